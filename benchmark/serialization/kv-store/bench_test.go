@@ -310,6 +310,18 @@ func writeSizes(filename string, sizes []int) error {
 	return nil
 }
 
+// meanSize returns the mean of the payload sizes, reported as the B/msg metric
+func meanSize(sizes []int) float64 {
+	if len(sizes) == 0 {
+		return 0
+	}
+	total := 0
+	for _, s := range sizes {
+		total += s
+	}
+	return float64(total) / float64(len(sizes))
+}
+
 func BenchmarkProtobuf_Write(b *testing.B) {
 	timings := make([]int64, 0, b.N)
 	sizes := make([]int, 0, b.N)
@@ -339,6 +351,7 @@ func BenchmarkProtobuf_Write(b *testing.B) {
 		nsPerOp := float64(b.Elapsed().Nanoseconds()) / float64(b.N)
 		msgPerSec := 1e9 / nsPerOp
 		b.ReportMetric(msgPerSec, "msg/s")
+		b.ReportMetric(meanSize(sizes), "B/msg")
 	}
 	if err := writeTimings("protobuf_write_times.txt", timings); err != nil {
 		b.Logf("Failed to write timing data: %v", err)
@@ -423,6 +436,7 @@ func BenchmarkFlatBuffers_Write(b *testing.B) {
 		nsPerOp := float64(b.Elapsed().Nanoseconds()) / float64(b.N)
 		msgPerSec := 1e9 / nsPerOp
 		b.ReportMetric(msgPerSec, "msg/s")
+		b.ReportMetric(meanSize(sizes), "B/msg")
 	}
 	if err := writeTimings("flatbuffers_write_times.txt", timings); err != nil {
 		b.Logf("Failed to write timing data: %v", err)
@@ -500,6 +514,7 @@ func BenchmarkCapnp_Write(b *testing.B) {
 		nsPerOp := float64(b.Elapsed().Nanoseconds()) / float64(b.N)
 		msgPerSec := 1e9 / nsPerOp
 		b.ReportMetric(msgPerSec, "msg/s")
+		b.ReportMetric(meanSize(sizes), "B/msg")
 	}
 	if err := writeTimings("capnp_write_times.txt", timings); err != nil {
 		b.Logf("Failed to write timing data: %v", err)
@@ -578,6 +593,7 @@ func BenchmarkSymphony_Write(b *testing.B) {
 		nsPerOp := float64(b.Elapsed().Nanoseconds()) / float64(b.N)
 		msgPerSec := 1e9 / nsPerOp
 		b.ReportMetric(msgPerSec, "msg/s")
+		b.ReportMetric(meanSize(sizes), "B/msg")
 	}
 	if err := writeTimings("symphony_write_times.txt", timings); err != nil {
 		b.Logf("Failed to write timing data: %v", err)
@@ -693,6 +709,7 @@ func BenchmarkSymphonyHybrid_Write(b *testing.B) {
 		nsPerOp := float64(b.Elapsed().Nanoseconds()) / float64(b.N)
 		msgPerSec := 1e9 / nsPerOp
 		b.ReportMetric(msgPerSec, "msg/s")
+		b.ReportMetric(meanSize(sizes), "B/msg")
 	}
 	if err := writeTimings("symphony_hybrid_write_times.txt", timings); err != nil {
 		b.Logf("Failed to write timing data: %v", err)
@@ -774,6 +791,7 @@ func BenchmarkGob_Write(b *testing.B) {
 		nsPerOp := float64(b.Elapsed().Nanoseconds()) / float64(b.N)
 		msgPerSec := 1e9 / nsPerOp
 		b.ReportMetric(msgPerSec, "msg/s")
+		b.ReportMetric(meanSize(sizes), "B/msg")
 	}
 	if err := writeTimings("gob_write_times.txt", timings); err != nil {
 		b.Logf("Failed to write timing data: %v", err)
@@ -99,6 +99,7 @@ func BenchmarkProtobuf_Write(b *testing.B) {
 		nsPerOp := float64(b.Elapsed().Nanoseconds()) / float64(b.N)
 		msgPerSec := 1e9 / nsPerOp
 		b.ReportMetric(msgPerSec, "msg/s")
+		b.ReportMetric(meanSize(sizes), "B/msg")
 	}
 	if err := writeTimings("protobuf_write_times.txt", timings); err != nil {
 		b.Logf("Failed to write timing data: %v", err)
@@ -170,6 +171,7 @@ func BenchmarkFlatBuffers_Write(b *testing.B) {
 		nsPerOp := float64(b.Elapsed().Nanoseconds()) / float64(b.N)
 		msgPerSec := 1e9 / nsPerOp
 		b.ReportMetric(msgPerSec, "msg/s")
+		b.ReportMetric(meanSize(sizes), "B/msg")
 	}
 	if err := writeTimings("flatbuffers_write_times.txt", timings); err != nil {
 		b.Logf("Failed to write timing data: %v", err)
@@ -237,6 +239,7 @@ func BenchmarkCapnp_Write(b *testing.B) {
 		nsPerOp := float64(b.Elapsed().Nanoseconds()) / float64(b.N)
 		msgPerSec := 1e9 / nsPerOp
 		b.ReportMetric(msgPerSec, "msg/s")
+		b.ReportMetric(meanSize(sizes), "B/msg")
 	}
 	if err := writeTimings("capnp_write_times.txt", timings); err != nil {
 		b.Logf("Failed to write timing data: %v", err)
@@ -303,6 +306,7 @@ func BenchmarkSymphony_Write(b *testing.B) {
 		nsPerOp := float64(b.Elapsed().Nanoseconds()) / float64(b.N)
 		msgPerSec := 1e9 / nsPerOp
 		b.ReportMetric(msgPerSec, "msg/s")
+		b.ReportMetric(meanSize(sizes), "B/msg")
 	}
 	if err := writeTimings("symphony_write_times.txt", timings); err != nil {
 		b.Logf("Failed to write timing data: %v", err)
@@ -374,6 +378,7 @@ func BenchmarkSymphonyHybrid_Write(b *testing.B) {
 		nsPerOp := float64(b.Elapsed().Nanoseconds()) / float64(b.N)
 		msgPerSec := 1e9 / nsPerOp
 		b.ReportMetric(msgPerSec, "msg/s")
+		b.ReportMetric(meanSize(sizes), "B/msg")
 	}
 	if err := writeTimings("symphony_hybrid_write_times.txt", timings); err != nil {
 		b.Logf("Failed to write timing data: %v", err)
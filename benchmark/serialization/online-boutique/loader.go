@@ -2,8 +2,10 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -13,8 +15,17 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
-// loadAllPayloads loads all JSONL files from the payloads directory
+// loadAllPayloads loads all JSONL files from the payloads directory. PAYLOADS_DIR selects
+// another corpus laid out the same way, such as payloads recorded from real traffic, so the
+// comparison follows its size and shape distribution instead of the generated one.
 func loadAllPayloads() error {
+	if dir := os.Getenv("PAYLOADS_DIR"); dir != "" {
+		if _, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("failed to open PAYLOADS_DIR: %w", err)
+		}
+		return loadPayloadsDir(dir)
+	}
+
 	// Try to find payloads directory
 	var payloadsDir string
 	possiblePaths := []string{
@@ -33,7 +44,11 @@ func loadAllPayloads() error {
 	if payloadsDir == "" {
 		return fmt.Errorf("failed to find payloads directory. Tried: %v", possiblePaths)
 	}
+	return loadPayloadsDir(payloadsDir)
+}
 
+// loadPayloadsDir loads the <MessageType>.jsonl files of a directory
+func loadPayloadsDir(payloadsDir string) error {
 	// Get all JSONL files
 	files, err := filepath.Glob(filepath.Join(payloadsDir, "*.jsonl"))
 	if err != nil {
@@ -68,13 +83,22 @@ func loadPayloadFile(filename, typeName string) ([]PayloadEntry, error) {
 	}
 	defer file.Close()
 
+	// Lines are read whole, however long: recorded payloads can exceed the token limit of
+	// bufio.Scanner
 	var entries []PayloadEntry
-	scanner := bufio.NewScanner(file)
+	reader := bufio.NewReader(file)
 	lineNum := 0
 
-	for scanner.Scan() {
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(line) == 0 && err == io.EOF {
+			break
+		}
 		lineNum++
-		line := scanner.Bytes()
+		line = bytes.TrimRight(line, "\r\n")
 		if len(line) == 0 {
 			continue
 		}
@@ -100,10 +124,6 @@ func loadPayloadFile(filename, typeName string) ([]PayloadEntry, error) {
 		})
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
-	}
-
 	return entries, nil
 }
 
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	onlineboutique "github.com/appnet-org/arpc/benchmark/serialization/online-boutique/proto"
+)
+
+func TestLoadPayloadFile_LongLines(t *testing.T) {
+	// A recorded payload far beyond the 64 KiB token limit of bufio.Scanner, between short
+	// ones, the last without a trailing newline
+	text := strings.Repeat("x", 200*1024)
+	lines := []string{
+		`{"redirect_url":"https://ads.example.com/a","text":"short"}`,
+		`{"redirect_url":"https://ads.example.com/b","text":"` + text + `"}`,
+		``,
+		`{"redirect_url":"https://ads.example.com/c","text":"last"}`,
+	}
+	file := filepath.Join(t.TempDir(), "Ad.jsonl")
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "\r\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := loadPayloadFile(file, "Ad")
+	if err != nil {
+		t.Fatalf("loadPayloadFile failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Loaded %d entries, want 3", len(entries))
+	}
+	for i, want := range []string{"short", text, "last"} {
+		if got := entries[i].Message.(*onlineboutique.Ad).Text; got != want {
+			t.Errorf("Entry %d has a text of %d bytes, want %d", i, len(got), len(want))
+		}
+	}
+}
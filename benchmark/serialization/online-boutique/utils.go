@@ -49,3 +49,15 @@ func writeSizes(filename string, sizes []int) error {
 	}
 	return nil
 }
+
+// meanSize returns the mean of the payload sizes, reported as the B/msg metric
+func meanSize(sizes []int) float64 {
+	if len(sizes) == 0 {
+		return 0
+	}
+	total := 0
+	for _, s := range sizes {
+		total += s
+	}
+	return float64(total) / float64(len(sizes))
+}
@@ -0,0 +1,102 @@
+package arpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/rpc"
+	"github.com/appnet-org/arpc/pkg/rpc/element"
+	"github.com/appnet-org/arpc/pkg/serializer"
+)
+
+type (
+	// Client is a client of aRPC services, created by Dial
+	Client = rpc.Client
+	// DialOption configures a client created by Dial
+	DialOption = rpc.DialOption
+	// CallOption configures a call
+	CallOption = rpc.CallOption
+	// ConnectivityState is the state of a client's path to its servers
+	ConnectivityState = rpc.ConnectivityState
+	// RetryPolicy says which failed calls a client retries, and how
+	RetryPolicy = rpc.RetryPolicy
+	// Serializer is the codec of requests and responses
+	Serializer = serializer.Serializer
+	// Element is an RPC element run on the requests and responses of a client or server
+	Element = element.RPCElement
+)
+
+// Connectivity states, see rpc.ConnectivityState
+const (
+	Connecting       = rpc.Connecting
+	Ready            = rpc.Ready
+	TransientFailure = rpc.TransientFailure
+	Shutdown         = rpc.Shutdown
+)
+
+// ClientConn is the API of a client that applications call: the stable subset of Client.
+// Code holding a ClientConn rather than a *Client can be given a fake in tests.
+type ClientConn interface {
+	// Call makes an RPC call, retried according to the client's retry policy, if any
+	Call(ctx context.Context, service, method string, req, resp any, opts ...CallOption) error
+	// State returns the connectivity state of the client
+	State() ConnectivityState
+	// WaitForStateChange blocks until the state differs from source, returning true, or
+	// until ctx is done, returning false
+	WaitForStateChange(ctx context.Context, source ConnectivityState) bool
+	// Close closes the client and stops its background goroutines
+	Close() error
+}
+
+var _ ClientConn = (*Client)(nil)
+
+// Dial creates a client for target. It is DialContext with a background context.
+func Dial(target string, opts ...DialOption) (*Client, error) {
+	return rpc.Dial(target, opts...)
+}
+
+// DialContext creates a client for target configured by opts. With WithBlock, it waits
+// until the server answers a probe, ctx is done or the WithTimeout timeout expires.
+func DialContext(ctx context.Context, target string, opts ...DialOption) (*Client, error) {
+	return rpc.DialContext(ctx, target, opts...)
+}
+
+// WithSerializer sets the codec of requests and responses (default: Symphony)
+func WithSerializer(s Serializer) DialOption {
+	return rpc.WithSerializer(s)
+}
+
+// WithLocalAddr binds the client to a local UDP address (default: any available port)
+func WithLocalAddr(addr string) DialOption {
+	return rpc.WithLocalAddr(addr)
+}
+
+// WithElements sets the RPC elements that process the calls of the client
+func WithElements(elements ...Element) DialOption {
+	return rpc.WithElements(elements...)
+}
+
+// WithEncryption enables encryption with the default keys
+func WithEncryption() DialOption {
+	return rpc.WithEncryption()
+}
+
+// WithBlock makes Dial return only once the server answered a keepalive probe
+func WithBlock() DialOption {
+	return rpc.WithBlock()
+}
+
+// WithTimeout bounds how long a blocking Dial waits for the server
+func WithTimeout(timeout time.Duration) DialOption {
+	return rpc.WithTimeout(timeout)
+}
+
+// WithUserAgent sets a string identifying the client, sent with every request
+func WithUserAgent(userAgent string) DialOption {
+	return rpc.WithUserAgent(userAgent)
+}
+
+// DefaultRetryPolicy returns a policy that retries throttled calls up to 3 times
+func DefaultRetryPolicy() *RetryPolicy {
+	return rpc.DefaultRetryPolicy()
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Report is the JSON form of a benchmark run
+type Report struct {
+	Context map[string]string `json:"context,omitempty"` // goos, goarch and cpu of the run
+	Results []*Result         `json:"results"`
+}
+
+// Result is a benchmark of a run. Runs of the same benchmark (go test -count) are merged:
+// metrics hold their mean.
+type Result struct {
+	Package    string             `json:"package,omitempty"`
+	Name       string             `json:"name"`             // without the Benchmark prefix and -GOMAXPROCS suffix
+	Format     string             `json:"format,omitempty"` // format of <Format>_<Operation> names, as in benchmark/serialization
+	Procs      int                `json:"procs,omitempty"`
+	Runs       int                `json:"runs"`
+	Iterations int64              `json:"iterations"` // summed over the runs
+	Metrics    map[string]float64 `json:"metrics"`    // by unit: ns/op, B/op, allocs/op, B/msg, msg/s...
+}
+
+// key identifies a benchmark across reports
+func (r *Result) key() string {
+	if r.Package == "" {
+		return r.Name
+	}
+	return r.Package + "." + r.Name
+}
+
+// ParseBenchmarks reads the output of go test -bench. Lines other than benchmark results
+// and the goos/goarch/pkg/cpu headers are ignored.
+func ParseBenchmarks(in io.Reader) (*Report, error) {
+	report := &Report{Context: make(map[string]string)}
+	byKey := make(map[string]*Result)
+	pkg := ""
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if key, value, ok := strings.Cut(line, ": "); ok {
+			switch key {
+			case "pkg":
+				pkg = value
+				continue
+			case "goos", "goarch", "cpu":
+				report.Context[key] = value
+				continue
+			}
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 4 || len(fields)%2 != 0 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		iterations, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		metrics := make(map[string]float64, len(fields)/2-1)
+		for i := 2; i < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("benchmark %s: invalid value %q", fields[0], fields[i])
+			}
+			metrics[fields[i+1]] = value
+		}
+
+		name, procs := splitProcs(strings.TrimPrefix(fields[0], "Benchmark"))
+		r := &Result{Package: pkg, Name: name, Procs: procs}
+		if prev, ok := byKey[r.key()]; ok {
+			prev.merge(iterations, metrics)
+			continue
+		}
+		if format, _, ok := strings.Cut(name, "_"); ok && !strings.Contains(format, "/") {
+			r.Format = format
+		}
+		r.Runs = 1
+		r.Iterations = iterations
+		r.Metrics = metrics
+		byKey[r.key()] = r
+		report.Results = append(report.Results, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// splitProcs splits the -GOMAXPROCS suffix off a benchmark name
+func splitProcs(name string) (string, int) {
+	i := strings.LastIndexByte(name, '-')
+	if i < 0 {
+		return name, 0
+	}
+	procs, err := strconv.Atoi(name[i+1:])
+	if err != nil {
+		return name, 0
+	}
+	return name[:i], procs
+}
+
+// merge adds a run to r, keeping the mean of every metric
+func (r *Result) merge(iterations int64, metrics map[string]float64) {
+	for unit, value := range metrics {
+		r.Metrics[unit] = (r.Metrics[unit]*float64(r.Runs) + value) / float64(r.Runs+1)
+	}
+	r.Runs++
+	r.Iterations += iterations
+}
+
+// Change is the difference of a metric between two reports
+type Change struct {
+	Benchmark string
+	Unit      string
+	Old, New  float64
+	Percent   float64 // relative change; positive is worse
+	Regressed bool    // whether Percent exceeds the unit's threshold
+}
+
+func (c Change) String() string {
+	status := "ok"
+	if c.Regressed {
+		status = "REGRESSION"
+	}
+	return fmt.Sprintf("%-10s %s %s: %g -> %g (%+.1f%%)", status, c.Benchmark, c.Unit, c.Old, c.New, c.Percent)
+}
+
+// higherIsBetter reports whether an increase of the unit is an improvement, as for
+// throughputs (msg/s, MB/s)
+func higherIsBetter(unit string) bool {
+	return strings.HasSuffix(unit, "/s")
+}
+
+// Compare diffs the metrics of the benchmarks of both reports. A change regresses if it
+// worsens its unit by more than the unit's threshold, in percent; units without one are
+// reported but never regress. Benchmarks missing from either report are returned by name.
+func Compare(old, cur *Report, thresholds map[string]float64) (changes []Change, missing []string) {
+	oldByKey := make(map[string]*Result, len(old.Results))
+	for _, r := range old.Results {
+		oldByKey[r.key()] = r
+	}
+	seen := make(map[string]bool, len(cur.Results))
+	for _, r := range cur.Results {
+		prev, ok := oldByKey[r.key()]
+		if !ok {
+			missing = append(missing, r.key())
+			continue
+		}
+		seen[r.key()] = true
+
+		units := make([]string, 0, len(r.Metrics))
+		for unit := range r.Metrics {
+			if _, ok := prev.Metrics[unit]; ok {
+				units = append(units, unit)
+			}
+		}
+		sort.Strings(units)
+		for _, unit := range units {
+			c := Change{Benchmark: r.key(), Unit: unit, Old: prev.Metrics[unit], New: r.Metrics[unit]}
+			switch {
+			case c.Old == c.New:
+			case c.Old == 0:
+				c.Percent = math.Inf(1)
+			default:
+				c.Percent = (c.New - c.Old) / c.Old * 100
+			}
+			if higherIsBetter(unit) {
+				c.Percent = -c.Percent
+			}
+			if threshold, ok := thresholds[unit]; ok && c.Percent > threshold {
+				c.Regressed = true
+			}
+			changes = append(changes, c)
+		}
+	}
+	for _, r := range old.Results {
+		if !seen[r.key()] {
+			missing = append(missing, r.key())
+		}
+	}
+	return changes, missing
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+const benchOutput = `goos: linux
+goarch: amd64
+pkg: github.com/appnet-org/arpc/benchmark/serialization/kv-store
+cpu: Intel(R) Xeon(R) Gold 6142 CPU @ 2.60GHz
+BenchmarkProtobuf_Write-64        727612    3205 ns/op    312026 msg/s    61.00 B/msg    421 B/op    0 allocs/op
+BenchmarkProtobuf_Write-64        727612    3405 ns/op    293686 msg/s    61.00 B/msg    421 B/op    0 allocs/op
+BenchmarkSymphony_Read-64         696314    2939 ns/op    340225 msg/s    1105 B/op    31 allocs/op
+--- some log line
+PASS
+ok      github.com/appnet-org/arpc/benchmark/serialization/kv-store      85.421s
+`
+
+func TestParseBenchmarks(t *testing.T) {
+	report, err := ParseBenchmarks(strings.NewReader(benchOutput))
+	if err != nil {
+		t.Fatalf("ParseBenchmarks failed: %v", err)
+	}
+	if report.Context["cpu"] != "Intel(R) Xeon(R) Gold 6142 CPU @ 2.60GHz" || report.Context["goos"] != "linux" {
+		t.Errorf("Unexpected context: %v", report.Context)
+	}
+	if len(report.Results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(report.Results))
+	}
+
+	// Both runs of Protobuf_Write are merged
+	w := report.Results[0]
+	if w.Name != "Protobuf_Write" || w.Format != "Protobuf" || w.Procs != 64 || w.Runs != 2 || w.Iterations != 2*727612 {
+		t.Errorf("Unexpected result: %+v", w)
+	}
+	if w.Metrics["ns/op"] != 3305 || w.Metrics["B/msg"] != 61 || w.Metrics["allocs/op"] != 0 {
+		t.Errorf("Unexpected metrics: %v", w.Metrics)
+	}
+	if k := report.Results[1].key(); k != "github.com/appnet-org/arpc/benchmark/serialization/kv-store.Symphony_Read" {
+		t.Errorf("Unexpected key %s", k)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	old := &Report{Results: []*Result{
+		{Name: "Symphony_Write", Metrics: map[string]float64{"ns/op": 100, "msg/s": 1000, "B/msg": 40, "allocs/op": 0}},
+		{Name: "Capnp_Write", Metrics: map[string]float64{"ns/op": 100}},
+	}}
+	cur := &Report{Results: []*Result{
+		{Name: "Symphony_Write", Metrics: map[string]float64{"ns/op": 105, "msg/s": 800, "B/msg": 44, "allocs/op": 1}},
+		{Name: "Gob_Write", Metrics: map[string]float64{"ns/op": 100}},
+	}}
+	thresholds := map[string]float64{"ns/op": 10, "B/msg": 5}
+
+	changes, missing := Compare(old, cur, thresholds)
+	byUnit := make(map[string]Change)
+	for _, c := range changes {
+		byUnit[c.Unit] = c
+	}
+	// 5% slower is within the threshold
+	if c := byUnit["ns/op"]; c.Regressed || c.Percent != 5 {
+		t.Errorf("ns/op: %v", c)
+	}
+	// Lower throughput is worse
+	if c := byUnit["msg/s"]; c.Percent != 20 || c.Regressed {
+		t.Errorf("msg/s: expected a 20%% worsening without threshold, got %v", c)
+	}
+	if c := byUnit["B/msg"]; !c.Regressed {
+		t.Errorf("B/msg: expected a regression, got %v", c)
+	}
+	if c := byUnit["allocs/op"]; !math.IsInf(c.Percent, 1) || c.Regressed {
+		t.Errorf("allocs/op: %v", c)
+	}
+	if len(missing) != 2 || missing[0] != "Gob_Write" || missing[1] != "Capnp_Write" {
+		t.Errorf("Unexpected missing benchmarks: %v", missing)
+	}
+}
@@ -0,0 +1,161 @@
+// benchjson turns the output of go test -bench into JSON and compares two such files, so
+// benchmark results can be tracked across commits by any automation.
+//
+// Usage:
+//
+//	go test -bench=. -benchmem | benchjson convert [-o results.json]
+//	benchjson compare [-threshold unit=percent]... old.json new.json
+//
+// compare prints every change and exits with status 1 if one exceeds the threshold of its
+// unit. The defaults are 10% for ns/op, B/op and allocs/op and 0% for B/msg, the payload
+// size reported by the serialization benchmarks.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "convert":
+		convert(os.Args[2:])
+	case "compare":
+		compare(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n  %s convert [-o results.json] [bench.txt]\n  %s compare [-threshold unit=percent]... old.json new.json\n", os.Args[0], os.Args[0])
+	os.Exit(2)
+}
+
+// convert writes the JSON report of go test -bench output read from a file or stdin
+func convert(args []string) {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	output := fs.String("o", "", "write the report to this file instead of stdout")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		usage()
+	}
+
+	in := os.Stdin
+	if fs.NArg() == 1 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	report, err := ParseBenchmarks(in)
+	if err != nil {
+		fatal(err)
+	}
+	if len(report.Results) == 0 {
+		fatal(fmt.Errorf("no benchmark results in the input"))
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fatal(err)
+	}
+	data = append(data, '\n')
+	if *output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		fatal(err)
+	}
+}
+
+// compare diffs two reports, exiting with status 1 on regressions
+func compare(args []string) {
+	thresholds := thresholdFlag{"ns/op": 10, "B/op": 10, "allocs/op": 10, "B/msg": 0}
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	fs.Var(thresholds, "threshold", "maximum worsening of a unit in percent, as unit=percent (repeatable)")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		usage()
+	}
+
+	old, err := loadReport(fs.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+	cur, err := loadReport(fs.Arg(1))
+	if err != nil {
+		fatal(err)
+	}
+
+	changes, missing := Compare(old, cur, thresholds)
+	failed := false
+	for _, c := range changes {
+		fmt.Println(c)
+		failed = failed || c.Regressed
+	}
+	for _, name := range missing {
+		fmt.Printf("%-10s %s: only in one of the reports\n", "missing", name)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// loadReport reads a report written by convert
+func loadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("%s: not a benchmark report: %w", path, err)
+	}
+	return report, nil
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}
+
+// thresholdFlag collects unit=percent flags, overriding the defaults it starts with
+type thresholdFlag map[string]float64
+
+func (t thresholdFlag) String() string {
+	units := make([]string, 0, len(t))
+	for unit := range t {
+		units = append(units, unit)
+	}
+	sort.Strings(units)
+	parts := make([]string, len(units))
+	for i, unit := range units {
+		parts[i] = fmt.Sprintf("%s=%g", unit, t[unit])
+	}
+	return strings.Join(parts, ",")
+}
+
+func (t thresholdFlag) Set(value string) error {
+	unit, percent, ok := strings.Cut(value, "=")
+	if !ok || unit == "" {
+		return fmt.Errorf("expected unit=percent, got %q", value)
+	}
+	p, err := strconv.ParseFloat(strings.TrimSuffix(percent, "%"), 64)
+	if err != nil || p < 0 {
+		return fmt.Errorf("invalid percentage %q", percent)
+	}
+	t[unit] = p
+	return nil
+}
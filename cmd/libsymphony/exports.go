@@ -0,0 +1,205 @@
+package main
+
+/*
+#define SYMPHONY_NO_PROTOTYPES
+#include <stdlib.h>
+#include "symphony.h"
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/schema"
+)
+
+// statusStrings are the descriptions of symphony_status_string, allocated once and never freed
+var statusStrings = func() map[status]*C.char {
+	m := make(map[status]*C.char)
+	for s := statusOK; s <= statusPartial; s++ {
+		m[s] = C.CString(s.String())
+	}
+	m[-1] = C.CString(status(-1).String())
+	return m
+}()
+
+// goBytes returns a slice of the C buffer, valid for the duration of the call
+func goBytes(data *C.uint8_t, n C.size_t) []byte {
+	if n == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(data)), int(n))
+}
+
+//export symphony_abi_version
+func symphony_abi_version() C.int {
+	return C.SYMPHONY_ABI_VERSION
+}
+
+//export symphony_status_string
+func symphony_status_string(s C.int) *C.char {
+	if str, ok := statusStrings[status(s)]; ok {
+		return str
+	}
+	return statusStrings[-1]
+}
+
+//export symphony_load_schema_file
+func symphony_load_schema_file(path *C.char) C.int {
+	if path == nil {
+		return C.int(statusInvalidArgument)
+	}
+	return C.int(loadSchemaFile(schema.Global, C.GoString(path)))
+}
+
+//export symphony_load_schema
+func symphony_load_schema(blob *C.uint8_t, n C.size_t) C.int {
+	if blob == nil {
+		return C.int(statusInvalidArgument)
+	}
+	if err := schema.Global.RegisterEncoded(goBytes(blob, n)); err != nil {
+		return C.int(statusMalformed)
+	}
+	return C.int(statusOK)
+}
+
+//export symphony_parse_packet
+func symphony_parse_packet(data *C.uint8_t, n C.size_t, out *C.symphony_packet) C.int {
+	if data == nil || out == nil {
+		return C.int(statusInvalidArgument)
+	}
+	p, st := parsePacket(goBytes(data, n))
+	if st != statusOK {
+		return C.int(st)
+	}
+	*out = C.symphony_packet{
+		_type:             C.uint8_t(p.typeID),
+		rpc_id:            C.uint64_t(p.rpcID),
+		total_packets:     C.uint16_t(p.totalPackets),
+		seq_number:        C.uint16_t(p.seqNumber),
+		more_fragments:    cBool(p.moreFragments),
+		fragment_index:    C.uint8_t(p.fragmentIndex),
+		dst_port:          C.uint16_t(p.dstPort),
+		src_port:          C.uint16_t(p.srcPort),
+		extensions_offset: C.size_t(p.layout.Extensions),
+		extensions_length: C.size_t(p.layout.ExtensionsLen),
+		payload_offset:    C.size_t(p.layout.Payload),
+		payload_length:    C.size_t(p.layout.PayloadLen),
+	}
+	for i := range 4 {
+		out.dst_ip[i] = C.uint8_t(p.dstIP[i])
+		out.src_ip[i] = C.uint8_t(p.srcIP[i])
+	}
+	return C.int(statusOK)
+}
+
+//export symphony_packet_extension
+func symphony_packet_extension(data *C.uint8_t, n C.size_t, t C.uint8_t, offset, length *C.size_t) C.int {
+	if data == nil || offset == nil || length == nil {
+		return C.int(statusInvalidArgument)
+	}
+	start, size, st := packetExtension(goBytes(data, n), packet.ExtensionType(t))
+	if st != statusOK {
+		return C.int(st)
+	}
+	*offset, *length = C.size_t(start), C.size_t(size)
+	return C.int(statusOK)
+}
+
+//export symphony_parse_header
+func symphony_parse_header(data *C.uint8_t, n C.size_t, out *C.symphony_header) C.int {
+	if data == nil || out == nil {
+		return C.int(statusInvalidArgument)
+	}
+	h, st := parseHeader(goBytes(data, n))
+	if st != statusOK {
+		return C.int(st)
+	}
+	*out = C.symphony_header{
+		version:           C.uint8_t(h.version),
+		offset_to_private: C.uint32_t(h.offsetToPrivate),
+		service_id:        C.uint32_t(h.serviceID),
+		method_id:         C.uint32_t(h.methodID),
+	}
+	return C.int(statusOK)
+}
+
+//export symphony_public_field
+func symphony_public_field(message *C.char, data *C.uint8_t, n C.size_t, name *C.char, out *C.symphony_field) C.int {
+	if message == nil || data == nil || name == nil || out == nil {
+		return C.int(statusInvalidArgument)
+	}
+	f, st := publicField(schema.Global, C.GoString(message), goBytes(data, n), C.GoString(name))
+	if st != statusOK {
+		return C.int(st)
+	}
+	*out = C.symphony_field{
+		kind:     C.int32_t(f.kind),
+		repeated: cBool(f.repeated),
+		present:  cBool(f.present),
+		count:    C.uint32_t(f.count),
+		offset:   C.size_t(f.offset),
+		length:   C.size_t(f.length),
+		i64:      C.int64_t(f.i64),
+		u64:      C.uint64_t(f.u64),
+		f64:      C.double(f.f64),
+	}
+	return C.int(statusOK)
+}
+
+//export symphony_decode_json
+func symphony_decode_json(message *C.char, data *C.uint8_t, n C.size_t, out **C.char, outLen *C.size_t) C.int {
+	if message == nil || data == nil || out == nil {
+		return C.int(statusInvalidArgument)
+	}
+	json, st := decodeJSON(schema.Global, C.GoString(message), goBytes(data, n))
+	return returnJSON(json, st, out, outLen)
+}
+
+//export symphony_decode_request_json
+func symphony_decode_request_json(data *C.uint8_t, n C.size_t, out **C.char, outLen *C.size_t) C.int {
+	if data == nil || out == nil {
+		return C.int(statusInvalidArgument)
+	}
+	json, st := decodeRequestJSON(schema.Global, goBytes(data, n))
+	return returnJSON(json, st, out, outLen)
+}
+
+//export symphony_encode_json
+func symphony_encode_json(message *C.char, json *C.char, n C.size_t, out **C.uint8_t, outLen *C.size_t) C.int {
+	if message == nil || json == nil || out == nil || outLen == nil {
+		return C.int(statusInvalidArgument)
+	}
+	data, st := encodeJSON(schema.Global, C.GoString(message), C.GoBytes(unsafe.Pointer(json), C.int(n)))
+	if st != statusOK {
+		return C.int(st)
+	}
+	*out = (*C.uint8_t)(C.CBytes(data))
+	*outLen = C.size_t(len(data))
+	return C.int(statusOK)
+}
+
+//export symphony_free
+func symphony_free(ptr unsafe.Pointer) {
+	C.free(ptr)
+}
+
+// returnJSON stores a NUL-terminated copy of json in out, and its length in outLen if set
+func returnJSON(json []byte, st status, out **C.char, outLen *C.size_t) C.int {
+	if st != statusOK {
+		return C.int(st)
+	}
+	*out = C.CString(string(json))
+	if outLen != nil {
+		*outLen = C.size_t(len(json))
+	}
+	return C.int(statusOK)
+}
+
+func cBool(b bool) C.int32_t {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"math"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/schema"
+	"github.com/appnet-org/arpc/pkg/transport"
+)
+
+// status is the result of a call of the C API. The values are those of symphony.h, which
+// is the stable API: they must never change.
+type status int
+
+const (
+	statusOK status = iota
+	statusMalformed
+	statusUnknownMessage
+	statusUnknownField
+	statusUnsupported
+	statusInvalidArgument
+	statusIO
+	statusPartial
+)
+
+func (s status) String() string {
+	switch s {
+	case statusOK:
+		return "ok"
+	case statusMalformed:
+		return "malformed data"
+	case statusUnknownMessage:
+		return "unknown message"
+	case statusUnknownField:
+		return "unknown field"
+	case statusUnsupported:
+		return "unsupported field"
+	case statusInvalidArgument:
+		return "invalid argument"
+	case statusIO:
+		return "I/O error"
+	case statusPartial:
+		return "some schemas have no Symphony encoding"
+	default:
+		return "unknown status"
+	}
+}
+
+// header is the reserved header of a message, at the start of its public segment
+type header struct {
+	version         uint8
+	offsetToPrivate uint32
+	serviceID       uint32
+	methodID        uint32
+}
+
+// field is a public field as the C API reports it: where its value is in the data, and the
+// value itself for fixed-length fields
+type field struct {
+	kind     schema.Kind
+	repeated bool
+	present  bool
+	count    int // items of a repeated field
+	offset   int // of the value, string, bytes, nested message or items in data
+	length   int
+	i64      int64   // bool, int32, int64 and enum values
+	u64      uint64  // uint32 and uint64 values
+	f64      float64 // float and double values
+}
+
+// packetInfo is a datagram as the C API reports it: the fixed fields of its header, and
+// where its extensions and payload are
+type packetInfo struct {
+	typeID        packet.PacketTypeID
+	rpcID         uint64
+	totalPackets  uint16
+	seqNumber     uint16
+	moreFragments bool
+	fragmentIndex uint8
+	dstIP         [4]byte
+	dstPort       uint16
+	srcIP         [4]byte
+	srcPort       uint16
+	layout        packet.Layout
+}
+
+// parsePacket reads the header of a datagram, without copying it. NAT traversal datagrams
+// carry no RPC, and are unsupported.
+func parsePacket(data []byte) (packetInfo, status) {
+	if len(data) > 0 && data[0] == byte(transport.NATPacketTypeID) {
+		return packetInfo{}, statusUnsupported
+	}
+	layout, err := packet.ParseLayout(data)
+	if err != nil {
+		return packetInfo{}, statusMalformed
+	}
+	p := packetInfo{typeID: packet.PacketTypeID(data[packet.OffsetPacketType]), layout: layout}
+	if layout.Error {
+		p.rpcID = binary.LittleEndian.Uint64(data[packet.ErrorOffsetRPCID:])
+		copy(p.dstIP[:], data[packet.ErrorOffsetDstIP:])
+		p.dstPort = binary.LittleEndian.Uint16(data[packet.ErrorOffsetDstPort:])
+		copy(p.srcIP[:], data[packet.ErrorOffsetSrcIP:])
+		p.srcPort = binary.LittleEndian.Uint16(data[packet.ErrorOffsetSrcPort:])
+		return p, statusOK
+	}
+	p.rpcID = binary.LittleEndian.Uint64(data[packet.OffsetRPCID:])
+	p.totalPackets = binary.LittleEndian.Uint16(data[packet.OffsetTotalPackets:])
+	p.seqNumber = binary.LittleEndian.Uint16(data[packet.OffsetSeqNumber:])
+	p.moreFragments = data[packet.OffsetFlags]&packet.FlagMoreFragments != 0
+	p.fragmentIndex = data[packet.OffsetFragmentIndex]
+	copy(p.dstIP[:], data[packet.OffsetDstIP:])
+	p.dstPort = binary.LittleEndian.Uint16(data[packet.OffsetDstPort:])
+	copy(p.srcIP[:], data[packet.OffsetSrcIP:])
+	p.srcPort = binary.LittleEndian.Uint16(data[packet.OffsetSrcPort:])
+	return p, statusOK
+}
+
+// packetExtension locates the value of the first extension of the given type in a datagram
+func packetExtension(data []byte, t packet.ExtensionType) (offset, length int, st status) {
+	p, st := parsePacket(data)
+	if st != statusOK {
+		return 0, 0, st
+	}
+	// ParseLayout checked the entries of the area
+	pos, end := p.layout.Extensions, p.layout.Extensions+p.layout.ExtensionsLen
+	for pos < end {
+		size := int(data[pos+1])
+		if packet.ExtensionType(data[pos]) == t {
+			return pos + 2, size, statusOK
+		}
+		pos += 2 + size
+	}
+	return 0, 0, statusUnknownField
+}
+
+func parseHeader(data []byte) (header, status) {
+	if len(data) < 13 || data[0] != 0x01 {
+		return header{}, statusMalformed
+	}
+	return header{
+		version:         data[0],
+		offsetToPrivate: binary.LittleEndian.Uint32(data[1:5]),
+		serviceID:       binary.LittleEndian.Uint32(data[5:9]),
+		methodID:        binary.LittleEndian.Uint32(data[9:13]),
+	}, statusOK
+}
+
+// publicField reads a public field of a message of the named type from data, which may hold
+// the public segment only. Nothing is copied: offset and length locate the field in data.
+// Delta encoded and interned fields are not stored as plain values, and are unsupported.
+func publicField(r *schema.Registry, message string, data []byte, name string) (field, status) {
+	m, ok := r.Message(message)
+	if !ok {
+		return field{}, statusUnknownMessage
+	}
+	f := m.FieldByName(name)
+	if f == nil || !f.Public {
+		return field{}, statusUnknownField
+	}
+	if f.Delta || f.Interned {
+		return field{}, statusUnsupported
+	}
+	offset, _, ok, err := m.PublicPayload(data, name)
+	if err != nil {
+		return field{}, statusMalformed
+	}
+	out := field{kind: f.Kind, repeated: f.Repeated, present: ok}
+	if !ok {
+		return out, statusOK
+	}
+
+	size := f.Kind.Size()
+	if size > 0 && !f.Repeated {
+		out.offset, out.length = offset, size
+		setFixed(&out, data[offset:offset+size])
+		return out, statusOK
+	}
+	n, ok := readUint32(data, offset)
+	if !ok {
+		return field{}, statusMalformed
+	}
+	out.offset = offset + 4
+	switch {
+	case !f.Repeated:
+		out.length = n
+	case size > 0:
+		out.count = n
+		if n > len(data)/size {
+			return field{}, statusMalformed
+		}
+		out.length = n * size
+	default:
+		// Each item is its length, then its bytes
+		out.count = n
+		pos := out.offset
+		for range n {
+			itemSize, ok := readUint32(data, pos)
+			if !ok || itemSize > len(data)-pos-4 {
+				return field{}, statusMalformed
+			}
+			pos += 4 + itemSize
+		}
+		out.length = pos - out.offset
+	}
+	if out.length > len(data)-out.offset {
+		return field{}, statusMalformed
+	}
+	return out, statusOK
+}
+
+// setFixed sets the value of a fixed-length field from its bytes
+func setFixed(f *field, b []byte) {
+	switch f.kind {
+	case schema.KindBool:
+		if b[0] != 0 {
+			f.i64 = 1
+		}
+	case schema.KindInt32, schema.KindEnum:
+		f.i64 = int64(int32(binary.LittleEndian.Uint32(b)))
+	case schema.KindInt64:
+		f.i64 = int64(binary.LittleEndian.Uint64(b))
+	case schema.KindUint32:
+		f.u64 = uint64(binary.LittleEndian.Uint32(b))
+	case schema.KindUint64:
+		f.u64 = binary.LittleEndian.Uint64(b)
+	case schema.KindFloat:
+		f.f64 = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	case schema.KindDouble:
+		f.f64 = math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+}
+
+func readUint32(data []byte, offset int) (int, bool) {
+	if offset < 0 || offset > len(data)-4 {
+		return 0, false
+	}
+	return int(binary.LittleEndian.Uint32(data[offset:])), true
+}
+
+// decodeJSON decodes a message of the named type and renders it as MarshalJSON does, with
+// sensitive fields redacted
+func decodeJSON(r *schema.Registry, message string, data []byte) ([]byte, status) {
+	if _, ok := r.Message(message); !ok {
+		return nil, statusUnknownMessage
+	}
+	d, err := r.Decode(data, message)
+	if err != nil {
+		return nil, statusMalformed
+	}
+	return marshalJSON(d)
+}
+
+// decodeRequestJSON decodes a request, whose message is given by the method IDs of its
+// header, and renders it as decodeJSON does
+func decodeRequestJSON(r *schema.Registry, data []byte) ([]byte, status) {
+	h, st := parseHeader(data)
+	if st != statusOK {
+		return nil, st
+	}
+	method, ok := r.Method(h.serviceID, h.methodID)
+	if !ok {
+		return nil, statusUnknownMessage
+	}
+	return decodeJSON(r, method.Request, data)
+}
+
+func marshalJSON(d *schema.DynamicMessage) ([]byte, status) {
+	out, err := json.Marshal(d)
+	if err != nil {
+		return nil, statusUnsupported // NaN and infinite floats have no JSON form
+	}
+	return out, statusOK
+}
+
+// encodeJSON encodes a message of the named type from its JSON form, with service and
+// method IDs 0
+func encodeJSON(r *schema.Registry, message string, data []byte) ([]byte, status) {
+	if _, ok := r.Message(message); !ok {
+		return nil, statusUnknownMessage
+	}
+	d, err := r.DecodeJSON(data, message)
+	if err != nil {
+		return nil, statusInvalidArgument
+	}
+	out, err := r.Encode(d)
+	if err != nil {
+		return nil, statusInvalidArgument
+	}
+	return out, statusOK
+}
+
+// loadSchemaFile registers the schemas of a FileDescriptorSet or schema blob file. Messages
+// and methods without a Symphony encoding are skipped and reported as statusPartial, the
+// others are still registered, as the proxy does.
+func loadSchemaFile(r *schema.Registry, path string) status {
+	err := r.LoadFile(path)
+	var pathErr *fs.PathError
+	var skipped interface{ Unwrap() []error } // the errors.Join of RegisterFileDescriptorSet
+	switch {
+	case err == nil:
+		return statusOK
+	case errors.As(err, &pathErr):
+		return statusIO
+	case errors.As(err, &skipped):
+		return statusPartial
+	}
+	return statusMalformed
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	Test "github.com/appnet-org/arpc/cmd/symphony-gen-arpc/test"
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/schema"
+	"github.com/appnet-org/arpc/pkg/transport"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+var testMessage = &Test.ComplexMixed{
+	FInt32:     7,
+	VString:    "public",
+	RInt64:     []int64{1, 2},
+	NestedLeaf: &Test.Leaf{LeafId: 4, LeafVal: "Nested"},
+	FBool:      true,
+	VBytes:     []byte{0x00, 0x01},
+}
+
+func TestPublicField(t *testing.T) {
+	data, err := testMessage.MarshalSymphony()
+	if err != nil {
+		t.Fatalf("MarshalSymphony failed: %v", err)
+	}
+	h, st := parseHeader(data)
+	if st != statusOK || h.version != 0x01 || int(h.offsetToPrivate) >= len(data) {
+		t.Fatalf("parseHeader() = %+v, %v", h, st)
+	}
+	public := data[:h.offsetToPrivate]
+
+	f, st := publicField(schema.Global, "Test.ComplexMixed", public, "v_string")
+	if st != statusOK || !f.present || f.kind != schema.KindString || string(public[f.offset:f.offset+f.length]) != "public" {
+		t.Errorf("publicField(v_string) = %+v, %v", f, st)
+	}
+	if f, st = publicField(schema.Global, "Test.ComplexMixed", public, "f_bool"); st != statusOK || f.i64 != 1 {
+		t.Errorf("publicField(f_bool) = %+v, %v", f, st)
+	}
+	f, st = publicField(schema.Global, "Test.ComplexMixed", public, "nested_leaf")
+	if st != statusOK || !f.present {
+		t.Fatalf("publicField(nested_leaf) = %+v, %v", f, st)
+	}
+	if leaf, st := publicField(schema.Global, "Test.Leaf", public[f.offset:f.offset+f.length], "leaf_id"); st != statusOK || leaf.i64 != 4 {
+		t.Errorf("publicField(nested_leaf.leaf_id) = %+v, %v", leaf, st)
+	}
+
+	// Repeated fields report their items
+	repeated := &Test.RepeatedVar{RString: []string{"a", "bc"}}
+	data, _ = repeated.MarshalSymphony()
+	if f, st = publicField(schema.Global, "Test.RepeatedVar", data, "r_string"); st != statusOK || f.count != 2 || f.length != 11 {
+		t.Errorf("publicField(r_string) = %+v, %v, want 2 items of 11 bytes", f, st)
+	}
+
+	for _, tt := range []struct {
+		message, field string
+		data           []byte
+		expected       status
+	}{
+		{"Test.Missing", "v_string", public, statusUnknownMessage},
+		{"Test.ComplexMixed", "f_int32", public, statusUnknownField},
+		{"Test.ComplexMixed", "v_bytes", public[:20], statusMalformed},
+		{"Test.Catalog", "region", public, statusUnsupported},
+	} {
+		if _, st := publicField(schema.Global, tt.message, tt.data, tt.field); st != tt.expected {
+			t.Errorf("publicField(%s, %s) = %v, want %v", tt.message, tt.field, st, tt.expected)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	data, _ := testMessage.MarshalSymphony()
+	out, st := decodeJSON(schema.Global, "Test.ComplexMixed", data)
+	if st != statusOK || !strings.Contains(string(out), `"v_string":"public"`) {
+		t.Fatalf("decodeJSON() = %s, %v", out, st)
+	}
+	encoded, st := encodeJSON(schema.Global, "Test.ComplexMixed", out)
+	if st != statusOK || string(encoded) != string(data) {
+		t.Errorf("encodeJSON() = %x, %v, want %x", encoded, st, data)
+	}
+	if _, st := encodeJSON(schema.Global, "Test.ComplexMixed", []byte(`{"f_int32":"x"}`)); st != statusInvalidArgument {
+		t.Errorf("encodeJSON() of a string int32 = %v, want %v", st, statusInvalidArgument)
+	}
+	if _, st := decodeJSON(schema.Global, "Test.ComplexMixed", data[:5]); st != statusMalformed {
+		t.Errorf("decodeJSON() of truncated data = %v, want %v", st, statusMalformed)
+	}
+
+	// Requests are found by the method IDs of their header
+	r := schema.NewRegistry()
+	if err := r.RegisterDescriptor(testMessage.ProtoReflect().Descriptor()); err != nil {
+		t.Fatalf("RegisterDescriptor failed: %v", err)
+	}
+	r.RegisterMethod(&schema.MethodSchema{ServiceID: 1, MethodID: 2, Request: "Test.ComplexMixed", Response: "Test.ComplexMixed"})
+	data[5], data[9] = 1, 2
+	if request, st := decodeRequestJSON(r, data); st != statusOK || string(request) != string(out) {
+		t.Errorf("decodeRequestJSON() = %s, %v, want %s", request, st, out)
+	}
+	data[9] = 3
+	if _, st := decodeRequestJSON(r, data); st != statusUnknownMessage {
+		t.Errorf("decodeRequestJSON() of an unknown method = %v, want %v", st, statusUnknownMessage)
+	}
+}
+
+// packetVector is an RPC of the vectors of pkg/packet, with the public field of its payload
+type packetVector struct {
+	Name    string   `json:"name"`
+	Packets []string `json:"packets"`
+	Layouts []struct {
+		Extensions []struct {
+			Type  uint8  `json:"type"`
+			Value string `json:"value"`
+		} `json:"extensions"`
+		PayloadOffset int `json:"payload_offset"`
+		PayloadLength int `json:"payload_length"`
+	} `json:"layouts"`
+	Type                 uint8  `json:"type"`
+	RPCID                uint64 `json:"rpc_id"`
+	Dst                  string `json:"dst"`
+	Src                  string `json:"src"`
+	Error                string `json:"error"`
+	PublicSegmentPackets int    `json:"public_segment_packets"`
+	Message              string `json:"message"`
+	ServiceID            uint32 `json:"service_id"`
+	MethodID             uint32 `json:"method_id"`
+	VString              string `json:"v_string"`
+}
+
+func loadPacketVectors(t *testing.T) []packetVector {
+	t.Helper()
+	data, err := os.ReadFile("../../pkg/packet/testdata/vectors.json")
+	if err != nil {
+		t.Fatalf("Failed to read vectors: %v", err)
+	}
+	var vectors []packetVector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatalf("Failed to parse vectors: %v", err)
+	}
+	return vectors
+}
+
+// Datagrams are read as cmd/proxy reads them: the public segment of an RPC is read once the
+// payloads of its first packets hold it
+func TestPacketVectors(t *testing.T) {
+	for _, v := range loadPacketVectors(t) {
+		t.Run(v.Name, func(t *testing.T) {
+			var payload []byte
+			for i, h := range v.Packets {
+				data, _ := hex.DecodeString(h)
+				p, st := parsePacket(data)
+				if st != statusOK {
+					t.Fatalf("Packet %d: parsePacket() = %v", i, st)
+				}
+				dst := fmt.Sprintf("%d.%d.%d.%d:%d", p.dstIP[0], p.dstIP[1], p.dstIP[2], p.dstIP[3], p.dstPort)
+				src := fmt.Sprintf("%d.%d.%d.%d:%d", p.srcIP[0], p.srcIP[1], p.srcIP[2], p.srcIP[3], p.srcPort)
+				if uint8(p.typeID) != v.Type || p.rpcID != v.RPCID || dst != v.Dst || src != v.Src || p.layout.Payload != v.Layouts[i].PayloadOffset {
+					t.Errorf("Packet %d: parsePacket() = %+v", i, p)
+				}
+				for _, ext := range v.Layouts[i].Extensions {
+					offset, length, st := packetExtension(data, packet.ExtensionType(ext.Type))
+					if st != statusOK || hex.EncodeToString(data[offset:offset+length]) != ext.Value {
+						t.Errorf("Packet %d: packetExtension(%d) = %d, %d, %v, want %s", i, ext.Type, offset, length, st, ext.Value)
+					}
+				}
+				if v.Error != "" {
+					continue
+				}
+				if int(p.seqNumber) != i || int(p.totalPackets) != len(v.Packets) {
+					t.Errorf("Packet %d: got sequence number %d of %d", i, p.seqNumber, p.totalPackets)
+				}
+				if i >= v.PublicSegmentPackets {
+					continue
+				}
+				payload = append(payload, data[p.layout.Payload:p.layout.Payload+p.layout.PayloadLen]...)
+			}
+			if v.Error != "" {
+				return
+			}
+
+			h, st := parseHeader(payload)
+			if st != statusOK || h.serviceID != v.ServiceID || h.methodID != v.MethodID || int(h.offsetToPrivate) > len(payload) {
+				t.Fatalf("parseHeader() = %+v, %v", h, st)
+			}
+			f, st := publicField(schema.Global, v.Message, payload[:h.offsetToPrivate], "v_string")
+			if st != statusOK || string(payload[f.offset:f.offset+f.length]) != v.VString {
+				t.Errorf("publicField(v_string) = %+v, %v, want %q", f, st, v.VString)
+			}
+		})
+	}
+
+	if _, st := parsePacket([]byte{byte(transport.NATPacketTypeID), 1}); st != statusUnsupported {
+		t.Errorf("parsePacket() of a NAT traversal datagram = %v, want %v", st, statusUnsupported)
+	}
+	if _, st := parsePacket(make([]byte, 10)); st != statusMalformed {
+		t.Errorf("parsePacket() of a truncated packet = %v, want %v", st, statusMalformed)
+	}
+}
+
+// The C API reads the public fields of a payload, and its JSON form, as the Go code does
+func TestSharedLibrary(t *testing.T) {
+	gcc, err := exec.LookPath("gcc")
+	if err != nil {
+		t.Skip("gcc not found")
+	}
+	if testing.Short() {
+		t.Skip("building the shared library is slow")
+	}
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "libsymphony.so")
+	if out, err := exec.Command("go", "build", "-buildmode=c-shared", "-o", lib, ".").CombinedOutput(); err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+	reader := filepath.Join(dir, "reader")
+	if out, err := exec.Command(gcc, "-Wall", "-Werror", "-I.", "-o", reader, "testdata/reader.c", "-L"+dir, "-lsymphony").CombinedOutput(); err != nil {
+		t.Fatalf("gcc failed: %v\n%s", err, out)
+	}
+
+	// The schemas come from a descriptor set, as the library registers none of its own
+	files := []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(Test.File_test_proto)}
+	for i := 0; i < Test.File_test_proto.Imports().Len(); i++ {
+		files = append(files, protodesc.ToFileDescriptorProto(Test.File_test_proto.Imports().Get(i)))
+	}
+	set, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: files})
+	if err != nil {
+		t.Fatalf("Failed to marshal descriptor set: %v", err)
+	}
+	data, _ := testMessage.MarshalSymphony()
+	vector := loadPacketVectors(t)[1] // a request with extensions
+	datagram, _ := hex.DecodeString(vector.Packets[0])
+	for name, content := range map[string][]byte{"schema.binpb": set, "payload.bin": data, "packet.bin": datagram} {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	cmd := exec.Command(reader, filepath.Join(dir, "schema.binpb"), filepath.Join(dir, "payload.bin"), filepath.Join(dir, "packet.bin"))
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("reader failed: %v\n%s", err, out)
+	}
+
+	expectedJSON, _ := decodeJSON(schema.Global, "Test.ComplexMixed", data)
+	expected := strings.Join([]string{
+		"v_string public",
+		"f_bool 1",
+		"nested_leaf.leaf_id 4",
+		"json " + string(expectedJSON),
+		fmt.Sprintf("packet type 1 rpc %d seq 0/1 dst %s", vector.RPCID, vector.Dst),
+		"priority 7",
+		fmt.Sprintf("method %d/%d v_string %s", vector.ServiceID, vector.MethodID, vector.VString),
+	}, "\n") + "\n"
+	if string(out) != expected {
+		t.Errorf("Expected output\n%s\ngot\n%s", expected, out)
+	}
+}
@@ -0,0 +1,11 @@
+// libsymphony is a shared library exposing the Symphony encoding to C and C++ components,
+// such as Envoy filters, so that they can read the public segment of aRPC messages without
+// reimplementing the format. Its API is declared by symphony.h. Build it with
+//
+//	go build -buildmode=c-shared -o libsymphony.so ./cmd/libsymphony
+//
+// Schemas are registered with schema.Global: at runtime with symphony_load_schema_file, or
+// at build time by blank importing generated packages, whose init registers their schemas.
+package main
+
+func main() {}
@@ -0,0 +1,185 @@
+/*
+ * symphony.h - stable C API of libsymphony, the Symphony encoding of aRPC.
+ *
+ * Build the library with
+ *
+ *     go build -buildmode=c-shared -o libsymphony.so ./cmd/libsymphony
+ *
+ * and link with -lsymphony. Schemas are loaded at runtime from FileDescriptorSets or
+ * schema blobs, or linked into the library (see README.md). All functions are safe to
+ * call from several threads; the data passed to them is not retained.
+ *
+ * Buffers returned by the library are allocated with malloc and must be released with
+ * symphony_free. Offsets reported by symphony_parse_packet and symphony_public_field point
+ * into the data passed in, nothing is copied.
+ *
+ * This header is the ABI: values and layouts only change with SYMPHONY_ABI_VERSION.
+ */
+#ifndef SYMPHONY_H
+#define SYMPHONY_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+#define SYMPHONY_ABI_VERSION 1
+
+/* Results of the functions of the library */
+#define SYMPHONY_OK 0
+#define SYMPHONY_ERR_MALFORMED 1        /* data is not a valid encoding of the message */
+#define SYMPHONY_ERR_UNKNOWN_MESSAGE 2  /* no schema is registered for the message or method */
+#define SYMPHONY_ERR_UNKNOWN_FIELD 3    /* the message has no public field of that name */
+#define SYMPHONY_ERR_UNSUPPORTED 4      /* delta encoded or interned field, or value without JSON form */
+#define SYMPHONY_ERR_INVALID_ARGUMENT 5 /* NULL argument, or JSON not matching the schema */
+#define SYMPHONY_ERR_IO 6               /* the schema file cannot be read */
+#define SYMPHONY_PARTIAL 7              /* schemas without a Symphony encoding were skipped, the others are loaded */
+
+/* Kinds of fields, as in pkg/schema. Enums are int32 values. */
+#define SYMPHONY_KIND_BOOL 1
+#define SYMPHONY_KIND_INT32 2
+#define SYMPHONY_KIND_INT64 3
+#define SYMPHONY_KIND_UINT32 4
+#define SYMPHONY_KIND_UINT64 5
+#define SYMPHONY_KIND_FLOAT 6
+#define SYMPHONY_KIND_DOUBLE 7
+#define SYMPHONY_KIND_ENUM 8
+#define SYMPHONY_KIND_STRING 9
+#define SYMPHONY_KIND_BYTES 10
+#define SYMPHONY_KIND_MESSAGE 11
+
+/* Packet types of the datagrams of aRPC (see pkg/packet) */
+#define SYMPHONY_PACKET_UNKNOWN 0 /* an error packet, as sent by servers for plain handler errors */
+#define SYMPHONY_PACKET_REQUEST 1
+#define SYMPHONY_PACKET_RESPONSE 2
+#define SYMPHONY_PACKET_ERROR 3
+#define SYMPHONY_PACKET_NAT 0xFE /* NAT traversal datagrams, which carry no RPC */
+
+/* Types of header extensions. Forward the extensions of unknown types unchanged. */
+#define SYMPHONY_EXT_TRACE_CONTEXT 1 /* W3C traceparent */
+#define SYMPHONY_EXT_PRIORITY 2      /* 1 byte, higher is more important */
+#define SYMPHONY_EXT_DEADLINE 3      /* 8 bytes little-endian, unix nanoseconds */
+#define SYMPHONY_EXT_KEY_ID 4        /* identifier of the encryption key */
+#define SYMPHONY_EXT_AUTH_TAG 5      /* proof that the sender holds the encryption key */
+#define SYMPHONY_EXT_RECV_LIMIT 6    /* 4 bytes little-endian, largest response the client accepts */
+#define SYMPHONY_EXT_USER_AGENT 7    /* identifies the client software */
+#define SYMPHONY_EXT_RELAY 8         /* final destination and session token of a relayed RPC */
+
+/*
+ * The header of a datagram read by symphony_parse_packet. Payloads of a data packet are
+ * consecutive chunks of the message of the RPC, in seq_number order; the first starts with
+ * a symphony_header. Error packets have no fragments: their payload is the error message.
+ */
+typedef struct {
+    uint8_t type; /* SYMPHONY_PACKET_* */
+    uint64_t rpc_id;
+    uint16_t total_packets; /* data packets only */
+    uint16_t seq_number;    /* data packets only */
+    int32_t more_fragments; /* data packets only */
+    uint8_t fragment_index; /* data packets only */
+    uint8_t dst_ip[4];
+    uint16_t dst_port;
+    uint8_t src_ip[4];
+    uint16_t src_port;
+    size_t extensions_offset; /* of the extension TLVs: type (1 byte), length (1 byte), value */
+    size_t extensions_length; /* 0 without extensions */
+    size_t payload_offset;
+    size_t payload_length;
+} symphony_packet;
+
+/* The reserved header at the start of every message (13 bytes on the wire) */
+typedef struct {
+    uint8_t version;            /* 0x01 */
+    uint32_t offset_to_private; /* start of the private segment */
+    uint32_t service_id;        /* 0 in responses */
+    uint32_t method_id;         /* 0 in responses */
+} symphony_header;
+
+/*
+ * A public field read by symphony_public_field. Absent fields (and empty nested messages
+ * and lists) have present 0.
+ *
+ * - Fixed-length fields: the value is in i64 (bool, int32, int64, enum), u64 (uint32,
+ *   uint64) or f64 (float, double); offset and length locate it in the data.
+ * - Strings and bytes: offset and length locate the bytes.
+ * - Nested messages: offset and length locate the encoding of the nested message, which
+ *   can be read with symphony_public_field in turn.
+ * - Repeated fields: count is the number of items, and offset and length locate them:
+ *   packed little-endian values for fixed-length kinds, otherwise each item is a uint32
+ *   little-endian length followed by its bytes.
+ */
+typedef struct {
+    int32_t kind; /* SYMPHONY_KIND_* */
+    int32_t repeated;
+    int32_t present;
+    uint32_t count;
+    size_t offset;
+    size_t length;
+    int64_t i64;
+    uint64_t u64;
+    double f64;
+} symphony_field;
+
+#ifndef SYMPHONY_NO_PROTOTYPES
+
+/* Returns the SYMPHONY_ABI_VERSION the library was built with */
+int symphony_abi_version(void);
+
+/* Returns a static description of a status */
+const char *symphony_status_string(int status);
+
+/* Registers the schemas of a FileDescriptorSet (protoc --descriptor_set_out) or schema blob file */
+int symphony_load_schema_file(const char *path);
+
+/*
+ * Registers the schemas of a schema blob: one embedded by protoc-gen-symphony, or one
+ * served by GET /schemas of the admin API of cmd/proxy, which also holds methods
+ */
+int symphony_load_schema(const uint8_t *blob, size_t len);
+
+/* Reads the header of a datagram. NAT traversal datagrams return SYMPHONY_ERR_UNSUPPORTED. */
+int symphony_parse_packet(const uint8_t *data, size_t len, symphony_packet *out);
+
+/*
+ * Locates the value of the first extension of a type (SYMPHONY_EXT_*) in a datagram.
+ * Returns SYMPHONY_ERR_UNKNOWN_FIELD if the datagram has none.
+ */
+int symphony_packet_extension(const uint8_t *data, size_t len, uint8_t type, size_t *offset, size_t *length);
+
+/* Reads the header of a message; data may hold the header only */
+int symphony_parse_header(const uint8_t *data, size_t len, symphony_header *out);
+
+/*
+ * Reads a public field of a message of the named type, e.g. "kv.SetRequest". data may
+ * hold the public segment only.
+ */
+int symphony_public_field(const char *message, const uint8_t *data, size_t len, const char *field, symphony_field *out);
+
+/*
+ * Decodes a message of the named type into a NUL-terminated JSON object keyed by field
+ * name, with sensitive fields redacted and bytes base64-encoded. Release *json with
+ * symphony_free.
+ */
+int symphony_decode_json(const char *message, const uint8_t *data, size_t len, char **json, size_t *json_len);
+
+/* Decodes a request as symphony_decode_json, finding its message by the method IDs of its header */
+int symphony_decode_request_json(const uint8_t *data, size_t len, char **json, size_t *json_len);
+
+/*
+ * Encodes a message of the named type from the JSON form of symphony_decode_json, with
+ * service and method IDs 0. Release *out with symphony_free.
+ */
+int symphony_encode_json(const char *message, const char *json, size_t json_len, uint8_t **out, size_t *out_len);
+
+/* Releases a buffer returned by the library */
+void symphony_free(void *ptr);
+
+#endif /* SYMPHONY_NO_PROTOTYPES */
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif /* SYMPHONY_H */
@@ -0,0 +1,121 @@
+/*
+ * reader reads a Test.ComplexMixed payload through libsymphony, the way a C component of a
+ * proxy would, and prints the JSON form of the message. It then reads the datagram of a
+ * request, and the public field of its payload.
+ *
+ * Usage: reader schema.binpb payload.bin packet.bin
+ */
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#include "symphony.h"
+
+#define CHECK(call)                                                                   \
+    do {                                                                              \
+        int status = (call);                                                          \
+        if (status != SYMPHONY_OK) {                                                  \
+            fprintf(stderr, "%s: %s\n", #call, symphony_status_string(status));       \
+            exit(1);                                                                  \
+        }                                                                             \
+    } while (0)
+
+static uint8_t *read_file(const char *path, size_t *len) {
+    FILE *f = fopen(path, "rb");
+    if (f == NULL) {
+        perror(path);
+        exit(1);
+    }
+    fseek(f, 0, SEEK_END);
+    *len = (size_t)ftell(f);
+    fseek(f, 0, SEEK_SET);
+    uint8_t *data = malloc(*len);
+    if (fread(data, 1, *len, f) != *len) {
+        perror(path);
+        exit(1);
+    }
+    fclose(f);
+    return data;
+}
+
+int main(int argc, char **argv) {
+    if (argc != 4) {
+        fprintf(stderr, "Usage: %s schema.binpb payload.bin packet.bin\n", argv[0]);
+        return 2;
+    }
+    if (symphony_abi_version() != SYMPHONY_ABI_VERSION) {
+        fprintf(stderr, "ABI version %d, want %d\n", symphony_abi_version(), SYMPHONY_ABI_VERSION);
+        return 1;
+    }
+    int status = symphony_load_schema_file(argv[1]);
+    if (status != SYMPHONY_OK && status != SYMPHONY_PARTIAL) {
+        fprintf(stderr, "symphony_load_schema_file: %s\n", symphony_status_string(status));
+        return 1;
+    }
+
+    size_t len;
+    uint8_t *data = read_file(argv[2], &len);
+    symphony_header header;
+    CHECK(symphony_parse_header(data, len, &header));
+
+    /* The public segment is enough to read public fields */
+    symphony_field field;
+    CHECK(symphony_public_field("Test.ComplexMixed", data, header.offset_to_private, "v_string", &field));
+    printf("v_string %.*s\n", (int)field.length, (const char *)data + field.offset);
+    CHECK(symphony_public_field("Test.ComplexMixed", data, header.offset_to_private, "f_bool", &field));
+    printf("f_bool %lld\n", (long long)field.i64);
+    CHECK(symphony_public_field("Test.ComplexMixed", data, header.offset_to_private, "nested_leaf", &field));
+    symphony_field leaf;
+    CHECK(symphony_public_field("Test.Leaf", data + field.offset, field.length, "leaf_id", &leaf));
+    printf("nested_leaf.leaf_id %lld\n", (long long)leaf.i64);
+
+    status = symphony_public_field("Test.ComplexMixed", data, len, "f_int32", &field);
+    if (status != SYMPHONY_ERR_UNKNOWN_FIELD) {
+        fprintf(stderr, "private field: got status %d, want SYMPHONY_ERR_UNKNOWN_FIELD\n", status);
+        return 1;
+    }
+    status = symphony_public_field("Test.ComplexMixed", data, 12, "v_string", &field);
+    if (status != SYMPHONY_ERR_MALFORMED) {
+        fprintf(stderr, "truncated data: got status %d, want SYMPHONY_ERR_MALFORMED\n", status);
+        return 1;
+    }
+
+    /* The JSON form encodes back to the same bytes */
+    char *json;
+    size_t json_len;
+    CHECK(symphony_decode_json("Test.ComplexMixed", data, len, &json, &json_len));
+    printf("json %s\n", json);
+    uint8_t *encoded;
+    size_t encoded_len;
+    CHECK(symphony_encode_json("Test.ComplexMixed", json, json_len, &encoded, &encoded_len));
+    if (encoded_len != len || memcmp(encoded, data, len) != 0) {
+        fprintf(stderr, "encoding mismatch\n");
+        return 1;
+    }
+    symphony_free(json);
+    symphony_free(encoded);
+    free(data);
+
+    /* A datagram holds its header, extensions and a chunk of the message */
+    data = read_file(argv[3], &len);
+    symphony_packet packet;
+    CHECK(symphony_parse_packet(data, len, &packet));
+    printf("packet type %d rpc %llu seq %d/%d dst %d.%d.%d.%d:%d\n", packet.type, (unsigned long long)packet.rpc_id,
+           packet.seq_number, packet.total_packets, packet.dst_ip[0], packet.dst_ip[1], packet.dst_ip[2],
+           packet.dst_ip[3], packet.dst_port);
+    size_t offset, length;
+    CHECK(symphony_packet_extension(data, len, SYMPHONY_EXT_PRIORITY, &offset, &length));
+    printf("priority %d\n", data[offset]);
+    status = symphony_packet_extension(data, len, SYMPHONY_EXT_DEADLINE, &offset, &length);
+    if (status != SYMPHONY_ERR_UNKNOWN_FIELD) {
+        fprintf(stderr, "missing extension: got status %d, want SYMPHONY_ERR_UNKNOWN_FIELD\n", status);
+        return 1;
+    }
+    const uint8_t *payload = data + packet.payload_offset;
+    CHECK(symphony_parse_header(payload, packet.payload_length, &header));
+    CHECK(symphony_public_field("Test.ComplexMixed", payload, header.offset_to_private, "v_string", &field));
+    printf("method %d/%d v_string %.*s\n", header.service_id, header.method_id, (int)field.length,
+           (const char *)payload + field.offset);
+    free(data);
+    return 0;
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/appnet-org/arpc/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// newAdminMux returns the handler of the admin HTTP server
+//
+//	GET  /chains                 split and metrics of the blue and green element chains
+//	POST /chains?greenPercent=N  send N percent of the RPCs to the green chain
+func newAdminMux(state *ProxyState) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/chains", state.chains)
+	return mux
+}
+
+// startAdminServer serves the admin API on addr in the background
+func startAdminServer(addr string, state *ProxyState) {
+	server := &http.Server{Addr: addr, Handler: newAdminMux(state)}
+	go func() {
+		logging.Info("Admin server listening", zap.String("addr", addr))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Error("Admin server failed", zap.String("addr", addr), zap.Error(err))
+		}
+	}()
+}
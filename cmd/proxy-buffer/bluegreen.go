@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy-buffer/util"
+)
+
+// ChainSplit sends a percentage of the RPCs to the green element chain and the rest to the
+// blue one, so new element versions can be canaried on live traffic before the cutover. RPCs
+// are picked by a hash of their RPC ID, so the request and the response of an RPC run
+// through the same chain. Without a green plugin loaded, all RPCs run through the blue chain.
+type ChainSplit struct {
+	greenPercent atomic.Int32
+	blue, green  ChainMetrics
+}
+
+// ChainMetrics counts the messages an element chain processed
+type ChainMetrics struct {
+	requests  atomic.Uint64
+	responses atomic.Uint64
+	drops     atomic.Uint64 // messages dropped by an element
+	errors    atomic.Uint64 // messages an element failed on
+	nanos     atomic.Int64  // spent in the chain
+}
+
+// NewChainSplit creates a split sending greenPercent percent of the RPCs to the green chain
+func NewChainSplit(greenPercent int) (*ChainSplit, error) {
+	s := &ChainSplit{}
+	if err := s.SetGreenPercent(greenPercent); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetGreenPercent changes the percentage of RPCs sent to the green chain: 0 until the
+// canary starts, 100 for the cutover
+func (s *ChainSplit) SetGreenPercent(percent int) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("green percentage %d is not between 0 and 100", percent)
+	}
+	s.greenPercent.Store(int32(percent))
+	return nil
+}
+
+// GreenPercent returns the percentage of RPCs sent to the green chain
+func (s *ChainSplit) GreenPercent() int {
+	return int(s.greenPercent.Load())
+}
+
+// Pick returns the element chain of an RPC and the metrics to record its messages in. The
+// chain is nil if no element chain is loaded.
+func (s *ChainSplit) Pick(rpcID uint64) (*RPCElementChain, *ChainMetrics) {
+	if green := GetGreenElementChain(); green != nil && rpcBucket(rpcID) < s.GreenPercent() {
+		return green, &s.green
+	}
+	return GetElementChain(), &s.blue
+}
+
+// rpcBucket maps an RPC ID to one of 100 buckets. RPC IDs are often sequential, so they are
+// mixed first.
+func rpcBucket(rpcID uint64) int {
+	return int((rpcID * 0x9E3779B97F4A7C15 >> 32) % 100)
+}
+
+// Record counts a message processed by the chain in elapsed, with its verdict and error
+func (m *ChainMetrics) Record(packetType util.PacketType, verdict util.PacketVerdict, err error, elapsed time.Duration) {
+	switch packetType {
+	case util.PacketTypeRequest:
+		m.requests.Add(1)
+	case util.PacketTypeResponse:
+		m.responses.Add(1)
+	}
+	switch {
+	case verdict == util.PacketVerdictDrop:
+		m.drops.Add(1)
+	case err != nil:
+		m.errors.Add(1)
+	}
+	m.nanos.Add(int64(elapsed))
+}
+
+// chainMetricsJSON is the JSON form of ChainMetrics
+type chainMetricsJSON struct {
+	Requests     uint64  `json:"requests"`
+	Responses    uint64  `json:"responses"`
+	Drops        uint64  `json:"drops"`
+	Errors       uint64  `json:"errors"`
+	AvgLatencyUs float64 `json:"avgLatencyUs"`
+}
+
+func (m *ChainMetrics) snapshot() chainMetricsJSON {
+	out := chainMetricsJSON{
+		Requests:  m.requests.Load(),
+		Responses: m.responses.Load(),
+		Drops:     m.drops.Load(),
+		Errors:    m.errors.Load(),
+	}
+	if messages := out.Requests + out.Responses; messages > 0 {
+		out.AvgLatencyUs = float64(m.nanos.Load()) / float64(messages) / 1e3
+	}
+	return out
+}
+
+// WriteMetrics writes the split and the metrics of both chains in the Prometheus text
+// exposition format, as arpc_proxy_chain_* series labeled with the chain
+func (s *ChainSplit) WriteMetrics(w io.Writer) (int64, error) {
+	chains := [2]chainMetricsJSON{s.blue.snapshot(), s.green.snapshot()}
+	var b strings.Builder
+	write := func(name, help string, value func(*chainMetricsJSON) uint64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for i, chain := range [2]string{"blue", "green"} {
+			fmt.Fprintf(&b, "%s{chain=%q} %d\n", name, chain, value(&chains[i]))
+		}
+	}
+	fmt.Fprintf(&b, "# HELP arpc_proxy_chain_green_percent Percentage of RPCs sent to the green chain.\n"+
+		"# TYPE arpc_proxy_chain_green_percent gauge\narpc_proxy_chain_green_percent %d\n", s.GreenPercent())
+	write("arpc_proxy_chain_requests_total", "Total number of requests processed by the chain.",
+		func(m *chainMetricsJSON) uint64 { return m.Requests })
+	write("arpc_proxy_chain_responses_total", "Total number of responses processed by the chain.",
+		func(m *chainMetricsJSON) uint64 { return m.Responses })
+	write("arpc_proxy_chain_drops_total", "Total number of messages dropped by an element of the chain.",
+		func(m *chainMetricsJSON) uint64 { return m.Drops })
+	write("arpc_proxy_chain_errors_total", "Total number of messages an element of the chain failed on.",
+		func(m *chainMetricsJSON) uint64 { return m.Errors })
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP reports the split and the metrics of both chains as JSON. POST with a
+// greenPercent query parameter changes the split.
+func (s *ChainSplit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		percent, err := strconv.Atoi(r.URL.Query().Get("greenPercent"))
+		if err == nil {
+			err = s.SetGreenPercent(percent)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid greenPercent: %v", err), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		GreenPercent int                         `json:"greenPercent"`
+		GreenLoaded  bool                        `json:"greenLoaded"`
+		Chains       map[string]chainMetricsJSON `json:"chains"`
+	}{
+		GreenPercent: s.GreenPercent(),
+		GreenLoaded:  GetGreenElementChain() != nil,
+		Chains: map[string]chainMetricsJSON{
+			blueSlot.name:  s.blue.snapshot(),
+			greenSlot.name: s.green.snapshot(),
+		},
+	})
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/binary"
 	"fmt"
 	"hash/fnv"
+	"io"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,9 +16,8 @@ import (
 	"go.uber.org/zap"
 )
 
-// DataPacketHeaderSize is the size of the DataPacket header in bytes
-// Total: 1+8+2+2+1+1+4+2+4+2+4 = 31 bytes (includes MoreFragments and FragmentIndex)
-const DataPacketHeaderSize = 31
+// DataPacketHeaderSize is the size of the fixed DataPacket header in bytes (without extensions)
+const DataPacketHeaderSize = packet.DataPacketHeaderSize
 
 const (
 	// numShards is the number of shards for partitioning fragment storage
@@ -158,6 +159,7 @@ func (pb *PacketBuffer) ProcessPacket(data []byte, src *net.UDPAddr) (*util.Buff
 			DstPort:      dataPacket.DstPort,
 			SrcIP:        dataPacket.SrcIP,
 			SrcPort:      dataPacket.SrcPort,
+			Extensions:   dataPacket.Extensions,
 			TotalPackets: dataPacket.TotalPackets,
 		}, nil
 	}
@@ -182,6 +184,7 @@ func (pb *PacketBuffer) ProcessPacket(data []byte, src *net.UDPAddr) (*util.Buff
 			DstPort:      dataPacket.DstPort,
 			SrcIP:        dataPacket.SrcIP,
 			SrcPort:      dataPacket.SrcPort,
+			Extensions:   dataPacket.Extensions,
 			TotalPackets: dataPacket.TotalPackets,
 		}, nil
 	}
@@ -302,6 +305,7 @@ func (pb *PacketBuffer) ProcessErrorPacket(data []byte, src *net.UDPAddr) (*util
 	// Create BufferedPacket with error message as payload
 	bufferedPacket := &util.BufferedPacket{
 		Payload:      []byte(errorPacket.ErrorMsg),
+		RetryHint:    errorPacket.RetryHint,
 		Source:       src,
 		Peer:         peer,
 		PacketType:   util.PacketTypeError,
@@ -394,6 +398,20 @@ func (pb *PacketBuffer) GetStats() map[string]any {
 	return stats
 }
 
+// WriteMetrics writes the occupancy of the buffer in the Prometheus text exposition format,
+// as arpc_proxy_* series
+func (pb *PacketBuffer) WriteMetrics(w io.Writer) (int64, error) {
+	stats := pb.GetStats()
+	var b strings.Builder
+	write := func(name, help string, value any) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+	write("arpc_proxy_buffered_connections", "Number of connections with RPCs in the buffer.", stats["activeConnections"])
+	write("arpc_proxy_buffered_fragments", "Number of fragments in the buffer.", stats["totalFragments"])
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
 // offsetToPrivate extracts the offset to private segment from the payload
 // The offset is stored as a little-endian uint32 at bytes 1-5
 func offsetToPrivate(payload []byte) int {
@@ -415,7 +433,7 @@ type FragmentedPacket struct {
 // Returns a slice of fragmented packets ready to send.
 func (pb *PacketBuffer) FragmentPacketForForward(bufferedPacket *util.BufferedPacket) ([]FragmentedPacket, error) {
 	completePayload := bufferedPacket.Payload
-	chunkSize := packet.MaxUDPPayloadSize - DataPacketHeaderSize
+	chunkSize := packet.MaxUDPPayloadSize - DataPacketHeaderSize - packet.ExtensionsSize(bufferedPacket.Extensions)
 
 	// Check if payload fits in a single packet
 	if len(completePayload) <= chunkSize {
@@ -429,6 +447,7 @@ func (pb *PacketBuffer) FragmentPacketForForward(bufferedPacket *util.BufferedPa
 			DstPort:      bufferedPacket.DstPort,
 			SrcIP:        bufferedPacket.SrcIP,
 			SrcPort:      bufferedPacket.SrcPort,
+			Extensions:   bufferedPacket.Extensions,
 			Payload:      completePayload,
 		}
 
@@ -464,6 +483,7 @@ func (pb *PacketBuffer) FragmentPacketForForward(bufferedPacket *util.BufferedPa
 			DstPort:      bufferedPacket.DstPort,
 			SrcIP:        bufferedPacket.SrcIP,
 			SrcPort:      bufferedPacket.SrcPort,
+			Extensions:   bufferedPacket.Extensions,
 			Payload:      completePayload[start:end],
 		}
 
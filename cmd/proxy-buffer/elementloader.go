@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"plugin"
@@ -11,6 +13,7 @@ import (
 	"time"
 
 	"github.com/appnet-org/arpc/cmd/proxy-buffer/util"
+	sharedelement "github.com/appnet-org/arpc/pkg/element"
 	"github.com/appnet-org/arpc/pkg/logging"
 	"go.uber.org/zap"
 )
@@ -22,16 +25,36 @@ const (
 	ElementPluginPrefix = "element-"
 )
 
+// elementSlot holds the element chain loaded from the plugins of one prefix. The proxy
+// has a blue slot for the stable chain and, for canaries, a green slot.
+type elementSlot struct {
+	name string // of the slot in logs and metrics
+	// chain is stored in an atomic.Value for lock-free reads
+	chain         atomic.Value // *RPCElementChain
+	prefix        string
+	highestFile   string
+	highestFileMu sync.Mutex // Protects highestFile
+	plugin        elementInit
+	module        *sharedelement.Module // module of plugin
+	pluginMu      sync.Mutex            // Protects plugin and module
+}
+
 var (
-	// currentElementChain is stored in an atomic.Value for lock-free reads
-	currentElementChain  atomic.Value // *RPCElementChain
-	highestElementFile   string
-	highestElementFileMu sync.Mutex // Protects highestElementFile
-	pluginInterface      elementInit
-	pluginInterfaceMu    sync.Mutex // Protects pluginInterface
-	elementPluginPrefix  string
+	blueSlot  = &elementSlot{name: "blue"}
+	greenSlot = &elementSlot{name: "green"}
+
+	// pluginVerifier approves plugin modules before they are loaded, nil accepts all of them
+	pluginVerifier sharedelement.ModuleVerifier
+	// rejectedPlugins counts the plugin modules refused by pluginVerifier
+	rejectedPlugins atomic.Uint64
 )
 
+// SetPluginVerifier makes the element loaders load only the plugin modules accepted by
+// verifier. It must be called before InitElementLoader.
+func SetPluginVerifier(verifier sharedelement.ModuleVerifier) {
+	pluginVerifier = verifier
+}
+
 // elementInit is the interface that element plugins must implement
 type elementInit interface {
 	Element() RPCElement
@@ -58,6 +81,10 @@ func (w *pluginElementInitWrapper) Element() RPCElement {
 	// This works because both types have the same method signatures
 	element, ok := pluginElement.(RPCElement)
 	if !ok {
+		// Elements of the shared interface work in every proxy variant
+		if shared, ok := pluginElement.(sharedelement.Element); ok {
+			return AdaptElement(shared)
+		}
 		// If direct assertion fails, try to create an adapter
 		// This handles the case where the plugin's type doesn't directly match
 		return &elementAdapter{elem: pluginElement}
@@ -110,8 +137,10 @@ func init() {
 	// Start background goroutine to periodically check for plugin updates
 	go func() {
 		for {
-			if elementPluginPrefix != "" {
-				updateElements(elementPluginPrefix)
+			for _, slot := range []*elementSlot{blueSlot, greenSlot} {
+				if prefix := slot.getPrefix(); prefix != "" {
+					slot.update(prefix)
+				}
 			}
 			time.Sleep(1000 * time.Millisecond)
 		}
@@ -120,26 +149,60 @@ func init() {
 
 // InitElementLoader initializes the element loader with the given plugin prefix path
 func InitElementLoader(pluginPrefixPath string) {
-	logging.Info("Initializing element loader", zap.String("pluginPrefix", pluginPrefixPath))
-	elementPluginPrefix = pluginPrefixPath
-	// Do an initial load
-	updateElements(pluginPrefixPath)
+	blueSlot.init(pluginPrefixPath)
+}
+
+// InitGreenElementLoader loads the green element chain from the plugins of the given
+// prefix path, next to the blue one of InitElementLoader
+func InitGreenElementLoader(pluginPrefixPath string) {
+	greenSlot.init(pluginPrefixPath)
 }
 
 // GetElementChain returns the current element chain in a thread-safe, lock-free manner
 func GetElementChain() *RPCElementChain {
-	chain := currentElementChain.Load()
+	return blueSlot.getChain()
+}
+
+// GetGreenElementChain returns the current green element chain, or nil if no green plugin
+// is loaded
+func GetGreenElementChain() *RPCElementChain {
+	greenSlot.pluginMu.Lock()
+	loaded := greenSlot.plugin != nil
+	greenSlot.pluginMu.Unlock()
+	if !loaded {
+		return nil
+	}
+	return greenSlot.getChain()
+}
+
+func (s *elementSlot) init(pluginPrefixPath string) {
+	logging.Info("Initializing element loader", zap.String("slot", s.name), zap.String("pluginPrefix", pluginPrefixPath))
+	s.highestFileMu.Lock()
+	s.prefix = pluginPrefixPath
+	s.highestFileMu.Unlock()
+	// Do an initial load
+	s.update(pluginPrefixPath)
+}
+
+func (s *elementSlot) getPrefix() string {
+	s.highestFileMu.Lock()
+	defer s.highestFileMu.Unlock()
+	return s.prefix
+}
+
+func (s *elementSlot) getChain() *RPCElementChain {
+	chain := s.chain.Load()
 	if chain == nil {
 		return nil
 	}
 	return chain.(*RPCElementChain)
 }
 
-// updateElements scans the plugin directory for element plugin files and loads the highest one
-func updateElements(prefix string) {
-	highestElementFileMu.Lock()
-	currentHighest := highestElementFile
-	highestElementFileMu.Unlock()
+// update scans the plugin directory for element plugin files and loads the highest one
+func (s *elementSlot) update(prefix string) {
+	s.highestFileMu.Lock()
+	currentHighest := s.highestFile
+	s.highestFileMu.Unlock()
 
 	var highestSeenElement string = currentHighest
 
@@ -158,15 +221,15 @@ func updateElements(prefix string) {
 			logging.Debug("Error reading element plugin directory", zap.String("dir", dir), zap.Error(err))
 		}
 		// If this is the first check and no directory exists, initialize with empty chain
-		if currentElementChain.Load() == nil {
-			currentElementChain.Store(NewRPCElementChain())
-			logging.Debug("Initialized with empty element chain (no plugin directory)")
+		if s.chain.Load() == nil {
+			s.chain.Store(NewRPCElementChain())
+			logging.Debug("Initialized with empty element chain (no plugin directory)", zap.String("slot", s.name))
 		}
 		return
 	}
 
 	for _, file := range files {
-		if strings.HasPrefix(file.Name(), prefixName) {
+		if strings.HasPrefix(file.Name(), prefixName) && !strings.HasSuffix(file.Name(), sharedelement.SignatureSuffix) {
 			if file.Name() > highestSeenElement {
 				highestSeenElement = file.Name()
 			}
@@ -174,71 +237,114 @@ func updateElements(prefix string) {
 	}
 
 	if highestSeenElement != currentHighest {
-		highestElementFileMu.Lock()
-		highestElementFile = highestSeenElement
-		highestElementFileMu.Unlock()
+		s.highestFileMu.Lock()
+		s.highestFile = highestSeenElement
+		s.highestFileMu.Unlock()
 
 		// If no plugin file found, create an empty chain
 		if highestSeenElement == "" {
-			logging.Debug("No element plugin found, using empty chain")
-			currentElementChain.Store(NewRPCElementChain())
+			logging.Debug("No element plugin found, using empty chain", zap.String("slot", s.name))
+			s.chain.Store(NewRPCElementChain())
 			// Kill previous plugin if it exists
-			pluginInterfaceMu.Lock()
-			if pluginInterface != nil {
-				pluginInterface.Kill()
-				pluginInterface = nil
+			s.pluginMu.Lock()
+			if s.plugin != nil {
+				s.plugin.Kill()
+				s.plugin = nil
 			}
-			pluginInterfaceMu.Unlock()
+			s.module = nil
+			s.pluginMu.Unlock()
 			return
 		}
 
 		pluginPath := filepath.Join(dir, highestSeenElement)
-		elementInit := loadElementPlugin(pluginPath)
+		elementInit, module := loadElementPlugin(pluginPath)
 		if elementInit != nil {
 			// Kill previous plugin if it exists
-			pluginInterfaceMu.Lock()
-			if pluginInterface != nil {
-				pluginInterface.Kill()
+			s.pluginMu.Lock()
+			if s.plugin != nil {
+				s.plugin.Kill()
 			}
-			pluginInterface = elementInit
-			pluginInterfaceMu.Unlock()
+			s.plugin = elementInit
+			s.module = module
+			s.pluginMu.Unlock()
 
 			// Create new chain with the element from plugin
 			element := elementInit.Element()
 			elementInit.Init()
 			if element != nil {
 				// Store atomically - this is a lock-free write
-				currentElementChain.Store(NewRPCElementChain(element))
+				s.chain.Store(NewRPCElementChain(element))
 				logging.Info("Updated element chain from plugin",
+					zap.String("slot", s.name),
 					zap.String("plugin", pluginPath),
+					zap.String("digest", module.Digest),
 					zap.String("element", element.Name()))
 			} else {
-				logging.Warn("Plugin returned nil element, keeping previous chain", zap.String("plugin", pluginPath))
+				logging.Warn("Plugin returned nil element, keeping previous chain", zap.String("slot", s.name), zap.String("plugin", pluginPath))
 			}
 		} else {
 			// Plugin loading failed, keep previous chain (or initialize empty if first load)
-			if currentElementChain.Load() == nil {
-				currentElementChain.Store(NewRPCElementChain())
-				logging.Debug("Initialized with empty element chain (plugin load failed)")
+			if s.chain.Load() == nil {
+				s.chain.Store(NewRPCElementChain())
+				logging.Debug("Initialized with empty element chain (plugin load failed)", zap.String("slot", s.name))
 			}
 		}
 	}
 }
 
-// loadElementPlugin loads an element plugin from the specified path
-func loadElementPlugin(elementPluginPath string) elementInit {
+// writePluginMetrics writes the module of the plugin of both slots, and the number of
+// modules rejected by the plugin verifier, in the Prometheus text exposition format
+func writePluginMetrics(w io.Writer) (int64, error) {
+	var b strings.Builder
+	b.WriteString("# HELP arpc_proxy_element_plugin_info Element plugin module loaded for each chain.\n" +
+		"# TYPE arpc_proxy_element_plugin_info gauge\n")
+	for _, slot := range []*elementSlot{blueSlot, greenSlot} {
+		slot.pluginMu.Lock()
+		if module := slot.module; module != nil {
+			fmt.Fprintf(&b, "arpc_proxy_element_plugin_info{chain=%q,plugin=%q,digest=%q,verified=\"%t\"} 1\n",
+				slot.name, filepath.Base(module.Path), module.Digest, module.Verified)
+		}
+		slot.pluginMu.Unlock()
+	}
+	fmt.Fprintf(&b, "# HELP arpc_proxy_element_plugins_rejected_total Total number of element plugin modules rejected by signature verification.\n"+
+		"# TYPE arpc_proxy_element_plugins_rejected_total counter\narpc_proxy_element_plugins_rejected_total %d\n", rejectedPlugins.Load())
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// loadElementPlugin loads an element plugin from the specified path, once pluginVerifier
+// accepted its module
+func loadElementPlugin(elementPluginPath string) (elementInit, *sharedelement.Module) {
 	logging.Info("Loading element plugin", zap.String("path", elementPluginPath))
 
-	elementPlugin, err := plugin.Open(elementPluginPath)
+	module, err := sharedelement.ReadModule(elementPluginPath, pluginVerifier)
+	if err != nil {
+		if module != nil {
+			rejectedPlugins.Add(1)
+			logging.Error("Element plugin rejected by signature verification", zap.String("path", elementPluginPath),
+				zap.String("digest", module.Digest), zap.Error(err))
+		} else {
+			logging.Error("Error reading element plugin", zap.String("path", elementPluginPath), zap.Error(err))
+		}
+		return nil, nil
+	}
+	loadPath, remove, err := module.LoadPath()
+	if err != nil {
+		logging.Error("Error copying verified element plugin", zap.String("path", elementPluginPath), zap.Error(err))
+		return nil, nil
+	}
+	defer remove()
+
+	elementPlugin, err := plugin.Open(loadPath)
 	if err != nil {
 		logging.Error("Error loading element plugin", zap.String("path", elementPluginPath), zap.Error(err))
-		return nil
+		return nil, nil
 	}
 
 	symElementInit, err := elementPlugin.Lookup("ElementInit")
 	if err != nil {
 		logging.Error("Error locating ElementInit symbol in plugin", zap.String("path", elementPluginPath), zap.Error(err))
-		return nil
+		return nil, nil
 	}
 
 	// Use interface{} and type assertion with a wrapper
@@ -259,7 +365,7 @@ func loadElementPlugin(elementPluginPath string) elementInit {
 	})
 	if !ok {
 		logging.Error("Error casting ElementInit from plugin - plugin must export ElementInit with Element() and Kill() methods", zap.String("path", elementPluginPath))
-		return nil
+		return nil, nil
 	}
 
 	// Create a wrapper that adapts the plugin's elementInit to our elementInit interface
@@ -267,6 +373,7 @@ func loadElementPlugin(elementPluginPath string) elementInit {
 		pluginInit: pluginInit,
 	}
 
-	logging.Info("Successfully loaded element plugin", zap.String("path", elementPluginPath))
-	return wrapper
+	logging.Info("Successfully loaded element plugin", zap.String("path", elementPluginPath),
+		zap.String("digest", module.Digest), zap.Bool("verified", module.Verified))
+	return wrapper, module
 }
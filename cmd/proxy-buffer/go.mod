@@ -12,4 +12,5 @@ require (
 require (
 	github.com/stretchr/testify v1.9.0 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
+	google.golang.org/protobuf v1.36.10 // indirect
 )
@@ -2,16 +2,21 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/appnet-org/arpc/cmd/proxy-buffer/util"
+	sharedelement "github.com/appnet-org/arpc/pkg/element"
 	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/otlp"
 	"github.com/appnet-org/arpc/pkg/packet"
 	"github.com/appnet-org/arpc/pkg/transport"
 	"go.uber.org/zap"
@@ -29,6 +34,7 @@ const (
 type ProxyState struct {
 	elementChain *RPCElementChain
 	packetBuffer *PacketBuffer
+	chains       *ChainSplit // picks the blue or green element chain of each RPC
 }
 
 // Config holds the proxy configuration
@@ -37,6 +43,18 @@ type Config struct {
 	EnableEncryption bool
 	EncryptionKey    []byte
 	BufferTimeout    time.Duration
+	// GreenElementPrefix is the plugin file prefix of the green element chain (empty disables
+	// it), and GreenPercent the percentage of RPCs it processes
+	GreenElementPrefix string
+	GreenPercent       int
+	// AdminAddr is the listen address of the admin HTTP server (empty disables it)
+	AdminAddr string
+	// OTLP exports the buffer and chain metrics to an OpenTelemetry collector, configured by
+	// the OTEL_* variables (nil disables it)
+	OTLP *otlp.Config
+	// MaxHops is the hop count past which requests are dropped as caught in a routing loop
+	// (0 disables the limit)
+	MaxHops int
 }
 
 // DefaultConfig returns the default proxy configuration
@@ -44,6 +62,7 @@ func DefaultConfig() *Config {
 	return &Config{
 		Ports:            []int{15002, 15006},
 		BufferTimeout:    30 * time.Second,
+		MaxHops:          packet.DefaultMaxHops,
 		EnableEncryption: false,
 		EncryptionKey:    nil,
 	}
@@ -60,6 +79,24 @@ func (c *Config) SetEncryption(key []byte) {
 	}
 }
 
+// publicSegmentKey returns the key the public segment of a packet is encrypted with, nil if
+// it is in plaintext: the key of the proxy with encryption enabled, and otherwise the default
+// public key for the calls that their client encrypted anyway (see
+// transport.EncryptionRequired)
+func publicSegmentKey(config *Config, bufferedPacket *util.BufferedPacket) []byte {
+	if config.EnableEncryption {
+		return config.EncryptionKey
+	}
+	if !transport.CallEncrypted(bufferedPacket.Extensions, packet.PacketTypeID(bufferedPacket.PacketType), bufferedPacket.RPCID) {
+		return nil
+	}
+	if err := transport.InitDefaultGCMObjects(); err != nil {
+		logging.Error("Failed to initialize GCM objects", zap.Error(err))
+		return nil
+	}
+	return transport.DefaultPublicKey
+}
+
 // getLoggingConfig reads logging configuration from environment variables with defaults
 func getLoggingConfig() *logging.Config {
 	level := os.Getenv("LOG_LEVEL")
@@ -72,13 +109,21 @@ func getLoggingConfig() *logging.Config {
 		format = "console"
 	}
 
-	return &logging.Config{
+	config := &logging.Config{
 		Level:  level,
 		Format: format,
 	}
+	// Binary payloads are logged as a hex preview of this many bytes, for 1 in
+	// LOG_PAYLOAD_SAMPLE payloads
+	config.PayloadPreviewBytes, _ = strconv.Atoi(os.Getenv("LOG_PAYLOAD_PREVIEW"))
+	config.PayloadSampleRate, _ = strconv.Atoi(os.Getenv("LOG_PAYLOAD_SAMPLE"))
+	return config
 }
 
 func main() {
+	selfTest := flag.Bool("self-test", false, "send an RPC through the proxy pipeline to a built-in echo target and exit, non-zero if it fails")
+	flag.Parse()
+
 	// Initialize logging
 	err := logging.Init(getLoggingConfig())
 	if err != nil {
@@ -87,6 +132,15 @@ func main() {
 
 	logging.Info("Starting buffered UDP proxy on :15002 and :15006...")
 
+	// Plugins are verified from their first load
+	if pluginKeys := os.Getenv("ELEMENT_PLUGIN_KEYS"); pluginKeys != "" {
+		verifier, err := sharedelement.LoadSignatureVerifier(strings.Split(pluginKeys, ","))
+		if err != nil {
+			logging.Fatal("Invalid ELEMENT_PLUGIN_KEYS", zap.Error(err))
+		}
+		SetPluginVerifier(verifier)
+	}
+
 	// Initialize dynamic element loader
 	InitElementLoader(ElementPluginDir + "/" + ElementPluginPrefix)
 
@@ -109,10 +163,50 @@ func main() {
 		logging.Info("Encryption GCM objects initialized")
 	}
 
+	config.GreenElementPrefix = os.Getenv("GREEN_ELEMENT_PREFIX")
+	if greenPercent := os.Getenv("GREEN_PERCENT"); greenPercent != "" {
+		percent, err := strconv.Atoi(greenPercent)
+		if err != nil {
+			logging.Fatal("Invalid GREEN_PERCENT", zap.String("percent", greenPercent))
+		}
+		config.GreenPercent = percent
+	}
+
+	config.AdminAddr = os.Getenv("ADMIN_ADDR")
+
+	if maxHops := os.Getenv("MAX_HOPS"); maxHops != "" {
+		hops, err := strconv.Atoi(maxHops)
+		if err != nil || hops < 0 || hops > 255 {
+			logging.Fatal("Invalid MAX_HOPS", zap.String("hops", maxHops))
+		}
+		config.MaxHops = hops
+	}
+
+	if config.OTLP, err = otlp.ConfigFromEnv("proxy-buffer"); err != nil {
+		logging.Fatal("Invalid OTLP configuration", zap.Error(err))
+	}
+	otlpEndpoint := ""
+	if config.OTLP != nil {
+		otlpEndpoint = config.OTLP.Endpoint
+	}
+
 	logging.Info("Proxy configuration",
 		zap.Duration("bufferTimeout", config.BufferTimeout),
 		zap.Bool("enableEncryption", config.EnableEncryption),
-		zap.Ints("ports", config.Ports))
+		zap.Ints("ports", config.Ports),
+		zap.String("greenElementPrefix", config.GreenElementPrefix),
+		zap.Int("greenPercent", config.GreenPercent),
+		zap.String("adminAddr", config.AdminAddr),
+		zap.String("otlpEndpoint", otlpEndpoint))
+
+	// Canaries of new element versions run next to the current chain
+	if config.GreenElementPrefix != "" {
+		InitGreenElementLoader(ElementPluginDir + "/" + config.GreenElementPrefix)
+	}
+	chains, err := NewChainSplit(config.GreenPercent)
+	if err != nil {
+		logging.Fatal("Invalid GREEN_PERCENT", zap.Error(err))
+	}
 
 	// Initialize packet buffer
 	packetBuffer := NewPacketBuffer(config.BufferTimeout)
@@ -129,6 +223,28 @@ func main() {
 	state := &ProxyState{
 		elementChain: elementChain,
 		packetBuffer: packetBuffer,
+		chains:       chains,
+	}
+
+	if config.OTLP != nil {
+		exporter, err := otlp.NewExporter(*config.OTLP)
+		if err != nil {
+			logging.Fatal("Failed to create OTLP exporter", zap.Error(err))
+		}
+		defer exporter.Close()
+		exporter.Register(packetBuffer.WriteMetrics, chains.WriteMetrics, writePluginMetrics)
+	}
+
+	if *selfTest {
+		if err := runSelfTest(config, state); err != nil {
+			logging.Fatal("Self-test failed", zap.Error(err))
+		}
+		logging.Info("Self-test passed")
+		return
+	}
+
+	if config.AdminAddr != "" {
+		startAdminServer(config.AdminAddr, state)
 	}
 
 	// Start proxy servers
@@ -201,11 +317,39 @@ func runProxyServer(port int, state *ProxyState, config *Config) error {
 	}
 }
 
+// dropLoopingRequest drops a request fragment past the hop limit, answering the first
+// fragment with an error packet
+func dropLoopingRequest(conn *net.UDPConn, src *net.UDPAddr, data []byte, origin packet.Origin) {
+	decoded, err := (&packet.DataPacketCodec{}).Deserialize(data)
+	if err != nil {
+		return
+	}
+	pkt := decoded.(*packet.DataPacket)
+	if pkt.SeqNumber != 0 {
+		return
+	}
+	logging.Warn("Dropping request past the hop limit, likely caught in a routing loop",
+		zap.Uint64("rpcID", pkt.RPCID),
+		zap.Uint64("originID", origin.ID),
+		zap.Uint8("hops", origin.Hops),
+		zap.String("src", src.String()))
+	msg := fmt.Sprintf("request of origin %d dropped after %d hops", origin.ID, origin.Hops)
+	if err := util.SendErrorPacket(conn, src, pkt.RPCID, msg, pkt.SrcIP, pkt.SrcPort, pkt.DstIP, pkt.DstPort); err != nil {
+		logging.Error("Failed to send error packet", zap.Error(err))
+	}
+}
+
 // handlePacket processes incoming packets and forwards them to the appropriate peer.
 // This simplified version buffers ALL fragments before processing through the element chain.
 func handlePacket(conn *net.UDPConn, state *ProxyState, src *net.UDPAddr, data []byte, config *Config) {
 	ctx := context.Background()
 
+	// Every proxy a request goes through is a hop of its origin (see packet.Origin)
+	if origin, ok := packet.CountHop(data); ok && config.MaxHops > 0 && int(origin.Hops) > config.MaxHops {
+		dropLoopingRequest(conn, src, data, origin)
+		return
+	}
+
 	// Check if this is an error packet (PacketTypeID == 3)
 	if len(data) > 0 && data[0] == byte(packet.PacketTypeError.TypeID) {
 		// Process error packet - forward directly without element chain
@@ -224,6 +368,7 @@ func handlePacket(conn *net.UDPConn, state *ProxyState, src *net.UDPAddr, data [
 			SrcIP:        bufferedPacket.SrcIP,
 			SrcPort:      bufferedPacket.SrcPort,
 			ErrorMsg:     string(bufferedPacket.Payload),
+			RetryHint:    bufferedPacket.RetryHint,
 		}
 
 		codec := &packet.ErrorPacketCodec{}
@@ -278,12 +423,14 @@ func handlePacket(conn *net.UDPConn, state *ProxyState, src *net.UDPAddr, data [
 		return
 	}
 
-	// Decrypt the public segment if encryption is enabled
-	if config.EnableEncryption {
-		publicPayload = transport.DecryptSymphonyData(publicPayload, config.EncryptionKey, nil)
+	// Decrypt the public segment if encryption is enabled or the client encrypted the call
+	key := publicSegmentKey(config, bufferedPacket)
+	if key != nil {
+		publicPayload = transport.DecryptSymphonyData(publicPayload, key, nil)
+		bufferedPacket.Encrypted = true
 		logging.Debug("Public segment decrypted",
 			zap.Int("size", len(publicPayload)),
-			zap.String("publicPayload", string(publicPayload)))
+			logging.Payload("publicPayload", publicPayload))
 	}
 
 	// Update the packet with the decrypted public segment
@@ -301,9 +448,9 @@ func handlePacket(conn *net.UDPConn, state *ProxyState, src *net.UDPAddr, data [
 		return
 	}
 
-	// Encrypt the packet if encryption is enabled
-	if config.EnableEncryption {
-		bufferedPacket.Payload = transport.EncryptSymphonyData(bufferedPacket.Payload, config.EncryptionKey, nil)
+	// Encrypt the packet if it was encrypted
+	if key != nil {
+		bufferedPacket.Payload = transport.EncryptSymphonyData(bufferedPacket.Payload, key, nil)
 	}
 
 	// Append the private segment to the packet
@@ -337,8 +484,8 @@ func handlePacket(conn *net.UDPConn, state *ProxyState, src *net.UDPAddr, data [
 // Modifications to the packet payload are made in place via the processedPacket return value.
 // Returns an error if processing fails or if the verdict is PacketVerdictDrop.
 func runElementsChain(ctx context.Context, state *ProxyState, packet *util.BufferedPacket) error {
-	// Get current element chain (may have been updated by plugin loader)
-	elementChain := GetElementChain()
+	// Get the current element chain of the RPC (may have been updated by plugin loader)
+	elementChain, metrics := state.chains.Pick(packet.RPCID)
 	var err error
 	var processedPacket *util.BufferedPacket
 	var verdict util.PacketVerdict
@@ -349,6 +496,7 @@ func runElementsChain(ctx context.Context, state *ProxyState, packet *util.Buffe
 		return nil
 	}
 
+	start := time.Now()
 	switch packet.PacketType {
 	case util.PacketTypeRequest:
 		// Process request through element chain
@@ -362,6 +510,7 @@ func runElementsChain(ctx context.Context, state *ProxyState, packet *util.Buffe
 			zap.String("packetType", packet.PacketType.String()))
 		return nil
 	}
+	metrics.Record(packet.PacketType, verdict, err, time.Since(start))
 
 	// Check verdict - if dropped, don't forward the packet
 	if verdict == util.PacketVerdictDrop || err != nil {
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net"
+
+	"github.com/appnet-org/arpc/pkg/selftest"
+)
+
+// runSelfTest sends an RPC from a loopback client through the proxy pipeline (buffering,
+// the element chains and re-fragmentation) to a built-in echo target and back, see
+// pkg/selftest
+func runSelfTest(config *Config, state *ProxyState) error {
+	handle := func(conn *net.UDPConn, src *net.UDPAddr, data []byte) {
+		handlePacket(conn, state, src, data, config)
+	}
+	var key []byte
+	if config.EnableEncryption {
+		key = config.EncryptionKey
+	}
+	return selftest.Run(handle, selftest.Config{Key: key})
+}
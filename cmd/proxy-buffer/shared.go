@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/appnet-org/arpc/cmd/proxy-buffer/util"
+	"github.com/appnet-org/arpc/pkg/element"
+)
+
+// sharedElement adapts an element of the shared interface (pkg/element) to RPCElement
+type sharedElement struct {
+	elem element.Element
+}
+
+// AdaptElement returns an RPCElement running a shared element on buffered packets
+func AdaptElement(elem element.Element) RPCElement {
+	return &sharedElement{elem: elem}
+}
+
+func (s *sharedElement) ProcessRequest(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	return s.process(ctx, packet, element.KindRequest, s.elem.ProcessRequest)
+}
+
+func (s *sharedElement) ProcessResponse(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	return s.process(ctx, packet, element.KindResponse, s.elem.ProcessResponse)
+}
+
+func (s *sharedElement) Name() string {
+	return s.elem.Name()
+}
+
+// process runs the element on the message view of the packet and applies its changes:
+// the payload, and the destination if the element rerouted the message
+func (s *sharedElement) process(ctx context.Context, packet *util.BufferedPacket, kind element.Kind,
+	fn func(context.Context, *element.Message) (*element.Message, element.Verdict, context.Context, error)) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	if packet == nil {
+		return packet, util.PacketVerdictPass, ctx, nil
+	}
+	msg := &element.Message{
+		Kind:        kind,
+		RPCID:       packet.RPCID,
+		Source:      packet.Source,
+		Destination: packet.Peer,
+		Encrypted:   packet.Encrypted,
+		Payload:     packet.Payload,
+	}
+
+	msg, verdict, ctx, err := fn(ctx, msg)
+	if err != nil {
+		return packet, util.PacketVerdictDrop, ctx, err
+	}
+	if msg == nil {
+		return nil, util.PacketVerdictDrop, ctx, nil
+	}
+	// Local replies are not supported: forwarding the reply to the server would be worse than
+	// failing the call
+	if verdict == element.VerdictReply && kind == element.KindRequest {
+		return packet, util.PacketVerdictDrop, ctx, errors.New("local replies are not supported by proxy-buffer")
+	}
+
+	packet.Payload = msg.Payload
+	if dst, ok := msg.Destination.(*net.UDPAddr); ok && dst != packet.Peer {
+		if ip4 := dst.IP.To4(); ip4 != nil {
+			packet.Peer = dst
+			copy(packet.DstIP[:], ip4)
+			packet.DstPort = uint16(dst.Port)
+		}
+	}
+	if verdict == element.VerdictDrop {
+		return packet, util.PacketVerdictDrop, ctx, nil
+	}
+	return packet, util.PacketVerdictPass, ctx, nil
+}
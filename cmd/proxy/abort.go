@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/packet"
+	"go.uber.org/zap"
+)
+
+// DefaultAbortGrace is how long elements processing an aborted RPC get to wrap up, from
+// OnAbort, before their context is canceled
+const DefaultAbortGrace = 100 * time.Millisecond
+
+// AbortableElement is implemented by elements that hold state or run lookups for the RPCs they
+// process, to learn that an RPC was aborted since its client went away. The proxy forwards
+// nothing more of the RPC, so elements should release what they hold for it. Elements still
+// processing a message of the RPC have their context canceled, with ErrClientGone as the
+// cause, once the abort grace period passes (see Config.AbortGrace).
+type AbortableElement interface {
+	OnAbort(rpcID uint64, reason error)
+}
+
+// ErrClientGone is the cause of the contexts of the elements processing an aborted RPC
+var ErrClientGone = errors.New("client is gone")
+
+// errRPCAborted is returned by runElementsChain for an RPC aborted while the chain processed
+// it. There is nobody left to send an error packet to.
+var errRPCAborted = util.NewDropError(packet.DropReasonUnavailable, "RPC aborted: client is gone")
+
+// clientKey is the address of the client of an RPC, as carried by the packet headers
+type clientKey struct {
+	ip   [4]byte
+	port uint16
+}
+
+// clientOf returns the client of the RPC of a packet: the source of a request, the
+// destination of a response
+func clientOf(p *util.BufferedPacket) clientKey {
+	if p.PacketType == util.PacketTypeResponse {
+		return clientKey{p.DstIP, p.DstPort}
+	}
+	return clientKey{p.SrcIP, p.SrcPort}
+}
+
+// inflightRPC is a message of an RPC in the element chain
+type inflightRPC struct {
+	client  clientKey
+	cancel  context.CancelCauseFunc
+	aborted bool
+}
+
+// RPCAborts aborts the RPCs of clients that went away: when a response or error packet cannot
+// be delivered to a client (an ICMP unreachable error, e.g. since its socket was closed), the
+// reassembly state of its RPCs is discarded, later fragments are dropped, and elements are
+// told, so that policy lookups do not go on for RPCs nobody waits for.
+type RPCAborts struct {
+	grace   time.Duration
+	aborted atomic.Uint64
+
+	mu       sync.Mutex
+	inflight map[verdictKey]*inflightRPC
+}
+
+// NewRPCAborts creates a tracker canceling the element contexts of aborted RPCs after grace
+func NewRPCAborts(grace time.Duration) *RPCAborts {
+	return &RPCAborts{grace: grace, inflight: make(map[verdictKey]*inflightRPC)}
+}
+
+// begin registers a message entering the element chain. It returns the context to run the
+// chain with, canceled if the RPC is aborted, and the function to call once the chain
+// returned, which tells whether the RPC was aborted meanwhile.
+func (a *RPCAborts) begin(ctx context.Context, p *util.BufferedPacket) (context.Context, func() bool) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	key := verdictKey{RPCID: p.RPCID, PacketType: p.PacketType}
+	rpc := &inflightRPC{client: clientOf(p), cancel: cancel}
+	a.mu.Lock()
+	a.inflight[key] = rpc
+	a.mu.Unlock()
+
+	return ctx, func() bool {
+		a.mu.Lock()
+		if a.inflight[key] == rpc {
+			delete(a.inflight, key)
+		}
+		aborted := rpc.aborted
+		a.mu.Unlock()
+		if !aborted {
+			cancel(nil)
+		}
+		return aborted
+	}
+}
+
+// Abort aborts rpcID, whose response could not be delivered to client, and the other RPCs of
+// the client: those it is sending, buffered in pb, and those in the element chain. The
+// elements of chain are told with OnAbort. It returns the number of RPCs aborted.
+func (a *RPCAborts) Abort(pb *PacketBuffer, chain *RPCElementChain, client *net.UDPAddr, rpcID uint64, reason error) int {
+	key := clientKey{port: uint16(client.Port)}
+	copy(key.ip[:], client.IP.To4())
+	reason = fmt.Errorf("%w: %v", ErrClientGone, reason)
+
+	rpcIDs := map[uint64]bool{rpcID: true}
+	for _, id := range pb.rpcsFrom(client.String()) {
+		rpcIDs[id] = true
+	}
+	var cancels []context.CancelCauseFunc
+	a.mu.Lock()
+	for k, rpc := range a.inflight {
+		if rpc.client == key && !rpc.aborted {
+			rpc.aborted = true
+			rpcIDs[k.RPCID] = true
+			cancels = append(cancels, rpc.cancel)
+		}
+	}
+	a.mu.Unlock()
+
+	for id := range rpcIDs {
+		pb.Abort(id)
+		if chain != nil {
+			chain.abort(id, reason)
+		}
+	}
+	// Elements get the grace period to wrap up before their lookups are canceled
+	for _, cancel := range cancels {
+		if a.grace <= 0 {
+			cancel(reason)
+			continue
+		}
+		time.AfterFunc(a.grace, func() { cancel(reason) })
+	}
+	a.aborted.Add(uint64(len(rpcIDs)))
+
+	logging.Debug("Aborted RPCs of a client that went away",
+		zap.String("client", client.String()),
+		zap.Uint64("rpcID", rpcID),
+		zap.Int("rpcs", len(rpcIDs)),
+		zap.Error(reason))
+	return len(rpcIDs)
+}
+
+// WriteMetrics writes the number of aborted RPCs in the Prometheus text exposition format
+func (a *RPCAborts) WriteMetrics(w io.Writer) (int64, error) {
+	n, err := fmt.Fprintf(w, "# HELP arpc_proxy_aborted_rpcs_total Total number of RPCs aborted since their client went away.\n"+
+		"# TYPE arpc_proxy_aborted_rpcs_total counter\narpc_proxy_aborted_rpcs_total %d\n", a.aborted.Load())
+	return int64(n), err
+}
+
+// abort tells the elements of the chain that an RPC was aborted, once each
+func (c *RPCElementChain) abort(rpcID uint64, reason error) {
+	var told []AbortableElement
+	notify := func(element any) {
+		abortable, ok := unwrapElement(element).(AbortableElement)
+		if !ok {
+			return
+		}
+		// Elements in both pipelines are told once; values that cannot be compared are told
+		// for each pipeline
+		if reflect.TypeOf(abortable).Comparable() {
+			for _, t := range told {
+				if reflect.TypeOf(t).Comparable() && t == abortable {
+					return
+				}
+			}
+		}
+		told = append(told, abortable)
+		abortable.OnAbort(rpcID, reason)
+	}
+	for _, element := range c.request {
+		notify(element)
+	}
+	for _, element := range c.response {
+		notify(element)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/rpc/stats"
+	"github.com/appnet-org/arpc/pkg/schema"
+	"go.uber.org/zap"
+)
+
+// newAdminMux returns the handler of the admin HTTP server. Endpoints of disabled
+// features are not registered.
+//
+//	GET /stats/sizes  per-method payload size histograms and largest RPCs (SIZE_STATS_TOP_K)
+//	GET /config       configuration applied from the control plane (CONTROL_PLANE)
+//	GET /stats/shadow what shadow elements would have done (SHADOW_ELEMENTS or CONTROL_PLANE)
+//	GET /debug/rpcs   recent RPCs, or the event timeline of one with ?id=<rpcID> (RPC_TIMELINES)
+//	GET /stats/stuck  count and diagnostics of RPCs whose reassembly stalled (STUCK_RPC_THRESHOLD)
+//	GET /metrics      buffer metrics, and RPC counters by label (METRIC_LABELS), for Prometheus
+//	GET /schemas      the registered schemas, as a blob of schema.Registry.Export
+//	GET /elements     the descriptors, plugins and applied parameters of the plugin elements
+func newAdminMux(state *ProxyState) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metricsHandler(state.metricsWriters()))
+	mux.Handle("/schemas", schemasHandler(schema.Global))
+	mux.Handle("/elements", elementsHandler())
+	if state.sizeStats != nil {
+		mux.Handle("/stats/sizes", state.sizeStats)
+	}
+	if state.controlPlane != nil {
+		mux.Handle("/config", state.controlPlane)
+	}
+	if state.timelines != nil {
+		mux.Handle("/debug/rpcs", state.timelines)
+	}
+	if state.stuckRPCs != nil {
+		mux.Handle("/stats/stuck", state.stuckRPCs)
+	}
+	if state.controlPlane != nil || len(shadowMode.Elements()) > 0 {
+		mux.Handle("/stats/shadow", shadowMode)
+	}
+	return mux
+}
+
+// metricsHandler serves the metrics of writers in the Prometheus text exposition format
+func metricsHandler(writers []stats.MetricsWriter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, write := range writers {
+			if _, err := write(w); err != nil {
+				logging.Warn("Failed to write metrics", zap.Error(err))
+				return
+			}
+		}
+	})
+}
+
+// schemasHandler serves the schemas of a registry, so that filters of other proxies (see
+// cmd/libsymphony) decode payloads with the schemas this proxy uses
+func schemasHandler(registry *schema.Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(registry.Export())
+	})
+}
+
+// startAdminServer serves the admin API on addr in the background
+func startAdminServer(addr string, state *ProxyState) {
+	server := &http.Server{Addr: addr, Handler: newAdminMux(state)}
+	go func() {
+		logging.Info("Admin server listening", zap.String("addr", addr))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Error("Admin server failed", zap.String("addr", addr), zap.Error(err))
+		}
+	}()
+}
@@ -3,38 +3,43 @@ package main
 import (
 	"encoding/binary"
 	"fmt"
-	"hash/fnv"
+	"io"
 	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/common"
 	"github.com/appnet-org/arpc/pkg/logging"
 	"github.com/appnet-org/arpc/pkg/packet"
 	"go.uber.org/zap"
 )
 
-// DataPacketHeaderSize is the size of the DataPacket header in bytes
-// Total: 1+8+2+2+1+1+4+2+4+2+4 = 31 bytes
-const DataPacketHeaderSize = 31
+// DataPacketHeaderSize is the size of the fixed DataPacket header in bytes (without extensions)
+const DataPacketHeaderSize = packet.DataPacketHeaderSize
 
 const (
 	// numShards is the number of shards for partitioning fragment storage
 	numShards = 256
+	// adaptiveFragmentGap is the time between fragments assumed by the adaptive timeout until
+	// a second fragment of the RPC shows its rate
+	adaptiveFragmentGap = time.Millisecond
 )
 
+// rpcKey identifies the reassembly state of an RPC: the RPC ID and the address it is sent from
+type rpcKey struct {
+	connKey string
+	rpcID   uint64
+}
+
 // verdictKey is a composite key for storing verdicts that distinguishes requests from responses
 type verdictKey struct {
 	RPCID      uint64
 	PacketType util.PacketType
 }
 
-// verdictEntry stores verdict and timestamp for cleanup
-type verdictEntry struct {
-	Verdict    util.PacketVerdict
-	LastAccess time.Time
-}
-
 // rpcState tracks the state of an RPC's fragment reassembly
 // fragmentInfo stores fragment payload and completion status
 type fragmentInfo struct {
@@ -42,48 +47,139 @@ type fragmentInfo struct {
 	moreFragments bool // true if there are more fragments with the same SeqNumber
 }
 
+// rpcPhase is the stage an RPC has reached in the buffer. RPCs only move forward through the
+// phases, under their state.mu, so that every fragment has a single owner: the buffer while it
+// is held, then the one caller it is handed to.
+type rpcPhase uint8
+
+const (
+	// rpcBuffering holds the fragments until they cover the public segment
+	rpcBuffering rpcPhase = iota
+	// rpcHeadDecided is entered when the fragments covering the public segment are handed to
+	// the caller completing it, which decides the RPC with the element chain (see Decide).
+	// Later fragments are held.
+	rpcHeadDecided
+	// rpcDraining is entered when the RPC passed. Fragments are held until
+	// ProcessRemainingFragments hands them out.
+	rpcDraining
+	// rpcDone is entered when the held fragments were handed out, or discarded since the RPC
+	// was dropped. Later fragments are handed back at once with the verdict.
+	rpcDone
+)
+
 // rpcState tracks the state of an RPC's fragment reassembly
 type rpcState struct {
-	mu                     sync.Mutex                         // Per-RPC mutex for serialization
-	Fragments              map[uint16]map[uint8]*fragmentInfo // SeqNumber -> FragmentIndex -> fragmentInfo
-	TotalPackets           uint16
-	PublicSegmentExtracted bool
-	LastSeen               time.Time
+	mu             sync.Mutex                         // Per-RPC mutex for serialization
+	Fragments      map[uint16]map[uint8]*fragmentInfo // SeqNumber -> FragmentIndex -> fragmentInfo
+	TotalPackets   uint16
+	Phase          rpcPhase
+	LastUsedSeqNum uint16        // last sequence number of the public segment, after rpcBuffering
+	Verdict        StoredVerdict // in rpcDone
+	FirstSeen      time.Time
+	LastSeen       time.Time
+	Received       int             // fragments buffered, for the adaptive timeout
+	PacketType     util.PacketType // of the fragments, for diagnostics
+	StuckReported  bool            // the RPC was reported as stuck
+}
+
+// finish hands out or discards the held fragments of an RPC given verdict, returning them.
+// The caller must hold state.mu.
+func (state *rpcState) finish(verdict StoredVerdict) map[uint16]map[uint8]*fragmentInfo {
+	fragments := state.Fragments
+	state.Fragments = make(map[uint16]map[uint8]*fragmentInfo)
+	state.Phase = rpcDone
+	state.Verdict = verdict
+	return fragments
+}
+
+// complete reports whether all fragments of the RPC have been buffered. The caller must hold state.mu.
+func (state *rpcState) complete() bool {
+	if state.TotalPackets == 0 {
+		return false
+	}
+	for seqNum := uint16(0); seqNum < state.TotalPackets; seqNum++ {
+		seqFragments := state.Fragments[seqNum]
+		last := -1
+		for fragIdx, fragInfo := range seqFragments {
+			if !fragInfo.moreFragments {
+				last = int(fragIdx)
+			}
+		}
+		if last < 0 || len(seqFragments) != last+1 {
+			return false
+		}
+	}
+	return true
 }
 
-// shard manages fragments for a subset of connections
+// shard manages the fragments of a subset of RPCs. RPCs are spread over the shards by RPC
+// ID, so that the RPCs of a single busy connection do not contend on one lock.
 type shard struct {
 	mu        sync.RWMutex
-	rpcStates map[string]map[uint64]*rpcState // connKey -> rpcID -> state
+	rpcStates map[rpcKey]*rpcState
 }
 
 // PacketBuffer handles the buffering and reassembly of fragmented RPC packets
 type PacketBuffer struct {
 	shards        [numShards]*shard
-	verdicts      sync.Map // map[verdictKey]*verdictEntry
+	verdicts      VerdictStore
 	timeout       time.Duration
-	cleanupTicker *time.Ticker
+	minTimeout    time.Duration // 0 unless the timeout of each RPC adapts to its size and rate
+	cleanupTicker *time.Ticker  // nil if the buffer is cleaned up by its caller (see newPacketBuffer)
 	done          chan struct{}
+	sizeStats     *SizeStats // nil if size stats are disabled
+	mode          ProxyMode  // packets of the pipeline the mode disables are passed through unbuffered
+	buffering     BufferingMode
+	// stuck is read by the cleanup routine, and holds nil if stuck RPC detection is disabled
+	stuck atomic.Pointer[StuckRPCs]
+	// cleanupInterval is the period of cleanup, shortened by stuck RPC detection
+	cleanupInterval time.Duration
+	// now is the time source of LastSeen and of the LastAccess of the default verdict store.
+	// It is the coarse clock, since they are set for every fragment and only compared
+	// against the timeout.
+	now   func() time.Time
+	start time.Time // origin of monotonic timestamps
 }
 
 // NewPacketBuffer creates a new packet buffer
 func NewPacketBuffer(timeout time.Duration) *PacketBuffer {
+	return NewAdaptivePacketBuffer(0, timeout)
+}
+
+// NewAdaptivePacketBuffer creates a packet buffer whose RPCs expire after a timeout scaled
+// by their size and the rate their fragments arrive at, between minTimeout and maxTimeout
+// (see rpcTimeout). Verdicts expire after maxTimeout. A minTimeout of 0 gives every RPC
+// maxTimeout, like NewPacketBuffer.
+func NewAdaptivePacketBuffer(minTimeout, maxTimeout time.Duration) *PacketBuffer {
+	pb := newPacketBuffer(minTimeout, maxTimeout, common.CoarseNow)
+
+	// Start cleanup routine
+	pb.cleanupTicker = time.NewTicker(pb.cleanupInterval)
+	go pb.cleanupRoutine()
+
+	return pb
+}
+
+// newPacketBuffer creates a packet buffer reading the time from now, without a cleanup
+// routine: the caller runs cleanup every cleanupInterval. Simulations drive it with a virtual
+// clock.
+func newPacketBuffer(minTimeout, maxTimeout time.Duration, now func() time.Time) *PacketBuffer {
 	pb := &PacketBuffer{
-		timeout: timeout,
-		done:    make(chan struct{}),
+		timeout:    maxTimeout,
+		minTimeout: minTimeout,
+		done:       make(chan struct{}),
+		now:        now,
+		start:      now(),
 	}
+	pb.verdicts = &MemoryVerdictStore{clock: pb.monotonic}
+	pb.cleanupInterval = pb.shortestTimeout() / 2
 
 	// Initialize shards
 	for i := range pb.shards {
 		pb.shards[i] = &shard{
-			rpcStates: make(map[string]map[uint64]*rpcState),
+			rpcStates: make(map[rpcKey]*rpcState),
 		}
 	}
-
-	// Start cleanup routine
-	pb.cleanupTicker = time.NewTicker(timeout / 2)
-	go pb.cleanupRoutine()
-
 	return pb
 }
 
@@ -93,33 +189,89 @@ func (pb *PacketBuffer) Close() {
 		pb.cleanupTicker.Stop()
 	}
 	close(pb.done)
+	pb.verdicts.Close()
+}
+
+// DetectStuckRPCs makes the buffer report the RPCs that stuck detects, checking them often
+// enough to report them before they expire
+func (pb *PacketBuffer) DetectStuckRPCs(stuck *StuckRPCs) {
+	pb.stuck.Store(stuck)
+	if interval := stuck.after(pb.shortestTimeout()) / 2; interval > 0 && interval < pb.cleanupInterval {
+		pb.cleanupInterval = interval
+		if pb.cleanupTicker != nil {
+			pb.cleanupTicker.Reset(interval)
+		}
+	}
+}
+
+// shortestTimeout returns the shortest timeout an RPC may get
+func (pb *PacketBuffer) shortestTimeout() time.Duration {
+	if pb.minTimeout > 0 {
+		return pb.minTimeout
+	}
+	return pb.timeout
+}
+
+// rpcTimeout returns how long an RPC may go without new fragments before it expires. With the
+// adaptive timeout, it is the time the whole message takes at the rate its fragments have
+// arrived so far, plus the minimum timeout, up to the buffer timeout: a small RPC missing a
+// fragment is freed quickly, a large one arriving slowly is kept. The caller must hold state.mu.
+func (pb *PacketBuffer) rpcTimeout(state *rpcState) time.Duration {
+	if pb.minTimeout == 0 {
+		return pb.timeout
+	}
+	gap := adaptiveFragmentGap
+	if state.Received > 1 {
+		gap = state.LastSeen.Sub(state.FirstSeen) / time.Duration(state.Received-1)
+	}
+	return min(pb.minTimeout+gap*time.Duration(state.TotalPackets), pb.timeout)
+}
+
+// monotonic returns the time of pb.now as nanoseconds since the buffer was created. Unlike
+// wall clock times, these are not affected by clock adjustments.
+func (pb *PacketBuffer) monotonic() int64 {
+	return int64(pb.now().Sub(pb.start))
+}
+
+// getShard returns the shard for a given RPC ID. RPC IDs are often timestamps, so they are
+// mixed (Fibonacci hashing) before picking the shard.
+func (pb *PacketBuffer) getShard(rpcID uint64) *shard {
+	h := rpcID * 0x9E3779B97F4A7C15
+	return pb.shards[(h>>32)%numShards]
 }
 
-// getShard returns the shard for a given connection key
-func (pb *PacketBuffer) getShard(connKey string) *shard {
-	h := fnv.New32a()
-	h.Write([]byte(connKey))
-	return pb.shards[h.Sum32()%numShards]
+// getRPCState returns the RPC state for a connection and RPC ID, or nil if there is none
+func (s *shard) getRPCState(connKey string, rpcID uint64) *rpcState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rpcStates[rpcKey{connKey, rpcID}]
 }
 
 // getOrCreateRPCState gets or creates the RPC state for a connection and RPC ID
-func (s *shard) getOrCreateRPCState(connKey string, rpcID uint64, totalPackets uint16) *rpcState {
+func (s *shard) getOrCreateRPCState(connKey string, rpcID uint64, totalPackets uint16, now time.Time) *rpcState {
+	// Most fragments belong to an RPC whose state exists, which only needs the read lock
+	key := rpcKey{connKey, rpcID}
+	s.mu.RLock()
+	state, exists := s.rpcStates[key]
+	filled := exists && state.TotalPackets != 0 // TotalPackets is written under the write lock
+	s.mu.RUnlock()
+	if filled {
+		return state
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.rpcStates[connKey] == nil {
-		s.rpcStates[connKey] = make(map[uint64]*rpcState)
-	}
-
-	state, exists := s.rpcStates[connKey][rpcID]
+	state, exists = s.rpcStates[key]
 	if !exists {
 		state = &rpcState{
-			Fragments:              make(map[uint16]map[uint8]*fragmentInfo),
-			TotalPackets:           totalPackets,
-			PublicSegmentExtracted: false,
-			LastSeen:               time.Now(),
+			Fragments:    make(map[uint16]map[uint8]*fragmentInfo),
+			TotalPackets: totalPackets,
+			Phase:        rpcBuffering,
+			FirstSeen:    now,
+			LastSeen:     now,
 		}
-		s.rpcStates[connKey][rpcID] = state
+		s.rpcStates[key] = state
 	} else {
 		// Update TotalPackets if not set (don't update LastSeen here - that's done in addFragmentToBuffer)
 		if state.TotalPackets == 0 {
@@ -146,27 +298,9 @@ func (pb *PacketBuffer) ProcessPacket(data []byte, src *net.UDPAddr) (*util.Buff
 	peer := &net.UDPAddr{IP: net.IP(dataPacket.DstIP[:]), Port: int(dataPacket.DstPort)}
 	packetType := util.PacketType(dataPacket.PacketTypeID)
 
-	// Check if a verdict exists for this RPC ID and packet type
-	key := verdictKey{
-		RPCID:      dataPacket.RPCID,
-		PacketType: packetType,
-	}
-
-	if val, ok := pb.verdicts.Load(key); ok {
-		entry := val.(*verdictEntry)
-		// Update last access time atomically
-		pb.verdicts.Store(key, &verdictEntry{
-			Verdict:    entry.Verdict,
-			LastAccess: time.Now(),
-		})
-
-		logging.Debug("Verdict exists for RPC ID", zap.Uint64("rpcID", dataPacket.RPCID), zap.String("packetType", packetType.String()), zap.String("verdict", entry.Verdict.String()))
-		// Verdict exists, forward the packet immediately without buffering or element chain processing
-		isFull := dataPacket.TotalPackets == 1
-		seqNumber := uint16(0)
-		if !isFull {
-			seqNumber = dataPacket.SeqNumber
-		}
+	// Packets of a pipeline disabled by the proxy mode are forwarded as they arrive, like
+	// fragments of an RPC with a pass verdict
+	if !pb.mode.Processes(packetType) {
 		return &util.BufferedPacket{
 			Payload:      dataPacket.Payload,
 			Source:       src,
@@ -177,10 +311,22 @@ func (pb *PacketBuffer) ProcessPacket(data []byte, src *net.UDPAddr) (*util.Buff
 			DstPort:      dataPacket.DstPort,
 			SrcIP:        dataPacket.SrcIP,
 			SrcPort:      dataPacket.SrcPort,
-			IsFull:       isFull,
-			SeqNumber:    int16(seqNumber),
+			Extensions:   dataPacket.Extensions,
+			IsFull:       dataPacket.TotalPackets == 1,
+			SeqNumber:    int16(dataPacket.SeqNumber),
 			TotalPackets: dataPacket.TotalPackets,
-		}, entry.Verdict, nil
+		}, util.PacketVerdictPass, nil
+	}
+
+	if pb.sizeStats != nil {
+		pb.sizeStats.RecordPacket(dataPacket, src)
+	}
+
+	// Check if a verdict exists for this RPC ID and packet type
+	if entry, ok := pb.verdicts.Load(dataPacket.RPCID, packetType); ok {
+		logging.Debug("Verdict exists for RPC ID", zap.Uint64("rpcID", dataPacket.RPCID), zap.String("packetType", packetType.String()), zap.String("verdict", entry.Verdict.String()))
+		// Verdict exists, forward the packet immediately without buffering or element chain processing
+		return decidedPacket(dataPacket, src, entry), entry.Verdict, nil
 	}
 
 	// If this is the first packet, the entire public segment fits in MTU (offset_private < MTU),
@@ -197,6 +343,7 @@ func (pb *PacketBuffer) ProcessPacket(data []byte, src *net.UDPAddr) (*util.Buff
 			DstPort:      dataPacket.DstPort,
 			SrcIP:        dataPacket.SrcIP,
 			SrcPort:      dataPacket.SrcPort,
+			Extensions:   dataPacket.Extensions,
 			IsFull:       true,
 			SeqNumber:    -1,
 			TotalPackets: 1,
@@ -205,7 +352,11 @@ func (pb *PacketBuffer) ProcessPacket(data []byte, src *net.UDPAddr) (*util.Buff
 
 	logging.Debug("Adding fragment to buffer", zap.Uint64("rpcID", dataPacket.RPCID), zap.Int("seqNumber", int(dataPacket.SeqNumber)), zap.Int("size", len(dataPacket.Payload)))
 	// Otherwise, add fragment to buffer and check if we have enough data
-	publicSegment, lastUsedSeqNum := pb.addFragmentToBuffer(src, dataPacket)
+	publicSegment, lastUsedSeqNum, decided := pb.addFragmentToBuffer(src, dataPacket)
+	if decided != nil {
+		// The RPC was decided and its held fragments handed out since the verdict was looked up
+		return decidedPacket(dataPacket, src, *decided), decided.Verdict, nil
+	}
 	if publicSegment != nil {
 		// We have enough contiguous data to cover the public segment
 		return &util.BufferedPacket{
@@ -218,6 +369,7 @@ func (pb *PacketBuffer) ProcessPacket(data []byte, src *net.UDPAddr) (*util.Buff
 			DstPort:        dataPacket.DstPort,
 			SrcIP:          dataPacket.SrcIP,
 			SrcPort:        dataPacket.SrcPort,
+			Extensions:     dataPacket.Extensions,
 			IsFull:         false,
 			SeqNumber:      -1,
 			TotalPackets:   dataPacket.TotalPackets,
@@ -229,6 +381,40 @@ func (pb *PacketBuffer) ProcessPacket(data []byte, src *net.UDPAddr) (*util.Buff
 	return nil, util.PacketVerdictUnknown, nil
 }
 
+// decidedPacket returns a fragment of an RPC with a verdict, to forward without buffering or
+// element chain processing. The destination chosen by the element chain is applied, so that
+// all fragments follow the same route.
+func decidedPacket(dataPacket *packet.DataPacket, src *net.UDPAddr, entry StoredVerdict) *util.BufferedPacket {
+	peer := &net.UDPAddr{IP: net.IP(dataPacket.DstIP[:]), Port: int(dataPacket.DstPort)}
+	dstIP, dstPort := dataPacket.DstIP, dataPacket.DstPort
+	if entry.Route != nil {
+		peer = entry.Route
+		copy(dstIP[:], entry.Route.IP.To4())
+		dstPort = uint16(entry.Route.Port)
+	}
+
+	isFull := dataPacket.TotalPackets == 1
+	seqNumber := uint16(0)
+	if !isFull {
+		seqNumber = dataPacket.SeqNumber
+	}
+	return &util.BufferedPacket{
+		Payload:      dataPacket.Payload,
+		Source:       src,
+		Peer:         peer,
+		PacketType:   util.PacketType(dataPacket.PacketTypeID),
+		RPCID:        dataPacket.RPCID,
+		DstIP:        dstIP,
+		DstPort:      dstPort,
+		SrcIP:        dataPacket.SrcIP,
+		SrcPort:      dataPacket.SrcPort,
+		Extensions:   dataPacket.Extensions,
+		IsFull:       isFull,
+		SeqNumber:    int16(seqNumber),
+		TotalPackets: dataPacket.TotalPackets,
+	}
+}
+
 // offsetToPrivate extracts the offset to private segment from the payload
 // The offset is stored as a little-endian uint32 at bytes 1-5
 func offsetToPrivate(payload []byte) int {
@@ -248,17 +434,27 @@ func isOffsetPrivateLessThanMTU(payload []byte) bool {
 // addFragmentToBuffer adds a packet fragment to the buffer for reassembly
 // Returns the assembled public segment if enough data is available, nil otherwise
 // Also returns the last sequence number used in the public segment (if public segment is ready)
-func (pb *PacketBuffer) addFragmentToBuffer(src *net.UDPAddr, dataPacket *packet.DataPacket) ([]byte, uint16) {
+// If the RPC is done (see rpcDone), the fragment is not buffered and its verdict is returned.
+func (pb *PacketBuffer) addFragmentToBuffer(src *net.UDPAddr, dataPacket *packet.DataPacket) ([]byte, uint16, *StoredVerdict) {
 	connKey := src.String()
-	shard := pb.getShard(connKey)
-	state := shard.getOrCreateRPCState(connKey, dataPacket.RPCID, dataPacket.TotalPackets)
+	shard := pb.getShard(dataPacket.RPCID)
+	state := shard.getOrCreateRPCState(connKey, dataPacket.RPCID, dataPacket.TotalPackets, pb.now())
 
 	// Serialize fragment processing per RPC
 	state.mu.Lock()
 	defer state.mu.Unlock()
-
-	// If public segment was already extracted, just buffer this fragment and return nil
-	if state.PublicSegmentExtracted {
+	state.PacketType = util.PacketType(dataPacket.PacketTypeID)
+
+	switch state.Phase {
+	case rpcDone:
+		state.LastSeen = pb.now()
+		verdict := state.Verdict
+		return nil, 0, &verdict
+	case rpcHeadDecided, rpcDraining:
+		// Fragments of the public segment were handed out with it
+		if dataPacket.SeqNumber <= state.LastUsedSeqNum {
+			return nil, 0, nil
+		}
 		// Make a copy of the payload
 		payloadCopy := make([]byte, len(dataPacket.Payload))
 		copy(payloadCopy, dataPacket.Payload)
@@ -270,8 +466,9 @@ func (pb *PacketBuffer) addFragmentToBuffer(src *net.UDPAddr, dataPacket *packet
 			payload:       payloadCopy,
 			moreFragments: dataPacket.MoreFragments,
 		}
-		state.LastSeen = time.Now()
-		return nil, 0
+		state.LastSeen = pb.now()
+		state.Received++
+		return nil, 0, nil
 	}
 
 	// Make a copy of the payload
@@ -285,7 +482,13 @@ func (pb *PacketBuffer) addFragmentToBuffer(src *net.UDPAddr, dataPacket *packet
 		payload:       payloadCopy,
 		moreFragments: dataPacket.MoreFragments,
 	}
-	state.LastSeen = time.Now()
+	state.LastSeen = pb.now()
+	state.Received++
+
+	// With full buffering, the public segment is only returned once the whole message is here
+	if pb.buffering == BufferingFull && !state.complete() {
+		return nil, 0, nil
+	}
 
 	// Check if we have enough data to cover the public segment
 	fragments := state.Fragments // map[uint16]map[uint8]*fragmentInfo
@@ -293,11 +496,11 @@ func (pb *PacketBuffer) addFragmentToBuffer(src *net.UDPAddr, dataPacket *packet
 	// Check if first packet exists (SeqNumber=0, FragmentIndex=0) and get offsetToPrivate
 	seq0Fragments, hasSeq0 := fragments[0]
 	if !hasSeq0 || seq0Fragments == nil {
-		return nil, 0
+		return nil, 0, nil
 	}
 	firstFragmentInfo, hasFirstFragment := seq0Fragments[0]
 	if !hasFirstFragment || firstFragmentInfo == nil {
-		return nil, 0
+		return nil, 0, nil
 	}
 
 	offsetPrivate := offsetToPrivate(firstFragmentInfo.payload)
@@ -310,7 +513,7 @@ func (pb *PacketBuffer) addFragmentToBuffer(src *net.UDPAddr, dataPacket *packet
 		seqFragments, hasSeq := fragments[seqNum]
 		if !hasSeq || seqFragments == nil || len(seqFragments) == 0 {
 			// Missing fragment means we don't have contiguous data yet
-			return nil, 0
+			return nil, 0, nil
 		}
 
 		// For this SeqNumber, we need to check if we have all fragments from 0 to the last one
@@ -341,12 +544,12 @@ func (pb *PacketBuffer) addFragmentToBuffer(src *net.UDPAddr, dataPacket *packet
 					tempSize += len(fragInfo.payload)
 				} else {
 					// Missing fragment, need to wait
-					return nil, 0
+					return nil, 0, nil
 				}
 			}
 			if tempSize < offsetPrivate-cumulativeSize {
 				// We don't have enough data from this SeqNumber yet
-				return nil, 0
+				return nil, 0, nil
 			}
 		}
 
@@ -355,7 +558,7 @@ func (pb *PacketBuffer) addFragmentToBuffer(src *net.UDPAddr, dataPacket *packet
 			fragInfo, hasFragment := seqFragments[fragIdx]
 			if !hasFragment || fragInfo == nil {
 				// Missing fragment means we don't have contiguous data yet
-				return nil, 0
+				return nil, 0, nil
 			}
 			cumulativeSize += len(fragInfo.payload)
 			if cumulativeSize >= offsetPrivate {
@@ -406,11 +609,15 @@ reassemble:
 	}
 done:
 
-	// Mark that public segment has been extracted
-	state.PublicSegmentExtracted = true
+	// Hand the fragments of the public segment out with it
+	for seqNum := uint16(0); seqNum <= lastUsedSeqNum; seqNum++ {
+		delete(state.Fragments, seqNum)
+	}
+	state.Phase = rpcHeadDecided
+	state.LastUsedSeqNum = lastUsedSeqNum
 
 	logging.Debug("Reassembled public segment", zap.Uint64("rpcID", dataPacket.RPCID), zap.Int("size", len(publicSegment)), zap.Uint16("lastUsedSeqNum", lastUsedSeqNum))
-	return publicSegment, lastUsedSeqNum
+	return publicSegment, lastUsedSeqNum, nil
 }
 
 // deserializePacket extracts packet information using the existing packet codec
@@ -450,6 +657,8 @@ func (pb *PacketBuffer) ProcessErrorPacket(data []byte, src *net.UDPAddr) (*util
 	// Create BufferedPacket with error message as payload
 	bufferedPacket := &util.BufferedPacket{
 		Payload:      []byte(errorPacket.ErrorMsg),
+		RetryHint:    errorPacket.RetryHint,
+		DropReason:   errorPacket.DropReason,
 		Source:       src,
 		Peer:         peer,
 		PacketType:   util.PacketTypeError,
@@ -466,80 +675,40 @@ func (pb *PacketBuffer) ProcessErrorPacket(data []byte, src *net.UDPAddr) (*util
 	return bufferedPacket, nil
 }
 
-// CleanupUsedFragments removes fragments up to and including the lastUsedSeqNum
-// This should be called after the public segment has been successfully forwarded
-func (pb *PacketBuffer) CleanupUsedFragments(connKey string, rpcID uint64, lastUsedSeqNum uint16) {
-	shard := pb.getShard(connKey)
-	shard.mu.RLock()
-	rpcStates, exists := shard.rpcStates[connKey]
-	if !exists {
-		shard.mu.RUnlock()
-		return
-	}
-	state, exists := rpcStates[rpcID]
-	if !exists {
-		shard.mu.RUnlock()
-		return
-	}
-	shard.mu.RUnlock()
-
-	state.mu.Lock()
-	defer state.mu.Unlock()
-
-	// Remove fragments from sequence number 0 up to and including lastUsedSeqNum
-	for seqNum := uint16(0); seqNum <= lastUsedSeqNum; seqNum++ {
-		delete(state.Fragments, seqNum)
-	}
-
-	logging.Debug("Cleaned up used fragments",
-		zap.String("connKey", connKey),
-		zap.Uint64("rpcID", rpcID),
-		zap.Uint16("lastUsedSeqNum", lastUsedSeqNum))
-}
-
 // ProcessRemainingFragments processes remaining buffered fragments after a verdict has been stored.
 // It checks if a verdict exists for the RPC ID and packet type, then reconstructs BufferedPackets
-// for all remaining fragments using the provided metadata. Returns an empty slice if no verdict
-// exists or no remaining fragments are found.
+// for all remaining fragments using the provided metadata, and moves the RPC to rpcDone. Returns
+// an empty slice if no verdict exists, the verdict is drop (the fragments are discarded), or no
+// remaining fragments are found. The fragments are handed out once: concurrent calls get them
+// at most once overall.
 func (pb *PacketBuffer) ProcessRemainingFragments(connKey string, rpcID uint64, packetType util.PacketType, metadata *util.BufferedPacket) []*util.BufferedPacket {
 	// Check if a verdict exists for this RPC ID and packet type
-	key := verdictKey{
-		RPCID:      rpcID,
-		PacketType: packetType,
-	}
-
-	val, verdictExists := pb.verdicts.Load(key)
+	entry, verdictExists := pb.verdicts.Load(rpcID, packetType)
 	if !verdictExists {
 		logging.Debug("No verdict exists for remaining fragments", zap.Uint64("rpcID", rpcID), zap.String("packetType", packetType.String()))
 		return nil
 	}
 
-	entry := val.(*verdictEntry)
-	if entry.Verdict == util.PacketVerdictDrop {
-		logging.Debug("Verdict is drop for remaining fragments, skipping processing", zap.Uint64("rpcID", rpcID))
+	state := pb.getShard(rpcID).getRPCState(connKey, rpcID)
+	if state == nil {
 		return nil
 	}
 
-	shard := pb.getShard(connKey)
-	shard.mu.RLock()
-	rpcStates, exists := shard.rpcStates[connKey]
-	if !exists {
-		shard.mu.RUnlock()
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.Phase == rpcDone {
 		return nil
 	}
-	state, exists := rpcStates[rpcID]
-	if !exists {
-		shard.mu.RUnlock()
+	fragments := state.finish(entry)
+	if entry.Verdict == util.PacketVerdictDrop {
+		logging.Debug("Verdict is drop for remaining fragments, skipping processing", zap.Uint64("rpcID", rpcID))
 		return nil
 	}
-	shard.mu.RUnlock()
-
-	state.mu.Lock()
-	defer state.mu.Unlock()
 
 	// Count total fragments
 	totalFragmentCount := 0
-	for _, seqFragments := range state.Fragments {
+	for _, seqFragments := range fragments {
 		totalFragmentCount += len(seqFragments)
 	}
 
@@ -554,9 +723,7 @@ func (pb *PacketBuffer) ProcessRemainingFragments(connKey string, rpcID uint64,
 
 	// Create BufferedPacket for each remaining fragment
 	result := make([]*util.BufferedPacket, 0, totalFragmentCount)
-	seqNumsToDelete := make([]uint16, 0, len(state.Fragments))
-
-	for seqNum, seqFragments := range state.Fragments {
+	for seqNum, seqFragments := range fragments {
 		if seqFragments == nil {
 			continue
 		}
@@ -565,12 +732,9 @@ func (pb *PacketBuffer) ProcessRemainingFragments(connKey string, rpcID uint64,
 			if fragInfo == nil {
 				continue
 			}
-			// Make a copy of the payload
-			payloadCopy := make([]byte, len(fragInfo.payload))
-			copy(payloadCopy, fragInfo.payload)
-
+			// The fragments were taken from the buffer, their payloads are handed out as they are
 			bufferedPacket := &util.BufferedPacket{
-				Payload:      payloadCopy,
+				Payload:      fragInfo.payload,
 				Source:       metadata.Source,
 				Peer:         metadata.Peer,
 				PacketType:   packetType,
@@ -579,6 +743,7 @@ func (pb *PacketBuffer) ProcessRemainingFragments(connKey string, rpcID uint64,
 				DstPort:      metadata.DstPort,
 				SrcIP:        metadata.SrcIP,
 				SrcPort:      metadata.SrcPort,
+				Extensions:   metadata.Extensions,
 				IsFull:       false,
 				SeqNumber:    int16(seqNum),
 				TotalPackets: totalPackets,
@@ -592,12 +757,6 @@ func (pb *PacketBuffer) ProcessRemainingFragments(connKey string, rpcID uint64,
 				zap.Uint8("fragIdx", fragIdx),
 				zap.String("verdict", entry.Verdict.String()))
 		}
-		seqNumsToDelete = append(seqNumsToDelete, seqNum)
-	}
-
-	// Remove processed fragments from buffer
-	for _, seqNum := range seqNumsToDelete {
-		delete(state.Fragments, seqNum)
 	}
 
 	logging.Debug("Processed remaining fragments",
@@ -613,46 +772,53 @@ func (pb *PacketBuffer) cleanupRoutine() {
 	for {
 		select {
 		case <-pb.cleanupTicker.C:
-			pb.cleanupExpiredFragments()
-			pb.cleanupExpiredVerdicts()
+			pb.cleanup()
 		case <-pb.done:
 			return
 		}
 	}
 }
 
-// cleanupExpiredFragments removes fragments that have timed out
+// cleanup reports stuck RPCs, and removes expired fragments and verdicts
+func (pb *PacketBuffer) cleanup() {
+	if pb.stuck.Load() != nil {
+		pb.detectStuckRPCs()
+	}
+	pb.cleanupExpiredFragments()
+	pb.verdicts.Expire(pb.timeout)
+}
+
+// cleanupExpiredFragments removes the fragments of RPCs that have timed out (see rpcTimeout).
+// With stuck RPC detection, RPCs expiring before the detector saw them stuck are reported.
 func (pb *PacketBuffer) cleanupExpiredFragments() {
-	now := time.Now()
+	detector := pb.stuck.Load()
+	now := pb.now()
 	expiredCount := 0
+	var stuck []StuckRPC
 
 	for _, shard := range pb.shards {
 		shard.mu.Lock()
-		for connKey, rpcStates := range shard.rpcStates {
-			var toDelete []uint64
-			for rpcID, state := range rpcStates {
-				state.mu.Lock()
-				lastSeen := state.LastSeen
-				state.mu.Unlock()
-
-				if now.Sub(lastSeen) > pb.timeout {
-					// This RPC has timed out - mark for deletion
-					toDelete = append(toDelete, rpcID)
-					expiredCount++
-
-					logging.Debug("Cleaned up expired fragments",
-						zap.String("connKey", connKey),
-						zap.Uint64("rpcID", rpcID),
-						zap.Duration("age", now.Sub(lastSeen)))
-				}
-			}
-			// Delete expired RPCs
-			for _, rpcID := range toDelete {
-				delete(rpcStates, rpcID)
+		for key, state := range shard.rpcStates {
+			state.mu.Lock()
+			lastSeen := state.LastSeen
+			expired := now.Sub(lastSeen) > pb.rpcTimeout(state)
+			if detector != nil && expired && state.Phase == rpcBuffering && !state.StuckReported {
+				state.StuckReported = true
+				report := pb.stuckRPC(key, state, now)
+				report.Expired = true
+				stuck = append(stuck, report)
 			}
-			// Clean up empty connection maps
-			if len(rpcStates) == 0 {
-				delete(shard.rpcStates, connKey)
+			state.mu.Unlock()
+
+			if expired {
+				// This RPC has timed out
+				delete(shard.rpcStates, key)
+				expiredCount++
+
+				logging.Debug("Cleaned up expired fragments",
+					zap.String("connKey", key.connKey),
+					zap.Uint64("rpcID", key.rpcID),
+					zap.Duration("age", now.Sub(lastSeen)))
 			}
 		}
 		shard.mu.Unlock()
@@ -661,30 +827,8 @@ func (pb *PacketBuffer) cleanupExpiredFragments() {
 	if expiredCount > 0 {
 		logging.Debug("Cleanup completed", zap.Int("expiredRPCs", expiredCount))
 	}
-}
-
-// cleanupExpiredVerdicts removes verdicts that have timed out
-func (pb *PacketBuffer) cleanupExpiredVerdicts() {
-	now := time.Now()
-	expiredCount := 0
-
-	pb.verdicts.Range(func(key, value interface{}) bool {
-		entry := value.(*verdictEntry)
-		if now.Sub(entry.LastAccess) > pb.timeout {
-			pb.verdicts.Delete(key)
-			expiredCount++
-
-			verdictKey := key.(verdictKey)
-			logging.Debug("Cleaned up expired verdict",
-				zap.Uint64("rpcID", verdictKey.RPCID),
-				zap.String("packetType", verdictKey.PacketType.String()),
-				zap.Duration("age", now.Sub(entry.LastAccess)))
-		}
-		return true
-	})
-
-	if expiredCount > 0 {
-		logging.Debug("Verdict cleanup completed", zap.Int("expiredVerdicts", expiredCount))
+	for _, s := range stuck {
+		detector.report(s)
 	}
 }
 
@@ -696,38 +840,142 @@ func (pb *PacketBuffer) GetStats() map[string]any {
 		"totalFragments":    0,
 	}
 
+	// The RPCs of a connection are spread over the shards
+	connections := make(map[string]struct{})
 	for _, shard := range pb.shards {
 		shard.mu.RLock()
-		stats["activeConnections"] = stats["activeConnections"].(int) + len(shard.rpcStates)
-		for _, rpcStates := range shard.rpcStates {
-			for _, state := range rpcStates {
-				state.mu.Lock()
-				fragmentCount := 0
-				for _, seqFragments := range state.Fragments {
-					if seqFragments != nil {
-						fragmentCount += len(seqFragments)
-					}
+		for key, state := range shard.rpcStates {
+			connections[key.connKey] = struct{}{}
+			state.mu.Lock()
+			fragmentCount := 0
+			for _, seqFragments := range state.Fragments {
+				if seqFragments != nil {
+					fragmentCount += len(seqFragments)
 				}
-				stats["totalFragments"] = stats["totalFragments"].(int) + fragmentCount
-				state.mu.Unlock()
 			}
+			stats["totalFragments"] = stats["totalFragments"].(int) + fragmentCount
+			state.mu.Unlock()
 		}
 		shard.mu.RUnlock()
 	}
+	stats["activeConnections"] = len(connections)
+	if stuck := pb.stuck.Load(); stuck != nil {
+		stats["stuckRPCs"] = stuck.Count()
+	}
 
 	return stats
 }
 
-// StoreVerdict stores a verdict for an RPC ID and packet type
-func (pb *PacketBuffer) StoreVerdict(rpcID uint64, packetType util.PacketType, verdict util.PacketVerdict) {
-	key := verdictKey{
-		RPCID:      rpcID,
-		PacketType: packetType,
+// WriteMetrics writes the occupancy of the buffer in the Prometheus text exposition format,
+// as arpc_proxy_* series
+func (pb *PacketBuffer) WriteMetrics(w io.Writer) (int64, error) {
+	stats := pb.GetStats()
+	rpcs := 0
+	for _, shard := range pb.shards {
+		shard.mu.RLock()
+		rpcs += len(shard.rpcStates)
+		shard.mu.RUnlock()
+	}
+
+	var b strings.Builder
+	write := func(name, kind, help string, value any) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+	}
+	write("arpc_proxy_buffered_rpcs", "gauge", "Number of RPCs with fragments in the buffer.", rpcs)
+	write("arpc_proxy_buffered_fragments", "gauge", "Number of fragments in the buffer.", stats["totalFragments"])
+	write("arpc_proxy_buffered_connections", "gauge", "Number of connections with RPCs in the buffer.", stats["activeConnections"])
+	if stuck, ok := stats["stuckRPCs"]; ok {
+		write("arpc_proxy_stuck_rpcs_total", "counter", "Total number of RPCs reported stuck in reassembly.", stuck)
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// StoreVerdict stores a verdict for an RPC ID and packet type.
+// An optional route can be given when an element rewrote the destination; remaining
+// fragments of the same RPC are then forwarded to that address instead of the original one.
+func (pb *PacketBuffer) StoreVerdict(rpcID uint64, packetType util.PacketType, verdict util.PacketVerdict, route ...*net.UDPAddr) {
+	entry := StoredVerdict{Verdict: verdict}
+	if len(route) > 0 {
+		entry.Route = route[0]
+	}
+	pb.verdicts.Store(rpcID, packetType, entry)
+}
+
+// Decide records the verdict of the element chain on the public segment of an RPC from
+// connKey, like StoreVerdict, and moves the RPC on from rpcHeadDecided: if it passed, its
+// fragments are held for ProcessRemainingFragments, if it was dropped they are discarded.
+func (pb *PacketBuffer) Decide(connKey string, rpcID uint64, packetType util.PacketType, verdict util.PacketVerdict, route ...*net.UDPAddr) {
+	pb.StoreVerdict(rpcID, packetType, verdict, route...)
+	state := pb.getShard(rpcID).getRPCState(connKey, rpcID)
+	if state == nil {
+		return
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.Phase != rpcHeadDecided || state.PacketType != packetType {
+		return
+	}
+	if verdict == util.PacketVerdictDrop {
+		state.finish(StoredVerdict{Verdict: verdict})
+		return
+	}
+	state.Phase = rpcDraining
+}
+
+// Abort cancels an RPC whose client went away: its request and response get a drop verdict,
+// so that later fragments are discarded as they arrive, and the fragments buffered for it are
+// discarded. An element chain deciding the RPC meanwhile finds it done (see RPCAborts).
+func (pb *PacketBuffer) Abort(rpcID uint64) {
+	pb.StoreVerdict(rpcID, util.PacketTypeRequest, util.PacketVerdictDrop)
+	pb.StoreVerdict(rpcID, util.PacketTypeResponse, util.PacketVerdictDrop)
+
+	shard := pb.getShard(rpcID)
+	var states []*rpcState
+	shard.mu.RLock()
+	for key, state := range shard.rpcStates {
+		if key.rpcID == rpcID {
+			states = append(states, state)
+		}
+	}
+	shard.mu.RUnlock()
+	for _, state := range states {
+		state.mu.Lock()
+		if state.Phase != rpcDone {
+			state.finish(StoredVerdict{Verdict: util.PacketVerdictDrop})
+		}
+		state.mu.Unlock()
+	}
+}
+
+// rpcsFrom returns the IDs of the RPCs with fragments from connKey still to be handed out
+func (pb *PacketBuffer) rpcsFrom(connKey string) []uint64 {
+	var rpcIDs []uint64
+	for _, shard := range pb.shards {
+		shard.mu.RLock()
+		for key, state := range shard.rpcStates {
+			if key.connKey != connKey {
+				continue
+			}
+			state.mu.Lock()
+			if state.Phase != rpcDone {
+				rpcIDs = append(rpcIDs, key.rpcID)
+			}
+			state.mu.Unlock()
+		}
+		shard.mu.RUnlock()
+	}
+	return rpcIDs
+}
+
+// GetRoute returns the destination override stored for an RPC ID and packet type, or nil if none
+func (pb *PacketBuffer) GetRoute(rpcID uint64, packetType util.PacketType) *net.UDPAddr {
+	entry, ok := pb.verdicts.Load(rpcID, packetType)
+	if !ok {
+		return nil
 	}
-	pb.verdicts.Store(key, &verdictEntry{
-		Verdict:    verdict,
-		LastAccess: time.Now(),
-	})
+	return entry.Route
 }
 
 // FragmentedPacket represents a fragment ready to be sent
@@ -743,7 +991,7 @@ type FragmentedPacket struct {
 // Returns a slice of fragmented packets ready to send.
 func (pb *PacketBuffer) FragmentPacketForForward(bufferedPacket *util.BufferedPacket) ([]FragmentedPacket, error) {
 	completePayload := bufferedPacket.Payload
-	chunkSize := packet.MaxUDPPayloadSize - DataPacketHeaderSize
+	chunkSize := packet.MaxUDPPayloadSize - DataPacketHeaderSize - packet.ExtensionsSize(bufferedPacket.Extensions)
 
 	// Check if payload fits in a single packet
 	if len(completePayload) <= chunkSize {
@@ -764,6 +1012,7 @@ func (pb *PacketBuffer) FragmentPacketForForward(bufferedPacket *util.BufferedPa
 			DstPort:       bufferedPacket.DstPort,
 			SrcIP:         bufferedPacket.SrcIP,
 			SrcPort:       bufferedPacket.SrcPort,
+			Extensions:    bufferedPacket.Extensions,
 			Payload:       completePayload,
 		}
 
@@ -793,6 +1042,11 @@ func (pb *PacketBuffer) FragmentPacketForForward(bufferedPacket *util.BufferedPa
 	if bufferedPacket.SeqNumber == -1 {
 		lastUsedSeqNum := bufferedPacket.LastUsedSeqNum
 		availableSeqNums := lastUsedSeqNum + 1 // 0 to LastUsedSeqNum inclusive
+		// The fragments after LastUsedSeqNum are forwarded as they came, so the fragments of
+		// the public segment keep the total of the whole message. Receivers complete a message
+		// once they hold TotalPackets sequence numbers.
+		totalPackets := max(bufferedPacket.TotalPackets, totalfragments)
+		packedTotalPackets := max(bufferedPacket.TotalPackets, availableSeqNums)
 
 		if totalfragments <= availableSeqNums {
 			// Normal case: we have enough sequence numbers, use them normally
@@ -803,7 +1057,7 @@ func (pb *PacketBuffer) FragmentPacketForForward(bufferedPacket *util.BufferedPa
 				fragment := &packet.DataPacket{
 					PacketTypeID:  packet.PacketTypeID(uint8(bufferedPacket.PacketType)),
 					RPCID:         bufferedPacket.RPCID,
-					TotalPackets:  totalfragments,
+					TotalPackets:  totalPackets,
 					SeqNumber:     uint16(i),
 					MoreFragments: false,
 					FragmentIndex: 0,
@@ -811,6 +1065,7 @@ func (pb *PacketBuffer) FragmentPacketForForward(bufferedPacket *util.BufferedPa
 					DstPort:       bufferedPacket.DstPort,
 					SrcIP:         bufferedPacket.SrcIP,
 					SrcPort:       bufferedPacket.SrcPort,
+					Extensions:    bufferedPacket.Extensions,
 					Payload:       completePayload[start:end],
 				}
 
@@ -847,7 +1102,7 @@ func (pb *PacketBuffer) FragmentPacketForForward(bufferedPacket *util.BufferedPa
 				fragment := &packet.DataPacket{
 					PacketTypeID:  packet.PacketTypeID(uint8(bufferedPacket.PacketType)),
 					RPCID:         bufferedPacket.RPCID,
-					TotalPackets:  availableSeqNums, // Use LastUsedSeqNum + 1, not totalfragments
+					TotalPackets:  packedTotalPackets, // At least LastUsedSeqNum + 1, not totalfragments
 					SeqNumber:     seqNum,
 					MoreFragments: false,
 					FragmentIndex: 0,
@@ -855,6 +1110,7 @@ func (pb *PacketBuffer) FragmentPacketForForward(bufferedPacket *util.BufferedPa
 					DstPort:       bufferedPacket.DstPort,
 					SrcIP:         bufferedPacket.SrcIP,
 					SrcPort:       bufferedPacket.SrcPort,
+					Extensions:    bufferedPacket.Extensions,
 					Payload:       completePayload[start:end],
 				}
 
@@ -894,7 +1150,7 @@ func (pb *PacketBuffer) FragmentPacketForForward(bufferedPacket *util.BufferedPa
 				fragment := &packet.DataPacket{
 					PacketTypeID:  packet.PacketTypeID(uint8(bufferedPacket.PacketType)),
 					RPCID:         bufferedPacket.RPCID,
-					TotalPackets:  availableSeqNums, // Use LastUsedSeqNum + 1, not totalfragments
+					TotalPackets:  packedTotalPackets, // At least LastUsedSeqNum + 1, not totalfragments
 					SeqNumber:     lastUsedSeqNum,
 					MoreFragments: moreFragments,
 					FragmentIndex: fragIdx,
@@ -902,6 +1158,7 @@ func (pb *PacketBuffer) FragmentPacketForForward(bufferedPacket *util.BufferedPa
 					DstPort:       bufferedPacket.DstPort,
 					SrcIP:         bufferedPacket.SrcIP,
 					SrcPort:       bufferedPacket.SrcPort,
+					Extensions:    bufferedPacket.Extensions,
 					Payload:       completePayload[start:end],
 				}
 
@@ -954,6 +1211,7 @@ func (pb *PacketBuffer) FragmentPacketForForward(bufferedPacket *util.BufferedPa
 			DstPort:       bufferedPacket.DstPort,
 			SrcIP:         bufferedPacket.SrcIP,
 			SrcPort:       bufferedPacket.SrcPort,
+			Extensions:    bufferedPacket.Extensions,
 			Payload:       completePayload[start:end],
 		}
 
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"bufio"
 	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/common"
 	"github.com/appnet-org/arpc/pkg/logging"
 	"github.com/appnet-org/arpc/pkg/packet"
 )
@@ -102,32 +110,24 @@ func TestPacketBuffer_ConcurrentFragmentProcessing(t *testing.T) {
 	// Test concurrent fragment processing for same RPC
 	var wg sync.WaitGroup
 	errors := make(chan error, 10)
-
-	// Send fragments concurrently
-	wg.Add(3)
-	go func() {
-		defer wg.Done()
-		_, _, err := pb.ProcessPacket(data0, src)
-		if err != nil {
-			errors <- err
-		}
-	}()
-	go func() {
+	var heads atomic.Int32
+	process := func(data []byte) {
 		defer wg.Done()
-		time.Sleep(10 * time.Millisecond) // Slight delay to ensure fragment 0 arrives first
-		_, _, err := pb.ProcessPacket(data1, src)
+		buffered, _, err := pb.ProcessPacket(data, src)
 		if err != nil {
 			errors <- err
 		}
-	}()
-	go func() {
-		defer wg.Done()
-		time.Sleep(20 * time.Millisecond)
-		_, _, err := pb.ProcessPacket(data2, src)
-		if err != nil {
-			errors <- err
+		if buffered != nil && buffered.SeqNumber == -1 {
+			heads.Add(1)
 		}
-	}()
+	}
+
+	// Send fragments concurrently, in any order (the orders themselves are enumerated by
+	// TestSimulation_PassAllOrders)
+	wg.Add(3)
+	go process(data0)
+	go process(data1)
+	go process(data2)
 
 	wg.Wait()
 	close(errors)
@@ -141,12 +141,13 @@ func TestPacketBuffer_ConcurrentFragmentProcessing(t *testing.T) {
 		}
 	}
 
-	// Verify that at least one fragment was processed successfully
-	// Note: Fragment 0 may have already been processed and extracted, so it might return nil on re-processing
-	// The test verifies that concurrent processing doesn't cause panics or data races
+	// The public segment is handed out exactly once, whatever the order of the fragments
 	if errorCount > 0 {
 		t.Errorf("Expected no errors, got %d errors", errorCount)
 	}
+	if n := heads.Load(); n != 1 {
+		t.Errorf("Expected the public segment once, got it %d times", n)
+	}
 }
 
 func TestPacketBuffer_VerdictStorageRetrievalRace(t *testing.T) {
@@ -212,9 +213,6 @@ func TestPacketBuffer_ProcessRemainingFragmentsRace(t *testing.T) {
 	packetType := util.PacketTypeRequest
 	connKey := src.String()
 
-	// Store a verdict first
-	pb.StoreVerdict(rpcID, packetType, util.PacketVerdictPass)
-
 	// Create metadata
 	metadata := &util.BufferedPacket{
 		Source:       src,
@@ -251,6 +249,9 @@ func TestPacketBuffer_ProcessRemainingFragmentsRace(t *testing.T) {
 	// Process fragment 1 (should be buffered)
 	_, _, _ = pb.ProcessPacket(data1, src)
 
+	// Decide the RPC
+	pb.Decide(connKey, rpcID, packetType, util.PacketVerdictPass)
+
 	// Test concurrent ProcessRemainingFragments calls
 	var wg sync.WaitGroup
 	const numGoroutines = 20
@@ -266,58 +267,185 @@ func TestPacketBuffer_ProcessRemainingFragmentsRace(t *testing.T) {
 
 	wg.Wait()
 
-	// Verify that only one goroutine got fragments (or all got empty)
+	// Verify that exactly one goroutine got the held fragment
 	nonEmptyCount := 0
 	for _, result := range results {
 		if len(result) > 0 {
 			nonEmptyCount++
+			if len(result) != 1 || result[0].SeqNumber != 1 {
+				t.Errorf("Expected fragment 1, got %d fragments", len(result))
+			}
+		}
+	}
+	if nonEmptyCount != 1 {
+		t.Errorf("Expected 1 goroutine to get fragments, got %d", nonEmptyCount)
+	}
+}
+
+// Test the phases of an RPC in the buffer, including a fragment that missed the verdict
+// when it was looked up (added to the buffer directly)
+func TestPacketBuffer_RPCPhases(t *testing.T) {
+	pb := NewPacketBuffer(5 * time.Second)
+	defer pb.Close()
+
+	src := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 5), Port: 9090}
+	connKey := src.String()
+	payload := createPayloadWithOffset(500, 1200)
+	fragment := func(rpcID uint64, seq uint16) *packet.DataPacket {
+		return createDataPacket(rpcID, seq, 4, payload[int(seq)*400:int(seq+1)*400])
+	}
+	phase := func(rpcID uint64) rpcPhase {
+		state := pb.getShard(rpcID).getRPCState(connKey, rpcID)
+		state.mu.Lock()
+		defer state.mu.Unlock()
+		return state.Phase
+	}
+
+	for _, verdict := range []util.PacketVerdict{util.PacketVerdictPass, util.PacketVerdictDrop} {
+		rpcID := uint64(100 + verdict)
+		if head, _, _ := pb.ProcessPacket(serializePacket(fragment(rpcID, 0)), src); head != nil || phase(rpcID) != rpcBuffering {
+			t.Fatalf("Expected fragment 0 to be buffered, got %+v", head)
+		}
+		head, _, _ := pb.ProcessPacket(serializePacket(fragment(rpcID, 1)), src)
+		if head == nil || head.SeqNumber != -1 || head.LastUsedSeqNum != 1 || phase(rpcID) != rpcHeadDecided {
+			t.Fatalf("Expected the public segment from fragments 0-1, got %+v", head)
+		}
+		// A duplicate of the public segment is discarded, later fragments are held
+		if _, _, decided := pb.addFragmentToBuffer(src, fragment(rpcID, 1)); decided != nil {
+			t.Errorf("Expected the duplicate of fragment 1 to be discarded, got %v", decided.Verdict)
+		}
+		if _, _, decided := pb.addFragmentToBuffer(src, fragment(rpcID, 2)); decided != nil {
+			t.Errorf("Expected fragment 2 to be held, got %v", decided.Verdict)
+		}
+
+		pb.Decide(connKey, rpcID, util.PacketTypeRequest, verdict)
+		if verdict == util.PacketVerdictPass {
+			if phase(rpcID) != rpcDraining {
+				t.Fatalf("Expected a passed RPC to be draining, got phase %d", phase(rpcID))
+			}
+			remaining := pb.ProcessRemainingFragments(connKey, rpcID, util.PacketTypeRequest, head)
+			if len(remaining) != 1 || remaining[0].SeqNumber != 2 {
+				t.Errorf("Expected fragment 2 to be handed out, got %d fragments", len(remaining))
+			}
+		}
+		if phase(rpcID) != rpcDone {
+			t.Fatalf("Expected the RPC to be done, got phase %d", phase(rpcID))
+		}
+		if remaining := pb.ProcessRemainingFragments(connKey, rpcID, util.PacketTypeRequest, head); len(remaining) != 0 {
+			t.Errorf("Expected the fragments to be handed out once, got %d more", len(remaining))
+		}
+
+		// A fragment arriving once the RPC is done is handed back with the verdict
+		got, gotVerdict, err := pb.ProcessPacket(serializePacket(fragment(rpcID, 3)), src)
+		if err != nil || got == nil || got.SeqNumber != 3 || gotVerdict != verdict {
+			t.Errorf("Expected fragment 3 with verdict %v, got %+v %v %v", verdict, got, gotVerdict, err)
+		}
+		if _, _, decided := pb.addFragmentToBuffer(src, fragment(rpcID, 3)); decided == nil || decided.Verdict != verdict {
+			t.Errorf("Expected fragment 3 to be handed back with verdict %v", verdict)
+		}
+		if n := pb.GetStats()["totalFragments"].(int); n != 0 {
+			t.Errorf("Expected no buffered fragments, got %d", n)
+		}
+	}
+}
+
+// Test that every fragment arriving while an RPC is decided is forwarded exactly once: held and
+// handed out by ProcessRemainingFragments, or handed back by ProcessPacket once the RPC is done
+func TestPacketBuffer_DecideRace(t *testing.T) {
+	pb := NewPacketBuffer(5 * time.Second)
+	defer pb.Close()
+
+	src := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 5), Port: 9090}
+	connKey := src.String()
+	rpcID := uint64(98765)
+	const total = 64
+	payload := createPayloadWithOffset(100, 50)
+
+	head, _, err := pb.ProcessPacket(serializePacket(createDataPacket(rpcID, 0, total, payload)), src)
+	if err != nil || head == nil {
+		t.Fatalf("Expected the public segment from fragment 0, got %+v %v", head, err)
+	}
+
+	var mu sync.Mutex
+	forwarded := make(map[int16]int)
+	record := func(fragments ...*util.BufferedPacket) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, f := range fragments {
+			forwarded[f.SeqNumber]++
 		}
 	}
 
-	// Either all should be empty (fragments already processed) or one should have fragments
-	if nonEmptyCount > 1 {
-		t.Errorf("Expected at most 1 goroutine to get fragments, got %d", nonEmptyCount)
+	var wg sync.WaitGroup
+	wg.Add(total)
+	for seq := uint16(1); seq < total; seq++ {
+		go func() {
+			defer wg.Done()
+			fragment, verdict, err := pb.ProcessPacket(serializePacket(createDataPacket(rpcID, seq, total, payload)), src)
+			if err != nil {
+				t.Errorf("Error processing fragment %d: %v", seq, err)
+			}
+			if fragment != nil && verdict == util.PacketVerdictPass {
+				record(fragment)
+			}
+		}()
+	}
+	go func() {
+		defer wg.Done()
+		pb.Decide(connKey, rpcID, util.PacketTypeRequest, util.PacketVerdictPass)
+		record(pb.ProcessRemainingFragments(connKey, rpcID, util.PacketTypeRequest, head)...)
+	}()
+	wg.Wait()
+
+	for seq := int16(1); seq < total; seq++ {
+		if forwarded[seq] != 1 {
+			t.Errorf("Fragment %d was forwarded %d times", seq, forwarded[seq])
+		}
 	}
 }
 
 func TestPacketBuffer_CleanupRace(t *testing.T) {
-	pb := NewPacketBuffer(100 * time.Millisecond) // Short timeout for testing
+	// The clock moves a timeout forward at every cleanup, so that cleanups expire the RPCs
+	// being buffered concurrently
+	const timeout = 100 * time.Millisecond
+	var elapsed atomic.Int64
+	start := time.Now()
+	pb := newPacketBuffer(0, timeout, func() time.Time { return start.Add(time.Duration(elapsed.Load())) })
 	defer pb.Close()
 
 	src := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 6), Port: 9090}
-	rpcID := uint64(77777)
-
-	// Add fragments
-	payload := createPayloadWithOffset(100, 50)
-	pkt := createDataPacket(rpcID, 0, 1, payload)
-	data := serializePacket(pkt)
 
 	var wg sync.WaitGroup
 	const numGoroutines = 20
 
-	// Concurrent packet processing
+	// Concurrent packet processing of RPCs missing their last fragment
 	wg.Add(numGoroutines)
 	for i := 0; i < numGoroutines; i++ {
 		go func() {
 			defer wg.Done()
+			data := serializePacket(createDataPacket(uint64(77777+i), 0, 2, createPayloadWithOffset(2000, 50)[:1000]))
 			_, _, _ = pb.ProcessPacket(data, src)
 		}()
 	}
 
-	// Concurrent cleanup (triggered by timer)
+	// Concurrent cleanup
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		// Wait for timeout
-		time.Sleep(150 * time.Millisecond)
-		// Cleanup should happen automatically via cleanup routine
-		time.Sleep(50 * time.Millisecond)
+		for i := 0; i < numGoroutines; i++ {
+			elapsed.Add(int64(2 * timeout))
+			pb.cleanup()
+		}
 	}()
 
 	wg.Wait()
 
-	// Verify no panics or data races occurred
-	// If we get here, the test passed
+	// Verify no panics or data races occurred, and that the RPCs left expire
+	elapsed.Add(int64(2 * timeout))
+	pb.cleanup()
+	if stats := pb.GetStats(); stats["activeConnections"] != 0 {
+		t.Errorf("Expected all RPCs to expire, got %v", stats)
+	}
 }
 
 func TestPacketBuffer_DifferentRPCsConcurrent(t *testing.T) {
@@ -761,9 +889,6 @@ func TestPacketBuffer_LargeMessageFragmentsOutOfOrder(t *testing.T) {
 		TotalPackets: totalPackets,
 	}
 
-	// Cleanup used fragments (fragment 0)
-	pb.CleanupUsedFragments(connKey, rpcID, bufferedPacket.LastUsedSeqNum)
-
 	// Get remaining fragments (should be fragments 1 and 2)
 	remaining := pb.ProcessRemainingFragments(connKey, rpcID, util.PacketTypeRequest, metadata)
 	t.Logf("Remaining fragments: %d", len(remaining))
@@ -1370,6 +1495,418 @@ func TestFragmentPacketForForward_LastUsedSeqNum_NormalCase(t *testing.T) {
 }
 
 // TestErrorPacketCodec_SerializeDeserialize tests error packet serialization and deserialization with IP/port fields
+func TestPacketBuffer_ForwardPreservesExtensions(t *testing.T) {
+	pb := NewPacketBuffer(5 * time.Second)
+	defer pb.Close()
+
+	src := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 9090}
+	dataPacket := createDataPacket(777, 0, 1, createPayloadWithOffset(100, 50))
+	dataPacket.SetExtension(packet.ExtensionPriority, []byte{5})
+	dataPacket.SetExtension(packet.ExtensionType(250), []byte("unknown"))
+
+	buffered, _, err := pb.ProcessPacket(serializePacket(dataPacket), src)
+	if err != nil {
+		t.Fatalf("ProcessPacket failed: %v", err)
+	}
+	if buffered == nil {
+		t.Fatal("Expected single packet to be processed immediately")
+	}
+
+	// Grow the payload so the forwarded packet needs several fragments
+	buffered.Payload = make([]byte, 3*packet.MaxUDPPayloadSize)
+	fragments, err := pb.FragmentPacketForForward(buffered)
+	if err != nil {
+		t.Fatalf("FragmentPacketForForward failed: %v", err)
+	}
+
+	codec := &packet.DataPacketCodec{}
+	for i, fragment := range fragments {
+		if len(fragment.Data) > packet.MaxUDPPayloadSize {
+			t.Errorf("Fragment %d is %d bytes, exceeds MaxUDPPayloadSize", i, len(fragment.Data))
+		}
+		decoded, err := codec.Deserialize(fragment.Data)
+		if err != nil {
+			t.Fatalf("Failed to deserialize fragment %d: %v", i, err)
+		}
+		forwarded := decoded.(*packet.DataPacket)
+		if v, ok := forwarded.GetExtension(packet.ExtensionPriority); !ok || v[0] != 5 {
+			t.Errorf("Fragment %d lost the priority extension", i)
+		}
+		if v, ok := forwarded.GetExtension(packet.ExtensionType(250)); !ok || string(v) != "unknown" {
+			t.Errorf("Fragment %d lost the unknown extension", i)
+		}
+	}
+}
+
+// Test that fragments of a pipeline disabled by the proxy mode are passed through unbuffered
+func TestPacketBuffer_ModePassThrough(t *testing.T) {
+	pb := NewPacketBuffer(5 * time.Second)
+	defer pb.Close()
+	pb.mode = ProxyModeInbound
+
+	src := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 9090}
+	fragment := createDataPacket(888, 1, 3, []byte{1, 2, 3})
+	buffered, verdict, err := pb.ProcessPacket(serializePacket(fragment), src)
+	if err != nil {
+		t.Fatalf("ProcessPacket failed: %v", err)
+	}
+	if buffered == nil || verdict != util.PacketVerdictPass {
+		t.Fatalf("Expected request fragment to be passed through, got %v with verdict %v", buffered, verdict)
+	}
+	if buffered.SeqNumber != 1 || buffered.IsFull || string(buffered.Payload) != "\x01\x02\x03" {
+		t.Errorf("Unexpected passed-through fragment %+v", buffered)
+	}
+
+	// Responses are still buffered until the public segment is complete
+	response := createDataPacket(888, 1, 3, []byte{1, 2, 3})
+	response.PacketTypeID = packet.PacketTypeResponse.TypeID
+	buffered, verdict, err = pb.ProcessPacket(serializePacket(response), src)
+	if err != nil {
+		t.Fatalf("ProcessPacket failed: %v", err)
+	}
+	if buffered != nil || verdict != util.PacketVerdictUnknown {
+		t.Errorf("Expected response fragment to be buffered, got %v with verdict %v", buffered, verdict)
+	}
+}
+
+func TestPacketBuffer_FullBuffering(t *testing.T) {
+	pb := NewPacketBuffer(5 * time.Second)
+	defer pb.Close()
+	pb.buffering = BufferingFull
+
+	src := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 9090}
+	fragments := []*packet.DataPacket{
+		createDataPacket(555, 0, 3, createPayloadWithOffset(16, 100)),
+		createDataPacket(555, 1, 3, []byte{1, 2, 3}),
+		createDataPacket(555, 2, 3, []byte{4, 5, 6}),
+	}
+
+	// The public segment is in the first fragment, but nothing is returned before the last one arrives
+	for _, i := range []int{0, 2} {
+		buffered, _, err := pb.ProcessPacket(serializePacket(fragments[i]), src)
+		if err != nil {
+			t.Fatalf("ProcessPacket failed: %v", err)
+		}
+		if buffered != nil {
+			t.Fatalf("Expected fragment %d to be buffered, got %+v", i, buffered)
+		}
+	}
+	buffered, _, err := pb.ProcessPacket(serializePacket(fragments[1]), src)
+	if err != nil {
+		t.Fatalf("ProcessPacket failed: %v", err)
+	}
+	if buffered == nil || buffered.LastUsedSeqNum != 0 {
+		t.Fatalf("Expected the public segment once all fragments arrived, got %+v", buffered)
+	}
+
+	// The other fragments are all buffered and forwarded right after the verdict
+	pb.StoreVerdict(555, util.PacketTypeRequest, util.PacketVerdictPass)
+	remaining := pb.ProcessRemainingFragments(src.String(), 555, util.PacketTypeRequest, buffered)
+	if len(remaining) != 2 {
+		t.Errorf("Expected 2 remaining fragments, got %d", len(remaining))
+	}
+
+	if _, err := ParseBufferingMode("partial"); err == nil {
+		t.Error("Expected error for unknown buffering mode")
+	}
+}
+
+// TestPacketBuffer_StuckRPCs checks that an RPC missing fragments is reported once idle for
+// the stuck threshold, and that one expiring unreported is reported on expiry
+func TestPacketBuffer_StuckRPCs(t *testing.T) {
+	pb := NewPacketBuffer(10 * time.Second)
+	defer pb.Close()
+	now := time.Now()
+	pb.now = func() time.Time { return now }
+	stuck := NewStuckRPCs(50, nil)
+	pb.stuck.Store(stuck)
+
+	src := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 9090}
+	// The public segment of 3000 bytes spans the first fragments, 1 is missing and the
+	// second fragment of 2 never arrives
+	first := createDataPacket(321, 0, 4, createPayloadWithOffset(3000, 0)[:1000])
+	partial := createDataPacket(321, 2, 4, make([]byte, 1000))
+	partial.MoreFragments = true
+	last := createDataPacket(321, 3, 4, make([]byte, 500))
+	for _, fragment := range []*packet.DataPacket{first, partial, last} {
+		if buffered, _, err := pb.ProcessPacket(serializePacket(fragment), src); err != nil || buffered != nil {
+			t.Fatalf("ProcessPacket returned %+v, %v, want the fragment buffered", buffered, err)
+		}
+	}
+	// The public segment of this RPC was processed, it is not stuck
+	if buffered, _, _ := pb.ProcessPacket(serializePacket(createDataPacket(654, 0, 2, createPayloadWithOffset(16, 100))), src); buffered == nil {
+		t.Fatal("Expected the public segment of RPC 654")
+	}
+	pb.StoreVerdict(321, util.PacketTypeResponse, util.PacketVerdictDrop)
+
+	now = now.Add(4 * time.Second)
+	pb.detectStuckRPCs()
+	if stuck.Count() != 0 {
+		t.Fatalf("Expected no stuck RPC before the threshold, got %d", stuck.Count())
+	}
+
+	now = now.Add(2 * time.Second)
+	pb.detectStuckRPCs()
+	pb.detectStuckRPCs()
+	if stuck.Count() != 1 {
+		t.Fatalf("Expected 1 stuck RPC reported once, got %d", stuck.Count())
+	}
+	report := stuck.Recent()[0]
+	if report.RPCID != 321 || report.Source != src.String() || report.PacketType != util.PacketTypeRequest.String() || report.Expired {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if report.CompleteSeqs != "0,3" || report.PartialSeqs != "2" || report.MissingSeqs != "1" {
+		t.Errorf("Expected complete 0,3, partial 2 and missing 1, got %q, %q and %q", report.CompleteSeqs, report.PartialSeqs, report.MissingSeqs)
+	}
+	if report.Fragments != 3 || report.BufferedBytes != 2500 || report.PublicBytes != 3000 || report.TotalPackets != 4 {
+		t.Errorf("Expected 3 fragments, 2500 bytes buffered and a public segment of 3000 bytes, got %+v", report)
+	}
+	if report.ResponseVerdict != eventVerdict(util.PacketVerdictDrop) || report.Idle != 6*time.Second {
+		t.Errorf("Expected the drop verdict of the response and 6s idle, got %+v", report)
+	}
+	if stats := pb.GetStats(); stats["stuckRPCs"] != uint64(1) {
+		t.Errorf("Expected stuckRPCs 1 in the buffer stats, got %v", stats["stuckRPCs"])
+	}
+
+	// An RPC expiring before being detected is reported with its expiry
+	if _, _, err := pb.ProcessPacket(serializePacket(createDataPacket(987, 1, 2, make([]byte, 100))), src); err != nil {
+		t.Fatalf("ProcessPacket failed: %v", err)
+	}
+	now = now.Add(11 * time.Second)
+	pb.cleanupExpiredFragments()
+	if stuck.Count() != 2 {
+		t.Fatalf("Expected the expired RPC to be reported, got %d stuck RPCs", stuck.Count())
+	}
+	if report := stuck.Recent()[0]; report.RPCID != 987 || !report.Expired || report.MissingSeqs != "0" {
+		t.Errorf("Unexpected report of the expired RPC %+v", report)
+	}
+
+	recorder := httptest.NewRecorder()
+	stuck.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stats/stuck", nil))
+	var status struct {
+		StuckRPC uint64 `json:"stuck_rpc"`
+		Recent   []struct {
+			RPCID uint64 `json:"rpcID"`
+		} `json:"recent"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if status.StuckRPC != 2 || len(status.Recent) != 2 {
+		t.Errorf("Expected stuck_rpc 2 with 2 reports, got %+v", status)
+	}
+}
+
+// TestPacketBuffer_AdaptiveTimeout checks that RPCs expire after a timeout scaled by their
+// size and fragment rate, within the clamps
+func TestPacketBuffer_AdaptiveTimeout(t *testing.T) {
+	pb := NewAdaptivePacketBuffer(time.Second, 30*time.Second)
+	defer pb.Close()
+	now := time.Now()
+	pb.now = func() time.Time { return now }
+
+	// The first fragments are missing, so that none of the RPCs is processed
+	src := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 9090}
+	receive := func(rpcID uint64, seqNum, totalPackets uint16) {
+		t.Helper()
+		if _, _, err := pb.ProcessPacket(serializePacket(createDataPacket(rpcID, seqNum, totalPackets, make([]byte, 100))), src); err != nil {
+			t.Fatalf("ProcessPacket failed: %v", err)
+		}
+	}
+	receive(1, 1, 2)
+	receive(2, 1, 20)
+	receive(3, 1, 1000)
+	now = now.Add(100 * time.Millisecond)
+	receive(2, 2, 20)
+	receive(3, 2, 1000)
+
+	timeouts := map[uint64]time.Duration{
+		1: time.Second + 2*adaptiveFragmentGap, // rate not observed yet
+		2: time.Second + 20*100*time.Millisecond,
+		3: 30 * time.Second, // clamped
+	}
+	for rpcID, want := range timeouts {
+		state := pb.getShard(rpcID).getRPCState(src.String(), rpcID)
+		state.mu.Lock()
+		got := pb.rpcTimeout(state)
+		state.mu.Unlock()
+		if got != want {
+			t.Errorf("RPC %d: expected a timeout of %v, got %v", rpcID, want, got)
+		}
+	}
+
+	buffered := func(rpcID uint64) bool {
+		return pb.getShard(rpcID).getRPCState(src.String(), rpcID) != nil
+	}
+	now = now.Add(1500 * time.Millisecond)
+	pb.cleanupExpiredFragments()
+	if buffered(1) || !buffered(2) || !buffered(3) {
+		t.Errorf("Expected only RPC 1 to expire after 1.5s, buffered: %v %v %v", buffered(1), buffered(2), buffered(3))
+	}
+	now = now.Add(2 * time.Second)
+	pb.cleanupExpiredFragments()
+	if buffered(2) || !buffered(3) {
+		t.Errorf("Expected RPC 2 to expire after 3.5s and RPC 3 to be kept, buffered: %v %v", buffered(2), buffered(3))
+	}
+	now = now.Add(27 * time.Second)
+	pb.cleanupExpiredFragments()
+	if buffered(3) {
+		t.Error("Expected RPC 3 to expire after the maximum timeout")
+	}
+}
+
+// TestPacketBuffer_SharedVerdictStore checks that a fragment reaching another replica follows
+// the verdict and route of the replica that ran the element chain
+func TestPacketBuffer_SharedVerdictStore(t *testing.T) {
+	store := NewMemoryVerdictStore()
+	replicas := make([]*PacketBuffer, 2)
+	for i := range replicas {
+		replicas[i] = NewPacketBuffer(5 * time.Second)
+		defer replicas[i].Close()
+		replicas[i].verdicts = store
+	}
+
+	route := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 9), Port: 9000}
+	replicas[0].StoreVerdict(777, util.PacketTypeRequest, util.PacketVerdictPass, route)
+
+	src := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 9090}
+	buffered, verdict, err := replicas[1].ProcessPacket(serializePacket(createDataPacket(777, 2, 3, []byte{1, 2, 3})), src)
+	if err != nil {
+		t.Fatalf("ProcessPacket failed: %v", err)
+	}
+	if buffered == nil || verdict != util.PacketVerdictPass {
+		t.Fatalf("Expected the fragment to be forwarded on the shared verdict, got %v with verdict %v", buffered, verdict)
+	}
+	if buffered.Peer.String() != route.String() || buffered.DstPort != 9000 {
+		t.Errorf("Expected the fragment to follow route %v, got %v", route, buffered.Peer)
+	}
+}
+
+// fakeRedis serves GET and SET (ignoring expiry) and AUTH with a fixed password over RESP
+type fakeRedis struct {
+	listener net.Listener
+	mu       sync.Mutex
+	values   map[string]string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	r := &fakeRedis{listener: listener, values: make(map[string]string)}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn, password)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn, password string) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := password == ""
+	for {
+		var n int
+		if _, err := fmt.Fscanf(reader, "*%d\r\n", &n); err != nil {
+			return
+		}
+		args := make([]string, n)
+		for i := range args {
+			var size int
+			if _, err := fmt.Fscanf(reader, "$%d\r\n", &size); err != nil {
+				return
+			}
+			buf := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, buf); err != nil {
+				return
+			}
+			args[i] = string(buf[:size])
+		}
+
+		r.mu.Lock()
+		switch {
+		case args[0] == "AUTH":
+			authenticated = args[1] == password
+			if authenticated {
+				io.WriteString(conn, "+OK\r\n")
+			} else {
+				io.WriteString(conn, "-WRONGPASS invalid password\r\n")
+			}
+		case !authenticated:
+			io.WriteString(conn, "-NOAUTH Authentication required\r\n")
+		case args[0] == "SET":
+			r.values[args[1]] = args[2]
+			io.WriteString(conn, "+OK\r\n")
+		case args[0] == "GET":
+			if v, ok := r.values[args[1]]; ok {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(v), v)
+			} else {
+				io.WriteString(conn, "$-1\r\n")
+			}
+		default:
+			io.WriteString(conn, "-ERR unknown command\r\n")
+		}
+		r.mu.Unlock()
+	}
+}
+
+func TestRedisVerdictStore(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	addr := server.listener.Addr().String()
+
+	if _, err := ParseVerdictStore("redis://:wrong@"+addr, time.Second); err == nil {
+		t.Fatal("Expected error for a wrong password")
+	}
+	// Each replica has its own cache, so the second one has to query the server
+	stores := make([]VerdictStore, 2)
+	for i := range stores {
+		store, err := ParseVerdictStore("redis://:secret@"+addr, time.Second)
+		if err != nil {
+			t.Fatalf("ParseVerdictStore failed: %v", err)
+		}
+		defer store.Close()
+		stores[i] = store
+	}
+
+	route := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 9), Port: 9000}
+	stores[0].Store(1, util.PacketTypeRequest, StoredVerdict{Verdict: util.PacketVerdictPass, Route: route})
+	stores[0].Store(1, util.PacketTypeResponse, StoredVerdict{Verdict: util.PacketVerdictDrop})
+
+	got, ok := stores[1].Load(1, util.PacketTypeRequest)
+	if !ok || got.Verdict != util.PacketVerdictPass || got.Route.String() != route.String() {
+		t.Errorf("Load(request) = %+v, %v, want pass via %v", got, ok, route)
+	}
+	got, ok = stores[1].Load(1, util.PacketTypeResponse)
+	if !ok || got.Verdict != util.PacketVerdictDrop || got.Route != nil {
+		t.Errorf("Load(response) = %+v, %v, want drop without route", got, ok)
+	}
+	if _, ok := stores[1].Load(2, util.PacketTypeRequest); ok {
+		t.Error("Expected no verdict for an unknown RPC")
+	}
+
+	// Cached verdicts are returned when the server is gone
+	server.listener.Close()
+	server.mu.Lock()
+	server.values = make(map[string]string)
+	server.mu.Unlock()
+	if got, ok := stores[1].Load(1, util.PacketTypeRequest); !ok || got.Verdict != util.PacketVerdictPass {
+		t.Errorf("Load(request) from cache = %+v, %v, want pass", got, ok)
+	}
+
+	for _, spec := range []string{"memcached://localhost:11211", "redis://", "redis://localhost:6379/db"} {
+		if _, err := ParseVerdictStore(spec, time.Second); err == nil {
+			t.Errorf("Expected error for verdict store %q", spec)
+		}
+	}
+}
+
 func TestErrorPacketCodec_SerializeDeserialize(t *testing.T) {
 	codec := &packet.ErrorPacketCodec{}
 
@@ -1390,8 +1927,8 @@ func TestErrorPacketCodec_SerializeDeserialize(t *testing.T) {
 		t.Fatalf("Failed to serialize error packet: %v", err)
 	}
 
-	// Verify serialized data has correct length (29 bytes header + message length)
-	expectedLen := 29 + len("Test error message")
+	// Verify serialized data has correct length (30 bytes header + message length)
+	expectedLen := 30 + len("Test error message")
 	if len(serialized) != expectedLen {
 		t.Errorf("Expected serialized length %d, got %d", expectedLen, len(serialized))
 	}
@@ -1559,3 +2096,71 @@ func TestPacketBuffer_ProcessErrorPacket(t *testing.T) {
 		t.Errorf("Expected TotalPackets 1, got %d", bufferedPacket.TotalPackets)
 	}
 }
+
+// BenchmarkPacketBuffer_ProcessPacket compares the system clock with the coarse clock as the
+// time source of PacketBuffer, on fragments of RPCs that already have a verdict
+func BenchmarkPacketBuffer_ProcessPacket(b *testing.B) {
+	clocks := []struct {
+		name string
+		now  func() time.Time
+	}{
+		{"TimeNow", time.Now},
+		{"CoarseClock", common.CoarseNow},
+	}
+
+	for _, clock := range clocks {
+		b.Run(clock.name, func(b *testing.B) {
+			pb := NewPacketBuffer(5 * time.Second)
+			defer pb.Close()
+			pb.now = clock.now
+
+			src := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 9090}
+			data := serializePacket(createDataPacket(999, 1, 3, make([]byte, 1024)))
+			pb.StoreVerdict(999, util.PacketTypeRequest, util.PacketVerdictPass)
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			b.RunParallel(func(pbt *testing.PB) {
+				for pbt.Next() {
+					if _, _, err := pb.ProcessPacket(data, src); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkPacketBuffer_ConcurrentReassembly buffers fragments of many RPCs from a single
+// connection in parallel, the case where all fragments would contend on one lock if the
+// reassembly state were sharded by connection. Run with -cpu 1,2,4,8 to see it scale.
+func BenchmarkPacketBuffer_ConcurrentReassembly(b *testing.B) {
+	pb := NewPacketBuffer(time.Minute)
+	defer pb.Close()
+
+	src := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 9090}
+	var nextRPCID atomic.Uint64
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pbt *testing.PB) {
+		// Each worker streams the fragments of its own RPCs, whose public segments were
+		// already extracted, so every fragment is buffered
+		const rpcsPerWorker = 64
+		fragments := make([][]byte, rpcsPerWorker)
+		for i := range fragments {
+			rpcID := nextRPCID.Add(1)
+			first := createDataPacket(rpcID, 0, 3, createPayloadWithOffset(16, 512))
+			if _, _, err := pb.ProcessPacket(serializePacket(first), src); err != nil {
+				b.Fatal(err)
+			}
+			fragments[i] = serializePacket(createDataPacket(rpcID, 1, 3, make([]byte, 1024)))
+		}
+
+		for i := 0; pbt.Next(); i++ {
+			if _, _, err := pb.ProcessPacket(fragments[i%rpcsPerWorker], src); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sharedelement "github.com/appnet-org/arpc/pkg/element"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// ConfigurableElement is implemented by elements whose parameters the control plane sets at
+// runtime (see CONTROL_PLANE). Configure receives the complete parameters of the element, so
+// missing keys take their default values, and must leave the element unchanged when it
+// returns an error. It is called while the element processes packets.
+type ConfigurableElement interface {
+	Configure(params map[string]string) error
+}
+
+// ControlConfig is a configuration pushed by the control plane. Each version replaces the
+// previous one as a whole.
+type ControlConfig struct {
+	Version string `json:"version"`
+	// Flags are feature flags passed to every configurable element
+	Flags map[string]string `json:"flags,omitempty"`
+	// Elements are the parameters of configurable elements by name (e.g. routing tables or
+	// rate limits), overriding flags of the same name
+	Elements map[string]map[string]string `json:"elements,omitempty"`
+	// ResponseRewrites replaces the rules of RESPONSE_REWRITES (same syntax)
+	ResponseRewrites string `json:"responseRewrites,omitempty"`
+	// Shadow replaces the elements of SHADOW_ELEMENTS
+	Shadow []string `json:"shadow,omitempty"`
+}
+
+// params returns the parameters of the named element
+func (c *ControlConfig) params(element string) map[string]string {
+	params := maps.Clone(c.Flags)
+	if params == nil {
+		params = make(map[string]string)
+	}
+	maps.Copy(params, c.Elements[element])
+	return params
+}
+
+// controlAck reports whether a proxy applied a version of the configuration
+type controlAck struct {
+	Node     string `json:"node"`
+	Version  string `json:"version"`
+	Accepted bool   `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// appliedControlConfig is the last configuration applied (the last known good one), which the
+// element loaders also apply to plugin elements they load later
+var appliedControlConfig atomic.Pointer[ControlConfig]
+
+// configureElement passes the parameters of config to element, if it is configurable. The
+// parameters declared by the descriptor of the element are checked first.
+func configureElement(element RPCElement, config *ControlConfig) error {
+	elem := unwrapElement(element)
+	if !isConfigurable(elem) {
+		return nil
+	}
+	params := config.params(element.Name())
+	if descriptor, ok := sharedelement.Describe(elem); ok {
+		if err := descriptor.CheckConfig(params); err != nil {
+			return err
+		}
+	}
+	switch e := elem.(type) {
+	case sharedelement.ConfigUpdateHook:
+		return e.OnConfigUpdate(params)
+	case ConfigurableElement:
+		return e.Configure(params)
+	}
+	return nil
+}
+
+// isConfigurable tells whether an unwrapped element takes parameters from the control plane
+func isConfigurable(elem any) bool {
+	switch elem.(type) {
+	case sharedelement.ConfigUpdateHook, ConfigurableElement:
+		return true
+	}
+	return false
+}
+
+// ControlPlaneClient subscribes to the configuration of a proxy on a control plane server,
+// applies every version it receives and acknowledges it. The protocol is HTTP with JSON
+// bodies, so the proxy needs no other client library:
+//
+//	GET  <url>/config?node=<node>&version=<version>  long poll for a configuration newer than
+//	                                                 version, the last one received; 200 with
+//	                                                 a ControlConfig, or 304 if none came
+//	POST <url>/ack                                   {"node", "version", "accepted", "error"}
+//
+// A configuration that cannot be applied is rejected (nack) and the last known good one
+// stays in effect. The last known good configuration is saved to the cache file, if any, so
+// that a proxy restarting while the control plane is unreachable starts with it.
+type ControlPlaneClient struct {
+	url      *url.URL
+	node     string
+	cache    string // path of the last known good configuration ("" disables it)
+	rewriter *ResponseRewriter
+	elements func() []RPCElement // elements to configure
+	client   *http.Client
+
+	mu        sync.Mutex
+	received  string // version of the last configuration received, applied or not
+	lastError error  // of the last poll or application, nil once one succeeds
+}
+
+// NewControlPlaneClient creates a client of the control plane at rawURL for the given node.
+// Response rewrites are applied to rewriter, and element parameters to the elements of the
+// element loaders.
+func NewControlPlaneClient(rawURL, node, cache string, rewriter *ResponseRewriter) (*ControlPlaneClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid control plane URL %q: expected http://host:port[/path]", rawURL)
+	}
+	return &ControlPlaneClient{
+		url:      u,
+		node:     node,
+		cache:    cache,
+		rewriter: rewriter,
+		elements: loadedElements,
+		client:   &http.Client{Timeout: 2 * time.Minute}, // longer than the server holds polls
+	}, nil
+}
+
+// Apply applies a configuration, or returns why it could not be applied. Elements that
+// accepted it before another rejected it are restored to the last known good configuration.
+func (c *ControlPlaneClient) Apply(config *ControlConfig) error {
+	rules, err := ParseResponseRewrites(config.ResponseRewrites)
+	if err != nil {
+		return fmt.Errorf("invalid responseRewrites: %w", err)
+	}
+
+	elements := c.elements()
+	for i, element := range elements {
+		if err := configureElement(element, config); err != nil {
+			previous := appliedControlConfig.Load()
+			if previous == nil {
+				previous = &ControlConfig{} // default parameters
+			}
+			for _, configured := range elements[:i] {
+				if err := configureElement(configured, previous); err != nil {
+					logging.Error("Failed to restore the element configuration",
+						zap.String("element", configured.Name()), zap.String("version", previous.Version), zap.Error(err))
+				}
+			}
+			return fmt.Errorf("element %s: %w", element.Name(), err)
+		}
+	}
+
+	c.rewriter.SetRules(rules)
+	shadowMode.SetElements(config.Shadow)
+	appliedControlConfig.Store(config)
+	if c.cache != "" {
+		if err := c.saveCache(config); err != nil {
+			logging.Warn("Failed to save the control plane configuration", zap.String("path", c.cache), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// LoadCache applies the last known good configuration saved to the cache file, if any
+func (c *ControlPlaneClient) LoadCache() error {
+	if c.cache == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.cache)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var config ControlConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("invalid cached configuration: %w", err)
+	}
+	if err := c.Apply(&config); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.received = config.Version
+	c.mu.Unlock()
+	logging.Info("Applied cached control plane configuration", zap.String("version", config.Version))
+	return nil
+}
+
+// saveCache writes config to the cache file, through a temporary file so that a crash
+// never leaves a partial configuration
+func (c *ControlPlaneClient) saveCache(config *ControlConfig) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	tmp := c.cache + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.cache)
+}
+
+// Run polls the control plane and applies the configurations it sends until ctx is done.
+// Failed polls are retried with exponential backoff, up to 30s apart.
+func (c *ControlPlaneClient) Run(ctx context.Context) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		config, err := c.poll(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.setError(err)
+			logging.Warn("Failed to poll the control plane", zap.String("url", c.url.String()), zap.Error(err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, 30*time.Second)
+			continue
+		}
+		backoff = time.Second
+		if config == nil {
+			// No new configuration. Servers hold polls, but do not spin on those that do not.
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		err = c.Apply(config)
+		c.mu.Lock()
+		c.received = config.Version
+		c.mu.Unlock()
+		c.setError(err)
+		if err != nil {
+			logging.Error("Rejected control plane configuration", zap.String("version", config.Version), zap.Error(err))
+		} else {
+			logging.Info("Applied control plane configuration", zap.String("version", config.Version))
+		}
+		if err := c.ack(ctx, config.Version, err); err != nil {
+			logging.Warn("Failed to acknowledge the control plane configuration", zap.String("version", config.Version), zap.Error(err))
+		}
+	}
+}
+
+// poll waits for a configuration newer than the last one received, returning nil if the
+// control plane has none
+func (c *ControlPlaneClient) poll(ctx context.Context) (*ControlConfig, error) {
+	c.mu.Lock()
+	received := c.received
+	c.mu.Unlock()
+
+	u := c.url.JoinPath("config")
+	u.RawQuery = url.Values{"node": {c.node}, "version": {received}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var config ControlConfig
+		if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+			return nil, fmt.Errorf("invalid configuration: %w", err)
+		}
+		if config.Version == "" || config.Version == received {
+			return nil, fmt.Errorf("configuration without new version (got %q)", config.Version)
+		}
+		return &config, nil
+	case http.StatusNotModified:
+		return nil, nil
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+}
+
+// ack reports to the control plane whether a version was applied
+func (c *ControlPlaneClient) ack(ctx context.Context, version string, applyErr error) error {
+	ack := controlAck{Node: c.node, Version: version, Accepted: applyErr == nil}
+	if applyErr != nil {
+		ack.Error = applyErr.Error()
+	}
+	body, err := json.Marshal(ack)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url.JoinPath("ack").String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (c *ControlPlaneClient) setError(err error) {
+	c.mu.Lock()
+	c.lastError = err
+	c.mu.Unlock()
+}
+
+// ServeHTTP writes the applied configuration, the version last received and the last error
+// as JSON
+func (c *ControlPlaneClient) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := struct {
+		Node     string         `json:"node"`
+		Applied  *ControlConfig `json:"applied"`
+		Received string         `json:"received"`
+		Error    string         `json:"error,omitempty"`
+	}{Node: c.node, Applied: appliedControlConfig.Load()}
+	c.mu.Lock()
+	status.Received = c.received
+	if c.lastError != nil {
+		status.Error = c.lastError.Error()
+	}
+	c.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		logging.Debug("Failed to write control plane status", zap.Error(err))
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"slices"
+
+	sharedelement "github.com/appnet-org/arpc/pkg/element"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// errNoDescriptor is the error of describeElement for elements without Describe
+var errNoDescriptor = errors.New("element does not implement Describe")
+
+// describeElement returns the descriptor of a plugin element, with the error making it
+// invalid, if any. Elements without one get a descriptor with their name only.
+func describeElement(element RPCElement) (sharedelement.Descriptor, error) {
+	descriptor, ok := sharedelement.Describe(unwrapElement(element))
+	if _, shared := element.(*sharedElement); shared && descriptor.Payload == "" {
+		// Elements of the shared interface never see more than the public segment
+		descriptor.Payload = sharedelement.PayloadPublic
+	}
+	if !ok {
+		descriptor.Name = element.Name()
+		return descriptor, errNoDescriptor
+	}
+	return descriptor, descriptor.Validate()
+}
+
+// elementStatus describes an element loaded by a plugin, as served by GET /elements
+type elementStatus struct {
+	Prefix     string                   `json:"prefix"`
+	Plugin     string                   `json:"plugin"`
+	Digest     string                   `json:"digest"`
+	Verified   bool                     `json:"verified"`
+	Descriptor sharedelement.Descriptor `json:"descriptor"`
+	// DescriptorError tells why the descriptor is missing or invalid
+	DescriptorError string `json:"descriptorError,omitempty"`
+	// Config holds the parameters applied from the control plane, for configurable elements
+	Config map[string]string `json:"config,omitempty"`
+	Shadow bool              `json:"shadow"`
+}
+
+// elementStatuses returns the status of the plugin element of every loader, by prefix
+func elementStatuses() []elementStatus {
+	config := appliedControlConfig.Load()
+	var statuses []elementStatus
+	for _, loader := range elementLoaders() {
+		loader.mu.Lock()
+		element, module, prefix := loader.element, loader.module, loader.prefix
+		loader.mu.Unlock()
+		if element == nil {
+			continue
+		}
+
+		status := elementStatus{Prefix: prefix, Shadow: shadowMode.Enabled(element.Name())}
+		if module != nil {
+			status.Plugin, status.Digest, status.Verified = filepath.Base(module.Path), module.Digest, module.Verified
+		}
+		descriptor, err := describeElement(element)
+		status.Descriptor = descriptor
+		if err != nil {
+			status.DescriptorError = err.Error()
+		}
+		if config != nil && isConfigurable(unwrapElement(element)) {
+			status.Config = config.params(element.Name())
+		}
+		statuses = append(statuses, status)
+	}
+	slices.SortFunc(statuses, func(a, b elementStatus) int { return cmp.Compare(a.Prefix, b.Prefix) })
+	return statuses
+}
+
+// elementsHandler serves the status of the plugin elements as JSON, so operators can audit
+// what the data plane of the node does
+func elementsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(struct {
+			Elements []elementStatus `json:"elements"`
+		}{elementStatuses()}); err != nil {
+			logging.Error("Failed to write element statuses", zap.Error(err))
+		}
+	})
+}
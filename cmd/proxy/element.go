@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/appnet-org/arpc/cmd/proxy/util"
 )
@@ -18,15 +21,86 @@ type RPCElement interface {
 	Name() string
 }
 
+// RequestElement is an element of the request pipeline only. Elements that do not need to
+// see responses can implement it instead of RPCElement, and the response pipeline skips them.
+type RequestElement interface {
+	ProcessRequest(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error)
+	Name() string
+}
+
+// ResponseElement is an element of the response pipeline only
+type ResponseElement interface {
+	ProcessResponse(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error)
+	Name() string
+}
+
+// ElementTiming records how long an element took to process a packet
+type ElementTiming struct {
+	Name     string
+	Phase    string // "request" or "response"
+	Duration time.Duration
+}
+
+// ElementTimings collects the element timings of a single packet
+type ElementTimings struct {
+	mu      sync.Mutex
+	timings []ElementTiming
+}
+
+// elementTimingsKey is the context key for ElementTimings
+type elementTimingsKey struct{}
+
+// WithElementTimings returns a context that makes the element chain record per-element timings
+func WithElementTimings(ctx context.Context) (context.Context, *ElementTimings) {
+	timings := &ElementTimings{}
+	return context.WithValue(ctx, elementTimingsKey{}, timings), timings
+}
+
+// Timings returns a copy of the recorded timings
+func (t *ElementTimings) Timings() []ElementTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]ElementTiming(nil), t.timings...)
+}
+
+// record appends a timing (no-op on a nil receiver)
+func (t *ElementTimings) record(name, phase string, start time.Time) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.timings = append(t.timings, ElementTiming{Name: name, Phase: phase, Duration: time.Since(start)})
+	t.mu.Unlock()
+}
+
 // RPCElementChain represents a chain of RPC elements.
+// Requests and responses go through separate pipelines.
 type RPCElementChain struct {
-	elements []RPCElement
+	request  []RequestElement
+	response []ResponseElement // in processing order
+	active   atomic.Int64      // messages in process, see acquireElementChain
 }
 
 // NewRPCElementChain creates a new chain of RPC elements.
+// Requests go through the elements in order, responses in reverse order.
 func NewRPCElementChain(elements ...RPCElement) *RPCElementChain {
+	c := &RPCElementChain{
+		request:  make([]RequestElement, len(elements)),
+		response: make([]ResponseElement, len(elements)),
+	}
+	for i, element := range elements {
+		c.request[i] = element
+		c.response[len(elements)-1-i] = element
+	}
+	return c
+}
+
+// NewPipelineChain creates a chain with distinct request and response pipelines.
+// Both run their elements in the given order.
+func NewPipelineChain(request []RequestElement, response []ResponseElement) *RPCElementChain {
 	return &RPCElementChain{
-		elements: elements,
+		request:  request,
+		response: response,
 	}
 }
 
@@ -34,8 +108,24 @@ func NewRPCElementChain(elements ...RPCElement) *RPCElementChain {
 func (c *RPCElementChain) ProcessRequest(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
 	var err error
 	var verdict util.PacketVerdict
-	for _, element := range c.elements {
+	timings, _ := ctx.Value(elementTimingsKey{}).(*ElementTimings)
+	timeline, _ := ctx.Value(timelineKey{}).(*timelineRecorder)
+	for _, element := range c.request {
+		var start time.Time
+		if timings != nil {
+			start = time.Now()
+		}
+		timeline.enter(element.Name())
+		// Shadow elements only record what they would have done to the packet
+		if packet != nil && shadowMode.Enabled(element.Name()) {
+			shadowMode.Run(ctx, element.Name(), packet, element.ProcessRequest)
+			timings.record(element.Name(), "request", start)
+			timeline.exit(element.Name(), util.PacketVerdictPass, nil)
+			continue
+		}
 		packet, verdict, ctx, err = element.ProcessRequest(ctx, packet)
+		timings.record(element.Name(), "request", start)
+		timeline.exit(element.Name(), verdict, err)
 		if verdict == util.PacketVerdictDrop {
 			return nil, util.PacketVerdictDrop, ctx, err
 		}
@@ -47,12 +137,29 @@ func (c *RPCElementChain) ProcessRequest(ctx context.Context, packet *util.Buffe
 	return packet, util.PacketVerdictPass, ctx, nil
 }
 
-// ProcessResponse processes the response through all RPC elements in reverse order.
+// ProcessResponse processes the response through the response pipeline
+// (all RPC elements in reverse order for chains created with NewRPCElementChain).
 func (c *RPCElementChain) ProcessResponse(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
 	var err error
 	var verdict util.PacketVerdict
-	for i := len(c.elements) - 1; i >= 0; i-- {
-		packet, verdict, ctx, err = c.elements[i].ProcessResponse(ctx, packet)
+	timings, _ := ctx.Value(elementTimingsKey{}).(*ElementTimings)
+	timeline, _ := ctx.Value(timelineKey{}).(*timelineRecorder)
+	for _, element := range c.response {
+		var start time.Time
+		if timings != nil {
+			start = time.Now()
+		}
+		timeline.enter(element.Name())
+		// Shadow elements only record what they would have done to the packet
+		if packet != nil && shadowMode.Enabled(element.Name()) {
+			shadowMode.Run(ctx, element.Name(), packet, element.ProcessResponse)
+			timings.record(element.Name(), "response", start)
+			timeline.exit(element.Name(), util.PacketVerdictPass, nil)
+			continue
+		}
+		packet, verdict, ctx, err = element.ProcessResponse(ctx, packet)
+		timings.record(element.Name(), "response", start)
+		timeline.exit(element.Name(), verdict, err)
 		if verdict == util.PacketVerdictDrop {
 			return nil, util.PacketVerdictDrop, ctx, err
 		}
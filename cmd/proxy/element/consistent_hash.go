@@ -0,0 +1,163 @@
+package element
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	sharedelement "github.com/appnet-org/arpc/pkg/element"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/transport/balancer/consistenthash"
+	"go.uber.org/zap"
+)
+
+// ErrNoBackends is returned when the hash ring has no backends
+var ErrNoBackends = errors.New("no backends available")
+
+// inflightTimeout is how long an RPC counts towards a backend's load if no response is seen
+const inflightTimeout = 30 * time.Second
+
+// inflightEntry records the backend an in-flight RPC was routed to
+type inflightEntry struct {
+	backend string
+	start   time.Time
+}
+
+// ConsistentHashElement routes requests to backends by hashing a public field onto a
+// bounded-load consistent hash ring, giving cache-affinity routing (e.g. by user_id).
+// A backend's load is the number of requests routed to it that have not seen a response yet.
+type ConsistentHashElement struct {
+	ring       *consistenthash.Ring
+	extractKey KeyExtractor
+
+	mu        sync.Mutex
+	inflight  map[uint64]inflightEntry // rpcID -> backend
+	lastPrune time.Time
+}
+
+// NewConsistentHashElement creates a consistent hash routing element over the given backends (host:port).
+// loadFactor < 1 uses consistenthash.DefaultLoadFactor.
+func NewConsistentHashElement(extractKey KeyExtractor, backends []string, loadFactor float64) (*ConsistentHashElement, error) {
+	for _, backend := range backends {
+		if _, err := resolveUDP4Addr(backend); err != nil {
+			return nil, err
+		}
+	}
+
+	ring := consistenthash.NewRing(consistenthash.DefaultReplicas, loadFactor)
+	ring.Add(backends...)
+
+	return &ConsistentHashElement{
+		ring:       ring,
+		extractKey: extractKey,
+		inflight:   make(map[uint64]inflightEntry),
+	}, nil
+}
+
+// SetBackends replaces the set of backends
+func (c *ConsistentHashElement) SetBackends(backends []string) error {
+	for _, backend := range backends {
+		if _, err := resolveUDP4Addr(backend); err != nil {
+			return err
+		}
+	}
+	c.ring.Set(backends)
+	return nil
+}
+
+// ProcessRequest rewrites the destination of the request to the backend owning its key.
+// Requests whose key cannot be extracted are passed through unchanged.
+func (c *ConsistentHashElement) ProcessRequest(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	if packet == nil {
+		return packet, util.PacketVerdictPass, ctx, nil
+	}
+
+	key, err := c.extractKey(packet.Payload)
+	if err != nil {
+		logging.Debug("Failed to extract hash key, forwarding unchanged", zap.Uint64("rpcID", packet.RPCID), zap.Error(err))
+		return packet, util.PacketVerdictPass, ctx, nil
+	}
+
+	backend := c.ring.Acquire(key)
+	if backend == "" {
+		return nil, util.PacketVerdictDrop, ctx, ErrNoBackends
+	}
+
+	addr, err := resolveUDP4Addr(backend)
+	if err != nil {
+		c.ring.Release(backend)
+		return nil, util.PacketVerdictDrop, ctx, fmt.Errorf("failed to route request: %w", err)
+	}
+
+	c.trackInflight(packet.RPCID, backend)
+
+	// Rewrite both the forwarding address and the header routing information
+	packet.Peer = addr
+	copy(packet.DstIP[:], addr.IP.To4())
+	packet.DstPort = uint16(addr.Port)
+
+	logging.Debug("Routed request by consistent hash",
+		zap.Uint64("rpcID", packet.RPCID),
+		zap.String("key", key),
+		zap.String("backend", backend))
+
+	return packet, util.PacketVerdictPass, ctx, nil
+}
+
+// ProcessResponse releases the load taken by the matching request
+func (c *ConsistentHashElement) ProcessResponse(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	if packet == nil {
+		return packet, util.PacketVerdictPass, ctx, nil
+	}
+
+	c.mu.Lock()
+	entry, ok := c.inflight[packet.RPCID]
+	delete(c.inflight, packet.RPCID)
+	c.mu.Unlock()
+
+	if ok {
+		c.ring.Release(entry.backend)
+	}
+	return packet, util.PacketVerdictPass, ctx, nil
+}
+
+// Name returns the name of this element
+func (c *ConsistentHashElement) Name() string {
+	return "ConsistentHashElement"
+}
+
+// Describe returns the descriptor of this element
+func (c *ConsistentHashElement) Describe() sharedelement.Descriptor {
+	return sharedelement.Descriptor{
+		Name:        c.Name(),
+		Version:     "v1",
+		Description: "Routes requests to backends by a bounded-load consistent hash of a public field",
+		Payload:     sharedelement.PayloadPublic,
+		Modifies:    true,
+	}
+}
+
+// trackInflight records the backend of an RPC and prunes RPCs that never saw a response
+func (c *ConsistentHashElement) trackInflight(rpcID uint64, backend string) {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inflight[rpcID] = inflightEntry{backend: backend, start: now}
+
+	// Prune at most once per second to keep the request path cheap
+	if now.Sub(c.lastPrune) < time.Second {
+		return
+	}
+	c.lastPrune = now
+	for id, entry := range c.inflight {
+		if now.Sub(entry.start) > inflightTimeout {
+			delete(c.inflight, id)
+			c.ring.Release(entry.backend)
+		}
+	}
+}
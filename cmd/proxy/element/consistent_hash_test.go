@@ -0,0 +1,75 @@
+package element
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/transport/balancer/consistenthash"
+)
+
+func TestConsistentHashElement_RoutesByKey(t *testing.T) {
+	backends := []string{"10.0.0.1:9000", "10.0.0.2:9000", "10.0.0.3:9000"}
+	c, err := NewConsistentHashElement(consistenthash.PublicStringField(13), backends, 0)
+	if err != nil {
+		t.Fatalf("NewConsistentHashElement failed: %v", err)
+	}
+
+	for i := range 20 {
+		key := fmt.Sprintf("user-%d", i)
+		p, verdict, _, err := c.ProcessRequest(context.Background(), requestPacket(uint64(i), stringFieldPayload(key)))
+		if err != nil || verdict != util.PacketVerdictPass {
+			t.Fatalf("ProcessRequest returned %v, %v, want a pass", verdict, err)
+		}
+		if want := c.ring.Get(key); p.Peer.String() != want || p.DstPort != 9000 {
+			t.Errorf("Key %s routed to %v, want its owner %s", key, p.Peer, want)
+		}
+		if c.ring.Load(p.Peer.String()) != 1 {
+			t.Errorf("Backend %v has load %d while the request is in flight, want 1", p.Peer, c.ring.Load(p.Peer.String()))
+		}
+
+		// The response releases the load of the request
+		resp := requestPacket(uint64(i), nil)
+		resp.PacketType = util.PacketTypeResponse
+		if _, _, _, err := c.ProcessResponse(context.Background(), resp); err != nil {
+			t.Fatalf("ProcessResponse failed: %v", err)
+		}
+		if c.ring.Load(p.Peer.String()) != 0 {
+			t.Errorf("Backend %v has load %d after the response, want 0", p.Peer, c.ring.Load(p.Peer.String()))
+		}
+	}
+
+	// Requests without a key are forwarded unchanged
+	p, verdict, _, err := c.ProcessRequest(context.Background(), requestPacket(100, []byte{0x01}))
+	if err != nil || verdict != util.PacketVerdictPass || p.Peer != nil {
+		t.Errorf("ProcessRequest returned %v, %v, peer %v, want an unchanged pass", verdict, err, p.Peer)
+	}
+}
+
+func TestConsistentHashElement_Backends(t *testing.T) {
+	if _, err := NewConsistentHashElement(consistenthash.PublicStringField(13), []string{"not an address"}, 0); err == nil {
+		t.Error("Expected an error for an invalid backend")
+	}
+
+	c, err := NewConsistentHashElement(consistenthash.PublicStringField(13), nil, 0)
+	if err != nil {
+		t.Fatalf("NewConsistentHashElement failed: %v", err)
+	}
+	_, verdict, _, err := c.ProcessRequest(context.Background(), requestPacket(1, stringFieldPayload("user-1")))
+	if !errors.Is(err, ErrNoBackends) || verdict != util.PacketVerdictDrop {
+		t.Errorf("ProcessRequest returned %v, %v without backends, want a drop with ErrNoBackends", verdict, err)
+	}
+
+	if err := c.SetBackends([]string{"10.0.0.9:9000"}); err != nil {
+		t.Fatalf("SetBackends failed: %v", err)
+	}
+	p, _, _, err := c.ProcessRequest(context.Background(), requestPacket(2, stringFieldPayload("user-1")))
+	if err != nil || p.Peer.String() != "10.0.0.9:9000" {
+		t.Errorf("ProcessRequest routed to %v, %v, want the only backend 10.0.0.9:9000", p.Peer, err)
+	}
+	if err := c.SetBackends([]string{"10.0.0.9"}); err == nil {
+		t.Error("Expected an error for a backend without a port")
+	}
+}
@@ -2,13 +2,11 @@ package element
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
-	"math/rand"
-	"sync"
-
-	kv "github.com/appnet-org/arpc-sigcomm/kv-store-symphony/symphony"
 
 	"github.com/appnet-org/arpc/cmd/proxy/util"
+	sharedelement "github.com/appnet-org/arpc/pkg/element"
 	"github.com/appnet-org/arpc/pkg/logging"
 	"go.uber.org/zap"
 )
@@ -18,14 +16,16 @@ var ErrPacketBlocked = errors.New("message blocked by firewall")
 
 // FirewallElement implements RPCElement to provide firewall functionality
 type FirewallElement struct {
+	scoreOffset    int   // Table offset of the public int32 score field of requests
 	blockThreshold int32 // Score threshold for blocking messages
-	mu             sync.Mutex
-	rng            *rand.Rand
 }
 
-// NewFaultInjectionElement creates a new fault injection element with the specified drop probability
-func NewFirewallElement(blockThreshold int32) *FirewallElement {
+// NewFirewallElement creates a firewall element blocking the requests whose public int32
+// score field, whose table entry is at scoreOffset (13 for the first public field), reaches
+// blockThreshold
+func NewFirewallElement(scoreOffset int, blockThreshold int32) *FirewallElement {
 	return &FirewallElement{
+		scoreOffset:    scoreOffset,
 		blockThreshold: blockThreshold,
 	}
 }
@@ -41,10 +41,14 @@ func (f *FirewallElement) ProcessRequest(ctx context.Context, packet *util.Buffe
 		return packet, util.PacketVerdictPass, ctx, nil
 	}
 
-	getRequest := kv.GetRequestRaw(packet.Payload)
-	logging.Debug("Request score", zap.Int32("score", getRequest.GetScore()))
+	if len(packet.Payload) < f.scoreOffset+4 {
+		logging.Debug("Request too short for score field, forwarding unchanged", zap.Uint64("rpcID", packet.RPCID))
+		return packet, util.PacketVerdictPass, ctx, nil
+	}
+	score := int32(binary.LittleEndian.Uint32(packet.Payload[f.scoreOffset:]))
+	logging.Debug("Request score", zap.Int32("score", score))
 
-	if f.shouldBlock(getRequest.GetScore()) {
+	if f.shouldBlock(score) {
 		logging.Debug("Request blocked by firewall", zap.String("packetType", packet.PacketType.String()))
 		return nil, util.PacketVerdictDrop, ctx, ErrPacketBlocked
 	}
@@ -61,3 +65,13 @@ func (f *FirewallElement) ProcessResponse(ctx context.Context, packet *util.Buff
 func (f *FirewallElement) Name() string {
 	return "FirewallElement"
 }
+
+// Describe returns the descriptor of this element
+func (f *FirewallElement) Describe() sharedelement.Descriptor {
+	return sharedelement.Descriptor{
+		Name:        f.Name(),
+		Version:     "v1",
+		Description: "Drops the requests whose score reaches the block threshold",
+		Payload:     sharedelement.PayloadPublic,
+	}
+}
@@ -0,0 +1,41 @@
+package element
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+)
+
+func TestFirewallElement(t *testing.T) {
+	f := NewFirewallElement(13, 50)
+	for _, tc := range []struct {
+		score   int32
+		blocked bool
+	}{
+		{-1, false},
+		{49, false},
+		{50, true},
+		{1000, true},
+	} {
+		payload := make([]byte, 17)
+		payload[0] = 0x01
+		binary.LittleEndian.PutUint32(payload[13:], uint32(tc.score))
+		_, verdict, _, err := f.ProcessRequest(context.Background(), requestPacket(1, payload))
+		if blocked := verdict == util.PacketVerdictDrop; blocked != tc.blocked || blocked != errors.Is(err, ErrPacketBlocked) {
+			t.Errorf("Score %d: got verdict %v, error %v, want blocked %v", tc.score, verdict, err, tc.blocked)
+		}
+	}
+
+	// Requests too short for the score field pass
+	if _, verdict, _, err := f.ProcessRequest(context.Background(), requestPacket(2, make([]byte, 15))); verdict != util.PacketVerdictPass || err != nil {
+		t.Errorf("Short request got verdict %v, error %v, want a pass", verdict, err)
+	}
+}
+
+// requestPacket returns a request packet carrying payload
+func requestPacket(rpcID uint64, payload []byte) *util.BufferedPacket {
+	return &util.BufferedPacket{Payload: payload, RPCID: rpcID, PacketType: util.PacketTypeRequest, IsFull: true, SeqNumber: -1}
+}
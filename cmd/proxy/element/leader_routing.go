@@ -0,0 +1,324 @@
+package element
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	sharedelement "github.com/appnet-org/arpc/pkg/element"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/transport/balancer/consistenthash"
+	"go.uber.org/zap"
+)
+
+// ErrNoLeader is returned when no leader is known for the shard of a request
+var ErrNoLeader = errors.New("no leader known for shard")
+
+// KeyExtractor extracts the routing key from the public segment of a request, e.g.
+// consistenthash.PublicStringField(13) for a string as first public field
+type KeyExtractor = consistenthash.KeyFunc
+
+// LeaderRoutingElement rewrites the destination of requests so that all requests
+// for a given shard reach the current leader of that shard.
+// The shard->leader map can be updated through SetLeader/UpdateLeaders, over HTTP
+// (the element implements http.Handler) or by watching a config endpoint.
+type LeaderRoutingElement struct {
+	extractKey KeyExtractor
+	numShards  uint32 // if 0, the key itself is used as the shard name
+
+	mu      sync.RWMutex
+	leaders map[string]*net.UDPAddr
+
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewLeaderRoutingElement creates a leader routing element.
+// If numShards > 0, keys are hashed into shards "0".."numShards-1"; otherwise the key is the shard.
+func NewLeaderRoutingElement(extractKey KeyExtractor, numShards uint32) *LeaderRoutingElement {
+	return &LeaderRoutingElement{
+		extractKey: extractKey,
+		numShards:  numShards,
+		leaders:    make(map[string]*net.UDPAddr),
+		done:       make(chan struct{}),
+	}
+}
+
+// ShardForKey returns the shard name a key belongs to
+func (l *LeaderRoutingElement) ShardForKey(key string) string {
+	if l.numShards == 0 {
+		return key
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return strconv.FormatUint(uint64(h.Sum32()%l.numShards), 10)
+}
+
+// SetLeader sets the leader address (host:port) for a shard
+func (l *LeaderRoutingElement) SetLeader(shard, addr string) error {
+	udpAddr, err := resolveUDP4Addr(addr)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.leaders[shard] = udpAddr
+	l.mu.Unlock()
+
+	logging.Info("Updated shard leader", zap.String("shard", shard), zap.String("leader", udpAddr.String()))
+	return nil
+}
+
+// RemoveLeader removes the leader entry for a shard
+func (l *LeaderRoutingElement) RemoveLeader(shard string) {
+	l.mu.Lock()
+	delete(l.leaders, shard)
+	l.mu.Unlock()
+}
+
+// UpdateLeaders atomically replaces the whole shard->leader map.
+// The map is left unchanged if any of the addresses is invalid.
+func (l *LeaderRoutingElement) UpdateLeaders(leaders map[string]string) error {
+	resolved, err := resolveLeaders(leaders)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.leaders = resolved
+	l.mu.Unlock()
+
+	logging.Debug("Replaced shard leader map", zap.Int("shards", len(resolved)))
+	return nil
+}
+
+// MergeLeaders atomically sets the leaders of the given shards, keeping the other entries.
+// The map is left unchanged if any of the addresses is invalid.
+func (l *LeaderRoutingElement) MergeLeaders(leaders map[string]string) error {
+	resolved, err := resolveLeaders(leaders)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	for shard, udpAddr := range resolved {
+		l.leaders[shard] = udpAddr
+	}
+	l.mu.Unlock()
+
+	logging.Debug("Merged shard leaders", zap.Int("shards", len(resolved)))
+	return nil
+}
+
+// resolveLeaders resolves the addresses of a shard->leader map
+func resolveLeaders(leaders map[string]string) (map[string]*net.UDPAddr, error) {
+	resolved := make(map[string]*net.UDPAddr, len(leaders))
+	for shard, addr := range leaders {
+		udpAddr, err := resolveUDP4Addr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid leader for shard %s: %w", shard, err)
+		}
+		resolved[shard] = udpAddr
+	}
+	return resolved, nil
+}
+
+// Leaders returns a snapshot of the shard->leader map
+func (l *LeaderRoutingElement) Leaders() map[string]string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	leaders := make(map[string]string, len(l.leaders))
+	for shard, addr := range l.leaders {
+		leaders[shard] = addr.String()
+	}
+	return leaders
+}
+
+// getLeader returns the leader for a shard, or nil if unknown
+func (l *LeaderRoutingElement) getLeader(shard string) *net.UDPAddr {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.leaders[shard]
+}
+
+// resolveUDP4Addr resolves a host:port address (only IPv4 is supported by the packet header)
+func resolveUDP4Addr(addr string) (*net.UDPAddr, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve address %s: %w", addr, err)
+	}
+	if udpAddr.IP.To4() == nil {
+		return nil, fmt.Errorf("address %s is not IPv4", addr)
+	}
+	return udpAddr, nil
+}
+
+// ProcessRequest rewrites the destination of the request to the leader of its shard.
+// Requests whose key cannot be extracted are passed through unchanged; requests for a
+// shard without a known leader are dropped with ErrNoLeader.
+func (l *LeaderRoutingElement) ProcessRequest(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	if packet == nil {
+		return packet, util.PacketVerdictPass, ctx, nil
+	}
+
+	key, err := l.extractKey(packet.Payload)
+	if err != nil {
+		logging.Debug("Failed to extract routing key, forwarding unchanged", zap.Uint64("rpcID", packet.RPCID), zap.Error(err))
+		return packet, util.PacketVerdictPass, ctx, nil
+	}
+
+	shard := l.ShardForKey(key)
+	leader := l.getLeader(shard)
+	if leader == nil {
+		logging.Debug("No leader for shard", zap.Uint64("rpcID", packet.RPCID), zap.String("shard", shard))
+		return nil, util.PacketVerdictDrop, ctx, fmt.Errorf("%w: %s", ErrNoLeader, shard)
+	}
+
+	// Rewrite both the forwarding address and the header routing information
+	packet.Peer = leader
+	copy(packet.DstIP[:], leader.IP.To4())
+	packet.DstPort = uint16(leader.Port)
+
+	logging.Debug("Routed request to shard leader",
+		zap.Uint64("rpcID", packet.RPCID),
+		zap.String("shard", shard),
+		zap.String("leader", leader.String()))
+
+	return packet, util.PacketVerdictPass, ctx, nil
+}
+
+// ProcessResponse returns the response unchanged
+func (l *LeaderRoutingElement) ProcessResponse(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	return packet, util.PacketVerdictPass, ctx, nil
+}
+
+// Name returns the name of this element
+func (l *LeaderRoutingElement) Name() string {
+	return "LeaderRoutingElement"
+}
+
+// Describe returns the descriptor of this element
+func (l *LeaderRoutingElement) Describe() sharedelement.Descriptor {
+	return sharedelement.Descriptor{
+		Name:        l.Name(),
+		Version:     "v1",
+		Description: "Routes requests to the leader of the shard of a public field",
+		Payload:     sharedelement.PayloadPublic,
+		Modifies:    true,
+	}
+}
+
+// ServeHTTP exposes the shard->leader map for an admin server.
+// GET returns the map as JSON, PUT replaces it, POST merges the given entries
+// and DELETE removes the shard given by the "shard" query parameter.
+func (l *LeaderRoutingElement) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(l.Leaders())
+	case http.MethodPut, http.MethodPost:
+		var leaders map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&leaders); err != nil {
+			http.Error(w, fmt.Sprintf("invalid leader map: %v", err), http.StatusBadRequest)
+			return
+		}
+		update := l.UpdateLeaders
+		if r.Method == http.MethodPost {
+			update = l.MergeLeaders
+		}
+		if err := update(leaders); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		shard := r.URL.Query().Get("shard")
+		if shard == "" {
+			http.Error(w, "missing shard parameter", http.StatusBadRequest)
+			return
+		}
+		l.RemoveLeader(shard)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// WatchConfig polls source every interval and replaces the shard->leader map with its content.
+// source is either an http(s) URL or a local file path; both must contain a JSON object
+// mapping shard names to leader addresses, e.g. {"0": "10.0.0.1:9000"}.
+// The watch runs until Close is called.
+func (l *LeaderRoutingElement) WatchConfig(source string, interval time.Duration) {
+	// Load once synchronously so the map is populated before the first request
+	if err := l.loadConfig(source); err != nil {
+		logging.Warn("Failed to load leader config", zap.String("source", source), zap.Error(err))
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-l.done:
+				return
+			case <-ticker.C:
+				if err := l.loadConfig(source); err != nil {
+					logging.Warn("Failed to reload leader config", zap.String("source", source), zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// loadConfig reads the leader map from source and applies it
+func (l *LeaderRoutingElement) loadConfig(source string) error {
+	var data []byte
+	var err error
+
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		client := &http.Client{Timeout: 5 * time.Second}
+		resp, err := client.Get(source)
+		if err != nil {
+			return fmt.Errorf("failed to fetch leader config: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status fetching leader config: %s", resp.Status)
+		}
+		data, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read leader config: %w", err)
+		}
+	} else {
+		data, err = os.ReadFile(source)
+		if err != nil {
+			return fmt.Errorf("failed to read leader config: %w", err)
+		}
+	}
+
+	var leaders map[string]string
+	if err := json.Unmarshal(data, &leaders); err != nil {
+		return fmt.Errorf("failed to parse leader config: %w", err)
+	}
+	return l.UpdateLeaders(leaders)
+}
+
+// Close stops the config watch, if any
+func (l *LeaderRoutingElement) Close() {
+	l.stopOnce.Do(func() {
+		close(l.done)
+	})
+}
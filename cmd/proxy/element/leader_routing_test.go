@@ -0,0 +1,165 @@
+package element
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/transport/balancer/consistenthash"
+)
+
+// stringFieldPayload returns a public segment whose first public field is the string key:
+// header (13 bytes), one offset slot, then [len][bytes]
+func stringFieldPayload(key string) []byte {
+	payload := make([]byte, 17+4+len(key))
+	payload[0] = 0x01
+	binary.LittleEndian.PutUint32(payload[1:5], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(payload[13:17], 17)
+	binary.LittleEndian.PutUint32(payload[17:21], uint32(len(key)))
+	copy(payload[21:], key)
+	return payload
+}
+
+func TestLeaderRoutingElement_RoutesToShardLeader(t *testing.T) {
+	l := NewLeaderRoutingElement(consistenthash.PublicStringField(13), 0)
+	if err := l.SetLeader("orders", "10.0.0.1:9000"); err != nil {
+		t.Fatalf("SetLeader failed: %v", err)
+	}
+
+	p, verdict, _, err := l.ProcessRequest(context.Background(), requestPacket(1, stringFieldPayload("orders")))
+	if err != nil || verdict != util.PacketVerdictPass {
+		t.Fatalf("ProcessRequest returned %v, %v, want a pass", verdict, err)
+	}
+	if p.Peer.String() != "10.0.0.1:9000" || p.DstIP != [4]byte{10, 0, 0, 1} || p.DstPort != 9000 {
+		t.Errorf("Routed to %v (header %v:%d), want 10.0.0.1:9000", p.Peer, p.DstIP, p.DstPort)
+	}
+
+	// A shard without a leader is dropped
+	_, verdict, _, err = l.ProcessRequest(context.Background(), requestPacket(2, stringFieldPayload("users")))
+	if !errors.Is(err, ErrNoLeader) || verdict != util.PacketVerdictDrop {
+		t.Errorf("ProcessRequest returned %v, %v, want a drop with ErrNoLeader", verdict, err)
+	}
+
+	// Requests without a key are forwarded unchanged
+	p, verdict, _, err = l.ProcessRequest(context.Background(), requestPacket(3, []byte{0x01}))
+	if err != nil || verdict != util.PacketVerdictPass || p.Peer != nil {
+		t.Errorf("ProcessRequest returned %v, %v, peer %v, want an unchanged pass", verdict, err, p.Peer)
+	}
+
+	// Once removed, the leader is unknown again
+	l.RemoveLeader("orders")
+	if _, _, _, err := l.ProcessRequest(context.Background(), requestPacket(4, stringFieldPayload("orders"))); !errors.Is(err, ErrNoLeader) {
+		t.Errorf("ProcessRequest returned %v after RemoveLeader, want ErrNoLeader", err)
+	}
+}
+
+func TestLeaderRoutingElement_HashedShards(t *testing.T) {
+	l := NewLeaderRoutingElement(consistenthash.PublicStringField(13), 4)
+	leaders := make(map[string]string)
+	for shard := range 4 {
+		leaders[fmt.Sprint(shard)] = fmt.Sprintf("10.0.0.%d:9000", shard+1)
+	}
+	if err := l.UpdateLeaders(leaders); err != nil {
+		t.Fatalf("UpdateLeaders failed: %v", err)
+	}
+
+	for i := range 20 {
+		key := fmt.Sprintf("user-%d", i)
+		shard := l.ShardForKey(key)
+		if shard != l.ShardForKey(key) || leaders[shard] == "" {
+			t.Fatalf("Key %s maps to shard %q, want a stable shard in 0..3", key, shard)
+		}
+		p, _, _, err := l.ProcessRequest(context.Background(), requestPacket(uint64(i), stringFieldPayload(key)))
+		if err != nil {
+			t.Fatalf("ProcessRequest failed: %v", err)
+		}
+		if p.Peer.String() != leaders[shard] {
+			t.Errorf("Key %s routed to %v, want the leader of shard %s, %s", key, p.Peer, shard, leaders[shard])
+		}
+	}
+
+	// An invalid address leaves the map unchanged
+	if err := l.UpdateLeaders(map[string]string{"0": "not an address"}); err == nil {
+		t.Error("Expected an error for an invalid leader address")
+	}
+	if got := l.Leaders(); len(got) != 4 {
+		t.Errorf("Leaders returned %v after a failed update, want the 4 previous leaders", got)
+	}
+}
+
+// serve sends a request to the HTTP handler of l and returns the response
+func serve(l *LeaderRoutingElement, method, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	l.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func TestLeaderRoutingElement_ServeHTTP(t *testing.T) {
+	l := NewLeaderRoutingElement(consistenthash.PublicStringField(13), 0)
+
+	if w := serve(l, http.MethodPut, "/leaders", `{"a": "10.0.0.1:9000", "b": "10.0.0.2:9000"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("PUT returned %d: %s", w.Code, w.Body)
+	}
+	if w := serve(l, http.MethodPost, "/leaders", `{"b": "10.0.0.3:9000", "c": "10.0.0.4:9000"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("POST returned %d: %s", w.Code, w.Body)
+	}
+	w := serve(l, http.MethodGet, "/leaders", "")
+	want := `{"a":"10.0.0.1:9000","b":"10.0.0.3:9000","c":"10.0.0.4:9000"}`
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != want {
+		t.Errorf("GET returned %d %s, want %s", w.Code, w.Body, want)
+	}
+
+	// PUT replaces the map
+	serve(l, http.MethodPut, "/leaders", `{"d": "10.0.0.5:9000"}`)
+	if got := l.Leaders(); len(got) != 1 || got["d"] != "10.0.0.5:9000" {
+		t.Errorf("Leaders returned %v after PUT, want only shard d", got)
+	}
+	if w := serve(l, http.MethodDelete, "/leaders?shard=d", ""); w.Code != http.StatusNoContent || len(l.Leaders()) != 0 {
+		t.Errorf("DELETE returned %d and left %v", w.Code, l.Leaders())
+	}
+
+	for _, tc := range []struct {
+		method, target, body string
+		code                 int
+	}{
+		{http.MethodPost, "/leaders", `{"a": `, http.StatusBadRequest},
+		{http.MethodPost, "/leaders", `{"a": "not an address"}`, http.StatusBadRequest},
+		{http.MethodDelete, "/leaders", "", http.StatusBadRequest},
+		{http.MethodPatch, "/leaders", "", http.StatusMethodNotAllowed},
+	} {
+		if w := serve(l, tc.method, tc.target, tc.body); w.Code != tc.code {
+			t.Errorf("%s %s %q returned %d, want %d", tc.method, tc.target, tc.body, w.Code, tc.code)
+		}
+	}
+	if got := l.Leaders(); len(got) != 0 {
+		t.Errorf("Leaders returned %v after invalid requests, want none", got)
+	}
+}
+
+// Concurrent merges and SetLeader calls are all kept
+func TestLeaderRoutingElement_ConcurrentMerges(t *testing.T) {
+	l := NewLeaderRoutingElement(consistenthash.PublicStringField(13), 0)
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			serve(l, http.MethodPost, "/leaders", fmt.Sprintf(`{"post-%d": "10.0.0.1:9000"}`, i))
+		}()
+		go func() {
+			defer wg.Done()
+			l.SetLeader(fmt.Sprintf("set-%d", i), "10.0.0.2:9000")
+		}()
+	}
+	wg.Wait()
+	if got := l.Leaders(); len(got) != 100 {
+		t.Errorf("Leaders has %d entries after 100 concurrent updates, want 100", len(got))
+	}
+}
@@ -0,0 +1,253 @@
+package element
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	sharedelement "github.com/appnet-org/arpc/pkg/element"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/schema"
+	"go.uber.org/zap"
+)
+
+// sampleQueueSize is the number of samples waiting to be written before new ones are dropped
+const sampleQueueSize = 256
+
+// SampleSink stores serialized samples under a key such as "kv/Get/2024-05-01/<nanos>-<rpcID>.json"
+type SampleSink interface {
+	Put(ctx context.Context, key string, data []byte) error
+}
+
+// DirSink writes each sample to a file under Dir, using the key as relative path
+type DirSink struct {
+	Dir string
+}
+
+// Put writes data to Dir/key, creating directories as needed
+func (s *DirSink) Put(ctx context.Context, key string, data []byte) error {
+	path := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create sample directory: %w", err)
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// ObjectPutter is the subset of an S3-compatible client used by ObjectStoreSink.
+// Clients of AWS S3, MinIO or GCS can be adapted with a few lines.
+type ObjectPutter interface {
+	PutObject(ctx context.Context, bucket, key string, body io.Reader, size int64, contentType string) error
+}
+
+// ObjectStoreSink uploads each sample as an object of Bucket, with Prefix prepended to its key
+type ObjectStoreSink struct {
+	Client ObjectPutter
+	Bucket string
+	Prefix string
+}
+
+// Put uploads data as a JSON object
+func (s *ObjectStoreSink) Put(ctx context.Context, key string, data []byte) error {
+	return s.Client.PutObject(ctx, s.Bucket, s.Prefix+key, bytes.NewReader(data), int64(len(data)), "application/json")
+}
+
+// Sample is the JSON document written for a sampled request
+type Sample struct {
+	Time         time.Time `json:"time"`
+	RPCID        uint64    `json:"rpcID"`
+	ServiceID    uint32    `json:"serviceID"`
+	MethodID     uint32    `json:"methodID"`
+	Service      string    `json:"service,omitempty"`
+	Method       string    `json:"method,omitempty"`
+	Source       string    `json:"source,omitempty"`
+	Destination  string    `json:"destination,omitempty"`
+	PublicBytes  int       `json:"publicBytes"`
+	TotalPackets uint16    `json:"totalPackets"`
+	// Public holds the decoded public segment. Private fields are never part of a sample.
+	Public *schema.DynamicMessage `json:"public,omitempty"`
+	// DecodeError is set if the public segment could not be decoded, e.g. because the
+	// schema of the method is not registered
+	DecodeError string `json:"decodeError,omitempty"`
+}
+
+// sampleWindow counts the samples of one method in the current minute
+type sampleWindow struct {
+	start time.Time
+	count int
+}
+
+// SamplingElement samples up to a fixed number of requests per minute and method, decodes
+// their public segment with the schema registry, and writes them as JSON to a sink for
+// offline analysis. Decoding and writing happen in the background; samples are dropped
+// if the sink cannot keep up. Requests are never modified.
+type SamplingElement struct {
+	sink      SampleSink
+	registry  *schema.Registry
+	perMinute int
+
+	mu      sync.Mutex
+	windows map[[2]uint32]*sampleWindow // (serviceID, methodID) -> window
+
+	queue    chan *pendingSample
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// pendingSample is a sampled request waiting to be decoded and written
+type pendingSample struct {
+	sample  Sample
+	payload []byte
+}
+
+// NewSamplingElement creates a sampling element writing up to perMinute requests per minute
+// and method to sink. If registry is nil, schema.Global is used.
+func NewSamplingElement(sink SampleSink, perMinute int, registry *schema.Registry) *SamplingElement {
+	if registry == nil {
+		registry = schema.Global
+	}
+	e := &SamplingElement{
+		sink:      sink,
+		registry:  registry,
+		perMinute: perMinute,
+		windows:   make(map[[2]uint32]*sampleWindow),
+		queue:     make(chan *pendingSample, sampleQueueSize),
+		done:      make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// ProcessRequest samples the request if its method has not reached its quota for this minute
+func (e *SamplingElement) ProcessRequest(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	if packet == nil || len(packet.Payload) < 13 {
+		return packet, util.PacketVerdictPass, ctx, nil
+	}
+	now := time.Now()
+	serviceID := binary.LittleEndian.Uint32(packet.Payload[5:9])
+	methodID := binary.LittleEndian.Uint32(packet.Payload[9:13])
+	if !e.take([2]uint32{serviceID, methodID}, now) {
+		return packet, util.PacketVerdictPass, ctx, nil
+	}
+
+	pending := &pendingSample{
+		sample: Sample{
+			Time:         now,
+			RPCID:        packet.RPCID,
+			ServiceID:    serviceID,
+			MethodID:     methodID,
+			PublicBytes:  len(packet.Payload),
+			TotalPackets: packet.TotalPackets,
+		},
+		payload: append([]byte(nil), packet.Payload...), // elements after this one may modify the payload
+	}
+	if packet.Source != nil {
+		pending.sample.Source = packet.Source.String()
+	}
+	if packet.Peer != nil {
+		pending.sample.Destination = packet.Peer.String()
+	}
+
+	select {
+	case e.queue <- pending:
+	default:
+		logging.Debug("Sample queue full, dropping sample", zap.Uint64("rpcID", packet.RPCID))
+	}
+	return packet, util.PacketVerdictPass, ctx, nil
+}
+
+// ProcessResponse returns the response unchanged
+func (e *SamplingElement) ProcessResponse(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	return packet, util.PacketVerdictPass, ctx, nil
+}
+
+// Name returns the name of this element
+func (e *SamplingElement) Name() string {
+	return "SamplingElement"
+}
+
+// Describe returns the descriptor of this element
+func (e *SamplingElement) Describe() sharedelement.Descriptor {
+	return sharedelement.Descriptor{
+		Name:        e.Name(),
+		Version:     "v1",
+		Description: "Writes samples of requests with their decoded public segment to a sink",
+		Payload:     sharedelement.PayloadPublic,
+	}
+}
+
+// Close stops writing samples. Samples still queued are discarded.
+func (e *SamplingElement) Close() {
+	e.stopOnce.Do(func() { close(e.done) })
+}
+
+// take reports whether a request of the method may be sampled, counting it if so
+func (e *SamplingElement) take(method [2]uint32, now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	w := e.windows[method]
+	if w == nil || now.Sub(w.start) >= time.Minute {
+		w = &sampleWindow{start: now}
+		e.windows[method] = w
+	}
+	if w.count >= e.perMinute {
+		return false
+	}
+	w.count++
+	return true
+}
+
+// run decodes and writes queued samples until Close is called
+func (e *SamplingElement) run() {
+	for {
+		select {
+		case <-e.done:
+			return
+		case pending := <-e.queue:
+			if err := e.write(pending); err != nil {
+				logging.Warn("Failed to write sample", zap.Uint64("rpcID", pending.sample.RPCID), zap.Error(err))
+			}
+		}
+	}
+}
+
+// write decodes the public segment of a sample and puts it into the sink
+func (e *SamplingElement) write(pending *pendingSample) error {
+	sample := &pending.sample
+	if method, ok := e.registry.Method(sample.ServiceID, sample.MethodID); ok {
+		sample.Service, sample.Method = method.Service, method.Method
+	}
+	if d, err := e.registry.DecodeRequest(pending.payload); err != nil {
+		sample.DecodeError = err.Error()
+	} else {
+		sample.Public = d
+	}
+
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return fmt.Errorf("failed to serialize sample: %w", err)
+	}
+	return e.sink.Put(context.Background(), sampleKey(sample), data)
+}
+
+// sampleKey returns <service>/<method>/<date>/<unix nanos>-<rpcID>.json, using the IDs
+// when the method is unknown
+func sampleKey(sample *Sample) string {
+	service, method := sample.Service, sample.Method
+	if service == "" {
+		service = strconv.FormatUint(uint64(sample.ServiceID), 10)
+	}
+	if method == "" {
+		method = strconv.FormatUint(uint64(sample.MethodID), 10)
+	}
+	return fmt.Sprintf("%s/%s/%s/%d-%d.json", service, method, sample.Time.UTC().Format("2006-01-02"), sample.Time.UnixNano(), sample.RPCID)
+}
@@ -0,0 +1,138 @@
+package element
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/schema"
+)
+
+// kvRegistry returns a registry with the KV.Get method (service 1, method 1), whose request
+// has the public string field key
+func kvRegistry() *schema.Registry {
+	registry := schema.NewRegistry()
+	registry.RegisterMessage(&schema.Message{FullName: "kv.GetRequest", Fields: []schema.Field{{Number: 1, Name: "key", Kind: schema.KindString, Public: true}}})
+	registry.RegisterMethod(&schema.MethodSchema{ServiceID: 1, MethodID: 1, Service: "KV", Method: "Get", Request: "kv.GetRequest", Response: "kv.GetRequest"})
+	return registry
+}
+
+// methodPayload returns stringFieldPayload(key) addressed to a method
+func methodPayload(serviceID, methodID uint32, key string) []byte {
+	payload := stringFieldPayload(key)
+	binary.LittleEndian.PutUint32(payload[5:9], serviceID)
+	binary.LittleEndian.PutUint32(payload[9:13], methodID)
+	return payload
+}
+
+// sampleRecorder is a SampleSink handing the samples to the test
+type sampleRecorder chan [2]string
+
+func (r sampleRecorder) Put(ctx context.Context, key string, data []byte) error {
+	r <- [2]string{key, string(data)}
+	return nil
+}
+
+// sampleDoc is a sample as parsed back from its JSON document
+type sampleDoc struct {
+	Sample
+	Public map[string]any `json:"public"`
+}
+
+// nextSample returns the next sample put into r
+func nextSample(t *testing.T, r sampleRecorder) (string, sampleDoc) {
+	t.Helper()
+	select {
+	case put := <-r:
+		var sample sampleDoc
+		if err := json.Unmarshal([]byte(put[1]), &sample); err != nil {
+			t.Fatalf("Failed to parse sample %s: %v", put[1], err)
+		}
+		return put[0], sample
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a sample")
+		return "", sampleDoc{}
+	}
+}
+
+func TestSamplingElement(t *testing.T) {
+	sink := make(sampleRecorder, sampleQueueSize)
+	e := NewSamplingElement(sink, 2, kvRegistry())
+	defer e.Close()
+
+	// The quota of 2 per minute and method leaves the third request of KV.Get out
+	for i, payload := range [][]byte{methodPayload(1, 1, "a"), methodPayload(1, 1, "b"), methodPayload(1, 1, "c"), methodPayload(1, 2, "d")} {
+		original := bytes.Clone(payload)
+		p, verdict, _, err := e.ProcessRequest(context.Background(), requestPacket(uint64(i+1), payload))
+		if err != nil || verdict != util.PacketVerdictPass || !bytes.Equal(p.Payload, original) {
+			t.Fatalf("ProcessRequest returned %v, %v, want the request passed unchanged", verdict, err)
+		}
+	}
+
+	for _, want := range []struct {
+		rpcID   uint64
+		prefix  string
+		key     string
+		decoded bool
+	}{{1, "KV/Get/", "a", true}, {2, "KV/Get/", "b", true}, {4, "1/2/", "d", false}} {
+		key, sample := nextSample(t, sink)
+		if !strings.HasPrefix(key, want.prefix) || !strings.HasSuffix(key, fmt.Sprintf("-%d.json", want.rpcID)) {
+			t.Errorf("Sample of RPC %d stored under %s, want %s<date>/<nanos>-%d.json", want.rpcID, key, want.prefix, want.rpcID)
+		}
+		if sample.RPCID != want.rpcID || sample.PublicBytes != len(stringFieldPayload(want.key)) {
+			t.Errorf("Got sample %+v, want RPC %d", sample, want.rpcID)
+		}
+		if !want.decoded {
+			// The method has no registered schema
+			if sample.DecodeError == "" || sample.Public != nil {
+				t.Errorf("Sample of an unknown method has no decode error: %+v", sample)
+			}
+			continue
+		}
+		if sample.Public == nil {
+			t.Fatalf("Sample of RPC %d not decoded: %s", want.rpcID, sample.DecodeError)
+		}
+		if key := sample.Public["key"]; key != want.key {
+			t.Errorf("Sample of RPC %d has key %v, want %s", want.rpcID, key, want.key)
+		}
+	}
+	select {
+	case put := <-sink:
+		t.Errorf("Unexpected sample beyond the quota: %s", put[0])
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSamplingElement_QuotaWindow(t *testing.T) {
+	e := &SamplingElement{perMinute: 1, windows: make(map[[2]uint32]*sampleWindow)}
+	start := time.Now()
+	if !e.take([2]uint32{1, 1}, start) || e.take([2]uint32{1, 1}, start.Add(30*time.Second)) {
+		t.Error("Expected one sample in the first minute")
+	}
+	if !e.take([2]uint32{1, 2}, start) {
+		t.Error("Expected methods to have separate quotas")
+	}
+	if !e.take([2]uint32{1, 1}, start.Add(time.Minute)) {
+		t.Error("Expected the quota to reset after a minute")
+	}
+}
+
+func TestDirSink(t *testing.T) {
+	dir := t.TempDir()
+	sink := &DirSink{Dir: dir}
+	if err := sink.Put(context.Background(), "KV/Get/2024-05-01/1-2.json", []byte(`{}`)); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "KV", "Get", "2024-05-01", "1-2.json"))
+	if err != nil || string(data) != `{}` {
+		t.Errorf("Read %q, %v, want {}", data, err)
+	}
+}
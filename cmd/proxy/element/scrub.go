@@ -0,0 +1,361 @@
+package element
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	sharedelement "github.com/appnet-org/arpc/pkg/element"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/schema"
+	"go.uber.org/zap"
+)
+
+// ErrScrubFailed is returned when a request that must be scrubbed cannot be decoded or
+// re-encoded. Such requests are dropped rather than forwarded with the values in clear.
+var ErrScrubFailed = errors.New("failed to scrub request")
+
+// ScrubAction is how a scrubbed value is replaced
+type ScrubAction int
+
+const (
+	// ScrubHash replaces a value by the hex-encoded HMAC-SHA256 of the value with the key of
+	// the element. Equal values get equal hashes, across proxies sharing the key.
+	ScrubHash ScrubAction = iota
+	// ScrubToken replaces a value by a random token from the element's TokenVault, which
+	// maps it back to the value
+	ScrubToken
+)
+
+// String returns the name of the action, as used by ParseScrubRules
+func (a ScrubAction) String() string {
+	if a == ScrubToken {
+		return "token"
+	}
+	return "hash"
+}
+
+// ScrubRule replaces the values of a string or bytes field of a request message
+type ScrubRule struct {
+	Message string // full name of the request message, e.g. "kv.SetRequest"
+	Path    string // dot-separated field names from the message, e.g. "user.email"
+	Action  ScrubAction
+}
+
+// String formats the rule in the syntax of ParseScrubRules
+func (r ScrubRule) String() string {
+	return r.Message + ":" + r.Path + "=" + r.Action.String()
+}
+
+// ParseScrubRules parses a comma-separated list of rules, each of the form
+//
+//	message:path=action
+//
+// where action is hash or token, e.g.
+//
+//	kv.SetRequest:user.email=token,kv.SetRequest:ssn=hash
+func ParseScrubRules(spec string) ([]ScrubRule, error) {
+	var rules []ScrubRule
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		target, action, ok := strings.Cut(entry, "=")
+		message, path, ok2 := strings.Cut(target, ":")
+		if !ok || !ok2 || message == "" || path == "" {
+			return nil, fmt.Errorf("invalid scrub rule %q: expected message:path=action", entry)
+		}
+		rule := ScrubRule{Message: strings.TrimSpace(message), Path: strings.TrimSpace(path)}
+		switch strings.TrimSpace(action) {
+		case "hash":
+			rule.Action = ScrubHash
+		case "token":
+			rule.Action = ScrubToken
+		default:
+			return nil, fmt.Errorf("invalid scrub rule %q: unknown action %q, expected hash or token", entry, action)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// TokenVault maps scrubbed values to tokens and back. Backends only ever see the tokens;
+// parties trusted with the vault can recover the values.
+type TokenVault interface {
+	// Token returns the token of value, creating it on first use
+	Token(value string) (string, error)
+	// Value returns the value of a token
+	Value(token string) (string, bool)
+}
+
+// MemoryVault is a TokenVault held in memory. It grows with every distinct value and
+// forgets the tokens on restart, so deployments whose backends store tokens should provide
+// a TokenVault backed by a shared store.
+type MemoryVault struct {
+	mu     sync.Mutex
+	tokens map[string]string // value -> token
+	values map[string]string // token -> value
+}
+
+// NewMemoryVault creates an empty in-memory vault
+func NewMemoryVault() *MemoryVault {
+	return &MemoryVault{tokens: make(map[string]string), values: make(map[string]string)}
+}
+
+// Token returns the token of value: "tok_" and 32 random hex digits
+func (v *MemoryVault) Token(value string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if token, ok := v.tokens[value]; ok {
+		return token, nil
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := "tok_" + hex.EncodeToString(b[:])
+	v.tokens[value] = token
+	v.values[token] = value
+	return token, nil
+}
+
+// Value returns the value of a token
+func (v *MemoryVault) Value(token string) (string, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	value, ok := v.values[token]
+	return value, ok
+}
+
+// scrubPath is a rule resolved against the schema of its message
+type scrubPath struct {
+	fields []*schema.Field // from the request message to the scrubbed field
+	action ScrubAction
+}
+
+// ScrubElement replaces the values of configured request fields by hashes or tokens before
+// requests reach less-trusted backends. Requests are decoded with the schema registry by
+// the method IDs of their headers, and their public segment is re-encoded with the
+// replaced values; the private segment is forwarded as is. Empty values are left empty.
+// Responses are never modified.
+type ScrubElement struct {
+	registry *schema.Registry
+	key      []byte
+	vault    TokenVault
+	paths    map[string][]scrubPath // by request message
+}
+
+// NewScrubElement creates an element applying rules. key is the HMAC key of hash rules, and
+// vault provides the tokens of token rules (a MemoryVault if nil). If registry is nil,
+// schema.Global is used. Rules must name registered messages, and paths must lead through
+// nested messages to a string or bytes field. The first field of a path must be public,
+// since the proxy never sees the private segment of a request.
+func NewScrubElement(rules []ScrubRule, key []byte, vault TokenVault, registry *schema.Registry) (*ScrubElement, error) {
+	if registry == nil {
+		registry = schema.Global
+	}
+	if vault == nil {
+		vault = NewMemoryVault()
+	}
+	e := &ScrubElement{
+		registry: registry,
+		key:      key,
+		vault:    vault,
+		paths:    make(map[string][]scrubPath),
+	}
+	for _, rule := range rules {
+		if rule.Action == ScrubHash && len(key) == 0 {
+			return nil, fmt.Errorf("scrub rule %s: hash rules need a key", rule)
+		}
+		path, err := e.resolve(rule)
+		if err != nil {
+			return nil, fmt.Errorf("scrub rule %s: %w", rule, err)
+		}
+		e.paths[rule.Message] = append(e.paths[rule.Message], path)
+	}
+	return e, nil
+}
+
+// resolve looks up the fields of the path of a rule
+func (e *ScrubElement) resolve(rule ScrubRule) (scrubPath, error) {
+	path := scrubPath{action: rule.Action}
+	msg, ok := e.registry.Message(rule.Message)
+	if !ok {
+		return path, fmt.Errorf("unknown message %s", rule.Message)
+	}
+	names := strings.Split(rule.Path, ".")
+	for i, name := range names {
+		if msg == nil {
+			return path, fmt.Errorf("field %s is not a message", names[i-1])
+		}
+		f := msg.FieldByName(name)
+		if f == nil {
+			return path, fmt.Errorf("%s has no field %s", msg.FullName, name)
+		}
+		if i == 0 && !f.Public {
+			return path, fmt.Errorf("field %s is private", name)
+		}
+		path.fields = append(path.fields, f)
+		msg = nil
+		if f.Kind == schema.KindMessage {
+			msg, _ = e.registry.Message(f.Message) // nil for well-known types
+		}
+	}
+	if last := path.fields[len(path.fields)-1]; last.Kind != schema.KindString && last.Kind != schema.KindBytes {
+		return path, fmt.Errorf("field %s is a %s, only string and bytes fields can be scrubbed", last.Name, last.Kind)
+	}
+	return path, nil
+}
+
+// ProcessRequest replaces the configured fields of the request
+func (e *ScrubElement) ProcessRequest(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	if packet == nil || len(packet.Payload) < 13 {
+		return packet, util.PacketVerdictPass, ctx, nil
+	}
+	payload := packet.Payload
+	serviceID := binary.LittleEndian.Uint32(payload[5:9])
+	methodID := binary.LittleEndian.Uint32(payload[9:13])
+	method, ok := e.registry.Method(serviceID, methodID)
+	if !ok || len(e.paths[method.Request]) == 0 {
+		return packet, util.PacketVerdictPass, ctx, nil
+	}
+
+	scrubbed, err := e.scrub(payload, method.Request)
+	if err != nil {
+		logging.Warn("Dropping request that could not be scrubbed", zap.Uint64("rpcID", packet.RPCID), zap.String("message", method.Request), zap.Error(err))
+		return nil, util.PacketVerdictDrop, ctx, fmt.Errorf("%w: %v", ErrScrubFailed, err)
+	}
+	packet.Payload = scrubbed
+	return packet, util.PacketVerdictPass, ctx, nil
+}
+
+// ProcessResponse returns the response unchanged
+func (e *ScrubElement) ProcessResponse(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	return packet, util.PacketVerdictPass, ctx, nil
+}
+
+// Name returns the name of this element
+func (e *ScrubElement) Name() string {
+	return "ScrubElement"
+}
+
+// Describe returns the descriptor of this element
+func (e *ScrubElement) Describe() sharedelement.Descriptor {
+	return sharedelement.Descriptor{
+		Name:        e.Name(),
+		Version:     "v1",
+		Description: "Replaces the values of request fields by hashes or tokens",
+		Payload:     sharedelement.PayloadPublic,
+		Modifies:    true,
+	}
+}
+
+// scrub returns payload, a request of the named message, with its public segment scrubbed.
+// The payload holds the public segment, followed by the private one if it fit in the same
+// packet.
+func (e *ScrubElement) scrub(payload []byte, message string) ([]byte, error) {
+	offsetToPrivate := int(binary.LittleEndian.Uint32(payload[1:5]))
+	if offsetToPrivate < 13 || offsetToPrivate > len(payload) {
+		return nil, fmt.Errorf("invalid offset to private segment %d", offsetToPrivate)
+	}
+	d, err := e.registry.Decode(payload[:offsetToPrivate], message)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := false
+	for _, path := range e.paths[message] {
+		n, err := e.scrubPath(d, path.fields, path.action)
+		if err != nil {
+			return nil, err
+		}
+		changed = changed || n > 0
+	}
+	if !changed {
+		return payload, nil
+	}
+
+	encoded, err := e.registry.Encode(d)
+	if err != nil {
+		return nil, err
+	}
+	// Messages without private fields decode as complete, and encode with an empty private
+	// segment that the payload already holds
+	public := encoded[:binary.LittleEndian.Uint32(encoded[1:5])]
+	copy(public[5:13], payload[5:13]) // service and method IDs
+	return append(public, payload[offsetToPrivate:]...), nil
+}
+
+// scrubPath replaces the values at the end of fields in d, through every element of repeated
+// fields, and returns how many it replaced
+func (e *ScrubElement) scrubPath(d *schema.DynamicMessage, fields []*schema.Field, action ScrubAction) (int, error) {
+	f := fields[0]
+	v, ok := d.Fields[f.Number]
+	if !ok {
+		return 0, nil
+	}
+	items := []any{v}
+	if f.Repeated {
+		items, _ = v.([]any)
+	}
+
+	count := 0
+	for i, item := range items {
+		if len(fields) > 1 {
+			nested, ok := item.(*schema.DynamicMessage)
+			if !ok {
+				continue // well-known types were rejected by resolve, so unset
+			}
+			n, err := e.scrubPath(nested, fields[1:], action)
+			if err != nil {
+				return 0, err
+			}
+			count += n
+			continue
+		}
+
+		var value string
+		switch item := item.(type) {
+		case string:
+			value = item
+		case []byte:
+			value = string(item)
+		}
+		if value == "" {
+			continue
+		}
+		replacement, err := e.replace(value, action)
+		if err != nil {
+			return 0, err
+		}
+		if f.Kind == schema.KindBytes {
+			items[i] = []byte(replacement)
+		} else {
+			items[i] = replacement
+		}
+		count++
+	}
+	if !f.Repeated && count > 0 {
+		d.Fields[f.Number] = items[0]
+	}
+	return count, nil
+}
+
+// replace returns the hash or token of value
+func (e *ScrubElement) replace(value string, action ScrubAction) (string, error) {
+	if action == ScrubToken {
+		return e.vault.Token(value)
+	}
+	mac := hmac.New(sha256.New, e.key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,171 @@
+package element
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/schema"
+)
+
+// scrubRegistry returns a registry with the KV.Set method (service 1, method 2)
+func scrubRegistry() *schema.Registry {
+	registry := kvRegistry()
+	registry.RegisterMessage(&schema.Message{FullName: "kv.User", Fields: []schema.Field{
+		{Number: 1, Name: "email", Kind: schema.KindString, Public: true},
+	}})
+	registry.RegisterMessage(&schema.Message{FullName: "kv.SetRequest", Fields: []schema.Field{
+		{Number: 1, Name: "key", Kind: schema.KindString, Public: true},
+		{Number: 2, Name: "user", Kind: schema.KindMessage, Message: "kv.User", Public: true},
+		{Number: 3, Name: "ssn", Kind: schema.KindBytes, Public: true},
+		{Number: 4, Name: "tags", Kind: schema.KindString, Repeated: true, Public: true},
+		{Number: 5, Name: "count", Kind: schema.KindInt32, Public: true},
+		{Number: 6, Name: "secret", Kind: schema.KindString},
+	}})
+	registry.RegisterMethod(&schema.MethodSchema{ServiceID: 1, MethodID: 2, Service: "KV", Method: "Set", Request: "kv.SetRequest", Response: "kv.GetRequest"})
+	return registry
+}
+
+// setRequest returns the payload of a KV.Set request
+func setRequest(t *testing.T, registry *schema.Registry, fields map[int32]any) []byte {
+	t.Helper()
+	msg, _ := registry.Message("kv.SetRequest")
+	payload, err := registry.Encode(&schema.DynamicMessage{Schema: msg, Fields: fields})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	binary.LittleEndian.PutUint32(payload[5:9], 1)
+	binary.LittleEndian.PutUint32(payload[9:13], 2)
+	return payload
+}
+
+func TestParseScrubRules(t *testing.T) {
+	rules, err := ParseScrubRules(" kv.SetRequest:user.email=token, kv.SetRequest:ssn=hash,")
+	if err != nil {
+		t.Fatalf("ParseScrubRules failed: %v", err)
+	}
+	want := []ScrubRule{{"kv.SetRequest", "user.email", ScrubToken}, {"kv.SetRequest", "ssn", ScrubHash}}
+	if len(rules) != len(want) || rules[0] != want[0] || rules[1] != want[1] {
+		t.Errorf("ParseScrubRules returned %v, want %v", rules, want)
+	}
+	if got := rules[0].String(); got != "kv.SetRequest:user.email=token" {
+		t.Errorf("String returned %s", got)
+	}
+	for _, spec := range []string{"kv.SetRequest:ssn", "ssn=hash", "kv.SetRequest:=hash", "kv.SetRequest:ssn=encrypt"} {
+		if _, err := ParseScrubRules(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestNewScrubElement_InvalidRules(t *testing.T) {
+	registry := scrubRegistry()
+	for _, tc := range []struct {
+		rule ScrubRule
+		key  []byte
+		err  string
+	}{
+		{ScrubRule{"kv.SetRequest", "ssn", ScrubHash}, nil, "need a key"},
+		{ScrubRule{"kv.Unknown", "ssn", ScrubToken}, nil, "unknown message"},
+		{ScrubRule{"kv.SetRequest", "missing", ScrubToken}, nil, "has no field"},
+		{ScrubRule{"kv.SetRequest", "secret", ScrubToken}, nil, "is private"},
+		{ScrubRule{"kv.SetRequest", "count", ScrubToken}, nil, "only string and bytes"},
+		{ScrubRule{"kv.SetRequest", "key.email", ScrubToken}, nil, "is not a message"},
+	} {
+		if _, err := NewScrubElement([]ScrubRule{tc.rule}, tc.key, nil, registry); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Rule %s returned %v, want an error containing %q", tc.rule, err, tc.err)
+		}
+	}
+}
+
+func TestScrubElement(t *testing.T) {
+	registry := scrubRegistry()
+	key := []byte("scrub-key")
+	vault := NewMemoryVault()
+	rules, _ := ParseScrubRules("kv.SetRequest:user.email=token,kv.SetRequest:ssn=hash,kv.SetRequest:tags=token")
+	e, err := NewScrubElement(rules, key, vault, registry)
+	if err != nil {
+		t.Fatalf("NewScrubElement failed: %v", err)
+	}
+	user, _ := registry.Message("kv.User")
+	payload := setRequest(t, registry, map[int32]any{
+		1: "k1",
+		2: &schema.DynamicMessage{Schema: user, Fields: map[int32]any{1: "alice@example.com"}},
+		3: []byte("123-45-6789"),
+		4: []any{"vip", ""},
+		5: int32(7),
+		6: "private",
+	})
+
+	p, verdict, _, err := e.ProcessRequest(context.Background(), requestPacket(1, payload))
+	if err != nil || verdict != util.PacketVerdictPass {
+		t.Fatalf("ProcessRequest returned %v, %v, want a pass", verdict, err)
+	}
+	if !bytes.Equal(p.Payload[5:13], payload[5:13]) {
+		t.Errorf("Service and method IDs changed to %x, want %x", p.Payload[5:13], payload[5:13])
+	}
+	d, err := registry.Decode(p.Payload, "kv.SetRequest")
+	if err != nil {
+		t.Fatalf("Failed to decode the scrubbed request: %v", err)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("123-45-6789"))
+	if ssn, _ := d.Get("ssn"); string(ssn.([]byte)) != hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("ssn scrubbed to %q, want its HMAC", ssn)
+	}
+	email, _ := d.Fields[2].(*schema.DynamicMessage).Get("email")
+	if value, ok := vault.Value(email.(string)); !ok || value != "alice@example.com" {
+		t.Errorf("email scrubbed to %q, which the vault maps to %q, want a token of alice@example.com", email, value)
+	}
+	tags, _ := d.Get("tags")
+	if items := tags.([]any); len(items) != 2 || !strings.HasPrefix(items[0].(string), "tok_") || items[1] != "" {
+		t.Errorf("tags scrubbed to %v, want a token and the empty tag", tags)
+	}
+	for name, want := range map[string]any{"key": "k1", "count": int32(7), "secret": "private"} {
+		if got, _ := d.Get(name); got != want {
+			t.Errorf("%s is %v after scrubbing, want it unchanged %v", name, got, want)
+		}
+	}
+
+	// Equal values get equal replacements
+	again, _, _, _ := e.ProcessRequest(context.Background(), requestPacket(2, bytes.Clone(payload)))
+	if !bytes.Equal(again.Payload, p.Payload) {
+		t.Error("Scrubbing the same request twice gave different payloads")
+	}
+}
+
+func TestScrubElement_PassesAndDrops(t *testing.T) {
+	registry := scrubRegistry()
+	e, err := NewScrubElement([]ScrubRule{{"kv.SetRequest", "ssn", ScrubToken}}, nil, nil, registry)
+	if err != nil {
+		t.Fatalf("NewScrubElement failed: %v", err)
+	}
+
+	// Requests of other methods, and requests without values to scrub, are forwarded as is
+	for _, payload := range [][]byte{
+		methodPayload(1, 1, "k1"),
+		setRequest(t, registry, map[int32]any{1: "k1"}),
+	} {
+		original := bytes.Clone(payload)
+		p, verdict, _, err := e.ProcessRequest(context.Background(), requestPacket(1, payload))
+		if err != nil || verdict != util.PacketVerdictPass || !bytes.Equal(p.Payload, original) {
+			t.Errorf("ProcessRequest returned %v, %v, want the request unchanged", verdict, err)
+		}
+	}
+
+	// Requests that cannot be decoded are dropped rather than forwarded in clear
+	payload := setRequest(t, registry, map[int32]any{3: []byte("123-45-6789")})
+	binary.LittleEndian.PutUint32(payload[1:5], uint32(len(payload)+1))
+	_, verdict, _, err := e.ProcessRequest(context.Background(), requestPacket(2, payload))
+	if !errors.Is(err, ErrScrubFailed) || verdict != util.PacketVerdictDrop {
+		t.Errorf("ProcessRequest returned %v, %v for a malformed request, want a drop with ErrScrubFailed", verdict, err)
+	}
+}
@@ -0,0 +1,424 @@
+package element
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	sharedelement "github.com/appnet-org/arpc/pkg/element"
+	"github.com/appnet-org/arpc/pkg/logging"
+	arpcpacket "github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/schema"
+	"go.uber.org/zap"
+)
+
+// validationPendingTimeout is how long the method of a request is kept waiting for its
+// response, past which the request is taken as lost
+const validationPendingTimeout = 2 * time.Minute
+
+// ValidationOp is the check of a ValidationRule
+type ValidationOp int
+
+const (
+	// ValidateRequired checks that a field is set: non-zero scalars, non-empty strings,
+	// bytes and repeated fields, present nested messages
+	ValidateRequired ValidationOp = iota
+	// ValidateMin checks that a numeric field is at least the bound of the rule
+	ValidateMin
+	// ValidateMax checks that a numeric field is at most the bound of the rule
+	ValidateMax
+)
+
+// ValidationAction is what a ValidateElement does with a response failing validation
+type ValidationAction int
+
+const (
+	// ValidationDrop drops the response, and the client gets a DropReasonMalformedPayload
+	// error in its place
+	ValidationDrop ValidationAction = iota
+	// ValidationFlag forwards the response, only logging and counting the violation
+	ValidationFlag
+)
+
+// ValidationRule is an invariant of a field of a message, checked wherever the message
+// appears in a response: as the response message or nested in it
+type ValidationRule struct {
+	Message string // full name of the message, e.g. "google.type.Money"
+	Field   string // name of a field of the message, e.g. "units"
+	Op      ValidationOp
+	Bound   float64 // bound of ValidateMin and ValidateMax
+}
+
+// String formats the rule in the syntax of ParseValidationRules
+func (r ValidationRule) String() string {
+	target := r.Message + ":" + r.Field
+	switch r.Op {
+	case ValidateMin:
+		return target + ">=" + strconv.FormatFloat(r.Bound, 'g', -1, 64)
+	case ValidateMax:
+		return target + "<=" + strconv.FormatFloat(r.Bound, 'g', -1, 64)
+	}
+	return target + "=required"
+}
+
+// ParseValidationRules parses a comma-separated list of rules, each of one of the forms
+//
+//	message:field>=bound
+//	message:field<=bound
+//	message:field=required
+//
+// e.g.
+//
+//	google.type.Money:units>=0,shop.Order:id=required
+func ParseValidationRules(spec string) ([]ValidationRule, error) {
+	var rules []ValidationRule
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var rule ValidationRule
+		var target, value string
+		var ok bool
+		if target, value, ok = strings.Cut(entry, ">="); ok {
+			rule.Op = ValidateMin
+		} else if target, value, ok = strings.Cut(entry, "<="); ok {
+			rule.Op = ValidateMax
+		} else if target, value, ok = strings.Cut(entry, "="); ok {
+			rule.Op = ValidateRequired
+		}
+		message, field, ok2 := strings.Cut(target, ":")
+		if !ok || !ok2 || message == "" || field == "" {
+			return nil, fmt.Errorf("invalid validation rule %q: expected message:field>=bound, message:field<=bound or message:field=required", entry)
+		}
+		rule.Message, rule.Field = strings.TrimSpace(message), strings.TrimSpace(field)
+		value = strings.TrimSpace(value)
+		if rule.Op == ValidateRequired {
+			if value != "required" {
+				return nil, fmt.Errorf("invalid validation rule %q: unknown check %q, expected required", entry, value)
+			}
+		} else {
+			bound, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid validation rule %q: invalid bound %q", entry, value)
+			}
+			rule.Bound = bound
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// validationCheck is a rule resolved against the schema of its message
+type validationCheck struct {
+	rule  ValidationRule
+	field *schema.Field
+}
+
+// pendingMethod is the method of a request waiting for its response
+type pendingMethod struct {
+	method *schema.MethodSchema
+	sent   time.Time
+}
+
+// methodViolations counts the responses of a method that failed validation
+type methodViolations struct {
+	decode    uint64 // responses that did not decode with the schema of the method
+	invariant uint64 // responses breaking a rule
+}
+
+// ValidateElement checks that responses decode with the registered schema of their method
+// and hold the invariants of its rules, e.g. non-negative money units, so that corrupt
+// responses of a faulty backend are caught before they reach clients. Responses carry no
+// method IDs, so the element takes the method of a response from its request. Only the
+// public segment is checked, since the proxy never sees the private one. Responses of
+// methods without a registered schema are forwarded unchecked.
+type ValidateElement struct {
+	registry *schema.Registry
+	action   ValidationAction
+	checks   map[string][]validationCheck // by message
+
+	mu         sync.Mutex
+	pending    map[uint64]pendingMethod // by RPC ID
+	lastPrune  time.Time
+	violations map[*schema.MethodSchema]*methodViolations
+}
+
+// NewValidateElement creates an element checking rules and applying action to the responses
+// that fail. If registry is nil, schema.Global is used. Rules must name registered messages
+// and public fields; bounds only apply to numeric fields.
+func NewValidateElement(rules []ValidationRule, action ValidationAction, registry *schema.Registry) (*ValidateElement, error) {
+	if registry == nil {
+		registry = schema.Global
+	}
+	e := &ValidateElement{
+		registry:   registry,
+		action:     action,
+		checks:     make(map[string][]validationCheck),
+		pending:    make(map[uint64]pendingMethod),
+		violations: make(map[*schema.MethodSchema]*methodViolations),
+	}
+	for _, rule := range rules {
+		check, err := e.resolve(rule)
+		if err != nil {
+			return nil, fmt.Errorf("validation rule %s: %w", rule, err)
+		}
+		e.checks[rule.Message] = append(e.checks[rule.Message], check)
+	}
+	return e, nil
+}
+
+// resolve looks up the field of a rule
+func (e *ValidateElement) resolve(rule ValidationRule) (validationCheck, error) {
+	msg, ok := e.registry.Message(rule.Message)
+	if !ok {
+		return validationCheck{}, fmt.Errorf("unknown message %s", rule.Message)
+	}
+	f := msg.FieldByName(rule.Field)
+	if f == nil {
+		return validationCheck{}, fmt.Errorf("%s has no field %s", msg.FullName, rule.Field)
+	}
+	if !f.Public {
+		return validationCheck{}, fmt.Errorf("field %s is private", f.Name)
+	}
+	if rule.Op != ValidateRequired {
+		switch f.Kind {
+		case schema.KindInt32, schema.KindInt64, schema.KindUint32, schema.KindUint64, schema.KindFloat, schema.KindDouble, schema.KindEnum:
+		default:
+			return validationCheck{}, fmt.Errorf("field %s is a %s, only numeric fields can be bounded", f.Name, f.Kind)
+		}
+	}
+	return validationCheck{rule: rule, field: f}, nil
+}
+
+// ProcessRequest records the method of the request, to validate its response
+func (e *ValidateElement) ProcessRequest(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	if packet == nil || len(packet.Payload) < 13 {
+		return packet, util.PacketVerdictPass, ctx, nil
+	}
+	serviceID := binary.LittleEndian.Uint32(packet.Payload[5:9])
+	methodID := binary.LittleEndian.Uint32(packet.Payload[9:13])
+	method, ok := e.registry.Method(serviceID, methodID)
+	if !ok {
+		return packet, util.PacketVerdictPass, ctx, nil
+	}
+
+	now := time.Now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending[packet.RPCID] = pendingMethod{method: method, sent: now}
+	if now.Sub(e.lastPrune) > time.Second {
+		e.lastPrune = now
+		for rpcID, p := range e.pending {
+			if now.Sub(p.sent) > validationPendingTimeout {
+				delete(e.pending, rpcID)
+			}
+		}
+	}
+	return packet, util.PacketVerdictPass, ctx, nil
+}
+
+// ProcessResponse validates the response of a recorded request
+func (e *ValidateElement) ProcessResponse(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	if packet == nil {
+		return packet, util.PacketVerdictPass, ctx, nil
+	}
+	e.mu.Lock()
+	p, ok := e.pending[packet.RPCID]
+	delete(e.pending, packet.RPCID)
+	e.mu.Unlock()
+	if !ok {
+		return packet, util.PacketVerdictPass, ctx, nil
+	}
+
+	kind, err := e.validate(packet.Payload, p.method.Response)
+	if err == nil {
+		return packet, util.PacketVerdictPass, ctx, nil
+	}
+	e.mu.Lock()
+	counts := e.violations[p.method]
+	if counts == nil {
+		counts = &methodViolations{}
+		e.violations[p.method] = counts
+	}
+	if kind == "decode" {
+		counts.decode++
+	} else {
+		counts.invariant++
+	}
+	e.mu.Unlock()
+
+	fields := []zap.Field{
+		zap.Uint64("rpcID", packet.RPCID),
+		zap.String("service", p.method.Service),
+		zap.String("method", p.method.Method),
+		zap.Error(err),
+	}
+	if e.action == ValidationFlag {
+		logging.Warn("Forwarding response that failed validation", fields...)
+		return packet, util.PacketVerdictPass, ctx, nil
+	}
+	logging.Warn("Dropping response that failed validation", fields...)
+	return nil, util.PacketVerdictDrop, ctx, util.NewDropError(arpcpacket.DropReasonMalformedPayload,
+		fmt.Sprintf("invalid response of %s.%s: %v", p.method.Service, p.method.Method, err))
+}
+
+// OnAbort forgets the method of an RPC aborted since its client went away
+func (e *ValidateElement) OnAbort(rpcID uint64, reason error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.pending, rpcID)
+}
+
+// Name returns the name of this element
+func (e *ValidateElement) Name() string {
+	return "ValidateElement"
+}
+
+// Describe returns the descriptor of this element
+func (e *ValidateElement) Describe() sharedelement.Descriptor {
+	return sharedelement.Descriptor{
+		Name:        e.Name(),
+		Version:     "v1",
+		Description: "Checks that responses decode with their schema and hold the invariants of its rules",
+		Payload:     sharedelement.PayloadPublic,
+	}
+}
+
+// validate decodes payload, the public segment of a response of the named message, and checks
+// the rules of every message in it. It returns the kind of the violation with its error.
+func (e *ValidateElement) validate(payload []byte, message string) (string, error) {
+	if len(payload) < 13 {
+		return "decode", fmt.Errorf("payload of %d bytes is shorter than the Symphony header", len(payload))
+	}
+	offsetToPrivate := min(int(binary.LittleEndian.Uint32(payload[1:5])), len(payload))
+	d, err := e.registry.Decode(payload[:offsetToPrivate], message)
+	if err != nil {
+		return "decode", err
+	}
+	if err := e.check(d); err != nil {
+		return "invariant", err
+	}
+	return "", nil
+}
+
+// check checks the rules of d and of the messages nested in it
+func (e *ValidateElement) check(d *schema.DynamicMessage) error {
+	for _, c := range e.checks[d.Schema.FullName] {
+		if err := c.check(d.Fields[c.field.Number]); err != nil {
+			return fmt.Errorf("%s.%s %w", d.Schema.FullName, c.field.Name, err)
+		}
+	}
+	for _, v := range d.Fields {
+		items := []any{v}
+		if list, ok := v.([]any); ok {
+			items = list
+		}
+		for _, item := range items {
+			if nested, ok := item.(*schema.DynamicMessage); ok {
+				if err := e.check(nested); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// check checks the rule on the value of its field, through every element of repeated fields
+func (c validationCheck) check(v any) error {
+	if c.rule.Op == ValidateRequired {
+		if isZeroValue(v) {
+			return fmt.Errorf("is required")
+		}
+		return nil
+	}
+	items := []any{v}
+	if c.field.Repeated {
+		items, _ = v.([]any)
+	}
+	for _, item := range items {
+		n, ok := numericValue(item)
+		if !ok {
+			continue
+		}
+		if c.rule.Op == ValidateMin && n < c.rule.Bound {
+			return fmt.Errorf("is %v, below %v", n, c.rule.Bound)
+		}
+		if c.rule.Op == ValidateMax && n > c.rule.Bound {
+			return fmt.Errorf("is %v, above %v", n, c.rule.Bound)
+		}
+	}
+	return nil
+}
+
+// numericValue returns a decoded numeric value as a float64
+func numericValue(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// isZeroValue tells whether a decoded value is unset
+func isZeroValue(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case string:
+		return v == ""
+	case []byte:
+		return len(v) == 0
+	case []any:
+		return len(v) == 0
+	}
+	n, ok := numericValue(v)
+	return ok && n == 0
+}
+
+// WriteMetrics writes the number of responses that failed validation, by method and kind of
+// violation, in the Prometheus text exposition format
+func (e *ValidateElement) WriteMetrics(w io.Writer) (int64, error) {
+	e.mu.Lock()
+	var series []string
+	for method, counts := range e.violations {
+		labels := fmt.Sprintf(`service="%s",method="%s"`, labelEscaper.Replace(method.Service), labelEscaper.Replace(method.Method))
+		series = append(series,
+			fmt.Sprintf(`arpc_proxy_response_violations_total{%s,kind="decode"} %d`, labels, counts.decode),
+			fmt.Sprintf(`arpc_proxy_response_violations_total{%s,kind="invariant"} %d`, labels, counts.invariant))
+	}
+	e.mu.Unlock()
+	sort.Strings(series)
+
+	var b strings.Builder
+	b.WriteString("# HELP arpc_proxy_response_violations_total Total number of responses that failed schema validation.\n")
+	b.WriteString("# TYPE arpc_proxy_response_violations_total counter\n")
+	for _, s := range series {
+		b.WriteString(s + "\n")
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// labelEscaper escapes Prometheus label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
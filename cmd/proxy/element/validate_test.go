@@ -0,0 +1,187 @@
+package element
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	arpcpacket "github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/schema"
+)
+
+// shopRegistry returns a registry with the Shop.GetOrder method (service 2, method 1), whose
+// response is a shop.Order
+func shopRegistry() *schema.Registry {
+	registry := kvRegistry()
+	registry.RegisterMessage(&schema.Message{FullName: "shop.Money", Fields: []schema.Field{
+		{Number: 1, Name: "units", Kind: schema.KindInt64, Public: true},
+	}})
+	registry.RegisterMessage(&schema.Message{FullName: "shop.Order", Fields: []schema.Field{
+		{Number: 1, Name: "id", Kind: schema.KindString, Public: true},
+		{Number: 2, Name: "total", Kind: schema.KindMessage, Message: "shop.Money", Public: true},
+		{Number: 3, Name: "quantities", Kind: schema.KindInt32, Repeated: true, Public: true},
+		{Number: 4, Name: "note", Kind: schema.KindString},
+	}})
+	registry.RegisterMethod(&schema.MethodSchema{ServiceID: 2, MethodID: 1, Service: "Shop", Method: "GetOrder", Request: "kv.GetRequest", Response: "shop.Order"})
+	return registry
+}
+
+// orderResponse returns a response packet carrying a shop.Order
+func orderResponse(t *testing.T, registry *schema.Registry, rpcID uint64, id string, units int64, quantities ...any) *util.BufferedPacket {
+	t.Helper()
+	order, _ := registry.Message("shop.Order")
+	money, _ := registry.Message("shop.Money")
+	payload, err := registry.Encode(&schema.DynamicMessage{Schema: order, Fields: map[int32]any{
+		1: id,
+		2: &schema.DynamicMessage{Schema: money, Fields: map[int32]any{1: units}},
+		3: quantities,
+	}})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	p := requestPacket(rpcID, payload)
+	p.PacketType = util.PacketTypeResponse
+	return p
+}
+
+// exchange passes a request of Shop.GetOrder through e, then its response
+func exchange(e *ValidateElement, resp *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, error) {
+	e.ProcessRequest(context.Background(), requestPacket(resp.RPCID, methodPayload(2, 1, "order-1")))
+	p, verdict, _, err := e.ProcessResponse(context.Background(), resp)
+	return p, verdict, err
+}
+
+func TestParseValidationRules(t *testing.T) {
+	spec := "shop.Money:units>=0, shop.Order:quantities<=10,shop.Order:id=required,"
+	rules, err := ParseValidationRules(spec)
+	if err != nil {
+		t.Fatalf("ParseValidationRules failed: %v", err)
+	}
+	want := []ValidationRule{
+		{"shop.Money", "units", ValidateMin, 0},
+		{"shop.Order", "quantities", ValidateMax, 10},
+		{"shop.Order", "id", ValidateRequired, 0},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("ParseValidationRules returned %v, want %v", rules, want)
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("Rule %d is %v, want %v", i, rules[i], want[i])
+		}
+	}
+	if got := rules[1].String(); got != "shop.Order:quantities<=10" {
+		t.Errorf("String returned %s", got)
+	}
+	for _, spec := range []string{"shop.Money:units", "units>=0", "shop.Money:>=0", "shop.Money:units>=zero", "shop.Order:id=optional"} {
+		if _, err := ParseValidationRules(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestNewValidateElement_InvalidRules(t *testing.T) {
+	registry := shopRegistry()
+	for _, tc := range []struct {
+		rule ValidationRule
+		err  string
+	}{
+		{ValidationRule{"shop.Unknown", "units", ValidateRequired, 0}, "unknown message"},
+		{ValidationRule{"shop.Order", "missing", ValidateRequired, 0}, "has no field"},
+		{ValidationRule{"shop.Order", "note", ValidateRequired, 0}, "is private"},
+		{ValidationRule{"shop.Order", "id", ValidateMin, 0}, "only numeric fields"},
+	} {
+		if _, err := NewValidateElement([]ValidationRule{tc.rule}, ValidationDrop, registry); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Rule %s returned %v, want an error containing %q", tc.rule, err, tc.err)
+		}
+	}
+}
+
+func TestValidateElement(t *testing.T) {
+	registry := shopRegistry()
+	rules, _ := ParseValidationRules("shop.Money:units>=0,shop.Order:quantities<=10,shop.Order:id=required")
+	e, err := NewValidateElement(rules, ValidationDrop, registry)
+	if err != nil {
+		t.Fatalf("NewValidateElement failed: %v", err)
+	}
+
+	// Valid responses are forwarded
+	resp := orderResponse(t, registry, 1, "order-1", 25, int32(1), int32(10))
+	if p, verdict, err := exchange(e, resp); err != nil || verdict != util.PacketVerdictPass || p != resp {
+		t.Errorf("ProcessResponse returned %v, %v for a valid response, want a pass", verdict, err)
+	}
+
+	// Invalid responses are dropped, and the client is told the payload is malformed
+	for _, tc := range []struct {
+		name string
+		resp *util.BufferedPacket
+		err  string
+	}{
+		{"negative nested units", orderResponse(t, registry, 2, "order-1", -5), "shop.Money.units is -5, below 0"},
+		{"missing id", orderResponse(t, registry, 3, "", 25), "shop.Order.id is required"},
+		{"quantity above the bound", orderResponse(t, registry, 4, "order-1", 25, int32(3), int32(11)), "shop.Order.quantities is 11, above 10"},
+		{"truncated payload", &util.BufferedPacket{Payload: []byte{0x01, 0x02}, RPCID: 5, PacketType: util.PacketTypeResponse}, "shorter than the Symphony header"},
+	} {
+		p, verdict, err := exchange(e, tc.resp)
+		var dropErr *util.DropError
+		if p != nil || verdict != util.PacketVerdictDrop || !errors.As(err, &dropErr) {
+			t.Errorf("%s: ProcessResponse returned %v, %v, want a drop with a DropError", tc.name, verdict, err)
+			continue
+		}
+		if dropErr.Reason != arpcpacket.DropReasonMalformedPayload || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: got reason %v, error %v, want DropReasonMalformedPayload and %q", tc.name, dropErr.Reason, err, tc.err)
+		}
+	}
+
+	// Responses to unknown requests, and to aborted ones, are not checked
+	invalid := orderResponse(t, registry, 6, "", -5)
+	if _, verdict, _, err := e.ProcessResponse(context.Background(), invalid); err != nil || verdict != util.PacketVerdictPass {
+		t.Errorf("ProcessResponse returned %v, %v without a request, want a pass", verdict, err)
+	}
+	e.ProcessRequest(context.Background(), requestPacket(6, methodPayload(2, 1, "order-1")))
+	e.OnAbort(6, nil)
+	if _, verdict, _, err := e.ProcessResponse(context.Background(), invalid); err != nil || verdict != util.PacketVerdictPass {
+		t.Errorf("ProcessResponse returned %v, %v after OnAbort, want a pass", verdict, err)
+	}
+
+	var metrics strings.Builder
+	if _, err := e.WriteMetrics(&metrics); err != nil {
+		t.Fatalf("WriteMetrics failed: %v", err)
+	}
+	for _, want := range []string{
+		`arpc_proxy_response_violations_total{service="Shop",method="GetOrder",kind="decode"} 1`,
+		`arpc_proxy_response_violations_total{service="Shop",method="GetOrder",kind="invariant"} 3`,
+	} {
+		if !strings.Contains(metrics.String(), want) {
+			t.Errorf("Metrics lack %s:\n%s", want, metrics.String())
+		}
+	}
+}
+
+func TestValidateElement_Flag(t *testing.T) {
+	registry := shopRegistry()
+	e, err := NewValidateElement([]ValidationRule{{"shop.Money", "units", ValidateMin, 0}}, ValidationFlag, registry)
+	if err != nil {
+		t.Fatalf("NewValidateElement failed: %v", err)
+	}
+
+	// Flagged responses are forwarded, only counted
+	resp := orderResponse(t, registry, 1, "order-1", -5)
+	if p, verdict, err := exchange(e, resp); err != nil || verdict != util.PacketVerdictPass || p != resp {
+		t.Errorf("ProcessResponse returned %v, %v, want the invalid response forwarded", verdict, err)
+	}
+	var metrics strings.Builder
+	e.WriteMetrics(&metrics)
+	if !strings.Contains(metrics.String(), `kind="invariant"} 1`) {
+		t.Errorf("Expected the flagged response to be counted:\n%s", metrics.String())
+	}
+
+	// Responses of methods without a schema are forwarded unchecked
+	e.ProcessRequest(context.Background(), requestPacket(2, methodPayload(9, 9, "x")))
+	resp = &util.BufferedPacket{Payload: []byte{0x01}, RPCID: 2, PacketType: util.PacketTypeResponse}
+	if _, verdict, _, err := e.ProcessResponse(context.Background(), resp); err != nil || verdict != util.PacketVerdictPass {
+		t.Errorf("ProcessResponse returned %v, %v for an unknown method, want a pass", verdict, err)
+	}
+}
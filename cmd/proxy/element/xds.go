@@ -0,0 +1,32 @@
+package element
+
+import (
+	"fmt"
+
+	"github.com/appnet-org/arpc/pkg/xds"
+)
+
+// ApplyXDS replaces the backends of the ring with the healthy endpoints of a cluster of an
+// xDS snapshot. It can be passed to xds.Client.Run:
+//
+//	client.Run(ctx, time.Second, func(s *xds.Snapshot) error { return c.ApplyXDS(s, "kv") })
+func (c *ConsistentHashElement) ApplyXDS(s *xds.Snapshot, cluster string) error {
+	backends, err := s.ClusterAddresses(cluster)
+	if err != nil {
+		return err
+	}
+	if len(backends) == 0 {
+		return fmt.Errorf("cluster %q has no healthy endpoints", cluster)
+	}
+	return c.SetBackends(backends)
+}
+
+// ApplyXDS replaces the shard->leader map with the routes of a route configuration of an
+// xDS snapshot (see xds.Snapshot.ShardLeaders)
+func (l *LeaderRoutingElement) ApplyXDS(s *xds.Snapshot, routeConfig string) error {
+	leaders, err := s.ShardLeaders(routeConfig)
+	if err != nil {
+		return err
+	}
+	return l.UpdateLeaders(leaders)
+}
@@ -0,0 +1,119 @@
+package element
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/appnet-org/arpc/pkg/transport/balancer/consistenthash"
+	"github.com/appnet-org/arpc/pkg/xds"
+)
+
+// lbEndpoint returns an endpoint of a load assignment
+func lbEndpoint(host string, port uint32, health string) xds.LbEndpoint {
+	return xds.LbEndpoint{
+		Endpoint:     xds.Endpoint{Address: xds.Address{SocketAddress: xds.SocketAddress{Address: host, PortValue: port}}},
+		HealthStatus: health,
+	}
+}
+
+// staticCluster returns a cluster with an inline load assignment of endpoints
+func staticCluster(name string, endpoints ...xds.LbEndpoint) *xds.Cluster {
+	return &xds.Cluster{Name: name, Type: "STATIC", LoadAssignment: &xds.ClusterLoadAssignment{
+		ClusterName: name,
+		Endpoints:   []xds.LocalityEndpoints{{LbEndpoints: endpoints}},
+	}}
+}
+
+// shardRoute returns a route of the shard to a cluster
+func shardRoute(shard, cluster string) xds.Route {
+	return xds.Route{Match: xds.RouteMatch{Path: "/" + shard}, Route: xds.RouteAction{Cluster: cluster}}
+}
+
+func TestConsistentHashElement_ApplyXDS(t *testing.T) {
+	c, err := NewConsistentHashElement(consistenthash.PublicStringField(13), []string{"10.0.0.9:9000"}, 0)
+	if err != nil {
+		t.Fatalf("NewConsistentHashElement failed: %v", err)
+	}
+	s := xds.NewSnapshot()
+	s.Clusters["kv"] = &xds.Cluster{Name: "kv", Type: "EDS"}
+	s.Endpoints["kv"] = &xds.ClusterLoadAssignment{ClusterName: "kv", Endpoints: []xds.LocalityEndpoints{{LbEndpoints: []xds.LbEndpoint{
+		lbEndpoint("10.0.0.1", 9000, "HEALTHY"),
+		lbEndpoint("10.0.0.2", 9000, ""),
+		lbEndpoint("10.0.0.3", 9000, "UNHEALTHY"),
+	}}}}
+	if err := c.ApplyXDS(s, "kv"); err != nil {
+		t.Fatalf("ApplyXDS failed: %v", err)
+	}
+	for i := range 20 {
+		p, _, _, err := c.ProcessRequest(context.Background(), requestPacket(uint64(i), stringFieldPayload(fmt.Sprintf("user-%d", i))))
+		if err != nil {
+			t.Fatalf("ProcessRequest failed: %v", err)
+		}
+		if peer := p.Peer.String(); peer != "10.0.0.1:9000" && peer != "10.0.0.2:9000" {
+			t.Errorf("Request routed to %s, want a healthy endpoint of the cluster", peer)
+		}
+	}
+
+	// Unknown clusters and clusters without healthy endpoints leave the backends unchanged
+	s.Clusters["down"] = staticCluster("down", lbEndpoint("10.0.0.4", 9000, "UNHEALTHY"))
+	s.Clusters["bad"] = staticCluster("bad", lbEndpoint("not an address", 0, ""))
+	for _, cluster := range []string{"missing", "down", "bad"} {
+		if err := c.ApplyXDS(s, cluster); err == nil {
+			t.Errorf("Expected an error applying cluster %s", cluster)
+		}
+	}
+	p, _, _, err := c.ProcessRequest(context.Background(), requestPacket(100, stringFieldPayload("user-1")))
+	if err != nil || (p.Peer.String() != "10.0.0.1:9000" && p.Peer.String() != "10.0.0.2:9000") {
+		t.Errorf("ProcessRequest routed to %v, %v after failed updates, want the previous backends", p.Peer, err)
+	}
+}
+
+func TestLeaderRoutingElement_ApplyXDS(t *testing.T) {
+	l := NewLeaderRoutingElement(consistenthash.PublicStringField(13), 0)
+	s := xds.NewSnapshot()
+	s.Clusters["shard-a"] = staticCluster("shard-a", lbEndpoint("10.0.0.3", 9000, "UNHEALTHY"), lbEndpoint("10.0.0.1", 9000, ""))
+	s.Clusters["shard-b"] = staticCluster("shard-b", lbEndpoint("10.0.0.2", 9000, "HEALTHY"))
+	s.Clusters["shard-c"] = staticCluster("shard-c", lbEndpoint("10.0.0.4", 9000, "DRAINING"))
+	s.Routes["leaders"] = &xds.RouteConfiguration{Name: "leaders", VirtualHosts: []xds.VirtualHost{{Name: "kv", Routes: []xds.Route{
+		shardRoute("a", "shard-a"),
+		shardRoute("b", "shard-b"),
+		shardRoute("c", "shard-c"),
+	}}}}
+	if err := l.ApplyXDS(s, "leaders"); err != nil {
+		t.Fatalf("ApplyXDS failed: %v", err)
+	}
+	// The shard without a healthy leader is left out
+	if got := l.Leaders(); len(got) != 2 || got["a"] != "10.0.0.1:9000" || got["b"] != "10.0.0.2:9000" {
+		t.Errorf("Leaders returned %v, want the first healthy endpoints of shards a and b", got)
+	}
+	p, _, _, err := l.ProcessRequest(context.Background(), requestPacket(1, stringFieldPayload("b")))
+	if err != nil || p.Peer.String() != "10.0.0.2:9000" {
+		t.Errorf("ProcessRequest routed to %v, %v, want the leader of shard b", p.Peer, err)
+	}
+
+	// Invalid route configurations leave the leaders unchanged
+	s.Routes["unnamed"] = &xds.RouteConfiguration{Name: "unnamed", VirtualHosts: []xds.VirtualHost{{Name: "kv", Routes: []xds.Route{
+		{Match: xds.RouteMatch{Prefix: "/"}, Route: xds.RouteAction{Cluster: "shard-a"}},
+	}}}}
+	s.Routes["dangling"] = &xds.RouteConfiguration{Name: "dangling", VirtualHosts: []xds.VirtualHost{{Name: "kv", Routes: []xds.Route{
+		shardRoute("a", "missing"),
+	}}}}
+	for _, routeConfig := range []string{"missing", "unnamed", "dangling"} {
+		if err := l.ApplyXDS(s, routeConfig); err == nil {
+			t.Errorf("Expected an error applying route configuration %s", routeConfig)
+		}
+	}
+	if got := l.Leaders(); len(got) != 2 {
+		t.Errorf("Leaders returned %v after failed updates, want the 2 previous leaders", got)
+	}
+
+	// A later snapshot replaces the map
+	s.Routes["leaders"].VirtualHosts[0].Routes = []xds.Route{shardRoute("b", "shard-a")}
+	if err := l.ApplyXDS(s, "leaders"); err != nil {
+		t.Fatalf("ApplyXDS failed: %v", err)
+	}
+	if got := l.Leaders(); len(got) != 1 || got["b"] != "10.0.0.1:9000" {
+		t.Errorf("Leaders returned %v, want only shard b led by 10.0.0.1:9000", got)
+	}
+}
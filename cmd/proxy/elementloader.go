@@ -2,15 +2,19 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"plugin"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/appnet-org/arpc/cmd/proxy/util"
+	sharedelement "github.com/appnet-org/arpc/pkg/element"
 	"github.com/appnet-org/arpc/pkg/logging"
 	"go.uber.org/zap"
 )
@@ -32,15 +36,49 @@ func GetElementPluginPrefix() string {
 }
 
 var (
-	// currentElementChain is stored in an atomic.Value for lock-free reads
-	currentElementChain  atomic.Value // *RPCElementChain
-	highestElementFile   string
-	highestElementFileMu sync.Mutex // Protects highestElementFile
-	pluginInterface      elementInit
-	pluginInterfaceMu    sync.Mutex // Protects pluginInterface
-	elementPluginPrefix  string
+	// currentElementChain holds the chain of the default loader, in an atomic.Value for lock-free reads
+	currentElementChain atomic.Value // *RPCElementChain
+	defaultLoader       = &ElementLoader{chain: &currentElementChain}
+
+	// listenerLoaders are the loaders of listeners with their own element plugins, by prefix path
+	listenerLoaders   = make(map[string]*ElementLoader)
+	listenerLoadersMu sync.Mutex
+
+	// pluginVerifier approves plugin modules before they are loaded, nil accepts all of them
+	// (see SetPluginVerifier)
+	pluginVerifier sharedelement.ModuleVerifier
+	// rejectedPlugins counts the plugin modules refused by pluginVerifier
+	rejectedPlugins atomic.Uint64
+	// requireDescriptors refuses plugin elements without a valid descriptor (see
+	// SetRequireDescriptors)
+	requireDescriptors bool
 )
 
+// SetPluginVerifier makes the element loaders load only the plugin modules accepted by
+// verifier. It must be called before InitElementLoader.
+func SetPluginVerifier(verifier sharedelement.ModuleVerifier) {
+	pluginVerifier = verifier
+}
+
+// SetRequireDescriptors makes the element loaders refuse the plugin elements that do not
+// describe themselves with a valid sharedelement.Descriptor, rather than only warn. It must
+// be called before InitElementLoader.
+func SetRequireDescriptors(require bool) {
+	requireDescriptors = require
+}
+
+// ElementLoader keeps the element chain of the highest plugin file matching a prefix up to date
+type ElementLoader struct {
+	prefix      string        // plugin prefix path, e.g. /appnet/arpc-plugins/element-
+	chain       *atomic.Value // *RPCElementChain
+	mu          sync.Mutex    // Protects highestFile, plugin, element, module and closed
+	highestFile string
+	plugin      elementInit
+	element     RPCElement            // element of the plugin, nil without one
+	module      *sharedelement.Module // module of the plugin, nil without one
+	closed      bool                  // the proxy is shutting down, see shutdownElements
+}
+
 // elementInit is the interface that element plugins must implement
 type elementInit interface {
 	Element() RPCElement
@@ -67,6 +105,10 @@ func (w *pluginElementInitWrapper) Element() RPCElement {
 	// This works because both types have the same method signatures
 	element, ok := pluginElement.(RPCElement)
 	if !ok {
+		// Elements of the shared interface work in every proxy variant
+		if shared, ok := pluginElement.(sharedelement.Element); ok {
+			return AdaptElement(shared)
+		}
 		// If direct assertion fails, try to create an adapter
 		// This handles the case where the plugin's type doesn't directly match
 		return &elementAdapter{elem: pluginElement}
@@ -115,44 +157,140 @@ func (a *elementAdapter) Name() string {
 	return "UnknownElement"
 }
 
+// pluginElementChain creates the chain of a plugin element. Elements implementing only
+// ProcessRequest or only ProcessResponse are left out of the other pipeline.
+func pluginElementChain(element RPCElement) *RPCElementChain {
+	adapter, ok := element.(*elementAdapter)
+	if !ok {
+		return NewRPCElementChain(element)
+	}
+	var request []RequestElement
+	var response []ResponseElement
+	if _, ok := adapter.elem.(interface {
+		ProcessRequest(context.Context, *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error)
+	}); ok {
+		request = append(request, adapter)
+	}
+	if _, ok := adapter.elem.(interface {
+		ProcessResponse(context.Context, *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error)
+	}); ok {
+		response = append(response, adapter)
+	}
+	return NewPipelineChain(request, response)
+}
+
 func init() {
 	// Start background goroutine to periodically check for plugin updates
 	go func() {
 		for {
-			if elementPluginPrefix != "" {
-				updateElements(elementPluginPrefix)
+			if defaultLoader.Prefix() != "" {
+				defaultLoader.update()
+			}
+			listenerLoadersMu.Lock()
+			loaders := make([]*ElementLoader, 0, len(listenerLoaders))
+			for _, loader := range listenerLoaders {
+				loaders = append(loaders, loader)
+			}
+			listenerLoadersMu.Unlock()
+			for _, loader := range loaders {
+				loader.update()
 			}
 			time.Sleep(1000 * time.Millisecond)
 		}
 	}()
 }
 
-// InitElementLoader initializes the element loader with the given plugin prefix path
+// InitElementLoader initializes the default element loader with the given plugin prefix path
 func InitElementLoader(pluginPrefixPath string) {
 	logging.Info("Initializing element loader", zap.String("pluginPrefix", pluginPrefixPath))
-	elementPluginPrefix = pluginPrefixPath
+	defaultLoader.mu.Lock()
+	defaultLoader.prefix = pluginPrefixPath
+	defaultLoader.mu.Unlock()
 	// Do an initial load
-	updateElements(pluginPrefixPath)
+	defaultLoader.update()
 }
 
-// GetElementChain returns the current element chain in a thread-safe, lock-free manner
+// GetElementChain returns the current element chain of the default loader in a thread-safe,
+// lock-free manner
 func GetElementChain() *RPCElementChain {
-	chain := currentElementChain.Load()
+	return defaultLoader.Chain()
+}
+
+// ListenerElementLoader returns the loader of the element plugins matching pluginPrefixPath,
+// for listeners that do not use the default chain. Listeners with the same prefix share a loader.
+func ListenerElementLoader(pluginPrefixPath string) *ElementLoader {
+	listenerLoadersMu.Lock()
+	loader, ok := listenerLoaders[pluginPrefixPath]
+	if !ok {
+		loader = &ElementLoader{prefix: pluginPrefixPath, chain: &atomic.Value{}}
+		listenerLoaders[pluginPrefixPath] = loader
+	}
+	listenerLoadersMu.Unlock()
+
+	if !ok {
+		logging.Info("Initializing element loader", zap.String("pluginPrefix", pluginPrefixPath))
+		loader.update()
+	}
+	return loader
+}
+
+// Prefix returns the plugin prefix path of the loader
+func (l *ElementLoader) Prefix() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.prefix
+}
+
+// Element returns the element of the loaded plugin, or nil without one
+func (l *ElementLoader) Element() RPCElement {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.element
+}
+
+// elementLoaders returns the default loader and the listener loaders
+func elementLoaders() []*ElementLoader {
+	loaders := []*ElementLoader{defaultLoader}
+	listenerLoadersMu.Lock()
+	for _, loader := range listenerLoaders {
+		loaders = append(loaders, loader)
+	}
+	listenerLoadersMu.Unlock()
+	return loaders
+}
+
+// loadedElements returns the plugin elements of the default loader and of the listener loaders
+func loadedElements() []RPCElement {
+	var elements []RPCElement
+	for _, loader := range elementLoaders() {
+		if element := loader.Element(); element != nil {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+// Chain returns the current element chain of the loader, or nil before the first load
+func (l *ElementLoader) Chain() *RPCElementChain {
+	chain := l.chain.Load()
 	if chain == nil {
 		return nil
 	}
 	return chain.(*RPCElementChain)
 }
 
-// updateElements scans the plugin directory for element plugin files and loads the highest one
-func updateElements(prefix string) {
-	highestElementFileMu.Lock()
-	currentHighest := highestElementFile
-	highestElementFileMu.Unlock()
+// update scans the plugin directory for element plugin files and loads the highest one
+func (l *ElementLoader) update() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
 
+	currentHighest := l.highestFile
 	var highestSeenElement string = currentHighest
 
-	dir, prefixName := filepath.Split(prefix)
+	dir, prefixName := filepath.Split(l.prefix)
 	if dir == "" {
 		dir = ElementPluginDir
 	}
@@ -167,15 +305,15 @@ func updateElements(prefix string) {
 			logging.Debug("Error reading element plugin directory", zap.String("dir", dir), zap.Error(err))
 		}
 		// If this is the first check and no directory exists, initialize with empty chain
-		if currentElementChain.Load() == nil {
-			currentElementChain.Store(NewRPCElementChain())
+		if l.chain.Load() == nil {
+			l.chain.Store(NewRPCElementChain())
 			logging.Debug("Initialized with empty element chain (no plugin directory)")
 		}
 		return
 	}
 
 	for _, file := range files {
-		if strings.HasPrefix(file.Name(), prefixName) {
+		if strings.HasPrefix(file.Name(), prefixName) && !strings.HasSuffix(file.Name(), sharedelement.SignatureSuffix) {
 			if file.Name() > highestSeenElement {
 				highestSeenElement = file.Name()
 			}
@@ -183,71 +321,153 @@ func updateElements(prefix string) {
 	}
 
 	if highestSeenElement != currentHighest {
-		highestElementFileMu.Lock()
-		highestElementFile = highestSeenElement
-		highestElementFileMu.Unlock()
+		l.highestFile = highestSeenElement
 
 		// If no plugin file found, create an empty chain
 		if highestSeenElement == "" {
 			logging.Debug("No element plugin found, using empty chain")
-			currentElementChain.Store(NewRPCElementChain())
-			// Kill previous plugin if it exists
-			pluginInterfaceMu.Lock()
-			if pluginInterface != nil {
-				pluginInterface.Kill()
-				pluginInterface = nil
-			}
-			pluginInterfaceMu.Unlock()
+			// The previous plugin is shut down and killed once its chain drained
+			go l.retire(NewRPCElementChain())()
 			return
 		}
 
 		pluginPath := filepath.Join(dir, highestSeenElement)
-		elementInit := loadElementPlugin(pluginPath)
+		elementInit, module := loadElementPlugin(pluginPath)
 		if elementInit != nil {
-			// Kill previous plugin if it exists
-			pluginInterfaceMu.Lock()
-			if pluginInterface != nil {
-				pluginInterface.Kill()
-			}
-			pluginInterface = elementInit
-			pluginInterfaceMu.Unlock()
-
 			// Create new chain with the element from plugin
 			element := elementInit.Element()
 			elementInit.Init()
-			if element != nil {
-				// Store atomically - this is a lock-free write
-				currentElementChain.Store(NewRPCElementChain(element))
-				logging.Info("Updated element chain from plugin",
-					zap.String("plugin", pluginPath),
-					zap.String("element", element.Name()))
-			} else {
+			if element == nil {
 				logging.Warn("Plugin returned nil element, keeping previous chain", zap.String("plugin", pluginPath))
+				elementInit.Kill()
+				return
 			}
+			descriptor, err := describeElement(element)
+			if err != nil {
+				if requireDescriptors {
+					logging.Error("Plugin element has no valid descriptor, keeping previous chain", zap.String("plugin", pluginPath), zap.Error(err))
+					elementInit.Kill()
+					return
+				}
+				logging.Warn("Plugin element has no valid descriptor", zap.String("plugin", pluginPath), zap.Error(err))
+			}
+			// Parameters pushed by the control plane apply to new plugins too
+			if config := appliedControlConfig.Load(); config != nil {
+				if err := configureElement(element, config); err != nil {
+					logging.Warn("Plugin element rejected the control plane configuration",
+						zap.String("plugin", pluginPath), zap.String("version", config.Version), zap.Error(err))
+				}
+			}
+			// The element sets up its connections and caches before its first message
+			if err := startElement(element); err != nil {
+				logging.Error("Plugin element failed to start, keeping previous chain", zap.String("plugin", pluginPath), zap.Error(err))
+				elementInit.Kill()
+				return
+			}
+			// Store atomically - this is a lock-free write. The previous plugin is shut down
+			// and killed once its chain drained.
+			retire := l.retire(pluginElementChain(element))
+			l.plugin = elementInit
+			l.element = element
+			l.module = module
+			go retire()
+			logging.Info("Updated element chain from plugin",
+				zap.String("plugin", pluginPath),
+				zap.String("digest", module.Digest),
+				zap.String("element", element.Name()),
+				zap.String("version", descriptor.Version))
 		} else {
 			// Plugin loading failed, keep previous chain (or initialize empty if first load)
-			if currentElementChain.Load() == nil {
-				currentElementChain.Store(NewRPCElementChain())
+			if l.chain.Load() == nil {
+				l.chain.Store(NewRPCElementChain())
 				logging.Debug("Initialized with empty element chain (plugin load failed)")
 			}
 		}
 	}
 }
 
-// loadElementPlugin loads an element plugin from the specified path
-func loadElementPlugin(elementPluginPath string) elementInit {
+// writePluginMetrics writes the module of the plugin of each loader, and the number of
+// modules rejected by the plugin verifier, in the Prometheus text exposition format
+func writePluginMetrics(w io.Writer) (int64, error) {
+	var series []string
+	for _, loader := range elementLoaders() {
+		loader.mu.Lock()
+		if module := loader.module; module != nil {
+			series = append(series, fmt.Sprintf(`arpc_proxy_element_plugin_info{prefix="%s",plugin="%s",digest="%s",verified="%t"} 1`,
+				labelValueEscaper.Replace(loader.prefix), labelValueEscaper.Replace(filepath.Base(module.Path)), module.Digest, module.Verified))
+		}
+		loader.mu.Unlock()
+	}
+	sort.Strings(series)
+
+	var b strings.Builder
+	b.WriteString("# HELP arpc_proxy_element_plugin_info Element plugin module loaded for each plugin prefix.\n")
+	b.WriteString("# TYPE arpc_proxy_element_plugin_info gauge\n")
+	for _, s := range series {
+		b.WriteString(s + "\n")
+	}
+	fmt.Fprintf(&b, "# HELP arpc_proxy_element_plugins_rejected_total Total number of element plugin modules rejected by signature verification.\n"+
+		"# TYPE arpc_proxy_element_plugins_rejected_total counter\narpc_proxy_element_plugins_rejected_total %d\n", rejectedPlugins.Load())
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// MetricsElement is implemented by elements exporting metrics of their own, which the proxy
+// serves with its metrics
+type MetricsElement interface {
+	WriteMetrics(w io.Writer) (int64, error)
+}
+
+// writeElementMetrics writes the metrics of the plugin elements of each loader
+func writeElementMetrics(w io.Writer) (int64, error) {
+	var total int64
+	for _, element := range loadedElements() {
+		exporter, ok := unwrapElement(element).(MetricsElement)
+		if !ok {
+			continue
+		}
+		n, err := exporter.WriteMetrics(w)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// loadElementPlugin loads an element plugin from the specified path, once pluginVerifier
+// accepted its module
+func loadElementPlugin(elementPluginPath string) (elementInit, *sharedelement.Module) {
 	logging.Info("Loading element plugin", zap.String("path", elementPluginPath))
 
-	elementPlugin, err := plugin.Open(elementPluginPath)
+	module, err := sharedelement.ReadModule(elementPluginPath, pluginVerifier)
+	if err != nil {
+		if module != nil {
+			rejectedPlugins.Add(1)
+			logging.Error("Element plugin rejected by signature verification", zap.String("path", elementPluginPath),
+				zap.String("digest", module.Digest), zap.Error(err))
+		} else {
+			logging.Error("Error reading element plugin", zap.String("path", elementPluginPath), zap.Error(err))
+		}
+		return nil, nil
+	}
+	loadPath, remove, err := module.LoadPath()
+	if err != nil {
+		logging.Error("Error copying verified element plugin", zap.String("path", elementPluginPath), zap.Error(err))
+		return nil, nil
+	}
+	defer remove()
+
+	elementPlugin, err := plugin.Open(loadPath)
 	if err != nil {
 		logging.Error("Error loading element plugin", zap.String("path", elementPluginPath), zap.Error(err))
-		return nil
+		return nil, nil
 	}
 
 	symElementInit, err := elementPlugin.Lookup("ElementInit")
 	if err != nil {
 		logging.Error("Error locating ElementInit symbol in plugin", zap.String("path", elementPluginPath), zap.Error(err))
-		return nil
+		return nil, nil
 	}
 
 	// Use interface{} and type assertion with a wrapper
@@ -268,7 +488,7 @@ func loadElementPlugin(elementPluginPath string) elementInit {
 	})
 	if !ok {
 		logging.Error("Error casting ElementInit from plugin - plugin must export ElementInit with Element() and Kill() methods", zap.String("path", elementPluginPath))
-		return nil
+		return nil, nil
 	}
 
 	// Create a wrapper that adapts the plugin's elementInit to our elementInit interface
@@ -276,6 +496,7 @@ func loadElementPlugin(elementPluginPath string) elementInit {
 		pluginInit: pluginInit,
 	}
 
-	logging.Info("Successfully loaded element plugin", zap.String("path", elementPluginPath))
-	return wrapper
+	logging.Info("Successfully loaded element plugin", zap.String("path", elementPluginPath),
+		zap.String("digest", module.Digest), zap.Bool("verified", module.Verified))
+	return wrapper, module
 }
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/otlp"
+	"github.com/appnet-org/arpc/pkg/packet"
+	"go.uber.org/zap"
+)
+
+// EventFormat selects the encoding of RPC summary events
+type EventFormat string
+
+const (
+	// EventFormatJSON writes each event as a JSON object
+	EventFormatJSON EventFormat = "json"
+	// EventFormatBinary writes each event as a fixed-size little-endian record (see RPCEvent.AppendBinary)
+	EventFormatBinary EventFormat = "binary"
+)
+
+// ParseEventFormat parses the value of EVENT_FORMAT
+func ParseEventFormat(s string) (EventFormat, error) {
+	switch format := EventFormat(strings.ToLower(strings.TrimSpace(s))); format {
+	case EventFormatJSON, EventFormatBinary:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown event format %q (want json or binary)", s)
+}
+
+// EventOutcome tells how an RPC completed
+type EventOutcome uint8
+
+const (
+	// EventOutcomeResponse means the response was forwarded to the client
+	EventOutcomeResponse EventOutcome = 1
+	// EventOutcomeError means the server (or a proxy on the path) returned an error packet
+	EventOutcomeError EventOutcome = 2
+	// EventOutcomeDropped means an element dropped the request or the response
+	EventOutcomeDropped EventOutcome = 3
+	// EventOutcomeTimeout means no response was seen within the buffer timeout
+	EventOutcomeTimeout EventOutcome = 4
+	// EventOutcomeLocalReply means an element answered the request in place of the server
+	EventOutcomeLocalReply EventOutcome = 5
+)
+
+// String returns the name of the outcome
+func (o EventOutcome) String() string {
+	switch o {
+	case EventOutcomeResponse:
+		return "response"
+	case EventOutcomeError:
+		return "error"
+	case EventOutcomeDropped:
+		return "dropped"
+	case EventOutcomeTimeout:
+		return "timeout"
+	case EventOutcomeLocalReply:
+		return "local_reply"
+	}
+	return "unknown"
+}
+
+// MarshalJSON encodes the outcome by name
+func (o EventOutcome) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.String())
+}
+
+// eventVerdict encodes a verdict by name in JSON, omitting Unknown (no verdict)
+type eventVerdict util.PacketVerdict
+
+// MarshalJSON encodes the verdict as "pass", "drop" or ""
+func (v eventVerdict) MarshalJSON() ([]byte, error) {
+	switch util.PacketVerdict(v) {
+	case util.PacketVerdictPass:
+		return []byte(`"pass"`), nil
+	case util.PacketVerdictDrop:
+		return []byte(`"drop"`), nil
+	}
+	return []byte(`""`), nil
+}
+
+// eventDropReason encodes a drop reason by name in JSON
+type eventDropReason packet.DropReason
+
+// MarshalJSON encodes the reason by name, e.g. "rate_limited"
+func (r eventDropReason) MarshalJSON() ([]byte, error) {
+	return json.Marshal(packet.DropReason(r).String())
+}
+
+// RPCEvent summarizes one RPC as seen by the proxy. Sizes are those of the public segments
+// the element chain saw; latency is measured from receiving the request to receiving the
+// response (or error).
+type RPCEvent struct {
+	RPCID           uint64       `json:"rpcID"`
+	ServiceID       uint32       `json:"serviceID"`
+	MethodID        uint32       `json:"methodID"`
+	Client          *net.UDPAddr `json:"-"`
+	Server          *net.UDPAddr `json:"-"`
+	ClientAddr      string       `json:"client"`
+	ServerAddr      string       `json:"server"`
+	Start           time.Time    `json:"-"`
+	StartUnixNano   int64        `json:"startUnixNano"`
+	LatencyNanos    int64        `json:"latencyNanos"`
+	RequestBytes    uint32       `json:"requestBytes"`
+	ResponseBytes   uint32       `json:"responseBytes"`
+	RequestPackets  uint16       `json:"requestPackets"`
+	ResponsePackets uint16       `json:"responsePackets"`
+	RequestVerdict  eventVerdict `json:"requestVerdict"`
+	ResponseVerdict eventVerdict `json:"responseVerdict"`
+	Outcome         EventOutcome `json:"outcome"`
+	// Why the RPC was dropped or failed, omitted if no reason was given
+	DropReason eventDropReason `json:"dropReason,omitempty"`
+	// Origin of the request and hops it took to reach the proxy, omitted for requests
+	// without an origin
+	OriginID uint64 `json:"originID,omitempty"`
+	Hops     uint8  `json:"hops,omitempty"`
+}
+
+// eventVersion is the first byte of binary events, bumped on layout changes
+const eventVersion = 3
+
+// binaryEventSize is the size of a binary event
+const binaryEventSize = 94
+
+// AppendBinary appends the binary encoding of the event to buf. The layout (little endian) is:
+//
+//	version u8 | outcome u8 | request verdict u8 | response verdict u8 | rpcID u64 |
+//	serviceID u32 | methodID u32 | start unix ns i64 | latency ns i64 |
+//	request bytes u32 | response bytes u32 | request packets u16 | response packets u16 |
+//	client IPv6-mapped IP [16] | client port u16 | server IP [16] | server port u16 |
+//	drop reason u8 | originID u64 | hops u8
+func (e *RPCEvent) AppendBinary(buf []byte) []byte {
+	buf = append(buf, eventVersion, byte(e.Outcome), byte(e.RequestVerdict), byte(e.ResponseVerdict))
+	buf = binary.LittleEndian.AppendUint64(buf, e.RPCID)
+	buf = binary.LittleEndian.AppendUint32(buf, e.ServiceID)
+	buf = binary.LittleEndian.AppendUint32(buf, e.MethodID)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(e.StartUnixNano))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(e.LatencyNanos))
+	buf = binary.LittleEndian.AppendUint32(buf, e.RequestBytes)
+	buf = binary.LittleEndian.AppendUint32(buf, e.ResponseBytes)
+	buf = binary.LittleEndian.AppendUint16(buf, e.RequestPackets)
+	buf = binary.LittleEndian.AppendUint16(buf, e.ResponsePackets)
+	buf = appendEventAddr(buf, e.Client)
+	buf = appendEventAddr(buf, e.Server)
+	buf = append(buf, byte(e.DropReason))
+	buf = binary.LittleEndian.AppendUint64(buf, e.OriginID)
+	return append(buf, e.Hops)
+}
+
+// Span returns the event as an OTLP span of the proxy. Proxies do not propagate a trace
+// context, so the span is a root span joined to the client span by the arpc.rpc_id attribute.
+func (e *RPCEvent) Span() otlp.Span {
+	span := otlp.Span{
+		TraceID: otlp.NewTraceID(),
+		SpanID:  otlp.NewSpanID(),
+		Name:    "arpc.proxy",
+		Kind:    otlp.SpanKindServer,
+		Start:   e.Start,
+		End:     e.Start.Add(time.Duration(e.LatencyNanos)),
+		Attributes: []otlp.Attribute{
+			{Key: "rpc.system", Value: "arpc"},
+			{Key: "arpc.rpc_id", Value: e.RPCID},
+			{Key: "arpc.service_id", Value: e.ServiceID},
+			{Key: "arpc.method_id", Value: e.MethodID},
+			{Key: "client.address", Value: e.ClientAddr},
+			{Key: "server.address", Value: e.ServerAddr},
+			{Key: "arpc.request.bytes", Value: e.RequestBytes},
+			{Key: "arpc.request.packets", Value: e.RequestPackets},
+			{Key: "arpc.response.bytes", Value: e.ResponseBytes},
+			{Key: "arpc.response.packets", Value: e.ResponsePackets},
+			{Key: "arpc.outcome", Value: e.Outcome.String()},
+		},
+	}
+	if e.DropReason != 0 {
+		span.Attributes = append(span.Attributes, otlp.Attribute{Key: "arpc.drop_reason", Value: packet.DropReason(e.DropReason).String()})
+	}
+	if e.OriginID != 0 {
+		span.Attributes = append(span.Attributes,
+			otlp.Attribute{Key: "arpc.origin_id", Value: e.OriginID},
+			otlp.Attribute{Key: "arpc.hops", Value: e.Hops})
+	}
+	if e.Outcome != EventOutcomeResponse && e.Outcome != EventOutcomeLocalReply {
+		span.Error = e.Outcome.String()
+	}
+	return span
+}
+
+// eventOrigin returns the origin of a request, zero for requests without one
+func eventOrigin(exts []packet.Extension) packet.Origin {
+	origin, _ := packet.FindOrigin(exts)
+	return origin
+}
+
+// appendEventAddr appends a 16-byte IP and a port, all zero for a nil address
+func appendEventAddr(buf []byte, addr *net.UDPAddr) []byte {
+	var ip [16]byte
+	var port uint16
+	if addr != nil {
+		if ip16 := addr.IP.To16(); ip16 != nil {
+			copy(ip[:], ip16)
+		}
+		port = uint16(addr.Port)
+	}
+	buf = append(buf, ip[:]...)
+	return binary.LittleEndian.AppendUint16(buf, port)
+}
+
+// EventLog writes a summary event per completed RPC to a UDP or Unix datagram socket, one
+// event per datagram, so collectors can consume data-plane telemetry without scraping, and
+// records it as a span with an OTLP exporter.
+// Events are written by a background goroutine; when the socket cannot keep up, events are
+// dropped rather than slowing down packet processing.
+type EventLog struct {
+	format   EventFormat
+	timeout  time.Duration  // requests without a response are reported as timed out after this long
+	conn     net.Conn       // nil if events are only exported as spans
+	exporter *otlp.Exporter // nil if spans are not exported
+	events   chan *RPCEvent
+	done     chan struct{}
+	dropped  atomic.Uint64
+
+	mu        sync.Mutex
+	pending   map[uint64]*RPCEvent // rpcID -> event of an RPC whose response has not been seen
+	lastPrune time.Time
+}
+
+// eventQueueSize is the number of events buffered before new ones are dropped
+const eventQueueSize = 4096
+
+// NewEventLog creates an event log writing to target, "udp://host:port" or "unix:///path"
+// (a Unix datagram socket), and recording spans with exporter if not nil. Either may be
+// empty, but not both.
+func NewEventLog(target string, format EventFormat, timeout time.Duration, exporter *otlp.Exporter) (*EventLog, error) {
+	if target == "" {
+		if exporter == nil {
+			return nil, errors.New("event log without event socket or span exporter")
+		}
+		return newEventLog(nil, exporter, format, timeout), nil
+	}
+	network, addr, ok := strings.Cut(target, "://")
+	if !ok || addr == "" {
+		return nil, fmt.Errorf("invalid event socket %q (want udp://host:port or unix:///path)", target)
+	}
+	switch network {
+	case "udp":
+	case "unix":
+		network = "unixgram"
+	default:
+		return nil, fmt.Errorf("unsupported event socket network %q (want udp or unix)", network)
+	}
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect event socket %s: %w", target, err)
+	}
+	return newEventLog(conn, exporter, format, timeout), nil
+}
+
+func newEventLog(conn net.Conn, exporter *otlp.Exporter, format EventFormat, timeout time.Duration) *EventLog {
+	l := &EventLog{
+		format:   format,
+		timeout:  timeout,
+		conn:     conn,
+		exporter: exporter,
+		events:   make(chan *RPCEvent, eventQueueSize),
+		done:     make(chan struct{}),
+		pending:  make(map[uint64]*RPCEvent),
+	}
+	go l.run()
+	return l
+}
+
+// RecordRequest remembers the request side of an RPC after the element chain processed it.
+// A dropped request completes the RPC right away, with the reason it was dropped for.
+func (l *EventLog) RecordRequest(packet *util.BufferedPacket, verdict util.PacketVerdict, reason packet.DropReason, recvTime time.Time) {
+	serviceID, methodID := methodIDs(packet.Payload)
+	event := RPCEvent{
+		RPCID:          packet.RPCID,
+		ServiceID:      serviceID,
+		MethodID:       methodID,
+		Client:         packet.Source,
+		Server:         packet.Peer,
+		Start:          recvTime,
+		RequestBytes:   uint32(len(packet.Payload)),
+		RequestPackets: packet.TotalPackets,
+		RequestVerdict: eventVerdict(verdict),
+	}
+	origin := eventOrigin(packet.Extensions)
+	event.OriginID, event.Hops = origin.ID, origin.Hops
+	if verdict == util.PacketVerdictDrop {
+		event.Outcome = EventOutcomeDropped
+		event.DropReason = eventDropReason(reason)
+		l.emit(&event, recvTime)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending[packet.RPCID] = &event
+
+	// Prune at most once per second to keep the request path cheap
+	if recvTime.Sub(l.lastPrune) < time.Second {
+		return
+	}
+	l.lastPrune = recvTime
+	for rpcID, pending := range l.pending {
+		if recvTime.Sub(pending.Start) > l.timeout {
+			delete(l.pending, rpcID)
+			pending.Outcome = EventOutcomeTimeout
+			l.emit(pending, recvTime)
+		}
+	}
+}
+
+// RecordLocalReply reports an RPC whose request an element answered with reply, which
+// completes it right away
+func (l *EventLog) RecordLocalReply(packet *util.BufferedPacket, reply *util.LocalReply, recvTime time.Time) {
+	serviceID, methodID := methodIDs(packet.Payload)
+	origin := eventOrigin(packet.Extensions)
+	l.emit(&RPCEvent{
+		RPCID:          packet.RPCID,
+		ServiceID:      serviceID,
+		MethodID:       methodID,
+		Client:         packet.Source,
+		Server:         packet.Peer,
+		Start:          recvTime,
+		RequestBytes:   uint32(len(packet.Payload)),
+		ResponseBytes:  uint32(len(reply.Payload)),
+		RequestPackets: packet.TotalPackets,
+		RequestVerdict: eventVerdict(util.PacketVerdictPass),
+		Outcome:        EventOutcomeLocalReply,
+		OriginID:       origin.ID,
+		Hops:           origin.Hops,
+	}, time.Now())
+}
+
+// RecordResponse completes an RPC with the response processed by the element chain, and the
+// reason it was dropped for
+func (l *EventLog) RecordResponse(packet *util.BufferedPacket, verdict util.PacketVerdict, reason packet.DropReason, recvTime time.Time) {
+	event := l.take(packet.RPCID)
+	if event == nil {
+		return
+	}
+	event.ResponseBytes = uint32(len(packet.Payload))
+	event.ResponsePackets = packet.TotalPackets
+	event.ResponseVerdict = eventVerdict(verdict)
+	event.Outcome = EventOutcomeResponse
+	if verdict == util.PacketVerdictDrop {
+		event.Outcome = EventOutcomeDropped
+		event.DropReason = eventDropReason(reason)
+	}
+	l.emit(event, recvTime)
+}
+
+// RecordError completes an RPC with an error packet, and the drop reason it carries
+func (l *EventLog) RecordError(packet *util.BufferedPacket, recvTime time.Time) {
+	event := l.take(packet.RPCID)
+	if event == nil {
+		return
+	}
+	event.ResponseBytes = uint32(len(packet.Payload))
+	event.ResponsePackets = 1
+	event.Outcome = EventOutcomeError
+	event.DropReason = eventDropReason(packet.DropReason)
+	l.emit(event, recvTime)
+}
+
+// take removes and returns the pending event of an RPC, nil if there is none
+func (l *EventLog) take(rpcID uint64) *RPCEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	event := l.pending[rpcID]
+	delete(l.pending, rpcID)
+	return event
+}
+
+// emit completes the event and queues it for writing, dropping it if the queue is full
+func (l *EventLog) emit(event *RPCEvent, end time.Time) {
+	event.StartUnixNano = event.Start.UnixNano()
+	event.LatencyNanos = int64(end.Sub(event.Start))
+	if event.Client != nil {
+		event.ClientAddr = event.Client.String()
+	}
+	if event.Server != nil {
+		event.ServerAddr = event.Server.String()
+	}
+	select {
+	case l.events <- event:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of events dropped because the socket could not keep up
+func (l *EventLog) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+// Close stops writing events and closes the socket. Queued events are discarded.
+func (l *EventLog) Close() error {
+	close(l.done)
+	if l.conn == nil {
+		return nil
+	}
+	return l.conn.Close()
+}
+
+func (l *EventLog) run() {
+	buf := make([]byte, 0, binaryEventSize)
+	for {
+		select {
+		case event := <-l.events:
+			if l.exporter != nil {
+				l.exporter.RecordSpan(event.Span())
+			}
+			if l.conn == nil {
+				continue
+			}
+			var data []byte
+			if l.format == EventFormatBinary {
+				buf = event.AppendBinary(buf[:0])
+				data = buf
+			} else {
+				var err error
+				if data, err = json.Marshal(event); err != nil {
+					logging.Error("Failed to encode RPC event", zap.Error(err))
+					continue
+				}
+			}
+			if _, err := l.conn.Write(data); err != nil {
+				// Collectors come and go; count the event as dropped rather than logging each one
+				l.dropped.Add(1)
+				logging.Debug("Failed to write RPC event", zap.Uint64("rpcID", event.RPCID), zap.Error(err))
+			}
+		case <-l.done:
+			return
+		}
+	}
+}
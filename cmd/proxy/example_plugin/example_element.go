@@ -11,6 +11,7 @@ import (
 	"context"
 
 	"github.com/appnet-org/arpc/cmd/proxy/util"
+	sharedelement "github.com/appnet-org/arpc/pkg/element"
 	"github.com/appnet-org/arpc/pkg/logging"
 	"go.uber.org/zap"
 )
@@ -59,6 +60,17 @@ func (e *ExampleElement) Name() string {
 	return e.name
 }
 
+// Describe returns the descriptor of this element, which the proxy lists on GET /elements of
+// its admin server
+func (e *ExampleElement) Describe() sharedelement.Descriptor {
+	return sharedelement.Descriptor{
+		Name:        e.name,
+		Version:     "v1",
+		Description: "Logs requests and responses",
+		Payload:     sharedelement.PayloadNone,
+	}
+}
+
 // RPCElement is the interface that elements must implement
 // NOTE: This must match the interface defined in cmd/proxy/element.go
 // For proper type sharing, consider moving RPCElement to a shared package
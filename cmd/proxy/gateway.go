@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+)
+
+// GatewayRoute sends requests to the private addresses of a remote cluster through the
+// gateway of that cluster
+type GatewayRoute struct {
+	Remote  *net.IPNet   // private network of the remote cluster
+	Gateway *net.UDPAddr // gateway of the remote cluster, reachable from this one
+}
+
+// String formats the route in the syntax of ParseGatewayRoutes
+func (r GatewayRoute) String() string {
+	return r.Remote.String() + "=" + r.Gateway.String()
+}
+
+// ParseGatewayRoutes parses a comma-separated list of routes, each of the form
+//
+//	network=gatewayIP:gatewayPort
+//
+// where network is an IPv4 address or CIDR. The first matching route applies, e.g.
+//
+//	10.1.0.0/16=203.0.113.7:15010,10.2.0.0/16=198.51.100.4:15010
+func ParseGatewayRoutes(spec string) ([]GatewayRoute, error) {
+	var routes []GatewayRoute
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		network, gateway, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid gateway route %q: expected network=gatewayIP:gatewayPort", entry)
+		}
+
+		network = strings.TrimSpace(network)
+		if !strings.Contains(network, "/") {
+			network += "/32"
+		}
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil || ipNet.IP.To4() == nil {
+			return nil, fmt.Errorf("invalid gateway route %q: invalid IPv4 network %q", entry, network)
+		}
+		addr, err := net.ResolveUDPAddr("udp4", strings.TrimSpace(gateway))
+		if err != nil || addr.IP.To4() == nil || addr.Port == 0 {
+			return nil, fmt.Errorf("invalid gateway route %q: invalid gateway %q", entry, gateway)
+		}
+		routes = append(routes, GatewayRoute{Remote: ipNet, Gateway: addr})
+	}
+	return routes, nil
+}
+
+// Gateway connects the clients of this cluster to servers of remote clusters without flat
+// networking. A request to a remote private address is sent to the gateway of its cluster,
+// with its header source (a private address of this cluster) translated to the address of
+// this gateway, which remote clusters can reach. Responses arriving at that address are
+// translated back to the client of the request, kept in a table by RPC ID.
+//
+// The serving side needs nothing more: its proxy forwards the request to the private
+// address in the header, and the response to the header source, this gateway.
+type Gateway struct {
+	address *net.UDPAddr // of this gateway, as seen from remote clusters
+	routes  []GatewayRoute
+	timeout time.Duration // translations are forgotten after this long
+
+	mu           sync.Mutex
+	translations map[uint64]originalSource // rpcID -> client before translation
+	lastPrune    time.Time
+}
+
+// NewGateway creates a gateway reachable at address for the given routes. address must be
+// a listener of this proxy, since the translations are kept in memory.
+func NewGateway(address *net.UDPAddr, routes []GatewayRoute, timeout time.Duration) *Gateway {
+	return &Gateway{
+		address:      address,
+		routes:       routes,
+		timeout:      timeout,
+		translations: make(map[uint64]originalSource),
+	}
+}
+
+// TranslateRequest sends a request to a remote private address on to the gateway of its
+// cluster, translating its header source to the address of this gateway. It reports whether
+// the request was translated.
+func (g *Gateway) TranslateRequest(p *util.BufferedPacket) bool {
+	if p.PacketType != util.PacketTypeRequest {
+		return false
+	}
+	for _, route := range g.routes {
+		if !route.Remote.Contains(net.IP(p.DstIP[:])) {
+			continue
+		}
+		var address [4]byte
+		copy(address[:], g.address.IP.To4())
+		if p.SrcIP != address || p.SrcPort != uint16(g.address.Port) {
+			now := time.Now()
+			g.mu.Lock()
+			g.prune(now)
+			g.translations[p.RPCID] = originalSource{ip: p.SrcIP, port: p.SrcPort, seen: now}
+			g.mu.Unlock()
+			p.SrcIP, p.SrcPort = address, uint16(g.address.Port)
+		} // else a fragment of a request already translated
+
+		p.Peer = route.Gateway
+		return true
+	}
+	return false
+}
+
+// RestoreResponse translates the destination of a response or error packet addressed to
+// this gateway back to the client of its request. It reports whether the packet was
+// translated.
+func (g *Gateway) RestoreResponse(p *util.BufferedPacket) bool {
+	if p.PacketType != util.PacketTypeResponse && p.PacketType != util.PacketTypeError {
+		return false
+	}
+	if !g.address.IP.To4().Equal(net.IP(p.DstIP[:])) || g.address.Port != int(p.DstPort) {
+		return false
+	}
+
+	g.mu.Lock()
+	original, ok := g.translations[p.RPCID]
+	g.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	p.DstIP, p.DstPort = original.ip, original.port
+	p.Peer = &net.UDPAddr{IP: net.IP(original.ip[:]), Port: int(original.port)}
+	return true
+}
+
+// prune forgets requests whose response never came. It runs at most once per second.
+func (g *Gateway) prune(now time.Time) {
+	if now.Sub(g.lastPrune) < time.Second {
+		return
+	}
+	g.lastPrune = now
+	for rpcID, original := range g.translations {
+		if now.Sub(original.seen) > g.timeout {
+			delete(g.translations, rpcID)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"net"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/transport"
+	"go.uber.org/zap"
+)
+
+// handleICMPErrors drains the error queue of a listener socket after a failed read. For each
+// forwarded request whose destination is unreachable, it sends an error packet to the client,
+// so that the call fails fast with an unavailable error instead of timing out. For each
+// response or error packet whose client is unreachable, e.g. since it closed its socket, the
+// RPCs of the client are aborted (see RPCAborts). It returns the number of errors read.
+func handleICMPErrors(ctx context.Context, conn *net.UDPConn, state *ProxyState) int {
+	icmpErrors, err := transport.ReadICMPErrors(conn)
+	if err != nil {
+		logging.Debug("Failed to read socket error queue", zap.Error(err))
+	}
+	for _, icmpErr := range icmpErrors {
+		if client, rpcID, ok := unreachableClient(icmpErr); ok {
+			if state.aborts != nil {
+				state.aborts.Abort(state.packetBuffer, elementChainFor(ctx), client, rpcID, icmpErr)
+			}
+			continue
+		}
+		dest, errorPacket, ok := unavailableErrorPacket(icmpErr, state)
+		if !ok {
+			logging.Debug("Ignoring ICMP error", zap.Error(icmpErr))
+			continue
+		}
+		if err := util.SendErrorPacket(conn, dest, errorPacket.RPCID, errorPacket.ErrorMsg, errorPacket.DstIP, errorPacket.DstPort, errorPacket.SrcIP, errorPacket.SrcPort, packet.RetryHint{}, errorPacket.DropReason); err != nil {
+			logging.Error("Failed to send unavailable error packet", zap.Uint64("rpcID", errorPacket.RPCID), zap.Error(err))
+			continue
+		}
+		logging.Debug("Reported unreachable destination to client",
+			zap.Uint64("rpcID", errorPacket.RPCID),
+			zap.String("client", dest.String()),
+			zap.Error(icmpErr))
+	}
+	return len(icmpErrors)
+}
+
+// unavailableErrorPacket returns the error packet to send, and where to send it, for an ICMP
+// error of a forwarded request. ok is false if the error is not an unreachable error or does
+// not quote the header of a request.
+func unavailableErrorPacket(icmpErr *transport.ICMPError, state *ProxyState) (*net.UDPAddr, *packet.ErrorPacket, bool) {
+	if !icmpErr.Unreachable() {
+		return nil, nil, false
+	}
+	rpcID, packetTypeID, dstIP, dstPort, srcIP, srcPort, ok := icmpErr.QuotedHeader()
+	if !ok || packetTypeID != packet.PacketTypeRequest.TypeID {
+		return nil, nil, false
+	}
+
+	// The error goes back the way the response would: to the request's source, restored
+	// if the request was rewritten (see ResponseRewriter)
+	errorPacket := &util.BufferedPacket{
+		PacketType: util.PacketTypeError,
+		RPCID:      rpcID,
+		DstIP:      srcIP,
+		DstPort:    srcPort,
+		SrcIP:      dstIP,
+		SrcPort:    dstPort,
+	}
+	if state.rewriter != nil {
+		state.rewriter.RestoreResponse(errorPacket)
+	}
+
+	return &net.UDPAddr{IP: net.IP(errorPacket.DstIP[:]), Port: int(errorPacket.DstPort)}, &packet.ErrorPacket{
+		PacketTypeID: packet.PacketTypeError.TypeID,
+		RPCID:        rpcID,
+		DstIP:        errorPacket.DstIP,
+		DstPort:      errorPacket.DstPort,
+		SrcIP:        errorPacket.SrcIP,
+		SrcPort:      errorPacket.SrcPort,
+		ErrorMsg:     transport.UnavailableErrorPrefix + icmpErr.Error(),
+		DropReason:   packet.DropReasonUnavailable,
+	}, true
+}
+
+// unreachableClient returns the client, and the RPC ID, of a response or error packet an ICMP
+// unreachable error was received for: the destination of the datagram, or of its header if
+// the error does not give it
+func unreachableClient(icmpErr *transport.ICMPError) (*net.UDPAddr, uint64, bool) {
+	if !icmpErr.Unreachable() {
+		return nil, 0, false
+	}
+	rpcID, packetTypeID, dstIP, dstPort, _, _, ok := icmpErr.QuotedHeader()
+	if !ok || (packetTypeID != packet.PacketTypeResponse.TypeID && packetTypeID != packet.PacketTypeError.TypeID) {
+		return nil, 0, false
+	}
+	if icmpErr.Dst != nil && icmpErr.Dst.IP.To4() != nil {
+		return icmpErr.Dst, rpcID, true
+	}
+	if dstPort == 0 {
+		return nil, 0, false // error packets quote no addresses
+	}
+	return &net.UDPAddr{IP: net.IP(dstIP[:]), Port: int(dstPort)}, rpcID, true
+}
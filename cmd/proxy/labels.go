@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/schema"
+)
+
+// LabelSource is where the value of a metric label is read from
+type LabelSource string
+
+const (
+	// LabelSourceClient labels RPCs with the IP address of the client
+	LabelSourceClient LabelSource = "client"
+	// LabelSourceUserAgent labels RPCs with the user agent extension of the request
+	LabelSourceUserAgent LabelSource = "user_agent"
+	// LabelSourceField labels RPCs with a field of the public segment of the request, decoded
+	// with schema.Global
+	LabelSourceField LabelSource = "field"
+)
+
+// OverflowLabelValue replaces the values of a label that are not allowed or over its limit,
+// so they are counted together rather than each in its own series
+const OverflowLabelValue = "other"
+
+// Defaults of the cardinality limits of labeled metrics
+const (
+	DefaultMetricLabelLimit  = 100
+	DefaultMetricSeriesLimit = 1000
+)
+
+// MetricLabel is a label of the per-RPC metrics and where its value comes from
+type MetricLabel struct {
+	Name   string
+	Source LabelSource
+	Field  string // name of the request field, with LabelSourceField
+	// Allow lists the values kept as is, others are counted as OverflowLabelValue (empty
+	// keeps any value, up to the limit of distinct values)
+	Allow []string
+}
+
+// String formats the label in the syntax of ParseMetricLabels
+func (l MetricLabel) String() string {
+	s := l.Name + "=" + string(l.Source)
+	if l.Source == LabelSourceField {
+		s += ":" + l.Field
+	}
+	if len(l.Allow) > 0 {
+		s += "=" + strings.Join(l.Allow, "|")
+	}
+	return s
+}
+
+// value returns the value of the label for a request, decoding its public segment at most
+// once for all field labels
+func (l MetricLabel) value(request *util.BufferedPacket, decoded **schema.DynamicMessage) string {
+	switch l.Source {
+	case LabelSourceClient:
+		if request.Source != nil {
+			return request.Source.IP.String()
+		}
+	case LabelSourceUserAgent:
+		if agent, ok := packet.FindExtension(request.Extensions, packet.ExtensionUserAgent); ok {
+			return string(agent)
+		}
+	case LabelSourceField:
+		if *decoded == nil {
+			message, err := schema.Global.DecodeRequest(request.Payload)
+			if err != nil {
+				return ""
+			}
+			*decoded = message
+		}
+		if v, ok := (*decoded).Get(l.Field); ok {
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+// ParseMetricLabels parses a comma-separated list of labels, each of the form
+//
+//	name=source[=value|value...]
+//
+// where source is client, user_agent or field:<name>, and the optional values are the
+// allow-list of the label, e.g.
+//
+//	tenant=field:tenant_id=acme|globex,agent=user_agent
+func ParseMetricLabels(spec string) ([]MetricLabel, error) {
+	var labels []MetricLabel
+	names := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 3)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid metric label %q: expected name=source[=value|value...]", entry)
+		}
+		label := MetricLabel{Name: strings.TrimSpace(parts[0])}
+		if !validLabelName(label.Name) {
+			return nil, fmt.Errorf("invalid metric label %q: invalid name %q", entry, label.Name)
+		}
+		if names[label.Name] {
+			return nil, fmt.Errorf("invalid metric label %q: duplicate name %q", entry, label.Name)
+		}
+		names[label.Name] = true
+
+		source, field, _ := strings.Cut(strings.TrimSpace(parts[1]), ":")
+		switch label.Source = LabelSource(source); label.Source {
+		case LabelSourceClient, LabelSourceUserAgent:
+		case LabelSourceField:
+			if label.Field = strings.TrimSpace(field); label.Field == "" {
+				return nil, fmt.Errorf("invalid metric label %q: expected field:<name>", entry)
+			}
+		default:
+			return nil, fmt.Errorf("invalid metric label %q: unknown source %q (want client, user_agent or field:<name>)", entry, source)
+		}
+
+		if len(parts) == 3 {
+			for _, value := range strings.Split(parts[2], "|") {
+				if value = strings.TrimSpace(value); value != "" {
+					label.Allow = append(label.Allow, value)
+				}
+			}
+		}
+		labels = append(labels, label)
+	}
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("no metric labels in %q", spec)
+	}
+	return labels, nil
+}
+
+// validLabelName reports whether name is a valid Prometheus label name
+func validLabelName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "__") {
+		return false
+	}
+	for i, c := range name {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// labeledSeries holds the counters of one combination of label values
+type labeledSeries struct {
+	values        []string
+	requests      uint64
+	responses     uint64
+	drops         uint64 // requests and responses dropped by an element
+	requestBytes  uint64
+	responseBytes uint64
+}
+
+// pendingSeries is the series of a request whose response has not been seen yet
+type pendingSeries struct {
+	series *labeledSeries
+	seen   time.Time
+}
+
+// LabeledMetrics counts the RPCs through the proxy by the values of configurable labels, e.g.
+// the tenant of each request, so multi-tenant meshes see per-tenant traffic. Responses are
+// counted with the labels of their request. To bound the number of series, each label keeps
+// at most limit distinct values and at most maxSeries combinations are counted; values past
+// the limits are counted as OverflowLabelValue. Sizes are those of the public segments.
+type LabeledMetrics struct {
+	labels    []MetricLabel
+	allow     []map[string]bool // nil for labels without an allow-list
+	limit     int
+	maxSeries int
+	timeout   time.Duration // requests without a response are forgotten after this long
+
+	mu        sync.Mutex
+	values    []map[string]bool // distinct values kept per label
+	overflow  []uint64          // per label, the values counted as OverflowLabelValue
+	series    map[string]*labeledSeries
+	pending   map[uint64]pendingSeries // rpcID -> series of the request
+	lastPrune time.Time
+}
+
+// NewLabeledMetrics creates metrics labeled by labels, keeping limit distinct values per
+// label and maxSeries combinations of values; DefaultMetricLabelLimit and
+// DefaultMetricSeriesLimit if 0
+func NewLabeledMetrics(labels []MetricLabel, limit, maxSeries int, timeout time.Duration) *LabeledMetrics {
+	if limit <= 0 {
+		limit = DefaultMetricLabelLimit
+	}
+	if maxSeries <= 0 {
+		maxSeries = DefaultMetricSeriesLimit
+	}
+	m := &LabeledMetrics{
+		labels:    labels,
+		allow:     make([]map[string]bool, len(labels)),
+		limit:     limit,
+		maxSeries: maxSeries,
+		timeout:   timeout,
+		values:    make([]map[string]bool, len(labels)),
+		overflow:  make([]uint64, len(labels)),
+		series:    make(map[string]*labeledSeries),
+		pending:   make(map[uint64]pendingSeries),
+	}
+	for i, label := range labels {
+		m.values[i] = make(map[string]bool)
+		if len(label.Allow) > 0 {
+			m.allow[i] = make(map[string]bool, len(label.Allow))
+			for _, value := range label.Allow {
+				m.allow[i][value] = true
+			}
+		}
+	}
+	return m
+}
+
+// RecordRequest counts a request processed by the element chain, dropped or not, with the
+// labels read from it
+func (m *LabeledMetrics) RecordRequest(request *util.BufferedPacket, dropped bool) {
+	var decoded *schema.DynamicMessage
+	values := make([]string, len(m.labels))
+	for i, label := range m.labels {
+		values[i] = label.value(request, &decoded)
+	}
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series := m.seriesOf(values)
+	series.requests++
+	series.requestBytes += uint64(len(request.Payload))
+	if dropped {
+		series.drops++
+	} else {
+		m.pending[request.RPCID] = pendingSeries{series: series, seen: now}
+	}
+	m.prune(now)
+}
+
+// RecordResponse counts a response processed by the element chain with the labels of its
+// request. Responses of requests that were not seen are not counted.
+func (m *LabeledMetrics) RecordResponse(response *util.BufferedPacket, dropped bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	request, ok := m.pending[response.RPCID]
+	if !ok {
+		return
+	}
+	delete(m.pending, response.RPCID)
+	request.series.responses++
+	request.series.responseBytes += uint64(len(response.Payload))
+	if dropped {
+		request.series.drops++
+	}
+}
+
+// seriesOf returns the series of the label values, replacing values past the limits by
+// OverflowLabelValue. m.mu must be held.
+func (m *LabeledMetrics) seriesOf(values []string) *labeledSeries {
+	for i, value := range values {
+		if value == "" || m.values[i][value] {
+			continue
+		}
+		if (m.allow[i] != nil && !m.allow[i][value]) || len(m.values[i]) >= m.limit {
+			values[i] = OverflowLabelValue
+			m.overflow[i]++
+			continue
+		}
+		m.values[i][value] = true
+	}
+
+	key := strings.Join(values, "\xff")
+	series := m.series[key]
+	if series != nil {
+		return series
+	}
+	if len(m.series) >= m.maxSeries {
+		// All new combinations share the series where every label overflowed
+		for i := range values {
+			values[i] = OverflowLabelValue
+		}
+		key = strings.Join(values, "\xff")
+		if series = m.series[key]; series != nil {
+			return series
+		}
+	}
+	series = &labeledSeries{values: values}
+	m.series[key] = series
+	return series
+}
+
+// prune forgets requests whose response never came. It runs at most once per second to keep
+// the packet path cheap. m.mu must be held.
+func (m *LabeledMetrics) prune(now time.Time) {
+	if now.Sub(m.lastPrune) < time.Second {
+		return
+	}
+	m.lastPrune = now
+	for rpcID, request := range m.pending {
+		if now.Sub(request.seen) > m.timeout {
+			delete(m.pending, rpcID)
+		}
+	}
+}
+
+// labelValueEscaper escapes label values in the Prometheus text exposition format
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteMetrics writes the labeled counters in the Prometheus text exposition format, as
+// arpc_proxy_rpc_* series, and the number of values counted as OverflowLabelValue per label
+func (m *LabeledMetrics) WriteMetrics(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	series := make([]labeledSeries, 0, len(m.series))
+	labels := make([]string, 0, len(m.series))
+	for _, s := range m.series {
+		series = append(series, *s)
+	}
+	overflow := append([]uint64(nil), m.overflow...)
+	m.mu.Unlock()
+
+	sort.Slice(series, func(i, j int) bool {
+		return strings.Join(series[i].values, "\xff") < strings.Join(series[j].values, "\xff")
+	})
+	for _, s := range series {
+		var b strings.Builder
+		for i, value := range s.values {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, `%s="%s"`, m.labels[i].Name, labelValueEscaper.Replace(value))
+		}
+		labels = append(labels, b.String())
+	}
+
+	var b strings.Builder
+	write := func(name, help string, value func(*labeledSeries) uint64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for i := range series {
+			fmt.Fprintf(&b, "%s{%s} %d\n", name, labels[i], value(&series[i]))
+		}
+	}
+	write("arpc_proxy_rpc_requests_total", "Total number of requests processed by the element chain.",
+		func(s *labeledSeries) uint64 { return s.requests })
+	write("arpc_proxy_rpc_responses_total", "Total number of responses processed by the element chain.",
+		func(s *labeledSeries) uint64 { return s.responses })
+	write("arpc_proxy_rpc_drops_total", "Total number of requests and responses dropped by an element.",
+		func(s *labeledSeries) uint64 { return s.drops })
+	write("arpc_proxy_rpc_request_bytes_total", "Total number of bytes of the public segments of requests.",
+		func(s *labeledSeries) uint64 { return s.requestBytes })
+	write("arpc_proxy_rpc_response_bytes_total", "Total number of bytes of the public segments of responses.",
+		func(s *labeledSeries) uint64 { return s.responseBytes })
+
+	b.WriteString("# HELP arpc_proxy_label_overflow_total Total number of label values counted as \"other\" by the cardinality limits.\n" +
+		"# TYPE arpc_proxy_label_overflow_total counter\n")
+	for i, label := range m.labels {
+		fmt.Fprintf(&b, "arpc_proxy_label_overflow_total{label=\"%s\"} %d\n", label.Name, overflow[i])
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
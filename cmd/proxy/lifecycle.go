@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	sharedelement "github.com/appnet-org/arpc/pkg/element"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/packet"
+	"go.uber.org/zap"
+)
+
+// chainDrainInterval is how often a retired chain is checked for messages still in process
+const chainDrainInterval = 10 * time.Millisecond
+
+// acquireElementChain returns the element chain of the listener of ctx, counted as busy until
+// release is called, so that a chain swapped out meanwhile is not retired while it processes
+// the message
+func acquireElementChain(ctx context.Context) *RPCElementChain {
+	for {
+		chain := elementChainFor(ctx)
+		if chain == nil {
+			return nil
+		}
+		chain.active.Add(1)
+		// A chain swapped out before it was counted may be retired already
+		if elementChainFor(ctx) == chain {
+			return chain
+		}
+		chain.active.Add(-1)
+	}
+}
+
+// release ends the processing of a message by a chain of acquireElementChain
+func (c *RPCElementChain) release() {
+	if c != nil {
+		c.active.Add(-1)
+	}
+}
+
+// drain waits for the chain to process no message anymore, until ctx is done
+func (c *RPCElementChain) drain(ctx context.Context) {
+	ticker := time.NewTicker(chainDrainInterval)
+	defer ticker.Stop()
+	for c.active.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// startElement starts a new plugin element (see sharedelement.StartHook)
+func startElement(element RPCElement) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sharedelement.DefaultHookTimeout)
+	defer cancel()
+	return sharedelement.Start(ctx, unwrapElement(element))
+}
+
+// retireElement shuts down the element of a chain that was swapped out, once the chain
+// drained or sharedelement.DefaultHookTimeout passed, then kills its plugin
+func retireElement(chain *RPCElementChain, element RPCElement, plugin elementInit) {
+	ctx, cancel := context.WithTimeout(context.Background(), sharedelement.DefaultHookTimeout)
+	defer cancel()
+	if chain != nil {
+		chain.drain(ctx)
+		if n := chain.active.Load(); n > 0 {
+			logging.Warn("Shutting down element still processing messages", zap.String("element", element.Name()), zap.Int64("messages", n))
+		}
+	}
+	if element != nil {
+		if err := sharedelement.Shutdown(ctx, unwrapElement(element)); err != nil {
+			logging.Error("Element failed to shut down", zap.String("element", element.Name()), zap.Error(err))
+		} else {
+			logging.Info("Element shut down", zap.String("element", element.Name()))
+		}
+	}
+	if plugin != nil {
+		plugin.Kill()
+	}
+}
+
+// errShuttingDown fails the messages arriving once the elements are shut down, so that clients
+// retry elsewhere rather than have their calls skip the policy of the elements
+var errShuttingDown = util.NewDropError(packet.DropReasonUnavailable, "proxy is shutting down")
+
+// closedElement fails every message, in place of the elements of a proxy shutting down
+type closedElement struct{}
+
+func (closedElement) ProcessRequest(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	return packet, util.PacketVerdictDrop, ctx, errShuttingDown
+}
+
+func (closedElement) ProcessResponse(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	return packet, util.PacketVerdictDrop, ctx, errShuttingDown
+}
+
+func (closedElement) Name() string {
+	return "closedElement"
+}
+
+// retire replaces the chain of the loader by next, takes its plugin out, and returns the
+// function retiring it. The caller must hold l.mu.
+func (l *ElementLoader) retire(next *RPCElementChain) func() {
+	chain, element, plugin := l.Chain(), l.element, l.plugin
+	l.chain.Store(next)
+	l.plugin, l.element, l.module = nil, nil, nil
+	return func() { retireElement(chain, element, plugin) }
+}
+
+// shutdownElements retires the plugin elements of every loader on shutdown of the proxy,
+// letting them finish the messages they process. Later messages are dropped as unavailable.
+func shutdownElements() {
+	var wg sync.WaitGroup
+	for _, loader := range elementLoaders() {
+		loader.mu.Lock()
+		// Later updates must not load the plugin back
+		loader.closed = true
+		retire := loader.retire(NewRPCElementChain(closedElement{}))
+		loader.mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			retire()
+		}()
+	}
+	wg.Wait()
+}
+
+// unwrapElement returns the element an RPCElement adapts, to check the optional interfaces
+// of plugin and shared elements
+func unwrapElement(element any) any {
+	switch e := element.(type) {
+	case *elementAdapter:
+		return e.elem
+	case *sharedElement:
+		return e.elem
+	}
+	return element
+}
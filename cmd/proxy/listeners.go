@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+)
+
+// maxPortRange bounds the number of ports a single range may expand to
+const maxPortRange = 1024
+
+// ListenerConfig configures one UDP listener of the proxy
+type ListenerConfig struct {
+	Port int
+	Role util.PortRole
+	// ElementPrefix selects the element plugins of the listener: the highest file in
+	// ElementPluginDir starting with it. Empty uses the default chain (ELEMENT_PLUGIN_PREFIX).
+	ElementPrefix string
+}
+
+// String formats the listener in the syntax of ParseListeners
+func (l ListenerConfig) String() string {
+	s := strconv.Itoa(l.Port)
+	if l.Role != util.PortRoleAny || l.ElementPrefix != "" {
+		s += ":" + l.Role.String()
+	}
+	if l.ElementPrefix != "" {
+		s += ":" + l.ElementPrefix
+	}
+	return s
+}
+
+// ParseListeners parses a comma-separated list of listeners, each of the form
+//
+//	port[-lastPort][:role[:elementPrefix]]
+//
+// where role is outbound, inbound or any (the default). A range expands to one listener per
+// port with the same role and element prefix, e.g.
+//
+//	15002:outbound,15006:inbound,16000-16003:inbound:element-edge-
+func ParseListeners(spec string) ([]ListenerConfig, error) {
+	var listeners []ListenerConfig
+	seen := make(map[int]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) > 3 {
+			return nil, fmt.Errorf("invalid listener %q: expected port[-lastPort][:role[:elementPrefix]]", entry)
+		}
+
+		first, last, err := parsePortRange(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid listener %q: %w", entry, err)
+		}
+		var role util.PortRole
+		if len(parts) > 1 {
+			if role, err = parsePortRole(parts[1]); err != nil {
+				return nil, fmt.Errorf("invalid listener %q: %w", entry, err)
+			}
+		}
+		var prefix string
+		if len(parts) > 2 {
+			prefix = parts[2]
+		}
+
+		for port := first; port <= last; port++ {
+			if seen[port] {
+				return nil, fmt.Errorf("port %d is configured more than once", port)
+			}
+			seen[port] = true
+			listeners = append(listeners, ListenerConfig{Port: port, Role: role, ElementPrefix: prefix})
+		}
+	}
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("no listeners configured")
+	}
+	return listeners, nil
+}
+
+// parsePortRange parses "port" or "first-last"
+func parsePortRange(s string) (int, int, error) {
+	firstStr, lastStr, isRange := strings.Cut(s, "-")
+	first, err := parsePort(firstStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !isRange {
+		return first, first, nil
+	}
+	last, err := parsePort(lastStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	if last < first {
+		return 0, 0, fmt.Errorf("port range %d-%d is empty", first, last)
+	}
+	if last-first+1 > maxPortRange {
+		return 0, 0, fmt.Errorf("port range %d-%d exceeds %d ports", first, last, maxPortRange)
+	}
+	return first, last, nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return port, nil
+}
+
+func parsePortRole(s string) (util.PortRole, error) {
+	switch role := util.PortRole(strings.ToLower(strings.TrimSpace(s))); role {
+	case util.PortRoleOutbound, util.PortRoleInbound:
+		return role, nil
+	case "any", "":
+		return util.PortRoleAny, nil
+	default:
+		return "", fmt.Errorf("unknown role %q: expected outbound, inbound or any", s)
+	}
+}
+
+// listenerLoaderKey is the context key for the element loader of the listener a packet arrived on
+type listenerLoaderKey struct{}
+
+// withListener returns a context for processing a packet that arrived on the given listener
+func withListener(ctx context.Context, listener ListenerConfig, loader *ElementLoader) context.Context {
+	ctx = util.WithPortRole(ctx, listener.Role)
+	if loader != nil {
+		ctx = context.WithValue(ctx, listenerLoaderKey{}, loader)
+	}
+	return ctx
+}
+
+// elementChainFor returns the element chain of the listener of ctx, or the default chain
+func elementChainFor(ctx context.Context) *RPCElementChain {
+	if loader, ok := ctx.Value(listenerLoaderKey{}).(*ElementLoader); ok {
+		return loader.Chain()
+	}
+	return GetElementChain()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/packet"
+	"go.uber.org/zap"
+)
+
+// loopDrops counts the request fragments dropped past the hop limit
+var loopDrops atomic.Uint64
+
+// countHop counts the proxy as a hop of a request datagram, updating its origin in place, and
+// tells whether the request went past maxHops (0 disables the limit), in which case it is
+// dropped and its sender gets a DropReasonLoopDetected error packet. Requests without an
+// origin, from clients of releases before it, are never dropped.
+func countHop(conn util.PacketWriter, src *net.UDPAddr, data []byte, maxHops int) (packet.Origin, bool) {
+	origin, ok := packet.CountHop(data)
+	if !ok || maxHops <= 0 || int(origin.Hops) <= maxHops {
+		return origin, false
+	}
+	loopDrops.Add(1)
+
+	decoded, err := (&packet.DataPacketCodec{}).Deserialize(data)
+	if err != nil {
+		return origin, true
+	}
+	pkt := decoded.(*packet.DataPacket)
+	if pkt.SeqNumber != 0 {
+		return origin, true
+	}
+	logging.Warn("Dropping request past the hop limit, likely caught in a routing loop",
+		zap.Uint64("rpcID", pkt.RPCID),
+		zap.Uint64("originID", origin.ID),
+		zap.Uint8("hops", origin.Hops),
+		zap.String("src", src.String()))
+	msg := fmt.Sprintf("request of origin %d dropped after %d hops (limit %d)", origin.ID, origin.Hops, maxHops)
+	if err := util.SendErrorPacket(conn, src, pkt.RPCID, msg, pkt.SrcIP, pkt.SrcPort, pkt.DstIP, pkt.DstPort, packet.RetryHint{}, packet.DropReasonLoopDetected); err != nil {
+		logging.Error("Failed to send error packet", zap.Error(err))
+	}
+	return origin, true
+}
+
+// writeLoopMetrics writes the number of request fragments dropped past the hop limit in the
+// Prometheus text exposition format
+func writeLoopMetrics(w io.Writer) (int64, error) {
+	n, err := fmt.Fprintf(w, "# HELP arpc_proxy_loop_drops_total Total number of request fragments dropped past the hop limit.\n"+
+		"# TYPE arpc_proxy_loop_drops_total counter\narpc_proxy_loop_drops_total %d\n", loopDrops.Load())
+	return int64(n), err
+}
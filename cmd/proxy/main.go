@@ -2,17 +2,27 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"net"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/common"
+	sharedelement "github.com/appnet-org/arpc/pkg/element"
 	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/otlp"
 	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/rpc/stats"
+	"github.com/appnet-org/arpc/pkg/schema"
 	"github.com/appnet-org/arpc/pkg/transport"
 	"go.uber.org/zap"
 )
@@ -29,21 +39,114 @@ const (
 type ProxyState struct {
 	elementChain *RPCElementChain
 	packetBuffer *PacketBuffer
+	slowQueryLog *SlowQueryLog       // nil if the slow query log is disabled
+	sizeStats    *SizeStats          // nil if size stats are disabled
+	transparent  *TransparentSockets // nil unless the source mode is transparent
+	rewriter     *ResponseRewriter   // nil if no response rewrites are configured
+	eventLog     *EventLog           // nil if RPC events are disabled
+	timelines    *Timelines          // nil if RPC timelines are disabled
+	stuckRPCs    *StuckRPCs          // nil if stuck RPC detection is disabled
+	labeled      *LabeledMetrics     // nil if no metric labels are configured
+	controlPlane *ControlPlaneClient // nil if no control plane is configured
+	gateway      *Gateway            // nil unless gateway mode is enabled
+	relay        *Relay              // nil unless relay mode is enabled
+	aborts       *RPCAborts          // nil if RPCs are not aborted when their client goes away
 }
 
 // Config holds the proxy configuration
 type Config struct {
-	Ports            []int
+	Listeners        []ListenerConfig
 	EnableEncryption bool
 	EncryptionKey    []byte
 	BufferTimeout    time.Duration
+	// BufferTimeoutMin enables the adaptive buffer timeout: each RPC expires after a timeout
+	// scaled by its size and fragment rate, between BufferTimeoutMin and BufferTimeout (0 gives
+	// every RPC BufferTimeout)
+	BufferTimeoutMin time.Duration
+	// SlowQueryThreshold enables logging of RPCs slower than this (0 disables it)
+	SlowQueryThreshold time.Duration
+	// StrictMode drops data packets without valid key ID and auth tag extensions (requires encryption)
+	StrictMode bool
+	// AdminAddr is the listen address of the admin HTTP server (empty disables it)
+	AdminAddr string
+	// SizeStatsTopK enables per-method payload size histograms and keeps the K largest RPCs (0 disables them)
+	SizeStatsTopK int
+	// RPCTimelines enables the recording of the events of the last RPCTimelines RPCs, served
+	// by the admin API (0 disables it)
+	RPCTimelines int
+	// StuckRPCThreshold reports RPCs whose reassembly is still incomplete after being idle for
+	// this percentage of BufferTimeout (0 disables it)
+	StuckRPCThreshold int
+	// Mode selects the pipelines that run the element chain; packets of the others are passed through
+	Mode ProxyMode
+	// SourceMode selects how the address of the original sender is preserved when forwarding
+	SourceMode SourceMode
+	// ResponseRewrites make responses of matching requests return via another address
+	ResponseRewrites []ResponseRewrite
+	// Buffering selects whether the element chain waits for the public segment or the whole RPC
+	Buffering BufferingMode
+	// EventSocket is where a summary event per completed RPC is written, udp://host:port or
+	// unix:///path (empty disables events)
+	EventSocket string
+	// EventFormat is the encoding of RPC events
+	EventFormat EventFormat
+	// MetricLabels are the labels of the per-RPC metrics, e.g. the tenant of each request
+	// (empty disables them). MetricLabelLimit bounds the distinct values of each label and
+	// MetricSeriesLimit the combinations of values (0 uses the defaults); values past the
+	// limits are counted as OverflowLabelValue.
+	MetricLabels      []MetricLabel
+	MetricLabelLimit  int
+	MetricSeriesLimit int
+	// OTLP exports the buffer metrics and a span per completed RPC to an OpenTelemetry
+	// collector, configured by the OTEL_* variables (nil disables it)
+	OTLP *otlp.Config
+	// SchemaFiles are FileDescriptorSets or Symphony schema blobs registered with schema.Global
+	// at startup, so elements decode payloads of services they were not compiled against
+	SchemaFiles []string
+	// VerdictStore is where verdicts of RPCs are kept: "memory", or redis://host:port to share
+	// them with other replicas behind the same load balancer
+	VerdictStore string
+	// ControlPlane is the URL of the control plane server pushing element parameters and
+	// response rewrites (empty disables it), ControlPlaneNode the name of this proxy on it,
+	// and ControlPlaneCache the file keeping the last known good configuration
+	ControlPlane      string
+	ControlPlaneNode  string
+	ControlPlaneCache string
+	// GatewayAddress is the address of this proxy as seen from remote clusters, and
+	// GatewayRoutes the gateways of their private networks (gateway mode, off if empty)
+	GatewayAddress *net.UDPAddr
+	GatewayRoutes  []GatewayRoute
+	// RelayAddress is the address of this proxy as seen from the destinations of relayed RPCs,
+	// RelaySecret the secret their session tokens are issued with (relay mode, off if empty),
+	// and RelayRate the bandwidth of each session in bytes per second (0: unlimited)
+	RelayAddress *net.UDPAddr
+	RelaySecret  []byte
+	RelayRate    int
+	// ShadowElements are the names of the elements that run in shadow mode: they only record
+	// what they would have done to packets
+	ShadowElements []string
+	// MaxHops is the hop count past which requests are dropped as caught in a routing loop
+	// (0 disables the limit)
+	MaxHops int
+	// AbortGrace is how long elements processing an RPC aborted since its client went away get
+	// to wrap up before their context is canceled (0 cancels it at once)
+	AbortGrace time.Duration
 }
 
 // DefaultConfig returns the default proxy configuration
 func DefaultConfig() *Config {
 	return &Config{
-		Ports:            []int{15002, 15006},
+		Listeners: []ListenerConfig{
+			{Port: 15002, Role: util.PortRoleOutbound},
+			{Port: 15006, Role: util.PortRoleInbound},
+		},
+		Mode:             ProxyModeBidirectional,
+		SourceMode:       SourceModeProxy,
+		Buffering:        BufferingStreaming,
+		EventFormat:      EventFormatJSON,
 		BufferTimeout:    30 * time.Second,
+		MaxHops:          packet.DefaultMaxHops,
+		AbortGrace:       DefaultAbortGrace,
 		EnableEncryption: false,
 		EncryptionKey:    nil,
 	}
@@ -68,6 +171,24 @@ func (c *Config) SetEncryption(key []byte) {
 	}
 }
 
+// publicSegmentKey returns the key the public segment of a packet is encrypted with, nil if
+// it is in plaintext: the key of the proxy with encryption enabled, and otherwise the default
+// public key for the calls that their client encrypted anyway (see
+// transport.EncryptionRequired)
+func publicSegmentKey(config *Config, bufferedPacket *util.BufferedPacket) []byte {
+	if config.EnableEncryption {
+		return config.EncryptionKey
+	}
+	if !transport.CallEncrypted(bufferedPacket.Extensions, packet.PacketTypeID(bufferedPacket.PacketType), bufferedPacket.RPCID) {
+		return nil
+	}
+	if err := transport.InitDefaultGCMObjects(); err != nil {
+		logging.Error("Failed to initialize GCM objects", zap.Error(err))
+		return nil
+	}
+	return transport.DefaultPublicKey
+}
+
 // getLoggingConfig reads logging configuration from environment variables with defaults
 func getLoggingConfig() *logging.Config {
 	level := os.Getenv("LOG_LEVEL")
@@ -80,20 +201,45 @@ func getLoggingConfig() *logging.Config {
 		format = "console"
 	}
 
+	// Comma-separated list of log field keys whose values must never be logged
+	var redactFields []string
+	if fields := os.Getenv("LOG_REDACT_FIELDS"); fields != "" {
+		redactFields = strings.Split(fields, ",")
+	}
+
+	// Entries are timestamped with the coarse clock the packet buffer already runs, which is
+	// cheaper than reading the system clock for every entry
 	return &logging.Config{
-		Level:  level,
-		Format: format,
+		Level:        level,
+		Format:       format,
+		RedactFields: redactFields,
+		Clock:        common.DefaultCoarseClock(),
 	}
 }
 
 func main() {
+	selfTest := flag.Bool("self-test", false, "send an RPC through the proxy pipeline to a built-in echo target and exit, non-zero if it fails")
+	flag.Parse()
+
 	// Initialize logging
 	err := logging.Init(getLoggingConfig())
 	if err != nil {
 		panic(fmt.Sprintf("Failed to initialize logging: %v", err))
 	}
 
-	logging.Info("Starting bidirectional UDP proxy on :15002 and :15006...")
+	logging.Info("Starting bidirectional UDP proxy...")
+
+	// Plugins are verified from their first load
+	if pluginKeys := os.Getenv("ELEMENT_PLUGIN_KEYS"); pluginKeys != "" {
+		verifier, err := sharedelement.LoadSignatureVerifier(strings.Split(pluginKeys, ","))
+		if err != nil {
+			logging.Fatal("Invalid ELEMENT_PLUGIN_KEYS", zap.Error(err))
+		}
+		SetPluginVerifier(verifier)
+	}
+	if os.Getenv("REQUIRE_ELEMENT_DESCRIPTORS") == "true" {
+		SetRequireDescriptors(true)
+	}
 
 	// Initialize dynamic element loader
 	InitElementLoader(ElementPluginDir + "/" + GetElementPluginPrefix())
@@ -101,25 +247,251 @@ func main() {
 	config := DefaultConfig()
 
 	// Override config from environment variables
+	if listeners := os.Getenv("LISTENERS"); listeners != "" {
+		parsed, err := ParseListeners(listeners)
+		if err != nil {
+			logging.Fatal("Invalid LISTENERS", zap.Error(err))
+		}
+		config.Listeners = parsed
+	}
+
+	if proxyMode := os.Getenv("PROXY_MODE"); proxyMode != "" {
+		mode, err := ParseProxyMode(proxyMode)
+		if err != nil {
+			logging.Fatal("Invalid PROXY_MODE", zap.Error(err))
+		}
+		config.Mode = mode
+	}
+
+	if sourceMode := os.Getenv("SOURCE_MODE"); sourceMode != "" {
+		mode, err := ParseSourceMode(sourceMode)
+		if err != nil {
+			logging.Fatal("Invalid SOURCE_MODE", zap.Error(err))
+		}
+		config.SourceMode = mode
+	}
+
+	if buffering := os.Getenv("BUFFERING"); buffering != "" {
+		mode, err := ParseBufferingMode(buffering)
+		if err != nil {
+			logging.Fatal("Invalid BUFFERING", zap.Error(err))
+		}
+		config.Buffering = mode
+	}
+
+	config.EventSocket = os.Getenv("EVENT_SOCKET")
+	if eventFormat := os.Getenv("EVENT_FORMAT"); eventFormat != "" {
+		format, err := ParseEventFormat(eventFormat)
+		if err != nil {
+			logging.Fatal("Invalid EVENT_FORMAT", zap.Error(err))
+		}
+		config.EventFormat = format
+	}
+
+	if metricLabels := os.Getenv("METRIC_LABELS"); metricLabels != "" {
+		labels, err := ParseMetricLabels(metricLabels)
+		if err != nil {
+			logging.Fatal("Invalid METRIC_LABELS", zap.Error(err))
+		}
+		config.MetricLabels = labels
+	}
+	if metricLabelLimit := os.Getenv("METRIC_LABEL_LIMIT"); metricLabelLimit != "" {
+		limit, err := strconv.Atoi(metricLabelLimit)
+		if err != nil || limit <= 0 {
+			logging.Fatal("Invalid METRIC_LABEL_LIMIT", zap.String("limit", metricLabelLimit))
+		}
+		config.MetricLabelLimit = limit
+	}
+	if metricSeriesLimit := os.Getenv("METRIC_SERIES_LIMIT"); metricSeriesLimit != "" {
+		limit, err := strconv.Atoi(metricSeriesLimit)
+		if err != nil || limit <= 0 {
+			logging.Fatal("Invalid METRIC_SERIES_LIMIT", zap.String("limit", metricSeriesLimit))
+		}
+		config.MetricSeriesLimit = limit
+	}
+
+	otlpConfig, err := otlp.ConfigFromEnv("proxy")
+	if err != nil {
+		logging.Fatal("Invalid OTLP configuration", zap.Error(err))
+	}
+	config.OTLP = otlpConfig
+
+	if responseRewrites := os.Getenv("RESPONSE_REWRITES"); responseRewrites != "" {
+		rules, err := ParseResponseRewrites(responseRewrites)
+		if err != nil {
+			logging.Fatal("Invalid RESPONSE_REWRITES", zap.Error(err))
+		}
+		config.ResponseRewrites = rules
+	}
+
+	if gatewayRoutes := os.Getenv("GATEWAY_ROUTES"); gatewayRoutes != "" {
+		routes, err := ParseGatewayRoutes(gatewayRoutes)
+		if err != nil {
+			logging.Fatal("Invalid GATEWAY_ROUTES", zap.Error(err))
+		}
+		config.GatewayRoutes = routes
+	}
+	if gatewayAddress := os.Getenv("GATEWAY_ADDRESS"); gatewayAddress != "" {
+		addr, err := net.ResolveUDPAddr("udp4", gatewayAddress)
+		if err != nil || addr.IP.To4() == nil || addr.IP.IsUnspecified() || addr.Port == 0 {
+			logging.Fatal("Invalid GATEWAY_ADDRESS", zap.String("address", gatewayAddress))
+		}
+		config.GatewayAddress = addr
+	}
+	if (config.GatewayAddress == nil) != (len(config.GatewayRoutes) == 0) {
+		logging.Fatal("Gateway mode requires both GATEWAY_ADDRESS and GATEWAY_ROUTES")
+	}
+
+	if relaySecret := os.Getenv("RELAY_SECRET"); relaySecret != "" {
+		config.RelaySecret = []byte(relaySecret)
+	}
+	if relayAddress := os.Getenv("RELAY_ADDRESS"); relayAddress != "" {
+		addr, err := net.ResolveUDPAddr("udp4", relayAddress)
+		if err != nil || addr.IP.To4() == nil || addr.IP.IsUnspecified() || addr.Port == 0 {
+			logging.Fatal("Invalid RELAY_ADDRESS", zap.String("address", relayAddress))
+		}
+		config.RelayAddress = addr
+	}
+	if (config.RelayAddress == nil) != (len(config.RelaySecret) == 0) {
+		logging.Fatal("Relay mode requires both RELAY_ADDRESS and RELAY_SECRET")
+	}
+	if relayRate := os.Getenv("RELAY_RATE"); relayRate != "" {
+		rate, err := strconv.Atoi(relayRate)
+		if err != nil || rate < 0 {
+			logging.Fatal("Invalid RELAY_RATE", zap.String("rate", relayRate))
+		}
+		config.RelayRate = rate
+	}
+
+	config.ShadowElements = ParseShadowElements(os.Getenv("SHADOW_ELEMENTS"))
+
+	if maxHops := os.Getenv("MAX_HOPS"); maxHops != "" {
+		hops, err := strconv.Atoi(maxHops)
+		if err != nil || hops < 0 || hops > 255 {
+			logging.Fatal("Invalid MAX_HOPS", zap.String("hops", maxHops))
+		}
+		config.MaxHops = hops
+	}
+
+	if abortGrace := os.Getenv("ABORT_GRACE"); abortGrace != "" {
+		grace, err := time.ParseDuration(abortGrace)
+		if err != nil || grace < 0 {
+			logging.Fatal("Invalid ABORT_GRACE", zap.String("grace", abortGrace))
+		}
+		config.AbortGrace = grace
+	}
+
 	if bufferTimeout := os.Getenv("BUFFER_TIMEOUT"); bufferTimeout != "" {
 		if timeout, err := time.ParseDuration(bufferTimeout); err == nil {
 			config.BufferTimeout = timeout
 		}
 	}
+	if bufferTimeoutMin := os.Getenv("BUFFER_TIMEOUT_MIN"); bufferTimeoutMin != "" {
+		timeout, err := time.ParseDuration(bufferTimeoutMin)
+		if err != nil || timeout < 0 || timeout > config.BufferTimeout {
+			logging.Fatal("Invalid BUFFER_TIMEOUT_MIN", zap.String("timeout", bufferTimeoutMin))
+		}
+		config.BufferTimeoutMin = timeout
+	}
+
+	if slowQueryThreshold := os.Getenv("SLOW_QUERY_THRESHOLD"); slowQueryThreshold != "" {
+		if threshold, err := time.ParseDuration(slowQueryThreshold); err == nil {
+			config.SlowQueryThreshold = threshold
+		}
+	}
 
 	// Configure encryption from environment variable
 	if enableEncryption := os.Getenv("ENABLE_ENCRYPTION"); enableEncryption == "true" {
 		config.SetEncryption(nil)
 	}
 
+	config.AdminAddr = os.Getenv("ADMIN_ADDR")
+
+	if sizeStatsTopK := os.Getenv("SIZE_STATS_TOP_K"); sizeStatsTopK != "" {
+		if topK, err := strconv.Atoi(sizeStatsTopK); err == nil {
+			config.SizeStatsTopK = topK
+		}
+	}
+
+	if rpcTimelines := os.Getenv("RPC_TIMELINES"); rpcTimelines != "" {
+		if rpcs, err := strconv.Atoi(rpcTimelines); err == nil {
+			config.RPCTimelines = rpcs
+		}
+	}
+
+	if stuckRPCThreshold := os.Getenv("STUCK_RPC_THRESHOLD"); stuckRPCThreshold != "" {
+		threshold, err := strconv.Atoi(stuckRPCThreshold)
+		if err != nil || threshold < 0 || threshold > 100 {
+			logging.Fatal("Invalid STUCK_RPC_THRESHOLD", zap.String("threshold", stuckRPCThreshold))
+		}
+		config.StuckRPCThreshold = threshold
+	}
+
+	if schemaFiles := os.Getenv("SCHEMA_FILES"); schemaFiles != "" {
+		config.SchemaFiles = strings.Split(schemaFiles, ",")
+	}
+
+	config.VerdictStore = os.Getenv("VERDICT_STORE")
+
+	config.ControlPlane = os.Getenv("CONTROL_PLANE")
+	config.ControlPlaneCache = os.Getenv("CONTROL_PLANE_CACHE")
+	if config.ControlPlaneNode = os.Getenv("CONTROL_PLANE_NODE"); config.ControlPlaneNode == "" {
+		config.ControlPlaneNode, _ = os.Hostname()
+	}
+
+	if strictMode := os.Getenv("STRICT_MODE"); strictMode == "true" {
+		if !config.EnableEncryption {
+			logging.Fatal("STRICT_MODE requires ENABLE_ENCRYPTION=true")
+		}
+		config.StrictMode = true
+	}
+
 	logging.Info("Proxy configuration",
+		zap.String("mode", string(config.Mode)),
+		zap.String("sourceMode", string(config.SourceMode)),
+		zap.String("buffering", string(config.Buffering)),
 		zap.Duration("bufferTimeout", config.BufferTimeout),
+		zap.Duration("bufferTimeoutMin", config.BufferTimeoutMin),
 		zap.Bool("enableEncryption", config.EnableEncryption),
-		zap.Ints("ports", config.Ports))
+		zap.Bool("strictMode", config.StrictMode),
+		zap.Duration("slowQueryThreshold", config.SlowQueryThreshold),
+		zap.String("adminAddr", config.AdminAddr),
+		zap.Int("sizeStatsTopK", config.SizeStatsTopK),
+		zap.Int("rpcTimelines", config.RPCTimelines),
+		zap.Int("stuckRPCThreshold", config.StuckRPCThreshold),
+		zap.String("eventSocket", config.EventSocket),
+		zap.String("eventFormat", string(config.EventFormat)),
+		zap.Stringers("metricLabels", config.MetricLabels),
+		zap.Int("metricLabelLimit", config.MetricLabelLimit),
+		zap.Int("metricSeriesLimit", config.MetricSeriesLimit),
+		zap.String("otlpEndpoint", otlpEndpoint(config.OTLP)),
+		zap.Strings("schemaFiles", config.SchemaFiles),
+		zap.String("verdictStore", config.VerdictStore),
+		zap.String("controlPlane", config.ControlPlane),
+		zap.String("controlPlaneNode", config.ControlPlaneNode),
+		zap.String("controlPlaneCache", config.ControlPlaneCache),
+		zap.Stringers("listeners", config.Listeners),
+		zap.Stringers("responseRewrites", config.ResponseRewrites),
+		zap.Stringer("gatewayAddress", config.GatewayAddress),
+		zap.Stringers("gatewayRoutes", config.GatewayRoutes),
+		zap.Stringer("relayAddress", config.RelayAddress),
+		zap.Int("relayRate", config.RelayRate),
+		zap.Strings("shadowElements", config.ShadowElements))
+
+	loadSchemas(config.SchemaFiles)
 
 	// Initialize packet buffer
-	packetBuffer := NewPacketBuffer(config.BufferTimeout)
+	packetBuffer := NewAdaptivePacketBuffer(config.BufferTimeoutMin, config.BufferTimeout)
 	defer packetBuffer.Close()
+	packetBuffer.mode = config.Mode
+	packetBuffer.buffering = config.Buffering
+	if config.VerdictStore != "" {
+		store, err := ParseVerdictStore(config.VerdictStore, config.BufferTimeout)
+		if err != nil {
+			logging.Fatal("Invalid VERDICT_STORE", zap.Error(err))
+		}
+		packetBuffer.verdicts = store
+	}
 
 	// Get the dynamically loaded element chain
 	elementChain := GetElementChain()
@@ -132,6 +504,81 @@ func main() {
 	state := &ProxyState{
 		elementChain: elementChain,
 		packetBuffer: packetBuffer,
+		aborts:       NewRPCAborts(config.AbortGrace),
+	}
+	if config.SlowQueryThreshold > 0 {
+		state.slowQueryLog = NewSlowQueryLog(config.SlowQueryThreshold, config.BufferTimeout)
+	}
+	if config.SizeStatsTopK > 0 {
+		state.sizeStats = NewSizeStats(config.SizeStatsTopK, config.BufferTimeout)
+		packetBuffer.sizeStats = state.sizeStats
+	}
+	if config.RPCTimelines > 0 {
+		state.timelines = NewTimelines(config.RPCTimelines, DefaultTimelineEvents)
+	}
+	if config.StuckRPCThreshold > 0 {
+		state.stuckRPCs = NewStuckRPCs(config.StuckRPCThreshold, state.timelines)
+		packetBuffer.DetectStuckRPCs(state.stuckRPCs)
+	}
+	if len(config.MetricLabels) > 0 {
+		state.labeled = NewLabeledMetrics(config.MetricLabels, config.MetricLabelLimit, config.MetricSeriesLimit, config.BufferTimeout)
+	}
+	var exporter *otlp.Exporter
+	if config.OTLP != nil {
+		var err error
+		if exporter, err = otlp.NewExporter(*config.OTLP); err != nil {
+			logging.Fatal("Failed to create OTLP exporter", zap.Error(err))
+		}
+		defer exporter.Close()
+		exporter.Register(state.metricsWriters()...)
+	}
+	if config.EventSocket != "" || exporter != nil {
+		eventLog, err := NewEventLog(config.EventSocket, config.EventFormat, config.BufferTimeout, exporter)
+		if err != nil {
+			logging.Fatal("Failed to open event socket", zap.Error(err))
+		}
+		defer eventLog.Close()
+		state.eventLog = eventLog
+	}
+	if config.SourceMode == SourceModeTransparent {
+		state.transparent = NewTransparentSockets(config.BufferTimeout, func(ctx context.Context, conn *net.UDPConn, src *net.UDPAddr, data []byte, recvTime time.Time) {
+			handlePacket(ctx, conn, state, src, data, config, recvTime)
+		})
+		defer state.transparent.Close()
+	}
+	// The control plane may push response rewrites even if none are configured
+	if len(config.ResponseRewrites) > 0 || config.ControlPlane != "" {
+		state.rewriter = NewResponseRewriter(config.ResponseRewrites, config.BufferTimeout)
+	}
+	if config.GatewayAddress != nil {
+		state.gateway = NewGateway(config.GatewayAddress, config.GatewayRoutes, config.BufferTimeout)
+	}
+	if config.RelayAddress != nil {
+		state.relay = NewRelay(config.RelayAddress, config.RelaySecret, config.RelayRate, config.BufferTimeout)
+	}
+	shadowMode.SetElements(config.ShadowElements)
+	if config.ControlPlane != "" {
+		client, err := NewControlPlaneClient(config.ControlPlane, config.ControlPlaneNode, config.ControlPlaneCache, state.rewriter)
+		if err != nil {
+			logging.Fatal("Invalid CONTROL_PLANE", zap.Error(err))
+		}
+		if err := client.LoadCache(); err != nil {
+			logging.Warn("Failed to apply the cached control plane configuration", zap.String("path", config.ControlPlaneCache), zap.Error(err))
+		}
+		state.controlPlane = client
+		go client.Run(context.Background())
+	}
+
+	if *selfTest {
+		if err := runSelfTest(config, state); err != nil {
+			logging.Fatal("Self-test failed", zap.Error(err))
+		}
+		logging.Info("Self-test passed")
+		return
+	}
+
+	if config.AdminAddr != "" {
+		startAdminServer(config.AdminAddr, state)
 	}
 
 	// Start proxy servers
@@ -141,21 +588,59 @@ func main() {
 
 	// Wait for shutdown signal
 	waitForShutdown()
+	shutdownElements()
 }
 
-// startProxyServers starts UDP listeners on the configured ports
+// metricsWriters returns the writers of the proxy metrics in the Prometheus text exposition
+// format, served by the admin API and exported with OTLP
+func (state *ProxyState) metricsWriters() []stats.MetricsWriter {
+	writers := []stats.MetricsWriter{state.packetBuffer.WriteMetrics, writePluginMetrics, writeElementMetrics, writeLoopMetrics}
+	if state.labeled != nil {
+		writers = append(writers, state.labeled.WriteMetrics)
+	}
+	if state.aborts != nil {
+		writers = append(writers, state.aborts.WriteMetrics)
+	}
+	return writers
+}
+
+// otlpEndpoint returns the collector endpoint of an OTLP configuration, empty if disabled
+func otlpEndpoint(config *otlp.Config) string {
+	if config == nil {
+		return ""
+	}
+	return config.Endpoint
+}
+
+// loadSchemas registers the schemas of the given files with schema.Global. A file that
+// cannot be read is fatal; messages and methods without a Symphony encoding are only
+// reported, the others are still registered.
+func loadSchemas(paths []string) {
+	for _, path := range paths {
+		err := schema.Global.LoadFile(path)
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			logging.Fatal("Failed to read schema file", zap.String("path", path), zap.Error(err))
+		} else if err != nil {
+			logging.Warn("Some schemas of the file were not registered", zap.String("path", path), zap.Error(err))
+		}
+		logging.Info("Loaded schema file", zap.String("path", path))
+	}
+}
+
+// startProxyServers starts the configured UDP listeners
 func startProxyServers(config *Config, state *ProxyState) error {
 	var wg sync.WaitGroup
-	errCh := make(chan error, len(config.Ports))
+	errCh := make(chan error, len(config.Listeners))
 
-	for _, port := range config.Ports {
+	for _, listener := range config.Listeners {
 		wg.Add(1)
-		go func(p int) {
+		go func(l ListenerConfig) {
 			defer wg.Done()
-			if err := runProxyServer(p, state, config); err != nil {
-				errCh <- fmt.Errorf("proxy server on port %d failed: %w", p, err)
+			if err := runProxyServer(l, state, config); err != nil {
+				errCh <- fmt.Errorf("proxy server on port %d failed: %w", l.Port, err)
 			}
-		}(port)
+		}(listener)
 	}
 
 	// Wait for all servers to start or fail
@@ -171,8 +656,9 @@ func startProxyServers(config *Config, state *ProxyState) error {
 	}
 }
 
-// runProxyServer runs a single UDP proxy server on the specified port
-func runProxyServer(port int, state *ProxyState, config *Config) error {
+// runProxyServer runs a single UDP proxy server for the given listener
+func runProxyServer(listener ListenerConfig, state *ProxyState, config *Config) error {
+	port := listener.Port
 	listenAddr := &net.UDPAddr{Port: port}
 	conn, err := net.ListenUDP("udp", listenAddr)
 	if err != nil {
@@ -185,13 +671,35 @@ func runProxyServer(port int, state *ProxyState, config *Config) error {
 		logging.Warn("Failed to set UDP receive buffer size", zap.Int("port", port), zap.Error(err))
 	}
 
-	logging.Info("Listening on UDP port", zap.Int("port", port))
+	// Report unreachable destinations of forwarded requests to clients, and abort the RPCs of
+	// clients that went away (see handleICMPErrors)
+	icmpErrors := true
+	if err := transport.EnableICMPErrors(conn); err != nil {
+		logging.Warn("ICMP errors not available on listener", zap.Int("port", port), zap.Error(err))
+		icmpErrors = false
+	}
+
+	// Packets of this listener are processed by its own element chain if it has a prefix
+	var loader *ElementLoader
+	if listener.ElementPrefix != "" {
+		loader = ListenerElementLoader(ElementPluginDir + "/" + listener.ElementPrefix)
+	}
+	ctx := withListener(context.Background(), listener, loader)
+
+	logging.Info("Listening on UDP port",
+		zap.Int("port", port),
+		zap.Stringer("role", listener.Role),
+		zap.String("elementPrefix", listener.ElementPrefix))
 
 	buf := make([]byte, DefaultBufferSize)
 
 	for {
 		n, src, err := conn.ReadFromUDP(buf)
 		if err != nil {
+			// A queued ICMP error interrupts the read
+			if icmpErrors && handleICMPErrors(ctx, conn, state) > 0 {
+				continue
+			}
 			logging.Error("ReadFromUDP error", zap.Int("port", port), zap.Error(err))
 			continue
 		}
@@ -201,13 +709,50 @@ func runProxyServer(port int, state *ProxyState, config *Config) error {
 		data := make([]byte, n)
 		copy(data, buf[:n])
 
-		go handlePacket(conn, state, src, data, config)
+		go handlePacket(ctx, conn, state, src, data, config, time.Now())
 	}
 }
 
-// handlePacket processes incoming packets and forwards them to the appropriate peer
-func handlePacket(conn *net.UDPConn, state *ProxyState, src *net.UDPAddr, data []byte, config *Config) {
-	ctx := context.Background()
+// handlePacket processes incoming packets and forwards them to the appropriate peer.
+// ctx carries the listener the packet arrived on (see withListener).
+// recvTime is when the packet was read from the socket (used for queue wait in the slow query log).
+func handlePacket(ctx context.Context, conn util.PacketWriter, state *ProxyState, src *net.UDPAddr, data []byte, config *Config, recvTime time.Time) {
+	queueWait := time.Since(recvTime)
+
+	// Peers relaying through the proxy send NAT traversal datagrams to open their NAT
+	// mappings towards it; they carry no RPC
+	if len(data) > 0 && data[0] == byte(transport.NATPacketTypeID) {
+		logging.Debug("Dropping NAT traversal datagram", zap.String("src", src.String()))
+		return
+	}
+
+	// Relayed datagrams are readdressed first, so that the rest of the pipeline forwards them
+	// like any other
+	if state.relay != nil {
+		relayed, err := state.relay.Process(data, src)
+		if err != nil {
+			logging.Warn("Dropping relayed packet", zap.String("src", src.String()), zap.Error(err))
+			var rejection *RelayRejection
+			if errors.As(err, &rejection) {
+				var srcIP [4]byte
+				copy(srcIP[:], src.IP.To4())
+				if sendErr := util.SendErrorPacket(conn, src, rejection.RPCID, err.Error(), srcIP, uint16(src.Port), [4]byte{}, 0, rejection.Hint, rejection.Reason); sendErr != nil {
+					logging.Error("Failed to send error packet", zap.Error(sendErr))
+				}
+			}
+			return
+		}
+		data = relayed
+	}
+
+	// Every proxy a request goes through is a hop of its origin
+	if _, dropped := countHop(conn, src, data, config.MaxHops); dropped {
+		return
+	}
+
+	if state.timelines != nil {
+		state.timelines.RecordDatagram(TimelineFragmentReceived, data, src)
+	}
 
 	// Check if this is an error packet (PacketTypeID == 3)
 	if len(data) > 0 && data[0] == byte(packet.PacketTypeError.TypeID) {
@@ -217,6 +762,15 @@ func handlePacket(conn *net.UDPConn, state *ProxyState, src *net.UDPAddr, data [
 			logging.Error("Error processing error packet", zap.Error(err))
 			return
 		}
+		if state.rewriter != nil {
+			state.rewriter.RestoreResponse(bufferedPacket)
+		}
+		if state.gateway != nil {
+			state.gateway.RestoreResponse(bufferedPacket)
+		}
+		if state.timelines != nil {
+			state.timelines.RecordErrorPacket(bufferedPacket, src)
+		}
 
 		// Serialize the error packet for forwarding
 		errorPacket := &packet.ErrorPacket{
@@ -227,6 +781,8 @@ func handlePacket(conn *net.UDPConn, state *ProxyState, src *net.UDPAddr, data [
 			SrcIP:        bufferedPacket.SrcIP,
 			SrcPort:      bufferedPacket.SrcPort,
 			ErrorMsg:     string(bufferedPacket.Payload),
+			RetryHint:    bufferedPacket.RetryHint,
+			DropReason:   bufferedPacket.DropReason,
 		}
 
 		codec := &packet.ErrorPacketCodec{}
@@ -248,6 +804,9 @@ func handlePacket(conn *net.UDPConn, state *ProxyState, src *net.UDPAddr, data [
 			zap.String("to", bufferedPacket.Peer.String()),
 			zap.String("errorMsg", string(bufferedPacket.Payload)))
 
+		if state.eventLog != nil {
+			state.eventLog.RecordError(bufferedPacket, recvTime)
+		}
 		return
 	}
 
@@ -264,21 +823,59 @@ func handlePacket(conn *net.UDPConn, state *ProxyState, src *net.UDPAddr, data [
 
 	// If bufferedPacket is nil, we're still waiting for more fragments.
 	// Check if a verdict exists and forward any buffered fragments that are ready.
+	// Forward from a socket bound to the sender's address in transparent mode
+	out := conn
+	if state.transparent != nil {
+		out = state.transparent.SenderFor(ctx, src, conn)
+	}
+
 	if bufferedPacket == nil {
 		logging.Debug("Still buffering packet fragments", zap.String("src", src.String()))
-		tryForwardBufferedFragmentsFromRawPacket(conn, state, src, data, config)
+		tryForwardBufferedFragmentsFromRawPacket(out, state, src, data, config)
 		return
 	}
 
+	if config.SourceMode.FillsHeader() {
+		fillSourceAddress(bufferedPacket, src)
+	}
+	// Responses arriving at a response rewrite target go on to the client of the request
+	if state.rewriter != nil {
+		state.rewriter.RestoreResponse(bufferedPacket)
+	}
+	// Responses arriving from remote clusters go on to the client of the request
+	if state.gateway != nil {
+		state.gateway.RestoreResponse(bufferedPacket)
+	}
+
+	// In strict mode, drop the RPC if the sender did not attach the security extensions,
+	// rather than forwarding what may be a plaintext fallback
+	if config.StrictMode && existingVerdict != util.PacketVerdictDrop {
+		if err := transport.VerifySecurityExtensions(bufferedPacket.Extensions, packet.PacketTypeID(bufferedPacket.PacketType), bufferedPacket.RPCID, config.EncryptionKey); err != nil {
+			logging.Warn("Dropping packet in strict mode",
+				zap.Uint64("rpcID", bufferedPacket.RPCID),
+				zap.String("src", src.String()),
+				zap.Error(err))
+			state.packetBuffer.Decide(src.String(), bufferedPacket.RPCID, bufferedPacket.PacketType, util.PacketVerdictDrop)
+			if state.timelines != nil {
+				state.timelines.RecordVerdict(bufferedPacket.RPCID, bufferedPacket.PacketType, util.PacketVerdictDrop, err)
+			}
+			return
+		}
+	}
+
 	// If verdict exists and it's a drop, don't forward the packet
 	if existingVerdict == util.PacketVerdictDrop {
 		logging.Debug("Packet dropped due to existing drop verdict", zap.Uint64("rpcID", bufferedPacket.RPCID))
+		if state.timelines != nil {
+			state.timelines.RecordDatagram(TimelineFragmentDropped, data, src)
+		}
 		return
 	}
 
 	payload := bufferedPacket.Payload
 	publicPayload := payload
 	privatePayload := []byte{}
+	key := publicSegmentKey(config, bufferedPacket)
 
 	// Only decrypt/split if this is the reassembled public segment (SeqNumber == -1)
 	// Fragments (SeqNumber >= 0) should be forwarded as-is without decryption
@@ -290,15 +887,23 @@ func handlePacket(conn *net.UDPConn, state *ProxyState, src *net.UDPAddr, data [
 			privatePayload = payload[offsetToPrivate(payload):]
 		}
 
-		// Decrypt the public segment if encryption is enabled
-		if config.EnableEncryption {
-			publicPayload = transport.DecryptSymphonyData(publicPayload, config.EncryptionKey, nil)
-			logging.Debug("Public segment decrypted", zap.Int("size", len(publicPayload)), zap.String("publicPayload", string(publicPayload)))
+		// Decrypt the public segment if encryption is enabled or the client encrypted the call
+		if key != nil {
+			publicPayload = transport.DecryptSymphonyData(publicPayload, key, nil)
+			bufferedPacket.Encrypted = true
+			logging.Debug("Public segment decrypted", zap.Int("size", len(publicPayload)))
 			logging.Debug("offsetToPrivate", zap.Int("offsetToPrivate", offsetToPrivate(publicPayload)))
 		}
 
 		// Update the packet with the decrypted public segment
 		bufferedPacket.Payload = publicPayload
+		if state.sizeStats != nil {
+			state.sizeStats.RecordMethod(bufferedPacket)
+		}
+		logging.Debug("Public segment",
+			zap.Uint64("rpcID", bufferedPacket.RPCID),
+			zap.String("packetType", bufferedPacket.PacketType.String()),
+			zap.Stringer("publicPayload", util.PayloadText{PacketType: bufferedPacket.PacketType, Payload: publicPayload}))
 	} else {
 		// This is a fragment being fast-forwarded - keep payload as-is (already encrypted)
 		logging.Debug("Fast-forwarding fragment without decryption", zap.Int16("seqNumber", bufferedPacket.SeqNumber), zap.Uint64("rpcID", bufferedPacket.RPCID))
@@ -312,12 +917,74 @@ func handlePacket(conn *net.UDPConn, state *ProxyState, src *net.UDPAddr, data [
 	if existingVerdict != util.PacketVerdictUnknown {
 		logging.Debug("Forwarding packet with preexisting verdict, skipping element chain", zap.Uint64("rpcID", bufferedPacket.RPCID))
 	} else {
+		// Record per-element timings if the slow query log is enabled
+		var timings *ElementTimings
+		if state.slowQueryLog != nil {
+			ctx, timings = WithElementTimings(ctx)
+		}
+		if state.timelines != nil {
+			ctx = state.timelines.WithTimeline(ctx, bufferedPacket)
+		}
+
 		// Process packet through the element chain
 		err = runElementsChain(ctx, state, bufferedPacket)
+		reply := util.LocalReplyOf(err)
+		if state.slowQueryLog != nil && err == nil {
+			switch bufferedPacket.PacketType {
+			case util.PacketTypeRequest:
+				state.slowQueryLog.RecordRequest(bufferedPacket, queueWait, timings.Timings())
+			case util.PacketTypeResponse:
+				state.slowQueryLog.RecordResponse(bufferedPacket, queueWait, timings.Timings())
+			}
+		}
+		if state.labeled != nil {
+			switch bufferedPacket.PacketType {
+			case util.PacketTypeRequest:
+				state.labeled.RecordRequest(bufferedPacket, err != nil && reply == nil)
+			case util.PacketTypeResponse:
+				state.labeled.RecordResponse(bufferedPacket, err != nil)
+			}
+		}
+		if state.eventLog != nil && reply != nil {
+			state.eventLog.RecordLocalReply(bufferedPacket, reply, recvTime)
+		} else if state.eventLog != nil {
+			verdict, reason := util.PacketVerdictPass, packet.DropReasonNone
+			if err != nil {
+				verdict, reason = util.PacketVerdictDrop, util.DropReasonOf(err)
+			}
+			switch bufferedPacket.PacketType {
+			case util.PacketTypeRequest:
+				state.eventLog.RecordRequest(bufferedPacket, verdict, reason, recvTime)
+			case util.PacketTypeResponse:
+				state.eventLog.RecordResponse(bufferedPacket, verdict, reason, recvTime)
+			}
+		}
+		// Requests an element answered get its response instead of an error packet
+		if reply != nil {
+			if sendErr := sendLocalReply(conn, state, bufferedPacket, reply, key); sendErr != nil {
+				logging.Error("Failed to send local reply", zap.Uint64("rpcID", bufferedPacket.RPCID), zap.Error(sendErr))
+			}
+			return
+		}
+		if errors.Is(err, errRPCAborted) {
+			logging.Debug("Dropped RPC aborted during the element chain", zap.Uint64("rpcID", bufferedPacket.RPCID))
+			return
+		}
 		if err != nil {
 			logging.Error("Error processing packet through element chain or packet was dropped by an element", zap.Error(err))
-			// Send error packet back to the source
-			if sendErr := util.SendErrorPacket(conn, bufferedPacket.Source, bufferedPacket.RPCID, err.Error(), bufferedPacket.SrcIP, bufferedPacket.SrcPort, bufferedPacket.DstIP, bufferedPacket.DstPort); sendErr != nil {
+			// Send error packet back to the source, with the retry hint of throttling elements
+			// and the reason of the drop. Dropped responses fail the call of the client
+			// instead, which would otherwise wait for the response until it times out.
+			var hint packet.RetryHint
+			var throttleErr *util.ThrottleError
+			if errors.As(err, &throttleErr) {
+				hint = throttleErr.Hint
+			}
+			dest, dstIP, dstPort, srcIP, srcPort := bufferedPacket.Source, bufferedPacket.SrcIP, bufferedPacket.SrcPort, bufferedPacket.DstIP, bufferedPacket.DstPort
+			if bufferedPacket.PacketType == util.PacketTypeResponse {
+				dest, dstIP, dstPort, srcIP, srcPort = bufferedPacket.Peer, bufferedPacket.DstIP, bufferedPacket.DstPort, bufferedPacket.SrcIP, bufferedPacket.SrcPort
+			}
+			if sendErr := util.SendErrorPacket(conn, dest, bufferedPacket.RPCID, err.Error(), dstIP, dstPort, srcIP, srcPort, hint, util.DropReasonOf(err)); sendErr != nil {
 				logging.Error("Failed to send error packet", zap.Error(sendErr))
 			}
 			return
@@ -329,15 +996,24 @@ func handlePacket(conn *net.UDPConn, state *ProxyState, src *net.UDPAddr, data [
 	// Only encrypt if we decrypted it (i.e., SeqNumber == -1)
 	// Fragments (SeqNumber >= 0) are already encrypted and should be forwarded as-is
 	if bufferedPacket.SeqNumber == -1 {
-		// Encrypt the packet if encryption is enabled
-		if config.EnableEncryption {
-			bufferedPacket.Payload = transport.EncryptSymphonyData(bufferedPacket.Payload, config.EncryptionKey, nil)
+		// Encrypt the packet if it was encrypted
+		if key != nil {
+			bufferedPacket.Payload = transport.EncryptSymphonyData(bufferedPacket.Payload, key, nil)
 		}
 
 		// Append the private segment to the packet
 		bufferedPacket.Payload = append(bufferedPacket.Payload, privatePayload...)
 	}
 
+	// Make the response of the request return via the rewrite target, if a rule matches
+	if state.rewriter != nil {
+		state.rewriter.RewriteRequest(bufferedPacket)
+	}
+	// Send requests to remote clusters through their gateway
+	if state.gateway != nil {
+		state.gateway.TranslateRequest(bufferedPacket)
+	}
+
 	// Fragment the packet if needed and forward all fragments
 	fragmentedPackets, err := state.packetBuffer.FragmentPacketForForward(bufferedPacket)
 	if err != nil {
@@ -352,45 +1028,45 @@ func handlePacket(conn *net.UDPConn, state *ProxyState, src *net.UDPAddr, data [
 	// 2. Implement retry logic for failed fragments, or
 	// 3. Track which fragments succeeded and retry only failed ones
 	for _, fragment := range fragmentedPackets {
-		if _, err := conn.WriteToUDP(fragment.Data, fragment.Peer); err != nil {
+		if _, err := out.WriteToUDP(fragment.Data, fragment.Peer); err != nil {
 			logging.Error("WriteToUDP error", zap.Error(err))
 			return
 		}
+		if state.timelines != nil {
+			state.timelines.RecordDatagram(TimelineFragmentSent, fragment.Data, fragment.Peer)
+		}
 	}
 
+	origin, _ := packet.FindOrigin(bufferedPacket.Extensions)
 	logging.Debug("Forwarded packet",
 		zap.Int("fragments", len(fragmentedPackets)),
 		zap.Int("bytes", len(bufferedPacket.Payload)),
 		zap.Uint64("rpcID", bufferedPacket.RPCID),
+		zap.Uint64("originID", origin.ID),
+		zap.Uint8("hops", origin.Hops),
 		zap.String("from", bufferedPacket.Source.String()),
 		zap.String("to", bufferedPacket.Peer.String()),
 		zap.String("packetType", bufferedPacket.PacketType.String()))
 
-	// Clean up fragments that were used to build the public segment
-	// Only cleanup if this was a buffered packet (SeqNumber == -1) and we have LastUsedSeqNum set
-	connKey := bufferedPacket.Source.String()
-	if bufferedPacket.SeqNumber == -1 {
-		state.packetBuffer.CleanupUsedFragments(connKey, bufferedPacket.RPCID, bufferedPacket.LastUsedSeqNum)
-	}
-
 	// After processing any packet (public segment or fast-forwarded fragment), check for remaining buffered fragments
-	// This fixes the bug where fragments arrive after ProcessRemainingFragments was called but remain stuck in buffer
 	// Only process if verdict exists (was just stored or already existed) and is not dropped
+	connKey := bufferedPacket.Source.String()
 	finalVerdict := existingVerdict
 	if verdictJustStored {
 		// Verdict was just stored, so it's Pass (drop verdicts return early)
 		finalVerdict = util.PacketVerdictPass
 	}
-	// After processing, forward any remaining buffered fragments that arrived while we were processing
-	if finalVerdict == util.PacketVerdictPass {
-		forwardBufferedFragments(conn, state, connKey, bufferedPacket.RPCID, bufferedPacket.PacketType, bufferedPacket, config)
+	// After processing, forward any remaining buffered fragments that arrived while we were processing.
+	// Packets passed through by the proxy mode are never buffered.
+	if finalVerdict == util.PacketVerdictPass && config.Mode.Processes(bufferedPacket.PacketType) {
+		forwardBufferedFragments(out, state, connKey, bufferedPacket.RPCID, bufferedPacket.PacketType, bufferedPacket, config)
 	}
 }
 
 // forwardBufferedFragments retrieves and forwards all remaining buffered fragments for an RPC.
 // ProcessRemainingFragments atomically returns all fragments and removes them from the buffer,
 // so a single call is sufficient.
-func forwardBufferedFragments(conn *net.UDPConn, state *ProxyState, connKey string, rpcID uint64, packetType util.PacketType, metadata *util.BufferedPacket, config *Config) {
+func forwardBufferedFragments(conn util.PacketWriter, state *ProxyState, connKey string, rpcID uint64, packetType util.PacketType, metadata *util.BufferedPacket, config *Config) {
 	fragments := state.packetBuffer.ProcessRemainingFragments(connKey, rpcID, packetType, metadata)
 	for _, fragment := range fragments {
 		if err := processFragmentViaFastForward(conn, state, fragment, config); err != nil {
@@ -405,7 +1081,7 @@ func forwardBufferedFragments(conn *net.UDPConn, state *ProxyState, connKey stri
 // tryForwardBufferedFragmentsFromRawPacket attempts to forward buffered fragments using raw packet data.
 // This is called when a packet fragment arrives but we're still waiting for more data.
 // If a verdict already exists for this RPC, we can forward any buffered fragments immediately.
-func tryForwardBufferedFragmentsFromRawPacket(conn *net.UDPConn, state *ProxyState, src *net.UDPAddr, data []byte, config *Config) {
+func tryForwardBufferedFragmentsFromRawPacket(conn util.PacketWriter, state *ProxyState, src *net.UDPAddr, data []byte, config *Config) {
 	dataPacket, err := state.packetBuffer.deserializePacket(data)
 	if err != nil {
 		return
@@ -425,13 +1101,31 @@ func tryForwardBufferedFragmentsFromRawPacket(conn *net.UDPConn, state *ProxySta
 		SrcIP:      dataPacket.SrcIP,
 		SrcPort:    dataPacket.SrcPort,
 	}
+	if config.SourceMode.FillsHeader() {
+		fillSourceAddress(metadata, src)
+	}
+
+	// Follow the destination chosen by the element chain if the RPC was rerouted
+	if route := state.packetBuffer.GetRoute(dataPacket.RPCID, packetType); route != nil {
+		metadata.Peer = route
+		copy(metadata.DstIP[:], route.IP.To4())
+		metadata.DstPort = uint16(route.Port)
+	}
+	if state.rewriter != nil {
+		state.rewriter.RestoreResponse(metadata)
+		state.rewriter.RewriteRequest(metadata)
+	}
+	if state.gateway != nil {
+		state.gateway.RestoreResponse(metadata)
+		state.gateway.TranslateRequest(metadata)
+	}
 
 	forwardBufferedFragments(conn, state, connKey, dataPacket.RPCID, packetType, metadata, config)
 }
 
 // processFragmentViaFastForward processes a fragment via the fast-forward path.
 // It encrypts if needed, serializes it, and forwards it without element chain processing.
-func processFragmentViaFastForward(conn *net.UDPConn, state *ProxyState, fragment *util.BufferedPacket, config *Config) error {
+func processFragmentViaFastForward(conn util.PacketWriter, state *ProxyState, fragment *util.BufferedPacket, config *Config) error {
 	// Serialize and forward the fragment
 	fragmentedPackets, err := state.packetBuffer.FragmentPacketForForward(fragment)
 	if err != nil {
@@ -443,6 +1137,9 @@ func processFragmentViaFastForward(conn *net.UDPConn, state *ProxyState, fragmen
 		if _, err := conn.WriteToUDP(fp.Data, fp.Peer); err != nil {
 			return fmt.Errorf("WriteToUDP error: %w", err)
 		}
+		if state.timelines != nil {
+			state.timelines.RecordDatagram(TimelineFragmentSent, fp.Data, fp.Peer)
+		}
 	}
 
 	logging.Debug("Forwarded remaining fragment via fast-forward",
@@ -458,12 +1155,22 @@ func processFragmentViaFastForward(conn *net.UDPConn, state *ProxyState, fragmen
 // Stores the verdict for future fast forwarding of fragments with the same RPC ID.
 // Returns an error if processing fails or if the verdict is PacketVerdictDrop.
 func runElementsChain(ctx context.Context, state *ProxyState, packet *util.BufferedPacket) error {
-	// Get current element chain (may have been updated by plugin loader)
-	elementChain := GetElementChain()
+	// Get current element chain of the listener (may have been updated by plugin loader)
+	elementChain := acquireElementChain(ctx)
+	defer elementChain.release()
 	var err error
 	var processedPacket *util.BufferedPacket
 	var verdict util.PacketVerdict
 
+	// Remember the original destination (elements may modify the packet in place)
+	origDstIP, origDstPort := packet.DstIP, packet.DstPort
+
+	// Elements of an RPC aborted meanwhile have their context canceled (see RPCAborts)
+	aborted := func() bool { return false }
+	if state.aborts != nil {
+		ctx, aborted = state.aborts.begin(ctx, packet)
+	}
+
 	if elementChain == nil {
 		// No element chain available, pass through with Pass verdict
 		logging.Debug("No element chain available, passing packet through")
@@ -483,15 +1190,32 @@ func runElementsChain(ctx context.Context, state *ProxyState, packet *util.Buffe
 			verdict = util.PacketVerdictPass
 		}
 	}
+	// Nothing is forwarded for aborted RPCs, whatever the verdict
+	if aborted() {
+		verdict, err = util.PacketVerdictDrop, errRPCAborted
+	}
 
 	// Store the verdict for this RPC ID and packet type (to distinguish requests from responses)
-	// This is critical for fast-forwarding remaining fragments after public segment processing
-	state.packetBuffer.StoreVerdict(packet.RPCID, packet.PacketType, verdict)
+	// This is critical for fast-forwarding remaining fragments after public segment processing.
+	// If an element rewrote the destination, remember it so the remaining fragments follow the same route.
+	connKey := packet.Source.String()
+	if processedPacket != nil && (processedPacket.DstIP != origDstIP || processedPacket.DstPort != origDstPort) {
+		route := &net.UDPAddr{IP: net.IP(processedPacket.DstIP[:]), Port: int(processedPacket.DstPort)}
+		state.packetBuffer.Decide(connKey, packet.RPCID, packet.PacketType, verdict, route)
+	} else {
+		state.packetBuffer.Decide(connKey, packet.RPCID, packet.PacketType, verdict)
+	}
+	if state.timelines != nil {
+		state.timelines.RecordVerdict(packet.RPCID, packet.PacketType, verdict, err)
+	}
 
 	// Check verdict - if dropped, don't forward the packet
-	if verdict == util.PacketVerdictDrop || err != nil {
+	if err != nil {
 		return err
 	}
+	if verdict == util.PacketVerdictDrop {
+		return util.ErrDropped
+	}
 
 	// Update the packet with any changes made by the element chain
 	if processedPacket != nil {
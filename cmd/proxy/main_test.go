@@ -1,16 +1,34 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/element"
 	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/otlp"
 	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/schema"
+	"github.com/appnet-org/arpc/pkg/transport"
 )
 
 func init() {
@@ -211,219 +229,340 @@ func TestPacketProcessing_DropVerdict(t *testing.T) {
 	}
 }
 
-// TestLargeMessage_EndToEndSimulation simulates the full end-to-end flow
-// of processing a large fragmented message through the proxy.
-// This test creates a mock UDP connection to capture forwarded packets.
-func TestLargeMessage_EndToEndSimulation(t *testing.T) {
-	// Create proxy state
+// rerouteElement is a test element that rewrites the destination of requests
+type rerouteElement struct {
+	target *net.UDPAddr
+}
+
+func (e *rerouteElement) ProcessRequest(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	packet.Peer = e.target
+	copy(packet.DstIP[:], e.target.IP.To4())
+	packet.DstPort = uint16(e.target.Port)
+	return packet, util.PacketVerdictPass, ctx, nil
+}
+
+func (e *rerouteElement) ProcessResponse(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	return packet, util.PacketVerdictPass, ctx, nil
+}
+
+func (e *rerouteElement) Name() string {
+	return "rerouteElement"
+}
+
+// Test that a destination rewritten by an element is applied to later fragments of the same RPC
+func TestRunElementsChain_RerouteAppliesToLaterFragments(t *testing.T) {
+	target := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 7), Port: 7000}
+	currentElementChain.Store(NewRPCElementChain(&rerouteElement{target: target}))
+	defer currentElementChain.Store(NewRPCElementChain())
+
 	state := &ProxyState{
-		elementChain: NewRPCElementChain(), // Empty chain
-		packetBuffer: NewPacketBuffer(30 * time.Second),
+		packetBuffer: NewPacketBuffer(5 * time.Second),
 	}
 	defer state.packetBuffer.Close()
 
-	// Create a mock UDP connection for testing
-	serverAddr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
-	if err != nil {
-		t.Fatalf("Failed to resolve server address: %v", err)
+	src := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 9090}
+	rpcID := uint64(55555)
+	bufferedPacket := &util.BufferedPacket{
+		Payload:      []byte{1, 2, 3, 4, 5},
+		Source:       src,
+		Peer:         &net.UDPAddr{IP: net.IPv4(192, 168, 1, 1), Port: 8080},
+		PacketType:   util.PacketTypeRequest,
+		RPCID:        rpcID,
+		DstIP:        [4]byte{192, 168, 1, 1},
+		DstPort:      8080,
+		SrcIP:        [4]byte{192, 168, 1, 2},
+		SrcPort:      9090,
+		IsFull:       false,
+		SeqNumber:    -1,
+		TotalPackets: 2,
 	}
 
-	serverConn, err := net.ListenUDP("udp", serverAddr)
-	if err != nil {
-		t.Fatalf("Failed to create server connection: %v", err)
+	if err := runElementsChain(context.Background(), state, bufferedPacket); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
 	}
-	defer serverConn.Close()
 
-	// Create proxy listener
-	proxyAddr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
-	if err != nil {
-		t.Fatalf("Failed to resolve proxy address: %v", err)
+	route := state.packetBuffer.GetRoute(rpcID, util.PacketTypeRequest)
+	if route == nil || route.String() != target.String() {
+		t.Fatalf("Expected stored route %v, got %v", target, route)
 	}
 
-	proxyConn, err := net.ListenUDP("udp", proxyAddr)
+	// A later fragment still carries the original destination in its header
+	data := serializePacket(createDataPacket(rpcID, 1, 2, []byte{6, 7, 8}))
+	fragment, verdict, err := state.packetBuffer.ProcessPacket(data, src)
 	if err != nil {
-		t.Fatalf("Failed to create proxy connection: %v", err)
+		t.Fatalf("Error processing packet: %v", err)
 	}
-	defer proxyConn.Close()
+	if verdict != util.PacketVerdictPass {
+		t.Errorf("Expected PacketVerdictPass, got %v", verdict)
+	}
+	if fragment.Peer.String() != target.String() {
+		t.Errorf("Expected fragment peer %v, got %v", target, fragment.Peer)
+	}
+	if fragment.DstIP != [4]byte{10, 0, 0, 7} || fragment.DstPort != 7000 {
+		t.Errorf("Expected fragment header destination 10.0.0.7:7000, got %v:%d", fragment.DstIP, fragment.DstPort)
+	}
+}
 
-	// Create a large Symphony-format payload
-	keySize := 61
-	valueSize := 10000 // 10KB for faster testing
-	fullPayload := createLargeSymphonyPayloadForMainTest(keySize, valueSize)
+// silentDropElement drops requests without an error
+type silentDropElement struct{}
 
-	t.Logf("Full payload size: %d bytes", len(fullPayload))
+func (e *silentDropElement) ProcessRequest(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	return nil, util.PacketVerdictDrop, ctx, nil
+}
 
-	// Fragment the payload
-	mtu := packet.MaxUDPPayloadSize - DataPacketHeaderSize // 1369
-	fragmentPayloads := fragmentPayloadForMainTest(fullPayload, mtu)
-	totalPackets := uint16(len(fragmentPayloads))
+func (e *silentDropElement) ProcessResponse(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	return packet, util.PacketVerdictPass, ctx, nil
+}
 
-	t.Logf("Total fragments: %d", totalPackets)
+func (e *silentDropElement) Name() string {
+	return "silentDropElement"
+}
 
-	// Get server's actual address for routing
-	serverActualAddr := serverConn.LocalAddr().(*net.UDPAddr)
-	t.Logf("Server address: %s", serverActualAddr.String())
+// Test that the client is sent an error packet for a request an element dropped without an error
+func TestHandlePacket_SilentDropNotifiesClient(t *testing.T) {
+	currentElementChain.Store(NewRPCElementChain(&silentDropElement{}))
+	defer currentElementChain.Store(NewRPCElementChain())
 
-	// Create DataPackets with server address as destination
-	codec := &packet.DataPacketCodec{}
-	rpcID := uint64(999888777)
-	src := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	client, proxyConn := listen(), listen()
+	clientAddr := client.LocalAddr().(*net.UDPAddr)
+	state := &ProxyState{packetBuffer: NewPacketBuffer(5 * time.Second)}
+	defer state.packetBuffer.Close()
 
-	var dstIP [4]byte
-	copy(dstIP[:], serverActualAddr.IP.To4())
-	dstPort := uint16(serverActualAddr.Port)
+	rpcID := uint64(99401)
+	request := createDataPacket(rpcID, 0, 1, createPayloadWithOffset(20, 0))
+	request.DstIP, request.DstPort = [4]byte{127, 0, 0, 1}, 9
+	copy(request.SrcIP[:], clientAddr.IP.To4())
+	request.SrcPort = uint16(clientAddr.Port)
+	handlePacket(context.Background(), proxyConn, state, clientAddr, serializePacket(request), DefaultConfig(), time.Now())
 
-	// Channel to signal when test is complete
-	done := make(chan struct{})
-	receivedFragments := make(map[uint16]bool)
-	var mu sync.Mutex
+	buf := make([]byte, DefaultBufferSize)
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatalf("No error packet received: %v", err)
+	}
+	decoded, err := (&packet.ErrorPacketCodec{}).Deserialize(buf[:n])
+	if err != nil {
+		t.Fatalf("Expected an error packet: %v", err)
+	}
+	errorPacket := decoded.(*packet.ErrorPacket)
+	if errorPacket.RPCID != rpcID || errorPacket.DropReason != packet.DropReasonPolicyDenied {
+		t.Errorf("Expected RPC %d dropped for policy_denied, got %d %v", rpcID, errorPacket.RPCID, errorPacket.DropReason)
+	}
+	if errorPacket.DstPort != uint16(clientAddr.Port) {
+		t.Errorf("Expected the error packet addressed to the client, got port %d", errorPacket.DstPort)
+	}
+}
 
-	// Start a goroutine to receive packets at the server
-	go func() {
-		buf := make([]byte, 2048)
-		for {
-			select {
-			case <-done:
-				return
-			default:
-				serverConn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
-				n, _, err := serverConn.ReadFromUDP(buf)
-				if err != nil {
-					continue
-				}
+// corruptResponseElement drops every response as malformed
+type corruptResponseElement struct{}
 
-				// Deserialize the received packet
-				packetAny, err := codec.Deserialize(buf[:n])
-				if err != nil {
-					t.Logf("Failed to deserialize received packet: %v", err)
-					continue
-				}
+func (e *corruptResponseElement) ProcessRequest(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	return packet, util.PacketVerdictPass, ctx, nil
+}
 
-				dataPkt, ok := packetAny.(*packet.DataPacket)
-				if !ok {
-					continue
-				}
+func (e *corruptResponseElement) ProcessResponse(ctx context.Context, p *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	return nil, util.PacketVerdictDrop, ctx, util.NewDropError(packet.DropReasonMalformedPayload, "corrupt response")
+}
 
-				mu.Lock()
-				receivedFragments[dataPkt.SeqNumber] = true
-				t.Logf("Server received fragment %d (total: %d)", dataPkt.SeqNumber, dataPkt.TotalPackets)
-				mu.Unlock()
-			}
-		}
-	}()
+func (e *corruptResponseElement) Name() string {
+	return "corruptResponseElement"
+}
 
-	// Process each fragment through the proxy
-	for i, fragPayload := range fragmentPayloads {
-		pkt := &packet.DataPacket{
-			PacketTypeID:  packet.PacketTypeRequest.TypeID,
-			RPCID:         rpcID,
-			TotalPackets:  totalPackets,
-			SeqNumber:     uint16(i),
-			MoreFragments: false,
-			FragmentIndex: 0,
-			DstIP:         dstIP,
-			DstPort:       dstPort,
-			SrcIP:         [4]byte{127, 0, 0, 1},
-			SrcPort:       12345,
-			Payload:       fragPayload,
-		}
+// Test that the error packet of a response an element dropped goes to the client waiting for
+// it, not back to the server
+func TestHandlePacket_DroppedResponseNotifiesClient(t *testing.T) {
+	currentElementChain.Store(NewRPCElementChain(&corruptResponseElement{}))
+	defer currentElementChain.Store(NewRPCElementChain())
 
-		data, err := codec.Serialize(pkt, nil)
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
 		if err != nil {
-			t.Fatalf("Failed to serialize fragment %d: %v", i, err)
+			t.Fatalf("Failed to listen: %v", err)
 		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	client, server, proxyConn := listen(), listen(), listen()
+	clientAddr, serverAddr := client.LocalAddr().(*net.UDPAddr), server.LocalAddr().(*net.UDPAddr)
+	state := &ProxyState{packetBuffer: NewPacketBuffer(5 * time.Second)}
+	defer state.packetBuffer.Close()
 
-		// Simulate handlePacket
-		bufferedPacket, existingVerdict, err := state.packetBuffer.ProcessPacket(data, src)
+	rpcID := uint64(99402)
+	response := createDataPacket(rpcID, 0, 1, createPayloadWithOffset(20, 0))
+	response.PacketTypeID = packet.PacketTypeResponse.TypeID
+	copy(response.SrcIP[:], serverAddr.IP.To4())
+	response.SrcPort = uint16(serverAddr.Port)
+	copy(response.DstIP[:], clientAddr.IP.To4())
+	response.DstPort = uint16(clientAddr.Port)
+	handlePacket(context.Background(), proxyConn, state, serverAddr, serializePacket(response), DefaultConfig(), time.Now())
+
+	buf := make([]byte, DefaultBufferSize)
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatalf("No error packet received by the client: %v", err)
+	}
+	decoded, err := (&packet.ErrorPacketCodec{}).Deserialize(buf[:n])
+	if err != nil {
+		t.Fatalf("Expected an error packet: %v", err)
+	}
+	errorPacket := decoded.(*packet.ErrorPacket)
+	if errorPacket.RPCID != rpcID || errorPacket.DropReason != packet.DropReasonMalformedPayload {
+		t.Errorf("Expected RPC %d dropped for malformed_payload, got %d %v", rpcID, errorPacket.RPCID, errorPacket.DropReason)
+	}
+	if errorPacket.DstPort != uint16(clientAddr.Port) || errorPacket.SrcPort != uint16(serverAddr.Port) {
+		t.Errorf("Expected the error packet from the server to the client, got ports %d -> %d", errorPacket.SrcPort, errorPacket.DstPort)
+	}
+
+	server.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := server.Read(buf); err == nil {
+		t.Error("Expected nothing sent back to the server")
+	}
+}
+
+// Test that the proxy counts itself as a hop of requests, and drops those past the hop limit
+// with a loop_detected error packet
+func TestHandlePacket_LoopDetected(t *testing.T) {
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
 		if err != nil {
-			t.Fatalf("Error processing fragment %d: %v", i, err)
+			t.Fatalf("Failed to listen: %v", err)
 		}
-
-		if bufferedPacket == nil {
-			// Still buffering
-			t.Logf("Fragment %d: buffering", i)
-			// Try to forward any buffered fragments if verdict exists
-			continue
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	client, server, proxyConn := listen(), listen(), listen()
+	clientAddr, serverAddr := client.LocalAddr().(*net.UDPAddr), server.LocalAddr().(*net.UDPAddr)
+	state := &ProxyState{packetBuffer: NewPacketBuffer(5 * time.Second)}
+	defer state.packetBuffer.Close()
+	config := DefaultConfig()
+	read := func(conn *net.UDPConn) []byte {
+		buf := make([]byte, DefaultBufferSize)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("No packet received: %v", err)
 		}
+		return buf[:n]
+	}
+	send := func(rpcID uint64, hops uint8) {
+		request := createDataPacket(rpcID, 0, 1, createPayloadWithOffset(20, 0))
+		copy(request.DstIP[:], serverAddr.IP.To4())
+		request.DstPort = uint16(serverAddr.Port)
+		copy(request.SrcIP[:], clientAddr.IP.To4())
+		request.SrcPort = uint16(clientAddr.Port)
+		origin := packet.Origin{ID: 7, Hops: hops}
+		request.SetExtension(packet.ExtensionOrigin, origin.Value())
+		handlePacket(context.Background(), proxyConn, state, clientAddr, serializePacket(request), config, time.Now())
+	}
 
-		t.Logf("Fragment %d: got buffered packet (SeqNumber=%d, verdict=%v)",
-			i, bufferedPacket.SeqNumber, existingVerdict)
+	send(99501, uint8(config.MaxHops-1))
+	decoded, err := (&packet.DataPacketCodec{}).Deserialize(read(server))
+	if err != nil {
+		t.Fatalf("Expected the request to be forwarded: %v", err)
+	}
+	if origin, ok := packet.FindOrigin(decoded.(*packet.DataPacket).Extensions); !ok || origin != (packet.Origin{ID: 7, Hops: uint8(config.MaxHops)}) {
+		t.Errorf("Expected the proxy counted as a hop, got %+v (%t)", origin, ok)
+	}
 
-		// If this is the public segment extraction (SeqNumber == -1)
-		if bufferedPacket.SeqNumber == -1 && existingVerdict == util.PacketVerdictUnknown {
-			// Split the payload into public and private segments (like handlePacket does)
-			payload := bufferedPacket.Payload
-			if len(payload) > offsetToPrivate(payload) {
-				publicPayload := payload[:offsetToPrivate(payload)]
-				bufferedPacket.Payload = publicPayload
-			}
-			// Process through element chain (empty chain, so just pass)
-			err := runElementsChain(context.Background(), state, bufferedPacket)
-			if err != nil {
-				t.Fatalf("Error in element chain: %v", err)
-			}
+	dropsBefore := loopDrops.Load()
+	send(99502, uint8(config.MaxHops))
+	decoded, err = (&packet.ErrorPacketCodec{}).Deserialize(read(client))
+	if err != nil {
+		t.Fatalf("Expected an error packet: %v", err)
+	}
+	if errorPacket := decoded.(*packet.ErrorPacket); errorPacket.RPCID != 99502 || errorPacket.DropReason != packet.DropReasonLoopDetected {
+		t.Errorf("Expected RPC 99502 dropped for loop_detected, got %d %v", errorPacket.RPCID, errorPacket.DropReason)
+	}
+	if drops := loopDrops.Load() - dropsBefore; drops != 1 {
+		t.Errorf("Expected 1 loop drop, got %d", drops)
+	}
+}
 
-			// Fragment and forward
-			fragments, err := state.packetBuffer.FragmentPacketForForward(bufferedPacket)
-			if err != nil {
-				t.Fatalf("Error fragmenting for forward: %v", err)
-			}
+// replyElement is a shared element answering every request with a fixed response
+type replyElement struct {
+	response []byte
+}
 
-			for _, frag := range fragments {
-				_, err := proxyConn.WriteToUDP(frag.Data, frag.Peer)
-				if err != nil {
-					t.Logf("Error forwarding fragment: %v", err)
-				}
-			}
+func (e *replyElement) ProcessRequest(ctx context.Context, msg *element.Message) (*element.Message, element.Verdict, context.Context, error) {
+	msg.Payload = e.response
+	return msg, element.VerdictReply, ctx, nil
+}
 
-			// Cleanup and forward remaining
-			connKey := src.String()
-			state.packetBuffer.CleanupUsedFragments(connKey, bufferedPacket.RPCID, bufferedPacket.LastUsedSeqNum)
-
-			// Forward remaining buffered fragments
-			remaining := state.packetBuffer.ProcessRemainingFragments(
-				connKey, bufferedPacket.RPCID, bufferedPacket.PacketType, bufferedPacket)
-			for _, rem := range remaining {
-				remFrags, err := state.packetBuffer.FragmentPacketForForward(rem)
-				if err != nil {
-					t.Logf("Error fragmenting remaining: %v", err)
-					continue
-				}
-				for _, rf := range remFrags {
-					proxyConn.WriteToUDP(rf.Data, rf.Peer)
-				}
+func (e *replyElement) ProcessResponse(ctx context.Context, msg *element.Message) (*element.Message, element.Verdict, context.Context, error) {
+	return msg, element.VerdictPass, ctx, nil
+}
+
+func (e *replyElement) Name() string { return "reply" }
+
+// Test that the response an element answered a request with is fragmented and sent to the
+// client as if from the server, and that the request is not forwarded
+func TestHandlePacket_LocalReply(t *testing.T) {
+	for _, size := range []int{100, 3 * packet.MaxUDPPayloadSize} {
+		response := createPayloadWithOffset(20, size-20)
+		currentElementChain.Store(NewRPCElementChain(AdaptElement(&replyElement{response: response})))
+
+		listen := func() *net.UDPConn {
+			conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				t.Fatalf("Failed to listen: %v", err)
+			}
+			t.Cleanup(func() { conn.Close() })
+			return conn
+		}
+		client, server, proxyConn := listen(), listen(), listen()
+		clientAddr, serverAddr := client.LocalAddr().(*net.UDPAddr), server.LocalAddr().(*net.UDPAddr)
+		state := &ProxyState{packetBuffer: NewPacketBuffer(5 * time.Second)}
+		defer state.packetBuffer.Close()
+
+		rpcID := uint64(99601 + size)
+		request := createDataPacket(rpcID, 0, 1, createPayloadWithOffset(20, 0))
+		copy(request.DstIP[:], serverAddr.IP.To4())
+		request.DstPort = uint16(serverAddr.Port)
+		copy(request.SrcIP[:], clientAddr.IP.To4())
+		request.SrcPort = uint16(clientAddr.Port)
+		handlePacket(context.Background(), proxyConn, state, clientAddr, serializePacket(request), DefaultConfig(), time.Now())
+
+		var received []byte
+		buf := make([]byte, DefaultBufferSize)
+		for len(received) < len(response) {
+			client.SetReadDeadline(time.Now().Add(time.Second))
+			n, err := client.Read(buf)
+			if err != nil {
+				t.Fatalf("Size %d: no response received: %v", size, err)
 			}
-		} else if existingVerdict == util.PacketVerdictPass {
-			// Fast-forward
-			fragments, err := state.packetBuffer.FragmentPacketForForward(bufferedPacket)
+			decoded, err := (&packet.DataPacketCodec{}).Deserialize(buf[:n])
 			if err != nil {
-				t.Logf("Error fragmenting fast-forward: %v", err)
-				continue
+				t.Fatalf("Size %d: expected a data packet: %v", size, err)
 			}
-			for _, frag := range fragments {
-				proxyConn.WriteToUDP(frag.Data, frag.Peer)
+			fragment := decoded.(*packet.DataPacket)
+			if fragment.PacketTypeID != packet.PacketTypeResponse.TypeID || fragment.RPCID != rpcID {
+				t.Fatalf("Size %d: expected a response of RPC %d, got type %d of RPC %d", size, rpcID, fragment.PacketTypeID, fragment.RPCID)
 			}
+			if fragment.SrcPort != uint16(serverAddr.Port) || fragment.DstPort != uint16(clientAddr.Port) {
+				t.Errorf("Size %d: expected a response from the server to the client, got %d -> %d", size, fragment.SrcPort, fragment.DstPort)
+			}
+			received = append(received, fragment.Payload...)
+		}
+		if !bytes.Equal(received, response) {
+			t.Errorf("Size %d: expected the response of the element, got %d bytes", size, len(received))
 		}
-	}
-
-	// Wait a bit for all packets to be received
-	time.Sleep(500 * time.Millisecond)
-	close(done)
-
-	// Check how many fragments were received
-	mu.Lock()
-	receivedCount := len(receivedFragments)
-	mu.Unlock()
-
-	t.Logf("Total fragments received at server: %d/%d", receivedCount, totalPackets)
 
-	if receivedCount == 0 {
-		t.Error("No fragments were received at the server - proxy forwarding may be broken")
+		server.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		if _, err := server.Read(buf); err == nil {
+			t.Errorf("Size %d: expected the request not to be forwarded", size)
+		}
 	}
-
-	// Note: Due to the fragmentation/reassembly differences between client and proxy,
-	// the number of received fragments may not equal totalPackets.
-	// The key is that at least SOME data was forwarded.
+	currentElementChain.Store(NewRPCElementChain())
 }
 
 // createLargeSymphonyPayloadForMainTest creates a Symphony-format payload
@@ -609,8 +748,6 @@ func TestLargeMessage_FragmentZeroDelayed(t *testing.T) {
 	state.packetBuffer.StoreVerdict(rpcID, util.PacketTypeRequest, util.PacketVerdictPass)
 
 	connKey := src.String()
-	state.packetBuffer.CleanupUsedFragments(connKey, rpcID, result.LastUsedSeqNum)
-
 	remaining := state.packetBuffer.ProcessRemainingFragments(
 		connKey, rpcID, util.PacketTypeRequest, result)
 
@@ -781,3 +918,1666 @@ func TestSendErrorPacket_WithRoutingInfo(t *testing.T) {
 
 	t.Log("SendErrorPacket routing fields verified successfully")
 }
+
+// Test that error packets sent by the proxy carry the reason of the drop
+func TestSendErrorPacket_DropReason(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		reason packet.DropReason
+	}{
+		{fmt.Errorf("denied"), packet.DropReasonPolicyDenied},
+		{&util.ThrottleError{Err: fmt.Errorf("too many requests")}, packet.DropReasonRateLimited},
+		{fmt.Errorf("element: %w", util.NewDropError(packet.DropReasonAuthFailed, "bad token")), packet.DropReasonAuthFailed},
+	} {
+		if reason := util.DropReasonOf(tc.err); reason != tc.reason {
+			t.Errorf("Expected reason %v for %v, got %v", tc.reason, tc.err, reason)
+		}
+	}
+
+	proxyConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	defer proxyConn.Close()
+	client, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	defer client.Close()
+
+	clientAddr := client.LocalAddr().(*net.UDPAddr)
+	if err := util.SendErrorPacket(proxyConn, clientAddr, 9, "bad token", [4]byte{127, 0, 0, 1}, uint16(clientAddr.Port), [4]byte{}, 0, packet.RetryHint{}, packet.DropReasonAuthFailed); err != nil {
+		t.Fatalf("SendErrorPacket failed: %v", err)
+	}
+	buf := make([]byte, 2048)
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatalf("No error packet received: %v", err)
+	}
+	decoded, err := (&packet.ErrorPacketCodec{}).Deserialize(buf[:n])
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	if errPacket := decoded.(*packet.ErrorPacket); errPacket.RPCID != 9 || errPacket.DropReason != packet.DropReasonAuthFailed {
+		t.Errorf("Expected RPC 9 dropped for auth_failed, got %d %v", errPacket.RPCID, errPacket.DropReason)
+	}
+}
+
+// Test that the slow query log matches responses to requests and forgets them afterwards
+func TestSlowQueryLog_RequestResponse(t *testing.T) {
+	log := NewSlowQueryLog(time.Nanosecond, time.Minute)
+
+	payload := createPayloadWithOffset(20, 0)
+	request := &util.BufferedPacket{RPCID: 4242, PacketType: util.PacketTypeRequest, Payload: payload, TotalPackets: 1}
+	response := &util.BufferedPacket{RPCID: 4242, PacketType: util.PacketTypeResponse, Payload: payload, TotalPackets: 1}
+
+	log.RecordRequest(request, 0, []ElementTiming{{Name: "test", Phase: "request", Duration: time.Millisecond}})
+	if len(log.pending) != 1 {
+		t.Fatalf("Expected 1 pending RPC, got %d", len(log.pending))
+	}
+
+	log.RecordResponse(response, 0, nil)
+	if len(log.pending) != 0 {
+		t.Errorf("Expected no pending RPCs after response, got %d", len(log.pending))
+	}
+
+	// A response without a recorded request is ignored
+	log.RecordResponse(response, 0, nil)
+}
+
+// Test that size stats attribute multi-packet requests and their responses to the request's method
+func TestSizeStats_HistogramsAndLargest(t *testing.T) {
+	stats := NewSizeStats(2, time.Minute, 100, 1000)
+	src := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 9000}
+
+	header := make([]byte, 13)
+	binary.LittleEndian.PutUint32(header[5:9], 7)
+	binary.LittleEndian.PutUint32(header[9:13], 3)
+
+	for rpcID, size := range map[uint64]int{1: 50, 2: 400, 3: 1200} {
+		// The public segment is processed after the first packet, before the last one arrives
+		first := &packet.DataPacket{PacketTypeID: packet.PacketTypeRequest.TypeID, RPCID: rpcID, TotalPackets: 2, SeqNumber: 0, Payload: make([]byte, size/2)}
+		stats.RecordPacket(first, src)
+		stats.RecordMethod(&util.BufferedPacket{RPCID: rpcID, PacketType: util.PacketTypeRequest, Payload: header})
+		last := &packet.DataPacket{PacketTypeID: packet.PacketTypeRequest.TypeID, RPCID: rpcID, TotalPackets: 2, SeqNumber: 1, Payload: make([]byte, size-size/2)}
+		stats.RecordPacket(last, src)
+	}
+
+	// The response is complete before its public segment is processed; it carries no IDs
+	response := &packet.DataPacket{PacketTypeID: packet.PacketTypeResponse.TypeID, RPCID: 3, TotalPackets: 1, Payload: make([]byte, 30)}
+	stats.RecordPacket(response, src)
+	stats.RecordMethod(&util.BufferedPacket{RPCID: 3, PacketType: util.PacketTypeResponse, Payload: header[:1]})
+
+	snapshot := stats.Snapshot()
+	if len(snapshot.Methods) != 2 {
+		t.Fatalf("Expected request and response series, got %+v", snapshot.Methods)
+	}
+	request := snapshot.Methods[0]
+	if request.ServiceID != 7 || request.MethodID != 3 || request.PacketType != "REQUEST" {
+		t.Errorf("Unexpected request series %+v", request)
+	}
+	if request.Count != 3 || request.SumBytes != 1650 || request.MaxBytes != 1200 {
+		t.Errorf("Unexpected request totals %+v", request)
+	}
+	expectedBuckets := []SizeBucket{{"100", 1}, {"1000", 2}, {"+Inf", 3}}
+	for i, bucket := range expectedBuckets {
+		if request.Buckets[i] != bucket {
+			t.Errorf("Bucket %d: expected %+v, got %+v", i, bucket, request.Buckets[i])
+		}
+	}
+	if response := snapshot.Methods[1]; response.PacketType != "RESPONSE" || response.MethodID != 3 || response.Count != 1 {
+		t.Errorf("Unexpected response series %+v", response)
+	}
+
+	if len(snapshot.Largest) != 2 || snapshot.Largest[0].RPCID != 3 || snapshot.Largest[1].RPCID != 2 {
+		t.Fatalf("Expected RPCs 3 and 2 as the largest, got %+v", snapshot.Largest)
+	}
+	if snapshot.Largest[0].Bytes != 1200 || snapshot.Largest[0].Source != src.String() {
+		t.Errorf("Unexpected largest RPC %+v", snapshot.Largest[0])
+	}
+	// Only the requests without a response are still waiting
+	if len(stats.pending) != 0 || len(stats.rpcMethods) != 2 {
+		t.Errorf("Expected 0 pending RPCs and 2 request methods, got %d and %d", len(stats.pending), len(stats.rpcMethods))
+	}
+}
+
+// Test that the timeline of an RPC records its datagrams, elements and verdict in order
+func TestTimelines_HandlePacket(t *testing.T) {
+	var log []string
+	currentElementChain.Store(NewRPCElementChain(&orderElement{"a", &log}))
+	defer currentElementChain.Store(NewRPCElementChain())
+
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	server, proxyConn := listen(), listen()
+	serverAddr := server.LocalAddr().(*net.UDPAddr)
+	clientAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9}
+	state := &ProxyState{packetBuffer: NewPacketBuffer(5 * time.Second), timelines: NewTimelines(2, 5)}
+	defer state.packetBuffer.Close()
+
+	rpcID := uint64(99501)
+	for seq := range uint16(2) {
+		request := createDataPacket(rpcID, seq, 2, createPayloadWithOffset(20, 0))
+		request.DstIP, request.DstPort = [4]byte{127, 0, 0, 1}, uint16(serverAddr.Port)
+		handlePacket(context.Background(), proxyConn, state, clientAddr, serializePacket(request), DefaultConfig(), time.Now())
+	}
+
+	timeline, ok := state.timelines.Timeline(rpcID)
+	if !ok {
+		t.Fatal("Expected a timeline for the RPC")
+	}
+	expected := []TimelineEventKind{TimelineFragmentReceived, TimelineElementEnter, TimelineElementExit, TimelineVerdict, TimelineFragmentSent}
+	if len(timeline.Events) != len(expected) || timeline.Truncated == 0 {
+		t.Fatalf("Expected %d events and truncated ones, got %d and %d truncated: %+v", len(expected), len(timeline.Events), timeline.Truncated, timeline.Events)
+	}
+	for i, kind := range expected {
+		if timeline.Events[i].Kind != kind {
+			t.Errorf("Event %d: expected %v, got %+v", i, kind, timeline.Events[i])
+		}
+	}
+	if received := timeline.Events[0]; received.Seq == nil || *received.Seq != 0 || received.Peer != clientAddr.String() || received.PacketType != "REQUEST" {
+		t.Errorf("Unexpected received event %+v", received)
+	}
+	if exit := timeline.Events[2]; exit.Element != "a" || exit.Verdict != eventVerdict(util.PacketVerdictPass) {
+		t.Errorf("Unexpected element exit %+v", exit)
+	}
+	if sent := timeline.Events[4]; sent.Peer != serverAddr.String() {
+		t.Errorf("Expected the request sent to %v, got %+v", serverAddr, sent)
+	}
+
+	// The admin API serves timelines by RPC ID; older RPCs are evicted by newer ones
+	admin := newAdminMux(state)
+	recorder := httptest.NewRecorder()
+	admin.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/rpcs?id="+strconv.FormatUint(rpcID, 10), nil))
+	var served struct {
+		RPCID  uint64            `json:"rpcID"`
+		Events []json.RawMessage `json:"events"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &served); recorder.Code != http.StatusOK || err != nil || served.RPCID != rpcID || len(served.Events) != len(expected) {
+		t.Fatalf("Unexpected response %d: %s", recorder.Code, recorder.Body)
+	}
+	if !strings.Contains(recorder.Body.String(), `"kind":"element_enter"`) {
+		t.Errorf("Expected event kinds by name, got %s", recorder.Body)
+	}
+	state.timelines.RecordVerdict(1, util.PacketTypeRequest, util.PacketVerdictPass, nil)
+	state.timelines.RecordVerdict(2, util.PacketTypeRequest, util.PacketVerdictPass, nil)
+	if _, ok := state.timelines.Timeline(rpcID); ok {
+		t.Error("Expected the oldest RPC to be evicted")
+	}
+	if recent := state.timelines.Recent(); len(recent) != 2 || recent[0].RPCID != 2 {
+		t.Errorf("Expected RPCs 2 and 1, most recent first, got %+v", recent)
+	}
+	recorder = httptest.NewRecorder()
+	admin.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/rpcs?id="+strconv.FormatUint(rpcID, 10), nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an evicted RPC, got %d", recorder.Code)
+	}
+}
+
+// Test parsing of port lists, ranges, roles and element prefixes
+func TestParseListeners(t *testing.T) {
+	listeners, err := ParseListeners("15002:outbound, 16000-16002:inbound:element-edge-,17000")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []ListenerConfig{
+		{Port: 15002, Role: util.PortRoleOutbound},
+		{Port: 16000, Role: util.PortRoleInbound, ElementPrefix: "element-edge-"},
+		{Port: 16001, Role: util.PortRoleInbound, ElementPrefix: "element-edge-"},
+		{Port: 16002, Role: util.PortRoleInbound, ElementPrefix: "element-edge-"},
+		{Port: 17000, Role: util.PortRoleAny},
+	}
+	if len(listeners) != len(expected) {
+		t.Fatalf("Expected %d listeners, got %v", len(expected), listeners)
+	}
+	for i, l := range expected {
+		if listeners[i] != l {
+			t.Errorf("Listener %d: expected %v, got %v", i, l, listeners[i])
+		}
+	}
+	if s := listeners[1].String(); s != "16000:inbound:element-edge-" {
+		t.Errorf("Unexpected listener string %q", s)
+	}
+
+	for _, spec := range []string{"", "0", "70000", "abc", "15002:sideways", "16002-16000", "1-2000", "15002:inbound:a:b", "15002,15000-15005"} {
+		if _, err := ParseListeners(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+// Test that packets of a listener with its own element loader run through the loader's chain
+func TestRunElementsChain_ListenerElementChain(t *testing.T) {
+	target := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 8), Port: 8000}
+	loader := &ElementLoader{chain: &atomic.Value{}}
+	loader.chain.Store(NewRPCElementChain(&rerouteElement{target: target}))
+
+	state := &ProxyState{
+		packetBuffer: NewPacketBuffer(5 * time.Second),
+	}
+	defer state.packetBuffer.Close()
+
+	listener := ListenerConfig{Port: 16000, Role: util.PortRoleInbound, ElementPrefix: "element-edge-"}
+	ctx := withListener(context.Background(), listener, loader)
+	if role := util.PortRoleFromContext(ctx); role != util.PortRoleInbound {
+		t.Errorf("Expected role inbound, got %v", role)
+	}
+
+	bufferedPacket := &util.BufferedPacket{
+		Payload:      []byte{1, 2, 3, 4, 5},
+		Peer:         &net.UDPAddr{IP: net.IPv4(192, 168, 1, 1), Port: 8080},
+		PacketType:   util.PacketTypeRequest,
+		RPCID:        66666,
+		SeqNumber:    -1,
+		TotalPackets: 1,
+	}
+	if err := runElementsChain(ctx, state, bufferedPacket); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if bufferedPacket.Peer.String() != target.String() {
+		t.Errorf("Expected the listener chain to reroute to %v, got %v", target, bufferedPacket.Peer)
+	}
+
+	// Without a listener loader, the default chain is used
+	if elementChainFor(util.WithPortRole(context.Background(), util.PortRoleOutbound)) != GetElementChain() {
+		t.Errorf("Expected the default element chain")
+	}
+}
+
+// Test that plugins without a valid signature are not loaded, and that loaded modules are
+// exported by digest
+func TestElementLoader_PluginVerification(t *testing.T) {
+	_, private, _ := ed25519.GenerateKey(nil)
+	public, _, _ := ed25519.GenerateKey(nil)
+	SetPluginVerifier(element.NewSignatureVerifier(public))
+	defer SetPluginVerifier(nil)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "element-acl.so")
+	os.WriteFile(path, []byte("element plugin build"), 0o644)
+	os.WriteFile(path+element.SignatureSuffix, ed25519.Sign(private, []byte("element plugin build")), 0o644)
+
+	rejected := rejectedPlugins.Load()
+	loader := &ElementLoader{prefix: filepath.Join(dir, "element-"), chain: &atomic.Value{}}
+	loader.update()
+	if loader.highestFile != "element-acl.so" {
+		t.Errorf("Expected the signature file to be skipped, got %s", loader.highestFile)
+	}
+	if rejectedPlugins.Load() != rejected+1 || loader.Element() != nil || loader.Chain() == nil {
+		t.Errorf("Expected the plugin to be rejected with an empty chain")
+	}
+
+	loader.module, _ = element.ReadModule(path, nil)
+	listenerLoadersMu.Lock()
+	listenerLoaders[loader.prefix] = loader
+	listenerLoadersMu.Unlock()
+	defer func() {
+		listenerLoadersMu.Lock()
+		delete(listenerLoaders, loader.prefix)
+		listenerLoadersMu.Unlock()
+	}()
+	var b strings.Builder
+	if _, err := writePluginMetrics(&b); err != nil {
+		t.Fatalf("writePluginMetrics failed: %v", err)
+	}
+	for _, want := range []string{
+		fmt.Sprintf(`arpc_proxy_element_plugin_info{prefix="%s",plugin="element-acl.so",digest="%s",verified="false"} 1`, loader.prefix, loader.module.Digest),
+		fmt.Sprintf("arpc_proxy_element_plugins_rejected_total %d", rejected+1),
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("Metrics lack %s:\n%s", want, b.String())
+		}
+	}
+}
+
+// orderElement appends its name to a log in the pipelines it implements
+type orderElement struct {
+	name string
+	log  *[]string
+}
+
+func (e *orderElement) ProcessRequest(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	*e.log = append(*e.log, "request:"+e.name)
+	return packet, util.PacketVerdictPass, ctx, nil
+}
+
+func (e *orderElement) ProcessResponse(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	*e.log = append(*e.log, "response:"+e.name)
+	return packet, util.PacketVerdictPass, ctx, nil
+}
+
+func (e *orderElement) Name() string {
+	return e.name
+}
+
+// Test the order of the request and response pipelines of both chain constructors
+func TestRPCElementChain_Pipelines(t *testing.T) {
+	var log []string
+	a, b, c := &orderElement{"a", &log}, &orderElement{"b", &log}, &orderElement{"c", &log}
+	ctx := context.Background()
+
+	chain := NewRPCElementChain(a, b)
+	chain.ProcessRequest(ctx, &util.BufferedPacket{})
+	chain.ProcessResponse(ctx, &util.BufferedPacket{})
+
+	pipelines := NewPipelineChain([]RequestElement{a}, []ResponseElement{b, c})
+	pipelines.ProcessRequest(ctx, &util.BufferedPacket{})
+	pipelines.ProcessResponse(ctx, &util.BufferedPacket{})
+
+	expected := []string{"request:a", "request:b", "response:b", "response:a", "request:a", "response:b", "response:c"}
+	if len(log) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, log)
+	}
+	for i := range expected {
+		if log[i] != expected[i] {
+			t.Errorf("Step %d: expected %s, got %s", i, expected[i], log[i])
+		}
+	}
+}
+
+// Test parsing of proxy modes and the pipelines they enable
+func TestProxyMode(t *testing.T) {
+	tests := []struct {
+		spec              string
+		mode              ProxyMode
+		request, response bool
+	}{
+		{"", ProxyModeBidirectional, true, true},
+		{"bidirectional", ProxyModeBidirectional, true, true},
+		{"Outbound", ProxyModeOutbound, true, false},
+		{"inbound", ProxyModeInbound, false, true},
+	}
+	for _, tt := range tests {
+		mode, err := ParseProxyMode(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseProxyMode(%q) failed: %v", tt.spec, err)
+		}
+		if mode != tt.mode {
+			t.Errorf("ParseProxyMode(%q): expected %s, got %s", tt.spec, tt.mode, mode)
+		}
+		if mode.Processes(util.PacketTypeRequest) != tt.request || mode.Processes(util.PacketTypeResponse) != tt.response {
+			t.Errorf("Mode %s: unexpected pipelines", mode)
+		}
+	}
+	if _, err := ParseProxyMode("sideways"); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+}
+
+// Test that the header source address is filled in only where the sender left it unspecified
+func TestFillSourceAddress(t *testing.T) {
+	src := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 5), Port: 41000}
+
+	unspecified := &util.BufferedPacket{SrcPort: 41000}
+	fillSourceAddress(unspecified, src)
+	if unspecified.SrcIP != [4]byte{10, 0, 0, 5} || unspecified.SrcPort != 41000 {
+		t.Errorf("Expected 10.0.0.5:41000, got %v:%d", unspecified.SrcIP, unspecified.SrcPort)
+	}
+
+	// An address set by the client or an upstream proxy is kept
+	preserved := &util.BufferedPacket{SrcIP: [4]byte{192, 168, 1, 2}, SrcPort: 9090}
+	fillSourceAddress(preserved, src)
+	if preserved.SrcIP != [4]byte{192, 168, 1, 2} || preserved.SrcPort != 9090 {
+		t.Errorf("Expected 192.168.1.2:9090 to be kept, got %v:%d", preserved.SrcIP, preserved.SrcPort)
+	}
+
+	if mode, err := ParseSourceMode(""); err != nil || mode != SourceModeProxy || mode.FillsHeader() {
+		t.Errorf("Expected the default source mode to leave headers unchanged, got %q, %v", mode, err)
+	}
+	if mode, err := ParseSourceMode("Transparent"); err != nil || !mode.FillsHeader() {
+		t.Errorf("Expected transparent mode to fill headers, got %q, %v", mode, err)
+	}
+	if _, err := ParseSourceMode("spoof"); err == nil {
+		t.Error("Expected error for unknown source mode")
+	}
+}
+
+// Test that transparent sockets are reused per sender, serve replies and fall back to the listener socket
+func TestTransparentSockets(t *testing.T) {
+	received := make(chan string, 1)
+	sockets := NewTransparentSockets(time.Minute, func(ctx context.Context, conn *net.UDPConn, src *net.UDPAddr, data []byte, recvTime time.Time) {
+		received <- string(data)
+	})
+	defer sockets.Close()
+	// Bind to a local port instead of the sender address, which would require CAP_NET_ADMIN
+	sockets.listen = func(addr *net.UDPAddr) (*net.UDPConn, error) {
+		if addr.Port == 1 {
+			return nil, fmt.Errorf("not permitted")
+		}
+		return net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	}
+
+	fallback, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer fallback.Close()
+
+	src := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 5), Port: 41000}
+	conn := sockets.SenderFor(context.Background(), src, fallback)
+	if conn == fallback {
+		t.Fatal("Expected a transparent socket")
+	}
+	if again := sockets.SenderFor(context.Background(), src, fallback); again != conn {
+		t.Error("Expected the socket of the sender to be reused")
+	}
+	if other := sockets.SenderFor(context.Background(), &net.UDPAddr{IP: net.IPv4(10, 0, 0, 5), Port: 1}, fallback); other != fallback {
+		t.Error("Expected the listener socket when binding fails")
+	}
+
+	// Replies addressed to the sender are handled like packets of a listener
+	if _, err := fallback.WriteToUDP([]byte("reply"), conn.(*net.UDPConn).LocalAddr().(*net.UDPAddr)); err != nil {
+		t.Fatalf("Failed to send reply: %v", err)
+	}
+	select {
+	case data := <-received:
+		if data != "reply" {
+			t.Errorf("Expected reply, got %q", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Reply was not handled")
+	}
+}
+
+// Test parsing of response rewrite rules
+func TestParseResponseRewrites(t *testing.T) {
+	rules, err := ParseResponseRewrites("10.0.1.0/24=10.0.0.2:15007, 10.0.2.5:8080=10.0.0.3:15008")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %v", rules)
+	}
+	if s := rules[0].String(); s != "10.0.1.0/24=10.0.0.2:15007" {
+		t.Errorf("Unexpected rule %q", s)
+	}
+	if s := rules[1].String(); s != "10.0.2.5/32:8080=10.0.0.3:15008" {
+		t.Errorf("Unexpected rule %q", s)
+	}
+	if !rules[0].matches([4]byte{10, 0, 1, 9}, 1234) || rules[0].matches([4]byte{10, 0, 2, 9}, 1234) {
+		t.Error("Unexpected match of the CIDR rule")
+	}
+	if !rules[1].matches([4]byte{10, 0, 2, 5}, 8080) || rules[1].matches([4]byte{10, 0, 2, 5}, 8081) {
+		t.Error("Unexpected match of the port rule")
+	}
+
+	for _, spec := range []string{"10.0.1.0/24", "10.0.1.0/33=10.0.0.2:15007", "10.0.1.0/24=10.0.0.2", "::1=10.0.0.2:15007", "10.0.1.1:0=10.0.0.2:15007"} {
+		if _, err := ParseResponseRewrites(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+// Test an asymmetric path end to end: the request leaves through one listener with its
+// source rewritten, and the server's response returns through another listener to the client
+func TestResponseRewrite_EndToEnd(t *testing.T) {
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+	client, server, requestListener, responseListener := listen(), listen(), listen(), listen()
+	clientAddr := client.LocalAddr().(*net.UDPAddr)
+	serverAddr := server.LocalAddr().(*net.UDPAddr)
+	responseAddr := responseListener.LocalAddr().(*net.UDPAddr)
+
+	rules, err := ParseResponseRewrites(fmt.Sprintf("%s=%s", serverAddr, responseAddr))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+	config := DefaultConfig()
+	state := &ProxyState{
+		elementChain: NewRPCElementChain(),
+		packetBuffer: NewPacketBuffer(5 * time.Second),
+		rewriter:     NewResponseRewriter(rules, time.Minute),
+	}
+	defer state.packetBuffer.Close()
+
+	codec := &packet.DataPacketCodec{}
+	header := func(from *net.UDPConn) (*packet.DataPacket, *net.UDPAddr) {
+		buf := make([]byte, DefaultBufferSize)
+		n, src, err := from.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		decoded, err := codec.Deserialize(buf[:n])
+		if err != nil {
+			t.Fatalf("Failed to deserialize: %v", err)
+		}
+		return decoded.(*packet.DataPacket), src
+	}
+	rpcID := uint64(99001)
+
+	// The client sends a request to the server, intercepted by the request listener
+	request := createDataPacket(rpcID, 0, 1, createPayloadWithOffset(20, 0))
+	copy(request.DstIP[:], serverAddr.IP.To4())
+	request.DstPort = uint16(serverAddr.Port)
+	copy(request.SrcIP[:], clientAddr.IP.To4())
+	request.SrcPort = uint16(clientAddr.Port)
+	handlePacket(context.Background(), requestListener, state, clientAddr, serializePacket(request), config, time.Now())
+
+	// The server sees the response listener as the client
+	forwarded, _ := header(server)
+	if forwarded.SrcIP != [4]byte{127, 0, 0, 1} || int(forwarded.SrcPort) != responseAddr.Port {
+		t.Fatalf("Expected the request source to be rewritten to %v, got %v:%d", responseAddr, forwarded.SrcIP, forwarded.SrcPort)
+	}
+
+	// The server answers to the source of the header, i.e. the response listener
+	response := createDataPacket(rpcID, 0, 1, createPayloadWithOffset(20, 0))
+	response.PacketTypeID = packet.PacketTypeResponse.TypeID
+	response.DstIP, response.DstPort = forwarded.SrcIP, forwarded.SrcPort
+	copy(response.SrcIP[:], serverAddr.IP.To4())
+	response.SrcPort = uint16(serverAddr.Port)
+	if _, err := server.WriteToUDP(serializePacket(response), responseAddr); err != nil {
+		t.Fatalf("Failed to send response: %v", err)
+	}
+	buf := make([]byte, DefaultBufferSize)
+	n, src, err := responseListener.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("Response did not arrive at the response listener: %v", err)
+	}
+	handlePacket(context.Background(), responseListener, state, src, buf[:n], config, time.Now())
+
+	// The client receives the response, addressed to itself, from the response listener
+	delivered, from := header(client)
+	if delivered.RPCID != rpcID || delivered.PacketTypeID != packet.PacketTypeResponse.TypeID {
+		t.Fatalf("Unexpected packet %+v", delivered)
+	}
+	if int(delivered.DstPort) != clientAddr.Port {
+		t.Errorf("Expected the response destination to be restored to %v, got port %d", clientAddr, delivered.DstPort)
+	}
+	if from.Port != responseAddr.Port {
+		t.Errorf("Expected the response to return via %v, got %v", responseAddr, from)
+	}
+}
+
+// Test parsing of gateway routes
+func TestParseGatewayRoutes(t *testing.T) {
+	routes, err := ParseGatewayRoutes("10.1.0.0/16=203.0.113.7:15010, 10.2.0.5=198.51.100.4:15011")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(routes) != 2 || routes[0].String() != "10.1.0.0/16=203.0.113.7:15010" || routes[1].String() != "10.2.0.5/32=198.51.100.4:15011" {
+		t.Errorf("Unexpected routes %v", routes)
+	}
+	for _, spec := range []string{"10.1.0.0/16", "10.1.0.0/16=203.0.113.7", "::1=203.0.113.7:15010", "10.1.0.0/40=203.0.113.7:15010"} {
+		if _, err := ParseGatewayRoutes(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+// Test a call across clusters: the request to a remote private address goes to the remote
+// gateway with the address of the local gateway as source, and the response coming back
+// to the local gateway is translated back to the client
+func TestGateway_EndToEnd(t *testing.T) {
+	listen := func(ip net.IP) *net.UDPConn {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: ip})
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+	loopback := net.IPv4(127, 0, 0, 1)
+	client, remoteGateway, localGateway := listen(loopback), listen(loopback), listen(loopback)
+	clientAddr := client.LocalAddr().(*net.UDPAddr)
+	remoteAddr := remoteGateway.LocalAddr().(*net.UDPAddr)
+	localAddr := localGateway.LocalAddr().(*net.UDPAddr)
+
+	// The server has a private address of the remote cluster, unreachable from here
+	routes, err := ParseGatewayRoutes(fmt.Sprintf("10.1.0.0/16=%s", remoteAddr))
+	if err != nil {
+		t.Fatalf("Failed to parse routes: %v", err)
+	}
+	config := DefaultConfig()
+	state := &ProxyState{
+		elementChain: NewRPCElementChain(),
+		packetBuffer: NewPacketBuffer(5 * time.Second),
+		gateway:      NewGateway(localAddr, routes, time.Minute),
+	}
+	defer state.packetBuffer.Close()
+
+	codec := &packet.DataPacketCodec{}
+	header := func(from *net.UDPConn) *packet.DataPacket {
+		buf := make([]byte, DefaultBufferSize)
+		n, _, err := from.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		decoded, err := codec.Deserialize(buf[:n])
+		if err != nil {
+			t.Fatalf("Failed to deserialize: %v", err)
+		}
+		return decoded.(*packet.DataPacket)
+	}
+	rpcID := uint64(99101)
+	server := [4]byte{10, 1, 2, 3}
+
+	request := createDataPacket(rpcID, 0, 1, createPayloadWithOffset(20, 0))
+	request.DstIP, request.DstPort = server, 9000
+	copy(request.SrcIP[:], clientAddr.IP.To4())
+	request.SrcPort = uint16(clientAddr.Port)
+	handlePacket(context.Background(), localGateway, state, clientAddr, serializePacket(request), config, time.Now())
+
+	forwarded := header(remoteGateway)
+	if forwarded.DstIP != server || forwarded.DstPort != 9000 {
+		t.Errorf("Expected the remote gateway to get the private destination, got %v:%d", forwarded.DstIP, forwarded.DstPort)
+	}
+	if int(forwarded.SrcPort) != localAddr.Port {
+		t.Fatalf("Expected the source to be translated to %v, got %v:%d", localAddr, forwarded.SrcIP, forwarded.SrcPort)
+	}
+
+	// The remote cluster answers to the header source, the local gateway
+	response := createDataPacket(rpcID, 0, 1, createPayloadWithOffset(20, 0))
+	response.PacketTypeID = packet.PacketTypeResponse.TypeID
+	response.DstIP, response.DstPort = forwarded.SrcIP, forwarded.SrcPort
+	response.SrcIP, response.SrcPort = server, 9000
+	handlePacket(context.Background(), localGateway, state, remoteAddr, serializePacket(response), config, time.Now())
+
+	delivered := header(client)
+	if delivered.RPCID != rpcID || delivered.PacketTypeID != packet.PacketTypeResponse.TypeID {
+		t.Fatalf("Unexpected packet %+v", delivered)
+	}
+	if int(delivered.DstPort) != clientAddr.Port || delivered.SrcIP != server {
+		t.Errorf("Expected the response from %v to the client %v, got %+v", server, clientAddr, delivered)
+	}
+
+	// Requests to this cluster are left alone
+	local := &util.BufferedPacket{PacketType: util.PacketTypeRequest, DstIP: [4]byte{10, 0, 0, 1}}
+	if state.gateway.TranslateRequest(local) {
+		t.Error("Expected a local destination not to be translated")
+	}
+}
+
+func TestRelay_EndToEnd(t *testing.T) {
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+	client, server, relayConn := listen(), listen(), listen()
+	clientAddr := client.LocalAddr().(*net.UDPAddr)
+	serverAddr := server.LocalAddr().(*net.UDPAddr)
+	relayAddr := relayConn.LocalAddr().(*net.UDPAddr)
+
+	secret := []byte("relay-secret")
+	config := DefaultConfig()
+	state := &ProxyState{
+		elementChain: NewRPCElementChain(),
+		packetBuffer: NewPacketBuffer(5 * time.Second),
+		relay:        NewRelay(relayAddr, secret, 2000, time.Minute),
+	}
+	defer state.packetBuffer.Close()
+
+	read := func(from *net.UDPConn) any {
+		buf := make([]byte, DefaultBufferSize)
+		n, _, err := from.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		var codec packet.PacketCodec = &packet.DataPacketCodec{}
+		if buf[0] == byte(packet.PacketTypeError.TypeID) {
+			codec = &packet.ErrorPacketCodec{}
+		}
+		decoded, err := codec.Deserialize(buf[:n])
+		if err != nil {
+			t.Fatalf("Failed to deserialize: %v", err)
+		}
+		return decoded
+	}
+	requestTo := func(dst *net.UDPAddr, rpcID uint64, token []byte) []byte {
+		pkt := createDataPacket(rpcID, 0, 1, createPayloadWithOffset(20, 0))
+		copy(pkt.DstIP[:], relayAddr.IP.To4())
+		pkt.DstPort = uint16(relayAddr.Port)
+		pkt.SetExtension(packet.ExtensionRelay, transport.EncodeRelayExtension(dst, token))
+		return serializePacket(pkt)
+	}
+	request := func(rpcID uint64, token []byte) []byte {
+		return requestTo(serverAddr, rpcID, token)
+	}
+	expectRejection := func(rpcID uint64, reason string) {
+		t.Helper()
+		rejected, ok := read(client).(*packet.ErrorPacket)
+		if !ok || rejected.RPCID != rpcID || !strings.Contains(rejected.ErrorMsg, reason) {
+			t.Errorf("Expected a rejection of RPC %d with %q, got %+v", rpcID, reason, rejected)
+		}
+	}
+	expiry := time.Now().Add(time.Hour)
+	token := transport.NewRelayToken(secret, 7, serverAddr, expiry)
+
+	handlePacket(context.Background(), relayConn, state, clientAddr, request(99201, token), config, time.Now())
+	forwarded, ok := read(server).(*packet.DataPacket)
+	if !ok {
+		t.Fatal("Expected the request to be forwarded to the server")
+	}
+	if int(forwarded.DstPort) != serverAddr.Port || int(forwarded.SrcPort) != relayAddr.Port {
+		t.Errorf("Expected a request from the relay to the server, got %+v", forwarded)
+	}
+	if _, ok := forwarded.GetExtension(packet.ExtensionRelay); ok {
+		t.Error("Expected the relay extension to be removed")
+	}
+
+	// The server answers to the header source, the relay
+	response := createDataPacket(99201, 0, 1, createPayloadWithOffset(20, 0))
+	response.PacketTypeID = packet.PacketTypeResponse.TypeID
+	response.DstIP, response.DstPort = forwarded.SrcIP, forwarded.SrcPort
+	response.SrcIP, response.SrcPort = forwarded.DstIP, forwarded.DstPort
+	handlePacket(context.Background(), relayConn, state, serverAddr, serializePacket(response), config, time.Now())
+	delivered, ok := read(client).(*packet.DataPacket)
+	if !ok || delivered.RPCID != 99201 || delivered.PacketTypeID != packet.PacketTypeResponse.TypeID {
+		t.Fatalf("Expected the response at the client, got %+v", delivered)
+	}
+	if int(delivered.DstPort) != clientAddr.Port {
+		t.Errorf("Expected the response to the client %v, got %+v", clientAddr, delivered)
+	}
+	if bytes := state.relay.SessionBytes(7); bytes == 0 {
+		t.Error("Expected the relayed bytes to be charged to the session")
+	}
+
+	// Tokens of another secret, of another destination or expired are rejected
+	handlePacket(context.Background(), relayConn, state, clientAddr, request(99202, transport.NewRelayToken([]byte("other"), 7, serverAddr, expiry)), config, time.Now())
+	expectRejection(99202, "relay authentication failed")
+	handlePacket(context.Background(), relayConn, state, clientAddr, requestTo(clientAddr, 99203, token), config, time.Now())
+	expectRejection(99203, "relay authentication failed")
+	handlePacket(context.Background(), relayConn, state, clientAddr, request(99204, transport.NewRelayToken(secret, 7, serverAddr, time.Now().Add(-time.Second))), config, time.Now())
+	expectRejection(99204, "relay authentication failed")
+
+	// Another holder of a token cannot take over the RPC ID of a pending RPC
+	intruder := listen()
+	handlePacket(context.Background(), relayConn, state, intruder.LocalAddr().(*net.UDPAddr), request(99201, token), config, time.Now())
+	rejected, ok := read(intruder).(*packet.ErrorPacket)
+	if !ok || rejected.RPCID != 99201 || !strings.Contains(rejected.ErrorMsg, "in use by another client") {
+		t.Errorf("Expected the RPC ID to be refused to another client, got %+v", rejected)
+	}
+	handlePacket(context.Background(), relayConn, state, serverAddr, serializePacket(response), config, time.Now())
+	if delivered, ok := read(client).(*packet.DataPacket); !ok || delivered.RPCID != 99201 {
+		t.Errorf("Expected the response to go to the client, got %+v", delivered)
+	}
+
+	// The session runs out of quota before 2000 bytes more
+	for rpcID := uint64(99300); ; rpcID++ {
+		if rpcID == 99400 {
+			t.Fatal("Expected the session to run out of quota")
+		}
+		handlePacket(context.Background(), relayConn, state, clientAddr, request(rpcID, token), config, time.Now())
+		buf := make([]byte, DefaultBufferSize)
+		client.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+		n, _, err := client.ReadFromUDP(buf)
+		if err != nil {
+			continue // forwarded
+		}
+		decoded, err := (&packet.ErrorPacketCodec{}).Deserialize(buf[:n])
+		if errPkt, ok := decoded.(*packet.ErrorPacket); err == nil && ok {
+			if !strings.Contains(errPkt.ErrorMsg, "relay quota exceeded") || errPkt.RetryHint.Throttle != packet.ThrottleBackoff {
+				t.Errorf("Expected a quota error with a backoff hint, got %+v", errPkt)
+			}
+			break
+		}
+	}
+}
+
+// Test that the self-test RPC passes through the pipeline with and without encryption, and
+// fails if an element drops it
+func TestSelfTest(t *testing.T) {
+	for _, encryption := range []bool{false, true} {
+		config := DefaultConfig()
+		if encryption {
+			config.SetEncryption(nil)
+		}
+		state := &ProxyState{
+			elementChain: NewRPCElementChain(),
+			packetBuffer: NewPacketBuffer(5 * time.Second),
+		}
+		if err := runSelfTest(config, state); err != nil {
+			t.Errorf("Self-test failed (encryption %v): %v", encryption, err)
+		}
+		state.packetBuffer.Close()
+	}
+
+	config := DefaultConfig()
+	state := &ProxyState{
+		elementChain: NewRPCElementChain(),
+		packetBuffer: NewPacketBuffer(5 * time.Second),
+	}
+	defer state.packetBuffer.Close()
+	loader := &ElementLoader{chain: &atomic.Value{}}
+	loader.chain.Store(NewRPCElementChain(&silentDropElement{}))
+	ctx := withListener(context.Background(), ListenerConfig{Port: 16000, ElementPrefix: "element-edge-"}, loader)
+	err := selfTestRPC(ctx, config, state)
+	if err == nil || !strings.Contains(err.Error(), "proxy returned an error") {
+		t.Errorf("Expected the dropped self-test RPC to fail with the error packet of the proxy, got %v", err)
+	}
+}
+
+// abortElement blocks in the request of blockRPC until its context is canceled, and records
+// the RPCs it is told were aborted
+type abortElement struct {
+	blockRPC uint64
+	started  chan struct{}
+	cause    chan error
+
+	mu      sync.Mutex
+	aborted []uint64
+}
+
+func (e *abortElement) ProcessRequest(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	if packet.RPCID == e.blockRPC {
+		close(e.started)
+		<-ctx.Done()
+		e.cause <- context.Cause(ctx)
+	}
+	return packet, util.PacketVerdictPass, ctx, nil
+}
+
+func (e *abortElement) ProcessResponse(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	return packet, util.PacketVerdictPass, ctx, nil
+}
+
+func (e *abortElement) OnAbort(rpcID uint64, reason error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.aborted = append(e.aborted, rpcID)
+}
+
+func (e *abortElement) Name() string {
+	return "abortElement"
+}
+
+// Test that an ICMP port unreachable error for a response aborts the RPCs of the client: the
+// one of the response, one still buffering and one in the element chain
+func TestHandleICMPErrors_UnreachableClient(t *testing.T) {
+	loopback := net.IPv4(127, 0, 0, 1)
+	proxyConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: loopback})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	defer proxyConn.Close()
+	if err := transport.EnableICMPErrors(proxyConn); err != nil {
+		t.Skipf("ICMP errors not available: %v", err)
+	}
+	client, err := net.ListenUDP("udp4", &net.UDPAddr{IP: loopback})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	clientAddr := client.LocalAddr().(*net.UDPAddr)
+
+	elem := &abortElement{blockRPC: 2, started: make(chan struct{}), cause: make(chan error, 1)}
+	currentElementChain.Store(NewRPCElementChain(elem))
+	defer currentElementChain.Store(NewRPCElementChain())
+	state := &ProxyState{packetBuffer: NewPacketBuffer(5 * time.Second), aborts: NewRPCAborts(0)}
+	defer state.packetBuffer.Close()
+	config := DefaultConfig()
+
+	fromClient := func(p *packet.DataPacket) []byte {
+		p.DstIP, p.DstPort = [4]byte{127, 0, 0, 1}, 9
+		p.SrcIP, p.SrcPort = [4]byte{127, 0, 0, 1}, uint16(clientAddr.Port)
+		return serializePacket(p)
+	}
+	// RPC 1 waits for the rest of its public segment, RPC 2 is held by the element
+	buffering := createDataPacket(1, 0, 2, createPayloadWithOffset(3000, 0)[:1000])
+	handlePacket(context.Background(), proxyConn, state, clientAddr, fromClient(buffering), config, time.Now())
+	done := make(chan struct{})
+	go func() {
+		handlePacket(context.Background(), proxyConn, state, clientAddr, fromClient(createDataPacket(2, 0, 1, createPayloadWithOffset(20, 0))), config, time.Now())
+		close(done)
+	}()
+	<-elem.started
+
+	// The response of RPC 3 finds the socket of the client closed
+	client.Close()
+	response := createDataPacket(3, 0, 1, createPayloadWithOffset(20, 0))
+	response.PacketTypeID = packet.PacketTypeResponse.TypeID
+	response.DstIP, response.DstPort = [4]byte{127, 0, 0, 1}, uint16(clientAddr.Port)
+	if _, err := proxyConn.WriteToUDP(serializePacket(response), clientAddr); err != nil {
+		t.Fatalf("WriteToUDP failed: %v", err)
+	}
+	proxyConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := proxyConn.ReadFromUDP(make([]byte, 64)); err == nil {
+		t.Fatal("Expected the read to fail with the ICMP error")
+	}
+	if n := handleICMPErrors(context.Background(), proxyConn, state); n != 1 {
+		t.Fatalf("Expected 1 ICMP error, got %d", n)
+	}
+
+	select {
+	case cause := <-elem.cause:
+		if !errors.Is(cause, ErrClientGone) {
+			t.Errorf("Expected the element context canceled with ErrClientGone, got %v", cause)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Element context of the in-flight RPC was not canceled")
+	}
+	<-done
+
+	elem.mu.Lock()
+	aborted := slices.Sorted(slices.Values(elem.aborted))
+	elem.mu.Unlock()
+	if !slices.Equal(aborted, []uint64{1, 2, 3}) {
+		t.Errorf("Expected the element told of RPCs 1, 2 and 3, got %v", aborted)
+	}
+	if rpcs := state.packetBuffer.rpcsFrom(clientAddr.String()); len(rpcs) != 0 {
+		t.Errorf("Expected the fragments of the client discarded, got RPCs %v", rpcs)
+	}
+	for _, rpcID := range []uint64{1, 2} {
+		if entry, ok := state.packetBuffer.verdicts.Load(rpcID, util.PacketTypeRequest); !ok || entry.Verdict != util.PacketVerdictDrop {
+			t.Errorf("Expected a drop verdict for RPC %d, got %v", rpcID, entry.Verdict)
+		}
+	}
+	var metrics strings.Builder
+	state.aborts.WriteMetrics(&metrics)
+	if !strings.Contains(metrics.String(), "arpc_proxy_aborted_rpcs_total 3") {
+		t.Errorf("Expected 3 aborted RPCs, got:\n%s", metrics.String())
+	}
+}
+
+// Test that an ICMP port unreachable error for a forwarded request is reported to the client
+func TestHandleICMPErrors_UnreachableRequest(t *testing.T) {
+	loopback := net.IPv4(127, 0, 0, 1)
+	proxyConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: loopback})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	defer proxyConn.Close()
+	if err := transport.EnableICMPErrors(proxyConn); err != nil {
+		t.Skipf("ICMP errors not available: %v", err)
+	}
+	client, err := net.ListenUDP("udp4", &net.UDPAddr{IP: loopback})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	defer client.Close()
+	closed, err := net.ListenUDP("udp4", &net.UDPAddr{IP: loopback})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	server := closed.LocalAddr().(*net.UDPAddr)
+	closed.Close()
+
+	clientAddr := client.LocalAddr().(*net.UDPAddr)
+	request := &packet.DataPacket{
+		PacketTypeID: packet.PacketTypeRequest.TypeID,
+		RPCID:        777,
+		TotalPackets: 1,
+		DstIP:        [4]byte{127, 0, 0, 1},
+		DstPort:      uint16(server.Port),
+		SrcIP:        [4]byte{127, 0, 0, 1},
+		SrcPort:      uint16(clientAddr.Port),
+		Payload:      []byte("request"),
+	}
+	data, err := (&packet.DataPacketCodec{}).Serialize(request, nil)
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	if _, err := proxyConn.WriteToUDP(data, server); err != nil {
+		t.Fatalf("WriteToUDP failed: %v", err)
+	}
+
+	// The queued error interrupts the next read of the listener
+	proxyConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := proxyConn.ReadFromUDP(make([]byte, 64)); err == nil {
+		t.Fatal("Expected the read to fail with the ICMP error")
+	}
+	if n := handleICMPErrors(context.Background(), proxyConn, &ProxyState{}); n != 1 {
+		t.Fatalf("Expected 1 ICMP error, got %d", n)
+	}
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := client.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("Client did not receive an error packet: %v", err)
+	}
+	receivedAny, err := (&packet.ErrorPacketCodec{}).Deserialize(buf[:n])
+	if err != nil {
+		t.Fatalf("Failed to deserialize error packet: %v", err)
+	}
+	errorPacket := receivedAny.(*packet.ErrorPacket)
+	if errorPacket.RPCID != 777 {
+		t.Errorf("Expected RPC ID 777, got %d", errorPacket.RPCID)
+	}
+	if !strings.HasPrefix(errorPacket.ErrorMsg, transport.UnavailableErrorPrefix) {
+		t.Errorf("Expected unavailable error, got %q", errorPacket.ErrorMsg)
+	}
+	if errorPacket.DstPort != uint16(clientAddr.Port) || errorPacket.SrcPort != uint16(server.Port) {
+		t.Errorf("Unexpected routing: dst port %d, src port %d", errorPacket.DstPort, errorPacket.SrcPort)
+	}
+}
+
+// upperElement is a shared element that uppercases request payloads, reroutes requests to
+// a fixed destination and drops responses
+type upperElement struct {
+	dst *net.UDPAddr
+}
+
+func (e *upperElement) ProcessRequest(ctx context.Context, msg *element.Message) (*element.Message, element.Verdict, context.Context, error) {
+	msg.Payload = []byte(strings.ToUpper(string(msg.Payload)))
+	msg.Destination = e.dst
+	return msg, element.VerdictPass, ctx, nil
+}
+
+func (e *upperElement) ProcessResponse(ctx context.Context, msg *element.Message) (*element.Message, element.Verdict, context.Context, error) {
+	return msg, element.VerdictDrop, ctx, nil
+}
+
+func (e *upperElement) Name() string { return "upper" }
+
+// Test that shared elements see and modify buffered packets through the adapter
+func TestAdaptElement(t *testing.T) {
+	dst := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 9), Port: 9100}
+	adapted := AdaptElement(&upperElement{dst: dst})
+	if adapted.Name() != "upper" {
+		t.Errorf("Expected name upper, got %s", adapted.Name())
+	}
+	ctx := context.Background()
+
+	request := &util.BufferedPacket{
+		Payload:    []byte("hello"),
+		Peer:       &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 9000},
+		PacketType: util.PacketTypeRequest,
+		DstIP:      [4]byte{10, 0, 0, 1},
+		DstPort:    9000,
+	}
+	result, verdict, _, err := adapted.ProcessRequest(ctx, request)
+	if err != nil || verdict != util.PacketVerdictPass {
+		t.Fatalf("Expected pass without error, got %v, %v", verdict, err)
+	}
+	if string(result.Payload) != "HELLO" {
+		t.Errorf("Expected modified payload, got %q", result.Payload)
+	}
+	if result.Peer != dst || result.DstIP != [4]byte{10, 0, 0, 9} || result.DstPort != 9100 {
+		t.Errorf("Expected reroute to %v, got peer %v, %v:%d", dst, result.Peer, result.DstIP, result.DstPort)
+	}
+
+	response := &util.BufferedPacket{Payload: []byte("reply"), PacketType: util.PacketTypeResponse}
+	if _, verdict, _, _ := adapted.ProcessResponse(ctx, response); verdict != util.PacketVerdictDrop {
+		t.Errorf("Expected drop verdict for responses, got %v", verdict)
+	}
+}
+
+// Test that the calls a client encrypted are decrypted for the elements of a proxy without
+// encryption, and that the encryption policy drops the others
+func TestPublicSegmentKey_CallEncrypted(t *testing.T) {
+	config := &Config{}
+	pkt := &packet.DataPacket{PacketTypeID: packet.PacketTypeRequest.TypeID, RPCID: 42}
+	transport.AddSecurityExtensions(pkt, transport.DefaultPublicKey)
+	encrypted := &util.BufferedPacket{RPCID: 42, PacketType: util.PacketTypeRequest, Extensions: pkt.Extensions}
+	if key := publicSegmentKey(config, encrypted); !bytes.Equal(key, transport.DefaultPublicKey) {
+		t.Errorf("Expected the default public key for an encrypted call, got %x", key)
+	}
+	plain := &util.BufferedPacket{RPCID: 42, PacketType: util.PacketTypeRequest}
+	if key := publicSegmentKey(config, plain); key != nil {
+		t.Errorf("Expected no key for a plaintext call, got %x", key)
+	}
+	if key := publicSegmentKey(&Config{EnableEncryption: true, EncryptionKey: []byte("key")}, plain); string(key) != "key" {
+		t.Errorf("Expected the key of the proxy with encryption enabled, got %x", key)
+	}
+
+	policy := AdaptElement(element.NewEncryptionPolicy())
+	encrypted.Encrypted = true
+	if _, verdict, _, err := policy.ProcessRequest(context.Background(), encrypted); err != nil || verdict != util.PacketVerdictPass {
+		t.Errorf("Expected the encrypted call to pass, got %v, %v", verdict, err)
+	}
+	if _, verdict, _, _ := policy.ProcessRequest(context.Background(), plain); verdict != util.PacketVerdictDrop {
+		t.Errorf("Expected the plaintext call to be dropped, got %v", verdict)
+	}
+}
+
+// Test that completed RPCs are written to the event socket in both formats
+func TestEventLog_CompletedRPCs(t *testing.T) {
+	collector, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer collector.Close()
+	readEvent := func() []byte {
+		buf := make([]byte, 2048)
+		collector.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := collector.Read(buf)
+		if err != nil {
+			t.Fatalf("No event received: %v", err)
+		}
+		return buf[:n]
+	}
+
+	if _, err := NewEventLog("tcp://"+collector.LocalAddr().String(), EventFormatJSON, time.Second, nil); err == nil {
+		t.Error("Expected an error for an unsupported network")
+	}
+	eventLog, err := NewEventLog("udp://"+collector.LocalAddr().String(), EventFormatJSON, time.Second, nil)
+	if err != nil {
+		t.Fatalf("NewEventLog failed: %v", err)
+	}
+	defer eventLog.Close()
+
+	client := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	server := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 9000}
+	payload := make([]byte, 20)
+	binary.LittleEndian.PutUint32(payload[5:9], 3)
+	binary.LittleEndian.PutUint32(payload[9:13], 4)
+	start := time.Now()
+	eventLog.RecordRequest(&util.BufferedPacket{RPCID: 1, Payload: payload, Source: client, Peer: server, TotalPackets: 2}, util.PacketVerdictPass, packet.DropReasonNone, start)
+	eventLog.RecordResponse(&util.BufferedPacket{RPCID: 1, Payload: []byte("reply")}, util.PacketVerdictPass, packet.DropReasonNone, start.Add(5*time.Millisecond))
+
+	expected := fmt.Sprintf(`{"rpcID":1,"serviceID":3,"methodID":4,"client":"10.0.0.1:5000","server":"10.0.0.2:9000","startUnixNano":%d,"latencyNanos":5000000,"requestBytes":20,"responseBytes":5,"requestPackets":2,"responsePackets":0,"requestVerdict":"pass","responseVerdict":"pass","outcome":"response"}`, start.UnixNano())
+	if event := string(readEvent()); event != expected {
+		t.Errorf("Unexpected event:\n got %s\nwant %s", event, expected)
+	}
+
+	// Responses of unknown RPCs are not reported
+	eventLog.RecordResponse(&util.BufferedPacket{RPCID: 1}, util.PacketVerdictPass, packet.DropReasonNone, start)
+
+	eventLog.format = EventFormatBinary
+	origin := packet.Origin{ID: 9, Hops: 2}
+	exts := []packet.Extension{{Type: packet.ExtensionOrigin, Value: origin.Value()}}
+	eventLog.RecordRequest(&util.BufferedPacket{RPCID: 2, Payload: payload, Source: client, Peer: server, Extensions: exts}, util.PacketVerdictDrop, packet.DropReasonRateLimited, start)
+	event := readEvent()
+	if len(event) != binaryEventSize {
+		t.Fatalf("Expected a %d-byte event, got %d", binaryEventSize, len(event))
+	}
+	if event[0] != eventVersion || EventOutcome(event[1]) != EventOutcomeDropped || util.PacketVerdict(event[2]) != util.PacketVerdictDrop {
+		t.Errorf("Unexpected event header % x", event[:4])
+	}
+	if rpcID := binary.LittleEndian.Uint64(event[4:12]); rpcID != 2 {
+		t.Errorf("Expected RPC ID 2, got %d", rpcID)
+	}
+	if ip, port := net.IP(event[48:64]), binary.LittleEndian.Uint16(event[64:66]); !ip.Equal(client.IP) || port != 5000 {
+		t.Errorf("Expected client %v, got %v:%d", client, ip, port)
+	}
+	if reason := packet.DropReason(event[84]); reason != packet.DropReasonRateLimited {
+		t.Errorf("Expected drop reason rate_limited, got %v", reason)
+	}
+	if originID, hops := binary.LittleEndian.Uint64(event[85:93]), event[93]; originID != origin.ID || hops != origin.Hops {
+		t.Errorf("Expected origin %+v, got ID %d and %d hops", origin, originID, hops)
+	}
+	if eventLog.Dropped() != 0 {
+		t.Errorf("Expected no dropped events, got %d", eventLog.Dropped())
+	}
+}
+
+// Test that RPC events and the buffer metrics are exported to an OTLP collector
+func TestEventLog_OTLP(t *testing.T) {
+	requests := make(chan string, 16)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		select {
+		case requests <- r.URL.Path + " " + string(body):
+		default:
+		}
+	}))
+	defer collector.Close()
+
+	exporter, err := otlp.NewExporter(otlp.Config{Endpoint: collector.URL, Interval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewExporter failed: %v", err)
+	}
+	defer exporter.Close()
+	pb := NewPacketBuffer(5 * time.Second)
+	defer pb.Close()
+	exporter.Register(pb.WriteMetrics)
+
+	if _, err := NewEventLog("", EventFormatJSON, time.Second, nil); err == nil {
+		t.Error("Expected an error for an event log without socket or exporter")
+	}
+	eventLog, err := NewEventLog("", EventFormatJSON, time.Second, exporter)
+	if err != nil {
+		t.Fatalf("NewEventLog failed: %v", err)
+	}
+	defer eventLog.Close()
+
+	start := time.Now()
+	eventLog.RecordRequest(&util.BufferedPacket{RPCID: 7, Payload: make([]byte, 20)}, util.PacketVerdictPass, packet.DropReasonNone, start)
+	eventLog.RecordError(&util.BufferedPacket{RPCID: 7, DropReason: packet.DropReasonRateLimited}, start.Add(time.Millisecond))
+
+	var spans, metrics bool
+	for timeout := time.After(2 * time.Second); !spans || !metrics; {
+		select {
+		case request := <-requests:
+			switch {
+			case strings.HasPrefix(request, "/v1/traces "):
+				spans = strings.Contains(request, "arpc.proxy") && strings.Contains(request, "rate_limited")
+			case strings.HasPrefix(request, "/v1/metrics "):
+				metrics = strings.Contains(request, "arpc_proxy_buffered_rpcs")
+			}
+		case <-timeout:
+			t.Fatalf("Expected spans and metrics, got spans=%v metrics=%v", spans, metrics)
+		}
+	}
+
+	span := (&RPCEvent{Outcome: EventOutcomeResponse}).Span()
+	if span.Error != "" || span.Kind != otlp.SpanKindServer {
+		t.Errorf("Unexpected span of a successful RPC: %+v", span)
+	}
+}
+
+// Test that RPC counters are labeled by the configured sources, within the cardinality limits
+func TestLabeledMetrics(t *testing.T) {
+	labels, err := ParseMetricLabels("agent=user_agent=kv|web, client=client")
+	if err != nil {
+		t.Fatalf("ParseMetricLabels failed: %v", err)
+	}
+	if len(labels) != 2 || labels[0].String() != "agent=user_agent=kv|web" || labels[1].String() != "client=client" {
+		t.Fatalf("Unexpected labels %v", labels)
+	}
+	for _, spec := range []string{"", "tenant", "tenant=header", "tenant=field:", "1x=client", "a=client,a=user_agent", "__name=client"} {
+		if _, err := ParseMetricLabels(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+
+	metrics := NewLabeledMetrics(labels, 2, 3, time.Minute)
+	request := func(rpcID uint64, agent string, ip byte, dropped bool) {
+		metrics.RecordRequest(&util.BufferedPacket{
+			RPCID:      rpcID,
+			Payload:    make([]byte, 10),
+			Source:     &net.UDPAddr{IP: net.IPv4(10, 0, 0, ip), Port: 5000},
+			Extensions: []packet.Extension{{Type: packet.ExtensionUserAgent, Value: []byte(agent)}},
+		}, dropped)
+	}
+	request(1, "kv", 1, false)
+	request(2, "kv", 1, true)
+	request(3, "batch", 2, false) // not allowed
+	request(4, "web", 3, false)   // third client: over the label limit
+	request(5, "web", 2, false)   // fourth combination: over the series limit
+	metrics.RecordResponse(&util.BufferedPacket{RPCID: 1, Payload: make([]byte, 4)}, false)
+	metrics.RecordResponse(&util.BufferedPacket{RPCID: 2, Payload: make([]byte, 4)}, false) // dropped request
+
+	state := &ProxyState{packetBuffer: NewPacketBuffer(5 * time.Second), labeled: metrics}
+	defer state.packetBuffer.Close()
+	recorder := httptest.NewRecorder()
+	newAdminMux(state).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+	for _, line := range []string{
+		`arpc_proxy_rpc_requests_total{agent="kv",client="10.0.0.1"} 2`,
+		`arpc_proxy_rpc_drops_total{agent="kv",client="10.0.0.1"} 1`,
+		`arpc_proxy_rpc_responses_total{agent="kv",client="10.0.0.1"} 1`,
+		`arpc_proxy_rpc_response_bytes_total{agent="kv",client="10.0.0.1"} 4`,
+		`arpc_proxy_rpc_requests_total{agent="other",client="10.0.0.2"} 1`,
+		`arpc_proxy_rpc_requests_total{agent="web",client="other"} 1`,
+		`arpc_proxy_rpc_requests_total{agent="other",client="other"} 1`,
+		`arpc_proxy_label_overflow_total{label="agent"} 1`,
+		`arpc_proxy_label_overflow_total{label="client"} 1`,
+		`arpc_proxy_buffered_rpcs 0`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected %s in:\n%s", line, body)
+		}
+	}
+}
+
+// limitElement is a configurable element taking a numeric limit parameter
+// Test that shadow elements record what they would have done without changing packets
+func TestShadow_Elements(t *testing.T) {
+	previous := shadowMode
+	shadowMode = NewShadow()
+	t.Cleanup(func() { shadowMode = previous })
+	shadowMode.SetElements(ParseShadowElements(" upper, other "))
+	if names := shadowMode.Elements(); len(names) != 2 || names[0] != "other" || names[1] != "upper" {
+		t.Fatalf("Expected shadow elements [other upper], got %v", names)
+	}
+
+	var log []string
+	chain := NewRPCElementChain(AdaptElement(&upperElement{dst: &net.UDPAddr{IP: net.IPv4(10, 0, 0, 9), Port: 9100}}), &orderElement{"after", &log})
+	ctx := context.Background()
+	peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 9000}
+	request := &util.BufferedPacket{Payload: []byte("hello"), Peer: peer, PacketType: util.PacketTypeRequest, DstIP: [4]byte{10, 0, 0, 1}, DstPort: 9000}
+
+	result, verdict, _, err := chain.ProcessRequest(ctx, request)
+	if err != nil || verdict != util.PacketVerdictPass {
+		t.Fatalf("Expected pass without error, got %v, %v", verdict, err)
+	}
+	if string(result.Payload) != "hello" || result.Peer != peer || result.DstIP != [4]byte{10, 0, 0, 1} {
+		t.Errorf("Expected the request unchanged by the shadow element, got %+v", result)
+	}
+	response := &util.BufferedPacket{Payload: []byte("world"), Peer: peer, PacketType: util.PacketTypeResponse}
+	if _, verdict, _, _ := chain.ProcessResponse(ctx, response); verdict != util.PacketVerdictPass {
+		t.Errorf("Expected the response not to be dropped by the shadow element, got %v", verdict)
+	}
+	if len(log) != 2 {
+		t.Errorf("Expected the next element to see both messages, got %v", log)
+	}
+
+	stats := shadowMode.Stats("upper")
+	if stats.Processed != 2 || stats.Modified != 1 || stats.Rerouted != 1 || stats.Drops != 1 || stats.Errors != 0 {
+		t.Errorf("Unexpected shadow stats %+v", stats)
+	}
+
+	// Out of shadow mode, the element applies its verdict
+	shadowMode.SetElements(nil)
+	if _, verdict, _, _ := chain.ProcessResponse(ctx, response); verdict != util.PacketVerdictDrop {
+		t.Errorf("Expected the response to be dropped, got %v", verdict)
+	}
+
+	w := httptest.NewRecorder()
+	shadowMode.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats/shadow", nil))
+	var status struct {
+		Stats map[string]ShadowStats `json:"stats"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil || status.Stats["upper"].Drops != 1 {
+		t.Errorf("Expected the stats over HTTP, got %+v (%v)", status, err)
+	}
+}
+
+type limitElement struct {
+	name   string
+	params map[string]string
+}
+
+func (e *limitElement) ProcessRequest(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	return packet, util.PacketVerdictPass, ctx, nil
+}
+
+func (e *limitElement) ProcessResponse(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	return packet, util.PacketVerdictPass, ctx, nil
+}
+
+func (e *limitElement) Name() string {
+	return e.name
+}
+
+func (e *limitElement) Configure(params map[string]string) error {
+	if limit, ok := params["limit"]; ok {
+		if _, err := strconv.Atoi(limit); err != nil {
+			return fmt.Errorf("invalid limit %q", limit)
+		}
+	}
+	e.params = params
+	return nil
+}
+
+// fakeControlPlane serves one configuration per version to pollers, and records acks
+type fakeControlPlane struct {
+	mu      sync.Mutex
+	configs []ControlConfig // in version order
+	acks    []controlAck
+}
+
+func (f *fakeControlPlane) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.URL.Path {
+	case "/cp/config":
+		version := r.URL.Query().Get("version")
+		for i, config := range f.configs {
+			if config.Version == version && i+1 < len(f.configs) || version == "" {
+				next := f.configs[0]
+				if version != "" {
+					next = f.configs[i+1]
+				}
+				json.NewEncoder(w).Encode(next)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotModified)
+	case "/cp/ack":
+		var ack controlAck
+		json.NewDecoder(r.Body).Decode(&ack)
+		f.acks = append(f.acks, ack)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Test applying control plane configurations, rejecting invalid ones and polling for them
+func TestControlPlaneClient(t *testing.T) {
+	t.Cleanup(func() { appliedControlConfig.Store(nil) })
+	a, b := &limitElement{name: "a"}, &limitElement{name: "b"}
+	rewriter := NewResponseRewriter(nil, time.Minute)
+	cache := filepath.Join(t.TempDir(), "control.json")
+	newClient := func(url string) *ControlPlaneClient {
+		c, err := NewControlPlaneClient(url, "node-1", cache, rewriter)
+		if err != nil {
+			t.Fatalf("NewControlPlaneClient failed: %v", err)
+		}
+		c.elements = func() []RPCElement { return []RPCElement{a, b} }
+		return c
+	}
+	if _, err := NewControlPlaneClient("localhost:1234", "node-1", "", rewriter); err == nil {
+		t.Error("Expected an error for a URL without scheme")
+	}
+
+	// Flags go to every element, element parameters override them
+	c := newClient("http://127.0.0.1:1")
+	v1 := &ControlConfig{
+		Version:          "1",
+		Flags:            map[string]string{"limit": "5", "tracing": "on"},
+		Elements:         map[string]map[string]string{"b": {"limit": "10"}},
+		ResponseRewrites: "10.0.1.0/24=10.0.0.2:15007",
+	}
+	if err := c.Apply(v1); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if a.params["limit"] != "5" || b.params["limit"] != "10" || b.params["tracing"] != "on" {
+		t.Errorf("Unexpected element parameters a=%v b=%v", a.params, b.params)
+	}
+	if len(rewriter.Rules()) != 1 {
+		t.Errorf("Expected the pushed response rewrite, got %v", rewriter.Rules())
+	}
+
+	// A configuration an element rejects leaves the last known good one in effect
+	v2 := &ControlConfig{Version: "2", Flags: map[string]string{"limit": "7"}, Elements: map[string]map[string]string{"b": {"limit": "many"}}}
+	if err := c.Apply(v2); err == nil || !strings.Contains(err.Error(), "element b") {
+		t.Fatalf("Expected element b to reject the configuration, got %v", err)
+	}
+	if a.params["limit"] != "5" || appliedControlConfig.Load() != v1 || len(rewriter.Rules()) != 1 {
+		t.Errorf("Expected configuration 1 to stay in effect, got a=%v", a.params)
+	}
+	if err := c.Apply(&ControlConfig{Version: "3", ResponseRewrites: "nonsense"}); err == nil {
+		t.Error("Expected an error for invalid response rewrites")
+	}
+
+	// Restarted proxies start with the cached configuration
+	a.params, b.params = nil, nil
+	appliedControlConfig.Store(nil)
+	if err := newClient("http://127.0.0.1:1").LoadCache(); err != nil {
+		t.Fatalf("LoadCache failed: %v", err)
+	}
+	if cached := appliedControlConfig.Load(); cached == nil || cached.Version != "1" || b.params["limit"] != "10" {
+		t.Errorf("Expected the cached configuration 1 to be applied, got %+v", cached)
+	}
+
+	// Polling applies and acks every version, rejected ones included
+	cp := &fakeControlPlane{configs: []ControlConfig{
+		{Version: "4", Flags: map[string]string{"limit": "1"}},
+		{Version: "5", Flags: map[string]string{"limit": "x"}},
+		{Version: "6", Flags: map[string]string{"limit": "2"}},
+	}}
+	server := httptest.NewServer(cp)
+	defer server.Close()
+	appliedControlConfig.Store(nil)
+	c = newClient(server.URL + "/cp")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cp.mu.Lock()
+		acks := len(cp.acks)
+		cp.mu.Unlock()
+		if acks == 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	want := []string{"4:true", "5:false", "6:true"}
+	if len(cp.acks) != len(want) {
+		t.Fatalf("Expected acks %v, got %+v", want, cp.acks)
+	}
+	for i, ack := range cp.acks {
+		if got := fmt.Sprintf("%s:%v", ack.Version, ack.Accepted); got != want[i] || ack.Node != "node-1" {
+			t.Errorf("ack %d = %+v, want %s", i, ack, want[i])
+		}
+	}
+	if a.params["limit"] != "2" {
+		t.Errorf("Expected configuration 6 to be applied, got a=%v", a.params)
+	}
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `"received":"6"`) || !strings.Contains(body, `"version":"6"`) {
+		t.Errorf("Unexpected status %s", body)
+	}
+}
+
+func TestSchemasHandler(t *testing.T) {
+	registry := schema.NewRegistry()
+	registry.RegisterMessage(&schema.Message{FullName: "kv.GetRequest", Fields: []schema.Field{{Number: 1, Name: "key", Kind: schema.KindString, Public: true}}})
+	registry.RegisterMethod(&schema.MethodSchema{ServiceID: 1, MethodID: 1, Service: "KV", Method: "Get", Request: "kv.GetRequest", Response: "kv.GetRequest"})
+
+	recorder := httptest.NewRecorder()
+	schemasHandler(registry).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/schemas", nil))
+	imported := schema.NewRegistry()
+	if err := imported.RegisterEncoded(recorder.Body.Bytes()); err != nil {
+		t.Fatalf("RegisterEncoded failed: %v", err)
+	}
+	if method, ok := imported.Method(1, 1); !ok || method.Request != "kv.GetRequest" {
+		t.Errorf("Method(1, 1) = %+v, %v, want KV.Get", method, ok)
+	}
+	if _, ok := imported.Message("kv.GetRequest"); !ok {
+		t.Error("Expected kv.GetRequest to be exported")
+	}
+
+	recorder = httptest.NewRecorder()
+	schemasHandler(registry).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/schemas", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d for POST, got %d", http.StatusMethodNotAllowed, recorder.Code)
+	}
+}
+
+// lifecycleElement records its lifecycle hooks, which take precedence over Configure
+type lifecycleElement struct {
+	limitElement
+	shutdown chan struct{}
+	updated  map[string]string
+}
+
+func (e *lifecycleElement) OnShutdown(ctx context.Context) error {
+	close(e.shutdown)
+	return nil
+}
+
+func (e *lifecycleElement) OnConfigUpdate(params map[string]string) error {
+	e.updated = params
+	return nil
+}
+
+func TestElementLoader_RetireDrainsChain(t *testing.T) {
+	old := &lifecycleElement{limitElement: limitElement{name: "RateLimit"}, shutdown: make(chan struct{})}
+	loader := &ElementLoader{chain: &atomic.Value{}, element: old}
+	loader.chain.Store(NewRPCElementChain(old))
+	ctx := context.WithValue(context.Background(), listenerLoaderKey{}, loader)
+
+	chain := acquireElementChain(ctx)
+	loader.mu.Lock()
+	retire := loader.retire(NewRPCElementChain())
+	loader.mu.Unlock()
+	go retire()
+
+	if next := acquireElementChain(ctx); next == chain {
+		t.Fatalf("Expected the retired chain to be swapped out")
+	} else {
+		next.release()
+	}
+	select {
+	case <-old.shutdown:
+		t.Fatalf("Expected the element to be shut down after the chain drained")
+	case <-time.After(5 * chainDrainInterval):
+	}
+	chain.release()
+	select {
+	case <-old.shutdown:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the element to be shut down once the chain drained")
+	}
+	if loader.Element() != nil {
+		t.Errorf("Expected the loader to have no element left")
+	}
+
+	config := &ControlConfig{Version: "1", Elements: map[string]map[string]string{old.Name(): {"limit": "100"}}}
+	if err := configureElement(old, config); err != nil || old.updated["limit"] != "100" || old.params != nil {
+		t.Errorf("Expected OnConfigUpdate to get the parameters, got %v, %v", old.updated, err)
+	}
+}
+
+// describedElement is a limitElement with a descriptor
+type describedElement struct {
+	limitElement
+}
+
+func (e *describedElement) Describe() element.Descriptor {
+	return element.Descriptor{Name: e.name, Version: "v3", Payload: element.PayloadNone,
+		Config: []element.ConfigParam{{Name: "burst", Type: element.ParamInt}}}
+}
+
+func TestElementsHandler(t *testing.T) {
+	described := &describedElement{limitElement{name: "RateLimit"}}
+	loaders := map[string]RPCElement{"/tmp/arpc-test/a-": described, "/tmp/arpc-test/b-": &silentDropElement{}}
+	listenerLoadersMu.Lock()
+	for prefix, e := range loaders {
+		listenerLoaders[prefix] = &ElementLoader{prefix: prefix, chain: &atomic.Value{}, element: e,
+			module: &element.Module{Path: prefix + "x.so", Digest: "sha256:00", Verified: true}}
+	}
+	listenerLoadersMu.Unlock()
+	defer func() {
+		listenerLoadersMu.Lock()
+		for prefix := range loaders {
+			delete(listenerLoaders, prefix)
+		}
+		listenerLoadersMu.Unlock()
+	}()
+
+	config := &ControlConfig{Version: "1", Flags: map[string]string{"tracing": "on"}, Elements: map[string]map[string]string{"RateLimit": {"burst": "ten"}}}
+	if err := configureElement(described, config); err == nil || described.params != nil {
+		t.Errorf("Expected the descriptor to reject the burst parameter, got %v", err)
+	}
+	config.Elements["RateLimit"]["burst"] = "10"
+	appliedControlConfig.Store(config)
+	defer appliedControlConfig.Store(nil)
+
+	recorder := httptest.NewRecorder()
+	elementsHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/elements", nil))
+	var status struct {
+		Elements []elementStatus `json:"elements"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to decode statuses: %v", err)
+	}
+	var got []elementStatus
+	for _, s := range status.Elements {
+		if strings.HasPrefix(s.Prefix, "/tmp/arpc-test/") {
+			got = append(got, s)
+		}
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected the elements of both loaders, got %+v", status.Elements)
+	}
+	if a := got[0]; a.Descriptor.Version != "v3" || a.DescriptorError != "" || a.Config["burst"] != "10" || a.Config["tracing"] != "on" || a.Plugin != "a-x.so" || !a.Verified {
+		t.Errorf("Unexpected status of the described element: %+v", a)
+	}
+	if b := got[1]; b.Descriptor.Name != "silentDropElement" || b.DescriptorError == "" || b.Config != nil {
+		t.Errorf("Expected the element without a descriptor to be flagged, got %+v", b)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+)
+
+// ProxyMode selects which pipelines of the proxy are active
+type ProxyMode string
+
+const (
+	// ProxyModeBidirectional runs requests and responses through the element chain (the default)
+	ProxyModeBidirectional ProxyMode = "bidirectional"
+	// ProxyModeOutbound runs only requests through the element chain, e.g. for client-side sidecars
+	ProxyModeOutbound ProxyMode = "outbound"
+	// ProxyModeInbound runs only responses through the element chain
+	ProxyModeInbound ProxyMode = "inbound"
+)
+
+// ParseProxyMode parses a proxy mode name; the empty string is bidirectional
+func ParseProxyMode(s string) (ProxyMode, error) {
+	switch mode := ProxyMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case "", ProxyModeBidirectional:
+		return ProxyModeBidirectional, nil
+	case ProxyModeOutbound, ProxyModeInbound:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown proxy mode %q: expected bidirectional, outbound or inbound", s)
+	}
+}
+
+// Processes reports whether packets of the given type go through the element chain in this mode.
+// Error packets are never processed by elements, and the zero value behaves like bidirectional.
+func (m ProxyMode) Processes(packetType util.PacketType) bool {
+	switch packetType {
+	case util.PacketTypeRequest:
+		return m != ProxyModeInbound
+	case util.PacketTypeResponse:
+		return m != ProxyModeOutbound
+	default:
+		return true
+	}
+}
+
+// BufferingMode selects how long the proxy holds the fragments of an RPC
+type BufferingMode string
+
+const (
+	// BufferingStreaming runs the element chain as soon as the public segment is complete and
+	// forwards the remaining fragments as they arrive (the default)
+	BufferingStreaming BufferingMode = "streaming"
+	// BufferingFull holds all fragments of an RPC and runs the element chain once the whole
+	// message has arrived. Elements still get the public segment only; unlike proxy-buffer,
+	// the payload is not reassembled for them.
+	BufferingFull BufferingMode = "full"
+)
+
+// ParseBufferingMode parses a buffering mode name; the empty string is streaming
+func ParseBufferingMode(s string) (BufferingMode, error) {
+	switch mode := BufferingMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case "", BufferingStreaming:
+		return BufferingStreaming, nil
+	case BufferingFull:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown buffering mode %q: expected streaming or full", s)
+	}
+}
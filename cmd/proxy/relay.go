@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/transport"
+)
+
+var (
+	// errRelayQuota is returned for responses of sessions out of quota; they are dropped
+	errRelayQuota = errors.New("relay quota exceeded")
+	// errRelayRPCInUse is returned for requests reusing the RPC ID of another client's RPC
+	// to the same destination, which would take its response
+	errRelayRPCInUse = errors.New("relayed RPC ID in use by another client")
+)
+
+// RelayRejection is returned for packets the relay refuses to forward. Their sender is sent
+// an error packet for the RPC, with the retry hint and the reason.
+type RelayRejection struct {
+	RPCID  uint64
+	Hint   packet.RetryHint
+	Reason packet.DropReason
+	Err    error
+}
+
+func (r *RelayRejection) Error() string { return r.Err.Error() }
+
+func (r *RelayRejection) Unwrap() error { return r.Err }
+
+// Relay forwards the RPCs of peers that cannot reach each other directly, such as clients
+// and servers behind different NATs (see transport.UDPTransport.SetRelay). Relayed packets
+// are addressed to the relay and carry their final destination and a session token in the
+// ExtensionRelay extension. The relay checks that the token was issued for the destination
+// and has not expired, readdresses the packet from itself to the destination, and remembers
+// the sender of the RPC by its address and RPC ID, so that the response the destination
+// sends for the RPC goes back to the address the request came from. An RPC ID in use by one
+// client cannot be taken over by another until it is forgotten.
+//
+// Bandwidth is limited per session (the ID in the token): relayed bytes in both directions
+// are drawn from a token bucket refilled at the rate of the relay, holding at most one
+// second of traffic.
+type Relay struct {
+	address *net.UDPAddr  // of this relay, as seen from the destinations
+	secret  []byte        // session tokens are issued with (see transport.NewRelayToken)
+	rate    int           // bytes per second per session (0: unlimited)
+	timeout time.Duration // sessions and RPCs are forgotten after this long
+
+	mu        sync.Mutex
+	sessions  map[uint32]*relaySession
+	rpcs      map[relayKey]relayedRPC // by client
+	responses map[relayKey]relayKey   // by server -> by client
+	lastPrune time.Time
+}
+
+// relayKey identifies a relayed RPC by the address of one of its peers
+type relayKey struct {
+	peer  string
+	rpcID uint64
+}
+
+// relaySession is the bandwidth quota of a relayed session
+type relaySession struct {
+	available float64 // bytes that can be relayed now
+	refilled  time.Time
+	bytes     uint64 // relayed in total
+}
+
+// relayedRPC is an RPC forwarded by the relay
+type relayedRPC struct {
+	client  *net.UDPAddr // the request came from
+	server  *net.UDPAddr // the request was forwarded to
+	session uint32
+	seen    time.Time
+}
+
+// NewRelay creates a relay reachable at address, accepting the tokens issued with secret and
+// relaying at most rate bytes per second per session (0 for no limit). address must be a
+// listener of this proxy, since the RPCs are kept in memory.
+func NewRelay(address *net.UDPAddr, secret []byte, rate int, timeout time.Duration) *Relay {
+	return &Relay{
+		address:   address,
+		secret:    secret,
+		rate:      rate,
+		timeout:   timeout,
+		sessions:  make(map[uint32]*relaySession),
+		rpcs:      make(map[relayKey]relayedRPC),
+		responses: make(map[relayKey]relayKey),
+	}
+}
+
+// Process readdresses a datagram received from src if it is relayed: a data packet with
+// the relay extension goes on to its final destination, and a response or error packet of a
+// relayed RPC back to the sender of its request. Other datagrams are returned unchanged.
+// An error means the datagram must be dropped; a *RelayRejection asks to answer src with an
+// error packet.
+func (r *Relay) Process(data []byte, src *net.UDPAddr) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	switch packet.PacketTypeID(data[0]) {
+	case packet.PacketTypeRequest.TypeID, packet.PacketTypeResponse.TypeID:
+		codec := &packet.DataPacketCodec{}
+		decoded, err := codec.Deserialize(data)
+		if err != nil {
+			return data, nil // left to the packet buffer to report
+		}
+		pkt := decoded.(*packet.DataPacket)
+		if value, ok := pkt.GetExtension(packet.ExtensionRelay); ok {
+			if err := r.forward(pkt, value, src, len(data)); err != nil {
+				return nil, err
+			}
+		} else if client, err := r.restore(pkt.RPCID, src, len(data)); err != nil {
+			return nil, err
+		} else if client == nil {
+			return data, nil
+		} else {
+			copy(pkt.DstIP[:], client.IP.To4())
+			pkt.DstPort = uint16(client.Port)
+		}
+		return codec.Serialize(pkt, nil)
+
+	case packet.PacketTypeError.TypeID:
+		codec := &packet.ErrorPacketCodec{}
+		decoded, err := codec.Deserialize(data)
+		if err != nil {
+			return data, nil
+		}
+		pkt := decoded.(*packet.ErrorPacket)
+		client, err := r.restore(pkt.RPCID, src, len(data))
+		if err != nil || client == nil {
+			return data, err
+		}
+		copy(pkt.DstIP[:], client.IP.To4())
+		pkt.DstPort = uint16(client.Port)
+		return codec.Serialize(pkt, nil)
+	}
+	return data, nil
+}
+
+// forward readdresses a packet with the relay extension from this relay to its final
+// destination, after checking its token and charging its size to the session
+func (r *Relay) forward(pkt *packet.DataPacket, value []byte, src *net.UDPAddr, size int) error {
+	dst, token, err := transport.DecodeRelayExtension(value)
+	if err != nil {
+		return &RelayRejection{RPCID: pkt.RPCID, Reason: packet.DropReasonMalformedPayload, Err: err}
+	}
+	now := time.Now()
+	session, err := transport.VerifyRelayToken(r.secret, token, dst, now)
+	if err != nil {
+		return &RelayRejection{RPCID: pkt.RPCID, Reason: packet.DropReasonAuthFailed, Err: err}
+	}
+
+	byClient := relayKey{peer: src.String(), rpcID: pkt.RPCID}
+	byServer := relayKey{peer: dst.String(), rpcID: pkt.RPCID}
+	r.mu.Lock()
+	r.prune(now)
+	if owner, ok := r.responses[byServer]; ok && owner != byClient {
+		r.mu.Unlock()
+		return &RelayRejection{
+			RPCID:  pkt.RPCID,
+			Reason: packet.DropReasonPolicyDenied,
+			Err:    fmt.Errorf("%w: RPC %d to %v", errRelayRPCInUse, pkt.RPCID, dst),
+		}
+	}
+	wait := r.charge(session, size, now)
+	if wait == 0 {
+		if previous, ok := r.rpcs[byClient]; ok && previous.server.String() != dst.String() {
+			delete(r.responses, relayKey{peer: previous.server.String(), rpcID: pkt.RPCID})
+		}
+		r.rpcs[byClient] = relayedRPC{client: src, server: dst, session: session, seen: now}
+		r.responses[byServer] = byClient
+	}
+	r.mu.Unlock()
+	if wait > 0 {
+		return &RelayRejection{
+			RPCID:  pkt.RPCID,
+			Hint:   packet.RetryHint{Throttle: packet.ThrottleBackoff, RetryAfter: wait},
+			Reason: packet.DropReasonRateLimited,
+			Err:    fmt.Errorf("%w for session %d", errRelayQuota, session),
+		}
+	}
+
+	// The extension is for this relay only
+	extensions := make([]packet.Extension, 0, len(pkt.Extensions))
+	for _, ext := range pkt.Extensions {
+		if ext.Type != packet.ExtensionRelay {
+			extensions = append(extensions, ext)
+		}
+	}
+	pkt.Extensions = extensions
+	copy(pkt.DstIP[:], dst.IP.To4())
+	pkt.DstPort = uint16(dst.Port)
+	copy(pkt.SrcIP[:], r.address.IP.To4())
+	pkt.SrcPort = uint16(r.address.Port)
+	return nil
+}
+
+// restore returns the sender of the request of a relayed RPC, for a response or error
+// packet coming from the destination of the request, after charging its size to the
+// session. It returns nil for packets of other RPCs.
+func (r *Relay) restore(rpcID uint64, src *net.UDPAddr, size int) (*net.UDPAddr, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	byClient, ok := r.responses[relayKey{peer: src.String(), rpcID: rpcID}]
+	if !ok {
+		return nil, nil
+	}
+	rpc := r.rpcs[byClient]
+	if r.charge(rpc.session, size, time.Now()) > 0 {
+		return nil, fmt.Errorf("%w for session %d", errRelayQuota, rpc.session)
+	}
+	return rpc.client, nil
+}
+
+// charge draws size bytes from the quota of a session. If the quota does not hold them, it
+// draws nothing and returns how long until it does.
+func (r *Relay) charge(session uint32, size int, now time.Time) time.Duration {
+	s, ok := r.sessions[session]
+	if !ok {
+		s = &relaySession{available: float64(r.burst()), refilled: now}
+		r.sessions[session] = s
+	}
+	elapsed := now.Sub(s.refilled)
+	s.refilled = now
+	if r.rate > 0 {
+		s.available = math.Min(float64(r.burst()), s.available+elapsed.Seconds()*float64(r.rate))
+		if missing := float64(size) - s.available; missing > 0 {
+			return time.Duration(math.Ceil(missing / float64(r.rate) * float64(time.Second)))
+		}
+		s.available -= float64(size)
+	}
+	s.bytes += uint64(size)
+	return 0
+}
+
+// burst is the most bytes a session can relay at once: a second of traffic, and at least
+// a full datagram
+func (r *Relay) burst() int {
+	return max(r.rate, packet.MaxUDPPayloadSize+packet.DataPacketHeaderSize+packet.MaxExtensionsSize+2)
+}
+
+// prune forgets RPCs whose response never came, and sessions idle for the timeout, whose
+// quota is full again. It runs at most once per second.
+func (r *Relay) prune(now time.Time) {
+	if now.Sub(r.lastPrune) < time.Second {
+		return
+	}
+	r.lastPrune = now
+	for key, rpc := range r.rpcs {
+		if now.Sub(rpc.seen) > r.timeout {
+			delete(r.rpcs, key)
+			delete(r.responses, relayKey{peer: rpc.server.String(), rpcID: key.rpcID})
+		}
+	}
+	for id, s := range r.sessions {
+		if now.Sub(s.refilled) > r.timeout {
+			delete(r.sessions, id)
+		}
+	}
+}
+
+// SessionBytes returns the number of bytes relayed for a session
+func (r *Relay) SessionBytes(session uint32) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.sessions[session]; ok {
+		return s.bytes
+	}
+	return 0
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/transport"
+	"go.uber.org/zap"
+)
+
+// localReplyPacket returns the response the proxy sends for a request an element answered:
+// addressed from the server to the client, through the hop the request came from, and
+// encrypted with key if not nil, like the public segments of the call
+func localReplyPacket(request *util.BufferedPacket, reply *util.LocalReply, key []byte) *util.BufferedPacket {
+	response := &util.BufferedPacket{
+		Payload:    reply.Payload,
+		Source:     &net.UDPAddr{IP: net.IP(request.DstIP[:]), Port: int(request.DstPort)},
+		Peer:       request.Source,
+		RPCID:      request.RPCID,
+		PacketType: util.PacketTypeResponse,
+		DstIP:      request.SrcIP,
+		DstPort:    request.SrcPort,
+		SrcIP:      request.DstIP,
+		SrcPort:    request.DstPort,
+		SeqNumber:  -1,
+	}
+	if key != nil {
+		response.Payload = transport.EncryptSymphonyData(reply.Payload, key, nil)
+		response.Encrypted = true
+		// Clients without encryption take the extensions as the sign the response is encrypted
+		pkt := &packet.DataPacket{PacketTypeID: packet.PacketTypeResponse.TypeID, RPCID: request.RPCID}
+		transport.AddSecurityExtensions(pkt, key)
+		response.Extensions = pkt.Extensions
+	}
+
+	// Every fragment of the reply gets a sequence number of its own
+	chunkSize := packet.MaxUDPPayloadSize - DataPacketHeaderSize - packet.ExtensionsSize(response.Extensions)
+	fragments := max((len(response.Payload)+chunkSize-1)/chunkSize, 1)
+	response.TotalPackets = uint16(fragments)
+	response.LastUsedSeqNum = uint16(fragments - 1)
+	return response
+}
+
+// sendLocalReply sends the response an element answered a request with to the client, in
+// place of the response of the server
+func sendLocalReply(conn util.PacketWriter, state *ProxyState, request *util.BufferedPacket, reply *util.LocalReply, key []byte) error {
+	response := localReplyPacket(request, reply, key)
+	fragments, err := state.packetBuffer.FragmentPacketForForward(response)
+	if err != nil {
+		return err
+	}
+	for _, fragment := range fragments {
+		if _, err := conn.WriteToUDP(fragment.Data, fragment.Peer); err != nil {
+			return err
+		}
+		if state.timelines != nil {
+			state.timelines.RecordDatagram(TimelineFragmentSent, fragment.Data, fragment.Peer)
+		}
+	}
+	logging.Debug("Sent local reply",
+		zap.Uint64("rpcID", request.RPCID),
+		zap.Int("fragments", len(fragments)),
+		zap.Int("bytes", len(reply.Payload)),
+		zap.String("to", response.Peer.String()))
+	return nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+)
+
+// ResponseRewrite makes responses of requests to Match return via Target: the source address
+// of the request header, which the server answers to, is replaced by Target. Target is
+// usually another listener of this proxy, e.g. on an interface of the return path.
+type ResponseRewrite struct {
+	Match     *net.IPNet // destination network of the requests
+	MatchPort int        // destination port of the requests (0 matches any)
+	Target    *net.UDPAddr
+}
+
+// String formats the rule in the syntax of ParseResponseRewrites
+func (r ResponseRewrite) String() string {
+	match := r.Match.String()
+	if r.MatchPort != 0 {
+		match += ":" + strconv.Itoa(r.MatchPort)
+	}
+	return match + "=" + r.Target.String()
+}
+
+// matches reports whether a request to dstIP:dstPort is rewritten by the rule
+func (r ResponseRewrite) matches(dstIP [4]byte, dstPort uint16) bool {
+	return r.Match.Contains(net.IP(dstIP[:])) && (r.MatchPort == 0 || r.MatchPort == int(dstPort))
+}
+
+// ParseResponseRewrites parses a comma-separated list of rules, each of the form
+//
+//	destination[:port]=targetIP:targetPort
+//
+// where destination is an IPv4 address or CIDR. The first matching rule applies, e.g.
+//
+//	10.0.1.0/24=10.0.0.2:15007,10.0.2.5:8080=10.0.0.3:15007
+func ParseResponseRewrites(spec string) ([]ResponseRewrite, error) {
+	var rules []ResponseRewrite
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		match, target, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid response rewrite %q: expected destination[:port]=targetIP:targetPort", entry)
+		}
+
+		var rule ResponseRewrite
+		network := strings.TrimSpace(match)
+		if host, port, found := strings.Cut(network, ":"); found {
+			p, err := parsePort(port)
+			if err != nil {
+				return nil, fmt.Errorf("invalid response rewrite %q: %w", entry, err)
+			}
+			network, rule.MatchPort = host, p
+		}
+		if !strings.Contains(network, "/") {
+			network += "/32"
+		}
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil || ipNet.IP.To4() == nil {
+			return nil, fmt.Errorf("invalid response rewrite %q: invalid IPv4 destination %q", entry, network)
+		}
+		rule.Match = ipNet
+
+		addr, err := net.ResolveUDPAddr("udp4", strings.TrimSpace(target))
+		if err != nil || addr.IP.To4() == nil || addr.Port == 0 {
+			return nil, fmt.Errorf("invalid response rewrite %q: invalid target %q", entry, target)
+		}
+		rule.Target = addr
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// originalSource is the source address of a rewritten request
+type originalSource struct {
+	ip   [4]byte
+	port uint16
+	seen time.Time
+}
+
+// ResponseRewriter applies response rewrite rules to requests, and sends the responses
+// arriving at a rule's target on to the client of the request
+type ResponseRewriter struct {
+	rules   atomic.Pointer[[]ResponseRewrite] // replaced by SetRules
+	timeout time.Duration                     // original sources are forgotten after this long
+
+	mu        sync.Mutex
+	originals map[uint64]originalSource // rpcID -> source before rewriting
+	lastPrune time.Time
+}
+
+// NewResponseRewriter creates a rewriter for the given rules
+func NewResponseRewriter(rules []ResponseRewrite, timeout time.Duration) *ResponseRewriter {
+	r := &ResponseRewriter{
+		timeout:   timeout,
+		originals: make(map[uint64]originalSource),
+	}
+	r.SetRules(rules)
+	return r
+}
+
+// SetRules replaces the rules of the rewriter. Responses to requests rewritten by the
+// previous rules are still restored while their targets remain targets of a rule.
+func (r *ResponseRewriter) SetRules(rules []ResponseRewrite) {
+	r.rules.Store(&rules)
+}
+
+// Rules returns the current rules of the rewriter
+func (r *ResponseRewriter) Rules() []ResponseRewrite {
+	return *r.rules.Load()
+}
+
+// RewriteRequest replaces the source address of the header of a request by the target of
+// the first rule matching its destination, remembering the original source
+func (r *ResponseRewriter) RewriteRequest(p *util.BufferedPacket) {
+	if p.PacketType != util.PacketTypeRequest {
+		return
+	}
+	for _, rule := range r.Rules() {
+		if !rule.matches(p.DstIP, p.DstPort) {
+			continue
+		}
+		var target [4]byte
+		copy(target[:], rule.Target.IP.To4())
+		if p.SrcIP == target && p.SrcPort == uint16(rule.Target.Port) {
+			return // already rewritten
+		}
+
+		now := time.Now()
+		r.mu.Lock()
+		r.prune(now)
+		r.originals[p.RPCID] = originalSource{ip: p.SrcIP, port: p.SrcPort, seen: now}
+		r.mu.Unlock()
+
+		p.SrcIP, p.SrcPort = target, uint16(rule.Target.Port)
+		return
+	}
+}
+
+// RestoreResponse sends a response or error packet addressed to the target of a rule on to
+// the original source of its request. It reports whether the destination was restored.
+func (r *ResponseRewriter) RestoreResponse(p *util.BufferedPacket) bool {
+	if p.PacketType != util.PacketTypeResponse && p.PacketType != util.PacketTypeError {
+		return false
+	}
+	if !r.isTarget(p.DstIP, p.DstPort) {
+		return false
+	}
+
+	r.mu.Lock()
+	original, ok := r.originals[p.RPCID]
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	p.DstIP, p.DstPort = original.ip, original.port
+	p.Peer = &net.UDPAddr{IP: net.IP(original.ip[:]), Port: int(original.port)}
+	return true
+}
+
+func (r *ResponseRewriter) isTarget(ip [4]byte, port uint16) bool {
+	for _, rule := range r.Rules() {
+		if rule.Target.IP.To4().Equal(net.IP(ip[:])) && rule.Target.Port == int(port) {
+			return true
+		}
+	}
+	return false
+}
+
+// prune forgets requests whose response never came. It runs at most once per second.
+func (r *ResponseRewriter) prune(now time.Time) {
+	if now.Sub(r.lastPrune) < time.Second {
+		return
+	}
+	r.lastPrune = now
+	for rpcID, original := range r.originals {
+		if now.Sub(original.seen) > r.timeout {
+			delete(r.originals, rpcID)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/selftest"
+	"go.uber.org/zap"
+)
+
+// runSelfTest sends an RPC from a loopback client through the proxy pipeline to a built-in
+// echo target and back (see pkg/selftest): the proxy reassembles the public segment of the
+// request and of the response and runs the element chain on them as for real traffic. An
+// RPC is sent through the default element chain and through the chain of each listener with
+// its own plugins. The first failure is returned.
+func runSelfTest(config *Config, state *ProxyState) error {
+	chains := []struct {
+		name string
+		ctx  context.Context
+	}{{"default", withListener(context.Background(), ListenerConfig{Role: util.PortRoleAny}, nil)}}
+	seen := make(map[string]bool)
+	for _, listener := range config.Listeners {
+		if listener.ElementPrefix == "" || seen[listener.ElementPrefix] {
+			continue
+		}
+		seen[listener.ElementPrefix] = true
+		loader := ListenerElementLoader(ElementPluginDir + "/" + listener.ElementPrefix)
+		chains = append(chains, struct {
+			name string
+			ctx  context.Context
+		}{listener.ElementPrefix, withListener(context.Background(), listener, loader)})
+	}
+
+	for _, chain := range chains {
+		start := time.Now()
+		if err := selfTestRPC(chain.ctx, config, state); err != nil {
+			return fmt.Errorf("%s element chain: %w", chain.name, err)
+		}
+		logging.Info("Self-test RPC passed", zap.String("chain", chain.name), zap.Duration("latency", time.Since(start)))
+	}
+	return nil
+}
+
+// selfTestRPC sends an RPC through a proxy listener of its own, with the listener of ctx
+func selfTestRPC(ctx context.Context, config *Config, state *ProxyState) error {
+	handle := func(conn *net.UDPConn, src *net.UDPAddr, data []byte) {
+		handlePacket(ctx, conn, state, src, data, config, time.Now())
+	}
+	var key []byte
+	if config.EnableEncryption {
+		key = config.EncryptionKey
+	}
+	return selftest.Run(handle, selftest.Config{Key: key})
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// shadowLogInterval is how often divergence stats of shadow elements are logged
+const shadowLogInterval = time.Minute
+
+// Shadow runs elements in shadow (dry-run) mode, to roll out new policy elements safely.
+// A shadow element processes a copy of every packet, and what it would have done to the
+// packet, a drop, an error, a modified payload or a new destination, is counted instead of
+// applied. The chain goes on with the packet as it was. Elements keep their own state, so a
+// shadow rate limiter still spends its tokens.
+type Shadow struct {
+	elements atomic.Pointer[map[string]bool] // names of the shadow elements
+
+	mu      sync.Mutex
+	stats   map[string]*ShadowStats // by element name
+	lastLog time.Time
+}
+
+// ShadowStats counts what a shadow element would have done to the packets it processed
+type ShadowStats struct {
+	Processed uint64 `json:"processed"`
+	Drops     uint64 `json:"drops"`
+	Errors    uint64 `json:"errors"`
+	Modified  uint64 `json:"modified"` // packets whose payload the element changed
+	Rerouted  uint64 `json:"rerouted"` // packets the element sent to another destination
+}
+
+// shadowMode holds the shadow elements of SHADOW_ELEMENTS and the control plane
+var shadowMode = NewShadow()
+
+// NewShadow creates a shadow mode without shadow elements
+func NewShadow() *Shadow {
+	return &Shadow{stats: make(map[string]*ShadowStats)}
+}
+
+// ParseShadowElements parses a comma-separated list of element names
+func ParseShadowElements(spec string) []string {
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// SetElements replaces the shadow elements. Stats of elements leaving shadow mode are kept.
+func (s *Shadow) SetElements(names []string) {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	s.elements.Store(&set)
+}
+
+// Elements returns the names of the shadow elements, sorted
+func (s *Shadow) Elements() []string {
+	set := s.elements.Load()
+	if set == nil {
+		return nil
+	}
+	names := make([]string, 0, len(*set))
+	for name := range *set {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Enabled reports whether the named element runs in shadow mode
+func (s *Shadow) Enabled(name string) bool {
+	set := s.elements.Load()
+	return set != nil && (*set)[name]
+}
+
+// Run passes a copy of packet to process, the request or response method of a shadow
+// element, and records how the result diverges from the packet
+func (s *Shadow) Run(ctx context.Context, name string, packet *util.BufferedPacket,
+	process func(context.Context, *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error)) {
+	result, verdict, _, err := process(ctx, clonePacket(packet))
+
+	var divergence string
+	s.mu.Lock()
+	stats, ok := s.stats[name]
+	if !ok {
+		stats = &ShadowStats{}
+		s.stats[name] = stats
+	}
+	stats.Processed++
+	switch {
+	case verdict == util.PacketVerdictDrop || (result == nil && err == nil):
+		stats.Drops++
+		divergence = "drop"
+	case err != nil:
+		stats.Errors++
+		divergence = "error"
+	default:
+		if !bytes.Equal(result.Payload, packet.Payload) {
+			stats.Modified++
+			divergence = "modify"
+		}
+		if result.DstIP != packet.DstIP || result.DstPort != packet.DstPort || result.Peer.String() != packet.Peer.String() {
+			stats.Rerouted++
+			divergence = "reroute"
+		}
+	}
+	snapshot := *stats
+	now := time.Now()
+	logStats := divergence != "" && now.Sub(s.lastLog) >= shadowLogInterval
+	if logStats {
+		s.lastLog = now
+	}
+	s.mu.Unlock()
+
+	if divergence == "" {
+		return
+	}
+	logging.Debug("Shadow element diverged",
+		zap.String("element", name),
+		zap.Uint64("rpcID", packet.RPCID),
+		zap.String("packetType", packet.PacketType.String()),
+		zap.String("divergence", divergence),
+		zap.Error(err))
+	if logStats {
+		logging.Info("Shadow element divergence",
+			zap.String("element", name),
+			zap.Uint64("processed", snapshot.Processed),
+			zap.Uint64("drops", snapshot.Drops),
+			zap.Uint64("errors", snapshot.Errors),
+			zap.Uint64("modified", snapshot.Modified),
+			zap.Uint64("rerouted", snapshot.Rerouted))
+	}
+}
+
+// Stats returns the stats of the named element
+func (s *Shadow) Stats(name string) ShadowStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stats, ok := s.stats[name]; ok {
+		return *stats
+	}
+	return ShadowStats{}
+}
+
+// ServeHTTP writes the shadow elements and the stats of all elements that ran in shadow
+// mode as JSON
+func (s *Shadow) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := struct {
+		Elements []string               `json:"elements"`
+		Stats    map[string]ShadowStats `json:"stats"`
+	}{Elements: s.Elements(), Stats: make(map[string]ShadowStats)}
+	s.mu.Lock()
+	for name, stats := range s.stats {
+		status.Stats[name] = *stats
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		logging.Error("Failed to write shadow stats", zap.Error(err))
+	}
+}
+
+// clonePacket copies a packet deeply enough that an element modifying the copy leaves the
+// original unchanged
+func clonePacket(packet *util.BufferedPacket) *util.BufferedPacket {
+	clone := *packet
+	clone.Payload = bytes.Clone(packet.Payload)
+	clone.Extensions = slices.Clone(packet.Extensions)
+	if packet.Peer != nil {
+		peer := *packet.Peer
+		clone.Peer = &peer
+	}
+	return &clone
+}
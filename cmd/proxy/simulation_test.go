@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/packet"
+)
+
+// simulation runs the proxy pipeline as a discrete-event simulation. Datagrams arrive and the
+// packet buffer is cleaned up at scripted instants of a virtual clock, one event at a time,
+// and the datagrams the proxy sends are recorded instead of written to a socket. Runs are
+// reproducible, so tests enumerate the orders of events rather than sleep for them.
+type simulation struct {
+	t      *testing.T
+	start  time.Time
+	now    time.Time
+	events []simEvent // sorted by time, then by the order they were scheduled in
+	state  *ProxyState
+	config *Config
+	sent   []simDatagram
+}
+
+// simEvent is something happening at an instant of a simulation
+type simEvent struct {
+	at  time.Time
+	run func()
+}
+
+// simDatagram is a datagram sent by the proxy
+type simDatagram struct {
+	at   time.Duration // since the start of the simulation
+	data []byte
+	peer *net.UDPAddr
+}
+
+// newSimulation creates a simulation of a proxy whose buffer expires RPCs after timeout,
+// cleaned up every cleanupInterval of the buffer like by its cleanup routine
+func newSimulation(t *testing.T, timeout time.Duration) *simulation {
+	sim := &simulation{t: t, start: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), config: DefaultConfig()}
+	sim.now = sim.start
+	pb := newPacketBuffer(0, timeout, func() time.Time { return sim.now })
+	sim.state = &ProxyState{packetBuffer: pb}
+
+	var tick func()
+	tick = func() {
+		pb.cleanup()
+		sim.after(pb.cleanupInterval, tick)
+	}
+	sim.after(pb.cleanupInterval, tick)
+	return sim
+}
+
+// at schedules run at d after the start of the simulation
+func (s *simulation) at(d time.Duration, run func()) {
+	s.schedule(simEvent{at: s.start.Add(d), run: run})
+}
+
+// after schedules run at d from now
+func (s *simulation) after(d time.Duration, run func()) {
+	s.schedule(simEvent{at: s.now.Add(d), run: run})
+}
+
+func (s *simulation) schedule(ev simEvent) {
+	i := sort.Search(len(s.events), func(i int) bool { return s.events[i].at.After(ev.at) })
+	s.events = append(s.events, simEvent{})
+	copy(s.events[i+1:], s.events[i:])
+	s.events[i] = ev
+}
+
+// arrive schedules the arrival of data from src at d after the start of the simulation
+func (s *simulation) arrive(d time.Duration, src *net.UDPAddr, data []byte) {
+	s.at(d, func() {
+		handlePacket(context.Background(), s, s.state, src, data, s.config, s.now)
+	})
+}
+
+// advance runs the events due in the next d of virtual time. Events may advance the clock
+// themselves (see slowElement), running the events due meanwhile before they return.
+func (s *simulation) advance(d time.Duration) {
+	end := s.now.Add(d)
+	for len(s.events) > 0 && !s.events[0].at.After(end) {
+		ev := s.events[0]
+		s.events = s.events[1:]
+		if ev.at.After(s.now) {
+			s.now = ev.at
+		}
+		ev.run()
+	}
+	if end.After(s.now) {
+		s.now = end
+	}
+}
+
+// WriteToUDP records a datagram sent by the proxy
+func (s *simulation) WriteToUDP(b []byte, addr *net.UDPAddr) (int, error) {
+	s.sent = append(s.sent, simDatagram{at: s.now.Sub(s.start), data: bytes.Clone(b), peer: addr})
+	return len(b), nil
+}
+
+// forwarded returns the data packets sent by the proxy, failing the test on any other datagram
+func (s *simulation) forwarded() []*packet.DataPacket {
+	s.t.Helper()
+	var packets []*packet.DataPacket
+	for _, d := range s.sent {
+		decoded, err := (&packet.DataPacketCodec{}).Deserialize(d.data)
+		if err != nil {
+			s.t.Fatalf("Proxy sent an undecodable datagram at %v: %v", d.at, err)
+		}
+		packets = append(packets, decoded.(*packet.DataPacket))
+	}
+	return packets
+}
+
+// reassemble returns the payload of the fragments of an RPC, in the order of their sequence
+// numbers and fragment indexes, failing the test if a fragment was sent twice
+func reassemble(t *testing.T, fragments []*packet.DataPacket) []byte {
+	t.Helper()
+	sort.SliceStable(fragments, func(i, j int) bool {
+		if fragments[i].SeqNumber != fragments[j].SeqNumber {
+			return fragments[i].SeqNumber < fragments[j].SeqNumber
+		}
+		return fragments[i].FragmentIndex < fragments[j].FragmentIndex
+	})
+	var payload []byte
+	for i, f := range fragments {
+		if i > 0 && f.SeqNumber == fragments[i-1].SeqNumber && f.FragmentIndex == fragments[i-1].FragmentIndex {
+			t.Fatalf("Fragment %d.%d was forwarded twice", f.SeqNumber, f.FragmentIndex)
+		}
+		payload = append(payload, f.Payload...)
+	}
+	return payload
+}
+
+// bufferedFragments returns the number of fragments held by the buffer
+func (s *simulation) bufferedFragments() int {
+	return s.state.packetBuffer.GetStats()["totalFragments"].(int)
+}
+
+// slowElement takes latency of virtual time to process an RPC, during which the events of
+// the simulation due meanwhile run, before giving verdict
+type slowElement struct {
+	sim     *simulation
+	latency time.Duration
+	verdict util.PacketVerdict
+	calls   int
+}
+
+func (e *slowElement) ProcessRequest(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	e.calls++
+	e.sim.advance(e.latency)
+	if e.verdict == util.PacketVerdictDrop {
+		return nil, util.PacketVerdictDrop, ctx, nil
+	}
+	return packet, e.verdict, ctx, nil
+}
+
+func (e *slowElement) ProcessResponse(ctx context.Context, packet *util.BufferedPacket) (*util.BufferedPacket, util.PacketVerdict, context.Context, error) {
+	return e.ProcessRequest(ctx, packet)
+}
+
+func (e *slowElement) Name() string {
+	return "slowElement"
+}
+
+// simulatedRPC returns the datagrams of a request whose public segment spans its first two
+// fragments, fragmented like the client does, and its payload
+func simulatedRPC(rpcID uint64) ([][]byte, []byte) {
+	payload := createPayloadWithOffset(2000, 2500)
+	mtu := packet.MaxUDPPayloadSize - DataPacketHeaderSize
+	fragments := fragmentPayloadLikeClient(payload, mtu)
+	datagrams := make([][]byte, len(fragments))
+	for i, fragment := range fragments {
+		datagrams[i] = serializePacket(createDataPacket(rpcID, uint16(i), uint16(len(fragments)), fragment))
+	}
+	return datagrams, payload
+}
+
+// permutations returns every order of 0..n-1
+func permutations(n int) [][]int {
+	if n == 0 {
+		return [][]int{{}}
+	}
+	var orders [][]int
+	for _, order := range permutations(n - 1) {
+		for i := 0; i <= len(order); i++ {
+			perm := make([]int, 0, n)
+			perm = append(perm, order[:i]...)
+			perm = append(perm, n-1)
+			perm = append(perm, order[i:]...)
+			orders = append(orders, perm)
+		}
+	}
+	return orders
+}
+
+var simSource = &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 9090}
+
+// Test that an RPC passed by the element chain is forwarded whole, exactly once, for every
+// arrival order of its fragments and for element latencies ending before, between and after
+// the arrivals of the other fragments
+func TestSimulation_PassAllOrders(t *testing.T) {
+	defer currentElementChain.Store(NewRPCElementChain())
+
+	const gap = time.Millisecond
+	datagrams, payload := simulatedRPC(4242)
+	if len(datagrams) != 4 {
+		t.Fatalf("Expected 4 fragments, got %d", len(datagrams))
+	}
+	for _, order := range permutations(len(datagrams)) {
+		for _, latency := range []time.Duration{0, gap / 2, gap, 3 * gap / 2, 10 * gap} {
+			t.Run(fmt.Sprintf("%v/%v", order, latency), func(t *testing.T) {
+				sim := newSimulation(t, time.Second)
+				element := &slowElement{sim: sim, latency: latency, verdict: util.PacketVerdictPass}
+				currentElementChain.Store(NewRPCElementChain(element))
+				for i, seq := range order {
+					sim.arrive(time.Duration(i)*gap, simSource, datagrams[seq])
+				}
+				sim.advance(100 * gap)
+
+				if element.calls != 1 {
+					t.Errorf("Expected the element chain to run once, ran %d times", element.calls)
+				}
+				if got := reassemble(t, sim.forwarded()); !bytes.Equal(got, payload) {
+					t.Errorf("Forwarded payload of %d bytes differs from the %d bytes sent", len(got), len(payload))
+				}
+				if n := sim.bufferedFragments(); n != 0 {
+					t.Errorf("Expected no buffered fragments, got %d", n)
+				}
+			})
+		}
+	}
+}
+
+// Test that only an error packet is sent for an RPC dropped by the element chain, whatever
+// the arrival order of its fragments, and that its fragments are freed once it expires
+func TestSimulation_DropAllOrders(t *testing.T) {
+	defer currentElementChain.Store(NewRPCElementChain())
+
+	const gap, timeout = time.Millisecond, time.Second
+	datagrams, _ := simulatedRPC(4343)
+	for _, order := range permutations(len(datagrams)) {
+		for _, latency := range []time.Duration{0, 3 * gap / 2, 10 * gap} {
+			t.Run(fmt.Sprintf("%v/%v", order, latency), func(t *testing.T) {
+				sim := newSimulation(t, timeout)
+				element := &slowElement{sim: sim, latency: latency, verdict: util.PacketVerdictDrop}
+				currentElementChain.Store(NewRPCElementChain(element))
+				for i, seq := range order {
+					sim.arrive(time.Duration(i)*gap, simSource, datagrams[seq])
+				}
+				sim.advance(100 * gap)
+
+				if len(sim.sent) != 1 {
+					t.Fatalf("Expected a single error packet, proxy sent %d datagrams", len(sim.sent))
+				}
+				decoded, err := (&packet.ErrorPacketCodec{}).Deserialize(sim.sent[0].data)
+				if err != nil {
+					t.Fatalf("Expected an error packet: %v", err)
+				}
+				if errorPacket := decoded.(*packet.ErrorPacket); errorPacket.RPCID != 4343 || errorPacket.DropReason != packet.DropReasonPolicyDenied {
+					t.Errorf("Expected RPC 4343 dropped for policy_denied, got %d %v", errorPacket.RPCID, errorPacket.DropReason)
+				}
+
+				sim.advance(2 * timeout)
+				if n := sim.state.packetBuffer.GetStats()["activeConnections"].(int); n != 0 {
+					t.Errorf("Expected the buffer to be empty after the timeout, got %d connections", n)
+				}
+			})
+		}
+	}
+}
+
+// Test the races of a late fragment with the cleanup of the buffer. The buffer is cleaned up
+// every half timeout, so an RPC or a verdict last used at 0 expires at the cleanup at 1.5
+// timeouts.
+func TestSimulation_TimerRaces(t *testing.T) {
+	defer currentElementChain.Store(NewRPCElementChain())
+	currentElementChain.Store(NewRPCElementChain())
+
+	const timeout = 100 * time.Millisecond
+	expiry := 3 * timeout / 2
+	datagrams, payload := simulatedRPC(4444)
+	last := len(datagrams) - 1
+
+	for _, tc := range []struct {
+		name string
+		// late is the fragment arriving at the given time, the others arrive at 0
+		late    int
+		arrival time.Duration
+		// forwarded are the sequence numbers forwarded
+		forwarded []uint16
+	}{
+		{"fragment before RPC expiry", 0, expiry - time.Nanosecond, []uint16{0, 1, 2, 3}},
+		{"fragment after RPC expiry", 0, expiry + time.Nanosecond, nil},
+		{"fragment at timeout", last, timeout, []uint16{0, 1, 2, 3}},
+		{"fragment before verdict expiry", last, expiry - time.Nanosecond, []uint16{0, 1, 2, 3}},
+		{"fragment after verdict expiry", last, expiry + time.Nanosecond, []uint16{0, 1, 2}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sim := newSimulation(t, timeout)
+			for i, data := range datagrams {
+				if i != tc.late {
+					sim.arrive(0, simSource, data)
+				}
+			}
+			sim.arrive(tc.arrival, simSource, datagrams[tc.late])
+			sim.advance(4 * timeout)
+
+			fragments := sim.forwarded()
+			var seqs []uint16
+			for _, f := range fragments {
+				seqs = append(seqs, f.SeqNumber)
+			}
+			sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+			if fmt.Sprint(seqs) != fmt.Sprint(tc.forwarded) {
+				t.Errorf("Expected fragments %v forwarded, got %v", tc.forwarded, seqs)
+			}
+			if len(seqs) == len(datagrams) {
+				if got := reassemble(t, fragments); !bytes.Equal(got, payload) {
+					t.Errorf("Forwarded payload of %d bytes differs from the %d bytes sent", len(got), len(payload))
+				}
+			}
+			if n := sim.state.packetBuffer.GetStats()["activeConnections"].(int); n != 0 {
+				t.Errorf("Expected the buffer to be empty after the timeout, got %d connections", n)
+			}
+		})
+	}
+}
+
+// Test that a large message is forwarded whole through handlePacket, like from a client
+// sending its fragments in order
+func TestSimulation_LargeMessage(t *testing.T) {
+	defer currentElementChain.Store(NewRPCElementChain())
+	currentElementChain.Store(NewRPCElementChain())
+
+	sim := newSimulation(t, 30*time.Second)
+	payload := createLargeSymphonyPayloadForMainTest(61, 10000)
+	fragments := fragmentPayloadForMainTest(payload, packet.MaxUDPPayloadSize-DataPacketHeaderSize)
+	for i, fragment := range fragments {
+		data := serializePacket(createDataPacket(999888777, uint16(i), uint16(len(fragments)), fragment))
+		sim.arrive(time.Duration(i)*time.Microsecond, simSource, data)
+	}
+	sim.advance(time.Second)
+
+	forwarded := sim.forwarded()
+	if len(forwarded) != len(fragments) {
+		t.Errorf("Expected %d fragments forwarded, got %d", len(fragments), len(forwarded))
+	}
+	for _, f := range forwarded {
+		if f.DstPort != 8080 {
+			t.Errorf("Expected fragment %d forwarded to port 8080, got %d", f.SeqNumber, f.DstPort)
+		}
+	}
+	if got := reassemble(t, forwarded); !bytes.Equal(got, payload) {
+		t.Errorf("Forwarded payload of %d bytes differs from the %d bytes sent", len(got), len(payload))
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/common"
+	"github.com/appnet-org/arpc/pkg/packet"
+)
+
+// DefaultSizeBuckets are the upper bounds (in bytes) of the payload size histogram buckets
+var DefaultSizeBuckets = []int{256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20}
+
+// methodKey identifies the series of one direction of a method
+type methodKey struct {
+	serviceID  uint32
+	methodID   uint32
+	packetType util.PacketType
+}
+
+// sizeHistogram is the payload size distribution of one methodKey
+type sizeHistogram struct {
+	counts []uint64 // per bucket, the last one counts the payloads above all bounds
+	count  uint64
+	sum    uint64
+	max    int
+}
+
+// pendingSize accumulates the payload bytes of an RPC until its last packet is seen
+type pendingSize struct {
+	start      time.Time
+	source     string
+	bytes      int
+	complete   bool // the last packet was seen
+	method     methodKey
+	methodSeen bool // the public segment was seen, so method is set
+}
+
+// requestMethod is the method of a request whose response has not been seen yet
+type requestMethod struct {
+	method methodKey
+	seen   time.Time
+}
+
+// LargeRPC is one of the largest RPCs observed by the proxy
+type LargeRPC struct {
+	RPCID      uint64    `json:"rpcID"`
+	ServiceID  uint32    `json:"serviceID"`
+	MethodID   uint32    `json:"methodID"`
+	PacketType string    `json:"packetType"`
+	Bytes      int       `json:"bytes"`
+	Source     string    `json:"source"`
+	Time       time.Time `json:"time"`
+}
+
+// MethodSizes is the payload size distribution of one direction of a method
+type MethodSizes struct {
+	ServiceID  uint32 `json:"serviceID"`
+	MethodID   uint32 `json:"methodID"`
+	PacketType string `json:"packetType"`
+	Count      uint64 `json:"count"`
+	SumBytes   uint64 `json:"sumBytes"`
+	MaxBytes   int    `json:"maxBytes"`
+	// Buckets are cumulative like Prometheus histograms: each counts the payloads of at most
+	// LE bytes ("+Inf" for the last)
+	Buckets []SizeBucket `json:"buckets"`
+}
+
+// SizeBucket is one cumulative histogram bucket
+type SizeBucket struct {
+	LE    string `json:"le"`
+	Count uint64 `json:"count"`
+}
+
+// SizeSnapshot is the content of the size stats served by the admin API
+type SizeSnapshot struct {
+	Methods []MethodSizes `json:"methods"`
+	Largest []LargeRPC    `json:"largest"`
+}
+
+// SizeStats tracks the payload size of RPCs per (serviceID, methodID) and direction, and
+// keeps the K largest RPCs with their source and time. The size of an RPC is the sum of
+// the payloads of its packets, so it is known once its last packet has been seen. Bytes of
+// packets reordered after the last one are not counted.
+type SizeStats struct {
+	buckets []int
+	topK    int
+	timeout time.Duration // incomplete RPCs are forgotten after this long
+
+	mu         sync.Mutex
+	pending    map[verdictKey]*pendingSize
+	rpcMethods map[uint64]requestMethod // rpcID -> request method, for responses, which carry no IDs
+	histograms map[methodKey]*sizeHistogram
+	largest    []LargeRPC // sorted by decreasing size, at most topK entries
+	lastPrune  time.Time
+}
+
+// NewSizeStats creates size stats keeping the topK largest RPCs.
+// If no buckets are given, DefaultSizeBuckets is used.
+func NewSizeStats(topK int, timeout time.Duration, buckets ...int) *SizeStats {
+	if len(buckets) == 0 {
+		buckets = DefaultSizeBuckets
+	}
+	sorted := append([]int(nil), buckets...)
+	sort.Ints(sorted)
+
+	return &SizeStats{
+		buckets:    sorted,
+		topK:       topK,
+		timeout:    timeout,
+		pending:    make(map[verdictKey]*pendingSize),
+		rpcMethods: make(map[uint64]requestMethod),
+		histograms: make(map[methodKey]*sizeHistogram),
+	}
+}
+
+// RecordPacket adds the payload of a data packet to the size of its RPC
+func (s *SizeStats) RecordPacket(dataPacket *packet.DataPacket, src *net.UDPAddr) {
+	packetType := util.PacketType(dataPacket.PacketTypeID)
+	if packetType != util.PacketTypeRequest && packetType != util.PacketTypeResponse {
+		return
+	}
+	last := dataPacket.SeqNumber+1 >= dataPacket.TotalPackets && !dataPacket.MoreFragments
+	now := common.CoarseNow()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(now)
+	key := verdictKey{RPCID: dataPacket.RPCID, PacketType: packetType}
+	entry := s.pending[key]
+	if entry == nil {
+		entry = &pendingSize{start: now, source: src.String()}
+		s.pending[key] = entry
+	}
+	entry.bytes += len(dataPacket.Payload)
+	if last {
+		entry.complete = true
+		s.finish(key, entry, now)
+	}
+}
+
+// RecordMethod attributes an RPC to the method of its public segment. For responses, the
+// method is the one of the request with the same RPC ID.
+func (s *SizeStats) RecordMethod(bufferedPacket *util.BufferedPacket) {
+	key := verdictKey{RPCID: bufferedPacket.RPCID, PacketType: bufferedPacket.PacketType}
+	now := common.CoarseNow()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var method methodKey
+	switch bufferedPacket.PacketType {
+	case util.PacketTypeRequest:
+		serviceID, methodID := methodIDs(bufferedPacket.Payload)
+		method = methodKey{serviceID, methodID, util.PacketTypeRequest}
+		s.rpcMethods[bufferedPacket.RPCID] = requestMethod{method, now}
+	case util.PacketTypeResponse:
+		request, ok := s.rpcMethods[bufferedPacket.RPCID]
+		if !ok {
+			return
+		}
+		delete(s.rpcMethods, bufferedPacket.RPCID)
+		method = methodKey{request.method.serviceID, request.method.methodID, util.PacketTypeResponse}
+	default:
+		return
+	}
+
+	entry := s.pending[key]
+	if entry == nil {
+		return
+	}
+	entry.method = method
+	entry.methodSeen = true
+	s.finish(key, entry, now)
+}
+
+// finish records an RPC once both its size and its method are known
+func (s *SizeStats) finish(key verdictKey, entry *pendingSize, now time.Time) {
+	if !entry.complete || !entry.methodSeen {
+		return
+	}
+	delete(s.pending, key)
+
+	h := s.histograms[entry.method]
+	if h == nil {
+		h = &sizeHistogram{counts: make([]uint64, len(s.buckets)+1)}
+		s.histograms[entry.method] = h
+	}
+	h.counts[sort.SearchInts(s.buckets, entry.bytes)]++
+	h.count++
+	h.sum += uint64(entry.bytes)
+	h.max = max(h.max, entry.bytes)
+
+	if s.topK <= 0 || (len(s.largest) == s.topK && entry.bytes <= s.largest[len(s.largest)-1].Bytes) {
+		return
+	}
+	rpc := LargeRPC{
+		RPCID:      key.RPCID,
+		ServiceID:  entry.method.serviceID,
+		MethodID:   entry.method.methodID,
+		PacketType: key.PacketType.String(),
+		Bytes:      entry.bytes,
+		Source:     entry.source,
+		Time:       now,
+	}
+	i := sort.Search(len(s.largest), func(i int) bool { return s.largest[i].Bytes < rpc.Bytes })
+	s.largest = append(s.largest, LargeRPC{})
+	copy(s.largest[i+1:], s.largest[i:])
+	s.largest[i] = rpc
+	if len(s.largest) > s.topK {
+		s.largest = s.largest[:s.topK]
+	}
+}
+
+// prune forgets RPCs whose last packet or public segment never arrived, and requests
+// whose response never came. It runs at most once per second to keep the packet path cheap.
+func (s *SizeStats) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < time.Second {
+		return
+	}
+	s.lastPrune = now
+	for key, entry := range s.pending {
+		if now.Sub(entry.start) > s.timeout {
+			delete(s.pending, key)
+		}
+	}
+	for rpcID, request := range s.rpcMethods {
+		if now.Sub(request.seen) > s.timeout {
+			delete(s.rpcMethods, rpcID)
+		}
+	}
+}
+
+// Snapshot returns the current histograms, sorted by service, method and direction,
+// and the largest RPCs
+func (s *SizeStats) Snapshot() *SizeSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := &SizeSnapshot{
+		Methods: make([]MethodSizes, 0, len(s.histograms)),
+		Largest: append([]LargeRPC{}, s.largest...),
+	}
+	for key, h := range s.histograms {
+		m := MethodSizes{
+			ServiceID:  key.serviceID,
+			MethodID:   key.methodID,
+			PacketType: key.packetType.String(),
+			Count:      h.count,
+			SumBytes:   h.sum,
+			MaxBytes:   h.max,
+		}
+		var cumulative uint64
+		for i, count := range h.counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(s.buckets) {
+				le = strconv.Itoa(s.buckets[i])
+			}
+			m.Buckets = append(m.Buckets, SizeBucket{LE: le, Count: cumulative})
+		}
+		snapshot.Methods = append(snapshot.Methods, m)
+	}
+	sort.Slice(snapshot.Methods, func(i, j int) bool {
+		a, b := snapshot.Methods[i], snapshot.Methods[j]
+		if a.ServiceID != b.ServiceID {
+			return a.ServiceID < b.ServiceID
+		}
+		if a.MethodID != b.MethodID {
+			return a.MethodID < b.MethodID
+		}
+		return a.PacketType < b.PacketType // REQUEST before RESPONSE
+	})
+	return snapshot
+}
+
+// ServeHTTP serves the snapshot as JSON for the admin API
+func (s *SizeStats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Snapshot())
+}
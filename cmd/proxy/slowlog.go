@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// slowQueryEntry holds what the proxy saw of the request of an in-flight RPC
+type slowQueryEntry struct {
+	start          time.Time
+	serviceID      uint32
+	methodID       uint32
+	publicBytes    int
+	totalPackets   uint16
+	queueWait      time.Duration
+	elementTimings []ElementTiming
+}
+
+// SlowQueryLog logs RPCs whose latency, measured at the proxy from the request's public
+// segment to the response's public segment, exceeds a threshold. Only slow RPCs are
+// logged, so the overhead is a map insert/delete per RPC.
+type SlowQueryLog struct {
+	threshold time.Duration
+	timeout   time.Duration // requests without a response are forgotten after this long
+
+	mu        sync.Mutex
+	pending   map[uint64]*slowQueryEntry // rpcID -> request record
+	lastPrune time.Time
+}
+
+// NewSlowQueryLog creates a slow query log with the given latency threshold
+func NewSlowQueryLog(threshold, timeout time.Duration) *SlowQueryLog {
+	return &SlowQueryLog{
+		threshold: threshold,
+		timeout:   timeout,
+		pending:   make(map[uint64]*slowQueryEntry),
+	}
+}
+
+// methodIDs reads the service and method IDs from the Symphony header of a public segment
+func methodIDs(payload []byte) (uint32, uint32) {
+	if len(payload) < 13 {
+		return 0, 0
+	}
+	return binary.LittleEndian.Uint32(payload[5:9]), binary.LittleEndian.Uint32(payload[9:13])
+}
+
+// RecordRequest remembers the request side of an RPC
+func (l *SlowQueryLog) RecordRequest(packet *util.BufferedPacket, queueWait time.Duration, timings []ElementTiming) {
+	now := time.Now()
+	serviceID, methodID := methodIDs(packet.Payload)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.pending[packet.RPCID] = &slowQueryEntry{
+		start:          now,
+		serviceID:      serviceID,
+		methodID:       methodID,
+		publicBytes:    len(packet.Payload),
+		totalPackets:   packet.TotalPackets,
+		queueWait:      queueWait,
+		elementTimings: timings,
+	}
+
+	// Prune at most once per second to keep the request path cheap
+	if now.Sub(l.lastPrune) < time.Second {
+		return
+	}
+	l.lastPrune = now
+	for rpcID, entry := range l.pending {
+		if now.Sub(entry.start) > l.timeout {
+			delete(l.pending, rpcID)
+		}
+	}
+}
+
+// RecordResponse completes the record of an RPC and logs it if it exceeded the threshold
+func (l *SlowQueryLog) RecordResponse(packet *util.BufferedPacket, queueWait time.Duration, timings []ElementTiming) {
+	l.mu.Lock()
+	entry, ok := l.pending[packet.RPCID]
+	delete(l.pending, packet.RPCID)
+	l.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	latency := time.Since(entry.start)
+	if latency < l.threshold {
+		return
+	}
+
+	fields := []zap.Field{
+		zap.Uint64("rpcID", packet.RPCID),
+		zap.Uint32("serviceID", entry.serviceID),
+		zap.Uint32("methodID", entry.methodID),
+		zap.Duration("latency", latency),
+		zap.Duration("threshold", l.threshold),
+		zap.Int("requestPublicBytes", entry.publicBytes),
+		zap.Uint16("requestPackets", entry.totalPackets),
+		zap.Duration("requestQueueWait", entry.queueWait),
+		zap.Int("responsePublicBytes", len(packet.Payload)),
+		zap.Uint16("responsePackets", packet.TotalPackets),
+		zap.Duration("responseQueueWait", queueWait),
+	}
+	for _, timing := range append(entry.elementTimings, timings...) {
+		fields = append(fields, zap.Duration("element."+timing.Name+"."+timing.Phase, timing.Duration))
+	}
+	logging.Warn("Slow RPC", fields...)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// maxTransparentSockets bounds the number of spoofed-source sockets; packets of further
+// senders are forwarded from the listener socket
+const maxTransparentSockets = 4096
+
+// SourceMode selects the source address of forwarded packets
+type SourceMode string
+
+const (
+	// SourceModeProxy forwards packets from the listener socket, leaving the header as sent (the default)
+	SourceModeProxy SourceMode = "proxy"
+	// SourceModeHeader forwards packets from the listener socket, but fills in the source address
+	// of the header with the address the packet was received from if the sender left it unspecified
+	SourceModeHeader SourceMode = "header"
+	// SourceModeTransparent forwards packets from sockets bound to the address of their sender
+	// (IP_TRANSPARENT, requires CAP_NET_ADMIN), so the receiver sees the original 4-tuple. The
+	// header is filled in as with SourceModeHeader, which serves as fallback where spoofing fails.
+	SourceModeTransparent SourceMode = "transparent"
+)
+
+// ParseSourceMode parses a source mode name; the empty string is SourceModeProxy
+func ParseSourceMode(s string) (SourceMode, error) {
+	switch mode := SourceMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case "", SourceModeProxy:
+		return SourceModeProxy, nil
+	case SourceModeHeader, SourceModeTransparent:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown source mode %q: expected proxy, header or transparent", s)
+	}
+}
+
+// FillsHeader reports whether the mode fills in the source address of forwarded headers
+func (m SourceMode) FillsHeader() bool {
+	return m == SourceModeHeader || m == SourceModeTransparent
+}
+
+// fillSourceAddress sets the source address of the header of a packet to src if the sender
+// left it unspecified, as clients do whose socket is bound to the wildcard address. Servers
+// read the client address from the header, so it survives forwarding from the proxy's port.
+func fillSourceAddress(p *util.BufferedPacket, src *net.UDPAddr) {
+	ip4 := src.IP.To4()
+	if ip4 == nil {
+		return
+	}
+	if p.SrcIP == [4]byte{} {
+		copy(p.SrcIP[:], ip4)
+	}
+	if p.SrcPort == 0 {
+		p.SrcPort = uint16(src.Port)
+	}
+}
+
+// transparentSocket is a socket bound to the address of a sender
+type transparentSocket struct {
+	conn     *net.UDPConn
+	lastUsed atomic.Int64 // unix nanos
+}
+
+// TransparentSockets forwards packets from sockets bound to the address of their original
+// sender. Packets addressed to that sender (e.g. the response of the server) arrive on the
+// socket and are passed to handle like packets of a listener.
+type TransparentSockets struct {
+	idleTimeout time.Duration
+	handle      func(ctx context.Context, conn *net.UDPConn, src *net.UDPAddr, data []byte, recvTime time.Time)
+	listen      func(addr *net.UDPAddr) (*net.UDPConn, error)
+
+	mu       sync.Mutex
+	sockets  map[string]*transparentSocket
+	warnOnce sync.Once
+	done     chan struct{}
+}
+
+// NewTransparentSockets creates spoofed-source sockets that are closed after idleTimeout
+// without traffic. handle processes the packets received on them.
+func NewTransparentSockets(idleTimeout time.Duration, handle func(ctx context.Context, conn *net.UDPConn, src *net.UDPAddr, data []byte, recvTime time.Time)) *TransparentSockets {
+	t := &TransparentSockets{
+		idleTimeout: idleTimeout,
+		handle:      handle,
+		listen:      listenTransparent,
+		sockets:     make(map[string]*transparentSocket),
+		done:        make(chan struct{}),
+	}
+	go t.cleanupRoutine()
+	return t
+}
+
+// Close closes all sockets
+func (t *TransparentSockets) Close() {
+	close(t.done)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, s := range t.sockets {
+		s.conn.Close()
+		delete(t.sockets, key)
+	}
+}
+
+// SenderFor returns the socket to forward a packet received from src with, or fallback if no
+// socket can be bound to src (e.g. without CAP_NET_ADMIN). ctx is the context of the listener
+// the packet arrived on; it is used for the packets received on a new socket.
+func (t *TransparentSockets) SenderFor(ctx context.Context, src *net.UDPAddr, fallback util.PacketWriter) util.PacketWriter {
+	key := src.String()
+	now := time.Now().UnixNano()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s, ok := t.sockets[key]; ok {
+		s.lastUsed.Store(now)
+		return s.conn
+	}
+	if len(t.sockets) >= maxTransparentSockets {
+		logging.Debug("Too many transparent sockets, forwarding from the listener socket", zap.String("src", key))
+		return fallback
+	}
+	conn, err := t.listen(src)
+	if err != nil {
+		t.warnOnce.Do(func() {
+			logging.Warn("Cannot bind transparent socket, falling back to header source preservation", zap.String("src", key), zap.Error(err))
+		})
+		return fallback
+	}
+	s := &transparentSocket{conn: conn}
+	s.lastUsed.Store(now)
+	t.sockets[key] = s
+	go t.serve(ctx, s)
+	return conn
+}
+
+// serve passes the packets received on a socket to handle until the socket is closed
+func (t *TransparentSockets) serve(ctx context.Context, s *transparentSocket) {
+	buf := make([]byte, DefaultBufferSize)
+	for {
+		n, src, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return // closed
+		}
+		s.lastUsed.Store(time.Now().UnixNano())
+
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		go t.handle(ctx, s.conn, src, data, time.Now())
+	}
+}
+
+// cleanupRoutine closes idle sockets
+func (t *TransparentSockets) cleanupRoutine() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case now := <-ticker.C:
+			t.mu.Lock()
+			for key, s := range t.sockets {
+				if now.Sub(time.Unix(0, s.lastUsed.Load())) > t.idleTimeout {
+					s.conn.Close()
+					delete(t.sockets, key)
+				}
+			}
+			t.mu.Unlock()
+		}
+	}
+}
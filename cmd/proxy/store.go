@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/common"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// StoredVerdict is the outcome of the element chain for the packets of one type of an RPC,
+// applied to the fragments that follow
+type StoredVerdict struct {
+	Verdict util.PacketVerdict
+	Route   *net.UDPAddr // destination override set by an element (nil if not rerouted)
+}
+
+// VerdictStore holds the verdicts of RPCs by RPC ID and packet type. PacketBuffer keeps them
+// in memory by default; a store shared by several proxy replicas lets fragments that a load
+// balancer spreads over the replicas follow the verdict of the replica that saw the public
+// segment.
+type VerdictStore interface {
+	// Load returns the verdict of an RPC and marks it as used, so it does not expire while
+	// fragments keep arriving
+	Load(rpcID uint64, packetType util.PacketType) (StoredVerdict, bool)
+	// Store records the verdict of an RPC, replacing any previous one
+	Store(rpcID uint64, packetType util.PacketType, verdict StoredVerdict)
+	// Expire removes verdicts unused for longer than timeout. Stores that expire verdicts on
+	// their own may ignore it.
+	Expire(timeout time.Duration)
+	// Close releases the resources of the store
+	Close() error
+}
+
+// ParseVerdictStore opens the store named by the value of VERDICT_STORE: "memory", or
+// redis://[:password@]host:port[/db] for a Redis server shared by the replicas. Verdicts
+// kept in Redis expire after timeout.
+func ParseVerdictStore(s string, timeout time.Duration) (VerdictStore, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "memory" {
+		return NewMemoryVerdictStore(), nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("invalid verdict store %q (want memory or redis://host:port)", s)
+	}
+	password, _ := u.User.Password()
+	db := 0
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if db, err = strconv.Atoi(path); err != nil {
+			return nil, fmt.Errorf("invalid verdict store %q: database %q is not a number", s, path)
+		}
+	}
+	return NewRedisVerdictStore(u.Host, password, db, timeout)
+}
+
+// verdictEntry stores verdict and timestamp for cleanup
+type verdictEntry struct {
+	StoredVerdict
+	// LastAccess is updated in place by every fragment, in monotonic nanoseconds (see MemoryVerdictStore.clock)
+	LastAccess atomic.Int64
+}
+
+// MemoryVerdictStore is a VerdictStore private to the process
+type MemoryVerdictStore struct {
+	verdicts sync.Map // map[verdictKey]*verdictEntry
+	// clock returns monotonic nanoseconds. It reads the coarse clock, since it is called for
+	// every fragment and only compared against the timeout.
+	clock func() int64
+}
+
+// NewMemoryVerdictStore creates an empty in-memory store
+func NewMemoryVerdictStore() *MemoryVerdictStore {
+	start := time.Now()
+	return &MemoryVerdictStore{clock: func() int64 { return int64(common.CoarseNow().Sub(start)) }}
+}
+
+// Load returns the verdict of an RPC and refreshes its last access time
+func (s *MemoryVerdictStore) Load(rpcID uint64, packetType util.PacketType) (StoredVerdict, bool) {
+	val, ok := s.verdicts.Load(verdictKey{RPCID: rpcID, PacketType: packetType})
+	if !ok {
+		return StoredVerdict{}, false
+	}
+	entry := val.(*verdictEntry)
+	entry.LastAccess.Store(s.clock())
+	return entry.StoredVerdict, true
+}
+
+// Store records the verdict of an RPC
+func (s *MemoryVerdictStore) Store(rpcID uint64, packetType util.PacketType, verdict StoredVerdict) {
+	entry := &verdictEntry{StoredVerdict: verdict}
+	entry.LastAccess.Store(s.clock())
+	s.verdicts.Store(verdictKey{RPCID: rpcID, PacketType: packetType}, entry)
+}
+
+// Expire removes verdicts that have not been used for longer than timeout
+func (s *MemoryVerdictStore) Expire(timeout time.Duration) {
+	now := s.clock()
+	expiredCount := 0
+
+	s.verdicts.Range(func(key, value interface{}) bool {
+		entry := value.(*verdictEntry)
+		age := time.Duration(now - entry.LastAccess.Load())
+		if age > timeout {
+			s.verdicts.Delete(key)
+			expiredCount++
+
+			verdictKey := key.(verdictKey)
+			logging.Debug("Cleaned up expired verdict",
+				zap.Uint64("rpcID", verdictKey.RPCID),
+				zap.String("packetType", verdictKey.PacketType.String()),
+				zap.Duration("age", age))
+		}
+		return true
+	})
+
+	if expiredCount > 0 {
+		logging.Debug("Verdict cleanup completed", zap.Int("expiredVerdicts", expiredCount))
+	}
+}
+
+// Close does nothing
+func (s *MemoryVerdictStore) Close() error {
+	return nil
+}
+
+const (
+	// redisKeyPrefix namespaces the keys of verdicts in a Redis database
+	redisKeyPrefix = "arpc:verdict:"
+	// redisTimeout bounds each Redis command, which runs on the path of a packet
+	redisTimeout = 50 * time.Millisecond
+	// redisPoolSize is the number of idle connections kept to the Redis server
+	redisPoolSize = 16
+)
+
+// RedisVerdictStore shares verdicts through a Redis server. Verdicts are also cached in
+// memory, so only fragments of RPCs whose verdict this replica has not seen query the
+// server. Keys expire after the buffer timeout from the time the verdict was stored, and
+// Redis errors are logged and treated as missing verdicts: the fragments are then buffered
+// as if no verdict existed yet.
+type RedisVerdictStore struct {
+	addr     string
+	password string
+	db       int
+	ttl      time.Duration
+	local    *MemoryVerdictStore
+	pool     chan *redisConn
+}
+
+// NewRedisVerdictStore connects to the Redis server at addr, checking that it is reachable
+func NewRedisVerdictStore(addr, password string, db int, ttl time.Duration) (*RedisVerdictStore, error) {
+	s := &RedisVerdictStore{
+		addr:     addr,
+		password: password,
+		db:       db,
+		ttl:      ttl,
+		local:    NewMemoryVerdictStore(),
+		pool:     make(chan *redisConn, redisPoolSize),
+	}
+	conn, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	s.release(conn)
+	return s, nil
+}
+
+// Load returns the cached verdict of an RPC, or else the one stored in Redis
+func (s *RedisVerdictStore) Load(rpcID uint64, packetType util.PacketType) (StoredVerdict, bool) {
+	if verdict, ok := s.local.Load(rpcID, packetType); ok {
+		return verdict, true
+	}
+	reply, err := s.do("GET", redisKey(rpcID, packetType))
+	if err != nil {
+		logging.Warn("Failed to load verdict from Redis", zap.Uint64("rpcID", rpcID), zap.Error(err))
+		return StoredVerdict{}, false
+	}
+	if reply == nil {
+		return StoredVerdict{}, false
+	}
+	verdict, err := decodeStoredVerdict(*reply)
+	if err != nil {
+		logging.Warn("Ignoring invalid verdict in Redis", zap.Uint64("rpcID", rpcID), zap.Error(err))
+		return StoredVerdict{}, false
+	}
+	s.local.Store(rpcID, packetType, verdict)
+	return verdict, true
+}
+
+// Store records the verdict of an RPC in the cache and in Redis
+func (s *RedisVerdictStore) Store(rpcID uint64, packetType util.PacketType, verdict StoredVerdict) {
+	s.local.Store(rpcID, packetType, verdict)
+	ttl := strconv.FormatInt(s.ttl.Milliseconds(), 10)
+	if _, err := s.do("SET", redisKey(rpcID, packetType), encodeStoredVerdict(verdict), "PX", ttl); err != nil {
+		logging.Warn("Failed to store verdict in Redis", zap.Uint64("rpcID", rpcID), zap.Error(err))
+	}
+}
+
+// Expire removes unused verdicts from the cache; Redis expires its keys on its own
+func (s *RedisVerdictStore) Expire(timeout time.Duration) {
+	s.local.Expire(timeout)
+}
+
+// Close closes the idle connections to the server
+func (s *RedisVerdictStore) Close() error {
+	for {
+		select {
+		case conn := <-s.pool:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// redisKey returns the key of the verdict of an RPC
+func redisKey(rpcID uint64, packetType util.PacketType) string {
+	return redisKeyPrefix + strconv.FormatUint(rpcID, 10) + ":" + strconv.Itoa(int(packetType))
+}
+
+// encodeStoredVerdict encodes a verdict as its number, followed by the route if any
+func encodeStoredVerdict(v StoredVerdict) string {
+	s := strconv.Itoa(int(v.Verdict))
+	if v.Route != nil {
+		s += " " + v.Route.String()
+	}
+	return s
+}
+
+// decodeStoredVerdict decodes the result of encodeStoredVerdict
+func decodeStoredVerdict(s string) (StoredVerdict, error) {
+	verdict, route, hasRoute := strings.Cut(s, " ")
+	n, err := strconv.Atoi(verdict)
+	if err != nil {
+		return StoredVerdict{}, fmt.Errorf("invalid verdict %q", s)
+	}
+	v := StoredVerdict{Verdict: util.PacketVerdict(n)}
+	if hasRoute {
+		if v.Route, err = net.ResolveUDPAddr("udp", route); err != nil {
+			return StoredVerdict{}, fmt.Errorf("invalid route %q: %w", route, err)
+		}
+	}
+	return v, nil
+}
+
+// do runs a command on a pooled connection and returns its bulk string reply, or nil for
+// a null reply. Connections that fail are closed instead of returned to the pool.
+func (s *RedisVerdictStore) do(args ...string) (*string, error) {
+	var conn *redisConn
+	select {
+	case conn = <-s.pool:
+	default:
+		var err error
+		if conn, err = s.dial(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := conn.do(args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		conn.Close()
+		return nil, err
+	}
+	s.release(conn)
+	return reply, err
+}
+
+// dial opens a connection, authenticates and selects the database
+func (s *RedisVerdictStore) dial() (*redisConn, error) {
+	c, err := net.DialTimeout("tcp", s.addr, redisTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	conn := &redisConn{Conn: c, r: bufio.NewReader(c)}
+	if s.password != "" {
+		if _, err := conn.do("AUTH", s.password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to authenticate to Redis: %w", err)
+		}
+	}
+	if s.db != 0 {
+		if _, err := conn.do("SELECT", strconv.Itoa(s.db)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to select Redis database %d: %w", s.db, err)
+		}
+	}
+	return conn, nil
+}
+
+// release returns a connection to the pool, or closes it if the pool is full
+func (s *RedisVerdictStore) release(conn *redisConn) {
+	select {
+	case s.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// redisError is an error reply of the server. The connection remains usable.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisConn is a connection speaking the subset of RESP the store needs
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// do sends a command and reads its reply: a bulk string, nil for null and status replies
+func (c *redisConn) do(args ...string) (*string, error) {
+	if err := c.SetDeadline(time.Now().Add(redisTimeout)); err != nil {
+		return nil, err
+	}
+	cmd := "*" + strconv.Itoa(len(args)) + "\r\n"
+	for _, arg := range args {
+		cmd += "$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n"
+	}
+	if _, err := io.WriteString(c.Conn, cmd); err != nil {
+		return nil, err
+	}
+
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return nil, nil
+	case '-':
+		return nil, redisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		reply := string(buf[:n])
+		return &reply, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// stuckRPCHistory is the number of stuck RPC reports kept for the admin API
+const stuckRPCHistory = 64
+
+// StuckRPC is the diagnostic bundle of an RPC whose reassembly stalled: no fragment arrived
+// for a large part of the buffer timeout while the fragments needed to process it are missing
+type StuckRPC struct {
+	RPCID      uint64    `json:"rpcID"`
+	Source     string    `json:"source"`
+	PacketType string    `json:"packetType"`
+	Time       time.Time `json:"time"`
+	// Age is the time since the first fragment, Idle the time since the last one
+	Age          time.Duration `json:"age"`
+	Idle         time.Duration `json:"idle"`
+	Expired      bool          `json:"expired,omitempty"` // reported when the buffer expired it
+	Timeout      time.Duration `json:"timeout"`           // buffer timeout of the RPC
+	TotalPackets uint16        `json:"totalPackets"`
+	// PublicBytes is the size of the public segment read from the first fragment (0 if it is missing)
+	PublicBytes   int `json:"publicBytes"`
+	Fragments     int `json:"fragments"`
+	BufferedBytes int `json:"bufferedBytes"`
+	// Sequence numbers as ranges, e.g. "0-3,7": with all their fragments, with some of them,
+	// and without any
+	CompleteSeqs string `json:"completeSeqs"`
+	PartialSeqs  string `json:"partialSeqs,omitempty"`
+	MissingSeqs  string `json:"missingSeqs,omitempty"`
+	// Verdicts stored for both directions of the RPC, and the element exits recorded in its
+	// timeline (if RPC timelines are enabled)
+	RequestVerdict  eventVerdict    `json:"requestVerdict"`
+	ResponseVerdict eventVerdict    `json:"responseVerdict"`
+	Elements        []TimelineEvent `json:"elements,omitempty"`
+}
+
+// StuckRPCs reports the RPCs whose reassembly is incomplete after a fraction of their buffer
+// timeout, so that they are not expired silently. Each RPC is reported once, in the log and
+// in the recent reports served by the admin API.
+type StuckRPCs struct {
+	threshold int        // percentage of the timeout of an RPC after which it is stuck
+	timelines *Timelines // nil if RPC timelines are disabled
+	count     atomic.Uint64
+
+	mu     sync.Mutex
+	recent []StuckRPC // most recent last
+}
+
+// NewStuckRPCs creates a stuck RPC detector for RPCs idle for threshold percent of their
+// buffer timeout
+func NewStuckRPCs(threshold int, timelines *Timelines) *StuckRPCs {
+	return &StuckRPCs{
+		threshold: threshold,
+		timelines: timelines,
+	}
+}
+
+// after returns the idle time after which an RPC with the given buffer timeout is stuck
+func (s *StuckRPCs) after(timeout time.Duration) time.Duration {
+	return timeout * time.Duration(s.threshold) / 100
+}
+
+// Count returns the number of stuck RPCs reported so far
+func (s *StuckRPCs) Count() uint64 {
+	return s.count.Load()
+}
+
+// report logs the diagnostic bundle of a stuck RPC and keeps it for the admin API
+func (s *StuckRPCs) report(stuck StuckRPC) {
+	s.count.Add(1)
+	if s.timelines != nil {
+		if timeline, ok := s.timelines.Timeline(stuck.RPCID); ok {
+			for _, event := range timeline.Events {
+				if event.Kind == TimelineElementExit {
+					stuck.Elements = append(stuck.Elements, event)
+				}
+			}
+		}
+	}
+
+	s.mu.Lock()
+	if len(s.recent) == stuckRPCHistory {
+		copy(s.recent, s.recent[1:])
+		s.recent = s.recent[:len(s.recent)-1]
+	}
+	s.recent = append(s.recent, stuck)
+	s.mu.Unlock()
+
+	fields := []zap.Field{
+		zap.Uint64("rpcID", stuck.RPCID),
+		zap.String("source", stuck.Source),
+		zap.String("packetType", stuck.PacketType),
+		zap.Duration("age", stuck.Age),
+		zap.Duration("idle", stuck.Idle),
+		zap.Bool("expired", stuck.Expired),
+		zap.Duration("timeout", stuck.Timeout),
+		zap.Uint16("totalPackets", stuck.TotalPackets),
+		zap.Int("publicBytes", stuck.PublicBytes),
+		zap.Int("fragments", stuck.Fragments),
+		zap.Int("bufferedBytes", stuck.BufferedBytes),
+		zap.String("completeSeqs", stuck.CompleteSeqs),
+		zap.String("partialSeqs", stuck.PartialSeqs),
+		zap.String("missingSeqs", stuck.MissingSeqs),
+		zap.String("requestVerdict", util.PacketVerdict(stuck.RequestVerdict).String()),
+		zap.String("responseVerdict", util.PacketVerdict(stuck.ResponseVerdict).String()),
+	}
+	for _, element := range stuck.Elements {
+		fields = append(fields, zap.String("element."+element.Element+"."+element.PacketType, util.PacketVerdict(element.Verdict).String()))
+	}
+	logging.Warn("Stuck RPC", fields...)
+}
+
+// Recent returns the most recent reports, most recent first
+func (s *StuckRPCs) Recent() []StuckRPC {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	recent := make([]StuckRPC, len(s.recent))
+	for i, stuck := range s.recent {
+		recent[len(recent)-1-i] = stuck
+	}
+	return recent
+}
+
+// ServeHTTP serves the stuck_rpc count and the most recent reports as JSON for the admin API
+func (s *StuckRPCs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := struct {
+		StuckRPC uint64     `json:"stuck_rpc"`
+		Recent   []StuckRPC `json:"recent"`
+	}{StuckRPC: s.Count(), Recent: s.Recent()}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// stuckRPC builds the diagnostic bundle of an RPC state. The caller must hold state.mu.
+func (pb *PacketBuffer) stuckRPC(key rpcKey, state *rpcState, now time.Time) StuckRPC {
+	stuck := StuckRPC{
+		RPCID:        key.rpcID,
+		Source:       key.connKey,
+		PacketType:   state.PacketType.String(),
+		Time:         now,
+		Age:          now.Sub(state.FirstSeen),
+		Idle:         now.Sub(state.LastSeen),
+		Timeout:      pb.rpcTimeout(state),
+		TotalPackets: state.TotalPackets,
+	}
+	if first := state.Fragments[0][0]; first != nil && len(first.payload) >= 5 {
+		stuck.PublicBytes = offsetToPrivate(first.payload)
+	}
+
+	var complete, partial, missing []uint16
+	for seqNum := uint16(0); seqNum < state.TotalPackets; seqNum++ {
+		seqFragments := state.Fragments[seqNum]
+		if len(seqFragments) == 0 {
+			missing = append(missing, seqNum)
+			continue
+		}
+		last := -1
+		for fragIdx, fragInfo := range seqFragments {
+			stuck.Fragments++
+			stuck.BufferedBytes += len(fragInfo.payload)
+			if !fragInfo.moreFragments {
+				last = int(fragIdx)
+			}
+		}
+		if last >= 0 && len(seqFragments) == last+1 {
+			complete = append(complete, seqNum)
+		} else {
+			partial = append(partial, seqNum)
+		}
+	}
+	stuck.CompleteSeqs, stuck.PartialSeqs, stuck.MissingSeqs = seqRanges(complete), seqRanges(partial), seqRanges(missing)
+
+	if entry, ok := pb.verdicts.Load(key.rpcID, util.PacketTypeRequest); ok {
+		stuck.RequestVerdict = eventVerdict(entry.Verdict)
+	}
+	if entry, ok := pb.verdicts.Load(key.rpcID, util.PacketTypeResponse); ok {
+		stuck.ResponseVerdict = eventVerdict(entry.Verdict)
+	}
+	return stuck
+}
+
+// detectStuckRPCs reports the RPCs still waiting for fragments to process after being idle
+// for the stuck threshold
+func (pb *PacketBuffer) detectStuckRPCs() {
+	detector := pb.stuck.Load()
+	now := pb.now()
+	var stuck []StuckRPC
+
+	for _, shard := range pb.shards {
+		shard.mu.RLock()
+		for key, state := range shard.rpcStates {
+			state.mu.Lock()
+			if state.Phase == rpcBuffering && !state.StuckReported && now.Sub(state.LastSeen) > detector.after(pb.rpcTimeout(state)) {
+				state.StuckReported = true
+				stuck = append(stuck, pb.stuckRPC(key, state, now))
+			}
+			state.mu.Unlock()
+		}
+		shard.mu.RUnlock()
+	}
+
+	// Report outside the locks, the log may block
+	for _, s := range stuck {
+		detector.report(s)
+	}
+}
+
+// seqRanges formats sorted sequence numbers as ranges, e.g. "0-3,7"
+func seqRanges(seqs []uint16) string {
+	var b strings.Builder
+	for i := 0; i < len(seqs); {
+		j := i
+		for j+1 < len(seqs) && seqs[j+1] == seqs[j]+1 {
+			j++
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Itoa(int(seqs[i])))
+		if j > i {
+			b.WriteByte('-')
+			b.WriteString(strconv.Itoa(int(seqs[j])))
+		}
+		i = j + 1
+	}
+	return b.String()
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/appnet-org/arpc/cmd/proxy/util"
+	"github.com/appnet-org/arpc/pkg/packet"
+)
+
+// DefaultTimelineEvents is the number of events kept per RPC; later events are counted but
+// not kept. It covers the fragments of an RPC of several MB in both directions.
+const DefaultTimelineEvents = 8192
+
+// TimelineEventKind is the kind of an event of an RPC timeline
+type TimelineEventKind uint8
+
+const (
+	// TimelineFragmentReceived is a datagram of the RPC read from a listener
+	TimelineFragmentReceived TimelineEventKind = iota + 1
+	// TimelineFragmentSent is a datagram of the RPC forwarded to its peer
+	TimelineFragmentSent
+	// TimelineFragmentDropped is a datagram of the RPC dropped because of its verdict
+	TimelineFragmentDropped
+	// TimelineElementEnter and TimelineElementExit bracket the processing by an element
+	TimelineElementEnter
+	TimelineElementExit
+	// TimelineVerdict is the verdict stored for one direction of the RPC
+	TimelineVerdict
+	// TimelineErrorPacket is an error packet of the RPC read from a listener
+	TimelineErrorPacket
+)
+
+// String returns the name of the kind
+func (k TimelineEventKind) String() string {
+	switch k {
+	case TimelineFragmentReceived:
+		return "fragment_received"
+	case TimelineFragmentSent:
+		return "fragment_sent"
+	case TimelineFragmentDropped:
+		return "fragment_dropped"
+	case TimelineElementEnter:
+		return "element_enter"
+	case TimelineElementExit:
+		return "element_exit"
+	case TimelineVerdict:
+		return "verdict"
+	case TimelineErrorPacket:
+		return "error_packet"
+	}
+	return "unknown"
+}
+
+// MarshalJSON encodes the kind by name
+func (k TimelineEventKind) MarshalJSON() ([]byte, error) {
+	return json.Marshal(k.String())
+}
+
+// timelineEvent is an event as recorded on the packet path; it is converted to a
+// TimelineEvent when the timeline is dumped
+type timelineEvent struct {
+	time          time.Time
+	kind          TimelineEventKind
+	packetType    util.PacketType
+	fragment      bool // seq and fragmentIndex are set
+	seq           uint16
+	fragmentIndex uint8
+	bytes         int
+	peer          *net.UDPAddr
+	element       string
+	verdict       util.PacketVerdict
+	err           string
+}
+
+// TimelineEvent is an event of an RPC timeline served by the admin API
+type TimelineEvent struct {
+	Time       time.Time         `json:"time"`
+	Kind       TimelineEventKind `json:"kind"`
+	PacketType string            `json:"packetType,omitempty"`
+	// Seq and FragmentIndex locate the datagram of fragment events
+	Seq           *uint16      `json:"seq,omitempty"`
+	FragmentIndex *uint8       `json:"fragmentIndex,omitempty"`
+	Bytes         int          `json:"bytes,omitempty"`
+	Peer          string       `json:"peer,omitempty"`
+	Element       string       `json:"element,omitempty"`
+	Verdict       eventVerdict `json:"verdict,omitempty"`
+	Error         string       `json:"error,omitempty"`
+}
+
+// RPCTimeline is the timeline of an RPC served by the admin API
+type RPCTimeline struct {
+	RPCID  uint64          `json:"rpcID"`
+	Start  time.Time       `json:"start"`
+	Events []TimelineEvent `json:"events"`
+	// Truncated counts the events past the per-RPC limit, which were not kept
+	Truncated int `json:"truncated,omitempty"`
+}
+
+// TimelineSummary describes a recorded RPC in the list of recent RPCs
+type TimelineSummary struct {
+	RPCID  uint64    `json:"rpcID"`
+	Start  time.Time `json:"start"`
+	Last   time.Time `json:"last"`
+	Events int       `json:"events"`
+}
+
+// rpcTimeline is the recorded timeline of one RPC
+type rpcTimeline struct {
+	rpcID     uint64
+	start     time.Time
+	events    []timelineEvent
+	truncated int
+}
+
+// Timelines records fine-grained events of the most recent RPCs (datagrams received and
+// forwarded, element entry and exit, verdicts) to debug RPCs that stall in the proxy without
+// reproducing them. RPCs are kept in a ring buffer: the timeline of the oldest RPC is reused
+// for a new one once the buffer is full.
+type Timelines struct {
+	maxEvents int
+
+	mu   sync.Mutex
+	ring []*rpcTimeline // in order of first event, next is the oldest once the ring is full
+	next int
+	byID map[uint64]*rpcTimeline
+}
+
+// NewTimelines creates timelines of the last rpcs RPCs, of up to maxEvents events each
+func NewTimelines(rpcs, maxEvents int) *Timelines {
+	return &Timelines{
+		maxEvents: maxEvents,
+		ring:      make([]*rpcTimeline, rpcs),
+		byID:      make(map[uint64]*rpcTimeline, rpcs),
+	}
+}
+
+// record appends an event to the timeline of an RPC, starting a timeline for a new RPC
+func (t *Timelines) record(rpcID uint64, event timelineEvent) {
+	event.time = time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tl := t.byID[rpcID]
+	if tl == nil {
+		// Reuse the timeline of the oldest RPC, and its events slice
+		tl = t.ring[t.next]
+		if tl == nil {
+			tl = &rpcTimeline{}
+			t.ring[t.next] = tl
+		} else {
+			delete(t.byID, tl.rpcID)
+		}
+		t.next = (t.next + 1) % len(t.ring)
+		tl.rpcID, tl.start, tl.events, tl.truncated = rpcID, event.time, tl.events[:0], 0
+		t.byID[rpcID] = tl
+	}
+	if len(tl.events) >= t.maxEvents {
+		tl.truncated++
+		return
+	}
+	tl.events = append(tl.events, event)
+}
+
+// RecordDatagram records a serialized request or response packet received from or sent to
+// peer. Other datagrams are ignored.
+func (t *Timelines) RecordDatagram(kind TimelineEventKind, data []byte, peer *net.UDPAddr) {
+	if len(data) < packet.DataPacketHeaderSize || (data[0] != byte(packet.PacketTypeRequest.TypeID) && data[0] != byte(packet.PacketTypeResponse.TypeID)) {
+		return
+	}
+	t.record(binary.LittleEndian.Uint64(data[1:9]), timelineEvent{
+		kind:          kind,
+		packetType:    util.PacketType(data[0]),
+		fragment:      true,
+		seq:           binary.LittleEndian.Uint16(data[11:13]),
+		fragmentIndex: data[14],
+		bytes:         len(data),
+		peer:          peer,
+	})
+}
+
+// RecordErrorPacket records an error packet of an RPC received from src
+func (t *Timelines) RecordErrorPacket(bufferedPacket *util.BufferedPacket, src *net.UDPAddr) {
+	t.record(bufferedPacket.RPCID, timelineEvent{
+		kind:  TimelineErrorPacket,
+		peer:  src,
+		bytes: len(bufferedPacket.Payload),
+		err:   string(bufferedPacket.Payload),
+	})
+}
+
+// RecordVerdict records the verdict stored for one direction of an RPC, and the error that
+// caused a drop
+func (t *Timelines) RecordVerdict(rpcID uint64, packetType util.PacketType, verdict util.PacketVerdict, err error) {
+	event := timelineEvent{kind: TimelineVerdict, packetType: packetType, verdict: verdict}
+	if err != nil {
+		event.err = err.Error()
+	}
+	t.record(rpcID, event)
+}
+
+// timelineKey is the context key of the timelineRecorder of the packet being processed
+type timelineKey struct{}
+
+// timelineRecorder records the element events of the packet of an RPC
+type timelineRecorder struct {
+	timelines  *Timelines
+	rpcID      uint64
+	packetType util.PacketType
+}
+
+// WithTimeline returns a context that makes the element chain record the entry and exit of
+// each element in the timeline of the RPC of bufferedPacket
+func (t *Timelines) WithTimeline(ctx context.Context, bufferedPacket *util.BufferedPacket) context.Context {
+	return context.WithValue(ctx, timelineKey{}, &timelineRecorder{timelines: t, rpcID: bufferedPacket.RPCID, packetType: bufferedPacket.PacketType})
+}
+
+// enter records the entry into an element (no-op on a nil receiver)
+func (r *timelineRecorder) enter(name string) {
+	if r == nil {
+		return
+	}
+	r.timelines.record(r.rpcID, timelineEvent{kind: TimelineElementEnter, packetType: r.packetType, element: name})
+}
+
+// exit records the exit from an element with its verdict and error (no-op on a nil receiver)
+func (r *timelineRecorder) exit(name string, verdict util.PacketVerdict, err error) {
+	if r == nil {
+		return
+	}
+	event := timelineEvent{kind: TimelineElementExit, packetType: r.packetType, element: name, verdict: verdict}
+	if err != nil {
+		event.err = err.Error()
+	}
+	r.timelines.record(r.rpcID, event)
+}
+
+// Timeline returns the timeline of an RPC, if it is one of the recent RPCs
+func (t *Timelines) Timeline(rpcID uint64) (*RPCTimeline, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tl := t.byID[rpcID]
+	if tl == nil {
+		return nil, false
+	}
+	timeline := &RPCTimeline{
+		RPCID:     rpcID,
+		Start:     tl.start,
+		Events:    make([]TimelineEvent, len(tl.events)),
+		Truncated: tl.truncated,
+	}
+	for i, e := range tl.events {
+		event := TimelineEvent{Time: e.time, Kind: e.kind, Bytes: e.bytes, Element: e.element, Verdict: eventVerdict(e.verdict), Error: e.err}
+		if e.packetType != 0 {
+			event.PacketType = e.packetType.String()
+		}
+		if e.fragment {
+			seq, fragmentIndex := e.seq, e.fragmentIndex
+			event.Seq, event.FragmentIndex = &seq, &fragmentIndex
+		}
+		if e.peer != nil {
+			event.Peer = e.peer.String()
+		}
+		timeline.Events[i] = event
+	}
+	return timeline, true
+}
+
+// Recent returns the summaries of the recorded RPCs, most recent first
+func (t *Timelines) Recent() []TimelineSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	summaries := make([]TimelineSummary, 0, len(t.byID))
+	for _, tl := range t.byID {
+		summary := TimelineSummary{RPCID: tl.rpcID, Start: tl.start, Last: tl.start, Events: len(tl.events) + tl.truncated}
+		if len(tl.events) > 0 {
+			summary.Last = tl.events[len(tl.events)-1].time
+		}
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Start.After(summaries[j].Start) })
+	return summaries
+}
+
+// ServeHTTP serves the timeline of the RPC given by the id parameter as JSON for the admin
+// API, or the list of recent RPCs without it
+func (t *Timelines) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t.Recent())
+		return
+	}
+	rpcID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid RPC ID", http.StatusBadRequest)
+		return
+	}
+	timeline, ok := t.Timeline(rpcID)
+	if !ok {
+		http.Error(w, "RPC not recorded", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(timeline)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// listenTransparent is only supported on Linux
+func listenTransparent(addr *net.UDPAddr) (*net.UDPConn, error) {
+	return nil, errors.New("transparent sockets require Linux")
+}
@@ -0,0 +1,38 @@
+package util
+
+import "context"
+
+// PortRole tells which traffic a proxy listener intercepts
+type PortRole string
+
+const (
+	// PortRoleAny listeners receive both outbound and inbound traffic
+	PortRoleAny PortRole = ""
+	// PortRoleOutbound listeners receive the traffic of the local application to remote services
+	PortRoleOutbound PortRole = "outbound"
+	// PortRoleInbound listeners receive the traffic of remote clients to the local service
+	PortRoleInbound PortRole = "inbound"
+)
+
+// String returns the role name, "any" for PortRoleAny
+func (r PortRole) String() string {
+	if r == PortRoleAny {
+		return "any"
+	}
+	return string(r)
+}
+
+// portRoleKey is the context key for the role of the listener a packet arrived on
+type portRoleKey struct{}
+
+// WithPortRole returns a context carrying the role of the listener a packet arrived on
+func WithPortRole(ctx context.Context, role PortRole) context.Context {
+	return context.WithValue(ctx, portRoleKey{}, role)
+}
+
+// PortRoleFromContext returns the role of the listener the packet being processed arrived on.
+// Elements use it to behave differently on outbound and inbound traffic.
+func PortRoleFromContext(ctx context.Context) PortRole {
+	role, _ := ctx.Value(portRoleKey{}).(PortRole)
+	return role
+}
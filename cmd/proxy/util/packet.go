@@ -1,6 +1,10 @@
 package util
 
-import "net"
+import (
+	"net"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+)
 
 // BufferedPacket represents a complete packet ready for processing
 type BufferedPacket struct {
@@ -14,6 +18,14 @@ type BufferedPacket struct {
 	DstPort uint16
 	SrcIP   [4]byte
 	SrcPort uint16
+	// Header extensions of the packet, forwarded unchanged
+	Extensions []packet.Extension
+	// Encrypted tells whether the public segment was encrypted on the wire. Elements get it
+	// decrypted.
+	Encrypted bool
+	// Retry hint and drop reason of an error packet, forwarded unchanged
+	RetryHint  packet.RetryHint
+	DropReason packet.DropReason
 	// Fragmentation information
 	IsFull         bool   // true for full messages, false for partial messages
 	SeqNumber      int16  // sequence number (-1 for full messages or public segment)
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"errors"
 	"fmt"
 	"net"
 
@@ -9,8 +10,89 @@ import (
 	"go.uber.org/zap"
 )
 
-// SendErrorPacket sends an error packet back to the source with routing information
-func SendErrorPacket(conn *net.UDPConn, dest *net.UDPAddr, rpcID uint64, errorMsg string, dstIP [4]byte, dstPort uint16, srcIP [4]byte, srcPort uint16) error {
+// ThrottleError is returned by elements that shed load (e.g. rate limiters). The proxy
+// sends its retry hint back to the client along with the error message, so the client
+// backs off instead of retrying immediately.
+type ThrottleError struct {
+	Err  error
+	Hint packet.RetryHint
+}
+
+func (e *ThrottleError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ThrottleError) Unwrap() error {
+	return e.Err
+}
+
+// ErrDropped is returned for packets an element dropped without an error, so the client is
+// told instead of waiting for its call to time out
+var ErrDropped = errors.New("dropped by element")
+
+// DropError is returned by elements that drop a packet for a standardized reason. The proxy
+// sends the reason back to the client in the error packet, so the client can branch on it.
+type DropError struct {
+	Reason packet.DropReason
+	Err    error
+}
+
+// NewDropError returns a DropError with the given reason and message
+func NewDropError(reason packet.DropReason, msg string) *DropError {
+	return &DropError{Reason: reason, Err: errors.New(msg)}
+}
+
+func (e *DropError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DropError) Unwrap() error {
+	return e.Err
+}
+
+// LocalReply is returned, with PacketVerdictDrop, by elements that answer a request
+// themselves. Instead of an error packet, the proxy sends Payload back to the client as the
+// response of the server (see element.VerdictReply).
+type LocalReply struct {
+	Payload []byte
+}
+
+func (e *LocalReply) Error() string {
+	return "answered by the proxy"
+}
+
+// LocalReplyOf returns the local reply an element answered a request with, nil if err is not
+// a LocalReply
+func LocalReplyOf(err error) *LocalReply {
+	var reply *LocalReply
+	if errors.As(err, &reply) {
+		return reply
+	}
+	return nil
+}
+
+// DropReasonOf returns the reason a packet was dropped for with err: that of a DropError,
+// DropReasonRateLimited for a ThrottleError, and DropReasonPolicyDenied for other errors
+func DropReasonOf(err error) packet.DropReason {
+	var dropErr *DropError
+	if errors.As(err, &dropErr) {
+		return dropErr.Reason
+	}
+	var throttleErr *ThrottleError
+	if errors.As(err, &throttleErr) {
+		return packet.DropReasonRateLimited
+	}
+	return packet.DropReasonPolicyDenied
+}
+
+// PacketWriter sends datagrams. It is a *net.UDPConn, except in simulations of the proxy.
+type PacketWriter interface {
+	WriteToUDP(b []byte, addr *net.UDPAddr) (int, error)
+}
+
+// SendErrorPacket sends an error packet back to the source with routing information, the
+// retry hint and the reason of the error
+func SendErrorPacket(conn PacketWriter, dest *net.UDPAddr, rpcID uint64, errorMsg string, dstIP [4]byte, dstPort uint16, srcIP [4]byte, srcPort uint16, hint packet.RetryHint, reason packet.DropReason) error {
 	// Create error packet
 	errorPacket := &packet.ErrorPacket{
 		PacketTypeID: packet.PacketTypeError.TypeID,
@@ -20,6 +102,8 @@ func SendErrorPacket(conn *net.UDPConn, dest *net.UDPAddr, rpcID uint64, errorMs
 		SrcIP:        srcIP,
 		SrcPort:      srcPort,
 		ErrorMsg:     errorMsg,
+		RetryHint:    hint,
+		DropReason:   reason,
 	}
 
 	// Serialize the error packet
@@ -37,7 +121,10 @@ func SendErrorPacket(conn *net.UDPConn, dest *net.UDPAddr, rpcID uint64, errorMs
 	logging.Debug("Sent error packet",
 		zap.Uint64("rpcID", rpcID),
 		zap.String("dest", dest.String()),
-		zap.String("errorMsg", errorMsg))
+		zap.String("errorMsg", errorMsg),
+		zap.Stringer("throttle", hint.Throttle),
+		zap.Stringer("reason", reason),
+		zap.Duration("retryAfter", hint.RetryAfter))
 
 	return nil
 }
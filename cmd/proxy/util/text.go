@@ -0,0 +1,61 @@
+package util
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// PayloadFormatter renders a Symphony public segment for debug logging. Elements that know
+// the message types of a method typically register the String method of the generated Raw
+// type, e.g. func(p []byte) string { return kv.GetRequestRaw(p).String() }.
+type PayloadFormatter func(payload []byte) string
+
+// formatterKey identifies the message type of a payload
+type formatterKey struct {
+	serviceID  uint32
+	methodID   uint32
+	packetType PacketType
+}
+
+var (
+	formattersMu sync.RWMutex
+	formatters   = make(map[formatterKey]PayloadFormatter)
+)
+
+// RegisterPayloadFormatter registers the formatter used for payloads of the given method and packet type
+func RegisterPayloadFormatter(serviceID, methodID uint32, packetType PacketType, f PayloadFormatter) {
+	formattersMu.Lock()
+	defer formattersMu.Unlock()
+	formatters[formatterKey{serviceID: serviceID, methodID: methodID, packetType: packetType}] = f
+}
+
+// PayloadText is a fmt.Stringer that renders a public segment in a readable text format.
+// Formatting is deferred until String is called, so passing it to zap.Stringer costs
+// nothing when debug logging is disabled.
+type PayloadText struct {
+	PacketType PacketType
+	Payload    []byte
+}
+
+// String renders the payload with its registered formatter, or as a summary of the
+// Symphony header if no formatter is registered for the method
+func (t PayloadText) String() string {
+	payload := t.Payload
+	if len(payload) < 13 {
+		return fmt.Sprintf("<%d bytes, too short for a Symphony header>", len(payload))
+	}
+
+	serviceID := binary.LittleEndian.Uint32(payload[5:9])
+	methodID := binary.LittleEndian.Uint32(payload[9:13])
+
+	formattersMu.RLock()
+	f, ok := formatters[formatterKey{serviceID: serviceID, methodID: methodID, packetType: t.PacketType}]
+	formattersMu.RUnlock()
+	if ok {
+		return f(payload)
+	}
+
+	return fmt.Sprintf("version: %d offset_to_private: %d service_id: %d method_id: %d size: %d",
+		payload[0], binary.LittleEndian.Uint32(payload[1:5]), serviceID, methodID, len(payload))
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/appnet-org/arpc/pkg/schema"
+	"github.com/appnet-org/arpc/pkg/serializer"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// isPublicOption is the number of the is_public field option
+const isPublicOption = 50001
+
+// Read is a field that proxy elements read from a message: dot-separated field names from
+// the message, e.g. "user.email" of "kv.SetRequest"
+type Read struct {
+	Message string
+	Path    string
+}
+
+func (r Read) String() string {
+	return r.Message + ":" + r.Path
+}
+
+// parseReads parses declarations of the fields elements read, one message:path per line or
+// several separated by commas. Blank lines and lines starting with # are ignored.
+func parseReads(r io.Reader) ([]Read, error) {
+	var reads []Read
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		for _, entry := range strings.Split(text, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			message, path, ok := strings.Cut(entry, ":")
+			if !ok || message == "" || path == "" {
+				return nil, fmt.Errorf("line %d: invalid read %q: expected message:path", line, entry)
+			}
+			reads = append(reads, Read{Message: strings.TrimSpace(message), Path: strings.TrimSpace(path)})
+		}
+	}
+	return reads, scanner.Err()
+}
+
+// Suggestion moves a field of a message to the other segment
+type Suggestion struct {
+	Message string // full name of the message
+	Field   string
+	Public  bool // the segment the field should move to
+	Reason  string
+}
+
+func (s Suggestion) String() string {
+	verb := "make private"
+	if s.Public {
+		verb = "make public"
+	}
+	return fmt.Sprintf("%s.%s: %s (%s)", s.Message, s.Field, verb, s.Reason)
+}
+
+// payloadMessages returns the request and response messages of the services of the files,
+// which are the messages proxies see at the top level of payloads
+func payloadMessages(files []protoreflect.FileDescriptor) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, fd := range files {
+		services := fd.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				for _, md := range []protoreflect.MessageDescriptor{methods.Get(j).Input(), methods.Get(j).Output()} {
+					if name := string(md.FullName()); !seen[name] {
+						seen[name] = true
+						names = append(names, name)
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// advise returns the changes that make the public segment of each message hold exactly the
+// fields elements read. messages are analyzed in addition to those named by reads; messages
+// without a Symphony encoding are skipped. Suggestions are sorted by message, then in
+// declaration order.
+//
+// Proxies decode the public segment of the top-level message of a payload, so only the first
+// field of a path has to be public. Nested messages are embedded whole in the segment of
+// their field, so a field below the first one exposes all of its parent message.
+func advise(reg *schema.Registry, messages []string, reads []Read) ([]Suggestion, error) {
+	needed := make(map[string]map[string][]string) // message -> field -> paths reading it
+	for _, name := range messages {
+		if _, ok := reg.Message(name); ok {
+			needed[name] = make(map[string][]string)
+		}
+	}
+	for _, read := range reads {
+		first, err := resolve(reg, read)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", read, err)
+		}
+		if needed[read.Message] == nil {
+			needed[read.Message] = make(map[string][]string)
+		}
+		needed[read.Message][first] = append(needed[read.Message][first], read.Path)
+	}
+
+	names := make([]string, 0, len(needed))
+	for name := range needed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var suggestions []Suggestion
+	for _, name := range names {
+		msg, _ := reg.Message(name)
+		for _, f := range msg.Fields {
+			paths, read := needed[name][f.Name]
+			switch {
+			case read && !f.Public:
+				suggestions = append(suggestions, Suggestion{name, f.Name, true, "read by elements as " + strings.Join(paths, ", ")})
+			case !read && f.Public:
+				suggestions = append(suggestions, Suggestion{name, f.Name, false, "not read by elements"})
+			}
+		}
+	}
+	return suggestions, nil
+}
+
+// resolve checks that the path of a read names fields of nested messages, and returns the
+// name of its first field
+func resolve(reg *schema.Registry, read Read) (string, error) {
+	msg, ok := reg.Message(read.Message)
+	if !ok {
+		return "", fmt.Errorf("unknown message %s, or without a Symphony encoding", read.Message)
+	}
+	names := strings.Split(read.Path, ".")
+	for i, name := range names {
+		if msg == nil {
+			return "", fmt.Errorf("field %s is not a message", names[i-1])
+		}
+		f := msg.FieldByName(name)
+		if f == nil {
+			return "", fmt.Errorf("%s has no field %s", msg.FullName, name)
+		}
+		msg = nil
+		if f.Kind == schema.KindMessage {
+			msg, _ = reg.Message(f.Message) // nil for well-known types
+		}
+	}
+	return names[0], nil
+}
+
+// applySuggestions sets or clears the is_public option of the suggested fields in the files
+// of set. protoc-gen-symphony reads the option from the descriptors, so the set can be fed
+// back to protoc with --descriptor_set_in to regenerate the code.
+func applySuggestions(set *descriptorpb.FileDescriptorSet, suggestions []Suggestion) {
+	public := make(map[string]bool) // message.field -> public
+	for _, s := range suggestions {
+		public[s.Message+"."+s.Field] = s.Public
+	}
+
+	var walk func(prefix string, msgs []*descriptorpb.DescriptorProto)
+	walk = func(prefix string, msgs []*descriptorpb.DescriptorProto) {
+		for _, msg := range msgs {
+			name := prefix + msg.GetName()
+			for _, fd := range msg.GetField() {
+				if value, ok := public[name+"."+fd.GetName()]; ok {
+					setBoolOption(fd, isPublicOption, value)
+				}
+			}
+			walk(name+".", msg.GetNestedType())
+		}
+	}
+	for _, file := range set.GetFile() {
+		prefix := ""
+		if file.GetPackage() != "" {
+			prefix = file.GetPackage() + "."
+		}
+		walk(prefix, file.GetMessageType())
+	}
+}
+
+// setBoolOption sets a boolean field option, or clears it if value is false. The option is
+// an unknown field of the options, as loadDescriptorSet reads them without the .pb.go
+// defining it.
+func setBoolOption(fd *descriptorpb.FieldDescriptorProto, number protowire.Number, value bool) {
+	if fd.Options == nil {
+		fd.Options = &descriptorpb.FieldOptions{}
+	}
+	m := fd.Options.ProtoReflect()
+	var kept []byte
+	unknown := m.GetUnknown()
+	for len(unknown) > 0 {
+		num, typ, n := protowire.ConsumeTag(unknown)
+		if n < 0 {
+			break
+		}
+		size := n + protowire.ConsumeFieldValue(num, typ, unknown[n:])
+		if size < n {
+			break
+		}
+		if num != number {
+			kept = append(kept, unknown[:size]...)
+		}
+		unknown = unknown[size:]
+	}
+	if value {
+		kept = protowire.AppendTag(kept, number, protowire.VarintType)
+		kept = protowire.AppendVarint(kept, 1)
+	}
+	m.SetUnknown(kept)
+}
+
+// SegmentSizes compares the average public segment of the payloads of a message with the
+// current and the advised schema
+type SegmentSizes struct {
+	Message  string
+	Payloads int
+	Skipped  int // lines that did not parse as the message
+	Current  float64
+	Advised  float64
+}
+
+func (s SegmentSizes) String() string {
+	return fmt.Sprintf("%s: public segment %.1f -> %.1f bytes on average over %d payloads", s.Message, s.Current, s.Advised, s.Payloads)
+}
+
+// measureSegments encodes the recorded payloads of messages with both schemas. Payloads of a
+// message are read from <full name>.jsonl or <name>.jsonl in dir, one protobuf JSON message
+// per line, as in the payload corpora of the serialization benchmarks. Messages without
+// payloads are left out.
+func measureSegments(dir string, files []protoreflect.FileDescriptor, messages []string, current, advised *schema.Registry) ([]SegmentSizes, error) {
+	descriptors := make(map[string]protoreflect.MessageDescriptor)
+	for _, fd := range files {
+		collectMessages(fd.Messages(), descriptors)
+	}
+
+	var sizes []SegmentSizes
+	for _, name := range messages {
+		md, ok := descriptors[name]
+		if !ok {
+			continue
+		}
+		file, err := os.Open(filepath.Join(dir, name+".jsonl"))
+		if os.IsNotExist(err) {
+			file, err = os.Open(filepath.Join(dir, string(md.Name())+".jsonl"))
+		}
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		s := SegmentSizes{Message: name}
+		var currentTotal, advisedTotal int
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, 16<<20)
+		for scanner.Scan() {
+			if len(strings.TrimSpace(scanner.Text())) == 0 {
+				continue
+			}
+			msg := dynamicpb.NewMessage(md)
+			if err := protojson.Unmarshal(scanner.Bytes(), msg); err != nil {
+				s.Skipped++
+				continue
+			}
+			c, err1 := publicSize(current, name, msg)
+			a, err2 := publicSize(advised, name, msg)
+			if err1 != nil || err2 != nil {
+				s.Skipped++
+				continue
+			}
+			currentTotal += c
+			advisedTotal += a
+			s.Payloads++
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name(), err)
+		}
+		if s.Payloads > 0 {
+			s.Current = float64(currentTotal) / float64(s.Payloads)
+			s.Advised = float64(advisedTotal) / float64(s.Payloads)
+		}
+		sizes = append(sizes, s)
+	}
+	return sizes, nil
+}
+
+// collectMessages indexes messages and their nested messages by full name
+func collectMessages(msgs protoreflect.MessageDescriptors, into map[string]protoreflect.MessageDescriptor) {
+	for i := 0; i < msgs.Len(); i++ {
+		md := msgs.Get(i)
+		into[string(md.FullName())] = md
+		collectMessages(md.Messages(), into)
+	}
+}
+
+// publicSize returns the size of the public segment of msg encoded with the schema of reg
+func publicSize(reg *schema.Registry, name string, msg proto.Message) (int, error) {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+	tagged := make([]byte, 13, 13+len(data))
+	tagged[0] = serializer.CodecTagProtobuf
+	d, err := reg.Decode(append(tagged, data...), name)
+	if err != nil {
+		return 0, err
+	}
+	encoded, err := reg.Encode(d)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.LittleEndian.Uint32(encoded[1:5])), nil
+}
+
+// loadDescriptorSet reads a binary FileDescriptorSet. Options are kept as unknown fields,
+// which applySuggestions edits.
+func loadDescriptorSet(path string) (*descriptorpb.FileDescriptorSet, []protoreflect.FileDescriptor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := (proto.UnmarshalOptions{Resolver: new(protoregistry.Types)}).Unmarshal(data, set); err != nil {
+		return nil, nil, fmt.Errorf("%s: not a FileDescriptorSet: %w", path, err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var fds []protoreflect.FileDescriptor
+	for _, file := range set.GetFile() {
+		fd, err := files.FindFileByPath(file.GetName())
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		fds = append(fds, fd)
+	}
+	return set, fds, nil
+}
+
+// newRegistry registers the schemas of a set read by loadDescriptorSet. Messages without a
+// Symphony encoding are skipped, as the advisor does not analyze them.
+func newRegistry(set *descriptorpb.FileDescriptorSet) *schema.Registry {
+	reg := schema.NewRegistry()
+	_ = reg.RegisterFileDescriptorSet(set) // only reports skipped messages, as the set is valid
+	return reg
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// option returns field options with the given boolean options set, as unknown fields
+func option(numbers ...protowire.Number) *descriptorpb.FieldOptions {
+	opts := &descriptorpb.FieldOptions{}
+	var raw []byte
+	for _, number := range numbers {
+		raw = protowire.AppendTag(raw, number, protowire.VarintType)
+		raw = protowire.AppendVarint(raw, 1)
+	}
+	opts.ProtoReflect().SetUnknown(raw)
+	return opts
+}
+
+func field(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, opts *descriptorpb.FieldOptions) *descriptorpb.FieldDescriptorProto {
+	fd := &descriptorpb.FieldDescriptorProto{
+		Name:    proto.String(name),
+		Number:  proto.Int32(number),
+		Label:   descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:    typ.Enum(),
+		Options: opts,
+	}
+	if typ == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+		fd.TypeName = proto.String(".kv.User")
+	}
+	return fd
+}
+
+// writeSet writes a descriptor set of a service kv.KV with one method Set(SetRequest)
+// returns (SetResponse), and returns its path
+func writeSet(t *testing.T) string {
+	t.Helper()
+	const (
+		str = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		byt = descriptorpb.FieldDescriptorProto_TYPE_BYTES
+		msg = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+		i32 = descriptorpb.FieldDescriptorProto_TYPE_INT32
+	)
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("kv.proto"),
+		Package: proto.String("kv"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("User"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("email", 1, str, nil),
+				field("name", 2, str, nil),
+			}},
+			{Name: proto.String("SetRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("key", 1, str, option(isPublicOption)),
+				field("value", 2, byt, option(isPublicOption, 50002)),
+				field("user", 3, msg, nil),
+			}},
+			{Name: proto.String("SetResponse"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("status", 1, i32, nil),
+			}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("KV"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Set"),
+				InputType:  proto.String(".kv.SetRequest"),
+				OutputType: proto.String(".kv.SetResponse"),
+			}},
+		}},
+	}
+	data, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "kv.binpb")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAdvise(t *testing.T) {
+	set, files, err := loadDescriptorSet(writeSet(t))
+	if err != nil {
+		t.Fatalf("loadDescriptorSet failed: %v", err)
+	}
+	reads, err := parseReads(strings.NewReader("# routing\nkv.SetRequest:key\n\nkv.SetRequest:user.email, kv.SetRequest:user.name\n"))
+	if err != nil {
+		t.Fatalf("parseReads failed: %v", err)
+	}
+
+	current := newRegistry(set)
+	messages := payloadMessages(files)
+	suggestions, err := advise(current, messages, reads)
+	if err != nil {
+		t.Fatalf("advise failed: %v", err)
+	}
+	want := []string{
+		"kv.SetRequest.value: make private (not read by elements)",
+		"kv.SetRequest.user: make public (read by elements as user.email, user.name)",
+	}
+	if len(suggestions) != len(want) {
+		t.Fatalf("advise() = %v, want %v", suggestions, want)
+	}
+	for i, s := range suggestions {
+		if s.String() != want[i] {
+			t.Errorf("suggestion %d = %q, want %q", i, s, want[i])
+		}
+	}
+
+	// The advised set has the advised layout, and keeps the other options
+	applySuggestions(set, suggestions)
+	advised := newRegistry(set)
+	m, _ := advised.Message("kv.SetRequest")
+	if !m.FieldByName("key").Public || m.FieldByName("value").Public || !m.FieldByName("user").Public {
+		t.Errorf("advised layout = %+v", m.Fields)
+	}
+	if !m.FieldByName("value").Sensitive {
+		t.Error("Expected value to stay sensitive")
+	}
+	if suggestions, err := advise(advised, messages, reads); err != nil || len(suggestions) != 0 {
+		t.Errorf("advise() on the advised layout = %v, %v, want no suggestions", suggestions, err)
+	}
+
+	// The public segment no longer holds the value
+	dir := t.TempDir()
+	payloads := `{"key": "k1", "value": "` + strings.Repeat("A", 400) + `", "user": {"email": "a@example.com"}}
+not json
+{"key": "k2", "value": "` + strings.Repeat("B", 400) + `"}
+`
+	if err := os.WriteFile(filepath.Join(dir, "SetRequest.jsonl"), []byte(payloads), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sizes, err := measureSegments(dir, files, messages, current, advised)
+	if err != nil {
+		t.Fatalf("measureSegments failed: %v", err)
+	}
+	if len(sizes) != 1 || sizes[0].Message != "kv.SetRequest" || sizes[0].Payloads != 2 || sizes[0].Skipped != 1 {
+		t.Fatalf("measureSegments() = %+v, want 2 payloads and 1 skipped line of kv.SetRequest", sizes)
+	}
+	if sizes[0].Current < 300 || sizes[0].Advised > 100 {
+		t.Errorf("Expected the public segment to shrink by the value, got %v", sizes[0])
+	}
+}
+
+func TestAdvise_InvalidReads(t *testing.T) {
+	set, files, err := loadDescriptorSet(writeSet(t))
+	if err != nil {
+		t.Fatalf("loadDescriptorSet failed: %v", err)
+	}
+	reg := newRegistry(set)
+
+	for _, read := range []string{"kv.Missing:key", "kv.SetRequest:missing", "kv.SetRequest:key.length", "kv.SetRequest:user.phone"} {
+		reads, err := parseReads(strings.NewReader(read))
+		if err != nil {
+			t.Fatalf("parseReads(%q) failed: %v", read, err)
+		}
+		if _, err := advise(reg, payloadMessages(files), reads); err == nil {
+			t.Errorf("Expected error for read %q", read)
+		}
+	}
+	if _, err := parseReads(strings.NewReader("kv.SetRequest\n")); err == nil {
+		t.Error("Expected error for a read without path")
+	}
+}
@@ -0,0 +1,115 @@
+// symphony-advise suggests which fields of Symphony messages belong in the public segment:
+// exactly those that proxy elements read. Fields that no element reads are exposed to every
+// proxy on the path, and decoded by elements for nothing; fields that elements read but are
+// private cannot be read at all.
+//
+// Schemas are read from a FileDescriptorSet, as produced by
+//
+//	protoc --include_imports --descriptor_set_out=kv.binpb kv.proto
+//
+// and the fields elements read from a file of message:path declarations, one per line.
+//
+// Usage:
+//
+//	symphony-advise [-payloads dir] [-o advised.binpb] [-check] -reads reads.txt kv.binpb
+//
+// With -payloads, the average public segment of recorded payloads is compared under the
+// current and the advised layout. With -o, the descriptor set with the advised layout is
+// written, to regenerate the code with protoc --descriptor_set_in. With -check, the exit
+// status is 1 if there is any suggestion.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func main() {
+	readsPath := flag.String("reads", "", "file of the fields elements read, one message:path per line")
+	payloads := flag.String("payloads", "", "directory of recorded payloads, one <message>.jsonl file of protobuf JSON per message")
+	output := flag.String("o", "", "write the descriptor set with the advised layout to this file")
+	check := flag.Bool("check", false, "exit with status 1 if there is any suggestion")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-payloads dir] [-o advised.binpb] [-check] -reads reads.txt schema.binpb\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *readsPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	set, files, err := loadDescriptorSet(flag.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+	readsFile, err := os.Open(*readsPath)
+	if err != nil {
+		fatal(err)
+	}
+	reads, err := parseReads(readsFile)
+	readsFile.Close()
+	if err != nil {
+		fatal(fmt.Errorf("%s: %w", *readsPath, err))
+	}
+
+	current := newRegistry(set)
+	messages := payloadMessages(files)
+	suggestions, err := advise(current, messages, reads)
+	if err != nil {
+		fatal(err)
+	}
+	for _, s := range suggestions {
+		fmt.Println(s)
+	}
+
+	applySuggestions(set, suggestions)
+	if *payloads != "" {
+		for _, read := range reads {
+			messages = append(messages, read.Message)
+		}
+		sizes, err := measureSegments(*payloads, files, unique(messages), current, newRegistry(set))
+		if err != nil {
+			fatal(err)
+		}
+		for _, s := range sizes {
+			fmt.Println(s)
+			if s.Skipped > 0 {
+				fmt.Fprintf(os.Stderr, "%s: skipped %d payloads that did not parse\n", s.Message, s.Skipped)
+			}
+		}
+	}
+	if *output != "" {
+		data, err := proto.Marshal(set)
+		if err != nil {
+			fatal(err)
+		}
+		if err := os.WriteFile(*output, data, 0o644); err != nil {
+			fatal(err)
+		}
+	}
+	if *check && len(suggestions) > 0 {
+		os.Exit(1)
+	}
+}
+
+// unique returns names without duplicates, in order of first occurrence
+func unique(names []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}
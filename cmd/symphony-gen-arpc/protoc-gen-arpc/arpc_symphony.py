@@ -0,0 +1,436 @@
+"""Runtime of the Python bindings generated by protoc-gen-arpc with lang=python.
+
+It holds the Symphony encoding of the generated messages, and Client, which calls aRPC
+services over UDP. The modules generated from .proto files import it; it is written next to
+them, so it is code generated by protoc-gen-arpc. DO NOT EDIT.
+
+Only what Python tooling needs is supported: scalar, enum, string and bytes fields, repeated
+fields of those, and nested messages of the same file. Messages with well-known types, delta
+encoded or interned fields, or without a Symphony encoding at all raise NotImplementedError.
+Messages generated with protoc-gen-symphony's checksum parameter are not supported either.
+"""
+
+import socket
+import struct
+import time
+
+# Kinds of fields. Enums are encoded as INT32.
+BOOL, INT32, INT64, UINT32, UINT64, FLOAT, DOUBLE, STRING, BYTES, MESSAGE = range(10)
+
+# struct formats of the fixed-length kinds
+_FIXED = {BOOL: "?", INT32: "i", INT64: "q", UINT32: "I", UINT64: "Q", FLOAT: "f", DOUBLE: "d"}
+
+# Size of the reserved header of the public segment: version, offset to the private segment,
+# service ID and method ID
+HEADER_SIZE = 13
+
+# Tag of the payloads of raw methods, whose body follows the reserved header (see
+# serializer.RawMessage)
+CODEC_TAG_RAW = 0x03
+
+# Packet types, and the size of the fixed header of data packets (see pkg/packet). Servers
+# answer errors other than RPCErrors with error packets of the unknown type.
+PACKET_TYPE_UNKNOWN = 0
+PACKET_TYPE_REQUEST = 1
+PACKET_TYPE_RESPONSE = 2
+PACKET_TYPE_ERROR = 3
+DATA_PACKET_HEADER_SIZE = 31
+MAX_UDP_PAYLOAD_SIZE = 1400
+
+_FLAG_MORE_FRAGMENTS = 1 << 0
+_FLAG_HAS_EXTENSIONS = 1 << 1
+_EXTENSION_USER_AGENT = 7
+MAX_USER_AGENT_SIZE = 24
+
+
+class Field:
+    """A field of a message: its Python name, proto number and kind, whether it is in the
+    public segment, whether it is repeated, and the class of its messages."""
+
+    __slots__ = ("name", "number", "kind", "public", "repeated", "message")
+
+    def __init__(self, name, number, kind, public=False, repeated=False, message=None):
+        self.name = name
+        self.number = number
+        self.kind = kind
+        self.public = public
+        self.repeated = repeated
+        self.message = message
+
+    def default(self):
+        if self.repeated:
+            return []
+        if self.kind == MESSAGE:
+            return None
+        if self.kind == BOOL:
+            return False
+        if self.kind in (FLOAT, DOUBLE):
+            return 0.0
+        if self.kind == STRING:
+            return ""
+        if self.kind == BYTES:
+            return b""
+        return 0
+
+
+class Message:
+    """Base class of the generated messages. Fields are attributes named like in the .proto
+    file, set by keyword in the constructor and defaulting to the proto3 zero values."""
+
+    __slots__ = ()
+    _name = "Message"
+    _fields = ()
+    _public = ()
+    _private = ()
+    _unsupported = None  # why the message has no Python encoding, if it has none
+
+    def __init__(self, **kwargs):
+        if self._unsupported:
+            raise NotImplementedError(unsupported_error(self._name, self._unsupported))
+        for field in self._fields:
+            setattr(self, field.name, kwargs.pop(field.name, field.default()))
+        if kwargs:
+            raise TypeError("%s has no field %s" % (self._name, ", ".join(sorted(kwargs))))
+
+    def __eq__(self, other):
+        if type(other) is not type(self):
+            return NotImplemented
+        return all(getattr(self, f.name) == getattr(other, f.name) for f in self._fields)
+
+    def __repr__(self):
+        values = ", ".join("%s=%r" % (f.name, getattr(self, f.name)) for f in self._fields)
+        return "%s(%s)" % (self._name, values)
+
+    def encode(self):
+        """Returns the Symphony encoding of the message"""
+        return encode(self)
+
+    @classmethod
+    def decode(cls, data):
+        """Returns the message encoded in data, raising ValueError if it is malformed"""
+        return decode(cls, data)
+
+
+def describe(cls, name, *fields, unsupported=None):
+    """Sets the fields of a generated message class, in declaration order"""
+    cls._name = name
+    cls._fields = fields
+    cls._public = tuple(f for f in fields if f.public)
+    cls._private = tuple(f for f in fields if not f.public)
+    cls._unsupported = unsupported
+
+
+def unsupported_error(name, reason):
+    return "symphony: %s is not supported by the Python runtime: %s" % (name, reason)
+
+
+def encode(msg):
+    """Returns the Symphony encoding of msg: the public segment, with the reserved header,
+    then the private segment. Table entries of variable-length fields hold the offset of
+    their payload from the start of their segment."""
+    if msg._unsupported:
+        raise NotImplementedError(unsupported_error(msg._name, msg._unsupported))
+    public = _encode_segment(msg, msg._public, HEADER_SIZE)
+    private = _encode_segment(msg, msg._private, 1)
+    header = struct.pack("<BIII", 0x01, HEADER_SIZE + len(public), 0, 0)
+    return header + public + b"\x01" + private
+
+
+def _table_size(fields):
+    return sum(4 if f.repeated or f.kind not in _FIXED else struct.calcsize(_FIXED[f.kind]) for f in fields)
+
+
+def _encode_segment(msg, fields, start):
+    """Encodes the table and payloads of the fields of a segment whose table begins start
+    bytes into the segment"""
+    table = bytearray()
+    payloads = bytearray()
+    payload_start = start + _table_size(fields)
+    for field in fields:
+        value = getattr(msg, field.name)
+        if not field.repeated and field.kind in _FIXED:
+            table += struct.pack("<" + _FIXED[field.kind], value)
+        elif not field.repeated and field.kind == MESSAGE and value is None:
+            table += struct.pack("<I", 0)
+        else:
+            table += struct.pack("<I", payload_start + len(payloads))
+            payloads += _encode_payload(field, value)
+    return bytes(table + payloads)
+
+
+def _encode_payload(field, value):
+    if not field.repeated:
+        return _encode_item(field, value)
+    if field.kind in _FIXED:
+        return struct.pack("<I%d%s" % (len(value), _FIXED[field.kind]), len(value), *value)
+    return struct.pack("<I", len(value)) + b"".join(_encode_item(field, item) for item in value)
+
+
+def _encode_item(field, value):
+    """Encodes a length-prefixed string, bytes or message"""
+    if field.kind == STRING:
+        data = value.encode("utf-8")
+    elif field.kind == BYTES:
+        data = bytes(value)
+    else:
+        if not isinstance(value, field.message):
+            raise TypeError("field %s holds %s, expected %s" % (field.name, type(value).__name__, field.message._name))
+        data = encode(value)
+    return struct.pack("<I", len(data)) + data
+
+
+def decode(cls, data):
+    """Returns the message of class cls encoded in data"""
+    if cls._unsupported:
+        raise NotImplementedError(unsupported_error(cls._name, cls._unsupported))
+    data = bytes(data)
+    if len(data) < HEADER_SIZE or data[0] != 0x01:
+        raise ValueError("invalid data: wrong public version")
+    private = struct.unpack_from("<I", data, 1)[0]
+    if private >= len(data) or data[private] != 0x01:
+        raise ValueError("missing private segment")
+
+    msg = cls.__new__(cls)
+    _decode_segment(msg, cls._public, data, 0, HEADER_SIZE)
+    _decode_segment(msg, cls._private, data, private, private + 1)
+    return msg
+
+
+def _decode_segment(msg, fields, data, base, table):
+    """Decodes the fields of the segment starting at base, whose table is at table"""
+    for field in fields:
+        if not field.repeated and field.kind in _FIXED:
+            fmt = "<" + _FIXED[field.kind]
+            setattr(msg, field.name, _unpack(fmt, data, table)[0])
+            table += struct.calcsize(fmt)
+            continue
+        offset = _unpack("<I", data, table)[0]
+        table += 4
+        if offset == 0 and not field.repeated and field.kind == MESSAGE:
+            setattr(msg, field.name, None)
+            continue
+        setattr(msg, field.name, _decode_payload(field, data, base + offset))
+
+
+def _decode_payload(field, data, pos):
+    if not field.repeated:
+        return _decode_item(field, data, pos)[0]
+    count = _unpack("<I", data, pos)[0]
+    pos += 4
+    if field.kind in _FIXED:
+        return list(_unpack("<%d%s" % (count, _FIXED[field.kind]), data, pos))
+    items = []
+    for _ in range(count):
+        item, pos = _decode_item(field, data, pos)
+        items.append(item)
+    return items
+
+
+def _decode_item(field, data, pos):
+    """Decodes a length-prefixed string, bytes or message, and returns the position after it"""
+    size = _unpack("<I", data, pos)[0]
+    end = pos + 4 + size
+    if end > len(data):
+        raise ValueError("invalid data: field %s is truncated" % field.name)
+    item = data[pos + 4 : end]
+    if field.kind == STRING:
+        return item.decode("utf-8"), end
+    if field.kind == BYTES:
+        return item, end
+    return decode(field.message, item), end
+
+
+def _unpack(fmt, data, pos):
+    if pos < 0 or pos + struct.calcsize(fmt) > len(data):
+        raise ValueError("invalid data: too short for field")
+    return struct.unpack_from(fmt, data, pos)
+
+
+def encode_raw(body):
+    """Returns the payload of a raw method carrying body"""
+    return struct.pack("<BI8x", CODEC_TAG_RAW, HEADER_SIZE) + bytes(body)
+
+
+def decode_raw(data):
+    """Returns the body of the payload of a raw method"""
+    if len(data) < HEADER_SIZE or data[0] != CODEC_TAG_RAW:
+        raise ValueError("invalid data: not a raw payload")
+    return bytes(data[HEADER_SIZE:])
+
+
+def fragment(data, mtu):
+    """Splits a payload into fragments of at most mtu bytes like transport.FragmentPackets:
+    the public segment fills the first fragments, and the fragment where it meets the
+    private segment absorbs the slack, so the private segment ends on fragment boundaries."""
+    if len(data) <= mtu:
+        return [data]
+    offset_to_private = struct.unpack_from("<I", data, 1)[0]
+    public, private = data[:offset_to_private], data[offset_to_private:]
+
+    fragments = []
+    while len(public) > mtu:
+        fragments.append(public[:mtu])
+        public = public[mtu:]
+    if private:
+        head = len(private) % mtu
+        meeting = public + private[:head]
+        private = private[head:]
+        if len(meeting) <= mtu:
+            fragments.append(meeting)
+        else:
+            fragments.append(meeting[:mtu])
+            fragments.append(meeting[mtu:])
+    elif public:
+        fragments.append(public)
+    while private:
+        fragments.append(private[:mtu])
+        private = private[mtu:]
+    return fragments
+
+
+class RPCError(Exception):
+    """The error a server or proxy answered a call with. retry_after is the wait, in
+    seconds, the sender asked for (see packet.RetryHint); drop_reason is the
+    packet.DropReason of a call dropped by a proxy, 0 for errors of the server."""
+
+    def __init__(self, message, throttle=0, retry_after=0.0, drop_reason=0):
+        super().__init__(message)
+        self.message = message
+        self.throttle = throttle
+        self.retry_after = retry_after
+        self.drop_reason = drop_reason
+
+
+class Client:
+    """A client calling aRPC services over UDP, without encryption. Calls are synchronous:
+    call waits for the response of each request before the next one is sent.
+
+    address is the server as "host:port" or a (host, port) tuple. Calls without a timeout
+    of their own fail with TimeoutError after timeout seconds. user_agent, of at most
+    MAX_USER_AGENT_SIZE bytes, is sent with every request like rpc.WithUserAgent."""
+
+    def __init__(self, address, timeout=5.0, user_agent="", local_address=("0.0.0.0", 0)):
+        if isinstance(address, str):
+            host, _, port = address.rpartition(":")
+            address = (host, int(port))
+        self._address = (socket.gethostbyname(address[0]), address[1])
+        self._timeout = timeout
+        self._extensions = b""
+        if user_agent:
+            agent = user_agent.encode("utf-8")
+            if len(agent) > MAX_USER_AGENT_SIZE:
+                raise ValueError("user agent longer than %d bytes" % MAX_USER_AGENT_SIZE)
+            self._extensions = struct.pack("<HBB", 2 + len(agent), _EXTENSION_USER_AGENT, len(agent)) + agent
+
+        # Servers answer the source address in the packet header, so bind to the address
+        # the server is reached from rather than to 0.0.0.0
+        host, port = local_address
+        if host in ("", "0.0.0.0"):
+            probe = socket.socket(socket.AF_INET, socket.SOCK_DGRAM)
+            try:
+                probe.connect(self._address)
+                host = probe.getsockname()[0]
+            finally:
+                probe.close()
+        self._sock = socket.socket(socket.AF_INET, socket.SOCK_DGRAM)
+        self._sock.bind((host, port))
+        self._source = self._sock.getsockname()
+        self._last_rpc_id = 0
+
+    def close(self):
+        self._sock.close()
+
+    def __enter__(self):
+        return self
+
+    def __exit__(self, *exc):
+        self.close()
+
+    def call(self, service_id, method_id, request, response_type, timeout=None):
+        """Calls a method with request, a message or the bytes of a raw method, and returns
+        the response decoded as response_type, or its bytes if response_type is bytes"""
+        payload = encode_raw(request) if isinstance(request, (bytes, bytearray)) else request.encode()
+        payload = bytearray(payload)
+        struct.pack_into("<II", payload, 5, service_id, method_id)
+
+        # RPC IDs are timestamps like transport.GenerateRPCID, strictly increasing per client
+        rpc_id = max(time.time_ns(), self._last_rpc_id + 1) & 0xFFFFFFFFFFFFFFFF
+        self._last_rpc_id = rpc_id
+        self._send(rpc_id, bytes(payload))
+
+        data = self._receive(rpc_id, self._timeout if timeout is None else timeout)
+        if response_type is bytes:
+            return decode_raw(data)
+        return response_type.decode(data)
+
+    def _send(self, rpc_id, payload):
+        mtu = MAX_UDP_PAYLOAD_SIZE - DATA_PACKET_HEADER_SIZE - len(self._extensions)
+        fragments = fragment(payload, mtu)
+        if len(fragments) > 0xFFFF:
+            raise ValueError("message too large: %d bytes need %d fragments" % (len(payload), len(fragments)))
+        flags = _FLAG_HAS_EXTENSIONS if self._extensions else 0
+        dst = socket.inet_aton(self._address[0])
+        src = socket.inet_aton(self._source[0])
+        for seq, chunk in enumerate(fragments):
+            header = struct.pack(
+                "<BQHHBB4sH4sHI", PACKET_TYPE_REQUEST, rpc_id, len(fragments), seq, flags, 0,
+                dst, self._address[1], src, self._source[1], len(chunk))
+            self._sock.sendto(header + self._extensions + chunk, self._address)
+
+    def _receive(self, rpc_id, timeout):
+        """Waits for the response or error of rpc_id, reassembling its fragments"""
+        deadline = None if timeout is None else time.monotonic() + timeout
+        fragments = {}  # by sequence number, then fragment index
+        last = {}  # index of the last fragment of each sequence number
+        while True:
+            if deadline is not None:
+                remaining = deadline - time.monotonic()
+                if remaining <= 0:
+                    raise TimeoutError("no response to RPC %d" % rpc_id)
+                self._sock.settimeout(remaining)
+            try:
+                datagram, _ = self._sock.recvfrom(65535)
+            except socket.timeout:
+                raise TimeoutError("no response to RPC %d" % rpc_id) from None
+            if len(datagram) < 9 or struct.unpack_from("<Q", datagram, 1)[0] != rpc_id:
+                continue
+
+            if datagram[0] in (PACKET_TYPE_ERROR, PACKET_TYPE_UNKNOWN):
+                raise _parse_error(datagram)
+            if datagram[0] != PACKET_TYPE_RESPONSE or len(datagram) < DATA_PACKET_HEADER_SIZE:
+                continue
+            total, seq, flags, index = struct.unpack_from("<HHBB", datagram, 9)
+            size = struct.unpack_from("<I", datagram, 27)[0]
+            start = DATA_PACKET_HEADER_SIZE
+            if flags & _FLAG_HAS_EXTENSIONS:
+                start += 2 + struct.unpack_from("<H", datagram, start)[0]
+            fragments.setdefault(seq, {})[index] = datagram[start : start + size]
+            if not flags & _FLAG_MORE_FRAGMENTS:
+                last[seq] = max(index, last.get(seq, 0))
+
+            if len(fragments) == total and all(
+                    seq in last and len(fragments[seq]) == last[seq] + 1 for seq in fragments):
+                return b"".join(fragments[s][i] for s in range(total) for i in range(last[s] + 1))
+
+
+def _parse_error(datagram):
+    """Returns the RPCError of an error packet (see packet.ErrorPacketCodec)"""
+    if len(datagram) < 29:
+        return RPCError("malformed error packet")
+    size = struct.unpack_from("<I", datagram, 21)[0]
+    message = datagram[25 : 25 + size].decode("utf-8", "replace")
+    hint = 25 + size
+    throttle, retry_after, drop_reason = 0, 0.0, 0
+    if len(datagram) >= hint + 4 and datagram[hint] <= 2:
+        throttle = datagram[hint]
+        retry_after = int.from_bytes(datagram[hint + 1 : hint + 4], "little") / 1000
+    if len(datagram) > hint + 4:
+        drop_reason = datagram[hint + 4]
+    return RPCError(message, throttle, retry_after, drop_reason)
+
+
+__all__ = [
+    "BOOL", "INT32", "INT64", "UINT32", "UINT64", "FLOAT", "DOUBLE", "STRING", "BYTES", "MESSAGE",
+    "Field", "Message", "describe", "encode", "decode", "encode_raw", "decode_raw", "fragment",
+    "RPCError", "Client",
+]
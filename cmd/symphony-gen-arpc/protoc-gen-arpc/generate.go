@@ -4,6 +4,15 @@ import (
 	"fmt"
 
 	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+var (
+	schemaPkg     = protogen.GoImportPath("github.com/appnet-org/arpc/pkg/schema")
+	serializerPkg = protogen.GoImportPath("github.com/appnet-org/arpc/pkg/serializer")
+	iterPkg       = protogen.GoImportPath("iter")
+	protoPkg      = protogen.GoImportPath("google.golang.org/protobuf/proto")
 )
 
 // generateFile generates the _arpc.pb.go file for a given proto file.
@@ -99,11 +108,32 @@ func genService(g *protogen.GeneratedFile, service *protogen.Service, serviceID
 		g.P()
 	}
 
+	// Register the request and response messages of each method for dynamic decoding
+	if len(service.Methods) > 0 {
+		g.P("func init() {")
+		for _, m := range service.Methods {
+			g.P("  ", schemaPkg.Ident("Global"), ".RegisterMethod(&", schemaPkg.Ident("MethodSchema"), "{")
+			g.P("    ServiceID: ServiceID_", svcName, ",")
+			g.P("    MethodID: ", svcName, "_MethodID_", m.GoName, ",")
+			g.P("    Service: \"", svcName, "\",")
+			g.P("    Method: \"", m.GoName, "\",")
+			g.P("    Request: \"", m.Input.Desc.FullName(), "\",")
+			g.P("    Response: \"", m.Output.Desc.FullName(), "\",")
+			g.P("  })")
+		}
+		g.P("}")
+		g.P()
+	}
+
 	// === Client interface ===
 	g.P("// ", clientName, " is the client API for ", svcName, " service.")
 	g.P("type ", clientName, " interface {")
 	for _, m := range service.Methods {
-		g.P(m.GoName, "(ctx context.Context, req *", m.Input.GoIdent, ") (*", m.Output.GoIdent, ", error)")
+		g.P(m.GoName, "(ctx context.Context, req ", messageType(g, m.Input), ", opts ...rpc.CallOption) (", messageType(g, m.Output), ", error)")
+		if _, _, items, ok := listFields(m); ok {
+			g.P("// ", m.GoName, "All calls ", m.GoName, " for each page of the list and yields its items")
+			g.P(m.GoName, "All(ctx context.Context, req ", messageType(g, m.Input), ", opts ...rpc.CallOption) ", iterPkg.Ident("Seq2"), "[", itemType(g, items), ", error]")
+		}
 	}
 	g.P("}")
 	g.P()
@@ -131,13 +161,59 @@ func genService(g *protogen.GeneratedFile, service *protogen.Service, serviceID
 		methodName := m.GoName
 
 		g.P("func (c *", implName, ") ", methodName,
-			"(ctx context.Context, req *", m.Input.GoIdent, ") (*", m.Output.GoIdent, ", error) {")
+			"(ctx context.Context, req ", messageType(g, m.Input), ", opts ...rpc.CallOption) (", messageType(g, m.Output), ", error) {")
 
-		g.P("  resp := new(", m.Output.GoIdent, ")")
-		g.P("  if err := c.client.Call(ctx, \"", serviceName, "\", \"", methodName, "\", req, resp); err != nil {")
+		// Raw requests and responses are passed through as bytes
+		callReq := "req"
+		if isRaw(m.Input) {
+			callReq = g.QualifiedGoIdent(serializerPkg.Ident("RawMessage")) + "(req)"
+		}
+		if isRaw(m.Output) {
+			g.P("  var resp ", serializerPkg.Ident("RawMessage"))
+			g.P("  if err := c.client.Call(ctx, \"", serviceName, "\", \"", methodName, "\", ", callReq, ", &resp, opts...); err != nil {")
+		} else {
+			g.P("  resp := new(", m.Output.GoIdent, ")")
+			g.P("  if err := c.client.Call(ctx, \"", serviceName, "\", \"", methodName, "\", ", callReq, ", resp, opts...); err != nil {")
+		}
 		g.P("    return nil, err")
 		g.P("  }")
-		g.P("  return resp, nil")
+		if isRaw(m.Output) {
+			g.P("  return []byte(resp), nil")
+		} else {
+			g.P("  return resp, nil")
+		}
+		g.P("}")
+		g.P()
+
+		// List methods get an iterator following the continuation tokens
+		token, next, items, ok := listFields(m)
+		if !ok {
+			continue
+		}
+		g.P("func (c *", implName, ") ", methodName, "All(ctx context.Context, req ", messageType(g, m.Input), ", opts ...rpc.CallOption) ", iterPkg.Ident("Seq2"), "[", itemType(g, items), ", error] {")
+		g.P("  return func(yield func(", itemType(g, items), ", error) bool) {")
+		g.P("    page := new(", m.Input.GoIdent, ")")
+		g.P("    if req != nil {")
+		g.P("      page = ", protoPkg.Ident("Clone"), "(req).(*", m.Input.GoIdent, ")")
+		g.P("    }")
+		g.P("    for {")
+		g.P("      resp, err := c.", methodName, "(ctx, page, opts...)")
+		g.P("      if err != nil {")
+		g.P("        var zero ", itemType(g, items))
+		g.P("        yield(zero, err)")
+		g.P("        return")
+		g.P("      }")
+		g.P("      for _, item := range resp.", items.GoName, " {")
+		g.P("        if !yield(item, nil) {")
+		g.P("          return")
+		g.P("        }")
+		g.P("      }")
+		g.P("      if resp.", next.GoName, " == \"\" {")
+		g.P("        return")
+		g.P("      }")
+		g.P("      page.", token.GoName, " = resp.", next.GoName)
+		g.P("    }")
+		g.P("  }")
 		g.P("}")
 		g.P()
 	}
@@ -145,13 +221,42 @@ func genService(g *protogen.GeneratedFile, service *protogen.Service, serviceID
 	// === Server interface ===
 	g.P("type ", svcName, "Server interface {")
 	for _, m := range service.Methods {
-		g.P(m.GoName, "(ctx context.Context, req *", m.Input.GoIdent, ") (*", m.Output.GoIdent, ", context.Context, error)")
+		g.P(m.GoName, "(ctx context.Context, req ", messageType(g, m.Input), ") (", messageType(g, m.Output), ", context.Context, error)")
+	}
+	g.P("}")
+	g.P()
+
+	// === Per-method server options ===
+	optionsName := svcName + "ServerOptions"
+	g.P("// ", optionsName, " holds the options the server enforces for each method of ", svcName)
+	g.P("type ", optionsName, " struct {")
+	for _, m := range service.Methods {
+		g.P(m.GoName, " rpc.MethodOptions")
 	}
 	g.P("}")
 	g.P()
 
+	g.P("// Default", optionsName, " returns the options declared in the proto file: methods with an")
+	g.P("// idempotency_level are Idempotent.")
+	g.P("func Default", optionsName, "() ", optionsName, " {")
+	g.P("  return ", optionsName, "{")
+	for _, m := range service.Methods {
+		if isIdempotent(m) {
+			g.P("    ", m.GoName, ": rpc.MethodOptions{Idempotent: true},")
+		}
+	}
+	g.P("  }")
+	g.P("}")
+	g.P()
+
 	// === Service registration ===
-	g.P("func Register", svcName, "Server(s *rpc.Server, srv ", svcName, "Server) {")
+	g.P("// Register", svcName, "Server registers srv with s. The methods use the options of")
+	g.P("// Default", optionsName, " unless opts is given.")
+	g.P("func Register", svcName, "Server(s *rpc.Server, srv ", svcName, "Server, opts ...", optionsName, ") {")
+	g.P("  o := Default", optionsName, "()")
+	g.P("  if len(opts) > 0 {")
+	g.P("    o = opts[len(opts)-1]")
+	g.P("  }")
 	g.P("  s.RegisterService(&rpc.ServiceDesc{")
 	g.P("    ServiceName: \"", service.GoName, "\",")
 	g.P("    ServiceID: ServiceID_", service.GoName, ",")
@@ -159,10 +264,14 @@ func genService(g *protogen.GeneratedFile, service *protogen.Service, serviceID
 	g.P("    MethodsByID: map[uint32]*rpc.MethodDesc{")
 	for _, m := range service.Methods {
 		handlerName := fmt.Sprintf("_%s_%s_Handler", svcName, m.GoName)
+		if _, _, _, ok := listFields(m); ok {
+			handlerName += "(o." + m.GoName + ".MaxPageBytes)"
+		}
 		g.P("      ", svcName, "_MethodID_", m.GoName, ": {")
 		g.P("        MethodName: \"", m.GoName, "\",")
 		g.P("        MethodID: ", svcName, "_MethodID_", m.GoName, ",")
 		g.P("        Handler: ", handlerName, ",")
+		g.P("        Options: o.", m.GoName, ",")
 		g.P("      },")
 	}
 	g.P("    },")
@@ -173,7 +282,20 @@ func genService(g *protogen.GeneratedFile, service *protogen.Service, serviceID
 	// === Method handler implementations ===
 	for _, m := range service.Methods {
 		handlerName := fmt.Sprintf("_%s_%s_Handler", svcName, m.GoName)
+		if _, _, _, ok := listFields(m); ok {
+			genListHandler(g, svcName, m, handlerName)
+			continue
+		}
 		inputType := m.Input.GoIdent.GoName
+		arg := "req.Payload.(*" + inputType + ")"
+		if isRaw(m.Input) {
+			inputType = g.QualifiedGoIdent(serializerPkg.Ident("RawMessage"))
+			arg = "[]byte(*req.Payload.(*" + inputType + "))"
+		}
+		result := "result"
+		if isRaw(m.Output) {
+			result = g.QualifiedGoIdent(serializerPkg.Ident("RawMessage")) + "(result)"
+		}
 
 		// Each handler decodes the request and invokes the appropriate method
 		g.P("func ", handlerName, "(srv any, ctx context.Context, dec func(any) error, req *element.RPCRequest, chain *element.RPCElementChain) (*element.RPCResponse, context.Context, error) {")
@@ -181,11 +303,11 @@ func genService(g *protogen.GeneratedFile, service *protogen.Service, serviceID
 		g.P("  if err := dec(req.Payload); err != nil { return nil, ctx, err }")
 		g.P("  req, ctx, err := chain.ProcessRequest(ctx, req)")
 		g.P("  if err != nil { return nil, ctx, err }")
-		g.P("  result, ctx, err := srv.(", svcName, "Server).", m.GoName, "(ctx, req.Payload.(*", inputType, "))")
+		g.P("  result, ctx, err := srv.(", svcName, "Server).", m.GoName, "(ctx, ", arg, ")")
 		g.P("  if err != nil { return nil, ctx, err }")
 		g.P("  resp := &element.RPCResponse{")
 		g.P("    ID:     req.ID,")
-		g.P("    Result: result,")
+		g.P("    Result: ", result, ",")
 		g.P("  }")
 		g.P("  resp, ctx, err = chain.ProcessResponse(ctx, resp)")
 		g.P("  if err != nil { return nil, ctx, err }")
@@ -194,3 +316,130 @@ func genService(g *protogen.GeneratedFile, service *protogen.Service, serviceID
 		g.P("")
 	}
 }
+
+// genListHandler generates the handler of a list method, which splits the list of the
+// response into pages with continuation tokens (see rpc.Paginate), unless the server
+// paginated it itself
+func genListHandler(g *protogen.GeneratedFile, svcName string, m *protogen.Method, handlerName string) {
+	token, next, items, _ := listFields(m)
+	inputType := m.Input.GoIdent.GoName
+
+	g.P("func ", handlerName, "(maxPageBytes int) rpc.MethodHandler {")
+	g.P("  return func(srv any, ctx context.Context, dec func(any) error, req *element.RPCRequest, chain *element.RPCElementChain) (*element.RPCResponse, context.Context, error) {")
+	g.P("    req.Payload = new(", inputType, ")")
+	g.P("    if err := dec(req.Payload); err != nil { return nil, ctx, err }")
+	g.P("    req, ctx, err := chain.ProcessRequest(ctx, req)")
+	g.P("    if err != nil { return nil, ctx, err }")
+	g.P("    // The server is asked for the whole list again for the later pages of its response")
+	g.P("    in := req.Payload.(*", inputType, ")")
+	g.P("    pageToken := \"\"")
+	g.P("    if rpc.IsPageToken(in.", token.GoName, ") {")
+	g.P("      pageToken, in.", token.GoName, " = in.", token.GoName, ", \"\"")
+	g.P("    }")
+	g.P("    paginate := in.", token.GoName, " == \"\"")
+	g.P("    result, ctx, err := srv.(", svcName, "Server).", m.GoName, "(ctx, in)")
+	g.P("    if err != nil { return nil, ctx, err }")
+	g.P("    if paginate && result != nil && result.", next.GoName, " == \"\" {")
+	g.P("      start, end, next, err := rpc.Paginate(pageToken, len(result.", items.GoName, "), maxPageBytes, func(i int) int { return ", itemSize(g, items, "result."+items.GoName+"[i]"), " })")
+	g.P("      if err != nil { return nil, ctx, err }")
+	g.P("      result.", items.GoName, ", result.", next.GoName, " = result.", items.GoName, "[start:end], next")
+	g.P("    }")
+	g.P("    resp := &element.RPCResponse{")
+	g.P("      ID:     req.ID,")
+	g.P("      Result: result,")
+	g.P("    }")
+	g.P("    resp, ctx, err = chain.ProcessResponse(ctx, resp)")
+	g.P("    if err != nil { return nil, ctx, err }")
+	g.P("    return resp, ctx, err")
+	g.P("  }")
+	g.P("}")
+	g.P("")
+}
+
+// listFields returns the fields of a list method following the page token convention of
+// AIP-158: a page_token string in the request, and in the response a next_page_token string
+// and a single repeated field of items. ok is false for other methods.
+func listFields(m *protogen.Method) (token, next, items *protogen.Field, ok bool) {
+	if isRaw(m.Input) || isRaw(m.Output) {
+		return nil, nil, nil, false
+	}
+	isToken := func(f *protogen.Field, name protoreflect.Name) bool {
+		return f.Desc.Name() == name && f.Desc.Kind() == protoreflect.StringKind && !f.Desc.IsList() && !f.Desc.HasPresence()
+	}
+	for _, f := range m.Input.Fields {
+		if isToken(f, "page_token") {
+			token = f
+		}
+	}
+	for _, f := range m.Output.Fields {
+		switch {
+		case isToken(f, "next_page_token"):
+			next = f
+		case f.Desc.IsList():
+			if items != nil {
+				return nil, nil, nil, false
+			}
+			items = f
+		}
+	}
+	return token, next, items, token != nil && next != nil && items != nil
+}
+
+// itemType returns the Go type of the items of a repeated field
+func itemType(g *protogen.GeneratedFile, f *protogen.Field) string {
+	switch f.Desc.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return "*" + g.QualifiedGoIdent(f.Message.GoIdent)
+	case protoreflect.EnumKind:
+		return g.QualifiedGoIdent(f.Enum.GoIdent)
+	case protoreflect.BytesKind:
+		return "[]byte"
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return "int32"
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return "uint32"
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return "int64"
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return "uint64"
+	case protoreflect.FloatKind:
+		return "float32"
+	case protoreflect.DoubleKind:
+		return "float64"
+	default:
+		return f.Desc.Kind().String() // bool and string
+	}
+}
+
+// itemSize returns an expression of the approximate encoded size of item, an item of f
+func itemSize(g *protogen.GeneratedFile, f *protogen.Field, item string) string {
+	switch f.Desc.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return g.QualifiedGoIdent(protoPkg.Ident("Size")) + "(" + item + ")"
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		return "len(" + item + ")"
+	default:
+		return "8"
+	}
+}
+
+// isRaw reports whether a request or response is declared as google.protobuf.BytesValue,
+// whose methods pass opaque bytes through without encoding them (see serializer.RawMessage)
+func isRaw(m *protogen.Message) bool {
+	return m.Desc.FullName() == "google.protobuf.BytesValue"
+}
+
+// messageType returns the Go type of a request or response in the generated stubs
+func messageType(g *protogen.GeneratedFile, m *protogen.Message) string {
+	if isRaw(m) {
+		return "[]byte"
+	}
+	return "*" + g.QualifiedGoIdent(m.GoIdent)
+}
+
+// isIdempotent reports whether the idempotency_level option of a method says its calls may
+// safely run more than once
+func isIdempotent(m *protogen.Method) bool {
+	opts, ok := m.Desc.Options().(*descriptorpb.MethodOptions)
+	return ok && opts.GetIdempotencyLevel() != descriptorpb.MethodOptions_IDEMPOTENCY_UNKNOWN
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// catalogFile declares list methods following the page token convention, and methods that
+// do not: Get has no page tokens, and Tagged two repeated fields
+func catalogFile() *descriptorpb.FileDescriptorProto {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, repeated bool, typeName string) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		f := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Type: typ.Enum(), Label: label.Enum()}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	str, msg := descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	method := func(name, input, output string) *descriptorpb.MethodDescriptorProto {
+		return &descriptorpb.MethodDescriptorProto{Name: proto.String(name), InputType: proto.String(".catalog." + input), OutputType: proto.String(".catalog." + output)}
+	}
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("catalog.proto"),
+		Package: proto.String("catalog"),
+		Syntax:  proto.String("proto3"),
+		Options: &descriptorpb.FileOptions{GoPackage: proto.String("example.com/catalog")},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Product"), Field: []*descriptorpb.FieldDescriptorProto{field("name", 1, str, false, "")}},
+			{Name: proto.String("ListRequest"), Field: []*descriptorpb.FieldDescriptorProto{field("page_token", 1, str, false, "")}},
+			{Name: proto.String("ListReply"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("products", 1, msg, true, ".catalog.Product"), field("next_page_token", 2, str, false, "")}},
+			{Name: proto.String("NamesReply"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("names", 1, str, true, ""), field("next_page_token", 2, str, false, "")}},
+			{Name: proto.String("TaggedReply"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("names", 1, str, true, ""), field("tags", 2, str, true, ""), field("next_page_token", 3, str, false, "")}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Catalog"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method("List", "ListRequest", "ListReply"),
+				method("Names", "ListRequest", "NamesReply"),
+				method("Get", "Product", "Product"),
+				method("Tagged", "ListRequest", "TaggedReply"),
+			},
+		}},
+	}
+}
+
+func TestGenerateListMethods(t *testing.T) {
+	plugin, err := protogen.Options{}.New(&pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{"catalog.proto"},
+		ProtoFile:      []*descriptorpb.FileDescriptorProto{catalogFile()},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	generateFile(plugin, plugin.Files[0])
+	resp := plugin.Response()
+	if resp.Error != nil || len(resp.File) != 1 {
+		t.Fatalf("Generation failed: %s", resp.GetError())
+	}
+	code := resp.File[0].GetContent()
+
+	for _, want := range []string{
+		"ListAll(ctx context.Context, req *ListRequest, opts ...rpc.CallOption) iter.Seq2[*Product, error]",
+		"NamesAll(ctx context.Context, req *ListRequest, opts ...rpc.CallOption) iter.Seq2[string, error]",
+		"Handler:    _Catalog_List_Handler(o.List.MaxPageBytes),",
+		"rpc.Paginate(pageToken, len(result.Products), maxPageBytes, func(i int) int { return proto.Size(result.Products[i]) })",
+		"rpc.Paginate(pageToken, len(result.Names), maxPageBytes, func(i int) int { return len(result.Names[i]) })",
+		"page.PageToken = resp.NextPageToken",
+		"Handler:    _Catalog_Get_Handler,",
+		"Handler:    _Catalog_Tagged_Handler,",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected the generated code to contain %q", want)
+		}
+	}
+	for _, unwanted := range []string{"GetAll(", "TaggedAll("} {
+		if strings.Contains(code, unwanted) {
+			t.Errorf("Expected no iterator %q for a method that is not a list method", unwanted)
+		}
+	}
+}
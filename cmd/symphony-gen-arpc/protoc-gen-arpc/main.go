@@ -1,17 +1,29 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+
 	"google.golang.org/protobuf/compiler/protogen"
 )
 
 func main() {
-	opt := protogen.Options{}
-	opt.Run(func(plugin *protogen.Plugin) error {
-		for _, file := range plugin.Files {
-			if !file.Generate {
-				continue
+	var flags flag.FlagSet
+	lang := flags.String("lang", "go", "language of the generated stubs: go, or python for client bindings")
+
+	protogen.Options{ParamFunc: flags.Set}.Run(func(plugin *protogen.Plugin) error {
+		switch *lang {
+		case "go":
+			for _, file := range plugin.Files {
+				if !file.Generate {
+					continue
+				}
+				generateFile(plugin, file)
 			}
-			generateFile(plugin, file)
+		case "python":
+			generatePython(plugin)
+		default:
+			return fmt.Errorf("invalid lang %q: expected go or python", *lang)
 		}
 		return nil
 	})
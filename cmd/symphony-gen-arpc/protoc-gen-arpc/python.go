@@ -0,0 +1,274 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// pythonRuntime is the module the Python bindings import: the Symphony encoding of their
+// messages and the UDP client. It is written next to the bindings of each output directory.
+//
+//go:embed arpc_symphony.py
+var pythonRuntime []byte
+
+// pythonRuntimeModule is the name the bindings import pythonRuntime as
+const pythonRuntimeModule = "arpc_symphony"
+
+// pythonKinds maps the kinds of the fields Python can encode to the constants of pythonRuntime
+var pythonKinds = map[protoreflect.Kind]string{
+	protoreflect.BoolKind:    "BOOL",
+	protoreflect.Int32Kind:   "INT32",
+	protoreflect.EnumKind:    "INT32",
+	protoreflect.Int64Kind:   "INT64",
+	protoreflect.Uint32Kind:  "UINT32",
+	protoreflect.Uint64Kind:  "UINT64",
+	protoreflect.FloatKind:   "FLOAT",
+	protoreflect.DoubleKind:  "DOUBLE",
+	protoreflect.StringKind:  "STRING",
+	protoreflect.BytesKind:   "BYTES",
+	protoreflect.MessageKind: "MESSAGE",
+}
+
+// pythonKeywords are renamed with a trailing underscore when used as field names
+var pythonKeywords = []string{
+	"False", "None", "True", "and", "as", "assert", "async", "await", "break", "class",
+	"continue", "def", "del", "elif", "else", "except", "finally", "for", "from", "global",
+	"if", "import", "in", "is", "lambda", "nonlocal", "not", "or", "pass", "raise", "return",
+	"try", "while", "with", "yield",
+}
+
+// generatePython generates the _arpc.py client bindings of each file to generate, and the
+// runtime module in each of their directories
+func generatePython(plugin *protogen.Plugin) {
+	runtimes := make(map[string]bool)
+	for _, file := range plugin.Files {
+		if !file.Generate {
+			continue
+		}
+		dir := path.Dir(file.GeneratedFilenamePrefix)
+		if !runtimes[dir] {
+			runtimes[dir] = true
+			g := plugin.NewGeneratedFile(path.Join(dir, pythonRuntimeModule+".py"), "")
+			g.Write(pythonRuntime)
+		}
+		generatePythonFile(plugin, file)
+	}
+}
+
+// generatePythonFile generates the message classes and service clients of a proto file
+func generatePythonFile(plugin *protogen.Plugin, file *protogen.File) {
+	g := plugin.NewGeneratedFile(file.GeneratedFilenamePrefix+"_arpc.py", "")
+	g.P("# Code generated by protoc-gen-arpc. DO NOT EDIT.")
+	g.P("# source: ", file.Desc.Path())
+	g.P(`"""aRPC client bindings of `, file.Desc.Path(), `, encoded with Symphony"""`)
+	g.P()
+	if len(file.Enums) > 0 {
+		g.P("import enum")
+		g.P()
+	}
+	g.P("import ", pythonRuntimeModule, " as _arpc")
+	g.P()
+
+	for _, enum := range file.Enums {
+		g.P()
+		g.P("class ", enum.Desc.Name(), "(enum.IntEnum):")
+		for _, value := range enum.Values {
+			g.P("    ", value.Desc.Name(), " = ", value.Desc.Number())
+		}
+		g.P()
+	}
+
+	// Classes first, so that fields can refer to the classes declared after them
+	for _, msg := range file.Messages {
+		g.P()
+		g.P("class ", msg.Desc.Name(), "(_arpc.Message):")
+		if pythonUnsupportedReason(msg, map[*protogen.Message]bool{}) != "" {
+			g.P("    __slots__ = ()")
+		} else {
+			names := make([]string, len(msg.Fields))
+			for i, field := range msg.Fields {
+				names[i] = strconv.Quote(pythonFieldName(field))
+			}
+			g.P("    __slots__ = (", strings.Join(names, ", "), trailingComma(len(names)), ")")
+		}
+		g.P()
+	}
+	g.P()
+	for _, msg := range file.Messages {
+		genPythonDescription(g, msg)
+	}
+
+	for i, service := range file.Services {
+		genPythonService(g, service, uint32(i+1))
+	}
+}
+
+// genPythonDescription generates the description of the fields of a message, or of why it
+// cannot be encoded
+func genPythonDescription(g *protogen.GeneratedFile, msg *protogen.Message) {
+	name := string(msg.Desc.Name())
+	if reason := pythonUnsupportedReason(msg, map[*protogen.Message]bool{}); reason != "" {
+		g.P("_arpc.describe(", name, ", ", strconv.Quote(name), ", unsupported=", strconv.Quote(reason), ")")
+		return
+	}
+	if len(msg.Fields) == 0 {
+		g.P("_arpc.describe(", name, ", ", strconv.Quote(name), ")")
+		return
+	}
+	g.P("_arpc.describe(")
+	g.P("    ", name, ", ", strconv.Quote(name), ",")
+	for _, field := range msg.Fields {
+		args := []string{
+			strconv.Quote(pythonFieldName(field)),
+			strconv.Itoa(int(field.Desc.Number())),
+			"_arpc." + pythonKinds[field.Desc.Kind()],
+		}
+		if isPublicField(field) {
+			args = append(args, "public=True")
+		}
+		if field.Desc.IsList() {
+			args = append(args, "repeated=True")
+		}
+		if field.Message != nil {
+			args = append(args, "message="+string(field.Message.Desc.Name()))
+		}
+		g.P("    _arpc.Field(", strings.Join(args, ", "), "),")
+	}
+	g.P(")")
+}
+
+// genPythonService generates the client of a service, with the IDs of the Go stubs
+func genPythonService(g *protogen.GeneratedFile, service *protogen.Service, serviceID uint32) {
+	svcName := service.GoName
+	g.P()
+	g.P()
+	g.P("class ", svcName, "Client:")
+	g.P(`    """Client of the `, svcName, ` service. Methods take the request and an optional timeout`)
+	g.P(`    in seconds, and return the response or raise _arpc.RPCError or TimeoutError."""`)
+	g.P()
+	g.P("    SERVICE_NAME = ", strconv.Quote(svcName))
+	g.P("    SERVICE_ID = ", serviceID)
+	g.P()
+	g.P("    def __init__(self, client):")
+	g.P("        self._client = client")
+	for i, m := range service.Methods {
+		g.P()
+		reason := pythonMethodUnsupportedReason(service, m)
+		if reason != "" {
+			g.P("    def ", m.GoName, "(self, req, timeout=None):")
+			g.P("        raise NotImplementedError(", strconv.Quote(fmt.Sprintf("%s.%s: %s", svcName, m.GoName, reason)), ")")
+			continue
+		}
+		g.P("    def ", m.GoName, "(self, req, timeout=None):")
+		g.P("        return self._client.call(", serviceID, ", ", i+1, ", req, ", pythonMessageType(m.Output), ", timeout)")
+	}
+}
+
+// pythonMessageType returns the Python type of a request or response: bytes for raw
+// methods, or the class of the message
+func pythonMessageType(m *protogen.Message) string {
+	if isRaw(m) {
+		return "bytes"
+	}
+	return string(m.Desc.Name())
+}
+
+// pythonMethodUnsupportedReason returns why a method has no Python client, or "" if it has one
+func pythonMethodUnsupportedReason(service *protogen.Service, m *protogen.Method) string {
+	for _, msg := range []*protogen.Message{m.Input, m.Output} {
+		if isRaw(msg) {
+			continue
+		}
+		if msg.Desc.Parent() != service.Desc.ParentFile() {
+			return fmt.Sprintf("%s is not a message of %s", msg.Desc.FullName(), service.Desc.ParentFile().Path())
+		}
+		if reason := pythonUnsupportedReason(msg, map[*protogen.Message]bool{}); reason != "" {
+			return fmt.Sprintf("%s: %s", msg.Desc.Name(), reason)
+		}
+	}
+	return ""
+}
+
+// pythonUnsupportedReason returns why the Python runtime cannot encode msg, or "" if it
+// can. Besides the messages protoc-gen-symphony cannot encode, the runtime leaves out
+// well-known types and delta encoded and interned fields.
+func pythonUnsupportedReason(msg *protogen.Message, visiting map[*protogen.Message]bool) string {
+	if visiting[msg] {
+		return "" // recursive message, the other fields decide
+	}
+	visiting[msg] = true
+	defer delete(visiting, msg)
+
+	for _, field := range msg.Fields {
+		switch {
+		case field.Desc.IsMap():
+			return fmt.Sprintf("field %s is a map", field.Desc.Name())
+		case field.Oneof != nil:
+			return fmt.Sprintf("field %s is part of a oneof", field.Desc.Name())
+		case pythonKinds[field.Desc.Kind()] == "":
+			return fmt.Sprintf("field %s has unsupported type %s", field.Desc.Name(), field.Desc.Kind())
+		case hasFieldOption(field, isDeltaEncodedOption):
+			return fmt.Sprintf("field %s is delta encoded", field.Desc.Name())
+		case hasFieldOption(field, isInternedOption):
+			return fmt.Sprintf("field %s is interned", field.Desc.Name())
+		}
+		if field.Message == nil {
+			continue
+		}
+		// Only top-level messages of the same file have a Symphony encoding (or a well-known one)
+		if field.Message.Desc.Parent() != msg.Desc.ParentFile() {
+			return fmt.Sprintf("field %s has type %s", field.Desc.Name(), field.Message.Desc.FullName())
+		}
+		if reason := pythonUnsupportedReason(field.Message, visiting); reason != "" {
+			return fmt.Sprintf("field %s: %s", field.Desc.Name(), reason)
+		}
+	}
+	return ""
+}
+
+// Numbers of the field options of protoc-gen-symphony
+const (
+	isPublicOption       = 50001
+	isDeltaEncodedOption = 50003
+	isInternedOption     = 50004
+)
+
+// isPublicField reports whether a field is in the public segment of its message
+func isPublicField(field *protogen.Field) bool {
+	return hasFieldOption(field, isPublicOption)
+}
+
+// hasFieldOption reports whether the boolean extension number of the options of a field is
+// true. Like protoc-gen-symphony, it reads the unknown fields of the options, so that the
+// .proto files declaring the extensions need not be linked in.
+func hasFieldOption(field *protogen.Field, number int) bool {
+	if field.Desc.Options() == nil {
+		return false
+	}
+	return strings.Contains(fmt.Sprintf("%v", field.Desc.Options()), fmt.Sprintf("%d:1", number))
+}
+
+// pythonFieldName returns the attribute name of a field: its proto name, with a trailing
+// underscore if it is a Python keyword
+func pythonFieldName(field *protogen.Field) string {
+	name := string(field.Desc.Name())
+	if slices.Contains(pythonKeywords, name) {
+		return name + "_"
+	}
+	return name
+}
+
+// trailingComma returns the comma a tuple of n elements needs after its last one
+func trailingComma(n int) string {
+	if n == 1 {
+		return ","
+	}
+	return ""
+}
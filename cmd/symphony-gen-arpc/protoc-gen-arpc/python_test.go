@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	Test "github.com/appnet-org/arpc/cmd/symphony-gen-arpc/test"
+	"github.com/appnet-org/arpc/pkg/metadata"
+	"github.com/appnet-org/arpc/pkg/rpc"
+	"github.com/appnet-org/arpc/pkg/rpc/element"
+	"github.com/appnet-org/arpc/pkg/serializer"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// mirrorService is the service the Python tests call, added to test.proto which declares none
+var mirrorService = &descriptorpb.ServiceDescriptorProto{
+	Name: proto.String("Mirror"),
+	Method: []*descriptorpb.MethodDescriptorProto{
+		{Name: proto.String("Reflect"), InputType: proto.String(".Test.ComplexMixed"), OutputType: proto.String(".Test.ComplexMixed")},
+		{Name: proto.String("Reject"), InputType: proto.String(".Test.Empty"), OutputType: proto.String(".Test.Empty")},
+		{Name: proto.String("Blob"), InputType: proto.String(".google.protobuf.BytesValue"), OutputType: proto.String(".google.protobuf.BytesValue")},
+		{Name: proto.String("Label"), InputType: proto.String(".Test.Labels"), OutputType: proto.String(".Test.Empty")},
+	},
+}
+
+// generatePythonBindings writes the Python bindings of test.proto, with mirrorService, to a
+// temporary directory and returns it
+func generatePythonBindings(t *testing.T) string {
+	t.Helper()
+	fd := protodesc.ToFileDescriptorProto(Test.File_test_proto)
+	fd.Service = append(fd.Service, mirrorService)
+	var files []*descriptorpb.FileDescriptorProto
+	for _, dep := range []protoreflect.FileDescriptor{
+		descriptorpb.File_google_protobuf_descriptor_proto,
+		anypb.File_google_protobuf_any_proto,
+		durationpb.File_google_protobuf_duration_proto,
+		structpb.File_google_protobuf_struct_proto,
+		timestamppb.File_google_protobuf_timestamp_proto,
+		wrapperspb.File_google_protobuf_wrappers_proto,
+	} {
+		files = append(files, protodesc.ToFileDescriptorProto(dep))
+	}
+	in, err := proto.Marshal(&pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{fd.GetName()},
+		Parameter:      proto.String("paths=source_relative"),
+		ProtoFile:      append(files, fd),
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+
+	// Decode the request the way protoc-gen-arpc sees it, without the Test extensions linked
+	// in, so that the is_public options stay unknown fields
+	req := &pluginpb.CodeGeneratorRequest{}
+	if err := (proto.UnmarshalOptions{Resolver: new(protoregistry.Types)}).Unmarshal(in, req); err != nil {
+		t.Fatalf("Failed to unmarshal request: %v", err)
+	}
+	plugin, err := protogen.Options{}.New(req)
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	generatePython(plugin)
+	resp := plugin.Response()
+	if resp.Error != nil {
+		t.Fatalf("Generation failed: %s", resp.GetError())
+	}
+
+	dir := t.TempDir()
+	for _, file := range resp.File {
+		if err := os.WriteFile(filepath.Join(dir, file.GetName()), []byte(file.GetContent()), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", file.GetName(), err)
+		}
+	}
+	return dir
+}
+
+// runPython runs a script of testdata with args, skipping the test without python3
+func runPython(t *testing.T, script string, args ...string) {
+	t.Helper()
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 not found")
+	}
+	out, err := exec.Command(python, append([]string{filepath.Join("testdata", script)}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s failed: %v\n%s", script, err, out)
+	}
+}
+
+// The Python runtime decodes the conformance vectors of the Go messages, and encodes them
+// back byte for byte
+func TestPythonConformance(t *testing.T) {
+	runPython(t, "conformance.py", generatePythonBindings(t), "../test/testdata/conformance.json")
+}
+
+// mirrorHandler returns the handler of a Mirror method, decoding its request with newRequest
+func mirrorHandler(newRequest func() any, fn func(ctx context.Context, req any) (any, error)) rpc.MethodHandler {
+	return func(srv any, ctx context.Context, dec func(any) error, req *element.RPCRequest, chain *element.RPCElementChain) (*element.RPCResponse, context.Context, error) {
+		req.Payload = newRequest()
+		if err := dec(req.Payload); err != nil {
+			return nil, ctx, err
+		}
+		req, ctx, err := chain.ProcessRequest(ctx, req)
+		if err != nil {
+			return nil, ctx, err
+		}
+		result, err := fn(ctx, req.Payload)
+		if err != nil {
+			return nil, ctx, err
+		}
+		return chain.ProcessResponse(ctx, &element.RPCResponse{ID: req.ID, Result: result})
+	}
+}
+
+func TestPythonClient(t *testing.T) {
+	server, err := rpc.NewServer("127.0.0.1:0", &serializer.SymphonySerializer{}, nil)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	server.RegisterService(&rpc.ServiceDesc{
+		ServiceName: "Mirror",
+		ServiceID:   1, // the first service of the file
+		MethodsByID: map[uint32]*rpc.MethodDesc{
+			1: {MethodName: "Reflect", MethodID: 1, Handler: mirrorHandler(
+				func() any { return new(Test.ComplexMixed) },
+				func(ctx context.Context, req any) (any, error) {
+					// Echo the request, with the user agent of the client in its public string
+					msg := req.(*Test.ComplexMixed)
+					msg.VString += "/" + metadata.FromIncomingContext(ctx).Get(rpc.UserAgentKey)
+					return msg, nil
+				})},
+			2: {MethodName: "Reject", MethodID: 2, Handler: mirrorHandler(
+				func() any { return new(Test.Empty) },
+				func(ctx context.Context, req any) (any, error) {
+					return nil, errors.New("rejected by mirror")
+				})},
+			3: {MethodName: "Blob", MethodID: 3, Handler: mirrorHandler(
+				func() any { return new(serializer.RawMessage) },
+				func(ctx context.Context, req any) (any, error) {
+					body := []byte(*req.(*serializer.RawMessage))
+					return serializer.RawMessage(strings.ToUpper(string(body))), nil
+				})},
+		},
+	}, nil)
+	go server.Start()
+	t.Cleanup(func() { server.GetTransport().Close() })
+
+	runPython(t, "client.py", generatePythonBindings(t), server.GetTransport().LocalAddr().String())
+}
@@ -0,0 +1,53 @@
+"""Calls the Mirror service of TestPythonClient with the generated MirrorClient.
+
+Usage: client.py <bindings dir> <server address>
+"""
+
+import sys
+
+sys.path.insert(0, sys.argv[1])
+
+import arpc_symphony  # noqa: E402
+import test_arpc  # noqa: E402
+
+
+def check(condition, message):
+    if not condition:
+        sys.exit(message)
+
+
+def main():
+    with arpc_symphony.Client(sys.argv[2], timeout=5.0, user_agent="python-test") as client:
+        mirror = test_arpc.MirrorClient(client)
+
+        # A small message, and one fragmented in both segments
+        for size in (1, 3000):
+            req = test_arpc.ComplexMixed(
+                f_int32=-3, v_string="p" * size, r_int64=[1, -(1 << 40)],
+                nested_leaf=test_arpc.Leaf(leaf_id=7, leaf_val="leaf"),
+                r_string=["x" * size, "y"], f_bool=True,
+                repeated_nested=[test_arpc.Root(root_id=9, l1=test_arpc.Level1(l1_data="d"))],
+                v_bytes=b"\x00\xff" * size)
+            resp = mirror.Reflect(req)
+            want = test_arpc.ComplexMixed(**{f.name: getattr(req, f.name) for f in req._fields})
+            want.v_string += "/python-test"
+            check(resp == want, "Reflect of size %d returned %r" % (size, resp))
+
+        try:
+            mirror.Reject(test_arpc.Empty())
+            sys.exit("Reject succeeded")
+        except arpc_symphony.RPCError as e:
+            check("rejected by mirror" in e.message, "Reject failed with %r" % e.message)
+
+        body = b"blob " * 1000
+        check(mirror.Blob(body) == body.upper(), "Blob returned the wrong bytes")
+
+        try:
+            mirror.Label(None)
+            sys.exit("Label succeeded")
+        except NotImplementedError:
+            pass
+
+
+if __name__ == "__main__":
+    main()
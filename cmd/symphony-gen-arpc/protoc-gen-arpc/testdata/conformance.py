@@ -0,0 +1,81 @@
+"""Checks that the Python bindings of test.proto decode the Symphony conformance vectors of
+the Go messages and encode them back byte for byte.
+
+Usage: conformance.py <bindings dir> <conformance.json>
+"""
+
+import base64
+import json
+import sys
+
+sys.path.insert(0, sys.argv[1])
+
+import arpc_symphony  # noqa: E402
+import test_arpc  # noqa: E402
+
+
+def from_json(cls, value):
+    """Builds a message of cls from its protobuf JSON form"""
+    kwargs = {}
+    for field in cls._fields:
+        if field.name not in value:
+            continue
+        convert = lambda v, f=field: convert_value(f, v)
+        if field.repeated:
+            kwargs[field.name] = [convert(v) for v in value[field.name]]
+        else:
+            kwargs[field.name] = convert(value[field.name])
+    return cls(**kwargs)
+
+
+def convert_value(field, value):
+    if field.kind == arpc_symphony.MESSAGE:
+        return from_json(field.message, value)
+    if field.kind == arpc_symphony.BYTES:
+        return base64.b64decode(value)
+    if field.kind in (arpc_symphony.INT64, arpc_symphony.UINT64):
+        return int(value)
+    if field.kind in (arpc_symphony.FLOAT, arpc_symphony.DOUBLE):
+        return float(value)
+    return value
+
+
+def main():
+    with open(sys.argv[2]) as f:
+        vectors = json.load(f)
+    failures = 0
+    for i, vector in enumerate(vectors):
+        cls = getattr(test_arpc, vector["message"])
+        want = from_json(cls, vector["json"])
+        data = bytes.fromhex(vector["symphony"])
+        got = cls.decode(data)
+        if got != want:
+            print("vector %d: decoded %r, expected %r" % (i, got, want))
+            failures += 1
+        encoded = want.encode()
+        if encoded != data:
+            print("vector %d: encoded %s, expected %s" % (i, encoded.hex(), data.hex()))
+            failures += 1
+
+    # Truncated data is rejected
+    truncated = bytes.fromhex(vectors[-1]["symphony"])[:-3]
+    try:
+        getattr(test_arpc, vectors[-1]["message"]).decode(truncated)
+        print("decoding truncated data succeeded")
+        failures += 1
+    except ValueError:
+        pass
+
+    # Messages without a Python encoding refuse to be built
+    for name in ("Labels", "WellKnown", "Deltas", "Catalog"):
+        try:
+            getattr(test_arpc, name)()
+            print("%s: expected NotImplementedError" % name)
+            failures += 1
+        except NotImplementedError:
+            pass
+    sys.exit(1 if failures else 0)
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,14 @@
+module github.com/appnet-org/arpc/cmd/symphony-gen-arpc/protoc-gen-symphony-hybrid/test
+
+go 1.24.0
+
+require (
+	capnproto.org/go/capnp/v3 v3.1.0-alpha.1
+	github.com/google/flatbuffers v25.12.19+incompatible
+	google.golang.org/protobuf v1.36.10
+)
+
+require (
+	github.com/colega/zeropool v0.0.0-20230505084239-6fb4a4f75381 // indirect
+	golang.org/x/sync v0.17.0 // indirect
+)
@@ -1,24 +1,90 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"strings"
 
+	"github.com/appnet-org/arpc/pkg/schema"
 	"google.golang.org/protobuf/compiler/protogen"
 	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 var (
-	math = protogen.GoImportPath("math")
+	math          = protogen.GoImportPath("math")
+	stringsPkg    = protogen.GoImportPath("strings")
+	serializerPkg = protogen.GoImportPath("github.com/appnet-org/arpc/pkg/serializer")
+	schemaPkg     = protogen.GoImportPath("github.com/appnet-org/arpc/pkg/schema")
+	symphonytest  = protogen.GoImportPath("github.com/appnet-org/arpc/pkg/symphonytest")
+	testingPkg    = protogen.GoImportPath("testing")
 )
 
+// arenaAlloc is set by the arena plugin parameter: generated messages then get an
+// UnmarshalSymphonyArena method that allocates nested messages from a serializer.Arena
+var arenaAlloc bool
+
+// checksums is set by the checksum plugin parameter: messages then end with a
+// serializer.ChecksumSize trailer holding a CRC-32C of their private segment, checked by
+// UnmarshalSymphony
+var checksums bool
+
+// trailerSize is the size of what follows the private segment of a message
+func trailerSize() int {
+	if checksums {
+		return 4 // serializer.ChecksumSize
+	}
+	return 0
+}
+
 func main() {
-	protogen.Options{}.Run(func(plugin *protogen.Plugin) error {
+	var flags flag.FlagSet
+	symlock := flags.String("symlock", symlockVerify, "lock file mode: verify, update or off")
+	symlockDir := flags.String("symlock_dir", ".", "directory holding existing lock files, usually the output directory")
+	flags.BoolVar(&arenaAlloc, "arena", false, "generate UnmarshalSymphonyArena methods")
+	flags.BoolVar(&checksums, "checksum", false, "append a checksum of the private segment to messages")
+	bench := flags.Bool("bench", false, "generate a _symphony_bench_test.go file with benchmarks per message")
+	lang := flags.String("lang", "go", "language of the generated code: go, rust for the messages only, or typescript for decoders of the public segment")
+
+	protogen.Options{ParamFunc: flags.Set}.Run(func(plugin *protogen.Plugin) error {
+		switch *symlock {
+		case symlockVerify, symlockUpdate, symlockOff:
+		default:
+			return fmt.Errorf("invalid symlock mode %q: expected verify, update or off", *symlock)
+		}
+		switch *lang {
+		case "go":
+		case "rust":
+			if checksums {
+				return fmt.Errorf("the checksum parameter is not supported with lang=rust")
+			}
+		case "typescript":
+		default:
+			return fmt.Errorf("invalid lang %q: expected go, rust or typescript", *lang)
+		}
 		for _, file := range plugin.Files {
 			if !file.Generate {
 				continue
 			}
-			generateFile(plugin, file)
+			if err := checkDeltaEncodedFields(file.Messages); err != nil {
+				return fmt.Errorf("%s: %w", file.Desc.Path(), err)
+			}
+			if err := checkInternedFields(file.Messages); err != nil {
+				return fmt.Errorf("%s: %w", file.Desc.Path(), err)
+			}
+			switch *lang {
+			case "rust":
+				generateRustFile(plugin, file)
+			case "typescript":
+				generateTypeScriptFile(plugin, file)
+			default:
+				generateFile(plugin, file)
+				if *bench {
+					generateBenchFile(plugin, file)
+				}
+			}
+			if err := generateLockFile(plugin, file, *symlock, *symlockDir); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
@@ -36,9 +102,87 @@ func generateFile(plugin *protogen.Plugin, file *protogen.File) {
 	for _, message := range file.Messages {
 		generateMessage(g, message)
 	}
+
+	generateSchema(g, file)
+}
+
+// generateBenchFile generates Marshal and Unmarshal benchmarks of the Symphony messages of
+// the file, seeded with their symphonytest.Example messages
+func generateBenchFile(plugin *protogen.Plugin, file *protogen.File) {
+	var msgs []*protogen.Message
+	for _, message := range file.Messages {
+		if unsupportedReason(message, map[*protogen.Message]bool{}) == "" {
+			msgs = append(msgs, message)
+		}
+	}
+	if len(msgs) == 0 {
+		return
+	}
+
+	g := plugin.NewGeneratedFile(file.GeneratedFilenamePrefix+"_symphony_bench_test.go", file.GoImportPath)
+	g.P("// Code generated by protoc-gen-symphony. DO NOT EDIT.")
+	g.P("package ", file.GoPackageName)
+	g.P()
+	for _, message := range msgs {
+		g.P("// BenchmarkSymphony", message.GoIdent.GoName, " encodes and decodes the example ", message.Desc.FullName(), " (see symphonytest.Example)")
+		g.P("func BenchmarkSymphony", message.GoIdent.GoName, "(b *", testingPkg.Ident("B"), ") {")
+		g.P("    ", symphonytest.Ident("Benchmark"), "[", message.GoIdent, "](b)")
+		g.P("}")
+		g.P()
+	}
+}
+
+// generateSchema embeds the compact schema of the Symphony messages of the file and registers
+// it with schema.Global, so that payloads can be decoded at runtime without .proto files
+func generateSchema(g *protogen.GeneratedFile, file *protogen.File) {
+	var msgs []*schema.Message
+	for _, message := range file.Messages {
+		if unsupportedReason(message, map[*protogen.Message]bool{}) != "" {
+			continue
+		}
+		m, err := schema.FromDescriptor(message.Desc)
+		if err != nil {
+			continue
+		}
+		msgs = append(msgs, m)
+	}
+	if len(msgs) == 0 {
+		return
+	}
+
+	name := file.GoDescriptorIdent.GoName
+	varName := strings.ToLower(name[:1]) + name[1:] + "_symphonySchema"
+	blob := schema.Encode(msgs)
+
+	g.P("// ", varName, " is the compact schema of the Symphony messages in this file (see pkg/schema)")
+	g.P("var ", varName, " = []byte{")
+	for len(blob) > 0 {
+		n := min(16, len(blob))
+		line := make([]string, n)
+		for i, b := range blob[:n] {
+			line[i] = fmt.Sprintf("0x%02x,", b)
+		}
+		g.P("    ", strings.Join(line, " "))
+		blob = blob[n:]
+	}
+	g.P("}")
+	g.P()
+	g.P("func init() {")
+	g.P("    if err := ", schemaPkg.Ident("Global"), ".RegisterEncoded(", varName, "); err != nil {")
+	g.P("        panic(err)")
+	g.P("    }")
+	g.P("}")
+	g.P()
 }
 
 func generateMessage(g *protogen.GeneratedFile, msg *protogen.Message) {
+	// Messages with fields Symphony cannot encode yet get stubs that always fail,
+	// so serializers with a protobuf fallback use protobuf for them
+	if reason := unsupportedReason(msg, map[*protogen.Message]bool{}); reason != "" {
+		generateUnsupportedMessage(g, msg, reason)
+		return
+	}
+
 	// 1. Standard Struct Implementation
 	generateStructType(g, msg)
 
@@ -46,6 +190,70 @@ func generateMessage(g *protogen.GeneratedFile, msg *protogen.Message) {
 	generateRawType(g, msg)
 }
 
+// generateUnsupportedMessage generates MarshalSymphony/UnmarshalSymphony stubs that return an
+// error. No Raw type is generated since its accessors would not be meaningful.
+func generateUnsupportedMessage(g *protogen.GeneratedFile, msg *protogen.Message, reason string) {
+	errMsg := fmt.Sprintf("symphony: %s is not supported: %s", msg.GoIdent.GoName, reason)
+
+	g.P("// MarshalSymphony always fails because ", reason, ".")
+	g.P("// Use serializer.SymphonyFallbackSerializer to encode ", msg.GoIdent.GoName, " with protobuf instead.")
+	g.P("func (m *", msg.GoIdent, ") MarshalSymphony() ([]byte, error) {")
+	g.P("    return nil, fmt.Errorf(", fmt.Sprintf("%q", errMsg), ")")
+	g.P("}")
+	g.P()
+	g.P("// UnmarshalSymphony always fails because ", reason, ".")
+	g.P("func (m *", msg.GoIdent, ") UnmarshalSymphony(data []byte) error {")
+	g.P("    return fmt.Errorf(", fmt.Sprintf("%q", errMsg), ")")
+	g.P("}")
+	g.P()
+	if arenaAlloc {
+		g.P("// UnmarshalSymphonyArena always fails because ", reason, ".")
+		g.P("func (m *", msg.GoIdent, ") UnmarshalSymphonyArena(data []byte, arena *", serializerPkg.Ident("Arena"), ") error {")
+		g.P("    return fmt.Errorf(", fmt.Sprintf("%q", errMsg), ")")
+		g.P("}")
+		g.P()
+	}
+}
+
+// unsupportedReason returns why msg has no Symphony encoding, or "" if it has one.
+// A message is unsupported if any of its fields, or of its nested messages, is.
+func unsupportedReason(msg *protogen.Message, visiting map[*protogen.Message]bool) string {
+	if visiting[msg] {
+		return "" // recursive message, the other fields decide
+	}
+	visiting[msg] = true
+	defer delete(visiting, msg)
+
+	for _, field := range msg.Fields {
+		if field.Desc.IsMap() {
+			return fmt.Sprintf("field %s is a map", field.Desc.Name())
+		}
+		if field.Oneof != nil {
+			return fmt.Sprintf("field %s is part of a oneof", field.Desc.Name())
+		}
+		switch field.Desc.Kind() {
+		case protoreflect.BoolKind, protoreflect.Int32Kind, protoreflect.Int64Kind,
+			protoreflect.Uint32Kind, protoreflect.Uint64Kind, protoreflect.FloatKind,
+			protoreflect.DoubleKind, protoreflect.EnumKind, protoreflect.StringKind,
+			protoreflect.BytesKind:
+		case protoreflect.MessageKind:
+			if isWellKnownField(field) {
+				continue
+			}
+			// Only top-level messages of the same file have generated Symphony methods
+			if field.Message.Desc.Parent() != msg.Desc.ParentFile() {
+				return fmt.Sprintf("field %s has type %s which has no Symphony encoding", field.Desc.Name(), field.Message.Desc.FullName())
+			}
+			if reason := unsupportedReason(field.Message, visiting); reason != "" {
+				return fmt.Sprintf("field %s: %s", field.Desc.Name(), reason)
+			}
+		default:
+			return fmt.Sprintf("field %s has unsupported type %s", field.Desc.Name(), field.Desc.Kind())
+		}
+	}
+	return ""
+}
+
 // ==========================================
 // 1. Standard Struct Implementation
 // ==========================================
@@ -77,15 +285,12 @@ func generateSegmentMarshalFunction(g *protogen.GeneratedFile, msg *protogen.Mes
 
 	// Calculate size
 	g.P("    size := 0")
-	tableSize := 0
-	for _, field := range fields {
-		if isFixedLengthField(field) {
-			tableSize += getFieldSize(field)
-		} else {
-			tableSize += 4
-		}
-	}
+	tableSize := segmentTableSize(fields)
 	g.P(fmt.Sprintf("    size += %d // table", tableSize))
+	if hasInternedFields(fields) {
+		generateStringDictBuild(g, fields, "dict", "m")
+		g.P("    size += dict.EncodedSize() // string dictionary")
+	}
 
 	// Calculate payload size
 	for _, field := range fields {
@@ -95,6 +300,10 @@ func generateSegmentMarshalFunction(g *protogen.GeneratedFile, msg *protogen.Mes
 		} else if isRepeatedFixedLengthField(field) {
 			fieldSize := getFieldSize(field)
 			g.P(fmt.Sprintf("    size += 4 + %d*len(m.%s)", fieldSize, goName))
+		} else if isDeltaEncodedField(field) {
+			g.P(fmt.Sprintf("    size += 8 + %s(m.%s)", g.QualifiedGoIdent(serializerPkg.Ident("DeltaEncodedSize")), goName))
+		} else if isInternedField(field) && field.Desc.IsList() {
+			g.P(fmt.Sprintf("    size += 4 + 4*len(m.%s)", goName))
 		} else if isRepeatedVariableLengthField(field) {
 			g.P(fmt.Sprintf("    size += 4 // count for %s", goName))
 			g.P(fmt.Sprintf("    for _, item := range m.%s {", goName))
@@ -102,13 +311,13 @@ func generateSegmentMarshalFunction(g *protogen.GeneratedFile, msg *protogen.Mes
 			g.P("    }")
 		} else if isNestedMessageField(field) {
 			g.P(fmt.Sprintf("    if m.%s != nil {", goName))
-			g.P(fmt.Sprintf("        nested, _ := m.%s.MarshalSymphony()", goName))
+			g.P(fmt.Sprintf("        nested, _ := %s", nestedMarshalCall(g, field, "m."+goName)))
 			g.P("        size += 4 + len(nested)")
 			g.P("    }")
 		} else if isRepeatedNestedMessageField(field) {
 			g.P(fmt.Sprintf("    size += 4 // count for %s", goName))
 			g.P(fmt.Sprintf("    for _, item := range m.%s {", goName))
-			g.P("        nested, _ := item.MarshalSymphony()")
+			g.P(fmt.Sprintf("        nested, _ := %s", nestedMarshalCall(g, field, "item")))
 			g.P("        size += 4 + len(nested)")
 			g.P("    }")
 		}
@@ -172,6 +381,9 @@ func generateSegmentUnmarshalFunction(g *protogen.GeneratedFile, msg *protogen.M
 	g.P("    _ = currentOffset")
 	g.P("    tableStart := 0")
 	g.P("    _ = tableStart")
+	if arenaAlloc && hasArenaFields(fields) {
+		g.P("    var arena *", serializerPkg.Ident("Arena"), " // nested messages of a segment come from the heap")
+	}
 	g.P()
 
 	generateSegmentUnmarshal(g, fields, "tableStart", "data")
@@ -201,11 +413,16 @@ func generateStructMarshal(g *protogen.GeneratedFile, msg *protogen.Message) {
 	// Handle empty messages specially
 	if len(msg.Fields) == 0 {
 		g.P("    // Empty message - public segment with header only, empty private segment")
-		g.P("    buf := make([]byte, 14) // 1 version + 12 reserved + 1 version for private")
+		if checksums {
+			g.P(fmt.Sprintf("    buf := make([]byte, %d) // 1 version + 12 reserved + 1 version for private + checksum", 14+trailerSize()))
+		} else {
+			g.P("    buf := make([]byte, 14) // 1 version + 12 reserved + 1 version for private")
+		}
 		g.P("    buf[0] = 0x01 // public version")
 		g.P("    binary.LittleEndian.PutUint32(buf[1:5], 13) // offset_to_private")
 		g.P("    // service_name and method_name stay 0")
 		g.P("    buf[13] = 0x01 // private version")
+		generateChecksumWrite(g, "buf")
 		g.P("    return buf, nil")
 		g.P("}")
 		g.P()
@@ -247,6 +464,10 @@ func generateStructMarshal(g *protogen.GeneratedFile, msg *protogen.Message) {
 			g.P("    publicSegmentSize += 4 // offset placeholder")
 		}
 	}
+	if hasInternedFields(publicFields) {
+		g.P("    publicSegmentSize += 4 // string dictionary offset")
+		g.P("    publicSegmentSize += publicDict.EncodedSize() // string dictionary")
+	}
 
 	// Add public payload sizes
 	for _, field := range publicFields {
@@ -258,6 +479,10 @@ func generateStructMarshal(g *protogen.GeneratedFile, msg *protogen.Message) {
 		} else if isRepeatedFixedLengthField(field) {
 			fieldSize := getFieldSize(field)
 			g.P(fmt.Sprintf("    publicSegmentSize += 4 + %d*len(m.%s) // field %d payload", fieldSize, goName, fieldNum))
+		} else if isDeltaEncodedField(field) {
+			g.P(fmt.Sprintf("    publicSegmentSize += 8 + %s(m.%s) // field %d payload", g.QualifiedGoIdent(serializerPkg.Ident("DeltaEncodedSize")), goName, fieldNum))
+		} else if isInternedField(field) && field.Desc.IsList() {
+			g.P(fmt.Sprintf("    publicSegmentSize += 4 + 4*len(m.%s) // field %d payload", goName, fieldNum))
 		} else if isRepeatedVariableLengthField(field) {
 			g.P(fmt.Sprintf("    publicSegmentSize += 4 // field %d count", fieldNum))
 			g.P(fmt.Sprintf("    for _, item := range m.%s {", goName))
@@ -265,13 +490,13 @@ func generateStructMarshal(g *protogen.GeneratedFile, msg *protogen.Message) {
 			g.P("    }")
 		} else if isNestedMessageField(field) {
 			g.P(fmt.Sprintf("    if m.%s != nil {", goName))
-			g.P(fmt.Sprintf("        nestedData%d, _ := m.%s.MarshalSymphony()", fieldNum, goName))
+			g.P(fmt.Sprintf("        nestedData%d, _ := %s", fieldNum, nestedMarshalCall(g, field, "m."+goName)))
 			g.P(fmt.Sprintf("        publicSegmentSize += 4 + len(nestedData%d) // field %d payload", fieldNum, fieldNum))
 			g.P("    }")
 		} else if isRepeatedNestedMessageField(field) {
 			g.P(fmt.Sprintf("    publicSegmentSize += 4 // field %d count", fieldNum))
 			g.P(fmt.Sprintf("    for _, item := range m.%s {", goName))
-			g.P("        nestedData, _ := item.MarshalSymphony()")
+			g.P(fmt.Sprintf("        nestedData, _ := %s", nestedMarshalCall(g, field, "item")))
 			g.P("        publicSegmentSize += 4 + len(nestedData)")
 			g.P("    }")
 		}
@@ -303,14 +528,7 @@ func generateStructMarshal(g *protogen.GeneratedFile, msg *protogen.Message) {
 	g.P()
 
 	// Calculate private table size
-	privateTableSize := 0
-	for _, field := range privateFields {
-		if isFixedLengthField(field) {
-			privateTableSize += getFieldSize(field)
-		} else {
-			privateTableSize += 4
-		}
-	}
+	privateTableSize := segmentTableSize(privateFields)
 
 	g.P("    // Write private fields")
 	g.P(fmt.Sprintf("    privateTableStart := privateStart + 1 // %d bytes table", privateTableSize))
@@ -323,6 +541,7 @@ func generateStructMarshal(g *protogen.GeneratedFile, msg *protogen.Message) {
 	// Pass "privateStart" as the relative offset base for private segment
 	g.P("    // Private segment offsets are stored relative to privateStart")
 	generateSegmentMarshal(g, privateFields, "privateTableStart", "privatePayloadStart", "privatePayloadOffset", "privateStart")
+	generateChecksumWrite(g, "buf")
 
 	g.P("    return buf, nil")
 	g.P("}")
@@ -343,6 +562,9 @@ func generateSegmentMarshal(g *protogen.GeneratedFile, fields []*protogen.Field,
 	}
 
 	tableOffset := 0
+	if hasInternedFields(fields) {
+		tableOffset = 4 // the table starts with the offset of the string dictionary
+	}
 	for _, field := range fields {
 		if isFixedLengthField(field) {
 			fieldSize := getFieldSize(field)
@@ -354,6 +576,15 @@ func generateSegmentMarshal(g *protogen.GeneratedFile, fields []*protogen.Field,
 		} else if isRepeatedFixedLengthField(field) {
 			generateRepeatedFixedFieldMarshal(g, field, tableStartVar, tableOffset, payloadStartVar, payloadOffsetVar, relativeBase)
 			tableOffset += 4
+		} else if isDeltaEncodedField(field) {
+			generateDeltaEncodedFieldMarshal(g, field, tableStartVar, tableOffset, payloadStartVar, payloadOffsetVar, relativeBase)
+			tableOffset += 4
+		} else if isInternedField(field) && field.Desc.IsList() {
+			generateRepeatedInternedFieldMarshal(g, field, tableStartVar, tableOffset, payloadStartVar, payloadOffsetVar, dictVarName(tableStartVar), relativeBase)
+			tableOffset += 4
+		} else if isInternedField(field) {
+			generateInternedFieldMarshal(g, field, tableStartVar, tableOffset, dictVarName(tableStartVar))
+			tableOffset += 4
 		} else if isRepeatedVariableLengthField(field) {
 			generateRepeatedVariableFieldMarshal(g, field, tableStartVar, tableOffset, payloadStartVar, payloadOffsetVar, relativeBase)
 			tableOffset += 4
@@ -365,6 +596,31 @@ func generateSegmentMarshal(g *protogen.GeneratedFile, fields []*protogen.Field,
 			tableOffset += 4
 		}
 	}
+
+	if hasInternedFields(fields) {
+		generateStringDictMarshal(g, tableStartVar, payloadStartVar, payloadOffsetVar, dictVarName(tableStartVar), relativeBase)
+	}
+}
+
+// generateChecksumWrite generates code storing the checksum of the message in bufVar, whose
+// private segment is complete, if checksums are enabled
+func generateChecksumWrite(g *protogen.GeneratedFile, bufVar string) {
+	if !checksums {
+		return
+	}
+	g.P("    ", serializerPkg.Ident("PutChecksum"), "(", bufVar, ")")
+}
+
+// generateChecksumVerify generates code failing UnmarshalSymphony with a
+// *serializer.ChecksumError if the private segment of data does not match its checksum, if
+// checksums are enabled
+func generateChecksumVerify(g *protogen.GeneratedFile) {
+	if !checksums {
+		return
+	}
+	g.P("    if err := ", serializerPkg.Ident("VerifyChecksum"), "(data); err != nil {")
+	g.P("        return err")
+	g.P("    }")
 }
 
 // Helper function to generate remarshal logic for setters
@@ -387,21 +643,19 @@ func generateRemarshalLogic(g *protogen.GeneratedFile, msg *protogen.Message, go
 
 		// Calculate how many bytes the private table needs
 		_, privateFields := classifyFields(msg)
-		privateTableSize := 0
-		for _, field := range privateFields {
-			if isFixedLengthField(field) {
-				privateTableSize += getFieldSize(field)
-			} else {
-				privateTableSize += 4 // offset for variable/repeated/nested fields
-			}
-		}
+		privateTableSize := segmentTableSize(privateFields)
 
 		g.P(fmt.Sprintf("    privateTableSize := %d // bytes needed for empty private table", privateTableSize))
-		g.P("    fakeComplete := make([]byte, len(*m)+1+privateTableSize) // version byte + private table")
+		if checksums {
+			g.P(fmt.Sprintf("    fakeComplete := make([]byte, len(*m)+1+privateTableSize+%d) // version byte + private table + checksum", trailerSize()))
+		} else {
+			g.P("    fakeComplete := make([]byte, len(*m)+1+privateTableSize) // version byte + private table")
+		}
 		g.P("    copy(fakeComplete, *m)")
 		g.P("    // Update offsetToPrivate to point to the appended private segment")
 		g.P("    binary.LittleEndian.PutUint32(fakeComplete[1:5], uint32(len(*m)))")
 		g.P("    fakeComplete[len(*m)] = 0x01 // private segment version")
+		generateChecksumWrite(g, "fakeComplete")
 		g.P("    if err := temp.UnmarshalSymphony(fakeComplete); err != nil {")
 		g.P("        return fmt.Errorf(\"failed to unmarshal: %w\", err)")
 		g.P("    }")
@@ -497,6 +751,54 @@ func generateRepeatedFixedFieldMarshal(g *protogen.GeneratedFile, field *protoge
 
 	g.P(fmt.Sprintf("    // Field %d (%s): repeated fixed-length", fieldNum, goName))
 
+	// Calculate the offset to store: either absolute or relative
+	if len(relativeBase) > 0 && relativeBase[0] != "" {
+		g.P(fmt.Sprintf("    binary.LittleEndian.PutUint32(buf[%s+%d:], uint32((%s+%s)-%s))", tableStartVar, tableOffset, payloadStartVar, payloadOffsetVar, relativeBase[0]))
+	} else {
+		g.P(fmt.Sprintf("    binary.LittleEndian.PutUint32(buf[%s+%d:], uint32(%s+%s))", tableStartVar, tableOffset, payloadStartVar, payloadOffsetVar))
+	}
+	g.P(fmt.Sprintf("    count = len(m.%s)", goName))
+	g.P(fmt.Sprintf("    binary.LittleEndian.PutUint32(buf[%s+%s:], uint32(count))", payloadStartVar, payloadOffsetVar))
+	g.P(fmt.Sprintf("    %s(buf[%s+%s+4:], m.%s)", fixedSliceFunc(g, field, "Put"), payloadStartVar, payloadOffsetVar, goName))
+	g.P(fmt.Sprintf("    %s += 4 + %d*len(m.%s)", payloadOffsetVar, fieldSize, goName))
+	g.P()
+}
+
+func generateDeltaEncodedFieldMarshal(g *protogen.GeneratedFile, field *protogen.Field, tableStartVar string, tableOffset int, payloadStartVar, payloadOffsetVar string, relativeBase ...string) {
+	fieldNum := field.Desc.Number()
+	goName := field.GoName
+
+	g.P(fmt.Sprintf("    // Field %d (%s): repeated delta-encoded", fieldNum, goName))
+
+	// Calculate the offset to store: either absolute or relative
+	if len(relativeBase) > 0 && relativeBase[0] != "" {
+		g.P(fmt.Sprintf("    binary.LittleEndian.PutUint32(buf[%s+%d:], uint32((%s+%s)-%s))", tableStartVar, tableOffset, payloadStartVar, payloadOffsetVar, relativeBase[0]))
+	} else {
+		g.P(fmt.Sprintf("    binary.LittleEndian.PutUint32(buf[%s+%d:], uint32(%s+%s))", tableStartVar, tableOffset, payloadStartVar, payloadOffsetVar))
+	}
+	g.P(fmt.Sprintf("    count = len(m.%s)", goName))
+	g.P(fmt.Sprintf("    binary.LittleEndian.PutUint32(buf[%s+%s:], uint32(count))", payloadStartVar, payloadOffsetVar))
+	g.P(fmt.Sprintf("    dataLen = %s(buf[%s+%s+8:], m.%s)", g.QualifiedGoIdent(serializerPkg.Ident("PutDeltaEncoded")), payloadStartVar, payloadOffsetVar, goName))
+	g.P(fmt.Sprintf("    binary.LittleEndian.PutUint32(buf[%s+%s+4:], uint32(dataLen))", payloadStartVar, payloadOffsetVar))
+	g.P(fmt.Sprintf("    %s += 8 + dataLen", payloadOffsetVar))
+	g.P()
+}
+
+func generateInternedFieldMarshal(g *protogen.GeneratedFile, field *protogen.Field, tableStartVar string, tableOffset int, dictVar string) {
+	fieldNum := field.Desc.Number()
+	goName := field.GoName
+
+	g.P(fmt.Sprintf("    // Field %d (%s): interned string", fieldNum, goName))
+	g.P(fmt.Sprintf("    binary.LittleEndian.PutUint32(buf[%s+%d:], %s.Ref(m.%s))", tableStartVar, tableOffset, dictVar, goName))
+	g.P()
+}
+
+func generateRepeatedInternedFieldMarshal(g *protogen.GeneratedFile, field *protogen.Field, tableStartVar string, tableOffset int, payloadStartVar, payloadOffsetVar, dictVar string, relativeBase ...string) {
+	fieldNum := field.Desc.Number()
+	goName := field.GoName
+
+	g.P(fmt.Sprintf("    // Field %d (%s): repeated interned string", fieldNum, goName))
+
 	// Calculate the offset to store: either absolute or relative
 	if len(relativeBase) > 0 && relativeBase[0] != "" {
 		g.P(fmt.Sprintf("    binary.LittleEndian.PutUint32(buf[%s+%d:], uint32((%s+%s)-%s))", tableStartVar, tableOffset, payloadStartVar, payloadOffsetVar, relativeBase[0]))
@@ -506,34 +808,43 @@ func generateRepeatedFixedFieldMarshal(g *protogen.GeneratedFile, field *protoge
 	g.P(fmt.Sprintf("    count = len(m.%s)", goName))
 	g.P(fmt.Sprintf("    binary.LittleEndian.PutUint32(buf[%s+%s:], uint32(count))", payloadStartVar, payloadOffsetVar))
 	g.P(fmt.Sprintf("    for i, v := range m.%s {", goName))
+	g.P(fmt.Sprintf("        binary.LittleEndian.PutUint32(buf[%s+%s+4+4*i:], %s.Ref(v))", payloadStartVar, payloadOffsetVar, dictVar))
+	g.P("    }")
+	g.P(fmt.Sprintf("    %s += 4 + 4*len(m.%s)", payloadOffsetVar, goName))
+	g.P()
+}
 
-	switch field.Desc.Kind() {
-	case protoreflect.BoolKind:
-		g.P("        if v {")
-		g.P(fmt.Sprintf("            buf[%s+%s+4+%d*i] = 1", payloadStartVar, payloadOffsetVar, fieldSize))
-		g.P("        } else {")
-		g.P(fmt.Sprintf("            buf[%s+%s+4+%d*i] = 0", payloadStartVar, payloadOffsetVar, fieldSize))
-		g.P("        }")
-	case protoreflect.Int32Kind, protoreflect.EnumKind:
-		g.P(fmt.Sprintf("        binary.LittleEndian.PutUint32(buf[%s+%s+4+%d*i:], uint32(v))", payloadStartVar, payloadOffsetVar, fieldSize))
-	case protoreflect.Uint32Kind:
-		g.P(fmt.Sprintf("        binary.LittleEndian.PutUint32(buf[%s+%s+4+%d*i:], v)", payloadStartVar, payloadOffsetVar, fieldSize))
-	case protoreflect.Int64Kind:
-		g.P(fmt.Sprintf("        binary.LittleEndian.PutUint64(buf[%s+%s+4+%d*i:], uint64(v))", payloadStartVar, payloadOffsetVar, fieldSize))
-	case protoreflect.Uint64Kind:
-		g.P(fmt.Sprintf("        binary.LittleEndian.PutUint64(buf[%s+%s+4+%d*i:], v)", payloadStartVar, payloadOffsetVar, fieldSize))
-	case protoreflect.FloatKind:
-		mathQualified := g.QualifiedGoIdent(math.Ident("Float32bits"))
-		g.P(fmt.Sprintf("        binary.LittleEndian.PutUint32(buf[%s+%s+4+%d*i:], %s(v))", payloadStartVar, payloadOffsetVar, fieldSize, mathQualified))
-	case protoreflect.DoubleKind:
-		mathQualified := g.QualifiedGoIdent(math.Ident("Float64bits"))
-		g.P(fmt.Sprintf("        binary.LittleEndian.PutUint64(buf[%s+%s+4+%d*i:], %s(v))", payloadStartVar, payloadOffsetVar, fieldSize, mathQualified))
+// generateStringDictMarshal generates code that writes the string dictionary of a segment
+// after the field payloads and stores its offset in the first table slot
+func generateStringDictMarshal(g *protogen.GeneratedFile, tableStartVar, payloadStartVar, payloadOffsetVar, dictVar string, relativeBase ...string) {
+	g.P("    // String dictionary of the interned fields (offset stays 0 if empty)")
+	g.P(fmt.Sprintf("    if %s.Len() > 0 {", dictVar))
+	if len(relativeBase) > 0 && relativeBase[0] != "" {
+		g.P(fmt.Sprintf("        binary.LittleEndian.PutUint32(buf[%s:], uint32((%s+%s)-%s))", tableStartVar, payloadStartVar, payloadOffsetVar, relativeBase[0]))
+	} else {
+		g.P(fmt.Sprintf("        binary.LittleEndian.PutUint32(buf[%s:], uint32(%s+%s))", tableStartVar, payloadStartVar, payloadOffsetVar))
 	}
+	g.P(fmt.Sprintf("        %s += %s.Put(buf[%s+%s:])", payloadOffsetVar, dictVar, payloadStartVar, payloadOffsetVar))
 	g.P("    }")
-	g.P(fmt.Sprintf("    %s += 4 + %d*len(m.%s)", payloadOffsetVar, fieldSize, goName))
 	g.P()
 }
 
+// generateStringDictBuild generates code that collects the strings of the interned fields
+// of a segment into the dictionary dictVar
+func generateStringDictBuild(g *protogen.GeneratedFile, fields []*protogen.Field, dictVar, msgVar string) {
+	g.P(fmt.Sprintf("    var %s %s", dictVar, g.QualifiedGoIdent(serializerPkg.Ident("StringDict"))))
+	for _, field := range fields {
+		if !isInternedField(field) {
+			continue
+		}
+		if field.Desc.IsList() {
+			g.P(fmt.Sprintf("    %s.AddAll(%s.%s)", dictVar, msgVar, field.GoName))
+		} else {
+			g.P(fmt.Sprintf("    %s.Add(%s.%s)", dictVar, msgVar, field.GoName))
+		}
+	}
+}
+
 func generateRepeatedVariableFieldMarshal(g *protogen.GeneratedFile, field *protogen.Field, tableStartVar string, tableOffset int, payloadStartVar, payloadOffsetVar string, relativeBase ...string) {
 	fieldNum := field.Desc.Number()
 	goName := field.GoName
@@ -575,7 +886,7 @@ func generateNestedFieldMarshal(g *protogen.GeneratedFile, field *protogen.Field
 	} else {
 		g.P(fmt.Sprintf("        binary.LittleEndian.PutUint32(buf[%s+%d:], uint32(%s+%s))", tableStartVar, tableOffset, payloadStartVar, payloadOffsetVar))
 	}
-	g.P(fmt.Sprintf("        nestedData, err := m.%s.MarshalSymphony()", goName))
+	g.P(fmt.Sprintf("        nestedData, err := %s", nestedMarshalCall(g, field, "m."+goName)))
 	g.P("        if err != nil {")
 	g.P("            return nil, fmt.Errorf(\"failed to marshal nested message: %w\", err)")
 	g.P("        }")
@@ -606,7 +917,7 @@ func generateRepeatedNestedFieldMarshal(g *protogen.GeneratedFile, field *protog
 	g.P(fmt.Sprintf("    %s += 4", payloadOffsetVar))
 	g.P(fmt.Sprintf("    currentOffset = %s + %s", payloadStartVar, payloadOffsetVar))
 	g.P(fmt.Sprintf("    for _, item := range m.%s {", goName))
-	g.P("        nestedData, err := item.MarshalSymphony()")
+	g.P(fmt.Sprintf("        nestedData, err := %s", nestedMarshalCall(g, field, "item")))
 	g.P("        if err != nil {")
 	g.P("            return nil, fmt.Errorf(\"failed to marshal nested message: %w\", err)")
 	g.P("        }")
@@ -622,7 +933,20 @@ func generateRepeatedNestedFieldMarshal(g *protogen.GeneratedFile, field *protog
 func generateStructUnmarshal(g *protogen.GeneratedFile, msg *protogen.Message) {
 	publicFields, privateFields := classifyFields(msg)
 
-	g.P("func (m *", msg.GoIdent, ") UnmarshalSymphony(data []byte) error {")
+	if arenaAlloc {
+		g.P("func (m *", msg.GoIdent, ") UnmarshalSymphony(data []byte) error {")
+		g.P("    return m.UnmarshalSymphonyArena(data, nil)")
+		g.P("}")
+		g.P()
+		g.P("// ", arenaTypeVar(msg), " identifies ", msg.GoIdent.GoName, " in a serializer.Arena")
+		g.P("var ", arenaTypeVar(msg), " = ", serializerPkg.Ident("NewArenaType"), "()")
+		g.P()
+		g.P("// UnmarshalSymphonyArena is UnmarshalSymphony allocating the nested messages from arena,")
+		g.P("// which must not be released while they are in use. A nil arena allocates from the heap.")
+		g.P("func (m *", msg.GoIdent, ") UnmarshalSymphonyArena(data []byte, arena *", serializerPkg.Ident("Arena"), ") error {")
+	} else {
+		g.P("func (m *", msg.GoIdent, ") UnmarshalSymphony(data []byte) error {")
+	}
 
 	// Handle empty messages specially
 	if len(msg.Fields) == 0 {
@@ -637,6 +961,7 @@ func generateStructUnmarshal(g *protogen.GeneratedFile, msg *protogen.Message) {
 		g.P("    if offsetToPrivate >= len(data) || data[offsetToPrivate] != 0x01 {")
 		g.P("        return fmt.Errorf(\"missing private segment\")")
 		g.P("    }")
+		generateChecksumVerify(g)
 		g.P("    return nil")
 		g.P("}")
 		g.P()
@@ -662,6 +987,7 @@ func generateStructUnmarshal(g *protogen.GeneratedFile, msg *protogen.Message) {
 	g.P("    if offsetToPrivate >= len(data) || data[offsetToPrivate] != 0x01 {")
 	g.P("        return fmt.Errorf(\"missing private segment\")")
 	g.P("    }")
+	generateChecksumVerify(g)
 	g.P()
 
 	// Variables
@@ -706,7 +1032,12 @@ func generateSegmentUnmarshal(g *protogen.GeneratedFile, fields []*protogen.Fiel
 		relativeBase = offsetBaseVar[0]
 	}
 
+	// Interned fields are resolved against the string dictionary, decoded first
 	tableOffset := 0
+	if hasInternedFields(fields) {
+		generateStringDictUnmarshal(g, tableStartVar, dataVar, dictVarName(tableStartVar), relativeBase)
+		tableOffset = 4
+	}
 	for _, field := range fields {
 		if isFixedLengthField(field) {
 			fieldSize := getFieldSize(field)
@@ -718,6 +1049,15 @@ func generateSegmentUnmarshal(g *protogen.GeneratedFile, fields []*protogen.Fiel
 		} else if isRepeatedFixedLengthField(field) {
 			generateRepeatedFixedFieldUnmarshal(g, field, tableStartVar, tableOffset, dataVar, relativeBase)
 			tableOffset += 4
+		} else if isDeltaEncodedField(field) {
+			generateDeltaEncodedFieldUnmarshal(g, field, tableStartVar, tableOffset, dataVar, relativeBase)
+			tableOffset += 4
+		} else if isInternedField(field) && field.Desc.IsList() {
+			generateRepeatedInternedFieldUnmarshal(g, field, tableStartVar, tableOffset, dataVar, dictVarName(tableStartVar), relativeBase)
+			tableOffset += 4
+		} else if isInternedField(field) {
+			generateInternedFieldUnmarshal(g, field, tableStartVar, tableOffset, dataVar, dictVarName(tableStartVar))
+			tableOffset += 4
 		} else if isRepeatedVariableLengthField(field) {
 			generateRepeatedVariableFieldUnmarshal(g, field, tableStartVar, tableOffset, dataVar, relativeBase)
 			tableOffset += 4
@@ -781,10 +1121,9 @@ func generateVariableFieldUnmarshal(g *protogen.GeneratedFile, field *protogen.F
 	g.P("            dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))")
 	g.P("            if len(data) >= payloadOffset+4+dataLen {")
 	if field.Desc.Kind() == protoreflect.StringKind {
-		g.P(fmt.Sprintf("                m.%s = string(data[payloadOffset+4 : payloadOffset+4+dataLen])", goName))
+		g.P(fmt.Sprintf("                m.%s = %s(data[payloadOffset+4 : payloadOffset+4+dataLen])", goName, g.QualifiedGoIdent(serializerPkg.Ident("GetString"))))
 	} else {
-		g.P(fmt.Sprintf("                m.%s = make([]byte, dataLen)", goName))
-		g.P(fmt.Sprintf("                copy(m.%s, data[payloadOffset+4:payloadOffset+4+dataLen])", goName))
+		g.P(fmt.Sprintf("                m.%s = %s(data[payloadOffset+4 : payloadOffset+4+dataLen])", goName, g.QualifiedGoIdent(serializerPkg.Ident("GetBytes"))))
 	}
 	g.P("            }")
 	g.P("        }")
@@ -812,27 +1151,110 @@ func generateRepeatedFixedFieldUnmarshal(g *protogen.GeneratedFile, field *proto
 	g.P("            count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))")
 	g.P(fmt.Sprintf("            if len(data) >= payloadOffset+4+count*%d {", fieldSize))
 	g.P(fmt.Sprintf("                m.%s = make([]%s, count)", goName, getGoTypeBase(g, field)))
-	g.P("                for i := 0; i < count; i++ {")
+	g.P(fmt.Sprintf("                %s(m.%s, data[payloadOffset+4:])", fixedSliceFunc(g, field, "Get"), goName))
+	g.P("            }")
+	g.P("        }")
+	g.P("    }")
+	g.P()
+}
 
-	switch field.Desc.Kind() {
-	case protoreflect.BoolKind:
-		g.P(fmt.Sprintf("                    m.%s[i] = data[payloadOffset+4+%d*i] != 0", goName, fieldSize))
-	case protoreflect.Int32Kind, protoreflect.EnumKind:
-		g.P(fmt.Sprintf("                    m.%s[i] = int32(binary.LittleEndian.Uint32(data[payloadOffset+4+%d*i:]))", goName, fieldSize))
-	case protoreflect.Uint32Kind:
-		g.P(fmt.Sprintf("                    m.%s[i] = binary.LittleEndian.Uint32(data[payloadOffset+4+%d*i:])", goName, fieldSize))
-	case protoreflect.Int64Kind:
-		g.P(fmt.Sprintf("                    m.%s[i] = int64(binary.LittleEndian.Uint64(data[payloadOffset+4+%d*i:]))", goName, fieldSize))
-	case protoreflect.Uint64Kind:
-		g.P(fmt.Sprintf("                    m.%s[i] = binary.LittleEndian.Uint64(data[payloadOffset+4+%d*i:])", goName, fieldSize))
-	case protoreflect.FloatKind:
-		mathQualified := g.QualifiedGoIdent(math.Ident("Float32frombits"))
-		g.P(fmt.Sprintf("                    m.%s[i] = %s(binary.LittleEndian.Uint32(data[payloadOffset+4+%d*i:]))", goName, mathQualified, fieldSize))
-	case protoreflect.DoubleKind:
-		mathQualified := g.QualifiedGoIdent(math.Ident("Float64frombits"))
-		g.P(fmt.Sprintf("                    m.%s[i] = %s(binary.LittleEndian.Uint64(data[payloadOffset+4+%d*i:]))", goName, mathQualified, fieldSize))
+func generateDeltaEncodedFieldUnmarshal(g *protogen.GeneratedFile, field *protogen.Field, tableStartVar string, tableOffset int, dataVar string, relativeBase ...string) {
+	fieldNum := field.Desc.Number()
+	goName := field.GoName
+	decode := g.QualifiedGoIdent(serializerPkg.Ident("DecodeDeltaEncoded"))
+
+	g.P(fmt.Sprintf("    // Field %d (%s): repeated delta-encoded", fieldNum, goName))
+	g.P(fmt.Sprintf("    if len(%s) >= %s+%d+4 {", dataVar, tableStartVar, tableOffset))
+	g.P(fmt.Sprintf("        payloadOffset = int(binary.LittleEndian.Uint32(%s[%s+%d:]))", dataVar, tableStartVar, tableOffset))
+
+	// If reading from a segment with relative offsets, add the base
+	if len(relativeBase) > 0 && relativeBase[0] != "" {
+		g.P("        if payloadOffset > 0 {")
+		g.P(fmt.Sprintf("            payloadOffset += %s // convert relative offset to absolute", relativeBase[0]))
+		g.P("        }")
+	}
+
+	g.P("        if payloadOffset > 0 && len(data) >= payloadOffset+8 {")
+	g.P("            count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))")
+	g.P("            dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset+4:]))")
+	g.P("            if len(data) >= payloadOffset+8+dataLen {")
+	g.P(fmt.Sprintf("                values, err := %s[%s](data[payloadOffset+8:payloadOffset+8+dataLen], count)", decode, getGoTypeBase(g, field)))
+	g.P("                if err != nil {")
+	g.P(fmt.Sprintf("                    return fmt.Errorf(\"field %s: %%w\", err)", goName))
+	g.P("                }")
+	g.P(fmt.Sprintf("                m.%s = values", goName))
+	g.P("            }")
+	g.P("        }")
+	g.P("    }")
+	g.P()
+}
+
+// generateStringDictUnmarshal generates code that decodes the string dictionary of a segment
+// into dictVar, whose offset is stored in the first table slot
+func generateStringDictUnmarshal(g *protogen.GeneratedFile, tableStartVar, dataVar, dictVar string, relativeBase ...string) {
+	g.P("    // String dictionary of the interned fields")
+	g.P(fmt.Sprintf("    var %s []string", dictVar))
+	g.P(fmt.Sprintf("    if len(%s) >= %s+4 {", dataVar, tableStartVar))
+	g.P(fmt.Sprintf("        payloadOffset = int(binary.LittleEndian.Uint32(%s[%s:]))", dataVar, tableStartVar))
+
+	// If reading from a segment with relative offsets, add the base
+	if len(relativeBase) > 0 && relativeBase[0] != "" {
+		g.P("        if payloadOffset > 0 {")
+		g.P(fmt.Sprintf("            payloadOffset += %s // convert relative offset to absolute", relativeBase[0]))
+		g.P("        }")
+	}
+
+	g.P("        if payloadOffset > 0 && len(data) >= payloadOffset {")
+	g.P(fmt.Sprintf("            entries, err := %s(data[payloadOffset:])", g.QualifiedGoIdent(serializerPkg.Ident("DecodeStringDict"))))
+	g.P("            if err != nil {")
+	g.P("                return err")
+	g.P("            }")
+	g.P(fmt.Sprintf("            %s = entries", dictVar))
+	g.P("        }")
+	g.P("    }")
+	g.P()
+}
+
+func generateInternedFieldUnmarshal(g *protogen.GeneratedFile, field *protogen.Field, tableStartVar string, tableOffset int, dataVar, dictVar string) {
+	fieldNum := field.Desc.Number()
+	goName := field.GoName
+
+	g.P(fmt.Sprintf("    // Field %d (%s): interned string", fieldNum, goName))
+	g.P(fmt.Sprintf("    if len(%s) >= %s+%d+4 {", dataVar, tableStartVar, tableOffset))
+	g.P(fmt.Sprintf("        v, err := %s(%s, binary.LittleEndian.Uint32(%s[%s+%d:]))", g.QualifiedGoIdent(serializerPkg.Ident("DictString")), dictVar, dataVar, tableStartVar, tableOffset))
+	g.P("        if err != nil {")
+	g.P(fmt.Sprintf("            return fmt.Errorf(\"field %s: %%w\", err)", goName))
+	g.P("        }")
+	g.P(fmt.Sprintf("        m.%s = v", goName))
+	g.P("    }")
+	g.P()
+}
+
+func generateRepeatedInternedFieldUnmarshal(g *protogen.GeneratedFile, field *protogen.Field, tableStartVar string, tableOffset int, dataVar, dictVar string, relativeBase ...string) {
+	fieldNum := field.Desc.Number()
+	goName := field.GoName
+
+	g.P(fmt.Sprintf("    // Field %d (%s): repeated interned string", fieldNum, goName))
+	g.P(fmt.Sprintf("    if len(%s) >= %s+%d+4 {", dataVar, tableStartVar, tableOffset))
+	g.P(fmt.Sprintf("        payloadOffset = int(binary.LittleEndian.Uint32(%s[%s+%d:]))", dataVar, tableStartVar, tableOffset))
+
+	// If reading from a segment with relative offsets, add the base
+	if len(relativeBase) > 0 && relativeBase[0] != "" {
+		g.P("        if payloadOffset > 0 {")
+		g.P(fmt.Sprintf("            payloadOffset += %s // convert relative offset to absolute", relativeBase[0]))
+		g.P("        }")
 	}
 
+	g.P("        if payloadOffset > 0 && len(data) >= payloadOffset+4 {")
+	g.P("            count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))")
+	g.P("            if len(data) >= payloadOffset+4+4*count {")
+	g.P(fmt.Sprintf("                m.%s = make([]string, count)", goName))
+	g.P("                for i := 0; i < count; i++ {")
+	g.P(fmt.Sprintf("                    v, err := %s(%s, binary.LittleEndian.Uint32(data[payloadOffset+4+4*i:]))", g.QualifiedGoIdent(serializerPkg.Ident("DictString")), dictVar))
+	g.P("                    if err != nil {")
+	g.P(fmt.Sprintf("                        return fmt.Errorf(\"field %s: %%w\", err)", goName))
+	g.P("                    }")
+	g.P(fmt.Sprintf("                    m.%s[i] = v", goName))
 	g.P("                }")
 	g.P("            }")
 	g.P("        }")
@@ -864,11 +1286,9 @@ func generateRepeatedVariableFieldUnmarshal(g *protogen.GeneratedFile, field *pr
 	g.P("                    itemLen := int(binary.LittleEndian.Uint32(data[currentOffset:]))")
 	g.P("                    if len(data) >= currentOffset+4+itemLen {")
 	if field.Desc.Kind() == protoreflect.StringKind {
-		g.P(fmt.Sprintf("                        m.%s = append(m.%s, string(data[currentOffset+4:currentOffset+4+itemLen]))", goName, goName))
+		g.P(fmt.Sprintf("                        m.%s = append(m.%s, %s(data[currentOffset+4:currentOffset+4+itemLen]))", goName, goName, g.QualifiedGoIdent(serializerPkg.Ident("GetString"))))
 	} else {
-		g.P("                        itemData := make([]byte, itemLen)")
-		g.P("                        copy(itemData, data[currentOffset+4:currentOffset+4+itemLen])")
-		g.P(fmt.Sprintf("                        m.%s = append(m.%s, itemData)", goName, goName))
+		g.P(fmt.Sprintf("                        m.%s = append(m.%s, %s(data[currentOffset+4:currentOffset+4+itemLen]))", goName, goName, g.QualifiedGoIdent(serializerPkg.Ident("GetBytes"))))
 	}
 	g.P("                        currentOffset += 4 + itemLen")
 	g.P("                    }")
@@ -882,7 +1302,6 @@ func generateRepeatedVariableFieldUnmarshal(g *protogen.GeneratedFile, field *pr
 func generateNestedFieldUnmarshal(g *protogen.GeneratedFile, field *protogen.Field, tableStartVar string, tableOffset int, dataVar string, relativeBase ...string) {
 	fieldNum := field.Desc.Number()
 	goName := field.GoName
-	msgType := g.QualifiedGoIdent(field.Message.GoIdent)
 
 	g.P(fmt.Sprintf("    // Field %d (%s): nested message", fieldNum, goName))
 	g.P(fmt.Sprintf("    if len(%s) >= %s+%d+4 {", dataVar, tableStartVar, tableOffset))
@@ -898,8 +1317,8 @@ func generateNestedFieldUnmarshal(g *protogen.GeneratedFile, field *protogen.Fie
 	g.P("        if payloadOffset > 0 && len(data) >= payloadOffset+4 {")
 	g.P("            dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))")
 	g.P("            if len(data) >= payloadOffset+4+dataLen {")
-	g.P(fmt.Sprintf("                m.%s = &%s{}", goName, msgType))
-	g.P(fmt.Sprintf("                if err := m.%s.UnmarshalSymphony(data[payloadOffset+4 : payloadOffset+4+dataLen]); err != nil {", goName))
+	g.P(fmt.Sprintf("                m.%s = %s", goName, nestedAlloc(g, field)))
+	g.P(fmt.Sprintf("                if err := %s; err != nil {", nestedUnmarshalCall(g, field, "m."+goName, "data[payloadOffset+4 : payloadOffset+4+dataLen]")))
 	g.P("                    return fmt.Errorf(\"failed to unmarshal nested message: %w\", err)")
 	g.P("                }")
 	g.P("            }")
@@ -932,8 +1351,8 @@ func generateRepeatedNestedFieldUnmarshal(g *protogen.GeneratedFile, field *prot
 	g.P("                if len(data) >= currentOffset+4 {")
 	g.P("                    itemLen := int(binary.LittleEndian.Uint32(data[currentOffset:]))")
 	g.P("                    if len(data) >= currentOffset+4+itemLen {")
-	g.P(fmt.Sprintf("                        item := &%s{}", msgType))
-	g.P("                        if err := item.UnmarshalSymphony(data[currentOffset+4 : currentOffset+4+itemLen]); err != nil {")
+	g.P(fmt.Sprintf("                        item := %s", nestedAlloc(g, field)))
+	g.P(fmt.Sprintf("                        if err := %s; err != nil {", nestedUnmarshalCall(g, field, "item", "data[currentOffset+4 : currentOffset+4+itemLen]")))
 	g.P("                            return fmt.Errorf(\"failed to unmarshal nested message: %w\", err)")
 	g.P("                        }")
 	g.P(fmt.Sprintf("                        m.%s = append(m.%s, item)", goName, goName))
@@ -964,6 +1383,9 @@ func generateRawType(g *protogen.GeneratedFile, msg *protogen.Message) {
 	// Accessors for Raw Type
 	generateRawGetters(g, msg, rawName)
 	generateRawSetters(g, msg, rawName)
+
+	// Text format for debugging
+	generateRawText(g, msg, rawName)
 }
 
 func generateRawMarshal(g *protogen.GeneratedFile, rawName string) {
@@ -981,20 +1403,135 @@ func generateRawUnmarshal(g *protogen.GeneratedFile, rawName string) {
 	g.P()
 }
 
+// generateRawText generates String and MarshalText for the Raw type. The output follows the
+// protobuf text format (field names, quoted strings, one entry per repeated element) and
+// omits zero values. Fields annotated with is_sensitive are rendered as "[REDACTED]" when
+// set, so their values never end up in logs. Private fields are only rendered when the private segment is present,
+// so a proxy holding just the public segment can still print what it sees.
+func generateRawText(g *protogen.GeneratedFile, msg *protogen.Message, rawName string) {
+	builder := g.QualifiedGoIdent(stringsPkg.Ident("Builder"))
+	trimSpace := g.QualifiedGoIdent(stringsPkg.Ident("TrimSpace"))
+	wellKnownText := serializerPkg.Ident("WellKnownText")
+
+	g.P("// String renders the message in a protobuf-text-like format for debugging.")
+	g.P("// Private fields are omitted when the buffer only holds the public segment.")
+	g.P("func (m ", rawName, ") String() string {")
+	g.P("    text, err := m.MarshalText()")
+	g.P("    if err != nil {")
+	g.P("        return fmt.Sprintf(\"<invalid ", msg.GoIdent.GoName, ": %v>\", err)")
+	g.P("    }")
+	g.P("    return string(text)")
+	g.P("}")
+	g.P()
+
+	g.P("// MarshalText implements encoding.TextMarshaler using the format of String")
+	g.P("func (m ", rawName, ") MarshalText() (text []byte, err error) {")
+	g.P("    if len(m) < 13 || m[0] != 0x01 {")
+	g.P("        return nil, fmt.Errorf(\"invalid data: too short or wrong public version\")")
+	g.P("    }")
+	g.P("    // Getters do not validate offsets against each other, so recover from malformed buffers")
+	g.P("    defer func() {")
+	g.P("        if r := recover(); r != nil {")
+	g.P("            text, err = nil, fmt.Errorf(\"invalid data: %v\", r)")
+	g.P("        }")
+	g.P("    }()")
+	g.P("    offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))")
+	g.P("    hasPrivate := offsetToPrivate < len(m) && m[offsetToPrivate] == 0x01")
+	g.P("    _ = hasPrivate")
+	g.P("    var b ", builder)
+
+	for _, field := range msg.Fields {
+		name := string(field.Desc.Name())
+		getter := "m.Get" + field.GoName + "()"
+		indent := "    "
+		if !isPublicField(field) {
+			g.P("    if hasPrivate {")
+			indent = "        "
+		}
+
+		if isSensitiveField(field) {
+			// Only reveal whether the field is set
+			switch {
+			case isFixedLengthField(field) && field.Desc.Kind() == protoreflect.BoolKind:
+				g.P(indent, "if ", getter, " {")
+			case isFixedLengthField(field):
+				g.P(indent, "if ", getter, " != 0 {")
+			case isNestedMessageField(field):
+				g.P(indent, "if ", getter, " != nil {")
+			default:
+				g.P(indent, "if len(", getter, ") > 0 {")
+			}
+			g.P(indent, "    b.WriteString(\"", name, ": \\\"[REDACTED]\\\" \")")
+			g.P(indent, "}")
+		} else {
+			switch {
+			case isFixedLengthField(field) && field.Desc.Kind() == protoreflect.BoolKind:
+				g.P(indent, "if ", getter, " {")
+				g.P(indent, "    b.WriteString(\"", name, ": true \")")
+				g.P(indent, "}")
+			case isFixedLengthField(field):
+				g.P(indent, "if v := ", getter, "; v != 0 {")
+				g.P(indent, "    fmt.Fprintf(&b, \"", name, ": %v \", v)")
+				g.P(indent, "}")
+			case isVariableLengthField(field), isInternedField(field) && !field.Desc.IsList():
+				g.P(indent, "if v := ", getter, "; len(v) > 0 {")
+				g.P(indent, "    fmt.Fprintf(&b, \"", name, ": %q \", v)")
+				g.P(indent, "}")
+			case isRepeatedFixedLengthField(field), isDeltaEncodedField(field):
+				g.P(indent, "for _, v := range ", getter, " {")
+				g.P(indent, "    fmt.Fprintf(&b, \"", name, ": %v \", v)")
+				g.P(indent, "}")
+			case isRepeatedVariableLengthField(field), isInternedField(field) && field.Desc.IsList():
+				g.P(indent, "for _, v := range ", getter, " {")
+				g.P(indent, "    fmt.Fprintf(&b, \"", name, ": %q \", v)")
+				g.P(indent, "}")
+			case isNestedMessageField(field) && isWellKnownField(field):
+				g.P(indent, "if v := ", getter, "; v != nil {")
+				g.P(indent, "    fmt.Fprintf(&b, \"", name, ": %s \", ", wellKnownText, "(v))")
+				g.P(indent, "}")
+			case isRepeatedNestedMessageField(field) && isWellKnownField(field):
+				g.P(indent, "for _, v := range ", getter, " {")
+				g.P(indent, "    fmt.Fprintf(&b, \"", name, ": %s \", ", wellKnownText, "(v))")
+				g.P(indent, "}")
+			case isNestedMessageField(field):
+				g.P(indent, "if v := ", getter, "; v != nil {")
+				g.P(indent, "    fmt.Fprintf(&b, \"", name, " { %s } \", v)")
+				g.P(indent, "}")
+			case isRepeatedNestedMessageField(field):
+				g.P(indent, "for _, v := range ", getter, " {")
+				g.P(indent, "    fmt.Fprintf(&b, \"", name, " { %s } \", v)")
+				g.P(indent, "}")
+			default:
+				panic(fmt.Sprintf("Unknown field type: %s", field.GoName))
+			}
+		}
+
+		if !isPublicField(field) {
+			g.P("    }")
+		}
+	}
+
+	g.P("    return []byte(", trimSpace, "(b.String())), nil")
+	g.P("}")
+	g.P()
+}
+
 func generateRawGetters(g *protogen.GeneratedFile, msg *protogen.Message, rawName string) {
 	publicFields, privateFields := classifyFields(msg)
 	// Public fields start at offset 13 (1 version + 12 reserved)
 	publicOffsets := calculateFieldOffsets(publicFields, 13)
 	// Private fields start at offset 1 (relative to private segment start)
 	privateOffsets := calculateFieldOffsets(privateFields, 1)
+	// The string dictionary offset (if any) is the first table slot
+	publicDictSlot, privateDictSlot := 13, 1
 
 	for _, field := range msg.Fields {
 		isPublic := isPublicField(field)
-		var offset int
+		var offset, dictSlot int
 		if isPublic {
-			offset = publicOffsets[field]
+			offset, dictSlot = publicOffsets[field], publicDictSlot
 		} else {
-			offset = privateOffsets[field]
+			offset, dictSlot = privateOffsets[field], privateDictSlot
 		}
 
 		goType := getGoType(g, field, true) // true = Raw type
@@ -1020,6 +1557,12 @@ func generateRawGetters(g *protogen.GeneratedFile, msg *protogen.Message, rawNam
 			generateRawVariableFieldGetter(g, field, offset, isPublic)
 		} else if isRepeatedFixedLengthField(field) {
 			generateRawRepeatedFixedFieldGetter(g, field, offset, isPublic)
+		} else if isDeltaEncodedField(field) {
+			generateRawDeltaEncodedFieldGetter(g, field, offset, isPublic)
+		} else if isInternedField(field) && field.Desc.IsList() {
+			generateRawRepeatedInternedFieldGetter(g, field, offset, dictSlot, isPublic)
+		} else if isInternedField(field) {
+			generateRawInternedFieldGetter(g, field, offset, dictSlot, isPublic)
 		} else if isRepeatedVariableLengthField(field) {
 			generateRawRepeatedVariableFieldGetter(g, field, offset, isPublic)
 		} else if isNestedMessageField(field) {
@@ -1041,18 +1584,24 @@ func generateRawSetters(g *protogen.GeneratedFile, msg *protogen.Message, rawNam
 	publicOffsets := calculateFieldOffsets(publicFields, 13)
 	// Private fields start at offset 1 (relative to private segment start)
 	privateOffsets := calculateFieldOffsets(privateFields, 1)
+	// The string dictionary offset (if any) is the first table slot
+	publicDictSlot, privateDictSlot := 13, 1
 
 	for _, field := range msg.Fields {
 		isPublic := isPublicField(field)
-		var offset int
+		var offset, dictSlot int
 		if isPublic {
-			offset = publicOffsets[field]
+			offset, dictSlot = publicOffsets[field], publicDictSlot
 		} else {
-			offset = privateOffsets[field]
+			offset, dictSlot = privateOffsets[field], privateDictSlot
 		}
 
 		goType := getGoType(g, field, true) // true = Raw type
-		g.P("func (m *", rawName, ") Set", field.GoName, "(v ", goType, ") error {")
+		if !isPublic && checksums {
+			g.P("func (m *", rawName, ") Set", field.GoName, "(v ", goType, ") (err error) {")
+		} else {
+			g.P("func (m *", rawName, ") Set", field.GoName, "(v ", goType, ") error {")
+		}
 
 		// Public fields must assert public-only buffer
 		if isPublic {
@@ -1075,6 +1624,14 @@ func generateRawSetters(g *protogen.GeneratedFile, msg *protogen.Message, rawNam
 			g.P("        if offsetToPrivate < len(*m) { marker = (*m)[offsetToPrivate] }")
 			g.P("        panic(fmt.Sprintf(\"private setter ", field.GoName, " called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)\", offsetToPrivate, len(*m), marker))")
 			g.P("    }")
+			if checksums {
+				g.P("    // In-place updates invalidate the checksum")
+				g.P("    defer func() {")
+				g.P("        if err == nil {")
+				generateChecksumWrite(g, "*m")
+				g.P("        }")
+				g.P("    }()")
+			}
 		}
 
 		if isFixedLengthField(field) {
@@ -1083,6 +1640,12 @@ func generateRawSetters(g *protogen.GeneratedFile, msg *protogen.Message, rawNam
 			generateRawVariableFieldSetter(g, field, offset, msg, isPublic)
 		} else if isRepeatedFixedLengthField(field) {
 			generateRawRepeatedFixedFieldSetter(g, field, offset, msg, isPublic)
+		} else if isDeltaEncodedField(field) {
+			generateRawDeltaEncodedFieldSetter(g, field, offset, msg, isPublic)
+		} else if isInternedField(field) && field.Desc.IsList() {
+			generateRawRepeatedInternedFieldSetter(g, field, offset, dictSlot, msg, isPublic)
+		} else if isInternedField(field) {
+			generateRawInternedFieldSetter(g, field, offset, dictSlot, msg, isPublic)
 		} else if isRepeatedVariableLengthField(field) {
 			generateRawRepeatedVariableFieldSetter(g, field, offset, msg, isPublic)
 		} else if isNestedMessageField(field) {
@@ -1098,6 +1661,22 @@ func generateRawSetters(g *protogen.GeneratedFile, msg *protogen.Message, rawNam
 	}
 }
 
+// generateRawRepeatedNestedFieldUpdate generates code that stores the setter argument v in temp
+func generateRawRepeatedNestedFieldUpdate(g *protogen.GeneratedFile, field *protogen.Field, nestedMsgType string) {
+	goName := field.GoName
+	if isWellKnownField(field) {
+		g.P(fmt.Sprintf("    temp.%s = v", goName))
+		return
+	}
+	g.P(fmt.Sprintf("    temp.%s = make([]*%s, len(v))", goName, nestedMsgType))
+	g.P("    for i, rawItem := range v {")
+	g.P(fmt.Sprintf("        temp.%s[i] = &%s{}", goName, nestedMsgType))
+	g.P(fmt.Sprintf("        if err := temp.%s[i].UnmarshalSymphony([]byte(rawItem)); err != nil {", goName))
+	g.P("            return fmt.Errorf(\"failed to unmarshal nested message: %w\", err)")
+	g.P("        }")
+	g.P("    }")
+}
+
 // ==========================================
 // Helpers
 // ==========================================
@@ -1139,7 +1718,7 @@ func getGoTypeBase(g *protogen.GeneratedFile, field *protogen.Field, isRaw ...bo
 	case protoreflect.BytesKind:
 		return "[]byte"
 	case protoreflect.MessageKind:
-		if useRaw {
+		if useRaw && !isWellKnownField(field) {
 			// For Raw types, nested fields are also Raw types (e.g. LeafRaw)
 			return g.QualifiedGoIdent(field.Message.GoIdent) + "Raw"
 		}
@@ -1188,6 +1767,14 @@ func isPublicField(field *protogen.Field) bool {
 	return false
 }
 
+// isSensitiveField checks if field has is_sensitive = true option (extension 50002)
+func isSensitiveField(field *protogen.Field) bool {
+	if field.Desc.Options() == nil {
+		return false
+	}
+	return containsSubstring(fmt.Sprintf("%v", field.Desc.Options()), "50002:1")
+}
+
 func containsSubstring(s, substr string) bool {
 	for i := 0; i <= len(s)-len(substr); i++ {
 		if s[i:i+len(substr)] == substr {
@@ -1243,6 +1830,9 @@ func getFieldSize(field *protogen.Field) int {
 func calculateFieldOffsets(fields []*protogen.Field, tableStart int) map[*protogen.Field]int {
 	offsets := make(map[*protogen.Field]int)
 	offset := tableStart
+	if hasInternedFields(fields) {
+		offset += 4 // offset of the string dictionary
+	}
 
 	for _, field := range fields {
 		offsets[field] = offset
@@ -1337,8 +1927,8 @@ func generateRawFixedFieldSetter(g *protogen.GeneratedFile, field *protogen.Fiel
 
 // isVariableLengthField returns true if the field is a variable-length field (string or bytes, singular, not nested)
 func isVariableLengthField(field *protogen.Field) bool {
-	if field.Desc.IsList() {
-		return false // Repeated fields handled separately
+	if field.Desc.IsList() || isInternedField(field) {
+		return false // Repeated and interned fields handled separately
 	}
 	if field.Desc.Kind() == protoreflect.MessageKind {
 		return false // Nested messages handled separately
@@ -1348,7 +1938,7 @@ func isVariableLengthField(field *protogen.Field) bool {
 
 // isRepeatedFixedLengthField returns true if the field is a repeated fixed-length field
 func isRepeatedFixedLengthField(field *protogen.Field) bool {
-	if !field.Desc.IsList() {
+	if !field.Desc.IsList() || isDeltaEncodedField(field) {
 		return false
 	}
 	if field.Desc.Kind() == protoreflect.MessageKind {
@@ -1364,9 +1954,113 @@ func isRepeatedFixedLengthField(field *protogen.Field) bool {
 	}
 }
 
+// isDeltaEncodedField returns true if the field is a repeated integer field with
+// is_delta_encoded = true option (extension 50003)
+func isDeltaEncodedField(field *protogen.Field) bool {
+	if !field.Desc.IsList() || !hasDeltaEncodedOption(field) {
+		return false
+	}
+	switch field.Desc.Kind() {
+	case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Uint32Kind, protoreflect.Uint64Kind:
+		return true
+	default:
+		return false
+	}
+}
+
+func hasDeltaEncodedOption(field *protogen.Field) bool {
+	if field.Desc.Options() == nil {
+		return false
+	}
+	return containsSubstring(fmt.Sprintf("%v", field.Desc.Options()), "50003:1")
+}
+
+// checkDeltaEncodedFields rejects is_delta_encoded on fields other than repeated integers,
+// rather than silently ignoring it
+func checkDeltaEncodedFields(msgs []*protogen.Message) error {
+	for _, msg := range msgs {
+		for _, field := range msg.Fields {
+			if hasDeltaEncodedOption(field) && !isDeltaEncodedField(field) {
+				return fmt.Errorf("field %s: is_delta_encoded requires a repeated int32, int64, uint32 or uint64 field", field.Desc.FullName())
+			}
+		}
+		if err := checkDeltaEncodedFields(msg.Messages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isInternedField returns true if the field is a string or repeated string field with
+// is_interned = true option (extension 50004). Interned fields store references into the
+// string dictionary of their segment (see pkg/serializer/dict.go).
+func isInternedField(field *protogen.Field) bool {
+	return field.Desc.Kind() == protoreflect.StringKind && hasInternedOption(field)
+}
+
+func hasInternedOption(field *protogen.Field) bool {
+	if field.Desc.Options() == nil {
+		return false
+	}
+	return containsSubstring(fmt.Sprintf("%v", field.Desc.Options()), "50004:1")
+}
+
+// checkInternedFields rejects is_interned on fields other than strings, rather than
+// silently ignoring it
+func checkInternedFields(msgs []*protogen.Message) error {
+	for _, msg := range msgs {
+		for _, field := range msg.Fields {
+			if hasInternedOption(field) && !isInternedField(field) {
+				return fmt.Errorf("field %s: is_interned requires a string or repeated string field", field.Desc.FullName())
+			}
+		}
+		if err := checkInternedFields(msg.Messages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasInternedFields returns true if any of the fields of a segment is interned, in which
+// case the segment carries a string dictionary
+func hasInternedFields(fields []*protogen.Field) bool {
+	for _, field := range fields {
+		if isInternedField(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentTableSize returns the size of the table of a segment: the field slots, preceded by
+// the offset of the string dictionary if the segment has interned fields
+func segmentTableSize(fields []*protogen.Field) int {
+	tableSize := 0
+	for _, field := range fields {
+		if isFixedLengthField(field) {
+			tableSize += getFieldSize(field)
+		} else {
+			tableSize += 4 // 32-bit offset (or string reference) for other fields
+		}
+	}
+	if hasInternedFields(fields) {
+		tableSize += 4 // offset of the string dictionary
+	}
+	return tableSize
+}
+
+// dictVarName returns the name of the string dictionary variable of the segment whose table
+// starts at tableStartVar
+func dictVarName(tableStartVar string) string {
+	if prefix, ok := strings.CutSuffix(tableStartVar, "TableStart"); ok {
+		return prefix + "Dict"
+	}
+	return "dict"
+}
+
 // isRepeatedVariableLengthField returns true if the field is a repeated variable-length field (repeated string or bytes)
 func isRepeatedVariableLengthField(field *protogen.Field) bool {
-	if !field.Desc.IsList() {
+	if !field.Desc.IsList() || isInternedField(field) {
 		return false
 	}
 	return field.Desc.Kind() == protoreflect.StringKind || field.Desc.Kind() == protoreflect.BytesKind
@@ -1385,6 +2079,101 @@ func isRepeatedNestedMessageField(field *protogen.Field) bool {
 	return field.Desc.IsList() && field.Desc.Kind() == protoreflect.MessageKind
 }
 
+// wellKnownTypes are the google.protobuf well-known types with a compact Symphony encoding
+// (see pkg/serializer/wellknown.go)
+var wellKnownTypes = map[protoreflect.FullName]bool{
+	"google.protobuf.Timestamp":   true,
+	"google.protobuf.Duration":    true,
+	"google.protobuf.Any":         true,
+	"google.protobuf.Struct":      true,
+	"google.protobuf.Value":       true,
+	"google.protobuf.ListValue":   true,
+	"google.protobuf.Empty":       true,
+	"google.protobuf.BoolValue":   true,
+	"google.protobuf.Int32Value":  true,
+	"google.protobuf.Int64Value":  true,
+	"google.protobuf.UInt32Value": true,
+	"google.protobuf.UInt64Value": true,
+	"google.protobuf.FloatValue":  true,
+	"google.protobuf.DoubleValue": true,
+	"google.protobuf.StringValue": true,
+	"google.protobuf.BytesValue":  true,
+}
+
+// isWellKnownField returns true if the field (or its elements) is a well-known type.
+// Well-known types are framed like nested messages but use the compact encodings of
+// the serializer package instead of generated MarshalSymphony methods.
+func isWellKnownField(field *protogen.Field) bool {
+	return field.Message != nil && wellKnownTypes[field.Message.Desc.FullName()]
+}
+
+// nestedMarshalCall returns the expression that encodes the nested message expr of field
+func nestedMarshalCall(g *protogen.GeneratedFile, field *protogen.Field, expr string) string {
+	if isWellKnownField(field) {
+		return fmt.Sprintf("%s(%s)", g.QualifiedGoIdent(serializerPkg.Ident("MarshalWellKnown")), expr)
+	}
+	return expr + ".MarshalSymphony()"
+}
+
+// nestedUnmarshalCall returns the expression that decodes dataExpr into the nested message expr of field
+func nestedUnmarshalCall(g *protogen.GeneratedFile, field *protogen.Field, expr, dataExpr string) string {
+	if isWellKnownField(field) {
+		return fmt.Sprintf("%s(%s, %s)", g.QualifiedGoIdent(serializerPkg.Ident("UnmarshalWellKnown")), dataExpr, expr)
+	}
+	if arenaAlloc {
+		return fmt.Sprintf("%s.UnmarshalSymphonyArena(%s, arena)", expr, dataExpr)
+	}
+	return fmt.Sprintf("%s.UnmarshalSymphony(%s)", expr, dataExpr)
+}
+
+// fixedSliceFunc returns the serializer function that writes (op "Put") or reads (op "Get")
+// the payload of the repeated fixed-length field
+func fixedSliceFunc(g *protogen.GeneratedFile, field *protogen.Field, op string) string {
+	var elem string
+	switch field.Desc.Kind() {
+	case protoreflect.BoolKind:
+		elem = "Bools"
+	case protoreflect.Int32Kind, protoreflect.EnumKind:
+		elem = "Int32s"
+	case protoreflect.Uint32Kind:
+		elem = "Uint32s"
+	case protoreflect.Int64Kind:
+		elem = "Int64s"
+	case protoreflect.Uint64Kind:
+		elem = "Uint64s"
+	case protoreflect.FloatKind:
+		elem = "Float32s"
+	case protoreflect.DoubleKind:
+		elem = "Float64s"
+	}
+	return g.QualifiedGoIdent(serializerPkg.Ident(op + elem))
+}
+
+// nestedAlloc returns the expression that allocates the nested message of field before it
+// is decoded. Well-known types always come from the heap.
+func nestedAlloc(g *protogen.GeneratedFile, field *protogen.Field) string {
+	msgType := g.QualifiedGoIdent(field.Message.GoIdent)
+	if !arenaAlloc || isWellKnownField(field) {
+		return "&" + msgType + "{}"
+	}
+	return fmt.Sprintf("%s[%s](arena, %s)", g.QualifiedGoIdent(serializerPkg.Ident("ArenaNew")), msgType, arenaTypeVar(field.Message))
+}
+
+// arenaTypeVar returns the name of the variable holding the serializer.ArenaType of msg
+func arenaTypeVar(msg *protogen.Message) string {
+	return "symphonyArena" + msg.GoIdent.GoName
+}
+
+// hasArenaFields reports whether decoding fields allocates nested messages from the arena
+func hasArenaFields(fields []*protogen.Field) bool {
+	for _, field := range fields {
+		if (isNestedMessageField(field) || isRepeatedNestedMessageField(field)) && !isWellKnownField(field) {
+			return true
+		}
+	}
+	return false
+}
+
 // generateSegmentSizeCalculation generates code to calculate size for a segment (public or private)
 // Returns the table size for the segment
 func generateSegmentSizeCalculation(g *protogen.GeneratedFile, fields []*protogen.Field, sizeVar, msgVar string, depth int, includeVersion bool) int {
@@ -1400,19 +2189,25 @@ func generateSegmentSizeCalculation(g *protogen.GeneratedFile, fields []*protoge
 	}
 
 	// Calculate table size
-	tableSize := 0
-	for _, field := range fields {
-		if isFixedLengthField(field) {
-			tableSize += getFieldSize(field)
-		} else {
-			tableSize += 4 // 32-bit offset for variable-length fields
-		}
-	}
+	tableSize := segmentTableSize(fields)
 
 	if tableSize > 0 {
 		g.P(fmt.Sprintf("    %s += %d // table entries", nestedSizeVar, tableSize))
 	}
 
+	// At depth 0 the string dictionaries built here are reused to marshal the segments
+	if hasInternedFields(fields) {
+		dictVar := "publicDict"
+		if includeVersion {
+			dictVar = "privateDict"
+		}
+		if depth > 0 {
+			dictVar = fmt.Sprintf("%s%d", dictVar, depth)
+		}
+		generateStringDictBuild(g, fields, dictVar, msgVar)
+		g.P(fmt.Sprintf("    %s += %s.EncodedSize() // string dictionary", nestedSizeVar, dictVar))
+	}
+
 	// Calculate payload size for variable-length fields
 	for _, field := range fields {
 		fieldNum := field.Desc.Number()
@@ -1425,12 +2220,29 @@ func generateSegmentSizeCalculation(g *protogen.GeneratedFile, fields []*protoge
 			fieldSize := getFieldSize(field)
 			g.P(fmt.Sprintf("    // Field %d (%s): repeated fixed-length payload", fieldNum, goName))
 			g.P(fmt.Sprintf("    %s += 4 + %d*len(%s.%s) // 4 bytes count + data", nestedSizeVar, fieldSize, msgVar, goName))
+		} else if isDeltaEncodedField(field) {
+			g.P(fmt.Sprintf("    // Field %d (%s): repeated delta-encoded payload", fieldNum, goName))
+			g.P(fmt.Sprintf("    %s += 8 + %s(%s.%s) // 4 bytes count + 4 bytes length + varints", nestedSizeVar, g.QualifiedGoIdent(serializerPkg.Ident("DeltaEncodedSize")), msgVar, goName))
+		} else if isInternedField(field) && field.Desc.IsList() {
+			g.P(fmt.Sprintf("    // Field %d (%s): repeated interned string payload", fieldNum, goName))
+			g.P(fmt.Sprintf("    %s += 4 + 4*len(%s.%s) // 4 bytes count + references", nestedSizeVar, msgVar, goName))
 		} else if isRepeatedVariableLengthField(field) {
 			g.P(fmt.Sprintf("    // Field %d (%s): repeated variable-length payload", fieldNum, goName))
 			g.P(fmt.Sprintf("    %s += 4 // count", nestedSizeVar))
 			g.P(fmt.Sprintf("    for _, item := range %s.%s {", msgVar, goName))
 			g.P(fmt.Sprintf("        %s += 4 + len(item) // 4 bytes length prefix + data", nestedSizeVar))
 			g.P("    }")
+		} else if isNestedMessageField(field) && isWellKnownField(field) {
+			g.P(fmt.Sprintf("    // Field %d (%s): well-known type payload", fieldNum, goName))
+			g.P(fmt.Sprintf("    if %s.%s != nil {", msgVar, goName))
+			g.P(fmt.Sprintf("        %s += 4 + %s(%s.%s) // 4 bytes size + compact data", nestedSizeVar, g.QualifiedGoIdent(serializerPkg.Ident("WellKnownSize")), msgVar, goName))
+			g.P("    }")
+		} else if isRepeatedNestedMessageField(field) && isWellKnownField(field) {
+			g.P(fmt.Sprintf("    // Field %d (%s): repeated well-known type payload", fieldNum, goName))
+			g.P(fmt.Sprintf("    %s += 4 // count", nestedSizeVar))
+			g.P(fmt.Sprintf("    for _, item := range %s.%s {", msgVar, goName))
+			g.P(fmt.Sprintf("        %s += 4 + %s(item) // 4 bytes size + compact data", nestedSizeVar, g.QualifiedGoIdent(serializerPkg.Ident("WellKnownSize"))))
+			g.P("    }")
 		} else if isNestedMessageField(field) {
 			g.P(fmt.Sprintf("    // Field %d (%s): nested message payload", fieldNum, goName))
 			g.P(fmt.Sprintf("    if %s.%s != nil {", msgVar, goName))
@@ -1485,6 +2297,9 @@ func generateSizeCalculation(g *protogen.GeneratedFile, msg *protogen.Message, s
 	// Calculate private segment
 	g.P("    // Private segment:")
 	_ = generateSegmentSizeCalculation(g, privateFields, nestedSizeVar, msgVar, depth, true)
+	if checksums {
+		g.P(fmt.Sprintf("    %s += %d // checksum", nestedSizeVar, trailerSize()))
+	}
 
 	g.P()
 
@@ -1556,11 +2371,9 @@ func generateRawVariableFieldGetter(g *protogen.GeneratedFile, field *protogen.F
 	g.P("    }")
 
 	if field.Desc.Kind() == protoreflect.StringKind {
-		g.P("    return string(m[payloadOffset+4 : payloadOffset+4+dataLen])")
+		g.P("    return ", serializerPkg.Ident("GetString"), "(m[payloadOffset+4 : payloadOffset+4+dataLen])")
 	} else { // BytesKind
-		g.P("    result := make([]byte, dataLen)")
-		g.P("    copy(result, m[payloadOffset+4:payloadOffset+4+dataLen])")
-		g.P("    return result")
+		g.P("    return ", serializerPkg.Ident("GetBytes"), "(m[payloadOffset+4 : payloadOffset+4+dataLen])")
 	}
 }
 
@@ -1658,26 +2471,7 @@ func generateRawRepeatedFixedFieldGetter(g *protogen.GeneratedFile, field *proto
 
 	// Allocate slice and read each element
 	g.P(fmt.Sprintf("    result := make([]%s, count)", getGoTypeName(field)))
-	g.P("    for i := 0; i < count; i++ {")
-	switch field.Desc.Kind() {
-	case protoreflect.BoolKind:
-		g.P(fmt.Sprintf("        result[i] = m[payloadOffset+4+%d*i] != 0", fieldSize))
-	case protoreflect.Int32Kind, protoreflect.EnumKind:
-		g.P(fmt.Sprintf("        result[i] = int32(binary.LittleEndian.Uint32(m[payloadOffset+4+%d*i:]))", fieldSize))
-	case protoreflect.Uint32Kind:
-		g.P(fmt.Sprintf("        result[i] = binary.LittleEndian.Uint32(m[payloadOffset+4+%d*i:])", fieldSize))
-	case protoreflect.Int64Kind:
-		g.P(fmt.Sprintf("        result[i] = int64(binary.LittleEndian.Uint64(m[payloadOffset+4+%d*i:]))", fieldSize))
-	case protoreflect.Uint64Kind:
-		g.P(fmt.Sprintf("        result[i] = binary.LittleEndian.Uint64(m[payloadOffset+4+%d*i:])", fieldSize))
-	case protoreflect.FloatKind:
-		mathQualified := g.QualifiedGoIdent(math.Ident("Float32frombits"))
-		g.P(fmt.Sprintf("        result[i] = %s(binary.LittleEndian.Uint32(m[payloadOffset+4+%d*i:]))", mathQualified, fieldSize))
-	case protoreflect.DoubleKind:
-		mathQualified := g.QualifiedGoIdent(math.Ident("Float64frombits"))
-		g.P(fmt.Sprintf("        result[i] = %s(binary.LittleEndian.Uint64(m[payloadOffset+4+%d*i:]))", mathQualified, fieldSize))
-	}
-	g.P("    }")
+	g.P(fmt.Sprintf("    %s(result, m[payloadOffset+4:])", fixedSliceFunc(g, field, "Get")))
 	g.P("    return result")
 }
 
@@ -1725,30 +2519,105 @@ func generateRawRepeatedFixedFieldSetter(g *protogen.GeneratedFile, field *proto
 	g.P("    if oldPayloadOffset > 0 && newDataSize <= oldDataSize {")
 	g.P("        // Update in-place (waste space)")
 	g.P("        binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(newCount))")
-	g.P("        for i, val := range v {")
-	switch field.Desc.Kind() {
-	case protoreflect.BoolKind:
-		g.P("            if val {")
-		g.P(fmt.Sprintf("                (*m)[oldPayloadOffset+4+%d*i] = 1", fieldSize))
-		g.P("            } else {")
-		g.P(fmt.Sprintf("                (*m)[oldPayloadOffset+4+%d*i] = 0", fieldSize))
-		g.P("            }")
-	case protoreflect.Int32Kind, protoreflect.EnumKind:
-		g.P(fmt.Sprintf("            binary.LittleEndian.PutUint32((*m)[oldPayloadOffset+4+%d*i:], uint32(val))", fieldSize))
-	case protoreflect.Uint32Kind:
-		g.P(fmt.Sprintf("            binary.LittleEndian.PutUint32((*m)[oldPayloadOffset+4+%d*i:], val)", fieldSize))
-	case protoreflect.Int64Kind:
-		g.P(fmt.Sprintf("            binary.LittleEndian.PutUint64((*m)[oldPayloadOffset+4+%d*i:], uint64(val))", fieldSize))
-	case protoreflect.Uint64Kind:
-		g.P(fmt.Sprintf("            binary.LittleEndian.PutUint64((*m)[oldPayloadOffset+4+%d*i:], val)", fieldSize))
-	case protoreflect.FloatKind:
-		mathQualified := g.QualifiedGoIdent(math.Ident("Float32bits"))
-		g.P(fmt.Sprintf("            binary.LittleEndian.PutUint32((*m)[oldPayloadOffset+4+%d*i:], %s(val))", fieldSize, mathQualified))
-	case protoreflect.DoubleKind:
-		mathQualified := g.QualifiedGoIdent(math.Ident("Float64bits"))
-		g.P(fmt.Sprintf("            binary.LittleEndian.PutUint64((*m)[oldPayloadOffset+4+%d*i:], %s(val))", fieldSize, mathQualified))
+	g.P(fmt.Sprintf("        %s((*m)[oldPayloadOffset+4:], v)", fixedSliceFunc(g, field, "Put")))
+	g.P("        return nil")
+	g.P("    }")
+
+	// Need to remarshal
+	generateRemarshalLogic(g, msg, goName, isPublic)
+}
+
+// generateRawDeltaEncodedFieldGetter generates code to read a repeated delta-encoded field from Raw type
+func generateRawDeltaEncodedFieldGetter(g *protogen.GeneratedFile, field *protogen.Field, tableOffset int, isPublic bool) {
+	fieldNum := field.Desc.Number()
+	goName := field.GoName
+
+	// For private fields, adjust offset to be relative to private segment
+	offsetExpr := fmt.Sprintf("%d", tableOffset)
+	if !isPublic {
+		offsetExpr = fmt.Sprintf("offsetToPrivate+%d", tableOffset)
 	}
-	g.P("        }")
+
+	g.P(fmt.Sprintf("    // Field %d (%s): repeated delta-encoded", fieldNum, goName))
+
+	// Check buffer size for table entry
+	g.P(fmt.Sprintf("    if len(m) < %s+4 {", offsetExpr))
+	g.P("        return ", getZeroValue(field))
+	g.P("    }")
+
+	// Read offset from table entry
+	g.P(fmt.Sprintf("    payloadOffset := int(binary.LittleEndian.Uint32(m[%s:]))", offsetExpr))
+
+	// Check if offset is valid (0 means not set)
+	g.P("    if payloadOffset == 0 {")
+	g.P("        return ", getZeroValue(field))
+	g.P("    }")
+
+	// For private fields, convert relative offset to absolute
+	if !isPublic {
+		g.P("    payloadOffset += offsetToPrivate // convert relative offset to absolute")
+	}
+
+	// Read count and data length from payload
+	g.P("    if len(m) < payloadOffset+8 {")
+	g.P("        return ", getZeroValue(field))
+	g.P("    }")
+	g.P("    count := int(binary.LittleEndian.Uint32(m[payloadOffset:]))")
+	g.P("    dataLen := int(binary.LittleEndian.Uint32(m[payloadOffset+4:]))")
+	g.P("    if len(m) < payloadOffset+8+dataLen {")
+	g.P("        return ", getZeroValue(field))
+	g.P("    }")
+
+	// Decode the deltas into a new slice
+	g.P(fmt.Sprintf("    result, err := %s[%s](m[payloadOffset+8:payloadOffset+8+dataLen], count)", g.QualifiedGoIdent(serializerPkg.Ident("DecodeDeltaEncoded")), getGoTypeName(field)))
+	g.P("    if err != nil {")
+	g.P("        return ", getZeroValue(field))
+	g.P("    }")
+	g.P("    return result")
+}
+
+// generateRawDeltaEncodedFieldSetter generates code to write a repeated delta-encoded field to Raw type
+func generateRawDeltaEncodedFieldSetter(g *protogen.GeneratedFile, field *protogen.Field, tableOffset int, msg *protogen.Message, isPublic bool) {
+	fieldNum := field.Desc.Number()
+	goName := field.GoName
+
+	// For private fields, adjust offset to be relative to private segment
+	offsetExpr := fmt.Sprintf("%d", tableOffset)
+	if !isPublic {
+		offsetExpr = fmt.Sprintf("offsetToPrivate+%d", tableOffset)
+	}
+
+	g.P(fmt.Sprintf("    // Field %d (%s): repeated delta-encoded", fieldNum, goName))
+
+	// Check buffer size for table entry
+	g.P(fmt.Sprintf("    if len(*m) < %s+4 {", offsetExpr))
+	g.P("        return fmt.Errorf(\"buffer too short for table entry\")")
+	g.P("    }")
+
+	// Read current offset and encoded size
+	g.P(fmt.Sprintf("    oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[%s:]))", offsetExpr))
+
+	// For private fields, convert relative offset to absolute
+	if !isPublic {
+		g.P("    if oldPayloadOffset > 0 {")
+		g.P("        oldPayloadOffset += offsetToPrivate // convert relative offset to absolute")
+		g.P("    }")
+	}
+
+	g.P("    var oldDataSize int")
+	g.P("    if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+8 {")
+	g.P("        oldDataSize = 8 + int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset+4:])) // count + length + varints")
+	g.P("    }")
+
+	// Calculate new data size
+	g.P(fmt.Sprintf("    newDataSize := 8 + %s(v) // count + length + varints", g.QualifiedGoIdent(serializerPkg.Ident("DeltaEncodedSize"))))
+
+	// Check if we can update in-place
+	g.P("    if oldPayloadOffset > 0 && newDataSize <= oldDataSize && len(*m) >= oldPayloadOffset+oldDataSize {")
+	g.P("        // Update in-place (waste space)")
+	g.P("        binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(len(v)))")
+	g.P(fmt.Sprintf("        dataLen := %s((*m)[oldPayloadOffset+8:], v)", g.QualifiedGoIdent(serializerPkg.Ident("PutDeltaEncoded"))))
+	g.P("        binary.LittleEndian.PutUint32((*m)[oldPayloadOffset+4:], uint32(dataLen))")
 	g.P("        return nil")
 	g.P("    }")
 
@@ -1756,6 +2625,209 @@ func generateRawRepeatedFixedFieldSetter(g *protogen.GeneratedFile, field *proto
 	generateRemarshalLogic(g, msg, goName, isPublic)
 }
 
+// generateRawInternedFieldGetter generates code to read an interned string field from Raw type
+func generateRawInternedFieldGetter(g *protogen.GeneratedFile, field *protogen.Field, tableOffset, dictSlot int, isPublic bool) {
+	fieldNum := field.Desc.Number()
+	goName := field.GoName
+
+	// For private fields, adjust offsets to be relative to private segment
+	offsetExpr := fmt.Sprintf("%d", tableOffset)
+	dictExpr := fmt.Sprintf("%d", dictSlot)
+	if !isPublic {
+		offsetExpr = fmt.Sprintf("offsetToPrivate+%d", tableOffset)
+		dictExpr = fmt.Sprintf("offsetToPrivate+%d", dictSlot)
+	}
+
+	g.P(fmt.Sprintf("    // Field %d (%s): interned string", fieldNum, goName))
+
+	// Check buffer size for the reference and the dictionary offset
+	g.P(fmt.Sprintf("    if len(m) < %s+4 || len(m) < %s+4 {", offsetExpr, dictExpr))
+	g.P("        return \"\"")
+	g.P("    }")
+
+	// Read the reference and the dictionary offset (0 means not set)
+	g.P(fmt.Sprintf("    ref := binary.LittleEndian.Uint32(m[%s:])", offsetExpr))
+	g.P(fmt.Sprintf("    dictOffset := int(binary.LittleEndian.Uint32(m[%s:]))", dictExpr))
+	g.P("    if ref == 0 || dictOffset == 0 {")
+	g.P("        return \"\"")
+	g.P("    }")
+
+	// For private fields, convert relative offset to absolute
+	if !isPublic {
+		g.P("    dictOffset += offsetToPrivate // convert relative offset to absolute")
+	}
+
+	// Look the entry up without decoding the whole dictionary
+	g.P("    if len(m) < dictOffset {")
+	g.P("        return \"\"")
+	g.P("    }")
+	g.P(fmt.Sprintf("    v, _ := %s(m[dictOffset:], ref)", g.QualifiedGoIdent(serializerPkg.Ident("LookupStringDict"))))
+	g.P("    return v")
+}
+
+// generateRawInternedFieldSetter generates code to write an interned string field to Raw type
+func generateRawInternedFieldSetter(g *protogen.GeneratedFile, field *protogen.Field, tableOffset, dictSlot int, msg *protogen.Message, isPublic bool) {
+	fieldNum := field.Desc.Number()
+	goName := field.GoName
+
+	// For private fields, adjust offsets to be relative to private segment
+	offsetExpr := fmt.Sprintf("%d", tableOffset)
+	dictExpr := fmt.Sprintf("%d", dictSlot)
+	if !isPublic {
+		offsetExpr = fmt.Sprintf("offsetToPrivate+%d", tableOffset)
+		dictExpr = fmt.Sprintf("offsetToPrivate+%d", dictSlot)
+	}
+
+	g.P(fmt.Sprintf("    // Field %d (%s): interned string", fieldNum, goName))
+
+	// Check buffer size for the reference and the dictionary offset
+	g.P(fmt.Sprintf("    if len(*m) < %s+4 || len(*m) < %s+4 {", offsetExpr, dictExpr))
+	g.P("        return fmt.Errorf(\"buffer too short for table entry\")")
+	g.P("    }")
+	generateRawStringDictLookup(g, dictExpr, isPublic)
+
+	// Update in-place if v is already in the dictionary
+	g.P(fmt.Sprintf("    if ref, ok := %s(dict, v); ok {", g.QualifiedGoIdent(serializerPkg.Ident("FindStringDict"))))
+	g.P(fmt.Sprintf("        binary.LittleEndian.PutUint32((*m)[%s:], ref)", offsetExpr))
+	g.P("        return nil")
+	g.P("    }")
+
+	// Need to remarshal to add v to the dictionary
+	generateRemarshalLogic(g, msg, goName, isPublic)
+}
+
+// generateRawRepeatedInternedFieldGetter generates code to read a repeated interned string field from Raw type
+func generateRawRepeatedInternedFieldGetter(g *protogen.GeneratedFile, field *protogen.Field, tableOffset, dictSlot int, isPublic bool) {
+	fieldNum := field.Desc.Number()
+	goName := field.GoName
+
+	// For private fields, adjust offsets to be relative to private segment
+	offsetExpr := fmt.Sprintf("%d", tableOffset)
+	dictExpr := fmt.Sprintf("%d", dictSlot)
+	if !isPublic {
+		offsetExpr = fmt.Sprintf("offsetToPrivate+%d", tableOffset)
+		dictExpr = fmt.Sprintf("offsetToPrivate+%d", dictSlot)
+	}
+
+	g.P(fmt.Sprintf("    // Field %d (%s): repeated interned string", fieldNum, goName))
+
+	// Check buffer size for the table entry and the dictionary offset
+	g.P(fmt.Sprintf("    if len(m) < %s+4 || len(m) < %s+4 {", offsetExpr, dictExpr))
+	g.P("        return ", getZeroValue(field))
+	g.P("    }")
+
+	// Read offset from table entry
+	g.P(fmt.Sprintf("    payloadOffset := int(binary.LittleEndian.Uint32(m[%s:]))", offsetExpr))
+
+	// Check if offset is valid (0 means not set)
+	g.P("    if payloadOffset == 0 {")
+	g.P("        return ", getZeroValue(field))
+	g.P("    }")
+
+	// For private fields, convert relative offset to absolute
+	if !isPublic {
+		g.P("    payloadOffset += offsetToPrivate // convert relative offset to absolute")
+	}
+
+	// Read count and references
+	g.P("    if len(m) < payloadOffset+4 {")
+	g.P("        return ", getZeroValue(field))
+	g.P("    }")
+	g.P("    count := int(binary.LittleEndian.Uint32(m[payloadOffset:]))")
+	g.P("    if len(m) < payloadOffset+4+4*count {")
+	g.P("        return ", getZeroValue(field))
+	g.P("    }")
+
+	// Decode the dictionary once and resolve the references
+	g.P("    var dict []string")
+	g.P(fmt.Sprintf("    if dictOffset := int(binary.LittleEndian.Uint32(m[%s:])); dictOffset > 0 {", dictExpr))
+	if !isPublic {
+		g.P("        dictOffset += offsetToPrivate // convert relative offset to absolute")
+	}
+	g.P("        if len(m) >= dictOffset {")
+	g.P(fmt.Sprintf("            dict, _ = %s(m[dictOffset:])", g.QualifiedGoIdent(serializerPkg.Ident("DecodeStringDict"))))
+	g.P("        }")
+	g.P("    }")
+	g.P("    result := make([]string, count)")
+	g.P("    for i := range result {")
+	g.P(fmt.Sprintf("        result[i], _ = %s(dict, binary.LittleEndian.Uint32(m[payloadOffset+4+4*i:]))", g.QualifiedGoIdent(serializerPkg.Ident("DictString"))))
+	g.P("    }")
+	g.P("    return result")
+}
+
+// generateRawRepeatedInternedFieldSetter generates code to write a repeated interned string field to Raw type
+func generateRawRepeatedInternedFieldSetter(g *protogen.GeneratedFile, field *protogen.Field, tableOffset, dictSlot int, msg *protogen.Message, isPublic bool) {
+	fieldNum := field.Desc.Number()
+	goName := field.GoName
+
+	// For private fields, adjust offsets to be relative to private segment
+	offsetExpr := fmt.Sprintf("%d", tableOffset)
+	dictExpr := fmt.Sprintf("%d", dictSlot)
+	if !isPublic {
+		offsetExpr = fmt.Sprintf("offsetToPrivate+%d", tableOffset)
+		dictExpr = fmt.Sprintf("offsetToPrivate+%d", dictSlot)
+	}
+
+	g.P(fmt.Sprintf("    // Field %d (%s): repeated interned string", fieldNum, goName))
+
+	// Check buffer size for the table entry and the dictionary offset
+	g.P(fmt.Sprintf("    if len(*m) < %s+4 || len(*m) < %s+4 {", offsetExpr, dictExpr))
+	g.P("        return fmt.Errorf(\"buffer too short for table entry\")")
+	g.P("    }")
+	generateRawStringDictLookup(g, dictExpr, isPublic)
+
+	// Read current offset and count
+	g.P(fmt.Sprintf("    oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[%s:]))", offsetExpr))
+	if !isPublic {
+		g.P("    if oldPayloadOffset > 0 {")
+		g.P("        oldPayloadOffset += offsetToPrivate // convert relative offset to absolute")
+		g.P("    }")
+	}
+	g.P("    var oldCount int")
+	g.P("    if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+4 {")
+	g.P("        oldCount = int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset:]))")
+	g.P("    }")
+
+	// Update in-place if v fits and all its strings are already in the dictionary
+	g.P("    if oldPayloadOffset > 0 && len(v) <= oldCount && len(*m) >= oldPayloadOffset+4+4*oldCount {")
+	g.P("        refs := make([]uint32, len(v))")
+	g.P("        inPlace := true")
+	g.P("        for i, s := range v {")
+	g.P(fmt.Sprintf("            ref, ok := %s(dict, s)", g.QualifiedGoIdent(serializerPkg.Ident("FindStringDict"))))
+	g.P("            if !ok {")
+	g.P("                inPlace = false")
+	g.P("                break")
+	g.P("            }")
+	g.P("            refs[i] = ref")
+	g.P("        }")
+	g.P("        if inPlace {")
+	g.P("            // Update in-place (waste space)")
+	g.P("            binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(len(v)))")
+	g.P("            for i, ref := range refs {")
+	g.P("                binary.LittleEndian.PutUint32((*m)[oldPayloadOffset+4+4*i:], ref)")
+	g.P("            }")
+	g.P("            return nil")
+	g.P("        }")
+	g.P("    }")
+
+	// Need to remarshal
+	generateRemarshalLogic(g, msg, goName, isPublic)
+}
+
+// generateRawStringDictLookup generates code that sets dict to the encoded string dictionary
+// of the segment, nil if it has none
+func generateRawStringDictLookup(g *protogen.GeneratedFile, dictExpr string, isPublic bool) {
+	g.P("    var dict []byte")
+	g.P(fmt.Sprintf("    if dictOffset := int(binary.LittleEndian.Uint32((*m)[%s:])); dictOffset > 0 {", dictExpr))
+	if !isPublic {
+		g.P("        dictOffset += offsetToPrivate // convert relative offset to absolute")
+	}
+	g.P("        if len(*m) >= dictOffset {")
+	g.P("            dict = (*m)[dictOffset:]")
+	g.P("        }")
+	g.P("    }")
+}
+
 // generateRawRepeatedVariableFieldGetter generates code to read a repeated variable-length field from Raw type
 func generateRawRepeatedVariableFieldGetter(g *protogen.GeneratedFile, field *protogen.Field, tableOffset int, isPublic bool) {
 	fieldNum := field.Desc.Number()
@@ -1811,10 +2883,9 @@ func generateRawRepeatedVariableFieldGetter(g *protogen.GeneratedFile, field *pr
 	g.P("            return ", getZeroValue(field))
 	g.P("        }")
 	if field.Desc.Kind() == protoreflect.StringKind {
-		g.P("        result[i] = string(m[currentOffset+4 : currentOffset+4+itemLen])")
+		g.P("        result[i] = ", serializerPkg.Ident("GetString"), "(m[currentOffset+4 : currentOffset+4+itemLen])")
 	} else { // BytesKind
-		g.P("        result[i] = make([]byte, itemLen)")
-		g.P("        copy(result[i], m[currentOffset+4:currentOffset+4+itemLen])")
+		g.P("        result[i] = ", serializerPkg.Ident("GetBytes"), "(m[currentOffset+4 : currentOffset+4+itemLen])")
 	}
 	g.P("        currentOffset += 4 + itemLen")
 	g.P("    }")
@@ -1934,6 +3005,16 @@ func generateRawNestedFieldGetter(g *protogen.GeneratedFile, field *protogen.Fie
 	g.P("        return nil")
 	g.P("    }")
 
+	if isWellKnownField(field) {
+		// Well-known types have no Raw type, decode the compact encoding
+		g.P(fmt.Sprintf("    v := &%s{}", g.QualifiedGoIdent(field.Message.GoIdent)))
+		g.P(fmt.Sprintf("    if err := %s; err != nil {", nestedUnmarshalCall(g, field, "v", "m[payloadOffset+4 : payloadOffset+4+nestedSize]")))
+		g.P("        return nil")
+		g.P("    }")
+		g.P("    return v")
+		return
+	}
+
 	// Return zero-copy slice of the nested message data as Raw type
 	g.P(fmt.Sprintf("    return %s(m[payloadOffset+4 : payloadOffset+4+nestedSize])", rawType))
 }
@@ -1972,16 +3053,32 @@ func generateRawNestedFieldSetter(g *protogen.GeneratedFile, field *protogen.Fie
 	g.P("        oldNestedSize = int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset:]))")
 	g.P("    }")
 
-	// Calculate new nested message size (v is already Raw type, i.e., []byte)
-	g.P("    newNestedSize := len(v)")
-
-	// Check if we can update in-place
-	g.P("    if oldPayloadOffset > 0 && newNestedSize <= oldNestedSize {")
-	g.P("        // Update in-place (waste space)")
-	g.P("        binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(newNestedSize))")
-	g.P("        copy((*m)[oldPayloadOffset+4:], v)")
-	g.P("        return nil")
-	g.P("    }")
+	if isWellKnownField(field) {
+		// Well-known types are passed decoded; nil clears the field, which needs a remarshal
+		g.P("    if v != nil {")
+		g.P(fmt.Sprintf("        encoded, err := %s", nestedMarshalCall(g, field, "v")))
+		g.P("        if err != nil {")
+		g.P("            return fmt.Errorf(\"failed to marshal nested message: %w\", err)")
+		g.P("        }")
+		g.P("        if oldPayloadOffset > 0 && len(encoded) <= oldNestedSize {")
+		g.P("            // Update in-place (waste space)")
+		g.P("            binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(len(encoded)))")
+		g.P("            copy((*m)[oldPayloadOffset+4:], encoded)")
+		g.P("            return nil")
+		g.P("        }")
+		g.P("    }")
+	} else {
+		// Calculate new nested message size (v is already Raw type, i.e., []byte)
+		g.P("    newNestedSize := len(v)")
+
+		// Check if we can update in-place
+		g.P("    if oldPayloadOffset > 0 && newNestedSize <= oldNestedSize {")
+		g.P("        // Update in-place (waste space)")
+		g.P("        binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(newNestedSize))")
+		g.P("        copy((*m)[oldPayloadOffset+4:], v)")
+		g.P("        return nil")
+		g.P("    }")
+	}
 
 	// Need to remarshal
 	parentMsgType := msg.GoIdent.GoName
@@ -1994,31 +3091,24 @@ func generateRawNestedFieldSetter(g *protogen.GeneratedFile, field *protogen.Fie
 
 		// Calculate how many bytes the private table needs
 		_, privateFields := classifyFields(msg)
-		privateTableSize := 0
-		for _, field := range privateFields {
-			if isFixedLengthField(field) {
-				privateTableSize += getFieldSize(field)
-			} else {
-				privateTableSize += 4 // offset for variable/repeated/nested fields
-			}
-		}
+		privateTableSize := segmentTableSize(privateFields)
 
 		g.P(fmt.Sprintf("    privateTableSize := %d // bytes needed for empty private table", privateTableSize))
-		g.P("    fakeComplete := make([]byte, len(*m)+1+privateTableSize) // version byte + private table")
+		if checksums {
+			g.P(fmt.Sprintf("    fakeComplete := make([]byte, len(*m)+1+privateTableSize+%d) // version byte + private table + checksum", trailerSize()))
+		} else {
+			g.P("    fakeComplete := make([]byte, len(*m)+1+privateTableSize) // version byte + private table")
+		}
 		g.P("    copy(fakeComplete, *m)")
 		g.P("    // Update offsetToPrivate to point to the appended private segment")
 		g.P("    binary.LittleEndian.PutUint32(fakeComplete[1:5], uint32(len(*m)))")
 		g.P("    fakeComplete[len(*m)] = 0x01 // private segment version")
+		generateChecksumWrite(g, "fakeComplete")
 		g.P("    if err := temp.UnmarshalSymphony(fakeComplete); err != nil {")
 		g.P("        return fmt.Errorf(\"failed to unmarshal: %w\", err)")
 		g.P("    }")
 		// Update the field - need to convert Raw to regular message type
-		g.P(fmt.Sprintf("    if temp.%s == nil {", goName))
-		g.P(fmt.Sprintf("        temp.%s = &%s{}", goName, msgType))
-		g.P("    }")
-		g.P(fmt.Sprintf("    if err := temp.%s.UnmarshalSymphony([]byte(v)); err != nil {", goName))
-		g.P("        return fmt.Errorf(\"failed to unmarshal nested message: %w\", err)")
-		g.P("    }")
+		generateRawNestedFieldUpdate(g, field, msgType)
 		// Marshal complete buffer
 		g.P("    fullData, err := temp.MarshalSymphony()")
 		g.P("    if err != nil {")
@@ -2036,12 +3126,7 @@ func generateRawNestedFieldSetter(g *protogen.GeneratedFile, field *protogen.Fie
 		g.P("        return fmt.Errorf(\"failed to unmarshal: %w\", err)")
 		g.P("    }")
 		// Update the field - need to convert Raw to regular message type
-		g.P(fmt.Sprintf("    if temp.%s == nil {", goName))
-		g.P(fmt.Sprintf("        temp.%s = &%s{}", goName, msgType))
-		g.P("    }")
-		g.P(fmt.Sprintf("    if err := temp.%s.UnmarshalSymphony([]byte(v)); err != nil {", goName))
-		g.P("        return fmt.Errorf(\"failed to unmarshal nested message: %w\", err)")
-		g.P("    }")
+		generateRawNestedFieldUpdate(g, field, msgType)
 		// Marshal again
 		g.P("    newData, err := temp.MarshalSymphony()")
 		g.P("    if err != nil {")
@@ -2052,6 +3137,21 @@ func generateRawNestedFieldSetter(g *protogen.GeneratedFile, field *protogen.Fie
 	}
 }
 
+// generateRawNestedFieldUpdate generates code that stores the setter argument v in temp
+func generateRawNestedFieldUpdate(g *protogen.GeneratedFile, field *protogen.Field, msgType string) {
+	goName := field.GoName
+	if isWellKnownField(field) {
+		g.P(fmt.Sprintf("    temp.%s = v", goName))
+		return
+	}
+	g.P(fmt.Sprintf("    if temp.%s == nil {", goName))
+	g.P(fmt.Sprintf("        temp.%s = &%s{}", goName, msgType))
+	g.P("    }")
+	g.P(fmt.Sprintf("    if err := temp.%s.UnmarshalSymphony([]byte(v)); err != nil {", goName))
+	g.P("        return fmt.Errorf(\"failed to unmarshal nested message: %w\", err)")
+	g.P("    }")
+}
+
 // generateRawRepeatedNestedFieldGetter generates code to read a repeated nested message field from Raw type
 func generateRawRepeatedNestedFieldGetter(g *protogen.GeneratedFile, field *protogen.Field, tableOffset int, isPublic bool) {
 	fieldNum := field.Desc.Number()
@@ -2090,8 +3190,12 @@ func generateRawRepeatedNestedFieldGetter(g *protogen.GeneratedFile, field *prot
 	g.P("    }")
 	g.P("    count := int(binary.LittleEndian.Uint32(m[payloadOffset:]))")
 
-	// Allocate slice of Raw types
-	g.P(fmt.Sprintf("    result := make([]%s, count)", rawType))
+	// Allocate slice of Raw types (well-known types are decoded instead)
+	if isWellKnownField(field) {
+		g.P(fmt.Sprintf("    result := make([]*%s, count)", g.QualifiedGoIdent(field.Message.GoIdent)))
+	} else {
+		g.P(fmt.Sprintf("    result := make([]%s, count)", rawType))
+	}
 
 	// Read each nested message as Raw type (zero-copy)
 	g.P("    currentOffset := payloadOffset + 4")
@@ -2103,7 +3207,14 @@ func generateRawRepeatedNestedFieldGetter(g *protogen.GeneratedFile, field *prot
 	g.P("        if len(m) < currentOffset+4+nestedSize {")
 	g.P("            return nil")
 	g.P("        }")
-	g.P(fmt.Sprintf("        result[i] = %s(m[currentOffset+4 : currentOffset+4+nestedSize])", rawType))
+	if isWellKnownField(field) {
+		g.P(fmt.Sprintf("        result[i] = &%s{}", g.QualifiedGoIdent(field.Message.GoIdent)))
+		g.P(fmt.Sprintf("        if err := %s; err != nil {", nestedUnmarshalCall(g, field, "result[i]", "m[currentOffset+4 : currentOffset+4+nestedSize]")))
+		g.P("            return nil")
+		g.P("        }")
+	} else {
+		g.P(fmt.Sprintf("        result[i] = %s(m[currentOffset+4 : currentOffset+4+nestedSize])", rawType))
+	}
 	g.P("        currentOffset += 4 + nestedSize")
 	g.P("    }")
 	g.P("    return result")
@@ -2157,16 +3268,33 @@ func generateRawRepeatedNestedFieldSetter(g *protogen.GeneratedFile, field *prot
 	// Calculate new count and total size
 	g.P("    newCount := len(v)")
 	g.P("    newDataSize := 4 // count")
-	g.P("    for _, item := range v {")
-	g.P("        newDataSize += 4 + len(item) // 4 bytes size + data")
-	g.P("    }")
+	if isWellKnownField(field) {
+		// Well-known types are passed decoded, encode them first
+		g.P("    encoded := make([][]byte, len(v))")
+		g.P("    for i, item := range v {")
+		g.P(fmt.Sprintf("        data, err := %s", nestedMarshalCall(g, field, "item")))
+		g.P("        if err != nil {")
+		g.P("            return fmt.Errorf(\"failed to marshal nested message: %w\", err)")
+		g.P("        }")
+		g.P("        encoded[i] = data")
+		g.P("        newDataSize += 4 + len(data) // 4 bytes size + data")
+		g.P("    }")
+	} else {
+		g.P("    for _, item := range v {")
+		g.P("        newDataSize += 4 + len(item) // 4 bytes size + data")
+		g.P("    }")
+	}
 
 	// Check if we can update in-place
 	g.P("    if oldPayloadOffset > 0 && newDataSize <= oldDataSize {")
 	g.P("        // Update in-place (waste space)")
 	g.P("        binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(newCount))")
 	g.P("        currentOffset := oldPayloadOffset + 4")
-	g.P("        for _, item := range v {")
+	if isWellKnownField(field) {
+		g.P("        for _, item := range encoded {")
+	} else {
+		g.P("        for _, item := range v {")
+	}
 	g.P("            itemSize := len(item)")
 	g.P("            binary.LittleEndian.PutUint32((*m)[currentOffset:], uint32(itemSize))")
 	g.P("            copy((*m)[currentOffset+4:], item)")
@@ -2188,32 +3316,24 @@ func generateRawRepeatedNestedFieldSetter(g *protogen.GeneratedFile, field *prot
 
 		// Calculate how many bytes the private table needs
 		_, privateFields := classifyFields(msg)
-		privateTableSize := 0
-		for _, field := range privateFields {
-			if isFixedLengthField(field) {
-				privateTableSize += getFieldSize(field)
-			} else {
-				privateTableSize += 4 // offset for variable/repeated/nested fields
-			}
-		}
+		privateTableSize := segmentTableSize(privateFields)
 
 		g.P(fmt.Sprintf("    privateTableSize := %d // bytes needed for empty private table", privateTableSize))
-		g.P("    fakeComplete := make([]byte, len(*m)+1+privateTableSize) // version byte + private table")
+		if checksums {
+			g.P(fmt.Sprintf("    fakeComplete := make([]byte, len(*m)+1+privateTableSize+%d) // version byte + private table + checksum", trailerSize()))
+		} else {
+			g.P("    fakeComplete := make([]byte, len(*m)+1+privateTableSize) // version byte + private table")
+		}
 		g.P("    copy(fakeComplete, *m)")
 		g.P("    // Update offsetToPrivate to point to the appended private segment")
 		g.P("    binary.LittleEndian.PutUint32(fakeComplete[1:5], uint32(len(*m)))")
 		g.P("    fakeComplete[len(*m)] = 0x01 // private segment version")
+		generateChecksumWrite(g, "fakeComplete")
 		g.P("    if err := temp.UnmarshalSymphony(fakeComplete); err != nil {")
 		g.P("        return fmt.Errorf(\"failed to unmarshal: %w\", err)")
 		g.P("    }")
 		// Update the field - convert Raw types to regular message types
-		g.P(fmt.Sprintf("    temp.%s = make([]*%s, len(v))", goName, nestedMsgType))
-		g.P("    for i, rawItem := range v {")
-		g.P(fmt.Sprintf("        temp.%s[i] = &%s{}", goName, nestedMsgType))
-		g.P(fmt.Sprintf("        if err := temp.%s[i].UnmarshalSymphony([]byte(rawItem)); err != nil {", goName))
-		g.P("            return fmt.Errorf(\"failed to unmarshal nested message: %w\", err)")
-		g.P("        }")
-		g.P("    }")
+		generateRawRepeatedNestedFieldUpdate(g, field, nestedMsgType)
 		// Marshal complete buffer
 		g.P("    fullData, err := temp.MarshalSymphony()")
 		g.P("    if err != nil {")
@@ -2231,13 +3351,7 @@ func generateRawRepeatedNestedFieldSetter(g *protogen.GeneratedFile, field *prot
 		g.P("        return fmt.Errorf(\"failed to unmarshal: %w\", err)")
 		g.P("    }")
 		// Update the field - convert Raw types to regular message types
-		g.P(fmt.Sprintf("    temp.%s = make([]*%s, len(v))", goName, nestedMsgType))
-		g.P("    for i, rawItem := range v {")
-		g.P(fmt.Sprintf("        temp.%s[i] = &%s{}", goName, nestedMsgType))
-		g.P(fmt.Sprintf("        if err := temp.%s[i].UnmarshalSymphony([]byte(rawItem)); err != nil {", goName))
-		g.P("            return fmt.Errorf(\"failed to unmarshal nested message: %w\", err)")
-		g.P("        }")
-		g.P("    }")
+		generateRawRepeatedNestedFieldUpdate(g, field, nestedMsgType)
 		// Marshal again
 		g.P("    newData, err := temp.MarshalSymphony()")
 		g.P("    if err != nil {")
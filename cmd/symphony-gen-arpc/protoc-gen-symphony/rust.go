@@ -0,0 +1,273 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// rustRuntime is the template of the symphony module of the generated Rust files: the
+// segment writers and readers of their messages
+//
+//go:embed rust_runtime.rs
+var rustRuntime string
+
+// rustKeywords are the Rust keywords a field name is escaped from: as a raw identifier, or
+// with a trailing underscore for those that cannot be raw
+var rustKeywords = []string{
+	"abstract", "as", "async", "await", "become", "box", "break", "const", "continue", "do",
+	"dyn", "else", "enum", "extern", "false", "final", "fn", "for", "gen", "if", "impl", "in",
+	"let", "loop", "macro", "match", "mod", "move", "mut", "override", "priv", "pub", "ref",
+	"return", "static", "struct", "trait", "true", "try", "type", "typeof", "unsafe",
+	"unsized", "use", "virtual", "where", "while", "yield",
+}
+
+// generateRustFile generates the .syn.rs file of a proto file: a self-contained Rust module
+// with a struct per Symphony message, implementing symphony::Message, and a module of
+// constants per enum. Include it with #[path = "<file>.syn.rs"] mod <name>;.
+func generateRustFile(plugin *protogen.Plugin, file *protogen.File) {
+	g := plugin.NewGeneratedFile(file.GeneratedFilenamePrefix+".syn.rs", "")
+	g.P("// Code generated by protoc-gen-symphony. DO NOT EDIT.")
+	g.P("// source: ", file.Desc.Path())
+	g.P()
+	g.P("pub mod symphony {")
+	g.P(strings.TrimRight(rustRuntime, "\n"))
+	g.P("}")
+
+	for _, enum := range file.Enums {
+		g.P()
+		g.P("/// Values of the ", enum.Desc.FullName(), " enum, whose fields are i32")
+		g.P("#[allow(non_snake_case)]")
+		g.P("pub mod ", enum.Desc.Name(), " {")
+		for _, value := range enum.Values {
+			g.P("    pub const ", value.Desc.Name(), ": i32 = ", value.Desc.Number(), ";")
+		}
+		g.P("}")
+	}
+
+	for _, msg := range file.Messages {
+		g.P()
+		if reason := rustUnsupportedReason(msg, map[*protogen.Message]bool{}); reason != "" {
+			g.P("// ", msg.Desc.FullName(), " has no Rust encoding: ", reason)
+			continue
+		}
+		generateRustMessage(g, msg)
+	}
+}
+
+// rustUnsupportedReason returns why no Rust encoding is generated for msg, or "" if one is.
+// Besides the messages without a Symphony encoding, the Rust runtime leaves out well-known
+// types and delta encoded and interned fields.
+func rustUnsupportedReason(msg *protogen.Message, visiting map[*protogen.Message]bool) string {
+	if reason := unsupportedReason(msg, map[*protogen.Message]bool{}); reason != "" {
+		return reason
+	}
+	if visiting[msg] {
+		return ""
+	}
+	visiting[msg] = true
+	defer delete(visiting, msg)
+
+	for _, field := range msg.Fields {
+		switch {
+		case isWellKnownField(field):
+			return fmt.Sprintf("field %s has type %s", field.Desc.Name(), field.Message.Desc.FullName())
+		case isDeltaEncodedField(field):
+			return fmt.Sprintf("field %s is delta encoded", field.Desc.Name())
+		case isInternedField(field):
+			return fmt.Sprintf("field %s is interned", field.Desc.Name())
+		case field.Message != nil:
+			if reason := rustUnsupportedReason(field.Message, visiting); reason != "" {
+				return fmt.Sprintf("field %s: %s", field.Desc.Name(), reason)
+			}
+		}
+	}
+	return ""
+}
+
+// generateRustMessage generates the struct of a message and its symphony::Message methods.
+// Both segments are written and read in declaration order, like the Go code does.
+func generateRustMessage(g *protogen.GeneratedFile, msg *protogen.Message) {
+	name := string(msg.Desc.Name())
+	publicFields, privateFields := classifyFields(msg)
+
+	g.P("/// ", msg.Desc.FullName())
+	g.P("#[derive(Clone, Debug, Default, PartialEq)]")
+	g.P("pub struct ", name, " {")
+	for _, field := range msg.Fields {
+		g.P("    pub ", rustFieldName(field), ": ", rustType(field), ",")
+	}
+	g.P("}")
+	g.P()
+
+	g.P("impl symphony::Message for ", name, " {")
+	g.P("    fn marshal_symphony(&self) -> Vec<u8> {")
+	for _, segment := range []struct {
+		name       string
+		tableStart string
+		fields     []*protogen.Field
+	}{
+		{"public", "symphony::HEADER_SIZE", publicFields},
+		{"private", "1", privateFields},
+	} {
+		mut := "mut "
+		if len(segment.fields) == 0 {
+			mut = ""
+		}
+		g.P("        let ", mut, segment.name, " = symphony::Writer::new(", segment.tableStart, ", ", segmentTableSize(segment.fields), ");")
+		for _, field := range segment.fields {
+			g.P("        ", segment.name, ".", rustWriteCall(field), ";")
+		}
+	}
+	g.P("        symphony::finish(public, private)")
+	g.P("    }")
+	g.P()
+
+	publicVar, privateVar := "_public", "_private"
+	if len(publicFields) > 0 {
+		publicVar = "mut public"
+	}
+	if len(privateFields) > 0 {
+		privateVar = "mut private"
+	}
+	g.P("    fn unmarshal_symphony(data: &[u8]) -> Result<Self, symphony::Error> {")
+	g.P("        let (", publicVar, ", ", privateVar, ") = symphony::segments(data)?;")
+	if len(msg.Fields) == 0 {
+		g.P("        Ok(", name, " {})")
+	} else {
+		g.P("        Ok(", name, " {")
+		for _, field := range msg.Fields {
+			segment := "private"
+			if isPublicField(field) {
+				segment = "public"
+			}
+			g.P("            ", rustFieldName(field), ": ", segment, ".", rustReadCall(field), ",")
+		}
+		g.P("        })")
+	}
+	g.P("    }")
+	g.P("}")
+}
+
+// rustType returns the Rust type of a field. Enums are i32, nested messages are optional and
+// boxed if they contain the message of the field.
+func rustType(field *protogen.Field) string {
+	var t string
+	switch field.Desc.Kind() {
+	case protoreflect.BoolKind:
+		t = "bool"
+	case protoreflect.Int32Kind, protoreflect.EnumKind:
+		t = "i32"
+	case protoreflect.Int64Kind:
+		t = "i64"
+	case protoreflect.Uint32Kind:
+		t = "u32"
+	case protoreflect.Uint64Kind:
+		t = "u64"
+	case protoreflect.FloatKind:
+		t = "f32"
+	case protoreflect.DoubleKind:
+		t = "f64"
+	case protoreflect.StringKind:
+		t = "String"
+	case protoreflect.BytesKind:
+		t = "Vec<u8>"
+	case protoreflect.MessageKind:
+		t = string(field.Message.Desc.Name())
+	}
+	switch {
+	case field.Desc.IsList():
+		return "Vec<" + t + ">"
+	case field.Message != nil && rustBoxed(field):
+		return "Option<Box<" + t + ">>"
+	case field.Message != nil:
+		return "Option<" + t + ">"
+	}
+	return t
+}
+
+// rustWriteCall returns the symphony::Writer call writing a field of self
+func rustWriteCall(field *protogen.Field) string {
+	value := "self." + rustFieldName(field)
+	switch {
+	case isFixedLengthField(field):
+		return "fixed(" + value + ")"
+	case isRepeatedFixedLengthField(field):
+		return "repeated(&" + value + ")"
+	case isNestedMessageField(field) && rustBoxed(field):
+		return "message(" + value + ".as_deref())"
+	case isNestedMessageField(field):
+		return "message(" + value + ".as_ref())"
+	case isRepeatedNestedMessageField(field):
+		return "messages(&" + value + ")"
+	case field.Desc.Kind() == protoreflect.StringKind && field.Desc.IsList():
+		return "strings(&" + value + ")"
+	case field.Desc.Kind() == protoreflect.StringKind:
+		return "string(&" + value + ")"
+	case field.Desc.IsList():
+		return "bytes_list(&" + value + ")"
+	}
+	return "bytes(&" + value + ")"
+}
+
+// rustReadCall returns the symphony::Reader call reading a field
+func rustReadCall(field *protogen.Field) string {
+	switch {
+	case isFixedLengthField(field):
+		return "fixed()?"
+	case isRepeatedFixedLengthField(field):
+		return "repeated()?"
+	case isNestedMessageField(field) && rustBoxed(field):
+		return "message()?.map(Box::new)"
+	case isNestedMessageField(field):
+		return "message()?"
+	case isRepeatedNestedMessageField(field):
+		return "messages()?"
+	case field.Desc.Kind() == protoreflect.StringKind && field.Desc.IsList():
+		return "strings()?"
+	case field.Desc.Kind() == protoreflect.StringKind:
+		return "string()?"
+	case field.Desc.IsList():
+		return "bytes_list()?"
+	}
+	return "bytes()?"
+}
+
+// rustBoxed reports whether a singular message field is boxed, because its message contains
+// the message of the field
+func rustBoxed(field *protogen.Field) bool {
+	return rustContains(field.Message, field.Parent, map[*protogen.Message]bool{})
+}
+
+// rustContains reports whether a message of type from holds a message of type target
+func rustContains(from, target *protogen.Message, seen map[*protogen.Message]bool) bool {
+	if from == target {
+		return true
+	}
+	if seen[from] {
+		return false
+	}
+	seen[from] = true
+	for _, field := range from.Fields {
+		if field.Message != nil && !field.Desc.IsList() && rustContains(field.Message, target, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// rustFieldName returns the Rust name of a field
+func rustFieldName(field *protogen.Field) string {
+	name := string(field.Desc.Name())
+	switch {
+	case name == "self" || name == "super" || name == "crate" || name == "Self":
+		return name + "_"
+	case slices.Contains(rustKeywords, name):
+		return "r#" + name
+	}
+	return name
+}
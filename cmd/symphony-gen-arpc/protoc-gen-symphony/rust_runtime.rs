@@ -0,0 +1,274 @@
+//! Runtime of the Rust code generated by protoc-gen-symphony with lang=rust: the segment
+//! writers and readers the generated marshal_symphony and unmarshal_symphony methods use.
+//!
+//! A message is its public segment, starting with the reserved header (version, offset to
+//! the private segment, service ID and method ID), then its private segment, starting with
+//! a version byte. Each segment holds a table, with fixed-length fields inline and the
+//! offset of the payload of other fields, then the payloads. Offsets are relative to the
+//! start of their segment; 0 is an absent field.
+
+#![allow(dead_code)]
+
+use std::fmt;
+
+/// Size of the reserved header of the public segment
+pub const HEADER_SIZE: usize = 13;
+
+/// Version byte of both segments
+pub const VERSION: u8 = 0x01;
+
+/// Error of unmarshal_symphony for malformed data
+#[derive(Clone, Debug, PartialEq, Eq)]
+pub struct Error(pub &'static str);
+
+impl fmt::Display for Error {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "symphony: {}", self.0)
+    }
+}
+
+impl std::error::Error for Error {}
+
+/// A message with a Symphony encoding
+pub trait Message: Sized {
+    /// Returns the Symphony encoding of the message, with service and method IDs 0
+    fn marshal_symphony(&self) -> Vec<u8>;
+
+    /// Decodes a message from its Symphony encoding
+    fn unmarshal_symphony(data: &[u8]) -> Result<Self, Error>;
+}
+
+/// A fixed-length field type, stored little-endian
+pub trait Fixed: Copy {
+    const SIZE: usize;
+    fn put(self, buf: &mut Vec<u8>);
+    fn get(b: &[u8]) -> Self;
+}
+
+impl Fixed for bool {
+    const SIZE: usize = 1;
+    fn put(self, buf: &mut Vec<u8>) {
+        buf.push(self as u8);
+    }
+    fn get(b: &[u8]) -> Self {
+        b[0] != 0
+    }
+}
+
+macro_rules! fixed_le {
+    ($($t:ty),*) => {$(
+        impl Fixed for $t {
+            const SIZE: usize = std::mem::size_of::<$t>();
+            fn put(self, buf: &mut Vec<u8>) {
+                buf.extend_from_slice(&self.to_le_bytes());
+            }
+            fn get(b: &[u8]) -> Self {
+                <$t>::from_le_bytes(b[..Self::SIZE].try_into().unwrap())
+            }
+        }
+    )*};
+}
+
+fixed_le!(i32, i64, u32, u64, f32, f64);
+
+/// Writes the table and payloads of a segment, in field declaration order
+pub struct Writer {
+    table: Vec<u8>,
+    payloads: Vec<u8>,
+    payload_start: usize,
+}
+
+impl Writer {
+    /// Returns a writer of a segment whose table of table_size bytes starts table_start bytes
+    /// into the segment
+    pub fn new(table_start: usize, table_size: usize) -> Self {
+        Writer { table: Vec::with_capacity(table_size), payloads: Vec::new(), payload_start: table_start + table_size }
+    }
+
+    fn offset(&mut self) {
+        let offset = (self.payload_start + self.payloads.len()) as u32;
+        offset.put(&mut self.table);
+    }
+
+    pub fn fixed<T: Fixed>(&mut self, v: T) {
+        v.put(&mut self.table);
+    }
+
+    pub fn string(&mut self, v: &str) {
+        self.bytes(v.as_bytes());
+    }
+
+    pub fn bytes(&mut self, v: &[u8]) {
+        self.offset();
+        (v.len() as u32).put(&mut self.payloads);
+        self.payloads.extend_from_slice(v);
+    }
+
+    pub fn repeated<T: Fixed>(&mut self, v: &[T]) {
+        self.offset();
+        (v.len() as u32).put(&mut self.payloads);
+        for &item in v {
+            item.put(&mut self.payloads);
+        }
+    }
+
+    pub fn strings(&mut self, v: &[String]) {
+        self.offset();
+        (v.len() as u32).put(&mut self.payloads);
+        for item in v {
+            (item.len() as u32).put(&mut self.payloads);
+            self.payloads.extend_from_slice(item.as_bytes());
+        }
+    }
+
+    pub fn bytes_list(&mut self, v: &[Vec<u8>]) {
+        self.offset();
+        (v.len() as u32).put(&mut self.payloads);
+        for item in v {
+            (item.len() as u32).put(&mut self.payloads);
+            self.payloads.extend_from_slice(item);
+        }
+    }
+
+    /// Writes a nested message, or offset 0 without payload if it is None
+    pub fn message<M: Message>(&mut self, v: Option<&M>) {
+        match v {
+            Some(m) => self.bytes(&m.marshal_symphony()),
+            None => 0u32.put(&mut self.table),
+        }
+    }
+
+    pub fn messages<M: Message>(&mut self, v: &[M]) {
+        self.offset();
+        (v.len() as u32).put(&mut self.payloads);
+        for item in v {
+            let data = item.marshal_symphony();
+            (data.len() as u32).put(&mut self.payloads);
+            self.payloads.extend_from_slice(&data);
+        }
+    }
+
+    fn len(&self) -> usize {
+        self.table.len() + self.payloads.len()
+    }
+}
+
+/// Returns the message of the public and private segments
+pub fn finish(public: Writer, private: Writer) -> Vec<u8> {
+    let public_size = HEADER_SIZE + public.len();
+    let mut buf = Vec::with_capacity(public_size + 1 + private.len());
+    buf.push(VERSION);
+    (public_size as u32).put(&mut buf);
+    buf.extend_from_slice(&[0; 8]); // service and method IDs
+    buf.extend_from_slice(&public.table);
+    buf.extend_from_slice(&public.payloads);
+    buf.push(VERSION);
+    buf.extend_from_slice(&private.table);
+    buf.extend_from_slice(&private.payloads);
+    buf
+}
+
+/// Reads the fields of a segment, in field declaration order
+pub struct Reader<'a> {
+    data: &'a [u8],
+    base: usize,
+    table: usize,
+}
+
+/// Returns the readers of the public and private segments of data
+pub fn segments(data: &[u8]) -> Result<(Reader<'_>, Reader<'_>), Error> {
+    if data.len() < HEADER_SIZE || data[0] != VERSION {
+        return Err(Error("invalid data: wrong public version"));
+    }
+    let private = u32::get(&data[1..]) as usize;
+    if private < HEADER_SIZE || private >= data.len() || data[private] != VERSION {
+        return Err(Error("missing private segment"));
+    }
+    Ok((Reader { data, base: 0, table: HEADER_SIZE }, Reader { data, base: private, table: private + 1 }))
+}
+
+impl<'a> Reader<'a> {
+    fn slice(&self, pos: usize, size: usize) -> Result<&'a [u8], Error> {
+        match pos.checked_add(size) {
+            Some(end) if end <= self.data.len() => Ok(&self.data[pos..end]),
+            _ => Err(Error("invalid data: too short for field")),
+        }
+    }
+
+    fn u32_at(&self, pos: usize) -> Result<usize, Error> {
+        Ok(u32::get(self.slice(pos, 4)?) as usize)
+    }
+
+    /// Returns the position of the payload of the next field, None if it is absent
+    fn payload(&mut self) -> Result<Option<usize>, Error> {
+        let offset = self.u32_at(self.table)?;
+        self.table += 4;
+        Ok(if offset == 0 { None } else { Some(self.base + offset) })
+    }
+
+    /// Returns a length-prefixed item at pos, and the position after it
+    fn item(&self, pos: usize) -> Result<(&'a [u8], usize), Error> {
+        let size = self.u32_at(pos)?;
+        Ok((self.slice(pos + 4, size)?, pos + 4 + size))
+    }
+
+    fn items(&mut self) -> Result<Vec<&'a [u8]>, Error> {
+        let Some(mut pos) = self.payload()? else { return Ok(Vec::new()) };
+        let count = self.u32_at(pos)?;
+        pos += 4;
+        let mut items = Vec::with_capacity(count.min(self.data.len()));
+        for _ in 0..count {
+            let (item, next) = self.item(pos)?;
+            items.push(item);
+            pos = next;
+        }
+        Ok(items)
+    }
+
+    pub fn fixed<T: Fixed>(&mut self) -> Result<T, Error> {
+        let v = T::get(self.slice(self.table, T::SIZE)?);
+        self.table += T::SIZE;
+        Ok(v)
+    }
+
+    pub fn string(&mut self) -> Result<String, Error> {
+        to_string(self.bytes()?)
+    }
+
+    pub fn bytes(&mut self) -> Result<Vec<u8>, Error> {
+        match self.payload()? {
+            Some(pos) => Ok(self.item(pos)?.0.to_vec()),
+            None => Ok(Vec::new()),
+        }
+    }
+
+    pub fn repeated<T: Fixed>(&mut self) -> Result<Vec<T>, Error> {
+        let Some(pos) = self.payload()? else { return Ok(Vec::new()) };
+        let count = self.u32_at(pos)?;
+        let values = self.slice(pos + 4, count.checked_mul(T::SIZE).ok_or(Error("invalid data: too short for field"))?)?;
+        Ok(values.chunks_exact(T::SIZE).map(T::get).collect())
+    }
+
+    pub fn strings(&mut self) -> Result<Vec<String>, Error> {
+        self.items()?.into_iter().map(|item| to_string(item.to_vec())).collect()
+    }
+
+    pub fn bytes_list(&mut self) -> Result<Vec<Vec<u8>>, Error> {
+        Ok(self.items()?.into_iter().map(|item| item.to_vec()).collect())
+    }
+
+    pub fn message<M: Message>(&mut self) -> Result<Option<M>, Error> {
+        match self.payload()? {
+            Some(pos) => Ok(Some(M::unmarshal_symphony(self.item(pos)?.0)?)),
+            None => Ok(None),
+        }
+    }
+
+    pub fn messages<M: Message>(&mut self) -> Result<Vec<M>, Error> {
+        self.items()?.into_iter().map(M::unmarshal_symphony).collect()
+    }
+}
+
+fn to_string(data: Vec<u8>) -> Result<String, Error> {
+    String::from_utf8(data).map_err(|_| Error("invalid data: string is not UTF-8"))
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// conformanceVector is a message of test.proto, in the protobuf JSON format, and its
+// Symphony encoding in hex (see test/testdata/conformance.json)
+type conformanceVector struct {
+	Message  string          `json:"message"`
+	JSON     json.RawMessage `json:"json"`
+	Symphony string          `json:"symphony"`
+}
+
+func TestRustFile(t *testing.T) {
+	plugin := newTestPlugin(t, nil)
+	generateRustFile(plugin, plugin.Files[len(plugin.Files)-1])
+	resp := plugin.Response()
+	if len(resp.File) != 1 || resp.File[0].GetName() != "test.syn.rs" {
+		t.Fatalf("Expected test.syn.rs, got %v", resp.File)
+	}
+	content := resp.File[0].GetContent()
+	for _, want := range []string{
+		"pub struct ComplexMixed {",
+		"    pub nested_leaf: Option<Leaf>,",
+		"    pub repeated_nested: Vec<Root>,",
+		"        let mut public = symphony::Writer::new(symphony::HEADER_SIZE, 13);",
+		"// Test.Labels has no Rust encoding: field values is a map",
+		"// Test.WellKnown has no Rust encoding: field created has type google.protobuf.Timestamp",
+		"// Test.Deltas has no Rust encoding: field timestamps is delta encoded",
+		"// Test.Catalog has no Rust encoding: field region is interned",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("Expected generated Rust to contain %q", want)
+		}
+	}
+
+	// Messages holding messages of their own type are boxed
+	addParent := func(fd *descriptorpb.FileDescriptorProto) {
+		for _, msg := range fd.MessageType {
+			if msg.GetName() == "Root" {
+				msg.Field = append(msg.Field, &descriptorpb.FieldDescriptorProto{
+					Name:     proto.String("parent"),
+					JsonName: proto.String("parent"),
+					Number:   proto.Int32(3),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+					TypeName: proto.String(".Test.Root"),
+				})
+			}
+		}
+	}
+	plugin = newTestPlugin(t, addParent)
+	generateRustFile(plugin, plugin.Files[len(plugin.Files)-1])
+	content = plugin.Response().File[0].GetContent()
+	for _, want := range []string{
+		"    pub parent: Option<Box<Root>>,",
+		"        private.message(self.parent.as_deref());",
+		"            parent: private.message()?.map(Box::new),",
+		"    pub l1: Option<Level1>,",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("Expected generated Rust to contain %q", want)
+		}
+	}
+}
+
+// The generated Rust decodes the conformance vectors of the Go messages, and encodes them
+// back byte for byte
+func TestRustConformance(t *testing.T) {
+	rustc, err := exec.LookPath("rustc")
+	if err != nil {
+		t.Skip("rustc not found")
+	}
+	data, err := os.ReadFile("../test/testdata/conformance.json")
+	if err != nil {
+		t.Fatalf("Failed to read vectors: %v", err)
+	}
+	var vectors []conformanceVector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatalf("Failed to parse vectors: %v", err)
+	}
+
+	dir := t.TempDir()
+	plugin := newTestPlugin(t, nil)
+	generateRustFile(plugin, plugin.Files[len(plugin.Files)-1])
+	for _, file := range plugin.Response().File {
+		if err := os.WriteFile(filepath.Join(dir, file.GetName()), []byte(file.GetContent()), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", file.GetName(), err)
+		}
+	}
+
+	// vectors.rs checks each vector against the Rust literal of its message
+	var b strings.Builder
+	b.WriteString("fn vectors(failures: &mut usize) {\n")
+	for i, v := range vectors {
+		mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName("Test." + v.Message))
+		if err != nil {
+			t.Fatalf("Vector %d: %v", i, err)
+		}
+		msg := mt.New().Interface()
+		if err := protojson.Unmarshal(v.JSON, msg); err != nil {
+			t.Fatalf("Vector %d: failed to parse %s: %v", i, v.Message, err)
+		}
+		fmt.Fprintf(&b, "    check(%d, %q, %s, failures);\n", i, v.Symphony, rustLiteral(msg.ProtoReflect()))
+	}
+	b.WriteString("}\n")
+	harness, err := os.ReadFile("testdata/conformance.rs")
+	if err != nil {
+		t.Fatalf("Failed to read conformance.rs: %v", err)
+	}
+	for name, content := range map[string]string{"vectors.rs": b.String(), "conformance.rs": string(harness)} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	bin := filepath.Join(dir, "conformance")
+	if out, err := exec.Command(rustc, "--edition", "2021", "-o", bin, filepath.Join(dir, "conformance.rs")).CombinedOutput(); err != nil {
+		t.Fatalf("rustc failed: %v\n%s", err, out)
+	}
+	if out, err := exec.Command(bin).CombinedOutput(); err != nil {
+		t.Fatalf("Conformance check failed: %v\n%s", err, out)
+	}
+}
+
+// rustLiteral returns the Rust expression of the generated struct holding m
+func rustLiteral(m protoreflect.Message) string {
+	var fields []string
+	fds := m.Descriptor().Fields()
+	for i := 0; i < fds.Len(); i++ {
+		fd := fds.Get(i)
+		if !m.Has(fd) {
+			continue
+		}
+		var value string
+		switch {
+		case fd.IsList():
+			list := m.Get(fd).List()
+			items := make([]string, list.Len())
+			for j := range items {
+				items[j] = rustValue(fd, list.Get(j))
+			}
+			value = "vec![" + strings.Join(items, ", ") + "]"
+		case fd.Message() != nil:
+			value = "Some(" + rustValue(fd, m.Get(fd)) + ")"
+		default:
+			value = rustValue(fd, m.Get(fd))
+		}
+		fields = append(fields, string(fd.Name())+": "+value)
+	}
+	return string(m.Descriptor().Name()) + " { " + strings.Join(append(fields, "..Default::default()"), ", ") + " }"
+}
+
+// rustValue returns the Rust expression of a single value of field fd
+func rustValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch fd.Kind() {
+	case protoreflect.MessageKind:
+		return rustLiteral(v.Message())
+	case protoreflect.StringKind:
+		var s strings.Builder
+		for _, r := range v.String() {
+			if r >= ' ' && r <= '~' && r != '"' && r != '\\' {
+				s.WriteRune(r)
+			} else {
+				fmt.Fprintf(&s, `\u{%x}`, r)
+			}
+		}
+		return `String::from("` + s.String() + `")`
+	case protoreflect.BytesKind:
+		var s strings.Builder
+		for _, c := range v.Bytes() {
+			fmt.Fprintf(&s, `\x%02x`, c)
+		}
+		return `b"` + s.String() + `".to_vec()`
+	case protoreflect.FloatKind:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32) + "f32"
+	case protoreflect.DoubleKind:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64) + "f64"
+	case protoreflect.Int32Kind, protoreflect.Int64Kind:
+		return strconv.FormatInt(v.Int(), 10)
+	case protoreflect.Uint32Kind, protoreflect.Uint64Kind:
+		return strconv.FormatUint(v.Uint(), 10)
+	case protoreflect.EnumKind:
+		return strconv.Itoa(int(v.Enum()))
+	}
+	return v.String() // bool
+}
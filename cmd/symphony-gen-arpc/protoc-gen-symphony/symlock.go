@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+// Lock modes, selected with the symlock plugin parameter
+const (
+	symlockVerify = "verify" // default: fail if the layout differs from the lock file
+	symlockUpdate = "update" // rewrite the lock file with the current layout
+	symlockOff    = "off"    // neither verify nor write lock files
+)
+
+// generateLockFile pins the public-segment layout of the Symphony messages of a file in
+// <prefix>.symlock. Proxies read public fields at fixed table offsets, so a layout that
+// shifts (e.g. because a field was added in the middle) silently breaks every deployed
+// element. If a lock file exists in lockDir, the current layout has to match it unless
+// mode is symlockUpdate.
+func generateLockFile(plugin *protogen.Plugin, file *protogen.File, mode, lockDir string) error {
+	if mode == symlockOff {
+		return nil
+	}
+	filename := file.GeneratedFilenamePrefix + ".symlock"
+	lock := lockFileContent(file)
+
+	if mode != symlockUpdate {
+		existing, err := os.ReadFile(filepath.Join(lockDir, filename))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			// First run: create the lock file
+		case err != nil:
+			return fmt.Errorf("failed to read lock file: %w", err)
+		default:
+			if diff := diffLockFiles(string(existing), lock); diff != "" {
+				return fmt.Errorf("public-segment layout of %s differs from %s:\n%s"+
+					"Declare new public fields after the existing ones, or pass symlock=update if the change is intentional",
+					file.Desc.Path(), filename, diff)
+			}
+		}
+	}
+
+	g := plugin.NewGeneratedFile(filename, "")
+	g.P(lock)
+	return nil
+}
+
+// lockFileContent renders the public table of each Symphony message, one field per line:
+// table offset, slot size, name and type
+func lockFileContent(file *protogen.File) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Code generated by protoc-gen-symphony. DO NOT EDIT.\n")
+	fmt.Fprintf(&b, "# Public-segment layout of the Symphony messages in %s.\n", file.Desc.Path())
+	fmt.Fprintf(&b, "# Regenerate with symlock=update after an intentional layout change.\n")
+
+	for _, msg := range file.Messages {
+		if unsupportedReason(msg, map[*protogen.Message]bool{}) != "" {
+			continue
+		}
+		publicFields, _ := classifyFields(msg)
+		offsets := calculateFieldOffsets(publicFields, 13)
+
+		fmt.Fprintf(&b, "\nmessage %s\n", msg.Desc.FullName())
+		end := 13
+		if hasInternedFields(publicFields) {
+			fmt.Fprintf(&b, "  13 4 (string dictionary)\n")
+			end = 17
+		}
+		for _, field := range publicFields {
+			size := 4
+			if isFixedLengthField(field) {
+				size = getFieldSize(field)
+			}
+			fmt.Fprintf(&b, "  %d %d %s %s\n", offsets[field], size, field.Desc.Name(), lockFieldType(field))
+			end = offsets[field] + size
+		}
+		fmt.Fprintf(&b, "  end %d\n", end)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func lockFieldType(field *protogen.Field) string {
+	name := field.Desc.Kind().String()
+	if field.Message != nil {
+		name = string(field.Message.Desc.FullName())
+	} else if field.Enum != nil {
+		name = string(field.Enum.Desc.FullName())
+	}
+	if field.Desc.IsList() {
+		name = "repeated " + name
+	}
+	if isDeltaEncodedField(field) {
+		name += " delta"
+	}
+	if isInternedField(field) {
+		name += " interned"
+	}
+	return name
+}
+
+// diffLockFiles returns the messages whose layout differs between two lock files, with the
+// old lines prefixed by "-" and the new ones by "+". Comments are ignored.
+func diffLockFiles(oldLock, newLock string) string {
+	oldMsgs, oldOrder := parseLockFile(oldLock)
+	newMsgs, newOrder := parseLockFile(newLock)
+
+	var b strings.Builder
+	seen := make(map[string]bool)
+	for _, name := range append(oldOrder, newOrder...) {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		oldLines, newLines := oldMsgs[name], newMsgs[name]
+		if strings.Join(oldLines, "\n") == strings.Join(newLines, "\n") {
+			continue
+		}
+		fmt.Fprintf(&b, "  message %s\n", name)
+		for _, l := range oldLines {
+			fmt.Fprintf(&b, "  - %s\n", l)
+		}
+		for _, l := range newLines {
+			fmt.Fprintf(&b, "  + %s\n", l)
+		}
+	}
+	return b.String()
+}
+
+// parseLockFile returns the layout lines of each message and the message names in file order
+func parseLockFile(lock string) (map[string][]string, []string) {
+	msgs := make(map[string][]string)
+	var order []string
+	var current string
+	for _, line := range strings.Split(lock, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "message "):
+			current = strings.TrimPrefix(line, "message ")
+			order = append(order, current)
+			msgs[current] = []string{}
+		case current != "":
+			msgs[current] = append(msgs[current], line)
+		}
+	}
+	return msgs, order
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	Test "github.com/appnet-org/arpc/cmd/symphony-gen-arpc/test"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// newTestPlugin returns a plugin generating test.proto, after applying edit to its descriptor
+func newTestPlugin(t *testing.T, edit func(*descriptorpb.FileDescriptorProto)) *protogen.Plugin {
+	t.Helper()
+	fd := protodesc.ToFileDescriptorProto(Test.File_test_proto)
+	if edit != nil {
+		edit(fd)
+	}
+	var files []*descriptorpb.FileDescriptorProto
+	for _, dep := range []protoreflect.FileDescriptor{
+		descriptorpb.File_google_protobuf_descriptor_proto,
+		anypb.File_google_protobuf_any_proto,
+		durationpb.File_google_protobuf_duration_proto,
+		structpb.File_google_protobuf_struct_proto,
+		timestamppb.File_google_protobuf_timestamp_proto,
+		wrapperspb.File_google_protobuf_wrappers_proto,
+	} {
+		files = append(files, protodesc.ToFileDescriptorProto(dep))
+	}
+	in, err := proto.Marshal(&pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{fd.GetName()},
+		Parameter:      proto.String("paths=source_relative"),
+		ProtoFile:      append(files, fd),
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+
+	// Decode the request the way protoc-gen-symphony sees it, without the Test extensions
+	// linked in, so that the is_public options stay unknown fields
+	req := &pluginpb.CodeGeneratorRequest{}
+	if err := (proto.UnmarshalOptions{Resolver: new(protoregistry.Types)}).Unmarshal(in, req); err != nil {
+		t.Fatalf("Failed to unmarshal request: %v", err)
+	}
+	plugin, err := protogen.Options{}.New(req)
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+	return plugin
+}
+
+func TestLockFile(t *testing.T) {
+	// The committed lock file matches the current layout
+	plugin := newTestPlugin(t, nil)
+	if err := generateLockFile(plugin, plugin.Files[len(plugin.Files)-1], symlockVerify, "../test"); err != nil {
+		t.Fatalf("Verification against test.symlock failed: %v", err)
+	}
+
+	// Adding a public field in the middle of Test.Fixed shifts the fields after it
+	insertField := func(fd *descriptorpb.FileDescriptorProto) {
+		for _, msg := range fd.MessageType {
+			if msg.GetName() == "Fixed" {
+				field := proto.Clone(msg.Field[0]).(*descriptorpb.FieldDescriptorProto)
+				field.Name, field.JsonName, field.Number = proto.String("f_new"), proto.String("fNew"), proto.Int32(100)
+				msg.Field = append([]*descriptorpb.FieldDescriptorProto{field}, msg.Field...)
+			}
+		}
+	}
+	plugin = newTestPlugin(t, insertField)
+	file := plugin.Files[len(plugin.Files)-1]
+	err := generateLockFile(plugin, file, symlockVerify, "../test")
+	if err == nil {
+		t.Fatal("Expected verification to fail")
+	}
+	for _, want := range []string{"message Test.Fixed", "- 13 4 f_int32 int32", "+ 13 4 f_new int32", "+ 17 4 f_int32 int32"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected diff to contain %q, got:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "Test.Var") {
+		t.Errorf("Expected unchanged messages to be left out of the diff, got:\n%v", err)
+	}
+
+	// symlock=update writes the new layout instead
+	if err := generateLockFile(plugin, file, symlockUpdate, "../test"); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	resp := plugin.Response()
+	if len(resp.File) != 1 || !strings.Contains(resp.File[0].GetContent(), "13 4 f_new int32") {
+		t.Errorf("Expected updated lock file, got %v", resp.File)
+	}
+
+	// Without an existing lock file, a new one is created
+	dir := t.TempDir()
+	if err := generateLockFile(plugin, file, symlockVerify, dir); err != nil {
+		t.Fatalf("Creating lock file failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "test.symlock")); err == nil {
+		t.Error("Expected the lock file to be returned to protoc, not written directly")
+	}
+}
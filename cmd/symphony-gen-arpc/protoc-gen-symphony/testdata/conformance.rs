@@ -0,0 +1,54 @@
+//! Checks the Rust code protoc-gen-symphony generates for test.proto against the
+//! conformance vectors of the Go messages (see TestRustConformance). vectors.rs, written
+//! by the test, calls check with each vector and the message it holds.
+
+#[path = "test.syn.rs"]
+mod test_syn;
+
+use std::fmt::Debug;
+use test_syn::symphony::Message;
+use test_syn::*;
+
+fn from_hex(s: &str) -> Vec<u8> {
+    (0..s.len()).step_by(2).map(|i| u8::from_str_radix(&s[i..i + 2], 16).unwrap()).collect()
+}
+
+fn to_hex(data: &[u8]) -> String {
+    data.iter().map(|b| format!("{:02x}", b)).collect()
+}
+
+fn check<M: Message + PartialEq + Debug>(i: usize, encoded: &str, want: M, failures: &mut usize) {
+    let data = from_hex(encoded);
+    match M::unmarshal_symphony(&data) {
+        Ok(got) if got == want => {}
+        Ok(got) => {
+            eprintln!("vector {}: decoded {:?}, expected {:?}", i, got, want);
+            *failures += 1;
+        }
+        Err(err) => {
+            eprintln!("vector {}: {}", i, err);
+            *failures += 1;
+        }
+    }
+    let got = want.marshal_symphony();
+    if got != data {
+        eprintln!("vector {}: encoded {}, expected {}", i, to_hex(&got), encoded);
+        *failures += 1;
+    }
+
+    // Truncated data is rejected
+    if M::unmarshal_symphony(&data[..data.len() - 3]).is_ok() {
+        eprintln!("vector {}: decoding truncated data succeeded", i);
+        *failures += 1;
+    }
+}
+
+include!("vectors.rs");
+
+fn main() {
+    let mut failures = 0;
+    vectors(&mut failures);
+    if failures > 0 {
+        std::process::exit(1);
+    }
+}
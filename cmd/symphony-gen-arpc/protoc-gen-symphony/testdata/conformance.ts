@@ -0,0 +1,80 @@
+// Checks the TypeScript decoders protoc-gen-symphony generates for test.proto against the
+// conformance vectors of the Go messages (see TestTypeScriptConformance). vectors.ts, written
+// by the test, lists each vector with the public fields the message holds.
+
+import { decoders, readSymphonyHeader, SymphonyError } from "./test.syn.ts";
+import { vectors } from "./vectors.ts";
+
+function fromHex(s: string): Uint8Array {
+  const data = new Uint8Array(s.length / 2);
+  for (let i = 0; i < data.length; i++) {
+    data[i] = parseInt(s.slice(2 * i, 2 * i + 2), 16);
+  }
+  return data;
+}
+
+// canonical returns the JSON of a decoded value, with sorted keys, undefined fields left out,
+// bigints and bytes as strings
+function canonical(v: unknown): string {
+  return JSON.stringify(v, function (this: unknown, _key: string, value: unknown) {
+    if (typeof value === "bigint") {
+      return value.toString() + "n";
+    }
+    if (typeof value === "number" && !Number.isFinite(value)) {
+      return String(value);
+    }
+    if (value instanceof Uint8Array) {
+      return "0x" + Array.from(value, (b) => b.toString(16).padStart(2, "0")).join("");
+    }
+    if (value !== null && typeof value === "object" && !Array.isArray(value)) {
+      const sorted: Record<string, unknown> = {};
+      for (const k of Object.keys(value).sort()) {
+        sorted[k] = (value as Record<string, unknown>)[k];
+      }
+      return sorted;
+    }
+    return value;
+  });
+}
+
+let failures = 0;
+vectors.forEach((v, i) => {
+  const decode = decoders[v.message];
+  if (decode === undefined) {
+    console.error(`vector ${i}: no decoder of ${v.message}`);
+    failures++;
+    return;
+  }
+  const data = fromHex(v.symphony);
+  const want = canonical(v.want);
+  // Proxies record the public segment only
+  const publicSegment = data.subarray(0, readSymphonyHeader(data).privateOffset);
+  for (const [name, input] of [["message", data], ["public segment", publicSegment]] as const) {
+    try {
+      const got = canonical(decode(input));
+      if (got !== want) {
+        console.error(`vector ${i}: ${name} decoded ${got}, expected ${want}`);
+        failures++;
+      }
+    } catch (err) {
+      console.error(`vector ${i}: ${name}: ${err}`);
+      failures++;
+    }
+  }
+
+  // A truncated public segment is rejected
+  try {
+    decode(publicSegment.subarray(0, publicSegment.length - 1));
+    console.error(`vector ${i}: decoding a truncated public segment succeeded`);
+    failures++;
+  } catch (err) {
+    if (!(err instanceof SymphonyError)) {
+      console.error(`vector ${i}: truncated public segment: unexpected ${err}`);
+      failures++;
+    }
+  }
+});
+
+if (failures > 0) {
+  process.exit(1);
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// typescriptRuntime is the runtime at the top of the generated TypeScript files: the reader
+// of the public segment of their messages
+//
+//go:embed typescript_runtime.ts
+var typescriptRuntime string
+
+// typescriptWellKnown are the TypeScript types of the well-known types, and the runtime
+// functions decoding them
+var typescriptWellKnown = map[protoreflect.FullName]struct{ typ, decode string }{
+	"google.protobuf.Timestamp":   {"SymphonySeconds", "symphonySeconds"},
+	"google.protobuf.Duration":    {"SymphonySeconds", "symphonySeconds"},
+	"google.protobuf.Any":         {"SymphonyAny", "symphonyAny"},
+	"google.protobuf.Struct":      {"Uint8Array", "symphonyBytesValue"},
+	"google.protobuf.Value":       {"Uint8Array", "symphonyBytesValue"},
+	"google.protobuf.ListValue":   {"Uint8Array", "symphonyBytesValue"},
+	"google.protobuf.Empty":       {"Record<string, never>", "symphonyEmpty"},
+	"google.protobuf.BoolValue":   {"boolean", "symphonyBoolValue"},
+	"google.protobuf.Int32Value":  {"number", "symphonyInt32Value"},
+	"google.protobuf.UInt32Value": {"number", "symphonyUInt32Value"},
+	"google.protobuf.FloatValue":  {"number", "symphonyFloatValue"},
+	"google.protobuf.Int64Value":  {"bigint", "symphonyInt64Value"},
+	"google.protobuf.UInt64Value": {"bigint", "symphonyUInt64Value"},
+	"google.protobuf.DoubleValue": {"number", "symphonyDoubleValue"},
+	"google.protobuf.StringValue": {"string", "symphonyStringValue"},
+	"google.protobuf.BytesValue":  {"Uint8Array", "symphonyBytesValue"},
+}
+
+// generateTypeScriptFile generates the .syn.ts file of a proto file: a self-contained
+// TypeScript module with an interface of the public fields of each Symphony message and the
+// function decoding them, a const object per enum, and a decoders map by full name, for
+// dashboards rendering recorded payloads without a Go backend. Private fields are left out:
+// their segment is encrypted or missing in what proxies see.
+func generateTypeScriptFile(plugin *protogen.Plugin, file *protogen.File) {
+	g := plugin.NewGeneratedFile(file.GeneratedFilenamePrefix+".syn.ts", "")
+	g.P("// Code generated by protoc-gen-symphony. DO NOT EDIT.")
+	g.P("// source: ", file.Desc.Path())
+	g.P()
+	g.P(strings.TrimRight(typescriptRuntime, "\n"))
+
+	for _, enum := range file.Enums {
+		g.P()
+		g.P("/** Values of the ", enum.Desc.FullName(), " enum, whose fields are numbers */")
+		g.P("export const ", enum.Desc.Name(), " = {")
+		for _, value := range enum.Values {
+			g.P("  ", value.Desc.Name(), ": ", value.Desc.Number(), ",")
+		}
+		g.P("} as const;")
+	}
+
+	var decoded []*protogen.Message
+	for _, msg := range file.Messages {
+		g.P()
+		if reason := unsupportedReason(msg, map[*protogen.Message]bool{}); reason != "" {
+			g.P("// ", msg.Desc.FullName(), " has no Symphony encoding: ", reason)
+			continue
+		}
+		generateTypeScriptMessage(g, msg)
+		decoded = append(decoded, msg)
+	}
+
+	g.P()
+	g.P("/** Decoders of the public fields of the messages of ", file.Desc.Path(), ", by full name */")
+	g.P("export const decoders: Record<string, (data: Uint8Array) => unknown> = {")
+	for _, msg := range decoded {
+		g.P("  \"", msg.Desc.FullName(), "\": decode", msg.Desc.Name(), ",")
+	}
+	g.P("};")
+}
+
+// generateTypeScriptMessage generates the interface of the public fields of a message and
+// its decode function, which reads them in declaration order, like the Go code does
+func generateTypeScriptMessage(g *protogen.GeneratedFile, msg *protogen.Message) {
+	name := string(msg.Desc.Name())
+	publicFields, _ := classifyFields(msg)
+
+	g.P("/** Public fields of ", msg.Desc.FullName(), " */")
+	if len(publicFields) == 0 {
+		g.P("export type ", name, " = Record<string, never>;")
+	} else {
+		g.P("export interface ", name, " {")
+		for _, field := range publicFields {
+			optional, typ := typescriptType(field)
+			if isSensitiveField(field) {
+				optional, typ = "?", "typeof SYMPHONY_REDACTED"
+			}
+			g.P("  ", field.Desc.Name(), optional, ": ", typ, ";")
+		}
+		g.P("}")
+	}
+	g.P()
+
+	g.P("/** Decodes the public fields of a ", msg.Desc.FullName(), " message, whose private segment may be missing */")
+	g.P("export function decode", name, "(data: Uint8Array): ", name, " {")
+	if len(publicFields) == 0 {
+		g.P("  readSymphonyHeader(data);")
+		g.P("  return {};")
+	} else {
+		g.P("  const r = new SymphonyReader(data, ", hasInternedFields(publicFields), ");")
+		g.P("  return {")
+		for _, field := range publicFields {
+			read := "r." + typescriptReadCall(field)
+			if isSensitiveField(field) {
+				read = "redacted(" + read + ")"
+			}
+			g.P("    ", field.Desc.Name(), ": ", read, ",")
+		}
+		g.P("  };")
+	}
+	g.P("}")
+}
+
+// typescriptType returns the TypeScript type of a field, and "?" for fields that are
+// undefined when unset: nested messages and well-known types. Enums are numbers, 64-bit
+// integers bigints.
+func typescriptType(field *protogen.Field) (optional, typ string) {
+	switch field.Desc.Kind() {
+	case protoreflect.BoolKind:
+		typ = "boolean"
+	case protoreflect.Int64Kind, protoreflect.Uint64Kind:
+		typ = "bigint"
+	case protoreflect.StringKind:
+		typ = "string"
+	case protoreflect.BytesKind:
+		typ = "Uint8Array"
+	case protoreflect.MessageKind:
+		if wellKnown, ok := typescriptWellKnown[field.Message.Desc.FullName()]; ok {
+			typ = wellKnown.typ
+		} else {
+			typ = string(field.Message.Desc.Name())
+		}
+	default:
+		typ = "number"
+	}
+	switch {
+	case field.Desc.IsList():
+		if strings.Contains(typ, " ") {
+			return "", "(" + typ + ")[]"
+		}
+		return "", typ + "[]"
+	case field.Message != nil:
+		return "?", typ
+	}
+	return "", typ
+}
+
+// typescriptReadCall returns the SymphonyReader call reading a field
+func typescriptReadCall(field *protogen.Field) string {
+	kind := field.Desc.Kind()
+	switch {
+	case field.Message != nil:
+		decode := "decode" + string(field.Message.Desc.Name())
+		if wellKnown, ok := typescriptWellKnown[field.Message.Desc.FullName()]; ok {
+			decode = wellKnown.decode
+		}
+		if field.Desc.IsList() {
+			return "messages(" + decode + ")"
+		}
+		return "message(" + decode + ")"
+	case isInternedField(field) && field.Desc.IsList():
+		return "internedList()"
+	case isInternedField(field):
+		return "interned()"
+	case isDeltaEncodedField(field):
+		return "delta" + typescriptKindName(kind) + "s()"
+	case kind == protoreflect.BytesKind && field.Desc.IsList():
+		return "bytesList()"
+	case field.Desc.IsList():
+		return strings.ToLower(typescriptKindName(kind)[:1]) + typescriptKindName(kind)[1:] + "s()"
+	}
+	return strings.ToLower(typescriptKindName(kind)[:1]) + typescriptKindName(kind)[1:] + "()"
+}
+
+// typescriptKindName returns the name of a scalar kind in the SymphonyReader methods
+func typescriptKindName(kind protoreflect.Kind) string {
+	switch kind {
+	case protoreflect.BoolKind:
+		return "Bool"
+	case protoreflect.Int32Kind, protoreflect.EnumKind:
+		return "Int32"
+	case protoreflect.Int64Kind:
+		return "Int64"
+	case protoreflect.Uint32Kind:
+		return "Uint32"
+	case protoreflect.Uint64Kind:
+		return "Uint64"
+	case protoreflect.FloatKind:
+		return "Float"
+	case protoreflect.DoubleKind:
+		return "Double"
+	case protoreflect.StringKind:
+		return "String"
+	case protoreflect.BytesKind:
+		return "Bytes"
+	}
+	panic(fmt.Sprintf("unexpected kind %s", kind))
+}
@@ -0,0 +1,372 @@
+// Runtime of the TypeScript code generated by protoc-gen-symphony with lang=typescript: the
+// reader of the public segment the generated decode functions use.
+//
+// A message is its public segment, starting with the reserved header (version, offset to
+// the private segment, service ID and method ID), then its private segment. The public
+// segment holds a table, with fixed-length fields inline and the offset of the payload of
+// other fields, then the payloads. Offsets are relative to the start of the message; 0 is
+// an absent field. Data may hold the public segment only, as proxies record it.
+
+/** Size of the reserved header of the public segment */
+export const SYMPHONY_HEADER_SIZE = 13;
+
+/** Version byte of the public segment */
+export const SYMPHONY_VERSION = 0x01;
+
+/** Value of the sensitive fields that are set; their values are never decoded */
+export const SYMPHONY_REDACTED = "[REDACTED]";
+
+/** Error of the decode functions for malformed data */
+export class SymphonyError extends Error {
+  constructor(message: string) {
+    super("symphony: " + message);
+    this.name = "SymphonyError";
+  }
+}
+
+/** The reserved header of a message */
+export interface SymphonyHeader {
+  /** Offset of the private segment, at or past the end of data if it only holds the public one */
+  privateOffset: number;
+  /** Service and method IDs of a request, 0 in responses and nested messages */
+  serviceId: number;
+  methodId: number;
+}
+
+/** Returns the header of a message, to find the method of a request */
+export function readSymphonyHeader(data: Uint8Array): SymphonyHeader {
+  if (data.length < SYMPHONY_HEADER_SIZE || data[0] !== SYMPHONY_VERSION) {
+    throw new SymphonyError("invalid data: wrong public version");
+  }
+  const view = new DataView(data.buffer, data.byteOffset, data.byteLength);
+  return { privateOffset: view.getUint32(1, true), serviceId: view.getUint32(5, true), methodId: view.getUint32(9, true) };
+}
+
+/** A google.protobuf.Timestamp or google.protobuf.Duration */
+export interface SymphonySeconds {
+  seconds: bigint;
+  nanos: number;
+}
+
+/** A google.protobuf.Any; the value is a Symphony or protobuf encoding */
+export interface SymphonyAny {
+  typeUrl: string;
+  value: Uint8Array;
+}
+
+const utf8 = new TextDecoder("utf-8", { fatal: true });
+
+function toString(data: Uint8Array): string {
+  try {
+    return utf8.decode(data);
+  } catch {
+    throw new SymphonyError("invalid data: string is not UTF-8");
+  }
+}
+
+/** Returns SYMPHONY_REDACTED for a sensitive field that is set, undefined for a zero value */
+export function redacted(v: unknown): typeof SYMPHONY_REDACTED | undefined {
+  const zero = v === undefined || v === false || v === 0 || v === 0n || v === "" ||
+    ((Array.isArray(v) || v instanceof Uint8Array) && v.length === 0);
+  return zero ? undefined : SYMPHONY_REDACTED;
+}
+
+/** Reads the public fields of a message, in field declaration order */
+export class SymphonyReader {
+  private readonly data: Uint8Array;
+  private readonly view: DataView;
+  private table = SYMPHONY_HEADER_SIZE;
+  private dict: string[] = [];
+
+  /** Returns a reader of data, whose public table starts with a string dictionary if interned */
+  constructor(data: Uint8Array, interned: boolean) {
+    readSymphonyHeader(data);
+    this.data = data;
+    this.view = new DataView(data.buffer, data.byteOffset, data.byteLength);
+    if (interned) {
+      const pos = this.payload();
+      if (pos !== undefined) {
+        this.dict = this.items(pos).map(toString);
+      }
+    }
+  }
+
+  private check(pos: number, size: number): void {
+    if (pos + size > this.data.length) {
+      throw new SymphonyError("invalid data: too short for field");
+    }
+  }
+
+  private u32At(pos: number): number {
+    this.check(pos, 4);
+    return this.view.getUint32(pos, true);
+  }
+
+  private slice(pos: number, size: number): Uint8Array {
+    this.check(pos, size);
+    return this.data.subarray(pos, pos + size);
+  }
+
+  /** Returns the table slot of the next fixed-length field of size bytes */
+  private fixed(size: number): number {
+    this.check(this.table, size);
+    const pos = this.table;
+    this.table += size;
+    return pos;
+  }
+
+  /** Returns the position of the payload of the next field, undefined if it is absent */
+  private payload(): number | undefined {
+    const offset = this.u32At(this.table);
+    this.table += 4;
+    return offset === 0 ? undefined : offset;
+  }
+
+  /** Returns the length-prefixed item at pos */
+  private item(pos: number): Uint8Array {
+    return this.slice(pos + 4, this.u32At(pos));
+  }
+
+  /** Returns the length-prefixed items of the list at pos */
+  private items(pos: number): Uint8Array[] {
+    const count = this.u32At(pos);
+    const items: Uint8Array[] = [];
+    pos += 4;
+    for (let i = 0; i < count; i++) {
+      const item = this.item(pos);
+      items.push(item);
+      pos += 4 + item.length;
+    }
+    return items;
+  }
+
+  /** Returns the values of the repeated fixed-length field of items of size bytes */
+  private repeated<T>(size: number, get: (pos: number) => T): T[] {
+    const pos = this.payload();
+    if (pos === undefined) {
+      return [];
+    }
+    const count = this.u32At(pos);
+    this.check(pos + 4, count * size);
+    const values: T[] = [];
+    for (let i = 0; i < count; i++) {
+      values.push(get(pos + 4 + i * size));
+    }
+    return values;
+  }
+
+  bool(): boolean {
+    return this.data[this.fixed(1)] !== 0;
+  }
+
+  int32(): number {
+    return this.view.getInt32(this.fixed(4), true);
+  }
+
+  uint32(): number {
+    return this.view.getUint32(this.fixed(4), true);
+  }
+
+  int64(): bigint {
+    return this.view.getBigInt64(this.fixed(8), true);
+  }
+
+  uint64(): bigint {
+    return this.view.getBigUint64(this.fixed(8), true);
+  }
+
+  float(): number {
+    return this.view.getFloat32(this.fixed(4), true);
+  }
+
+  double(): number {
+    return this.view.getFloat64(this.fixed(8), true);
+  }
+
+  string(): string {
+    return toString(this.bytes());
+  }
+
+  bytes(): Uint8Array {
+    const pos = this.payload();
+    return pos === undefined ? new Uint8Array(0) : this.item(pos).slice();
+  }
+
+  bools(): boolean[] {
+    return this.repeated(1, (pos) => this.data[pos] !== 0);
+  }
+
+  int32s(): number[] {
+    return this.repeated(4, (pos) => this.view.getInt32(pos, true));
+  }
+
+  uint32s(): number[] {
+    return this.repeated(4, (pos) => this.view.getUint32(pos, true));
+  }
+
+  int64s(): bigint[] {
+    return this.repeated(8, (pos) => this.view.getBigInt64(pos, true));
+  }
+
+  uint64s(): bigint[] {
+    return this.repeated(8, (pos) => this.view.getBigUint64(pos, true));
+  }
+
+  floats(): number[] {
+    return this.repeated(4, (pos) => this.view.getFloat32(pos, true));
+  }
+
+  doubles(): number[] {
+    return this.repeated(8, (pos) => this.view.getFloat64(pos, true));
+  }
+
+  strings(): string[] {
+    const pos = this.payload();
+    return pos === undefined ? [] : this.items(pos).map(toString);
+  }
+
+  bytesList(): Uint8Array[] {
+    const pos = this.payload();
+    return pos === undefined ? [] : this.items(pos).map((item) => item.slice());
+  }
+
+  /** Reads a nested message, or a well-known type, with decode */
+  message<T>(decode: (data: Uint8Array) => T): T | undefined {
+    const pos = this.payload();
+    return pos === undefined ? undefined : decode(this.item(pos));
+  }
+
+  messages<T>(decode: (data: Uint8Array) => T): T[] {
+    const pos = this.payload();
+    return pos === undefined ? [] : this.items(pos).map(decode);
+  }
+
+  /** Reads a delta encoded field: [count][data length][zigzag varint deltas], modulo 2^64 */
+  private deltas(): bigint[] {
+    const pos = this.payload();
+    if (pos === undefined) {
+      return [];
+    }
+    const count = this.u32At(pos);
+    const data = this.slice(pos + 8, this.u32At(pos + 4));
+    const values: bigint[] = [];
+    let prev = 0n;
+    let i = 0;
+    while (values.length < count) {
+      let zigzag = 0n;
+      for (let shift = 0n; ; shift += 7n) {
+        if (i >= data.length || shift > 63n) {
+          throw new SymphonyError(`invalid varint in delta-encoded data at value ${values.length}`);
+        }
+        const b = data[i++];
+        zigzag |= BigInt(b & 0x7f) << shift;
+        if (b < 0x80) {
+          break;
+        }
+      }
+      prev = BigInt.asUintN(64, prev + ((zigzag >> 1n) ^ -(zigzag & 1n)));
+      values.push(prev);
+    }
+    return values;
+  }
+
+  deltaInt32s(): number[] {
+    return this.deltas().map((v) => Number(BigInt.asIntN(32, v)));
+  }
+
+  deltaUint32s(): number[] {
+    return this.deltas().map((v) => Number(BigInt.asUintN(32, v)));
+  }
+
+  deltaInt64s(): bigint[] {
+    return this.deltas().map((v) => BigInt.asIntN(64, v));
+  }
+
+  deltaUint64s(): bigint[] {
+    return this.deltas();
+  }
+
+  private lookup(ref: number): string {
+    if (ref > this.dict.length) {
+      throw new SymphonyError(`string reference ${ref} out of range (dictionary has ${this.dict.length} entries)`);
+    }
+    return ref === 0 ? "" : this.dict[ref - 1];
+  }
+
+  /** Reads an interned string, whose slot holds its reference in the dictionary */
+  interned(): string {
+    return this.lookup(this.uint32());
+  }
+
+  /** Reads a repeated interned string: [count][references] */
+  internedList(): string[] {
+    return this.repeated(4, (pos) => this.view.getUint32(pos, true)).map((ref) => this.lookup(ref));
+  }
+}
+
+// Decoders of the compact encodings of the well-known types (see pkg/serializer). Like the
+// reader, they are exported so that files without such fields have no unused declarations.
+
+export function symphonyWellKnown(data: Uint8Array, size: number, name: string): DataView {
+  if (data.length !== size) {
+    throw new SymphonyError(`invalid data: ${name} needs ${size} bytes, got ${data.length}`);
+  }
+  return new DataView(data.buffer, data.byteOffset, data.byteLength);
+}
+
+export function symphonySeconds(data: Uint8Array): SymphonySeconds {
+  const view = symphonyWellKnown(data, 12, "google.protobuf.Timestamp");
+  return { seconds: view.getBigInt64(0, true), nanos: view.getInt32(8, true) };
+}
+
+export function symphonyBoolValue(data: Uint8Array): boolean {
+  return symphonyWellKnown(data, 1, "google.protobuf.BoolValue").getUint8(0) !== 0;
+}
+
+export function symphonyInt32Value(data: Uint8Array): number {
+  return symphonyWellKnown(data, 4, "google.protobuf.Int32Value").getInt32(0, true);
+}
+
+export function symphonyUInt32Value(data: Uint8Array): number {
+  return symphonyWellKnown(data, 4, "google.protobuf.UInt32Value").getUint32(0, true);
+}
+
+export function symphonyFloatValue(data: Uint8Array): number {
+  return symphonyWellKnown(data, 4, "google.protobuf.FloatValue").getFloat32(0, true);
+}
+
+export function symphonyInt64Value(data: Uint8Array): bigint {
+  return symphonyWellKnown(data, 8, "google.protobuf.Int64Value").getBigInt64(0, true);
+}
+
+export function symphonyUInt64Value(data: Uint8Array): bigint {
+  return symphonyWellKnown(data, 8, "google.protobuf.UInt64Value").getBigUint64(0, true);
+}
+
+export function symphonyDoubleValue(data: Uint8Array): number {
+  return symphonyWellKnown(data, 8, "google.protobuf.DoubleValue").getFloat64(0, true);
+}
+
+export function symphonyStringValue(data: Uint8Array): string {
+  return toString(data);
+}
+
+/** Returns a copy of data: BytesValue, and Struct, Value and ListValue in their protobuf encoding */
+export function symphonyBytesValue(data: Uint8Array): Uint8Array {
+  return data.slice();
+}
+
+export function symphonyAny(data: Uint8Array): SymphonyAny {
+  if (data.length < 4) {
+    throw new SymphonyError("invalid data: too short for Any");
+  }
+  const size = new DataView(data.buffer, data.byteOffset, data.byteLength).getUint32(0, true);
+  if (data.length < 4 + size) {
+    throw new SymphonyError("invalid data: too short for Any type URL");
+  }
+  return { typeUrl: toString(data.subarray(4, 4 + size)), value: data.slice(4 + size) };
+}
+
+export function symphonyEmpty(_data: Uint8Array): Record<string, never> {
+  return {};
+}
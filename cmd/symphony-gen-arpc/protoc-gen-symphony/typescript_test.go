@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	Test "github.com/appnet-org/arpc/cmd/symphony-gen-arpc/test"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestTypeScriptFile(t *testing.T) {
+	plugin := newTestPlugin(t, nil)
+	generateTypeScriptFile(plugin, plugin.Files[len(plugin.Files)-1])
+	resp := plugin.Response()
+	if len(resp.File) != 1 || resp.File[0].GetName() != "test.syn.ts" {
+		t.Fatalf("Expected test.syn.ts, got %v", resp.File)
+	}
+	content := resp.File[0].GetContent()
+	for _, want := range []string{
+		"export class SymphonyReader {",
+		"export interface ComplexMixed {\n  v_string: string;\n  nested_leaf?: Leaf;\n  f_bool: boolean;\n  v_bytes: Uint8Array;\n}",
+		"export function decodeComplexMixed(data: Uint8Array): ComplexMixed {",
+		"    nested_leaf: r.message(decodeLeaf),",
+		"export type Empty = Record<string, never>;",
+		"  card_number?: typeof SYMPHONY_REDACTED;",
+		"    card_number: redacted(r.string()),",
+		"  r_int64: bigint[];",
+		"    created: r.message(symphonySeconds),",
+		"    history: r.messages(symphonySeconds),",
+		"  nickname?: string;",
+		"    timestamps: r.deltaInt64s(),",
+		"  const r = new SymphonyReader(data, true);",
+		"    currencies: r.internedList(),",
+		"// Test.Labels has no Symphony encoding: field values is a map",
+		`  "Test.Catalog": decodeCatalog,`,
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("Expected generated TypeScript to contain %q", want)
+		}
+	}
+	if strings.Contains(content, "f_int64") {
+		t.Errorf("Expected generated TypeScript to leave private fields out")
+	}
+}
+
+// symphonyMarshaler is implemented by the Go messages of test.proto
+type symphonyMarshaler interface {
+	MarshalSymphony() ([]byte, error)
+}
+
+// The generated TypeScript decodes the public fields of the conformance vectors of the Go
+// messages, and of Go messages with the field types the vectors do not cover
+func TestTypeScriptConformance(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not found")
+	}
+	if err := exec.Command(node, "--experimental-strip-types", "-e", "").Run(); err != nil {
+		t.Skip("node does not support --experimental-strip-types")
+	}
+	data, err := os.ReadFile("../test/testdata/conformance.json")
+	if err != nil {
+		t.Fatalf("Failed to read vectors: %v", err)
+	}
+	var vectors []conformanceVector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatalf("Failed to parse vectors: %v", err)
+	}
+	var msgs []proto.Message
+	for i, v := range vectors {
+		mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName("Test." + v.Message))
+		if err != nil {
+			t.Fatalf("Vector %d: %v", i, err)
+		}
+		msg := mt.New().Interface()
+		if err := protojson.Unmarshal(v.JSON, msg); err != nil {
+			t.Fatalf("Vector %d: failed to parse %s: %v", i, v.Message, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	msgs = append(msgs,
+		&Test.WellKnown{
+			Created:  &timestamppb.Timestamp{Seconds: 1700000000, Nanos: 5},
+			Ttl:      durationpb.New(90),
+			Nickname: wrapperspb.String("nick"),
+			Version:  wrapperspb.Int64(3),
+			History:  []*timestamppb.Timestamp{{Seconds: -1}, {Nanos: 999999999}},
+		},
+		&Test.WellKnown{},
+		&Test.Deltas{
+			Timestamps: []int64{1700000000000, 1700000000500, -3, 1 << 62},
+			ProductIds: []int32{4, 2},
+			Counts:     []uint32{3, 1},
+		},
+		&Test.Catalog{Region: "eu", Currencies: []string{"eur", "usd", "eur", ""}, Count: 2, Categories: []string{"eu"}, Owner: "ops"},
+		&Test.Catalog{Count: 1},
+	)
+
+	dir := t.TempDir()
+	plugin := newTestPlugin(t, nil)
+	file := plugin.Files[len(plugin.Files)-1]
+	generateTypeScriptFile(plugin, file)
+	for _, f := range plugin.Response().File {
+		if err := os.WriteFile(filepath.Join(dir, f.GetName()), []byte(f.GetContent()), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", f.GetName(), err)
+		}
+	}
+	messages := make(map[protoreflect.FullName]*protogen.Message)
+	for _, msg := range file.Messages {
+		messages[msg.Desc.FullName()] = msg
+	}
+
+	// vectors.ts lists each vector with the TypeScript literal of its public fields
+	var b strings.Builder
+	b.WriteString("export const vectors = [\n")
+	for i, msg := range msgs {
+		encoded, err := msg.(symphonyMarshaler).MarshalSymphony()
+		if err != nil {
+			t.Fatalf("Message %d: failed to marshal: %v", i, err)
+		}
+		name := msg.ProtoReflect().Descriptor().FullName()
+		fmt.Fprintf(&b, "  { message: %q, symphony: %q, want: %s },\n", name, hex.EncodeToString(encoded), typescriptLiteral(messages[name], msg.ProtoReflect()))
+	}
+	b.WriteString("];\n")
+	harness, err := os.ReadFile("testdata/conformance.ts")
+	if err != nil {
+		t.Fatalf("Failed to read conformance.ts: %v", err)
+	}
+	for name, content := range map[string]string{
+		"vectors.ts":     b.String(),
+		"conformance.ts": string(harness),
+		"package.json":   `{"type": "module"}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	if out, err := exec.Command(node, "--experimental-strip-types", "--no-warnings", filepath.Join(dir, "conformance.ts")).CombinedOutput(); err != nil {
+		t.Fatalf("Conformance check failed: %v\n%s", err, out)
+	}
+}
+
+// typescriptLiteral returns the TypeScript object of the public fields of m the generated
+// decoder returns, msg being its message
+func typescriptLiteral(msg *protogen.Message, m protoreflect.Message) string {
+	publicFields, _ := classifyFields(msg)
+	var fields []string
+	for _, field := range publicFields {
+		// The descriptors of the plugin are not those of the Go messages
+		fd := m.Descriptor().Fields().ByName(field.Desc.Name())
+		var value string
+		switch {
+		case isSensitiveField(field):
+			if !m.Has(fd) {
+				continue
+			}
+			value = `"[REDACTED]"`
+		case fd.IsList():
+			list := m.Get(fd).List()
+			items := make([]string, list.Len())
+			for j := range items {
+				items[j] = typescriptValue(field, list.Get(j))
+			}
+			value = "[" + strings.Join(items, ", ") + "]"
+		case fd.Message() != nil && !m.Has(fd):
+			continue
+		default:
+			value = typescriptValue(field, m.Get(fd))
+		}
+		fields = append(fields, string(fd.Name())+": "+value)
+	}
+	return "{ " + strings.Join(fields, ", ") + " }"
+}
+
+// typescriptValue returns the TypeScript expression of a single value of field
+func typescriptValue(field *protogen.Field, v protoreflect.Value) string {
+	fd := field.Desc
+	switch fd.Kind() {
+	case protoreflect.MessageKind:
+		m := v.Message()
+		fields := m.Descriptor().Fields()
+		if _, ok := typescriptWellKnown[m.Descriptor().FullName()]; !ok {
+			return typescriptLiteral(field.Message, m)
+		}
+		if seconds := fields.ByName("seconds"); seconds != nil {
+			return fmt.Sprintf("{ seconds: %dn, nanos: %d }", m.Get(seconds).Int(), m.Get(fields.ByName("nanos")).Int())
+		}
+		// Wrappers, the only other well-known types of the public fields of test.proto
+		value := fields.ByName("value")
+		return typescriptValue(&protogen.Field{Desc: value}, m.Get(value))
+	case protoreflect.StringKind:
+		s, _ := json.Marshal(v.String())
+		return string(s)
+	case protoreflect.BytesKind:
+		items := make([]string, len(v.Bytes()))
+		for i, c := range v.Bytes() {
+			items[i] = strconv.Itoa(int(c))
+		}
+		return "new Uint8Array([" + strings.Join(items, ", ") + "])"
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return strings.NewReplacer("+Inf", "Infinity", "-Inf", "-Infinity").Replace(strconv.FormatFloat(v.Float(), 'g', -1, 64))
+	case protoreflect.Int64Kind:
+		return strconv.FormatInt(v.Int(), 10) + "n"
+	case protoreflect.Uint64Kind:
+		return strconv.FormatUint(v.Uint(), 10) + "n"
+	case protoreflect.Int32Kind:
+		return strconv.FormatInt(v.Int(), 10)
+	case protoreflect.Uint32Kind:
+		return strconv.FormatUint(v.Uint(), 10)
+	case protoreflect.EnumKind:
+		return strconv.Itoa(int(v.Enum()))
+	}
+	return v.String() // bool
+}
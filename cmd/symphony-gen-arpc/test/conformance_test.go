@@ -0,0 +1,60 @@
+package Test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// conformanceVector is a message of test.proto, in the protobuf JSON format, and its
+// Symphony encoding in hex. The runtimes of the other languages protoc-gen-arpc and
+// protoc-gen-symphony generate are checked against them.
+type conformanceVector struct {
+	Message  string          `json:"message"`
+	JSON     json.RawMessage `json:"json"`
+	Symphony string          `json:"symphony"`
+}
+
+// The conformance vectors are what the Go messages encode, and decode back
+func TestConformanceVectors(t *testing.T) {
+	data, err := os.ReadFile("testdata/conformance.json")
+	if err != nil {
+		t.Fatalf("Failed to read vectors: %v", err)
+	}
+	var vectors []conformanceVector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatalf("Failed to parse vectors: %v", err)
+	}
+
+	for i, v := range vectors {
+		mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName("Test." + v.Message))
+		if err != nil {
+			t.Fatalf("Vector %d: %v", i, err)
+		}
+		msg := mt.New().Interface()
+		if err := protojson.Unmarshal(v.JSON, msg); err != nil {
+			t.Fatalf("Vector %d: failed to parse %s: %v", i, v.Message, err)
+		}
+		encoded, err := msg.(SymphonyMessage).MarshalSymphony()
+		if err != nil {
+			t.Fatalf("Vector %d: failed to marshal %s: %v", i, v.Message, err)
+		}
+		if got := hex.EncodeToString(encoded); got != v.Symphony {
+			t.Errorf("Vector %d: %s encodes to\n%s\nexpected\n%s", i, v.Message, got, v.Symphony)
+		}
+
+		decoded := mt.New().Interface()
+		if err := decoded.(SymphonyMessage).UnmarshalSymphony(encoded); err != nil {
+			t.Fatalf("Vector %d: failed to unmarshal %s: %v", i, v.Message, err)
+		}
+		if !proto.Equal(decoded, msg) {
+			t.Errorf("Vector %d: %s decodes to %v, expected %v", i, v.Message, decoded, msg)
+		}
+	}
+}
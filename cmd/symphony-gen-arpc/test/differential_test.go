@@ -0,0 +1,35 @@
+package Test
+
+import (
+	"testing"
+
+	"github.com/appnet-org/arpc/pkg/symphonytest"
+)
+
+// Random messages of every Symphony message of test.proto round-trip like protobuf.
+// Run one of the fuzz targets to explore further, e.g.
+//
+//	go test -run '^$' -fuzz FuzzDifferentialComplexMixed ./cmd/symphony-gen-arpc/test
+func TestDifferential(t *testing.T) {
+	const n = 200
+	t.Run("Fixed", symphonytest.Differential[Fixed](n))
+	t.Run("Var", symphonytest.Differential[Var](n))
+	t.Run("RepeatedFixed", symphonytest.Differential[RepeatedFixed](n))
+	t.Run("RepeatedVar", symphonytest.Differential[RepeatedVar](n))
+	t.Run("Leaf", symphonytest.Differential[Leaf](n))
+	t.Run("Level2", symphonytest.Differential[Level2](n))
+	t.Run("Level1", symphonytest.Differential[Level1](n))
+	t.Run("Root", symphonytest.Differential[Root](n))
+	t.Run("ComplexMixed", symphonytest.Differential[ComplexMixed](n))
+	t.Run("Empty", symphonytest.Differential[Empty](n))
+	t.Run("Credentials", symphonytest.Differential[Credentials](n))
+	t.Run("WellKnown", symphonytest.Differential[WellKnown](n))
+	t.Run("Deltas", symphonytest.Differential[Deltas](n))
+	t.Run("Catalog", symphonytest.Differential[Catalog](n))
+}
+
+func FuzzDifferentialComplexMixed(f *testing.F) { symphonytest.FuzzDifferential[ComplexMixed](f) }
+
+func FuzzDifferentialWellKnown(f *testing.F) { symphonytest.FuzzDifferential[WellKnown](f) }
+
+func FuzzDifferentialCatalog(f *testing.F) { symphonytest.FuzzDifferential[Catalog](f) }
@@ -2,9 +2,19 @@ package Test
 
 import (
 	"bytes"
+	"encoding/binary"
 	"math"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/serializer"
+	"github.com/appnet-org/arpc/pkg/symphonytest"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 // --- Helpers ---
@@ -92,7 +102,7 @@ func TestFixed(t *testing.T) {
 		}
 
 		// 5. Test public field mutation on public-only buffer
-		offsetToPrivate := int(data[1]) | int(data[2])<<8 | int(data[3])<<16 | int(data[4])<<24
+		offsetToPrivate := binary.LittleEndian.Uint32(data[1:5])
 		publicOnly := data[:offsetToPrivate]
 
 		// Directly assign public-only buffer (no unmarshal needed for Raw types)
@@ -701,3 +711,431 @@ func TestPublicPrivateAccessControl(t *testing.T) {
 		}
 	})
 }
+
+func TestRawText(t *testing.T) {
+	msg := &ComplexMixed{
+		FInt32:         7,
+		VString:        "hello \"world\"",
+		RInt64:         []int64{1, 2},
+		NestedLeaf:     &Leaf{LeafId: 3, LeafVal: "leaf"},
+		FBool:          true,
+		RepeatedNested: []*Root{{RootId: 9}},
+	}
+	data, err := msg.MarshalSymphony()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	t.Run("Complete", func(t *testing.T) {
+		expected := `f_int32: 7 v_string: "hello \"world\"" r_int64: 1 r_int64: 2 nested_leaf { leaf_id: 3 leaf_val: "leaf" } f_bool: true repeated_nested { root_id: 9 }`
+		if got := ComplexMixedRaw(data).String(); got != expected {
+			t.Errorf("String mismatch.\nExpected: %s\nGot:      %s", expected, got)
+		}
+	})
+
+	t.Run("PublicOnly", func(t *testing.T) {
+		// A proxy only holds the public segment, private fields must be skipped
+		offsetToPrivate := binary.LittleEndian.Uint32(data[1:5])
+		expected := `v_string: "hello \"world\"" nested_leaf { leaf_id: 3 leaf_val: "leaf" } f_bool: true`
+		if got := ComplexMixedRaw(data[:offsetToPrivate]).String(); got != expected {
+			t.Errorf("String mismatch.\nExpected: %s\nGot:      %s", expected, got)
+		}
+	})
+
+	t.Run("Sensitive", func(t *testing.T) {
+		creds := &Credentials{User: "alice", CardNumber: "4111111111111111", Secret: []byte("hunter2")}
+		data, err := creds.MarshalSymphony()
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		expected := `user: "alice" card_number: "[REDACTED]" secret: "[REDACTED]"`
+		if got := CredentialsRaw(data).String(); got != expected {
+			t.Errorf("String mismatch.\nExpected: %s\nGot:      %s", expected, got)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		text, err := ComplexMixedRaw([]byte{0x01, 0x02}).MarshalText()
+		if err == nil {
+			t.Errorf("Expected error for truncated buffer, got %q", text)
+		}
+	})
+}
+
+func TestProtobufFallback(t *testing.T) {
+	s := &serializer.SymphonyFallbackSerializer{}
+
+	t.Run("UnsupportedMessage", func(t *testing.T) {
+		msg := &Labels{Name: "pod", Values: map[string]string{"app": "kv"}}
+		if _, err := msg.MarshalSymphony(); err == nil {
+			t.Fatal("Expected MarshalSymphony to fail for a message with a map field")
+		}
+
+		data, err := s.Marshal(msg)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		if data[0] != serializer.CodecTagProtobuf {
+			t.Errorf("Expected protobuf codec tag, got 0x%02x", data[0])
+		}
+
+		out := &Labels{}
+		if err := s.Unmarshal(data, out); err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		if !proto.Equal(msg, out) {
+			t.Errorf("Mismatch.\nExpected: %v\nGot:      %v", msg, out)
+		}
+	})
+
+	t.Run("SupportedMessage", func(t *testing.T) {
+		msg := &Var{VString: "hello", VBytes: []byte{1, 2}}
+		for _, codecTag := range []byte{serializer.CodecTagSymphony, serializer.CodecTagProtobuf} {
+			data, err := s.MarshalWithCodec(msg, codecTag)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			if data[0] != codecTag {
+				t.Errorf("Expected codec tag 0x%02x, got 0x%02x", codecTag, data[0])
+			}
+
+			out := &Var{}
+			if err := s.Unmarshal(data, out); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			if !proto.Equal(msg, out) {
+				t.Errorf("Mismatch.\nExpected: %v\nGot:      %v", msg, out)
+			}
+		}
+	})
+}
+
+func TestWellKnownTypes(t *testing.T) {
+	attrs, err := structpb.NewStruct(map[string]any{"zone": "us-east", "replicas": 3})
+	if err != nil {
+		t.Fatalf("NewStruct failed: %v", err)
+	}
+	detail, err := serializer.NewAny(&Leaf{LeafId: 7, LeafVal: "leaf"})
+	if err != nil {
+		t.Fatalf("NewAny failed: %v", err)
+	}
+	msg := &WellKnown{
+		Created:  timestamppb.New(time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)),
+		Ttl:      durationpb.New(90 * time.Second),
+		Detail:   detail,
+		Attrs:    attrs,
+		Nickname: wrapperspb.String("kv"),
+		Version:  wrapperspb.Int64(-3),
+		History:  []*timestamppb.Timestamp{timestamppb.New(time.Unix(1, 2)), timestamppb.New(time.Unix(3, 4))},
+	}
+
+	data, err := msg.MarshalSymphony()
+	if err != nil {
+		t.Fatalf("MarshalSymphony failed: %v", err)
+	}
+	out := &WellKnown{}
+	if err := out.UnmarshalSymphony(data); err != nil {
+		t.Fatalf("UnmarshalSymphony failed: %v", err)
+	}
+	if !proto.Equal(msg, out) {
+		t.Errorf("Mismatch.\nExpected: %v\nGot:      %v", msg, out)
+	}
+
+	leaf := &Leaf{}
+	if err := serializer.UnmarshalAny(out.Detail, leaf); err != nil {
+		t.Fatalf("UnmarshalAny failed: %v", err)
+	}
+	if leaf.LeafId != 7 || leaf.LeafVal != "leaf" {
+		t.Errorf("Unexpected Any payload: %v", leaf)
+	}
+
+	// Unset fields stay nil
+	empty := &WellKnown{}
+	data, err = empty.MarshalSymphony()
+	if err != nil {
+		t.Fatalf("MarshalSymphony failed: %v", err)
+	}
+	out = &WellKnown{}
+	if err := out.UnmarshalSymphony(data); err != nil {
+		t.Fatalf("UnmarshalSymphony failed: %v", err)
+	}
+	if out.Created != nil || out.Nickname != nil || out.Attrs != nil {
+		t.Errorf("Expected unset fields to stay nil, got %v", out)
+	}
+
+	t.Run("Raw", func(t *testing.T) {
+		data, _ := msg.MarshalSymphony()
+		raw := WellKnownRaw(data)
+		if got := raw.GetCreated(); !proto.Equal(got, msg.Created) {
+			t.Errorf("GetCreated: expected %v, got %v", msg.Created, got)
+		}
+		if got := raw.GetVersion(); got.GetValue() != -3 {
+			t.Errorf("GetVersion: expected -3, got %v", got)
+		}
+		if got := raw.GetHistory(); len(got) != 2 || !proto.Equal(got[1], msg.History[1]) {
+			t.Errorf("GetHistory: unexpected %v", got)
+		}
+
+		if err := raw.SetTtl(durationpb.New(time.Minute)); err != nil {
+			t.Fatalf("SetTtl failed: %v", err)
+		}
+		if got := raw.GetTtl().AsDuration(); got != time.Minute {
+			t.Errorf("GetTtl: expected 1m, got %v", got)
+		}
+		if err := raw.SetVersion(nil); err != nil {
+			t.Fatalf("SetVersion failed: %v", err)
+		}
+		if got := raw.GetVersion(); got != nil {
+			t.Errorf("GetVersion: expected nil after clearing, got %v", got)
+		}
+
+		offsetToPrivate := binary.LittleEndian.Uint32(data[1:5])
+		public := WellKnownRaw(append([]byte(nil), data[:offsetToPrivate]...))
+		if err := public.SetNickname(wrapperspb.String("a much longer nickname")); err != nil {
+			t.Fatalf("SetNickname failed: %v", err)
+		}
+		if got := public.GetNickname().GetValue(); got != "a much longer nickname" {
+			t.Errorf("GetNickname: unexpected %q", got)
+		}
+
+		expected := `created: "2024-05-01T12:00:00.0000005Z" nickname: "a much longer nickname" history: "1970-01-01T00:00:01.000000002Z" history: "1970-01-01T00:00:03.000000004Z"`
+		if got := public.String(); got != expected {
+			t.Errorf("Unexpected text.\nExpected: %s\nGot:      %s", expected, got)
+		}
+	})
+}
+
+func TestDeltaEncoded(t *testing.T) {
+	timestamps := make([]int64, 100)
+	for i := range timestamps {
+		timestamps[i] = 1_700_000_000_000 + int64(i)*250
+	}
+	msg := &Deltas{
+		Timestamps: timestamps,
+		ProductIds: []int32{-5, 3, 3, 1 << 30, math.MinInt32, 0},
+		Offsets:    []uint64{math.MaxUint64, 0, 1},
+		Counts:     []uint32{1, 2},
+	}
+
+	data, err := msg.MarshalSymphony()
+	if err != nil {
+		t.Fatalf("MarshalSymphony failed: %v", err)
+	}
+	out := &Deltas{}
+	if err := out.UnmarshalSymphony(data); err != nil {
+		t.Fatalf("UnmarshalSymphony failed: %v", err)
+	}
+	if !proto.Equal(msg, out) {
+		t.Errorf("Mismatch.\nExpected: %v\nGot:      %v", msg, out)
+	}
+
+	// Closely spaced values take 2 bytes each instead of 8
+	offsetToPrivate := int(binary.LittleEndian.Uint32(data[1:5]))
+	if offsetToPrivate > 300 {
+		t.Errorf("Expected a compact public segment, got %d bytes", offsetToPrivate)
+	}
+
+	// Truncated varint data is an error, not a panic
+	corrupt := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(corrupt[binary.LittleEndian.Uint32(data[13:17]):], 1000) // count
+	if err := (&Deltas{}).UnmarshalSymphony(corrupt); err == nil {
+		t.Error("Expected an error for a count exceeding the encoded data")
+	}
+
+	t.Run("Raw", func(t *testing.T) {
+		raw := DeltasRaw(append([]byte(nil), data...))
+		if got := raw.GetTimestamps(); !reflect.DeepEqual(got, timestamps) {
+			t.Errorf("GetTimestamps: unexpected %v", got)
+		}
+		if got := raw.GetOffsets(); !reflect.DeepEqual(got, msg.Offsets) {
+			t.Errorf("GetOffsets: unexpected %v", got)
+		}
+
+		// Shorter lists are updated in place, longer ones remarshal
+		if err := raw.SetProductIds([]int32{7, 8}); err != nil {
+			t.Fatalf("SetProductIds failed: %v", err)
+		}
+		if len(raw) != len(data) {
+			t.Errorf("Expected an in-place update, length changed from %d to %d", len(data), len(raw))
+		}
+		if err := raw.SetOffsets([]uint64{1, 1 << 40, 3, 1 << 50}); err != nil {
+			t.Fatalf("SetOffsets failed: %v", err)
+		}
+		if got := raw.GetProductIds(); !reflect.DeepEqual(got, []int32{7, 8}) {
+			t.Errorf("GetProductIds: unexpected %v", got)
+		}
+		if got := raw.GetOffsets(); !reflect.DeepEqual(got, []uint64{1, 1 << 40, 3, 1 << 50}) {
+			t.Errorf("GetOffsets: unexpected %v", got)
+		}
+		if got := raw.GetTimestamps(); !reflect.DeepEqual(got, timestamps) {
+			t.Errorf("GetTimestamps changed by other setters: %v", got)
+		}
+
+		public := DeltasRaw(append([]byte(nil), data[:offsetToPrivate]...))
+		if err := public.SetCounts([]uint32{9}); err != nil {
+			t.Fatalf("SetCounts failed: %v", err)
+		}
+		if err := public.SetTimestamps([]int64{-1, -2}); err != nil {
+			t.Fatalf("SetTimestamps failed: %v", err)
+		}
+		if got := public.String(); got != "timestamps: -1 timestamps: -2 counts: 9" {
+			t.Errorf("Unexpected text %q", got)
+		}
+	})
+}
+
+func TestInterned(t *testing.T) {
+	currencies := make([]string, 50)
+	for i := range currencies {
+		currencies[i] = []string{"USD", "EUR", "JPY"}[i%3]
+	}
+	msg := &Catalog{
+		Region:     "EUR",
+		Currencies: currencies,
+		Count:      50,
+		Categories: []string{"kitchen", "", "kitchen", "garden"},
+		Owner:      "garden",
+		Note:       "not interned",
+	}
+
+	data, err := msg.MarshalSymphony()
+	if err != nil {
+		t.Fatalf("MarshalSymphony failed: %v", err)
+	}
+	out := &Catalog{}
+	if err := out.UnmarshalSymphony(data); err != nil {
+		t.Fatalf("UnmarshalSymphony failed: %v", err)
+	}
+	if !proto.Equal(msg, out) {
+		t.Errorf("Mismatch.\nExpected: %v\nGot:      %v", msg, out)
+	}
+
+	// Each currency is stored once: 13 header + 16 table + 4+4*50 references + dictionary
+	offsetToPrivate := int(binary.LittleEndian.Uint32(data[1:5]))
+	if want := 13 + 16 + 4 + 4*50 + 4 + 3*(4+3); offsetToPrivate != want {
+		t.Errorf("Expected a %d-byte public segment, got %d", want, offsetToPrivate)
+	}
+
+	// A reference beyond the dictionary is an error, not a panic
+	corrupt := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(corrupt[17:], 100) // region
+	if err := (&Catalog{}).UnmarshalSymphony(corrupt); err == nil {
+		t.Error("Expected an error for a reference out of range")
+	}
+
+	t.Run("Raw", func(t *testing.T) {
+		raw := CatalogRaw(append([]byte(nil), data...))
+		if got := raw.GetRegion(); got != "EUR" {
+			t.Errorf("GetRegion: unexpected %q", got)
+		}
+		if got := raw.GetCurrencies(); !reflect.DeepEqual(got, currencies) {
+			t.Errorf("GetCurrencies: unexpected %v", got)
+		}
+		if got := raw.GetCategories(); !reflect.DeepEqual(got, msg.Categories) {
+			t.Errorf("GetCategories: unexpected %v", got)
+		}
+
+		// Strings already in the dictionary are set in place, new ones remarshal
+		if err := raw.SetOwner("kitchen"); err != nil {
+			t.Fatalf("SetOwner failed: %v", err)
+		}
+		if err := raw.SetCategories([]string{"garden"}); err != nil {
+			t.Fatalf("SetCategories failed: %v", err)
+		}
+		if len(raw) != len(data) {
+			t.Errorf("Expected in-place updates, length changed from %d to %d", len(data), len(raw))
+		}
+		if err := raw.SetOwner("toys"); err != nil {
+			t.Fatalf("SetOwner failed: %v", err)
+		}
+		if got := raw.GetOwner(); got != "toys" {
+			t.Errorf("GetOwner: unexpected %q", got)
+		}
+		if got := raw.GetCategories(); !reflect.DeepEqual(got, []string{"garden"}) {
+			t.Errorf("GetCategories: unexpected %v", got)
+		}
+		if got := raw.GetNote(); got != "not interned" {
+			t.Errorf("GetNote changed by other setters: %q", got)
+		}
+
+		public := CatalogRaw(append([]byte(nil), data[:offsetToPrivate]...))
+		if err := public.SetRegion("USD"); err != nil {
+			t.Fatalf("SetRegion failed: %v", err)
+		}
+		if err := public.SetCurrencies([]string{"CHF", "USD"}); err != nil {
+			t.Fatalf("SetCurrencies failed: %v", err)
+		}
+		if got := public.String(); got != `region: "USD" currencies: "CHF" currencies: "USD" count: 50` {
+			t.Errorf("Unexpected text %q", got)
+		}
+	})
+}
+
+func TestUnmarshalArena(t *testing.T) {
+	msg := &ComplexMixed{FInt32: 1, NestedLeaf: &Leaf{LeafId: 2, LeafVal: "leaf"}}
+	for i := range 40 {
+		msg.RepeatedNested = append(msg.RepeatedNested, &Root{RootId: int32(i), L1: &Level1{L1Data: "l1", L2: &Level2{Leaf: &Leaf{LeafId: int32(i)}}}})
+	}
+	data, err := msg.MarshalSymphony()
+	if err != nil {
+		t.Fatalf("MarshalSymphony failed: %v", err)
+	}
+
+	arena := serializer.NewArena()
+	out := &ComplexMixed{}
+	if err := out.UnmarshalSymphonyArena(data, arena); err != nil {
+		t.Fatalf("UnmarshalSymphonyArena failed: %v", err)
+	}
+	if !proto.Equal(msg, out) {
+		t.Errorf("Mismatch.\nExpected: %v\nGot:      %v", msg, out)
+	}
+
+	// Released messages are zeroed and their memory is reused by the next call
+	first := out.RepeatedNested[0]
+	arena.Release()
+	if first.RootId != 0 || first.L1 != nil {
+		t.Errorf("Expected a zeroed message after Release, got %v", first)
+	}
+	out = &ComplexMixed{}
+	if err := out.UnmarshalSymphonyArena(data, arena); err != nil {
+		t.Fatalf("UnmarshalSymphonyArena failed: %v", err)
+	}
+	if out.RepeatedNested[0] != first || !proto.Equal(msg, out) {
+		t.Error("Expected the second call to reuse the released arena")
+	}
+
+	heap := testing.AllocsPerRun(10, func() {
+		_ = (&ComplexMixed{}).UnmarshalSymphony(data)
+	})
+	reused := testing.AllocsPerRun(10, func() {
+		arena.Release()
+		_ = (&ComplexMixed{}).UnmarshalSymphonyArena(data, arena)
+	})
+	if reused >= heap/2 {
+		t.Errorf("Expected far fewer allocations with a reused arena: %v, from the heap: %v", reused, heap)
+	}
+}
+
+func TestBenchmarkExamples(t *testing.T) {
+	// ComplexMixed has an example file, the other messages are populated
+	msg := &ComplexMixed{}
+	symphonytest.Example(t, msg)
+	if msg.VString != "order-2024-0001" || len(msg.RepeatedNested) != 3 {
+		t.Errorf("Expected the example from testdata, got %v", msg)
+	}
+
+	for _, msg := range []proto.Message{&ComplexMixed{}, &Fixed{}, &WellKnown{}, &Catalog{}} {
+		symphonytest.Example(t, msg)
+		data, err := msg.(serializer.SymphonyMessage).MarshalSymphony()
+		if err != nil {
+			t.Fatalf("%T: MarshalSymphony failed: %v", msg, err)
+		}
+		out := msg.ProtoReflect().New().Interface()
+		if err := out.(serializer.SymphonyMessage).UnmarshalSymphony(data); err != nil {
+			t.Fatalf("%T: UnmarshalSymphony failed: %v", msg, err)
+		}
+		if !proto.Equal(msg, out) {
+			t.Errorf("%T: mismatch.\nExpected: %v\nGot:      %v", msg, msg, out)
+		}
+	}
+}
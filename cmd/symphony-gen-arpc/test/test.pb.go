@@ -10,6 +10,11 @@ import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
 	descriptorpb "google.golang.org/protobuf/types/descriptorpb"
+	anypb "google.golang.org/protobuf/types/known/anypb"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	wrapperspb "google.golang.org/protobuf/types/known/wrapperspb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -653,6 +658,367 @@ func (*Empty) Descriptor() ([]byte, []int) {
 	return file_test_proto_rawDescGZIP(), []int{9}
 }
 
+// 8. Sensitive fields are redacted in the text format
+type Credentials struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	User          string                 `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	CardNumber    string                 `protobuf:"bytes,2,opt,name=card_number,json=cardNumber,proto3" json:"card_number,omitempty"`
+	Secret        []byte                 `protobuf:"bytes,3,opt,name=secret,proto3" json:"secret,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Credentials) Reset() {
+	*x = Credentials{}
+	mi := &file_test_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Credentials) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Credentials) ProtoMessage() {}
+
+func (x *Credentials) ProtoReflect() protoreflect.Message {
+	mi := &file_test_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Credentials.ProtoReflect.Descriptor instead.
+func (*Credentials) Descriptor() ([]byte, []int) {
+	return file_test_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Credentials) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *Credentials) GetCardNumber() string {
+	if x != nil {
+		return x.CardNumber
+	}
+	return ""
+}
+
+func (x *Credentials) GetSecret() []byte {
+	if x != nil {
+		return x.Secret
+	}
+	return nil
+}
+
+// 9. Fields without a Symphony encoding fall back to protobuf
+type Labels struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Values        map[string]string      `protobuf:"bytes,2,rep,name=values,proto3" json:"values,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Labels) Reset() {
+	*x = Labels{}
+	mi := &file_test_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Labels) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Labels) ProtoMessage() {}
+
+func (x *Labels) ProtoReflect() protoreflect.Message {
+	mi := &file_test_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Labels.ProtoReflect.Descriptor instead.
+func (*Labels) Descriptor() ([]byte, []int) {
+	return file_test_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Labels) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Labels) GetValues() map[string]string {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+// 10. Well-known types have compact Symphony encodings
+type WellKnown struct {
+	state         protoimpl.MessageState   `protogen:"open.v1"`
+	Created       *timestamppb.Timestamp   `protobuf:"bytes,1,opt,name=created,proto3" json:"created,omitempty"`
+	Ttl           *durationpb.Duration     `protobuf:"bytes,2,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	Detail        *anypb.Any               `protobuf:"bytes,3,opt,name=detail,proto3" json:"detail,omitempty"`
+	Attrs         *structpb.Struct         `protobuf:"bytes,4,opt,name=attrs,proto3" json:"attrs,omitempty"`
+	Nickname      *wrapperspb.StringValue  `protobuf:"bytes,5,opt,name=nickname,proto3" json:"nickname,omitempty"`
+	Version       *wrapperspb.Int64Value   `protobuf:"bytes,6,opt,name=version,proto3" json:"version,omitempty"`
+	History       []*timestamppb.Timestamp `protobuf:"bytes,7,rep,name=history,proto3" json:"history,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WellKnown) Reset() {
+	*x = WellKnown{}
+	mi := &file_test_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WellKnown) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WellKnown) ProtoMessage() {}
+
+func (x *WellKnown) ProtoReflect() protoreflect.Message {
+	mi := &file_test_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WellKnown.ProtoReflect.Descriptor instead.
+func (*WellKnown) Descriptor() ([]byte, []int) {
+	return file_test_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *WellKnown) GetCreated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Created
+	}
+	return nil
+}
+
+func (x *WellKnown) GetTtl() *durationpb.Duration {
+	if x != nil {
+		return x.Ttl
+	}
+	return nil
+}
+
+func (x *WellKnown) GetDetail() *anypb.Any {
+	if x != nil {
+		return x.Detail
+	}
+	return nil
+}
+
+func (x *WellKnown) GetAttrs() *structpb.Struct {
+	if x != nil {
+		return x.Attrs
+	}
+	return nil
+}
+
+func (x *WellKnown) GetNickname() *wrapperspb.StringValue {
+	if x != nil {
+		return x.Nickname
+	}
+	return nil
+}
+
+func (x *WellKnown) GetVersion() *wrapperspb.Int64Value {
+	if x != nil {
+		return x.Version
+	}
+	return nil
+}
+
+func (x *WellKnown) GetHistory() []*timestamppb.Timestamp {
+	if x != nil {
+		return x.History
+	}
+	return nil
+}
+
+// 11. Repeated integers stored as varint deltas
+type Deltas struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Timestamps    []int64                `protobuf:"varint,1,rep,packed,name=timestamps,proto3" json:"timestamps,omitempty"`
+	ProductIds    []int32                `protobuf:"varint,2,rep,packed,name=product_ids,json=productIds,proto3" json:"product_ids,omitempty"`
+	Offsets       []uint64               `protobuf:"varint,3,rep,packed,name=offsets,proto3" json:"offsets,omitempty"`
+	Counts        []uint32               `protobuf:"varint,4,rep,packed,name=counts,proto3" json:"counts,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Deltas) Reset() {
+	*x = Deltas{}
+	mi := &file_test_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Deltas) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Deltas) ProtoMessage() {}
+
+func (x *Deltas) ProtoReflect() protoreflect.Message {
+	mi := &file_test_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Deltas.ProtoReflect.Descriptor instead.
+func (*Deltas) Descriptor() ([]byte, []int) {
+	return file_test_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Deltas) GetTimestamps() []int64 {
+	if x != nil {
+		return x.Timestamps
+	}
+	return nil
+}
+
+func (x *Deltas) GetProductIds() []int32 {
+	if x != nil {
+		return x.ProductIds
+	}
+	return nil
+}
+
+func (x *Deltas) GetOffsets() []uint64 {
+	if x != nil {
+		return x.Offsets
+	}
+	return nil
+}
+
+func (x *Deltas) GetCounts() []uint32 {
+	if x != nil {
+		return x.Counts
+	}
+	return nil
+}
+
+// 12. Strings stored in the string dictionaries of their segments
+type Catalog struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Region        string                 `protobuf:"bytes,1,opt,name=region,proto3" json:"region,omitempty"`
+	Currencies    []string               `protobuf:"bytes,2,rep,name=currencies,proto3" json:"currencies,omitempty"`
+	Count         int32                  `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`
+	Categories    []string               `protobuf:"bytes,4,rep,name=categories,proto3" json:"categories,omitempty"`
+	Owner         string                 `protobuf:"bytes,5,opt,name=owner,proto3" json:"owner,omitempty"`
+	Note          string                 `protobuf:"bytes,6,opt,name=note,proto3" json:"note,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Catalog) Reset() {
+	*x = Catalog{}
+	mi := &file_test_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Catalog) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Catalog) ProtoMessage() {}
+
+func (x *Catalog) ProtoReflect() protoreflect.Message {
+	mi := &file_test_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Catalog.ProtoReflect.Descriptor instead.
+func (*Catalog) Descriptor() ([]byte, []int) {
+	return file_test_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *Catalog) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+func (x *Catalog) GetCurrencies() []string {
+	if x != nil {
+		return x.Currencies
+	}
+	return nil
+}
+
+func (x *Catalog) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *Catalog) GetCategories() []string {
+	if x != nil {
+		return x.Categories
+	}
+	return nil
+}
+
+func (x *Catalog) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *Catalog) GetNote() string {
+	if x != nil {
+		return x.Note
+	}
+	return ""
+}
+
 var file_test_proto_extTypes = []protoimpl.ExtensionInfo{
 	{
 		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
@@ -662,12 +1028,42 @@ var file_test_proto_extTypes = []protoimpl.ExtensionInfo{
 		Tag:           "varint,50001,opt,name=is_public",
 		Filename:      "test.proto",
 	},
+	{
+		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         50002,
+		Name:          "Test.is_sensitive",
+		Tag:           "varint,50002,opt,name=is_sensitive",
+		Filename:      "test.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         50003,
+		Name:          "Test.is_delta_encoded",
+		Tag:           "varint,50003,opt,name=is_delta_encoded",
+		Filename:      "test.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         50004,
+		Name:          "Test.is_interned",
+		Tag:           "varint,50004,opt,name=is_interned",
+		Filename:      "test.proto",
+	},
 }
 
 // Extension fields to descriptorpb.FieldOptions.
 var (
 	// optional bool is_public = 50001;
 	E_IsPublic = &file_test_proto_extTypes[0]
+	// optional bool is_sensitive = 50002;
+	E_IsSensitive = &file_test_proto_extTypes[1]
+	// optional bool is_delta_encoded = 50003;
+	E_IsDeltaEncoded = &file_test_proto_extTypes[2]
+	// optional bool is_interned = 50004;
+	E_IsInterned = &file_test_proto_extTypes[3]
 )
 
 var File_test_proto protoreflect.FileDescriptor
@@ -675,7 +1071,7 @@ var File_test_proto protoreflect.FileDescriptor
 const file_test_proto_rawDesc = "" +
 	"\n" +
 	"\n" +
-	"test.proto\x12\x04Test\x1a google/protobuf/descriptor.proto\"\xd2\x01\n" +
+	"test.proto\x12\x04Test\x1a google/protobuf/descriptor.proto\x1a\x19google/protobuf/any.proto\x1a\x1egoogle/protobuf/duration.proto\x1a\x1cgoogle/protobuf/struct.proto\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x1egoogle/protobuf/wrappers.proto\"\xd2\x01\n" +
 	"\x05Fixed\x12\x1d\n" +
 	"\af_int32\x18\x01 \x01(\x05B\x04\x88\xb5\x18\x01R\x06fInt32\x12\x17\n" +
 	"\af_int64\x18\x02 \x01(\x03R\x06fInt64\x12\x1f\n" +
@@ -722,8 +1118,50 @@ const file_test_proto_rawDesc = "" +
 	"\x0frepeated_nested\x18\a \x03(\v2\n" +
 	".Test.RootR\x0erepeatedNested\x12\x1d\n" +
 	"\av_bytes\x18\b \x01(\fB\x04\x88\xb5\x18\x01R\x06vBytes\"\a\n" +
-	"\x05Empty:<\n" +
-	"\tis_public\x12\x1d.google.protobuf.FieldOptions\x18ц\x03 \x01(\bR\bisPublicB\bZ\x06./Testb\x06proto3"
+	"\x05Empty\"p\n" +
+	"\vCredentials\x12\x18\n" +
+	"\x04user\x18\x01 \x01(\tB\x04\x88\xb5\x18\x01R\x04user\x12)\n" +
+	"\vcard_number\x18\x02 \x01(\tB\b\x88\xb5\x18\x01\x90\xb5\x18\x01R\n" +
+	"cardNumber\x12\x1c\n" +
+	"\x06secret\x18\x03 \x01(\fB\x04\x90\xb5\x18\x01R\x06secret\"\x8f\x01\n" +
+	"\x06Labels\x12\x18\n" +
+	"\x04name\x18\x01 \x01(\tB\x04\x88\xb5\x18\x01R\x04name\x120\n" +
+	"\x06values\x18\x02 \x03(\v2\x18.Test.Labels.ValuesEntryR\x06values\x1a9\n" +
+	"\vValuesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x84\x03\n" +
+	"\tWellKnown\x12:\n" +
+	"\acreated\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampB\x04\x88\xb5\x18\x01R\acreated\x12+\n" +
+	"\x03ttl\x18\x02 \x01(\v2\x19.google.protobuf.DurationR\x03ttl\x12,\n" +
+	"\x06detail\x18\x03 \x01(\v2\x14.google.protobuf.AnyR\x06detail\x12-\n" +
+	"\x05attrs\x18\x04 \x01(\v2\x17.google.protobuf.StructR\x05attrs\x12>\n" +
+	"\bnickname\x18\x05 \x01(\v2\x1c.google.protobuf.StringValueB\x04\x88\xb5\x18\x01R\bnickname\x125\n" +
+	"\aversion\x18\x06 \x01(\v2\x1b.google.protobuf.Int64ValueR\aversion\x12:\n" +
+	"\ahistory\x18\a \x03(\v2\x1a.google.protobuf.TimestampB\x04\x88\xb5\x18\x01R\ahistory\"\x97\x01\n" +
+	"\x06Deltas\x12(\n" +
+	"\n" +
+	"timestamps\x18\x01 \x03(\x03B\b\x88\xb5\x18\x01\x98\xb5\x18\x01R\n" +
+	"timestamps\x12%\n" +
+	"\vproduct_ids\x18\x02 \x03(\x05B\x04\x98\xb5\x18\x01R\n" +
+	"productIds\x12\x1e\n" +
+	"\aoffsets\x18\x03 \x03(\x04B\x04\x98\xb5\x18\x01R\aoffsets\x12\x1c\n" +
+	"\x06counts\x18\x04 \x03(\rB\x04\x88\xb5\x18\x01R\x06counts\"\xc7\x01\n" +
+	"\aCatalog\x12 \n" +
+	"\x06region\x18\x01 \x01(\tB\b\x88\xb5\x18\x01\xa0\xb5\x18\x01R\x06region\x12(\n" +
+	"\n" +
+	"currencies\x18\x02 \x03(\tB\b\x88\xb5\x18\x01\xa0\xb5\x18\x01R\n" +
+	"currencies\x12\x1a\n" +
+	"\x05count\x18\x03 \x01(\x05B\x04\x88\xb5\x18\x01R\x05count\x12$\n" +
+	"\n" +
+	"categories\x18\x04 \x03(\tB\x04\xa0\xb5\x18\x01R\n" +
+	"categories\x12\x1a\n" +
+	"\x05owner\x18\x05 \x01(\tB\x04\xa0\xb5\x18\x01R\x05owner\x12\x12\n" +
+	"\x04note\x18\x06 \x01(\tR\x04note:<\n" +
+	"\tis_public\x12\x1d.google.protobuf.FieldOptions\x18ц\x03 \x01(\bR\bisPublic:B\n" +
+	"\fis_sensitive\x12\x1d.google.protobuf.FieldOptions\x18҆\x03 \x01(\bR\visSensitive:I\n" +
+	"\x10is_delta_encoded\x12\x1d.google.protobuf.FieldOptions\x18ӆ\x03 \x01(\bR\x0eisDeltaEncoded:@\n" +
+	"\vis_interned\x12\x1d.google.protobuf.FieldOptions\x18Ԇ\x03 \x01(\bR\n" +
+	"isInternedB\bZ\x06./Testb\x06proto3"
 
 var (
 	file_test_proto_rawDescOnce sync.Once
@@ -737,7 +1175,7 @@ func file_test_proto_rawDescGZIP() []byte {
 	return file_test_proto_rawDescData
 }
 
-var file_test_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_test_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
 var file_test_proto_goTypes = []any{
 	(*Fixed)(nil),                     // 0: Test.Fixed
 	(*Var)(nil),                       // 1: Test.Var
@@ -749,7 +1187,19 @@ var file_test_proto_goTypes = []any{
 	(*Root)(nil),                      // 7: Test.Root
 	(*ComplexMixed)(nil),              // 8: Test.ComplexMixed
 	(*Empty)(nil),                     // 9: Test.Empty
-	(*descriptorpb.FieldOptions)(nil), // 10: google.protobuf.FieldOptions
+	(*Credentials)(nil),               // 10: Test.Credentials
+	(*Labels)(nil),                    // 11: Test.Labels
+	(*WellKnown)(nil),                 // 12: Test.WellKnown
+	(*Deltas)(nil),                    // 13: Test.Deltas
+	(*Catalog)(nil),                   // 14: Test.Catalog
+	nil,                               // 15: Test.Labels.ValuesEntry
+	(*timestamppb.Timestamp)(nil),     // 16: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),       // 17: google.protobuf.Duration
+	(*anypb.Any)(nil),                 // 18: google.protobuf.Any
+	(*structpb.Struct)(nil),           // 19: google.protobuf.Struct
+	(*wrapperspb.StringValue)(nil),    // 20: google.protobuf.StringValue
+	(*wrapperspb.Int64Value)(nil),     // 21: google.protobuf.Int64Value
+	(*descriptorpb.FieldOptions)(nil), // 22: google.protobuf.FieldOptions
 }
 var file_test_proto_depIdxs = []int32{
 	4,  // 0: Test.Level2.leaf:type_name -> Test.Leaf
@@ -757,12 +1207,23 @@ var file_test_proto_depIdxs = []int32{
 	6,  // 2: Test.Root.l1:type_name -> Test.Level1
 	4,  // 3: Test.ComplexMixed.nested_leaf:type_name -> Test.Leaf
 	7,  // 4: Test.ComplexMixed.repeated_nested:type_name -> Test.Root
-	10, // 5: Test.is_public:extendee -> google.protobuf.FieldOptions
-	6,  // [6:6] is the sub-list for method output_type
-	6,  // [6:6] is the sub-list for method input_type
-	6,  // [6:6] is the sub-list for extension type_name
-	5,  // [5:6] is the sub-list for extension extendee
-	0,  // [0:5] is the sub-list for field type_name
+	15, // 5: Test.Labels.values:type_name -> Test.Labels.ValuesEntry
+	16, // 6: Test.WellKnown.created:type_name -> google.protobuf.Timestamp
+	17, // 7: Test.WellKnown.ttl:type_name -> google.protobuf.Duration
+	18, // 8: Test.WellKnown.detail:type_name -> google.protobuf.Any
+	19, // 9: Test.WellKnown.attrs:type_name -> google.protobuf.Struct
+	20, // 10: Test.WellKnown.nickname:type_name -> google.protobuf.StringValue
+	21, // 11: Test.WellKnown.version:type_name -> google.protobuf.Int64Value
+	16, // 12: Test.WellKnown.history:type_name -> google.protobuf.Timestamp
+	22, // 13: Test.is_public:extendee -> google.protobuf.FieldOptions
+	22, // 14: Test.is_sensitive:extendee -> google.protobuf.FieldOptions
+	22, // 15: Test.is_delta_encoded:extendee -> google.protobuf.FieldOptions
+	22, // 16: Test.is_interned:extendee -> google.protobuf.FieldOptions
+	17, // [17:17] is the sub-list for method output_type
+	17, // [17:17] is the sub-list for method input_type
+	17, // [17:17] is the sub-list for extension type_name
+	13, // [13:17] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
 }
 
 func init() { file_test_proto_init() }
@@ -776,8 +1237,8 @@ func file_test_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_test_proto_rawDesc), len(file_test_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   10,
-			NumExtensions: 1,
+			NumMessages:   16,
+			NumExtensions: 4,
 			NumServices:   0,
 		},
 		GoTypes:           file_test_proto_goTypes,
@@ -7,7 +7,7 @@ go install ./protoc-gen-arpc
 cd test
 
 # generate code from the test.proto file
-protoc  --symphony_out=paths=source_relative:. \
+protoc  --symphony_out=paths=source_relative,arena=true,bench=true:. \
         --go_out=paths=source_relative:. \
         test.proto
 
@@ -2,7 +2,15 @@
 package Test
 
 import (
+	schema "github.com/appnet-org/arpc/pkg/schema"
+	serializer "github.com/appnet-org/arpc/pkg/serializer"
+	anypb "google.golang.org/protobuf/types/known/anypb"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	wrapperspb "google.golang.org/protobuf/types/known/wrapperspb"
 	math "math"
+	strings "strings"
 )
 
 import (
@@ -231,6 +239,15 @@ func (m *Fixed) MarshalSymphony() ([]byte, error) {
 }
 
 func (m *Fixed) UnmarshalSymphony(data []byte) error {
+	return m.UnmarshalSymphonyArena(data, nil)
+}
+
+// symphonyArenaFixed identifies Fixed in a serializer.Arena
+var symphonyArenaFixed = serializer.NewArenaType()
+
+// UnmarshalSymphonyArena is UnmarshalSymphony allocating the nested messages from arena,
+// which must not be released while they are in use. A nil arena allocates from the heap.
+func (m *Fixed) UnmarshalSymphonyArena(data []byte, arena *serializer.Arena) error {
 	if len(data) < 13 {
 		return fmt.Errorf("invalid data: too short")
 	}
@@ -333,11 +350,15 @@ func (m FixedRaw) GetFInt32() int32 {
 func (m FixedRaw) GetFInt64() int64 {
 	// ASSERT: Private field requires complete buffer
 	if len(m) < 5 {
-		panic("private getter called on invalid buffer")
+		panic(fmt.Sprintf("private getter FInt64 called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
 	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
-		panic("private getter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter FInt64 called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
 	}
 	// Field 2 (FInt64): fixed-length (8 bytes)
 	if len(m) < offsetToPrivate+1+8 {
@@ -357,11 +378,15 @@ func (m FixedRaw) GetFUint32() uint32 {
 func (m FixedRaw) GetFUint64() uint64 {
 	// ASSERT: Private field requires complete buffer
 	if len(m) < 5 {
-		panic("private getter called on invalid buffer")
+		panic(fmt.Sprintf("private getter FUint64 called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
 	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
-		panic("private getter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter FUint64 called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
 	}
 	// Field 4 (FUint64): fixed-length (8 bytes)
 	if len(m) < offsetToPrivate+9+8 {
@@ -381,11 +406,15 @@ func (m FixedRaw) GetFBool() bool {
 func (m FixedRaw) GetFFloat() float32 {
 	// ASSERT: Private field requires complete buffer
 	if len(m) < 5 {
-		panic("private getter called on invalid buffer")
+		panic(fmt.Sprintf("private getter FFloat called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
 	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
-		panic("private getter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter FFloat called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
 	}
 	// Field 6 (FFloat): fixed-length (4 bytes)
 	if len(m) < offsetToPrivate+17+4 {
@@ -407,7 +436,7 @@ func (m *FixedRaw) SetFInt32(v int32) error {
 	if len(*m) >= 5 {
 		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
-			panic("public setter called on complete buffer")
+			panic(fmt.Sprintf("public setter FInt32 called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
 		}
 	}
 	// Field 1 (FInt32): fixed-length (4 bytes)
@@ -421,11 +450,15 @@ func (m *FixedRaw) SetFInt32(v int32) error {
 func (m *FixedRaw) SetFInt64(v int64) error {
 	// ASSERT: Private field setter requires complete buffer
 	if len(*m) < 5 {
-		panic("private setter called on invalid buffer")
+		panic(fmt.Sprintf("private setter FInt64 called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
-		panic("private setter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter FInt64 called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
 	}
 	// Field 2 (FInt64): fixed-length (8 bytes)
 	if len(*m) < offsetToPrivate+1+8 {
@@ -440,7 +473,7 @@ func (m *FixedRaw) SetFUint32(v uint32) error {
 	if len(*m) >= 5 {
 		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
-			panic("public setter called on complete buffer")
+			panic(fmt.Sprintf("public setter FUint32 called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
 		}
 	}
 	// Field 3 (FUint32): fixed-length (4 bytes)
@@ -454,11 +487,15 @@ func (m *FixedRaw) SetFUint32(v uint32) error {
 func (m *FixedRaw) SetFUint64(v uint64) error {
 	// ASSERT: Private field setter requires complete buffer
 	if len(*m) < 5 {
-		panic("private setter called on invalid buffer")
+		panic(fmt.Sprintf("private setter FUint64 called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
-		panic("private setter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter FUint64 called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
 	}
 	// Field 4 (FUint64): fixed-length (8 bytes)
 	if len(*m) < offsetToPrivate+9+8 {
@@ -473,7 +510,7 @@ func (m *FixedRaw) SetFBool(v bool) error {
 	if len(*m) >= 5 {
 		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
-			panic("public setter called on complete buffer")
+			panic(fmt.Sprintf("public setter FBool called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
 		}
 	}
 	// Field 5 (FBool): fixed-length (1 bytes)
@@ -491,11 +528,15 @@ func (m *FixedRaw) SetFBool(v bool) error {
 func (m *FixedRaw) SetFFloat(v float32) error {
 	// ASSERT: Private field setter requires complete buffer
 	if len(*m) < 5 {
-		panic("private setter called on invalid buffer")
+		panic(fmt.Sprintf("private setter FFloat called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
-		panic("private setter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter FFloat called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
 	}
 	// Field 6 (FFloat): fixed-length (4 bytes)
 	if len(*m) < offsetToPrivate+17+4 {
@@ -510,7 +551,7 @@ func (m *FixedRaw) SetFDouble(v float64) error {
 	if len(*m) >= 5 {
 		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
-			panic("public setter called on complete buffer")
+			panic(fmt.Sprintf("public setter FDouble called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
 		}
 	}
 	// Field 7 (FDouble): fixed-length (8 bytes)
@@ -521,6 +562,61 @@ func (m *FixedRaw) SetFDouble(v float64) error {
 	return nil
 }
 
+// String renders the message in a protobuf-text-like format for debugging.
+// Private fields are omitted when the buffer only holds the public segment.
+func (m FixedRaw) String() string {
+	text, err := m.MarshalText()
+	if err != nil {
+		return fmt.Sprintf("<invalid Fixed: %v>", err)
+	}
+	return string(text)
+}
+
+// MarshalText implements encoding.TextMarshaler using the format of String
+func (m FixedRaw) MarshalText() (text []byte, err error) {
+	if len(m) < 13 || m[0] != 0x01 {
+		return nil, fmt.Errorf("invalid data: too short or wrong public version")
+	}
+	// Getters do not validate offsets against each other, so recover from malformed buffers
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = nil, fmt.Errorf("invalid data: %v", r)
+		}
+	}()
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	hasPrivate := offsetToPrivate < len(m) && m[offsetToPrivate] == 0x01
+	_ = hasPrivate
+	var b strings.Builder
+	if v := m.GetFInt32(); v != 0 {
+		fmt.Fprintf(&b, "f_int32: %v ", v)
+	}
+	if hasPrivate {
+		if v := m.GetFInt64(); v != 0 {
+			fmt.Fprintf(&b, "f_int64: %v ", v)
+		}
+	}
+	if v := m.GetFUint32(); v != 0 {
+		fmt.Fprintf(&b, "f_uint32: %v ", v)
+	}
+	if hasPrivate {
+		if v := m.GetFUint64(); v != 0 {
+			fmt.Fprintf(&b, "f_uint64: %v ", v)
+		}
+	}
+	if m.GetFBool() {
+		b.WriteString("f_bool: true ")
+	}
+	if hasPrivate {
+		if v := m.GetFFloat(); v != 0 {
+			fmt.Fprintf(&b, "f_float: %v ", v)
+		}
+	}
+	if v := m.GetFDouble(); v != 0 {
+		fmt.Fprintf(&b, "f_double: %v ", v)
+	}
+	return []byte(strings.TrimSpace(b.String())), nil
+}
+
 // MarshalSymphonyPublic marshals only the public fields (without header)
 func (m *Var) MarshalSymphonyPublic() ([]byte, error) {
 	size := 0
@@ -596,7 +692,7 @@ func (m *Var) UnmarshalSymphonyPublic(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.VString = string(data[payloadOffset+4 : payloadOffset+4+dataLen])
+				m.VString = serializer.GetString(data[payloadOffset+4 : payloadOffset+4+dataLen])
 			}
 		}
 	}
@@ -623,8 +719,7 @@ func (m *Var) UnmarshalSymphonyPrivate(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.VBytes = make([]byte, dataLen)
-				copy(m.VBytes, data[payloadOffset+4:payloadOffset+4+dataLen])
+				m.VBytes = serializer.GetBytes(data[payloadOffset+4 : payloadOffset+4+dataLen])
 			}
 		}
 	}
@@ -705,6 +800,15 @@ func (m *Var) MarshalSymphony() ([]byte, error) {
 }
 
 func (m *Var) UnmarshalSymphony(data []byte) error {
+	return m.UnmarshalSymphonyArena(data, nil)
+}
+
+// symphonyArenaVar identifies Var in a serializer.Arena
+var symphonyArenaVar = serializer.NewArenaType()
+
+// UnmarshalSymphonyArena is UnmarshalSymphony allocating the nested messages from arena,
+// which must not be released while they are in use. A nil arena allocates from the heap.
+func (m *Var) UnmarshalSymphonyArena(data []byte, arena *serializer.Arena) error {
 	if len(data) < 13 {
 		return fmt.Errorf("invalid data: too short")
 	}
@@ -742,7 +846,7 @@ func (m *Var) UnmarshalSymphony(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.VString = string(data[payloadOffset+4 : payloadOffset+4+dataLen])
+				m.VString = serializer.GetString(data[payloadOffset+4 : payloadOffset+4+dataLen])
 			}
 		}
 	}
@@ -760,8 +864,7 @@ func (m *Var) UnmarshalSymphony(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.VBytes = make([]byte, dataLen)
-				copy(m.VBytes, data[payloadOffset+4:payloadOffset+4+dataLen])
+				m.VBytes = serializer.GetBytes(data[payloadOffset+4 : payloadOffset+4+dataLen])
 			}
 		}
 	}
@@ -796,17 +899,21 @@ func (m VarRaw) GetVString() string {
 	if len(m) < payloadOffset+4+dataLen {
 		return ""
 	}
-	return string(m[payloadOffset+4 : payloadOffset+4+dataLen])
+	return serializer.GetString(m[payloadOffset+4 : payloadOffset+4+dataLen])
 }
 
 func (m VarRaw) GetVBytes() []byte {
 	// ASSERT: Private field requires complete buffer
 	if len(m) < 5 {
-		panic("private getter called on invalid buffer")
+		panic(fmt.Sprintf("private getter VBytes called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
 	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
-		panic("private getter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter VBytes called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
 	}
 	// Field 2 (VBytes): variable-length
 	if len(m) < offsetToPrivate+1+4 {
@@ -824,9 +931,7 @@ func (m VarRaw) GetVBytes() []byte {
 	if len(m) < payloadOffset+4+dataLen {
 		return nil
 	}
-	result := make([]byte, dataLen)
-	copy(result, m[payloadOffset+4:payloadOffset+4+dataLen])
-	return result
+	return serializer.GetBytes(m[payloadOffset+4 : payloadOffset+4+dataLen])
 }
 
 func (m *VarRaw) SetVString(v string) error {
@@ -834,7 +939,7 @@ func (m *VarRaw) SetVString(v string) error {
 	if len(*m) >= 5 {
 		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
-			panic("public setter called on complete buffer")
+			panic(fmt.Sprintf("public setter VString called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
 		}
 	}
 	// Field 1 (VString): variable-length
@@ -890,11 +995,15 @@ func (m *VarRaw) SetVString(v string) error {
 func (m *VarRaw) SetVBytes(v []byte) error {
 	// ASSERT: Private field setter requires complete buffer
 	if len(*m) < 5 {
-		panic("private setter called on invalid buffer")
+		panic(fmt.Sprintf("private setter VBytes called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
-		panic("private setter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter VBytes called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
 	}
 	// Field 2 (VBytes): variable-length
 	if len(*m) < offsetToPrivate+1+4 {
@@ -929,6 +1038,42 @@ func (m *VarRaw) SetVBytes(v []byte) error {
 	return nil
 }
 
+// String renders the message in a protobuf-text-like format for debugging.
+// Private fields are omitted when the buffer only holds the public segment.
+func (m VarRaw) String() string {
+	text, err := m.MarshalText()
+	if err != nil {
+		return fmt.Sprintf("<invalid Var: %v>", err)
+	}
+	return string(text)
+}
+
+// MarshalText implements encoding.TextMarshaler using the format of String
+func (m VarRaw) MarshalText() (text []byte, err error) {
+	if len(m) < 13 || m[0] != 0x01 {
+		return nil, fmt.Errorf("invalid data: too short or wrong public version")
+	}
+	// Getters do not validate offsets against each other, so recover from malformed buffers
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = nil, fmt.Errorf("invalid data: %v", r)
+		}
+	}()
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	hasPrivate := offsetToPrivate < len(m) && m[offsetToPrivate] == 0x01
+	_ = hasPrivate
+	var b strings.Builder
+	if v := m.GetVString(); len(v) > 0 {
+		fmt.Fprintf(&b, "v_string: %q ", v)
+	}
+	if hasPrivate {
+		if v := m.GetVBytes(); len(v) > 0 {
+			fmt.Fprintf(&b, "v_bytes: %q ", v)
+		}
+	}
+	return []byte(strings.TrimSpace(b.String())), nil
+}
+
 // MarshalSymphonyPublic marshals only the public fields (without header)
 func (m *RepeatedFixed) MarshalSymphonyPublic() ([]byte, error) {
 	size := 0
@@ -953,27 +1098,21 @@ func (m *RepeatedFixed) MarshalSymphonyPublic() ([]byte, error) {
 	binary.LittleEndian.PutUint32(buf[tableStart+0:], uint32(payloadStart+payloadOffset))
 	count = len(m.RInt64)
 	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(count))
-	for i, v := range m.RInt64 {
-		binary.LittleEndian.PutUint64(buf[payloadStart+payloadOffset+4+8*i:], uint64(v))
-	}
+	serializer.PutInt64s(buf[payloadStart+payloadOffset+4:], m.RInt64)
 	payloadOffset += 4 + 8*len(m.RInt64)
 
 	// Field 4 (RUint64): repeated fixed-length
 	binary.LittleEndian.PutUint32(buf[tableStart+4:], uint32(payloadStart+payloadOffset))
 	count = len(m.RUint64)
 	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(count))
-	for i, v := range m.RUint64 {
-		binary.LittleEndian.PutUint64(buf[payloadStart+payloadOffset+4+8*i:], v)
-	}
+	serializer.PutUint64s(buf[payloadStart+payloadOffset+4:], m.RUint64)
 	payloadOffset += 4 + 8*len(m.RUint64)
 
 	// Field 6 (RDouble): repeated fixed-length
 	binary.LittleEndian.PutUint32(buf[tableStart+8:], uint32(payloadStart+payloadOffset))
 	count = len(m.RDouble)
 	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(count))
-	for i, v := range m.RDouble {
-		binary.LittleEndian.PutUint64(buf[payloadStart+payloadOffset+4+8*i:], math.Float64bits(v))
-	}
+	serializer.PutFloat64s(buf[payloadStart+payloadOffset+4:], m.RDouble)
 	payloadOffset += 4 + 8*len(m.RDouble)
 
 	return buf, nil
@@ -1004,40 +1143,28 @@ func (m *RepeatedFixed) MarshalSymphonyPrivate() ([]byte, error) {
 	binary.LittleEndian.PutUint32(buf[tableStart+0:], uint32(payloadStart+payloadOffset))
 	count = len(m.RInt32)
 	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(count))
-	for i, v := range m.RInt32 {
-		binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset+4+4*i:], uint32(v))
-	}
+	serializer.PutInt32s(buf[payloadStart+payloadOffset+4:], m.RInt32)
 	payloadOffset += 4 + 4*len(m.RInt32)
 
 	// Field 3 (RUint32): repeated fixed-length
 	binary.LittleEndian.PutUint32(buf[tableStart+4:], uint32(payloadStart+payloadOffset))
 	count = len(m.RUint32)
 	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(count))
-	for i, v := range m.RUint32 {
-		binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset+4+4*i:], v)
-	}
+	serializer.PutUint32s(buf[payloadStart+payloadOffset+4:], m.RUint32)
 	payloadOffset += 4 + 4*len(m.RUint32)
 
 	// Field 5 (RFloat): repeated fixed-length
 	binary.LittleEndian.PutUint32(buf[tableStart+8:], uint32(payloadStart+payloadOffset))
 	count = len(m.RFloat)
 	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(count))
-	for i, v := range m.RFloat {
-		binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset+4+4*i:], math.Float32bits(v))
-	}
+	serializer.PutFloat32s(buf[payloadStart+payloadOffset+4:], m.RFloat)
 	payloadOffset += 4 + 4*len(m.RFloat)
 
 	// Field 7 (RBool): repeated fixed-length
 	binary.LittleEndian.PutUint32(buf[tableStart+12:], uint32(payloadStart+payloadOffset))
 	count = len(m.RBool)
 	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(count))
-	for i, v := range m.RBool {
-		if v {
-			buf[payloadStart+payloadOffset+4+1*i] = 1
-		} else {
-			buf[payloadStart+payloadOffset+4+1*i] = 0
-		}
-	}
+	serializer.PutBools(buf[payloadStart+payloadOffset+4:], m.RBool)
 	payloadOffset += 4 + 1*len(m.RBool)
 
 	return buf, nil
@@ -1063,9 +1190,7 @@ func (m *RepeatedFixed) UnmarshalSymphonyPublic(data []byte) error {
 			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+count*8 {
 				m.RInt64 = make([]int64, count)
-				for i := 0; i < count; i++ {
-					m.RInt64[i] = int64(binary.LittleEndian.Uint64(data[payloadOffset+4+8*i:]))
-				}
+				serializer.GetInt64s(m.RInt64, data[payloadOffset+4:])
 			}
 		}
 	}
@@ -1077,9 +1202,7 @@ func (m *RepeatedFixed) UnmarshalSymphonyPublic(data []byte) error {
 			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+count*8 {
 				m.RUint64 = make([]uint64, count)
-				for i := 0; i < count; i++ {
-					m.RUint64[i] = binary.LittleEndian.Uint64(data[payloadOffset+4+8*i:])
-				}
+				serializer.GetUint64s(m.RUint64, data[payloadOffset+4:])
 			}
 		}
 	}
@@ -1091,9 +1214,7 @@ func (m *RepeatedFixed) UnmarshalSymphonyPublic(data []byte) error {
 			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+count*8 {
 				m.RDouble = make([]float64, count)
-				for i := 0; i < count; i++ {
-					m.RDouble[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[payloadOffset+4+8*i:]))
-				}
+				serializer.GetFloat64s(m.RDouble, data[payloadOffset+4:])
 			}
 		}
 	}
@@ -1121,9 +1242,7 @@ func (m *RepeatedFixed) UnmarshalSymphonyPrivate(data []byte) error {
 			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+count*4 {
 				m.RInt32 = make([]int32, count)
-				for i := 0; i < count; i++ {
-					m.RInt32[i] = int32(binary.LittleEndian.Uint32(data[payloadOffset+4+4*i:]))
-				}
+				serializer.GetInt32s(m.RInt32, data[payloadOffset+4:])
 			}
 		}
 	}
@@ -1135,9 +1254,7 @@ func (m *RepeatedFixed) UnmarshalSymphonyPrivate(data []byte) error {
 			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+count*4 {
 				m.RUint32 = make([]uint32, count)
-				for i := 0; i < count; i++ {
-					m.RUint32[i] = binary.LittleEndian.Uint32(data[payloadOffset+4+4*i:])
-				}
+				serializer.GetUint32s(m.RUint32, data[payloadOffset+4:])
 			}
 		}
 	}
@@ -1149,9 +1266,7 @@ func (m *RepeatedFixed) UnmarshalSymphonyPrivate(data []byte) error {
 			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+count*4 {
 				m.RFloat = make([]float32, count)
-				for i := 0; i < count; i++ {
-					m.RFloat[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[payloadOffset+4+4*i:]))
-				}
+				serializer.GetFloat32s(m.RFloat, data[payloadOffset+4:])
 			}
 		}
 	}
@@ -1163,9 +1278,7 @@ func (m *RepeatedFixed) UnmarshalSymphonyPrivate(data []byte) error {
 			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+count*1 {
 				m.RBool = make([]bool, count)
-				for i := 0; i < count; i++ {
-					m.RBool[i] = data[payloadOffset+4+1*i] != 0
-				}
+				serializer.GetBools(m.RBool, data[payloadOffset+4:])
 			}
 		}
 	}
@@ -1234,27 +1347,21 @@ func (m *RepeatedFixed) MarshalSymphony() ([]byte, error) {
 	binary.LittleEndian.PutUint32(buf[publicTableStart+0:], uint32(publicPayloadStart+publicPayloadOffset))
 	count = len(m.RInt64)
 	binary.LittleEndian.PutUint32(buf[publicPayloadStart+publicPayloadOffset:], uint32(count))
-	for i, v := range m.RInt64 {
-		binary.LittleEndian.PutUint64(buf[publicPayloadStart+publicPayloadOffset+4+8*i:], uint64(v))
-	}
+	serializer.PutInt64s(buf[publicPayloadStart+publicPayloadOffset+4:], m.RInt64)
 	publicPayloadOffset += 4 + 8*len(m.RInt64)
 
 	// Field 4 (RUint64): repeated fixed-length
 	binary.LittleEndian.PutUint32(buf[publicTableStart+4:], uint32(publicPayloadStart+publicPayloadOffset))
 	count = len(m.RUint64)
 	binary.LittleEndian.PutUint32(buf[publicPayloadStart+publicPayloadOffset:], uint32(count))
-	for i, v := range m.RUint64 {
-		binary.LittleEndian.PutUint64(buf[publicPayloadStart+publicPayloadOffset+4+8*i:], v)
-	}
+	serializer.PutUint64s(buf[publicPayloadStart+publicPayloadOffset+4:], m.RUint64)
 	publicPayloadOffset += 4 + 8*len(m.RUint64)
 
 	// Field 6 (RDouble): repeated fixed-length
 	binary.LittleEndian.PutUint32(buf[publicTableStart+8:], uint32(publicPayloadStart+publicPayloadOffset))
 	count = len(m.RDouble)
 	binary.LittleEndian.PutUint32(buf[publicPayloadStart+publicPayloadOffset:], uint32(count))
-	for i, v := range m.RDouble {
-		binary.LittleEndian.PutUint64(buf[publicPayloadStart+publicPayloadOffset+4+8*i:], math.Float64bits(v))
-	}
+	serializer.PutFloat64s(buf[publicPayloadStart+publicPayloadOffset+4:], m.RDouble)
 	publicPayloadOffset += 4 + 8*len(m.RDouble)
 
 	// === PRIVATE SEGMENT ===
@@ -1273,46 +1380,43 @@ func (m *RepeatedFixed) MarshalSymphony() ([]byte, error) {
 	binary.LittleEndian.PutUint32(buf[privateTableStart+0:], uint32((privatePayloadStart+privatePayloadOffset)-privateStart))
 	count = len(m.RInt32)
 	binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset:], uint32(count))
-	for i, v := range m.RInt32 {
-		binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset+4+4*i:], uint32(v))
-	}
+	serializer.PutInt32s(buf[privatePayloadStart+privatePayloadOffset+4:], m.RInt32)
 	privatePayloadOffset += 4 + 4*len(m.RInt32)
 
 	// Field 3 (RUint32): repeated fixed-length
 	binary.LittleEndian.PutUint32(buf[privateTableStart+4:], uint32((privatePayloadStart+privatePayloadOffset)-privateStart))
 	count = len(m.RUint32)
 	binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset:], uint32(count))
-	for i, v := range m.RUint32 {
-		binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset+4+4*i:], v)
-	}
+	serializer.PutUint32s(buf[privatePayloadStart+privatePayloadOffset+4:], m.RUint32)
 	privatePayloadOffset += 4 + 4*len(m.RUint32)
 
 	// Field 5 (RFloat): repeated fixed-length
 	binary.LittleEndian.PutUint32(buf[privateTableStart+8:], uint32((privatePayloadStart+privatePayloadOffset)-privateStart))
 	count = len(m.RFloat)
 	binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset:], uint32(count))
-	for i, v := range m.RFloat {
-		binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset+4+4*i:], math.Float32bits(v))
-	}
+	serializer.PutFloat32s(buf[privatePayloadStart+privatePayloadOffset+4:], m.RFloat)
 	privatePayloadOffset += 4 + 4*len(m.RFloat)
 
 	// Field 7 (RBool): repeated fixed-length
 	binary.LittleEndian.PutUint32(buf[privateTableStart+12:], uint32((privatePayloadStart+privatePayloadOffset)-privateStart))
 	count = len(m.RBool)
 	binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset:], uint32(count))
-	for i, v := range m.RBool {
-		if v {
-			buf[privatePayloadStart+privatePayloadOffset+4+1*i] = 1
-		} else {
-			buf[privatePayloadStart+privatePayloadOffset+4+1*i] = 0
-		}
-	}
+	serializer.PutBools(buf[privatePayloadStart+privatePayloadOffset+4:], m.RBool)
 	privatePayloadOffset += 4 + 1*len(m.RBool)
 
 	return buf, nil
 }
 
 func (m *RepeatedFixed) UnmarshalSymphony(data []byte) error {
+	return m.UnmarshalSymphonyArena(data, nil)
+}
+
+// symphonyArenaRepeatedFixed identifies RepeatedFixed in a serializer.Arena
+var symphonyArenaRepeatedFixed = serializer.NewArenaType()
+
+// UnmarshalSymphonyArena is UnmarshalSymphony allocating the nested messages from arena,
+// which must not be released while they are in use. A nil arena allocates from the heap.
+func (m *RepeatedFixed) UnmarshalSymphonyArena(data []byte, arena *serializer.Arena) error {
 	if len(data) < 13 {
 		return fmt.Errorf("invalid data: too short")
 	}
@@ -1351,9 +1455,7 @@ func (m *RepeatedFixed) UnmarshalSymphony(data []byte) error {
 			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+count*8 {
 				m.RInt64 = make([]int64, count)
-				for i := 0; i < count; i++ {
-					m.RInt64[i] = int64(binary.LittleEndian.Uint64(data[payloadOffset+4+8*i:]))
-				}
+				serializer.GetInt64s(m.RInt64, data[payloadOffset+4:])
 			}
 		}
 	}
@@ -1365,9 +1467,7 @@ func (m *RepeatedFixed) UnmarshalSymphony(data []byte) error {
 			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+count*8 {
 				m.RUint64 = make([]uint64, count)
-				for i := 0; i < count; i++ {
-					m.RUint64[i] = binary.LittleEndian.Uint64(data[payloadOffset+4+8*i:])
-				}
+				serializer.GetUint64s(m.RUint64, data[payloadOffset+4:])
 			}
 		}
 	}
@@ -1379,9 +1479,7 @@ func (m *RepeatedFixed) UnmarshalSymphony(data []byte) error {
 			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+count*8 {
 				m.RDouble = make([]float64, count)
-				for i := 0; i < count; i++ {
-					m.RDouble[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[payloadOffset+4+8*i:]))
-				}
+				serializer.GetFloat64s(m.RDouble, data[payloadOffset+4:])
 			}
 		}
 	}
@@ -1400,9 +1498,7 @@ func (m *RepeatedFixed) UnmarshalSymphony(data []byte) error {
 			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+count*4 {
 				m.RInt32 = make([]int32, count)
-				for i := 0; i < count; i++ {
-					m.RInt32[i] = int32(binary.LittleEndian.Uint32(data[payloadOffset+4+4*i:]))
-				}
+				serializer.GetInt32s(m.RInt32, data[payloadOffset+4:])
 			}
 		}
 	}
@@ -1417,9 +1513,7 @@ func (m *RepeatedFixed) UnmarshalSymphony(data []byte) error {
 			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+count*4 {
 				m.RUint32 = make([]uint32, count)
-				for i := 0; i < count; i++ {
-					m.RUint32[i] = binary.LittleEndian.Uint32(data[payloadOffset+4+4*i:])
-				}
+				serializer.GetUint32s(m.RUint32, data[payloadOffset+4:])
 			}
 		}
 	}
@@ -1434,9 +1528,7 @@ func (m *RepeatedFixed) UnmarshalSymphony(data []byte) error {
 			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+count*4 {
 				m.RFloat = make([]float32, count)
-				for i := 0; i < count; i++ {
-					m.RFloat[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[payloadOffset+4+4*i:]))
-				}
+				serializer.GetFloat32s(m.RFloat, data[payloadOffset+4:])
 			}
 		}
 	}
@@ -1451,9 +1543,7 @@ func (m *RepeatedFixed) UnmarshalSymphony(data []byte) error {
 			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+count*1 {
 				m.RBool = make([]bool, count)
-				for i := 0; i < count; i++ {
-					m.RBool[i] = data[payloadOffset+4+1*i] != 0
-				}
+				serializer.GetBools(m.RBool, data[payloadOffset+4:])
 			}
 		}
 	}
@@ -1475,11 +1565,15 @@ func (m *RepeatedFixedRaw) UnmarshalSymphony(data []byte) error {
 func (m RepeatedFixedRaw) GetRInt32() []int32 {
 	// ASSERT: Private field requires complete buffer
 	if len(m) < 5 {
-		panic("private getter called on invalid buffer")
+		panic(fmt.Sprintf("private getter RInt32 called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
 	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
-		panic("private getter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter RInt32 called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
 	}
 	// Field 1 (RInt32): repeated fixed-length
 	if len(m) < offsetToPrivate+1+4 {
@@ -1498,9 +1592,7 @@ func (m RepeatedFixedRaw) GetRInt32() []int32 {
 		return nil
 	}
 	result := make([]int32, count)
-	for i := 0; i < count; i++ {
-		result[i] = int32(binary.LittleEndian.Uint32(m[payloadOffset+4+4*i:]))
-	}
+	serializer.GetInt32s(result, m[payloadOffset+4:])
 	return result
 }
 
@@ -1521,20 +1613,22 @@ func (m RepeatedFixedRaw) GetRInt64() []int64 {
 		return nil
 	}
 	result := make([]int64, count)
-	for i := 0; i < count; i++ {
-		result[i] = int64(binary.LittleEndian.Uint64(m[payloadOffset+4+8*i:]))
-	}
+	serializer.GetInt64s(result, m[payloadOffset+4:])
 	return result
 }
 
 func (m RepeatedFixedRaw) GetRUint32() []uint32 {
 	// ASSERT: Private field requires complete buffer
 	if len(m) < 5 {
-		panic("private getter called on invalid buffer")
+		panic(fmt.Sprintf("private getter RUint32 called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
 	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
-		panic("private getter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter RUint32 called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
 	}
 	// Field 3 (RUint32): repeated fixed-length
 	if len(m) < offsetToPrivate+5+4 {
@@ -1553,9 +1647,7 @@ func (m RepeatedFixedRaw) GetRUint32() []uint32 {
 		return nil
 	}
 	result := make([]uint32, count)
-	for i := 0; i < count; i++ {
-		result[i] = binary.LittleEndian.Uint32(m[payloadOffset+4+4*i:])
-	}
+	serializer.GetUint32s(result, m[payloadOffset+4:])
 	return result
 }
 
@@ -1576,20 +1668,22 @@ func (m RepeatedFixedRaw) GetRUint64() []uint64 {
 		return nil
 	}
 	result := make([]uint64, count)
-	for i := 0; i < count; i++ {
-		result[i] = binary.LittleEndian.Uint64(m[payloadOffset+4+8*i:])
-	}
+	serializer.GetUint64s(result, m[payloadOffset+4:])
 	return result
 }
 
 func (m RepeatedFixedRaw) GetRFloat() []float32 {
 	// ASSERT: Private field requires complete buffer
 	if len(m) < 5 {
-		panic("private getter called on invalid buffer")
+		panic(fmt.Sprintf("private getter RFloat called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
 	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
-		panic("private getter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter RFloat called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
 	}
 	// Field 5 (RFloat): repeated fixed-length
 	if len(m) < offsetToPrivate+9+4 {
@@ -1608,9 +1702,7 @@ func (m RepeatedFixedRaw) GetRFloat() []float32 {
 		return nil
 	}
 	result := make([]float32, count)
-	for i := 0; i < count; i++ {
-		result[i] = math.Float32frombits(binary.LittleEndian.Uint32(m[payloadOffset+4+4*i:]))
-	}
+	serializer.GetFloat32s(result, m[payloadOffset+4:])
 	return result
 }
 
@@ -1631,20 +1723,22 @@ func (m RepeatedFixedRaw) GetRDouble() []float64 {
 		return nil
 	}
 	result := make([]float64, count)
-	for i := 0; i < count; i++ {
-		result[i] = math.Float64frombits(binary.LittleEndian.Uint64(m[payloadOffset+4+8*i:]))
-	}
+	serializer.GetFloat64s(result, m[payloadOffset+4:])
 	return result
 }
 
 func (m RepeatedFixedRaw) GetRBool() []bool {
 	// ASSERT: Private field requires complete buffer
 	if len(m) < 5 {
-		panic("private getter called on invalid buffer")
+		panic(fmt.Sprintf("private getter RBool called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
 	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
-		panic("private getter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter RBool called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
 	}
 	// Field 7 (RBool): repeated fixed-length
 	if len(m) < offsetToPrivate+13+4 {
@@ -1663,20 +1757,22 @@ func (m RepeatedFixedRaw) GetRBool() []bool {
 		return nil
 	}
 	result := make([]bool, count)
-	for i := 0; i < count; i++ {
-		result[i] = m[payloadOffset+4+1*i] != 0
-	}
+	serializer.GetBools(result, m[payloadOffset+4:])
 	return result
 }
 
 func (m *RepeatedFixedRaw) SetRInt32(v []int32) error {
 	// ASSERT: Private field setter requires complete buffer
 	if len(*m) < 5 {
-		panic("private setter called on invalid buffer")
+		panic(fmt.Sprintf("private setter RInt32 called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
-		panic("private setter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter RInt32 called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
 	}
 	// Field 1 (RInt32): repeated fixed-length
 	if len(*m) < offsetToPrivate+1+4 {
@@ -1697,9 +1793,7 @@ func (m *RepeatedFixedRaw) SetRInt32(v []int32) error {
 	if oldPayloadOffset > 0 && newDataSize <= oldDataSize {
 		// Update in-place (waste space)
 		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(newCount))
-		for i, val := range v {
-			binary.LittleEndian.PutUint32((*m)[oldPayloadOffset+4+4*i:], uint32(val))
-		}
+		serializer.PutInt32s((*m)[oldPayloadOffset+4:], v)
 		return nil
 	}
 	// Need to remarshal: unmarshal, update, marshal
@@ -1721,7 +1815,7 @@ func (m *RepeatedFixedRaw) SetRInt64(v []int64) error {
 	if len(*m) >= 5 {
 		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
-			panic("public setter called on complete buffer")
+			panic(fmt.Sprintf("public setter RInt64 called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
 		}
 	}
 	// Field 2 (RInt64): repeated fixed-length
@@ -1740,9 +1834,7 @@ func (m *RepeatedFixedRaw) SetRInt64(v []int64) error {
 	if oldPayloadOffset > 0 && newDataSize <= oldDataSize {
 		// Update in-place (waste space)
 		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(newCount))
-		for i, val := range v {
-			binary.LittleEndian.PutUint64((*m)[oldPayloadOffset+4+8*i:], uint64(val))
-		}
+		serializer.PutInt64s((*m)[oldPayloadOffset+4:], v)
 		return nil
 	}
 	// Need to remarshal: unmarshal, update, marshal, truncate to public-only
@@ -1782,11 +1874,15 @@ func (m *RepeatedFixedRaw) SetRInt64(v []int64) error {
 func (m *RepeatedFixedRaw) SetRUint32(v []uint32) error {
 	// ASSERT: Private field setter requires complete buffer
 	if len(*m) < 5 {
-		panic("private setter called on invalid buffer")
+		panic(fmt.Sprintf("private setter RUint32 called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
-		panic("private setter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter RUint32 called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
 	}
 	// Field 3 (RUint32): repeated fixed-length
 	if len(*m) < offsetToPrivate+5+4 {
@@ -1807,9 +1903,7 @@ func (m *RepeatedFixedRaw) SetRUint32(v []uint32) error {
 	if oldPayloadOffset > 0 && newDataSize <= oldDataSize {
 		// Update in-place (waste space)
 		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(newCount))
-		for i, val := range v {
-			binary.LittleEndian.PutUint32((*m)[oldPayloadOffset+4+4*i:], val)
-		}
+		serializer.PutUint32s((*m)[oldPayloadOffset+4:], v)
 		return nil
 	}
 	// Need to remarshal: unmarshal, update, marshal
@@ -1831,7 +1925,7 @@ func (m *RepeatedFixedRaw) SetRUint64(v []uint64) error {
 	if len(*m) >= 5 {
 		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
-			panic("public setter called on complete buffer")
+			panic(fmt.Sprintf("public setter RUint64 called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
 		}
 	}
 	// Field 4 (RUint64): repeated fixed-length
@@ -1850,9 +1944,7 @@ func (m *RepeatedFixedRaw) SetRUint64(v []uint64) error {
 	if oldPayloadOffset > 0 && newDataSize <= oldDataSize {
 		// Update in-place (waste space)
 		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(newCount))
-		for i, val := range v {
-			binary.LittleEndian.PutUint64((*m)[oldPayloadOffset+4+8*i:], val)
-		}
+		serializer.PutUint64s((*m)[oldPayloadOffset+4:], v)
 		return nil
 	}
 	// Need to remarshal: unmarshal, update, marshal, truncate to public-only
@@ -1892,11 +1984,15 @@ func (m *RepeatedFixedRaw) SetRUint64(v []uint64) error {
 func (m *RepeatedFixedRaw) SetRFloat(v []float32) error {
 	// ASSERT: Private field setter requires complete buffer
 	if len(*m) < 5 {
-		panic("private setter called on invalid buffer")
+		panic(fmt.Sprintf("private setter RFloat called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
-		panic("private setter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter RFloat called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
 	}
 	// Field 5 (RFloat): repeated fixed-length
 	if len(*m) < offsetToPrivate+9+4 {
@@ -1917,9 +2013,7 @@ func (m *RepeatedFixedRaw) SetRFloat(v []float32) error {
 	if oldPayloadOffset > 0 && newDataSize <= oldDataSize {
 		// Update in-place (waste space)
 		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(newCount))
-		for i, val := range v {
-			binary.LittleEndian.PutUint32((*m)[oldPayloadOffset+4+4*i:], math.Float32bits(val))
-		}
+		serializer.PutFloat32s((*m)[oldPayloadOffset+4:], v)
 		return nil
 	}
 	// Need to remarshal: unmarshal, update, marshal
@@ -1941,7 +2035,7 @@ func (m *RepeatedFixedRaw) SetRDouble(v []float64) error {
 	if len(*m) >= 5 {
 		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
-			panic("public setter called on complete buffer")
+			panic(fmt.Sprintf("public setter RDouble called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
 		}
 	}
 	// Field 6 (RDouble): repeated fixed-length
@@ -1960,9 +2054,7 @@ func (m *RepeatedFixedRaw) SetRDouble(v []float64) error {
 	if oldPayloadOffset > 0 && newDataSize <= oldDataSize {
 		// Update in-place (waste space)
 		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(newCount))
-		for i, val := range v {
-			binary.LittleEndian.PutUint64((*m)[oldPayloadOffset+4+8*i:], math.Float64bits(val))
-		}
+		serializer.PutFloat64s((*m)[oldPayloadOffset+4:], v)
 		return nil
 	}
 	// Need to remarshal: unmarshal, update, marshal, truncate to public-only
@@ -2002,11 +2094,15 @@ func (m *RepeatedFixedRaw) SetRDouble(v []float64) error {
 func (m *RepeatedFixedRaw) SetRBool(v []bool) error {
 	// ASSERT: Private field setter requires complete buffer
 	if len(*m) < 5 {
-		panic("private setter called on invalid buffer")
+		panic(fmt.Sprintf("private setter RBool called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
-		panic("private setter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter RBool called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
 	}
 	// Field 7 (RBool): repeated fixed-length
 	if len(*m) < offsetToPrivate+13+4 {
@@ -2027,13 +2123,7 @@ func (m *RepeatedFixedRaw) SetRBool(v []bool) error {
 	if oldPayloadOffset > 0 && newDataSize <= oldDataSize {
 		// Update in-place (waste space)
 		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(newCount))
-		for i, val := range v {
-			if val {
-				(*m)[oldPayloadOffset+4+1*i] = 1
-			} else {
-				(*m)[oldPayloadOffset+4+1*i] = 0
-			}
-		}
+		serializer.PutBools((*m)[oldPayloadOffset+4:], v)
 		return nil
 	}
 	// Need to remarshal: unmarshal, update, marshal
@@ -2050,6 +2140,63 @@ func (m *RepeatedFixedRaw) SetRBool(v []bool) error {
 	return nil
 }
 
+// String renders the message in a protobuf-text-like format for debugging.
+// Private fields are omitted when the buffer only holds the public segment.
+func (m RepeatedFixedRaw) String() string {
+	text, err := m.MarshalText()
+	if err != nil {
+		return fmt.Sprintf("<invalid RepeatedFixed: %v>", err)
+	}
+	return string(text)
+}
+
+// MarshalText implements encoding.TextMarshaler using the format of String
+func (m RepeatedFixedRaw) MarshalText() (text []byte, err error) {
+	if len(m) < 13 || m[0] != 0x01 {
+		return nil, fmt.Errorf("invalid data: too short or wrong public version")
+	}
+	// Getters do not validate offsets against each other, so recover from malformed buffers
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = nil, fmt.Errorf("invalid data: %v", r)
+		}
+	}()
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	hasPrivate := offsetToPrivate < len(m) && m[offsetToPrivate] == 0x01
+	_ = hasPrivate
+	var b strings.Builder
+	if hasPrivate {
+		for _, v := range m.GetRInt32() {
+			fmt.Fprintf(&b, "r_int32: %v ", v)
+		}
+	}
+	for _, v := range m.GetRInt64() {
+		fmt.Fprintf(&b, "r_int64: %v ", v)
+	}
+	if hasPrivate {
+		for _, v := range m.GetRUint32() {
+			fmt.Fprintf(&b, "r_uint32: %v ", v)
+		}
+	}
+	for _, v := range m.GetRUint64() {
+		fmt.Fprintf(&b, "r_uint64: %v ", v)
+	}
+	if hasPrivate {
+		for _, v := range m.GetRFloat() {
+			fmt.Fprintf(&b, "r_float: %v ", v)
+		}
+	}
+	for _, v := range m.GetRDouble() {
+		fmt.Fprintf(&b, "r_double: %v ", v)
+	}
+	if hasPrivate {
+		for _, v := range m.GetRBool() {
+			fmt.Fprintf(&b, "r_bool: %v ", v)
+		}
+	}
+	return []byte(strings.TrimSpace(b.String())), nil
+}
+
 // MarshalSymphonyPublic marshals only the public fields (without header)
 func (m *RepeatedVar) MarshalSymphonyPublic() ([]byte, error) {
 	size := 0
@@ -2154,7 +2301,7 @@ func (m *RepeatedVar) UnmarshalSymphonyPublic(data []byte) error {
 				if len(data) >= currentOffset+4 {
 					itemLen := int(binary.LittleEndian.Uint32(data[currentOffset:]))
 					if len(data) >= currentOffset+4+itemLen {
-						m.RString = append(m.RString, string(data[currentOffset+4:currentOffset+4+itemLen]))
+						m.RString = append(m.RString, serializer.GetString(data[currentOffset+4:currentOffset+4+itemLen]))
 						currentOffset += 4 + itemLen
 					}
 				}
@@ -2189,9 +2336,7 @@ func (m *RepeatedVar) UnmarshalSymphonyPrivate(data []byte) error {
 				if len(data) >= currentOffset+4 {
 					itemLen := int(binary.LittleEndian.Uint32(data[currentOffset:]))
 					if len(data) >= currentOffset+4+itemLen {
-						itemData := make([]byte, itemLen)
-						copy(itemData, data[currentOffset+4:currentOffset+4+itemLen])
-						m.RBytes = append(m.RBytes, itemData)
+						m.RBytes = append(m.RBytes, serializer.GetBytes(data[currentOffset+4:currentOffset+4+itemLen]))
 						currentOffset += 4 + itemLen
 					}
 				}
@@ -2302,6 +2447,15 @@ func (m *RepeatedVar) MarshalSymphony() ([]byte, error) {
 }
 
 func (m *RepeatedVar) UnmarshalSymphony(data []byte) error {
+	return m.UnmarshalSymphonyArena(data, nil)
+}
+
+// symphonyArenaRepeatedVar identifies RepeatedVar in a serializer.Arena
+var symphonyArenaRepeatedVar = serializer.NewArenaType()
+
+// UnmarshalSymphonyArena is UnmarshalSymphony allocating the nested messages from arena,
+// which must not be released while they are in use. A nil arena allocates from the heap.
+func (m *RepeatedVar) UnmarshalSymphonyArena(data []byte, arena *serializer.Arena) error {
 	if len(data) < 13 {
 		return fmt.Errorf("invalid data: too short")
 	}
@@ -2344,7 +2498,7 @@ func (m *RepeatedVar) UnmarshalSymphony(data []byte) error {
 				if len(data) >= currentOffset+4 {
 					itemLen := int(binary.LittleEndian.Uint32(data[currentOffset:]))
 					if len(data) >= currentOffset+4+itemLen {
-						m.RString = append(m.RString, string(data[currentOffset+4:currentOffset+4+itemLen]))
+						m.RString = append(m.RString, serializer.GetString(data[currentOffset+4:currentOffset+4+itemLen]))
 						currentOffset += 4 + itemLen
 					}
 				}
@@ -2370,9 +2524,7 @@ func (m *RepeatedVar) UnmarshalSymphony(data []byte) error {
 				if len(data) >= currentOffset+4 {
 					itemLen := int(binary.LittleEndian.Uint32(data[currentOffset:]))
 					if len(data) >= currentOffset+4+itemLen {
-						itemData := make([]byte, itemLen)
-						copy(itemData, data[currentOffset+4:currentOffset+4+itemLen])
-						m.RBytes = append(m.RBytes, itemData)
+						m.RBytes = append(m.RBytes, serializer.GetBytes(data[currentOffset+4:currentOffset+4+itemLen]))
 						currentOffset += 4 + itemLen
 					}
 				}
@@ -2417,7 +2569,7 @@ func (m RepeatedVarRaw) GetRString() []string {
 		if len(m) < currentOffset+4+itemLen {
 			return nil
 		}
-		result[i] = string(m[currentOffset+4 : currentOffset+4+itemLen])
+		result[i] = serializer.GetString(m[currentOffset+4 : currentOffset+4+itemLen])
 		currentOffset += 4 + itemLen
 	}
 	return result
@@ -2426,11 +2578,15 @@ func (m RepeatedVarRaw) GetRString() []string {
 func (m RepeatedVarRaw) GetRBytes() [][]byte {
 	// ASSERT: Private field requires complete buffer
 	if len(m) < 5 {
-		panic("private getter called on invalid buffer")
+		panic(fmt.Sprintf("private getter RBytes called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
 	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
-		panic("private getter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter RBytes called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
 	}
 	// Field 2 (RBytes): repeated variable-length
 	if len(m) < offsetToPrivate+1+4 {
@@ -2455,8 +2611,7 @@ func (m RepeatedVarRaw) GetRBytes() [][]byte {
 		if len(m) < currentOffset+4+itemLen {
 			return nil
 		}
-		result[i] = make([]byte, itemLen)
-		copy(result[i], m[currentOffset+4:currentOffset+4+itemLen])
+		result[i] = serializer.GetBytes(m[currentOffset+4 : currentOffset+4+itemLen])
 		currentOffset += 4 + itemLen
 	}
 	return result
@@ -2467,7 +2622,7 @@ func (m *RepeatedVarRaw) SetRString(v []string) error {
 	if len(*m) >= 5 {
 		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
-			panic("public setter called on complete buffer")
+			panic(fmt.Sprintf("public setter RString called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
 		}
 	}
 	// Field 1 (RString): repeated variable-length
@@ -2545,11 +2700,15 @@ func (m *RepeatedVarRaw) SetRString(v []string) error {
 func (m *RepeatedVarRaw) SetRBytes(v [][]byte) error {
 	// ASSERT: Private field setter requires complete buffer
 	if len(*m) < 5 {
-		panic("private setter called on invalid buffer")
+		panic(fmt.Sprintf("private setter RBytes called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
-		panic("private setter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter RBytes called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
 	}
 	// Field 2 (RBytes): repeated variable-length
 	if len(*m) < offsetToPrivate+1+4 {
@@ -2606,6 +2765,42 @@ func (m *RepeatedVarRaw) SetRBytes(v [][]byte) error {
 	return nil
 }
 
+// String renders the message in a protobuf-text-like format for debugging.
+// Private fields are omitted when the buffer only holds the public segment.
+func (m RepeatedVarRaw) String() string {
+	text, err := m.MarshalText()
+	if err != nil {
+		return fmt.Sprintf("<invalid RepeatedVar: %v>", err)
+	}
+	return string(text)
+}
+
+// MarshalText implements encoding.TextMarshaler using the format of String
+func (m RepeatedVarRaw) MarshalText() (text []byte, err error) {
+	if len(m) < 13 || m[0] != 0x01 {
+		return nil, fmt.Errorf("invalid data: too short or wrong public version")
+	}
+	// Getters do not validate offsets against each other, so recover from malformed buffers
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = nil, fmt.Errorf("invalid data: %v", r)
+		}
+	}()
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	hasPrivate := offsetToPrivate < len(m) && m[offsetToPrivate] == 0x01
+	_ = hasPrivate
+	var b strings.Builder
+	for _, v := range m.GetRString() {
+		fmt.Fprintf(&b, "r_string: %q ", v)
+	}
+	if hasPrivate {
+		for _, v := range m.GetRBytes() {
+			fmt.Fprintf(&b, "r_bytes: %q ", v)
+		}
+	}
+	return []byte(strings.TrimSpace(b.String())), nil
+}
+
 // MarshalSymphonyPublic marshals only the public fields (without header)
 func (m *Leaf) MarshalSymphonyPublic() ([]byte, error) {
 	size := 0
@@ -2698,7 +2893,7 @@ func (m *Leaf) UnmarshalSymphonyPrivate(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.LeafVal = string(data[payloadOffset+4 : payloadOffset+4+dataLen])
+				m.LeafVal = serializer.GetString(data[payloadOffset+4 : payloadOffset+4+dataLen])
 			}
 		}
 	}
@@ -2772,6 +2967,15 @@ func (m *Leaf) MarshalSymphony() ([]byte, error) {
 }
 
 func (m *Leaf) UnmarshalSymphony(data []byte) error {
+	return m.UnmarshalSymphonyArena(data, nil)
+}
+
+// symphonyArenaLeaf identifies Leaf in a serializer.Arena
+var symphonyArenaLeaf = serializer.NewArenaType()
+
+// UnmarshalSymphonyArena is UnmarshalSymphony allocating the nested messages from arena,
+// which must not be released while they are in use. A nil arena allocates from the heap.
+func (m *Leaf) UnmarshalSymphonyArena(data []byte, arena *serializer.Arena) error {
 	if len(data) < 13 {
 		return fmt.Errorf("invalid data: too short")
 	}
@@ -2822,7 +3026,7 @@ func (m *Leaf) UnmarshalSymphony(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.LeafVal = string(data[payloadOffset+4 : payloadOffset+4+dataLen])
+				m.LeafVal = serializer.GetString(data[payloadOffset+4 : payloadOffset+4+dataLen])
 			}
 		}
 	}
@@ -2852,11 +3056,15 @@ func (m LeafRaw) GetLeafId() int32 {
 func (m LeafRaw) GetLeafVal() string {
 	// ASSERT: Private field requires complete buffer
 	if len(m) < 5 {
-		panic("private getter called on invalid buffer")
+		panic(fmt.Sprintf("private getter LeafVal called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
 	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
-		panic("private getter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter LeafVal called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
 	}
 	// Field 2 (LeafVal): variable-length
 	if len(m) < offsetToPrivate+1+4 {
@@ -2874,7 +3082,7 @@ func (m LeafRaw) GetLeafVal() string {
 	if len(m) < payloadOffset+4+dataLen {
 		return ""
 	}
-	return string(m[payloadOffset+4 : payloadOffset+4+dataLen])
+	return serializer.GetString(m[payloadOffset+4 : payloadOffset+4+dataLen])
 }
 
 func (m *LeafRaw) SetLeafId(v int32) error {
@@ -2882,7 +3090,7 @@ func (m *LeafRaw) SetLeafId(v int32) error {
 	if len(*m) >= 5 {
 		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
-			panic("public setter called on complete buffer")
+			panic(fmt.Sprintf("public setter LeafId called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
 		}
 	}
 	// Field 1 (LeafId): fixed-length (4 bytes)
@@ -2896,11 +3104,15 @@ func (m *LeafRaw) SetLeafId(v int32) error {
 func (m *LeafRaw) SetLeafVal(v string) error {
 	// ASSERT: Private field setter requires complete buffer
 	if len(*m) < 5 {
-		panic("private setter called on invalid buffer")
+		panic(fmt.Sprintf("private setter LeafVal called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
-		panic("private setter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter LeafVal called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
 	}
 	// Field 2 (LeafVal): variable-length
 	if len(*m) < offsetToPrivate+1+4 {
@@ -2935,6 +3147,42 @@ func (m *LeafRaw) SetLeafVal(v string) error {
 	return nil
 }
 
+// String renders the message in a protobuf-text-like format for debugging.
+// Private fields are omitted when the buffer only holds the public segment.
+func (m LeafRaw) String() string {
+	text, err := m.MarshalText()
+	if err != nil {
+		return fmt.Sprintf("<invalid Leaf: %v>", err)
+	}
+	return string(text)
+}
+
+// MarshalText implements encoding.TextMarshaler using the format of String
+func (m LeafRaw) MarshalText() (text []byte, err error) {
+	if len(m) < 13 || m[0] != 0x01 {
+		return nil, fmt.Errorf("invalid data: too short or wrong public version")
+	}
+	// Getters do not validate offsets against each other, so recover from malformed buffers
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = nil, fmt.Errorf("invalid data: %v", r)
+		}
+	}()
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	hasPrivate := offsetToPrivate < len(m) && m[offsetToPrivate] == 0x01
+	_ = hasPrivate
+	var b strings.Builder
+	if v := m.GetLeafId(); v != 0 {
+		fmt.Fprintf(&b, "leaf_id: %v ", v)
+	}
+	if hasPrivate {
+		if v := m.GetLeafVal(); len(v) > 0 {
+			fmt.Fprintf(&b, "leaf_val: %q ", v)
+		}
+	}
+	return []byte(strings.TrimSpace(b.String())), nil
+}
+
 // MarshalSymphonyPublic marshals only the public fields (without header)
 func (m *Level2) MarshalSymphonyPublic() ([]byte, error) {
 	size := 0
@@ -2991,6 +3239,7 @@ func (m *Level2) UnmarshalSymphonyPublic(data []byte) error {
 	_ = currentOffset
 	tableStart := 0
 	_ = tableStart
+	var arena *serializer.Arena // nested messages of a segment come from the heap
 
 	// Field 1 (Leaf): nested message
 	if len(data) >= tableStart+0+4 {
@@ -2998,8 +3247,8 @@ func (m *Level2) UnmarshalSymphonyPublic(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.Leaf = &Leaf{}
-				if err := m.Leaf.UnmarshalSymphony(data[payloadOffset+4 : payloadOffset+4+dataLen]); err != nil {
+				m.Leaf = serializer.ArenaNew[Leaf](arena, symphonyArenaLeaf)
+				if err := m.Leaf.UnmarshalSymphonyArena(data[payloadOffset+4:payloadOffset+4+dataLen], arena); err != nil {
 					return fmt.Errorf("failed to unmarshal nested message: %w", err)
 				}
 			}
@@ -3101,6 +3350,15 @@ func (m *Level2) MarshalSymphony() ([]byte, error) {
 }
 
 func (m *Level2) UnmarshalSymphony(data []byte) error {
+	return m.UnmarshalSymphonyArena(data, nil)
+}
+
+// symphonyArenaLevel2 identifies Level2 in a serializer.Arena
+var symphonyArenaLevel2 = serializer.NewArenaType()
+
+// UnmarshalSymphonyArena is UnmarshalSymphony allocating the nested messages from arena,
+// which must not be released while they are in use. A nil arena allocates from the heap.
+func (m *Level2) UnmarshalSymphonyArena(data []byte, arena *serializer.Arena) error {
 	if len(data) < 13 {
 		return fmt.Errorf("invalid data: too short")
 	}
@@ -3138,8 +3396,8 @@ func (m *Level2) UnmarshalSymphony(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.Leaf = &Leaf{}
-				if err := m.Leaf.UnmarshalSymphony(data[payloadOffset+4 : payloadOffset+4+dataLen]); err != nil {
+				m.Leaf = serializer.ArenaNew[Leaf](arena, symphonyArenaLeaf)
+				if err := m.Leaf.UnmarshalSymphonyArena(data[payloadOffset+4:payloadOffset+4+dataLen], arena); err != nil {
 					return fmt.Errorf("failed to unmarshal nested message: %w", err)
 				}
 			}
@@ -3188,7 +3446,7 @@ func (m *Level2Raw) SetLeaf(v LeafRaw) error {
 	if len(*m) >= 5 {
 		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
-			panic("public setter called on complete buffer")
+			panic(fmt.Sprintf("public setter Leaf called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
 		}
 	}
 	// Field 1 (Leaf): nested message
@@ -3235,6 +3493,37 @@ func (m *Level2Raw) SetLeaf(v LeafRaw) error {
 	return nil
 }
 
+// String renders the message in a protobuf-text-like format for debugging.
+// Private fields are omitted when the buffer only holds the public segment.
+func (m Level2Raw) String() string {
+	text, err := m.MarshalText()
+	if err != nil {
+		return fmt.Sprintf("<invalid Level2: %v>", err)
+	}
+	return string(text)
+}
+
+// MarshalText implements encoding.TextMarshaler using the format of String
+func (m Level2Raw) MarshalText() (text []byte, err error) {
+	if len(m) < 13 || m[0] != 0x01 {
+		return nil, fmt.Errorf("invalid data: too short or wrong public version")
+	}
+	// Getters do not validate offsets against each other, so recover from malformed buffers
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = nil, fmt.Errorf("invalid data: %v", r)
+		}
+	}()
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	hasPrivate := offsetToPrivate < len(m) && m[offsetToPrivate] == 0x01
+	_ = hasPrivate
+	var b strings.Builder
+	if v := m.GetLeaf(); v != nil {
+		fmt.Fprintf(&b, "leaf { %s } ", v)
+	}
+	return []byte(strings.TrimSpace(b.String())), nil
+}
+
 // MarshalSymphonyPublic marshals only the public fields (without header)
 func (m *Level1) MarshalSymphonyPublic() ([]byte, error) {
 	size := 0
@@ -3321,7 +3610,7 @@ func (m *Level1) UnmarshalSymphonyPublic(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.L1Data = string(data[payloadOffset+4 : payloadOffset+4+dataLen])
+				m.L1Data = serializer.GetString(data[payloadOffset+4 : payloadOffset+4+dataLen])
 			}
 		}
 	}
@@ -3341,6 +3630,7 @@ func (m *Level1) UnmarshalSymphonyPrivate(data []byte) error {
 	_ = currentOffset
 	tableStart := 0
 	_ = tableStart
+	var arena *serializer.Arena // nested messages of a segment come from the heap
 
 	// Field 1 (L2): nested message
 	if len(data) >= tableStart+0+4 {
@@ -3348,8 +3638,8 @@ func (m *Level1) UnmarshalSymphonyPrivate(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.L2 = &Level2{}
-				if err := m.L2.UnmarshalSymphony(data[payloadOffset+4 : payloadOffset+4+dataLen]); err != nil {
+				m.L2 = serializer.ArenaNew[Level2](arena, symphonyArenaLevel2)
+				if err := m.L2.UnmarshalSymphonyArena(data[payloadOffset+4:payloadOffset+4+dataLen], arena); err != nil {
 					return fmt.Errorf("failed to unmarshal nested message: %w", err)
 				}
 			}
@@ -3465,6 +3755,15 @@ func (m *Level1) MarshalSymphony() ([]byte, error) {
 }
 
 func (m *Level1) UnmarshalSymphony(data []byte) error {
+	return m.UnmarshalSymphonyArena(data, nil)
+}
+
+// symphonyArenaLevel1 identifies Level1 in a serializer.Arena
+var symphonyArenaLevel1 = serializer.NewArenaType()
+
+// UnmarshalSymphonyArena is UnmarshalSymphony allocating the nested messages from arena,
+// which must not be released while they are in use. A nil arena allocates from the heap.
+func (m *Level1) UnmarshalSymphonyArena(data []byte, arena *serializer.Arena) error {
 	if len(data) < 13 {
 		return fmt.Errorf("invalid data: too short")
 	}
@@ -3502,7 +3801,7 @@ func (m *Level1) UnmarshalSymphony(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.L1Data = string(data[payloadOffset+4 : payloadOffset+4+dataLen])
+				m.L1Data = serializer.GetString(data[payloadOffset+4 : payloadOffset+4+dataLen])
 			}
 		}
 	}
@@ -3520,8 +3819,8 @@ func (m *Level1) UnmarshalSymphony(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.L2 = &Level2{}
-				if err := m.L2.UnmarshalSymphony(data[payloadOffset+4 : payloadOffset+4+dataLen]); err != nil {
+				m.L2 = serializer.ArenaNew[Level2](arena, symphonyArenaLevel2)
+				if err := m.L2.UnmarshalSymphonyArena(data[payloadOffset+4:payloadOffset+4+dataLen], arena); err != nil {
 					return fmt.Errorf("failed to unmarshal nested message: %w", err)
 				}
 			}
@@ -3545,11 +3844,15 @@ func (m *Level1Raw) UnmarshalSymphony(data []byte) error {
 func (m Level1Raw) GetL2() Level2Raw {
 	// ASSERT: Private field requires complete buffer
 	if len(m) < 5 {
-		panic("private getter called on invalid buffer")
+		panic(fmt.Sprintf("private getter L2 called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
 	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
-		panic("private getter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter L2 called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
 	}
 	// Field 1 (L2): nested message
 	if len(m) < offsetToPrivate+1+4 {
@@ -3586,17 +3889,21 @@ func (m Level1Raw) GetL1Data() string {
 	if len(m) < payloadOffset+4+dataLen {
 		return ""
 	}
-	return string(m[payloadOffset+4 : payloadOffset+4+dataLen])
+	return serializer.GetString(m[payloadOffset+4 : payloadOffset+4+dataLen])
 }
 
 func (m *Level1Raw) SetL2(v Level2Raw) error {
 	// ASSERT: Private field setter requires complete buffer
 	if len(*m) < 5 {
-		panic("private setter called on invalid buffer")
+		panic(fmt.Sprintf("private setter L2 called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
-		panic("private setter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter L2 called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
 	}
 	// Field 1 (L2): nested message
 	if len(*m) < offsetToPrivate+1+4 {
@@ -3641,7 +3948,7 @@ func (m *Level1Raw) SetL1Data(v string) error {
 	if len(*m) >= 5 {
 		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
-			panic("public setter called on complete buffer")
+			panic(fmt.Sprintf("public setter L1Data called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
 		}
 	}
 	// Field 2 (L1Data): variable-length
@@ -3694,6 +4001,42 @@ func (m *Level1Raw) SetL1Data(v string) error {
 	return nil
 }
 
+// String renders the message in a protobuf-text-like format for debugging.
+// Private fields are omitted when the buffer only holds the public segment.
+func (m Level1Raw) String() string {
+	text, err := m.MarshalText()
+	if err != nil {
+		return fmt.Sprintf("<invalid Level1: %v>", err)
+	}
+	return string(text)
+}
+
+// MarshalText implements encoding.TextMarshaler using the format of String
+func (m Level1Raw) MarshalText() (text []byte, err error) {
+	if len(m) < 13 || m[0] != 0x01 {
+		return nil, fmt.Errorf("invalid data: too short or wrong public version")
+	}
+	// Getters do not validate offsets against each other, so recover from malformed buffers
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = nil, fmt.Errorf("invalid data: %v", r)
+		}
+	}()
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	hasPrivate := offsetToPrivate < len(m) && m[offsetToPrivate] == 0x01
+	_ = hasPrivate
+	var b strings.Builder
+	if hasPrivate {
+		if v := m.GetL2(); v != nil {
+			fmt.Fprintf(&b, "l2 { %s } ", v)
+		}
+	}
+	if v := m.GetL1Data(); len(v) > 0 {
+		fmt.Fprintf(&b, "l1_data: %q ", v)
+	}
+	return []byte(strings.TrimSpace(b.String())), nil
+}
+
 // MarshalSymphonyPublic marshals only the public fields (without header)
 func (m *Root) MarshalSymphonyPublic() ([]byte, error) {
 	size := 0
@@ -3768,6 +4111,7 @@ func (m *Root) UnmarshalSymphonyPublic(data []byte) error {
 	_ = currentOffset
 	tableStart := 0
 	_ = tableStart
+	var arena *serializer.Arena // nested messages of a segment come from the heap
 
 	// Field 1 (L1): nested message
 	if len(data) >= tableStart+0+4 {
@@ -3775,8 +4119,8 @@ func (m *Root) UnmarshalSymphonyPublic(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.L1 = &Level1{}
-				if err := m.L1.UnmarshalSymphony(data[payloadOffset+4 : payloadOffset+4+dataLen]); err != nil {
+				m.L1 = serializer.ArenaNew[Level1](arena, symphonyArenaLevel1)
+				if err := m.L1.UnmarshalSymphonyArena(data[payloadOffset+4:payloadOffset+4+dataLen], arena); err != nil {
 					return fmt.Errorf("failed to unmarshal nested message: %w", err)
 				}
 			}
@@ -3926,6 +4270,15 @@ func (m *Root) MarshalSymphony() ([]byte, error) {
 }
 
 func (m *Root) UnmarshalSymphony(data []byte) error {
+	return m.UnmarshalSymphonyArena(data, nil)
+}
+
+// symphonyArenaRoot identifies Root in a serializer.Arena
+var symphonyArenaRoot = serializer.NewArenaType()
+
+// UnmarshalSymphonyArena is UnmarshalSymphony allocating the nested messages from arena,
+// which must not be released while they are in use. A nil arena allocates from the heap.
+func (m *Root) UnmarshalSymphonyArena(data []byte, arena *serializer.Arena) error {
 	if len(data) < 13 {
 		return fmt.Errorf("invalid data: too short")
 	}
@@ -3963,8 +4316,8 @@ func (m *Root) UnmarshalSymphony(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.L1 = &Level1{}
-				if err := m.L1.UnmarshalSymphony(data[payloadOffset+4 : payloadOffset+4+dataLen]); err != nil {
+				m.L1 = serializer.ArenaNew[Level1](arena, symphonyArenaLevel1)
+				if err := m.L1.UnmarshalSymphonyArena(data[payloadOffset+4:payloadOffset+4+dataLen], arena); err != nil {
 					return fmt.Errorf("failed to unmarshal nested message: %w", err)
 				}
 			}
@@ -4017,11 +4370,15 @@ func (m RootRaw) GetL1() Level1Raw {
 func (m RootRaw) GetRootId() int32 {
 	// ASSERT: Private field requires complete buffer
 	if len(m) < 5 {
-		panic("private getter called on invalid buffer")
+		panic(fmt.Sprintf("private getter RootId called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
 	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
-		panic("private getter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter RootId called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
 	}
 	// Field 2 (RootId): fixed-length (4 bytes)
 	if len(m) < offsetToPrivate+1+4 {
@@ -4035,7 +4392,7 @@ func (m *RootRaw) SetL1(v Level1Raw) error {
 	if len(*m) >= 5 {
 		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
-			panic("public setter called on complete buffer")
+			panic(fmt.Sprintf("public setter L1 called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
 		}
 	}
 	// Field 1 (L1): nested message
@@ -4085,11 +4442,15 @@ func (m *RootRaw) SetL1(v Level1Raw) error {
 func (m *RootRaw) SetRootId(v int32) error {
 	// ASSERT: Private field setter requires complete buffer
 	if len(*m) < 5 {
-		panic("private setter called on invalid buffer")
+		panic(fmt.Sprintf("private setter RootId called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
-		panic("private setter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter RootId called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
 	}
 	// Field 2 (RootId): fixed-length (4 bytes)
 	if len(*m) < offsetToPrivate+1+4 {
@@ -4099,6 +4460,42 @@ func (m *RootRaw) SetRootId(v int32) error {
 	return nil
 }
 
+// String renders the message in a protobuf-text-like format for debugging.
+// Private fields are omitted when the buffer only holds the public segment.
+func (m RootRaw) String() string {
+	text, err := m.MarshalText()
+	if err != nil {
+		return fmt.Sprintf("<invalid Root: %v>", err)
+	}
+	return string(text)
+}
+
+// MarshalText implements encoding.TextMarshaler using the format of String
+func (m RootRaw) MarshalText() (text []byte, err error) {
+	if len(m) < 13 || m[0] != 0x01 {
+		return nil, fmt.Errorf("invalid data: too short or wrong public version")
+	}
+	// Getters do not validate offsets against each other, so recover from malformed buffers
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = nil, fmt.Errorf("invalid data: %v", r)
+		}
+	}()
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	hasPrivate := offsetToPrivate < len(m) && m[offsetToPrivate] == 0x01
+	_ = hasPrivate
+	var b strings.Builder
+	if v := m.GetL1(); v != nil {
+		fmt.Fprintf(&b, "l1 { %s } ", v)
+	}
+	if hasPrivate {
+		if v := m.GetRootId(); v != 0 {
+			fmt.Fprintf(&b, "root_id: %v ", v)
+		}
+	}
+	return []byte(strings.TrimSpace(b.String())), nil
+}
+
 // MarshalSymphonyPublic marshals only the public fields (without header)
 func (m *ComplexMixed) MarshalSymphonyPublic() ([]byte, error) {
 	size := 0
@@ -4195,9 +4592,7 @@ func (m *ComplexMixed) MarshalSymphonyPrivate() ([]byte, error) {
 	binary.LittleEndian.PutUint32(buf[tableStart+4:], uint32(payloadStart+payloadOffset))
 	count = len(m.RInt64)
 	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(count))
-	for i, v := range m.RInt64 {
-		binary.LittleEndian.PutUint64(buf[payloadStart+payloadOffset+4+8*i:], uint64(v))
-	}
+	serializer.PutInt64s(buf[payloadStart+payloadOffset+4:], m.RInt64)
 	payloadOffset += 4 + 8*len(m.RInt64)
 
 	// Field 5 (RString): repeated variable-length
@@ -4249,6 +4644,7 @@ func (m *ComplexMixed) UnmarshalSymphonyPublic(data []byte) error {
 	_ = currentOffset
 	tableStart := 0
 	_ = tableStart
+	var arena *serializer.Arena // nested messages of a segment come from the heap
 
 	// Field 2 (VString): variable-length
 	if len(data) >= tableStart+0+4 {
@@ -4256,7 +4652,7 @@ func (m *ComplexMixed) UnmarshalSymphonyPublic(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.VString = string(data[payloadOffset+4 : payloadOffset+4+dataLen])
+				m.VString = serializer.GetString(data[payloadOffset+4 : payloadOffset+4+dataLen])
 			}
 		}
 	}
@@ -4267,8 +4663,8 @@ func (m *ComplexMixed) UnmarshalSymphonyPublic(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.NestedLeaf = &Leaf{}
-				if err := m.NestedLeaf.UnmarshalSymphony(data[payloadOffset+4 : payloadOffset+4+dataLen]); err != nil {
+				m.NestedLeaf = serializer.ArenaNew[Leaf](arena, symphonyArenaLeaf)
+				if err := m.NestedLeaf.UnmarshalSymphonyArena(data[payloadOffset+4:payloadOffset+4+dataLen], arena); err != nil {
 					return fmt.Errorf("failed to unmarshal nested message: %w", err)
 				}
 			}
@@ -4287,8 +4683,7 @@ func (m *ComplexMixed) UnmarshalSymphonyPublic(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.VBytes = make([]byte, dataLen)
-				copy(m.VBytes, data[payloadOffset+4:payloadOffset+4+dataLen])
+				m.VBytes = serializer.GetBytes(data[payloadOffset+4 : payloadOffset+4+dataLen])
 			}
 		}
 	}
@@ -4308,6 +4703,7 @@ func (m *ComplexMixed) UnmarshalSymphonyPrivate(data []byte) error {
 	_ = currentOffset
 	tableStart := 0
 	_ = tableStart
+	var arena *serializer.Arena // nested messages of a segment come from the heap
 
 	// Field 1 (FInt32): fixed-length (4 bytes)
 	if len(data) < tableStart+4 {
@@ -4322,9 +4718,7 @@ func (m *ComplexMixed) UnmarshalSymphonyPrivate(data []byte) error {
 			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+count*8 {
 				m.RInt64 = make([]int64, count)
-				for i := 0; i < count; i++ {
-					m.RInt64[i] = int64(binary.LittleEndian.Uint64(data[payloadOffset+4+8*i:]))
-				}
+				serializer.GetInt64s(m.RInt64, data[payloadOffset+4:])
 			}
 		}
 	}
@@ -4340,7 +4734,7 @@ func (m *ComplexMixed) UnmarshalSymphonyPrivate(data []byte) error {
 				if len(data) >= currentOffset+4 {
 					itemLen := int(binary.LittleEndian.Uint32(data[currentOffset:]))
 					if len(data) >= currentOffset+4+itemLen {
-						m.RString = append(m.RString, string(data[currentOffset+4:currentOffset+4+itemLen]))
+						m.RString = append(m.RString, serializer.GetString(data[currentOffset+4:currentOffset+4+itemLen]))
 						currentOffset += 4 + itemLen
 					}
 				}
@@ -4359,8 +4753,8 @@ func (m *ComplexMixed) UnmarshalSymphonyPrivate(data []byte) error {
 				if len(data) >= currentOffset+4 {
 					itemLen := int(binary.LittleEndian.Uint32(data[currentOffset:]))
 					if len(data) >= currentOffset+4+itemLen {
-						item := &Root{}
-						if err := item.UnmarshalSymphony(data[currentOffset+4 : currentOffset+4+itemLen]); err != nil {
+						item := serializer.ArenaNew[Root](arena, symphonyArenaRoot)
+						if err := item.UnmarshalSymphonyArena(data[currentOffset+4:currentOffset+4+itemLen], arena); err != nil {
 							return fmt.Errorf("failed to unmarshal nested message: %w", err)
 						}
 						m.RepeatedNested = append(m.RepeatedNested, item)
@@ -4558,9 +4952,7 @@ func (m *ComplexMixed) MarshalSymphony() ([]byte, error) {
 	binary.LittleEndian.PutUint32(buf[privateTableStart+4:], uint32((privatePayloadStart+privatePayloadOffset)-privateStart))
 	count = len(m.RInt64)
 	binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset:], uint32(count))
-	for i, v := range m.RInt64 {
-		binary.LittleEndian.PutUint64(buf[privatePayloadStart+privatePayloadOffset+4+8*i:], uint64(v))
-	}
+	serializer.PutInt64s(buf[privatePayloadStart+privatePayloadOffset+4:], m.RInt64)
 	privatePayloadOffset += 4 + 8*len(m.RInt64)
 
 	// Field 5 (RString): repeated variable-length
@@ -4601,6 +4993,15 @@ func (m *ComplexMixed) MarshalSymphony() ([]byte, error) {
 }
 
 func (m *ComplexMixed) UnmarshalSymphony(data []byte) error {
+	return m.UnmarshalSymphonyArena(data, nil)
+}
+
+// symphonyArenaComplexMixed identifies ComplexMixed in a serializer.Arena
+var symphonyArenaComplexMixed = serializer.NewArenaType()
+
+// UnmarshalSymphonyArena is UnmarshalSymphony allocating the nested messages from arena,
+// which must not be released while they are in use. A nil arena allocates from the heap.
+func (m *ComplexMixed) UnmarshalSymphonyArena(data []byte, arena *serializer.Arena) error {
 	if len(data) < 13 {
 		return fmt.Errorf("invalid data: too short")
 	}
@@ -4638,7 +5039,7 @@ func (m *ComplexMixed) UnmarshalSymphony(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.VString = string(data[payloadOffset+4 : payloadOffset+4+dataLen])
+				m.VString = serializer.GetString(data[payloadOffset+4 : payloadOffset+4+dataLen])
 			}
 		}
 	}
@@ -4649,8 +5050,8 @@ func (m *ComplexMixed) UnmarshalSymphony(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.NestedLeaf = &Leaf{}
-				if err := m.NestedLeaf.UnmarshalSymphony(data[payloadOffset+4 : payloadOffset+4+dataLen]); err != nil {
+				m.NestedLeaf = serializer.ArenaNew[Leaf](arena, symphonyArenaLeaf)
+				if err := m.NestedLeaf.UnmarshalSymphonyArena(data[payloadOffset+4:payloadOffset+4+dataLen], arena); err != nil {
 					return fmt.Errorf("failed to unmarshal nested message: %w", err)
 				}
 			}
@@ -4669,8 +5070,7 @@ func (m *ComplexMixed) UnmarshalSymphony(data []byte) error {
 		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
 			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+dataLen {
-				m.VBytes = make([]byte, dataLen)
-				copy(m.VBytes, data[payloadOffset+4:payloadOffset+4+dataLen])
+				m.VBytes = serializer.GetBytes(data[payloadOffset+4 : payloadOffset+4+dataLen])
 			}
 		}
 	}
@@ -4695,9 +5095,7 @@ func (m *ComplexMixed) UnmarshalSymphony(data []byte) error {
 			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
 			if len(data) >= payloadOffset+4+count*8 {
 				m.RInt64 = make([]int64, count)
-				for i := 0; i < count; i++ {
-					m.RInt64[i] = int64(binary.LittleEndian.Uint64(data[payloadOffset+4+8*i:]))
-				}
+				serializer.GetInt64s(m.RInt64, data[payloadOffset+4:])
 			}
 		}
 	}
@@ -4716,7 +5114,7 @@ func (m *ComplexMixed) UnmarshalSymphony(data []byte) error {
 				if len(data) >= currentOffset+4 {
 					itemLen := int(binary.LittleEndian.Uint32(data[currentOffset:]))
 					if len(data) >= currentOffset+4+itemLen {
-						m.RString = append(m.RString, string(data[currentOffset+4:currentOffset+4+itemLen]))
+						m.RString = append(m.RString, serializer.GetString(data[currentOffset+4:currentOffset+4+itemLen]))
 						currentOffset += 4 + itemLen
 					}
 				}
@@ -4738,8 +5136,8 @@ func (m *ComplexMixed) UnmarshalSymphony(data []byte) error {
 				if len(data) >= currentOffset+4 {
 					itemLen := int(binary.LittleEndian.Uint32(data[currentOffset:]))
 					if len(data) >= currentOffset+4+itemLen {
-						item := &Root{}
-						if err := item.UnmarshalSymphony(data[currentOffset+4 : currentOffset+4+itemLen]); err != nil {
+						item := serializer.ArenaNew[Root](arena, symphonyArenaRoot)
+						if err := item.UnmarshalSymphonyArena(data[currentOffset+4:currentOffset+4+itemLen], arena); err != nil {
 							return fmt.Errorf("failed to unmarshal nested message: %w", err)
 						}
 						m.RepeatedNested = append(m.RepeatedNested, item)
@@ -4767,11 +5165,15 @@ func (m *ComplexMixedRaw) UnmarshalSymphony(data []byte) error {
 func (m ComplexMixedRaw) GetFInt32() int32 {
 	// ASSERT: Private field requires complete buffer
 	if len(m) < 5 {
-		panic("private getter called on invalid buffer")
+		panic(fmt.Sprintf("private getter FInt32 called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
 	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
-		panic("private getter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter FInt32 called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
 	}
 	// Field 1 (FInt32): fixed-length (4 bytes)
 	if len(m) < offsetToPrivate+1+4 {
@@ -4796,17 +5198,21 @@ func (m ComplexMixedRaw) GetVString() string {
 	if len(m) < payloadOffset+4+dataLen {
 		return ""
 	}
-	return string(m[payloadOffset+4 : payloadOffset+4+dataLen])
+	return serializer.GetString(m[payloadOffset+4 : payloadOffset+4+dataLen])
 }
 
 func (m ComplexMixedRaw) GetRInt64() []int64 {
 	// ASSERT: Private field requires complete buffer
 	if len(m) < 5 {
-		panic("private getter called on invalid buffer")
+		panic(fmt.Sprintf("private getter RInt64 called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
 	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
-		panic("private getter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter RInt64 called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
 	}
 	// Field 3 (RInt64): repeated fixed-length
 	if len(m) < offsetToPrivate+5+4 {
@@ -4825,9 +5231,7 @@ func (m ComplexMixedRaw) GetRInt64() []int64 {
 		return nil
 	}
 	result := make([]int64, count)
-	for i := 0; i < count; i++ {
-		result[i] = int64(binary.LittleEndian.Uint64(m[payloadOffset+4+8*i:]))
-	}
+	serializer.GetInt64s(result, m[payloadOffset+4:])
 	return result
 }
 
@@ -4853,11 +5257,15 @@ func (m ComplexMixedRaw) GetNestedLeaf() LeafRaw {
 func (m ComplexMixedRaw) GetRString() []string {
 	// ASSERT: Private field requires complete buffer
 	if len(m) < 5 {
-		panic("private getter called on invalid buffer")
+		panic(fmt.Sprintf("private getter RString called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
 	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
-		panic("private getter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter RString called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
 	}
 	// Field 5 (RString): repeated variable-length
 	if len(m) < offsetToPrivate+9+4 {
@@ -4882,7 +5290,7 @@ func (m ComplexMixedRaw) GetRString() []string {
 		if len(m) < currentOffset+4+itemLen {
 			return nil
 		}
-		result[i] = string(m[currentOffset+4 : currentOffset+4+itemLen])
+		result[i] = serializer.GetString(m[currentOffset+4 : currentOffset+4+itemLen])
 		currentOffset += 4 + itemLen
 	}
 	return result
@@ -4899,11 +5307,15 @@ func (m ComplexMixedRaw) GetFBool() bool {
 func (m ComplexMixedRaw) GetRepeatedNested() []RootRaw {
 	// ASSERT: Private field requires complete buffer
 	if len(m) < 5 {
-		panic("private getter called on invalid buffer")
+		panic(fmt.Sprintf("private getter RepeatedNested called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
 	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
-		panic("private getter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter RepeatedNested called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
 	}
 	// Field 7 (RepeatedNested): repeated nested message
 	if len(m) < offsetToPrivate+13+4 {
@@ -4950,19 +5362,21 @@ func (m ComplexMixedRaw) GetVBytes() []byte {
 	if len(m) < payloadOffset+4+dataLen {
 		return nil
 	}
-	result := make([]byte, dataLen)
-	copy(result, m[payloadOffset+4:payloadOffset+4+dataLen])
-	return result
+	return serializer.GetBytes(m[payloadOffset+4 : payloadOffset+4+dataLen])
 }
 
 func (m *ComplexMixedRaw) SetFInt32(v int32) error {
 	// ASSERT: Private field setter requires complete buffer
 	if len(*m) < 5 {
-		panic("private setter called on invalid buffer")
+		panic(fmt.Sprintf("private setter FInt32 called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
-		panic("private setter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter FInt32 called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
 	}
 	// Field 1 (FInt32): fixed-length (4 bytes)
 	if len(*m) < offsetToPrivate+1+4 {
@@ -4977,7 +5391,7 @@ func (m *ComplexMixedRaw) SetVString(v string) error {
 	if len(*m) >= 5 {
 		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
-			panic("public setter called on complete buffer")
+			panic(fmt.Sprintf("public setter VString called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
 		}
 	}
 	// Field 2 (VString): variable-length
@@ -5033,11 +5447,15 @@ func (m *ComplexMixedRaw) SetVString(v string) error {
 func (m *ComplexMixedRaw) SetRInt64(v []int64) error {
 	// ASSERT: Private field setter requires complete buffer
 	if len(*m) < 5 {
-		panic("private setter called on invalid buffer")
+		panic(fmt.Sprintf("private setter RInt64 called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
-		panic("private setter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter RInt64 called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
 	}
 	// Field 3 (RInt64): repeated fixed-length
 	if len(*m) < offsetToPrivate+5+4 {
@@ -5058,9 +5476,7 @@ func (m *ComplexMixedRaw) SetRInt64(v []int64) error {
 	if oldPayloadOffset > 0 && newDataSize <= oldDataSize {
 		// Update in-place (waste space)
 		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(newCount))
-		for i, val := range v {
-			binary.LittleEndian.PutUint64((*m)[oldPayloadOffset+4+8*i:], uint64(val))
-		}
+		serializer.PutInt64s((*m)[oldPayloadOffset+4:], v)
 		return nil
 	}
 	// Need to remarshal: unmarshal, update, marshal
@@ -5082,7 +5498,7 @@ func (m *ComplexMixedRaw) SetNestedLeaf(v LeafRaw) error {
 	if len(*m) >= 5 {
 		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
-			panic("public setter called on complete buffer")
+			panic(fmt.Sprintf("public setter NestedLeaf called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
 		}
 	}
 	// Field 4 (NestedLeaf): nested message
@@ -5132,11 +5548,15 @@ func (m *ComplexMixedRaw) SetNestedLeaf(v LeafRaw) error {
 func (m *ComplexMixedRaw) SetRString(v []string) error {
 	// ASSERT: Private field setter requires complete buffer
 	if len(*m) < 5 {
-		panic("private setter called on invalid buffer")
+		panic(fmt.Sprintf("private setter RString called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
-		panic("private setter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter RString called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
 	}
 	// Field 5 (RString): repeated variable-length
 	if len(*m) < offsetToPrivate+9+4 {
@@ -5198,7 +5618,7 @@ func (m *ComplexMixedRaw) SetFBool(v bool) error {
 	if len(*m) >= 5 {
 		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
-			panic("public setter called on complete buffer")
+			panic(fmt.Sprintf("public setter FBool called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
 		}
 	}
 	// Field 6 (FBool): fixed-length (1 bytes)
@@ -5216,11 +5636,15 @@ func (m *ComplexMixedRaw) SetFBool(v bool) error {
 func (m *ComplexMixedRaw) SetRepeatedNested(v []RootRaw) error {
 	// ASSERT: Private field setter requires complete buffer
 	if len(*m) < 5 {
-		panic("private setter called on invalid buffer")
+		panic(fmt.Sprintf("private setter RepeatedNested called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
 	}
 	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
-		panic("private setter called on public-only buffer")
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter RepeatedNested called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
 	}
 	// Field 7 (RepeatedNested): repeated nested message
 	if len(*m) < offsetToPrivate+13+4 {
@@ -5288,7 +5712,7 @@ func (m *ComplexMixedRaw) SetVBytes(v []byte) error {
 	if len(*m) >= 5 {
 		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
 		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
-			panic("public setter called on complete buffer")
+			panic(fmt.Sprintf("public setter VBytes called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
 		}
 	}
 	// Field 8 (VBytes): variable-length
@@ -5341,22 +5765,82 @@ func (m *ComplexMixedRaw) SetVBytes(v []byte) error {
 	return nil
 }
 
-// MarshalSymphonyPublic marshals only the public fields (without header)
-func (m *Empty) MarshalSymphonyPublic() ([]byte, error) {
-	return []byte{}, nil
-}
-
-// MarshalSymphonyPrivate marshals only the private fields (without header)
-func (m *Empty) MarshalSymphonyPrivate() ([]byte, error) {
-	return []byte{}, nil
-}
-
-// UnmarshalSymphonyPublic unmarshals only the public fields (without header)
-func (m *Empty) UnmarshalSymphonyPublic(data []byte) error {
-	return nil
+// String renders the message in a protobuf-text-like format for debugging.
+// Private fields are omitted when the buffer only holds the public segment.
+func (m ComplexMixedRaw) String() string {
+	text, err := m.MarshalText()
+	if err != nil {
+		return fmt.Sprintf("<invalid ComplexMixed: %v>", err)
+	}
+	return string(text)
 }
 
-// UnmarshalSymphonyPrivate unmarshals only the private fields (without header)
+// MarshalText implements encoding.TextMarshaler using the format of String
+func (m ComplexMixedRaw) MarshalText() (text []byte, err error) {
+	if len(m) < 13 || m[0] != 0x01 {
+		return nil, fmt.Errorf("invalid data: too short or wrong public version")
+	}
+	// Getters do not validate offsets against each other, so recover from malformed buffers
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = nil, fmt.Errorf("invalid data: %v", r)
+		}
+	}()
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	hasPrivate := offsetToPrivate < len(m) && m[offsetToPrivate] == 0x01
+	_ = hasPrivate
+	var b strings.Builder
+	if hasPrivate {
+		if v := m.GetFInt32(); v != 0 {
+			fmt.Fprintf(&b, "f_int32: %v ", v)
+		}
+	}
+	if v := m.GetVString(); len(v) > 0 {
+		fmt.Fprintf(&b, "v_string: %q ", v)
+	}
+	if hasPrivate {
+		for _, v := range m.GetRInt64() {
+			fmt.Fprintf(&b, "r_int64: %v ", v)
+		}
+	}
+	if v := m.GetNestedLeaf(); v != nil {
+		fmt.Fprintf(&b, "nested_leaf { %s } ", v)
+	}
+	if hasPrivate {
+		for _, v := range m.GetRString() {
+			fmt.Fprintf(&b, "r_string: %q ", v)
+		}
+	}
+	if m.GetFBool() {
+		b.WriteString("f_bool: true ")
+	}
+	if hasPrivate {
+		for _, v := range m.GetRepeatedNested() {
+			fmt.Fprintf(&b, "repeated_nested { %s } ", v)
+		}
+	}
+	if v := m.GetVBytes(); len(v) > 0 {
+		fmt.Fprintf(&b, "v_bytes: %q ", v)
+	}
+	return []byte(strings.TrimSpace(b.String())), nil
+}
+
+// MarshalSymphonyPublic marshals only the public fields (without header)
+func (m *Empty) MarshalSymphonyPublic() ([]byte, error) {
+	return []byte{}, nil
+}
+
+// MarshalSymphonyPrivate marshals only the private fields (without header)
+func (m *Empty) MarshalSymphonyPrivate() ([]byte, error) {
+	return []byte{}, nil
+}
+
+// UnmarshalSymphonyPublic unmarshals only the public fields (without header)
+func (m *Empty) UnmarshalSymphonyPublic(data []byte) error {
+	return nil
+}
+
+// UnmarshalSymphonyPrivate unmarshals only the private fields (without header)
 func (m *Empty) UnmarshalSymphonyPrivate(data []byte) error {
 	return nil
 }
@@ -5372,6 +5856,15 @@ func (m *Empty) MarshalSymphony() ([]byte, error) {
 }
 
 func (m *Empty) UnmarshalSymphony(data []byte) error {
+	return m.UnmarshalSymphonyArena(data, nil)
+}
+
+// symphonyArenaEmpty identifies Empty in a serializer.Arena
+var symphonyArenaEmpty = serializer.NewArenaType()
+
+// UnmarshalSymphonyArena is UnmarshalSymphony allocating the nested messages from arena,
+// which must not be released while they are in use. A nil arena allocates from the heap.
+func (m *Empty) UnmarshalSymphonyArena(data []byte, arena *serializer.Arena) error {
 	// Empty message - just validate version bytes
 	if len(data) < 14 {
 		return fmt.Errorf("invalid data: too short")
@@ -5396,3 +5889,3847 @@ func (m *EmptyRaw) UnmarshalSymphony(data []byte) error {
 	*m = EmptyRaw(data)
 	return nil
 }
+
+// String renders the message in a protobuf-text-like format for debugging.
+// Private fields are omitted when the buffer only holds the public segment.
+func (m EmptyRaw) String() string {
+	text, err := m.MarshalText()
+	if err != nil {
+		return fmt.Sprintf("<invalid Empty: %v>", err)
+	}
+	return string(text)
+}
+
+// MarshalText implements encoding.TextMarshaler using the format of String
+func (m EmptyRaw) MarshalText() (text []byte, err error) {
+	if len(m) < 13 || m[0] != 0x01 {
+		return nil, fmt.Errorf("invalid data: too short or wrong public version")
+	}
+	// Getters do not validate offsets against each other, so recover from malformed buffers
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = nil, fmt.Errorf("invalid data: %v", r)
+		}
+	}()
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	hasPrivate := offsetToPrivate < len(m) && m[offsetToPrivate] == 0x01
+	_ = hasPrivate
+	var b strings.Builder
+	return []byte(strings.TrimSpace(b.String())), nil
+}
+
+// MarshalSymphonyPublic marshals only the public fields (without header)
+func (m *Credentials) MarshalSymphonyPublic() ([]byte, error) {
+	size := 0
+	size += 8 // table
+	size += 4 + len(m.User)
+	size += 4 + len(m.CardNumber)
+	buf := make([]byte, size)
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+	tableStart := 0
+	payloadStart := tableStart + 8
+	payloadOffset := 0
+	_ = payloadStart
+	_ = payloadOffset
+
+	// Field 1 (User): variable-length
+	binary.LittleEndian.PutUint32(buf[tableStart+0:], uint32(payloadStart+payloadOffset))
+	dataLen = len(m.User)
+	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(dataLen))
+	copy(buf[payloadStart+payloadOffset+4:], m.User)
+	payloadOffset += 4 + len(m.User)
+
+	// Field 2 (CardNumber): variable-length
+	binary.LittleEndian.PutUint32(buf[tableStart+4:], uint32(payloadStart+payloadOffset))
+	dataLen = len(m.CardNumber)
+	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(dataLen))
+	copy(buf[payloadStart+payloadOffset+4:], m.CardNumber)
+	payloadOffset += 4 + len(m.CardNumber)
+
+	return buf, nil
+}
+
+// MarshalSymphonyPrivate marshals only the private fields (without header)
+func (m *Credentials) MarshalSymphonyPrivate() ([]byte, error) {
+	size := 0
+	size += 4 // table
+	size += 4 + len(m.Secret)
+	buf := make([]byte, size)
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+	tableStart := 0
+	payloadStart := tableStart + 4
+	payloadOffset := 0
+	_ = payloadStart
+	_ = payloadOffset
+
+	// Field 3 (Secret): variable-length
+	binary.LittleEndian.PutUint32(buf[tableStart+0:], uint32(payloadStart+payloadOffset))
+	dataLen = len(m.Secret)
+	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(dataLen))
+	copy(buf[payloadStart+payloadOffset+4:], m.Secret)
+	payloadOffset += 4 + len(m.Secret)
+
+	return buf, nil
+}
+
+// UnmarshalSymphonyPublic unmarshals only the public fields (without header)
+func (m *Credentials) UnmarshalSymphonyPublic(data []byte) error {
+	payloadOffset := 0
+	_ = payloadOffset
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+	tableStart := 0
+	_ = tableStart
+
+	// Field 1 (User): variable-length
+	if len(data) >= tableStart+0+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart+0:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.User = serializer.GetString(data[payloadOffset+4 : payloadOffset+4+dataLen])
+			}
+		}
+	}
+
+	// Field 2 (CardNumber): variable-length
+	if len(data) >= tableStart+4+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart+4:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.CardNumber = serializer.GetString(data[payloadOffset+4 : payloadOffset+4+dataLen])
+			}
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalSymphonyPrivate unmarshals only the private fields (without header)
+func (m *Credentials) UnmarshalSymphonyPrivate(data []byte) error {
+	payloadOffset := 0
+	_ = payloadOffset
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+	tableStart := 0
+	_ = tableStart
+
+	// Field 3 (Secret): variable-length
+	if len(data) >= tableStart+0+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart+0:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.Secret = serializer.GetBytes(data[payloadOffset+4 : payloadOffset+4+dataLen])
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *Credentials) MarshalSymphony() ([]byte, error) {
+	size := 0
+	// Public segment:
+	size += 1  // version byte
+	size += 12 // reserved: offset_to_private, service_name, method_name
+	size += 8  // table entries
+	// Field 1 (User): variable-length payload
+	size += 4 + len(m.User) // 4 bytes length prefix + data
+	// Field 2 (CardNumber): variable-length payload
+	size += 4 + len(m.CardNumber) // 4 bytes length prefix + data
+	// Private segment:
+	size += 1 // version byte
+	size += 4 // table entries
+	// Field 3 (Secret): variable-length payload
+	size += 4 + len(m.Secret) // 4 bytes length prefix + data
+
+	buf := make([]byte, size)
+
+	dataLen := 0 // avoid no new variables warning
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+
+	// === PUBLIC SEGMENT ===
+	buf[0] = 0x01 // version byte
+
+	// Calculate offset to private segment
+	publicSegmentSize := 13
+	publicSegmentSize += 4                     // offset placeholder
+	publicSegmentSize += 4                     // offset placeholder
+	publicSegmentSize += 4 + len(m.User)       // field 1 payload
+	publicSegmentSize += 4 + len(m.CardNumber) // field 2 payload
+
+	// Write reserved header
+	binary.LittleEndian.PutUint32(buf[1:5], uint32(publicSegmentSize)) // offset_to_private
+	binary.LittleEndian.PutUint32(buf[5:9], 0)                         // service_id
+	binary.LittleEndian.PutUint32(buf[9:13], 0)                        // method_id
+
+	// Write public fields
+	publicTableStart := 13
+	publicPayloadStart := publicTableStart + 8
+	publicPayloadOffset := 0
+	_ = publicPayloadStart
+	_ = publicPayloadOffset
+
+	// Field 1 (User): variable-length
+	binary.LittleEndian.PutUint32(buf[publicTableStart+0:], uint32(publicPayloadStart+publicPayloadOffset))
+	dataLen = len(m.User)
+	binary.LittleEndian.PutUint32(buf[publicPayloadStart+publicPayloadOffset:], uint32(dataLen))
+	copy(buf[publicPayloadStart+publicPayloadOffset+4:], m.User)
+	publicPayloadOffset += 4 + len(m.User)
+
+	// Field 2 (CardNumber): variable-length
+	binary.LittleEndian.PutUint32(buf[publicTableStart+4:], uint32(publicPayloadStart+publicPayloadOffset))
+	dataLen = len(m.CardNumber)
+	binary.LittleEndian.PutUint32(buf[publicPayloadStart+publicPayloadOffset:], uint32(dataLen))
+	copy(buf[publicPayloadStart+publicPayloadOffset+4:], m.CardNumber)
+	publicPayloadOffset += 4 + len(m.CardNumber)
+
+	// === PRIVATE SEGMENT ===
+	privateStart := publicSegmentSize
+	buf[privateStart] = 0x01 // version byte
+
+	// Write private fields
+	privateTableStart := privateStart + 1 // 4 bytes table
+	privatePayloadStart := privateTableStart + 4
+	privatePayloadOffset := 0
+	_ = privatePayloadStart
+	_ = privatePayloadOffset
+
+	// Private segment offsets are stored relative to privateStart
+	// Field 3 (Secret): variable-length
+	binary.LittleEndian.PutUint32(buf[privateTableStart+0:], uint32((privatePayloadStart+privatePayloadOffset)-privateStart))
+	dataLen = len(m.Secret)
+	binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset:], uint32(dataLen))
+	copy(buf[privatePayloadStart+privatePayloadOffset+4:], m.Secret)
+	privatePayloadOffset += 4 + len(m.Secret)
+
+	return buf, nil
+}
+
+func (m *Credentials) UnmarshalSymphony(data []byte) error {
+	return m.UnmarshalSymphonyArena(data, nil)
+}
+
+// symphonyArenaCredentials identifies Credentials in a serializer.Arena
+var symphonyArenaCredentials = serializer.NewArenaType()
+
+// UnmarshalSymphonyArena is UnmarshalSymphony allocating the nested messages from arena,
+// which must not be released while they are in use. A nil arena allocates from the heap.
+func (m *Credentials) UnmarshalSymphonyArena(data []byte, arena *serializer.Arena) error {
+	if len(data) < 13 {
+		return fmt.Errorf("invalid data: too short")
+	}
+
+	// Validate public segment version
+	if data[0] != 0x01 {
+		return fmt.Errorf("invalid data: wrong public version")
+	}
+
+	// Read reserved header
+	offsetToPrivate := int(binary.LittleEndian.Uint32(data[1:5]))
+	// service_name := binary.LittleEndian.Uint32(data[5:9])  // not used yet
+	// method_name := binary.LittleEndian.Uint32(data[9:13])  // not used yet
+
+	// Assert private segment exists
+	if offsetToPrivate >= len(data) || data[offsetToPrivate] != 0x01 {
+		return fmt.Errorf("missing private segment")
+	}
+
+	payloadOffset := 0
+	_ = payloadOffset
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+
+	// === PUBLIC FIELDS ===
+	publicTableStart := 13
+	_ = publicTableStart
+	// Field 1 (User): variable-length
+	if len(data) >= publicTableStart+0+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[publicTableStart+0:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.User = serializer.GetString(data[payloadOffset+4 : payloadOffset+4+dataLen])
+			}
+		}
+	}
+
+	// Field 2 (CardNumber): variable-length
+	if len(data) >= publicTableStart+4+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[publicTableStart+4:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.CardNumber = serializer.GetString(data[payloadOffset+4 : payloadOffset+4+dataLen])
+			}
+		}
+	}
+
+	// === PRIVATE FIELDS ===
+	privateTableStart := offsetToPrivate + 1
+	_ = privateTableStart
+	// Private segment offsets are relative to offsetToPrivate
+	// Field 3 (Secret): variable-length
+	if len(data) >= privateTableStart+0+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[privateTableStart+0:]))
+		if payloadOffset > 0 {
+			payloadOffset += offsetToPrivate // convert relative offset to absolute
+		}
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.Secret = serializer.GetBytes(data[payloadOffset+4 : payloadOffset+4+dataLen])
+			}
+		}
+	}
+
+	return nil
+}
+
+type CredentialsRaw []byte
+
+func (m CredentialsRaw) MarshalSymphony() ([]byte, error) {
+	return []byte(m), nil
+}
+
+func (m *CredentialsRaw) UnmarshalSymphony(data []byte) error {
+	*m = CredentialsRaw(data)
+	return nil
+}
+
+func (m CredentialsRaw) GetUser() string {
+	// Field 1 (User): variable-length
+	if len(m) < 13+4 {
+		return ""
+	}
+	payloadOffset := int(binary.LittleEndian.Uint32(m[13:]))
+	if payloadOffset == 0 {
+		return ""
+	}
+	if len(m) < payloadOffset+4 {
+		return ""
+	}
+	dataLen := int(binary.LittleEndian.Uint32(m[payloadOffset:]))
+	if len(m) < payloadOffset+4+dataLen {
+		return ""
+	}
+	return serializer.GetString(m[payloadOffset+4 : payloadOffset+4+dataLen])
+}
+
+func (m CredentialsRaw) GetCardNumber() string {
+	// Field 2 (CardNumber): variable-length
+	if len(m) < 17+4 {
+		return ""
+	}
+	payloadOffset := int(binary.LittleEndian.Uint32(m[17:]))
+	if payloadOffset == 0 {
+		return ""
+	}
+	if len(m) < payloadOffset+4 {
+		return ""
+	}
+	dataLen := int(binary.LittleEndian.Uint32(m[payloadOffset:]))
+	if len(m) < payloadOffset+4+dataLen {
+		return ""
+	}
+	return serializer.GetString(m[payloadOffset+4 : payloadOffset+4+dataLen])
+}
+
+func (m CredentialsRaw) GetSecret() []byte {
+	// ASSERT: Private field requires complete buffer
+	if len(m) < 5 {
+		panic(fmt.Sprintf("private getter Secret called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter Secret called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
+	}
+	// Field 3 (Secret): variable-length
+	if len(m) < offsetToPrivate+1+4 {
+		return nil
+	}
+	payloadOffset := int(binary.LittleEndian.Uint32(m[offsetToPrivate+1:]))
+	if payloadOffset == 0 {
+		return nil
+	}
+	payloadOffset += offsetToPrivate // convert relative offset to absolute
+	if len(m) < payloadOffset+4 {
+		return nil
+	}
+	dataLen := int(binary.LittleEndian.Uint32(m[payloadOffset:]))
+	if len(m) < payloadOffset+4+dataLen {
+		return nil
+	}
+	return serializer.GetBytes(m[payloadOffset+4 : payloadOffset+4+dataLen])
+}
+
+func (m *CredentialsRaw) SetUser(v string) error {
+	// ASSERT: Public field setter requires public-only buffer
+	if len(*m) >= 5 {
+		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
+			panic(fmt.Sprintf("public setter User called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
+		}
+	}
+	// Field 1 (User): variable-length
+	if len(*m) < 13+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[13:]))
+	var oldDataLen int
+	if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+4 {
+		oldDataLen = int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset:]))
+	}
+	newDataLen := len(v)
+	if oldPayloadOffset > 0 && newDataLen <= oldDataLen {
+		// Update in-place (waste space)
+		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(newDataLen))
+		copy((*m)[oldPayloadOffset+4:], v)
+		return nil
+	}
+	// Need to remarshal: unmarshal, update, marshal, truncate to public-only
+	// Preserve reserved bytes (serviceID at bytes 5-9, methodID at bytes 9-13) from original buffer
+	var originalServiceID, originalMethodID uint32
+	if len(*m) >= 13 {
+		originalServiceID = binary.LittleEndian.Uint32((*m)[5:9])
+		originalMethodID = binary.LittleEndian.Uint32((*m)[9:13])
+	}
+	var temp Credentials
+	// Create a fake complete buffer by appending a minimal private segment
+	// Calculate private table size
+	privateTableSize := 4                                    // bytes needed for empty private table
+	fakeComplete := make([]byte, len(*m)+1+privateTableSize) // version byte + private table
+	copy(fakeComplete, *m)
+	// Update offsetToPrivate to point to the appended private segment
+	binary.LittleEndian.PutUint32(fakeComplete[1:5], uint32(len(*m)))
+	fakeComplete[len(*m)] = 0x01 // private segment version
+	if err := temp.UnmarshalSymphony(fakeComplete); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.User = v
+	fullData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	// Restore reserved bytes (serviceID and methodID) in the marshaled payload
+	if len(fullData) >= 13 {
+		binary.LittleEndian.PutUint32(fullData[5:9], originalServiceID)
+		binary.LittleEndian.PutUint32(fullData[9:13], originalMethodID)
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(fullData[1:5]))
+	*m = CredentialsRaw(fullData[:offsetToPrivate])
+	return nil
+}
+
+func (m *CredentialsRaw) SetCardNumber(v string) error {
+	// ASSERT: Public field setter requires public-only buffer
+	if len(*m) >= 5 {
+		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
+			panic(fmt.Sprintf("public setter CardNumber called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
+		}
+	}
+	// Field 2 (CardNumber): variable-length
+	if len(*m) < 17+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[17:]))
+	var oldDataLen int
+	if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+4 {
+		oldDataLen = int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset:]))
+	}
+	newDataLen := len(v)
+	if oldPayloadOffset > 0 && newDataLen <= oldDataLen {
+		// Update in-place (waste space)
+		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(newDataLen))
+		copy((*m)[oldPayloadOffset+4:], v)
+		return nil
+	}
+	// Need to remarshal: unmarshal, update, marshal, truncate to public-only
+	// Preserve reserved bytes (serviceID at bytes 5-9, methodID at bytes 9-13) from original buffer
+	var originalServiceID, originalMethodID uint32
+	if len(*m) >= 13 {
+		originalServiceID = binary.LittleEndian.Uint32((*m)[5:9])
+		originalMethodID = binary.LittleEndian.Uint32((*m)[9:13])
+	}
+	var temp Credentials
+	// Create a fake complete buffer by appending a minimal private segment
+	// Calculate private table size
+	privateTableSize := 4                                    // bytes needed for empty private table
+	fakeComplete := make([]byte, len(*m)+1+privateTableSize) // version byte + private table
+	copy(fakeComplete, *m)
+	// Update offsetToPrivate to point to the appended private segment
+	binary.LittleEndian.PutUint32(fakeComplete[1:5], uint32(len(*m)))
+	fakeComplete[len(*m)] = 0x01 // private segment version
+	if err := temp.UnmarshalSymphony(fakeComplete); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.CardNumber = v
+	fullData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	// Restore reserved bytes (serviceID and methodID) in the marshaled payload
+	if len(fullData) >= 13 {
+		binary.LittleEndian.PutUint32(fullData[5:9], originalServiceID)
+		binary.LittleEndian.PutUint32(fullData[9:13], originalMethodID)
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(fullData[1:5]))
+	*m = CredentialsRaw(fullData[:offsetToPrivate])
+	return nil
+}
+
+func (m *CredentialsRaw) SetSecret(v []byte) error {
+	// ASSERT: Private field setter requires complete buffer
+	if len(*m) < 5 {
+		panic(fmt.Sprintf("private setter Secret called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter Secret called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
+	}
+	// Field 3 (Secret): variable-length
+	if len(*m) < offsetToPrivate+1+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[offsetToPrivate+1:]))
+	if oldPayloadOffset > 0 {
+		oldPayloadOffset += offsetToPrivate // convert relative offset to absolute
+	}
+	var oldDataLen int
+	if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+4 {
+		oldDataLen = int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset:]))
+	}
+	newDataLen := len(v)
+	if oldPayloadOffset > 0 && newDataLen <= oldDataLen {
+		// Update in-place (waste space)
+		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(newDataLen))
+		copy((*m)[oldPayloadOffset+4:], v)
+		return nil
+	}
+	// Need to remarshal: unmarshal, update, marshal
+	var temp Credentials
+	if err := temp.UnmarshalSymphony([]byte(*m)); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.Secret = v
+	newData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	*m = CredentialsRaw(newData)
+	return nil
+}
+
+// String renders the message in a protobuf-text-like format for debugging.
+// Private fields are omitted when the buffer only holds the public segment.
+func (m CredentialsRaw) String() string {
+	text, err := m.MarshalText()
+	if err != nil {
+		return fmt.Sprintf("<invalid Credentials: %v>", err)
+	}
+	return string(text)
+}
+
+// MarshalText implements encoding.TextMarshaler using the format of String
+func (m CredentialsRaw) MarshalText() (text []byte, err error) {
+	if len(m) < 13 || m[0] != 0x01 {
+		return nil, fmt.Errorf("invalid data: too short or wrong public version")
+	}
+	// Getters do not validate offsets against each other, so recover from malformed buffers
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = nil, fmt.Errorf("invalid data: %v", r)
+		}
+	}()
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	hasPrivate := offsetToPrivate < len(m) && m[offsetToPrivate] == 0x01
+	_ = hasPrivate
+	var b strings.Builder
+	if v := m.GetUser(); len(v) > 0 {
+		fmt.Fprintf(&b, "user: %q ", v)
+	}
+	if len(m.GetCardNumber()) > 0 {
+		b.WriteString("card_number: \"[REDACTED]\" ")
+	}
+	if hasPrivate {
+		if len(m.GetSecret()) > 0 {
+			b.WriteString("secret: \"[REDACTED]\" ")
+		}
+	}
+	return []byte(strings.TrimSpace(b.String())), nil
+}
+
+// MarshalSymphony always fails because field values is a map.
+// Use serializer.SymphonyFallbackSerializer to encode Labels with protobuf instead.
+func (m *Labels) MarshalSymphony() ([]byte, error) {
+	return nil, fmt.Errorf("symphony: Labels is not supported: field values is a map")
+}
+
+// UnmarshalSymphony always fails because field values is a map.
+func (m *Labels) UnmarshalSymphony(data []byte) error {
+	return fmt.Errorf("symphony: Labels is not supported: field values is a map")
+}
+
+// UnmarshalSymphonyArena always fails because field values is a map.
+func (m *Labels) UnmarshalSymphonyArena(data []byte, arena *serializer.Arena) error {
+	return fmt.Errorf("symphony: Labels is not supported: field values is a map")
+}
+
+// MarshalSymphonyPublic marshals only the public fields (without header)
+func (m *WellKnown) MarshalSymphonyPublic() ([]byte, error) {
+	size := 0
+	size += 12 // table
+	if m.Created != nil {
+		nested, _ := serializer.MarshalWellKnown(m.Created)
+		size += 4 + len(nested)
+	}
+	if m.Nickname != nil {
+		nested, _ := serializer.MarshalWellKnown(m.Nickname)
+		size += 4 + len(nested)
+	}
+	size += 4 // count for History
+	for _, item := range m.History {
+		nested, _ := serializer.MarshalWellKnown(item)
+		size += 4 + len(nested)
+	}
+	buf := make([]byte, size)
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+	tableStart := 0
+	payloadStart := tableStart + 12
+	payloadOffset := 0
+	_ = payloadStart
+	_ = payloadOffset
+
+	// Field 1 (Created): nested message
+	if m.Created != nil {
+		binary.LittleEndian.PutUint32(buf[tableStart+0:], uint32(payloadStart+payloadOffset))
+		nestedData, err := serializer.MarshalWellKnown(m.Created)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		nestedSize := len(nestedData)
+		binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(nestedSize))
+		copy(buf[payloadStart+payloadOffset+4:], nestedData)
+		payloadOffset += 4 + nestedSize
+	} else {
+		binary.LittleEndian.PutUint32(buf[tableStart+0:], 0)
+	}
+
+	// Field 5 (Nickname): nested message
+	if m.Nickname != nil {
+		binary.LittleEndian.PutUint32(buf[tableStart+4:], uint32(payloadStart+payloadOffset))
+		nestedData, err := serializer.MarshalWellKnown(m.Nickname)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		nestedSize := len(nestedData)
+		binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(nestedSize))
+		copy(buf[payloadStart+payloadOffset+4:], nestedData)
+		payloadOffset += 4 + nestedSize
+	} else {
+		binary.LittleEndian.PutUint32(buf[tableStart+4:], 0)
+	}
+
+	// Field 7 (History): repeated nested message
+	binary.LittleEndian.PutUint32(buf[tableStart+8:], uint32(payloadStart+payloadOffset))
+	count = len(m.History)
+	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(count))
+	payloadOffset += 4
+	currentOffset = payloadStart + payloadOffset
+	for _, item := range m.History {
+		nestedData, err := serializer.MarshalWellKnown(item)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		nestedSize := len(nestedData)
+		binary.LittleEndian.PutUint32(buf[currentOffset:], uint32(nestedSize))
+		copy(buf[currentOffset+4:], nestedData)
+		currentOffset += 4 + nestedSize
+		payloadOffset += 4 + nestedSize
+	}
+
+	return buf, nil
+}
+
+// MarshalSymphonyPrivate marshals only the private fields (without header)
+func (m *WellKnown) MarshalSymphonyPrivate() ([]byte, error) {
+	size := 0
+	size += 16 // table
+	if m.Ttl != nil {
+		nested, _ := serializer.MarshalWellKnown(m.Ttl)
+		size += 4 + len(nested)
+	}
+	if m.Detail != nil {
+		nested, _ := serializer.MarshalWellKnown(m.Detail)
+		size += 4 + len(nested)
+	}
+	if m.Attrs != nil {
+		nested, _ := serializer.MarshalWellKnown(m.Attrs)
+		size += 4 + len(nested)
+	}
+	if m.Version != nil {
+		nested, _ := serializer.MarshalWellKnown(m.Version)
+		size += 4 + len(nested)
+	}
+	buf := make([]byte, size)
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+	tableStart := 0
+	payloadStart := tableStart + 16
+	payloadOffset := 0
+	_ = payloadStart
+	_ = payloadOffset
+
+	// Field 2 (Ttl): nested message
+	if m.Ttl != nil {
+		binary.LittleEndian.PutUint32(buf[tableStart+0:], uint32(payloadStart+payloadOffset))
+		nestedData, err := serializer.MarshalWellKnown(m.Ttl)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		nestedSize := len(nestedData)
+		binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(nestedSize))
+		copy(buf[payloadStart+payloadOffset+4:], nestedData)
+		payloadOffset += 4 + nestedSize
+	} else {
+		binary.LittleEndian.PutUint32(buf[tableStart+0:], 0)
+	}
+
+	// Field 3 (Detail): nested message
+	if m.Detail != nil {
+		binary.LittleEndian.PutUint32(buf[tableStart+4:], uint32(payloadStart+payloadOffset))
+		nestedData, err := serializer.MarshalWellKnown(m.Detail)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		nestedSize := len(nestedData)
+		binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(nestedSize))
+		copy(buf[payloadStart+payloadOffset+4:], nestedData)
+		payloadOffset += 4 + nestedSize
+	} else {
+		binary.LittleEndian.PutUint32(buf[tableStart+4:], 0)
+	}
+
+	// Field 4 (Attrs): nested message
+	if m.Attrs != nil {
+		binary.LittleEndian.PutUint32(buf[tableStart+8:], uint32(payloadStart+payloadOffset))
+		nestedData, err := serializer.MarshalWellKnown(m.Attrs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		nestedSize := len(nestedData)
+		binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(nestedSize))
+		copy(buf[payloadStart+payloadOffset+4:], nestedData)
+		payloadOffset += 4 + nestedSize
+	} else {
+		binary.LittleEndian.PutUint32(buf[tableStart+8:], 0)
+	}
+
+	// Field 6 (Version): nested message
+	if m.Version != nil {
+		binary.LittleEndian.PutUint32(buf[tableStart+12:], uint32(payloadStart+payloadOffset))
+		nestedData, err := serializer.MarshalWellKnown(m.Version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		nestedSize := len(nestedData)
+		binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(nestedSize))
+		copy(buf[payloadStart+payloadOffset+4:], nestedData)
+		payloadOffset += 4 + nestedSize
+	} else {
+		binary.LittleEndian.PutUint32(buf[tableStart+12:], 0)
+	}
+
+	return buf, nil
+}
+
+// UnmarshalSymphonyPublic unmarshals only the public fields (without header)
+func (m *WellKnown) UnmarshalSymphonyPublic(data []byte) error {
+	payloadOffset := 0
+	_ = payloadOffset
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+	tableStart := 0
+	_ = tableStart
+
+	// Field 1 (Created): nested message
+	if len(data) >= tableStart+0+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart+0:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.Created = &timestamppb.Timestamp{}
+				if err := serializer.UnmarshalWellKnown(data[payloadOffset+4:payloadOffset+4+dataLen], m.Created); err != nil {
+					return fmt.Errorf("failed to unmarshal nested message: %w", err)
+				}
+			}
+		}
+	}
+
+	// Field 5 (Nickname): nested message
+	if len(data) >= tableStart+4+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart+4:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.Nickname = &wrapperspb.StringValue{}
+				if err := serializer.UnmarshalWellKnown(data[payloadOffset+4:payloadOffset+4+dataLen], m.Nickname); err != nil {
+					return fmt.Errorf("failed to unmarshal nested message: %w", err)
+				}
+			}
+		}
+	}
+
+	// Field 7 (History): repeated nested message
+	if len(data) >= tableStart+8+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart+8:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			m.History = make([]*timestamppb.Timestamp, 0, count)
+			currentOffset = payloadOffset + 4
+			for i := 0; i < count; i++ {
+				if len(data) >= currentOffset+4 {
+					itemLen := int(binary.LittleEndian.Uint32(data[currentOffset:]))
+					if len(data) >= currentOffset+4+itemLen {
+						item := &timestamppb.Timestamp{}
+						if err := serializer.UnmarshalWellKnown(data[currentOffset+4:currentOffset+4+itemLen], item); err != nil {
+							return fmt.Errorf("failed to unmarshal nested message: %w", err)
+						}
+						m.History = append(m.History, item)
+						currentOffset += 4 + itemLen
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalSymphonyPrivate unmarshals only the private fields (without header)
+func (m *WellKnown) UnmarshalSymphonyPrivate(data []byte) error {
+	payloadOffset := 0
+	_ = payloadOffset
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+	tableStart := 0
+	_ = tableStart
+
+	// Field 2 (Ttl): nested message
+	if len(data) >= tableStart+0+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart+0:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.Ttl = &durationpb.Duration{}
+				if err := serializer.UnmarshalWellKnown(data[payloadOffset+4:payloadOffset+4+dataLen], m.Ttl); err != nil {
+					return fmt.Errorf("failed to unmarshal nested message: %w", err)
+				}
+			}
+		}
+	}
+
+	// Field 3 (Detail): nested message
+	if len(data) >= tableStart+4+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart+4:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.Detail = &anypb.Any{}
+				if err := serializer.UnmarshalWellKnown(data[payloadOffset+4:payloadOffset+4+dataLen], m.Detail); err != nil {
+					return fmt.Errorf("failed to unmarshal nested message: %w", err)
+				}
+			}
+		}
+	}
+
+	// Field 4 (Attrs): nested message
+	if len(data) >= tableStart+8+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart+8:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.Attrs = &structpb.Struct{}
+				if err := serializer.UnmarshalWellKnown(data[payloadOffset+4:payloadOffset+4+dataLen], m.Attrs); err != nil {
+					return fmt.Errorf("failed to unmarshal nested message: %w", err)
+				}
+			}
+		}
+	}
+
+	// Field 6 (Version): nested message
+	if len(data) >= tableStart+12+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart+12:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.Version = &wrapperspb.Int64Value{}
+				if err := serializer.UnmarshalWellKnown(data[payloadOffset+4:payloadOffset+4+dataLen], m.Version); err != nil {
+					return fmt.Errorf("failed to unmarshal nested message: %w", err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *WellKnown) MarshalSymphony() ([]byte, error) {
+	size := 0
+	// Public segment:
+	size += 1  // version byte
+	size += 12 // reserved: offset_to_private, service_name, method_name
+	size += 12 // table entries
+	// Field 1 (Created): well-known type payload
+	if m.Created != nil {
+		size += 4 + serializer.WellKnownSize(m.Created) // 4 bytes size + compact data
+	}
+	// Field 5 (Nickname): well-known type payload
+	if m.Nickname != nil {
+		size += 4 + serializer.WellKnownSize(m.Nickname) // 4 bytes size + compact data
+	}
+	// Field 7 (History): repeated well-known type payload
+	size += 4 // count
+	for _, item := range m.History {
+		size += 4 + serializer.WellKnownSize(item) // 4 bytes size + compact data
+	}
+	// Private segment:
+	size += 1  // version byte
+	size += 16 // table entries
+	// Field 2 (Ttl): well-known type payload
+	if m.Ttl != nil {
+		size += 4 + serializer.WellKnownSize(m.Ttl) // 4 bytes size + compact data
+	}
+	// Field 3 (Detail): well-known type payload
+	if m.Detail != nil {
+		size += 4 + serializer.WellKnownSize(m.Detail) // 4 bytes size + compact data
+	}
+	// Field 4 (Attrs): well-known type payload
+	if m.Attrs != nil {
+		size += 4 + serializer.WellKnownSize(m.Attrs) // 4 bytes size + compact data
+	}
+	// Field 6 (Version): well-known type payload
+	if m.Version != nil {
+		size += 4 + serializer.WellKnownSize(m.Version) // 4 bytes size + compact data
+	}
+
+	buf := make([]byte, size)
+
+	dataLen := 0 // avoid no new variables warning
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+
+	// === PUBLIC SEGMENT ===
+	buf[0] = 0x01 // version byte
+
+	// Calculate offset to private segment
+	publicSegmentSize := 13
+	publicSegmentSize += 4 // offset placeholder
+	publicSegmentSize += 4 // offset placeholder
+	publicSegmentSize += 4 // offset placeholder
+	if m.Created != nil {
+		nestedData1, _ := serializer.MarshalWellKnown(m.Created)
+		publicSegmentSize += 4 + len(nestedData1) // field 1 payload
+	}
+	if m.Nickname != nil {
+		nestedData5, _ := serializer.MarshalWellKnown(m.Nickname)
+		publicSegmentSize += 4 + len(nestedData5) // field 5 payload
+	}
+	publicSegmentSize += 4 // field 7 count
+	for _, item := range m.History {
+		nestedData, _ := serializer.MarshalWellKnown(item)
+		publicSegmentSize += 4 + len(nestedData)
+	}
+
+	// Write reserved header
+	binary.LittleEndian.PutUint32(buf[1:5], uint32(publicSegmentSize)) // offset_to_private
+	binary.LittleEndian.PutUint32(buf[5:9], 0)                         // service_id
+	binary.LittleEndian.PutUint32(buf[9:13], 0)                        // method_id
+
+	// Write public fields
+	publicTableStart := 13
+	publicPayloadStart := publicTableStart + 12
+	publicPayloadOffset := 0
+	_ = publicPayloadStart
+	_ = publicPayloadOffset
+
+	// Field 1 (Created): nested message
+	if m.Created != nil {
+		binary.LittleEndian.PutUint32(buf[publicTableStart+0:], uint32(publicPayloadStart+publicPayloadOffset))
+		nestedData, err := serializer.MarshalWellKnown(m.Created)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		nestedSize := len(nestedData)
+		binary.LittleEndian.PutUint32(buf[publicPayloadStart+publicPayloadOffset:], uint32(nestedSize))
+		copy(buf[publicPayloadStart+publicPayloadOffset+4:], nestedData)
+		publicPayloadOffset += 4 + nestedSize
+	} else {
+		binary.LittleEndian.PutUint32(buf[publicTableStart+0:], 0)
+	}
+
+	// Field 5 (Nickname): nested message
+	if m.Nickname != nil {
+		binary.LittleEndian.PutUint32(buf[publicTableStart+4:], uint32(publicPayloadStart+publicPayloadOffset))
+		nestedData, err := serializer.MarshalWellKnown(m.Nickname)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		nestedSize := len(nestedData)
+		binary.LittleEndian.PutUint32(buf[publicPayloadStart+publicPayloadOffset:], uint32(nestedSize))
+		copy(buf[publicPayloadStart+publicPayloadOffset+4:], nestedData)
+		publicPayloadOffset += 4 + nestedSize
+	} else {
+		binary.LittleEndian.PutUint32(buf[publicTableStart+4:], 0)
+	}
+
+	// Field 7 (History): repeated nested message
+	binary.LittleEndian.PutUint32(buf[publicTableStart+8:], uint32(publicPayloadStart+publicPayloadOffset))
+	count = len(m.History)
+	binary.LittleEndian.PutUint32(buf[publicPayloadStart+publicPayloadOffset:], uint32(count))
+	publicPayloadOffset += 4
+	currentOffset = publicPayloadStart + publicPayloadOffset
+	for _, item := range m.History {
+		nestedData, err := serializer.MarshalWellKnown(item)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		nestedSize := len(nestedData)
+		binary.LittleEndian.PutUint32(buf[currentOffset:], uint32(nestedSize))
+		copy(buf[currentOffset+4:], nestedData)
+		currentOffset += 4 + nestedSize
+		publicPayloadOffset += 4 + nestedSize
+	}
+
+	// === PRIVATE SEGMENT ===
+	privateStart := publicSegmentSize
+	buf[privateStart] = 0x01 // version byte
+
+	// Write private fields
+	privateTableStart := privateStart + 1 // 16 bytes table
+	privatePayloadStart := privateTableStart + 16
+	privatePayloadOffset := 0
+	_ = privatePayloadStart
+	_ = privatePayloadOffset
+
+	// Private segment offsets are stored relative to privateStart
+	// Field 2 (Ttl): nested message
+	if m.Ttl != nil {
+		binary.LittleEndian.PutUint32(buf[privateTableStart+0:], uint32((privatePayloadStart+privatePayloadOffset)-privateStart))
+		nestedData, err := serializer.MarshalWellKnown(m.Ttl)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		nestedSize := len(nestedData)
+		binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset:], uint32(nestedSize))
+		copy(buf[privatePayloadStart+privatePayloadOffset+4:], nestedData)
+		privatePayloadOffset += 4 + nestedSize
+	} else {
+		binary.LittleEndian.PutUint32(buf[privateTableStart+0:], 0)
+	}
+
+	// Field 3 (Detail): nested message
+	if m.Detail != nil {
+		binary.LittleEndian.PutUint32(buf[privateTableStart+4:], uint32((privatePayloadStart+privatePayloadOffset)-privateStart))
+		nestedData, err := serializer.MarshalWellKnown(m.Detail)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		nestedSize := len(nestedData)
+		binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset:], uint32(nestedSize))
+		copy(buf[privatePayloadStart+privatePayloadOffset+4:], nestedData)
+		privatePayloadOffset += 4 + nestedSize
+	} else {
+		binary.LittleEndian.PutUint32(buf[privateTableStart+4:], 0)
+	}
+
+	// Field 4 (Attrs): nested message
+	if m.Attrs != nil {
+		binary.LittleEndian.PutUint32(buf[privateTableStart+8:], uint32((privatePayloadStart+privatePayloadOffset)-privateStart))
+		nestedData, err := serializer.MarshalWellKnown(m.Attrs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		nestedSize := len(nestedData)
+		binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset:], uint32(nestedSize))
+		copy(buf[privatePayloadStart+privatePayloadOffset+4:], nestedData)
+		privatePayloadOffset += 4 + nestedSize
+	} else {
+		binary.LittleEndian.PutUint32(buf[privateTableStart+8:], 0)
+	}
+
+	// Field 6 (Version): nested message
+	if m.Version != nil {
+		binary.LittleEndian.PutUint32(buf[privateTableStart+12:], uint32((privatePayloadStart+privatePayloadOffset)-privateStart))
+		nestedData, err := serializer.MarshalWellKnown(m.Version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		nestedSize := len(nestedData)
+		binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset:], uint32(nestedSize))
+		copy(buf[privatePayloadStart+privatePayloadOffset+4:], nestedData)
+		privatePayloadOffset += 4 + nestedSize
+	} else {
+		binary.LittleEndian.PutUint32(buf[privateTableStart+12:], 0)
+	}
+
+	return buf, nil
+}
+
+func (m *WellKnown) UnmarshalSymphony(data []byte) error {
+	return m.UnmarshalSymphonyArena(data, nil)
+}
+
+// symphonyArenaWellKnown identifies WellKnown in a serializer.Arena
+var symphonyArenaWellKnown = serializer.NewArenaType()
+
+// UnmarshalSymphonyArena is UnmarshalSymphony allocating the nested messages from arena,
+// which must not be released while they are in use. A nil arena allocates from the heap.
+func (m *WellKnown) UnmarshalSymphonyArena(data []byte, arena *serializer.Arena) error {
+	if len(data) < 13 {
+		return fmt.Errorf("invalid data: too short")
+	}
+
+	// Validate public segment version
+	if data[0] != 0x01 {
+		return fmt.Errorf("invalid data: wrong public version")
+	}
+
+	// Read reserved header
+	offsetToPrivate := int(binary.LittleEndian.Uint32(data[1:5]))
+	// service_name := binary.LittleEndian.Uint32(data[5:9])  // not used yet
+	// method_name := binary.LittleEndian.Uint32(data[9:13])  // not used yet
+
+	// Assert private segment exists
+	if offsetToPrivate >= len(data) || data[offsetToPrivate] != 0x01 {
+		return fmt.Errorf("missing private segment")
+	}
+
+	payloadOffset := 0
+	_ = payloadOffset
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+
+	// === PUBLIC FIELDS ===
+	publicTableStart := 13
+	_ = publicTableStart
+	// Field 1 (Created): nested message
+	if len(data) >= publicTableStart+0+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[publicTableStart+0:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.Created = &timestamppb.Timestamp{}
+				if err := serializer.UnmarshalWellKnown(data[payloadOffset+4:payloadOffset+4+dataLen], m.Created); err != nil {
+					return fmt.Errorf("failed to unmarshal nested message: %w", err)
+				}
+			}
+		}
+	}
+
+	// Field 5 (Nickname): nested message
+	if len(data) >= publicTableStart+4+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[publicTableStart+4:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.Nickname = &wrapperspb.StringValue{}
+				if err := serializer.UnmarshalWellKnown(data[payloadOffset+4:payloadOffset+4+dataLen], m.Nickname); err != nil {
+					return fmt.Errorf("failed to unmarshal nested message: %w", err)
+				}
+			}
+		}
+	}
+
+	// Field 7 (History): repeated nested message
+	if len(data) >= publicTableStart+8+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[publicTableStart+8:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			m.History = make([]*timestamppb.Timestamp, 0, count)
+			currentOffset = payloadOffset + 4
+			for i := 0; i < count; i++ {
+				if len(data) >= currentOffset+4 {
+					itemLen := int(binary.LittleEndian.Uint32(data[currentOffset:]))
+					if len(data) >= currentOffset+4+itemLen {
+						item := &timestamppb.Timestamp{}
+						if err := serializer.UnmarshalWellKnown(data[currentOffset+4:currentOffset+4+itemLen], item); err != nil {
+							return fmt.Errorf("failed to unmarshal nested message: %w", err)
+						}
+						m.History = append(m.History, item)
+						currentOffset += 4 + itemLen
+					}
+				}
+			}
+		}
+	}
+
+	// === PRIVATE FIELDS ===
+	privateTableStart := offsetToPrivate + 1
+	_ = privateTableStart
+	// Private segment offsets are relative to offsetToPrivate
+	// Field 2 (Ttl): nested message
+	if len(data) >= privateTableStart+0+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[privateTableStart+0:]))
+		if payloadOffset > 0 {
+			payloadOffset += offsetToPrivate // convert relative offset to absolute
+		}
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.Ttl = &durationpb.Duration{}
+				if err := serializer.UnmarshalWellKnown(data[payloadOffset+4:payloadOffset+4+dataLen], m.Ttl); err != nil {
+					return fmt.Errorf("failed to unmarshal nested message: %w", err)
+				}
+			}
+		}
+	}
+
+	// Field 3 (Detail): nested message
+	if len(data) >= privateTableStart+4+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[privateTableStart+4:]))
+		if payloadOffset > 0 {
+			payloadOffset += offsetToPrivate // convert relative offset to absolute
+		}
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.Detail = &anypb.Any{}
+				if err := serializer.UnmarshalWellKnown(data[payloadOffset+4:payloadOffset+4+dataLen], m.Detail); err != nil {
+					return fmt.Errorf("failed to unmarshal nested message: %w", err)
+				}
+			}
+		}
+	}
+
+	// Field 4 (Attrs): nested message
+	if len(data) >= privateTableStart+8+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[privateTableStart+8:]))
+		if payloadOffset > 0 {
+			payloadOffset += offsetToPrivate // convert relative offset to absolute
+		}
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.Attrs = &structpb.Struct{}
+				if err := serializer.UnmarshalWellKnown(data[payloadOffset+4:payloadOffset+4+dataLen], m.Attrs); err != nil {
+					return fmt.Errorf("failed to unmarshal nested message: %w", err)
+				}
+			}
+		}
+	}
+
+	// Field 6 (Version): nested message
+	if len(data) >= privateTableStart+12+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[privateTableStart+12:]))
+		if payloadOffset > 0 {
+			payloadOffset += offsetToPrivate // convert relative offset to absolute
+		}
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.Version = &wrapperspb.Int64Value{}
+				if err := serializer.UnmarshalWellKnown(data[payloadOffset+4:payloadOffset+4+dataLen], m.Version); err != nil {
+					return fmt.Errorf("failed to unmarshal nested message: %w", err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+type WellKnownRaw []byte
+
+func (m WellKnownRaw) MarshalSymphony() ([]byte, error) {
+	return []byte(m), nil
+}
+
+func (m *WellKnownRaw) UnmarshalSymphony(data []byte) error {
+	*m = WellKnownRaw(data)
+	return nil
+}
+
+func (m WellKnownRaw) GetCreated() *timestamppb.Timestamp {
+	// Field 1 (Created): nested message
+	if len(m) < 13+4 {
+		return nil
+	}
+	payloadOffset := int(binary.LittleEndian.Uint32(m[13:]))
+	if payloadOffset == 0 {
+		return nil
+	}
+	if len(m) < payloadOffset+4 {
+		return nil
+	}
+	nestedSize := int(binary.LittleEndian.Uint32(m[payloadOffset:]))
+	if len(m) < payloadOffset+4+nestedSize {
+		return nil
+	}
+	v := &timestamppb.Timestamp{}
+	if err := serializer.UnmarshalWellKnown(m[payloadOffset+4:payloadOffset+4+nestedSize], v); err != nil {
+		return nil
+	}
+	return v
+}
+
+func (m WellKnownRaw) GetTtl() *durationpb.Duration {
+	// ASSERT: Private field requires complete buffer
+	if len(m) < 5 {
+		panic(fmt.Sprintf("private getter Ttl called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter Ttl called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
+	}
+	// Field 2 (Ttl): nested message
+	if len(m) < offsetToPrivate+1+4 {
+		return nil
+	}
+	payloadOffset := int(binary.LittleEndian.Uint32(m[offsetToPrivate+1:]))
+	if payloadOffset == 0 {
+		return nil
+	}
+	payloadOffset += offsetToPrivate // convert relative offset to absolute
+	if len(m) < payloadOffset+4 {
+		return nil
+	}
+	nestedSize := int(binary.LittleEndian.Uint32(m[payloadOffset:]))
+	if len(m) < payloadOffset+4+nestedSize {
+		return nil
+	}
+	v := &durationpb.Duration{}
+	if err := serializer.UnmarshalWellKnown(m[payloadOffset+4:payloadOffset+4+nestedSize], v); err != nil {
+		return nil
+	}
+	return v
+}
+
+func (m WellKnownRaw) GetDetail() *anypb.Any {
+	// ASSERT: Private field requires complete buffer
+	if len(m) < 5 {
+		panic(fmt.Sprintf("private getter Detail called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter Detail called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
+	}
+	// Field 3 (Detail): nested message
+	if len(m) < offsetToPrivate+5+4 {
+		return nil
+	}
+	payloadOffset := int(binary.LittleEndian.Uint32(m[offsetToPrivate+5:]))
+	if payloadOffset == 0 {
+		return nil
+	}
+	payloadOffset += offsetToPrivate // convert relative offset to absolute
+	if len(m) < payloadOffset+4 {
+		return nil
+	}
+	nestedSize := int(binary.LittleEndian.Uint32(m[payloadOffset:]))
+	if len(m) < payloadOffset+4+nestedSize {
+		return nil
+	}
+	v := &anypb.Any{}
+	if err := serializer.UnmarshalWellKnown(m[payloadOffset+4:payloadOffset+4+nestedSize], v); err != nil {
+		return nil
+	}
+	return v
+}
+
+func (m WellKnownRaw) GetAttrs() *structpb.Struct {
+	// ASSERT: Private field requires complete buffer
+	if len(m) < 5 {
+		panic(fmt.Sprintf("private getter Attrs called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter Attrs called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
+	}
+	// Field 4 (Attrs): nested message
+	if len(m) < offsetToPrivate+9+4 {
+		return nil
+	}
+	payloadOffset := int(binary.LittleEndian.Uint32(m[offsetToPrivate+9:]))
+	if payloadOffset == 0 {
+		return nil
+	}
+	payloadOffset += offsetToPrivate // convert relative offset to absolute
+	if len(m) < payloadOffset+4 {
+		return nil
+	}
+	nestedSize := int(binary.LittleEndian.Uint32(m[payloadOffset:]))
+	if len(m) < payloadOffset+4+nestedSize {
+		return nil
+	}
+	v := &structpb.Struct{}
+	if err := serializer.UnmarshalWellKnown(m[payloadOffset+4:payloadOffset+4+nestedSize], v); err != nil {
+		return nil
+	}
+	return v
+}
+
+func (m WellKnownRaw) GetNickname() *wrapperspb.StringValue {
+	// Field 5 (Nickname): nested message
+	if len(m) < 17+4 {
+		return nil
+	}
+	payloadOffset := int(binary.LittleEndian.Uint32(m[17:]))
+	if payloadOffset == 0 {
+		return nil
+	}
+	if len(m) < payloadOffset+4 {
+		return nil
+	}
+	nestedSize := int(binary.LittleEndian.Uint32(m[payloadOffset:]))
+	if len(m) < payloadOffset+4+nestedSize {
+		return nil
+	}
+	v := &wrapperspb.StringValue{}
+	if err := serializer.UnmarshalWellKnown(m[payloadOffset+4:payloadOffset+4+nestedSize], v); err != nil {
+		return nil
+	}
+	return v
+}
+
+func (m WellKnownRaw) GetVersion() *wrapperspb.Int64Value {
+	// ASSERT: Private field requires complete buffer
+	if len(m) < 5 {
+		panic(fmt.Sprintf("private getter Version called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter Version called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
+	}
+	// Field 6 (Version): nested message
+	if len(m) < offsetToPrivate+13+4 {
+		return nil
+	}
+	payloadOffset := int(binary.LittleEndian.Uint32(m[offsetToPrivate+13:]))
+	if payloadOffset == 0 {
+		return nil
+	}
+	payloadOffset += offsetToPrivate // convert relative offset to absolute
+	if len(m) < payloadOffset+4 {
+		return nil
+	}
+	nestedSize := int(binary.LittleEndian.Uint32(m[payloadOffset:]))
+	if len(m) < payloadOffset+4+nestedSize {
+		return nil
+	}
+	v := &wrapperspb.Int64Value{}
+	if err := serializer.UnmarshalWellKnown(m[payloadOffset+4:payloadOffset+4+nestedSize], v); err != nil {
+		return nil
+	}
+	return v
+}
+
+func (m WellKnownRaw) GetHistory() []*timestamppb.Timestamp {
+	// Field 7 (History): repeated nested message
+	if len(m) < 21+4 {
+		return nil
+	}
+	payloadOffset := int(binary.LittleEndian.Uint32(m[21:]))
+	if payloadOffset == 0 {
+		return nil
+	}
+	if len(m) < payloadOffset+4 {
+		return nil
+	}
+	count := int(binary.LittleEndian.Uint32(m[payloadOffset:]))
+	result := make([]*timestamppb.Timestamp, count)
+	currentOffset := payloadOffset + 4
+	for i := 0; i < count; i++ {
+		if len(m) < currentOffset+4 {
+			return nil
+		}
+		nestedSize := int(binary.LittleEndian.Uint32(m[currentOffset:]))
+		if len(m) < currentOffset+4+nestedSize {
+			return nil
+		}
+		result[i] = &timestamppb.Timestamp{}
+		if err := serializer.UnmarshalWellKnown(m[currentOffset+4:currentOffset+4+nestedSize], result[i]); err != nil {
+			return nil
+		}
+		currentOffset += 4 + nestedSize
+	}
+	return result
+}
+
+func (m *WellKnownRaw) SetCreated(v *timestamppb.Timestamp) error {
+	// ASSERT: Public field setter requires public-only buffer
+	if len(*m) >= 5 {
+		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
+			panic(fmt.Sprintf("public setter Created called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
+		}
+	}
+	// Field 1 (Created): nested message
+	if len(*m) < 13+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[13:]))
+	var oldNestedSize int
+	if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+4 {
+		oldNestedSize = int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset:]))
+	}
+	if v != nil {
+		encoded, err := serializer.MarshalWellKnown(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		if oldPayloadOffset > 0 && len(encoded) <= oldNestedSize {
+			// Update in-place (waste space)
+			binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(len(encoded)))
+			copy((*m)[oldPayloadOffset+4:], encoded)
+			return nil
+		}
+	}
+	// Need to remarshal: unmarshal, update, marshal, truncate to public-only
+	var temp WellKnown
+	// Create a fake complete buffer by appending a minimal private segment
+	// Calculate private table size
+	privateTableSize := 16                                   // bytes needed for empty private table
+	fakeComplete := make([]byte, len(*m)+1+privateTableSize) // version byte + private table
+	copy(fakeComplete, *m)
+	// Update offsetToPrivate to point to the appended private segment
+	binary.LittleEndian.PutUint32(fakeComplete[1:5], uint32(len(*m)))
+	fakeComplete[len(*m)] = 0x01 // private segment version
+	if err := temp.UnmarshalSymphony(fakeComplete); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.Created = v
+	fullData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(fullData[1:5]))
+	*m = WellKnownRaw(fullData[:offsetToPrivate])
+	return nil
+}
+
+func (m *WellKnownRaw) SetTtl(v *durationpb.Duration) error {
+	// ASSERT: Private field setter requires complete buffer
+	if len(*m) < 5 {
+		panic(fmt.Sprintf("private setter Ttl called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter Ttl called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
+	}
+	// Field 2 (Ttl): nested message
+	if len(*m) < offsetToPrivate+1+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[offsetToPrivate+1:]))
+	if oldPayloadOffset > 0 {
+		oldPayloadOffset += offsetToPrivate // convert relative offset to absolute
+	}
+	var oldNestedSize int
+	if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+4 {
+		oldNestedSize = int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset:]))
+	}
+	if v != nil {
+		encoded, err := serializer.MarshalWellKnown(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		if oldPayloadOffset > 0 && len(encoded) <= oldNestedSize {
+			// Update in-place (waste space)
+			binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(len(encoded)))
+			copy((*m)[oldPayloadOffset+4:], encoded)
+			return nil
+		}
+	}
+	// Need to remarshal: unmarshal, update, marshal
+	var temp WellKnown
+	if err := temp.UnmarshalSymphony([]byte(*m)); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.Ttl = v
+	newData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	*m = WellKnownRaw(newData)
+	return nil
+}
+
+func (m *WellKnownRaw) SetDetail(v *anypb.Any) error {
+	// ASSERT: Private field setter requires complete buffer
+	if len(*m) < 5 {
+		panic(fmt.Sprintf("private setter Detail called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter Detail called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
+	}
+	// Field 3 (Detail): nested message
+	if len(*m) < offsetToPrivate+5+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[offsetToPrivate+5:]))
+	if oldPayloadOffset > 0 {
+		oldPayloadOffset += offsetToPrivate // convert relative offset to absolute
+	}
+	var oldNestedSize int
+	if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+4 {
+		oldNestedSize = int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset:]))
+	}
+	if v != nil {
+		encoded, err := serializer.MarshalWellKnown(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		if oldPayloadOffset > 0 && len(encoded) <= oldNestedSize {
+			// Update in-place (waste space)
+			binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(len(encoded)))
+			copy((*m)[oldPayloadOffset+4:], encoded)
+			return nil
+		}
+	}
+	// Need to remarshal: unmarshal, update, marshal
+	var temp WellKnown
+	if err := temp.UnmarshalSymphony([]byte(*m)); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.Detail = v
+	newData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	*m = WellKnownRaw(newData)
+	return nil
+}
+
+func (m *WellKnownRaw) SetAttrs(v *structpb.Struct) error {
+	// ASSERT: Private field setter requires complete buffer
+	if len(*m) < 5 {
+		panic(fmt.Sprintf("private setter Attrs called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter Attrs called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
+	}
+	// Field 4 (Attrs): nested message
+	if len(*m) < offsetToPrivate+9+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[offsetToPrivate+9:]))
+	if oldPayloadOffset > 0 {
+		oldPayloadOffset += offsetToPrivate // convert relative offset to absolute
+	}
+	var oldNestedSize int
+	if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+4 {
+		oldNestedSize = int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset:]))
+	}
+	if v != nil {
+		encoded, err := serializer.MarshalWellKnown(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		if oldPayloadOffset > 0 && len(encoded) <= oldNestedSize {
+			// Update in-place (waste space)
+			binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(len(encoded)))
+			copy((*m)[oldPayloadOffset+4:], encoded)
+			return nil
+		}
+	}
+	// Need to remarshal: unmarshal, update, marshal
+	var temp WellKnown
+	if err := temp.UnmarshalSymphony([]byte(*m)); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.Attrs = v
+	newData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	*m = WellKnownRaw(newData)
+	return nil
+}
+
+func (m *WellKnownRaw) SetNickname(v *wrapperspb.StringValue) error {
+	// ASSERT: Public field setter requires public-only buffer
+	if len(*m) >= 5 {
+		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
+			panic(fmt.Sprintf("public setter Nickname called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
+		}
+	}
+	// Field 5 (Nickname): nested message
+	if len(*m) < 17+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[17:]))
+	var oldNestedSize int
+	if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+4 {
+		oldNestedSize = int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset:]))
+	}
+	if v != nil {
+		encoded, err := serializer.MarshalWellKnown(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		if oldPayloadOffset > 0 && len(encoded) <= oldNestedSize {
+			// Update in-place (waste space)
+			binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(len(encoded)))
+			copy((*m)[oldPayloadOffset+4:], encoded)
+			return nil
+		}
+	}
+	// Need to remarshal: unmarshal, update, marshal, truncate to public-only
+	var temp WellKnown
+	// Create a fake complete buffer by appending a minimal private segment
+	// Calculate private table size
+	privateTableSize := 16                                   // bytes needed for empty private table
+	fakeComplete := make([]byte, len(*m)+1+privateTableSize) // version byte + private table
+	copy(fakeComplete, *m)
+	// Update offsetToPrivate to point to the appended private segment
+	binary.LittleEndian.PutUint32(fakeComplete[1:5], uint32(len(*m)))
+	fakeComplete[len(*m)] = 0x01 // private segment version
+	if err := temp.UnmarshalSymphony(fakeComplete); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.Nickname = v
+	fullData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(fullData[1:5]))
+	*m = WellKnownRaw(fullData[:offsetToPrivate])
+	return nil
+}
+
+func (m *WellKnownRaw) SetVersion(v *wrapperspb.Int64Value) error {
+	// ASSERT: Private field setter requires complete buffer
+	if len(*m) < 5 {
+		panic(fmt.Sprintf("private setter Version called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter Version called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
+	}
+	// Field 6 (Version): nested message
+	if len(*m) < offsetToPrivate+13+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[offsetToPrivate+13:]))
+	if oldPayloadOffset > 0 {
+		oldPayloadOffset += offsetToPrivate // convert relative offset to absolute
+	}
+	var oldNestedSize int
+	if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+4 {
+		oldNestedSize = int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset:]))
+	}
+	if v != nil {
+		encoded, err := serializer.MarshalWellKnown(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		if oldPayloadOffset > 0 && len(encoded) <= oldNestedSize {
+			// Update in-place (waste space)
+			binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(len(encoded)))
+			copy((*m)[oldPayloadOffset+4:], encoded)
+			return nil
+		}
+	}
+	// Need to remarshal: unmarshal, update, marshal
+	var temp WellKnown
+	if err := temp.UnmarshalSymphony([]byte(*m)); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.Version = v
+	newData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	*m = WellKnownRaw(newData)
+	return nil
+}
+
+func (m *WellKnownRaw) SetHistory(v []*timestamppb.Timestamp) error {
+	// ASSERT: Public field setter requires public-only buffer
+	if len(*m) >= 5 {
+		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
+			panic(fmt.Sprintf("public setter History called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
+		}
+	}
+	// Field 7 (History): repeated nested message
+	if len(*m) < 21+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[21:]))
+	var oldCount int
+	var oldDataSize int
+	if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+4 {
+		oldCount = int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset:]))
+		// Calculate old data size: 4 bytes count + for each item: 4 bytes size + data
+		oldDataSize = 4
+		currentOffset := oldPayloadOffset + 4
+		for i := 0; i < oldCount; i++ {
+			if len(*m) < currentOffset+4 {
+				break
+			}
+			itemSize := int(binary.LittleEndian.Uint32((*m)[currentOffset:]))
+			oldDataSize += 4 + itemSize
+			currentOffset += 4 + itemSize
+		}
+	}
+	newCount := len(v)
+	newDataSize := 4 // count
+	encoded := make([][]byte, len(v))
+	for i, item := range v {
+		data, err := serializer.MarshalWellKnown(item)
+		if err != nil {
+			return fmt.Errorf("failed to marshal nested message: %w", err)
+		}
+		encoded[i] = data
+		newDataSize += 4 + len(data) // 4 bytes size + data
+	}
+	if oldPayloadOffset > 0 && newDataSize <= oldDataSize {
+		// Update in-place (waste space)
+		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(newCount))
+		currentOffset := oldPayloadOffset + 4
+		for _, item := range encoded {
+			itemSize := len(item)
+			binary.LittleEndian.PutUint32((*m)[currentOffset:], uint32(itemSize))
+			copy((*m)[currentOffset+4:], item)
+			currentOffset += 4 + itemSize
+		}
+		return nil
+	}
+	// Need to remarshal: unmarshal, update, marshal, truncate to public-only
+	var temp WellKnown
+	// Create a fake complete buffer by appending a minimal private segment
+	// Calculate private table size
+	privateTableSize := 16                                   // bytes needed for empty private table
+	fakeComplete := make([]byte, len(*m)+1+privateTableSize) // version byte + private table
+	copy(fakeComplete, *m)
+	// Update offsetToPrivate to point to the appended private segment
+	binary.LittleEndian.PutUint32(fakeComplete[1:5], uint32(len(*m)))
+	fakeComplete[len(*m)] = 0x01 // private segment version
+	if err := temp.UnmarshalSymphony(fakeComplete); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.History = v
+	fullData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(fullData[1:5]))
+	*m = WellKnownRaw(fullData[:offsetToPrivate])
+	return nil
+}
+
+// String renders the message in a protobuf-text-like format for debugging.
+// Private fields are omitted when the buffer only holds the public segment.
+func (m WellKnownRaw) String() string {
+	text, err := m.MarshalText()
+	if err != nil {
+		return fmt.Sprintf("<invalid WellKnown: %v>", err)
+	}
+	return string(text)
+}
+
+// MarshalText implements encoding.TextMarshaler using the format of String
+func (m WellKnownRaw) MarshalText() (text []byte, err error) {
+	if len(m) < 13 || m[0] != 0x01 {
+		return nil, fmt.Errorf("invalid data: too short or wrong public version")
+	}
+	// Getters do not validate offsets against each other, so recover from malformed buffers
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = nil, fmt.Errorf("invalid data: %v", r)
+		}
+	}()
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	hasPrivate := offsetToPrivate < len(m) && m[offsetToPrivate] == 0x01
+	_ = hasPrivate
+	var b strings.Builder
+	if v := m.GetCreated(); v != nil {
+		fmt.Fprintf(&b, "created: %s ", serializer.WellKnownText(v))
+	}
+	if hasPrivate {
+		if v := m.GetTtl(); v != nil {
+			fmt.Fprintf(&b, "ttl: %s ", serializer.WellKnownText(v))
+		}
+	}
+	if hasPrivate {
+		if v := m.GetDetail(); v != nil {
+			fmt.Fprintf(&b, "detail: %s ", serializer.WellKnownText(v))
+		}
+	}
+	if hasPrivate {
+		if v := m.GetAttrs(); v != nil {
+			fmt.Fprintf(&b, "attrs: %s ", serializer.WellKnownText(v))
+		}
+	}
+	if v := m.GetNickname(); v != nil {
+		fmt.Fprintf(&b, "nickname: %s ", serializer.WellKnownText(v))
+	}
+	if hasPrivate {
+		if v := m.GetVersion(); v != nil {
+			fmt.Fprintf(&b, "version: %s ", serializer.WellKnownText(v))
+		}
+	}
+	for _, v := range m.GetHistory() {
+		fmt.Fprintf(&b, "history: %s ", serializer.WellKnownText(v))
+	}
+	return []byte(strings.TrimSpace(b.String())), nil
+}
+
+// MarshalSymphonyPublic marshals only the public fields (without header)
+func (m *Deltas) MarshalSymphonyPublic() ([]byte, error) {
+	size := 0
+	size += 8 // table
+	size += 8 + serializer.DeltaEncodedSize(m.Timestamps)
+	size += 4 + 4*len(m.Counts)
+	buf := make([]byte, size)
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+	tableStart := 0
+	payloadStart := tableStart + 8
+	payloadOffset := 0
+	_ = payloadStart
+	_ = payloadOffset
+
+	// Field 1 (Timestamps): repeated delta-encoded
+	binary.LittleEndian.PutUint32(buf[tableStart+0:], uint32(payloadStart+payloadOffset))
+	count = len(m.Timestamps)
+	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(count))
+	dataLen = serializer.PutDeltaEncoded(buf[payloadStart+payloadOffset+8:], m.Timestamps)
+	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset+4:], uint32(dataLen))
+	payloadOffset += 8 + dataLen
+
+	// Field 4 (Counts): repeated fixed-length
+	binary.LittleEndian.PutUint32(buf[tableStart+4:], uint32(payloadStart+payloadOffset))
+	count = len(m.Counts)
+	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(count))
+	serializer.PutUint32s(buf[payloadStart+payloadOffset+4:], m.Counts)
+	payloadOffset += 4 + 4*len(m.Counts)
+
+	return buf, nil
+}
+
+// MarshalSymphonyPrivate marshals only the private fields (without header)
+func (m *Deltas) MarshalSymphonyPrivate() ([]byte, error) {
+	size := 0
+	size += 8 // table
+	size += 8 + serializer.DeltaEncodedSize(m.ProductIds)
+	size += 8 + serializer.DeltaEncodedSize(m.Offsets)
+	buf := make([]byte, size)
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+	tableStart := 0
+	payloadStart := tableStart + 8
+	payloadOffset := 0
+	_ = payloadStart
+	_ = payloadOffset
+
+	// Field 2 (ProductIds): repeated delta-encoded
+	binary.LittleEndian.PutUint32(buf[tableStart+0:], uint32(payloadStart+payloadOffset))
+	count = len(m.ProductIds)
+	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(count))
+	dataLen = serializer.PutDeltaEncoded(buf[payloadStart+payloadOffset+8:], m.ProductIds)
+	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset+4:], uint32(dataLen))
+	payloadOffset += 8 + dataLen
+
+	// Field 3 (Offsets): repeated delta-encoded
+	binary.LittleEndian.PutUint32(buf[tableStart+4:], uint32(payloadStart+payloadOffset))
+	count = len(m.Offsets)
+	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(count))
+	dataLen = serializer.PutDeltaEncoded(buf[payloadStart+payloadOffset+8:], m.Offsets)
+	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset+4:], uint32(dataLen))
+	payloadOffset += 8 + dataLen
+
+	return buf, nil
+}
+
+// UnmarshalSymphonyPublic unmarshals only the public fields (without header)
+func (m *Deltas) UnmarshalSymphonyPublic(data []byte) error {
+	payloadOffset := 0
+	_ = payloadOffset
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+	tableStart := 0
+	_ = tableStart
+
+	// Field 1 (Timestamps): repeated delta-encoded
+	if len(data) >= tableStart+0+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart+0:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+8 {
+			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset+4:]))
+			if len(data) >= payloadOffset+8+dataLen {
+				values, err := serializer.DecodeDeltaEncoded[int64](data[payloadOffset+8:payloadOffset+8+dataLen], count)
+				if err != nil {
+					return fmt.Errorf("field Timestamps: %w", err)
+				}
+				m.Timestamps = values
+			}
+		}
+	}
+
+	// Field 4 (Counts): repeated fixed-length
+	if len(data) >= tableStart+4+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart+4:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+count*4 {
+				m.Counts = make([]uint32, count)
+				serializer.GetUint32s(m.Counts, data[payloadOffset+4:])
+			}
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalSymphonyPrivate unmarshals only the private fields (without header)
+func (m *Deltas) UnmarshalSymphonyPrivate(data []byte) error {
+	payloadOffset := 0
+	_ = payloadOffset
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+	tableStart := 0
+	_ = tableStart
+
+	// Field 2 (ProductIds): repeated delta-encoded
+	if len(data) >= tableStart+0+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart+0:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+8 {
+			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset+4:]))
+			if len(data) >= payloadOffset+8+dataLen {
+				values, err := serializer.DecodeDeltaEncoded[int32](data[payloadOffset+8:payloadOffset+8+dataLen], count)
+				if err != nil {
+					return fmt.Errorf("field ProductIds: %w", err)
+				}
+				m.ProductIds = values
+			}
+		}
+	}
+
+	// Field 3 (Offsets): repeated delta-encoded
+	if len(data) >= tableStart+4+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart+4:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+8 {
+			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset+4:]))
+			if len(data) >= payloadOffset+8+dataLen {
+				values, err := serializer.DecodeDeltaEncoded[uint64](data[payloadOffset+8:payloadOffset+8+dataLen], count)
+				if err != nil {
+					return fmt.Errorf("field Offsets: %w", err)
+				}
+				m.Offsets = values
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *Deltas) MarshalSymphony() ([]byte, error) {
+	size := 0
+	// Public segment:
+	size += 1  // version byte
+	size += 12 // reserved: offset_to_private, service_name, method_name
+	size += 8  // table entries
+	// Field 1 (Timestamps): repeated delta-encoded payload
+	size += 8 + serializer.DeltaEncodedSize(m.Timestamps) // 4 bytes count + 4 bytes length + varints
+	// Field 4 (Counts): repeated fixed-length payload
+	size += 4 + 4*len(m.Counts) // 4 bytes count + data
+	// Private segment:
+	size += 1 // version byte
+	size += 8 // table entries
+	// Field 2 (ProductIds): repeated delta-encoded payload
+	size += 8 + serializer.DeltaEncodedSize(m.ProductIds) // 4 bytes count + 4 bytes length + varints
+	// Field 3 (Offsets): repeated delta-encoded payload
+	size += 8 + serializer.DeltaEncodedSize(m.Offsets) // 4 bytes count + 4 bytes length + varints
+
+	buf := make([]byte, size)
+
+	dataLen := 0 // avoid no new variables warning
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+
+	// === PUBLIC SEGMENT ===
+	buf[0] = 0x01 // version byte
+
+	// Calculate offset to private segment
+	publicSegmentSize := 13
+	publicSegmentSize += 4                                             // offset placeholder
+	publicSegmentSize += 4                                             // offset placeholder
+	publicSegmentSize += 8 + serializer.DeltaEncodedSize(m.Timestamps) // field 1 payload
+	publicSegmentSize += 4 + 4*len(m.Counts)                           // field 4 payload
+
+	// Write reserved header
+	binary.LittleEndian.PutUint32(buf[1:5], uint32(publicSegmentSize)) // offset_to_private
+	binary.LittleEndian.PutUint32(buf[5:9], 0)                         // service_id
+	binary.LittleEndian.PutUint32(buf[9:13], 0)                        // method_id
+
+	// Write public fields
+	publicTableStart := 13
+	publicPayloadStart := publicTableStart + 8
+	publicPayloadOffset := 0
+	_ = publicPayloadStart
+	_ = publicPayloadOffset
+
+	// Field 1 (Timestamps): repeated delta-encoded
+	binary.LittleEndian.PutUint32(buf[publicTableStart+0:], uint32(publicPayloadStart+publicPayloadOffset))
+	count = len(m.Timestamps)
+	binary.LittleEndian.PutUint32(buf[publicPayloadStart+publicPayloadOffset:], uint32(count))
+	dataLen = serializer.PutDeltaEncoded(buf[publicPayloadStart+publicPayloadOffset+8:], m.Timestamps)
+	binary.LittleEndian.PutUint32(buf[publicPayloadStart+publicPayloadOffset+4:], uint32(dataLen))
+	publicPayloadOffset += 8 + dataLen
+
+	// Field 4 (Counts): repeated fixed-length
+	binary.LittleEndian.PutUint32(buf[publicTableStart+4:], uint32(publicPayloadStart+publicPayloadOffset))
+	count = len(m.Counts)
+	binary.LittleEndian.PutUint32(buf[publicPayloadStart+publicPayloadOffset:], uint32(count))
+	serializer.PutUint32s(buf[publicPayloadStart+publicPayloadOffset+4:], m.Counts)
+	publicPayloadOffset += 4 + 4*len(m.Counts)
+
+	// === PRIVATE SEGMENT ===
+	privateStart := publicSegmentSize
+	buf[privateStart] = 0x01 // version byte
+
+	// Write private fields
+	privateTableStart := privateStart + 1 // 8 bytes table
+	privatePayloadStart := privateTableStart + 8
+	privatePayloadOffset := 0
+	_ = privatePayloadStart
+	_ = privatePayloadOffset
+
+	// Private segment offsets are stored relative to privateStart
+	// Field 2 (ProductIds): repeated delta-encoded
+	binary.LittleEndian.PutUint32(buf[privateTableStart+0:], uint32((privatePayloadStart+privatePayloadOffset)-privateStart))
+	count = len(m.ProductIds)
+	binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset:], uint32(count))
+	dataLen = serializer.PutDeltaEncoded(buf[privatePayloadStart+privatePayloadOffset+8:], m.ProductIds)
+	binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset+4:], uint32(dataLen))
+	privatePayloadOffset += 8 + dataLen
+
+	// Field 3 (Offsets): repeated delta-encoded
+	binary.LittleEndian.PutUint32(buf[privateTableStart+4:], uint32((privatePayloadStart+privatePayloadOffset)-privateStart))
+	count = len(m.Offsets)
+	binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset:], uint32(count))
+	dataLen = serializer.PutDeltaEncoded(buf[privatePayloadStart+privatePayloadOffset+8:], m.Offsets)
+	binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset+4:], uint32(dataLen))
+	privatePayloadOffset += 8 + dataLen
+
+	return buf, nil
+}
+
+func (m *Deltas) UnmarshalSymphony(data []byte) error {
+	return m.UnmarshalSymphonyArena(data, nil)
+}
+
+// symphonyArenaDeltas identifies Deltas in a serializer.Arena
+var symphonyArenaDeltas = serializer.NewArenaType()
+
+// UnmarshalSymphonyArena is UnmarshalSymphony allocating the nested messages from arena,
+// which must not be released while they are in use. A nil arena allocates from the heap.
+func (m *Deltas) UnmarshalSymphonyArena(data []byte, arena *serializer.Arena) error {
+	if len(data) < 13 {
+		return fmt.Errorf("invalid data: too short")
+	}
+
+	// Validate public segment version
+	if data[0] != 0x01 {
+		return fmt.Errorf("invalid data: wrong public version")
+	}
+
+	// Read reserved header
+	offsetToPrivate := int(binary.LittleEndian.Uint32(data[1:5]))
+	// service_name := binary.LittleEndian.Uint32(data[5:9])  // not used yet
+	// method_name := binary.LittleEndian.Uint32(data[9:13])  // not used yet
+
+	// Assert private segment exists
+	if offsetToPrivate >= len(data) || data[offsetToPrivate] != 0x01 {
+		return fmt.Errorf("missing private segment")
+	}
+
+	payloadOffset := 0
+	_ = payloadOffset
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+
+	// === PUBLIC FIELDS ===
+	publicTableStart := 13
+	_ = publicTableStart
+	// Field 1 (Timestamps): repeated delta-encoded
+	if len(data) >= publicTableStart+0+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[publicTableStart+0:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+8 {
+			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset+4:]))
+			if len(data) >= payloadOffset+8+dataLen {
+				values, err := serializer.DecodeDeltaEncoded[int64](data[payloadOffset+8:payloadOffset+8+dataLen], count)
+				if err != nil {
+					return fmt.Errorf("field Timestamps: %w", err)
+				}
+				m.Timestamps = values
+			}
+		}
+	}
+
+	// Field 4 (Counts): repeated fixed-length
+	if len(data) >= publicTableStart+4+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[publicTableStart+4:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+count*4 {
+				m.Counts = make([]uint32, count)
+				serializer.GetUint32s(m.Counts, data[payloadOffset+4:])
+			}
+		}
+	}
+
+	// === PRIVATE FIELDS ===
+	privateTableStart := offsetToPrivate + 1
+	_ = privateTableStart
+	// Private segment offsets are relative to offsetToPrivate
+	// Field 2 (ProductIds): repeated delta-encoded
+	if len(data) >= privateTableStart+0+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[privateTableStart+0:]))
+		if payloadOffset > 0 {
+			payloadOffset += offsetToPrivate // convert relative offset to absolute
+		}
+		if payloadOffset > 0 && len(data) >= payloadOffset+8 {
+			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset+4:]))
+			if len(data) >= payloadOffset+8+dataLen {
+				values, err := serializer.DecodeDeltaEncoded[int32](data[payloadOffset+8:payloadOffset+8+dataLen], count)
+				if err != nil {
+					return fmt.Errorf("field ProductIds: %w", err)
+				}
+				m.ProductIds = values
+			}
+		}
+	}
+
+	// Field 3 (Offsets): repeated delta-encoded
+	if len(data) >= privateTableStart+4+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[privateTableStart+4:]))
+		if payloadOffset > 0 {
+			payloadOffset += offsetToPrivate // convert relative offset to absolute
+		}
+		if payloadOffset > 0 && len(data) >= payloadOffset+8 {
+			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset+4:]))
+			if len(data) >= payloadOffset+8+dataLen {
+				values, err := serializer.DecodeDeltaEncoded[uint64](data[payloadOffset+8:payloadOffset+8+dataLen], count)
+				if err != nil {
+					return fmt.Errorf("field Offsets: %w", err)
+				}
+				m.Offsets = values
+			}
+		}
+	}
+
+	return nil
+}
+
+type DeltasRaw []byte
+
+func (m DeltasRaw) MarshalSymphony() ([]byte, error) {
+	return []byte(m), nil
+}
+
+func (m *DeltasRaw) UnmarshalSymphony(data []byte) error {
+	*m = DeltasRaw(data)
+	return nil
+}
+
+func (m DeltasRaw) GetTimestamps() []int64 {
+	// Field 1 (Timestamps): repeated delta-encoded
+	if len(m) < 13+4 {
+		return nil
+	}
+	payloadOffset := int(binary.LittleEndian.Uint32(m[13:]))
+	if payloadOffset == 0 {
+		return nil
+	}
+	if len(m) < payloadOffset+8 {
+		return nil
+	}
+	count := int(binary.LittleEndian.Uint32(m[payloadOffset:]))
+	dataLen := int(binary.LittleEndian.Uint32(m[payloadOffset+4:]))
+	if len(m) < payloadOffset+8+dataLen {
+		return nil
+	}
+	result, err := serializer.DecodeDeltaEncoded[int64](m[payloadOffset+8:payloadOffset+8+dataLen], count)
+	if err != nil {
+		return nil
+	}
+	return result
+}
+
+func (m DeltasRaw) GetProductIds() []int32 {
+	// ASSERT: Private field requires complete buffer
+	if len(m) < 5 {
+		panic(fmt.Sprintf("private getter ProductIds called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter ProductIds called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
+	}
+	// Field 2 (ProductIds): repeated delta-encoded
+	if len(m) < offsetToPrivate+1+4 {
+		return nil
+	}
+	payloadOffset := int(binary.LittleEndian.Uint32(m[offsetToPrivate+1:]))
+	if payloadOffset == 0 {
+		return nil
+	}
+	payloadOffset += offsetToPrivate // convert relative offset to absolute
+	if len(m) < payloadOffset+8 {
+		return nil
+	}
+	count := int(binary.LittleEndian.Uint32(m[payloadOffset:]))
+	dataLen := int(binary.LittleEndian.Uint32(m[payloadOffset+4:]))
+	if len(m) < payloadOffset+8+dataLen {
+		return nil
+	}
+	result, err := serializer.DecodeDeltaEncoded[int32](m[payloadOffset+8:payloadOffset+8+dataLen], count)
+	if err != nil {
+		return nil
+	}
+	return result
+}
+
+func (m DeltasRaw) GetOffsets() []uint64 {
+	// ASSERT: Private field requires complete buffer
+	if len(m) < 5 {
+		panic(fmt.Sprintf("private getter Offsets called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter Offsets called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
+	}
+	// Field 3 (Offsets): repeated delta-encoded
+	if len(m) < offsetToPrivate+5+4 {
+		return nil
+	}
+	payloadOffset := int(binary.LittleEndian.Uint32(m[offsetToPrivate+5:]))
+	if payloadOffset == 0 {
+		return nil
+	}
+	payloadOffset += offsetToPrivate // convert relative offset to absolute
+	if len(m) < payloadOffset+8 {
+		return nil
+	}
+	count := int(binary.LittleEndian.Uint32(m[payloadOffset:]))
+	dataLen := int(binary.LittleEndian.Uint32(m[payloadOffset+4:]))
+	if len(m) < payloadOffset+8+dataLen {
+		return nil
+	}
+	result, err := serializer.DecodeDeltaEncoded[uint64](m[payloadOffset+8:payloadOffset+8+dataLen], count)
+	if err != nil {
+		return nil
+	}
+	return result
+}
+
+func (m DeltasRaw) GetCounts() []uint32 {
+	// Field 4 (Counts): repeated fixed-length
+	if len(m) < 17+4 {
+		return nil
+	}
+	payloadOffset := int(binary.LittleEndian.Uint32(m[17:]))
+	if payloadOffset == 0 {
+		return nil
+	}
+	if len(m) < payloadOffset+4 {
+		return nil
+	}
+	count := int(binary.LittleEndian.Uint32(m[payloadOffset:]))
+	if len(m) < payloadOffset+4+4*count {
+		return nil
+	}
+	result := make([]uint32, count)
+	serializer.GetUint32s(result, m[payloadOffset+4:])
+	return result
+}
+
+func (m *DeltasRaw) SetTimestamps(v []int64) error {
+	// ASSERT: Public field setter requires public-only buffer
+	if len(*m) >= 5 {
+		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
+			panic(fmt.Sprintf("public setter Timestamps called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
+		}
+	}
+	// Field 1 (Timestamps): repeated delta-encoded
+	if len(*m) < 13+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[13:]))
+	var oldDataSize int
+	if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+8 {
+		oldDataSize = 8 + int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset+4:])) // count + length + varints
+	}
+	newDataSize := 8 + serializer.DeltaEncodedSize(v) // count + length + varints
+	if oldPayloadOffset > 0 && newDataSize <= oldDataSize && len(*m) >= oldPayloadOffset+oldDataSize {
+		// Update in-place (waste space)
+		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(len(v)))
+		dataLen := serializer.PutDeltaEncoded((*m)[oldPayloadOffset+8:], v)
+		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset+4:], uint32(dataLen))
+		return nil
+	}
+	// Need to remarshal: unmarshal, update, marshal, truncate to public-only
+	// Preserve reserved bytes (serviceID at bytes 5-9, methodID at bytes 9-13) from original buffer
+	var originalServiceID, originalMethodID uint32
+	if len(*m) >= 13 {
+		originalServiceID = binary.LittleEndian.Uint32((*m)[5:9])
+		originalMethodID = binary.LittleEndian.Uint32((*m)[9:13])
+	}
+	var temp Deltas
+	// Create a fake complete buffer by appending a minimal private segment
+	// Calculate private table size
+	privateTableSize := 8                                    // bytes needed for empty private table
+	fakeComplete := make([]byte, len(*m)+1+privateTableSize) // version byte + private table
+	copy(fakeComplete, *m)
+	// Update offsetToPrivate to point to the appended private segment
+	binary.LittleEndian.PutUint32(fakeComplete[1:5], uint32(len(*m)))
+	fakeComplete[len(*m)] = 0x01 // private segment version
+	if err := temp.UnmarshalSymphony(fakeComplete); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.Timestamps = v
+	fullData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	// Restore reserved bytes (serviceID and methodID) in the marshaled payload
+	if len(fullData) >= 13 {
+		binary.LittleEndian.PutUint32(fullData[5:9], originalServiceID)
+		binary.LittleEndian.PutUint32(fullData[9:13], originalMethodID)
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(fullData[1:5]))
+	*m = DeltasRaw(fullData[:offsetToPrivate])
+	return nil
+}
+
+func (m *DeltasRaw) SetProductIds(v []int32) error {
+	// ASSERT: Private field setter requires complete buffer
+	if len(*m) < 5 {
+		panic(fmt.Sprintf("private setter ProductIds called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter ProductIds called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
+	}
+	// Field 2 (ProductIds): repeated delta-encoded
+	if len(*m) < offsetToPrivate+1+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[offsetToPrivate+1:]))
+	if oldPayloadOffset > 0 {
+		oldPayloadOffset += offsetToPrivate // convert relative offset to absolute
+	}
+	var oldDataSize int
+	if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+8 {
+		oldDataSize = 8 + int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset+4:])) // count + length + varints
+	}
+	newDataSize := 8 + serializer.DeltaEncodedSize(v) // count + length + varints
+	if oldPayloadOffset > 0 && newDataSize <= oldDataSize && len(*m) >= oldPayloadOffset+oldDataSize {
+		// Update in-place (waste space)
+		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(len(v)))
+		dataLen := serializer.PutDeltaEncoded((*m)[oldPayloadOffset+8:], v)
+		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset+4:], uint32(dataLen))
+		return nil
+	}
+	// Need to remarshal: unmarshal, update, marshal
+	var temp Deltas
+	if err := temp.UnmarshalSymphony([]byte(*m)); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.ProductIds = v
+	newData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	*m = DeltasRaw(newData)
+	return nil
+}
+
+func (m *DeltasRaw) SetOffsets(v []uint64) error {
+	// ASSERT: Private field setter requires complete buffer
+	if len(*m) < 5 {
+		panic(fmt.Sprintf("private setter Offsets called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter Offsets called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
+	}
+	// Field 3 (Offsets): repeated delta-encoded
+	if len(*m) < offsetToPrivate+5+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[offsetToPrivate+5:]))
+	if oldPayloadOffset > 0 {
+		oldPayloadOffset += offsetToPrivate // convert relative offset to absolute
+	}
+	var oldDataSize int
+	if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+8 {
+		oldDataSize = 8 + int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset+4:])) // count + length + varints
+	}
+	newDataSize := 8 + serializer.DeltaEncodedSize(v) // count + length + varints
+	if oldPayloadOffset > 0 && newDataSize <= oldDataSize && len(*m) >= oldPayloadOffset+oldDataSize {
+		// Update in-place (waste space)
+		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(len(v)))
+		dataLen := serializer.PutDeltaEncoded((*m)[oldPayloadOffset+8:], v)
+		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset+4:], uint32(dataLen))
+		return nil
+	}
+	// Need to remarshal: unmarshal, update, marshal
+	var temp Deltas
+	if err := temp.UnmarshalSymphony([]byte(*m)); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.Offsets = v
+	newData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	*m = DeltasRaw(newData)
+	return nil
+}
+
+func (m *DeltasRaw) SetCounts(v []uint32) error {
+	// ASSERT: Public field setter requires public-only buffer
+	if len(*m) >= 5 {
+		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
+			panic(fmt.Sprintf("public setter Counts called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
+		}
+	}
+	// Field 4 (Counts): repeated fixed-length
+	if len(*m) < 17+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[17:]))
+	var oldCount int
+	var oldDataSize int
+	if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+4 {
+		oldCount = int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset:]))
+		oldDataSize = 4 + 4*oldCount // 4 bytes count + data
+	}
+	newCount := len(v)
+	newDataSize := 4 + 4*newCount // 4 bytes count + data
+	if oldPayloadOffset > 0 && newDataSize <= oldDataSize {
+		// Update in-place (waste space)
+		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(newCount))
+		serializer.PutUint32s((*m)[oldPayloadOffset+4:], v)
+		return nil
+	}
+	// Need to remarshal: unmarshal, update, marshal, truncate to public-only
+	// Preserve reserved bytes (serviceID at bytes 5-9, methodID at bytes 9-13) from original buffer
+	var originalServiceID, originalMethodID uint32
+	if len(*m) >= 13 {
+		originalServiceID = binary.LittleEndian.Uint32((*m)[5:9])
+		originalMethodID = binary.LittleEndian.Uint32((*m)[9:13])
+	}
+	var temp Deltas
+	// Create a fake complete buffer by appending a minimal private segment
+	// Calculate private table size
+	privateTableSize := 8                                    // bytes needed for empty private table
+	fakeComplete := make([]byte, len(*m)+1+privateTableSize) // version byte + private table
+	copy(fakeComplete, *m)
+	// Update offsetToPrivate to point to the appended private segment
+	binary.LittleEndian.PutUint32(fakeComplete[1:5], uint32(len(*m)))
+	fakeComplete[len(*m)] = 0x01 // private segment version
+	if err := temp.UnmarshalSymphony(fakeComplete); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.Counts = v
+	fullData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	// Restore reserved bytes (serviceID and methodID) in the marshaled payload
+	if len(fullData) >= 13 {
+		binary.LittleEndian.PutUint32(fullData[5:9], originalServiceID)
+		binary.LittleEndian.PutUint32(fullData[9:13], originalMethodID)
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(fullData[1:5]))
+	*m = DeltasRaw(fullData[:offsetToPrivate])
+	return nil
+}
+
+// String renders the message in a protobuf-text-like format for debugging.
+// Private fields are omitted when the buffer only holds the public segment.
+func (m DeltasRaw) String() string {
+	text, err := m.MarshalText()
+	if err != nil {
+		return fmt.Sprintf("<invalid Deltas: %v>", err)
+	}
+	return string(text)
+}
+
+// MarshalText implements encoding.TextMarshaler using the format of String
+func (m DeltasRaw) MarshalText() (text []byte, err error) {
+	if len(m) < 13 || m[0] != 0x01 {
+		return nil, fmt.Errorf("invalid data: too short or wrong public version")
+	}
+	// Getters do not validate offsets against each other, so recover from malformed buffers
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = nil, fmt.Errorf("invalid data: %v", r)
+		}
+	}()
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	hasPrivate := offsetToPrivate < len(m) && m[offsetToPrivate] == 0x01
+	_ = hasPrivate
+	var b strings.Builder
+	for _, v := range m.GetTimestamps() {
+		fmt.Fprintf(&b, "timestamps: %v ", v)
+	}
+	if hasPrivate {
+		for _, v := range m.GetProductIds() {
+			fmt.Fprintf(&b, "product_ids: %v ", v)
+		}
+	}
+	if hasPrivate {
+		for _, v := range m.GetOffsets() {
+			fmt.Fprintf(&b, "offsets: %v ", v)
+		}
+	}
+	for _, v := range m.GetCounts() {
+		fmt.Fprintf(&b, "counts: %v ", v)
+	}
+	return []byte(strings.TrimSpace(b.String())), nil
+}
+
+// MarshalSymphonyPublic marshals only the public fields (without header)
+func (m *Catalog) MarshalSymphonyPublic() ([]byte, error) {
+	size := 0
+	size += 16 // table
+	var dict serializer.StringDict
+	dict.Add(m.Region)
+	dict.AddAll(m.Currencies)
+	size += dict.EncodedSize() // string dictionary
+	size += 4 + 4*len(m.Currencies)
+	buf := make([]byte, size)
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+	tableStart := 0
+	payloadStart := tableStart + 16
+	payloadOffset := 0
+	_ = payloadStart
+	_ = payloadOffset
+
+	// Field 1 (Region): interned string
+	binary.LittleEndian.PutUint32(buf[tableStart+4:], dict.Ref(m.Region))
+
+	// Field 2 (Currencies): repeated interned string
+	binary.LittleEndian.PutUint32(buf[tableStart+8:], uint32(payloadStart+payloadOffset))
+	count = len(m.Currencies)
+	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(count))
+	for i, v := range m.Currencies {
+		binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset+4+4*i:], dict.Ref(v))
+	}
+	payloadOffset += 4 + 4*len(m.Currencies)
+
+	// Field 3 (Count): fixed-length (4 bytes)
+	binary.LittleEndian.PutUint32(buf[tableStart+12:], uint32(m.Count))
+
+	// String dictionary of the interned fields (offset stays 0 if empty)
+	if dict.Len() > 0 {
+		binary.LittleEndian.PutUint32(buf[tableStart:], uint32(payloadStart+payloadOffset))
+		payloadOffset += dict.Put(buf[payloadStart+payloadOffset:])
+	}
+
+	return buf, nil
+}
+
+// MarshalSymphonyPrivate marshals only the private fields (without header)
+func (m *Catalog) MarshalSymphonyPrivate() ([]byte, error) {
+	size := 0
+	size += 16 // table
+	var dict serializer.StringDict
+	dict.AddAll(m.Categories)
+	dict.Add(m.Owner)
+	size += dict.EncodedSize() // string dictionary
+	size += 4 + 4*len(m.Categories)
+	size += 4 + len(m.Note)
+	buf := make([]byte, size)
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+	tableStart := 0
+	payloadStart := tableStart + 16
+	payloadOffset := 0
+	_ = payloadStart
+	_ = payloadOffset
+
+	// Field 4 (Categories): repeated interned string
+	binary.LittleEndian.PutUint32(buf[tableStart+4:], uint32(payloadStart+payloadOffset))
+	count = len(m.Categories)
+	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(count))
+	for i, v := range m.Categories {
+		binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset+4+4*i:], dict.Ref(v))
+	}
+	payloadOffset += 4 + 4*len(m.Categories)
+
+	// Field 5 (Owner): interned string
+	binary.LittleEndian.PutUint32(buf[tableStart+8:], dict.Ref(m.Owner))
+
+	// Field 6 (Note): variable-length
+	binary.LittleEndian.PutUint32(buf[tableStart+12:], uint32(payloadStart+payloadOffset))
+	dataLen = len(m.Note)
+	binary.LittleEndian.PutUint32(buf[payloadStart+payloadOffset:], uint32(dataLen))
+	copy(buf[payloadStart+payloadOffset+4:], m.Note)
+	payloadOffset += 4 + len(m.Note)
+
+	// String dictionary of the interned fields (offset stays 0 if empty)
+	if dict.Len() > 0 {
+		binary.LittleEndian.PutUint32(buf[tableStart:], uint32(payloadStart+payloadOffset))
+		payloadOffset += dict.Put(buf[payloadStart+payloadOffset:])
+	}
+
+	return buf, nil
+}
+
+// UnmarshalSymphonyPublic unmarshals only the public fields (without header)
+func (m *Catalog) UnmarshalSymphonyPublic(data []byte) error {
+	payloadOffset := 0
+	_ = payloadOffset
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+	tableStart := 0
+	_ = tableStart
+
+	// String dictionary of the interned fields
+	var dict []string
+	if len(data) >= tableStart+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset {
+			entries, err := serializer.DecodeStringDict(data[payloadOffset:])
+			if err != nil {
+				return err
+			}
+			dict = entries
+		}
+	}
+
+	// Field 1 (Region): interned string
+	if len(data) >= tableStart+4+4 {
+		v, err := serializer.DictString(dict, binary.LittleEndian.Uint32(data[tableStart+4:]))
+		if err != nil {
+			return fmt.Errorf("field Region: %w", err)
+		}
+		m.Region = v
+	}
+
+	// Field 2 (Currencies): repeated interned string
+	if len(data) >= tableStart+8+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart+8:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+4*count {
+				m.Currencies = make([]string, count)
+				for i := 0; i < count; i++ {
+					v, err := serializer.DictString(dict, binary.LittleEndian.Uint32(data[payloadOffset+4+4*i:]))
+					if err != nil {
+						return fmt.Errorf("field Currencies: %w", err)
+					}
+					m.Currencies[i] = v
+				}
+			}
+		}
+	}
+
+	// Field 3 (Count): fixed-length (4 bytes)
+	if len(data) < tableStart+16 {
+		return fmt.Errorf("invalid data: too short for field")
+	}
+	m.Count = int32(binary.LittleEndian.Uint32(data[tableStart+12:]))
+
+	return nil
+}
+
+// UnmarshalSymphonyPrivate unmarshals only the private fields (without header)
+func (m *Catalog) UnmarshalSymphonyPrivate(data []byte) error {
+	payloadOffset := 0
+	_ = payloadOffset
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+	tableStart := 0
+	_ = tableStart
+
+	// String dictionary of the interned fields
+	var dict []string
+	if len(data) >= tableStart+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset {
+			entries, err := serializer.DecodeStringDict(data[payloadOffset:])
+			if err != nil {
+				return err
+			}
+			dict = entries
+		}
+	}
+
+	// Field 4 (Categories): repeated interned string
+	if len(data) >= tableStart+4+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart+4:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+4*count {
+				m.Categories = make([]string, count)
+				for i := 0; i < count; i++ {
+					v, err := serializer.DictString(dict, binary.LittleEndian.Uint32(data[payloadOffset+4+4*i:]))
+					if err != nil {
+						return fmt.Errorf("field Categories: %w", err)
+					}
+					m.Categories[i] = v
+				}
+			}
+		}
+	}
+
+	// Field 5 (Owner): interned string
+	if len(data) >= tableStart+8+4 {
+		v, err := serializer.DictString(dict, binary.LittleEndian.Uint32(data[tableStart+8:]))
+		if err != nil {
+			return fmt.Errorf("field Owner: %w", err)
+		}
+		m.Owner = v
+	}
+
+	// Field 6 (Note): variable-length
+	if len(data) >= tableStart+12+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[tableStart+12:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.Note = serializer.GetString(data[payloadOffset+4 : payloadOffset+4+dataLen])
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *Catalog) MarshalSymphony() ([]byte, error) {
+	size := 0
+	// Public segment:
+	size += 1  // version byte
+	size += 12 // reserved: offset_to_private, service_name, method_name
+	size += 16 // table entries
+	var publicDict serializer.StringDict
+	publicDict.Add(m.Region)
+	publicDict.AddAll(m.Currencies)
+	size += publicDict.EncodedSize() // string dictionary
+	// Field 2 (Currencies): repeated interned string payload
+	size += 4 + 4*len(m.Currencies) // 4 bytes count + references
+	// Private segment:
+	size += 1  // version byte
+	size += 16 // table entries
+	var privateDict serializer.StringDict
+	privateDict.AddAll(m.Categories)
+	privateDict.Add(m.Owner)
+	size += privateDict.EncodedSize() // string dictionary
+	// Field 4 (Categories): repeated interned string payload
+	size += 4 + 4*len(m.Categories) // 4 bytes count + references
+	// Field 6 (Note): variable-length payload
+	size += 4 + len(m.Note) // 4 bytes length prefix + data
+
+	buf := make([]byte, size)
+
+	dataLen := 0 // avoid no new variables warning
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+
+	// === PUBLIC SEGMENT ===
+	buf[0] = 0x01 // version byte
+
+	// Calculate offset to private segment
+	publicSegmentSize := 13
+	publicSegmentSize += 4                        // offset placeholder
+	publicSegmentSize += 4                        // offset placeholder
+	publicSegmentSize += 4                        // field Count
+	publicSegmentSize += 4                        // string dictionary offset
+	publicSegmentSize += publicDict.EncodedSize() // string dictionary
+	publicSegmentSize += 4 + 4*len(m.Currencies)  // field 2 payload
+
+	// Write reserved header
+	binary.LittleEndian.PutUint32(buf[1:5], uint32(publicSegmentSize)) // offset_to_private
+	binary.LittleEndian.PutUint32(buf[5:9], 0)                         // service_id
+	binary.LittleEndian.PutUint32(buf[9:13], 0)                        // method_id
+
+	// Write public fields
+	publicTableStart := 13
+	publicPayloadStart := publicTableStart + 16
+	publicPayloadOffset := 0
+	_ = publicPayloadStart
+	_ = publicPayloadOffset
+
+	// Field 1 (Region): interned string
+	binary.LittleEndian.PutUint32(buf[publicTableStart+4:], publicDict.Ref(m.Region))
+
+	// Field 2 (Currencies): repeated interned string
+	binary.LittleEndian.PutUint32(buf[publicTableStart+8:], uint32(publicPayloadStart+publicPayloadOffset))
+	count = len(m.Currencies)
+	binary.LittleEndian.PutUint32(buf[publicPayloadStart+publicPayloadOffset:], uint32(count))
+	for i, v := range m.Currencies {
+		binary.LittleEndian.PutUint32(buf[publicPayloadStart+publicPayloadOffset+4+4*i:], publicDict.Ref(v))
+	}
+	publicPayloadOffset += 4 + 4*len(m.Currencies)
+
+	// Field 3 (Count): fixed-length (4 bytes)
+	binary.LittleEndian.PutUint32(buf[publicTableStart+12:], uint32(m.Count))
+
+	// String dictionary of the interned fields (offset stays 0 if empty)
+	if publicDict.Len() > 0 {
+		binary.LittleEndian.PutUint32(buf[publicTableStart:], uint32(publicPayloadStart+publicPayloadOffset))
+		publicPayloadOffset += publicDict.Put(buf[publicPayloadStart+publicPayloadOffset:])
+	}
+
+	// === PRIVATE SEGMENT ===
+	privateStart := publicSegmentSize
+	buf[privateStart] = 0x01 // version byte
+
+	// Write private fields
+	privateTableStart := privateStart + 1 // 16 bytes table
+	privatePayloadStart := privateTableStart + 16
+	privatePayloadOffset := 0
+	_ = privatePayloadStart
+	_ = privatePayloadOffset
+
+	// Private segment offsets are stored relative to privateStart
+	// Field 4 (Categories): repeated interned string
+	binary.LittleEndian.PutUint32(buf[privateTableStart+4:], uint32((privatePayloadStart+privatePayloadOffset)-privateStart))
+	count = len(m.Categories)
+	binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset:], uint32(count))
+	for i, v := range m.Categories {
+		binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset+4+4*i:], privateDict.Ref(v))
+	}
+	privatePayloadOffset += 4 + 4*len(m.Categories)
+
+	// Field 5 (Owner): interned string
+	binary.LittleEndian.PutUint32(buf[privateTableStart+8:], privateDict.Ref(m.Owner))
+
+	// Field 6 (Note): variable-length
+	binary.LittleEndian.PutUint32(buf[privateTableStart+12:], uint32((privatePayloadStart+privatePayloadOffset)-privateStart))
+	dataLen = len(m.Note)
+	binary.LittleEndian.PutUint32(buf[privatePayloadStart+privatePayloadOffset:], uint32(dataLen))
+	copy(buf[privatePayloadStart+privatePayloadOffset+4:], m.Note)
+	privatePayloadOffset += 4 + len(m.Note)
+
+	// String dictionary of the interned fields (offset stays 0 if empty)
+	if privateDict.Len() > 0 {
+		binary.LittleEndian.PutUint32(buf[privateTableStart:], uint32((privatePayloadStart+privatePayloadOffset)-privateStart))
+		privatePayloadOffset += privateDict.Put(buf[privatePayloadStart+privatePayloadOffset:])
+	}
+
+	return buf, nil
+}
+
+func (m *Catalog) UnmarshalSymphony(data []byte) error {
+	return m.UnmarshalSymphonyArena(data, nil)
+}
+
+// symphonyArenaCatalog identifies Catalog in a serializer.Arena
+var symphonyArenaCatalog = serializer.NewArenaType()
+
+// UnmarshalSymphonyArena is UnmarshalSymphony allocating the nested messages from arena,
+// which must not be released while they are in use. A nil arena allocates from the heap.
+func (m *Catalog) UnmarshalSymphonyArena(data []byte, arena *serializer.Arena) error {
+	if len(data) < 13 {
+		return fmt.Errorf("invalid data: too short")
+	}
+
+	// Validate public segment version
+	if data[0] != 0x01 {
+		return fmt.Errorf("invalid data: wrong public version")
+	}
+
+	// Read reserved header
+	offsetToPrivate := int(binary.LittleEndian.Uint32(data[1:5]))
+	// service_name := binary.LittleEndian.Uint32(data[5:9])  // not used yet
+	// method_name := binary.LittleEndian.Uint32(data[9:13])  // not used yet
+
+	// Assert private segment exists
+	if offsetToPrivate >= len(data) || data[offsetToPrivate] != 0x01 {
+		return fmt.Errorf("missing private segment")
+	}
+
+	payloadOffset := 0
+	_ = payloadOffset
+	dataLen := 0
+	_ = dataLen
+	count := 0
+	_ = count
+	currentOffset := 0
+	_ = currentOffset
+
+	// === PUBLIC FIELDS ===
+	publicTableStart := 13
+	_ = publicTableStart
+	// String dictionary of the interned fields
+	var publicDict []string
+	if len(data) >= publicTableStart+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[publicTableStart:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset {
+			entries, err := serializer.DecodeStringDict(data[payloadOffset:])
+			if err != nil {
+				return err
+			}
+			publicDict = entries
+		}
+	}
+
+	// Field 1 (Region): interned string
+	if len(data) >= publicTableStart+4+4 {
+		v, err := serializer.DictString(publicDict, binary.LittleEndian.Uint32(data[publicTableStart+4:]))
+		if err != nil {
+			return fmt.Errorf("field Region: %w", err)
+		}
+		m.Region = v
+	}
+
+	// Field 2 (Currencies): repeated interned string
+	if len(data) >= publicTableStart+8+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[publicTableStart+8:]))
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+4*count {
+				m.Currencies = make([]string, count)
+				for i := 0; i < count; i++ {
+					v, err := serializer.DictString(publicDict, binary.LittleEndian.Uint32(data[payloadOffset+4+4*i:]))
+					if err != nil {
+						return fmt.Errorf("field Currencies: %w", err)
+					}
+					m.Currencies[i] = v
+				}
+			}
+		}
+	}
+
+	// Field 3 (Count): fixed-length (4 bytes)
+	if len(data) < publicTableStart+16 {
+		return fmt.Errorf("invalid data: too short for field")
+	}
+	m.Count = int32(binary.LittleEndian.Uint32(data[publicTableStart+12:]))
+
+	// === PRIVATE FIELDS ===
+	privateTableStart := offsetToPrivate + 1
+	_ = privateTableStart
+	// Private segment offsets are relative to offsetToPrivate
+	// String dictionary of the interned fields
+	var privateDict []string
+	if len(data) >= privateTableStart+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[privateTableStart:]))
+		if payloadOffset > 0 {
+			payloadOffset += offsetToPrivate // convert relative offset to absolute
+		}
+		if payloadOffset > 0 && len(data) >= payloadOffset {
+			entries, err := serializer.DecodeStringDict(data[payloadOffset:])
+			if err != nil {
+				return err
+			}
+			privateDict = entries
+		}
+	}
+
+	// Field 4 (Categories): repeated interned string
+	if len(data) >= privateTableStart+4+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[privateTableStart+4:]))
+		if payloadOffset > 0 {
+			payloadOffset += offsetToPrivate // convert relative offset to absolute
+		}
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			count = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+4*count {
+				m.Categories = make([]string, count)
+				for i := 0; i < count; i++ {
+					v, err := serializer.DictString(privateDict, binary.LittleEndian.Uint32(data[payloadOffset+4+4*i:]))
+					if err != nil {
+						return fmt.Errorf("field Categories: %w", err)
+					}
+					m.Categories[i] = v
+				}
+			}
+		}
+	}
+
+	// Field 5 (Owner): interned string
+	if len(data) >= privateTableStart+8+4 {
+		v, err := serializer.DictString(privateDict, binary.LittleEndian.Uint32(data[privateTableStart+8:]))
+		if err != nil {
+			return fmt.Errorf("field Owner: %w", err)
+		}
+		m.Owner = v
+	}
+
+	// Field 6 (Note): variable-length
+	if len(data) >= privateTableStart+12+4 {
+		payloadOffset = int(binary.LittleEndian.Uint32(data[privateTableStart+12:]))
+		if payloadOffset > 0 {
+			payloadOffset += offsetToPrivate // convert relative offset to absolute
+		}
+		if payloadOffset > 0 && len(data) >= payloadOffset+4 {
+			dataLen = int(binary.LittleEndian.Uint32(data[payloadOffset:]))
+			if len(data) >= payloadOffset+4+dataLen {
+				m.Note = serializer.GetString(data[payloadOffset+4 : payloadOffset+4+dataLen])
+			}
+		}
+	}
+
+	return nil
+}
+
+type CatalogRaw []byte
+
+func (m CatalogRaw) MarshalSymphony() ([]byte, error) {
+	return []byte(m), nil
+}
+
+func (m *CatalogRaw) UnmarshalSymphony(data []byte) error {
+	*m = CatalogRaw(data)
+	return nil
+}
+
+func (m CatalogRaw) GetRegion() string {
+	// Field 1 (Region): interned string
+	if len(m) < 17+4 || len(m) < 13+4 {
+		return ""
+	}
+	ref := binary.LittleEndian.Uint32(m[17:])
+	dictOffset := int(binary.LittleEndian.Uint32(m[13:]))
+	if ref == 0 || dictOffset == 0 {
+		return ""
+	}
+	if len(m) < dictOffset {
+		return ""
+	}
+	v, _ := serializer.LookupStringDict(m[dictOffset:], ref)
+	return v
+}
+
+func (m CatalogRaw) GetCurrencies() []string {
+	// Field 2 (Currencies): repeated interned string
+	if len(m) < 21+4 || len(m) < 13+4 {
+		return nil
+	}
+	payloadOffset := int(binary.LittleEndian.Uint32(m[21:]))
+	if payloadOffset == 0 {
+		return nil
+	}
+	if len(m) < payloadOffset+4 {
+		return nil
+	}
+	count := int(binary.LittleEndian.Uint32(m[payloadOffset:]))
+	if len(m) < payloadOffset+4+4*count {
+		return nil
+	}
+	var dict []string
+	if dictOffset := int(binary.LittleEndian.Uint32(m[13:])); dictOffset > 0 {
+		if len(m) >= dictOffset {
+			dict, _ = serializer.DecodeStringDict(m[dictOffset:])
+		}
+	}
+	result := make([]string, count)
+	for i := range result {
+		result[i], _ = serializer.DictString(dict, binary.LittleEndian.Uint32(m[payloadOffset+4+4*i:]))
+	}
+	return result
+}
+
+func (m CatalogRaw) GetCount() int32 {
+	// Field 3 (Count): fixed-length (4 bytes)
+	if len(m) < 25+4 {
+		return 0
+	}
+	return int32(binary.LittleEndian.Uint32(m[25:]))
+}
+
+func (m CatalogRaw) GetCategories() []string {
+	// ASSERT: Private field requires complete buffer
+	if len(m) < 5 {
+		panic(fmt.Sprintf("private getter Categories called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter Categories called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
+	}
+	// Field 4 (Categories): repeated interned string
+	if len(m) < offsetToPrivate+5+4 || len(m) < offsetToPrivate+1+4 {
+		return nil
+	}
+	payloadOffset := int(binary.LittleEndian.Uint32(m[offsetToPrivate+5:]))
+	if payloadOffset == 0 {
+		return nil
+	}
+	payloadOffset += offsetToPrivate // convert relative offset to absolute
+	if len(m) < payloadOffset+4 {
+		return nil
+	}
+	count := int(binary.LittleEndian.Uint32(m[payloadOffset:]))
+	if len(m) < payloadOffset+4+4*count {
+		return nil
+	}
+	var dict []string
+	if dictOffset := int(binary.LittleEndian.Uint32(m[offsetToPrivate+1:])); dictOffset > 0 {
+		dictOffset += offsetToPrivate // convert relative offset to absolute
+		if len(m) >= dictOffset {
+			dict, _ = serializer.DecodeStringDict(m[dictOffset:])
+		}
+	}
+	result := make([]string, count)
+	for i := range result {
+		result[i], _ = serializer.DictString(dict, binary.LittleEndian.Uint32(m[payloadOffset+4+4*i:]))
+	}
+	return result
+}
+
+func (m CatalogRaw) GetOwner() string {
+	// ASSERT: Private field requires complete buffer
+	if len(m) < 5 {
+		panic(fmt.Sprintf("private getter Owner called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter Owner called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
+	}
+	// Field 5 (Owner): interned string
+	if len(m) < offsetToPrivate+9+4 || len(m) < offsetToPrivate+1+4 {
+		return ""
+	}
+	ref := binary.LittleEndian.Uint32(m[offsetToPrivate+9:])
+	dictOffset := int(binary.LittleEndian.Uint32(m[offsetToPrivate+1:]))
+	if ref == 0 || dictOffset == 0 {
+		return ""
+	}
+	dictOffset += offsetToPrivate // convert relative offset to absolute
+	if len(m) < dictOffset {
+		return ""
+	}
+	v, _ := serializer.LookupStringDict(m[dictOffset:], ref)
+	return v
+}
+
+func (m CatalogRaw) GetNote() string {
+	// ASSERT: Private field requires complete buffer
+	if len(m) < 5 {
+		panic(fmt.Sprintf("private getter Note called on invalid buffer: len(m)=%d, need at least 5 bytes", len(m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	if offsetToPrivate >= len(m) || m[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(m) {
+			marker = m[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private getter Note called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(m), marker))
+	}
+	// Field 6 (Note): variable-length
+	if len(m) < offsetToPrivate+13+4 {
+		return ""
+	}
+	payloadOffset := int(binary.LittleEndian.Uint32(m[offsetToPrivate+13:]))
+	if payloadOffset == 0 {
+		return ""
+	}
+	payloadOffset += offsetToPrivate // convert relative offset to absolute
+	if len(m) < payloadOffset+4 {
+		return ""
+	}
+	dataLen := int(binary.LittleEndian.Uint32(m[payloadOffset:]))
+	if len(m) < payloadOffset+4+dataLen {
+		return ""
+	}
+	return serializer.GetString(m[payloadOffset+4 : payloadOffset+4+dataLen])
+}
+
+func (m *CatalogRaw) SetRegion(v string) error {
+	// ASSERT: Public field setter requires public-only buffer
+	if len(*m) >= 5 {
+		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
+			panic(fmt.Sprintf("public setter Region called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
+		}
+	}
+	// Field 1 (Region): interned string
+	if len(*m) < 17+4 || len(*m) < 13+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	var dict []byte
+	if dictOffset := int(binary.LittleEndian.Uint32((*m)[13:])); dictOffset > 0 {
+		if len(*m) >= dictOffset {
+			dict = (*m)[dictOffset:]
+		}
+	}
+	if ref, ok := serializer.FindStringDict(dict, v); ok {
+		binary.LittleEndian.PutUint32((*m)[17:], ref)
+		return nil
+	}
+	// Need to remarshal: unmarshal, update, marshal, truncate to public-only
+	// Preserve reserved bytes (serviceID at bytes 5-9, methodID at bytes 9-13) from original buffer
+	var originalServiceID, originalMethodID uint32
+	if len(*m) >= 13 {
+		originalServiceID = binary.LittleEndian.Uint32((*m)[5:9])
+		originalMethodID = binary.LittleEndian.Uint32((*m)[9:13])
+	}
+	var temp Catalog
+	// Create a fake complete buffer by appending a minimal private segment
+	// Calculate private table size
+	privateTableSize := 16                                   // bytes needed for empty private table
+	fakeComplete := make([]byte, len(*m)+1+privateTableSize) // version byte + private table
+	copy(fakeComplete, *m)
+	// Update offsetToPrivate to point to the appended private segment
+	binary.LittleEndian.PutUint32(fakeComplete[1:5], uint32(len(*m)))
+	fakeComplete[len(*m)] = 0x01 // private segment version
+	if err := temp.UnmarshalSymphony(fakeComplete); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.Region = v
+	fullData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	// Restore reserved bytes (serviceID and methodID) in the marshaled payload
+	if len(fullData) >= 13 {
+		binary.LittleEndian.PutUint32(fullData[5:9], originalServiceID)
+		binary.LittleEndian.PutUint32(fullData[9:13], originalMethodID)
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(fullData[1:5]))
+	*m = CatalogRaw(fullData[:offsetToPrivate])
+	return nil
+}
+
+func (m *CatalogRaw) SetCurrencies(v []string) error {
+	// ASSERT: Public field setter requires public-only buffer
+	if len(*m) >= 5 {
+		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
+			panic(fmt.Sprintf("public setter Currencies called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
+		}
+	}
+	// Field 2 (Currencies): repeated interned string
+	if len(*m) < 21+4 || len(*m) < 13+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	var dict []byte
+	if dictOffset := int(binary.LittleEndian.Uint32((*m)[13:])); dictOffset > 0 {
+		if len(*m) >= dictOffset {
+			dict = (*m)[dictOffset:]
+		}
+	}
+	oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[21:]))
+	var oldCount int
+	if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+4 {
+		oldCount = int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset:]))
+	}
+	if oldPayloadOffset > 0 && len(v) <= oldCount && len(*m) >= oldPayloadOffset+4+4*oldCount {
+		refs := make([]uint32, len(v))
+		inPlace := true
+		for i, s := range v {
+			ref, ok := serializer.FindStringDict(dict, s)
+			if !ok {
+				inPlace = false
+				break
+			}
+			refs[i] = ref
+		}
+		if inPlace {
+			// Update in-place (waste space)
+			binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(len(v)))
+			for i, ref := range refs {
+				binary.LittleEndian.PutUint32((*m)[oldPayloadOffset+4+4*i:], ref)
+			}
+			return nil
+		}
+	}
+	// Need to remarshal: unmarshal, update, marshal, truncate to public-only
+	// Preserve reserved bytes (serviceID at bytes 5-9, methodID at bytes 9-13) from original buffer
+	var originalServiceID, originalMethodID uint32
+	if len(*m) >= 13 {
+		originalServiceID = binary.LittleEndian.Uint32((*m)[5:9])
+		originalMethodID = binary.LittleEndian.Uint32((*m)[9:13])
+	}
+	var temp Catalog
+	// Create a fake complete buffer by appending a minimal private segment
+	// Calculate private table size
+	privateTableSize := 16                                   // bytes needed for empty private table
+	fakeComplete := make([]byte, len(*m)+1+privateTableSize) // version byte + private table
+	copy(fakeComplete, *m)
+	// Update offsetToPrivate to point to the appended private segment
+	binary.LittleEndian.PutUint32(fakeComplete[1:5], uint32(len(*m)))
+	fakeComplete[len(*m)] = 0x01 // private segment version
+	if err := temp.UnmarshalSymphony(fakeComplete); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.Currencies = v
+	fullData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	// Restore reserved bytes (serviceID and methodID) in the marshaled payload
+	if len(fullData) >= 13 {
+		binary.LittleEndian.PutUint32(fullData[5:9], originalServiceID)
+		binary.LittleEndian.PutUint32(fullData[9:13], originalMethodID)
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(fullData[1:5]))
+	*m = CatalogRaw(fullData[:offsetToPrivate])
+	return nil
+}
+
+func (m *CatalogRaw) SetCount(v int32) error {
+	// ASSERT: Public field setter requires public-only buffer
+	if len(*m) >= 5 {
+		offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+		if offsetToPrivate < len(*m) && (*m)[offsetToPrivate] == 0x01 {
+			panic(fmt.Sprintf("public setter Count called on complete buffer: offsetToPrivate=%d, len(m)=%d, marker=0x01 (should not modify complete buffer)", offsetToPrivate, len(*m)))
+		}
+	}
+	// Field 3 (Count): fixed-length (4 bytes)
+	if len(*m) < 25+4 {
+		return fmt.Errorf("buffer too short")
+	}
+	binary.LittleEndian.PutUint32((*m)[25:], uint32(v))
+	return nil
+}
+
+func (m *CatalogRaw) SetCategories(v []string) error {
+	// ASSERT: Private field setter requires complete buffer
+	if len(*m) < 5 {
+		panic(fmt.Sprintf("private setter Categories called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter Categories called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
+	}
+	// Field 4 (Categories): repeated interned string
+	if len(*m) < offsetToPrivate+5+4 || len(*m) < offsetToPrivate+1+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	var dict []byte
+	if dictOffset := int(binary.LittleEndian.Uint32((*m)[offsetToPrivate+1:])); dictOffset > 0 {
+		dictOffset += offsetToPrivate // convert relative offset to absolute
+		if len(*m) >= dictOffset {
+			dict = (*m)[dictOffset:]
+		}
+	}
+	oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[offsetToPrivate+5:]))
+	if oldPayloadOffset > 0 {
+		oldPayloadOffset += offsetToPrivate // convert relative offset to absolute
+	}
+	var oldCount int
+	if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+4 {
+		oldCount = int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset:]))
+	}
+	if oldPayloadOffset > 0 && len(v) <= oldCount && len(*m) >= oldPayloadOffset+4+4*oldCount {
+		refs := make([]uint32, len(v))
+		inPlace := true
+		for i, s := range v {
+			ref, ok := serializer.FindStringDict(dict, s)
+			if !ok {
+				inPlace = false
+				break
+			}
+			refs[i] = ref
+		}
+		if inPlace {
+			// Update in-place (waste space)
+			binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(len(v)))
+			for i, ref := range refs {
+				binary.LittleEndian.PutUint32((*m)[oldPayloadOffset+4+4*i:], ref)
+			}
+			return nil
+		}
+	}
+	// Need to remarshal: unmarshal, update, marshal
+	var temp Catalog
+	if err := temp.UnmarshalSymphony([]byte(*m)); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.Categories = v
+	newData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	*m = CatalogRaw(newData)
+	return nil
+}
+
+func (m *CatalogRaw) SetOwner(v string) error {
+	// ASSERT: Private field setter requires complete buffer
+	if len(*m) < 5 {
+		panic(fmt.Sprintf("private setter Owner called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter Owner called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
+	}
+	// Field 5 (Owner): interned string
+	if len(*m) < offsetToPrivate+9+4 || len(*m) < offsetToPrivate+1+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	var dict []byte
+	if dictOffset := int(binary.LittleEndian.Uint32((*m)[offsetToPrivate+1:])); dictOffset > 0 {
+		dictOffset += offsetToPrivate // convert relative offset to absolute
+		if len(*m) >= dictOffset {
+			dict = (*m)[dictOffset:]
+		}
+	}
+	if ref, ok := serializer.FindStringDict(dict, v); ok {
+		binary.LittleEndian.PutUint32((*m)[offsetToPrivate+9:], ref)
+		return nil
+	}
+	// Need to remarshal: unmarshal, update, marshal
+	var temp Catalog
+	if err := temp.UnmarshalSymphony([]byte(*m)); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.Owner = v
+	newData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	*m = CatalogRaw(newData)
+	return nil
+}
+
+func (m *CatalogRaw) SetNote(v string) error {
+	// ASSERT: Private field setter requires complete buffer
+	if len(*m) < 5 {
+		panic(fmt.Sprintf("private setter Note called on invalid buffer: len(m)=%d, need at least 5 bytes", len(*m)))
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32((*m)[1:5]))
+	if offsetToPrivate >= len(*m) || (*m)[offsetToPrivate] != 0x01 {
+		marker := byte(0)
+		if offsetToPrivate < len(*m) {
+			marker = (*m)[offsetToPrivate]
+		}
+		panic(fmt.Sprintf("private setter Note called on public-only buffer: offsetToPrivate=%d, len(m)=%d, marker=0x%02x (expected 0x01)", offsetToPrivate, len(*m), marker))
+	}
+	// Field 6 (Note): variable-length
+	if len(*m) < offsetToPrivate+13+4 {
+		return fmt.Errorf("buffer too short for table entry")
+	}
+	oldPayloadOffset := int(binary.LittleEndian.Uint32((*m)[offsetToPrivate+13:]))
+	if oldPayloadOffset > 0 {
+		oldPayloadOffset += offsetToPrivate // convert relative offset to absolute
+	}
+	var oldDataLen int
+	if oldPayloadOffset > 0 && len(*m) >= oldPayloadOffset+4 {
+		oldDataLen = int(binary.LittleEndian.Uint32((*m)[oldPayloadOffset:]))
+	}
+	newDataLen := len(v)
+	if oldPayloadOffset > 0 && newDataLen <= oldDataLen {
+		// Update in-place (waste space)
+		binary.LittleEndian.PutUint32((*m)[oldPayloadOffset:], uint32(newDataLen))
+		copy((*m)[oldPayloadOffset+4:], v)
+		return nil
+	}
+	// Need to remarshal: unmarshal, update, marshal
+	var temp Catalog
+	if err := temp.UnmarshalSymphony([]byte(*m)); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	temp.Note = v
+	newData, err := temp.MarshalSymphony()
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	*m = CatalogRaw(newData)
+	return nil
+}
+
+// String renders the message in a protobuf-text-like format for debugging.
+// Private fields are omitted when the buffer only holds the public segment.
+func (m CatalogRaw) String() string {
+	text, err := m.MarshalText()
+	if err != nil {
+		return fmt.Sprintf("<invalid Catalog: %v>", err)
+	}
+	return string(text)
+}
+
+// MarshalText implements encoding.TextMarshaler using the format of String
+func (m CatalogRaw) MarshalText() (text []byte, err error) {
+	if len(m) < 13 || m[0] != 0x01 {
+		return nil, fmt.Errorf("invalid data: too short or wrong public version")
+	}
+	// Getters do not validate offsets against each other, so recover from malformed buffers
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = nil, fmt.Errorf("invalid data: %v", r)
+		}
+	}()
+	offsetToPrivate := int(binary.LittleEndian.Uint32(m[1:5]))
+	hasPrivate := offsetToPrivate < len(m) && m[offsetToPrivate] == 0x01
+	_ = hasPrivate
+	var b strings.Builder
+	if v := m.GetRegion(); len(v) > 0 {
+		fmt.Fprintf(&b, "region: %q ", v)
+	}
+	for _, v := range m.GetCurrencies() {
+		fmt.Fprintf(&b, "currencies: %q ", v)
+	}
+	if v := m.GetCount(); v != 0 {
+		fmt.Fprintf(&b, "count: %v ", v)
+	}
+	if hasPrivate {
+		for _, v := range m.GetCategories() {
+			fmt.Fprintf(&b, "categories: %q ", v)
+		}
+	}
+	if hasPrivate {
+		if v := m.GetOwner(); len(v) > 0 {
+			fmt.Fprintf(&b, "owner: %q ", v)
+		}
+	}
+	if hasPrivate {
+		if v := m.GetNote(); len(v) > 0 {
+			fmt.Fprintf(&b, "note: %q ", v)
+		}
+	}
+	return []byte(strings.TrimSpace(b.String())), nil
+}
+
+// file_test_proto_symphonySchema is the compact schema of the Symphony messages in this file (see pkg/schema)
+var file_test_proto_symphonySchema = []byte{
+	0x01, 0x0e, 0x0a, 0x54, 0x65, 0x73, 0x74, 0x2e, 0x46, 0x69, 0x78, 0x65, 0x64, 0x07, 0x01, 0x07,
+	0x66, 0x5f, 0x69, 0x6e, 0x74, 0x33, 0x32, 0x02, 0x02, 0x02, 0x07, 0x66, 0x5f, 0x69, 0x6e, 0x74,
+	0x36, 0x34, 0x03, 0x00, 0x03, 0x08, 0x66, 0x5f, 0x75, 0x69, 0x6e, 0x74, 0x33, 0x32, 0x04, 0x02,
+	0x04, 0x08, 0x66, 0x5f, 0x75, 0x69, 0x6e, 0x74, 0x36, 0x34, 0x05, 0x00, 0x05, 0x06, 0x66, 0x5f,
+	0x62, 0x6f, 0x6f, 0x6c, 0x01, 0x02, 0x06, 0x07, 0x66, 0x5f, 0x66, 0x6c, 0x6f, 0x61, 0x74, 0x06,
+	0x00, 0x07, 0x08, 0x66, 0x5f, 0x64, 0x6f, 0x75, 0x62, 0x6c, 0x65, 0x07, 0x02, 0x08, 0x54, 0x65,
+	0x73, 0x74, 0x2e, 0x56, 0x61, 0x72, 0x02, 0x01, 0x08, 0x76, 0x5f, 0x73, 0x74, 0x72, 0x69, 0x6e,
+	0x67, 0x09, 0x02, 0x02, 0x07, 0x76, 0x5f, 0x62, 0x79, 0x74, 0x65, 0x73, 0x0a, 0x00, 0x12, 0x54,
+	0x65, 0x73, 0x74, 0x2e, 0x52, 0x65, 0x70, 0x65, 0x61, 0x74, 0x65, 0x64, 0x46, 0x69, 0x78, 0x65,
+	0x64, 0x07, 0x01, 0x07, 0x72, 0x5f, 0x69, 0x6e, 0x74, 0x33, 0x32, 0x02, 0x01, 0x02, 0x07, 0x72,
+	0x5f, 0x69, 0x6e, 0x74, 0x36, 0x34, 0x03, 0x03, 0x03, 0x08, 0x72, 0x5f, 0x75, 0x69, 0x6e, 0x74,
+	0x33, 0x32, 0x04, 0x01, 0x04, 0x08, 0x72, 0x5f, 0x75, 0x69, 0x6e, 0x74, 0x36, 0x34, 0x05, 0x03,
+	0x05, 0x07, 0x72, 0x5f, 0x66, 0x6c, 0x6f, 0x61, 0x74, 0x06, 0x01, 0x06, 0x08, 0x72, 0x5f, 0x64,
+	0x6f, 0x75, 0x62, 0x6c, 0x65, 0x07, 0x03, 0x07, 0x06, 0x72, 0x5f, 0x62, 0x6f, 0x6f, 0x6c, 0x01,
+	0x01, 0x10, 0x54, 0x65, 0x73, 0x74, 0x2e, 0x52, 0x65, 0x70, 0x65, 0x61, 0x74, 0x65, 0x64, 0x56,
+	0x61, 0x72, 0x02, 0x01, 0x08, 0x72, 0x5f, 0x73, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x09, 0x03, 0x02,
+	0x07, 0x72, 0x5f, 0x62, 0x79, 0x74, 0x65, 0x73, 0x0a, 0x01, 0x09, 0x54, 0x65, 0x73, 0x74, 0x2e,
+	0x4c, 0x65, 0x61, 0x66, 0x02, 0x01, 0x07, 0x6c, 0x65, 0x61, 0x66, 0x5f, 0x69, 0x64, 0x02, 0x02,
+	0x02, 0x08, 0x6c, 0x65, 0x61, 0x66, 0x5f, 0x76, 0x61, 0x6c, 0x09, 0x00, 0x0b, 0x54, 0x65, 0x73,
+	0x74, 0x2e, 0x4c, 0x65, 0x76, 0x65, 0x6c, 0x32, 0x01, 0x01, 0x04, 0x6c, 0x65, 0x61, 0x66, 0x0b,
+	0x02, 0x09, 0x54, 0x65, 0x73, 0x74, 0x2e, 0x4c, 0x65, 0x61, 0x66, 0x0b, 0x54, 0x65, 0x73, 0x74,
+	0x2e, 0x4c, 0x65, 0x76, 0x65, 0x6c, 0x31, 0x02, 0x01, 0x02, 0x6c, 0x32, 0x0b, 0x00, 0x0b, 0x54,
+	0x65, 0x73, 0x74, 0x2e, 0x4c, 0x65, 0x76, 0x65, 0x6c, 0x32, 0x02, 0x07, 0x6c, 0x31, 0x5f, 0x64,
+	0x61, 0x74, 0x61, 0x09, 0x02, 0x09, 0x54, 0x65, 0x73, 0x74, 0x2e, 0x52, 0x6f, 0x6f, 0x74, 0x02,
+	0x01, 0x02, 0x6c, 0x31, 0x0b, 0x02, 0x0b, 0x54, 0x65, 0x73, 0x74, 0x2e, 0x4c, 0x65, 0x76, 0x65,
+	0x6c, 0x31, 0x02, 0x07, 0x72, 0x6f, 0x6f, 0x74, 0x5f, 0x69, 0x64, 0x02, 0x00, 0x11, 0x54, 0x65,
+	0x73, 0x74, 0x2e, 0x43, 0x6f, 0x6d, 0x70, 0x6c, 0x65, 0x78, 0x4d, 0x69, 0x78, 0x65, 0x64, 0x08,
+	0x01, 0x07, 0x66, 0x5f, 0x69, 0x6e, 0x74, 0x33, 0x32, 0x02, 0x00, 0x02, 0x08, 0x76, 0x5f, 0x73,
+	0x74, 0x72, 0x69, 0x6e, 0x67, 0x09, 0x02, 0x03, 0x07, 0x72, 0x5f, 0x69, 0x6e, 0x74, 0x36, 0x34,
+	0x03, 0x01, 0x04, 0x0b, 0x6e, 0x65, 0x73, 0x74, 0x65, 0x64, 0x5f, 0x6c, 0x65, 0x61, 0x66, 0x0b,
+	0x02, 0x09, 0x54, 0x65, 0x73, 0x74, 0x2e, 0x4c, 0x65, 0x61, 0x66, 0x05, 0x08, 0x72, 0x5f, 0x73,
+	0x74, 0x72, 0x69, 0x6e, 0x67, 0x09, 0x01, 0x06, 0x06, 0x66, 0x5f, 0x62, 0x6f, 0x6f, 0x6c, 0x01,
+	0x02, 0x07, 0x0f, 0x72, 0x65, 0x70, 0x65, 0x61, 0x74, 0x65, 0x64, 0x5f, 0x6e, 0x65, 0x73, 0x74,
+	0x65, 0x64, 0x0b, 0x01, 0x09, 0x54, 0x65, 0x73, 0x74, 0x2e, 0x52, 0x6f, 0x6f, 0x74, 0x08, 0x07,
+	0x76, 0x5f, 0x62, 0x79, 0x74, 0x65, 0x73, 0x0a, 0x02, 0x0a, 0x54, 0x65, 0x73, 0x74, 0x2e, 0x45,
+	0x6d, 0x70, 0x74, 0x79, 0x00, 0x10, 0x54, 0x65, 0x73, 0x74, 0x2e, 0x43, 0x72, 0x65, 0x64, 0x65,
+	0x6e, 0x74, 0x69, 0x61, 0x6c, 0x73, 0x03, 0x01, 0x04, 0x75, 0x73, 0x65, 0x72, 0x09, 0x02, 0x02,
+	0x0b, 0x63, 0x61, 0x72, 0x64, 0x5f, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x09, 0x06, 0x03, 0x06,
+	0x73, 0x65, 0x63, 0x72, 0x65, 0x74, 0x0a, 0x04, 0x0e, 0x54, 0x65, 0x73, 0x74, 0x2e, 0x57, 0x65,
+	0x6c, 0x6c, 0x4b, 0x6e, 0x6f, 0x77, 0x6e, 0x07, 0x01, 0x07, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65,
+	0x64, 0x0b, 0x02, 0x19, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x02, 0x03, 0x74,
+	0x74, 0x6c, 0x0b, 0x00, 0x18, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x62, 0x75, 0x66, 0x2e, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x03, 0x06, 0x64,
+	0x65, 0x74, 0x61, 0x69, 0x6c, 0x0b, 0x00, 0x13, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x41, 0x6e, 0x79, 0x04, 0x05, 0x61, 0x74, 0x74,
+	0x72, 0x73, 0x0b, 0x00, 0x16, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x62, 0x75, 0x66, 0x2e, 0x53, 0x74, 0x72, 0x75, 0x63, 0x74, 0x05, 0x08, 0x6e, 0x69, 0x63,
+	0x6b, 0x6e, 0x61, 0x6d, 0x65, 0x0b, 0x02, 0x1b, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x56, 0x61,
+	0x6c, 0x75, 0x65, 0x06, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x0b, 0x00, 0x1a, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x49,
+	0x6e, 0x74, 0x36, 0x34, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x07, 0x07, 0x68, 0x69, 0x73, 0x74, 0x6f,
+	0x72, 0x79, 0x0b, 0x03, 0x19, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x0b, 0x54,
+	0x65, 0x73, 0x74, 0x2e, 0x44, 0x65, 0x6c, 0x74, 0x61, 0x73, 0x04, 0x01, 0x0a, 0x74, 0x69, 0x6d,
+	0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x73, 0x03, 0x0b, 0x02, 0x0b, 0x70, 0x72, 0x6f, 0x64, 0x75,
+	0x63, 0x74, 0x5f, 0x69, 0x64, 0x73, 0x02, 0x09, 0x03, 0x07, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74,
+	0x73, 0x05, 0x09, 0x04, 0x06, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x73, 0x04, 0x03, 0x0c, 0x54, 0x65,
+	0x73, 0x74, 0x2e, 0x43, 0x61, 0x74, 0x61, 0x6c, 0x6f, 0x67, 0x06, 0x01, 0x06, 0x72, 0x65, 0x67,
+	0x69, 0x6f, 0x6e, 0x09, 0x12, 0x02, 0x0a, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x69, 0x65,
+	0x73, 0x09, 0x13, 0x03, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x02, 0x02, 0x04, 0x0a, 0x63, 0x61,
+	0x74, 0x65, 0x67, 0x6f, 0x72, 0x69, 0x65, 0x73, 0x09, 0x11, 0x05, 0x05, 0x6f, 0x77, 0x6e, 0x65,
+	0x72, 0x09, 0x10, 0x06, 0x04, 0x6e, 0x6f, 0x74, 0x65, 0x09, 0x00,
+}
+
+func init() {
+	if err := schema.Global.RegisterEncoded(file_test_proto_symphonySchema); err != nil {
+		panic(err)
+	}
+}
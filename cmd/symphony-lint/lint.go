@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/appnet-org/arpc/pkg/schema"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Severity tells whether a change breaks existing peers
+type Severity int
+
+const (
+	// SeverityWarning changes are safe only if peers are upgraded in a given order
+	SeverityWarning Severity = iota
+	// SeverityBreaking changes make old and new peers misread each other's payloads
+	SeverityBreaking
+)
+
+func (s Severity) String() string {
+	if s == SeverityBreaking {
+		return "BREAKING"
+	}
+	return "WARNING"
+}
+
+// Finding is one problematic change between two schema versions
+type Finding struct {
+	Severity Severity
+	Message  string // full name of the message
+	Field    string // field name, empty for message-level findings
+	Reason   string
+}
+
+func (f Finding) String() string {
+	if f.Field == "" {
+		return fmt.Sprintf("%s %s: %s", f.Severity, f.Message, f.Reason)
+	}
+	return fmt.Sprintf("%s %s.%s: %s", f.Severity, f.Message, f.Field, f.Reason)
+}
+
+// lintFiles compares all top-level messages with a Symphony encoding in oldFiles with
+// their counterparts in newFiles. Findings are sorted by message name.
+func lintFiles(oldFiles, newFiles *protoregistry.Files) []Finding {
+	var findings []Finding
+	oldFiles.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		msgs := fd.Messages()
+		for i := 0; i < msgs.Len(); i++ {
+			oldMd := msgs.Get(i)
+			oldMsg, err := schema.FromDescriptor(oldMd)
+			if err != nil {
+				continue // encoded with protobuf, whose tags keep it compatible
+			}
+
+			desc, err := newFiles.FindDescriptorByName(oldMd.FullName())
+			newMd, ok := desc.(protoreflect.MessageDescriptor)
+			if err != nil || !ok {
+				findings = append(findings, Finding{SeverityBreaking, oldMsg.FullName, "", "message was removed"})
+				continue
+			}
+			newMsg, err := schema.FromDescriptor(newMd)
+			if err != nil {
+				findings = append(findings, Finding{SeverityBreaking, oldMsg.FullName, "", fmt.Sprintf("message lost its Symphony encoding (%v) and falls back to protobuf", err)})
+				continue
+			}
+			findings = append(findings, lintMessage(oldMsg, newMsg, newMd)...)
+		}
+		return true
+	})
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Message < findings[j].Message })
+	return findings
+}
+
+// lintMessage compares two versions of a message. Symphony locates fields by their position
+// in the public or private table rather than by tag, so besides type changes, everything
+// that moves an existing field to another table slot breaks the wire format.
+func lintMessage(oldMsg, newMsg *schema.Message, newMd protoreflect.MessageDescriptor) []Finding {
+	var findings []Finding
+	add := func(severity Severity, field, format string, args ...any) {
+		findings = append(findings, Finding{severity, oldMsg.FullName, field, fmt.Sprintf(format, args...)})
+	}
+
+	renumbered := make(map[int32]int32) // new number -> old number
+	for _, f := range oldMsg.Fields {
+		nf := newMsg.Field(f.Number)
+		if nf == nil {
+			if renamed := newMsg.FieldByName(f.Name); renamed != nil {
+				// Symphony tables do not store numbers, but the protobuf fallback and
+				// dynamic decoding rely on them
+				add(SeverityBreaking, f.Name, "renumbered from %d to %d", f.Number, renamed.Number)
+				renumbered[renamed.Number] = f.Number
+			} else if !newMd.ReservedRanges().Has(protoreflect.FieldNumber(f.Number)) || !newMd.ReservedNames().Has(protoreflect.Name(f.Name)) {
+				add(SeverityBreaking, f.Name, "removed without reserving its number and name")
+			}
+			continue
+		}
+		if nf.Public != f.Public {
+			add(SeverityBreaking, f.Name, "moved from the %s to the %s segment", segmentName(f.Public), segmentName(nf.Public))
+			continue
+		}
+		if typeName(nf) != typeName(&f) {
+			add(SeverityBreaking, f.Name, "type changed from %s to %s", typeName(&f), typeName(nf))
+		}
+	}
+
+	for _, public := range []bool{true, false} {
+		oldSeg, newSeg := segment(oldMsg, public), segment(newMsg, public)
+		oldPos := make(map[int32]int, len(oldSeg))
+		for i, f := range oldSeg {
+			oldPos[f.Number] = i
+		}
+
+		if oldDict, newDict := hasInterned(oldSeg), hasInterned(newSeg); oldDict != newDict && len(oldSeg) > 0 {
+			// The string dictionary offset is the first slot of the table
+			verb := "adds"
+			if oldDict {
+				verb = "removes"
+			}
+			add(SeverityBreaking, "", "%s the string dictionary of the %s table, which shifts all its fields", verb, segmentName(public))
+		}
+		for i, f := range oldSeg {
+			removed := newMsg.Field(f.Number) == nil && newMsg.FieldByName(f.Name) == nil
+			if removed && i < len(oldSeg)-1 {
+				add(SeverityBreaking, f.Name, "removal shifts the following fields of the %s table; keep the field and stop using it instead", segmentName(public))
+			}
+		}
+		for j, nf := range newSeg {
+			number := nf.Number
+			if old, ok := renumbered[number]; ok {
+				number = old
+			}
+			if of := oldMsg.Field(number); of != nil && of.Public != public {
+				continue // moved between segments, reported above
+			}
+			i, existed := oldPos[number]
+			switch {
+			case existed && i != j:
+				add(SeverityBreaking, nf.Name, "moved from slot %d to slot %d of the %s table", i, j, segmentName(public))
+			case !existed && j < len(oldSeg):
+				add(SeverityBreaking, nf.Name, "added in the middle of the %s table; declare new fields after the existing ones", segmentName(public))
+			case !existed:
+				add(SeverityWarning, nf.Name, "added to the %s table; payloads of older writers lack its slot, so upgrade writers before readers", segmentName(public))
+			}
+		}
+	}
+	return findings
+}
+
+// segment returns the fields of one segment in table order
+func segment(m *schema.Message, public bool) []*schema.Field {
+	var fields []*schema.Field
+	for i := range m.Fields {
+		if m.Fields[i].Public == public {
+			fields = append(fields, &m.Fields[i])
+		}
+	}
+	return fields
+}
+
+// hasInterned returns true if a segment has interned fields and therefore a string dictionary
+func hasInterned(fields []*schema.Field) bool {
+	for _, f := range fields {
+		if f.Interned {
+			return true
+		}
+	}
+	return false
+}
+
+func segmentName(public bool) string {
+	if public {
+		return "public"
+	}
+	return "private"
+}
+
+func typeName(f *schema.Field) string {
+	name := f.Kind.String()
+	if f.Kind == schema.KindMessage {
+		name = f.Message
+	}
+	if f.Repeated {
+		name = "repeated " + name
+	}
+	if f.Delta {
+		name += " delta"
+	}
+	if f.Interned {
+		name += " interned"
+	}
+	return name
+}
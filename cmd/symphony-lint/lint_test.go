@@ -0,0 +1,161 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+type testField struct {
+	name   string
+	number int32
+	typ    descriptorpb.FieldDescriptorProto_Type
+	public bool
+}
+
+// files builds a registry with one message "lint.Msg" made of the given fields
+func files(t *testing.T, fields []testField, reserved ...string) *protoregistry.Files {
+	t.Helper()
+	msg := &descriptorpb.DescriptorProto{Name: proto.String("Msg")}
+	for _, f := range fields {
+		fd := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(f.name),
+			Number: proto.Int32(f.number),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:   f.typ.Enum(),
+		}
+		if f.public {
+			opts := &descriptorpb.FieldOptions{}
+			raw := protowire.AppendTag(nil, 50001, protowire.VarintType)
+			opts.ProtoReflect().SetUnknown(protowire.AppendVarint(raw, 1))
+			fd.Options = opts
+		}
+		msg.Field = append(msg.Field, fd)
+	}
+	for _, name := range reserved {
+		msg.ReservedName = append(msg.ReservedName, name)
+	}
+	file := &descriptorpb.FileDescriptorProto{
+		Name:        proto.String("lint.proto"),
+		Package:     proto.String("lint"),
+		Syntax:      proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{msg},
+	}
+	reg, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	if err != nil {
+		t.Fatalf("NewFiles failed: %v", err)
+	}
+	return reg
+}
+
+const (
+	i32 = descriptorpb.FieldDescriptorProto_TYPE_INT32
+	i64 = descriptorpb.FieldDescriptorProto_TYPE_INT64
+	str = descriptorpb.FieldDescriptorProto_TYPE_STRING
+)
+
+func TestLint(t *testing.T) {
+	base := []testField{{"id", 1, i32, true}, {"name", 2, str, true}, {"secret", 3, str, false}}
+
+	tests := []struct {
+		name     string
+		fields   []testField
+		reserved []string
+		want     []string // substrings of the findings, in order
+	}{
+		{"Unchanged", base, nil, nil},
+		{
+			"AppendedPublicField",
+			[]testField{base[0], base[1], {"zone", 4, str, true}, base[2]},
+			nil,
+			[]string{"WARNING lint.Msg.zone: added to the public table"},
+		},
+		{
+			"InsertedPublicField",
+			[]testField{{"zone", 4, str, true}, base[0], base[1], base[2]},
+			nil,
+			[]string{
+				"BREAKING lint.Msg.zone: added in the middle of the public table",
+				"BREAKING lint.Msg.id: moved from slot 0 to slot 1",
+				"BREAKING lint.Msg.name: moved from slot 1 to slot 2",
+			},
+		},
+		{
+			"ReorderedPublicFields",
+			[]testField{base[1], base[0], base[2]},
+			nil,
+			[]string{"BREAKING lint.Msg.name: moved from slot 1 to slot 0", "BREAKING lint.Msg.id: moved from slot 0 to slot 1"},
+		},
+		{
+			"TypeChange",
+			[]testField{{"id", 1, i64, true}, base[1], base[2]},
+			nil,
+			[]string{"BREAKING lint.Msg.id: type changed from int32 to int64"},
+		},
+		{
+			"MovedToPrivate",
+			[]testField{base[0], {"name", 2, str, false}, base[2]},
+			nil,
+			[]string{
+				"BREAKING lint.Msg.name: moved from the public to the private segment",
+				"BREAKING lint.Msg.secret: moved from slot 0 to slot 1 of the private table",
+			},
+		},
+		{
+			"RemovedWithoutReservation",
+			[]testField{base[0], base[1]},
+			nil,
+			[]string{"BREAKING lint.Msg.secret: removed without reserving its number and name"},
+		},
+		{
+			"RemovedFromMiddle",
+			[]testField{base[1], base[2]},
+			[]string{"id"},
+			[]string{
+				"BREAKING lint.Msg.id: removed without reserving",
+				"BREAKING lint.Msg.id: removal shifts the following fields",
+				"BREAKING lint.Msg.name: moved from slot 1 to slot 0",
+			},
+		},
+		{
+			"Renumbered",
+			[]testField{base[0], {"name", 5, str, true}, base[2]},
+			nil,
+			[]string{"BREAKING lint.Msg.name: renumbered from 2 to 5"},
+		},
+	}
+
+	oldFiles := files(t, base)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := lintFiles(oldFiles, files(t, tt.fields, tt.reserved...))
+			if len(findings) != len(tt.want) {
+				t.Fatalf("Expected %d findings, got %d: %v", len(tt.want), len(findings), findings)
+			}
+			for i, want := range tt.want {
+				if got := findings[i].String(); !strings.Contains(got, want) {
+					t.Errorf("Finding %d: expected %q, got %q", i, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestLintRemovedMessage(t *testing.T) {
+	oldFiles := files(t, []testField{{"id", 1, i32, true}})
+	newFiles, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name: proto.String("lint.proto"), Package: proto.String("lint"), Syntax: proto.String("proto3"),
+	}}})
+	if err != nil {
+		t.Fatalf("NewFiles failed: %v", err)
+	}
+	findings := lintFiles(oldFiles, newFiles)
+	if len(findings) != 1 || findings[0].String() != "BREAKING lint.Msg: message was removed" {
+		t.Errorf("Unexpected findings: %v", findings)
+	}
+}
@@ -0,0 +1,74 @@
+// symphony-lint compares two versions of a schema and reports changes that break the
+// Symphony wire format. Schemas are read from FileDescriptorSets, as produced by
+//
+//	protoc --include_imports --descriptor_set_out=kv.binpb kv.proto
+//
+// Usage:
+//
+//	symphony-lint [-strict] old.binpb new.binpb
+//
+// The exit status is 1 if a breaking change is found (or a warning, with -strict).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func main() {
+	strict := flag.Bool("strict", false, "fail on warnings as well as breaking changes")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-strict] old.binpb new.binpb\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	oldFiles, err := loadDescriptorSet(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	newFiles, err := loadDescriptorSet(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, f := range lintFiles(oldFiles, newFiles) {
+		fmt.Println(f)
+		if f.Severity == SeverityBreaking || *strict {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// loadDescriptorSet reads a binary FileDescriptorSet
+func loadDescriptorSet(path string) (*protoregistry.Files, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("%s: not a FileDescriptorSet: %w", path, err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return files, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/schema"
+	"github.com/appnet-org/arpc/pkg/transport"
+)
+
+// dissectorRuntime is the part of the generated dissectors that does not depend on the
+// schemas: the protocol, its header fields and the walk of the public segment, driven by the
+// tables generated before it
+//
+//go:embed dissector.lua
+var dissectorRuntime string
+
+// portRange matches the port ranges of Wireshark preferences
+var portRange = regexp.MustCompile(`^[0-9]+(-[0-9]+)?(,[0-9]+(-[0-9]+)?)*$`)
+
+// extensionNames are the names the dissector gives to the types of header extensions
+var extensionNames = []struct {
+	Type packet.ExtensionType
+	Name string
+}{
+	{packet.ExtensionTraceContext, "Trace context"},
+	{packet.ExtensionPriority, "Priority"},
+	{packet.ExtensionDeadline, "Deadline"},
+	{packet.ExtensionKeyID, "Key ID"},
+	{packet.ExtensionAuthTag, "Auth tag"},
+	{packet.ExtensionRecvLimit, "Receive limit"},
+	{packet.ExtensionUserAgent, "User agent"},
+	{packet.ExtensionRelay, "Relay"},
+	{packet.ExtensionOrigin, "Origin"},
+}
+
+// generateDissector returns the Lua dissector of the messages and methods of reg, registered
+// on the UDP ports of ports by default (a preference of the dissector changes them)
+func generateDissector(reg *schema.Registry, ports string) ([]byte, error) {
+	if !portRange.MatchString(ports) {
+		return nil, fmt.Errorf("invalid port range %q", ports)
+	}
+	msgs, methods, err := schema.DecodeWithMethods(reg.Export())
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.WriteString("-- Code generated by symphony-wireshark. DO NOT EDIT.\n")
+	b.WriteString("--\n")
+	b.WriteString("-- Wireshark dissector of aRPC. Copy it to the Lua plugins folder of Wireshark\n")
+	b.WriteString("-- (Help > About Wireshark > Folders), or load it with tshark -X lua_script:arpc.lua.\n")
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "local default_ports = %s\n", luaString(ports))
+	fmt.Fprintf(&b, "local nat_packet_type = %d\n\n", transport.NATPacketTypeID)
+
+	b.WriteString("local packet_types = {\n")
+	for _, t := range []packet.PacketType{packet.PacketTypeUnknown, packet.PacketTypeRequest, packet.PacketTypeResponse, packet.PacketTypeError} {
+		fmt.Fprintf(&b, "    [%d] = %s,\n", t.TypeID, luaString(t.Name))
+	}
+	fmt.Fprintf(&b, "    [%d] = %s,\n", transport.NATPacketTypeID, luaString("NAT traversal"))
+	b.WriteString("}\n\n")
+
+	b.WriteString("local extension_types = {\n")
+	for _, e := range extensionNames {
+		fmt.Fprintf(&b, "    [%d] = %s,\n", e.Type, luaString(e.Name))
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString("local throttle_states = {\n")
+	for s := packet.ThrottleNone; s <= packet.ThrottleOverloaded; s++ {
+		fmt.Fprintf(&b, "    [%d] = %s,\n", s, luaString(s.String()))
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString("local drop_reasons = {\n")
+	for r := packet.DropReasonNone; r <= packet.DropReasonLoopDetected; r++ {
+		fmt.Fprintf(&b, "    [%d] = %s,\n", r, luaString(r.String()))
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString("-- Public fields of the messages, in the order of the public table\n")
+	b.WriteString("local messages = {\n")
+	for _, m := range msgs {
+		writeMessage(&b, m)
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString("-- Methods by \"<service ID>:<method ID>\", as in the header of requests\n")
+	b.WriteString("local methods = {\n")
+	for _, m := range methods {
+		fmt.Fprintf(&b, "    [%s] = { name = %s, request = %s, response = %s },\n",
+			luaString(fmt.Sprintf("%d:%d", m.ServiceID, m.MethodID)), luaString(m.Service+"/"+m.Method),
+			luaString(m.Request), luaString(m.Response))
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString(dissectorRuntime)
+	return b.Bytes(), nil
+}
+
+// writeMessage writes the entry of the messages table of m
+func writeMessage(b *bytes.Buffer, m *schema.Message) {
+	var public []schema.Field
+	interned := false
+	for _, f := range m.Fields {
+		if f.Public {
+			public = append(public, f)
+			interned = interned || f.Interned
+		}
+	}
+
+	fmt.Fprintf(b, "    [%s] = {\n", luaString(m.FullName))
+	fmt.Fprintf(b, "        interned = %t,\n", interned)
+	b.WriteString("        fields = {\n")
+	for _, f := range public {
+		fmt.Fprintf(b, "            { name = %s, kind = %s, repeated = %t, delta = %t, interned = %t, sensitive = %t",
+			luaString(f.Name), luaString(f.Kind.String()), f.Repeated, f.Delta, f.Interned, f.Sensitive)
+		if f.Kind == schema.KindMessage {
+			fmt.Fprintf(b, ", message = %s", luaString(f.Message))
+		}
+		b.WriteString(" },\n")
+	}
+	b.WriteString("        },\n")
+	b.WriteString("    },\n")
+}
+
+// luaString quotes s as a Lua string literal. Names of protobuf elements are ASCII, for which
+// the escapes of Go and Lua agree.
+func luaString(s string) string {
+	return strconv.QuoteToASCII(s)
+}
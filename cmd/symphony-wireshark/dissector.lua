@@ -0,0 +1,501 @@
+-- Runtime of the dissectors generated by symphony-wireshark, which follows the generated
+-- tables: default_ports, nat_packet_type, the names of values, messages and methods.
+--
+-- A datagram is an ErrorPacket (types Unknown and Error) or a DataPacket: its header, the
+-- extension TLVs if flagged, then a chunk of the message of its RPC. The public segment of a
+-- message is dissected in the datagram that completes it, from the chunks of the earlier
+-- datagrams of the RPC, collected on the first pass over the capture.
+
+local arpc = Proto("arpc", "aRPC")
+
+arpc.prefs.ports = Pref.range("UDP ports", default_ports, "UDP ports of aRPC traffic", 65535)
+arpc.prefs.show_sensitive = Pref.bool("Show sensitive fields", false,
+    "Show the values of public fields marked sensitive instead of redacting them")
+
+local DATA_HEADER_SIZE = 31
+local ERROR_HEADER_SIZE = 25
+local SYMPHONY_HEADER_SIZE = 13
+local MAX_DEPTH = 16
+
+local hf = {
+    type = ProtoField.uint8("arpc.type", "Packet type", base.DEC, packet_types),
+    rpc_id = ProtoField.uint64("arpc.rpc_id", "RPC ID"),
+    total_packets = ProtoField.uint16("arpc.total_packets", "Total packets"),
+    seq_number = ProtoField.uint16("arpc.seq_number", "Sequence number"),
+    flags = ProtoField.uint8("arpc.flags", "Flags", base.HEX),
+    more_fragments = ProtoField.bool("arpc.flags.more_fragments", "More fragments", 8, nil, 0x01),
+    has_extensions = ProtoField.bool("arpc.flags.has_extensions", "Has extensions", 8, nil, 0x02),
+    fragment_index = ProtoField.uint8("arpc.fragment_index", "Fragment index"),
+    dst_ip = ProtoField.ipv4("arpc.dst_ip", "Destination IP"),
+    dst_port = ProtoField.uint16("arpc.dst_port", "Destination port"),
+    src_ip = ProtoField.ipv4("arpc.src_ip", "Source IP"),
+    src_port = ProtoField.uint16("arpc.src_port", "Source port"),
+    payload_length = ProtoField.uint32("arpc.payload_length", "Payload length"),
+    extensions_length = ProtoField.uint16("arpc.extensions.length", "Extensions length"),
+    extension_type = ProtoField.uint8("arpc.extension.type", "Type", base.DEC, extension_types),
+    extension_length = ProtoField.uint8("arpc.extension.length", "Length"),
+    extension_value = ProtoField.bytes("arpc.extension.value", "Value"),
+    payload = ProtoField.bytes("arpc.payload", "Payload"),
+    error_length = ProtoField.uint32("arpc.error.length", "Message length"),
+    error_message = ProtoField.string("arpc.error.message", "Message"),
+    throttle = ProtoField.uint8("arpc.error.throttle", "Throttle", base.DEC, throttle_states),
+    retry_after = ProtoField.uint24("arpc.error.retry_after_ms", "Retry after (ms)"),
+    drop_reason = ProtoField.uint8("arpc.error.drop_reason", "Drop reason", base.DEC, drop_reasons),
+    version = ProtoField.uint8("arpc.symphony.version", "Version", base.HEX),
+    offset_to_private = ProtoField.uint32("arpc.symphony.offset_to_private", "Offset to private segment"),
+    service_id = ProtoField.uint32("arpc.symphony.service_id", "Service ID"),
+    method_id = ProtoField.uint32("arpc.symphony.method_id", "Method ID"),
+    dictionary = ProtoField.uint32("arpc.symphony.dictionary", "String dictionary offset"),
+    method = ProtoField.string("arpc.method", "Method"),
+    message = ProtoField.string("arpc.message", "Message"),
+}
+
+local ef_truncated = ProtoExpert.new("arpc.truncated", "Beyond the available data",
+    expert.group.MALFORMED, expert.severity.WARN)
+local ef_unknown_method = ProtoExpert.new("arpc.unknown_method", "No schema for the method",
+    expert.group.UNDECODED, expert.severity.NOTE)
+arpc.experts = { ef_truncated, ef_unknown_method }
+
+-- Fields of fixed-length kinds are inline in the table of their segment
+local sizes = { bool = 1, int32 = 4, int64 = 8, uint32 = 4, uint64 = 8, float = 4, double = 8, enum = 4 }
+
+local constructors = {
+    bool = ProtoField.bool, int32 = ProtoField.int32, int64 = ProtoField.int64,
+    uint32 = ProtoField.uint32, uint64 = ProtoField.uint64, float = ProtoField.float,
+    double = ProtoField.double, enum = ProtoField.int32, string = ProtoField.string,
+    bytes = ProtoField.bytes, message = ProtoField.bytes,
+}
+
+-- Every public field gets a display filter field, arpc.<message>.<field>
+local protofields = {}
+for _, field in pairs(hf) do
+    protofields[#protofields + 1] = field
+end
+for name, message in pairs(messages) do
+    for _, field in ipairs(message.fields) do
+        local abbr = "arpc." .. name .. "." .. field.name
+        if field.delta then
+            field.protofield = ProtoField.bytes(abbr, field.name)
+        elseif field.interned then
+            field.protofield = ProtoField.string(abbr, field.name)
+        else
+            field.protofield = constructors[field.kind](abbr, field.name)
+        end
+        protofields[#protofields + 1] = field.protofield
+    end
+end
+arpc.fields = protofields
+
+local function fits(tvb, at, length)
+    return at >= 0 and length >= 0 and at + length <= tvb:len()
+end
+
+local function truncated(tree, what)
+    tree:add_proto_expert_info(ef_truncated, what .. " is beyond the available data")
+end
+
+local function redacted(field)
+    return field.sensitive and not arpc.prefs.show_sensitive
+end
+
+-- add_value adds a value of a field, held by range
+local function add_value(tree, field, range)
+    if redacted(field) then
+        return tree:add(range, field.name .. ": <redacted>")
+    end
+    return tree:add_le(field.protofield, range)
+end
+
+-- add_interned adds a string of an interned field, whose reference into dict is held by range
+local function add_interned(tree, field, range, dict)
+    if redacted(field) then
+        return tree:add(range, field.name .. ": <redacted>")
+    end
+    local ref = range:le_uint()
+    local value = dict and dict[ref]
+    if value == nil then
+        return tree:add(field.protofield, range, string.format("<reference %d>", ref))
+    end
+    return tree:add(field.protofield, range, value)
+end
+
+-- read_dict reads the string dictionary at offset at: [count], then [length][bytes] per
+-- string. References to its strings start from 1.
+local function read_dict(tvb, at)
+    local dict = {}
+    if not fits(tvb, at, 4) then
+        return dict
+    end
+    local count = tvb(at, 4):le_uint()
+    local pos = at + 4
+    for i = 1, count do
+        if not fits(tvb, pos, 4) then
+            break
+        end
+        local length = tvb(pos, 4):le_uint()
+        if not fits(tvb, pos + 4, length) then
+            break
+        end
+        dict[i] = length > 0 and tvb(pos + 4, length):string() or ""
+        pos = pos + 4 + length
+    end
+    return dict
+end
+
+local dissect_message
+
+-- add_variable adds a string, bytes or nested message value held by the length bytes at at,
+-- which follow their length
+local function add_variable(tvb, tree, field, at, length, depth)
+    if length == 0 then
+        return tree:add(tvb(at - 4, 4), field.name .. ": (empty)")
+    end
+    local range = tvb(at, length)
+    local item = add_value(tree, field, range)
+    local nested = field.kind == "message" and messages[field.message]
+    if nested and not redacted(field) then
+        item:append_text(" (" .. field.message .. ")")
+        if depth < MAX_DEPTH then
+            dissect_message(range:tvb(), item, nested, depth + 1)
+        end
+    end
+    return item
+end
+
+-- dissect_payload adds the value of a variable-length, repeated or nested field whose payload
+-- starts at at
+local function dissect_payload(tvb, tree, field, at, dict, depth)
+    if not fits(tvb, at, 4) then
+        return truncated(tree, field.name)
+    end
+    local n = tvb(at, 4):le_uint()
+    local pos = at + 4
+    if not field.repeated then
+        -- [length][bytes]
+        if not fits(tvb, pos, n) then
+            return truncated(tree, field.name)
+        end
+        return add_variable(tvb, tree, field, pos, n, depth)
+    end
+
+    -- [count][items]
+    local list = tree:add(tvb(at, 4), string.format("%s: %d items", field.name, n))
+    if field.delta then
+        -- [count][length][varint deltas]
+        if not fits(tvb, pos, 4) then
+            return truncated(list, field.name)
+        end
+        local length = tvb(pos, 4):le_uint()
+        if not fits(tvb, pos + 4, length) then
+            return truncated(list, field.name)
+        end
+        if length > 0 then
+            add_value(list, field, tvb(pos + 4, length)):append_text(" (delta encoded)")
+        end
+        return
+    end
+    local size = sizes[field.kind]
+    for _ = 1, n do
+        if field.interned then
+            if not fits(tvb, pos, 4) then
+                return truncated(list, field.name)
+            end
+            add_interned(list, field, tvb(pos, 4), dict)
+            pos = pos + 4
+        elseif size then
+            if not fits(tvb, pos, size) then
+                return truncated(list, field.name)
+            end
+            add_value(list, field, tvb(pos, size))
+            pos = pos + size
+        else
+            -- [length][bytes] per item
+            if not fits(tvb, pos, 4) then
+                return truncated(list, field.name)
+            end
+            local length = tvb(pos, 4):le_uint()
+            if not fits(tvb, pos + 4, length) then
+                return truncated(list, field.name)
+            end
+            add_variable(tvb, list, field, pos + 4, length, depth)
+            pos = pos + 4 + length
+        end
+    end
+end
+
+-- dissect_message adds the public fields of a message encoded at the start of tvb, from its
+-- reserved header. Payload offsets are relative to that start; 0 is an absent field.
+dissect_message = function(tvb, tree, message, depth)
+    if not fits(tvb, 0, SYMPHONY_HEADER_SIZE) then
+        return truncated(tree, "The header")
+    end
+    local pos = SYMPHONY_HEADER_SIZE
+    local dict
+    if message.interned then
+        -- The table starts with the offset of the string dictionary
+        if not fits(tvb, pos, 4) then
+            return truncated(tree, "The string dictionary")
+        end
+        tree:add_le(hf.dictionary, tvb(pos, 4))
+        local offset = tvb(pos, 4):le_uint()
+        if offset ~= 0 then
+            dict = read_dict(tvb, offset)
+        end
+        pos = pos + 4
+    end
+    for _, field in ipairs(message.fields) do
+        local size = sizes[field.kind]
+        if size and not field.repeated then
+            if not fits(tvb, pos, size) then
+                return truncated(tree, field.name)
+            end
+            add_value(tree, field, tvb(pos, size))
+            pos = pos + size
+        else
+            if not fits(tvb, pos, 4) then
+                return truncated(tree, field.name)
+            end
+            local slot = tvb(pos, 4)
+            if slot:le_uint() ~= 0 then
+                if field.interned and not field.repeated then
+                    -- The slot holds the reference itself
+                    add_interned(tree, field, slot, dict)
+                else
+                    dissect_payload(tvb, tree, field, slot:le_uint(), dict, depth)
+                end
+            end
+            pos = pos + 4
+        end
+    end
+end
+
+-- Chunks of the payloads of the RPCs being collected, by direction and RPC ID, then by
+-- sequence number
+local rpcs = {}
+-- Public segments, by the number of the frame that completed them
+local public_segments = {}
+-- Methods of the requests, by RPC ID, which give the messages of their responses
+local request_methods = {}
+
+function arpc.init()
+    rpcs, public_segments, request_methods = {}, {}, {}
+end
+
+local function le_uint32(bytes, at)
+    return bytes:get_index(at) + bytes:get_index(at + 1) * 0x100 +
+        bytes:get_index(at + 2) * 0x10000 + bytes:get_index(at + 3) * 0x1000000
+end
+
+-- collect adds the payload of a data packet to those of its RPC, and keeps the public
+-- segment for the frame if it completes it
+local function collect(pinfo, key, seq, payload)
+    local rpc = rpcs[key]
+    if rpc == nil then
+        rpc = {}
+        rpcs[key] = rpc
+    end
+    if rpc.done then
+        return
+    end
+    rpc[seq] = payload:bytes()
+
+    local data = ByteArray.new()
+    local i = 0
+    while rpc[i] do
+        data = data .. rpc[i]
+        i = i + 1
+    end
+    if data:len() < SYMPHONY_HEADER_SIZE or data:len() < le_uint32(data, 1) then
+        return
+    end
+    rpcs[key] = { done = true }
+    public_segments[pinfo.number] = data
+end
+
+-- dissect_public adds the public segment of a message, and returns the name of its method
+local function dissect_public(tvb, tree, packet_type, rpc_id, pinfo)
+    local segment = tree:add(tvb(), "Public segment")
+    segment:add(hf.version, tvb(0, 1))
+    segment:add_le(hf.offset_to_private, tvb(1, 4))
+    segment:add_le(hf.service_id, tvb(5, 4))
+    segment:add_le(hf.method_id, tvb(9, 4))
+
+    local method, name
+    if packet_type == 1 then
+        method = methods[string.format("%d:%d", tvb(5, 4):le_uint(), tvb(9, 4):le_uint())]
+        if not pinfo.visited then
+            request_methods[rpc_id] = method
+        end
+        name = method and method.request
+    else
+        method = request_methods[rpc_id]
+        name = method and method.response
+    end
+    local message = name and messages[name]
+    if message == nil then
+        segment:add_proto_expert_info(ef_unknown_method)
+        return nil
+    end
+    segment:add(hf.method, tvb(5, 8), method.name):set_generated()
+    segment:add(hf.message, tvb(5, 8), name):set_generated()
+    dissect_message(tvb, segment, message, 0)
+    return method.name
+end
+
+local function dissect_error(tvb, pinfo, tree)
+    if not fits(tvb, 0, ERROR_HEADER_SIZE) then
+        truncated(tree, "The header")
+        return tvb:len()
+    end
+    local rpc_id = tvb(1, 8):le_uint64()
+    tree:add_le(hf.rpc_id, tvb(1, 8))
+    tree:add(hf.dst_ip, tvb(9, 4))
+    tree:add_le(hf.dst_port, tvb(13, 2))
+    tree:add(hf.src_ip, tvb(15, 4))
+    tree:add_le(hf.src_port, tvb(19, 2))
+    tree:add_le(hf.error_length, tvb(21, 4))
+
+    local length = tvb(21, 4):le_uint()
+    local pos = ERROR_HEADER_SIZE
+    local text = ""
+    if length > 0 then
+        if not fits(tvb, pos, length) then
+            truncated(tree, "The message")
+            return tvb:len()
+        end
+        tree:add(hf.error_message, tvb(pos, length))
+        text = tvb(pos, length):string()
+        pos = pos + length
+    end
+    -- The retry hint, without the drop reason from older senders
+    if fits(tvb, pos, 4) then
+        tree:add(hf.throttle, tvb(pos, 1))
+        tree:add_le(hf.retry_after, tvb(pos + 1, 3))
+    end
+    if fits(tvb, pos + 4, 1) then
+        tree:add(hf.drop_reason, tvb(pos + 4, 1))
+    end
+    pinfo.cols.info = "Error rpc_id=" .. tostring(rpc_id) .. " " .. text
+    return tvb:len()
+end
+
+local function dissect_data(tvb, pinfo, tree, packet_type)
+    if not fits(tvb, 0, DATA_HEADER_SIZE) then
+        truncated(tree, "The header")
+        return tvb:len()
+    end
+    local rpc_id = tostring(tvb(1, 8):le_uint64())
+    local total = tvb(9, 2):le_uint()
+    local seq = tvb(11, 2):le_uint()
+    tree:add_le(hf.rpc_id, tvb(1, 8))
+    tree:add_le(hf.total_packets, tvb(9, 2))
+    tree:add_le(hf.seq_number, tvb(11, 2))
+    local flags = tree:add(hf.flags, tvb(13, 1))
+    flags:add(hf.more_fragments, tvb(13, 1))
+    flags:add(hf.has_extensions, tvb(13, 1))
+    tree:add(hf.fragment_index, tvb(14, 1))
+    tree:add(hf.dst_ip, tvb(15, 4))
+    tree:add_le(hf.dst_port, tvb(19, 2))
+    tree:add(hf.src_ip, tvb(21, 4))
+    tree:add_le(hf.src_port, tvb(25, 2))
+    tree:add_le(hf.payload_length, tvb(27, 4))
+
+    local info = string.format("%s rpc_id=%s seq=%d/%d",
+        packet_types[packet_type] or string.format("Type %d", packet_type), rpc_id, seq, total)
+    pinfo.cols.info = info
+
+    local pos = DATA_HEADER_SIZE
+    if tvb(13, 1):uint() % 4 >= 2 then
+        -- [area length][type][length][value]...
+        if not fits(tvb, pos, 2) then
+            truncated(tree, "The extensions")
+            return tvb:len()
+        end
+        local area = tvb(pos, 2):le_uint()
+        if not fits(tvb, pos + 2, area) then
+            truncated(tree, "The extensions")
+            return tvb:len()
+        end
+        local list = tree:add(tvb(pos, 2 + area), "Extensions")
+        list:add_le(hf.extensions_length, tvb(pos, 2))
+        local at, stop = pos + 2, pos + 2 + area
+        while at < stop do
+            if at + 2 > stop or at + 2 + tvb(at + 1, 1):uint() > stop then
+                truncated(list, "An extension")
+                break
+            end
+            local ext_type, length = tvb(at, 1):uint(), tvb(at + 1, 1):uint()
+            local ext = list:add(tvb(at, 2 + length), "Extension: " .. (extension_types[ext_type] or string.format("type %d", ext_type)))
+            ext:add(hf.extension_type, tvb(at, 1))
+            ext:add(hf.extension_length, tvb(at + 1, 1))
+            if length > 0 then
+                ext:add(hf.extension_value, tvb(at + 2, length))
+            end
+            at = at + 2 + length
+        end
+        pos = stop
+    end
+
+    local length = tvb(27, 4):le_uint()
+    if not fits(tvb, pos, length) then
+        truncated(tree, "The payload")
+        return tvb:len()
+    end
+    if length == 0 then
+        return tvb:len()
+    end
+    local payload = tvb(pos, length)
+    tree:add(hf.payload, payload)
+
+    if not pinfo.visited then
+        local key = string.format("%s:%d/%d/%s", tostring(pinfo.src), pinfo.src_port, packet_type, rpc_id)
+        collect(pinfo, key, seq, payload)
+    end
+    local public = public_segments[pinfo.number]
+    if public then
+        local method = dissect_public(public:tvb("Public segment"), tree, packet_type, rpc_id, pinfo)
+        if method then
+            pinfo.cols.info = info .. " " .. method
+        end
+    elseif seq == 0 then
+        tree:add(payload, "Public segment: continued in later datagrams")
+    end
+    return tvb:len()
+end
+
+function arpc.dissector(tvb, pinfo, tree)
+    if tvb:len() == 0 then
+        return 0
+    end
+    pinfo.cols.protocol = "aRPC"
+    local packet_type = tvb(0, 1):uint()
+    local root = tree:add(arpc, tvb())
+    root:add(hf.type, tvb(0, 1))
+    if packet_type == nat_packet_type then
+        pinfo.cols.info = "NAT traversal"
+        return tvb:len()
+    end
+    if packet_type == 0 or packet_type == 3 then
+        return dissect_error(tvb, pinfo, root)
+    end
+    return dissect_data(tvb, pinfo, root, packet_type)
+end
+
+local registered_ports = ""
+
+local function register_ports()
+    local udp = DissectorTable.get("udp.port")
+    if registered_ports ~= "" then
+        udp:remove(registered_ports, arpc)
+    end
+    registered_ports = tostring(arpc.prefs.ports)
+    if registered_ports ~= "" then
+        udp:add(registered_ports, arpc)
+    end
+end
+
+function arpc.prefs_changed()
+    register_ports()
+end
+
+register_ports()
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/appnet-org/arpc/cmd/symphony-gen-arpc/test"
+	"github.com/appnet-org/arpc/pkg/schema"
+)
+
+// testRegistry holds the schemas of the test package, and a method whose request is a
+// Test.ComplexMixed, as in pkg/packet/testdata/vectors.json
+func testRegistry(t *testing.T) *schema.Registry {
+	t.Helper()
+	reg := schema.NewRegistry()
+	if err := reg.RegisterEncoded(schema.Global.Export()); err != nil {
+		t.Fatalf("RegisterEncoded failed: %v", err)
+	}
+	reg.RegisterMethod(&schema.MethodSchema{
+		ServiceID: 1, MethodID: 2, Service: "Test.Mixed", Method: "Echo",
+		Request: "Test.ComplexMixed", Response: "Test.ComplexMixed",
+	})
+	return reg
+}
+
+func TestGenerateDissector(t *testing.T) {
+	out, err := generateDissector(testRegistry(t), "9000,9100-9110")
+	if err != nil {
+		t.Fatalf("generateDissector failed: %v", err)
+	}
+	lua := string(out)
+
+	for _, want := range []string{
+		"-- Code generated by symphony-wireshark. DO NOT EDIT.",
+		`local default_ports = "9000,9100-9110"`,
+		`[254] = "NAT traversal",`,
+		`[2] = "Priority",`,
+		`[1] = "policy_denied",`,
+		`["1:2"] = { name = "Test.Mixed/Echo", request = "Test.ComplexMixed", response = "Test.ComplexMixed" },`,
+		`{ name = "nested_leaf", kind = "message", repeated = false, delta = false, interned = false, sensitive = false, message = "Test.Leaf" },`,
+		`{ name = "card_number", kind = "string", repeated = false, delta = false, interned = false, sensitive = true },`,
+		`{ name = "timestamps", kind = "int64", repeated = true, delta = true, interned = false, sensitive = false },`,
+		`{ name = "currencies", kind = "string", repeated = true, delta = false, interned = true, sensitive = false },`,
+		`local arpc = Proto("arpc", "aRPC")`,
+	} {
+		if !strings.Contains(lua, want) {
+			t.Errorf("Dissector lacks %s", want)
+		}
+	}
+
+	// Only public fields are listed, in the order of the public table
+	m, _ := schema.Global.Message("Test.ComplexMixed")
+	entry := lua[strings.Index(lua, `["Test.ComplexMixed"] = {`):]
+	entry = entry[:strings.Index(entry, "\n    },\n")]
+	pos := 0
+	for _, f := range m.Fields {
+		i := strings.Index(entry, `{ name = "`+f.Name+`",`)
+		if !f.Public {
+			if i >= 0 {
+				t.Errorf("Private field %s is listed", f.Name)
+			}
+			continue
+		}
+		if i < pos {
+			t.Errorf("Public field %s is missing or out of order", f.Name)
+		}
+		pos = i
+	}
+	if !strings.Contains(lua, `["Test.Catalog"] = {`+"\n        interned = true,") {
+		t.Errorf("Test.Catalog is not marked as having interned public fields")
+	}
+}
+
+func TestGenerateDissector_InvalidPorts(t *testing.T) {
+	for _, ports := range []string{"", "9000;9001", "90-", `9000"`} {
+		if _, err := generateDissector(schema.NewRegistry(), ports); err == nil {
+			t.Errorf("%q: expected an error", ports)
+		}
+	}
+}
+
+func TestDissectorSyntax(t *testing.T) {
+	luac, err := exec.LookPath("luac")
+	if err != nil {
+		t.Skip("luac not found")
+	}
+	out, err := generateDissector(testRegistry(t), "9000")
+	if err != nil {
+		t.Fatalf("generateDissector failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "arpc.lua")
+	if err := os.WriteFile(path, out, 0o644); err != nil {
+		t.Fatalf("Failed to write dissector: %v", err)
+	}
+	if out, err := exec.Command(luac, "-p", path).CombinedOutput(); err != nil {
+		t.Fatalf("luac failed: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,63 @@
+// symphony-wireshark generates a Lua dissector for Wireshark (and tshark) that decodes the
+// datagrams of aRPC: the DataPacket and ErrorPacket headers, their extensions, and the
+// public segment of Symphony messages, with a display filter field per public field.
+//
+// Schemas are read from FileDescriptorSets, as produced by
+//
+//	protoc --include_imports --descriptor_set_out=kv.binpb kv.proto
+//
+// from schema blobs, such as the one served at GET /schemas by the admin API of cmd/proxy,
+// and from the schemas of the generated packages linked into the tool (see README.md).
+//
+// Usage:
+//
+//	symphony-wireshark [-ports 9000] [-o arpc.lua] [schema...]
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/appnet-org/arpc/pkg/schema"
+)
+
+func main() {
+	ports := flag.String("ports", "9000", "UDP ports the dissector is registered on by default, as a Wireshark range (e.g. 9000,9100-9110)")
+	output := flag.String("o", "", "write the dissector to this file instead of standard output")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-ports 9000] [-o arpc.lua] [schema...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	for _, path := range flag.Args() {
+		if err := schema.Global.LoadFile(path); err != nil {
+			// Messages without a Symphony encoding are reported after the others are loaded
+			var skipped interface{ Unwrap() []error }
+			if !errors.As(err, &skipped) {
+				fatal(err)
+			}
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		}
+	}
+
+	dissector, err := generateDissector(schema.Global, *ports)
+	if err != nil {
+		fatal(err)
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(dissector)
+	} else {
+		err = os.WriteFile(*output, dissector, 0o644)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}
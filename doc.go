@@ -0,0 +1,12 @@
+// Package arpc is the stable API of aRPC: the client, the server and the types generated code
+// and applications build on. Its names follow semantic versioning: within a major version they
+// are only added to, never removed or changed incompatibly, whatever is refactored under pkg/.
+//
+// The types are aliases of their pkg/rpc counterparts, so values flow freely between code
+// written against this package, generated code and the packages under pkg/. Methods of the
+// aliased types not named by the interfaces of this package (ClientConn, ServiceRegistrar)
+// carry no guarantee; neither do the packages under pkg/, which are the implementation.
+//
+// Experimental APIs live under github.com/appnet-org/arpc/x/. They may change or disappear in
+// any release; a stable API graduates from there to this package.
+package arpc
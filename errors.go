@@ -0,0 +1,33 @@
+package arpc
+
+import (
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/rpc"
+)
+
+type (
+	// RPCError is the error of a failed call, as seen by clients and returned by handlers
+	RPCError = rpc.RPCError
+	// RPCErrorType is the kind of an RPCError
+	RPCErrorType = rpc.RPCErrorType
+	// RetryHint is the load signal sent along with an error
+	RetryHint = packet.RetryHint
+)
+
+// Kinds of RPCError, see their rpc counterparts. Types compare by value, so they match the
+// Type of errors made by pkg/rpc.
+var (
+	RPCUnknownError           = rpc.RPCUnknownError
+	RPCFailError              = rpc.RPCFailError
+	RPCUnavailableError       = rpc.RPCUnavailableError
+	RPCResourceExhaustedError = rpc.RPCResourceExhaustedError
+	RPCDeadlineExceededError  = rpc.RPCDeadlineExceededError
+	RPCUnauthenticatedError   = rpc.RPCUnauthenticatedError
+	RPCDroppedError           = rpc.RPCDroppedError
+)
+
+// NewThrottleError returns an error that a handler can return to shed load. The client's
+// retry policy waits at least hint.RetryAfter before retrying.
+func NewThrottleError(reason string, hint RetryHint) *RPCError {
+	return rpc.NewThrottleError(reason, hint)
+}
@@ -10,7 +10,7 @@ import (
 	"github.com/appnet-org/arpc/pkg/metadata"
 	"github.com/appnet-org/arpc/pkg/rpc"
 	"github.com/appnet-org/arpc/pkg/rpc/element"
-	"github.com/appnet-org/arpc/pkg/serializer"
+	"github.com/appnet-org/arpc/pkg/serializer/capnpserializer"
 )
 
 var echoClient echo.EchoServiceClient
@@ -52,7 +52,7 @@ func handler(w http.ResponseWriter, r *http.Request) {
 
 func main() {
 	// Create RPC client with capnp serializer
-	serializer := &serializer.CapnpSerializer{}
+	serializer := &capnpserializer.Serializer{}
 
 	// Create metrics element
 	metrics := NewMetricsElement()
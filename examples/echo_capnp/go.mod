@@ -7,6 +7,7 @@ toolchain go1.24.8
 require (
 	capnproto.org/go/capnp/v3 v3.1.0-alpha.1
 	github.com/appnet-org/arpc v0.0.0-20250521234147-524183cf9b99
+	github.com/appnet-org/arpc/pkg/serializer/capnpserializer v0.0.0-00010101000000-000000000000
 )
 
 require (
@@ -18,3 +19,5 @@ require (
 )
 
 replace github.com/appnet-org/arpc => ../..
+
+replace github.com/appnet-org/arpc/pkg/serializer/capnpserializer => ../../pkg/serializer/capnpserializer
@@ -8,7 +8,7 @@ import (
 	echo "github.com/appnet-org/arpc/examples/echo_capnp/capnp"
 	"github.com/appnet-org/arpc/pkg/metadata"
 	"github.com/appnet-org/arpc/pkg/rpc"
-	"github.com/appnet-org/arpc/pkg/serializer"
+	"github.com/appnet-org/arpc/pkg/serializer/capnpserializer"
 )
 
 // EchoService implementation
@@ -38,7 +38,7 @@ func (s *echoServer) Echo(ctx context.Context, req *echo.EchoRequest_) (*echo.Ec
 }
 
 func main() {
-	serializer := &serializer.CapnpSerializer{}
+	serializer := &capnpserializer.Serializer{}
 
 	server, err := rpc.NewServer(":9000", serializer, nil)
 	if err != nil {
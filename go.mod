@@ -3,14 +3,8 @@ module github.com/appnet-org/arpc
 go 1.24.0
 
 require (
-	capnproto.org/go/capnp/v3 v3.1.0-alpha.1
-	github.com/google/flatbuffers v25.12.19+incompatible
 	go.uber.org/zap v1.27.0
 	google.golang.org/protobuf v1.36.10
 )
 
-require (
-	github.com/colega/zeropool v0.0.0-20230505084239-6fb4a4f75381 // indirect
-	go.uber.org/multierr v1.11.0 // indirect
-	golang.org/x/sync v0.17.0 // indirect
-)
+require go.uber.org/multierr v1.11.0 // indirect
@@ -0,0 +1,51 @@
+// Package allocaudit locks in the allocation budget of the hot paths of aRPC. Built with the
+// arpc_allocaudit tag, the client, server and transport count the heap allocations of every
+// RPC on its way out (marshal, fragment, send) and on its way in (receive, reassemble,
+// unmarshal), and panic when an RPC goes over the budget set for the path, so that tests fail
+// on changes that undo pooling or zero-copy work. Without the tag, the instrumentation
+// compiles to nothing.
+//
+// Allocations are counted for the whole process, so audited tests run one RPC at a time. The
+// budgets of the paths are locked in by
+//
+//	go test -tags arpc_allocaudit ./pkg/allocaudit
+package allocaudit
+
+import "fmt"
+
+// Path is an instrumented hot path
+type Path uint8
+
+const (
+	// PathSend covers marshaling a message, fragmenting it and sending the fragments
+	PathSend Path = iota
+	// PathReceive covers receiving the fragments of a message, reassembling and unmarshaling it
+	PathReceive
+
+	numPaths
+)
+
+func (p Path) String() string {
+	switch p {
+	case PathSend:
+		return "send"
+	case PathReceive:
+		return "receive"
+	}
+	return fmt.Sprintf("path(%d)", uint8(p))
+}
+
+// Budget is the number of heap allocations an RPC may make on a path: PerRPC, plus
+// PerFragment for every fragment of its message
+type Budget struct {
+	PerRPC      int
+	PerFragment int
+}
+
+// Unlimited is the default budget of the paths, which disables the check
+var Unlimited = Budget{PerRPC: -1}
+
+// allows reports whether allocs allocations of a message of fragments fragments fit in b
+func (b Budget) allows(allocs uint64, fragments int) bool {
+	return b.PerRPC < 0 || allocs <= uint64(b.PerRPC+b.PerFragment*fragments)
+}
@@ -0,0 +1,40 @@
+package allocaudit
+
+import (
+	"strings"
+	"testing"
+)
+
+var sink []byte
+
+func TestFinishOverBudget(t *testing.T) {
+	if !Enabled {
+		t.Skip("built without the arpc_allocaudit tag")
+	}
+	defer SetBudget(PathReceive, Unlimited)
+
+	// Allocations of the spans of an RPC add up
+	SetBudget(PathReceive, Budget{PerRPC: 1, PerFragment: 1})
+	mark := Start()
+	sink = make([]byte, 64)
+	mark.Stop(PathReceive, 1, 1)
+	mark = Start()
+	sink = make([]byte, 64)
+	mark.Finish(PathReceive, 1, 0)
+
+	defer func() {
+		msg, _ := recover().(string)
+		if !strings.Contains(msg, "over the budget") {
+			t.Errorf("recovered %q, want a panic over the budget", msg)
+		}
+	}()
+	for range 2 {
+		mark := Start()
+		sink = make([]byte, 64)
+		mark.Stop(PathReceive, 2, 0)
+	}
+	mark = Start()
+	sink = make([]byte, 64)
+	mark.Finish(PathReceive, 2, 1)
+	t.Error("expected Finish to panic for 3 allocations over a budget of 2")
+}
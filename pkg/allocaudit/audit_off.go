@@ -0,0 +1,27 @@
+//go:build !arpc_allocaudit
+
+package allocaudit
+
+// Enabled reports whether the package was built with the arpc_allocaudit tag
+const Enabled = false
+
+// SetBudget sets the budget of path
+func SetBudget(path Path, budget Budget) {}
+
+// Mark is the start of a span of a hot path
+type Mark struct{}
+
+// Start starts a span
+func Start() Mark { return Mark{} }
+
+// Stop adds the allocations since m, for fragments fragments, to those of the RPC on path,
+// for a path that continues in another span, e.g. in another goroutine
+func (m Mark) Stop(path Path, rpcID uint64, fragments int) {}
+
+// Finish ends the last span of the RPC on path, which handled fragments more fragments. It
+// panics if the RPC allocated more than the budget of the path.
+func (m Mark) Finish(path Path, rpcID uint64, fragments int) {}
+
+// Forget drops the allocations counted for an RPC whose path did not finish, e.g. because
+// the call failed
+func Forget(rpcID uint64) {}
@@ -0,0 +1,91 @@
+//go:build arpc_allocaudit
+
+package allocaudit
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Enabled reports whether the package was built with the arpc_allocaudit tag
+const Enabled = true
+
+// key is an RPC on a path, whose allocations are counted across several spans
+type key struct {
+	path  Path
+	rpcID uint64
+}
+
+// count is the allocations and fragments of the spans of an RPC so far
+type count struct {
+	allocs    uint64
+	fragments int
+}
+
+var (
+	mu      sync.Mutex
+	budgets = [numPaths]Budget{Unlimited, Unlimited}
+	pending = make(map[key]count)
+)
+
+// SetBudget sets the budget of path
+func SetBudget(path Path, budget Budget) {
+	mu.Lock()
+	defer mu.Unlock()
+	budgets[path] = budget
+}
+
+// Mark is the start of a span of a hot path
+type Mark struct {
+	mallocs uint64
+}
+
+// Start starts a span
+func Start() Mark {
+	return Mark{mallocs: mallocs()}
+}
+
+// Stop adds the allocations since m, for fragments fragments, to those of the RPC on path,
+// for a path that continues in another span, e.g. in another goroutine
+func (m Mark) Stop(path Path, rpcID uint64, fragments int) {
+	n := mallocs() - m.mallocs
+	mu.Lock()
+	defer mu.Unlock()
+	c := pending[key{path, rpcID}]
+	pending[key{path, rpcID}] = count{allocs: c.allocs + n, fragments: c.fragments + fragments}
+}
+
+// Finish ends the last span of the RPC on path, which handled fragments more fragments. It
+// panics if the RPC allocated more than the budget of the path.
+func (m Mark) Finish(path Path, rpcID uint64, fragments int) {
+	n := mallocs() - m.mallocs
+	mu.Lock()
+	c := pending[key{path, rpcID}]
+	delete(pending, key{path, rpcID})
+	budget := budgets[path]
+	mu.Unlock()
+	c.allocs += n
+	c.fragments += fragments
+	if !budget.allows(c.allocs, c.fragments) {
+		panic(fmt.Sprintf("allocaudit: RPC %d made %d allocations for %d fragments on the %s path, over the budget of %+v",
+			rpcID, c.allocs, c.fragments, path, budget))
+	}
+}
+
+// Forget drops the allocations counted for an RPC whose path did not finish, e.g. because
+// the call failed
+func Forget(rpcID uint64) {
+	mu.Lock()
+	defer mu.Unlock()
+	for path := range numPaths {
+		delete(pending, key{path, rpcID})
+	}
+}
+
+// mallocs returns the number of heap allocations of the process so far
+func mallocs() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.Mallocs
+}
@@ -0,0 +1,149 @@
+package allocaudit_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/allocaudit"
+	"github.com/appnet-org/arpc/pkg/rpc"
+	"github.com/appnet-org/arpc/pkg/serializer"
+)
+
+// Budgets of the hot paths for raw messages. PerFragment is a little above what a fragment
+// allocates today; PerRPC leaves room for the allocations of other goroutines that land in a
+// span now and then. Lower them along with changes that save allocations; never raise them to
+// make this test pass.
+var (
+	sendBudget    = allocaudit.Budget{PerRPC: 120, PerFragment: 10}
+	receiveBudget = allocaudit.Budget{PerRPC: 40, PerFragment: 12}
+)
+
+// echoServerEnv is the file TestEchoServer writes its address to, set to serve rather than skip
+const echoServerEnv = "ARPC_ALLOCAUDIT_ECHO_SERVER"
+
+// sizes are the sizes of the messages echoed, of one to a few hundred fragments
+var sizes = []int{64, 1400, 8 << 10, 64 << 10, 256 << 10}
+
+// setBudgets sets the budgets of the hot paths
+func setBudgets() {
+	allocaudit.SetBudget(allocaudit.PathSend, sendBudget)
+	allocaudit.SetBudget(allocaudit.PathReceive, receiveBudget)
+}
+
+// newEchoMux returns the mux of the echo server: Echo echoes the request, and Arm sets the
+// budgets once the client has warmed up the server
+func newEchoMux() *rpc.Mux {
+	mux := rpc.NewMux()
+	rpc.HandleFunc(mux, "Echo", "Echo", func(ctx context.Context, req *serializer.RawMessage) (*serializer.RawMessage, error) {
+		return req, nil
+	})
+	rpc.HandleFunc(mux, "Echo", "Arm", func(ctx context.Context, req *serializer.RawMessage) (*serializer.RawMessage, error) {
+		setBudgets()
+		return req, nil
+	})
+	return mux
+}
+
+// TestEchoServer is the server of TestHotPathBudget, run in a process of its own so that the
+// allocations of the server and the client are counted apart. It writes its address to a file
+// and serves until its stdin is closed. Both processes run with GOMAXPROCS=1, so that no
+// goroutine allocates while another is in the middle of a hot path, and without GC, which
+// empties the buffer pools.
+func TestEchoServer(t *testing.T) {
+	addrFile := os.Getenv(echoServerEnv)
+	if addrFile == "" {
+		t.Skip("run by TestHotPathBudget")
+	}
+	server, err := rpc.NewServer("127.0.0.1:0", &serializer.SymphonySerializer{}, nil)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	newEchoMux().Register(server)
+	go server.Start()
+	if err := os.WriteFile(addrFile, []byte(server.GetTransport().LocalAddr().String()), 0o644); err != nil {
+		t.Fatalf("failed to write the address: %v", err)
+	}
+	io.Copy(io.Discard, os.Stdin)
+}
+
+// TestHotPathBudget echoes messages with the budgets set, so that the client and server panic
+// on RPCs over budget. Run with -tags arpc_allocaudit.
+func TestHotPathBudget(t *testing.T) {
+	if !allocaudit.Enabled {
+		t.Skip("built without the arpc_allocaudit tag")
+	}
+	// The output of the server goes to a file rather than a pipe, which would take a goroutine
+	// of this process to drain
+	dir := t.TempDir()
+	addrFile, logFile := filepath.Join(dir, "addr"), filepath.Join(dir, "log")
+	log, err := os.Create(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestEchoServer$")
+	cmd.Env = append(os.Environ(), echoServerEnv+"="+addrFile, "GOMAXPROCS=1", "GOGC=off")
+	cmd.Stdout, cmd.Stderr = log, log
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start the echo server: %v", err)
+	}
+	stop := func() string {
+		stdin.Close()
+		cmd.Wait()
+		output, _ := os.ReadFile(logFile)
+		return string(output)
+	}
+	defer stop()
+
+	var addr []byte
+	for deadline := time.Now().Add(5 * time.Second); len(addr) == 0; time.Sleep(10 * time.Millisecond) {
+		if addr, _ = os.ReadFile(addrFile); len(addr) == 0 && time.Now().After(deadline) {
+			t.Fatalf("the echo server did not write its address:\n%s", stop())
+		}
+	}
+
+	client, err := rpc.NewClient(&serializer.SymphonySerializer{}, string(addr), nil)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close()
+	client.SetServiceRegistry(newEchoMux().Registry())
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	call := func(method string, size int) {
+		req := make(serializer.RawMessage, size)
+		var resp serializer.RawMessage
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := client.Call(ctx, "Echo", method, &req, &resp); err != nil {
+			t.Fatalf("call of %d bytes failed: %v\necho server:\n%s", size, err, stop())
+		}
+		if len(resp) != size {
+			t.Fatalf("echoed %d bytes, want %d", len(resp), size)
+		}
+	}
+
+	// The first calls allocate the state of the peer and fill the buffer pools
+	for _, size := range sizes {
+		call("Echo", size)
+	}
+	call("Arm", 0)
+	setBudgets()
+	defer allocaudit.SetBudget(allocaudit.PathSend, allocaudit.Unlimited)
+	defer allocaudit.SetBudget(allocaudit.PathReceive, allocaudit.Unlimited)
+	for _, size := range sizes {
+		call("Echo", size)
+	}
+}
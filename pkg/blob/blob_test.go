@@ -0,0 +1,216 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/rpc"
+	"github.com/appnet-org/arpc/pkg/serializer"
+)
+
+// loadBlob returns the blob an assemble function stored, nil if it was not called
+func loadBlob(p *atomic.Pointer[[]byte]) []byte {
+	if data := p.Load(); data != nil {
+		return *data
+	}
+	return nil
+}
+
+// startReceiver serves a receiver on a loopback server, failing Chunk calls once fail
+// returns true
+func startReceiver(t *testing.T, r *Receiver, chunks *atomic.Int32, fail func() bool) string {
+	t.Helper()
+	mux := rpc.NewMux()
+	mux.Use(func(next rpc.HandlerFunc) rpc.HandlerFunc {
+		return func(ctx context.Context, req any) (any, error) {
+			if _, method, _ := rpc.MethodFromContext(ctx); method == methodChunk {
+				if fail != nil && fail() {
+					return nil, errors.New("chunk refused")
+				}
+				chunks.Add(1)
+			}
+			return next(ctx, req)
+		}
+	})
+	r.Register(mux)
+
+	server, err := rpc.NewServer("127.0.0.1:0", &serializer.SymphonySerializer{}, nil)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	mux.Register(server)
+	go server.Start()
+	t.Cleanup(func() { server.GetTransport().Close() })
+	return server.GetTransport().LocalAddr().String()
+}
+
+func newSender(t *testing.T, addr string) *Sender {
+	t.Helper()
+	client, err := rpc.NewClient(&serializer.SymphonySerializer{}, addr, nil)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	s := NewSender(client)
+	s.ChunkSize = 16 << 10
+	s.Attempts = 1
+	return s
+}
+
+func randomContent(size int) []byte {
+	content := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(content)
+	return content
+}
+
+func TestManifestEncoding(t *testing.T) {
+	content := randomContent(100)
+	m, err := NewManifest("data.bin", bytes.NewReader(content), int64(len(content)), 30)
+	if err != nil {
+		t.Fatalf("NewManifest failed: %v", err)
+	}
+	if m.Chunks() != 4 || len(m.Checksums) != 4 || m.chunkLen(3) != 10 {
+		t.Fatalf("got %d chunks (%d checksums), last of %d bytes, want 4 chunks, last of 10 bytes", m.Chunks(), len(m.Checksums), m.chunkLen(3))
+	}
+
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	decoded := new(Manifest)
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if !decoded.equal(m) || decoded.Name != "data.bin" {
+		t.Errorf("decoded manifest %+v, want %+v", decoded, m)
+	}
+	if err := decoded.UnmarshalBinary(data[:len(data)-len(m.Name)-1]); err == nil {
+		t.Error("expected an error for a truncated manifest")
+	}
+}
+
+func TestSend(t *testing.T) {
+	content := randomContent(1<<20 + 123)
+	// The receiver assembles blobs on its own goroutine
+	var assembled atomic.Pointer[[]byte]
+	receiver, err := NewReceiver(t.TempDir(), func(ctx context.Context, m *Manifest, path string) error {
+		if m.Name != "data.bin" {
+			t.Errorf("assembled blob named %q, want data.bin", m.Name)
+		}
+		data, err := os.ReadFile(path)
+		assembled.Store(&data)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("NewReceiver failed: %v", err)
+	}
+	var chunks atomic.Int32
+	sender := newSender(t, startReceiver(t, receiver, &chunks, nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	m, err := sender.Send(ctx, "data.bin", bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if got := loadBlob(&assembled); !bytes.Equal(got, content) {
+		t.Fatalf("assembled %d bytes, want the %d bytes sent", len(got), len(content))
+	}
+	if int(chunks.Load()) != m.Chunks() {
+		t.Errorf("sent %d chunks, want %d", chunks.Load(), m.Chunks())
+	}
+	if entries, _ := os.ReadDir(receiver.dir); len(entries) != 0 {
+		t.Errorf("%d state files left after the commit", len(entries))
+	}
+}
+
+func TestSendResumes(t *testing.T) {
+	content := randomContent(256 << 10)
+	dir := t.TempDir()
+	var assembled atomic.Int32
+	assemble := func(ctx context.Context, m *Manifest, path string) error {
+		data, err := os.ReadFile(path)
+		if err == nil && bytes.Equal(data, content) {
+			assembled.Add(1)
+		}
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The first transfer fails after 5 chunks, as if the sender crashed
+	receiver, err := NewReceiver(dir, assemble)
+	if err != nil {
+		t.Fatalf("NewReceiver failed: %v", err)
+	}
+	var chunks atomic.Int32
+	var calls atomic.Int32
+	addr := startReceiver(t, receiver, &chunks, func() bool { return calls.Add(1) > 5 })
+	sender := newSender(t, addr)
+	sender.Concurrency = 1
+	if _, err := sender.Send(ctx, "data.bin", bytes.NewReader(content), int64(len(content))); err == nil {
+		t.Fatal("expected the first transfer to fail")
+	}
+	if chunks.Load() != 5 {
+		t.Fatalf("received %d chunks before the failure, want 5", chunks.Load())
+	}
+
+	// A new sender resumes with the chunks still missing
+	calls.Store(-1 << 20)
+	sender = newSender(t, addr)
+	m, err := sender.Send(ctx, "data.bin", bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("resumed Send failed: %v", err)
+	}
+	if int(chunks.Load()) != m.Chunks() || assembled.Load() != 1 {
+		t.Errorf("received %d chunks in total and assembled %d blobs, want %d chunks and 1 blob", chunks.Load(), assembled.Load(), m.Chunks())
+	}
+}
+
+func TestReceiverRestartResumes(t *testing.T) {
+	content := randomContent(128 << 10)
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	receiver, err := NewReceiver(dir, nil)
+	if err != nil {
+		t.Fatalf("NewReceiver failed: %v", err)
+	}
+	var chunks atomic.Int32
+	sender := newSender(t, startReceiver(t, receiver, &chunks, func() bool { return chunks.Load() >= 3 }))
+	sender.Concurrency = 1
+	if _, err := sender.Send(ctx, "data.bin", bytes.NewReader(content), int64(len(content))); err == nil {
+		t.Fatal("expected the first transfer to fail")
+	}
+	receiver.Close()
+
+	// A new receiver on the same directory recovers the chunks written by the first one
+	var assembled atomic.Pointer[[]byte]
+	receiver, err = NewReceiver(dir, func(ctx context.Context, m *Manifest, path string) error {
+		data, err := os.ReadFile(path)
+		assembled.Store(&data)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("NewReceiver failed: %v", err)
+	}
+	var resumed atomic.Int32
+	sender = newSender(t, startReceiver(t, receiver, &resumed, nil))
+	m, err := sender.Send(ctx, "data.bin", bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("resumed Send failed: %v", err)
+	}
+	if int(resumed.Load()) != m.Chunks()-3 {
+		t.Errorf("resent %d chunks, want %d", resumed.Load(), m.Chunks()-3)
+	}
+	if got := loadBlob(&assembled); !bytes.Equal(got, content) {
+		t.Errorf("assembled %d bytes, want the %d bytes sent", len(got), len(content))
+	}
+}
@@ -0,0 +1,161 @@
+// Package blob transfers payloads of many megabytes over aRPC. A blob is split into chunks
+// of a fixed size, each sent and acknowledged as its own RPC, and described by a manifest
+// holding the SHA-256 of the content and the CRC-32C of every chunk. The receiver keeps the
+// chunks it got on disk, so a sender that restarts sends only the chunks still missing, and
+// hands the blob to an assembly callback once all of them arrived and the content matches.
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// ServiceName is the service the blob methods are registered under (see rpc.NameID)
+const ServiceName = "arpc.Blob"
+
+// Methods of the blob service
+const (
+	methodBegin  = "Begin"  // manifest -> bitmap of the chunks the receiver has
+	methodChunk  = "Chunk"  // [ID(32B)][index(4B)][data] -> empty
+	methodCommit = "Commit" // [ID(32B)] -> empty, once all chunks arrived
+)
+
+// DefaultChunkSize is the chunk size of senders that do not set one
+const DefaultChunkSize = 64 << 10
+
+// ErrIncomplete is returned by Commit for blobs whose chunks did not all arrive
+var ErrIncomplete = errors.New("blob is incomplete")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ID identifies a blob by the SHA-256 of its content, so that a restarted sender resumes the
+// transfer of the same content
+type ID [sha256.Size]byte
+
+// String returns the ID in hex
+func (id ID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// Manifest describes a blob and its chunks
+type Manifest struct {
+	ID        ID
+	Name      string // set by the sender, e.g. a file name
+	Size      int64
+	ChunkSize int
+	Checksums []uint32 // CRC-32C of each chunk
+}
+
+// NewManifest reads size bytes of r to describe them as a blob of chunkSize chunks
+func NewManifest(name string, r io.ReaderAt, size int64, chunkSize int) (*Manifest, error) {
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("invalid blob size %d", size)
+	}
+	m := &Manifest{Name: name, Size: size, ChunkSize: chunkSize}
+	content := sha256.New()
+	buf := make([]byte, chunkSize)
+	for index := range m.Chunks() {
+		chunk := buf[:m.chunkLen(index)]
+		if _, err := r.ReadAt(chunk, int64(index)*int64(chunkSize)); err != nil && !(err == io.EOF && len(chunk) > 0) {
+			return nil, fmt.Errorf("failed to read chunk %d: %w", index, err)
+		}
+		content.Write(chunk)
+		m.Checksums = append(m.Checksums, crc32.Checksum(chunk, castagnoli))
+	}
+	content.Sum(m.ID[:0])
+	return m, nil
+}
+
+// Chunks returns the number of chunks of the blob
+func (m *Manifest) Chunks() int {
+	return int((m.Size + int64(m.ChunkSize) - 1) / int64(m.ChunkSize))
+}
+
+// chunkLen returns the size of a chunk: ChunkSize, except for the last one
+func (m *Manifest) chunkLen(index int) int {
+	return int(min(int64(m.ChunkSize), m.Size-int64(index)*int64(m.ChunkSize)))
+}
+
+// equal reports whether two manifests describe the same chunks
+func (m *Manifest) equal(other *Manifest) bool {
+	if m.ID != other.ID || m.Size != other.Size || m.ChunkSize != other.ChunkSize || len(m.Checksums) != len(other.Checksums) {
+		return false
+	}
+	for i, checksum := range m.Checksums {
+		if other.Checksums[i] != checksum {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalBinary encodes the manifest (little endian):
+//
+//	[ID(32B)][size(8B)][chunkSize(4B)][chunks(4B)][checksum(4B)]*chunks[name]
+func (m *Manifest) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, len(m.ID)+16+4*len(m.Checksums)+len(m.Name))
+	buf = append(buf, m.ID[:]...)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Size))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.ChunkSize))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(m.Checksums)))
+	for _, checksum := range m.Checksums {
+		buf = binary.LittleEndian.AppendUint32(buf, checksum)
+	}
+	return append(buf, m.Name...), nil
+}
+
+// UnmarshalBinary decodes a manifest encoded by MarshalBinary
+func (m *Manifest) UnmarshalBinary(data []byte) error {
+	if len(data) < len(m.ID)+16 {
+		return fmt.Errorf("manifest of %d bytes is too short", len(data))
+	}
+	copy(m.ID[:], data)
+	data = data[len(m.ID):]
+	m.Size = int64(binary.LittleEndian.Uint64(data[0:8]))
+	m.ChunkSize = int(binary.LittleEndian.Uint32(data[8:12]))
+	chunks := int(binary.LittleEndian.Uint32(data[12:16]))
+	data = data[16:]
+	if m.Size < 0 || m.ChunkSize <= 0 || chunks != m.Chunks() || len(data) < 4*chunks {
+		return fmt.Errorf("invalid manifest: %d chunks of %d bytes for %d bytes", chunks, m.ChunkSize, m.Size)
+	}
+	m.Checksums = make([]uint32, chunks)
+	for i := range m.Checksums {
+		m.Checksums[i] = binary.LittleEndian.Uint32(data[4*i:])
+	}
+	m.Name = string(data[4*chunks:])
+	return nil
+}
+
+// bitmap is the set of chunks the receiver has, one bit per chunk
+type bitmap []byte
+
+func newBitmap(chunks int) bitmap {
+	return make(bitmap, (chunks+7)/8)
+}
+
+func (b bitmap) has(index int) bool {
+	return index/8 < len(b) && b[index/8]&(1<<(index%8)) != 0
+}
+
+func (b bitmap) set(index int) {
+	b[index/8] |= 1 << (index % 8)
+}
+
+// missing returns the chunks not in the set, out of chunks
+func (b bitmap) missing(chunks int) []int {
+	var indexes []int
+	for index := range chunks {
+		if !b.has(index) {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
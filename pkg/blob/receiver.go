@@ -0,0 +1,242 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/rpc"
+	"github.com/appnet-org/arpc/pkg/serializer"
+	"go.uber.org/zap"
+)
+
+// AssembleFunc is called once all chunks of a blob arrived and the content matches its ID.
+// path is the file holding the content; it is removed after AssembleFunc returns nil, unless
+// AssembleFunc moved it. A non-nil error fails the commit, which the sender may retry.
+type AssembleFunc func(ctx context.Context, m *Manifest, path string) error
+
+// Receiver is the server side of blob transfers. Chunks are written to <ID>.part files in a
+// directory as they arrive, next to the <ID>.manifest of the blob, so transfers interrupted by
+// a restart of either side resume where they stopped.
+type Receiver struct {
+	dir      string
+	assemble AssembleFunc
+
+	// MaxSize is the largest blob accepted, in bytes; 0 means no limit
+	MaxSize int64
+
+	mu        sync.Mutex
+	transfers map[ID]*transfer
+}
+
+// transfer is a blob being received
+type transfer struct {
+	mu       sync.Mutex
+	manifest *Manifest
+	file     *os.File
+	received bitmap
+}
+
+// NewReceiver creates a receiver keeping the chunks of blobs in dir and calling assemble for
+// every complete blob
+func NewReceiver(dir string, assemble AssembleFunc) (*Receiver, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &Receiver{dir: dir, assemble: assemble, transfers: make(map[ID]*transfer)}, nil
+}
+
+// Register registers the blob service with mux
+func (r *Receiver) Register(mux *rpc.Mux) {
+	rpc.HandleFunc(mux, ServiceName, methodBegin, r.begin, rpc.MethodOptions{Idempotent: true})
+	rpc.HandleFunc(mux, ServiceName, methodChunk, r.chunk, rpc.MethodOptions{Idempotent: true})
+	rpc.HandleFunc(mux, ServiceName, methodCommit, r.commit)
+}
+
+// Close closes the files of the blobs being received. Their chunks stay on disk for the
+// transfers to resume.
+func (r *Receiver) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for id, t := range r.transfers {
+		errs = append(errs, t.file.Close())
+		delete(r.transfers, id)
+	}
+	return errors.Join(errs...)
+}
+
+// path returns the path of a state file of a blob
+func (r *Receiver) path(id ID, ext string) string {
+	return filepath.Join(r.dir, id.String()+ext)
+}
+
+// begin starts or resumes the transfer of the blob of a manifest, returning the bitmap of the
+// chunks already received
+func (r *Receiver) begin(ctx context.Context, req *serializer.RawMessage) (*serializer.RawMessage, error) {
+	m := new(Manifest)
+	if err := m.UnmarshalBinary(*req); err != nil {
+		return nil, err
+	}
+	if r.MaxSize > 0 && m.Size > r.MaxSize {
+		return nil, fmt.Errorf("blob of %d bytes exceeds the limit of %d bytes", m.Size, r.MaxSize)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.transfers[m.ID]
+	if !ok {
+		var err error
+		if t, err = r.open(m); err != nil {
+			return nil, err
+		}
+		r.transfers[m.ID] = t
+	} else if !t.manifest.equal(m) {
+		return nil, fmt.Errorf("blob %s is being received with another manifest", m.ID)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	resp := serializer.RawMessage(bytes.Clone(t.received))
+	return &resp, nil
+}
+
+// open opens the state files of a blob, creating them for a new transfer. The chunks of an
+// interrupted transfer are recovered by checking them against the manifest.
+func (r *Receiver) open(m *Manifest) (*transfer, error) {
+	t := &transfer{manifest: m, received: newBitmap(m.Chunks())}
+	resumed := false
+	if data, err := os.ReadFile(r.path(m.ID, ".manifest")); err == nil {
+		stored := new(Manifest)
+		resumed = stored.UnmarshalBinary(data) == nil && stored.equal(m)
+	}
+	if !resumed {
+		data, err := m.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(r.path(m.ID, ".manifest"), data, 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write manifest: %w", err)
+		}
+	}
+
+	flags := os.O_RDWR | os.O_CREATE
+	if !resumed {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(r.path(m.ID, ".part"), flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blob file: %w", err)
+	}
+	t.file = file
+	if resumed {
+		buf := make([]byte, m.ChunkSize)
+		for index := range m.Chunks() {
+			chunk := buf[:m.chunkLen(index)]
+			if _, err := file.ReadAt(chunk, int64(index)*int64(m.ChunkSize)); err != nil {
+				continue
+			}
+			if crc32.Checksum(chunk, castagnoli) == m.Checksums[index] {
+				t.received.set(index)
+			}
+		}
+		logging.Debug("Resuming blob transfer", zap.String("id", m.ID.String()), zap.Int("missingChunks", len(t.received.missing(m.Chunks()))))
+	}
+	return t, nil
+}
+
+// lookup returns the transfer of a blob started by begin
+func (r *Receiver) lookup(id ID) (*transfer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.transfers[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown blob %s", id)
+	}
+	return t, nil
+}
+
+// chunk writes a chunk of a blob, encoded as [ID(32B)][index(4B)][data]
+func (r *Receiver) chunk(ctx context.Context, req *serializer.RawMessage) (*serializer.RawMessage, error) {
+	data := *req
+	var id ID
+	if len(data) < len(id)+4 {
+		return nil, fmt.Errorf("chunk of %d bytes is too short", len(data))
+	}
+	copy(id[:], data)
+	index := int(binary.LittleEndian.Uint32(data[len(id):]))
+	data = data[len(id)+4:]
+
+	t, err := r.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	m := t.manifest
+	if index >= m.Chunks() {
+		return nil, fmt.Errorf("chunk %d of blob %s out of range", index, id)
+	}
+	if len(data) != m.chunkLen(index) || crc32.Checksum(data, castagnoli) != m.Checksums[index] {
+		return nil, fmt.Errorf("chunk %d of blob %s does not match the manifest", index, id)
+	}
+	if _, err := t.file.WriteAt(data, int64(index)*int64(m.ChunkSize)); err != nil {
+		return nil, fmt.Errorf("failed to write chunk %d: %w", index, err)
+	}
+
+	t.mu.Lock()
+	t.received.set(index)
+	t.mu.Unlock()
+	return &serializer.RawMessage{}, nil
+}
+
+// commit hands a complete blob, named by its ID, to the assembly callback
+func (r *Receiver) commit(ctx context.Context, req *serializer.RawMessage) (*serializer.RawMessage, error) {
+	var id ID
+	if len(*req) != len(id) {
+		return nil, fmt.Errorf("invalid blob ID of %d bytes", len(*req))
+	}
+	copy(id[:], *req)
+	t, err := r.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commits of the same blob are serialized, so the callback sees each blob once
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m := t.manifest
+	if missing := t.received.missing(m.Chunks()); len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %d of %d chunks missing", ErrIncomplete, len(missing), m.Chunks())
+	}
+	content := sha256.New()
+	if _, err := io.Copy(content, io.NewSectionReader(t.file, 0, m.Size)); err != nil {
+		return nil, fmt.Errorf("failed to read blob: %w", err)
+	}
+	if !bytes.Equal(content.Sum(nil), id[:]) {
+		return nil, fmt.Errorf("content of blob %s does not match its ID", id)
+	}
+
+	if r.assemble != nil {
+		if err := r.assemble(ctx, m, r.path(id, ".part")); err != nil {
+			return nil, err
+		}
+	}
+	r.mu.Lock()
+	delete(r.transfers, id)
+	r.mu.Unlock()
+	t.file.Close()
+	for _, ext := range []string{".part", ".manifest"} {
+		if err := os.Remove(r.path(id, ext)); err != nil && !os.IsNotExist(err) {
+			logging.Warn("Failed to remove blob state", zap.String("id", id.String()), zap.Error(err))
+		}
+	}
+	return &serializer.RawMessage{}, nil
+}
@@ -0,0 +1,153 @@
+package blob
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/rpc"
+	"github.com/appnet-org/arpc/pkg/serializer"
+	"go.uber.org/zap"
+)
+
+// Sender is the client side of blob transfers
+type Sender struct {
+	client *rpc.Client
+
+	// ChunkSize is the size of the chunks of new blobs; DefaultChunkSize if 0
+	ChunkSize int
+	// Concurrency is the number of chunks in flight; 4 if 0
+	Concurrency int
+	// ChunkTimeout bounds each attempt to send a chunk; 5s if 0
+	ChunkTimeout time.Duration
+	// Attempts is the number of attempts to send a chunk before the transfer fails; 3 if 0
+	Attempts int
+}
+
+// NewSender creates a sender of blobs over client. It registers the blob service with the
+// service registry of the client.
+func NewSender(client *rpc.Client) *Sender {
+	client.ServiceRegistry().RegisterNamedService(ServiceName, methodBegin, methodChunk, methodCommit)
+	return &Sender{client: client}
+}
+
+// Send transfers size bytes of r as a blob named name, returning its manifest once the
+// receiver assembled it. Only the chunks the receiver does not have yet are sent, so calling
+// Send again with the same content, e.g. after a restart of the sender, resumes the transfer.
+func (s *Sender) Send(ctx context.Context, name string, r io.ReaderAt, size int64) (*Manifest, error) {
+	m, err := NewManifest(name, r, size, orDefault(s.ChunkSize, DefaultChunkSize))
+	if err != nil {
+		return nil, err
+	}
+	return m, s.SendManifest(ctx, m, r)
+}
+
+// SendManifest transfers the blob of m, whose content is read from r
+func (s *Sender) SendManifest(ctx context.Context, m *Manifest, r io.ReaderAt) error {
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	req := serializer.RawMessage(data)
+	var received serializer.RawMessage
+	if err := s.client.Call(ctx, ServiceName, methodBegin, &req, &received); err != nil {
+		return fmt.Errorf("failed to begin blob transfer: %w", err)
+	}
+
+	missing := bitmap(received).missing(m.Chunks())
+	logging.Debug("Sending blob",
+		zap.String("id", m.ID.String()),
+		zap.Int("chunks", m.Chunks()),
+		zap.Int("missingChunks", len(missing)))
+	if err := s.sendChunks(ctx, m, r, missing); err != nil {
+		return err
+	}
+
+	id := serializer.RawMessage(m.ID[:])
+	if err := s.client.Call(ctx, ServiceName, methodCommit, &id, &serializer.RawMessage{}); err != nil {
+		return fmt.Errorf("failed to commit blob: %w", err)
+	}
+	return nil
+}
+
+// sendChunks sends the chunks at indexes, Concurrency at a time
+func (s *Sender) sendChunks(ctx context.Context, m *Manifest, r io.ReaderAt, indexes []int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	work := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for range min(orDefault(s.Concurrency, 4), len(indexes)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, len(m.ID)+4+m.ChunkSize)
+			for index := range work {
+				if err := s.sendChunk(ctx, m, r, index, buf); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, index := range indexes {
+		select {
+		case work <- index:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// sendChunk sends a chunk, encoded into buf, retrying failed attempts
+func (s *Sender) sendChunk(ctx context.Context, m *Manifest, r io.ReaderAt, index int, buf []byte) error {
+	n := m.chunkLen(index)
+	req := serializer.RawMessage(buf[:len(m.ID)+4+n])
+	copy(req, m.ID[:])
+	binary.LittleEndian.PutUint32(req[len(m.ID):], uint32(index))
+	if _, err := r.ReadAt(req[len(m.ID)+4:], int64(index)*int64(m.ChunkSize)); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read chunk %d: %w", index, err)
+	}
+
+	var err error
+	for attempt := 1; attempt <= orDefault(s.Attempts, 3); attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, orDefault(s.ChunkTimeout, 5*time.Second))
+		err = s.client.Call(attemptCtx, ServiceName, methodChunk, &req, &serializer.RawMessage{})
+		cancel()
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		logging.Debug("Retrying blob chunk", zap.String("id", m.ID.String()), zap.Int("chunk", index), zap.Int("attempt", attempt), zap.Error(err))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to send chunk %d: %w", index, err)
+	}
+	return nil
+}
+
+// orDefault returns v, or def if v is zero
+func orDefault[T comparable](v, def T) T {
+	var zero T
+	if v == zero {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,84 @@
+package common
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultClockResolution is how often the default coarse clock is updated
+const DefaultClockResolution = time.Millisecond
+
+// CoarseClock caches the current time and updates it periodically, so that reading it costs
+// an atomic load instead of a clock read. Use it on hot paths that need timestamps for
+// timeouts or logs, not for measuring short durations.
+//
+// The times it returns carry a monotonic clock reading, so Sub and Since between them are
+// not affected by wall clock changes.
+type CoarseClock struct {
+	base    time.Time
+	elapsed atomic.Int64 // nanoseconds since base at the last update
+	ticker  *time.Ticker
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewCoarseClock creates a clock updated every resolution. Call Stop to release it.
+func NewCoarseClock(resolution time.Duration) *CoarseClock {
+	c := &CoarseClock{
+		base:   time.Now(),
+		ticker: time.NewTicker(resolution),
+		done:   make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+var (
+	defaultClock     *CoarseClock
+	defaultClockOnce sync.Once
+)
+
+// DefaultCoarseClock returns the shared clock updated every DefaultClockResolution,
+// starting it on first use
+func DefaultCoarseClock() *CoarseClock {
+	defaultClockOnce.Do(func() {
+		defaultClock = NewCoarseClock(DefaultClockResolution)
+	})
+	return defaultClock
+}
+
+// CoarseNow returns the time of the default coarse clock
+func CoarseNow() time.Time {
+	return DefaultCoarseClock().Now()
+}
+
+// Now returns the time of the last update, at most one resolution behind time.Now
+func (c *CoarseClock) Now() time.Time {
+	return c.base.Add(time.Duration(c.elapsed.Load()))
+}
+
+// NewTicker returns a ticker of the system clock. With Now it makes CoarseClock a
+// zapcore.Clock, which loggers use for entry timestamps.
+func (c *CoarseClock) NewTicker(d time.Duration) *time.Ticker {
+	return time.NewTicker(d)
+}
+
+// Stop stops updating the clock. Now keeps returning the last time.
+func (c *CoarseClock) Stop() {
+	c.once.Do(func() {
+		c.ticker.Stop()
+		close(c.done)
+	})
+}
+
+func (c *CoarseClock) run() {
+	for {
+		select {
+		case <-c.ticker.C:
+			c.elapsed.Store(int64(time.Since(c.base)))
+		case <-c.done:
+			return
+		}
+	}
+}
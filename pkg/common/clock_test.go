@@ -0,0 +1,56 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCoarseClock(t *testing.T) {
+	c := NewCoarseClock(time.Millisecond)
+	defer c.Stop()
+
+	start := c.Now()
+	if d := time.Since(start); d < 0 || d > 100*time.Millisecond {
+		t.Fatalf("Clock is %v off the system clock", d)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	now := c.Now()
+	if elapsed := now.Sub(start); elapsed < 10*time.Millisecond {
+		t.Errorf("Expected the clock to advance by about 20ms, got %v", elapsed)
+	}
+	if now.After(time.Now()) {
+		t.Error("Clock must not be ahead of the system clock")
+	}
+
+	c.Stop()
+	time.Sleep(5 * time.Millisecond) // let a pending update finish
+	stopped := c.Now()
+	time.Sleep(5 * time.Millisecond)
+	if !c.Now().Equal(stopped) {
+		t.Error("Stopped clock must not advance")
+	}
+}
+
+var benchTime time.Time
+
+func BenchmarkTimeNow(b *testing.B) {
+	b.RunParallel(func(pb *testing.PB) {
+		var now time.Time
+		for pb.Next() {
+			now = time.Now()
+		}
+		benchTime = now
+	})
+}
+
+func BenchmarkCoarseClockNow(b *testing.B) {
+	c := DefaultCoarseClock()
+	b.RunParallel(func(pb *testing.PB) {
+		var now time.Time
+		for pb.Next() {
+			now = c.Now()
+		}
+		benchTime = now
+	})
+}
@@ -117,6 +117,23 @@ type TransportSender interface {
 	GetConn() *net.UDPConn
 }
 
+// datagramWriter is implemented by transports writing serialized packets through their own
+// send path (see transport.UDPTransport.WriteDatagram), which counts them and lets tests
+// inject faults
+type datagramWriter interface {
+	WriteDatagram(data []byte, addr *net.UDPAddr, rpcID uint64) error
+}
+
+// writeDatagram writes a serialized packet through the transport, or directly to its socket
+// if the transport has no send path of its own
+func (h *ReliableHandler) writeDatagram(data []byte, addr *net.UDPAddr, rpcID uint64) error {
+	if w, ok := h.transport.(datagramWriter); ok {
+		return w.WriteDatagram(data, addr, rpcID)
+	}
+	_, err := h.transport.GetConn().WriteToUDP(data, addr)
+	return err
+}
+
 // TimerScheduler interface for managing timers
 type TimerScheduler interface {
 	Schedule(id transport.TimerKey, duration time.Duration, callback transport.TimerCallback)
@@ -196,7 +213,7 @@ func (h *ReliableHandler) sendACK(rpcID uint64, kind uint8, addr *net.UDPAddr) e
 
 	// Send ACK packet directly via UDP (bypass fragmentation)
 	// ACK packets are small control packets that should never be fragmented
-	_, err = h.transport.GetConn().WriteToUDP(ackData, addr)
+	err = h.writeDatagram(ackData, addr, rpcID)
 	if err != nil {
 		logging.Error("Failed to send ACK packet", zap.Error(err))
 		return err
@@ -325,8 +342,8 @@ func (h *ReliableHandler) checkRetransmission(connKey uint64, rpcID uint64, time
 			continue
 		}
 
-		// Send directly via UDP
-		_, err = udpConn.WriteToUDP(packetData, dstAddr)
+		// Send as is through the transport
+		err = h.writeDatagram(packetData, dstAddr, rpcID)
 		if err != nil {
 			logging.Error("Failed to send retransmitted packet",
 				zap.Uint64("rpcID", rpcID),
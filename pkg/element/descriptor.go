@@ -0,0 +1,146 @@
+package element
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// PayloadAccess is how much of the payload of messages an element reads or changes
+type PayloadAccess string
+
+const (
+	// PayloadNone is for elements using the headers of messages only: addresses, RPC IDs and
+	// metadata
+	PayloadNone PayloadAccess = "none"
+	// PayloadPublic is for elements decoding or changing the public segment, as every
+	// element of the shared interface does
+	PayloadPublic PayloadAccess = "public"
+	// PayloadFull is for elements handling the whole payload as received, the private
+	// segment included
+	PayloadFull PayloadAccess = "full"
+)
+
+// Types of element parameters, checked by Descriptor.CheckConfig
+const (
+	ParamString   = "string"
+	ParamInt      = "int"
+	ParamFloat    = "float"
+	ParamBool     = "bool"
+	ParamDuration = "duration" // time.ParseDuration syntax, e.g. "250ms"
+)
+
+// ConfigParam describes a parameter an element takes from the control plane of a proxy
+type ConfigParam struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Descriptor describes an element to the operators of a proxy: what it is, which parameters
+// it takes, and what it does to messages. Proxies list the descriptors of their elements
+// with their applied parameters, so the data plane of each node can be audited.
+type Descriptor struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+	// Payload is how much of the payload of messages the element reads or changes
+	Payload PayloadAccess `json:"payload"`
+	// Modifies tells whether the element changes messages: their payload or destination
+	Modifies bool          `json:"modifies"`
+	Config   []ConfigParam `json:"config,omitempty"`
+}
+
+// Describer is implemented by elements describing themselves (see Descriptor). Proxies may
+// be set to refuse elements without a valid descriptor.
+type Describer interface {
+	Describe() Descriptor
+}
+
+// Describe returns the descriptor of an element and true, or false for elements not
+// implementing Describer, whose descriptor only has the name of the element
+func Describe(e any) (Descriptor, bool) {
+	describer, ok := e.(Describer)
+	if !ok {
+		return Descriptor{Name: nameOf(e)}, false
+	}
+	return describer.Describe(), true
+}
+
+// Validate checks that the descriptor names the element, its version and payload access,
+// and that its parameters have distinct names, known types and defaults of their type
+func (d Descriptor) Validate() error {
+	if d.Name == "" {
+		return errors.New("descriptor has no name")
+	}
+	if d.Version == "" {
+		return fmt.Errorf("descriptor of %s has no version", d.Name)
+	}
+	switch d.Payload {
+	case PayloadNone, PayloadPublic, PayloadFull:
+	default:
+		return fmt.Errorf("descriptor of %s has invalid payload access %q", d.Name, d.Payload)
+	}
+	seen := make(map[string]bool, len(d.Config))
+	for _, param := range d.Config {
+		if param.Name == "" || seen[param.Name] {
+			return fmt.Errorf("descriptor of %s has an unnamed or duplicate parameter %q", d.Name, param.Name)
+		}
+		seen[param.Name] = true
+		if err := checkParam(param.Type, "0"); errors.Is(err, errUnknownParamType) {
+			return fmt.Errorf("parameter %s of %s: %w", param.Name, d.Name, err)
+		}
+		if param.Default != "" {
+			if err := checkParam(param.Type, param.Default); err != nil {
+				return fmt.Errorf("default of parameter %s of %s: %w", param.Name, d.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckConfig checks params against the parameters of the descriptor: required ones must be
+// set, and values must be of their type. Keys the descriptor does not declare are left to
+// the element, since the control plane passes its flags to every element.
+func (d Descriptor) CheckConfig(params map[string]string) error {
+	for _, param := range d.Config {
+		value, ok := params[param.Name]
+		if !ok {
+			if param.Required {
+				return fmt.Errorf("missing required parameter %s", param.Name)
+			}
+			continue
+		}
+		if err := checkParam(param.Type, value); err != nil {
+			return fmt.Errorf("parameter %s: %w", param.Name, err)
+		}
+	}
+	return nil
+}
+
+var errUnknownParamType = errors.New("unknown parameter type")
+
+// checkParam checks that value is of the parameter type typ
+func checkParam(typ, value string) error {
+	var err error
+	switch typ {
+	case ParamString:
+	case ParamInt:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case ParamFloat:
+		_, err = strconv.ParseFloat(value, 64)
+	case ParamBool:
+		_, err = strconv.ParseBool(value)
+	case ParamDuration:
+		_, err = time.ParseDuration(value)
+	default:
+		return fmt.Errorf("%w %q", errUnknownParamType, typ)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", typ, value)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package element
+
+import "testing"
+
+func TestDescriptor(t *testing.T) {
+	d, ok := Describe(NewEncryptionPolicy())
+	if !ok || d.Validate() != nil {
+		t.Fatalf("Expected EncryptionPolicy to describe itself, got %+v", d)
+	}
+	if d, ok := Describe("not an element"); ok || d.Name != "string" {
+		t.Errorf("Expected a name-only descriptor, got %+v", d)
+	}
+
+	d = Descriptor{Name: "RateLimit", Version: "v2", Payload: PayloadNone, Config: []ConfigParam{
+		{Name: "limit", Type: ParamInt, Required: true},
+		{Name: "window", Type: ParamDuration, Default: "1s"},
+	}}
+	if err := d.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	for _, tc := range []struct {
+		params map[string]string
+		err    string
+	}{
+		{map[string]string{"limit": "100", "tracing": "on"}, ""},
+		{map[string]string{"window": "1s"}, "missing required parameter limit"},
+		{map[string]string{"limit": "many"}, `parameter limit: invalid int "many"`},
+		{map[string]string{"limit": "1", "window": "1"}, `parameter window: invalid duration "1"`},
+	} {
+		err := d.CheckConfig(tc.params)
+		if tc.err == "" && err != nil || tc.err != "" && (err == nil || err.Error() != tc.err) {
+			t.Errorf("CheckConfig(%v): expected %q, got %v", tc.params, tc.err, err)
+		}
+	}
+
+	for _, invalid := range []Descriptor{
+		{Version: "v1", Payload: PayloadFull},
+		{Name: "ACL", Payload: PayloadFull},
+		{Name: "ACL", Version: "v1", Payload: "private"},
+		{Name: "ACL", Version: "v1", Payload: PayloadNone, Config: []ConfigParam{{Name: "a", Type: ParamBool}, {Name: "a", Type: ParamBool}}},
+		{Name: "ACL", Version: "v1", Payload: PayloadNone, Config: []ConfigParam{{Name: "a", Type: "list"}}},
+		{Name: "ACL", Version: "v1", Payload: PayloadNone, Config: []ConfigParam{{Name: "a", Type: ParamFloat, Default: "high"}}},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", invalid)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Package element defines the proxy element interface shared by all proxy variants.
+//
+// Each proxy has its own packet representation (the UDP proxies use their util.BufferedPacket),
+// so elements written against those types only work in one proxy. Elements implementing
+// Element operate on a Message instead and are adapted by every proxy.
+package element
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+)
+
+// Kind tells whether a message is a request or a response
+type Kind uint8
+
+const (
+	KindRequest  Kind = 1
+	KindResponse Kind = 2
+)
+
+// String returns the name of the kind
+func (k Kind) String() string {
+	switch k {
+	case KindRequest:
+		return "REQUEST"
+	case KindResponse:
+		return "RESPONSE"
+	}
+	return "UNKNOWN"
+}
+
+// Verdict tells the proxy what to do with a message after an element processed it
+type Verdict int
+
+const (
+	// VerdictPass forwards the message to the next element and then to its destination
+	VerdictPass Verdict = iota
+	// VerdictDrop drops the message; the proxy returns an error to the sender
+	VerdictDrop
+	// VerdictReply answers a request without forwarding it: the proxy returns the payload of
+	// the message to the client as the response of the server, e.g. a cached response or a
+	// maintenance message, and later elements do not see the request. The payload is a whole
+	// response in the Symphony wire format. Proxies hold no private key, so responses to
+	// encrypted calls must have an empty private segment. On responses it is VerdictPass.
+	VerdictReply
+)
+
+// String returns the name of the verdict
+func (v Verdict) String() string {
+	switch v {
+	case VerdictDrop:
+		return "drop"
+	case VerdictReply:
+		return "reply"
+	}
+	return "pass"
+}
+
+// Message is the protocol-independent view of an RPC message seen by an element
+type Message struct {
+	Kind  Kind
+	RPCID uint64
+	// Source is the address the message was received from, Destination the address it is
+	// forwarded to. Elements reroute a message by setting Destination.
+	Source      net.Addr
+	Destination net.Addr
+	// Metadata holds the headers of the message, if the protocol carries any
+	Metadata map[string]string
+	// Encrypted tells whether the message was encrypted on the wire, by default or because
+	// its call required it (see transport.EncryptionRequired)
+	Encrypted bool
+	// Payload is the public segment of the message (Symphony wire format). Elements may
+	// replace it; the private segment is never visible to elements.
+	Payload []byte
+}
+
+// ServiceID returns the service ID of a request's public segment, 0 if it is too short
+func (m *Message) ServiceID() uint32 {
+	if len(m.Payload) < 9 {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(m.Payload[5:9])
+}
+
+// MethodID returns the method ID of a request's public segment, 0 if it is too short
+func (m *Message) MethodID() uint32 {
+	if len(m.Payload) < 13 {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(m.Payload[9:13])
+}
+
+// Element processes the messages passing through a proxy. The returned context is passed to
+// the next element, so elements can hand values to later ones.
+type Element interface {
+	// ProcessRequest processes a request before it is forwarded to the server
+	ProcessRequest(ctx context.Context, msg *Message) (*Message, Verdict, context.Context, error)
+
+	// ProcessResponse processes a response before it is forwarded to the client
+	ProcessResponse(ctx context.Context, msg *Message) (*Message, Verdict, context.Context, error)
+
+	// Name returns the name of the element
+	Name() string
+}
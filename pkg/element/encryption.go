@@ -0,0 +1,55 @@
+package element
+
+import (
+	"context"
+	"fmt"
+)
+
+// EncryptionPolicy is an element rejecting the plaintext requests of services that must only
+// be called with encryption, e.g. payments in a mesh that does not encrypt by default. Clients
+// encrypt such calls with the transport.EncryptionRequired profile. It runs in proxies, as
+// the element of a plugin, and in clients (see rpc.WithProxyElements).
+type EncryptionPolicy struct {
+	services map[uint32]bool // nil: all services
+}
+
+// NewEncryptionPolicy creates a policy requiring encryption for the services of serviceIDs,
+// or for all services if none is given
+func NewEncryptionPolicy(serviceIDs ...uint32) *EncryptionPolicy {
+	p := &EncryptionPolicy{}
+	if len(serviceIDs) > 0 {
+		p.services = make(map[uint32]bool, len(serviceIDs))
+		for _, id := range serviceIDs {
+			p.services[id] = true
+		}
+	}
+	return p
+}
+
+// ProcessRequest rejects plaintext requests of the services of the policy
+func (p *EncryptionPolicy) ProcessRequest(ctx context.Context, msg *Message) (*Message, Verdict, context.Context, error) {
+	if msg.Encrypted || (p.services != nil && !p.services[msg.ServiceID()]) {
+		return msg, VerdictPass, ctx, nil
+	}
+	return msg, VerdictDrop, ctx, fmt.Errorf("service %d requires encryption", msg.ServiceID())
+}
+
+// ProcessResponse passes responses, whose encryption clients check themselves
+func (p *EncryptionPolicy) ProcessResponse(ctx context.Context, msg *Message) (*Message, Verdict, context.Context, error) {
+	return msg, VerdictPass, ctx, nil
+}
+
+// Name returns the name of the element
+func (p *EncryptionPolicy) Name() string {
+	return "EncryptionPolicy"
+}
+
+// Describe returns the descriptor of the element
+func (p *EncryptionPolicy) Describe() Descriptor {
+	return Descriptor{
+		Name:        p.Name(),
+		Version:     "v1",
+		Description: "Drops the plaintext requests of services requiring encryption",
+		Payload:     PayloadPublic,
+	}
+}
@@ -0,0 +1,38 @@
+package element
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+)
+
+func TestEncryptionPolicy(t *testing.T) {
+	request := func(serviceID uint32, encrypted bool) *Message {
+		payload := make([]byte, 13)
+		binary.LittleEndian.PutUint32(payload[5:9], serviceID)
+		return &Message{Kind: KindRequest, Payload: payload, Encrypted: encrypted}
+	}
+
+	policy := NewEncryptionPolicy(7)
+	for _, tc := range []struct {
+		serviceID uint32
+		encrypted bool
+		drop      bool
+	}{
+		{7, false, true},
+		{7, true, false},
+		{8, false, false},
+	} {
+		_, verdict, _, err := policy.ProcessRequest(context.Background(), request(tc.serviceID, tc.encrypted))
+		if dropped := verdict == VerdictDrop && err != nil; dropped != tc.drop {
+			t.Errorf("service %d, encrypted %v: expected drop %v, got %v (%v)", tc.serviceID, tc.encrypted, tc.drop, verdict, err)
+		}
+	}
+
+	if _, verdict, _, _ := NewEncryptionPolicy().ProcessRequest(context.Background(), request(8, false)); verdict != VerdictDrop {
+		t.Errorf("Expected a policy without services to apply to all of them")
+	}
+	if _, verdict, _, err := policy.ProcessResponse(context.Background(), &Message{Kind: KindResponse}); verdict != VerdictPass || err != nil {
+		t.Errorf("Expected responses to pass, got %v (%v)", verdict, err)
+	}
+}
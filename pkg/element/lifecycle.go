@@ -0,0 +1,78 @@
+package element
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultHookTimeout bounds the lifecycle hooks of elements: OnStart and OnShutdown get a
+// context canceled after it, and proxies wait this long at most for a retired chain to drain
+const DefaultHookTimeout = 30 * time.Second
+
+// StartHook is implemented by elements that set up what they need before processing
+// messages: open connections to Redis or policy servers, warm caches. Hosts call OnStart
+// before the element gets its first message, after OnConfigUpdate if a configuration was
+// pushed, and do not install an element whose OnStart fails; a proxy keeps its previous
+// chain.
+type StartHook interface {
+	OnStart(ctx context.Context) error
+}
+
+// ShutdownHook is implemented by elements that release what they hold when they are retired:
+// on shutdown of their host, or when a chain swap replaces them. Proxies call OnShutdown once
+// the element processes no message anymore, or the drain timed out.
+type ShutdownHook interface {
+	OnShutdown(ctx context.Context) error
+}
+
+// ConfigUpdateHook is implemented by elements taking parameters from the control plane of a
+// proxy. OnConfigUpdate receives the complete parameters of the element with each new
+// configuration; an error rejects the configuration, and the proxy keeps the last one every
+// element accepted.
+type ConfigUpdateHook interface {
+	OnConfigUpdate(params map[string]string) error
+}
+
+// Start calls OnStart on the elements implementing StartHook, in order. Elements may be of
+// any proxy interface. If one fails, those started before it are shut down in reverse order,
+// and its error is returned.
+func Start(ctx context.Context, elements ...any) error {
+	for i, e := range elements {
+		hook, ok := e.(StartHook)
+		if !ok {
+			continue
+		}
+		if err := hook.OnStart(ctx); err != nil {
+			err = fmt.Errorf("failed to start element %s: %w", nameOf(e), err)
+			return errors.Join(err, Shutdown(ctx, elements[:i]...))
+		}
+	}
+	return nil
+}
+
+// Shutdown calls OnShutdown on the elements implementing ShutdownHook, in reverse order, so
+// that elements are shut down after those relying on them. Every element is shut down, and
+// the errors are returned together.
+func Shutdown(ctx context.Context, elements ...any) error {
+	var errs []error
+	for i := len(elements) - 1; i >= 0; i-- {
+		hook, ok := elements[i].(ShutdownHook)
+		if !ok {
+			continue
+		}
+		if err := hook.OnShutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to shut down element %s: %w", nameOf(elements[i]), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// nameOf returns the name of an element, or its type without a Name method
+func nameOf(e any) string {
+	if named, ok := e.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", e)
+}
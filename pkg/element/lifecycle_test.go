@@ -0,0 +1,56 @@
+package element
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// hookElement records its lifecycle calls in a shared log
+type hookElement struct {
+	name     string
+	log      *[]string
+	startErr error
+}
+
+func (e *hookElement) OnStart(ctx context.Context) error {
+	*e.log = append(*e.log, "start "+e.name)
+	return e.startErr
+}
+
+func (e *hookElement) OnShutdown(ctx context.Context) error {
+	*e.log = append(*e.log, "shutdown "+e.name)
+	return nil
+}
+
+func (e *hookElement) Name() string {
+	return e.name
+}
+
+func TestStartAndShutdown(t *testing.T) {
+	var log []string
+	a, b := &hookElement{name: "a", log: &log}, &hookElement{name: "b", log: &log}
+	if err := Start(context.Background(), a, "not an element", b); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := Shutdown(context.Background(), a, "not an element", b); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if want := []string{"start a", "start b", "shutdown b", "shutdown a"}; !slices.Equal(log, want) {
+		t.Errorf("Expected %v, got %v", want, log)
+	}
+}
+
+func TestStart_RollsBack(t *testing.T) {
+	var log []string
+	failure := errors.New("redis unreachable")
+	a, b, c := &hookElement{name: "a", log: &log}, &hookElement{name: "b", log: &log, startErr: failure}, &hookElement{name: "c", log: &log}
+	err := Start(context.Background(), a, b, c)
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected the error of b, got %v", err)
+	}
+	if want := []string{"start a", "start b", "shutdown a"}; !slices.Equal(log, want) {
+		t.Errorf("Expected the elements started before b shut down, got %v", log)
+	}
+}
@@ -0,0 +1,158 @@
+package element
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SignatureSuffix is appended to the path of a plugin module to give the path of its
+// detached signature. Proxies do not load files with this suffix as plugins.
+const SignatureSuffix = ".sig"
+
+// ModuleVerifier decides whether a plugin module may be loaded by a proxy
+type ModuleVerifier interface {
+	// Verify returns an error if the module read from path must not be loaded
+	Verify(path string, module []byte) error
+}
+
+// SignatureVerifier accepts the plugin modules signed by one of its Ed25519 keys. The
+// signature of a module is in the file of its path plus SignatureSuffix, raw or
+// base64-encoded, as made by e.g.
+//
+//	openssl pkeyutl -sign -inkey key.pem -rawin -in element-acl.so -out element-acl.so.sig
+type SignatureVerifier struct {
+	keys []ed25519.PublicKey
+}
+
+// NewSignatureVerifier creates a verifier accepting modules signed by one of keys
+func NewSignatureVerifier(keys ...ed25519.PublicKey) *SignatureVerifier {
+	return &SignatureVerifier{keys: keys}
+}
+
+// LoadSignatureVerifier creates a verifier accepting modules signed by one of the public
+// keys in files, each a PEM "PUBLIC KEY" block (openssl pkey -pubout) or a base64-encoded
+// 32 byte key
+func LoadSignatureVerifier(files []string) (*SignatureVerifier, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no public key files")
+	}
+	keys := make([]ed25519.PublicKey, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParsePublicKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		keys = append(keys, key)
+	}
+	return NewSignatureVerifier(keys...), nil
+}
+
+// ParsePublicKey parses an Ed25519 public key in a PEM "PUBLIC KEY" block, or base64-encoded
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "PUBLIC KEY" {
+			return nil, fmt.Errorf("unexpected PEM block %q, want PUBLIC KEY", block.Type)
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		ed, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("unexpected %T public key, want Ed25519", key)
+		}
+		return ed, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key of %d bytes, want %d", len(key), ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// Verify checks the detached signature of the module read from path
+func (v *SignatureVerifier) Verify(path string, module []byte) error {
+	data, err := os.ReadFile(path + SignatureSuffix)
+	if err != nil {
+		return fmt.Errorf("no signature: %w", err)
+	}
+	signature := data
+	if len(signature) != ed25519.SignatureSize {
+		signature, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(signature) != ed25519.SignatureSize {
+			return fmt.Errorf("invalid signature in %s", path+SignatureSuffix)
+		}
+	}
+	for _, key := range v.keys {
+		if ed25519.Verify(key, module, signature) {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature is not valid for any of the %d public keys", len(v.keys))
+}
+
+// Module is a plugin module read by ReadModule
+type Module struct {
+	Path string
+	// Digest is the SHA-256 of the module, as sha256:<hex>, identifying the build that was
+	// loaded in logs and metrics
+	Digest string
+	// Verified tells whether a verifier accepted the module
+	Verified bool
+	data     []byte
+}
+
+// ReadModule reads the plugin module at path and checks it with verifier, unless nil. The
+// module is returned with the error of the verifier, so that rejected builds can be logged
+// by digest too.
+func ReadModule(path string, verifier ModuleVerifier) (*Module, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	module := &Module{Path: path, Digest: "sha256:" + hex.EncodeToString(sum[:]), data: data}
+	if verifier != nil {
+		if err := verifier.Verify(path, data); err != nil {
+			return module, err
+		}
+		module.Verified = true
+	}
+	return module, nil
+}
+
+// LoadPath returns the file to load the module from, and a function removing it once the
+// module is loaded. Unverified modules are loaded from Path. Verified modules are copied to
+// a private file, so that the code loaded is the code that was verified even if Path is
+// replaced in between.
+func (m *Module) LoadPath() (string, func(), error) {
+	if !m.Verified {
+		return m.Path, func() {}, nil
+	}
+	dir, err := os.MkdirTemp("", "arpc-plugin-")
+	if err != nil {
+		return "", nil, err
+	}
+	path := filepath.Join(dir, filepath.Base(m.Path))
+	if err := os.WriteFile(path, m.data, 0o500); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	return path, func() { os.RemoveAll(dir) }, nil
+}
@@ -18,6 +18,20 @@ var (
 type Config struct {
 	Level  string `json:"level" yaml:"level"`   // debug, info, warn, error
 	Format string `json:"format" yaml:"format"` // json, console
+
+	// RedactFields lists field keys whose values are replaced with RedactedValue
+	RedactFields []string `json:"redact_fields" yaml:"redact_fields"`
+
+	// PayloadPreviewBytes caps the hex preview of Payload fields (0 gives
+	// DefaultPayloadPreviewBytes, a negative value logs no preview)
+	PayloadPreviewBytes int `json:"payload_preview_bytes" yaml:"payload_preview_bytes"`
+	// PayloadSampleRate shows the preview of 1 in this many Payload fields, the others are
+	// logged with their size and hash only (0 or 1 shows every preview)
+	PayloadSampleRate int `json:"payload_sample_rate" yaml:"payload_sample_rate"`
+
+	// Clock timestamps the entries (nil for the system clock). Hot paths logging a lot can
+	// pass a common.CoarseClock, which is cheaper to read.
+	Clock zapcore.Clock `json:"-" yaml:"-"`
 }
 
 // DefaultConfig returns the default logging configuration
@@ -40,15 +54,22 @@ func Init(config *Config) error {
 
 // GetLogger returns the global logger instance
 func GetLogger() *zap.Logger {
-	if globalLogger == nil {
-		// Initialize with default config if not already initialized
-		_ = Init(DefaultConfig())
-	}
+	// Initialize with default config if not already initialized. The check goes through
+	// once, so that goroutines logging for the first time at once do not race on the logger.
+	once.Do(initDefault)
 	return globalLogger
 }
 
+// initDefault initializes the global logger with the default configuration
+func initDefault() {
+	globalConfig = DefaultConfig()
+	globalLogger, _ = newLogger(globalConfig)
+}
+
 // newLogger creates a new zap logger with the given configuration
 func newLogger(config *Config) (*zap.Logger, error) {
+	setPayloadConfig(config)
+
 	// Parse log level
 	level, err := zapcore.ParseLevel(config.Level)
 	if err != nil {
@@ -73,10 +94,17 @@ func newLogger(config *Config) (*zap.Logger, error) {
 	}
 
 	// Create core
-	core := zapcore.NewCore(encoder, zapcore.AddSync(os.Stdout), level)
+	var core zapcore.Core = zapcore.NewCore(encoder, zapcore.AddSync(os.Stdout), level)
+	if len(config.RedactFields) > 0 {
+		core = newRedactingCore(core, config.RedactFields)
+	}
 
 	// Create logger with caller skip to skip the wrapper functions
-	logger := zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1), zap.AddStacktrace(zapcore.ErrorLevel))
+	options := []zap.Option{zap.AddCaller(), zap.AddCallerSkip(1), zap.AddStacktrace(zapcore.ErrorLevel)}
+	if config.Clock != nil {
+		options = append(options, zap.WithClock(config.Clock))
+	}
+	logger := zap.New(core, options...)
 
 	return logger, nil
 }
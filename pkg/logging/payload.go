@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultPayloadPreviewBytes is the number of bytes of a payload shown by Payload fields when
+// Config.PayloadPreviewBytes is 0
+const DefaultPayloadPreviewBytes = 64
+
+var (
+	payloadPreviewBytes atomic.Int64
+	payloadSampleRate   atomic.Int64
+	payloadCount        atomic.Uint64 // payloads logged, for sampling
+)
+
+// setPayloadConfig applies the payload settings of config. They are read by the encoding
+// of Payload fields, which may run on any goroutine, so they are kept in atomics.
+func setPayloadConfig(config *Config) {
+	payloadPreviewBytes.Store(int64(config.PayloadPreviewBytes))
+	payloadSampleRate.Store(int64(config.PayloadSampleRate))
+}
+
+// Payload returns a field describing a binary payload by its size and a hash of its content
+// (the first 8 bytes of its SHA-256), instead of dumping it, plus a hex preview of its first
+// bytes (see Config.PayloadPreviewBytes and Config.PayloadSampleRate). The hash and preview
+// are only computed if the entry is written, so large payloads are cheap to pass at disabled
+// levels. The payload must not be modified until the log call returns.
+func Payload(key string, payload []byte) zap.Field {
+	return zap.Object(key, payloadField(payload))
+}
+
+// payloadField is the zapcore.ObjectMarshaler of Payload fields
+type payloadField []byte
+
+// MarshalLogObject encodes the size, hash and preview of the payload
+func (p payloadField) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt("size", len(p))
+	sum := sha256.Sum256(p)
+	enc.AddString("sha256", hex.EncodeToString(sum[:8]))
+
+	preview := payloadPreviewBytes.Load()
+	if preview < 0 {
+		return nil
+	}
+	if preview == 0 {
+		preview = DefaultPayloadPreviewBytes
+	}
+	if rate := payloadSampleRate.Load(); rate > 1 && payloadCount.Add(1)%uint64(rate) != 1 {
+		return nil
+	}
+	n := min(int64(len(p)), preview)
+	enc.AddString("preview", hex.EncodeToString(p[:n]))
+	if n < int64(len(p)) {
+		enc.AddBool("truncated", true)
+	}
+	return nil
+}
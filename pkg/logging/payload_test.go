@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestPayload(t *testing.T) {
+	defer setPayloadConfig(DefaultConfig())
+	observed, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(observed)
+	payload := bytes.Repeat([]byte{0xab}, 500000)
+
+	setPayloadConfig(&Config{PayloadPreviewBytes: 4})
+	logger.Debug("frame", Payload("payload", payload), Payload("short", []byte{1, 2}))
+	fields := logs.TakeAll()[0].ContextMap()
+	got := fields["payload"].(map[string]any)
+	if got["size"] != 500000 || got["preview"] != "abababab" || got["truncated"] != true {
+		t.Errorf("Unexpected payload field %v", got)
+	}
+	if sum, _ := got["sha256"].(string); len(sum) != 16 {
+		t.Errorf("Expected a 16 digit hash, got %q", sum)
+	}
+	if short := fields["short"].(map[string]any); short["preview"] != "0102" || short["truncated"] != nil {
+		t.Errorf("Unexpected short payload field %v", short)
+	}
+
+	// With sampling, 1 in 3 payloads has a preview
+	setPayloadConfig(&Config{PayloadSampleRate: 3})
+	previews := 0
+	for range 9 {
+		logger.Debug("frame", Payload("payload", payload))
+		if _, ok := logs.TakeAll()[0].ContextMap()["payload"].(map[string]any)["preview"]; ok {
+			previews++
+		}
+	}
+	if previews != 3 {
+		t.Errorf("Expected 3 previews, got %d", previews)
+	}
+
+	// A negative preview size disables previews
+	setPayloadConfig(&Config{PayloadPreviewBytes: -1})
+	logger.Debug("frame", Payload("payload", payload))
+	if got := logs.TakeAll()[0].ContextMap()["payload"].(map[string]any); got["preview"] != nil || got["size"] != 500000 {
+		t.Errorf("Unexpected payload field %v", got)
+	}
+}
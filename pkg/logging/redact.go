@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RedactedValue replaces the value of redacted fields
+const RedactedValue = "[REDACTED]"
+
+// redactingCore wraps a core and replaces the value of every field whose key is on the
+// deny-list, so sensitive values never reach the log output regardless of the call site
+type redactingCore struct {
+	zapcore.Core
+	denied map[string]struct{}
+}
+
+// newRedactingCore wraps core with a deny-list of field keys
+func newRedactingCore(core zapcore.Core, keys []string) zapcore.Core {
+	denied := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		denied[key] = struct{}{}
+	}
+	return &redactingCore{Core: core, denied: denied}
+}
+
+// With redacts the fields added to the child core
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.redact(fields)), denied: c.denied}
+}
+
+// Check adds this core, rather than the wrapped one, so Write sees the fields first
+func (c *redactingCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+// Write redacts the fields of the entry before writing it
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, c.redact(fields))
+}
+
+// redact returns fields with denied values replaced. The input slice is not modified.
+func (c *redactingCore) redact(fields []zapcore.Field) []zapcore.Field {
+	var redacted []zapcore.Field
+	for i, field := range fields {
+		if _, ok := c.denied[field.Key]; !ok {
+			continue
+		}
+		if redacted == nil {
+			redacted = append([]zapcore.Field(nil), fields...)
+		}
+		redacted[i] = zap.String(field.Key, RedactedValue)
+	}
+	if redacted == nil {
+		return fields
+	}
+	return redacted
+}
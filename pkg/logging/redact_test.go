@@ -0,0 +1,33 @@
+package logging
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRedactingCore(t *testing.T) {
+	observed, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(newRedactingCore(observed, []string{"cardNumber", "token"}))
+
+	logger.With(zap.String("token", "secret")).Info("payment",
+		zap.String("cardNumber", "4111111111111111"),
+		zap.String("merchant", "acme"))
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["cardNumber"] != RedactedValue {
+		t.Errorf("Expected cardNumber to be redacted, got %v", fields["cardNumber"])
+	}
+	if fields["token"] != RedactedValue {
+		t.Errorf("Expected token to be redacted, got %v", fields["token"])
+	}
+	if fields["merchant"] != "acme" {
+		t.Errorf("Expected merchant to be kept, got %v", fields["merchant"])
+	}
+}
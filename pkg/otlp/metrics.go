@@ -0,0 +1,281 @@
+package otlp
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// metricKind is the OTLP data type a Prometheus family is exported as
+type metricKind int
+
+const (
+	kindGauge metricKind = iota
+	kindCounter
+	kindHistogram
+	kindIgnored // summaries, which OTLP only keeps for compatibility
+)
+
+// metric is a metric family read from the Prometheus text exposition format
+type metric struct {
+	name   string
+	help   string
+	kind   metricKind
+	points []*point
+	byKey  map[string]*point // histogram points by labels, without le
+}
+
+// point is a data point of a metric: a value, or the buckets of a histogram
+type point struct {
+	attributes []Attribute
+	value      float64
+	bounds     []float64 // upper bounds of the histogram buckets, without +Inf
+	cumulative []uint64  // cumulative counts of the buckets
+	count      uint64
+	sum        float64
+}
+
+// parsePrometheus reads the metric families of a Prometheus text exposition. Counters are
+// exported as cumulative sums, gauges and untyped samples as gauges, and histograms as
+// explicit bucket histograms; summaries are ignored.
+func parsePrometheus(text []byte) []*metric {
+	var metrics []*metric
+	families := make(map[string]*metric)
+	family := func(name string, kind metricKind) *metric {
+		m := families[name]
+		if m == nil {
+			m = &metric{name: name, kind: kind, byKey: make(map[string]*point)}
+			families[name] = m
+			metrics = append(metrics, m)
+		}
+		return m
+	}
+
+	for _, line := range strings.Split(string(text), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.SplitN(line, " ", 4)
+			if len(fields) < 4 {
+				continue
+			}
+			switch fields[1] {
+			case "HELP":
+				family(fields[2], kindGauge).help = fields[3]
+			case "TYPE":
+				m := family(fields[2], kindGauge)
+				switch fields[3] {
+				case "counter":
+					m.kind = kindCounter
+				case "histogram":
+					m.kind = kindHistogram
+				case "summary":
+					m.kind = kindIgnored
+				}
+			}
+			continue
+		}
+
+		name, attributes, value, ok := parseSample(line)
+		if !ok {
+			continue
+		}
+		if m := families[name]; m != nil && m.kind != kindHistogram {
+			if m.kind != kindIgnored {
+				m.points = append(m.points, &point{attributes: attributes, value: value})
+			}
+			continue
+		}
+		base, suffix := name, ""
+		if i := strings.LastIndexByte(name, '_'); i > 0 {
+			base, suffix = name[:i], name[i+1:]
+		}
+		m := families[base]
+		if m == nil || (m.kind != kindHistogram && m.kind != kindIgnored) {
+			// An untyped sample
+			m = family(name, kindGauge)
+			m.points = append(m.points, &point{attributes: attributes, value: value})
+			continue
+		}
+		if m.kind == kindIgnored {
+			continue
+		}
+
+		// Samples of a histogram: the buckets (without le, by their labels), the sum and the count
+		var le string
+		key, kept := histogramKey(attributes, &le)
+		p := m.byKey[key]
+		if p == nil {
+			p = &point{attributes: kept}
+			m.byKey[key] = p
+			m.points = append(m.points, p)
+		}
+		switch suffix {
+		case "bucket":
+			if bound, err := strconv.ParseFloat(le, 64); err == nil && !math.IsInf(bound, 1) {
+				p.bounds = append(p.bounds, bound)
+				p.cumulative = append(p.cumulative, uint64(value))
+			}
+		case "sum":
+			p.sum = value
+		case "count":
+			p.count = uint64(value)
+		}
+	}
+	return metrics
+}
+
+// histogramKey returns the labels of a histogram sample without le, and a key identifying
+// them; le is set to the value of the le label
+func histogramKey(attributes []Attribute, le *string) (string, []Attribute) {
+	var key strings.Builder
+	kept := make([]Attribute, 0, len(attributes))
+	for _, attr := range attributes {
+		if attr.Key == "le" {
+			*le = attr.Value.(string)
+			continue
+		}
+		kept = append(kept, attr)
+		key.WriteString(attr.Key)
+		key.WriteByte('=')
+		key.WriteString(attr.Value.(string))
+		key.WriteByte(0xff)
+	}
+	return key.String(), kept
+}
+
+// parseSample parses a sample line, `name{label="value",...} value [timestamp]`
+func parseSample(line string) (string, []Attribute, float64, bool) {
+	end := strings.IndexAny(line, "{ ")
+	if end <= 0 {
+		return "", nil, 0, false
+	}
+	name, rest := line[:end], line[end:]
+
+	var attributes []Attribute
+	if rest[0] == '{' {
+		rest = rest[1:]
+		for {
+			rest = strings.TrimLeft(rest, " ,")
+			if strings.HasPrefix(rest, "}") {
+				rest = rest[1:]
+				break
+			}
+			eq := strings.IndexByte(rest, '=')
+			if eq <= 0 || len(rest) < eq+2 || rest[eq+1] != '"' {
+				return "", nil, 0, false
+			}
+			key := strings.TrimSpace(rest[:eq])
+			rest = rest[eq+1:]
+
+			// Find the closing quote, skipping escaped characters
+			i := 1
+			for i < len(rest) && rest[i] != '"' {
+				if rest[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(rest) {
+				return "", nil, 0, false
+			}
+			value, err := strconv.Unquote(rest[:i+1])
+			if err != nil {
+				return "", nil, 0, false
+			}
+			attributes = append(attributes, Attribute{Key: key, Value: value})
+			rest = rest[i+1:]
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", nil, 0, false
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", nil, 0, false
+	}
+	return name, attributes, value, true
+}
+
+// encodeMetrics encodes an ExportMetricsServiceRequest of metrics read at now. Counters and
+// histograms are cumulative since the exporter started.
+func (e *Exporter) encodeMetrics(metrics []*metric, now time.Time) []byte {
+	start, end := uint64(e.start.UnixNano()), uint64(now.UnixNano())
+	return appendMessage(nil, 1, func(b []byte) []byte { // ResourceMetrics
+		b = appendBytes(b, 1, e.resource)
+		return appendMessage(b, 2, func(b []byte) []byte { // ScopeMetrics
+			b = appendMessage(b, 1, appendScope)
+			for _, m := range metrics {
+				if m.kind == kindIgnored || len(m.points) == 0 {
+					continue
+				}
+				b = appendMessage(b, 2, func(b []byte) []byte {
+					return m.append(b, start, end)
+				})
+			}
+			return b
+		})
+	})
+}
+
+// append appends the Metric encoding of the family
+func (m *metric) append(b []byte, start, end uint64) []byte {
+	b = appendString(b, 1, m.name)
+	b = appendString(b, 2, m.help)
+
+	numberPoints := func(b []byte) []byte {
+		for _, p := range m.points {
+			b = appendMessage(b, 1, func(b []byte) []byte { // NumberDataPoint
+				b = appendFixed64(b, 2, start)
+				b = appendFixed64(b, 3, end)
+				b = appendDouble(b, 4, p.value)
+				return appendAttributes(b, 7, p.attributes)
+			})
+		}
+		return b
+	}
+
+	switch m.kind {
+	case kindGauge:
+		return appendMessage(b, 5, numberPoints)
+	case kindCounter:
+		return appendMessage(b, 7, func(b []byte) []byte { // Sum
+			b = numberPoints(b)
+			b = appendVarint(b, 2, 2) // AGGREGATION_TEMPORALITY_CUMULATIVE
+			return appendVarint(b, 3, 1)
+		})
+	}
+	return appendMessage(b, 9, func(b []byte) []byte { // Histogram
+		for _, p := range m.points {
+			b = appendMessage(b, 1, func(b []byte) []byte { // HistogramDataPoint
+				b = appendFixed64(b, 2, start)
+				b = appendFixed64(b, 3, end)
+				b = appendFixed64(b, 4, p.count)
+				b = appendDouble(b, 5, p.sum)
+
+				// OTLP counts each bucket separately, the last one up to +Inf
+				var counts, bounds []byte
+				previous := uint64(0)
+				for i, cumulative := range p.cumulative {
+					counts = protowire.AppendFixed64(counts, cumulative-min(previous, cumulative))
+					bounds = protowire.AppendFixed64(bounds, math.Float64bits(p.bounds[i]))
+					previous = cumulative
+				}
+				counts = protowire.AppendFixed64(counts, p.count-min(previous, p.count))
+				b = appendBytes(b, 6, counts)
+				if len(bounds) > 0 {
+					b = appendBytes(b, 7, bounds)
+				}
+				return appendAttributes(b, 9, p.attributes)
+			})
+		}
+		return appendVarint(b, 2, 2) // AGGREGATION_TEMPORALITY_CUMULATIVE
+	})
+}
@@ -0,0 +1,310 @@
+// Package otlp exports aRPC telemetry to OpenTelemetry collectors with OTLP, over gRPC or
+// HTTP with the protobuf encoding, without depending on the OpenTelemetry SDK. Metrics are
+// read from the same writers as the Prometheus endpoints and pushed at a fixed interval; spans
+// are queued and pushed in batches.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/rpc/stats"
+	"go.uber.org/zap"
+)
+
+// Protocol is the transport of the OTLP requests
+type Protocol string
+
+const (
+	// ProtocolGRPC calls the Export methods of the collector services. Endpoints without a
+	// scheme or with http:// use HTTP/2 without TLS (h2c), https:// endpoints use TLS.
+	ProtocolGRPC Protocol = "grpc"
+	// ProtocolHTTP posts protobuf requests to the /v1/metrics and /v1/traces paths of the endpoint
+	ProtocolHTTP Protocol = "http/protobuf"
+)
+
+// Defaults of the exporter configuration
+const (
+	DefaultInterval  = 10 * time.Second
+	DefaultBatchSize = 512
+	DefaultQueueSize = 2048
+	DefaultTimeout   = 10 * time.Second
+)
+
+// Config configures an Exporter
+type Config struct {
+	// Endpoint is the address of the collector, e.g. "http://otel-collector:4318", or
+	// "otel-collector:4317" with ProtocolGRPC
+	Endpoint string
+	// Protocol is ProtocolHTTP if empty
+	Protocol Protocol
+	// Headers are added to every request, e.g. for authentication
+	Headers map[string]string
+	// Interval is the time between exports of the metrics, and of spans not filling a batch;
+	// DefaultInterval if 0
+	Interval time.Duration
+	// BatchSize is the number of spans exported at once; DefaultBatchSize if 0
+	BatchSize int
+	// QueueSize is the number of spans queued for export before new ones are dropped;
+	// DefaultQueueSize if 0
+	QueueSize int
+	// Timeout bounds each export request; DefaultTimeout if 0
+	Timeout time.Duration
+	// Resource holds the attributes identifying the process, e.g. service.name, k8s.pod.name
+	Resource map[string]string
+}
+
+// ConfigFromEnv reads the exporter configuration from the standard OpenTelemetry variables
+// (OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_EXPORTER_OTLP_PROTOCOL, OTEL_EXPORTER_OTLP_HEADERS,
+// OTEL_EXPORTER_OTLP_TIMEOUT, OTEL_METRIC_EXPORT_INTERVAL, OTEL_BSP_MAX_EXPORT_BATCH_SIZE,
+// OTEL_BSP_MAX_QUEUE_SIZE, OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES). The resource also
+// gets arpc.role, and the pod, namespace and node from the POD_NAME, POD_NAMESPACE and
+// NODE_NAME variables set by the Kubernetes downward API. It returns nil if no endpoint is set.
+func ConfigFromEnv(role string) (*Config, error) {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	if endpoint == "" {
+		return nil, nil
+	}
+	config := &Config{
+		Endpoint: endpoint,
+		Protocol: Protocol(os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")),
+		Headers:  parsePairs(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		Resource: parsePairs(os.Getenv("OTEL_RESOURCE_ATTRIBUTES")),
+	}
+	switch config.Protocol {
+	case "", ProtocolGRPC, ProtocolHTTP:
+	default:
+		return nil, fmt.Errorf("unsupported OTEL_EXPORTER_OTLP_PROTOCOL %q (want grpc or http/protobuf)", config.Protocol)
+	}
+
+	// Durations are in milliseconds, counts are plain integers
+	for _, v := range []struct {
+		name string
+		set  func(int)
+	}{
+		{"OTEL_EXPORTER_OTLP_TIMEOUT", func(n int) { config.Timeout = time.Duration(n) * time.Millisecond }},
+		{"OTEL_METRIC_EXPORT_INTERVAL", func(n int) { config.Interval = time.Duration(n) * time.Millisecond }},
+		{"OTEL_BSP_MAX_EXPORT_BATCH_SIZE", func(n int) { config.BatchSize = n }},
+		{"OTEL_BSP_MAX_QUEUE_SIZE", func(n int) { config.QueueSize = n }},
+	} {
+		value := os.Getenv(v.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", v.name, value)
+		}
+		v.set(n)
+	}
+
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		config.Resource["service.name"] = name
+	}
+	if _, ok := config.Resource["service.name"]; !ok {
+		config.Resource["service.name"] = "arpc-" + role
+	}
+	config.Resource["arpc.role"] = role
+	for variable, key := range map[string]string{
+		"POD_NAME":      "k8s.pod.name",
+		"POD_NAMESPACE": "k8s.namespace.name",
+		"NODE_NAME":     "k8s.node.name",
+	} {
+		if value := os.Getenv(variable); value != "" {
+			config.Resource[key] = value
+		}
+	}
+	return config, nil
+}
+
+// parsePairs parses a comma-separated list of key=value pairs, ignoring malformed entries
+func parsePairs(s string) map[string]string {
+	pairs := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if key = strings.TrimSpace(key); ok && key != "" {
+			pairs[key] = strings.TrimSpace(value)
+		}
+	}
+	return pairs
+}
+
+// Exporter pushes metrics and spans to an OpenTelemetry collector. Spans are recorded
+// without blocking and dropped when the queue is full; export failures are logged and the
+// data of the failed request is discarded.
+type Exporter struct {
+	config   Config
+	client   *http.Client
+	resource []byte // encoded Resource message
+	start    time.Time
+
+	mu      sync.Mutex
+	writers []stats.MetricsWriter
+
+	spans   chan Span
+	dropped atomic.Uint64
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewExporter creates an exporter and starts pushing to the collector in the background
+func NewExporter(config Config) (*Exporter, error) {
+	if config.Endpoint == "" {
+		return nil, errors.New("otlp: no endpoint")
+	}
+	if config.Protocol == "" {
+		config.Protocol = ProtocolHTTP
+	}
+	config.Interval = orDefault(config.Interval, DefaultInterval)
+	config.BatchSize = orDefault(config.BatchSize, DefaultBatchSize)
+	config.QueueSize = orDefault(config.QueueSize, DefaultQueueSize)
+	config.Timeout = orDefault(config.Timeout, DefaultTimeout)
+
+	client, err := newClient(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(config.Resource))
+	for key := range config.Resource {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	attributes := make([]Attribute, len(keys))
+	for i, key := range keys {
+		attributes[i] = Attribute{Key: key, Value: config.Resource[key]}
+	}
+
+	e := &Exporter{
+		config:   config,
+		client:   client,
+		resource: appendAttributes(nil, 1, attributes),
+		start:    time.Now(),
+		spans:    make(chan Span, config.QueueSize),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go e.run()
+	return e, nil
+}
+
+// Register adds writers of metrics in the Prometheus text exposition format, such as the
+// WriteTo method of a stats.PrometheusHandler or the WriteMetrics method of a transport.
+// Their counters, gauges and histograms are exported at every interval.
+func (e *Exporter) Register(writers ...stats.MetricsWriter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.writers = append(e.writers, writers...)
+}
+
+// RecordSpan queues a finished span for export, dropping it if the queue is full
+func (e *Exporter) RecordSpan(span Span) {
+	select {
+	case e.spans <- span:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of spans dropped because the queue was full
+func (e *Exporter) Dropped() uint64 {
+	return e.dropped.Load()
+}
+
+// Close exports the queued spans and the metrics a last time, and stops the exporter
+func (e *Exporter) Close() error {
+	close(e.done)
+	<-e.stopped
+	return nil
+}
+
+func (e *Exporter) run() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(e.config.Interval)
+	defer ticker.Stop()
+
+	batch := make([]Span, 0, e.config.BatchSize)
+	exportSpans := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.ExportSpans(context.Background(), batch); err != nil {
+			logging.Warn("Failed to export spans", zap.String("endpoint", e.config.Endpoint), zap.Int("spans", len(batch)), zap.Error(err))
+		}
+		batch = batch[:0]
+	}
+	exportMetrics := func() {
+		if err := e.ExportMetrics(context.Background()); err != nil {
+			logging.Warn("Failed to export metrics", zap.String("endpoint", e.config.Endpoint), zap.Error(err))
+		}
+	}
+
+	for {
+		select {
+		case span := <-e.spans:
+			if batch = append(batch, span); len(batch) == e.config.BatchSize {
+				exportSpans()
+			}
+		case <-ticker.C:
+			exportSpans()
+			exportMetrics()
+		case <-e.done:
+			for len(e.spans) > 0 {
+				if batch = append(batch, <-e.spans); len(batch) == e.config.BatchSize {
+					exportSpans()
+				}
+			}
+			exportSpans()
+			exportMetrics()
+			return
+		}
+	}
+}
+
+// ExportMetrics reads the registered writers and exports their metrics right away
+func (e *Exporter) ExportMetrics(ctx context.Context) error {
+	e.mu.Lock()
+	writers := e.writers
+	e.mu.Unlock()
+	if len(writers) == 0 {
+		return nil
+	}
+
+	var text bytes.Buffer
+	for _, write := range writers {
+		if _, err := write(&text); err != nil {
+			return fmt.Errorf("failed to read metrics: %w", err)
+		}
+	}
+	metrics := parsePrometheus(text.Bytes())
+	if len(metrics) == 0 {
+		return nil
+	}
+	return e.send(ctx, signalMetrics, e.encodeMetrics(metrics, time.Now()))
+}
+
+// ExportSpans exports spans right away, bypassing the queue
+func (e *Exporter) ExportSpans(ctx context.Context, spans []Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	return e.send(ctx, signalTraces, e.encodeSpans(spans))
+}
+
+func orDefault[T int | time.Duration](value, def T) T {
+	if value <= 0 {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,327 @@
+package otlp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/rpc/stats"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// message is a decoded protobuf message: the values of its fields by number, varints and
+// fixed values as uint64 and length-delimited fields as []byte
+type message map[protowire.Number][]any
+
+func decode(t *testing.T, b []byte) message {
+	t.Helper()
+	m := make(message)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("invalid tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		var value any
+		switch typ {
+		case protowire.VarintType:
+			value, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			value, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(b)
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+		if n < 0 {
+			t.Fatalf("invalid field %d: %v", num, protowire.ParseError(n))
+		}
+		m[num] = append(m[num], value)
+		b = b[n:]
+	}
+	return m
+}
+
+// messages decodes the repeated message field num
+func (m message) messages(t *testing.T, num protowire.Number) []message {
+	t.Helper()
+	var messages []message
+	for _, value := range m[num] {
+		messages = append(messages, decode(t, value.([]byte)))
+	}
+	return messages
+}
+
+func (m message) string(num protowire.Number) string {
+	if len(m[num]) == 0 {
+		return ""
+	}
+	return string(m[num][0].([]byte))
+}
+
+func (m message) uint(num protowire.Number) uint64 {
+	if len(m[num]) == 0 {
+		return 0
+	}
+	return m[num][0].(uint64)
+}
+
+// attributes decodes the string, int and bool values of repeated KeyValue field num
+func (m message) attributes(t *testing.T, num protowire.Number) map[string]any {
+	t.Helper()
+	attributes := make(map[string]any)
+	for _, kv := range m.messages(t, num) {
+		value := kv.messages(t, 2)[0]
+		switch {
+		case value[1] != nil:
+			attributes[kv.string(1)] = value.string(1)
+		case value[2] != nil:
+			attributes[kv.string(1)] = value.uint(2) == 1
+		case value[3] != nil:
+			attributes[kv.string(1)] = int64(value.uint(3))
+		}
+	}
+	return attributes
+}
+
+// collector records the requests of an OTLP endpoint by path
+type collector struct {
+	mu       sync.Mutex
+	requests map[string][][]byte
+}
+
+func (c *collector) record(path string, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.requests == nil {
+		c.requests = make(map[string][][]byte)
+	}
+	c.requests[path] = append(c.requests[path], body)
+}
+
+func (c *collector) get(path string) [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requests[path]
+}
+
+const testMetrics = `# HELP arpc_client_started_total Total number of RPCs started by the client.
+# TYPE arpc_client_started_total counter
+arpc_client_started_total{service="kv.KVService",method="Get"} 7
+# TYPE arpc_transport_pending_reassemblies gauge
+arpc_transport_pending_reassemblies{transport="127.0.0.1:9000"} 3
+# TYPE arpc_client_handling_seconds histogram
+arpc_client_handling_seconds_bucket{service="kv",method="Get",le="0.01"} 2
+arpc_client_handling_seconds_bucket{service="kv",method="Get",le="0.1"} 5
+arpc_client_handling_seconds_bucket{service="kv",method="Get",le="+Inf"} 6
+arpc_client_handling_seconds_sum{service="kv",method="Get"} 1.5
+arpc_client_handling_seconds_count{service="kv",method="Get"} 6
+`
+
+func TestExporter_MetricsHTTP(t *testing.T) {
+	var c collector
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-protobuf" || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unexpected headers", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		c.record(r.URL.Path, body)
+	}))
+	defer server.Close()
+
+	exporter, err := NewExporter(Config{
+		Endpoint: server.URL,
+		Headers:  map[string]string{"Authorization": "Bearer token"},
+		Interval: time.Hour,
+		Resource: map[string]string{"service.name": "kv-client", "arpc.role": "client"},
+	})
+	if err != nil {
+		t.Fatalf("NewExporter failed: %v", err)
+	}
+	defer exporter.Close()
+	exporter.Register(func(w io.Writer) (int64, error) {
+		n, err := io.WriteString(w, testMetrics)
+		return int64(n), err
+	})
+	if err := exporter.ExportMetrics(context.Background()); err != nil {
+		t.Fatalf("ExportMetrics failed: %v", err)
+	}
+
+	requests := c.get("/v1/metrics")
+	if len(requests) != 1 {
+		t.Fatalf("Expected 1 metrics request, got %d", len(requests))
+	}
+	resourceMetrics := decode(t, requests[0]).messages(t, 1)[0]
+	if resource := resourceMetrics.messages(t, 1)[0].attributes(t, 1); resource["service.name"] != "kv-client" || resource["arpc.role"] != "client" {
+		t.Errorf("Unexpected resource attributes %v", resource)
+	}
+	metrics := make(map[string]message)
+	for _, m := range resourceMetrics.messages(t, 2)[0].messages(t, 2) {
+		metrics[m.string(1)] = m
+	}
+
+	started := metrics["arpc_client_started_total"]
+	if started.string(2) != "Total number of RPCs started by the client." || started[7] == nil {
+		t.Fatalf("Expected a sum with its description, got %v", started)
+	}
+	sum := started.messages(t, 7)[0]
+	dataPoint := sum.messages(t, 1)[0]
+	if sum.uint(2) != 2 || sum.uint(3) != 1 || math.Float64frombits(dataPoint.uint(4)) != 7 {
+		t.Errorf("Expected a cumulative monotonic sum of 7, got %v", sum)
+	}
+	if attributes := dataPoint.attributes(t, 7); attributes["service"] != "kv.KVService" || attributes["method"] != "Get" {
+		t.Errorf("Unexpected data point attributes %v", attributes)
+	}
+
+	if gauge := metrics["arpc_transport_pending_reassemblies"]; gauge[5] == nil {
+		t.Errorf("Expected a gauge, got %v", gauge)
+	}
+
+	histogram := metrics["arpc_client_handling_seconds"]
+	if histogram[9] == nil {
+		t.Fatalf("Expected a histogram, got %v", histogram)
+	}
+	histogramPoint := histogram.messages(t, 9)[0].messages(t, 1)[0]
+	counts := histogramPoint[6][0].([]byte)
+	var buckets []uint64
+	for i := 0; i < len(counts); i += 8 {
+		buckets = append(buckets, binary.LittleEndian.Uint64(counts[i:]))
+	}
+	if histogramPoint.uint(4) != 6 || len(buckets) != 3 || buckets[0] != 2 || buckets[1] != 3 || buckets[2] != 1 {
+		t.Errorf("Expected buckets [2 3 1] of a count of 6, got %v of %d", buckets, histogramPoint.uint(4))
+	}
+	if attributes := histogramPoint.attributes(t, 9); len(attributes) != 2 || attributes["le"] != nil {
+		t.Errorf("Expected the labels of the histogram without le, got %v", attributes)
+	}
+}
+
+// newGRPCCollector serves the OTLP gRPC services over HTTP/2 without TLS, answering with status
+func newGRPCCollector(t *testing.T, c *collector, status string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.ProtoMajor != 2 || r.Header.Get("Content-Type") != "application/grpc" || len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+			http.Error(w, "not a gRPC request", http.StatusBadRequest)
+			return
+		}
+		c.record(r.URL.Path, body[5:])
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Write(make([]byte, 5)) // empty response message
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", status)
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", "unavailable")
+	}))
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTracer_GRPC(t *testing.T) {
+	var c collector
+	server := newGRPCCollector(t, &c, "0")
+	exporter, err := NewExporter(Config{Endpoint: strings.TrimPrefix(server.URL, "http://"), Protocol: ProtocolGRPC, Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewExporter failed: %v", err)
+	}
+
+	// A call failing after a retry
+	tracer := NewTracer(exporter)
+	handler := stats.MultiHandler(stats.NewPrometheusHandler(), tracer)
+	begin := time.Now()
+	ctx := handler.TagRPC(context.Background(), &stats.RPCTagInfo{Service: "kv.KVService", Method: "Get"})
+	handler.HandleRPC(ctx, &stats.Begin{RPCID: 42, Service: "kv.KVService", Method: "Get", BeginTime: begin})
+	handler.HandleRPC(ctx, &stats.OutPayload{RPCID: 42, Bytes: 100, Fragments: 1})
+	handler.HandleRPC(ctx, &stats.Retry{RPCID: 42, Attempt: 1, Error: errors.New("timeout"), Backoff: 10 * time.Millisecond})
+	handler.HandleRPC(ctx, &stats.OutPayload{RPCID: 43, Bytes: 100, Fragments: 1})
+	handler.HandleRPC(ctx, &stats.End{RPCID: 42, BeginTime: begin, EndTime: begin.Add(time.Second), Error: errors.New("unavailable")})
+
+	// Closing exports the queued span
+	exporter.Close()
+	requests := c.get("/opentelemetry.proto.collector.trace.v1.TraceService/Export")
+	if len(requests) != 1 {
+		t.Fatalf("Expected 1 trace export, got %d", len(requests))
+	}
+	spans := decode(t, requests[0]).messages(t, 1)[0].messages(t, 2)[0].messages(t, 2)
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.string(5) != "kv.KVService/Get" || span.uint(6) != uint64(SpanKindClient) || len(span.string(1)) != 16 || len(span.string(2)) != 8 {
+		t.Errorf("Unexpected span %v", span)
+	}
+	if end := span.uint(8) - span.uint(7); end != uint64(time.Second) {
+		t.Errorf("Expected a span of 1s, got %v", time.Duration(end))
+	}
+	if attributes := span.attributes(t, 9); attributes["arpc.rpc_id"] != int64(42) || attributes["arpc.request.bytes"] != int64(200) || attributes["rpc.method"] != "Get" {
+		t.Errorf("Unexpected span attributes %v", attributes)
+	}
+	if events := span.messages(t, 11); len(events) != 1 || events[0].string(2) != "retry" {
+		t.Errorf("Expected a retry event, got %v", events)
+	}
+	if status := span.messages(t, 15); len(status) != 1 || status[0].uint(3) != 2 || status[0].string(2) != "unavailable" {
+		t.Errorf("Expected an error status, got %v", status)
+	}
+}
+
+func TestExporter_GRPCError(t *testing.T) {
+	var c collector
+	server := newGRPCCollector(t, &c, "14")
+	exporter, err := NewExporter(Config{Endpoint: server.URL, Protocol: ProtocolGRPC, Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewExporter failed: %v", err)
+	}
+	defer exporter.Close()
+
+	err = exporter.ExportSpans(context.Background(), []Span{{TraceID: NewTraceID(), SpanID: NewSpanID(), Name: "test"}})
+	if err == nil || !strings.Contains(err.Error(), "status 14") {
+		t.Errorf("Expected the gRPC status of the collector, got %v", err)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	if config, err := ConfigFromEnv("proxy"); config != nil || err != nil {
+		t.Fatalf("Expected no configuration without an endpoint, got %+v, %v", config, err)
+	}
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "otel-collector:4317")
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+	t.Setenv("OTEL_METRIC_EXPORT_INTERVAL", "5000")
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment=staging, team=infra")
+	t.Setenv("POD_NAME", "proxy-abc")
+	t.Setenv("NODE_NAME", "node-1")
+	config, err := ConfigFromEnv("proxy")
+	if err != nil {
+		t.Fatalf("ConfigFromEnv failed: %v", err)
+	}
+	if config.Protocol != ProtocolGRPC || config.Interval != 5*time.Second {
+		t.Errorf("Unexpected configuration %+v", config)
+	}
+	want := map[string]string{
+		"service.name":           "arpc-proxy",
+		"arpc.role":              "proxy",
+		"k8s.pod.name":           "proxy-abc",
+		"k8s.node.name":          "node-1",
+		"deployment.environment": "staging",
+		"team":                   "infra",
+	}
+	for key, value := range want {
+		if config.Resource[key] != value {
+			t.Errorf("Expected resource attribute %s=%s, got %q", key, value, config.Resource[key])
+		}
+	}
+
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json")
+	if _, err := ConfigFromEnv("proxy"); err == nil {
+		t.Error("Expected an error for an unsupported protocol")
+	}
+}
@@ -0,0 +1,218 @@
+package otlp
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/rpc/stats"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Attribute is an attribute of a resource, span or span event. Values are encoded by type:
+// strings, bools, integers and floats; other values are formatted with fmt.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// appendValue appends the AnyValue encoding of the attribute value
+func (a Attribute) appendValue(b []byte) []byte {
+	switch v := a.Value.(type) {
+	case string:
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		return protowire.AppendString(b, v)
+	case bool:
+		return appendVarint(b, 2, protowire.EncodeBool(v))
+	case int:
+		return appendVarint(b, 3, uint64(v))
+	case int64:
+		return appendVarint(b, 3, uint64(v))
+	case int32:
+		return appendVarint(b, 3, uint64(v))
+	case uint64:
+		return appendVarint(b, 3, v)
+	case uint32:
+		return appendVarint(b, 3, uint64(v))
+	case uint16:
+		return appendVarint(b, 3, uint64(v))
+	case uint8:
+		return appendVarint(b, 3, uint64(v))
+	case float64:
+		return appendDouble(b, 4, v)
+	}
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	return protowire.AppendString(b, fmt.Sprint(a.Value))
+}
+
+// SpanKind is the role of the process in the operation of a span
+type SpanKind int32
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// Span is a finished operation, such as an RPC seen by a client or a proxy
+type Span struct {
+	TraceID      [16]byte
+	SpanID       [8]byte
+	ParentSpanID [8]byte // zero for a root span
+	Name         string
+	Kind         SpanKind
+	Start        time.Time
+	End          time.Time
+	Attributes   []Attribute
+	Events       []SpanEvent
+	// Error sets the status of the span to error with this message; the status is unset if empty
+	Error string
+}
+
+// SpanEvent is an event during a span, such as a retry
+type SpanEvent struct {
+	Time       time.Time
+	Name       string
+	Attributes []Attribute
+}
+
+// NewTraceID returns a random trace ID
+func NewTraceID() [16]byte {
+	var id [16]byte
+	binary.LittleEndian.PutUint64(id[:8], rand.Uint64())
+	binary.LittleEndian.PutUint64(id[8:], rand.Uint64())
+	return id
+}
+
+// NewSpanID returns a random span ID
+func NewSpanID() [8]byte {
+	var id [8]byte
+	binary.LittleEndian.PutUint64(id[:], rand.Uint64())
+	return id
+}
+
+// encodeSpans encodes an ExportTraceServiceRequest of spans
+func (e *Exporter) encodeSpans(spans []Span) []byte {
+	return appendMessage(nil, 1, func(b []byte) []byte { // ResourceSpans
+		b = appendBytes(b, 1, e.resource)
+		return appendMessage(b, 2, func(b []byte) []byte { // ScopeSpans
+			b = appendMessage(b, 1, appendScope)
+			for i := range spans {
+				b = appendMessage(b, 2, spans[i].append)
+			}
+			return b
+		})
+	})
+}
+
+// append appends the Span encoding of the span
+func (s *Span) append(b []byte) []byte {
+	b = appendBytes(b, 1, s.TraceID[:])
+	b = appendBytes(b, 2, s.SpanID[:])
+	if s.ParentSpanID != [8]byte{} {
+		b = appendBytes(b, 4, s.ParentSpanID[:])
+	}
+	b = appendString(b, 5, s.Name)
+	b = appendVarint(b, 6, uint64(s.Kind))
+	b = appendFixed64(b, 7, uint64(s.Start.UnixNano()))
+	b = appendFixed64(b, 8, uint64(s.End.UnixNano()))
+	b = appendAttributes(b, 9, s.Attributes)
+	for _, event := range s.Events {
+		b = appendMessage(b, 11, func(b []byte) []byte {
+			b = appendFixed64(b, 1, uint64(event.Time.UnixNano()))
+			b = appendString(b, 2, event.Name)
+			return appendAttributes(b, 3, event.Attributes)
+		})
+	}
+	if s.Error != "" {
+		b = appendMessage(b, 15, func(b []byte) []byte { // Status
+			b = appendString(b, 2, s.Error)
+			return appendVarint(b, 3, 2) // STATUS_CODE_ERROR
+		})
+	}
+	return b
+}
+
+// Tracer is a stats.Handler exporting a client span per call, with the sizes of the
+// request and response, the RPC ID and an event per retry
+type Tracer struct {
+	exporter *Exporter
+}
+
+// NewTracer creates a tracer exporting its spans with exporter. Set it on a client with
+// SetStatsHandler; it can be combined with PrometheusHandler with stats.MultiHandler.
+func NewTracer(exporter *Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// callSpanKey is the context key of the span of a call
+type callSpanKey struct{}
+
+// callSpan is the span of a call being built from its events
+type callSpan struct {
+	span          Span
+	sentBytes     int
+	sentFragments int
+	receivedBytes int
+}
+
+// TagRPC starts the span of a call
+func (t *Tracer) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, callSpanKey{}, &callSpan{span: Span{
+		TraceID: NewTraceID(),
+		SpanID:  NewSpanID(),
+		Name:    info.Service + "/" + info.Method,
+		Kind:    SpanKindClient,
+		Attributes: []Attribute{
+			{Key: "rpc.system", Value: "arpc"},
+			{Key: "rpc.service", Value: info.Service},
+			{Key: "rpc.method", Value: info.Method},
+		},
+	}})
+}
+
+// HandleRPC adds an event to the span of the call, and exports it once the call ends
+func (t *Tracer) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	call, ok := ctx.Value(callSpanKey{}).(*callSpan)
+	if !ok {
+		return
+	}
+	switch st := s.(type) {
+	case *stats.Begin:
+		call.span.Start = st.BeginTime
+		call.span.Attributes = append(call.span.Attributes, Attribute{Key: "arpc.rpc_id", Value: st.RPCID})
+	case *stats.OutPayload:
+		call.sentBytes += st.Bytes
+		call.sentFragments += st.Fragments
+	case *stats.InPayload:
+		call.receivedBytes += st.Bytes
+	case *stats.Retry:
+		call.span.Events = append(call.span.Events, SpanEvent{
+			Time: time.Now(),
+			Name: "retry",
+			Attributes: []Attribute{
+				{Key: "arpc.retry.attempt", Value: st.Attempt},
+				{Key: "arpc.retry.backoff_ms", Value: st.Backoff.Milliseconds()},
+				{Key: "exception.message", Value: errorString(st.Error)},
+			},
+		})
+	case *stats.End:
+		call.span.End = st.EndTime
+		call.span.Attributes = append(call.span.Attributes,
+			Attribute{Key: "arpc.request.bytes", Value: call.sentBytes},
+			Attribute{Key: "arpc.request.fragments", Value: call.sentFragments},
+			Attribute{Key: "arpc.response.bytes", Value: call.receivedBytes},
+		)
+		call.span.Error = errorString(st.Error)
+		t.exporter.RecordSpan(call.span)
+	}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
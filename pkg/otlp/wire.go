@@ -0,0 +1,163 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// signal is an OTLP signal, with its HTTP path and gRPC method
+type signal struct {
+	path   string
+	method string
+}
+
+var (
+	signalMetrics = signal{"/v1/metrics", "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"}
+	signalTraces  = signal{"/v1/traces", "/opentelemetry.proto.collector.trace.v1.TraceService/Export"}
+)
+
+// newClient creates the HTTP client of the protocol, and normalizes the endpoint to a URL
+// without a trailing slash
+func newClient(config *Config) (*http.Client, error) {
+	endpoint := strings.TrimSuffix(config.Endpoint, "/")
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	config.Endpoint = endpoint
+
+	switch config.Protocol {
+	case ProtocolHTTP:
+		return &http.Client{Timeout: config.Timeout}, nil
+	case ProtocolGRPC:
+		// gRPC runs over HTTP/2, without TLS unless the endpoint asks for it
+		var protocols http.Protocols
+		if strings.HasPrefix(endpoint, "https://") {
+			protocols.SetHTTP2(true)
+		} else {
+			protocols.SetUnencryptedHTTP2(true)
+		}
+		return &http.Client{Timeout: config.Timeout, Transport: &http.Transport{Protocols: &protocols}}, nil
+	}
+	return nil, fmt.Errorf("otlp: unsupported protocol %q", config.Protocol)
+}
+
+// send exports an encoded Export*ServiceRequest
+func (e *Exporter) send(ctx context.Context, sig signal, message []byte) error {
+	if e.config.Protocol == ProtocolGRPC {
+		return e.sendGRPC(ctx, sig, message)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.config.Endpoint+sig.path, bytes.NewReader(message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for key, value := range e.config.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// sendGRPC makes a unary gRPC call with the message as request
+func (e *Exporter) sendGRPC(ctx context.Context, sig signal, message []byte) error {
+	// A gRPC message is prefixed by its compression flag and big-endian length
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	frame = append(frame, message...)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.config.Endpoint+sig.method, bytes.NewReader(frame))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	for key, value := range e.config.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+
+	// The status is in the trailers, or in the headers of a response without a body
+	status, statusMessage := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, statusMessage = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status != "0" {
+		return fmt.Errorf("collector returned gRPC status %s: %s", status, statusMessage)
+	}
+	return nil
+}
+
+// appendMessage appends a length-delimited field holding the message encoded by encode
+func appendMessage(b []byte, num protowire.Number, encode func([]byte) []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, encode(nil))
+}
+
+// appendString appends a string field, omitted if empty like proto3 defaults
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendFixed64(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v)
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	return appendFixed64(b, num, math.Float64bits(v))
+}
+
+// appendAttributes appends attributes as repeated KeyValue fields
+func appendAttributes(b []byte, num protowire.Number, attributes []Attribute) []byte {
+	for _, attr := range attributes {
+		b = appendMessage(b, num, func(b []byte) []byte {
+			b = appendString(b, 1, attr.Key)
+			return appendMessage(b, 2, attr.appendValue)
+		})
+	}
+	return b
+}
+
+// appendScope appends the InstrumentationScope of the exported data
+func appendScope(b []byte) []byte {
+	return appendString(b, 1, "github.com/appnet-org/arpc")
+}
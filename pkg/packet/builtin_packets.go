@@ -5,6 +5,7 @@ package packet
 import (
 	"encoding/binary"
 	"errors"
+	"time"
 
 	"github.com/appnet-org/arpc/pkg/common"
 )
@@ -17,19 +18,23 @@ var (
 	PacketTypeError    = PacketType{TypeID: 3, Name: "Error"}
 )
 
+// DataPacketHeaderSize is the size of the fixed DataPacket header in bytes (without extensions)
+const DataPacketHeaderSize = 31 // 1+8+2+2+1+1+4+2+4+2+4
+
 // DataPacket represents the common structure for Request and Response packets
 type DataPacket struct {
 	PacketTypeID  PacketTypeID
-	RPCID         uint64  // Unique RPC ID
-	TotalPackets  uint16  // Total number of packets in this RPC
-	SeqNumber     uint16  // Sequence number of this packet
-	MoreFragments bool    // Indicates if there are more fragments with the same sequence number
-	FragmentIndex uint8   // Indexes fragments that share the same sequence number (0-255)
-	DstIP         [4]byte // Destination IP address (4 bytes)
-	DstPort       uint16  // Destination port
-	SrcIP         [4]byte // Source IP address (4 bytes)
-	SrcPort       uint16  // Source port
-	Payload       []byte  // Partial application data
+	RPCID         uint64      // Unique RPC ID
+	TotalPackets  uint16      // Total number of packets in this RPC
+	SeqNumber     uint16      // Sequence number of this packet
+	MoreFragments bool        // Indicates if there are more fragments with the same sequence number
+	FragmentIndex uint8       // Indexes fragments that share the same sequence number (0-255)
+	DstIP         [4]byte     // Destination IP address (4 bytes)
+	DstPort       uint16      // Destination port
+	SrcIP         [4]byte     // Source IP address (4 bytes)
+	SrcPort       uint16      // Source port
+	Extensions    []Extension // Header extension TLVs
+	Payload       []byte      // Partial application data
 }
 
 // RequestPacket extends DataPacket for request packets
@@ -45,27 +50,36 @@ type ResponsePacket struct {
 // ErrorPacket has routing information similar to DataPacket
 type ErrorPacket struct {
 	PacketTypeID PacketTypeID
-	RPCID        uint64  // RPC ID that caused the error
-	DstIP        [4]byte // Destination IP address (4 bytes)
-	DstPort      uint16  // Destination port
-	SrcIP        [4]byte // Source IP address (4 bytes)
-	SrcPort      uint16  // Source port
-	ErrorMsg     string  // Error message string (must fit in one MTU)
+	RPCID        uint64     // RPC ID that caused the error
+	DstIP        [4]byte    // Destination IP address (4 bytes)
+	DstPort      uint16     // Destination port
+	SrcIP        [4]byte    // Source IP address (4 bytes)
+	SrcPort      uint16     // Source port
+	ErrorMsg     string     // Error message string (must fit in one MTU)
+	RetryHint               // Load signal for the client's retry policy (optional)
+	DropReason   DropReason // Standardized cause of the error (optional)
 }
 
 // DataPacketCodec implements DataPacket serialization for both Request and Response packets
 type DataPacketCodec struct{}
 
 // Serialize encodes a DataPacket into binary format:
-// [PacketTypeID(1B)][RPCID(8B)][TotalPackets(2B)][SeqNumber(2B)][MoreFragments(1B)][FragmentIndex(1B)][DstIP(4B)][DstPort(2B)][SrcIP(4B)][SrcPort(2B)][PayloadLen(4B)][Payload]
+// [PacketTypeID(1B)][RPCID(8B)][TotalPackets(2B)][SeqNumber(2B)][Flags(1B)][FragmentIndex(1B)][DstIP(4B)][DstPort(2B)][SrcIP(4B)][SrcPort(2B)][PayloadLen(4B)][Extensions][Payload]
+// Bit 0 of Flags is MoreFragments. Bit 1 is set when the Extensions TLV area is present;
+// packets without extensions keep the original 31-byte layout.
 func (c *DataPacketCodec) Serialize(packet any, pool *common.BufferPool) ([]byte, error) {
 	p, ok := packet.(*DataPacket)
 	if !ok {
 		return nil, errors.New("invalid packet type for DataPacket codec")
 	}
 
+	if err := validateExtensions(p.Extensions); err != nil {
+		return nil, err
+	}
+
 	payloadLen := len(p.Payload)
-	totalSize := 31 + payloadLen // 1+8+2+2+1+1+4+2+4+2+4 = 31 bytes for header
+	extSize := ExtensionsSize(p.Extensions)
+	totalSize := DataPacketHeaderSize + extSize + payloadLen
 
 	var buf []byte
 	if pool != nil {
@@ -80,11 +94,13 @@ func (c *DataPacketCodec) Serialize(packet any, pool *common.BufferPool) ([]byte
 	binary.LittleEndian.PutUint16(buf[9:11], p.TotalPackets)
 	binary.LittleEndian.PutUint16(buf[11:13], p.SeqNumber)
 
-	// Write MoreFragments as a byte (0 or 1)
+	// Write flags (MoreFragments and the presence of extensions)
+	buf[13] = 0
 	if p.MoreFragments {
-		buf[13] = 1
-	} else {
-		buf[13] = 0
+		buf[13] |= flagMoreFragments
+	}
+	if extSize > 0 {
+		buf[13] |= flagHasExtensions
 	}
 
 	// Write FragmentIndex
@@ -105,8 +121,13 @@ func (c *DataPacketCodec) Serialize(packet any, pool *common.BufferPool) ([]byte
 	// Write payload length
 	binary.LittleEndian.PutUint32(buf[27:31], uint32(payloadLen))
 
+	// Write extensions
+	if extSize > 0 {
+		putExtensions(buf[DataPacketHeaderSize:], p.Extensions)
+	}
+
 	// Copy payload
-	copy(buf[31:], p.Payload)
+	copy(buf[DataPacketHeaderSize+extSize:], p.Payload)
 
 	// Note: We don't return the buffer to the pool here because it's returned to the caller
 	// The caller (transport.Send) is responsible for returning it after WriteToUDP
@@ -114,9 +135,9 @@ func (c *DataPacketCodec) Serialize(packet any, pool *common.BufferPool) ([]byte
 }
 
 // Deserialize decodes binary data into a DataPacket
-// Format: [PacketTypeID(1B)][RPCID(8B)][TotalPackets(2B)][SeqNumber(2B)][MoreFragments(1B)][FragmentIndex(1B)][DstIP(4B)][DstPort(2B)][SrcIP(4B)][SrcPort(2B)][PayloadLen(4B)][Payload]
+// Format: [PacketTypeID(1B)][RPCID(8B)][TotalPackets(2B)][SeqNumber(2B)][Flags(1B)][FragmentIndex(1B)][DstIP(4B)][DstPort(2B)][SrcIP(4B)][SrcPort(2B)][PayloadLen(4B)][Extensions][Payload]
 func (c *DataPacketCodec) Deserialize(data []byte) (any, error) {
-	if len(data) < 31 {
+	if len(data) < DataPacketHeaderSize {
 		return nil, errors.New("data too short for DataPacket header")
 	}
 
@@ -126,8 +147,9 @@ func (c *DataPacketCodec) Deserialize(data []byte) (any, error) {
 	p.TotalPackets = binary.LittleEndian.Uint16(data[9:11])
 	p.SeqNumber = binary.LittleEndian.Uint16(data[11:13])
 
-	// Read MoreFragments (convert byte to bool)
-	p.MoreFragments = data[13] != 0
+	// Read flags
+	flags := data[13]
+	p.MoreFragments = flags&flagMoreFragments != 0
 
 	// Read FragmentIndex
 	p.FragmentIndex = data[14]
@@ -147,14 +169,25 @@ func (c *DataPacketCodec) Deserialize(data []byte) (any, error) {
 	// Read payload length
 	payloadLen := binary.LittleEndian.Uint32(data[27:31])
 
+	// Read extensions (unknown types are kept so forwarders can pass them on)
+	payloadStart := DataPacketHeaderSize
+	if flags&flagHasExtensions != 0 {
+		exts, extSize, err := parseExtensions(data[DataPacketHeaderSize:])
+		if err != nil {
+			return nil, err
+		}
+		p.Extensions = exts
+		payloadStart += extSize
+	}
+
 	// Validate length
-	if len(data) < 31+int(payloadLen) {
+	if len(data) < payloadStart+int(payloadLen) {
 		return nil, errors.New("data too short for declared payload length")
 	}
 
 	// Use zero-copy slice for payload - caller must keep buffer alive until payload is no longer needed
 	payloadLenInt := int(payloadLen)
-	p.Payload = data[31 : 31+payloadLenInt]
+	p.Payload = data[payloadStart : payloadStart+payloadLenInt]
 
 	return p, nil
 }
@@ -163,7 +196,7 @@ func (c *DataPacketCodec) Deserialize(data []byte) (any, error) {
 type ErrorPacketCodec struct{}
 
 // Serialize encodes an ErrorPacket into binary format:
-// [PacketTypeID(1B)][RPCID(8B)][DstIP(4B)][DstPort(2B)][SrcIP(4B)][SrcPort(2B)][MsgLen(4B)][Msg]
+// [PacketTypeID(1B)][RPCID(8B)][DstIP(4B)][DstPort(2B)][SrcIP(4B)][SrcPort(2B)][MsgLen(4B)][Msg][Throttle(1B)][RetryAfterMs(3B)][DropReason(1B)]
 func (c *ErrorPacketCodec) Serialize(packet any, pool *common.BufferPool) ([]byte, error) {
 	p, ok := packet.(*ErrorPacket)
 	if !ok {
@@ -171,11 +204,14 @@ func (c *ErrorPacketCodec) Serialize(packet any, pool *common.BufferPool) ([]byt
 	}
 
 	msgBytes := []byte(p.ErrorMsg)
-	if len(msgBytes) > MaxUDPPayloadSize-29 { // 1+8+4+2+4+2+4 header = 29B
+	if len(msgBytes) > MaxUDPPayloadSize-30 { // 1+8+4+2+4+2+4 header + 1+3 retry hint + 1 drop reason = 30B
 		return nil, errors.New("error message too long, must fit in one MTU")
 	}
+	if p.RetryAfter < 0 || p.RetryAfter > MaxRetryAfter {
+		return nil, errors.New("retry-after hint out of range")
+	}
 
-	totalSize := 29 + len(msgBytes)
+	totalSize := 30 + len(msgBytes)
 
 	var buf []byte
 	if pool != nil {
@@ -206,13 +242,25 @@ func (c *ErrorPacketCodec) Serialize(packet any, pool *common.BufferPool) ([]byt
 	// Copy message
 	copy(buf[25:], msgBytes)
 
+	// Write retry hint
+	hintStart := 25 + len(msgBytes)
+	retryAfterMs := uint32(p.RetryAfter / time.Millisecond)
+	buf[hintStart] = byte(p.Throttle)
+	buf[hintStart+1] = byte(retryAfterMs)
+	buf[hintStart+2] = byte(retryAfterMs >> 8)
+	buf[hintStart+3] = byte(retryAfterMs >> 16)
+	buf[hintStart+4] = byte(p.DropReason)
+
 	// Note: We don't return the buffer to the pool here because it's returned to the caller
 	// The caller (transport.Send) is responsible for returning it after WriteToUDP
 	return buf, nil
 }
 
 // Deserialize decodes binary data into an ErrorPacket
-// Format: [PacketTypeID(1B)][RPCID(8B)][DstIP(4B)][DstPort(2B)][SrcIP(4B)][SrcPort(2B)][MsgLen(4B)][Msg]
+// Format: [PacketTypeID(1B)][RPCID(8B)][DstIP(4B)][DstPort(2B)][SrcIP(4B)][SrcPort(2B)][MsgLen(4B)][Msg][Throttle(1B)][RetryAfterMs(3B)][DropReason(1B)]
+// The retry hint occupies what used to be unused trailing bytes, so a hint with an
+// unknown throttle state (e.g. from a sender that left them uninitialized) is ignored.
+// Older senders end the packet before the drop reason, which is then DropReasonNone.
 func (c *ErrorPacketCodec) Deserialize(data []byte) (any, error) {
 	if len(data) < 29 {
 		return nil, errors.New("data too short for ErrorPacket header")
@@ -242,5 +290,18 @@ func (c *ErrorPacketCodec) Deserialize(data []byte) (any, error) {
 	}
 
 	pkt.ErrorMsg = string(data[25 : 25+msgLen])
+
+	// Read retry hint
+	hintStart := 25 + int(msgLen)
+	if throttle := ThrottleState(data[hintStart]); throttle <= ThrottleOverloaded {
+		retryAfterMs := uint32(data[hintStart+1]) | uint32(data[hintStart+2])<<8 | uint32(data[hintStart+3])<<16
+		pkt.Throttle = throttle
+		pkt.RetryAfter = time.Duration(retryAfterMs) * time.Millisecond
+	}
+	if len(data) > hintStart+4 {
+		if reason := DropReason(data[hintStart+4]); reason <= maxDropReason {
+			pkt.DropReason = reason
+		}
+	}
 	return pkt, nil
 }
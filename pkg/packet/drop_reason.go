@@ -0,0 +1,42 @@
+package packet
+
+// DropReason is the standardized cause of a call that a proxy or server refused, carried in
+// error packets so that clients branch on it rather than on error messages
+type DropReason uint8
+
+const (
+	DropReasonNone             DropReason = 0 // no cause given (e.g. by senders predating drop reasons)
+	DropReasonPolicyDenied     DropReason = 1 // a policy element rejected the call
+	DropReasonRateLimited      DropReason = 2 // a rate limit or quota of the sender was exceeded
+	DropReasonAuthFailed       DropReason = 3 // the caller could not be authenticated
+	DropReasonMalformedPayload DropReason = 4 // the payload could not be decoded
+	DropReasonUnavailable      DropReason = 5 // the destination is unreachable
+	DropReasonInternal         DropReason = 6 // the proxy failed to process the call
+	DropReasonLoopDetected     DropReason = 7 // the request exceeded the hop limit, likely in a routing loop
+)
+
+// maxDropReason is the highest drop reason known to this version
+const maxDropReason = DropReasonLoopDetected
+
+func (r DropReason) String() string {
+	switch r {
+	case DropReasonNone:
+		return "none"
+	case DropReasonPolicyDenied:
+		return "policy_denied"
+	case DropReasonRateLimited:
+		return "rate_limited"
+	case DropReasonAuthFailed:
+		return "auth_failed"
+	case DropReasonMalformedPayload:
+		return "malformed_payload"
+	case DropReasonUnavailable:
+		return "unavailable"
+	case DropReasonInternal:
+		return "internal"
+	case DropReasonLoopDetected:
+		return "loop_detected"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,140 @@
+package packet
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ExtensionType identifies a header extension TLV
+type ExtensionType uint8
+
+// Known extension types. Decoders skip types they do not understand, and forwarders
+// (proxies) carry them through unchanged, so new types can be added without
+// coordinating upgrades.
+const (
+	ExtensionTraceContext ExtensionType = 1 // W3C traceparent
+	ExtensionPriority     ExtensionType = 2 // 1 byte, higher is more important
+	ExtensionDeadline     ExtensionType = 3 // 8 bytes, unix nanoseconds
+	ExtensionKeyID        ExtensionType = 4 // identifier of the encryption key
+	ExtensionAuthTag      ExtensionType = 5 // proof that the sender holds the encryption key
+	ExtensionRecvLimit    ExtensionType = 6 // 4 bytes, largest response (in bytes) the client accepts
+	ExtensionUserAgent    ExtensionType = 7 // at most MaxUserAgentSize bytes, identifies the client software
+	ExtensionRelay        ExtensionType = 8 // final destination and session token of an RPC sent through a relay
+	ExtensionOrigin       ExtensionType = 9 // OriginSize bytes, origin request ID and hop count (see Origin)
+)
+
+// MaxExtensionsSize bounds the TLV area (excluding its 2-byte length prefix) so that
+// extensions fit in the headroom between MaxUDPPayloadSize and the link MTU. Peers of
+// releases before ExtensionOrigin reject areas of more than 64 bytes.
+const MaxExtensionsSize = 80
+
+// MaxUserAgentSize bounds ExtensionUserAgent so that it fits next to the security, receive
+// limit and origin extensions
+const MaxUserAgentSize = 24
+
+// flagHasExtensions is set in the flags byte of a DataPacket when a TLV area follows
+// the fixed header. Bit 0 of the same byte is MoreFragments.
+const (
+	flagMoreFragments = 1 << 0
+	flagHasExtensions = 1 << 1
+)
+
+// Extension is a single type-length-value entry of the DataPacket header
+type Extension struct {
+	Type  ExtensionType
+	Value []byte // at most 255 bytes
+}
+
+var (
+	ErrExtensionTooLong  = errors.New("extension value too long")
+	ErrExtensionsTooLong = errors.New("header extensions exceed MaxExtensionsSize")
+	ErrMalformedTLV      = errors.New("malformed header extension")
+)
+
+// ExtensionsSize returns the number of bytes the extensions add to the header,
+// including the length prefix of the TLV area (0 if there are no extensions)
+func ExtensionsSize(exts []Extension) int {
+	if len(exts) == 0 {
+		return 0
+	}
+	size := 2
+	for _, ext := range exts {
+		size += 2 + len(ext.Value)
+	}
+	return size
+}
+
+// FindExtension returns the value of the first extension of the given type
+func FindExtension(exts []Extension, t ExtensionType) ([]byte, bool) {
+	for _, ext := range exts {
+		if ext.Type == t {
+			return ext.Value, true
+		}
+	}
+	return nil, false
+}
+
+// GetExtension returns the value of the first extension of the given type
+func (p *DataPacket) GetExtension(t ExtensionType) ([]byte, bool) {
+	return FindExtension(p.Extensions, t)
+}
+
+// SetExtension adds an extension or replaces the value of an existing one of the same type
+func (p *DataPacket) SetExtension(t ExtensionType, value []byte) {
+	for i := range p.Extensions {
+		if p.Extensions[i].Type == t {
+			p.Extensions[i].Value = value
+			return
+		}
+	}
+	p.Extensions = append(p.Extensions, Extension{Type: t, Value: value})
+}
+
+// validateExtensions checks the bounds of an extension list before serialization
+func validateExtensions(exts []Extension) error {
+	for _, ext := range exts {
+		if len(ext.Value) > 255 {
+			return ErrExtensionTooLong
+		}
+	}
+	if ExtensionsSize(exts)-2 > MaxExtensionsSize {
+		return ErrExtensionsTooLong
+	}
+	return nil
+}
+
+// putExtensions writes the TLV area: [AreaLen(2B)]([Type(1B)][Len(1B)][Value])*
+func putExtensions(buf []byte, exts []Extension) {
+	binary.LittleEndian.PutUint16(buf[0:2], uint16(ExtensionsSize(exts)-2))
+	offset := 2
+	for _, ext := range exts {
+		buf[offset] = byte(ext.Type)
+		buf[offset+1] = byte(len(ext.Value))
+		copy(buf[offset+2:], ext.Value)
+		offset += 2 + len(ext.Value)
+	}
+}
+
+// parseExtensions reads the TLV area at the start of data and returns the extensions
+// (values are zero-copy slices of data) and the total size of the area
+func parseExtensions(data []byte) ([]Extension, int, error) {
+	if len(data) < 2 {
+		return nil, 0, ErrMalformedTLV
+	}
+	areaLen := int(binary.LittleEndian.Uint16(data[0:2]))
+	if areaLen > MaxExtensionsSize || len(data) < 2+areaLen {
+		return nil, 0, ErrMalformedTLV
+	}
+
+	var exts []Extension
+	area := data[2 : 2+areaLen]
+	for len(area) > 0 {
+		if len(area) < 2 || len(area) < 2+int(area[1]) {
+			return nil, 0, ErrMalformedTLV
+		}
+		valueLen := int(area[1])
+		exts = append(exts, Extension{Type: ExtensionType(area[0]), Value: area[2 : 2+valueLen]})
+		area = area[2+valueLen:]
+	}
+	return exts, 2 + areaLen, nil
+}
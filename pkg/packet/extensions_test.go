@@ -0,0 +1,126 @@
+package packet
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDataPacketCodec_Extensions(t *testing.T) {
+	codec := &DataPacketCodec{}
+	in := &DataPacket{
+		PacketTypeID:  PacketTypeRequest.TypeID,
+		RPCID:         42,
+		TotalPackets:  2,
+		SeqNumber:     1,
+		MoreFragments: true,
+		FragmentIndex: 3,
+		Payload:       []byte("payload"),
+	}
+	in.SetExtension(ExtensionPriority, []byte{7})
+	in.SetExtension(ExtensionType(200), []byte("future")) // unknown type
+
+	data, err := codec.Serialize(in, nil)
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	if len(data) != DataPacketHeaderSize+ExtensionsSize(in.Extensions)+len(in.Payload) {
+		t.Errorf("Unexpected packet size %d", len(data))
+	}
+
+	outAny, err := codec.Deserialize(data)
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	out := outAny.(*DataPacket)
+
+	if !out.MoreFragments || out.FragmentIndex != 3 || out.SeqNumber != 1 {
+		t.Errorf("Fixed header fields not preserved: %+v", out)
+	}
+	if !bytes.Equal(out.Payload, in.Payload) {
+		t.Errorf("Expected payload %q, got %q", in.Payload, out.Payload)
+	}
+	if v, ok := out.GetExtension(ExtensionPriority); !ok || !bytes.Equal(v, []byte{7}) {
+		t.Errorf("Expected priority extension, got %v (found=%v)", v, ok)
+	}
+	if v, ok := out.GetExtension(ExtensionType(200)); !ok || string(v) != "future" {
+		t.Errorf("Expected unknown extension to be kept, got %q (found=%v)", v, ok)
+	}
+}
+
+func TestDataPacketCodec_NoExtensionsKeepsLayout(t *testing.T) {
+	codec := &DataPacketCodec{}
+	data, err := codec.Serialize(&DataPacket{PacketTypeID: PacketTypeRequest.TypeID, MoreFragments: true, Payload: []byte("x")}, nil)
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	if len(data) != DataPacketHeaderSize+1 {
+		t.Errorf("Expected %d bytes, got %d", DataPacketHeaderSize+1, len(data))
+	}
+	if data[13] != 1 {
+		t.Errorf("Expected flags byte 1, got %d", data[13])
+	}
+}
+
+func TestDataPacketCodec_ExtensionBounds(t *testing.T) {
+	codec := &DataPacketCodec{}
+
+	p := &DataPacket{PacketTypeID: PacketTypeRequest.TypeID}
+	p.SetExtension(ExtensionTraceContext, make([]byte, MaxExtensionsSize))
+	if _, err := codec.Serialize(p, nil); err != ErrExtensionsTooLong {
+		t.Errorf("Expected ErrExtensionsTooLong, got %v", err)
+	}
+
+	p = &DataPacket{PacketTypeID: PacketTypeRequest.TypeID, Payload: []byte("x")}
+	p.SetExtension(ExtensionKeyID, []byte{1, 2, 3, 4})
+	data, err := codec.Serialize(p, nil)
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	// Corrupt the TLV length so it runs past the area
+	data[DataPacketHeaderSize+3] = 200
+	if _, err := codec.Deserialize(data); err != ErrMalformedTLV {
+		t.Errorf("Expected ErrMalformedTLV, got %v", err)
+	}
+}
+
+func TestCountHop(t *testing.T) {
+	origin := Origin{ID: 42, Hops: 1}
+	request := &DataPacket{PacketTypeID: PacketTypeRequest.TypeID, RPCID: 9, TotalPackets: 1, Payload: []byte("payload")}
+	request.SetExtension(ExtensionUserAgent, []byte("agent"))
+	request.SetExtension(ExtensionOrigin, origin.Value())
+	data, err := (&DataPacketCodec{}).Serialize(request, nil)
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+
+	next, ok := CountHop(data)
+	if !ok || next != (Origin{ID: 42, Hops: 2}) {
+		t.Fatalf("Expected origin 42 at hop 2, got %+v (%v)", next, ok)
+	}
+	decoded, err := (&DataPacketCodec{}).Deserialize(data)
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	if got, ok := FindOrigin(decoded.(*DataPacket).Extensions); !ok || got != next {
+		t.Errorf("Expected the datagram to carry %+v, got %+v (%v)", next, got, ok)
+	}
+
+	// Responses and requests without an origin are left alone
+	response := &DataPacket{PacketTypeID: PacketTypeResponse.TypeID, RPCID: 9, TotalPackets: 1, Payload: []byte("payload")}
+	response.SetExtension(ExtensionOrigin, origin.Value())
+	plain := &DataPacket{PacketTypeID: PacketTypeRequest.TypeID, RPCID: 9, TotalPackets: 1, Payload: []byte("payload")}
+	for _, pkt := range []*DataPacket{response, plain} {
+		data, err := (&DataPacketCodec{}).Serialize(pkt, nil)
+		if err != nil {
+			t.Fatalf("Serialize failed: %v", err)
+		}
+		if _, ok := CountHop(data); ok {
+			t.Errorf("Expected no hop counted for %+v", pkt)
+		}
+	}
+
+	// The hop count saturates
+	if got := (Origin{Hops: 255}).Next(); got.Hops != 255 {
+		t.Errorf("Expected the hop count to stop at 255, got %d", got.Hops)
+	}
+}
@@ -0,0 +1,94 @@
+package packet
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Offsets of the fields of a serialized DataPacket header, followed by the extensions if
+// FlagHasExtensions is set, then by the payload. They are part of the wire format and stable
+// across releases, for components that parse packets without this package, such as proxy
+// filters using cmd/libsymphony.
+const (
+	OffsetPacketType    = 0  // 1 byte
+	OffsetRPCID         = 1  // 8 bytes
+	OffsetTotalPackets  = 9  // 2 bytes
+	OffsetSeqNumber     = 11 // 2 bytes
+	OffsetFlags         = 13 // 1 byte
+	OffsetFragmentIndex = 14 // 1 byte
+	OffsetDstIP         = 15 // 4 bytes
+	OffsetDstPort       = 19 // 2 bytes
+	OffsetSrcIP         = 21 // 4 bytes
+	OffsetSrcPort       = 25 // 2 bytes
+	OffsetPayloadLen    = 27 // 4 bytes
+)
+
+// Offsets of the fields of a serialized ErrorPacket, whose message is followed by the retry
+// hint (ErrorTrailerSize bytes, the last of which older senders omit)
+const (
+	ErrorOffsetRPCID   = 1  // 8 bytes
+	ErrorOffsetDstIP   = 9  // 4 bytes
+	ErrorOffsetDstPort = 13 // 2 bytes
+	ErrorOffsetSrcIP   = 15 // 4 bytes
+	ErrorOffsetSrcPort = 19 // 2 bytes
+	ErrorOffsetMsgLen  = 21 // 4 bytes
+	ErrorHeaderSize    = 25
+	ErrorTrailerSize   = 5 // throttle, retry-after and drop reason
+)
+
+// Bits of the flags byte of a DataPacket
+const (
+	FlagMoreFragments = flagMoreFragments
+	FlagHasExtensions = flagHasExtensions
+)
+
+// Layout locates the variable-length parts of a serialized packet. Multi-byte integers of
+// the fixed header are little-endian.
+type Layout struct {
+	Error         bool // an ErrorPacket: Payload holds the error message
+	Extensions    int  // start of the extension TLVs, after the length of their area
+	ExtensionsLen int  // 0 without extensions
+	Payload       int
+	PayloadLen    int
+}
+
+var ErrMalformedPacket = errors.New("malformed packet")
+
+// ParseLayout locates the extensions and payload of a serialized packet, without copying
+// it. Packets of types Unknown and Error are ErrorPackets, those of other types are laid out
+// as DataPackets, as by DefaultRegistry.
+func ParseLayout(data []byte) (Layout, error) {
+	if len(data) == 0 {
+		return Layout{}, ErrMalformedPacket
+	}
+	switch PacketTypeID(data[0]) {
+	case PacketTypeUnknown.TypeID, PacketTypeError.TypeID:
+		if len(data) < ErrorHeaderSize+ErrorTrailerSize-1 {
+			return Layout{}, ErrMalformedPacket
+		}
+		msgLen := binary.LittleEndian.Uint32(data[ErrorOffsetMsgLen:])
+		if uint64(msgLen) > uint64(len(data)-ErrorHeaderSize-(ErrorTrailerSize-1)) {
+			return Layout{}, ErrMalformedPacket
+		}
+		return Layout{Error: true, Payload: ErrorHeaderSize, PayloadLen: int(msgLen)}, nil
+	}
+
+	if len(data) < DataPacketHeaderSize {
+		return Layout{}, ErrMalformedPacket
+	}
+	layout := Layout{Payload: DataPacketHeaderSize}
+	if data[OffsetFlags]&FlagHasExtensions != 0 {
+		_, size, err := parseExtensions(data[DataPacketHeaderSize:])
+		if err != nil {
+			return Layout{}, err
+		}
+		layout.Extensions, layout.ExtensionsLen = DataPacketHeaderSize+2, size-2
+		layout.Payload += size
+	}
+	payloadLen := binary.LittleEndian.Uint32(data[OffsetPayloadLen:])
+	if uint64(payloadLen) > uint64(len(data)-layout.Payload) {
+		return Layout{}, ErrMalformedPacket
+	}
+	layout.PayloadLen = int(payloadLen)
+	return layout, nil
+}
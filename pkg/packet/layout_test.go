@@ -0,0 +1,139 @@
+package packet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// packetVector is an RPC as serialized by the transport, checked by the implementations of
+// the wire format outside Go (see testdata/vectors.json)
+type packetVector struct {
+	Name    string   `json:"name"`
+	Packets []string `json:"packets"` // hex datagrams, in order
+	Layouts []struct {
+		Extensions []struct {
+			Type  uint8  `json:"type"`
+			Value string `json:"value"`
+		} `json:"extensions"`
+		PayloadOffset int `json:"payload_offset"`
+		PayloadLength int `json:"payload_length"`
+	} `json:"layouts"`
+	Type  uint8  `json:"type"`
+	RPCID uint64 `json:"rpc_id"`
+	Dst   string `json:"dst"`
+	Src   string `json:"src"`
+	Error string `json:"error"`
+
+	// Data packets needed to hold the public segment of the payload, which proxies read
+	PublicSegmentPackets int `json:"public_segment_packets"`
+}
+
+func loadPacketVectors(t *testing.T) []packetVector {
+	t.Helper()
+	data, err := os.ReadFile("testdata/vectors.json")
+	if err != nil {
+		t.Fatalf("Failed to read vectors: %v", err)
+	}
+	var vectors []packetVector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatalf("Failed to parse vectors: %v", err)
+	}
+	return vectors
+}
+
+func addrString(ip [4]byte, port uint16) string {
+	return fmt.Sprintf("%d.%d.%d.%d:%d", ip[0], ip[1], ip[2], ip[3], port)
+}
+
+func TestPacketVectors(t *testing.T) {
+	for _, v := range loadPacketVectors(t) {
+		t.Run(v.Name, func(t *testing.T) {
+			var payload []byte
+			for i, h := range v.Packets {
+				data, err := hex.DecodeString(h)
+				if err != nil {
+					t.Fatalf("Packet %d: %v", i, err)
+				}
+				layout, err := ParseLayout(data)
+				if err != nil {
+					t.Fatalf("Packet %d: ParseLayout failed: %v", i, err)
+				}
+				expected := v.Layouts[i]
+				if layout.Payload != expected.PayloadOffset || layout.PayloadLen != expected.PayloadLength || layout.Error != (v.Error != "") {
+					t.Errorf("Packet %d: ParseLayout() = %+v, want payload at %d of %d bytes", i, layout, expected.PayloadOffset, expected.PayloadLength)
+				}
+
+				codec, _ := DefaultRegistry.GetCodec(PacketTypeID(data[OffsetPacketType]))
+				decoded, err := codec.Deserialize(data)
+				if err != nil {
+					t.Fatalf("Packet %d: Deserialize failed: %v", i, err)
+				}
+				serialized, err := codec.Serialize(decoded, nil)
+				if err != nil || !bytes.Equal(serialized, data) {
+					t.Errorf("Packet %d: Serialize() = %x, %v, want the vector", i, serialized, err)
+				}
+
+				if p, ok := decoded.(*ErrorPacket); ok {
+					if p.RPCID != v.RPCID || p.ErrorMsg != v.Error || addrString(p.DstIP, p.DstPort) != v.Dst || addrString(p.SrcIP, p.SrcPort) != v.Src {
+						t.Errorf("Packet %d: got %+v", i, p)
+					}
+					if p.ErrorMsg != string(data[layout.Payload:layout.Payload+layout.PayloadLen]) {
+						t.Errorf("Packet %d: layout does not locate the error message", i)
+					}
+					continue
+				}
+				p := decoded.(*DataPacket)
+				if uint8(p.PacketTypeID) != v.Type || p.RPCID != v.RPCID || int(p.TotalPackets) != len(v.Packets) || int(p.SeqNumber) != i ||
+					addrString(p.DstIP, p.DstPort) != v.Dst || addrString(p.SrcIP, p.SrcPort) != v.Src {
+					t.Errorf("Packet %d: got %+v", i, p)
+				}
+				if !bytes.Equal(p.Payload, data[layout.Payload:layout.Payload+layout.PayloadLen]) {
+					t.Errorf("Packet %d: layout does not locate the payload", i)
+				}
+				if len(p.Extensions) != len(expected.Extensions) {
+					t.Fatalf("Packet %d: got %d extensions, want %d", i, len(p.Extensions), len(expected.Extensions))
+				}
+				for j, ext := range expected.Extensions {
+					if uint8(p.Extensions[j].Type) != ext.Type || hex.EncodeToString(p.Extensions[j].Value) != ext.Value {
+						t.Errorf("Packet %d: extension %d is %+v, want %+v", i, j, p.Extensions[j], ext)
+					}
+				}
+
+				payload = append(payload, p.Payload...)
+				if covered := len(payload) >= int(binary.LittleEndian.Uint32(payload[1:5])); covered != (i+1 >= v.PublicSegmentPackets) {
+					t.Errorf("Packet %d: public segment covered is %v with %d packets needed", i, covered, v.PublicSegmentPackets)
+				}
+			}
+		})
+	}
+}
+
+func TestParseLayout_Malformed(t *testing.T) {
+	p := &DataPacket{PacketTypeID: PacketTypeRequest.TypeID, Payload: []byte("payload")}
+	p.SetExtension(ExtensionPriority, []byte{1})
+	data, _ := (&DataPacketCodec{}).Serialize(p, nil)
+	errorData, _ := (&ErrorPacketCodec{}).Serialize(&ErrorPacket{PacketTypeID: PacketTypeError.TypeID, ErrorMsg: "failed"}, nil)
+
+	for name, data := range map[string][]byte{
+		"empty":                 nil,
+		"truncated header":      data[:DataPacketHeaderSize-1],
+		"truncated extensions":  data[:DataPacketHeaderSize+3],
+		"truncated payload":     data[:len(data)-1],
+		"truncated error":       errorData[:ErrorHeaderSize+3],
+		"truncated error trail": errorData[:len(errorData)-2],
+	} {
+		if _, err := ParseLayout(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// Senders predating drop reasons end error packets before it
+	if layout, err := ParseLayout(errorData[:len(errorData)-1]); err != nil || layout.PayloadLen != len("failed") {
+		t.Errorf("ParseLayout() = %+v, %v, want the message of an error packet without drop reason", layout, err)
+	}
+}
@@ -0,0 +1,63 @@
+package packet
+
+import "encoding/binary"
+
+// DefaultMaxHops is the hop count past which clients and proxies refuse a request as caught
+// in a routing loop
+const DefaultMaxHops = 16
+
+// OriginSize is the size of the value of the ExtensionOrigin extension
+const OriginSize = 9
+
+// Origin identifies the request a call descends from and counts the hops since: every proxy
+// forwarding a request and every server calling on while serving one adds a hop. Unlike a
+// trace context, it is carried by every request of aRPC clients, in the ExtensionOrigin
+// extension, so that routing cycles are caught even without tracing.
+type Origin struct {
+	ID   uint64 // RPC ID of the request the chain started with
+	Hops uint8
+}
+
+// Next returns the origin of the next hop. The hop count stops at 255.
+func (o Origin) Next() Origin {
+	if o.Hops < 255 {
+		o.Hops++
+	}
+	return o
+}
+
+// Value encodes the origin as the value of ExtensionOrigin: [ID(8B)][Hops(1B)]
+func (o Origin) Value() []byte {
+	return append(binary.LittleEndian.AppendUint64(make([]byte, 0, OriginSize), o.ID), o.Hops)
+}
+
+// FindOrigin returns the origin carried by the extensions of a packet
+func FindOrigin(exts []Extension) (Origin, bool) {
+	value, ok := FindExtension(exts, ExtensionOrigin)
+	if !ok || len(value) != OriginSize {
+		return Origin{}, false
+	}
+	return Origin{ID: binary.LittleEndian.Uint64(value), Hops: value[8]}, true
+}
+
+// CountHop adds a hop to the origin of a serialized request in place, so that forwarders
+// count themselves without decoding the packet, and returns the new origin. It returns false
+// for other packets and requests without an origin.
+func CountHop(data []byte) (Origin, bool) {
+	if len(data) < DataPacketHeaderSize || data[0] != byte(PacketTypeRequest.TypeID) || data[13]&flagHasExtensions == 0 {
+		return Origin{}, false
+	}
+	exts, _, err := parseExtensions(data[DataPacketHeaderSize:])
+	if err != nil {
+		return Origin{}, false
+	}
+	origin, ok := FindOrigin(exts)
+	if !ok {
+		return Origin{}, false
+	}
+	// Values are slices of data, so the hop count is updated in the datagram
+	value, _ := FindExtension(exts, ExtensionOrigin)
+	origin = origin.Next()
+	value[8] = origin.Hops
+	return origin, true
+}
@@ -0,0 +1,40 @@
+package packet
+
+import "time"
+
+// ThrottleState tells the client how the sender of an error packet is coping with load
+type ThrottleState uint8
+
+const (
+	ThrottleNone       ThrottleState = 0 // no load signal
+	ThrottleBackoff    ThrottleState = 1 // sender is shedding load; retry no earlier than RetryAfter
+	ThrottleOverloaded ThrottleState = 2 // sender is out of capacity; do not retry this call
+)
+
+func (s ThrottleState) String() string {
+	switch s {
+	case ThrottleNone:
+		return "none"
+	case ThrottleBackoff:
+		return "backoff"
+	case ThrottleOverloaded:
+		return "overloaded"
+	default:
+		return "unknown"
+	}
+}
+
+// MaxRetryAfter is the largest retry-after hint that can be carried by an error packet
+const MaxRetryAfter = time.Duration(1<<24-1) * time.Millisecond
+
+// RetryHint is the load signal a server or proxy attaches to an error packet so that
+// clients back off in a coordinated way instead of retrying in lockstep
+type RetryHint struct {
+	Throttle   ThrottleState
+	RetryAfter time.Duration // minimum wait before retrying (millisecond precision)
+}
+
+// IsZero reports whether the hint carries no load signal
+func (h RetryHint) IsZero() bool {
+	return h.Throttle == ThrottleNone && h.RetryAfter == 0
+}
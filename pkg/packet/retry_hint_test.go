@@ -0,0 +1,88 @@
+package packet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestErrorPacketCodec_RetryHint(t *testing.T) {
+	codec := &ErrorPacketCodec{}
+	in := &ErrorPacket{
+		PacketTypeID: PacketTypeError.TypeID,
+		RPCID:        42,
+		ErrorMsg:     "rate limited",
+		RetryHint:    RetryHint{Throttle: ThrottleBackoff, RetryAfter: 1500 * time.Millisecond},
+	}
+
+	data, err := codec.Serialize(in, nil)
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	if len(data) != 30+len(in.ErrorMsg) {
+		t.Errorf("Unexpected packet size %d", len(data))
+	}
+
+	outAny, err := codec.Deserialize(data)
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	out := outAny.(*ErrorPacket)
+	if out.ErrorMsg != in.ErrorMsg || out.RetryHint != in.RetryHint {
+		t.Errorf("Expected %q with hint %+v, got %q with hint %+v", in.ErrorMsg, in.RetryHint, out.ErrorMsg, out.RetryHint)
+	}
+
+	// Trailing bytes with an unknown throttle state are not a hint
+	data[25+len(in.ErrorMsg)] = 0xff
+	outAny, err = codec.Deserialize(data)
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	if hint := outAny.(*ErrorPacket).RetryHint; !hint.IsZero() {
+		t.Errorf("Expected no hint, got %+v", hint)
+	}
+
+	in.RetryAfter = MaxRetryAfter + time.Millisecond
+	if _, err := codec.Serialize(in, nil); err == nil {
+		t.Error("Expected error for out of range retry-after hint")
+	}
+}
+
+func TestErrorPacketCodec_DropReason(t *testing.T) {
+	codec := &ErrorPacketCodec{}
+	in := &ErrorPacket{
+		PacketTypeID: PacketTypeError.TypeID,
+		RPCID:        43,
+		ErrorMsg:     "denied by ACL",
+		DropReason:   DropReasonPolicyDenied,
+	}
+	data, err := codec.Serialize(in, nil)
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	outAny, err := codec.Deserialize(data)
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	if reason := outAny.(*ErrorPacket).DropReason; reason != DropReasonPolicyDenied {
+		t.Errorf("Expected %v, got %v", DropReasonPolicyDenied, reason)
+	}
+
+	// Packets of older senders end before the drop reason
+	outAny, err = codec.Deserialize(data[:len(data)-1])
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	if reason := outAny.(*ErrorPacket).DropReason; reason != DropReasonNone {
+		t.Errorf("Expected no drop reason, got %v", reason)
+	}
+
+	// Reasons of newer senders are not guessed at
+	data[len(data)-1] = 0xff
+	outAny, err = codec.Deserialize(data)
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	if reason := outAny.(*ErrorPacket).DropReason; reason != DropReasonNone {
+		t.Errorf("Expected an unknown drop reason to be ignored, got %v", reason)
+	}
+}
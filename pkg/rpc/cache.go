@@ -0,0 +1,135 @@
+package rpc
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/transport"
+)
+
+// ResponseCache is an LRU cache of call responses, bounded by entry count and total size.
+// Responses are cached only for calls made with WithCacheTTL, keyed by method and a hash of
+// the marshaled request, so only idempotent methods whose responses may be stale for the
+// TTL should use it.
+type ResponseCache struct {
+	maxEntries int // 0: no limit
+	maxBytes   int // 0: no limit
+	now        func() time.Time
+
+	mu      sync.Mutex
+	bytes   int
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[cacheKey]*list.Element
+}
+
+// cacheKey identifies the response to a request of a method
+type cacheKey struct {
+	service, method string
+	request         [sha256.Size]byte
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	data    []byte // marshaled response
+	expires time.Time
+}
+
+// NewResponseCache creates a cache holding at most maxEntries responses of at most maxBytes
+// in total (0: no limit). The least recently used responses are evicted first.
+func NewResponseCache(maxEntries, maxBytes int) *ResponseCache {
+	return &ResponseCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		now:        time.Now,
+		lru:        list.New(),
+		entries:    make(map[cacheKey]*list.Element),
+	}
+}
+
+func newCacheKey(service, method string, request []byte) cacheKey {
+	return cacheKey{service: service, method: method, request: sha256.Sum256(request)}
+}
+
+// Len returns the number of cached responses, including expired ones not evicted yet
+func (c *ResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Purge drops every cached response
+func (c *ResponseCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	clear(c.entries)
+	c.bytes = 0
+}
+
+// get returns the response cached for key, unless it expired
+func (c *ResponseCache) get(key cacheKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if c.now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.data, true
+}
+
+// put caches data as the response for key for ttl, evicting the least recently used
+// responses beyond the bounds. Responses larger than maxBytes are not cached.
+func (c *ResponseCache) put(key cacheKey, data []byte, ttl time.Duration) {
+	if c.maxBytes > 0 && len(data) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, data: data, expires: c.now().Add(ttl)})
+	c.bytes += len(data)
+	for (c.maxEntries > 0 && c.lru.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops an entry. It must be called with mu held.
+func (c *ResponseCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= len(entry.data)
+}
+
+// CallOption configures a single call of Client.Call
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	cacheTTL   time.Duration
+	encryption transport.EncryptionProfile
+}
+
+// WithCacheTTL serves the call from the client's response cache (see
+// Client.SetResponseCache) if a response to the same request is younger than ttl, without
+// sending anything. Otherwise the response is cached for ttl. Errors are never cached.
+// Without a response cache on the client it has no effect.
+func WithCacheTTL(ttl time.Duration) CallOption {
+	return func(o *callOptions) { o.cacheTTL = ttl }
+}
+
+// WithEncryptionProfile sets whether the call is encrypted. With transport.EncryptionRequired
+// the request is encrypted even if the client does not encrypt by default (see
+// WithEncryption), the server answers it encrypted as well, and the call fails if the
+// response was not encrypted.
+func WithEncryptionProfile(profile transport.EncryptionProfile) CallOption {
+	return func(o *callOptions) { o.encryption = profile }
+}
@@ -0,0 +1,109 @@
+package rpc
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/serializer"
+)
+
+func TestResponseCache_Eviction(t *testing.T) {
+	c := NewResponseCache(2, 0)
+	k1, k2, k3 := newCacheKey("KV", "Get", []byte("1")), newCacheKey("KV", "Get", []byte("2")), newCacheKey("KV", "Get", []byte("3"))
+	c.put(k1, []byte("one"), time.Minute)
+	c.put(k2, []byte("two"), time.Minute)
+	if _, ok := c.get(k1); !ok {
+		t.Fatal("Expected k1 to be cached")
+	}
+	// k2 is now the least recently used
+	c.put(k3, []byte("three"), time.Minute)
+	if _, ok := c.get(k2); ok {
+		t.Error("Expected k2 to be evicted")
+	}
+	for _, key := range []cacheKey{k1, k3} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("Expected %x to stay cached", key.request[:4])
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len returned %d, want 2", c.Len())
+	}
+
+	// Size bounds evict as well, and responses over the bound are not cached
+	c = NewResponseCache(0, 10)
+	c.put(k1, make([]byte, 6), time.Minute)
+	c.put(k2, make([]byte, 6), time.Minute)
+	if _, ok := c.get(k1); ok || c.Len() != 1 {
+		t.Errorf("Expected k1 to be evicted to fit k2, got %d entries", c.Len())
+	}
+	c.put(k3, make([]byte, 11), time.Minute)
+	if _, ok := c.get(k3); ok {
+		t.Error("Expected the response larger than maxBytes not to be cached")
+	}
+	c.Purge()
+	if c.Len() != 0 || c.bytes != 0 {
+		t.Errorf("Purge left %d entries of %d bytes", c.Len(), c.bytes)
+	}
+}
+
+func TestResponseCache_TTL(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := NewResponseCache(0, 0)
+	c.now = func() time.Time { return now }
+	key := newCacheKey("KV", "Get", []byte("1"))
+	c.put(key, []byte("one"), time.Second)
+
+	now = now.Add(time.Second)
+	if data, ok := c.get(key); !ok || string(data) != "one" {
+		t.Errorf("get returned %q, %v at the TTL, want the cached response", data, ok)
+	}
+	now = now.Add(time.Nanosecond)
+	if _, ok := c.get(key); ok {
+		t.Error("Expected the response to expire past its TTL")
+	}
+	if c.Len() != 0 {
+		t.Errorf("Len returned %d, want the expired response evicted", c.Len())
+	}
+}
+
+func TestResponseCache_Keys(t *testing.T) {
+	key := newCacheKey("KV", "Get", []byte("a"))
+	if key != newCacheKey("KV", "Get", []byte("a")) {
+		t.Error("Expected equal requests to share a key")
+	}
+	for _, other := range []cacheKey{
+		newCacheKey("KV", "Get", []byte("b")),
+		newCacheKey("KV", "Scan", []byte("a")),
+		newCacheKey("Store", "Get", []byte("a")),
+	} {
+		if other == key {
+			t.Errorf("Key %+v shared by different calls", other)
+		}
+	}
+
+	// Through the client: each different request reaches the server once
+	var calls atomic.Int32
+	mux := rawHandler("KV", "Get", func(ctx context.Context, req *serializer.RawMessage) (*serializer.RawMessage, error) {
+		calls.Add(1)
+		resp := append(serializer.RawMessage("value of "), *req...)
+		return &resp, nil
+	})
+	client := newTestClient(t, startServer(t, mux, nil), mux)
+	client.SetResponseCache(NewResponseCache(10, 0))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, req := range []string{"a", "b", "a", "b"} {
+		var resp serializer.RawMessage
+		if err := client.Call(ctx, "KV", "Get", serializer.RawMessage(req), &resp, WithCacheTTL(time.Minute)); err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+		if string(resp) != "value of "+req {
+			t.Errorf("Call(%s) returned %q, want the response to its own request", req, resp)
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Server handled %d calls, want one per distinct request", n)
+	}
+}
@@ -2,15 +2,23 @@
 package rpc
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"net"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/appnet-org/arpc/pkg/allocaudit"
+	sharedelement "github.com/appnet-org/arpc/pkg/element"
 	"github.com/appnet-org/arpc/pkg/logging"
 	"github.com/appnet-org/arpc/pkg/metadata"
 	"github.com/appnet-org/arpc/pkg/packet"
 	"github.com/appnet-org/arpc/pkg/rpc/element"
+	"github.com/appnet-org/arpc/pkg/rpc/stats"
 	"github.com/appnet-org/arpc/pkg/serializer"
 	"github.com/appnet-org/arpc/pkg/transport"
 	"go.uber.org/zap"
@@ -30,13 +38,30 @@ type Client struct {
 	metadataCodec   metadata.MetadataCodec
 	serviceRegistry *ServiceRegistry
 	defaultAddr     string
+	picker          Picker
+	statsHandler    stats.Handler
+	retryPolicy     *RetryPolicy
+	responseCache   *ResponseCache
 	rpcElementChain *element.RPCElementChain
+	proxyElements   []sharedelement.Element // run in-process, see SetProxyElements
+	startedElements []any                   // started by DialContext, shut down by Close
+
+	// Responses larger than this fail with a ResourceExhausted error (0: no limit)
+	maxRecvMsgSize int
+
+	// Connectivity state, and the stop channel of the keepalive probes if enabled
+	state         *connState
+	keepaliveMu   sync.Mutex
+	keepaliveStop chan struct{}
 
 	// Response dispatcher for handling concurrent calls
 	pendingCalls map[uint64]chan *responseData
 	pendingMu    sync.RWMutex
 	receiverDone chan struct{}
 	receiverOnce sync.Once
+
+	// Subscribers to the calls dropped by a proxy on the path
+	drops dropSubscribers
 }
 
 // NewClient creates a new Client using the given serializer and target address.
@@ -45,55 +70,34 @@ type Client struct {
 // enableEncryption: optional variadic parameter - if true, enables encryption using default keys
 func NewClient(serializer serializer.Serializer, addr string, rpcElements []element.RPCElement, enableEncryption ...bool) (*Client, error) {
 	// Use port 0 to let the OS assign an available port
-	t, err := transport.NewUDPTransport("0.0.0.0:0")
-	if err != nil {
-		return nil, err
-	}
-
-	// Enable encryption if requested (default: false for backward compatibility)
-	encrypt := false
-	if len(enableEncryption) > 0 && enableEncryption[0] {
-		encrypt = true
-	}
-	if encrypt {
-		logging.Info("Enabling encryption on client transport")
-		t.EnableEncryption()
-	}
-
-	c := &Client{
-		transport:       t,
-		serializer:      serializer,
-		metadataCodec:   metadata.MetadataCodec{},
-		serviceRegistry: NewServiceRegistry(),
-		defaultAddr:     addr,
-		rpcElementChain: element.NewRPCElementChain(rpcElements...),
-		pendingCalls:    make(map[uint64]chan *responseData),
-		receiverDone:    make(chan struct{}),
-	}
-	// Start the background receiver goroutine
-	go c.receiveLoop()
-	return c, nil
+	return newClient(serializer, addr, "0.0.0.0:0", rpcElements, len(enableEncryption) > 0 && enableEncryption[0])
 }
 
 // NewClientWithLocalAddr creates a new Client using the given serializer, target address, and local address.
 // This allows specifying a custom local UDP address to bind to.
 // enableEncryption: optional variadic parameter - if true, enables encryption using default keys (default: false)
 func NewClientWithLocalAddr(serializer serializer.Serializer, addr, localAddr string, rpcElements []element.RPCElement, enableEncryption ...bool) (*Client, error) {
+	return newClient(serializer, addr, localAddr, rpcElements, len(enableEncryption) > 0 && enableEncryption[0])
+}
+
+// newClient creates a Client bound to localAddr and starts its receiver goroutine
+func newClient(serializer serializer.Serializer, addr, localAddr string, rpcElements []element.RPCElement, encrypt bool) (*Client, error) {
 	t, err := transport.NewUDPTransport(localAddr)
 	if err != nil {
 		return nil, err
 	}
 
-	// Enable encryption if requested (default: false for backward compatibility)
-	encrypt := false
-	if len(enableEncryption) > 0 && enableEncryption[0] {
-		encrypt = true
-	}
+	// Encryption is disabled by default for backward compatibility
 	if encrypt {
 		logging.Info("Enabling encryption on client transport")
 		t.EnableEncryption()
 	}
 
+	// Fail calls fast on ICMP unreachable errors instead of waiting for a response
+	if err := t.EnableICMPErrors(); err != nil {
+		logging.Debug("ICMP errors not available on client transport", zap.Error(err))
+	}
+
 	c := &Client{
 		transport:       t,
 		serializer:      serializer,
@@ -101,6 +105,7 @@ func NewClientWithLocalAddr(serializer serializer.Serializer, addr, localAddr st
 		serviceRegistry: NewServiceRegistry(),
 		defaultAddr:     addr,
 		rpcElementChain: element.NewRPCElementChain(rpcElements...),
+		state:           newConnState(),
 		pendingCalls:    make(map[uint64]chan *responseData),
 		receiverDone:    make(chan struct{}),
 	}
@@ -109,6 +114,11 @@ func NewClientWithLocalAddr(serializer serializer.Serializer, addr, localAddr st
 	return c, nil
 }
 
+// ServiceRegistry returns the registry the client looks up service and method IDs in
+func (c *Client) ServiceRegistry() *ServiceRegistry {
+	return c.serviceRegistry
+}
+
 // Transport returns the underlying UDP transport for cleanup purposes
 func (c *Client) Transport() *transport.UDPTransport {
 	return c.transport
@@ -119,6 +129,34 @@ func (c *Client) SetServiceRegistry(registry *ServiceRegistry) {
 	c.serviceRegistry = registry
 }
 
+// SetPicker sets a picker that selects the destination of each call instead of the default address
+func (c *Client) SetPicker(picker Picker) {
+	c.picker = picker
+}
+
+// SetStatsHandler sets a handler that receives per-call statistics
+func (c *Client) SetStatsHandler(handler stats.Handler) {
+	c.statsHandler = handler
+}
+
+// SetRetryPolicy sets the policy used to retry failed calls (nil disables retries)
+func (c *Client) SetRetryPolicy(policy *RetryPolicy) {
+	c.retryPolicy = policy
+}
+
+// SetResponseCache sets the cache serving calls made with WithCacheTTL (nil disables caching)
+func (c *Client) SetResponseCache(cache *ResponseCache) {
+	c.responseCache = cache
+}
+
+// SetMaxRecvMsgSize limits the size of responses, in bytes, and advertises the limit to
+// servers in the header of each request. Servers answer calls whose response exceeds it
+// with an RPCResourceExhaustedError instead of sending the response. 0 removes the limit.
+func (c *Client) SetMaxRecvMsgSize(size int) {
+	c.maxRecvMsgSize = size
+	c.transport.SetRecvLimit(size)
+}
+
 // receiveLoop runs in a background goroutine and dispatches responses to pending calls
 func (c *Client) receiveLoop() {
 	for {
@@ -132,6 +170,14 @@ func (c *Client) receiveLoop() {
 		// Block on receive (this will block until data arrives or error occurs)
 		data, _, respID, packetType, err := c.transport.Receive(packet.MaxUDPPayloadSize, transport.RoleClient)
 
+		// Any answer shows that the server is reachable, an unreachable error that it is not
+		var icmpErr *transport.ICMPError
+		if data != nil {
+			c.state.set(Ready)
+		} else if errors.As(err, &icmpErr) && icmpErr.Unreachable() {
+			c.state.set(TransientFailure)
+		}
+
 		// Check if we should dispatch this response
 		if data != nil || err != nil {
 			c.pendingMu.RLock()
@@ -151,6 +197,9 @@ func (c *Client) receiveLoop() {
 					logging.Debug("Ignoring response with no pending call",
 						zap.Uint64("rpcID", respID))
 					c.transport.GetBufferPool().Put(data)
+					c.transport.TakeRetryHint(respID)
+					c.transport.TakeDropReason(respID)
+					c.transport.TakeCallEncrypted(respID)
 				}
 			}
 		}
@@ -169,15 +218,21 @@ func (c *Client) unregisterPendingCall(rpcID uint64) {
 	c.pendingMu.Lock()
 	delete(c.pendingCalls, rpcID)
 	c.pendingMu.Unlock()
+	allocaudit.Forget(rpcID)
 }
 
-func (c *Client) handleErrorPacket(ctx context.Context, data []byte, errType packet.PacketType) error {
+func (c *Client) handleErrorPacket(ctx context.Context, data []byte, rpcID uint64, errType packet.PacketType) error {
 	// Convert data to string for error message
 	errMsg := string(data)
 
 	// Return buffer to pool after converting to string
 	c.transport.GetBufferPool().Put(data)
 
+	// Pick up the load signal of the server or proxy, if it sent one
+	hint, _ := c.transport.TakeRetryHint(rpcID)
+	// and the reason a proxy dropped the call for
+	dropReason, _ := c.transport.TakeDropReason(rpcID)
+
 	// Create error response for RPC element processing
 	rpcResp := &element.RPCResponse{
 		Result: nil,
@@ -191,25 +246,47 @@ func (c *Client) handleErrorPacket(ctx context.Context, data []byte, errType pac
 	}
 
 	var rpcErrType RPCErrorType
-	if errType == packet.PacketTypeError {
+	if errType == packet.PacketTypeError && (dropReason == packet.DropReasonUnavailable || strings.HasPrefix(errMsg, transport.UnavailableErrorPrefix)) {
+		// A proxy on the path got an ICMP unreachable error for the forwarded request
+		rpcErrType = RPCUnavailableError
+	} else if errType == packet.PacketTypeError && strings.HasPrefix(errMsg, ResourceExhaustedErrorPrefix) {
+		rpcErrType = RPCResourceExhaustedError
+	} else if errType == packet.PacketTypeError && strings.HasPrefix(errMsg, DeadlineExceededErrorPrefix) {
+		rpcErrType = RPCDeadlineExceededError
+	} else if errType == packet.PacketTypeError && (dropReason == packet.DropReasonAuthFailed || strings.HasPrefix(errMsg, UnauthenticatedErrorPrefix)) {
+		rpcErrType = RPCUnauthenticatedError
+	} else if errType == packet.PacketTypeError && dropReason != packet.DropReasonNone {
+		rpcErrType = RPCDroppedError
+	} else if errType == packet.PacketTypeError {
 		rpcErrType = RPCFailError
 	} else {
 		rpcErrType = RPCUnknownError
 	}
-	return &RPCError{Type: rpcErrType, Reason: errMsg}
+	return &RPCError{Type: rpcErrType, Reason: errMsg, RetryHint: hint, DropReason: dropReason}
 }
 
 func (c *Client) handleResponsePacket(ctx context.Context, data []byte, rpcID uint64, resp any) error {
+	// Servers that do not know the receive limit extension send responses of any size
+	if c.maxRecvMsgSize > 0 && len(data) > c.maxRecvMsgSize {
+		c.transport.GetBufferPool().Put(data)
+		return newTooLargeError("response", len(data), c.maxRecvMsgSize)
+	}
+
 	// Data is already the raw payload, no framing to parse
 	// Deserialize the response into resp
-	if err := c.serializer.Unmarshal(data, resp); err != nil {
+	mark := allocaudit.Start()
+	if err := serializer.UnmarshalMessage(c.serializer, data, resp); err != nil {
 		// Return buffer to pool on unmarshal error
 		c.transport.GetBufferPool().Put(data)
 		return fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
-	// Return buffer to pool after unmarshaling (unmarshaler has copied what it needs)
-	c.transport.GetBufferPool().Put(data)
+	// Return buffer to pool after unmarshaling (unmarshaler has copied what it needs). With
+	// the unsafe fast path, decoded strings and bytes alias the buffer, so it is left to the GC.
+	if !serializer.UnsafeFastPath {
+		c.transport.GetBufferPool().Put(data)
+	}
+	mark.Finish(allocaudit.PathReceive, rpcID, 0)
 
 	logging.Debug("Successfully received response", zap.Uint64("rpcID", rpcID))
 
@@ -229,11 +306,79 @@ func (c *Client) handleResponsePacket(ctx context.Context, data []byte, rpcID ui
 	return rpcResp.Error
 }
 
-// Call makes an RPC call with RPC element processing
-func (c *Client) Call(ctx context.Context, service, method string, req any, resp any) error {
+// Call makes an RPC call with RPC element processing.
+// Failed attempts are retried according to the client's retry policy, if any.
+func (c *Client) Call(ctx context.Context, service, method string, req any, resp any, opts ...CallOption) (err error) {
+	var o callOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Cache hits skip the network, elements and stats handler entirely
+	cache := c.responseCache
+	var key cacheKey
+	if o.cacheTTL > 0 && cache != nil {
+		reqBytes, err := serializer.MarshalMessage(c.serializer, req)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		key = newCacheKey(service, method, reqBytes)
+		if data, ok := cache.get(key); ok {
+			// With the unsafe fast path, resp aliases what it is decoded from, which must
+			// not be the shared cache entry
+			if serializer.UnsafeFastPath {
+				data = bytes.Clone(data)
+			}
+			return serializer.UnmarshalMessage(c.serializer, data, resp)
+		}
+		defer func() {
+			if err != nil {
+				return
+			}
+			if data, marshalErr := serializer.MarshalMessage(c.serializer, resp); marshalErr == nil {
+				cache.put(key, data, o.cacheTTL)
+			}
+		}()
+	}
 
 	rpcReqID := transport.GenerateRPCID()
 
+	// Report call start/end to the stats handler, if any
+	if c.statsHandler != nil {
+		ctx = c.statsHandler.TagRPC(ctx, &stats.RPCTagInfo{Service: service, Method: method})
+		beginTime := time.Now()
+		c.statsHandler.HandleRPC(ctx, &stats.Begin{RPCID: rpcReqID, Service: service, Method: method, BeginTime: beginTime})
+		statsCtx := ctx
+		defer func() {
+			c.statsHandler.HandleRPC(statsCtx, &stats.End{RPCID: rpcReqID, BeginTime: beginTime, EndTime: time.Now(), Error: err})
+		}()
+	}
+
+	err = c.call(ctx, rpcReqID, service, method, req, resp, o.encryption)
+	for retry := 1; err != nil && c.retryPolicy != nil; retry++ {
+		delay, ok := c.retryPolicy.backoff(retry, err)
+		if !ok {
+			break
+		}
+		logging.Debug("Retrying call",
+			zap.Uint64("rpcID", rpcReqID),
+			zap.Int("retry", retry),
+			zap.Duration("backoff", delay),
+			zap.Error(err))
+		if !waitForRetry(ctx, delay) {
+			break
+		}
+		if c.statsHandler != nil {
+			c.statsHandler.HandleRPC(ctx, &stats.Retry{RPCID: rpcReqID, Attempt: retry, Error: err, Backoff: delay})
+		}
+		// Each attempt gets a new RPC ID so that proxies do not apply the verdict of the previous one
+		err = c.call(ctx, transport.GenerateRPCID(), service, method, req, resp, o.encryption)
+	}
+	return err
+}
+
+// call makes a single attempt of an RPC call, encrypted as profile says
+func (c *Client) call(ctx context.Context, rpcReqID uint64, service, method string, req any, resp any, profile transport.EncryptionProfile) error {
 	// Create request with service and method information
 	rpcReq := &element.RPCRequest{
 		ServiceName: service,
@@ -249,7 +394,8 @@ func (c *Client) Call(ctx context.Context, service, method string, req any, resp
 	}
 
 	// Serialize the request payload
-	reqPayloadBytes, err := c.serializer.Marshal(rpcReq.Payload)
+	mark := allocaudit.Start()
+	reqPayloadBytes, err := serializer.MarshalMessage(c.serializer, rpcReq.Payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request: %w", err)
 	}
@@ -275,17 +421,73 @@ func (c *Client) Call(ctx context.Context, service, method string, req any, resp
 	c.registerPendingCall(rpcReq.ID, respChan)
 	defer c.unregisterPendingCall(rpcReq.ID)
 
+	// Pick the destination address (default address unless a picker is configured)
+	addr := c.defaultAddr
+	if c.picker != nil {
+		pickedAddr, done, err := c.picker.Pick(reqPayloadBytes)
+		if err != nil {
+			return fmt.Errorf("failed to pick destination: %w", err)
+		}
+		if done != nil {
+			defer done()
+		}
+		addr = pickedAddr
+	}
+
+	// Run the proxy elements of deployments without a sidecar
+	encrypted := c.transport.IsEncryptionEnabled() || profile == transport.EncryptionRequired
+	var dst net.Addr
+	if len(c.proxyElements) > 0 {
+		reqPayloadBytes, addr, dst, err = c.interceptRequest(ctx, rpcReq.ID, addr, reqPayloadBytes, encrypted)
+		var reply *localReply
+		if errors.As(err, &reply) {
+			return c.handleLocalReply(ctx, rpcReq.ID, reply, resp)
+		}
+		if err != nil {
+			c.notifyDrop(rpcReq.ID, rpcReq.ServiceName, rpcReq.Method, err)
+			return err
+		}
+	}
+
+	// Chain the call to the request the caller serves, if any
+	origin, err := callOrigin(ctx, rpcReq.ID)
+	if err != nil {
+		logging.Warn("Refusing call past the hop limit",
+			zap.Uint64("rpcID", rpcReq.ID),
+			zap.Uint64("originID", origin.ID),
+			zap.Uint8("hops", origin.Hops))
+		c.notifyDrop(rpcReq.ID, rpcReq.ServiceName, rpcReq.Method, err)
+		return err
+	}
+
 	// Send the payload directly (no framing)
-	err = c.transport.Send(c.defaultAddr, rpcReq.ID, reqPayloadBytes, packet.PacketTypeRequest)
+	fragments, err := c.transport.SendRequest(addr, rpcReq.ID, reqPayloadBytes, profile, origin)
 	if err != nil {
+		c.state.set(TransientFailure)
 		return fmt.Errorf("failed to send request: %w", err)
 	}
+	mark.Finish(allocaudit.PathSend, rpcReq.ID, fragments)
+	if c.statsHandler != nil {
+		c.statsHandler.HandleRPC(ctx, &stats.OutPayload{RPCID: rpcReq.ID, Bytes: len(reqPayloadBytes), Fragments: fragments, Origin: origin, SentTime: time.Now()})
+	}
 
-	// Wait for the response from the dispatcher
-	respData := <-respChan
+	// Wait for the response from the dispatcher, or until the call is canceled
+	var respData *responseData
+	select {
+	case respData = <-respChan:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if c.statsHandler != nil && respData.data != nil {
+		c.statsHandler.HandleRPC(ctx, &stats.InPayload{RPCID: rpcReq.ID, Bytes: len(respData.data), RecvTime: time.Now()})
+	}
 
 	// Check for receive error
 	if respData.err != nil {
+		var icmpErr *transport.ICMPError
+		if errors.As(respData.err, &icmpErr) {
+			return &RPCError{Type: RPCUnavailableError, Reason: icmpErr.Error(), Cause: icmpErr}
+		}
 		return fmt.Errorf("failed to receive response: %w", respData.err)
 	}
 
@@ -297,10 +499,26 @@ func (c *Client) Call(ctx context.Context, service, method string, req any, resp
 	// Process the packet based on its type
 	switch respData.packetType {
 	case packet.PacketTypeResponse:
-		return c.handleResponsePacket(ctx, respData.data, rpcReq.ID, resp)
+		data := respData.data
+		// A server or proxy that responds in plaintext to a call that required encryption
+		// would leak the response, so the call fails rather than accept it
+		responseEncrypted := c.transport.IsEncryptionEnabled() || c.transport.TakeCallEncrypted(rpcReq.ID)
+		if encrypted && !responseEncrypted {
+			c.transport.GetBufferPool().Put(data)
+			return &RPCError{Type: RPCFailError, Reason: "response to a call requiring encryption was not encrypted"}
+		}
+		if len(c.proxyElements) > 0 {
+			if data, err = c.interceptResponse(ctx, rpcReq.ID, dst, data, responseEncrypted); err != nil {
+				c.notifyDrop(rpcReq.ID, rpcReq.ServiceName, rpcReq.Method, err)
+				return err
+			}
+		}
+		return c.handleResponsePacket(ctx, data, rpcReq.ID, resp)
 	case packet.PacketTypeError, packet.PacketTypeUnknown:
 		// handleErrorPacket will return the buffer to pool
-		return c.handleErrorPacket(ctx, respData.data, respData.packetType)
+		err := c.handleErrorPacket(ctx, respData.data, rpcReq.ID, respData.packetType)
+		c.notifyDrop(rpcReq.ID, rpcReq.ServiceName, rpcReq.Method, err)
+		return err
 	default:
 		logging.Debug("Ignoring packet with unknown type", zap.String("packetType", respData.packetType.Name))
 		// Return buffer to pool for unknown packet type
@@ -343,13 +561,17 @@ func (c *Client) GetTransport() *transport.UDPTransport {
 	return c.transport
 }
 
-// Close closes the client and stops the background receiver goroutine
+// Close closes the client and stops the background receiver goroutine and keepalive probes.
+// Later calls do nothing.
 func (c *Client) Close() error {
-	// Signal the receiver goroutine to stop (only once)
+	c.state.set(Shutdown)
+
+	// Signal the receiver goroutine to stop and close the transport (only once)
+	var err error
 	c.receiverOnce.Do(func() {
 		close(c.receiverDone)
+		c.shutdownProxyElements()
+		err = c.transport.Close()
 	})
-
-	// Close the transport
-	return c.transport.Close()
+	return err
 }
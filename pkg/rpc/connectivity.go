@@ -0,0 +1,166 @@
+package rpc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/transport"
+)
+
+// ConnectivityState is the state of a client's path to its servers. UDP has no connection,
+// so it is inferred from what comes back: answers to calls and keepalive probes, send
+// errors, and ICMP unreachable errors.
+type ConnectivityState int
+
+const (
+	// Connecting: nothing has been heard from a server yet
+	Connecting ConnectivityState = iota
+	// Ready: the last outcome was an answer from a server (a response or an error packet)
+	Ready
+	// TransientFailure: the last outcome was a send error, an unreachable destination or an
+	// unanswered keepalive probe. Calls are still attempted; an answer makes the client Ready.
+	TransientFailure
+	// Shutdown: the client was closed
+	Shutdown
+)
+
+func (s ConnectivityState) String() string {
+	switch s {
+	case Connecting:
+		return "CONNECTING"
+	case Ready:
+		return "READY"
+	case TransientFailure:
+		return "TRANSIENT_FAILURE"
+	case Shutdown:
+		return "SHUTDOWN"
+	default:
+		return "INVALID_STATE"
+	}
+}
+
+// keepaliveServiceID is the service ID of keepalive probes. Services are numbered from 1,
+// so it never reaches a handler: servers echo the probe back as a response.
+const keepaliveServiceID = 0
+
+// keepaliveProbeSize is the size of a probe: the Symphony reserved header carrying the IDs
+const keepaliveProbeSize = 13
+
+// connState holds the connectivity state of a client and wakes up its watchers on changes
+type connState struct {
+	mu      sync.Mutex
+	state   ConnectivityState
+	changed chan struct{} // closed and replaced on every change
+}
+
+func newConnState() *connState {
+	return &connState{state: Connecting, changed: make(chan struct{})}
+}
+
+// get returns the current state and a channel closed when it changes
+func (s *connState) get() (ConnectivityState, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state, s.changed
+}
+
+// set moves to state. Shutdown is final.
+func (s *connState) set(state ConnectivityState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == state || s.state == Shutdown {
+		return
+	}
+	s.state = state
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// State returns the connectivity state of the client
+func (c *Client) State() ConnectivityState {
+	state, _ := c.state.get()
+	return state
+}
+
+// WaitForStateChange blocks until the state of the client differs from source, returning
+// true, or until ctx is done, returning false. Like grpc.ClientConn, watchers call State
+// and WaitForStateChange in a loop to follow every change.
+func (c *Client) WaitForStateChange(ctx context.Context, source ConnectivityState) bool {
+	for {
+		state, changed := c.state.get()
+		if state != source {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// SetKeepalive makes the client probe its default address every interval, so its state
+// reflects the reachability of the server between calls. A probe unanswered within timeout
+// moves the client to TransientFailure. An interval of 0 stops the probes.
+func (c *Client) SetKeepalive(interval, timeout time.Duration) {
+	c.keepaliveMu.Lock()
+	defer c.keepaliveMu.Unlock()
+	if c.keepaliveStop != nil {
+		close(c.keepaliveStop)
+		c.keepaliveStop = nil
+	}
+	if interval <= 0 {
+		return
+	}
+	c.keepaliveStop = make(chan struct{})
+	go c.keepaliveLoop(interval, timeout, c.keepaliveStop)
+}
+
+// keepaliveLoop sends a probe every interval until stop or the client is closed
+func (c *Client) keepaliveLoop(interval, timeout time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.probe(timeout, stop)
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		case <-c.receiverDone:
+			return
+		}
+	}
+}
+
+// probe sends a keepalive probe and waits for its answer. The receive loop updates the
+// state when the answer (or an ICMP error) arrives; probe only accounts for silence.
+func (c *Client) probe(timeout time.Duration, stop <-chan struct{}) {
+	rpcID := transport.GenerateRPCID()
+	respChan := make(chan *responseData, 1)
+	c.registerPendingCall(rpcID, respChan)
+	defer c.unregisterPendingCall(rpcID)
+
+	// Service and method IDs are zero
+	probe := make([]byte, keepaliveProbeSize)
+	if _, err := c.transport.SendWithFragmentCount(c.defaultAddr, rpcID, probe, packet.PacketTypeRequest); err != nil {
+		c.state.set(TransientFailure)
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case respData := <-respChan:
+		if respData.data != nil {
+			c.transport.GetBufferPool().Put(respData.data)
+			c.transport.TakeRetryHint(rpcID)
+			c.transport.TakeDropReason(rpcID)
+		}
+	case <-timer.C:
+		c.state.set(TransientFailure)
+	case <-stop:
+	case <-c.receiverDone:
+	}
+}
@@ -0,0 +1,102 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// closed tells whether a change channel of connState was closed
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestConnState(t *testing.T) {
+	s := newConnState()
+	state, changed := s.get()
+	if state != Connecting {
+		t.Fatalf("Initial state is %v, want CONNECTING", state)
+	}
+
+	for _, next := range []ConnectivityState{Ready, TransientFailure, Ready, Shutdown} {
+		s.set(next)
+		if !closed(changed) {
+			t.Errorf("Moving to %v did not notify the watchers", next)
+		}
+		if state, changed = s.get(); state != next {
+			t.Errorf("State is %v, want %v", state, next)
+		}
+	}
+
+	// Setting the current state is not a change, and Shutdown is final
+	s.set(Shutdown)
+	s.set(Ready)
+	if state, _ = s.get(); state != Shutdown || closed(changed) {
+		t.Errorf("State moved to %v after Shutdown", state)
+	}
+
+	for state, want := range map[ConnectivityState]string{Connecting: "CONNECTING", Ready: "READY", TransientFailure: "TRANSIENT_FAILURE", Shutdown: "SHUTDOWN", 9: "INVALID_STATE"} {
+		if state.String() != want {
+			t.Errorf("String of state %d is %s, want %s", int(state), state, want)
+		}
+	}
+}
+
+func TestClient_Connectivity(t *testing.T) {
+	mux := NewMux()
+	server := startServer(t, mux, nil)
+	client := newTestClient(t, server, mux)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A watcher following every change
+	states := make(chan ConnectivityState, 10)
+	state := client.State()
+	if state != Connecting {
+		t.Fatalf("State of a new client is %v, want CONNECTING", state)
+	}
+	go func() {
+		defer close(states)
+		for state != Shutdown && client.WaitForStateChange(ctx, state) {
+			state = client.State()
+			states <- state
+		}
+	}()
+	next := func(want ConnectivityState) {
+		t.Helper()
+		select {
+		case state := <-states:
+			if state != want {
+				t.Fatalf("Watcher saw %v, want %v", state, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for %v", want)
+		}
+	}
+
+	// Answered probes make the client Ready
+	client.SetKeepalive(10*time.Millisecond, 100*time.Millisecond)
+	next(Ready)
+
+	// Unanswered (or unreachable) probes fail the path
+	server.Stop()
+	next(TransientFailure)
+
+	client.SetKeepalive(0, 0)
+	client.Close()
+	next(Shutdown)
+	if _, ok := <-states; ok {
+		t.Error("Watcher saw a change after Shutdown")
+	}
+
+	expired, cancelExpired := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelExpired()
+	if client.WaitForStateChange(expired, Shutdown) {
+		t.Error("WaitForStateChange returned true without a change")
+	}
+}
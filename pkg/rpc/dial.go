@@ -0,0 +1,143 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sharedelement "github.com/appnet-org/arpc/pkg/element"
+	"github.com/appnet-org/arpc/pkg/rpc/element"
+	"github.com/appnet-org/arpc/pkg/serializer"
+)
+
+// UserAgentKey is the incoming metadata key under which servers expose the user agent a
+// client set with WithUserAgent
+const UserAgentKey = "user-agent"
+
+// dialProbeTimeout is how long a blocking Dial waits for the answer to each probe
+const dialProbeTimeout = 250 * time.Millisecond
+
+// dialOptions holds the settings of Dial
+type dialOptions struct {
+	serializer serializer.Serializer
+	localAddr  string
+	elements   []element.RPCElement
+	proxy      []sharedelement.Element
+	encryption bool
+	block      bool
+	timeout    time.Duration
+	userAgent  string
+	flowPorts  int
+}
+
+// DialOption configures a client created by Dial
+type DialOption func(*dialOptions)
+
+// WithSerializer sets the codec of requests and responses (default: Symphony)
+func WithSerializer(s serializer.Serializer) DialOption {
+	return func(o *dialOptions) { o.serializer = s }
+}
+
+// WithLocalAddr binds the client to a local UDP address (default: any available port)
+func WithLocalAddr(addr string) DialOption {
+	return func(o *dialOptions) { o.localAddr = addr }
+}
+
+// WithElements sets the RPC elements that process the calls of the client
+func WithElements(elements ...element.RPCElement) DialOption {
+	return func(o *dialOptions) { o.elements = elements }
+}
+
+// WithProxyElements runs elements of the proxy interface in the client, see
+// Client.SetProxyElements. Elements implementing the lifecycle hooks of pkg/element are
+// started by DialContext, which fails if one fails to start, and shut down by Client.Close.
+func WithProxyElements(elements ...sharedelement.Element) DialOption {
+	return func(o *dialOptions) { o.proxy = elements }
+}
+
+// WithEncryption enables encryption with the default keys
+func WithEncryption() DialOption {
+	return func(o *dialOptions) { o.encryption = true }
+}
+
+// WithBlock makes Dial return only once the server answered a keepalive probe, so an
+// unreachable or mistyped target fails at construction instead of at the first call
+func WithBlock() DialOption {
+	return func(o *dialOptions) { o.block = true }
+}
+
+// WithTimeout bounds how long a blocking Dial waits for the server. Without WithBlock it
+// has no effect.
+func WithTimeout(timeout time.Duration) DialOption {
+	return func(o *dialOptions) { o.timeout = timeout }
+}
+
+// WithUserAgent sets a string identifying the client, of at most packet.MaxUserAgentSize
+// bytes, sent with every request. Handlers read it from the incoming metadata under
+// UserAgentKey.
+func WithUserAgent(userAgent string) DialOption {
+	return func(o *dialOptions) { o.userAgent = userAgent }
+}
+
+// WithFlowPorts sends the packets of each call from one of n additional local ports, picked
+// by RPC ID, so that L4 load balancers in front of proxy replicas send all fragments of a call
+// to the same replica while spreading calls over the replicas. Responses still arrive at the
+// client's address. See transport.UDPTransport.SetFlowPorts.
+func WithFlowPorts(n int) DialOption {
+	return func(o *dialOptions) { o.flowPorts = n }
+}
+
+// Dial creates a client for target. It is DialContext with a background context.
+func Dial(target string, opts ...DialOption) (*Client, error) {
+	return DialContext(context.Background(), target, opts...)
+}
+
+// DialContext creates a client for target configured by opts. With WithBlock, it waits
+// until the server answers a probe, ctx is done or the WithTimeout timeout expires, and
+// fails with an RPCUnavailableError in the latter two cases.
+func DialContext(ctx context.Context, target string, opts ...DialOption) (*Client, error) {
+	o := dialOptions{serializer: &serializer.SymphonySerializer{}, localAddr: "0.0.0.0:0"}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	c, err := newClient(o.serializer, target, o.localAddr, o.elements, o.encryption)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.startProxyElements(ctx, o.proxy); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := c.transport.SetUserAgent(o.userAgent); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := c.transport.SetFlowPorts(o.flowPorts); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if !o.block {
+		return c, nil
+	}
+
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+	for {
+		start := time.Now()
+		c.probe(dialProbeTimeout, ctx.Done())
+		if c.State() == Ready {
+			return c, nil
+		}
+		// Pace probes that failed fast, on send or unreachable errors
+		select {
+		case <-time.After(dialProbeTimeout - time.Since(start)):
+		case <-ctx.Done():
+			c.Close()
+			return nil, &RPCError{Type: RPCUnavailableError, Reason: fmt.Sprintf("no answer from %s", target), Cause: ctx.Err()}
+		}
+	}
+}
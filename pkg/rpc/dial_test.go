@@ -0,0 +1,174 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sharedelement "github.com/appnet-org/arpc/pkg/element"
+	"github.com/appnet-org/arpc/pkg/metadata"
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/rpc/element"
+	"github.com/appnet-org/arpc/pkg/serializer"
+)
+
+// countingElement is an RPC element counting the requests of the client
+type countingElement struct {
+	requests atomic.Int32
+}
+
+func (e *countingElement) ProcessRequest(ctx context.Context, req *element.RPCRequest) (*element.RPCRequest, context.Context, error) {
+	e.requests.Add(1)
+	return req, ctx, nil
+}
+
+func (e *countingElement) ProcessResponse(ctx context.Context, resp *element.RPCResponse) (*element.RPCResponse, context.Context, error) {
+	return resp, ctx, nil
+}
+
+func (e *countingElement) Name() string {
+	return "counting"
+}
+
+// hookedProxyElement is a proxy element passing messages through, recording its lifecycle
+type hookedProxyElement struct {
+	startErr          error
+	started, shutdown atomic.Bool
+	requests          atomic.Int32
+}
+
+func (e *hookedProxyElement) ProcessRequest(ctx context.Context, msg *sharedelement.Message) (*sharedelement.Message, sharedelement.Verdict, context.Context, error) {
+	e.requests.Add(1)
+	return msg, sharedelement.VerdictPass, ctx, nil
+}
+
+func (e *hookedProxyElement) ProcessResponse(ctx context.Context, msg *sharedelement.Message) (*sharedelement.Message, sharedelement.Verdict, context.Context, error) {
+	return msg, sharedelement.VerdictPass, ctx, nil
+}
+
+func (e *hookedProxyElement) Name() string {
+	return "hooked"
+}
+
+func (e *hookedProxyElement) OnStart(ctx context.Context) error {
+	e.started.Store(true)
+	return e.startErr
+}
+
+func (e *hookedProxyElement) OnShutdown(ctx context.Context) error {
+	e.shutdown.Store(true)
+	return nil
+}
+
+// unusedAddr returns a loopback address nothing listens on
+func unusedAddr(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().String()
+}
+
+func TestDial_Options(t *testing.T) {
+	// The handler answers with the user agent of the call
+	mux := rawHandler("Test", "UserAgent", func(ctx context.Context, req *serializer.RawMessage) (*serializer.RawMessage, error) {
+		resp := serializer.RawMessage(metadata.FromIncomingContext(ctx).Get(UserAgentKey))
+		return &resp, nil
+	})
+	server := startServer(t, mux, nil)
+	counter, proxy := &countingElement{}, &hookedProxyElement{}
+	client, err := Dial(server.GetTransport().LocalAddr().String(),
+		WithSerializer(&serializer.SymphonySerializer{}),
+		WithLocalAddr("127.0.0.1:0"),
+		WithElements(counter),
+		WithProxyElements(proxy),
+		WithUserAgent("test-client/1.0"),
+		WithFlowPorts(2),
+		WithBlock(),
+		WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+	client.SetServiceRegistry(mux.Registry())
+
+	// A blocking dial returns once the server answered
+	if state := client.State(); state != Ready {
+		t.Errorf("State after a blocking Dial is %v, want READY", state)
+	}
+	if ip := client.Transport().LocalAddr().IP; !ip.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("Client bound to %v, want 127.0.0.1", ip)
+	}
+	if !proxy.started.Load() {
+		t.Error("Expected Dial to start the proxy elements")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var resp serializer.RawMessage
+	if err := client.Call(ctx, "Test", "UserAgent", serializer.RawMessage("x"), &resp); err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if string(resp) != "test-client/1.0" {
+		t.Errorf("Server saw user agent %q, want test-client/1.0", resp)
+	}
+	if counter.requests.Load() != 1 || proxy.requests.Load() != 1 {
+		t.Errorf("Elements saw %d and %d requests, want 1 each", counter.requests.Load(), proxy.requests.Load())
+	}
+
+	client.Close()
+	if !proxy.shutdown.Load() {
+		t.Error("Expected Close to shut the proxy elements down")
+	}
+
+	// Without WithBlock, Dial does not wait for the server
+	client, err = Dial(unusedAddr(t), WithEncryption())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+	if client.State() != Connecting || !client.Transport().IsEncryptionEnabled() {
+		t.Errorf("Got state %v, encryption %v, want a CONNECTING client with encryption", client.State(), client.Transport().IsEncryptionEnabled())
+	}
+}
+
+func TestDial_Errors(t *testing.T) {
+	startErr := errors.New("no config")
+	for _, tc := range []struct {
+		name string
+		opts []DialOption
+		err  string
+	}{
+		{"invalid local address", []DialOption{WithLocalAddr("not an address")}, "not an address"},
+		{"long user agent", []DialOption{WithUserAgent(strings.Repeat("x", packet.MaxUserAgentSize+1))}, "exceeds"},
+		{"negative flow ports", []DialOption{WithFlowPorts(-1)}, "flow ports"},
+		{"failing proxy element", []DialOption{WithProxyElements(&hookedProxyElement{startErr: startErr})}, "no config"},
+	} {
+		if _, err := Dial(unusedAddr(t), tc.opts...); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: Dial returned %v, want an error containing %q", tc.name, err, tc.err)
+		}
+	}
+
+	// A blocking dial of an unanswering target fails once the timeout or context expires
+	start := time.Now()
+	_, err := Dial(unusedAddr(t), WithBlock(), WithTimeout(300*time.Millisecond))
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Type != RPCUnavailableError || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Dial returned %v, want an RPCUnavailableError caused by the timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("Dial gave up after %v, want about the 300ms timeout", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := DialContext(ctx, unusedAddr(t), WithBlock()); !errors.As(err, &rpcErr) || !errors.Is(err, context.Canceled) {
+		t.Errorf("DialContext returned %v with a canceled context, want an RPCUnavailableError", err)
+	}
+}
@@ -0,0 +1,193 @@
+package rpc
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PeerLoad is a snapshot of the requests of one client being handled by the server
+type PeerLoad struct {
+	InFlight int // requests whose handler is running
+	Queued   int // requests waiting for a worker
+}
+
+// dispatcher runs server calls on a pool of workers. Each client (by peer address) has its
+// own FIFO queue, and workers take calls from the queues in turn, so a client pipelining
+// many requests gets one worker per round like every other client instead of all of them.
+type dispatcher struct {
+	workers     int // 0: calls run in the caller, one at a time
+	maxInFlight int // handlers running at once per peer (0: no limit besides workers)
+	maxQueued   int // calls waiting per peer before new ones are rejected (0: no limit)
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	peers   map[string]*peerQueue
+	ready   []*peerQueue // peers with queued calls below their in-flight cap, in turn order
+	started bool
+	stopped chan struct{} // closed by stop
+}
+
+// peerQueue holds the calls of one peer. Idle peers are dropped so that their gauges do
+// not outlive them.
+type peerQueue struct {
+	addr     string
+	calls    []func()
+	inFlight int
+	ready    bool // whether the peer is in the ready list
+}
+
+func newDispatcher() *dispatcher {
+	d := &dispatcher{peers: make(map[string]*peerQueue), stopped: make(chan struct{})}
+	d.cond = sync.NewCond(&d.mu)
+	return d
+}
+
+// start launches the workers, once
+func (d *dispatcher) start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.started {
+		return
+	}
+	d.started = true
+	for range d.workers {
+		go d.work()
+	}
+}
+
+// stop makes the workers exit once their current call returns. Queued calls are not run.
+func (d *dispatcher) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.isStopped() {
+		return
+	}
+	close(d.stopped)
+	d.cond.Broadcast()
+}
+
+// isStopped tells whether stop was called
+func (d *dispatcher) isStopped() bool {
+	select {
+	case <-d.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// submit queues call for peer, or runs it right away if there are no workers. It returns
+// false if the peer already has maxQueued calls waiting.
+func (d *dispatcher) submit(peer string, call func()) bool {
+	d.mu.Lock()
+	q := d.peers[peer]
+	if q == nil {
+		q = &peerQueue{addr: peer}
+		d.peers[peer] = q
+	}
+	if d.workers == 0 {
+		q.inFlight++
+		d.mu.Unlock()
+		call()
+		d.done(q)
+		return true
+	}
+	if d.maxQueued > 0 && len(q.calls) >= d.maxQueued {
+		d.mu.Unlock()
+		return false
+	}
+	q.calls = append(q.calls, call)
+	d.markReady(q)
+	d.mu.Unlock()
+	return true
+}
+
+// work runs calls, one peer at a time in the order peers became ready, until stop
+func (d *dispatcher) work() {
+	for {
+		d.mu.Lock()
+		for len(d.ready) == 0 && !d.isStopped() {
+			d.cond.Wait()
+		}
+		if d.isStopped() {
+			d.mu.Unlock()
+			return
+		}
+		q := d.ready[0]
+		d.ready[0] = nil
+		d.ready = d.ready[1:]
+		q.ready = false
+		call := q.calls[0]
+		q.calls[0] = nil
+		q.calls = q.calls[1:]
+		q.inFlight++
+		// The peer's next call goes behind the calls of the other ready peers
+		d.markReady(q)
+		d.mu.Unlock()
+
+		call()
+		d.done(q)
+	}
+}
+
+// done accounts for the end of a call of q
+func (d *dispatcher) done(q *peerQueue) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q.inFlight--
+	d.markReady(q)
+	if q.inFlight == 0 && len(q.calls) == 0 {
+		delete(d.peers, q.addr)
+	}
+}
+
+// markReady appends q to the ready list if it has a call it may run. It must be called
+// with mu held.
+func (d *dispatcher) markReady(q *peerQueue) {
+	if q.ready || len(q.calls) == 0 || (d.maxInFlight > 0 && q.inFlight >= d.maxInFlight) {
+		return
+	}
+	q.ready = true
+	d.ready = append(d.ready, q)
+	d.cond.Signal()
+}
+
+// loads returns the load of every peer with requests in flight or queued
+func (d *dispatcher) loads() map[string]PeerLoad {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	loads := make(map[string]PeerLoad, len(d.peers))
+	for addr, q := range d.peers {
+		loads[addr] = PeerLoad{InFlight: q.inFlight, Queued: len(q.calls)}
+	}
+	return loads
+}
+
+// writeMetrics writes the peer loads as gauges in the Prometheus text exposition format
+func (d *dispatcher) writeMetrics(w io.Writer) (int64, error) {
+	loads := d.loads()
+	peers := make([]string, 0, len(loads))
+	for addr := range loads {
+		peers = append(peers, addr)
+	}
+	sort.Strings(peers)
+
+	var b strings.Builder
+	writeGauge := func(name, help string, value func(PeerLoad) int) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, addr := range peers {
+			fmt.Fprintf(&b, "%s{peer=%s} %d\n", name, strconv.Quote(addr), value(loads[addr]))
+		}
+	}
+	writeGauge("arpc_server_peer_in_flight", "Number of requests of the client being handled.",
+		func(l PeerLoad) int { return l.InFlight })
+	writeGauge("arpc_server_peer_queued", "Number of requests of the client waiting for a worker.",
+		func(l PeerLoad) int { return l.Queued })
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
@@ -0,0 +1,261 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/serializer"
+)
+
+// startServer serves mux on a loopback server, configured by configure if not nil, until
+// the end of the test
+func startServer(t *testing.T, mux *Mux, configure func(*Server)) *Server {
+	t.Helper()
+	server, err := NewServer("127.0.0.1:0", &serializer.SymphonySerializer{}, nil)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	if configure != nil {
+		configure(server)
+	}
+	mux.Register(server)
+	go server.Start()
+	t.Cleanup(func() { server.Stop() })
+	return server
+}
+
+// newTestClient returns a client of the services of mux served by server
+func newTestClient(t *testing.T, server *Server, mux *Mux) *Client {
+	t.Helper()
+	client, err := NewClient(&serializer.SymphonySerializer{}, server.GetTransport().LocalAddr().String(), nil)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	client.SetServiceRegistry(mux.Registry())
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// rawHandler registers fn as the handler of service.method on a new mux
+func rawHandler(service, method string, fn func(context.Context, *serializer.RawMessage) (*serializer.RawMessage, error)) *Mux {
+	mux := NewMux()
+	HandleFunc(mux, service, method, fn)
+	return mux
+}
+
+// waitFor waits until cond holds, failing the test after a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDispatcher_RoundRobin(t *testing.T) {
+	d := newDispatcher()
+	d.workers = 1
+	order := make(chan string, 6)
+	for _, call := range []string{"a1", "a2", "a3", "a4", "b1", "b2"} {
+		if !d.submit(call[:1], func() { order <- call }) {
+			t.Fatalf("submit(%s) refused", call)
+		}
+	}
+	d.start()
+	defer d.stop()
+
+	var got []string
+	for range 6 {
+		select {
+		case call := <-order:
+			got = append(got, call)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out after calls %v", got)
+		}
+	}
+	// Peer a pipelined its calls first, yet b gets every other turn
+	if want := "[a1 b1 a2 b2 a3 a4]"; fmt.Sprint(got) != want {
+		t.Errorf("Calls ran in the order %v, want %s", got, want)
+	}
+}
+
+func TestDispatcher_BusyPeer(t *testing.T) {
+	d := newDispatcher()
+	d.workers, d.maxInFlight = 2, 1
+	d.start()
+	defer d.stop()
+
+	// Peer a blocks its calls, one at a time
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		d.submit("a", func() {
+			defer wg.Done()
+			<-release
+		})
+	}
+	ran := make(chan struct{})
+	d.submit("b", func() { close(ran) })
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The call of peer b waited behind the blocked calls of peer a")
+	}
+	if load := d.loads()["a"]; load != (PeerLoad{InFlight: 1, Queued: 2}) {
+		t.Errorf("Peer a has load %+v, want 1 in flight and 2 queued", load)
+	}
+
+	close(release)
+	wg.Wait()
+	waitFor(t, "idle peers to be dropped", func() bool { return len(d.loads()) == 0 })
+}
+
+func TestDispatcher_MaxQueued(t *testing.T) {
+	d := newDispatcher()
+	d.workers, d.maxQueued = 1, 2
+	for i := range 2 {
+		if !d.submit("a", func() {}) {
+			t.Fatalf("Call %d of peer a refused below maxQueued", i)
+		}
+	}
+	if d.submit("a", func() {}) {
+		t.Error("Expected the call beyond maxQueued to be refused")
+	}
+	if !d.submit("b", func() {}) {
+		t.Error("Expected the queue limit to apply per peer")
+	}
+	if loads := d.loads(); loads["a"].Queued != 2 || loads["b"].Queued != 1 {
+		t.Errorf("Got loads %v, want 2 calls of a and 1 of b queued", loads)
+	}
+}
+
+func TestDispatcher_StartStop(t *testing.T) {
+	d := newDispatcher()
+	d.workers = 1
+	d.start()
+	d.start()
+
+	// A second start launches no more workers: b waits for the one worker
+	release := make(chan struct{})
+	ran := make(chan string, 3)
+	d.submit("a", func() {
+		<-release
+		ran <- "a"
+	})
+	d.submit("b", func() { ran <- "b" })
+	select {
+	case call := <-ran:
+		t.Fatalf("Call of peer %s ran while the only worker was busy", call)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	for _, want := range []string{"a", "b"} {
+		select {
+		case call := <-ran:
+			if call != want {
+				t.Errorf("Call of peer %s ran, want %s", call, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for the call of peer %s", want)
+		}
+	}
+
+	// Stopped workers run no more calls
+	d.stop()
+	d.stop()
+	d.submit("c", func() { ran <- "c" })
+	select {
+	case <-ran:
+		t.Error("Call ran after stop")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestServer_PeerLimits(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	mux := rawHandler("Test", "Block", func(ctx context.Context, req *serializer.RawMessage) (*serializer.RawMessage, error) {
+		started <- struct{}{}
+		<-release
+		return req, nil
+	})
+	server := startServer(t, mux, func(s *Server) {
+		s.SetMaxConcurrentRPCs(2)
+		s.SetPeerLimits(1, 1)
+	})
+	client := newTestClient(t, server, mux)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The first call runs and the second waits for it, the only one allowed in flight
+	errs := make(chan error, 2)
+	call := func() {
+		var resp serializer.RawMessage
+		errs <- client.Call(ctx, "Test", "Block", serializer.RawMessage("x"), &resp)
+	}
+	go call()
+	<-started
+	go call()
+	waitFor(t, "the second call to be queued", func() bool {
+		for _, load := range server.PeerLoads() {
+			return load == PeerLoad{InFlight: 1, Queued: 1}
+		}
+		return false
+	})
+
+	// The third is rejected with a backoff hint
+	var resp serializer.RawMessage
+	err := client.Call(ctx, "Test", "Block", serializer.RawMessage("x"), &resp)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Type != RPCFailError || !strings.Contains(rpcErr.Reason, "too many queued requests") {
+		t.Fatalf("Call returned %v, want a too many queued requests RPCError", err)
+	}
+	if rpcErr.RetryHint.Throttle != packet.ThrottleBackoff {
+		t.Errorf("Got retry hint %+v, want packet.ThrottleBackoff", rpcErr.RetryHint)
+	}
+
+	close(release)
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Errorf("Call failed: %v", err)
+		}
+	}
+}
+
+func TestServer_Stop(t *testing.T) {
+	server, err := NewServer("127.0.0.1:0", &serializer.SymphonySerializer{}, nil)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	server.SetMaxConcurrentRPCs(2)
+	returned := make(chan struct{})
+	go func() {
+		server.Start()
+		close(returned)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := server.Stop(); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after Stop")
+	}
+	if !server.dispatcher.isStopped() {
+		t.Error("Expected Stop to stop the workers")
+	}
+	if err := server.Stop(); err != nil {
+		t.Errorf("Second Stop returned %v, want nil", err)
+	}
+}
@@ -0,0 +1,79 @@
+package rpc
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+)
+
+// DropNotification reports a call of the client that a proxy on the path dropped. The proxy
+// answers the dropped request with an error packet addressed back to the socket the request
+// came from, carrying the reason of the drop.
+type DropNotification struct {
+	RPCID   uint64
+	Service string
+	Method  string
+	Reason  packet.DropReason
+	Message string // sent by the proxy, e.g. the error of the element
+	Time    time.Time
+}
+
+// dropSubscribers holds the channels of SubscribeDrops
+type dropSubscribers struct {
+	mu   sync.Mutex
+	subs map[int]chan DropNotification
+	next int
+}
+
+// SubscribeDrops returns a channel receiving a notification for every call of the client
+// that a proxy dropped, along with a function to unsubscribe, which closes the channel. The
+// call itself fails right away with an *RPCError carrying the reason. Notifications that do
+// not fit in the buffer of the channel are discarded, so slow subscribers never hold up calls.
+func (c *Client) SubscribeDrops(buffer int) (<-chan DropNotification, func()) {
+	ch := make(chan DropNotification, buffer)
+	c.drops.mu.Lock()
+	if c.drops.subs == nil {
+		c.drops.subs = make(map[int]chan DropNotification)
+	}
+	id := c.drops.next
+	c.drops.next++
+	c.drops.subs[id] = ch
+	c.drops.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			c.drops.mu.Lock()
+			delete(c.drops.subs, id)
+			c.drops.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// notifyDrop notifies the subscribers if err is the error of a call dropped by a proxy
+func (c *Client) notifyDrop(rpcID uint64, service, method string, err error) {
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.DropReason == packet.DropReasonNone {
+		return
+	}
+	notification := DropNotification{
+		RPCID:   rpcID,
+		Service: service,
+		Method:  method,
+		Reason:  rpcErr.DropReason,
+		Message: rpcErr.Reason,
+		Time:    time.Now(),
+	}
+
+	c.drops.mu.Lock()
+	defer c.drops.mu.Unlock()
+	for _, ch := range c.drops.subs {
+		select {
+		case ch <- notification:
+		default:
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/serializer"
+)
+
+// startDroppingProxy answers every request it receives with the error packet returned by
+// drop for the RPC ID of the request, like a proxy dropping the calls
+func startDroppingProxy(t *testing.T, drop func(rpcID uint64) *packet.ErrorPacket) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, packet.MaxUDPPayloadSize)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			decoded, err := (&packet.DataPacketCodec{}).Deserialize(buf[:n])
+			if err != nil {
+				continue
+			}
+			data, err := (&packet.ErrorPacketCodec{}).Serialize(drop(decoded.(*packet.DataPacket).RPCID), nil)
+			if err != nil {
+				t.Errorf("Failed to serialize the error packet: %v", err)
+				return
+			}
+			conn.WriteToUDP(data, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestClient_DropErrors(t *testing.T) {
+	for _, tc := range []struct {
+		reason packet.DropReason
+		hint   packet.RetryHint
+		want   RPCErrorType
+	}{
+		{packet.DropReasonRateLimited, packet.RetryHint{Throttle: packet.ThrottleBackoff, RetryAfter: 1500 * time.Millisecond}, RPCDroppedError},
+		{packet.DropReasonPolicyDenied, packet.RetryHint{}, RPCDroppedError},
+		{packet.DropReasonAuthFailed, packet.RetryHint{}, RPCUnauthenticatedError},
+		{packet.DropReasonUnavailable, packet.RetryHint{Throttle: packet.ThrottleBackoff}, RPCUnavailableError},
+	} {
+		addr := startDroppingProxy(t, func(rpcID uint64) *packet.ErrorPacket {
+			return &packet.ErrorPacket{
+				PacketTypeID: packet.PacketTypeError.TypeID,
+				RPCID:        rpcID,
+				ErrorMsg:     "dropped: " + tc.reason.String(),
+				RetryHint:    tc.hint,
+				DropReason:   tc.reason,
+			}
+		})
+		client, err := NewClient(&serializer.SymphonySerializer{}, addr, nil)
+		if err != nil {
+			t.Fatalf("NewClient failed: %v", err)
+		}
+		defer client.Close()
+		registry := NewServiceRegistry()
+		registry.RegisterNamedService("Test", "Call")
+		client.SetServiceRegistry(registry)
+		drops, unsubscribe := client.SubscribeDrops(1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		var resp serializer.RawMessage
+		err = client.Call(ctx, "Test", "Call", serializer.RawMessage("x"), &resp)
+		cancel()
+
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			t.Fatalf("%v: Call returned %v, want an RPCError", tc.reason, err)
+		}
+		if rpcErr.Type != tc.want || rpcErr.DropReason != tc.reason || rpcErr.RetryHint != tc.hint {
+			t.Errorf("%v: got type %s, drop reason %v, hint %+v, want %s, %v, %+v",
+				tc.reason, rpcErr.Type.Name, rpcErr.DropReason, rpcErr.RetryHint, tc.want.Name, tc.reason, tc.hint)
+		}
+		if rpcErr.Reason != "dropped: "+tc.reason.String() {
+			t.Errorf("%v: got reason %q, want the message of the proxy", tc.reason, rpcErr.Reason)
+		}
+
+		select {
+		case n := <-drops:
+			if n.Service != "Test" || n.Method != "Call" || n.Reason != tc.reason || n.Message != rpcErr.Reason {
+				t.Errorf("%v: got notification %+v", tc.reason, n)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%v: no drop notification", tc.reason)
+		}
+		unsubscribe()
+		if _, ok := <-drops; ok {
+			t.Errorf("%v: expected unsubscribe to close the channel", tc.reason)
+		}
+	}
+}
+
+func TestClient_ServerErrorsAreNotDrops(t *testing.T) {
+	mux := rawHandler("Test", "Fail", func(ctx context.Context, req *serializer.RawMessage) (*serializer.RawMessage, error) {
+		return nil, &RPCError{Type: RPCFailError, Reason: "handler failed"}
+	})
+	client := newTestClient(t, startServer(t, mux, nil), mux)
+	drops, unsubscribe := client.SubscribeDrops(1)
+	defer unsubscribe()
+
+	var resp serializer.RawMessage
+	err := client.Call(context.Background(), "Test", "Fail", serializer.RawMessage("x"), &resp)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Type != RPCFailError || rpcErr.DropReason != packet.DropReasonNone {
+		t.Fatalf("Call returned %v, want an RPCFailError without a drop reason", err)
+	}
+	select {
+	case n := <-drops:
+		t.Errorf("Unexpected drop notification %+v for an error of the server", n)
+	default:
+	}
+}
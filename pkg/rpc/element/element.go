@@ -2,6 +2,8 @@ package element
 
 import (
 	"context"
+	"sync"
+	"time"
 )
 
 // Request represents an RPC request
@@ -31,6 +33,54 @@ type RPCElement interface {
 	Name() string
 }
 
+// ElementTiming records how long an element took to process a request or response
+type ElementTiming struct {
+	Name     string
+	Phase    string // "request" or "response"
+	Duration time.Duration
+}
+
+// ElementTimings collects the element timings of a single RPC
+type ElementTimings struct {
+	mu      sync.Mutex
+	timings []ElementTiming
+}
+
+// elementTimingsKey is the context key for ElementTimings
+type elementTimingsKey struct{}
+
+// WithElementTimings returns a context that makes the element chain record per-element timings
+func WithElementTimings(ctx context.Context) (context.Context, *ElementTimings) {
+	timings := &ElementTimings{}
+	return context.WithValue(ctx, elementTimingsKey{}, timings), timings
+}
+
+// Timings returns a copy of the recorded timings
+func (t *ElementTimings) Timings() []ElementTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]ElementTiming(nil), t.timings...)
+}
+
+// record appends a timing (no-op on a nil receiver)
+func (t *ElementTimings) record(name, phase string, start time.Time) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.timings = append(t.timings, ElementTiming{Name: name, Phase: phase, Duration: time.Since(start)})
+	t.mu.Unlock()
+}
+
+// elementTimingsFromContext returns the ElementTimings stored in ctx, or nil
+func elementTimingsFromContext(ctx context.Context) *ElementTimings {
+	if ctx == nil {
+		return nil
+	}
+	timings, _ := ctx.Value(elementTimingsKey{}).(*ElementTimings)
+	return timings
+}
+
 // RPCElementChain represents a chain of RPC elements
 type RPCElementChain struct {
 	elements []RPCElement
@@ -46,8 +96,14 @@ func NewRPCElementChain(elements ...RPCElement) *RPCElementChain {
 // ProcessRequest processes the request through all RPC elements in the chain
 func (c *RPCElementChain) ProcessRequest(ctx context.Context, req *RPCRequest) (*RPCRequest, context.Context, error) {
 	var err error
+	timings := elementTimingsFromContext(ctx)
 	for idx, element := range c.elements {
+		var start time.Time
+		if timings != nil {
+			start = time.Now()
+		}
 		req, ctx, err = element.ProcessRequest(ctx, req)
+		timings.record(element.Name(), "request", start)
 		if err != nil {
 			// We mock a RPCResponse struct to go through the ProcessResponse logic of executed elements
 			resp := &RPCResponse{
@@ -66,8 +122,14 @@ func (c *RPCElementChain) ProcessRequest(ctx context.Context, req *RPCRequest) (
 // ProcessResponse processes the response through all RPC elements in reverse order
 func (c *RPCElementChain) ProcessResponse(ctx context.Context, resp *RPCResponse) (*RPCResponse, context.Context, error) {
 	var err error
+	timings := elementTimingsFromContext(ctx)
 	for i := len(c.elements) - 1; i >= 0; i-- {
+		var start time.Time
+		if timings != nil {
+			start = time.Now()
+		}
 		resp, ctx, err = c.elements[i].ProcessResponse(ctx, resp)
+		timings.record(c.elements[i].Name(), "response", start)
 		if err != nil {
 			return nil, ctx, err
 		}
@@ -0,0 +1,173 @@
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	sharedelement "github.com/appnet-org/arpc/pkg/element"
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/packet"
+	"go.uber.org/zap"
+)
+
+// errDroppedByElement is the error of calls dropped by the verdict of a local proxy element
+var errDroppedByElement = errors.New("dropped by element")
+
+// localReply is the error of calls a local proxy element answered itself, carrying the
+// response it answered with (see sharedelement.VerdictReply)
+type localReply struct {
+	payload []byte
+}
+
+func (r *localReply) Error() string {
+	return "answered by a proxy element"
+}
+
+// SetProxyElements makes the client run elements of the proxy interface (pkg/element) on the
+// public segment of its requests before sending them and of its responses before decoding
+// them, as a sidecar proxy would, so that deployments without a proxy keep the same policy
+// code. Requests run through the elements in order and responses in reverse order. Calls
+// dropped by an element fail with an RPCDroppedError, as if a proxy had dropped them, and
+// calls an element answered get its response without sending the request. The
+// elements must be set before the first call. Not to be confused with the RPC elements of
+// NewClient, which process the requests and responses before serialization. Callers start
+// and shut down the elements with element.Start and element.Shutdown; WithProxyElements does
+// it for them.
+func (c *Client) SetProxyElements(elements ...sharedelement.Element) {
+	c.proxyElements = elements
+}
+
+// startProxyElements starts the proxy elements of WithProxyElements and sets them, see
+// sharedelement.StartHook
+func (c *Client) startProxyElements(ctx context.Context, elements []sharedelement.Element) error {
+	started := make([]any, len(elements))
+	for i, e := range elements {
+		started[i] = e
+	}
+	if err := sharedelement.Start(ctx, started...); err != nil {
+		return err
+	}
+	c.startedElements = started
+	c.SetProxyElements(elements...)
+	return nil
+}
+
+// shutdownProxyElements shuts down the proxy elements started by DialContext
+func (c *Client) shutdownProxyElements() {
+	if len(c.startedElements) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sharedelement.DefaultHookTimeout)
+	defer cancel()
+	if err := sharedelement.Shutdown(ctx, c.startedElements...); err != nil {
+		logging.Warn("Proxy elements failed to shut down", zap.Error(err))
+	}
+}
+
+// interceptRequest runs the proxy elements on a serialized request to addr, and returns the
+// request to send and its destination, which elements may change, as an address to send to
+// and as the source of the response
+func (c *Client) interceptRequest(ctx context.Context, rpcID uint64, addr string, data []byte, encrypted bool) ([]byte, string, net.Addr, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to resolve %s: %w", addr, err)
+	}
+	msg := &sharedelement.Message{
+		Kind:        sharedelement.KindRequest,
+		RPCID:       rpcID,
+		Source:      c.transport.LocalAddr(),
+		Destination: udpAddr,
+		Encrypted:   encrypted,
+	}
+	data, err = c.runProxyElements(ctx, msg, data)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if msg.Destination == nil || msg.Destination == net.Addr(udpAddr) {
+		return data, addr, udpAddr, nil
+	}
+	return data, msg.Destination.String(), msg.Destination, nil
+}
+
+// interceptResponse runs the proxy elements on a serialized response. The buffer of the
+// response is returned to the pool if the elements replaced it.
+func (c *Client) interceptResponse(ctx context.Context, rpcID uint64, source net.Addr, data []byte, encrypted bool) ([]byte, error) {
+	msg := &sharedelement.Message{
+		Kind:        sharedelement.KindResponse,
+		RPCID:       rpcID,
+		Source:      source,
+		Destination: c.transport.LocalAddr(),
+		Encrypted:   encrypted,
+	}
+	processed, err := c.runProxyElements(ctx, msg, data)
+	if err != nil || !sameBuffer(processed, data) {
+		c.transport.GetBufferPool().Put(data)
+	}
+	return processed, err
+}
+
+// runProxyElements runs the proxy elements on msg with the public segment of data, and
+// returns data with the public segment the elements left, followed by the private segment,
+// which elements never see
+func (c *Client) runProxyElements(ctx context.Context, msg *sharedelement.Message, data []byte) ([]byte, error) {
+	public, private := data, []byte(nil)
+	if len(data) >= 5 {
+		if offset := int(binary.LittleEndian.Uint32(data[1:5])); offset < len(data) {
+			public, private = data[:offset], data[offset:]
+		}
+	}
+	msg.Payload = public
+
+	elements := c.proxyElements
+	for i := range elements {
+		elem := elements[i]
+		process := elem.ProcessRequest
+		if msg.Kind == sharedelement.KindResponse {
+			elem = elements[len(elements)-1-i]
+			process = elem.ProcessResponse
+		}
+		processed, verdict, newCtx, err := process(ctx, msg)
+		if err == nil && (processed == nil || verdict == sharedelement.VerdictDrop) {
+			err = errDroppedByElement
+		}
+		if err != nil {
+			logging.Debug("Call dropped by a proxy element",
+				zap.Uint64("rpcID", msg.RPCID),
+				zap.String("element", elem.Name()),
+				zap.String("kind", msg.Kind.String()),
+				zap.Error(err))
+			return nil, &RPCError{Type: RPCDroppedError, Reason: err.Error(), Cause: err, DropReason: packet.DropReasonPolicyDenied}
+		}
+		if verdict == sharedelement.VerdictReply && msg.Kind == sharedelement.KindRequest {
+			logging.Debug("Call answered by a proxy element",
+				zap.Uint64("rpcID", msg.RPCID),
+				zap.String("element", elem.Name()))
+			return nil, &localReply{payload: processed.Payload}
+		}
+		*msg = *processed
+		if newCtx != nil {
+			ctx = newCtx
+		}
+	}
+
+	if sameBuffer(msg.Payload, public) {
+		return data, nil
+	}
+	return append(msg.Payload[:len(msg.Payload):len(msg.Payload)], private...), nil
+}
+
+// handleLocalReply completes a call with the response a proxy element answered it with. The
+// response is copied, since elements may keep answering with the same buffer.
+func (c *Client) handleLocalReply(ctx context.Context, rpcID uint64, reply *localReply, resp any) error {
+	data := c.transport.GetBufferPool().GetSize(len(reply.payload))
+	copy(data, reply.payload)
+	return c.handleResponsePacket(ctx, data, rpcID, resp)
+}
+
+// sameBuffer tells whether a and b are the same bytes of the same buffer
+func sameBuffer(a, b []byte) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
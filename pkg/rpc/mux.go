@@ -0,0 +1,187 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/appnet-org/arpc/pkg/rpc/element"
+)
+
+// HandlerFunc handles the calls of a method registered on a Mux. req is the decoded request;
+// the returned value is marshaled as the response.
+type HandlerFunc func(ctx context.Context, req any) (any, error)
+
+// Middleware wraps the handlers of a Mux, e.g. to log, authorize or time their calls
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Mux registers handlers by service and method name, like http.ServeMux, for services built
+// without generated code. Services and methods are numbered by NameID, so clients calling
+// them need no generated code either (see ServiceRegistry.RegisterNamedService).
+type Mux struct {
+	mu         sync.Mutex
+	middleware []Middleware
+	services   map[string]map[string]*muxRoute // by service name, then method name
+}
+
+// muxRoute is a method registered on a Mux
+type muxRoute struct {
+	newRequest func() any
+	handler    HandlerFunc
+	options    MethodOptions
+}
+
+// muxMethodKey is the context key of the service and method of a call dispatched by a Mux
+type muxMethodKey struct{}
+
+type muxMethod struct {
+	service, method string
+}
+
+// NewMux creates an empty mux
+func NewMux() *Mux {
+	return &Mux{services: make(map[string]map[string]*muxRoute)}
+}
+
+// Use appends middleware to the mux. Middleware applies to all handlers, whenever they were
+// registered; the first one is the outermost.
+func (m *Mux) Use(middleware ...Middleware) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.middleware = append(m.middleware, middleware...)
+}
+
+// Handle registers handler for the calls of service.method. Requests are decoded into the
+// value returned by newRequest, a pointer to a new message. It panics if the method is
+// already registered, or if the ID of the service or method collides with another one.
+func (m *Mux) Handle(service, method string, newRequest func() any, handler HandlerFunc, opts ...MethodOptions) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	methods, ok := m.services[service]
+	if !ok {
+		for name := range m.services {
+			if NameID(name) == NameID(service) {
+				panic(fmt.Sprintf("rpc: services %s and %s have the same ID", name, service))
+			}
+		}
+		methods = make(map[string]*muxRoute)
+		m.services[service] = methods
+	}
+	for name := range methods {
+		if name == method {
+			panic(fmt.Sprintf("rpc: multiple registrations for %s.%s", service, method))
+		}
+		if NameID(name) == NameID(method) {
+			panic(fmt.Sprintf("rpc: methods %s and %s of %s have the same ID", name, method, service))
+		}
+	}
+	route := &muxRoute{newRequest: newRequest, handler: handler}
+	if len(opts) > 0 {
+		route.options = opts[0]
+	}
+	methods[method] = route
+}
+
+// HandleFunc registers fn for the calls of service.method on m, decoding requests into a
+// new Req
+func HandleFunc[Req, Resp any](m *Mux, service, method string, fn func(context.Context, *Req) (*Resp, error), opts ...MethodOptions) {
+	m.Handle(service, method, func() any { return new(Req) }, func(ctx context.Context, req any) (any, error) {
+		return fn(ctx, req.(*Req))
+	}, opts...)
+}
+
+// MethodFromContext returns the service and method of a call dispatched by a Mux, for
+// middleware shared by several methods
+func MethodFromContext(ctx context.Context) (service, method string, ok bool) {
+	m, ok := ctx.Value(muxMethodKey{}).(muxMethod)
+	return m.service, m.method, ok
+}
+
+// Register registers the services of the mux with s. Handlers and middleware added later
+// are not seen by s.
+func (m *Mux) Register(s *Server) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, service := range m.serviceNames() {
+		desc := &ServiceDesc{
+			ServiceName: service,
+			ServiceID:   NameID(service),
+			MethodsByID: make(map[uint32]*MethodDesc),
+		}
+		for method, route := range m.services[service] {
+			handler := route.handler
+			for i := len(m.middleware) - 1; i >= 0; i-- {
+				handler = m.middleware[i](handler)
+			}
+			desc.MethodsByID[NameID(method)] = &MethodDesc{
+				MethodName: method,
+				MethodID:   NameID(method),
+				Handler:    muxMethodHandler(service, method, route.newRequest, handler),
+				Options:    route.options,
+			}
+		}
+		s.RegisterService(desc, nil)
+	}
+}
+
+// Registry returns a service registry of the services of the mux, for clients
+func (m *Mux) Registry() *ServiceRegistry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	registry := NewServiceRegistry()
+	for service, methods := range m.services {
+		names := make([]string, 0, len(methods))
+		for method := range methods {
+			names = append(names, method)
+		}
+		registry.RegisterNamedService(service, names...)
+	}
+	return registry
+}
+
+// serviceNames returns the names of the services, sorted
+func (m *Mux) serviceNames() []string {
+	names := make([]string, 0, len(m.services))
+	for service := range m.services {
+		names = append(names, service)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// muxMethodHandler returns the MethodHandler of a method registered on a Mux. Like generated
+// handlers, it runs the decoded request and the result through the element chain.
+func muxMethodHandler(service, method string, newRequest func() any, handler HandlerFunc) MethodHandler {
+	return func(srv any, ctx context.Context, dec func(any) error, req *element.RPCRequest, chain *element.RPCElementChain) (*element.RPCResponse, context.Context, error) {
+		req.Payload = newRequest()
+		if err := dec(req.Payload); err != nil {
+			return nil, ctx, err
+		}
+		req, ctx, err := chain.ProcessRequest(ctx, req)
+		if err != nil {
+			return nil, ctx, err
+		}
+		result, err := handler(context.WithValue(ctx, muxMethodKey{}, muxMethod{service, method}), req.Payload)
+		if err != nil {
+			return nil, ctx, err
+		}
+		resp := &element.RPCResponse{
+			ID:     req.ID,
+			Result: result,
+		}
+		return chain.ProcessResponse(ctx, resp)
+	}
+}
+
+// NameID returns the ID of a service or method registered on a Mux by name: the 32-bit
+// FNV-1a hash of the name. 0 is reserved for keepalive probes, so it is never returned.
+func NameID(name string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	if id := h.Sum32(); id != keepaliveServiceID {
+		return id
+	}
+	return 1
+}
@@ -0,0 +1,134 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/serializer"
+)
+
+func TestMux_ConcurrentCalls(t *testing.T) {
+	mux := NewMux()
+	// Handlers sleep for a time that depends on the request, so responses come back out of order
+	delay := func(req *serializer.RawMessage) {
+		time.Sleep(time.Duration(len(*req)%5) * time.Millisecond)
+	}
+	HandleFunc(mux, "Text", "Upper", func(ctx context.Context, req *serializer.RawMessage) (*serializer.RawMessage, error) {
+		delay(req)
+		resp := serializer.RawMessage(strings.ToUpper(string(*req)))
+		return &resp, nil
+	})
+	HandleFunc(mux, "Text", "Reverse", func(ctx context.Context, req *serializer.RawMessage) (*serializer.RawMessage, error) {
+		delay(req)
+		resp := make(serializer.RawMessage, len(*req))
+		for i, b := range *req {
+			resp[len(resp)-1-i] = b
+		}
+		return &resp, nil
+	})
+	HandleFunc(mux, "Echo", "Echo", func(ctx context.Context, req *serializer.RawMessage) (*serializer.RawMessage, error) {
+		delay(req)
+		return req, nil
+	})
+	server := startServer(t, mux, func(s *Server) { s.SetMaxConcurrentRPCs(8) })
+	client := newTestClient(t, server, mux)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := range 60 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := fmt.Sprintf("req-%d-%s", i, strings.Repeat("x", i%7))
+			service, method, want := "Echo", "Echo", req
+			switch i % 3 {
+			case 1:
+				service, method, want = "Text", "Upper", strings.ToUpper(req)
+			case 2:
+				service, method = "Text", "Reverse"
+				reversed := []byte(req)
+				for l, r := 0, len(reversed)-1; l < r; l, r = l+1, r-1 {
+					reversed[l], reversed[r] = reversed[r], reversed[l]
+				}
+				want = string(reversed)
+			}
+			var resp serializer.RawMessage
+			if err := client.Call(ctx, service, method, serializer.RawMessage(req), &resp); err != nil {
+				t.Errorf("%s.%s(%s) failed: %v", service, method, req, err)
+				return
+			}
+			if string(resp) != want {
+				t.Errorf("%s.%s(%s) returned %q, want %q", service, method, req, resp, want)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMux_Middleware(t *testing.T) {
+	mux := NewMux()
+	var mu sync.Mutex
+	var log []string
+	record := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, req any) (any, error) {
+				service, method, ok := MethodFromContext(ctx)
+				mu.Lock()
+				log = append(log, fmt.Sprintf("%s %s.%s %v", name, service, method, ok))
+				mu.Unlock()
+				return next(ctx, req)
+			}
+		}
+	}
+	mux.Use(record("outer"))
+	HandleFunc(mux, "Echo", "Echo", func(ctx context.Context, req *serializer.RawMessage) (*serializer.RawMessage, error) {
+		return req, nil
+	})
+	// Middleware added after a handler applies to it as well
+	mux.Use(record("inner"))
+	server := startServer(t, mux, nil)
+	client := newTestClient(t, server, mux)
+
+	var resp serializer.RawMessage
+	if err := client.Call(context.Background(), "Echo", "Echo", serializer.RawMessage("x"), &resp); err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got, want := fmt.Sprint(log), "[outer Echo.Echo true inner Echo.Echo true]"; got != want {
+		t.Errorf("Middleware ran as %s, want %s", got, want)
+	}
+}
+
+func TestMux_Handle(t *testing.T) {
+	mux := NewMux()
+	handler := func(ctx context.Context, req *serializer.RawMessage) (*serializer.RawMessage, error) { return req, nil }
+	HandleFunc(mux, "Echo", "Echo", handler)
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "multiple registrations") {
+			t.Errorf("Expected a panic for a duplicate method, got %v", r)
+		}
+	}()
+	HandleFunc(mux, "Echo", "Echo", handler)
+}
+
+func TestNameID(t *testing.T) {
+	if NameID("KV") != NameID("KV") || NameID("KV") == NameID("Store") {
+		t.Error("Expected NameID to be stable and tell names apart")
+	}
+	mux := NewMux()
+	HandleFunc(mux, "KV", "Get", func(ctx context.Context, req *serializer.RawMessage) (*serializer.RawMessage, error) { return req, nil })
+	registry := mux.Registry()
+	if id, ok := registry.GetServiceID("KV"); !ok || id != NameID("KV") {
+		t.Errorf("Registry has service ID %d for KV, want %d", id, NameID("KV"))
+	}
+	if id, ok := registry.GetMethodID("KV", "Get"); !ok || id != NameID("Get") {
+		t.Errorf("Registry has method ID %d for KV.Get, want %d", id, NameID("Get"))
+	}
+}
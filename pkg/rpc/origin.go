@@ -0,0 +1,43 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+)
+
+// originKey is the context key for the origin of the RPC being served
+type originKey struct{}
+
+// withOrigin returns a context carrying the origin of an RPC
+func withOrigin(ctx context.Context, origin packet.Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// OriginFromContext returns the origin of the request a handler is serving (see
+// packet.Origin). Calls made with the handler's context carry it on with one more hop, so
+// that all requests caused by a request share its ID.
+func OriginFromContext(ctx context.Context) (packet.Origin, bool) {
+	origin, ok := ctx.Value(originKey{}).(packet.Origin)
+	return origin, ok
+}
+
+// callOrigin returns the origin of the call rpcID made with ctx: that of the request the
+// caller serves with one more hop, or a new origin. Calls past packet.DefaultMaxHops fail
+// with an RPCDroppedError, as proxies drop them.
+func callOrigin(ctx context.Context, rpcID uint64) (packet.Origin, error) {
+	parent, ok := OriginFromContext(ctx)
+	if !ok {
+		return packet.Origin{ID: rpcID}, nil
+	}
+	origin := parent.Next()
+	if origin.Hops > packet.DefaultMaxHops {
+		return origin, &RPCError{
+			Type:       RPCDroppedError,
+			Reason:     fmt.Sprintf("request %d of origin %d exceeds %d hops", rpcID, origin.ID, packet.DefaultMaxHops),
+			DropReason: packet.DropReasonLoopDetected,
+		}
+	}
+	return origin, nil
+}
@@ -0,0 +1,52 @@
+package rpc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxPageBytes is the size of the pages of the paginated list methods whose
+// MethodOptions set no MaxPageBytes, about 45 full fragments
+const DefaultMaxPageBytes = 64 << 10
+
+// pageTokenPrefix marks the continuation tokens made by Paginate, to tell them apart from
+// the tokens of handlers that paginate their lists themselves
+const pageTokenPrefix = "arpc-page:"
+
+// Paginate splits a list of n items into pages of about maxBytes (DefaultMaxPageBytes if 0),
+// measuring item i with size, and returns the bounds [start, end) of the page pageToken
+// continues and the token of the next page, empty after the last page. An empty pageToken
+// asks for the first page. Every page holds at least one item, so an item larger than
+// maxBytes gets a page of its own. Tokens are offsets in the list, so the list must not
+// change while a client iterates over it. Generated servers of list methods call it (see
+// protoc-gen-arpc).
+func Paginate(pageToken string, n, maxBytes int, size func(i int) int) (start, end int, next string, err error) {
+	if pageToken != "" {
+		offset, err := strconv.Atoi(strings.TrimPrefix(pageToken, pageTokenPrefix))
+		if !IsPageToken(pageToken) || err != nil || offset < 0 || offset > n {
+			return 0, 0, "", &RPCError{Type: RPCFailError, Reason: fmt.Sprintf("invalid page token %q", pageToken)}
+		}
+		start = offset
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxPageBytes
+	}
+
+	end = start
+	for total := 0; end < n; end++ {
+		total += size(end)
+		if total > maxBytes && end > start {
+			break
+		}
+	}
+	if end < n {
+		next = pageTokenPrefix + strconv.Itoa(end)
+	}
+	return start, end, next, nil
+}
+
+// IsPageToken tells whether a continuation token was made by Paginate
+func IsPageToken(token string) bool {
+	return strings.HasPrefix(token, pageTokenPrefix)
+}
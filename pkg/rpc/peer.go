@@ -0,0 +1,22 @@
+package rpc
+
+import (
+	"context"
+	"net"
+)
+
+// peerKey is the context key for the client address of the RPC being served
+type peerKey struct{}
+
+// withPeer returns a context carrying the client address of an RPC
+func withPeer(ctx context.Context, addr *net.UDPAddr) context.Context {
+	return context.WithValue(ctx, peerKey{}, addr)
+}
+
+// PeerFromContext returns the address of the client of the RPC a handler is serving. It is
+// read from the packet header rather than the UDP source, so it is the client's address even
+// when a proxy forwarded the request from its own port (see the proxy's SOURCE_MODE).
+func PeerFromContext(ctx context.Context) (*net.UDPAddr, bool) {
+	addr, ok := ctx.Value(peerKey{}).(*net.UDPAddr)
+	return addr, ok
+}
@@ -0,0 +1,8 @@
+package rpc
+
+// Picker selects the destination address for each call in place of the client's default address.
+// Pick receives the marshaled request (public segment first for Symphony messages) and returns
+// the address to send to and a done function that is called once the call completes.
+type Picker interface {
+	Pick(payload []byte) (addr string, done func(), err error)
+}
@@ -0,0 +1,106 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+)
+
+// RetryPolicy controls how the client retries calls that fail with an error packet.
+// Waits grow exponentially from InitialBackoff up to MaxBackoff with random jitter, and
+// never end before the retry-after hint of the server or proxy that rejected the call,
+// so clients throttled at the same time do not come back at the same time.
+type RetryPolicy struct {
+	MaxAttempts       int // total attempts including the first one (<= 1 disables retries)
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64 // growth factor of the backoff between attempts (defaults to 2)
+	Jitter            float64 // up to this fraction of each wait is added at random, in [0, 1]
+
+	// Retryable decides whether an error is retried. If nil, only errors whose
+	// throttle state is packet.ThrottleBackoff are retried. Errors with the
+	// packet.ThrottleOverloaded state are never retried.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy returns a policy that retries throttled calls up to 3 times
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:       4,
+		InitialBackoff:    10 * time.Millisecond,
+		MaxBackoff:        time.Second,
+		BackoffMultiplier: 2,
+		Jitter:            0.2,
+	}
+}
+
+// retryHint returns the retry hint carried by err, if any
+func retryHint(err error) packet.RetryHint {
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.RetryHint
+	}
+	return packet.RetryHint{}
+}
+
+// backoff returns how long to wait before the given retry (1 for the first retry) after
+// err, or false if the call must not be retried
+func (p *RetryPolicy) backoff(retry int, err error) (time.Duration, bool) {
+	if retry >= p.MaxAttempts {
+		return 0, false
+	}
+
+	hint := retryHint(err)
+	if hint.Throttle == packet.ThrottleOverloaded {
+		return 0, false
+	}
+	if p.Retryable != nil {
+		if !p.Retryable(err) {
+			return 0, false
+		}
+	} else if hint.Throttle != packet.ThrottleBackoff {
+		return 0, false
+	}
+
+	multiplier := p.BackoffMultiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	wait := float64(p.InitialBackoff)
+	for i := 1; i < retry; i++ {
+		wait *= multiplier
+	}
+	if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+	if float64(hint.RetryAfter) > wait {
+		wait = float64(hint.RetryAfter)
+	}
+
+	// Jitter only extends the wait so that it never ends before the hint
+	if p.Jitter > 0 {
+		wait += wait * p.Jitter * rand.Float64()
+	}
+	return time.Duration(wait), true
+}
+
+// waitForRetry sleeps for delay, returning false if the context is done first or its
+// deadline would pass before the wait ends
+func waitForRetry(ctx context.Context, delay time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return false
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
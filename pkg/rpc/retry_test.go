@@ -0,0 +1,181 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/rpc/element"
+	"github.com/appnet-org/arpc/pkg/serializer"
+)
+
+// attemptRecorder is an RPC element recording the RPC ID of every attempt of the client
+type attemptRecorder struct {
+	mu  sync.Mutex
+	ids []uint64
+}
+
+func (e *attemptRecorder) ProcessRequest(ctx context.Context, req *element.RPCRequest) (*element.RPCRequest, context.Context, error) {
+	e.mu.Lock()
+	e.ids = append(e.ids, req.ID)
+	e.mu.Unlock()
+	return req, ctx, nil
+}
+
+func (e *attemptRecorder) ProcessResponse(ctx context.Context, resp *element.RPCResponse) (*element.RPCResponse, context.Context, error) {
+	return resp, ctx, nil
+}
+
+func (e *attemptRecorder) Name() string {
+	return "attempts"
+}
+
+func (e *attemptRecorder) attempts() []uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]uint64(nil), e.ids...)
+}
+
+var backoffErr = NewThrottleError("busy", packet.RetryHint{Throttle: packet.ThrottleBackoff})
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 5, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, BackoffMultiplier: 2}
+	for retry, want := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond} {
+		if delay, ok := p.backoff(retry+1, backoffErr); !ok || delay != want {
+			t.Errorf("Backoff of retry %d is %v, %v, want %v", retry+1, delay, ok, want)
+		}
+	}
+	if _, ok := p.backoff(5, backoffErr); ok {
+		t.Error("Expected no retry past MaxAttempts")
+	}
+
+	// The retry-after hint of the server is a floor
+	hinted := NewThrottleError("busy", packet.RetryHint{Throttle: packet.ThrottleBackoff, RetryAfter: 200 * time.Millisecond})
+	if delay, _ := p.backoff(1, hinted); delay != 200*time.Millisecond {
+		t.Errorf("Backoff with a 200ms hint is %v, want 200ms", delay)
+	}
+
+	// Jitter only extends the wait
+	p.Jitter = 0.5
+	for range 100 {
+		if delay, _ := p.backoff(2, backoffErr); delay < 20*time.Millisecond || delay > 30*time.Millisecond {
+			t.Fatalf("Backoff with jitter is %v, want within [20ms, 30ms]", delay)
+		}
+	}
+
+	// The multiplier defaults to 2
+	p = &RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond}
+	if delay, _ := p.backoff(3, backoffErr); delay != 4*time.Millisecond {
+		t.Errorf("Backoff of retry 3 with the default multiplier is %v, want 4ms", delay)
+	}
+}
+
+func TestRetryPolicy_Retryable(t *testing.T) {
+	p := DefaultRetryPolicy()
+	for _, err := range []error{
+		errors.New("plain error"),
+		&RPCError{Type: RPCFailError, Reason: "no hint"},
+		NewThrottleError("overloaded", packet.RetryHint{Throttle: packet.ThrottleOverloaded}),
+	} {
+		if _, ok := p.backoff(1, err); ok {
+			t.Errorf("Expected %v not to be retried", err)
+		}
+	}
+
+	// Retryable replaces the hint check, but overloaded servers are never retried
+	p.Retryable = func(err error) bool { return err.Error() == "plain error" }
+	if _, ok := p.backoff(1, errors.New("plain error")); !ok {
+		t.Error("Expected Retryable to allow the retry")
+	}
+	if _, ok := p.backoff(1, backoffErr); ok {
+		t.Error("Expected Retryable to refuse the retry")
+	}
+	if _, ok := p.backoff(1, NewThrottleError("plain error", packet.RetryHint{Throttle: packet.ThrottleOverloaded})); ok {
+		t.Error("Expected ThrottleOverloaded errors never to be retried")
+	}
+}
+
+func TestWaitForRetry(t *testing.T) {
+	if !waitForRetry(context.Background(), time.Millisecond) {
+		t.Error("Expected the wait to complete")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if waitForRetry(ctx, time.Second) {
+		t.Error("Expected no wait past the deadline")
+	}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if waitForRetry(canceled, time.Hour) {
+		t.Error("Expected no wait once canceled")
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	// The handler throttles the first calls, then fails them for good or answers
+	var mu sync.Mutex
+	var calls, failures int32
+	var final error
+	mux := rawHandler("Test", "Flaky", func(ctx context.Context, req *serializer.RawMessage) (*serializer.RawMessage, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if calls++; calls <= failures {
+			return nil, backoffErr
+		}
+		if final != nil {
+			return nil, final
+		}
+		return req, nil
+	})
+	server := startServer(t, mux, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, tc := range []struct {
+		name     string
+		failures int32
+		final    error
+		attempts int
+		ok       bool
+	}{
+		{"recovers", 2, nil, 3, true},
+		{"gives up after MaxAttempts", 10, nil, 4, false},
+		{"non-retryable error", 0, errors.New("not found"), 1, false},
+	} {
+		mu.Lock()
+		calls, failures, final = 0, tc.failures, tc.final
+		mu.Unlock()
+		recorder := &attemptRecorder{}
+		client, err := NewClient(&serializer.SymphonySerializer{}, server.GetTransport().LocalAddr().String(), []element.RPCElement{recorder})
+		if err != nil {
+			t.Fatalf("NewClient failed: %v", err)
+		}
+		client.SetServiceRegistry(mux.Registry())
+		client.SetRetryPolicy(&RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+
+		var resp serializer.RawMessage
+		err = client.Call(ctx, "Test", "Flaky", serializer.RawMessage("x"), &resp)
+		client.Close()
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: Call returned %v, want success %v", tc.name, err, tc.ok)
+		}
+		ids := recorder.attempts()
+		mu.Lock()
+		handled := calls
+		mu.Unlock()
+		if len(ids) != tc.attempts || int(handled) != tc.attempts {
+			t.Errorf("%s: made %d attempts (%d handled), want %d", tc.name, len(ids), handled, tc.attempts)
+		}
+		// Each attempt has its own RPC ID, so proxies do not apply the verdict of the previous one
+		seen := make(map[uint64]bool)
+		for _, id := range ids {
+			if seen[id] {
+				t.Errorf("%s: RPC ID %d reused across attempts %v", tc.name, id, ids)
+			}
+			seen[id] = true
+		}
+	}
+}
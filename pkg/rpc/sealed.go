@@ -0,0 +1,20 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/appnet-org/arpc/pkg/transport"
+)
+
+// sealedKey is the context key for the sealed request of the RPC being served
+type sealedKey struct{}
+
+// SealedRequestFromContext returns the request of the RPC a handler is serving as received,
+// when the server's transport has lazy decryption enabled (see
+// transport.UDPTransport.SetLazyDecryption). Handlers that read the request through the
+// Raw accessors of its message after opening the fields they need, instead of decoding it,
+// skip the decryption of the other private fields. Decoding the request opens all of them.
+func SealedRequestFromContext(ctx context.Context) (*transport.SealedMessage, bool) {
+	sealed, ok := ctx.Value(sealedKey{}).(*transport.SealedMessage)
+	return sealed, ok
+}
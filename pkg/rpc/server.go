@@ -3,8 +3,13 @@ package rpc
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"sync"
+	"time"
 
+	"github.com/appnet-org/arpc/pkg/allocaudit"
 	"github.com/appnet-org/arpc/pkg/logging"
 	"github.com/appnet-org/arpc/pkg/metadata"
 	"github.com/appnet-org/arpc/pkg/packet"
@@ -22,6 +27,30 @@ type MethodDesc struct {
 	MethodName string
 	MethodID   uint32
 	Handler    MethodHandler
+	Options    MethodOptions
+}
+
+// MethodOptions are the settings the server enforces for the calls of one method, on top
+// of its own. Generated RegisterXxxServer functions take them for each method of a service.
+type MethodOptions struct {
+	// Timeout is the deadline of the handler's context. Calls whose handler returns after it
+	// fail with an RPCDeadlineExceededError instead of sending the response (0: no timeout).
+	Timeout time.Duration
+	// MaxRecvMsgSize rejects larger requests, in bytes, with an RPCResourceExhaustedError
+	// before they are decoded (0: no limit)
+	MaxRecvMsgSize int
+	// MaxSendMsgSize limits responses like Server.SetMaxSendMsgSize, whichever is smaller
+	// (0: only the server's limit)
+	MaxSendMsgSize int
+	// Idempotent marks methods whose calls may safely run more than once. Calls of such
+	// methods that time out come with a packet.ThrottleBackoff hint so clients retry them.
+	Idempotent bool
+	// RequireAuth rejects requests that do not carry valid security extensions of the
+	// server's key with an RPCUnauthenticatedError. It requires encryption on the server.
+	RequireAuth bool
+	// MaxPageBytes is the size of the pages list methods generated with pagination split
+	// their responses into, see Paginate (0: DefaultMaxPageBytes)
+	MaxPageBytes int
 }
 
 // ServiceDesc describes an RPC service, including its implementation and methods.
@@ -40,6 +69,18 @@ type Server struct {
 	services        map[string]*ServiceDesc
 	servicesByID    map[uint32]*ServiceDesc
 	rpcElementChain *element.RPCElementChain
+
+	// RPCs taking longer than this are logged with detailed timings (0 disables the slow query log)
+	slowQueryThreshold time.Duration
+
+	// Responses larger than this are replaced by a ResourceExhausted error (0: no limit)
+	maxSendMsgSize int
+
+	// Runs method handlers, taking the requests of different clients in turn
+	dispatcher *dispatcher
+
+	stopOnce sync.Once
+	stopped  chan struct{} // closed by Stop
 }
 
 // NewServer initializes a new Server instance with the given address and serializer.
@@ -67,6 +108,8 @@ func NewServer(addr string, serializer serializer.Serializer, rpcElements []elem
 		services:        make(map[string]*ServiceDesc),
 		servicesByID:    make(map[uint32]*ServiceDesc),
 		rpcElementChain: element.NewRPCElementChain(rpcElements...),
+		dispatcher:      newDispatcher(),
+		stopped:         make(chan struct{}),
 	}, nil
 }
 
@@ -77,14 +120,90 @@ func (s *Server) RegisterService(desc *ServiceDesc, impl any) {
 	logging.Info("Registered service", zap.String("serviceName", desc.ServiceName), zap.Uint32("serviceID", desc.ServiceID))
 }
 
+// SetSlowQueryThreshold enables the slow query log: RPCs taking longer than threshold
+// (from request receipt to response sent) are logged with sizes, fragment count and timings.
+// A threshold of 0 disables it.
+func (s *Server) SetSlowQueryThreshold(threshold time.Duration) {
+	s.slowQueryThreshold = threshold
+}
+
+// SetMaxSendMsgSize limits the size of responses, in bytes. A handler returning a larger
+// response fails the call with an RPCResourceExhaustedError instead. The limit a client
+// advertises with Client.SetMaxRecvMsgSize applies as well, whichever is smaller. 0 removes
+// the server's limit.
+func (s *Server) SetMaxSendMsgSize(size int) {
+	s.maxSendMsgSize = size
+}
+
+// SetMaxConcurrentRPCs handles up to workers requests at once, each on its own goroutine.
+// Workers take the requests of different clients in turn, so that a client pipelining many
+// requests does not delay the others. With 0 (the default), requests are handled one at a
+// time in the receive loop. It must be called before Start.
+func (s *Server) SetMaxConcurrentRPCs(workers int) {
+	s.dispatcher.workers = max(workers, 0)
+}
+
+// SetPeerLimits caps the requests of each client (by peer address) that are handled at
+// once to maxInFlight, and those waiting for a worker to maxQueued. Requests beyond
+// maxQueued are rejected with a packet.ThrottleBackoff error so the client backs off.
+// 0 removes a limit. They only apply with SetMaxConcurrentRPCs, and must be set before Start.
+func (s *Server) SetPeerLimits(maxInFlight, maxQueued int) {
+	s.dispatcher.maxInFlight = max(maxInFlight, 0)
+	s.dispatcher.maxQueued = max(maxQueued, 0)
+}
+
+// PeerLoads returns the number of requests in flight and queued for each client that
+// has any
+func (s *Server) PeerLoads() map[string]PeerLoad {
+	return s.dispatcher.loads()
+}
+
+// WritePeerMetrics writes the loads of PeerLoads as the arpc_server_peer_in_flight and
+// arpc_server_peer_queued gauges in the Prometheus text exposition format
+func (s *Server) WritePeerMetrics(w io.Writer) (int64, error) {
+	return s.dispatcher.writeMetrics(w)
+}
+
+// sendLimit returns the largest response of a method with methodLimit the server may send
+// to a client that advertised clientLimit (0 if none of them sets a limit)
+func (s *Server) sendLimit(clientLimit, methodLimit int) int {
+	limit := 0
+	for _, l := range []int{s.maxSendMsgSize, clientLimit, methodLimit} {
+		if l > 0 && (limit == 0 || l < limit) {
+			limit = l
+		}
+	}
+	return limit
+}
+
+// checkSlowQuery logs the record if the RPC exceeded the slow query threshold
+func (s *Server) checkSlowQuery(record *SlowQueryRecord, timings *element.ElementTimings, recvTime time.Time) {
+	if record == nil {
+		return
+	}
+	record.Total = time.Since(recvTime)
+	if record.Total < s.slowQueryThreshold {
+		return
+	}
+	record.ElementTimings = timings.Timings()
+	record.log(s.slowQueryThreshold)
+}
+
 // Start begins listening for incoming RPC requests, dispatching to the appropriate service/method handler.
+// It returns once Stop is called.
 func (s *Server) Start() {
 	logging.Info("Server started... Waiting for messages.")
+	s.dispatcher.start()
 
 	for {
 		// Receive a packet from a client
 		data, addr, rpcID, _, err := s.transport.Receive(packet.MaxUDPPayloadSize, transport.RoleServer)
 		if err != nil {
+			select {
+			case <-s.stopped:
+				return
+			default:
+			}
 			logging.Error("Error receiving data", zap.Error(err))
 			if err := s.transport.Send(addr.String(), rpcID, []byte(err.Error()), packet.PacketTypeUnknown); err != nil {
 				logging.Error("Error sending error response", zap.Error(err))
@@ -95,7 +214,19 @@ func (s *Server) Start() {
 		if data == nil {
 			continue // Either still waiting for fragments or we received an non-data packet
 		}
-		logging.Debug("Received message", zap.Int("length", len(data)), zap.String("from", addr.String()), zap.Uint64("rpcID", rpcID))
+		recvTime := time.Now()
+		clientRecvLimit, _ := s.transport.TakeRecvLimit(rpcID)
+		authenticated := s.transport.TakeAuthenticated(rpcID)
+		userAgent, _ := s.transport.TakeUserAgent(rpcID)
+		origin, hasOrigin := s.transport.TakeOrigin(rpcID)
+		sealed, _ := s.transport.TakeSealedMessage(rpcID)
+		// Calls the client encrypted although this server does not are answered encrypted
+		encryption := transport.EncryptionDefault
+		if s.transport.TakeCallEncrypted(rpcID) {
+			encryption = transport.EncryptionRequired
+		}
+		logging.Debug("Received message", zap.Int("length", len(data)), zap.String("from", addr.String()), zap.Uint64("rpcID", rpcID),
+			zap.Uint64("originID", origin.ID), zap.Uint8("hops", origin.Hops))
 
 		// Data is already the raw payload
 		reqPayloadBytes := data
@@ -111,9 +242,28 @@ func (s *Server) Start() {
 		}
 		serviceID := binary.LittleEndian.Uint32(reqPayloadBytes[5:9])
 		methodID := binary.LittleEndian.Uint32(reqPayloadBytes[9:13])
+		// Echo keepalive probes of clients (see Client.SetKeepalive) without dispatching them
+		if serviceID == keepaliveServiceID {
+			if _, err := s.transport.SendWithProfile(addr.String(), rpcID, reqPayloadBytes, packet.PacketTypeResponse, encryption); err != nil {
+				logging.Error("Error answering keepalive probe", zap.Error(err))
+			}
+			s.transport.GetBufferPool().Put(data)
+			continue
+		}
+		// Remember the codec of the request so that the response uses the same one
+		reqCodecTag := reqPayloadBytes[0]
 
-		// Create context (no metadata)
-		ctx := context.Background()
+		// Create context carrying the client address, and its user agent as metadata if any
+		ctx := withPeer(context.Background(), addr)
+		if userAgent != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.New(map[string]string{UserAgentKey: userAgent}))
+		}
+		if sealed != nil {
+			ctx = context.WithValue(ctx, sealedKey{}, sealed)
+		}
+		if hasOrigin {
+			ctx = withOrigin(ctx, origin)
+		}
 
 		// Create RPC request for element processing
 		rpcReq := &element.RPCRequest{
@@ -147,45 +297,213 @@ func (s *Server) Start() {
 		}
 		rpcReq.Method = methodDesc.MethodName
 
-		// Invoke method handler with context containing metadata
-		rpcResp, _, err := methodDesc.Handler(svcDesc.ServiceImpl, ctx, func(v any) error {
-			return s.serializer.Unmarshal(reqPayloadBytes, v)
-		}, rpcReq, s.rpcElementChain)
-
-		// Return buffer to pool after unmarshaling (handler has copied what it needs)
-		s.transport.GetBufferPool().Put(data)
-		if err != nil {
-			var errType packet.PacketType
-			if rpcErr, ok := err.(*RPCError); ok && rpcErr.Type == RPCFailError {
-				errType = packet.PacketTypeError
-			} else {
-				errType = packet.PacketTypeUnknown
-				logging.Error("Handler error", zap.Error(err))
-			}
-			// Buffer already returned to pool above
-			if err := s.transport.Send(addr.String(), rpcID, []byte(err.Error()), errType); err != nil {
+		// Enforce the options of the method before the request is decoded
+		if rpcErr := checkRequest(methodDesc, len(reqPayloadBytes), authenticated); rpcErr != nil {
+			logging.Warn("Rejected request",
+				zap.String("service", svcDesc.ServiceName),
+				zap.String("method", methodDesc.MethodName),
+				zap.String("from", addr.String()),
+				zap.Error(rpcErr))
+			s.transport.GetBufferPool().Put(data)
+			if err := s.transport.SendErrorWithHint(addr.String(), rpcID, rpcErr.Error(), packet.PacketTypeError, packet.RetryHint{}); err != nil {
 				logging.Error("Error sending error response", zap.Error(err))
 			}
 			continue
 		}
 
-		// Serialize response
-		respPayloadBytes, err := s.serializer.Marshal(rpcResp.Result)
-		if err != nil {
-			logging.Error("Error marshaling response", zap.Error(err))
-			if err := s.transport.Send(addr.String(), rpcID, []byte(err.Error()), packet.PacketTypeUnknown); err != nil {
+		call := &serverCall{
+			ctx:             ctx,
+			peer:            addr.String(),
+			rpcID:           rpcID,
+			data:            data,
+			codecTag:        reqCodecTag,
+			recvTime:        recvTime,
+			clientRecvLimit: clientRecvLimit,
+			encryption:      encryption,
+			request:         rpcReq,
+			service:         svcDesc,
+			method:          methodDesc,
+		}
+		if !s.dispatcher.submit(call.peer, func() { s.handleCall(call) }) {
+			// Ask the client to back off rather than queue without bound behind its own requests
+			logging.Warn("Too many queued requests from client", zap.String("from", call.peer), zap.Uint64("rpcID", rpcID))
+			s.transport.GetBufferPool().Put(data)
+			hint := packet.RetryHint{Throttle: packet.ThrottleBackoff}
+			if err := s.transport.SendErrorWithHint(call.peer, rpcID, "too many queued requests", packet.PacketTypeError, hint); err != nil {
 				logging.Error("Error sending error response", zap.Error(err))
 			}
-			continue
 		}
+	}
+}
+
+// Stop shuts the server down: Start returns, the workers of SetMaxConcurrentRPCs exit once
+// their current request is handled, and the transport is closed. Later calls do nothing.
+func (s *Server) Stop() error {
+	var err error
+	s.stopOnce.Do(func() {
+		close(s.stopped)
+		s.dispatcher.stop()
+		err = s.transport.Close()
+	})
+	return err
+}
+
+// checkRequest returns the error for a request of size bytes that violates the options of
+// its method, if any
+func checkRequest(method *MethodDesc, size int, authenticated bool) *RPCError {
+	opts := method.Options
+	if opts.RequireAuth && !authenticated {
+		return &RPCError{Type: RPCUnauthenticatedError, Reason: fmt.Sprintf("%smethod %s requires an authenticated request", UnauthenticatedErrorPrefix, method.MethodName)}
+	}
+	if opts.MaxRecvMsgSize > 0 && size > opts.MaxRecvMsgSize {
+		return newTooLargeError("request", size, opts.MaxRecvMsgSize)
+	}
+	return nil
+}
+
+// serverCall is a received request waiting to be handled
+type serverCall struct {
+	ctx             context.Context
+	peer            string
+	rpcID           uint64
+	data            []byte // request payload, returned to the buffer pool once unmarshaled
+	codecTag        byte   // codec of the request, which the response uses as well
+	recvTime        time.Time
+	clientRecvLimit int
+	encryption      transport.EncryptionProfile // of the response, that of the request
+	request         *element.RPCRequest
+	service         *ServiceDesc
+	method          *MethodDesc
+}
+
+// handleCall invokes the method handler of a request and sends its response
+func (s *Server) handleCall(c *serverCall) {
+	ctx := c.ctx
+
+	// Collect timings for the slow query log if enabled
+	var slowRecord *SlowQueryRecord
+	var timings *element.ElementTimings
+	if s.slowQueryThreshold > 0 {
+		slowRecord = &SlowQueryRecord{
+			RPCID:        c.rpcID,
+			Service:      c.service.ServiceName,
+			Method:       c.method.MethodName,
+			RequestBytes: len(c.data),
+		}
+		ctx, timings = element.WithElementTimings(ctx)
+	}
+
+	opts := c.method.Options
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	// Invoke method handler with context containing metadata
+	handlerStart := time.Now()
+	rpcResp, _, err := c.method.Handler(c.service.ServiceImpl, ctx, func(v any) error {
+		if sealed, ok := SealedRequestFromContext(ctx); ok {
+			if err := sealed.OpenAll(); err != nil {
+				return err
+			}
+		}
+		mark := allocaudit.Start()
+		defer mark.Finish(allocaudit.PathReceive, c.rpcID, 0)
+		return serializer.UnmarshalMessage(s.serializer, c.data, v)
+	}, c.request, s.rpcElementChain)
+	// The handler ran past its deadline, so its response is late even if it ignored ctx
+	if opts.Timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = newDeadlineExceededError(c.method.MethodName, opts)
+	}
+	if slowRecord != nil {
+		slowRecord.QueueWait = handlerStart.Sub(c.recvTime)
+		slowRecord.HandlerTime = time.Since(handlerStart)
+		slowRecord.Error = err
+	}
+
+	// Return buffer to pool after unmarshaling (handler has copied what it needs). With the
+	// unsafe fast path, the request and maybe the response alias the buffer, so it is left to
+	// the GC.
+	if !serializer.UnsafeFastPath {
+		s.transport.GetBufferPool().Put(c.data)
+	}
+	if err != nil {
+		var errType packet.PacketType
+		var hint packet.RetryHint
+		if rpcErr, ok := err.(*RPCError); ok && (rpcErr.Type == RPCFailError || rpcErr.Type == RPCDeadlineExceededError) {
+			errType = packet.PacketTypeError
+			hint = rpcErr.RetryHint
+		} else {
+			errType = packet.PacketTypeUnknown
+			logging.Error("Handler error", zap.Error(err))
+		}
+		// Buffer already returned to pool above
+		if err := s.transport.SendErrorWithHint(c.peer, c.rpcID, err.Error(), errType, hint); err != nil {
+			logging.Error("Error sending error response", zap.Error(err))
+		}
+		s.checkSlowQuery(slowRecord, timings, c.recvTime)
+		return
+	}
 
-		// Send the response payload directly (no framing)
-		err = s.transport.Send(addr.String(), rpcID, respPayloadBytes, packet.PacketTypeResponse)
+	// Serialize response (in the codec of the request if the serializer supports several)
+	mark := allocaudit.Start()
+	var respPayloadBytes []byte
+	if cm, ok := s.serializer.(serializer.CodecMarshaler); ok && !serializer.IsRaw(rpcResp.Result) {
+		respPayloadBytes, err = cm.MarshalWithCodec(rpcResp.Result, c.codecTag)
+	} else {
+		respPayloadBytes, err = serializer.MarshalMessage(s.serializer, rpcResp.Result)
+	}
+	if err != nil {
+		logging.Error("Error marshaling response", zap.Error(err))
+		if err := s.transport.Send(c.peer, c.rpcID, []byte(err.Error()), packet.PacketTypeUnknown); err != nil {
+			logging.Error("Error sending error response", zap.Error(err))
+		}
+		if slowRecord != nil {
+			slowRecord.Error = err
+		}
+		s.checkSlowQuery(slowRecord, timings, c.recvTime)
+		return
+	}
+
+	// Fail the call rather than send a response the client would reject or could not reassemble
+	if limit := s.sendLimit(c.clientRecvLimit, c.method.Options.MaxSendMsgSize); limit > 0 && len(respPayloadBytes) > limit {
+		err = newTooLargeError("response", len(respPayloadBytes), limit)
+	}
+
+	// Send the response payload directly (no framing)
+	fragments := 0
+	if err == nil {
+		fragments, err = s.transport.SendWithProfile(c.peer, c.rpcID, respPayloadBytes, packet.PacketTypeResponse, c.encryption)
+		if err == nil {
+			mark.Finish(allocaudit.PathSend, c.rpcID, fragments)
+		}
+		if errors.Is(err, transport.ErrMessageTooLarge) {
+			err = &RPCError{Type: RPCResourceExhaustedError, Reason: ResourceExhaustedErrorPrefix + err.Error(), Cause: err}
+		}
+	}
+
+	if rpcErr, ok := err.(*RPCError); ok && rpcErr.Type == RPCResourceExhaustedError {
+		logging.Warn("Response too large",
+			zap.String("service", c.service.ServiceName),
+			zap.String("method", c.method.MethodName),
+			zap.Int("size", len(respPayloadBytes)),
+			zap.Error(err))
+		if err := s.transport.SendErrorWithHint(c.peer, c.rpcID, rpcErr.Error(), packet.PacketTypeError, packet.RetryHint{}); err != nil {
+			logging.Error("Error sending error response", zap.Error(err))
+		}
+	} else if err != nil {
+		logging.Error("Error sending response", zap.Error(err))
+	}
 
+	if slowRecord != nil {
+		slowRecord.ResponseBytes = len(respPayloadBytes)
+		slowRecord.ResponseFragments = fragments
 		if err != nil {
-			logging.Error("Error sending response", zap.Error(err))
+			slowRecord.Error = err
 		}
 	}
+	s.checkSlowQuery(slowRecord, timings, c.recvTime)
 }
 
 // Temporary functions to register packet types and handlers.
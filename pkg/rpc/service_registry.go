@@ -22,6 +22,16 @@ func (r *ServiceRegistry) RegisterService(serviceName string, serviceID uint32,
 	r.serviceMethodToID[serviceName] = methodMap
 }
 
+// RegisterNamedService registers a service of a Mux, whose service and methods are numbered
+// by NameID
+func (r *ServiceRegistry) RegisterNamedService(serviceName string, methodNames ...string) {
+	methodMap := make(map[string]uint32, len(methodNames))
+	for _, method := range methodNames {
+		methodMap[method] = NameID(method)
+	}
+	r.RegisterService(serviceName, NameID(serviceName), methodMap)
+}
+
 // GetServiceID looks up a service ID by name
 func (r *ServiceRegistry) GetServiceID(serviceName string) (uint32, bool) {
 	id, ok := r.serviceNameToID[serviceName]
@@ -0,0 +1,47 @@
+package rpc
+
+import (
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/rpc/element"
+	"go.uber.org/zap"
+)
+
+// SlowQueryRecord holds the details logged for an RPC that exceeded the slow query threshold
+type SlowQueryRecord struct {
+	RPCID             uint64
+	Service           string
+	Method            string
+	RequestBytes      int
+	ResponseBytes     int
+	ResponseFragments int
+	QueueWait         time.Duration // time between receiving the request and invoking the handler
+	HandlerTime       time.Duration // time spent in the method handler (including elements)
+	Total             time.Duration
+	ElementTimings    []element.ElementTiming
+	Error             error
+}
+
+// log writes the record as a single structured warning
+func (r *SlowQueryRecord) log(threshold time.Duration) {
+	fields := []zap.Field{
+		zap.Uint64("rpcID", r.RPCID),
+		zap.String("service", r.Service),
+		zap.String("method", r.Method),
+		zap.Int("requestBytes", r.RequestBytes),
+		zap.Int("responseBytes", r.ResponseBytes),
+		zap.Int("responseFragments", r.ResponseFragments),
+		zap.Duration("queueWait", r.QueueWait),
+		zap.Duration("handlerTime", r.HandlerTime),
+		zap.Duration("total", r.Total),
+		zap.Duration("threshold", threshold),
+	}
+	for _, timing := range r.ElementTimings {
+		fields = append(fields, zap.Duration("element."+timing.Name+"."+timing.Phase, timing.Duration))
+	}
+	if r.Error != nil {
+		fields = append(fields, zap.Error(r.Error))
+	}
+	logging.Warn("Slow RPC", fields...)
+}
@@ -0,0 +1,205 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLatencyBuckets are the default histogram buckets (in seconds) for call latency
+var DefaultLatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// tagKey is the context key used to carry the RPC tag between events
+type tagKey struct{}
+
+// labels identifies a time series (service, method)
+type labels struct {
+	service string
+	method  string
+}
+
+// methodMetrics holds all series of a single service/method pair
+type methodMetrics struct {
+	started       uint64
+	succeeded     uint64
+	failed        uint64
+	retries       uint64
+	sentBytes     uint64
+	receivedBytes uint64
+	sentFragments uint64
+	hops          uint64
+	latencyCounts []uint64 // cumulative counts per bucket
+	latencySum    float64
+	latencyCount  uint64
+}
+
+// MetricsWriter writes further metrics in the Prometheus text exposition format, such as the
+// WriteMetrics method of a transport
+type MetricsWriter func(w io.Writer) (int64, error)
+
+// PrometheusHandler is a Handler that aggregates client stats and exposes them in the
+// Prometheus text exposition format. It implements http.Handler so it can be mounted
+// directly on a /metrics endpoint.
+type PrometheusHandler struct {
+	buckets []float64
+
+	mu      sync.Mutex
+	metrics map[labels]*methodMetrics
+	writers []MetricsWriter
+}
+
+// NewPrometheusHandler creates a Prometheus stats handler.
+// If no buckets are given, DefaultLatencyBuckets is used.
+func NewPrometheusHandler(buckets ...float64) *PrometheusHandler {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	return &PrometheusHandler{
+		buckets: sorted,
+		metrics: make(map[labels]*methodMetrics),
+	}
+}
+
+// Register adds writers whose metrics are written after those of the handler, e.g.
+// handler.Register(client.Transport().WriteMetrics)
+func (p *PrometheusHandler) Register(writers ...MetricsWriter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.writers = append(p.writers, writers...)
+}
+
+// TagRPC stores the service and method in the context
+func (p *PrometheusHandler) TagRPC(ctx context.Context, info *RPCTagInfo) context.Context {
+	return context.WithValue(ctx, tagKey{}, labels{service: info.Service, method: info.Method})
+}
+
+// HandleRPC updates the series of the tagged service/method
+func (p *PrometheusHandler) HandleRPC(ctx context.Context, s RPCStats) {
+	l, _ := ctx.Value(tagKey{}).(labels)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m, ok := p.metrics[l]
+	if !ok {
+		m = &methodMetrics{latencyCounts: make([]uint64, len(p.buckets))}
+		p.metrics[l] = m
+	}
+
+	switch st := s.(type) {
+	case *Begin:
+		m.started++
+	case *OutPayload:
+		m.sentBytes += uint64(st.Bytes)
+		m.sentFragments += uint64(st.Fragments)
+		m.hops += uint64(st.Origin.Hops)
+	case *InPayload:
+		m.receivedBytes += uint64(st.Bytes)
+	case *Retry:
+		m.retries++
+	case *End:
+		if st.Error != nil {
+			m.failed++
+		} else {
+			m.succeeded++
+		}
+		latency := st.EndTime.Sub(st.BeginTime).Seconds()
+		for i, bound := range p.buckets {
+			if latency <= bound {
+				m.latencyCounts[i]++
+			}
+		}
+		m.latencySum += latency
+		m.latencyCount++
+	}
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format
+func (p *PrometheusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.WriteTo(w)
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format
+func (p *PrometheusHandler) WriteTo(w io.Writer) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Sort series so the output is stable
+	keys := make([]labels, 0, len(p.metrics))
+	for l := range p.metrics {
+		keys = append(keys, l)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].service != keys[j].service {
+			return keys[i].service < keys[j].service
+		}
+		return keys[i].method < keys[j].method
+	})
+
+	var b strings.Builder
+	writeCounter := func(name, help string, value func(*methodMetrics) uint64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for _, l := range keys {
+			fmt.Fprintf(&b, "%s{%s} %d\n", name, l.format(), value(p.metrics[l]))
+		}
+	}
+
+	writeCounter("arpc_client_started_total", "Total number of RPCs started by the client.",
+		func(m *methodMetrics) uint64 { return m.started })
+
+	fmt.Fprintf(&b, "# HELP arpc_client_handled_total Total number of RPCs completed by the client, by result.\n")
+	fmt.Fprintf(&b, "# TYPE arpc_client_handled_total counter\n")
+	for _, l := range keys {
+		m := p.metrics[l]
+		fmt.Fprintf(&b, "arpc_client_handled_total{%s,result=\"ok\"} %d\n", l.format(), m.succeeded)
+		fmt.Fprintf(&b, "arpc_client_handled_total{%s,result=\"error\"} %d\n", l.format(), m.failed)
+	}
+
+	writeCounter("arpc_client_retries_total", "Total number of RPC retries.",
+		func(m *methodMetrics) uint64 { return m.retries })
+	writeCounter("arpc_client_sent_bytes_total", "Total number of request bytes sent.",
+		func(m *methodMetrics) uint64 { return m.sentBytes })
+	writeCounter("arpc_client_received_bytes_total", "Total number of response bytes received.",
+		func(m *methodMetrics) uint64 { return m.receivedBytes })
+	writeCounter("arpc_client_sent_fragments_total", "Total number of request packets sent.",
+		func(m *methodMetrics) uint64 { return m.sentFragments })
+	writeCounter("arpc_client_request_hops_total", "Total number of hops of the requests sent since their origin.",
+		func(m *methodMetrics) uint64 { return m.hops })
+
+	fmt.Fprintf(&b, "# HELP arpc_client_handling_seconds Histogram of RPC latency as seen by the client.\n")
+	fmt.Fprintf(&b, "# TYPE arpc_client_handling_seconds histogram\n")
+	for _, l := range keys {
+		m := p.metrics[l]
+		for i, bound := range p.buckets {
+			fmt.Fprintf(&b, "arpc_client_handling_seconds_bucket{%s,le=\"%s\"} %d\n", l.format(), strconv.FormatFloat(bound, 'g', -1, 64), m.latencyCounts[i])
+		}
+		fmt.Fprintf(&b, "arpc_client_handling_seconds_bucket{%s,le=\"+Inf\"} %d\n", l.format(), m.latencyCount)
+		fmt.Fprintf(&b, "arpc_client_handling_seconds_sum{%s} %s\n", l.format(), strconv.FormatFloat(m.latencySum, 'g', -1, 64))
+		fmt.Fprintf(&b, "arpc_client_handling_seconds_count{%s} %d\n", l.format(), m.latencyCount)
+	}
+
+	n, err := io.WriteString(w, b.String())
+	written := int64(n)
+	for _, write := range p.writers {
+		if err != nil {
+			break
+		}
+		n, werr := write(w)
+		written, err = written+n, werr
+	}
+	return written, err
+}
+
+// format renders the labels in the Prometheus label syntax
+func (l labels) format() string {
+	return fmt.Sprintf("service=%s,method=%s", strconv.Quote(l.service), strconv.Quote(l.method))
+}
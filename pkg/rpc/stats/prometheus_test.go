@@ -0,0 +1,67 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+)
+
+func TestPrometheusHandler_WriteTo(t *testing.T) {
+	h := NewPrometheusHandler(0.01, 0.1)
+
+	begin := time.Now()
+	for i, callErr := range []error{nil, errors.New("boom")} {
+		ctx := h.TagRPC(context.Background(), &RPCTagInfo{Service: "kv.KVService", Method: "Get"})
+		h.HandleRPC(ctx, &Begin{RPCID: uint64(i), Service: "kv.KVService", Method: "Get", BeginTime: begin})
+		h.HandleRPC(ctx, &OutPayload{RPCID: uint64(i), Bytes: 100, Fragments: 2, Origin: packet.Origin{ID: 7, Hops: 3}})
+		h.HandleRPC(ctx, &InPayload{RPCID: uint64(i), Bytes: 40})
+		h.HandleRPC(ctx, &End{RPCID: uint64(i), BeginTime: begin, EndTime: begin.Add(50 * time.Millisecond), Error: callErr})
+	}
+
+	var b strings.Builder
+	if _, err := h.WriteTo(&b); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out := b.String()
+
+	expected := []string{
+		`arpc_client_started_total{service="kv.KVService",method="Get"} 2`,
+		`arpc_client_handled_total{service="kv.KVService",method="Get",result="ok"} 1`,
+		`arpc_client_handled_total{service="kv.KVService",method="Get",result="error"} 1`,
+		`arpc_client_sent_bytes_total{service="kv.KVService",method="Get"} 200`,
+		`arpc_client_received_bytes_total{service="kv.KVService",method="Get"} 80`,
+		`arpc_client_sent_fragments_total{service="kv.KVService",method="Get"} 4`,
+		`arpc_client_request_hops_total{service="kv.KVService",method="Get"} 6`,
+		`arpc_client_handling_seconds_bucket{service="kv.KVService",method="Get",le="0.01"} 0`,
+		`arpc_client_handling_seconds_bucket{service="kv.KVService",method="Get",le="0.1"} 2`,
+		`arpc_client_handling_seconds_bucket{service="kv.KVService",method="Get",le="+Inf"} 2`,
+		`arpc_client_handling_seconds_count{service="kv.KVService",method="Get"} 2`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Missing line %q in output:\n%s", line, out)
+		}
+	}
+}
+
+func TestPrometheusHandler_Register(t *testing.T) {
+	h := NewPrometheusHandler()
+	h.Register(func(w io.Writer) (int64, error) {
+		n, err := io.WriteString(w, "arpc_transport_datagrams_sent_total 3\n")
+		return int64(n), err
+	})
+
+	var b strings.Builder
+	n, err := h.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(b.String(), "arpc_transport_datagrams_sent_total 3\n") || n != int64(b.Len()) {
+		t.Errorf("Expected the registered metrics at the end of %d bytes, got %d bytes:\n%s", b.Len(), n, b.String())
+	}
+}
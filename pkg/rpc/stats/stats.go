@@ -0,0 +1,102 @@
+// Package stats defines the hooks the RPC client uses to report per-call statistics,
+// so applications can plug in their own metrics systems.
+package stats
+
+import (
+	"context"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+)
+
+// Handler receives per-call statistics from the client.
+// Implementations must be safe for concurrent use.
+type Handler interface {
+	// TagRPC is called before any other event of a call. The returned context is
+	// passed to every HandleRPC call for the same RPC.
+	TagRPC(ctx context.Context, info *RPCTagInfo) context.Context
+
+	// HandleRPC processes an RPC event.
+	HandleRPC(ctx context.Context, s RPCStats)
+}
+
+// RPCTagInfo identifies the RPC being tagged
+type RPCTagInfo struct {
+	Service string
+	Method  string
+}
+
+// RPCStats is implemented by all RPC events
+type RPCStats interface {
+	isRPCStats()
+}
+
+// Begin is reported when a call starts
+type Begin struct {
+	RPCID     uint64
+	Service   string
+	Method    string
+	BeginTime time.Time
+}
+
+// OutPayload is reported when the request has been sent
+type OutPayload struct {
+	RPCID     uint64
+	Bytes     int           // serialized request size (before encryption)
+	Fragments int           // number of packets written to the socket
+	Origin    packet.Origin // origin of the request and its hops so far
+	SentTime  time.Time
+}
+
+// InPayload is reported when a response or error packet has been received
+type InPayload struct {
+	RPCID    uint64
+	Bytes    int
+	RecvTime time.Time
+}
+
+// Retry is reported each time a call is retried
+type Retry struct {
+	RPCID   uint64
+	Attempt int           // 1 for the first retry
+	Error   error         // error of the previous attempt
+	Backoff time.Duration // wait before this retry, including any retry-after hint
+}
+
+// End is reported when a call completes
+type End struct {
+	RPCID     uint64
+	BeginTime time.Time
+	EndTime   time.Time
+	Error     error // nil if the call succeeded
+}
+
+func (*Begin) isRPCStats()      {}
+func (*OutPayload) isRPCStats() {}
+func (*InPayload) isRPCStats()  {}
+func (*Retry) isRPCStats()      {}
+func (*End) isRPCStats()        {}
+
+// multiHandler passes the events of a call to several handlers
+type multiHandler []Handler
+
+// MultiHandler returns a Handler passing every event to each of handlers, in order, e.g.
+// to aggregate metrics and export traces of the same calls
+func MultiHandler(handlers ...Handler) Handler {
+	return multiHandler(handlers)
+}
+
+// TagRPC tags the context with each handler in turn
+func (m multiHandler) TagRPC(ctx context.Context, info *RPCTagInfo) context.Context {
+	for _, h := range m {
+		ctx = h.TagRPC(ctx, info)
+	}
+	return ctx
+}
+
+// HandleRPC passes the event to each handler
+func (m multiHandler) HandleRPC(ctx context.Context, s RPCStats) {
+	for _, h := range m {
+		h.HandleRPC(ctx, s)
+	}
+}
@@ -1,5 +1,11 @@
 package rpc
 
+import (
+	"fmt"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+)
+
 type RPCErrorType struct {
 	Name string
 }
@@ -12,13 +18,79 @@ var (
 	// (1) service/method not found
 	// (2) RPC rejected by element policy
 	RPCFailError = RPCErrorType{Name: "fail"}
+	// RPCUnavailableError represents a call that failed because the destination is unreachable,
+	// as reported by ICMP (e.g. no server listens on the port), or because the request exceeds
+	// the path MTU. The request was not processed, so the call is safe to retry.
+	RPCUnavailableError = RPCErrorType{Name: "unavailable"}
+	// RPCResourceExhaustedError represents a call whose response is larger than the server's
+	// MaxSendMsgSize or the client's MaxRecvMsgSize. The handler ran, but its response was
+	// not sent, so retrying gets the same error.
+	RPCResourceExhaustedError = RPCErrorType{Name: "resource_exhausted"}
+	// RPCDeadlineExceededError represents a call whose handler did not complete within the
+	// Timeout of its method. The handler may have had effects, so only calls of Idempotent
+	// methods come with a retry hint.
+	RPCDeadlineExceededError = RPCErrorType{Name: "deadline_exceeded"}
+	// RPCUnauthenticatedError represents a call of a method with RequireAuth whose request did
+	// not carry a valid auth tag. The request was not processed.
+	RPCUnauthenticatedError = RPCErrorType{Name: "unauthenticated"}
+	// RPCDroppedError represents a call dropped by a proxy on the path, e.g. by an element
+	// policy or a rate limit. RPCError.DropReason says why (see Client.SubscribeDrops).
+	RPCDroppedError = RPCErrorType{Name: "dropped"}
+)
+
+// Prefixes of the error messages of the server's own failures, so that clients tell them
+// apart from other failures
+const (
+	ResourceExhaustedErrorPrefix = "resource exhausted: "
+	DeadlineExceededErrorPrefix  = "deadline exceeded: "
+	UnauthenticatedErrorPrefix   = "unauthenticated: "
 )
 
 type RPCError struct {
 	Type   RPCErrorType
 	Reason string
+	// RetryHint is the load signal sent along with the error. Handlers set it to ask
+	// clients to back off; on the client it holds the hint of the server or proxy.
+	RetryHint packet.RetryHint
+	// DropReason is why a proxy on the path dropped the call, packet.DropReasonNone for
+	// errors of the server. Clients branch on it instead of parsing Reason.
+	DropReason packet.DropReason
+	// Cause is the underlying error, if any (e.g. the *transport.ICMPError of an unavailable call)
+	Cause error
+}
+
+// NewThrottleError returns an error that a handler can return to shed load. The
+// client's retry policy waits at least hint.RetryAfter before retrying, and does not
+// retry at all if hint.Throttle is packet.ThrottleOverloaded.
+func NewThrottleError(reason string, hint packet.RetryHint) *RPCError {
+	return &RPCError{Type: RPCFailError, Reason: reason, RetryHint: hint}
+}
+
+// newTooLargeError returns the error for a request or response (kind) of size bytes over limit
+func newTooLargeError(kind string, size, limit int) *RPCError {
+	return &RPCError{
+		Type:   RPCResourceExhaustedError,
+		Reason: fmt.Sprintf("%s%s of %d bytes exceeds the limit of %d bytes", ResourceExhaustedErrorPrefix, kind, size, limit),
+	}
+}
+
+// newDeadlineExceededError returns the error for a call of method that ran past opts.Timeout
+func newDeadlineExceededError(method string, opts MethodOptions) *RPCError {
+	rpcErr := &RPCError{
+		Type:   RPCDeadlineExceededError,
+		Reason: fmt.Sprintf("%smethod %s did not complete within %v", DeadlineExceededErrorPrefix, method, opts.Timeout),
+	}
+	if opts.Idempotent {
+		rpcErr.RetryHint = packet.RetryHint{Throttle: packet.ThrottleBackoff}
+	}
+	return rpcErr
 }
 
 func (e *RPCError) Error() string {
 	return e.Reason
 }
+
+// Unwrap returns the underlying error
+func (e *RPCError) Unwrap() error {
+	return e.Cause
+}
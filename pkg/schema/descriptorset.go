@@ -0,0 +1,111 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// LoadFile registers the schemas of a file holding either a binary FileDescriptorSet (as
+// written by protoc --descriptor_set_out) or a schema blob produced by Encode (the one
+// protoc-gen-symphony embeds in generated files). Those blobs only hold messages, so
+// requests can be decoded by message name but not by method IDs; blobs of Export also hold
+// methods.
+func (r *Registry) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// A FileDescriptorSet starts with the tag of its file field, never with the version byte
+	if len(data) > 0 && data[0] == encodingVersion {
+		return r.RegisterEncoded(data)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return fmt.Errorf("%s is neither a FileDescriptorSet nor a schema blob: %w", path, err)
+	}
+	return r.RegisterFileDescriptorSet(set)
+}
+
+// RegisterFileDescriptorSet registers the messages and services of the files of a set.
+// Services and methods get the IDs protoc-gen-arpc assigns: their position in the file and
+// in the service, starting from 1. Imports missing from the set (built with protoc
+// --include_imports, it has none) are looked up among the files linked into the binary,
+// such as the well-known types.
+//
+// Messages and methods without a Symphony encoding are skipped. They are reported in the
+// returned error, after all the others have been registered.
+func (r *Registry) RegisterFileDescriptorSet(set *descriptorpb.FileDescriptorSet) error {
+	files := new(protoregistry.Files)
+	resolver := fileResolver{files}
+	var errs []error
+	for _, fdp := range set.GetFile() {
+		fd, err := protodesc.NewFile(fdp, resolver)
+		if err != nil {
+			return err
+		}
+		if err := files.RegisterFile(fd); err != nil {
+			return err
+		}
+		errs = append(errs, r.registerFile(fd)...)
+	}
+	return errors.Join(errs...)
+}
+
+// registerFile registers the messages and services of a file, returning the errors of the
+// ones that were skipped
+func (r *Registry) registerFile(fd protoreflect.FileDescriptor) []error {
+	var errs []error
+	var registerMessages func(msgs protoreflect.MessageDescriptors)
+	registerMessages = func(msgs protoreflect.MessageDescriptors) {
+		for i := 0; i < msgs.Len(); i++ {
+			md := msgs.Get(i)
+			if md.IsMapEntry() {
+				continue
+			}
+			if err := r.RegisterDescriptor(md); err != nil {
+				errs = append(errs, err)
+			}
+			registerMessages(md.Messages())
+		}
+	}
+	registerMessages(fd.Messages())
+
+	services := fd.Services()
+	for i := 0; i < services.Len(); i++ {
+		sd := services.Get(i)
+		methods := sd.Methods()
+		for j := 0; j < methods.Len(); j++ {
+			if err := r.registerMethodDescriptor(uint32(i+1), uint32(j+1), methods.Get(j)); err != nil {
+				errs = append(errs, fmt.Errorf("method %s: %w", methods.Get(j).FullName(), err))
+			}
+		}
+	}
+	return errs
+}
+
+// fileResolver resolves the imports of a FileDescriptorSet from the files of the set
+// registered so far, then from the files linked into the binary
+type fileResolver struct {
+	local *protoregistry.Files
+}
+
+func (f fileResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if fd, err := f.local.FindFileByPath(path); err == nil {
+		return fd, nil
+	}
+	return protoregistry.GlobalFiles.FindFileByPath(path)
+}
+
+func (f fileResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if d, err := f.local.FindDescriptorByName(name); err == nil {
+		return d, nil
+	}
+	return protoregistry.GlobalFiles.FindDescriptorByName(name)
+}
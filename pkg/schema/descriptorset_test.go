@@ -0,0 +1,106 @@
+package schema_test
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	Test "github.com/appnet-org/arpc/cmd/symphony-gen-arpc/test"
+	"github.com/appnet-org/arpc/pkg/schema"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// writeFile writes data to a file of the test's temporary directory
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+func TestLoadFileDescriptorSet(t *testing.T) {
+	// test.proto with two services. Its imports (the well-known types) are left out of the
+	// set and resolved from the linked files.
+	fd := protodesc.ToFileDescriptorProto(Test.File_test_proto)
+	fd.Service = []*descriptorpb.ServiceDescriptorProto{
+		{Name: proto.String("Vault"), Method: []*descriptorpb.MethodDescriptorProto{
+			{Name: proto.String("Store"), InputType: proto.String(".Test.WellKnown"), OutputType: proto.String(".Test.Credentials")},
+			{Name: proto.String("Tag"), InputType: proto.String(".Test.Labels"), OutputType: proto.String(".Test.Empty")},
+		}},
+		{Name: proto.String("Shop"), Method: []*descriptorpb.MethodDescriptorProto{
+			{Name: proto.String("List"), InputType: proto.String(".Test.Catalog"), OutputType: proto.String(".Test.Catalog")},
+		}},
+	}
+	data, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{fd}})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	r := schema.NewRegistry()
+	err = r.LoadFile(writeFile(t, "test.pb", data))
+	// Labels has no Symphony encoding, so it and the method taking it are skipped
+	if err == nil || !strings.Contains(err.Error(), "Test.Labels") || !strings.Contains(err.Error(), "Test.Vault.Tag") {
+		t.Errorf("Expected Test.Labels and Test.Vault.Tag to be reported, got %v", err)
+	}
+	if _, ok := r.Method(1, 2); ok {
+		t.Error("Expected Vault.Tag not to be registered")
+	}
+
+	// IDs follow the positions of services and methods, like protoc-gen-arpc
+	if m, ok := r.Method(2, 1); !ok || m.Service != "Shop" || m.Method != "List" || m.Request != "Test.Catalog" {
+		t.Errorf("Unexpected method 2/1: %+v", m)
+	}
+	request, _ := (&Test.WellKnown{Nickname: wrapperspb.String("bob")}).MarshalSymphony()
+	binary.LittleEndian.PutUint32(request[5:9], 1)
+	binary.LittleEndian.PutUint32(request[9:13], 1)
+	d, err := r.DecodeRequest(request)
+	if err != nil {
+		t.Fatalf("DecodeRequest failed: %v", err)
+	}
+	if v, _ := d.Get("nickname"); !proto.Equal(v.(proto.Message), wrapperspb.String("bob")) {
+		t.Errorf("nickname: expected bob, got %v", v)
+	}
+	response, _ := (&Test.Credentials{User: "alice", CardNumber: "4111"}).MarshalSymphony()
+	d, err = r.DecodeResponse(1, 1, response)
+	if err != nil {
+		t.Fatalf("DecodeResponse failed: %v", err)
+	}
+	if expected := Test.CredentialsRaw(response).String(); d.String() != expected {
+		t.Errorf("Text mismatch.\nExpected: %s\nGot:      %s", expected, d.String())
+	}
+
+	// Messages used by no method are registered as well
+	if _, ok := r.Message("Test.Deltas"); !ok {
+		t.Error("Expected Test.Deltas to be registered")
+	}
+}
+
+func TestLoadFileSchemaBlob(t *testing.T) {
+	leaf, err := schema.FromDescriptor((&Test.Leaf{}).ProtoReflect().Descriptor())
+	if err != nil {
+		t.Fatalf("FromDescriptor failed: %v", err)
+	}
+	r := schema.NewRegistry()
+	if err := r.LoadFile(writeFile(t, "leaf.schema", schema.Encode([]*schema.Message{leaf}))); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	data, _ := (&Test.Leaf{LeafId: 7, LeafVal: "v"}).MarshalSymphony()
+	d, err := r.Decode(data, "Test.Leaf")
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if v, _ := d.Get("leaf_id"); v != int32(7) {
+		t.Errorf("leaf_id: expected 7, got %v", v)
+	}
+
+	if err := r.LoadFile(writeFile(t, "garbage", []byte{0xff, 0xff})); err == nil {
+		t.Error("Expected error for a file in neither format")
+	}
+}
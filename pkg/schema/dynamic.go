@@ -0,0 +1,627 @@
+package schema
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/appnet-org/arpc/pkg/serializer"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// DynamicMessage is a message decoded without its compiled type. Fields maps field numbers
+// to values:
+//
+//	bool, int32, int64, uint32, uint64, float32, float64  scalars (enums are int32)
+//	string, []byte                                        variable-length fields
+//	*DynamicMessage                                       nested messages
+//	proto.Message                                         well-known types (e.g. *timestamppb.Timestamp)
+//	[]any                                                 repeated fields, with elements as above
+//
+// Unset nested messages have no entry.
+type DynamicMessage struct {
+	Schema *Message
+	Fields map[int32]any
+
+	// PublicOnly is set when the payload only held the public segment, so private
+	// fields are missing
+	PublicOnly bool
+}
+
+// Get returns the value of the field with the given name
+func (d *DynamicMessage) Get(name string) (any, bool) {
+	f := d.Schema.FieldByName(name)
+	if f == nil {
+		return nil, false
+	}
+	v, ok := d.Fields[f.Number]
+	return v, ok
+}
+
+func (d *DynamicMessage) set(f *Field, v any) {
+	if !f.Repeated {
+		d.Fields[f.Number] = v
+		return
+	}
+	items, _ := d.Fields[f.Number].([]any)
+	d.Fields[f.Number] = append(items, v)
+}
+
+// String renders the message in the protobuf-text-like format of the generated Raw types,
+// with sensitive fields redacted
+func (d *DynamicMessage) String() string {
+	var b strings.Builder
+	for i := range d.Schema.Fields {
+		f := &d.Schema.Fields[i]
+		v, ok := d.Fields[f.Number]
+		if !ok {
+			continue
+		}
+		items := []any{v}
+		if f.Repeated {
+			items, _ = v.([]any)
+		}
+		if f.Sensitive {
+			if len(items) > 0 && !isZeroValue(items[0]) {
+				fmt.Fprintf(&b, "%s: \"[REDACTED]\" ", f.Name)
+			}
+			continue
+		}
+		for _, item := range items {
+			if !f.Repeated && isZeroValue(item) {
+				continue
+			}
+			switch item := item.(type) {
+			case *DynamicMessage:
+				fmt.Fprintf(&b, "%s { %s } ", f.Name, item)
+			case proto.Message:
+				fmt.Fprintf(&b, "%s: %s ", f.Name, serializer.WellKnownText(item))
+			case string, []byte:
+				fmt.Fprintf(&b, "%s: %q ", f.Name, item)
+			default:
+				fmt.Fprintf(&b, "%s: %v ", f.Name, item)
+			}
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// MarshalJSON renders the message as a JSON object keyed by field name, with sensitive
+// fields redacted. Bytes are base64-encoded and well-known types use their protobuf JSON form.
+// Zero values are omitted, as in String.
+func (d *DynamicMessage) MarshalJSON() ([]byte, error) {
+	obj := make(map[string]any, len(d.Fields))
+	for i := range d.Schema.Fields {
+		f := &d.Schema.Fields[i]
+		v, ok := d.Fields[f.Number]
+		if !ok {
+			continue
+		}
+		items := []any{v}
+		if f.Repeated {
+			items, _ = v.([]any)
+		}
+		if len(items) == 0 || (!f.Repeated && isZeroValue(v)) {
+			continue
+		}
+		if f.Sensitive {
+			obj[f.Name] = "[REDACTED]"
+			continue
+		}
+		if !f.Repeated {
+			obj[f.Name] = jsonValue(v)
+			continue
+		}
+		values := make([]any, len(items))
+		for j, item := range items {
+			values[j] = jsonValue(item)
+		}
+		obj[f.Name] = values
+	}
+	return json.Marshal(obj)
+}
+
+// jsonValue returns a value encoding/json renders like protojson
+func jsonValue(v any) any {
+	if m, ok := v.(proto.Message); ok {
+		b, err := protojson.Marshal(m)
+		if err != nil {
+			return nil
+		}
+		return json.RawMessage(b)
+	}
+	return v
+}
+
+func isZeroValue(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return !v
+	case int32:
+		return v == 0
+	case int64:
+		return v == 0
+	case uint32:
+		return v == 0
+	case uint64:
+		return v == 0
+	case float32:
+		return v == 0
+	case float64:
+		return v == 0
+	case string:
+		return v == ""
+	case []byte:
+		return len(v) == 0
+	default:
+		return v == nil
+	}
+}
+
+// Decode decodes a payload of the named message. Both Symphony payloads and protobuf payloads
+// tagged by serializer.SymphonyFallbackSerializer are accepted.
+func (r *Registry) Decode(data []byte, messageName string) (*DynamicMessage, error) {
+	m, ok := r.Message(messageName)
+	if !ok {
+		return nil, fmt.Errorf("unknown message %s", messageName)
+	}
+	if len(data) > 0 && data[0] == serializer.CodecTagProtobuf {
+		if len(data) < 13 {
+			return nil, fmt.Errorf("invalid data: too short for protobuf tagged payload")
+		}
+		return r.decodeProtobuf(data[13:], m)
+	}
+	return r.decodeSymphony(data, m)
+}
+
+// DecodeRequest decodes a request payload, using the service and method IDs in its header
+// to find the request message
+func (r *Registry) DecodeRequest(payload []byte) (*DynamicMessage, error) {
+	if len(payload) < 13 {
+		return nil, fmt.Errorf("invalid data: too short for header")
+	}
+	serviceID := binary.LittleEndian.Uint32(payload[5:9])
+	methodID := binary.LittleEndian.Uint32(payload[9:13])
+	method, ok := r.Method(serviceID, methodID)
+	if !ok {
+		return nil, fmt.Errorf("unknown method %d of service %d", methodID, serviceID)
+	}
+	return r.Decode(payload, method.Request)
+}
+
+// DecodeResponse decodes a response payload of the given method. Responses do not carry
+// service and method IDs, so they must come from the request.
+func (r *Registry) DecodeResponse(serviceID, methodID uint32, payload []byte) (*DynamicMessage, error) {
+	method, ok := r.Method(serviceID, methodID)
+	if !ok {
+		return nil, fmt.Errorf("unknown method %d of service %d", methodID, serviceID)
+	}
+	return r.Decode(payload, method.Response)
+}
+
+// DecodeAny decodes the value of an Any packed with serializer.NewAny (Symphony) or
+// anypb.New (protobuf)
+func (r *Registry) DecodeAny(a *anypb.Any) (*DynamicMessage, error) {
+	name := string(a.MessageName())
+	m, ok := r.Message(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown message %s", name)
+	}
+	value := a.GetValue()
+	if len(value) > 0 && value[0] == serializer.CodecTagSymphony {
+		return r.decodeSymphony(value, m)
+	}
+	return r.decodeProtobuf(value, m)
+}
+
+// ==========================================
+// Symphony
+// ==========================================
+
+func (r *Registry) decodeSymphony(data []byte, m *Message) (*DynamicMessage, error) {
+	if len(data) < 13 || data[0] != serializer.CodecTagSymphony {
+		return nil, fmt.Errorf("invalid data: too short or wrong public version")
+	}
+	d := &DynamicMessage{Schema: m, Fields: make(map[int32]any)}
+	public, private := m.segments()
+
+	if err := r.decodeSegment(data, 13, 0, public, d); err != nil {
+		return nil, err
+	}
+
+	offsetToPrivate := int(binary.LittleEndian.Uint32(data[1:5]))
+	if offsetToPrivate < len(data) && data[offsetToPrivate] == 0x01 {
+		// Private offsets are relative to the start of the private segment
+		if err := r.decodeSegment(data, offsetToPrivate+1, offsetToPrivate, private, d); err != nil {
+			return nil, err
+		}
+	} else if len(private) > 0 {
+		d.PublicOnly = true
+	}
+	return d, nil
+}
+
+// decodeSegment decodes the fields of one segment, whose table starts at tableStart.
+// Payload offsets in the table are relative to base.
+func (r *Registry) decodeSegment(data []byte, tableStart, base int, fields []*Field, d *DynamicMessage) error {
+	pos := tableStart
+	var dict []string
+	if hasInterned(fields) {
+		// The table starts with the offset of the string dictionary
+		var err error
+		if dict, err = decodeStringDict(data, tableStart, base); err != nil {
+			return err
+		}
+		pos += 4
+	}
+	for _, f := range fields {
+		if size := f.Kind.Size(); size > 0 && !f.Repeated {
+			b, err := slice(data, pos, size)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			d.set(f, decodeFixed(f.Kind, b))
+			pos += size
+			continue
+		}
+
+		offset, err := readUint32(data, pos)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		pos += 4
+		if offset == 0 {
+			continue // unset nested message or empty interned string
+		}
+		switch {
+		case f.Interned && !f.Repeated:
+			// The slot holds the reference itself
+			var v string
+			if v, err = serializer.DictString(dict, offset); err == nil {
+				d.set(f, v)
+			}
+		case f.Interned:
+			err = decodeInterned(data, base+int(offset), f, dict, d)
+		default:
+			err = r.decodePayload(data, base+int(offset), f, d)
+		}
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func hasInterned(fields []*Field) bool {
+	for _, f := range fields {
+		if f.Interned {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeStringDict decodes the string dictionary whose offset is stored at tableStart,
+// nil if the segment has none
+func decodeStringDict(data []byte, tableStart, base int) ([]string, error) {
+	offset, err := readUint32(data, tableStart)
+	if err != nil {
+		return nil, fmt.Errorf("string dictionary: %w", err)
+	}
+	if offset == 0 {
+		return nil, nil
+	}
+	if base+int(offset) > len(data) {
+		return nil, fmt.Errorf("string dictionary: offset %d out of range", base+int(offset))
+	}
+	return serializer.DecodeStringDict(data[base+int(offset):])
+}
+
+// decodeInterned decodes the payload of a repeated interned field at offset:
+// [count][references]
+func decodeInterned(data []byte, offset int, f *Field, dict []string, d *DynamicMessage) error {
+	n, err := readUint32(data, offset)
+	if err != nil {
+		return err
+	}
+	d.Fields[f.Number] = make([]any, 0, n)
+	for i := 0; i < int(n); i++ {
+		ref, err := readUint32(data, offset+4+4*i)
+		if err != nil {
+			return err
+		}
+		v, err := serializer.DictString(dict, ref)
+		if err != nil {
+			return err
+		}
+		d.set(f, v)
+	}
+	return nil
+}
+
+// decodePayload decodes the payload of a variable-length, repeated or nested field at offset
+func (r *Registry) decodePayload(data []byte, offset int, f *Field, d *DynamicMessage) error {
+	n, err := readUint32(data, offset)
+	if err != nil {
+		return err
+	}
+	offset += 4
+
+	if !f.Repeated {
+		// [len][bytes]
+		b, err := slice(data, offset, int(n))
+		if err != nil {
+			return err
+		}
+		v, err := r.decodeVariable(f, b)
+		if err != nil {
+			return err
+		}
+		d.set(f, v)
+		return nil
+	}
+
+	if f.Delta {
+		// [count][dataLen][varint deltas]
+		dataLen, err := readUint32(data, offset)
+		if err != nil {
+			return err
+		}
+		b, err := slice(data, offset+4, int(dataLen))
+		if err != nil {
+			return err
+		}
+		values, err := serializer.DecodeDeltaEncoded[uint64](b, int(n))
+		if err != nil {
+			return err
+		}
+		d.Fields[f.Number] = make([]any, 0, n)
+		for _, v := range values {
+			d.set(f, deltaValue(f.Kind, v))
+		}
+		return nil
+	}
+
+	// [count][items]
+	d.Fields[f.Number] = make([]any, 0, n)
+	for i := 0; i < int(n); i++ {
+		if size := f.Kind.Size(); size > 0 {
+			b, err := slice(data, offset, size)
+			if err != nil {
+				return err
+			}
+			d.set(f, decodeFixed(f.Kind, b))
+			offset += size
+			continue
+		}
+
+		itemLen, err := readUint32(data, offset)
+		if err != nil {
+			return err
+		}
+		b, err := slice(data, offset+4, int(itemLen))
+		if err != nil {
+			return err
+		}
+		v, err := r.decodeVariable(f, b)
+		if err != nil {
+			return err
+		}
+		d.set(f, v)
+		offset += 4 + int(itemLen)
+	}
+	return nil
+}
+
+// decodeVariable decodes one string, bytes or nested message value
+func (r *Registry) decodeVariable(f *Field, b []byte) (any, error) {
+	switch f.Kind {
+	case KindString:
+		return string(b), nil
+	case KindBytes:
+		return append([]byte(nil), b...), nil
+	case KindMessage:
+		if isWellKnown(f.Message) {
+			msg, err := newWellKnown(f.Message)
+			if err != nil {
+				return nil, err
+			}
+			if err := serializer.UnmarshalWellKnown(b, msg); err != nil {
+				return nil, err
+			}
+			return msg, nil
+		}
+		m, ok := r.Message(f.Message)
+		if !ok {
+			return nil, fmt.Errorf("unknown message %s", f.Message)
+		}
+		return r.decodeSymphony(b, m)
+	default:
+		return nil, fmt.Errorf("unexpected kind %s", f.Kind)
+	}
+}
+
+func decodeFixed(kind Kind, b []byte) any {
+	switch kind {
+	case KindBool:
+		return b[0] != 0
+	case KindInt32, KindEnum:
+		return int32(binary.LittleEndian.Uint32(b))
+	case KindUint32:
+		return binary.LittleEndian.Uint32(b)
+	case KindFloat:
+		return math.Float32frombits(binary.LittleEndian.Uint32(b))
+	case KindInt64:
+		return int64(binary.LittleEndian.Uint64(b))
+	case KindUint64:
+		return binary.LittleEndian.Uint64(b)
+	case KindDouble:
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	default:
+		return nil
+	}
+}
+
+// deltaValue converts a value decoded from delta-encoded data (modulo 2^64) to its kind
+func deltaValue(kind Kind, v uint64) any {
+	switch kind {
+	case KindInt32:
+		return int32(v)
+	case KindUint32:
+		return uint32(v)
+	case KindInt64:
+		return int64(v)
+	default:
+		return v
+	}
+}
+
+func readUint32(data []byte, offset int) (uint32, error) {
+	b, err := slice(data, offset, 4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func slice(data []byte, offset, n int) ([]byte, error) {
+	if offset < 0 || n < 0 || offset+n > len(data) {
+		return nil, fmt.Errorf("invalid data: %d bytes at offset %d exceed buffer of %d bytes", n, offset, len(data))
+	}
+	return data[offset : offset+n], nil
+}
+
+// newWellKnown creates an empty well-known type message from the protobuf registry
+func newWellKnown(name string) (proto.Message, error) {
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("unknown well-known type %s: %w", name, err)
+	}
+	return mt.New().Interface(), nil
+}
+
+// ==========================================
+// Protobuf
+// ==========================================
+
+func (r *Registry) decodeProtobuf(b []byte, m *Message) (*DynamicMessage, error) {
+	d := &DynamicMessage{Schema: m, Fields: make(map[int32]any)}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f := m.Field(int32(num))
+		if f == nil {
+			// Unknown field, e.g. added by a newer schema
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+
+		switch {
+		case typ == protowire.BytesType && f.Kind.Size() > 0:
+			// Packed repeated scalars
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+			for len(v) > 0 {
+				item, n := consumeScalar(f.Kind, v)
+				if n < 0 {
+					return nil, fmt.Errorf("field %s: %w", f.Name, protowire.ParseError(n))
+				}
+				d.set(f, item)
+				v = v[n:]
+			}
+		case typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+			item, err := r.decodeProtobufVariable(f, v)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			d.set(f, item)
+		default:
+			item, n := consumeScalar(f.Kind, b)
+			if n < 0 {
+				return nil, fmt.Errorf("field %s: %w", f.Name, protowire.ParseError(n))
+			}
+			b = b[n:]
+			d.set(f, item)
+		}
+	}
+	return d, nil
+}
+
+func (r *Registry) decodeProtobufVariable(f *Field, b []byte) (any, error) {
+	switch f.Kind {
+	case KindString:
+		return string(b), nil
+	case KindBytes:
+		return append([]byte(nil), b...), nil
+	case KindMessage:
+		if isWellKnown(f.Message) {
+			msg, err := newWellKnown(f.Message)
+			if err != nil {
+				return nil, err
+			}
+			if err := proto.Unmarshal(b, msg); err != nil {
+				return nil, err
+			}
+			return msg, nil
+		}
+		m, ok := r.Message(f.Message)
+		if !ok {
+			return nil, fmt.Errorf("unknown message %s", f.Message)
+		}
+		return r.decodeProtobuf(b, m)
+	default:
+		return nil, fmt.Errorf("unexpected kind %s", f.Kind)
+	}
+}
+
+// consumeScalar decodes one protobuf scalar of the given kind, returning the number of bytes read
+// (negative on error)
+func consumeScalar(kind Kind, b []byte) (any, int) {
+	switch kind {
+	case KindFloat:
+		v, n := protowire.ConsumeFixed32(b)
+		return math.Float32frombits(v), n
+	case KindDouble:
+		v, n := protowire.ConsumeFixed64(b)
+		return math.Float64frombits(v), n
+	}
+
+	v, n := protowire.ConsumeVarint(b)
+	switch kind {
+	case KindBool:
+		return v != 0, n
+	case KindInt32, KindEnum:
+		return int32(v), n
+	case KindInt64:
+		return int64(v), n
+	case KindUint32:
+		return uint32(v), n
+	case KindUint64:
+		return v, n
+	default:
+		return nil, -1
+	}
+}
@@ -0,0 +1,330 @@
+package schema
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/appnet-org/arpc/pkg/serializer"
+	"google.golang.org/protobuf/proto"
+)
+
+// Encode encodes a message in the Symphony format, producing the same bytes as the
+// MarshalSymphony method of its generated type. Values must have the types Decode produces
+// (see DynamicMessage); missing fields are encoded as zero values. A PublicOnly message is
+// encoded as its public segment. The reserved service and method IDs are left 0, and no
+// private segment checksum is appended.
+func (r *Registry) Encode(d *DynamicMessage) ([]byte, error) {
+	if d == nil || d.Schema == nil {
+		return nil, fmt.Errorf("message without schema")
+	}
+	return r.encodeSymphony(nil, d)
+}
+
+// encodeSymphony appends the encoding of d to buf
+func (r *Registry) encodeSymphony(buf []byte, d *DynamicMessage) ([]byte, error) {
+	start := len(buf)
+	public, private := d.Schema.segments()
+
+	buf = append(buf, serializer.CodecTagSymphony)
+	buf = append(buf, make([]byte, 12)...) // offset_to_private, service and method IDs
+	buf, err := r.encodeSegment(buf, start, public, d)
+	if err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint32(buf[start+1:], uint32(len(buf)-start))
+	if d.PublicOnly {
+		return buf, nil
+	}
+
+	// Private offsets are relative to the start of the private segment
+	privateStart := len(buf)
+	buf = append(buf, 0x01)
+	return r.encodeSegment(buf, privateStart, private, d)
+}
+
+// encodeSegment appends the table and payloads of one segment to buf. Payload offsets in the
+// table are relative to base.
+func (r *Registry) encodeSegment(buf []byte, base int, fields []*Field, d *DynamicMessage) ([]byte, error) {
+	tableStart := len(buf)
+	tableSize := 0
+	var dict serializer.StringDict
+	if hasInterned(fields) {
+		tableSize = 4 // the table starts with the offset of the string dictionary
+	}
+	for _, f := range fields {
+		if size := f.Kind.Size(); size > 0 && !f.Repeated {
+			tableSize += size
+		} else {
+			tableSize += 4
+		}
+		if !f.Interned {
+			continue
+		}
+		items, err := fieldItems(f, d)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("field %s: %w", f.Name, typeError(f.Kind, item))
+			}
+			dict.Add(s)
+		}
+	}
+	buf = append(buf, make([]byte, tableSize)...)
+
+	pos := tableStart
+	if hasInterned(fields) {
+		pos += 4
+	}
+	var err error
+	for _, f := range fields {
+		v, ok := d.Fields[f.Number]
+		if size := f.Kind.Size(); size > 0 && !f.Repeated {
+			if ok {
+				if err := putFixed(buf[pos:pos+size], f.Kind, v); err != nil {
+					return nil, fmt.Errorf("field %s: %w", f.Name, err)
+				}
+			}
+			pos += size
+			continue
+		}
+
+		slot := pos
+		pos += 4
+		switch {
+		case f.Interned && !f.Repeated:
+			// The slot holds the reference itself (checked to be a string above)
+			s, _ := v.(string)
+			binary.LittleEndian.PutUint32(buf[slot:], dict.Ref(s))
+			continue
+		case f.Kind == KindMessage && !f.Repeated && (!ok || v == nil):
+			continue // unset nested message
+		}
+
+		binary.LittleEndian.PutUint32(buf[slot:], uint32(len(buf)-base))
+		var items []any
+		if items, err = fieldItems(f, d); err != nil {
+			return nil, err
+		}
+		if buf, err = r.encodePayload(buf, f, items, &dict); err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+	}
+
+	if dict.Len() > 0 {
+		binary.LittleEndian.PutUint32(buf[tableStart:], uint32(len(buf)-base))
+		n := len(buf)
+		buf = append(buf, make([]byte, dict.EncodedSize())...)
+		dict.Put(buf[n:])
+	}
+	return buf, nil
+}
+
+// fieldItems returns the values of a field: its value for singular fields, its elements for
+// repeated ones
+func fieldItems(f *Field, d *DynamicMessage) ([]any, error) {
+	v, ok := d.Fields[f.Number]
+	if !f.Repeated {
+		if !ok {
+			return []any{zeroValue(f.Kind)}, nil
+		}
+		return []any{v}, nil
+	}
+	if !ok || v == nil {
+		return nil, nil
+	}
+	items, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("field %s: expected []any, got %T", f.Name, v)
+	}
+	return items, nil
+}
+
+// encodePayload appends the payload of a variable-length, repeated or nested field
+func (r *Registry) encodePayload(buf []byte, f *Field, items []any, dict *serializer.StringDict) ([]byte, error) {
+	if !f.Repeated {
+		// [len][bytes]
+		return r.appendVariable(buf, f, items[0])
+	}
+
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(items)))
+	switch {
+	case f.Delta:
+		// [count][dataLen][varint deltas]
+		values := make([]uint64, len(items))
+		for i, item := range items {
+			v, err := deltaBits(f.Kind, item)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		n := serializer.DeltaEncodedSize(values)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(n))
+		start := len(buf)
+		buf = append(buf, make([]byte, n)...)
+		serializer.PutDeltaEncoded(buf[start:], values)
+		return buf, nil
+
+	case f.Interned:
+		// [count][references]
+		for _, item := range items {
+			s, _ := item.(string)
+			buf = binary.LittleEndian.AppendUint32(buf, dict.Ref(s))
+		}
+		return buf, nil
+
+	case f.Kind.Size() > 0:
+		// [count][items]
+		size := f.Kind.Size()
+		for _, item := range items {
+			start := len(buf)
+			buf = append(buf, make([]byte, size)...)
+			if err := putFixed(buf[start:], f.Kind, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+
+	// [count][len][bytes]...
+	var err error
+	for _, item := range items {
+		if buf, err = r.appendVariable(buf, f, item); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// appendVariable appends one string, bytes or nested message value as [len][bytes]
+func (r *Registry) appendVariable(buf []byte, f *Field, v any) ([]byte, error) {
+	lenPos := len(buf)
+	buf = append(buf, 0, 0, 0, 0)
+	switch f.Kind {
+	case KindString:
+		s, ok := v.(string)
+		if !ok {
+			return nil, typeError(f.Kind, v)
+		}
+		buf = append(buf, s...)
+	case KindBytes:
+		b, ok := v.([]byte)
+		if !ok && v != nil {
+			return nil, typeError(f.Kind, v)
+		}
+		buf = append(buf, b...)
+	case KindMessage:
+		if isWellKnown(f.Message) {
+			msg, ok := v.(proto.Message)
+			if !ok {
+				return nil, typeError(f.Kind, v)
+			}
+			data, err := serializer.MarshalWellKnown(msg)
+			if err != nil {
+				return nil, err
+			}
+			buf = append(buf, data...)
+			break
+		}
+		nested, ok := v.(*DynamicMessage)
+		if !ok {
+			return nil, typeError(f.Kind, v)
+		}
+		var err error
+		if buf, err = r.encodeSymphony(buf, nested); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unexpected kind %s", f.Kind)
+	}
+	binary.LittleEndian.PutUint32(buf[lenPos:], uint32(len(buf)-lenPos-4))
+	return buf, nil
+}
+
+// putFixed writes a value of a fixed-length kind to b, which holds its size
+func putFixed(b []byte, kind Kind, v any) error {
+	switch v := v.(type) {
+	case bool:
+		if kind == KindBool {
+			if v {
+				b[0] = 1
+			}
+			return nil
+		}
+	case int32:
+		if kind == KindInt32 || kind == KindEnum {
+			binary.LittleEndian.PutUint32(b, uint32(v))
+			return nil
+		}
+	case uint32:
+		if kind == KindUint32 {
+			binary.LittleEndian.PutUint32(b, v)
+			return nil
+		}
+	case float32:
+		if kind == KindFloat {
+			binary.LittleEndian.PutUint32(b, math.Float32bits(v))
+			return nil
+		}
+	case int64:
+		if kind == KindInt64 {
+			binary.LittleEndian.PutUint64(b, uint64(v))
+			return nil
+		}
+	case uint64:
+		if kind == KindUint64 {
+			binary.LittleEndian.PutUint64(b, v)
+			return nil
+		}
+	case float64:
+		if kind == KindDouble {
+			binary.LittleEndian.PutUint64(b, math.Float64bits(v))
+			return nil
+		}
+	}
+	return typeError(kind, v)
+}
+
+// deltaBits returns a delta-encoded value as delta encoding sees it: signed values
+// sign-extended to 64 bits
+func deltaBits(kind Kind, v any) (uint64, error) {
+	switch v := v.(type) {
+	case int32:
+		if kind == KindInt32 {
+			return uint64(int64(v)), nil
+		}
+	case uint32:
+		if kind == KindUint32 {
+			return uint64(v), nil
+		}
+	case int64:
+		if kind == KindInt64 {
+			return uint64(v), nil
+		}
+	case uint64:
+		if kind == KindUint64 {
+			return v, nil
+		}
+	}
+	return 0, typeError(kind, v)
+}
+
+// zeroValue returns the value of an unset singular field of a variable-length kind
+func zeroValue(kind Kind) any {
+	switch kind {
+	case KindString:
+		return ""
+	case KindBytes:
+		return []byte(nil)
+	default:
+		return nil
+	}
+}
+
+func typeError(kind Kind, v any) error {
+	return fmt.Errorf("expected %s value, got %T", kind, v)
+}
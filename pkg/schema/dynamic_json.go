@@ -0,0 +1,129 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// DecodeJSON parses a message of the named type from the JSON form MarshalJSON renders: an
+// object keyed by field name, with bytes base64-encoded and well-known types in their
+// protobuf JSON form. 64-bit integers may also be quoted, as protojson renders them. Unknown
+// fields are an error, and redacted sensitive fields cannot be parsed back.
+func (r *Registry) DecodeJSON(data []byte, messageName string) (*DynamicMessage, error) {
+	m, ok := r.Message(messageName)
+	if !ok {
+		return nil, fmt.Errorf("unknown message %s", messageName)
+	}
+	return r.decodeJSONMessage(data, m)
+}
+
+func (r *Registry) decodeJSONMessage(data []byte, m *Message) (*DynamicMessage, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("%s: %w", m.FullName, err)
+	}
+	d := &DynamicMessage{Schema: m, Fields: make(map[int32]any)}
+	for name, raw := range obj {
+		f := m.FieldByName(name)
+		if f == nil {
+			return nil, fmt.Errorf("%s has no field %s", m.FullName, name)
+		}
+		if isJSONNull(raw) {
+			continue
+		}
+		if !f.Repeated {
+			v, err := r.decodeJSONValue(f, raw)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			d.Fields[f.Number] = v
+			continue
+		}
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		values := make([]any, len(items))
+		for i, item := range items {
+			v, err := r.decodeJSONValue(f, item)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			values[i] = v
+		}
+		d.Fields[f.Number] = values
+	}
+	return d, nil
+}
+
+// decodeJSONValue decodes one value of a field, with the type Decode produces
+func (r *Registry) decodeJSONValue(f *Field, raw json.RawMessage) (any, error) {
+	switch f.Kind {
+	case KindBool:
+		var v bool
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case KindInt32, KindEnum:
+		v, err := strconv.ParseInt(jsonNumber(raw), 10, 32)
+		return int32(v), err
+	case KindInt64:
+		return strconv.ParseInt(jsonNumber(raw), 10, 64)
+	case KindUint32:
+		v, err := strconv.ParseUint(jsonNumber(raw), 10, 32)
+		return uint32(v), err
+	case KindUint64:
+		return strconv.ParseUint(jsonNumber(raw), 10, 64)
+	case KindFloat:
+		v, err := strconv.ParseFloat(jsonNumber(raw), 32)
+		if err != nil || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("invalid float %s", raw)
+		}
+		return float32(v), nil
+	case KindDouble:
+		return strconv.ParseFloat(jsonNumber(raw), 64)
+	case KindString:
+		var v string
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case KindBytes:
+		var v []byte
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case KindMessage:
+		if isWellKnown(f.Message) {
+			msg, err := newWellKnown(f.Message)
+			if err != nil {
+				return nil, err
+			}
+			if err := protojson.Unmarshal(raw, msg); err != nil {
+				return nil, err
+			}
+			return msg, nil
+		}
+		m, ok := r.Message(f.Message)
+		if !ok {
+			return nil, fmt.Errorf("unknown message %s", f.Message)
+		}
+		return r.decodeJSONMessage(raw, m)
+	default:
+		return nil, fmt.Errorf("unexpected kind %s", f.Kind)
+	}
+}
+
+// jsonNumber returns the text of a JSON number, without the quotes of a quoted one
+func jsonNumber(raw json.RawMessage) string {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) >= 2 && raw[0] == '"' && raw[len(raw)-1] == '"' {
+		raw = raw[1 : len(raw)-1]
+	}
+	return string(raw)
+}
+
+func isJSONNull(raw json.RawMessage) bool {
+	return string(bytes.TrimSpace(raw)) == "null"
+}
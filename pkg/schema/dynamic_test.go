@@ -0,0 +1,497 @@
+package schema_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	Test "github.com/appnet-org/arpc/cmd/symphony-gen-arpc/test"
+	"github.com/appnet-org/arpc/pkg/schema"
+	"github.com/appnet-org/arpc/pkg/serializer"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func newTestRegistry(t *testing.T, msgs ...proto.Message) *schema.Registry {
+	t.Helper()
+	r := schema.NewRegistry()
+	for _, msg := range msgs {
+		if err := r.RegisterDescriptor(msg.ProtoReflect().Descriptor()); err != nil {
+			t.Fatalf("RegisterDescriptor failed: %v", err)
+		}
+	}
+	return r
+}
+
+func TestDecodeSymphony(t *testing.T) {
+	r := newTestRegistry(t, &Test.ComplexMixed{}, &Test.RepeatedFixed{})
+
+	msg := &Test.ComplexMixed{
+		FInt32:         123,
+		VString:        "Mixed",
+		RInt64:         []int64{1, 2},
+		NestedLeaf:     &Test.Leaf{LeafId: 4, LeafVal: "Nested"},
+		RString:        []string{"S1", "S2"},
+		FBool:          true,
+		RepeatedNested: []*Test.Root{{RootId: 1, L1: &Test.Level1{L1Data: "L1", L2: &Test.Level2{Leaf: &Test.Leaf{LeafId: 10, LeafVal: "Deep"}}}}},
+		VBytes:         []byte{0x00, 0x01},
+	}
+	data, err := msg.MarshalSymphony()
+	if err != nil {
+		t.Fatalf("MarshalSymphony failed: %v", err)
+	}
+
+	d, err := r.Decode(data, "Test.ComplexMixed")
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if v, _ := d.Get("f_int32"); v != int32(123) {
+		t.Errorf("f_int32: expected 123, got %v", v)
+	}
+	if v, _ := d.Get("r_string"); len(v.([]any)) != 2 || v.([]any)[1] != "S2" {
+		t.Errorf("r_string: unexpected %v", v)
+	}
+	nested, _ := d.Get("nested_leaf")
+	if v, _ := nested.(*schema.DynamicMessage).Get("leaf_val"); v != "Nested" {
+		t.Errorf("nested_leaf.leaf_val: expected Nested, got %v", v)
+	}
+
+	// The text format matches the one of the generated Raw type
+	if expected := Test.ComplexMixedRaw(data).String(); d.String() != expected {
+		t.Errorf("Text mismatch.\nExpected: %s\nGot:      %s", expected, d.String())
+	}
+
+	// Public-only buffers decode the public fields
+	offsetToPrivate := binary.LittleEndian.Uint32(data[1:5])
+	d, err = r.Decode(data[:offsetToPrivate], "Test.ComplexMixed")
+	if err != nil {
+		t.Fatalf("Decode of public segment failed: %v", err)
+	}
+	if !d.PublicOnly {
+		t.Error("Expected PublicOnly to be set")
+	}
+	if _, ok := d.Get("f_int32"); ok {
+		t.Error("Expected private field to be missing")
+	}
+	if expected := Test.ComplexMixedRaw(data[:offsetToPrivate]).String(); d.String() != expected {
+		t.Errorf("Text mismatch.\nExpected: %s\nGot:      %s", expected, d.String())
+	}
+
+	fixed := &Test.RepeatedFixed{RInt32: []int32{-1, 2}, RFloat: []float32{1.5}, RBool: []bool{true, false}}
+	data, _ = fixed.MarshalSymphony()
+	d, err = r.Decode(data, "Test.RepeatedFixed")
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if expected := Test.RepeatedFixedRaw(data).String(); d.String() != expected {
+		t.Errorf("Text mismatch.\nExpected: %s\nGot:      %s", expected, d.String())
+	}
+
+	if _, err := r.Decode(data[:20], "Test.RepeatedFixed"); err == nil {
+		t.Error("Expected error for truncated payload")
+	}
+}
+
+func TestDecodeProtobuf(t *testing.T) {
+	r := newTestRegistry(t, &Test.ComplexMixed{})
+
+	msg := &Test.ComplexMixed{
+		FInt32:     -5,
+		VString:    "proto",
+		RInt64:     []int64{7, 8},
+		NestedLeaf: &Test.Leaf{LeafVal: "leaf"},
+		FBool:      true,
+	}
+	data, err := serializer.MarshalProtobufTagged(msg)
+	if err != nil {
+		t.Fatalf("MarshalProtobufTagged failed: %v", err)
+	}
+	d, err := r.Decode(data, "Test.ComplexMixed")
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	symphony, _ := msg.MarshalSymphony()
+	if expected := Test.ComplexMixedRaw(symphony).String(); d.String() != expected {
+		t.Errorf("Text mismatch.\nExpected: %s\nGot:      %s", expected, d.String())
+	}
+}
+
+func TestDecodeRequestAndAny(t *testing.T) {
+	r := newTestRegistry(t, &Test.WellKnown{}, &Test.Credentials{})
+	r.RegisterMethod(&schema.MethodSchema{ServiceID: 3, MethodID: 1, Service: "Vault", Method: "Store", Request: "Test.WellKnown", Response: "Test.Credentials"})
+
+	creds := &Test.Credentials{User: "alice", CardNumber: "4111", Secret: []byte("pw")}
+	symphonyAny, err := serializer.NewAny(creds)
+	if err != nil {
+		t.Fatalf("NewAny failed: %v", err)
+	}
+	msg := &Test.WellKnown{
+		Created: timestamppb.New(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)),
+		Detail:  symphonyAny,
+	}
+	payload, _ := msg.MarshalSymphony()
+	binary.LittleEndian.PutUint32(payload[5:9], 3)
+	binary.LittleEndian.PutUint32(payload[9:13], 1)
+
+	d, err := r.DecodeRequest(payload)
+	if err != nil {
+		t.Fatalf("DecodeRequest failed: %v", err)
+	}
+	created, _ := d.Get("created")
+	if !proto.Equal(created.(proto.Message), msg.Created) {
+		t.Errorf("created: expected %v, got %v", msg.Created, created)
+	}
+
+	detail, _ := d.Get("detail")
+	protoAny, _ := anypb.New(creds)
+	for _, a := range []*anypb.Any{detail.(*anypb.Any), protoAny} {
+		inner, err := r.DecodeAny(a)
+		if err != nil {
+			t.Fatalf("DecodeAny failed: %v", err)
+		}
+		if expected := `user: "alice" card_number: "[REDACTED]" secret: "[REDACTED]"`; inner.String() != expected {
+			t.Errorf("Unexpected text.\nExpected: %s\nGot:      %s", expected, inner.String())
+		}
+	}
+
+	response, _ := creds.MarshalSymphony()
+	if _, err := r.DecodeResponse(3, 1, response); err != nil {
+		t.Errorf("DecodeResponse failed: %v", err)
+	}
+	if _, err := r.DecodeResponse(3, 2, response); err == nil {
+		t.Error("Expected error for unknown method")
+	}
+}
+
+func TestDynamicMessageJSON(t *testing.T) {
+	r := newTestRegistry(t, &Test.WellKnown{}, &Test.Credentials{}, &Test.RepeatedVar{})
+
+	tests := []struct {
+		name     string
+		msg      serializer.SymphonyMessage
+		expected string
+	}{
+		{"Credentials", &Test.Credentials{User: "alice", CardNumber: "4111"}, `{"card_number":"[REDACTED]","user":"alice"}`},
+		{"WellKnown", &Test.WellKnown{Created: timestamppb.New(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))}, `{"created":"2024-05-01T00:00:00Z"}`},
+		{"RepeatedVar", &Test.RepeatedVar{RString: []string{"a", "b"}, RBytes: [][]byte{{1}}}, `{"r_bytes":["AQ=="],"r_string":["a","b"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.msg.MarshalSymphony()
+			if err != nil {
+				t.Fatalf("MarshalSymphony failed: %v", err)
+			}
+			d, err := r.Decode(data, "Test."+tt.name)
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+			out, err := json.Marshal(d)
+			if err != nil {
+				t.Fatalf("MarshalJSON failed: %v", err)
+			}
+			if string(out) != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, out)
+			}
+		})
+	}
+}
+
+func TestDecodeSymphony_DeltaEncoded(t *testing.T) {
+	msg := &Test.Deltas{Timestamps: []int64{100, 90, 110}, ProductIds: []int32{-1, 5}, Offsets: []uint64{1 << 63}}
+	data, err := msg.MarshalSymphony()
+	if err != nil {
+		t.Fatalf("MarshalSymphony failed: %v", err)
+	}
+
+	// Through both the descriptor and the schema embedded in the generated code
+	for name, r := range map[string]*schema.Registry{"descriptor": newTestRegistry(t, &Test.Deltas{}), "embedded": schema.Global} {
+		d, err := r.Decode(data, "Test.Deltas")
+		if err != nil {
+			t.Fatalf("%s: Decode failed: %v", name, err)
+		}
+		if v, _ := d.Get("timestamps"); len(v.([]any)) != 3 || v.([]any)[1] != int64(90) {
+			t.Errorf("%s: timestamps: unexpected %v", name, v)
+		}
+		if v, _ := d.Get("product_ids"); len(v.([]any)) != 2 || v.([]any)[0] != int32(-1) {
+			t.Errorf("%s: product_ids: unexpected %v", name, v)
+		}
+		if v, _ := d.Get("offsets"); len(v.([]any)) != 1 || v.([]any)[0] != uint64(1<<63) {
+			t.Errorf("%s: offsets: unexpected %v", name, v)
+		}
+	}
+}
+
+func TestDecodeSymphony_Interned(t *testing.T) {
+	msg := &Test.Catalog{Region: "EU", Currencies: []string{"EUR", "USD", "EUR"}, Count: 3, Categories: []string{"", "toys"}, Owner: "toys", Note: "n"}
+	data, err := msg.MarshalSymphony()
+	if err != nil {
+		t.Fatalf("MarshalSymphony failed: %v", err)
+	}
+
+	// Through both the descriptor and the schema embedded in the generated code
+	for name, r := range map[string]*schema.Registry{"descriptor": newTestRegistry(t, &Test.Catalog{}), "embedded": schema.Global} {
+		d, err := r.Decode(data, "Test.Catalog")
+		if err != nil {
+			t.Fatalf("%s: Decode failed: %v", name, err)
+		}
+		if v, _ := d.Get("region"); v != "EU" {
+			t.Errorf("%s: region: unexpected %v", name, v)
+		}
+		if v, _ := d.Get("currencies"); !reflect.DeepEqual(v, []any{"EUR", "USD", "EUR"}) {
+			t.Errorf("%s: currencies: unexpected %v", name, v)
+		}
+		if v, _ := d.Get("count"); v != int32(3) {
+			t.Errorf("%s: count: unexpected %v", name, v)
+		}
+		if v, _ := d.Get("categories"); !reflect.DeepEqual(v, []any{"", "toys"}) {
+			t.Errorf("%s: categories: unexpected %v", name, v)
+		}
+		if v, _ := d.Get("owner"); v != "toys" {
+			t.Errorf("%s: owner: unexpected %v", name, v)
+		}
+		if v, _ := d.Get("note"); v != "n" {
+			t.Errorf("%s: note: unexpected %v", name, v)
+		}
+	}
+}
+
+func TestEncodeSymphony(t *testing.T) {
+	creds := &Test.Credentials{User: "alice", CardNumber: "4111", Secret: []byte("pw")}
+	symphonyAny, err := serializer.NewAny(creds)
+	if err != nil {
+		t.Fatalf("NewAny failed: %v", err)
+	}
+	tests := []struct {
+		name string
+		msg  serializer.SymphonyMessage
+	}{
+		{"ComplexMixed", &Test.ComplexMixed{
+			FInt32:         123,
+			VString:        "Mixed",
+			RInt64:         []int64{1, 2},
+			NestedLeaf:     &Test.Leaf{LeafId: 4, LeafVal: "Nested"},
+			RString:        []string{"S1", "S2"},
+			FBool:          true,
+			RepeatedNested: []*Test.Root{{RootId: 1, L1: &Test.Level1{L1Data: "L1", L2: &Test.Level2{Leaf: &Test.Leaf{LeafId: 10, LeafVal: "Deep"}}}}},
+			VBytes:         []byte{0x00, 0x01},
+		}},
+		{"ComplexMixed", &Test.ComplexMixed{}},
+		{"RepeatedVar", &Test.RepeatedVar{RString: []string{"a", ""}, RBytes: [][]byte{{1}, nil}}},
+		{"Deltas", &Test.Deltas{Timestamps: []int64{100, 90, 110}, ProductIds: []int32{-1, 5}, Offsets: []uint64{1 << 63}}},
+		{"Catalog", &Test.Catalog{Region: "EU", Currencies: []string{"EUR", "USD", "EUR"}, Count: 3, Categories: []string{"", "toys"}, Owner: "toys", Note: "n"}},
+		{"WellKnown", &Test.WellKnown{Created: timestamppb.New(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)), Detail: symphonyAny}},
+		{"Credentials", creds},
+		{"Empty", &Test.Empty{}},
+	}
+	r := schema.Global
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.msg.MarshalSymphony()
+			if err != nil {
+				t.Fatalf("MarshalSymphony failed: %v", err)
+			}
+			d, err := r.Decode(data, "Test."+tt.name)
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+			encoded, err := r.Encode(d)
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			if !bytes.Equal(encoded, data) {
+				t.Errorf("Encoding mismatch.\nExpected: %x\nGot:      %x", data, encoded)
+			}
+
+			// Public-only messages encode to the public segment
+			offsetToPrivate := binary.LittleEndian.Uint32(data[1:5])
+			if d, err = r.Decode(data[:offsetToPrivate], "Test."+tt.name); err != nil {
+				t.Fatalf("Decode of public segment failed: %v", err)
+			}
+			if !d.PublicOnly {
+				return // no private fields
+			}
+			if encoded, err = r.Encode(d); err != nil {
+				t.Fatalf("Encode of public segment failed: %v", err)
+			}
+			if !bytes.Equal(encoded, data[:offsetToPrivate]) {
+				t.Errorf("Public segment encoding mismatch.\nExpected: %x\nGot:      %x", data[:offsetToPrivate], encoded)
+			}
+		})
+	}
+}
+
+func TestEncodeSymphony_Modified(t *testing.T) {
+	r := schema.Global
+	msg := &Test.ComplexMixed{VString: "short", NestedLeaf: &Test.Leaf{LeafVal: "leaf"}, RString: []string{"x"}}
+	data, _ := msg.MarshalSymphony()
+	d, err := r.Decode(data, "Test.ComplexMixed")
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	nested, _ := d.Get("nested_leaf")
+	nested.(*schema.DynamicMessage).Fields[nested.(*schema.DynamicMessage).Schema.FieldByName("leaf_val").Number] = "a much longer leaf value"
+	d.Fields[d.Schema.FieldByName("v_string").Number] = "replaced"
+	delete(d.Fields, d.Schema.FieldByName("r_string").Number)
+	encoded, err := r.Encode(d)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	out := &Test.ComplexMixed{}
+	if err := out.UnmarshalSymphony(encoded); err != nil {
+		t.Fatalf("UnmarshalSymphony failed: %v", err)
+	}
+	if out.VString != "replaced" || out.NestedLeaf.GetLeafVal() != "a much longer leaf value" || len(out.RString) != 0 {
+		t.Errorf("Unexpected message %v", out)
+	}
+
+	d.Fields[d.Schema.FieldByName("f_int32").Number] = "not an int"
+	if _, err := r.Encode(d); err == nil {
+		t.Error("Expected error for a value of the wrong type")
+	}
+}
+
+func TestPrivateBoundaries(t *testing.T) {
+	msg := &Test.ComplexMixed{
+		FInt32:         7,
+		VString:        "public",
+		RInt64:         []int64{1, 2, 3},
+		RString:        []string{"a", "bc"},
+		RepeatedNested: []*Test.Root{{RootId: 1}},
+	}
+	data, err := msg.MarshalSymphony()
+	if err != nil {
+		t.Fatalf("MarshalSymphony failed: %v", err)
+	}
+	private := data[binary.LittleEndian.Uint32(data[1:5]):]
+	m, _ := schema.Global.Message("Test.ComplexMixed")
+
+	// The table, then the payloads of r_int64, r_string and repeated_nested
+	boundaries, err := m.PrivateBoundaries(private)
+	if err != nil {
+		t.Fatalf("PrivateBoundaries failed: %v", err)
+	}
+	if len(boundaries) != 4 || boundaries[0] != 0 {
+		t.Fatalf("PrivateBoundaries() = %v, want the table and 3 payloads", boundaries)
+	}
+	for i, name := range []string{"r_int64", "r_string", "repeated_nested"} {
+		offset, _, ok, err := m.PrivatePayload(private, name)
+		if err != nil || !ok || offset != boundaries[i+1] {
+			t.Errorf("PrivatePayload(%s) = %d, %v, %v, want %d", name, offset, ok, err, boundaries[i+1])
+		}
+	}
+	if offset, _, ok, err := m.PrivatePayload(private, "f_int32"); err != nil || !ok || offset != 1 {
+		t.Errorf("PrivatePayload(f_int32) = %d, %v, %v, want the first table slot", offset, ok, err)
+	}
+	if _, _, _, err := m.PrivatePayload(private, "v_string"); err == nil {
+		t.Error("Expected an error for a public field")
+	}
+	if _, err := m.PrivateBoundaries(data[13:]); err == nil {
+		t.Error("Expected an error for a segment without version byte")
+	}
+
+	// Interned fields need the string dictionary, which has a payload of its own
+	catalog := &Test.Catalog{Region: "EU", Categories: []string{"toys"}, Owner: "toys", Note: "n"}
+	if data, err = catalog.MarshalSymphony(); err != nil {
+		t.Fatalf("MarshalSymphony failed: %v", err)
+	}
+	private = data[binary.LittleEndian.Uint32(data[1:5]):]
+	m, _ = schema.Global.Message("Test.Catalog")
+	if boundaries, err = m.PrivateBoundaries(private); err != nil {
+		t.Fatalf("PrivateBoundaries failed: %v", err)
+	}
+	_, dict, ok, err := m.PrivatePayload(private, "owner")
+	if err != nil || !ok || dict == 0 || !slices.Contains(boundaries, dict) {
+		t.Errorf("PrivatePayload(owner) = dict %d, %v, %v, want a dictionary in %v", dict, ok, err, boundaries)
+	}
+}
+
+func TestPublicPayload(t *testing.T) {
+	msg := &Test.ComplexMixed{FInt32: 7, VString: "public", FBool: true, RString: []string{"a"}}
+	data, err := msg.MarshalSymphony()
+	if err != nil {
+		t.Fatalf("MarshalSymphony failed: %v", err)
+	}
+	public := data[:binary.LittleEndian.Uint32(data[1:5])]
+	m, _ := schema.Global.Message("Test.ComplexMixed")
+
+	// The table holds v_string, nested_leaf, f_bool and v_bytes, in declaration order
+	offset, _, ok, err := m.PublicPayload(public, "v_string")
+	if err != nil || !ok || binary.LittleEndian.Uint32(public[offset:]) != 6 || string(public[offset+4:offset+10]) != "public" {
+		t.Errorf("PublicPayload(v_string) = %d, %v, %v, want the payload of v_string", offset, ok, err)
+	}
+	if offset, _, ok, err = m.PublicPayload(public, "f_bool"); err != nil || !ok || offset != 21 || public[offset] != 1 {
+		t.Errorf("PublicPayload(f_bool) = %d, %v, %v, want the third table slot", offset, ok, err)
+	}
+	if _, _, ok, err = m.PublicPayload(public, "nested_leaf"); err != nil || ok {
+		t.Errorf("PublicPayload(nested_leaf) = %v, %v, want an absent field", ok, err)
+	}
+	if _, _, _, err = m.PublicPayload(public, "f_int32"); err == nil {
+		t.Error("Expected an error for a private field")
+	}
+	if _, _, _, err = m.PublicPayload(public[:20], "f_bool"); err == nil {
+		t.Error("Expected an error for a truncated table")
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	r := schema.Global
+	for name, msg := range map[string]serializer.SymphonyMessage{
+		"ComplexMixed": &Test.ComplexMixed{
+			FInt32:         -123,
+			VString:        "Mixed",
+			RInt64:         []int64{1, -2},
+			NestedLeaf:     &Test.Leaf{LeafId: 4, LeafVal: "Nested"},
+			RString:        []string{"S1", ""},
+			FBool:          true,
+			RepeatedNested: []*Test.Root{{RootId: 1, L1: &Test.Level1{L1Data: "L1"}}},
+			VBytes:         []byte{0x00, 0x01},
+		},
+		"WellKnown": &Test.WellKnown{Created: timestamppb.New(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))},
+	} {
+		t.Run(name, func(t *testing.T) {
+			data, err := msg.MarshalSymphony()
+			if err != nil {
+				t.Fatalf("MarshalSymphony failed: %v", err)
+			}
+			d, err := r.Decode(data, "Test."+name)
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+			out, err := json.Marshal(d)
+			if err != nil {
+				t.Fatalf("MarshalJSON failed: %v", err)
+			}
+			if d, err = r.DecodeJSON(out, "Test."+name); err != nil {
+				t.Fatalf("DecodeJSON(%s) failed: %v", out, err)
+			}
+			encoded, err := r.Encode(d)
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			if !bytes.Equal(encoded, data) {
+				t.Errorf("Encoding mismatch.\nExpected: %x\nGot:      %x", data, encoded)
+			}
+		})
+	}
+
+	// 64-bit integers may be quoted, as protojson renders them
+	d, err := r.DecodeJSON([]byte(`{"r_int64":["9007199254740993",1],"f_int32":null}`), "Test.ComplexMixed")
+	if err != nil {
+		t.Fatalf("DecodeJSON failed: %v", err)
+	}
+	if v, _ := d.Get("r_int64"); !reflect.DeepEqual(v, []any{int64(9007199254740993), int64(1)}) {
+		t.Errorf("Expected r_int64 [9007199254740993 1], got %v", v)
+	}
+	for _, data := range []string{`{"unknown":1}`, `{"f_int32":"x"}`, `{"f_int32":4294967296}`, `{"r_int64":1}`, `[]`} {
+		if _, err := r.DecodeJSON([]byte(data), "Test.ComplexMixed"); err == nil {
+			t.Errorf("Expected an error for %s", data)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package schema
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// encodingVersion is the first byte of an encoded schema blob
+const encodingVersion = 0x01
+
+// Field flags of the encoding
+const (
+	flagRepeated  = 1 << 0
+	flagPublic    = 1 << 1
+	flagSensitive = 1 << 2
+	flagDelta     = 1 << 3
+	flagInterned  = 1 << 4
+)
+
+// Encode serializes message schemas into the compact blob that protoc-gen-symphony embeds
+// in generated files:
+//
+//	[version(1B)][messageCount]
+//	message: [name][fieldCount] field...
+//	field:   [number][name][kind(1B)][flags(1B)] [messageName] (KindMessage only)
+//
+// Counts and numbers are varints, names are length-prefixed with a varint.
+func Encode(msgs []*Message) []byte {
+	return encodeMessages(msgs)
+}
+
+// EncodeWithMethods serializes message schemas as Encode does, followed by methods:
+//
+//	[methodCount] method: [serviceID][methodID][service][method][request][response]
+//
+// Decode stops after the messages, so these blobs can be read by decoders that predate
+// methods.
+func EncodeWithMethods(msgs []*Message, methods []*MethodSchema) []byte {
+	buf := encodeMessages(msgs)
+	buf = protowire.AppendVarint(buf, uint64(len(methods)))
+	for _, m := range methods {
+		buf = protowire.AppendVarint(buf, uint64(m.ServiceID))
+		buf = protowire.AppendVarint(buf, uint64(m.MethodID))
+		buf = protowire.AppendString(buf, m.Service)
+		buf = protowire.AppendString(buf, m.Method)
+		buf = protowire.AppendString(buf, m.Request)
+		buf = protowire.AppendString(buf, m.Response)
+	}
+	return buf
+}
+
+func encodeMessages(msgs []*Message) []byte {
+	buf := []byte{encodingVersion}
+	buf = protowire.AppendVarint(buf, uint64(len(msgs)))
+	for _, m := range msgs {
+		buf = protowire.AppendString(buf, m.FullName)
+		buf = protowire.AppendVarint(buf, uint64(len(m.Fields)))
+		for _, f := range m.Fields {
+			buf = protowire.AppendVarint(buf, uint64(f.Number))
+			buf = protowire.AppendString(buf, f.Name)
+			var flags byte
+			if f.Repeated {
+				flags |= flagRepeated
+			}
+			if f.Public {
+				flags |= flagPublic
+			}
+			if f.Sensitive {
+				flags |= flagSensitive
+			}
+			if f.Delta {
+				flags |= flagDelta
+			}
+			if f.Interned {
+				flags |= flagInterned
+			}
+			buf = append(buf, byte(f.Kind), flags)
+			if f.Kind == KindMessage {
+				buf = protowire.AppendString(buf, f.Message)
+			}
+		}
+	}
+	return buf
+}
+
+// Decode parses the messages of a blob produced by Encode or EncodeWithMethods
+func Decode(blob []byte) ([]*Message, error) {
+	if len(blob) == 0 || blob[0] != encodingVersion {
+		return nil, fmt.Errorf("invalid schema: unsupported version")
+	}
+	d := decoder{buf: blob[1:]}
+	return d.messages()
+}
+
+// DecodeWithMethods parses a blob produced by Encode or EncodeWithMethods. Blobs of Encode
+// have no methods.
+func DecodeWithMethods(blob []byte) ([]*Message, []*MethodSchema, error) {
+	if len(blob) == 0 || blob[0] != encodingVersion {
+		return nil, nil, fmt.Errorf("invalid schema: unsupported version")
+	}
+	d := decoder{buf: blob[1:]}
+	msgs, err := d.messages()
+	if err != nil || len(d.buf) == 0 {
+		return msgs, nil, err
+	}
+
+	count := d.varint()
+	var methods []*MethodSchema
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		methods = append(methods, &MethodSchema{
+			ServiceID: uint32(d.varint()),
+			MethodID:  uint32(d.varint()),
+			Service:   d.string(),
+			Method:    d.string(),
+			Request:   d.string(),
+			Response:  d.string(),
+		})
+	}
+	if d.err != nil {
+		return nil, nil, fmt.Errorf("invalid schema: %w", d.err)
+	}
+	return msgs, methods, nil
+}
+
+// messages reads the message schemas at the start of a blob, after its version
+func (d *decoder) messages() ([]*Message, error) {
+	count := d.varint()
+	var msgs []*Message
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		m := &Message{FullName: d.string()}
+		fieldCount := d.varint()
+		for j := uint64(0); j < fieldCount && d.err == nil; j++ {
+			f := Field{Number: int32(d.varint()), Name: d.string()}
+			f.Kind = Kind(d.byte())
+			flags := d.byte()
+			f.Repeated = flags&flagRepeated != 0
+			f.Public = flags&flagPublic != 0
+			f.Sensitive = flags&flagSensitive != 0
+			f.Delta = flags&flagDelta != 0
+			f.Interned = flags&flagInterned != 0
+			if f.Kind == KindMessage {
+				f.Message = d.string()
+			}
+			if f.Kind.String() == "unknown" {
+				d.fail(fmt.Errorf("field %s has unknown kind %d", f.Name, f.Kind))
+			}
+			m.Fields = append(m.Fields, f)
+		}
+		msgs = append(msgs, m)
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", d.err)
+	}
+	return msgs, nil
+}
+
+// RegisterEncoded registers the message schemas, and methods if any, of a blob produced by
+// Encode or EncodeWithMethods
+func (r *Registry) RegisterEncoded(blob []byte) error {
+	msgs, methods, err := DecodeWithMethods(blob)
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		r.RegisterMessage(m)
+	}
+	for _, m := range methods {
+		r.RegisterMethod(m)
+	}
+	return nil
+}
+
+// decoder reads a schema blob, remembering the first error
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+	d.buf = nil
+}
+
+func (d *decoder) varint() uint64 {
+	v, n := protowire.ConsumeVarint(d.buf)
+	if n < 0 {
+		d.fail(protowire.ParseError(n))
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	v, n := protowire.ConsumeString(d.buf)
+	if n < 0 {
+		d.fail(protowire.ParseError(n))
+		return ""
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) byte() byte {
+	if len(d.buf) == 0 {
+		d.fail(fmt.Errorf("unexpected end of data"))
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
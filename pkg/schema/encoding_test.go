@@ -0,0 +1,106 @@
+package schema_test
+
+import (
+	"reflect"
+	"testing"
+
+	Test "github.com/appnet-org/arpc/cmd/symphony-gen-arpc/test"
+	"github.com/appnet-org/arpc/pkg/schema"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEmbeddedSchema(t *testing.T) {
+	// Generated files register their schemas with schema.Global
+	for _, msg := range []proto.Message{&Test.ComplexMixed{}, &Test.Credentials{}, &Test.WellKnown{}, &Test.Empty{}} {
+		md := msg.ProtoReflect().Descriptor()
+		want, err := schema.FromDescriptor(md)
+		if err != nil {
+			t.Fatalf("FromDescriptor(%s) failed: %v", md.FullName(), err)
+		}
+		got, ok := schema.Global.Message(string(md.FullName()))
+		if !ok {
+			t.Fatalf("%s is not registered", md.FullName())
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Schema mismatch for %s.\nExpected: %+v\nGot:      %+v", md.FullName(), want, got)
+		}
+	}
+
+	// Messages without a Symphony encoding are not embedded
+	if _, ok := schema.Global.Message("Test.Labels"); ok {
+		t.Error("Expected Test.Labels not to be registered")
+	}
+
+	data, _ := (&Test.Root{RootId: 5, L1: &Test.Level1{L1Data: "x"}}).MarshalSymphony()
+	d, err := schema.Global.Decode(data, "Test.Root")
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if expected := Test.RootRaw(data).String(); d.String() != expected {
+		t.Errorf("Text mismatch.\nExpected: %s\nGot:      %s", expected, d.String())
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	msgs := []*schema.Message{{
+		FullName: "pkg.Msg",
+		Fields: []schema.Field{
+			{Number: 1, Name: "id", Kind: schema.KindUint64, Public: true},
+			{Number: 300, Name: "tags", Kind: schema.KindString, Repeated: true, Sensitive: true},
+			{Number: 2, Name: "child", Kind: schema.KindMessage, Message: "pkg.Child"},
+		},
+	}}
+	blob := schema.Encode(msgs)
+	got, err := schema.Decode(blob)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, msgs) {
+		t.Errorf("Mismatch.\nExpected: %+v\nGot:      %+v", msgs, got)
+	}
+
+	if _, err := schema.Decode(blob[:len(blob)-3]); err == nil {
+		t.Error("Expected error for truncated schema")
+	}
+}
+
+func TestExport(t *testing.T) {
+	r := schema.NewRegistry()
+	if err := r.RegisterDescriptor((&Test.ComplexMixed{}).ProtoReflect().Descriptor()); err != nil {
+		t.Fatalf("RegisterDescriptor failed: %v", err)
+	}
+	methods := []*schema.MethodSchema{
+		{ServiceID: 1, MethodID: 1, Service: "Mirror", Method: "Reflect", Request: "Test.ComplexMixed", Response: "Test.ComplexMixed"},
+		{ServiceID: 2, MethodID: 1, Service: "Other", Method: "Get", Request: "Test.Leaf", Response: "Test.Root"},
+	}
+	r.RegisterMethod(methods[1])
+	r.RegisterMethod(methods[0])
+
+	blob := r.Export()
+	msgs, got, err := schema.DecodeWithMethods(blob)
+	if err != nil {
+		t.Fatalf("DecodeWithMethods failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, methods) {
+		t.Errorf("Methods mismatch.\nExpected: %+v\nGot:      %+v", methods, got)
+	}
+	if len(msgs) != 5 || msgs[0].FullName != "Test.ComplexMixed" || msgs[4].FullName != "Test.Root" {
+		t.Errorf("Expected the 5 messages of Test.ComplexMixed sorted by name, got %d", len(msgs))
+	}
+
+	// Decode only reads the messages, as decoders predating methods do
+	if onlyMessages, err := schema.Decode(blob); err != nil || !reflect.DeepEqual(onlyMessages, msgs) {
+		t.Errorf("Decode() = %v, %v, want the messages of the blob", onlyMessages, err)
+	}
+
+	imported := schema.NewRegistry()
+	if err := imported.RegisterEncoded(blob); err != nil {
+		t.Fatalf("RegisterEncoded failed: %v", err)
+	}
+	if m, ok := imported.Method(2, 1); !ok || *m != *methods[1] {
+		t.Errorf("Method(2, 1) = %+v, %v, want %+v", m, ok, methods[1])
+	}
+	if _, _, err := schema.DecodeWithMethods(blob[:len(blob)-3]); err == nil {
+		t.Error("Expected error for truncated methods")
+	}
+}
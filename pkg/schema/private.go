@@ -0,0 +1,99 @@
+package schema
+
+import (
+	"fmt"
+	"slices"
+)
+
+// PrivateBoundaries returns where the payloads of the private fields of a message start in
+// its private segment (the bytes from offsetToPrivate, starting with the version byte),
+// sorted and relative to the start of the segment. The segment starts with its table, so 0
+// is always the first boundary; the string dictionary of interned fields starts a payload
+// of its own. Every payload ends where the next one starts, so the boundaries split the
+// segment into byte ranges that each hold the values of one field.
+func (m *Message) PrivateBoundaries(private []byte) ([]int, error) {
+	if len(private) == 0 || private[0] != 0x01 {
+		return nil, fmt.Errorf("invalid private segment: missing or incorrect version byte")
+	}
+	_, fields := m.segments()
+	boundaries := []int{0}
+	add := func(offset uint32) {
+		if offset > 0 && int(offset) < len(private) {
+			boundaries = append(boundaries, int(offset))
+		}
+	}
+
+	pos := 1
+	if hasInterned(fields) {
+		offset, err := readUint32(private, pos)
+		if err != nil {
+			return nil, fmt.Errorf("string dictionary: %w", err)
+		}
+		add(offset)
+		pos += 4
+	}
+	for _, f := range fields {
+		if size := f.Kind.Size(); size > 0 && !f.Repeated {
+			pos += size // held by the table
+			continue
+		}
+		offset, err := readUint32(private, pos)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		pos += 4
+		if !f.Interned || f.Repeated {
+			add(offset) // the slot of a single interned string holds a dictionary reference
+		}
+	}
+	if pos > len(private) {
+		return nil, fmt.Errorf("invalid private segment: table of %d bytes exceeds segment of %d", pos, len(private))
+	}
+
+	slices.Sort(boundaries)
+	return slices.Compact(boundaries), nil
+}
+
+// PrivatePayload returns where the payload of a private field starts in the private segment
+// of a message, read from the table of the segment, and whether the field has one. Payloads
+// of fixed-size fields are held by the table, and are reported at their position in it.
+// Interned fields also need the string dictionary, whose offset is reported as dict (0 if
+// the message has no interned private fields).
+func (m *Message) PrivatePayload(private []byte, name string) (offset, dict int, ok bool, err error) {
+	if len(private) == 0 || private[0] != 0x01 {
+		return 0, 0, false, fmt.Errorf("invalid private segment: missing or incorrect version byte")
+	}
+	_, fields := m.segments()
+	pos := 1
+	if hasInterned(fields) {
+		offset, err := readUint32(private, pos)
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("string dictionary: %w", err)
+		}
+		dict = int(offset)
+		pos += 4
+	}
+	for _, f := range fields {
+		size := f.Kind.Size()
+		fixed := size > 0 && !f.Repeated
+		if !fixed {
+			size = 4
+		}
+		if f.Name != name {
+			pos += size
+			continue
+		}
+		if fixed {
+			return pos, dict, true, nil
+		}
+		offset, err := readUint32(private, pos)
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		if f.Interned && !f.Repeated {
+			return pos, dict, offset != 0, nil // the slot holds the dictionary reference
+		}
+		return int(offset), dict, offset != 0, nil
+	}
+	return 0, 0, false, fmt.Errorf("%s has no private field %s", m.FullName, name)
+}
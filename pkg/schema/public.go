@@ -0,0 +1,50 @@
+package schema
+
+import "fmt"
+
+// PublicPayload returns where the payload of a public field starts in a message, read from
+// the table of its public segment, and whether the field has one. data may hold the public
+// segment only. Payloads of fixed-size fields are held by the table, and are reported at
+// their position in it. Interned fields also need the string dictionary, whose offset is
+// reported as dict (0 if the message has no interned public fields).
+func (m *Message) PublicPayload(data []byte, name string) (offset, dict int, ok bool, err error) {
+	if len(data) < 13 || data[0] != 0x01 {
+		return 0, 0, false, fmt.Errorf("invalid data: too short or wrong public version")
+	}
+	fields, _ := m.segments()
+	pos := 13
+	if hasInterned(fields) {
+		offset, err := readUint32(data, pos)
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("string dictionary: %w", err)
+		}
+		dict = int(offset)
+		pos += 4
+	}
+	for _, f := range fields {
+		size := f.Kind.Size()
+		fixed := size > 0 && !f.Repeated
+		if !fixed {
+			size = 4
+		}
+		if f.Name != name {
+			pos += size
+			continue
+		}
+		if fixed {
+			if _, err := slice(data, pos, size); err != nil {
+				return 0, 0, false, fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			return pos, dict, true, nil
+		}
+		offset, err := readUint32(data, pos)
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		if f.Interned && !f.Repeated {
+			return pos, dict, offset != 0, nil // the slot holds the dictionary reference
+		}
+		return int(offset), dict, offset != 0, nil
+	}
+	return 0, 0, false, fmt.Errorf("%s has no public field %s", m.FullName, name)
+}
@@ -0,0 +1,167 @@
+package schema
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// MethodSchema names the request and response messages of a method
+type MethodSchema struct {
+	ServiceID uint32
+	MethodID  uint32
+	Service   string
+	Method    string
+	Request   string // full name of the request message
+	Response  string // full name of the response message
+}
+
+// Registry maps message names to their schemas and (serviceID, methodID) pairs to the
+// messages of the method. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.RWMutex
+	messages map[string]*Message
+	methods  map[uint64]*MethodSchema
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		messages: make(map[string]*Message),
+		methods:  make(map[uint64]*MethodSchema),
+	}
+}
+
+// Global is the registry used by elements and tools unless they are given another one
+var Global = NewRegistry()
+
+func methodKey(serviceID, methodID uint32) uint64 {
+	return uint64(serviceID)<<32 | uint64(methodID)
+}
+
+// RegisterMessage registers the schema of a message, replacing any previous one with the same name
+func (r *Registry) RegisterMessage(m *Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages[m.FullName] = m
+}
+
+// RegisterMethod registers the messages of a method
+func (r *Registry) RegisterMethod(m *MethodSchema) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.methods[methodKey(m.ServiceID, m.MethodID)] = m
+}
+
+// RegisterDescriptor registers the schema of a protobuf message and of the messages it
+// references. Well-known types are not registered, they are decoded with their protobuf types.
+func (r *Registry) RegisterDescriptor(md protoreflect.MessageDescriptor) error {
+	return r.registerDescriptor(md, map[protoreflect.FullName]bool{})
+}
+
+func (r *Registry) registerDescriptor(md protoreflect.MessageDescriptor, seen map[protoreflect.FullName]bool) error {
+	if seen[md.FullName()] || isWellKnown(string(md.FullName())) {
+		return nil
+	}
+	seen[md.FullName()] = true
+
+	msg, err := FromDescriptor(md)
+	if err != nil {
+		return err
+	}
+	r.RegisterMessage(msg)
+
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if nested := fields.Get(i).Message(); nested != nil {
+			if err := r.registerDescriptor(nested, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RegisterServiceDescriptor registers the methods of a service with the IDs assigned by
+// protoc-gen-arpc (the <Service>_methodNameToID map of the generated code) and the schemas
+// of their messages
+func (r *Registry) RegisterServiceDescriptor(serviceID uint32, sd protoreflect.ServiceDescriptor, methodIDs map[string]uint32) error {
+	methods := sd.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+		methodID, ok := methodIDs[string(md.Name())]
+		if !ok {
+			return fmt.Errorf("no method ID for %s", md.FullName())
+		}
+		if err := r.registerMethodDescriptor(serviceID, methodID, md); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerMethodDescriptor registers a method and the schemas of its messages
+func (r *Registry) registerMethodDescriptor(serviceID, methodID uint32, md protoreflect.MethodDescriptor) error {
+	if err := r.RegisterDescriptor(md.Input()); err != nil {
+		return err
+	}
+	if err := r.RegisterDescriptor(md.Output()); err != nil {
+		return err
+	}
+	r.RegisterMethod(&MethodSchema{
+		ServiceID: serviceID,
+		MethodID:  methodID,
+		Service:   string(md.Parent().Name()),
+		Method:    string(md.Name()),
+		Request:   string(md.Input().FullName()),
+		Response:  string(md.Output().FullName()),
+	})
+	return nil
+}
+
+// Message looks up the schema of a message by full name
+func (r *Registry) Message(fullName string) (*Message, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.messages[fullName]
+	return m, ok
+}
+
+// Method looks up the messages of a method
+func (r *Registry) Method(serviceID, methodID uint32) (*MethodSchema, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.methods[methodKey(serviceID, methodID)]
+	return m, ok
+}
+
+// Export returns the blob of EncodeWithMethods holding every registered message and method,
+// sorted by name and IDs, so that components outside this process can decode the same
+// payloads (see cmd/libsymphony)
+func (r *Registry) Export() []byte {
+	r.mu.RLock()
+	msgs := make([]*Message, 0, len(r.messages))
+	for _, m := range r.messages {
+		msgs = append(msgs, m)
+	}
+	methods := make([]*MethodSchema, 0, len(r.methods))
+	for _, m := range r.methods {
+		methods = append(methods, m)
+	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(msgs, func(a, b *Message) int { return strings.Compare(a.FullName, b.FullName) })
+	slices.SortFunc(methods, func(a, b *MethodSchema) int {
+		return cmp.Compare(methodKey(a.ServiceID, a.MethodID), methodKey(b.ServiceID, b.MethodID))
+	})
+	return EncodeWithMethods(msgs, methods)
+}
+
+// isWellKnown reports whether name is a google.protobuf well-known type
+func isWellKnown(name string) bool {
+	return strings.HasPrefix(name, "google.protobuf.")
+}
@@ -0,0 +1,244 @@
+// Package schema describes the layout of Symphony messages at runtime, so that payloads can
+// be decoded without compiled message types (e.g. by proxy elements and command-line tools).
+package schema
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Field options understood by protoc-gen-symphony
+const (
+	isPublicOption    = 50001
+	isSensitiveOption = 50002
+	isDeltaOption     = 50003
+	isInternedOption  = 50004
+)
+
+// Kind is the type of a field as far as the Symphony encoding is concerned
+type Kind uint8
+
+const (
+	KindBool Kind = iota + 1
+	KindInt32
+	KindInt64
+	KindUint32
+	KindUint64
+	KindFloat
+	KindDouble
+	KindEnum
+	KindString
+	KindBytes
+	KindMessage
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindBool:
+		return "bool"
+	case KindInt32:
+		return "int32"
+	case KindInt64:
+		return "int64"
+	case KindUint32:
+		return "uint32"
+	case KindUint64:
+		return "uint64"
+	case KindFloat:
+		return "float"
+	case KindDouble:
+		return "double"
+	case KindEnum:
+		return "enum"
+	case KindString:
+		return "string"
+	case KindBytes:
+		return "bytes"
+	case KindMessage:
+		return "message"
+	default:
+		return "unknown"
+	}
+}
+
+// Size returns the number of bytes a value of a fixed-length kind takes, or 0 for
+// variable-length kinds
+func (k Kind) Size() int {
+	switch k {
+	case KindBool:
+		return 1
+	case KindInt32, KindUint32, KindFloat, KindEnum:
+		return 4
+	case KindInt64, KindUint64, KindDouble:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// Field describes one field of a message
+type Field struct {
+	Number    int32
+	Name      string
+	Kind      Kind
+	Repeated  bool
+	Public    bool
+	Sensitive bool
+	Delta     bool   // repeated integers stored as varint deltas (see serializer.PutDeltaEncoded)
+	Interned  bool   // strings stored as references into the segment's string dictionary (see serializer.StringDict)
+	Message   string // full name of the message type, for KindMessage
+}
+
+// Message describes one message. Fields are in declaration order, which determines their
+// position in the public and private tables.
+type Message struct {
+	FullName string
+	Fields   []Field
+}
+
+// Field returns the field with the given number, or nil
+func (m *Message) Field(number int32) *Field {
+	for i := range m.Fields {
+		if m.Fields[i].Number == number {
+			return &m.Fields[i]
+		}
+	}
+	return nil
+}
+
+// FieldByName returns the field with the given name, or nil
+func (m *Message) FieldByName(name string) *Field {
+	for i := range m.Fields {
+		if m.Fields[i].Name == name {
+			return &m.Fields[i]
+		}
+	}
+	return nil
+}
+
+// segments splits the fields into public and private lists, preserving declaration order
+func (m *Message) segments() (public, private []*Field) {
+	for i := range m.Fields {
+		if m.Fields[i].Public {
+			public = append(public, &m.Fields[i])
+		} else {
+			private = append(private, &m.Fields[i])
+		}
+	}
+	return public, private
+}
+
+// FromDescriptor builds the schema of a protobuf message. It fails for messages that have
+// no Symphony encoding (maps, oneofs and unsupported scalar kinds).
+func FromDescriptor(md protoreflect.MessageDescriptor) (*Message, error) {
+	msg := &Message{FullName: string(md.FullName())}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.IsMap() {
+			return nil, fmt.Errorf("%s: field %s is a map", md.FullName(), fd.Name())
+		}
+		if fd.ContainingOneof() != nil {
+			return nil, fmt.Errorf("%s: field %s is part of a oneof", md.FullName(), fd.Name())
+		}
+		kind, err := kindOf(fd)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", md.FullName(), err)
+		}
+		field := Field{
+			Number:    int32(fd.Number()),
+			Name:      string(fd.Name()),
+			Kind:      kind,
+			Repeated:  fd.IsList(),
+			Public:    boolOption(fd.Options(), isPublicOption),
+			Sensitive: boolOption(fd.Options(), isSensitiveOption),
+		}
+		switch kind {
+		case KindInt32, KindInt64, KindUint32, KindUint64:
+			field.Delta = field.Repeated && boolOption(fd.Options(), isDeltaOption)
+		}
+		if kind == KindString {
+			field.Interned = boolOption(fd.Options(), isInternedOption)
+		}
+		if kind == KindMessage {
+			field.Message = string(fd.Message().FullName())
+		}
+		msg.Fields = append(msg.Fields, field)
+	}
+	return msg, nil
+}
+
+func kindOf(fd protoreflect.FieldDescriptor) (Kind, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return KindBool, nil
+	case protoreflect.Int32Kind:
+		return KindInt32, nil
+	case protoreflect.Int64Kind:
+		return KindInt64, nil
+	case protoreflect.Uint32Kind:
+		return KindUint32, nil
+	case protoreflect.Uint64Kind:
+		return KindUint64, nil
+	case protoreflect.FloatKind:
+		return KindFloat, nil
+	case protoreflect.DoubleKind:
+		return KindDouble, nil
+	case protoreflect.EnumKind:
+		return KindEnum, nil
+	case protoreflect.StringKind:
+		return KindString, nil
+	case protoreflect.BytesKind:
+		return KindBytes, nil
+	case protoreflect.MessageKind:
+		return KindMessage, nil
+	default:
+		return 0, fmt.Errorf("field %s has unsupported type %s", fd.Name(), fd.Kind())
+	}
+}
+
+// boolOption reports whether the boolean field option with the given number is set. The
+// option may be a known extension (if the .pb.go defining it is linked in) or an unknown field.
+func boolOption(opts protoreflect.ProtoMessage, number protowire.Number) bool {
+	if opts == nil {
+		return false
+	}
+	m := opts.ProtoReflect()
+	found := false
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Number() == number && fd.Kind() == protoreflect.BoolKind {
+			found = v.Bool()
+			return false
+		}
+		return true
+	})
+	if found {
+		return true
+	}
+
+	unknown := m.GetUnknown()
+	for len(unknown) > 0 {
+		num, typ, n := protowire.ConsumeTag(unknown)
+		if n < 0 {
+			return false
+		}
+		unknown = unknown[n:]
+		if num == number && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(unknown)
+			if n < 0 {
+				return false
+			}
+			found = v != 0
+			unknown = unknown[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, unknown)
+		if n < 0 {
+			return false
+		}
+		unknown = unknown[n:]
+	}
+	return found
+}
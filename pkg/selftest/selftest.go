@@ -0,0 +1,243 @@
+// Package selftest checks a proxy end to end before it takes traffic. A loopback client sends
+// an RPC to a built-in echo target through a listener of the proxy: the client encrypts and
+// fragments it as the transport does, the proxy processes the request and the echoed
+// response as it processes real traffic, and the client checks that the response it
+// reassembles and decrypts is the request.
+package selftest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/transport"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultTimeout is the time the RPC may take if Config.Timeout is 0
+	DefaultTimeout = 5 * time.Second
+	// SegmentSize is the size of the public and the private segment of the message of the
+	// RPC, so that both span several fragments
+	SegmentSize = 2000
+)
+
+// datagramSize is the size of the datagrams read by the client, the echo target and the listener
+const datagramSize = 2048
+
+// Handler processes a datagram a proxy listener received from src, forwarding it from conn
+// like the listeners of the proxy do
+type Handler func(conn *net.UDPConn, src *net.UDPAddr, data []byte)
+
+// Config configures the RPC of a self-test
+type Config struct {
+	// Key encrypts the public segment, as configured in the proxy; nil sends the RPC in
+	// plaintext. The private segment is encrypted with transport.DefaultPrivateKey. The GCM
+	// objects must have been initialized with both by transport.InitGCMObjects, as proxies
+	// do on startup.
+	Key []byte
+	// Timeout bounds the time the RPC may take, DefaultTimeout if 0
+	Timeout time.Duration
+}
+
+// Run sends an RPC through a loopback listener whose datagrams are processed by handle, each
+// in its own goroutine, and returns why it failed, or nil if the response matched the request
+func Run(handle Handler, config Config) error {
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	var conns [3]*net.UDPConn
+	for i := range conns {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		conns[i] = conn
+	}
+	listener, client, target := conns[0], conns[1], conns[2]
+
+	go func() {
+		for {
+			buf := make([]byte, datagramSize)
+			n, src, err := listener.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			go handle(listener, src, buf[:n])
+		}
+	}()
+	go serveEcho(target, config.Key)
+
+	message := Message()
+	request := message
+	if config.Key != nil {
+		request = transport.EncryptSymphonyData(message, config.Key, transport.DefaultPrivateKey)
+	}
+	rpcID := transport.GenerateRPCID()
+	if err := send(client, listener.LocalAddr().(*net.UDPAddr), target.LocalAddr().(*net.UDPAddr), rpcID, request, config.Key); err != nil {
+		return err
+	}
+
+	response, err := receive(client, rpcID)
+	if err != nil {
+		return err
+	}
+	if config.Key != nil {
+		if response, err = decrypt(response, config.Key); err != nil {
+			return err
+		}
+	}
+	if !bytes.Equal(response, message) {
+		return fmt.Errorf("response of %d bytes differs from the request of %d bytes", len(response), len(message))
+	}
+	return nil
+}
+
+// Message returns the Symphony message of the RPC, with a public and a private segment of
+// SegmentSize bytes each
+func Message() []byte {
+	offsetToPrivate := 13 + SegmentSize
+	message := make([]byte, offsetToPrivate+SegmentSize)
+	message[0] = 0x01
+	binary.LittleEndian.PutUint32(message[1:5], uint32(offsetToPrivate))
+	for i := 13; i < len(message); i++ {
+		message[i] = byte(i)
+	}
+	message[offsetToPrivate] = 0x01
+	return message
+}
+
+// send fragments a request to target and sends it to the listener at proxy, the way
+// clients reach a proxy through its interception rules
+func send(client *net.UDPConn, proxy, target *net.UDPAddr, rpcID uint64, data, key []byte) error {
+	mtu := packet.MaxUDPPayloadSize - packet.DataPacketHeaderSize
+	if key != nil {
+		mtu -= transport.SecurityExtensionsSize
+	}
+	fragments, err := transport.FragmentPackets(data, mtu)
+	if err != nil {
+		return err
+	}
+	src := client.LocalAddr().(*net.UDPAddr)
+	for seq, fragment := range fragments {
+		pkt := &packet.DataPacket{
+			PacketTypeID: packet.PacketTypeRequest.TypeID,
+			RPCID:        rpcID,
+			TotalPackets: uint16(len(fragments)),
+			SeqNumber:    uint16(seq),
+			DstPort:      uint16(target.Port),
+			SrcPort:      uint16(src.Port),
+			Payload:      fragment,
+		}
+		copy(pkt.DstIP[:], target.IP.To4())
+		copy(pkt.SrcIP[:], src.IP.To4())
+		if key != nil {
+			transport.AddSecurityExtensions(pkt, key)
+		}
+		if err := write(client, pkt, proxy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serveEcho answers every request fragment received on conn with the same fragment of a
+// response, sent back to the proxy, until conn is closed
+func serveEcho(conn *net.UDPConn, key []byte) {
+	codec := &packet.DataPacketCodec{}
+	buf := make([]byte, datagramSize)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		decoded, err := codec.Deserialize(buf[:n])
+		request, ok := decoded.(*packet.DataPacket)
+		if err != nil || !ok || request.PacketTypeID != packet.PacketTypeRequest.TypeID {
+			logging.Warn("Self-test echo target received an unexpected packet", zap.String("src", src.String()), zap.Error(err))
+			continue
+		}
+		response := &packet.DataPacket{
+			PacketTypeID:  packet.PacketTypeResponse.TypeID,
+			RPCID:         request.RPCID,
+			TotalPackets:  request.TotalPackets,
+			SeqNumber:     request.SeqNumber,
+			MoreFragments: request.MoreFragments,
+			FragmentIndex: request.FragmentIndex,
+			DstIP:         request.SrcIP,
+			DstPort:       request.SrcPort,
+			SrcIP:         request.DstIP,
+			SrcPort:       request.DstPort,
+			Payload:       request.Payload,
+		}
+		if key != nil {
+			transport.AddSecurityExtensions(response, key)
+		}
+		if err := write(conn, response, src); err != nil {
+			logging.Warn("Self-test echo target failed to respond", zap.Error(err))
+		}
+	}
+}
+
+// write serializes a data packet and writes it to addr
+func write(conn *net.UDPConn, pkt *packet.DataPacket, addr *net.UDPAddr) error {
+	data, err := (&packet.DataPacketCodec{}).Serialize(pkt, nil)
+	if err != nil {
+		return err
+	}
+	_, err = conn.WriteToUDP(data, addr)
+	return err
+}
+
+// receive reads the fragments of the response to rpcID and returns its payload, reassembled
+// as the transport of clients does, or the error packet the proxy sent instead
+func receive(conn *net.UDPConn, rpcID uint64) ([]byte, error) {
+	reassembler := transport.NewDataReassembler()
+	received := 0
+	for {
+		buf := make([]byte, datagramSize)
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				err = errors.New("no complete response")
+			}
+			return nil, fmt.Errorf("%d response fragments received: %w", received, err)
+		}
+		decoded, _, err := packet.DeserializePacketAny(buf[:n])
+		if err != nil {
+			return nil, fmt.Errorf("invalid packet from the proxy: %w", err)
+		}
+		switch pkt := decoded.(type) {
+		case *packet.ErrorPacket:
+			return nil, fmt.Errorf("proxy returned an error: %s", pkt.ErrorMsg)
+		case *packet.DataPacket:
+			if pkt.RPCID != rpcID || pkt.PacketTypeID != packet.PacketTypeResponse.TypeID {
+				return nil, fmt.Errorf("unexpected packet of type %d for RPC %d", pkt.PacketTypeID, pkt.RPCID)
+			}
+			received++
+			if message, _, _, done := reassembler.ProcessFragment(pkt, src, buf); done {
+				return message, nil
+			}
+		}
+	}
+}
+
+// decrypt decrypts a response, turning the panics of the decryption of invalid data into
+// an error
+func decrypt(data, key []byte) (plaintext []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to decrypt the response: %v", r)
+		}
+	}()
+	return transport.DecryptSymphonyData(data, key, transport.DefaultPrivateKey), nil
+}
@@ -0,0 +1,56 @@
+package selftest
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/transport"
+)
+
+// forward is a Handler forwarding every data packet unchanged to its destination, as a proxy
+// without elements does
+func forward(conn *net.UDPConn, src *net.UDPAddr, data []byte) {
+	decoded, err := (&packet.DataPacketCodec{}).Deserialize(data)
+	if err != nil {
+		return
+	}
+	pkt := decoded.(*packet.DataPacket)
+	conn.WriteToUDP(data, &net.UDPAddr{IP: net.IP(pkt.DstIP[:]), Port: int(pkt.DstPort)})
+}
+
+func TestRun(t *testing.T) {
+	if err := Run(forward, Config{}); err != nil {
+		t.Errorf("Expected the plaintext RPC to pass, got %v", err)
+	}
+	if err := transport.InitGCMObjects(transport.DefaultPublicKey, transport.DefaultPrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run(forward, Config{Key: transport.DefaultPublicKey}); err != nil {
+		t.Errorf("Expected the encrypted RPC to pass, got %v", err)
+	}
+
+	// A dropped RPC times out
+	drop := func(conn *net.UDPConn, src *net.UDPAddr, data []byte) {}
+	if err := Run(drop, Config{Timeout: 100 * time.Millisecond}); err == nil || !strings.Contains(err.Error(), "no complete response") {
+		t.Errorf("Expected a dropped RPC to time out, got %v", err)
+	}
+
+	// A corrupted response is detected
+	corrupt := func(conn *net.UDPConn, src *net.UDPAddr, data []byte) {
+		decoded, err := (&packet.DataPacketCodec{}).Deserialize(data)
+		if err != nil {
+			return
+		}
+		pkt := decoded.(*packet.DataPacket)
+		if pkt.PacketTypeID == packet.PacketTypeResponse.TypeID && pkt.SeqNumber == 0 {
+			data[len(data)-1] ^= 0xff
+		}
+		forward(conn, src, data)
+	}
+	if err := Run(corrupt, Config{Timeout: time.Second}); err == nil || !strings.Contains(err.Error(), "differs") {
+		t.Errorf("Expected a corrupted response to be detected, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package serializer
+
+import "sync/atomic"
+
+// Code generated with the arena plugin parameter has UnmarshalSymphonyArena methods that
+// allocate the nested messages of one call from an Arena instead of one by one from the heap.
+// Each message type gets its own slab of chunks, identified by an ArenaType the generated
+// code registers once per type:
+//
+//	arena := serializer.NewArena()
+//	defer arena.Release()
+//	var res OrderResult
+//	if err := res.UnmarshalSymphonyArena(data, arena); err != nil { ... }
+
+const (
+	arenaMinChunk = 16   // elements in the first chunk of a slab
+	arenaMaxChunk = 1024 // elements from which chunks stop growing
+)
+
+// ArenaType identifies a message type within arenas
+type ArenaType int32
+
+var arenaTypes atomic.Int32
+
+// NewArenaType returns a new ArenaType. Generated code calls it once per message type.
+func NewArenaType() ArenaType {
+	return ArenaType(arenaTypes.Add(1) - 1)
+}
+
+// Arena is a slice-backed bump allocator for the nested messages of UnmarshalSymphonyArena
+// calls. It is not safe for concurrent use. A nil *Arena allocates from the heap.
+type Arena struct {
+	slabs []arenaSlab // indexed by ArenaType
+}
+
+type arenaSlab interface {
+	release()
+}
+
+// slab allocates values of one type from chunks that are reused after release
+type slab[T any] struct {
+	chunks [][]T
+	chunk  int // index of the chunk being allocated from
+	used   int // elements used in that chunk
+}
+
+// NewArena returns an empty arena
+func NewArena() *Arena {
+	return &Arena{}
+}
+
+// ArenaNew returns a pointer to a zero T allocated from a, or from the heap if a is nil
+func ArenaNew[T any](a *Arena, t ArenaType) *T {
+	if a == nil {
+		return new(T)
+	}
+	if int(t) >= len(a.slabs) {
+		a.slabs = append(a.slabs, make([]arenaSlab, int(t)+1-len(a.slabs))...)
+	}
+	s, _ := a.slabs[t].(*slab[T])
+	if s == nil {
+		s = &slab[T]{}
+		a.slabs[t] = s
+	}
+	return s.alloc()
+}
+
+func (s *slab[T]) alloc() *T {
+	for s.chunk < len(s.chunks) && s.used == len(s.chunks[s.chunk]) {
+		s.chunk++
+		s.used = 0
+	}
+	if s.chunk == len(s.chunks) {
+		n := arenaMinChunk
+		if len(s.chunks) > 0 {
+			n = min(2*len(s.chunks[len(s.chunks)-1]), arenaMaxChunk)
+		}
+		s.chunks = append(s.chunks, make([]T, n))
+		s.used = 0
+	}
+	v := &s.chunks[s.chunk][s.used]
+	s.used++
+	return v
+}
+
+// release zeroes the allocated values so they no longer keep their fields alive, and
+// rewinds the slab to its first chunk
+func (s *slab[T]) release() {
+	for i := 0; i < s.chunk && i < len(s.chunks); i++ {
+		clear(s.chunks[i])
+	}
+	if s.chunk < len(s.chunks) {
+		clear(s.chunks[s.chunk][:s.used])
+	}
+	s.chunk = 0
+	s.used = 0
+}
+
+// Release makes the memory of the arena available to later allocations. Messages allocated
+// from it, and everything reachable only through them, must not be used afterwards.
+func (a *Arena) Release() {
+	for _, s := range a.slabs {
+		if s != nil {
+			s.release()
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package serializer
+
+// Generated code decodes string and bytes fields with GetString and GetBytes. By default
+// they copy the field out of the encoded message. Built with the symphony_unsafe tag, they
+// alias it instead (see fixed_unsafe.go), so decoding a large field costs no allocation and
+// no copy. The decoded message then points into the encoded data, which must not be modified
+// or reused while the message is in use; clients and servers of pkg/rpc keep such receive
+// buffers out of their buffer pool.
+
+// GetString returns data as a string
+func GetString(data []byte) string {
+	if s, ok := aliasString(data); ok {
+		return s
+	}
+	return string(data)
+}
+
+// GetBytes returns data as a byte slice whose capacity ends with data, so that appending to
+// it never writes over the rest of the message
+func GetBytes(data []byte) []byte {
+	if b, ok := aliasBytes(data); ok {
+		return b
+	}
+	b := make([]byte, len(data))
+	copy(b, data)
+	return b
+}
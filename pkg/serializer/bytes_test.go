@@ -0,0 +1,69 @@
+package serializer_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/appnet-org/arpc/pkg/serializer"
+)
+
+// FuzzGetStringBytes checks that GetString and GetBytes, aliasing the data when built with
+// -tags symphony_unsafe, return the same values as copying it:
+//
+//	go test -tags symphony_unsafe -fuzz FuzzGetStringBytes ./pkg/serializer
+func FuzzGetStringBytes(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte("hello, symphony"))
+	f.Add([]byte{0, 0xff, 0xc3, 0x28})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if s := serializer.GetString(data); s != string(data) {
+			t.Fatalf("GetString returned %q, want %q", s, data)
+		}
+		b := serializer.GetBytes(data)
+		if !bytes.Equal(b, data) || b == nil || cap(b) != len(b) {
+			t.Fatalf("GetBytes returned %x (cap %d), want %x", b, cap(b), data)
+		}
+	})
+}
+
+func TestGetStringBytes_Aliasing(t *testing.T) {
+	msg := []byte("field+rest of the message")
+	s := serializer.GetString(msg[:5])
+	b := serializer.GetBytes(msg[:5])
+
+	// Appending to decoded bytes never writes over the rest of the message
+	_ = append(b, '!')
+	if string(msg) != "field+rest of the message" {
+		t.Fatalf("Appending to the decoded bytes changed the message to %q", msg)
+	}
+
+	// Only the unsafe fast path shares the memory of the message
+	msg[0] = 'F'
+	if aliased := s == "Field" && b[0] == 'F'; aliased != serializer.UnsafeFastPath {
+		t.Errorf("Got %q and %q after changing the message, want aliasing %v", s, b, serializer.UnsafeFastPath)
+	}
+}
+
+func benchmarkGet(b *testing.B, get func([]byte)) {
+	data := bytes.Repeat([]byte("symphony"), 8192) // 64 KiB
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for range b.N {
+		get(data)
+	}
+}
+
+var (
+	stringSink string
+	bytesSink  []byte
+)
+
+// BenchmarkGetString decodes a 64 KiB string field; compare with -tags symphony_unsafe
+func BenchmarkGetString(b *testing.B) {
+	benchmarkGet(b, func(data []byte) { stringSink = serializer.GetString(data) })
+}
+
+// BenchmarkGetBytes decodes a 64 KiB bytes field; compare with -tags symphony_unsafe
+func BenchmarkGetBytes(b *testing.B) {
+	benchmarkGet(b, func(data []byte) { bytesSink = serializer.GetBytes(data) })
+}
@@ -0,0 +1,24 @@
+// Package capnpserializer serializes Cap'n Proto messages for aRPC. It is a module of its own
+// so that applications not using Cap'n Proto do not depend on it.
+package capnpserializer
+
+import (
+	"capnproto.org/go/capnp/v3"
+)
+
+// Serializer marshals *capnp.Message values, and unmarshals into **capnp.Message
+type Serializer struct{}
+
+func (c *Serializer) Marshal(msg any) ([]byte, error) {
+	payload, err := msg.(*capnp.Message).Marshal()
+	return payload, err
+}
+
+func (c *Serializer) Unmarshal(data []byte, out any) error {
+	msg, err := capnp.Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	*out.(**capnp.Message) = msg
+	return err
+}
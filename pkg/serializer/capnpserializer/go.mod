@@ -0,0 +1,10 @@
+module github.com/appnet-org/arpc/pkg/serializer/capnpserializer
+
+go 1.24.0
+
+require capnproto.org/go/capnp/v3 v3.1.0-alpha.1
+
+require (
+	github.com/colega/zeropool v0.0.0-20230505084239-6fb4a4f75381 // indirect
+	golang.org/x/sync v0.17.0 // indirect
+)
@@ -0,0 +1,66 @@
+package serializer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// Generated Symphony code built with the checksum plugin parameter ends every message with
+// a CRC-32C of its private segment:
+//
+//	[public segment][private segment][crc32c(private segment)(4B)]
+//
+// The public segment is left out: proxies legitimately rewrite it in flight, whereas only
+// elements holding the whole message may change private fields, and the generated Raw
+// setters keep the checksum valid when they do. A mismatch at unmarshal time thus points at
+// an element or transport that corrupted the private segment.
+
+// ChecksumSize is the size of the checksum trailer
+const ChecksumSize = 4
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ChecksumError reports a message whose private segment does not match its checksum
+type ChecksumError struct {
+	Stored, Computed uint32
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("symphony: private segment checksum mismatch: stored %08x, computed %08x", e.Stored, e.Computed)
+}
+
+// privateSegment returns the bounds of the private segment of a message ending with a
+// checksum, or false if data is too short to hold both
+func privateSegment(data []byte) (start, end int, ok bool) {
+	if len(data) < 13+ChecksumSize {
+		return 0, 0, false
+	}
+	start = int(binary.LittleEndian.Uint32(data[1:5]))
+	end = len(data) - ChecksumSize
+	return start, end, start < end
+}
+
+// PutChecksum stores the checksum of the private segment of the message data in its last
+// ChecksumSize bytes. Data too short to hold a private segment and a checksum is left as is.
+func PutChecksum(data []byte) {
+	start, end, ok := privateSegment(data)
+	if !ok {
+		return
+	}
+	binary.LittleEndian.PutUint32(data[end:], crc32.Checksum(data[start:end], castagnoli))
+}
+
+// VerifyChecksum checks the private segment of the message data against the checksum in its
+// last ChecksumSize bytes. A mismatch is reported as a *ChecksumError.
+func VerifyChecksum(data []byte) error {
+	start, end, ok := privateSegment(data)
+	if !ok {
+		return fmt.Errorf("symphony: message too short for a private segment checksum")
+	}
+	stored := binary.LittleEndian.Uint32(data[end:])
+	if computed := crc32.Checksum(data[start:end], castagnoli); computed != stored {
+		return &ChecksumError{Stored: stored, Computed: computed}
+	}
+	return nil
+}
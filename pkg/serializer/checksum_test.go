@@ -0,0 +1,69 @@
+package serializer_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/appnet-org/arpc/pkg/serializer"
+)
+
+// checksummedMessage returns an empty-tabled message with the given public and private
+// payloads and room for the checksum
+func checksummedMessage(public, private []byte) []byte {
+	data := make([]byte, 0, 13+len(public)+1+len(private)+serializer.ChecksumSize)
+	data = append(data, 0x01)
+	data = binary.LittleEndian.AppendUint32(data, uint32(13+len(public)))
+	data = append(data, make([]byte, 8)...) // service and method IDs
+	data = append(data, public...)
+	data = append(data, 0x01)
+	data = append(data, private...)
+	return append(data, make([]byte, serializer.ChecksumSize)...)
+}
+
+func TestChecksum(t *testing.T) {
+	data := checksummedMessage([]byte("public"), []byte("private"))
+	serializer.PutChecksum(data)
+	if err := serializer.VerifyChecksum(data); err != nil {
+		t.Fatalf("VerifyChecksum() = %v, want nil", err)
+	}
+
+	// The public segment is not covered
+	data[13] ^= 0xff
+	binary.LittleEndian.PutUint32(data[5:9], 42)
+	if err := serializer.VerifyChecksum(data); err != nil {
+		t.Fatalf("VerifyChecksum() after public change = %v, want nil", err)
+	}
+
+	// The private segment is
+	data[len(data)-serializer.ChecksumSize-1] ^= 0x01
+	var checksumErr *serializer.ChecksumError
+	if err := serializer.VerifyChecksum(data); !errors.As(err, &checksumErr) {
+		t.Fatalf("VerifyChecksum() after private change = %v, want *ChecksumError", err)
+	}
+	if checksumErr.Stored == checksumErr.Computed {
+		t.Errorf("ChecksumError has equal checksums %08x", checksumErr.Stored)
+	}
+
+	serializer.PutChecksum(data)
+	if err := serializer.VerifyChecksum(data); err != nil {
+		t.Fatalf("VerifyChecksum() after PutChecksum = %v, want nil", err)
+	}
+}
+
+func TestChecksumShort(t *testing.T) {
+	data := checksummedMessage(nil, nil)
+	binary.LittleEndian.PutUint32(data[1:5], uint32(len(data))) // private segment past the end
+	serializer.PutChecksum(data)
+	err := serializer.VerifyChecksum(data)
+	if err == nil {
+		t.Fatal("VerifyChecksum() = nil, want an error")
+	}
+	var checksumErr *serializer.ChecksumError
+	if errors.As(err, &checksumErr) {
+		t.Errorf("VerifyChecksum() = %v, want a format error", err)
+	}
+	if err := serializer.VerifyChecksum(data[:13]); err == nil {
+		t.Error("VerifyChecksum() on a header = nil, want an error")
+	}
+}
@@ -0,0 +1,74 @@
+package serializer
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Generated Symphony code stores repeated integer fields annotated with is_delta_encoded
+// as the differences between consecutive values, zigzag- and varint-encoded:
+//
+//	[count(4B)][dataLen(4B)][varint(v0)][varint(v1-v0)]...[varint(vn-vn-1)]
+//
+// Sorted IDs and timestamps then take one or two bytes per value instead of four or eight.
+// Differences are computed modulo 2^64, so any sequence round-trips, but unsorted values
+// of large magnitude can take up to 10 bytes each.
+
+// DeltaInteger is the set of element types of delta-encoded fields
+type DeltaInteger interface {
+	~int32 | ~int64 | ~uint32 | ~uint64
+}
+
+// deltas calls fn with the zigzag-encoded difference of each value to its predecessor
+func deltas[T DeltaInteger](values []T, fn func(zigzag uint64)) {
+	var prev uint64
+	for _, v := range values {
+		cur := uint64(v) // signed values are sign-extended, so deltas of negative values stay small
+		d := int64(cur - prev)
+		fn(uint64(d<<1) ^ uint64(d>>63))
+		prev = cur
+	}
+}
+
+// DeltaEncodedSize returns the size of the varint data of values (without count and length)
+func DeltaEncodedSize[T DeltaInteger](values []T) int {
+	size := 0
+	deltas(values, func(zigzag uint64) {
+		size++
+		for zigzag >= 0x80 {
+			zigzag >>= 7
+			size++
+		}
+	})
+	return size
+}
+
+// PutDeltaEncoded writes the varint data of values to buf, which must hold
+// DeltaEncodedSize(values) bytes, and returns the number of bytes written
+func PutDeltaEncoded[T DeltaInteger](buf []byte, values []T) int {
+	n := 0
+	deltas(values, func(zigzag uint64) {
+		n += binary.PutUvarint(buf[n:], zigzag)
+	})
+	return n
+}
+
+// DecodeDeltaEncoded decodes count values from the varint data written by PutDeltaEncoded
+func DecodeDeltaEncoded[T DeltaInteger](data []byte, count int) ([]T, error) {
+	if count > len(data) {
+		// Every value takes at least one byte
+		return nil, fmt.Errorf("delta-encoded data too short: %d values in %d bytes", count, len(data))
+	}
+	values := make([]T, count)
+	var prev uint64
+	for i := range values {
+		zigzag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid varint in delta-encoded data at value %d", i)
+		}
+		data = data[n:]
+		prev += uint64(int64(zigzag>>1) ^ -int64(zigzag&1))
+		values[i] = T(prev)
+	}
+	return values, nil
+}
@@ -0,0 +1,192 @@
+package serializer
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Generated Symphony code stores string fields annotated with is_interned as references
+// into a dictionary of the distinct strings of their segment. The dictionary is the last
+// payload of the segment; its offset is the first slot of the segment table:
+//
+//	[count(4B)][len(s1)(4B)][s1]...[len(sn)(4B)][sn]
+//
+// A reference is a 32-bit value, 0 for the empty string and i for the i-th dictionary
+// entry. Repeated identical strings then take four bytes each instead of four plus their
+// length, and decoding allocates each distinct string once.
+
+// stringDictMapThreshold is the number of entries from which StringDict indexes its entries
+// in a map instead of scanning them
+const stringDictMapThreshold = 8
+
+// StringDict collects the distinct non-empty strings of a segment in first-use order.
+// The zero value is an empty dictionary.
+type StringDict struct {
+	entries []string
+	index   map[string]uint32
+	size    int // sum of the entry lengths
+}
+
+// Add adds s to the dictionary and returns its reference
+func (d *StringDict) Add(s string) uint32 {
+	if s == "" {
+		return 0
+	}
+	if ref := d.Ref(s); ref != 0 {
+		return ref
+	}
+	d.entries = append(d.entries, s)
+	d.size += len(s)
+	ref := uint32(len(d.entries))
+	if d.index != nil {
+		d.index[s] = ref
+	} else if len(d.entries) > stringDictMapThreshold {
+		d.index = make(map[string]uint32, 2*len(d.entries))
+		for i, e := range d.entries {
+			d.index[e] = uint32(i + 1)
+		}
+	}
+	return ref
+}
+
+// AddAll adds each of values to the dictionary
+func (d *StringDict) AddAll(values []string) {
+	for _, s := range values {
+		d.Add(s)
+	}
+}
+
+// Ref returns the reference of s, 0 if s is empty or was not added
+func (d *StringDict) Ref(s string) uint32 {
+	if s == "" {
+		return 0
+	}
+	if d.index != nil {
+		return d.index[s]
+	}
+	for i, e := range d.entries {
+		if e == s {
+			return uint32(i + 1)
+		}
+	}
+	return 0
+}
+
+// Len returns the number of entries
+func (d *StringDict) Len() int {
+	return len(d.entries)
+}
+
+// EncodedSize returns the size of the encoded dictionary, 0 if it is empty (an empty
+// dictionary is not written and its offset stays 0)
+func (d *StringDict) EncodedSize() int {
+	if len(d.entries) == 0 {
+		return 0
+	}
+	return 4 + 4*len(d.entries) + d.size
+}
+
+// Put writes the encoded dictionary to buf, which must hold EncodedSize() bytes, and
+// returns the number of bytes written
+func (d *StringDict) Put(buf []byte) int {
+	if len(d.entries) == 0 {
+		return 0
+	}
+	binary.LittleEndian.PutUint32(buf, uint32(len(d.entries)))
+	n := 4
+	for _, s := range d.entries {
+		binary.LittleEndian.PutUint32(buf[n:], uint32(len(s)))
+		n += 4 + copy(buf[n+4:], s)
+	}
+	return n
+}
+
+// DecodeStringDict decodes the dictionary at the start of data
+func DecodeStringDict(data []byte) ([]string, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("string dictionary too short")
+	}
+	count := int(binary.LittleEndian.Uint32(data))
+	if count > (len(data)-4)/4 {
+		// Every entry takes at least its length prefix
+		return nil, fmt.Errorf("string dictionary too short: %d entries in %d bytes", count, len(data))
+	}
+	entries := make([]string, count)
+	pos := 4
+	for i := range entries {
+		if len(data) < pos+4 {
+			return nil, fmt.Errorf("string dictionary too short at entry %d", i)
+		}
+		n := int(binary.LittleEndian.Uint32(data[pos:]))
+		if n > len(data)-pos-4 {
+			return nil, fmt.Errorf("string dictionary entry %d exceeds data", i)
+		}
+		entries[i] = string(data[pos+4 : pos+4+n])
+		pos += 4 + n
+	}
+	return entries, nil
+}
+
+// DictString resolves a reference against a decoded dictionary
+func DictString(entries []string, ref uint32) (string, error) {
+	if ref == 0 {
+		return "", nil
+	}
+	if int(ref) > len(entries) {
+		return "", fmt.Errorf("string reference %d out of range (dictionary has %d entries)", ref, len(entries))
+	}
+	return entries[ref-1], nil
+}
+
+// LookupStringDict resolves a reference against the encoded dictionary at the start of
+// data without decoding the other entries. It returns false if the reference is out of
+// range or the dictionary is malformed.
+func LookupStringDict(data []byte, ref uint32) (string, bool) {
+	if ref == 0 {
+		return "", true
+	}
+	if len(data) < 4 || int(ref) > int(binary.LittleEndian.Uint32(data)) {
+		return "", false
+	}
+	pos := 4
+	for i := uint32(1); ; i++ {
+		if len(data) < pos+4 {
+			return "", false
+		}
+		n := int(binary.LittleEndian.Uint32(data[pos:]))
+		if n > len(data)-pos-4 {
+			return "", false
+		}
+		if i == ref {
+			return string(data[pos+4 : pos+4+n]), true
+		}
+		pos += 4 + n
+	}
+}
+
+// FindStringDict returns the reference of s in the encoded dictionary at the start of data,
+// 0 for the empty string, and false if s is not in the dictionary
+func FindStringDict(data []byte, s string) (uint32, bool) {
+	if s == "" {
+		return 0, true
+	}
+	if len(data) < 4 {
+		return 0, false
+	}
+	count := binary.LittleEndian.Uint32(data)
+	pos := 4
+	for i := uint32(1); i <= count; i++ {
+		if len(data) < pos+4 {
+			return 0, false
+		}
+		n := int(binary.LittleEndian.Uint32(data[pos:]))
+		if n > len(data)-pos-4 {
+			return 0, false
+		}
+		if string(data[pos+4:pos+4+n]) == s {
+			return i, true
+		}
+		pos += 4 + n
+	}
+	return 0, false
+}
@@ -0,0 +1,93 @@
+package serializer
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/appnet-org/arpc/pkg/logging"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec tags are stored in the first byte of a payload, where Symphony stores its version.
+// Protobuf payloads keep the 13-byte Symphony header so that routing (service/method IDs),
+// fragmentation and encryption work unchanged, but the whole body is treated as public.
+const (
+	CodecTagSymphony byte = 0x01
+	CodecTagProtobuf byte = 0x02
+)
+
+// headerSize is the size of the Symphony header kept in front of protobuf payloads
+const headerSize = 13
+
+// CodecMarshaler is implemented by serializers that can encode a message with a given
+// codec. The server uses it to answer in the codec of the request.
+type CodecMarshaler interface {
+	MarshalWithCodec(msg any, codecTag byte) ([]byte, error)
+}
+
+// MarshalProtobufTagged encodes msg with protobuf behind a Symphony header tagged CodecTagProtobuf
+func MarshalProtobufTagged(msg proto.Message) ([]byte, error) {
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, headerSize+len(body))
+	buf[0] = CodecTagProtobuf
+	binary.LittleEndian.PutUint32(buf[1:5], uint32(len(buf))) // no private segment
+	// service and method IDs (bytes 5-13) are filled in by the client
+	copy(buf[headerSize:], body)
+	return buf, nil
+}
+
+// UnmarshalProtobufTagged decodes a payload produced by MarshalProtobufTagged
+func UnmarshalProtobufTagged(data []byte, out proto.Message) error {
+	if len(data) < headerSize || data[0] != CodecTagProtobuf {
+		return fmt.Errorf("invalid data: not a protobuf tagged payload")
+	}
+	return proto.Unmarshal(data[headerSize:], out)
+}
+
+// SymphonyFallbackSerializer encodes messages with Symphony and transparently falls back
+// to protobuf when Symphony encoding fails (e.g. for field types Symphony does not support
+// yet) or when PreferProtobuf is set, so that partially migrated fleets interoperate.
+// Unmarshal accepts both codecs based on the codec tag of the payload.
+type SymphonyFallbackSerializer struct {
+	// PreferProtobuf encodes every message with protobuf, for peers that have not
+	// migrated to Symphony
+	PreferProtobuf bool
+}
+
+func (s *SymphonyFallbackSerializer) Marshal(msg any) ([]byte, error) {
+	if s.PreferProtobuf {
+		return s.MarshalWithCodec(msg, CodecTagProtobuf)
+	}
+	return s.MarshalWithCodec(msg, CodecTagSymphony)
+}
+
+func (s *SymphonyFallbackSerializer) MarshalWithCodec(msg any, codecTag byte) ([]byte, error) {
+	if sm, ok := msg.(SymphonyMessage); ok && codecTag == CodecTagSymphony {
+		data, err := sm.MarshalSymphony()
+		if err == nil {
+			return data, nil
+		}
+		logging.Debug("Symphony encoding failed, falling back to protobuf", zap.Error(err))
+	}
+
+	pm, ok := msg.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("cannot encode %T: not a Symphony or protobuf message", msg)
+	}
+	return MarshalProtobufTagged(pm)
+}
+
+func (s *SymphonyFallbackSerializer) Unmarshal(data []byte, out any) error {
+	if len(data) > 0 && data[0] == CodecTagProtobuf {
+		pm, ok := out.(proto.Message)
+		if !ok {
+			return fmt.Errorf("cannot decode protobuf payload into %T", out)
+		}
+		return UnmarshalProtobufTagged(data, pm)
+	}
+	return out.(SymphonyMessage).UnmarshalSymphony(data)
+}
@@ -0,0 +1,163 @@
+package serializer
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// The payload of a repeated fixed-length field is its values in little-endian order,
+// 1, 4 or 8 bytes each. Generated code encodes and decodes it with the Put and Get
+// functions below. Built with the symphony_unsafe tag, they copy the whole slice as one
+// block on little-endian hosts (see fixed_unsafe.go) instead of converting value by value.
+
+// fixedValue is the set of element types that can be written as raw memory
+type fixedValue interface {
+	~bool | numericValue
+}
+
+// numericValue is the set of element types that can also be read as raw memory. Bools are
+// not, since a byte other than 0 or 1 is not a valid bool.
+type numericValue interface {
+	~int32 | ~uint32 | ~int64 | ~uint64 | ~float32 | ~float64
+}
+
+// PutBools writes values to buf as one byte each, 1 for true
+func PutBools(buf []byte, values []bool) {
+	if putBulk(buf, values) {
+		return
+	}
+	for i, v := range values {
+		if v {
+			buf[i] = 1
+		} else {
+			buf[i] = 0
+		}
+	}
+}
+
+// PutInt32s writes values to buf as little-endian 32-bit integers
+func PutInt32s[T ~int32](buf []byte, values []T) {
+	if putBulk(buf, values) {
+		return
+	}
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(buf[4*i:], uint32(v))
+	}
+}
+
+// PutUint32s writes values to buf as little-endian 32-bit integers
+func PutUint32s(buf []byte, values []uint32) {
+	if putBulk(buf, values) {
+		return
+	}
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(buf[4*i:], v)
+	}
+}
+
+// PutInt64s writes values to buf as little-endian 64-bit integers
+func PutInt64s(buf []byte, values []int64) {
+	if putBulk(buf, values) {
+		return
+	}
+	for i, v := range values {
+		binary.LittleEndian.PutUint64(buf[8*i:], uint64(v))
+	}
+}
+
+// PutUint64s writes values to buf as little-endian 64-bit integers
+func PutUint64s(buf []byte, values []uint64) {
+	if putBulk(buf, values) {
+		return
+	}
+	for i, v := range values {
+		binary.LittleEndian.PutUint64(buf[8*i:], v)
+	}
+}
+
+// PutFloat32s writes values to buf as little-endian IEEE 754 single-precision numbers
+func PutFloat32s(buf []byte, values []float32) {
+	if putBulk(buf, values) {
+		return
+	}
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+}
+
+// PutFloat64s writes values to buf as little-endian IEEE 754 double-precision numbers
+func PutFloat64s(buf []byte, values []float64) {
+	if putBulk(buf, values) {
+		return
+	}
+	for i, v := range values {
+		binary.LittleEndian.PutUint64(buf[8*i:], math.Float64bits(v))
+	}
+}
+
+// GetBools fills dst from data, any non-zero byte being true. It never copies in bulk.
+func GetBools(dst []bool, data []byte) {
+	for i := range dst {
+		dst[i] = data[i] != 0
+	}
+}
+
+// GetInt32s fills dst with the little-endian 32-bit integers at the start of data
+func GetInt32s[T ~int32](dst []T, data []byte) {
+	if getBulk(dst, data) {
+		return
+	}
+	for i := range dst {
+		dst[i] = T(int32(binary.LittleEndian.Uint32(data[4*i:])))
+	}
+}
+
+// GetUint32s fills dst with the little-endian 32-bit integers at the start of data
+func GetUint32s(dst []uint32, data []byte) {
+	if getBulk(dst, data) {
+		return
+	}
+	for i := range dst {
+		dst[i] = binary.LittleEndian.Uint32(data[4*i:])
+	}
+}
+
+// GetInt64s fills dst with the little-endian 64-bit integers at the start of data
+func GetInt64s(dst []int64, data []byte) {
+	if getBulk(dst, data) {
+		return
+	}
+	for i := range dst {
+		dst[i] = int64(binary.LittleEndian.Uint64(data[8*i:]))
+	}
+}
+
+// GetUint64s fills dst with the little-endian 64-bit integers at the start of data
+func GetUint64s(dst []uint64, data []byte) {
+	if getBulk(dst, data) {
+		return
+	}
+	for i := range dst {
+		dst[i] = binary.LittleEndian.Uint64(data[8*i:])
+	}
+}
+
+// GetFloat32s fills dst with the little-endian single-precision numbers at the start of data
+func GetFloat32s(dst []float32, data []byte) {
+	if getBulk(dst, data) {
+		return
+	}
+	for i := range dst {
+		dst[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+}
+
+// GetFloat64s fills dst with the little-endian double-precision numbers at the start of data
+func GetFloat64s(dst []float64, data []byte) {
+	if getBulk(dst, data) {
+		return
+	}
+	for i := range dst {
+		dst[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[8*i:]))
+	}
+}
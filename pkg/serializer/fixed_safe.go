@@ -0,0 +1,14 @@
+//go:build !symphony_unsafe
+
+package serializer
+
+// UnsafeFastPath reports whether the package was built with the symphony_unsafe tag
+const UnsafeFastPath = false
+
+func putBulk[T fixedValue](buf []byte, values []T) bool { return false }
+
+func getBulk[T numericValue](dst []T, data []byte) bool { return false }
+
+func aliasString(data []byte) (string, bool) { return "", false }
+
+func aliasBytes(data []byte) ([]byte, bool) { return nil, false }
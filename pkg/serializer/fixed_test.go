@@ -0,0 +1,93 @@
+package serializer_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/appnet-org/arpc/pkg/serializer"
+)
+
+// FuzzFixed checks that the Put and Get functions, bulk copies included when built with
+// -tags symphony_unsafe, match value-by-value little-endian encoding:
+//
+//	go test -tags symphony_unsafe -fuzz FuzzFixed ./pkg/serializer
+func FuzzFixed(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{1, 0, 2})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0x80, 0, 0, 0xc0, 0x7f, 0x01, 0, 0, 0, 0, 0, 0xf0, 0x7f})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		n32, n64 := len(data)/4, len(data)/8
+
+		bools := make([]bool, len(data))
+		serializer.GetBools(bools, data)
+		buf := make([]byte, len(data))
+		serializer.PutBools(buf, bools)
+		for i, b := range data {
+			want := byte(0)
+			if b != 0 {
+				want = 1
+			}
+			if bools[i] != (b != 0) || buf[i] != want {
+				t.Fatalf("bool %d: got %v, %d for %d", i, bools[i], buf[i], b)
+			}
+		}
+
+		i32 := make([]int32, n32)
+		serializer.GetInt32s(i32, data)
+		u32 := make([]uint32, n32)
+		serializer.GetUint32s(u32, data)
+		f32 := make([]float32, n32)
+		serializer.GetFloat32s(f32, data)
+		for i := range n32 {
+			want := binary.LittleEndian.Uint32(data[4*i:])
+			if uint32(i32[i]) != want || u32[i] != want || math.Float32bits(f32[i]) != want {
+				t.Fatalf("32-bit value %d: got %d, %d, %v, want %#x", i, i32[i], u32[i], f32[i], want)
+			}
+		}
+		i64 := make([]int64, n64)
+		serializer.GetInt64s(i64, data)
+		u64 := make([]uint64, n64)
+		serializer.GetUint64s(u64, data)
+		f64 := make([]float64, n64)
+		serializer.GetFloat64s(f64, data)
+		for i := range n64 {
+			want := binary.LittleEndian.Uint64(data[8*i:])
+			if uint64(i64[i]) != want || u64[i] != want || math.Float64bits(f64[i]) != want {
+				t.Fatalf("64-bit value %d: got %d, %d, %v, want %#x", i, i64[i], u64[i], f64[i], want)
+			}
+		}
+
+		// Writing the decoded values back reproduces the input, NaN payloads included
+		for _, w := range []struct {
+			name string
+			n    int
+			put  func([]byte)
+		}{
+			{"int32", 4 * n32, func(b []byte) { serializer.PutInt32s(b, i32) }},
+			{"uint32", 4 * n32, func(b []byte) { serializer.PutUint32s(b, u32) }},
+			{"float32", 4 * n32, func(b []byte) { serializer.PutFloat32s(b, f32) }},
+			{"int64", 8 * n64, func(b []byte) { serializer.PutInt64s(b, i64) }},
+			{"uint64", 8 * n64, func(b []byte) { serializer.PutUint64s(b, u64) }},
+			{"float64", 8 * n64, func(b []byte) { serializer.PutFloat64s(b, f64) }},
+		} {
+			buf := make([]byte, w.n+1)
+			buf[w.n] = 0xaa
+			w.put(buf)
+			if !bytes.Equal(buf[:w.n], data[:w.n]) || buf[w.n] != 0xaa {
+				t.Fatalf("%s: wrote %x, want %x", w.name, buf, data[:w.n])
+			}
+		}
+	})
+}
+
+func TestFixedShortBuffer(t *testing.T) {
+	// Both paths panic instead of writing a truncated payload
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected a panic for a short buffer (unsafe path: %v)", serializer.UnsafeFastPath)
+		}
+	}()
+	serializer.PutInt64s(make([]byte, 15), []int64{1, 2})
+}
@@ -0,0 +1,51 @@
+//go:build symphony_unsafe
+
+package serializer
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// UnsafeFastPath reports whether the package was built with the symphony_unsafe tag
+const UnsafeFastPath = true
+
+// littleEndian reports whether the memory layout of the values matches their encoding
+var littleEndian = binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+
+// asBytes aliases the memory of values as a byte slice
+func asBytes[T fixedValue](values []T) []byte {
+	var zero T
+	return unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(values))), len(values)*int(unsafe.Sizeof(zero)))
+}
+
+// putBulk copies values to buf as one block. Like the value-by-value path, it panics if
+// buf is too short.
+func putBulk[T fixedValue](buf []byte, values []T) bool {
+	if !littleEndian {
+		return false
+	}
+	src := asBytes(values)
+	copy(buf[:len(src)], src)
+	return true
+}
+
+// getBulk copies the start of data to dst as one block
+func getBulk[T numericValue](dst []T, data []byte) bool {
+	if !littleEndian {
+		return false
+	}
+	dstBytes := asBytes(dst)
+	copy(dstBytes, data[:len(dstBytes)])
+	return true
+}
+
+// aliasString returns a string sharing the memory of data
+func aliasString(data []byte) (string, bool) {
+	return unsafe.String(unsafe.SliceData(data), len(data)), true
+}
+
+// aliasBytes returns data with its capacity cut at its length
+func aliasBytes(data []byte) ([]byte, bool) {
+	return data[:len(data):len(data)], true
+}
@@ -0,0 +1,69 @@
+package serializer
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// CodecTagRaw tags payloads whose body is the opaque bytes of a raw method
+const CodecTagRaw byte = 0x03
+
+// RawMessage is the request or response of a raw method: opaque bytes sent behind the
+// Symphony header without being encoded, for services that move blobs they do not need to
+// decode, such as proxies and storage daemons. The bytes are the private segment of the
+// payload, so proxies on the path forward them without buffering or decoding them.
+type RawMessage []byte
+
+// MarshalRaw returns a payload tagged CodecTagRaw carrying body
+func MarshalRaw(body []byte) []byte {
+	buf := make([]byte, headerSize+len(body))
+	buf[0] = CodecTagRaw
+	binary.LittleEndian.PutUint32(buf[1:5], headerSize) // the body is the private segment
+	// service and method IDs (bytes 5-13) are filled in by the client
+	copy(buf[headerSize:], body)
+	return buf
+}
+
+// UnmarshalRaw returns the body of a payload produced by MarshalRaw. It shares the memory
+// of data.
+func UnmarshalRaw(data []byte) ([]byte, error) {
+	if len(data) < headerSize || data[0] != CodecTagRaw {
+		return nil, fmt.Errorf("invalid data: not a raw payload")
+	}
+	return data[headerSize:], nil
+}
+
+// IsRaw reports whether msg is a RawMessage or a *RawMessage
+func IsRaw(msg any) bool {
+	switch msg.(type) {
+	case RawMessage, *RawMessage:
+		return true
+	}
+	return false
+}
+
+// MarshalMessage encodes msg with s, or as a raw payload if msg is a RawMessage
+func MarshalMessage(s Serializer, msg any) ([]byte, error) {
+	switch m := msg.(type) {
+	case RawMessage:
+		return MarshalRaw(m), nil
+	case *RawMessage:
+		return MarshalRaw(*m), nil
+	}
+	return s.Marshal(msg)
+}
+
+// UnmarshalMessage decodes data into out with s, or copies the body of a raw payload into
+// out if it is a *RawMessage
+func UnmarshalMessage(s Serializer, data []byte, out any) error {
+	raw, ok := out.(*RawMessage)
+	if !ok {
+		return s.Unmarshal(data, out)
+	}
+	body, err := UnmarshalRaw(data)
+	if err != nil {
+		return err
+	}
+	*raw = append(RawMessage(nil), body...)
+	return nil
+}
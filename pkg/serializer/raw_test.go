@@ -0,0 +1,32 @@
+package serializer_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/appnet-org/arpc/pkg/serializer"
+)
+
+func TestRawMessage(t *testing.T) {
+	codec := &serializer.SymphonyFallbackSerializer{}
+	data, err := serializer.MarshalMessage(codec, serializer.RawMessage("blob"))
+	if err != nil {
+		t.Fatalf("MarshalMessage() = %v", err)
+	}
+	if data[0] != serializer.CodecTagRaw || binary.LittleEndian.Uint32(data[1:5]) != 13 || string(data[13:]) != "blob" {
+		t.Fatalf("Unexpected raw payload % x", data)
+	}
+
+	var out serializer.RawMessage
+	if err := serializer.UnmarshalMessage(codec, data, &out); err != nil {
+		t.Fatalf("UnmarshalMessage() = %v", err)
+	}
+	data[13] = 'B'
+	if string(out) != "blob" {
+		t.Errorf("Expected a copy of the body, got %q", out)
+	}
+
+	if err := serializer.UnmarshalMessage(codec, []byte{serializer.CodecTagSymphony, 13, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, &out); err == nil {
+		t.Error("Expected an error for a Symphony payload")
+	}
+}
@@ -0,0 +1,248 @@
+package serializer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Generated Symphony code stores google.protobuf well-known types like nested messages
+// ([size(4B)][data]), with these compact encodings for the data:
+//
+//	Timestamp, Duration          [seconds(8B)][nanos(4B)]
+//	BoolValue                    [value(1B)]
+//	Int32Value, UInt32Value,
+//	FloatValue                   [value(4B)]
+//	Int64Value, UInt64Value,
+//	DoubleValue                  [value(8B)]
+//	StringValue, BytesValue      [value]
+//	Any                          [typeURLLen(4B)][typeURL][value]
+//	Struct, Value, ListValue     protobuf encoding
+//	Empty                        no data
+//
+// The value of an Any is stored as is. NewAny packs Symphony messages with Symphony
+// (their version byte 0x01 is never a valid first byte of a protobuf encoding), and
+// UnmarshalAny decodes either codec.
+
+// WellKnownSize returns the size of the compact encoding of a well-known type
+func WellKnownSize(msg proto.Message) int {
+	switch m := msg.(type) {
+	case *timestamppb.Timestamp, *durationpb.Duration:
+		return 12
+	case *wrapperspb.BoolValue:
+		return 1
+	case *wrapperspb.Int32Value, *wrapperspb.UInt32Value, *wrapperspb.FloatValue:
+		return 4
+	case *wrapperspb.Int64Value, *wrapperspb.UInt64Value, *wrapperspb.DoubleValue:
+		return 8
+	case *wrapperspb.StringValue:
+		return len(m.GetValue())
+	case *wrapperspb.BytesValue:
+		return len(m.GetValue())
+	case *anypb.Any:
+		return 4 + len(m.GetTypeUrl()) + len(m.GetValue())
+	case *emptypb.Empty:
+		return 0
+	default:
+		return proto.Size(msg)
+	}
+}
+
+// MarshalWellKnown encodes a well-known type with its compact encoding
+func MarshalWellKnown(msg proto.Message) ([]byte, error) {
+	buf := make([]byte, WellKnownSize(msg))
+	switch m := msg.(type) {
+	case *timestamppb.Timestamp:
+		binary.LittleEndian.PutUint64(buf[0:8], uint64(m.GetSeconds()))
+		binary.LittleEndian.PutUint32(buf[8:12], uint32(m.GetNanos()))
+	case *durationpb.Duration:
+		binary.LittleEndian.PutUint64(buf[0:8], uint64(m.GetSeconds()))
+		binary.LittleEndian.PutUint32(buf[8:12], uint32(m.GetNanos()))
+	case *wrapperspb.BoolValue:
+		if m.GetValue() {
+			buf[0] = 1
+		}
+	case *wrapperspb.Int32Value:
+		binary.LittleEndian.PutUint32(buf, uint32(m.GetValue()))
+	case *wrapperspb.UInt32Value:
+		binary.LittleEndian.PutUint32(buf, m.GetValue())
+	case *wrapperspb.FloatValue:
+		binary.LittleEndian.PutUint32(buf, math.Float32bits(m.GetValue()))
+	case *wrapperspb.Int64Value:
+		binary.LittleEndian.PutUint64(buf, uint64(m.GetValue()))
+	case *wrapperspb.UInt64Value:
+		binary.LittleEndian.PutUint64(buf, m.GetValue())
+	case *wrapperspb.DoubleValue:
+		binary.LittleEndian.PutUint64(buf, math.Float64bits(m.GetValue()))
+	case *wrapperspb.StringValue:
+		copy(buf, m.GetValue())
+	case *wrapperspb.BytesValue:
+		copy(buf, m.GetValue())
+	case *anypb.Any:
+		binary.LittleEndian.PutUint32(buf[0:4], uint32(len(m.GetTypeUrl())))
+		copy(buf[4:], m.GetTypeUrl())
+		copy(buf[4+len(m.GetTypeUrl()):], m.GetValue())
+	case *emptypb.Empty:
+	case *structpb.Struct, *structpb.Value, *structpb.ListValue:
+		return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	default:
+		return nil, fmt.Errorf("symphony: %s is not a supported well-known type", msg.ProtoReflect().Descriptor().FullName())
+	}
+	return buf, nil
+}
+
+// UnmarshalWellKnown decodes the compact encoding of a well-known type into msg
+func UnmarshalWellKnown(data []byte, msg proto.Message) error {
+	if size := WellKnownSize(msg); isFixedSizeWellKnown(msg) && len(data) != size {
+		return fmt.Errorf("invalid data: %s needs %d bytes, got %d", msg.ProtoReflect().Descriptor().FullName(), size, len(data))
+	}
+
+	switch m := msg.(type) {
+	case *timestamppb.Timestamp:
+		m.Seconds = int64(binary.LittleEndian.Uint64(data[0:8]))
+		m.Nanos = int32(binary.LittleEndian.Uint32(data[8:12]))
+	case *durationpb.Duration:
+		m.Seconds = int64(binary.LittleEndian.Uint64(data[0:8]))
+		m.Nanos = int32(binary.LittleEndian.Uint32(data[8:12]))
+	case *wrapperspb.BoolValue:
+		m.Value = data[0] != 0
+	case *wrapperspb.Int32Value:
+		m.Value = int32(binary.LittleEndian.Uint32(data))
+	case *wrapperspb.UInt32Value:
+		m.Value = binary.LittleEndian.Uint32(data)
+	case *wrapperspb.FloatValue:
+		m.Value = math.Float32frombits(binary.LittleEndian.Uint32(data))
+	case *wrapperspb.Int64Value:
+		m.Value = int64(binary.LittleEndian.Uint64(data))
+	case *wrapperspb.UInt64Value:
+		m.Value = binary.LittleEndian.Uint64(data)
+	case *wrapperspb.DoubleValue:
+		m.Value = math.Float64frombits(binary.LittleEndian.Uint64(data))
+	case *wrapperspb.StringValue:
+		m.Value = string(data)
+	case *wrapperspb.BytesValue:
+		m.Value = append([]byte(nil), data...)
+	case *anypb.Any:
+		if len(data) < 4 {
+			return fmt.Errorf("invalid data: too short for Any")
+		}
+		urlLen := int(binary.LittleEndian.Uint32(data[0:4]))
+		if len(data) < 4+urlLen {
+			return fmt.Errorf("invalid data: too short for Any type URL")
+		}
+		m.TypeUrl = string(data[4 : 4+urlLen])
+		m.Value = append([]byte(nil), data[4+urlLen:]...)
+	case *emptypb.Empty:
+	case *structpb.Struct, *structpb.Value, *structpb.ListValue:
+		return proto.Unmarshal(data, msg)
+	default:
+		return fmt.Errorf("symphony: %s is not a supported well-known type", msg.ProtoReflect().Descriptor().FullName())
+	}
+	return nil
+}
+
+// isFixedSizeWellKnown reports whether the encoding of msg has a size independent of its value
+func isFixedSizeWellKnown(msg proto.Message) bool {
+	switch msg.(type) {
+	case *timestamppb.Timestamp, *durationpb.Duration, *wrapperspb.BoolValue,
+		*wrapperspb.Int32Value, *wrapperspb.UInt32Value, *wrapperspb.FloatValue,
+		*wrapperspb.Int64Value, *wrapperspb.UInt64Value, *wrapperspb.DoubleValue:
+		return true
+	default:
+		return false
+	}
+}
+
+// WellKnownText renders a well-known type for the text format of Raw types. The output is
+// deterministic, unlike the String method of the protobuf types.
+func WellKnownText(msg proto.Message) string {
+	switch m := msg.(type) {
+	case *timestamppb.Timestamp:
+		return strconv.Quote(m.AsTime().Format(time.RFC3339Nano))
+	case *durationpb.Duration:
+		return strconv.Quote(m.AsDuration().String())
+	case *wrapperspb.BoolValue:
+		return strconv.FormatBool(m.GetValue())
+	case *wrapperspb.Int32Value:
+		return strconv.FormatInt(int64(m.GetValue()), 10)
+	case *wrapperspb.UInt32Value:
+		return strconv.FormatUint(uint64(m.GetValue()), 10)
+	case *wrapperspb.FloatValue:
+		return strconv.FormatFloat(float64(m.GetValue()), 'g', -1, 32)
+	case *wrapperspb.Int64Value:
+		return strconv.FormatInt(m.GetValue(), 10)
+	case *wrapperspb.UInt64Value:
+		return strconv.FormatUint(m.GetValue(), 10)
+	case *wrapperspb.DoubleValue:
+		return strconv.FormatFloat(m.GetValue(), 'g', -1, 64)
+	case *wrapperspb.StringValue:
+		return strconv.Quote(m.GetValue())
+	case *wrapperspb.BytesValue:
+		return strconv.Quote(string(m.GetValue()))
+	case *anypb.Any:
+		return fmt.Sprintf("{ type_url: %q }", m.GetTypeUrl())
+	case *emptypb.Empty:
+		return "{}"
+	case *structpb.Struct:
+		return jsonText(m.AsMap())
+	case *structpb.Value:
+		return jsonText(m.AsInterface())
+	case *structpb.ListValue:
+		return jsonText(m.AsSlice())
+	default:
+		return fmt.Sprintf("<unsupported %s>", msg.ProtoReflect().Descriptor().FullName())
+	}
+}
+
+// jsonText renders v as quoted JSON (map keys are sorted)
+func jsonText(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("<invalid: %v>", err)
+	}
+	return strconv.Quote(string(data))
+}
+
+// NewAny packs msg into an Any. Symphony messages are packed with Symphony, other
+// messages with protobuf. Peers that only speak protobuf cannot unpack Symphony values,
+// so use anypb.New for messages sent to them.
+func NewAny(msg proto.Message) (*anypb.Any, error) {
+	typeURL := "type.googleapis.com/" + string(msg.ProtoReflect().Descriptor().FullName())
+	if sm, ok := msg.(SymphonyMessage); ok {
+		if value, err := sm.MarshalSymphony(); err == nil {
+			return &anypb.Any{TypeUrl: typeURL, Value: value}, nil
+		}
+	}
+	value, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &anypb.Any{TypeUrl: typeURL, Value: value}, nil
+}
+
+// UnmarshalAny unpacks an Any produced by NewAny or anypb.New into out
+func UnmarshalAny(a *anypb.Any, out proto.Message) error {
+	if !a.MessageIs(out) {
+		return fmt.Errorf("mismatched message type: got %q, want %q", a.GetTypeUrl(), out.ProtoReflect().Descriptor().FullName())
+	}
+	value := a.GetValue()
+	if len(value) > 0 && value[0] == CodecTagSymphony {
+		sm, ok := out.(SymphonyMessage)
+		if !ok {
+			return fmt.Errorf("cannot decode Symphony value into %T", out)
+		}
+		return sm.UnmarshalSymphony(value)
+	}
+	return proto.Unmarshal(value, out)
+}
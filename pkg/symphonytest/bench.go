@@ -0,0 +1,72 @@
+package symphonytest
+
+import (
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/appnet-org/arpc/pkg/serializer"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+// ExampleDir is the directory, relative to the package under test, that Example reads
+// example messages from
+const ExampleDir = "testdata/symphony"
+
+// Message is a generated message with a Symphony encoding
+type Message[T any] interface {
+	*T
+	proto.Message
+	serializer.SymphonyMessage
+}
+
+// Example fills msg with the example for its type: the text-format message in
+// testdata/symphony/<full name>.txtpb if there is one, else a message populated
+// from a fixed seed, so that runs are comparable.
+func Example(tb testing.TB, msg proto.Message) {
+	tb.Helper()
+	name := string(msg.ProtoReflect().Descriptor().FullName())
+	text, err := os.ReadFile(filepath.Join(ExampleDir, name+".txtpb"))
+	switch {
+	case err == nil:
+		if err := prototext.Unmarshal(text, msg); err != nil {
+			tb.Fatalf("example %s: %v", name, err)
+		}
+	case os.IsNotExist(err):
+		Populate(msg, rand.New(rand.NewPCG(1, 2)))
+	default:
+		tb.Fatalf("example %s: %v", name, err)
+	}
+}
+
+// Benchmark runs Marshal and Unmarshal sub-benchmarks of the Symphony encoding of the
+// example message of type T (see Example)
+func Benchmark[T any, PT Message[T]](b *testing.B) {
+	msg := PT(new(T))
+	Example(b, msg)
+	data, err := msg.MarshalSymphony()
+	if err != nil {
+		b.Fatalf("MarshalSymphony failed: %v", err)
+	}
+
+	b.Run("Marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		for b.Loop() {
+			if _, err := msg.MarshalSymphony(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Unmarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		for b.Loop() {
+			if err := PT(new(T)).UnmarshalSymphony(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
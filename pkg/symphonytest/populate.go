@@ -0,0 +1,103 @@
+// Package symphonytest provides helpers for testing and benchmarking generated Symphony
+// code: messages filled in through protobuf reflection, round trips checked against
+// protobuf, and the benchmarks that protoc-gen-symphony generates with the bench parameter.
+package symphonytest
+
+import (
+	"math/rand/v2"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	maxDepth    = 3 // levels of nested messages Populate fills, so recursive messages stay finite
+	maxElements = 3 // elements of each repeated or map field
+)
+
+// Populate sets the fields of msg to values drawn from r. About one field in four is left
+// unset, repeated and map fields get up to three elements, and only the first field of
+// each oneof is set.
+func Populate(msg proto.Message, r *rand.Rand) {
+	populate(msg.ProtoReflect(), r, 0)
+}
+
+func populate(m protoreflect.Message, r *rand.Rand, depth int) {
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() && oneof.Fields().Get(0) != fd {
+			continue
+		}
+		if r.IntN(4) == 0 {
+			continue
+		}
+		switch {
+		case fd.IsList():
+			list := m.Mutable(fd).List()
+			for n := r.IntN(maxElements + 1); n > 0; n-- {
+				list.Append(newValue(fd, list.NewElement, r, depth))
+			}
+		case fd.IsMap():
+			entries := m.Mutable(fd).Map()
+			for n := r.IntN(maxElements + 1); n > 0; n-- {
+				key := scalarValue(fd.MapKey(), r).MapKey()
+				entries.Set(key, newValue(fd.MapValue(), entries.NewValue, r, depth))
+			}
+		case fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind:
+			if depth < maxDepth {
+				populate(m.Mutable(fd).Message(), r, depth+1)
+			}
+		default:
+			m.Set(fd, scalarValue(fd, r))
+		}
+	}
+}
+
+// newValue returns a value for an element of a repeated or map field, using alloc for messages
+func newValue(fd protoreflect.FieldDescriptor, alloc func() protoreflect.Value, r *rand.Rand, depth int) protoreflect.Value {
+	if fd.Kind() != protoreflect.MessageKind && fd.Kind() != protoreflect.GroupKind {
+		return scalarValue(fd, r)
+	}
+	v := alloc()
+	if depth < maxDepth {
+		populate(v.Message(), r, depth+1)
+	}
+	return v
+}
+
+func scalarValue(fd protoreflect.FieldDescriptor, r *rand.Rand) protoreflect.Value {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(r.IntN(2) == 1)
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		return protoreflect.ValueOfEnum(values.Get(r.IntN(values.Len())).Number())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(int32(r.Uint32()))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(r.Uint32())
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(int64(r.Uint64()))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return protoreflect.ValueOfUint64(r.Uint64())
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(float32(r.NormFloat64() * 1e3))
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(r.NormFloat64() * 1e6)
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(string(randomBytes(r, 'a', 26)))
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes(randomBytes(r, 0, 256))
+	}
+	panic("symphonytest: unexpected kind " + fd.Kind().String())
+}
+
+// randomBytes returns up to 16 bytes in [base, base+n)
+func randomBytes(r *rand.Rand, base, n int) []byte {
+	b := make([]byte, r.IntN(17))
+	for i := range b {
+		b[i] = byte(base + r.IntN(n))
+	}
+	return b
+}
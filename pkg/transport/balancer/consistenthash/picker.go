@@ -0,0 +1,91 @@
+package consistenthash
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// KeyFunc extracts the hash key from a marshaled request
+type KeyFunc func(payload []byte) (string, error)
+
+// PublicStringField returns a KeyFunc that reads a public string/bytes field of a
+// Symphony message whose table entry is at tableOffset (13 for the first public field).
+func PublicStringField(tableOffset int) KeyFunc {
+	return func(payload []byte) (string, error) {
+		if len(payload) < tableOffset+4 {
+			return "", fmt.Errorf("payload too short for key field: len=%d", len(payload))
+		}
+		fieldOffset := int(binary.LittleEndian.Uint32(payload[tableOffset:]))
+		if fieldOffset == 0 || len(payload) < fieldOffset+4 {
+			return "", fmt.Errorf("key field not present in public segment")
+		}
+		fieldLen := int(binary.LittleEndian.Uint32(payload[fieldOffset:]))
+		if len(payload) < fieldOffset+4+fieldLen {
+			return "", fmt.Errorf("key field out of bounds: offset=%d, len=%d", fieldOffset, fieldLen)
+		}
+		return string(payload[fieldOffset+4 : fieldOffset+4+fieldLen]), nil
+	}
+}
+
+// PublicUint32Field returns a KeyFunc that reads a fixed-length public (u)int32 field at tableOffset
+func PublicUint32Field(tableOffset int) KeyFunc {
+	return func(payload []byte) (string, error) {
+		if len(payload) < tableOffset+4 {
+			return "", fmt.Errorf("payload too short for key field: len=%d", len(payload))
+		}
+		return strconv.FormatUint(uint64(binary.LittleEndian.Uint32(payload[tableOffset:])), 10), nil
+	}
+}
+
+// PublicUint64Field returns a KeyFunc that reads a fixed-length public (u)int64 field at tableOffset
+func PublicUint64Field(tableOffset int) KeyFunc {
+	return func(payload []byte) (string, error) {
+		if len(payload) < tableOffset+8 {
+			return "", fmt.Errorf("payload too short for key field: len=%d", len(payload))
+		}
+		return strconv.FormatUint(binary.LittleEndian.Uint64(payload[tableOffset:]), 10), nil
+	}
+}
+
+// Picker picks a backend for each call by hashing a request field onto a bounded-load ring.
+// It implements rpc.Picker.
+type Picker struct {
+	ring    *Ring
+	keyFunc KeyFunc
+}
+
+// NewPicker creates a picker over the given backend addresses (host:port).
+// loadFactor < 1 uses DefaultLoadFactor.
+func NewPicker(backends []string, keyFunc KeyFunc, loadFactor float64) *Picker {
+	ring := NewRing(DefaultReplicas, loadFactor)
+	ring.Add(backends...)
+	return &Picker{
+		ring:    ring,
+		keyFunc: keyFunc,
+	}
+}
+
+// Pick returns the backend for the request; done must be called once the call completes
+func (p *Picker) Pick(payload []byte) (string, func(), error) {
+	key, err := p.keyFunc(payload)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to extract hash key: %w", err)
+	}
+
+	backend := p.ring.Acquire(key)
+	if backend == "" {
+		return "", nil, fmt.Errorf("no backends available")
+	}
+	return backend, func() { p.ring.Release(backend) }, nil
+}
+
+// SetBackends replaces the set of backends
+func (p *Picker) SetBackends(backends []string) {
+	p.ring.Set(backends)
+}
+
+// Ring returns the underlying hash ring
+func (p *Picker) Ring() *Ring {
+	return p.ring
+}
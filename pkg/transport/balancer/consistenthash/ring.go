@@ -0,0 +1,195 @@
+package consistenthash
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const (
+	// DefaultReplicas is the default number of virtual nodes per member
+	DefaultReplicas = 100
+	// DefaultLoadFactor bounds the load of a member to 1.25x the average load
+	DefaultLoadFactor = 1.25
+)
+
+// Ring is a consistent hash ring with bounded loads.
+// Keys are mapped to the first member clockwise from their hash whose load is
+// below ceil(loadFactor * average load), so hot keys spill over to the next members
+// instead of overloading a single backend.
+type Ring struct {
+	mu         sync.RWMutex
+	replicas   int
+	loadFactor float64
+	hashes     []uint32          // sorted virtual node hashes
+	owners     map[uint32]string // virtual node hash -> member
+	loads      map[string]int64  // member -> in-flight load
+	totalLoad  int64
+}
+
+// NewRing creates a ring with the given number of virtual nodes per member and load factor.
+// replicas <= 0 uses DefaultReplicas; loadFactor < 1 uses DefaultLoadFactor.
+func NewRing(replicas int, loadFactor float64) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	if loadFactor < 1 {
+		loadFactor = DefaultLoadFactor
+	}
+	return &Ring{
+		replicas:   replicas,
+		loadFactor: loadFactor,
+		owners:     make(map[uint32]string),
+		loads:      make(map[string]int64),
+	}
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// Add adds members to the ring
+func (r *Ring) Add(members ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, member := range members {
+		if _, ok := r.loads[member]; ok {
+			continue
+		}
+		r.loads[member] = 0
+		for i := 0; i < r.replicas; i++ {
+			h := hashKey(member + "#" + strconv.Itoa(i))
+			r.owners[h] = member
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+}
+
+// Remove removes a member (and its load) from the ring
+func (r *Ring) Remove(member string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	load, ok := r.loads[member]
+	if !ok {
+		return
+	}
+	r.totalLoad -= load
+	delete(r.loads, member)
+
+	hashes := r.hashes[:0]
+	for _, h := range r.hashes {
+		if r.owners[h] == member {
+			delete(r.owners, h)
+			continue
+		}
+		hashes = append(hashes, h)
+	}
+	r.hashes = hashes
+}
+
+// Set replaces the members of the ring, keeping the loads of members that remain
+func (r *Ring) Set(members []string) {
+	keep := make(map[string]bool, len(members))
+	for _, member := range members {
+		keep[member] = true
+	}
+	for _, member := range r.Members() {
+		if !keep[member] {
+			r.Remove(member)
+		}
+	}
+	r.Add(members...)
+}
+
+// Members returns the members of the ring
+func (r *Ring) Members() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	members := make([]string, 0, len(r.loads))
+	for member := range r.loads {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// Get returns the member owning key, ignoring loads. Returns "" if the ring is empty.
+func (r *Ring) Get(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	return r.owners[r.hashes[r.search(hashKey(key))]]
+}
+
+// Acquire returns the member for key under the load bound and increments its load.
+// Callers must call Release with the returned member once the request completes.
+// Returns "" if the ring is empty.
+func (r *Ring) Acquire(key string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.hashes) == 0 {
+		return ""
+	}
+
+	maxLoad := r.maxLoad()
+	start := r.search(hashKey(key))
+	for i := 0; i < len(r.hashes); i++ {
+		member := r.owners[r.hashes[(start+i)%len(r.hashes)]]
+		if r.loads[member]+1 <= maxLoad {
+			r.loads[member]++
+			r.totalLoad++
+			return member
+		}
+	}
+
+	// Unreachable while maxLoad >= average, but fall back to the owner
+	member := r.owners[r.hashes[start]]
+	r.loads[member]++
+	r.totalLoad++
+	return member
+}
+
+// Release decrements the load of member
+func (r *Ring) Release(member string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if load, ok := r.loads[member]; ok && load > 0 {
+		r.loads[member] = load - 1
+		r.totalLoad--
+	}
+}
+
+// Load returns the current load of member
+func (r *Ring) Load(member string) int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.loads[member]
+}
+
+// maxLoad returns the load bound for the next assignment (caller must hold the lock)
+func (r *Ring) maxLoad() int64 {
+	avg := float64(r.totalLoad+1) / float64(len(r.loads))
+	return int64(math.Ceil(avg * r.loadFactor))
+}
+
+// search returns the index of the first virtual node at or after h (caller must hold the lock)
+func (r *Ring) search(h uint32) int {
+	idx := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if idx == len(r.hashes) {
+		idx = 0
+	}
+	return idx
+}
@@ -0,0 +1,153 @@
+package consistenthash
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+func TestRing_GetIsStable(t *testing.T) {
+	ring := NewRing(0, 0)
+	ring.Add("10.0.0.1:9000", "10.0.0.2:9000", "10.0.0.3:9000")
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		first := ring.Get(key)
+		if first == "" {
+			t.Fatalf("Expected a member for key %s", key)
+		}
+		if again := ring.Get(key); again != first {
+			t.Errorf("Key %s mapped to %s then %s", key, first, again)
+		}
+	}
+}
+
+func TestRing_RemoveOnlyMovesKeysOfRemovedMember(t *testing.T) {
+	ring := NewRing(0, 0)
+	ring.Add("a", "b", "c")
+
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		before[key] = ring.Get(key)
+	}
+
+	ring.Remove("b")
+	for key, owner := range before {
+		after := ring.Get(key)
+		if after == "b" {
+			t.Fatalf("Key %s still mapped to removed member", key)
+		}
+		if owner != "b" && after != owner {
+			t.Errorf("Key %s moved from %s to %s although its owner was not removed", key, owner, after)
+		}
+	}
+}
+
+func TestRing_AcquireBoundsLoad(t *testing.T) {
+	ring := NewRing(0, 1.25)
+	members := []string{"a", "b", "c", "d"}
+	ring.Add(members...)
+
+	// All requests use the same hot key; the bound must spread them across members
+	const requests = 100
+	for i := 0; i < requests; i++ {
+		ring.Acquire("hot-key")
+	}
+
+	// Bound for the last assignment is ceil(1.25 * requests / members)
+	maxAllowed := int64((requests*5 + 4*len(members) - 1) / (4 * len(members)))
+	for _, member := range members {
+		if load := ring.Load(member); load > maxAllowed {
+			t.Errorf("Member %s has load %d, expected at most %d", member, load, maxAllowed)
+		}
+	}
+
+	owner := ring.Get("hot-key")
+	for i := 0; i < requests; i++ {
+		for _, member := range members {
+			ring.Release(member)
+		}
+	}
+	if got := ring.Acquire("hot-key"); got != owner {
+		t.Errorf("Expected key to return to its owner %s once load drained, got %s", owner, got)
+	}
+}
+
+func TestRing_Empty(t *testing.T) {
+	ring := NewRing(0, 0)
+	if got := ring.Get("key"); got != "" {
+		t.Errorf("Expected empty member for empty ring, got %s", got)
+	}
+	if got := ring.Acquire("key"); got != "" {
+		t.Errorf("Expected empty member for empty ring, got %s", got)
+	}
+}
+
+func TestPicker_PickByPublicStringField(t *testing.T) {
+	picker := NewPicker([]string{"10.0.0.1:9000", "10.0.0.2:9000"}, PublicStringField(13), 0)
+
+	// Public segment: header (13 bytes), one offset slot, then [len][bytes]
+	key := "user-42"
+	payload := make([]byte, 17+4+len(key))
+	payload[0] = 0x01
+	binary.LittleEndian.PutUint32(payload[1:5], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(payload[13:17], 17)
+	binary.LittleEndian.PutUint32(payload[17:21], uint32(len(key)))
+	copy(payload[21:], key)
+
+	addr, done, err := picker.Pick(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if addr != picker.Ring().Get(key) {
+		t.Errorf("Expected %s, got %s", picker.Ring().Get(key), addr)
+	}
+	if picker.Ring().Load(addr) != 1 {
+		t.Errorf("Expected load 1 while call in flight, got %d", picker.Ring().Load(addr))
+	}
+	done()
+	if picker.Ring().Load(addr) != 0 {
+		t.Errorf("Expected load 0 after done, got %d", picker.Ring().Load(addr))
+	}
+
+	if _, _, err := picker.Pick(payload[:10]); err == nil {
+		t.Error("Expected error for truncated payload")
+	}
+}
+
+// stringFieldPayload returns a public segment whose first public field is the string key:
+// header (13 bytes), one offset slot, then [len][bytes]
+func stringFieldPayload(key string) []byte {
+	payload := make([]byte, 17+4+len(key))
+	payload[0] = 0x01
+	binary.LittleEndian.PutUint32(payload[1:5], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(payload[13:17], 17)
+	binary.LittleEndian.PutUint32(payload[17:21], uint32(len(key)))
+	copy(payload[21:], key)
+	return payload
+}
+
+func TestPublicFieldKeyFuncs(t *testing.T) {
+	key, err := PublicStringField(13)(stringFieldPayload("user-42"))
+	if err != nil || key != "user-42" {
+		t.Errorf("PublicStringField returned %q, %v, want user-42", key, err)
+	}
+	if _, err := PublicStringField(13)(stringFieldPayload("user-42")[:19]); err == nil {
+		t.Error("Expected an error for a truncated string field")
+	}
+	absent := stringFieldPayload("")
+	binary.LittleEndian.PutUint32(absent[13:17], 0)
+	if _, err := PublicStringField(13)(absent); err == nil {
+		t.Error("Expected an error for an absent string field")
+	}
+
+	fixed := make([]byte, 17)
+	binary.LittleEndian.PutUint32(fixed[13:], 4000000000)
+	if key, err := PublicUint32Field(13)(fixed); err != nil || key != "4000000000" {
+		t.Errorf("PublicUint32Field returned %q, %v, want 4000000000", key, err)
+	}
+	if _, err := PublicUint32Field(13)(fixed[:16]); err == nil {
+		t.Error("Expected an error for a truncated uint32 field")
+	}
+}
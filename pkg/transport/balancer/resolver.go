@@ -3,6 +3,7 @@ package balancer
 import (
 	"fmt"
 	"net"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,6 +21,7 @@ type Resolver struct {
 	cache       map[string]dnsCacheEntry
 	cacheTTL    time.Duration
 	cacheEnable bool
+	endpoints   map[string][]*net.UDPAddr // static endpoint sets by host, see SetEndpoints
 	mu          sync.RWMutex
 }
 
@@ -89,6 +91,10 @@ func (r *Resolver) ResolveUDPTarget(addr string) (*net.UDPAddr, error) {
 		return &net.UDPAddr{IP: ip, Port: port}, nil
 	}
 
+	if addr, ok := r.pickEndpoint(host); ok {
+		return addr, nil
+	}
+
 	// FQDN case: resolve all IPs and use balancer
 	result, err := r.lookupIPs(host)
 	if err != nil {
@@ -121,6 +127,48 @@ func (r *Resolver) ResolveUDPTarget(addr string) (*net.UDPAddr, error) {
 	return &net.UDPAddr{IP: chosen, Port: port}, nil
 }
 
+// SetEndpoints replaces the static endpoint sets of the resolver (e.g. the clusters of a
+// service mesh control plane). Hosts that have one are not looked up: the balancer picks one
+// of their endpoints, whose port replaces the port of the address resolved. A nil map
+// removes every set.
+func (r *Resolver) SetEndpoints(endpoints map[string][]*net.UDPAddr) {
+	sets := make(map[string][]*net.UDPAddr, len(endpoints))
+	for host, addrs := range endpoints {
+		if len(addrs) > 0 {
+			sets[host] = slices.Clone(addrs)
+		}
+	}
+	r.mu.Lock()
+	r.endpoints = sets
+	r.mu.Unlock()
+}
+
+// pickEndpoint picks an endpoint of the static set of host, if it has one
+func (r *Resolver) pickEndpoint(host string) (*net.UDPAddr, bool) {
+	r.mu.RLock()
+	addrs := r.endpoints[host]
+	r.mu.RUnlock()
+	if len(addrs) == 0 {
+		return nil, false
+	}
+
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	chosen := r.balancer.Pick(host, ips)
+	for _, addr := range addrs {
+		if addr.IP.Equal(chosen) {
+			logging.Debug("Balancer selected endpoint",
+				zap.String("balancer", r.balancer.Name()),
+				zap.String("host", host),
+				zap.String("selected", addr.String()))
+			return &net.UDPAddr{IP: addr.IP, Port: addr.Port}, true
+		}
+	}
+	return &net.UDPAddr{IP: addrs[0].IP, Port: addrs[0].Port}, true // the balancer picked none
+}
+
 // DefaultResolver creates a resolver with a random balancer (for backward compatibility)
 func DefaultResolver() *Resolver {
 	return NewResolverWithDefaults(random.NewRandomBalancer())
@@ -0,0 +1,360 @@
+package transport
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/schema"
+)
+
+// MinPrivateChunkSize is the smallest private chunk EncryptChunkedSymphonyData produces
+// (except for the last one). Every chunk costs 20 bytes of directory, so the payloads of
+// small fields are merged into the chunk of the next field.
+const MinPrivateChunkSize = 64
+
+// privateDirectoryHeaderSize is the size of the nonce and chunk count of a directory
+const privateDirectoryHeaderSize = 12 + 2
+
+// EncryptChunkedSymphonyData encrypts Symphony marshaled data like EncryptSymphonyData, but
+// encrypts the private segment in chunks starting at boundaries (relative to the start of
+// the private segment, see schema.Message.PrivateBoundaries), so that the receiver can
+// decrypt the payloads of some fields only (see SealedMessage). The private segment becomes
+//
+//	[nonce(12)][chunkCount(2)][chunkStart(4)]...[tag(16)]...[ciphertext]
+//
+// where the ciphertext keeps the length and layout of the plaintext. Chunk i is encrypted
+// with the nonce whose last 4 bytes are XORed with i, and authenticates the directory
+// before the tags. Boundaries closer than MinPrivateChunkSize to the previous one are
+// dropped, and without boundaries the private segment is encrypted as one chunk.
+//
+// Returns encrypted data with updated offsetToPrivate, or panics on error.
+func EncryptChunkedSymphonyData(data []byte, publicKey []byte, privateKey []byte, boundaries []int) []byte {
+	if len(data) < 13 {
+		panic("invalid Symphony data: too short for header")
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(data[1:5]))
+	if offsetToPrivate < 13 || offsetToPrivate > len(data) {
+		panic(fmt.Sprintf("invalid offsetToPrivate: %d (data length: %d)", offsetToPrivate, len(data)))
+	}
+
+	// The public segment is encrypted as in EncryptSymphonyData
+	encryptedPublic := EncryptSymphonyData(data[:offsetToPrivate], publicKey, nil)
+	if offsetToPrivate == len(data) {
+		return encryptedPublic
+	}
+	if privateKey == nil {
+		panic("privateKey is required for encrypting private segment")
+	}
+	private := data[offsetToPrivate:]
+
+	starts := []int{0}
+	for _, b := range boundaries {
+		if b-starts[len(starts)-1] >= MinPrivateChunkSize && b < len(private) && len(starts) < math.MaxUint16 {
+			starts = append(starts, b)
+		}
+	}
+
+	// Directory: nonce, chunk count and starts (authenticated by every chunk), then the tags
+	gcm := privateGCM
+	tagSize := gcm.Overhead()
+	aadSize := privateDirectoryHeaderSize + 4*len(starts)
+	dirSize := aadSize + tagSize*len(starts)
+	result := make([]byte, len(encryptedPublic)+dirSize+len(private))
+	copy(result, encryptedPublic)
+	dir := result[len(encryptedPublic) : len(encryptedPublic)+dirSize]
+	if _, err := rand.Read(dir[:12]); err != nil {
+		panic(fmt.Sprintf("failed to generate nonce: %v", err))
+	}
+	binary.LittleEndian.PutUint16(dir[12:14], uint16(len(starts)))
+	for i, start := range starts {
+		binary.LittleEndian.PutUint32(dir[privateDirectoryHeaderSize+4*i:], uint32(start))
+	}
+	aad := dir[:aadSize]
+	tags := dir[aadSize:]
+
+	ciphertext := result[len(encryptedPublic)+dirSize:]
+	nonce := make([]byte, 12)
+	sealed := make([]byte, 0, len(private)+tagSize)
+	for i, start := range starts {
+		end := len(private)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		sealed = gcm.Seal(sealed[:0], chunkNonce(nonce, dir[:12], i), private[start:end], aad)
+		copy(ciphertext[start:end], sealed)
+		copy(tags[tagSize*i:], sealed[end-start:])
+	}
+	return result
+}
+
+// DecryptChunkedSymphonyData decrypts data encrypted with EncryptChunkedSymphonyData,
+// returning the same plaintext as DecryptSymphonyData does for EncryptSymphonyData, or
+// panics on error.
+func DecryptChunkedSymphonyData(data []byte, publicKey []byte, privateKey []byte) []byte {
+	sealed, err := OpenChunkedSymphonyData(data, publicKey, privateKey)
+	if err != nil {
+		panic(err.Error())
+	}
+	if err := sealed.OpenAll(); err != nil {
+		panic(err.Error())
+	}
+	return sealed.Data
+}
+
+// OpenChunkedSymphonyData decrypts the public segment and the private table of data
+// encrypted with EncryptChunkedSymphonyData, leaving the other private chunks to be
+// decrypted on demand with the methods of the returned SealedMessage.
+func OpenChunkedSymphonyData(data []byte, publicKey []byte, privateKey []byte) (*SealedMessage, error) {
+	if len(data) < 13 || publicKey == nil {
+		return nil, errors.New("invalid encrypted data: too short for header or missing public key")
+	}
+	encryptedOffsetToPrivate := int(binary.LittleEndian.Uint32(data[1:5]))
+	if encryptedOffsetToPrivate < 13+28 || encryptedOffsetToPrivate > len(data) {
+		return nil, fmt.Errorf("invalid encrypted offsetToPrivate: %d (data length: %d)", encryptedOffsetToPrivate, len(data))
+	}
+	publicPlaintext, err := decryptSegment(data[13:encryptedOffsetToPrivate], true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt public segment: %w", err)
+	}
+	offsetToPrivate := 13 + len(publicPlaintext)
+
+	s := &SealedMessage{offsetToPrivate: offsetToPrivate}
+	var private []byte
+	if encryptedOffsetToPrivate < len(data) {
+		if privateKey == nil {
+			return nil, errors.New("privateKey is required for decrypting private segment")
+		}
+		s.gcm = privateGCM
+		if private, err = s.parseDirectory(data[encryptedOffsetToPrivate:]); err != nil {
+			return nil, err
+		}
+	}
+
+	s.Data = make([]byte, offsetToPrivate+len(private))
+	copy(s.Data, data[:13])
+	binary.LittleEndian.PutUint32(s.Data[1:5], uint32(offsetToPrivate))
+	copy(s.Data[13:], publicPlaintext)
+	copy(s.Data[offsetToPrivate:], private)
+
+	if len(s.starts) > 0 {
+		// The table is needed to find the payloads of fields
+		if err := s.Open(0, 1); err != nil {
+			return nil, err
+		}
+		if s.Data[offsetToPrivate] != 0x01 {
+			return nil, errors.New("invalid decrypted private segment: missing or incorrect version byte")
+		}
+	}
+	return s, nil
+}
+
+// SealedMessage is a received Symphony message whose public segment is decrypted and whose
+// private segment is decrypted chunk by chunk, in place, as it is opened. Data has the
+// layout of the plaintext message, so once the fields a handler needs are opened, its Raw
+// accessors read them from Data directly. A SealedMessage is not safe for concurrent use.
+type SealedMessage struct {
+	// Data is the message: the header, the public segment, and the private segment, of which
+	// only the opened chunks hold plaintext
+	Data []byte
+
+	offsetToPrivate int
+	gcm             cipher.AEAD
+	nonce           []byte
+	aad             []byte // directory authenticated by every chunk
+	starts          []int
+	tags            []byte
+	opened          []bool
+	sealed          int // chunks not opened yet
+}
+
+// parseDirectory reads the directory of an encrypted private segment and returns its
+// ciphertext
+func (s *SealedMessage) parseDirectory(encrypted []byte) ([]byte, error) {
+	if len(encrypted) < privateDirectoryHeaderSize {
+		return nil, errors.New("invalid encrypted private segment: too short for directory")
+	}
+	count := int(binary.LittleEndian.Uint16(encrypted[12:14]))
+	tagSize := s.gcm.Overhead()
+	aadSize := privateDirectoryHeaderSize + 4*count
+	dirSize := aadSize + tagSize*count
+	if count == 0 || len(encrypted) < dirSize {
+		return nil, fmt.Errorf("invalid encrypted private segment: directory of %d chunks", count)
+	}
+	private := encrypted[dirSize:]
+
+	// The directory outlives the received buffer
+	dir := append([]byte(nil), encrypted[:dirSize]...)
+	s.nonce = dir[:12]
+	s.aad = dir[:aadSize]
+	s.tags = dir[aadSize:]
+	s.starts = make([]int, count)
+	for i := range s.starts {
+		s.starts[i] = int(binary.LittleEndian.Uint32(dir[privateDirectoryHeaderSize+4*i:]))
+		if i == 0 && s.starts[i] != 0 || i > 0 && s.starts[i] <= s.starts[i-1] || s.starts[i] >= len(private) {
+			return nil, fmt.Errorf("invalid encrypted private segment: chunk %d starts at %d", i, s.starts[i])
+		}
+	}
+	s.opened = make([]bool, count)
+	s.sealed = count
+	return private, nil
+}
+
+// Sealed returns the number of private chunks that are not decrypted yet
+func (s *SealedMessage) Sealed() int {
+	return s.sealed
+}
+
+// Open decrypts the private chunks holding the bytes from start to end of the private
+// segment (relative to its start, as the offsets of the private table are)
+func (s *SealedMessage) Open(start, end int) error {
+	private := s.Data[s.offsetToPrivate:]
+	if start < 0 || end > len(private) || start >= end {
+		return fmt.Errorf("invalid private range %d-%d (segment of %d bytes)", start, end, len(private))
+	}
+	tagSize := s.gcm.Overhead()
+	nonce := make([]byte, 12)
+	var buf []byte
+	for i := s.chunkOf(start); i < len(s.starts) && s.starts[i] < end; i++ {
+		if s.opened[i] {
+			continue
+		}
+		chunk := private[s.starts[i]:s.chunkEnd(i)]
+		buf = append(append(buf[:0], chunk...), s.tags[tagSize*i:tagSize*(i+1)]...)
+		if _, err := s.gcm.Open(chunk[:0], chunkNonce(nonce, s.nonce, i), buf, s.aad); err != nil {
+			return fmt.Errorf("failed to decrypt private chunk %d: %w", i, err)
+		}
+		s.opened[i] = true
+		s.sealed--
+	}
+	return nil
+}
+
+// OpenField decrypts the payload of a field of the message, whose schema is m. Public
+// fields are always decrypted, and fields without payload need nothing more than the table.
+// Interned fields also open the string dictionary of the segment.
+func (s *SealedMessage) OpenField(m *schema.Message, name string) error {
+	if f := m.FieldByName(name); f == nil {
+		return fmt.Errorf("%s has no field %s", m.FullName, name)
+	} else if f.Public || s.offsetToPrivate == len(s.Data) {
+		return nil
+	}
+	private := s.Data[s.offsetToPrivate:]
+	offset, dict, ok, err := m.PrivatePayload(private, name)
+	if err != nil || !ok {
+		return err
+	}
+	if dict > 0 && dict < len(private) {
+		if err := s.Open(dict, dict+1); err != nil {
+			return err
+		}
+	}
+	if offset >= len(private) {
+		return fmt.Errorf("field %s: payload offset %d out of range", name, offset)
+	}
+	return s.Open(offset, offset+1)
+}
+
+// OpenAll decrypts every private chunk that is not decrypted yet
+func (s *SealedMessage) OpenAll() error {
+	if s.sealed == 0 {
+		return nil
+	}
+	return s.Open(0, len(s.Data)-s.offsetToPrivate)
+}
+
+// chunkOf returns the index of the chunk holding the byte at offset of the private segment
+func (s *SealedMessage) chunkOf(offset int) int {
+	i := 0
+	for i+1 < len(s.starts) && s.starts[i+1] <= offset {
+		i++
+	}
+	return i
+}
+
+// chunkEnd returns where chunk i ends in the private segment
+func (s *SealedMessage) chunkEnd(i int) int {
+	if i+1 < len(s.starts) {
+		return s.starts[i+1]
+	}
+	return len(s.Data) - s.offsetToPrivate
+}
+
+// chunkNonce writes the nonce of chunk i, derived from the base nonce, to nonce
+func chunkNonce(nonce, base []byte, i int) []byte {
+	copy(nonce, base)
+	binary.BigEndian.PutUint32(nonce[8:], binary.BigEndian.Uint32(base[8:])^uint32(i))
+	return nonce
+}
+
+// SetChunkedEncryption makes the transport encrypt private segments in chunks aligned to
+// the payloads of their fields (see EncryptChunkedSymphonyData), found with the schemas of
+// registry by the service and method IDs of the messages. Messages of methods the registry
+// does not know are encrypted as one chunk. Peers must agree on the setting, as they do on
+// the keys. nil restores the encryption of private segments as a whole.
+func (t *UDPTransport) SetChunkedEncryption(registry *schema.Registry) {
+	t.chunkRegistry = registry
+	if registry == nil {
+		t.lazyDecryption = false
+	}
+}
+
+// SetLazyDecryption makes a transport with chunked encryption leave the private segments
+// of received requests encrypted, except for their tables. The payloads of fields are
+// decrypted when opened through the SealedMessage of the request (see TakeSealedMessage),
+// so handlers that read few fields of large requests through the Raw accessors of their
+// messages skip the decryption of the others. Responses are always decrypted.
+func (t *UDPTransport) SetLazyDecryption(enabled bool) error {
+	if enabled && (!t.encryptionEnabled || t.chunkRegistry == nil) {
+		return errors.New("lazy decryption requires encryption and chunked encryption to be enabled")
+	}
+	t.lazyDecryption = enabled
+	return nil
+}
+
+// TakeSealedMessage returns and forgets the sealed message of a request received with lazy
+// decryption enabled. Its Data is the payload Receive returned. Servers should call it for
+// every request returned by Receive so that messages do not accumulate.
+func (t *UDPTransport) TakeSealedMessage(rpcID uint64) (*SealedMessage, bool) {
+	t.sealedMu.Lock()
+	defer t.sealedMu.Unlock()
+
+	sealed, ok := t.sealed[rpcID]
+	if ok {
+		delete(t.sealed, rpcID)
+	}
+	return sealed, ok
+}
+
+// privateBoundaries returns the chunk boundaries of the private segment of data, a message
+// of the given packet type, or nil if its schema is unknown
+func (t *UDPTransport) privateBoundaries(data []byte, packetType packet.PacketType) []int {
+	if len(data) < 13 {
+		return nil
+	}
+	offsetToPrivate := int(binary.LittleEndian.Uint32(data[1:5]))
+	if offsetToPrivate >= len(data) {
+		return nil
+	}
+	method, ok := t.chunkRegistry.Method(binary.LittleEndian.Uint32(data[5:9]), binary.LittleEndian.Uint32(data[9:13]))
+	if !ok {
+		return nil
+	}
+	name := method.Request
+	if packetType == packet.PacketTypeResponse {
+		name = method.Response
+	}
+	m, ok := t.chunkRegistry.Message(name)
+	if !ok {
+		return nil
+	}
+	boundaries, err := m.PrivateBoundaries(data[offsetToPrivate:])
+	if err != nil {
+		return nil
+	}
+	return boundaries
+}
@@ -69,6 +69,19 @@ func InitGCMObjects(publicKey, privateKey []byte) error {
 	return nil
 }
 
+// InitDefaultGCMObjects initializes the cached GCM objects with the default keys, unless
+// they were initialized already. Receivers without encryption enabled need them to decrypt
+// the messages of calls made with EncryptionRequired.
+func InitDefaultGCMObjects() error {
+	gcmInitMu.RLock()
+	initialized := publicGCM != nil && privateGCM != nil
+	gcmInitMu.RUnlock()
+	if initialized {
+		return nil
+	}
+	return InitGCMObjects(DefaultPublicKey, DefaultPrivateKey)
+}
+
 // EncryptSymphonyData encrypts Symphony marshaled data using AES-GCM.
 // The public segment (bytes 13 to offsetToPrivate) is encrypted with publicKey.
 // The private segment (bytes offsetToPrivate onwards, including version byte) is encrypted with privateKey.
@@ -5,8 +5,12 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/schema"
 )
 
 // --- Test Helpers ---
@@ -419,6 +423,199 @@ func TestDecryptSymphonyData_Panics(t *testing.T) {
 	})
 }
 
+// --- Chunked Encryption Tests ---
+
+// newChunkedTestMessage returns a registry knowing method 2 of service 1, whose requests and
+// responses are test.Blob messages, and the encoding of such a message with large private
+// fields
+func newChunkedTestMessage(t *testing.T) (*schema.Registry, *schema.Message, []byte) {
+	t.Helper()
+	m := &schema.Message{FullName: "test.Blob", Fields: []schema.Field{
+		{Number: 1, Name: "id", Kind: schema.KindInt64, Public: true},
+		{Number: 2, Name: "note", Kind: schema.KindString},
+		{Number: 3, Name: "blob", Kind: schema.KindBytes},
+		{Number: 4, Name: "tags", Kind: schema.KindString, Repeated: true},
+	}}
+	r := schema.NewRegistry()
+	r.RegisterMessage(m)
+	r.RegisterMethod(&schema.MethodSchema{ServiceID: 1, MethodID: 2, Request: m.FullName, Response: m.FullName})
+
+	data, err := r.Encode(&schema.DynamicMessage{Schema: m, Fields: map[int32]any{
+		1: int64(42),
+		2: strings.Repeat("n", 100),
+		3: bytes.Repeat([]byte{0xAB}, 4000),
+		4: []any{"a", "b"},
+	}})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	binary.LittleEndian.PutUint32(data[5:9], 1)
+	binary.LittleEndian.PutUint32(data[9:13], 2)
+	return r, m, data
+}
+
+func TestChunkedSymphonyData(t *testing.T) {
+	if err := InitGCMObjects(DefaultPublicKey, DefaultPrivateKey); err != nil {
+		t.Fatalf("Failed to init GCM objects: %v", err)
+	}
+	r, m, original := newChunkedTestMessage(t)
+	offsetToPrivate := int(binary.LittleEndian.Uint32(original[1:5]))
+	boundaries, err := m.PrivateBoundaries(original[offsetToPrivate:])
+	if err != nil {
+		t.Fatalf("PrivateBoundaries failed: %v", err)
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		for _, b := range [][]int{boundaries, nil} {
+			encrypted := EncryptChunkedSymphonyData(original, DefaultPublicKey, DefaultPrivateKey, b)
+			if bytes.Contains(encrypted, bytes.Repeat([]byte{0xAB}, 64)) {
+				t.Error("Expected the private segment to be encrypted")
+			}
+			if decrypted := DecryptChunkedSymphonyData(encrypted, DefaultPublicKey, DefaultPrivateKey); !bytes.Equal(decrypted, original) {
+				t.Errorf("Round trip with boundaries %v changed the data", b)
+			}
+		}
+
+		publicOnly := original[:offsetToPrivate]
+		encrypted := EncryptChunkedSymphonyData(publicOnly, DefaultPublicKey, DefaultPrivateKey, nil)
+		if decrypted := DecryptChunkedSymphonyData(encrypted, DefaultPublicKey, nil); !bytes.Equal(decrypted, publicOnly) {
+			t.Error("Round trip of a public-only message changed the data")
+		}
+	})
+
+	t.Run("OpenField", func(t *testing.T) {
+		encrypted := EncryptChunkedSymphonyData(original, DefaultPublicKey, DefaultPrivateKey, boundaries)
+		sealed, err := OpenChunkedSymphonyData(encrypted, DefaultPublicKey, DefaultPrivateKey)
+		if err != nil {
+			t.Fatalf("OpenChunkedSymphonyData failed: %v", err)
+		}
+		// The table and the note share a chunk, which is opened with the table
+		if sealed.Sealed() != 2 {
+			t.Fatalf("Expected the blob and tags chunks to be sealed, got %d sealed chunks", sealed.Sealed())
+		}
+		if err := sealed.OpenField(m, "id"); err != nil || sealed.Sealed() != 2 {
+			t.Errorf("OpenField(id) = %v with %d sealed chunks, want nothing to open", err, sealed.Sealed())
+		}
+		d, err := r.Decode(sealed.Data[:offsetToPrivate], m.FullName)
+		if err != nil {
+			t.Fatalf("Decode of the public segment failed: %v", err)
+		}
+		if v, _ := d.Get("id"); v != int64(42) {
+			t.Errorf("id: unexpected %v", v)
+		}
+
+		if err := sealed.OpenField(m, "tags"); err != nil || sealed.Sealed() != 1 {
+			t.Fatalf("OpenField(tags) = %v with %d sealed chunks, want 1", err, sealed.Sealed())
+		}
+		tags, _, _, _ := m.PrivatePayload(sealed.Data[offsetToPrivate:], "tags")
+		if start := offsetToPrivate + tags; !bytes.Equal(sealed.Data[start:], original[start:]) {
+			t.Error("Expected the tags to be decrypted in place")
+		}
+		if bytes.Equal(sealed.Data, original) {
+			t.Error("Expected the blob to stay encrypted")
+		}
+		if err := sealed.OpenField(m, "missing"); err == nil {
+			t.Error("Expected an error for an unknown field")
+		}
+
+		if err := sealed.OpenAll(); err != nil || sealed.Sealed() != 0 {
+			t.Fatalf("OpenAll = %v with %d sealed chunks", err, sealed.Sealed())
+		}
+		if !bytes.Equal(sealed.Data, original) {
+			t.Error("Expected OpenAll to restore the original data")
+		}
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		encrypted := EncryptChunkedSymphonyData(original, DefaultPublicKey, DefaultPrivateKey, boundaries)
+		encrypted[len(encrypted)-1] ^= 0xFF // in the tags chunk
+		sealed, err := OpenChunkedSymphonyData(encrypted, DefaultPublicKey, DefaultPrivateKey)
+		if err != nil {
+			t.Fatalf("OpenChunkedSymphonyData failed: %v", err)
+		}
+		if err := sealed.OpenField(m, "blob"); err != nil {
+			t.Errorf("Expected the blob to open despite the tampered tags, got %v", err)
+		}
+		if err := sealed.OpenField(m, "tags"); err == nil {
+			t.Error("Expected the tampered tags to fail authentication")
+		}
+		assertPanic(t, "TamperedDecrypt", "failed to decrypt private chunk", func() {
+			DecryptChunkedSymphonyData(encrypted, DefaultPublicKey, DefaultPrivateKey)
+		})
+
+		// The directory is authenticated by every chunk
+		encrypted = EncryptChunkedSymphonyData(original, DefaultPublicKey, DefaultPrivateKey, boundaries)
+		encrypted[binary.LittleEndian.Uint32(encrypted[1:5])] ^= 0x01 // nonce
+		if _, err := OpenChunkedSymphonyData(encrypted, DefaultPublicKey, DefaultPrivateKey); err == nil {
+			t.Error("Expected a tampered directory to fail authentication")
+		}
+	})
+}
+
+func TestUDPTransport_LazyDecryption(t *testing.T) {
+	r, m, original := newChunkedTestMessage(t)
+	server, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create server transport: %v", err)
+	}
+	defer server.Close()
+	client, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create client transport: %v", err)
+	}
+	defer client.Close()
+
+	if err := server.SetLazyDecryption(true); err == nil {
+		t.Error("Expected lazy decryption to require chunked encryption")
+	}
+	for _, tr := range []*UDPTransport{server, client} {
+		tr.EnableEncryption()
+		tr.SetChunkedEncryption(r)
+	}
+	if err := server.SetLazyDecryption(true); err != nil {
+		t.Fatalf("SetLazyDecryption failed: %v", err)
+	}
+
+	if err := client.Send(server.LocalAddr().String(), 1, original, packet.PacketTypeRequest); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	var data []byte
+	for data == nil {
+		if data, _, _, _, err = server.Receive(packet.MaxUDPPayloadSize, RoleServer); err != nil {
+			t.Fatalf("Receive failed: %v", err)
+		}
+	}
+	sealed, ok := server.TakeSealedMessage(1)
+	if !ok || !bytes.Equal(sealed.Data, data) {
+		t.Fatal("Expected the sealed message of the request")
+	}
+	if _, ok := server.TakeSealedMessage(1); ok {
+		t.Error("Expected the sealed message to be forgotten once taken")
+	}
+	if sealed.Sealed() == 0 {
+		t.Error("Expected the private payloads to stay encrypted")
+	}
+	if err := sealed.OpenField(m, "blob"); err != nil {
+		t.Fatalf("OpenField(blob) failed: %v", err)
+	}
+	if err := sealed.OpenAll(); err != nil || !bytes.Equal(data, original) {
+		t.Errorf("Expected the opened request to equal the sent one (%v)", err)
+	}
+
+	// Responses are decrypted as a whole
+	if err := server.Send(client.LocalAddr().String(), 1, original, packet.PacketTypeResponse); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	for data = nil; data == nil; {
+		if data, _, _, _, err = client.Receive(packet.MaxUDPPayloadSize, RoleClient); err != nil {
+			t.Fatalf("Receive failed: %v", err)
+		}
+	}
+	if !bytes.Equal(data, original) {
+		t.Error("Expected the response to be decrypted")
+	}
+}
+
 // --- Concurrent Access Tests ---
 
 func TestEncryptDecrypt_Concurrent(t *testing.T) {
@@ -0,0 +1,182 @@
+package transport
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/packet"
+	"go.uber.org/zap"
+)
+
+// FaultInjector decides the fate of the datagrams a transport writes, so that tests can
+// exercise retransmission and retry logic deterministically, without lossy links
+// (see SetFaultInjector)
+type FaultInjector interface {
+	// Inject is called before every attempt to write a datagram. It may modify d.Data to
+	// corrupt the datagram.
+	Inject(d *Datagram) Fault
+}
+
+// Datagram is a datagram about to be written, as seen by a FaultInjector
+type Datagram struct {
+	// Index counts the write attempts since the injector was set, from 0. Attempts retried
+	// after a transient error count again.
+	Index        int
+	Dst          *net.UDPAddr
+	RPCID        uint64
+	PacketTypeID packet.PacketTypeID
+	// Seq and FragmentIndex locate the fragment of a data packet in its message; 0 for
+	// other packets
+	Seq           uint16
+	FragmentIndex uint8
+	Data          []byte
+}
+
+// Fault is what happens to a datagram; the zero Fault writes it
+type Fault struct {
+	// Err fails the write with Err without writing the datagram
+	Err error
+	// Drop reports a successful write without writing the datagram
+	Drop bool
+	// Delay reports a successful write, and writes the datagram after Delay
+	Delay time.Duration
+}
+
+// SetFaultInjector makes injector decide the fate of every datagram the transport writes,
+// including those written with WriteDatagram. nil removes the injector. Meant for tests only.
+func (t *UDPTransport) SetFaultInjector(injector FaultInjector) {
+	t.faultsMu.Lock()
+	defer t.faultsMu.Unlock()
+	t.faults = injector
+	t.faultIndex = 0
+}
+
+// write makes a single attempt at writing a datagram from conn, through the fault injector
+func (t *UDPTransport) write(conn *net.UDPConn, data []byte, addr *net.UDPAddr, rpcID uint64) error {
+	t.faultsMu.Lock()
+	injector := t.faults
+	if injector == nil {
+		t.faultsMu.Unlock()
+		_, err := conn.WriteToUDP(data, addr)
+		return err
+	}
+	d := &Datagram{Index: t.faultIndex, Dst: addr, RPCID: rpcID, Data: data}
+	t.faultIndex++
+	t.faultsMu.Unlock()
+
+	if len(data) > 0 {
+		d.PacketTypeID = packet.PacketTypeID(data[0])
+	}
+	if (d.PacketTypeID == packet.PacketTypeRequest.TypeID || d.PacketTypeID == packet.PacketTypeResponse.TypeID) && len(data) >= packet.DataPacketHeaderSize {
+		d.Seq = binary.LittleEndian.Uint16(data[11:13])
+		d.FragmentIndex = data[14]
+	}
+
+	fault := injector.Inject(d)
+	switch {
+	case fault.Err != nil:
+		logging.Debug("Injected send error", zap.Int("index", d.Index), zap.Uint64("rpcID", rpcID), zap.Error(fault.Err))
+		return fault.Err
+	case fault.Drop:
+		logging.Debug("Injected datagram drop", zap.Int("index", d.Index), zap.Uint64("rpcID", rpcID))
+		return nil
+	case fault.Delay > 0:
+		// The caller returns data to its pool once the write returns
+		delayed := append([]byte(nil), d.Data...)
+		time.AfterFunc(fault.Delay, func() {
+			if _, err := conn.WriteToUDP(delayed, addr); err != nil {
+				logging.Debug("Failed to write delayed datagram", zap.Uint64("rpcID", rpcID), zap.Error(err))
+			}
+		})
+		return nil
+	}
+	_, err := conn.WriteToUDP(d.Data, addr)
+	return err
+}
+
+// WriteDatagram writes an already serialized packet as a single datagram, without running
+// handlers, fragmenting or encrypting it. Handlers sending their own control packets, such
+// as ACKs, or retransmitting stored fragments use it so that those writes are counted (see
+// Stats) and subject to the fault injector.
+func (t *UDPTransport) WriteDatagram(data []byte, addr *net.UDPAddr, rpcID uint64) error {
+	return t.writeDatagram(data, addr, rpcID)
+}
+
+// FaultScript is a FaultInjector applying rules in the order they were added. The first
+// rule matching a datagram decides its fault; datagrams no rule matches are written.
+type FaultScript struct {
+	mu    sync.Mutex
+	rules []*faultRule
+}
+
+// faultRule applies fault to up to times datagrams matching match (times < 0: all of them)
+type faultRule struct {
+	match func(d *Datagram) bool
+	fault func(d *Datagram) Fault
+	times int
+}
+
+// NewFaultScript creates a fault script without rules
+func NewFaultScript() *FaultScript {
+	return &FaultScript{}
+}
+
+func (s *FaultScript) add(times int, match func(d *Datagram) bool, fault func(d *Datagram) Fault) *FaultScript {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, &faultRule{match: match, fault: fault, times: times})
+	return s
+}
+
+// FailWrite fails the write attempt of index n (see Datagram.Index) with err
+func (s *FaultScript) FailWrite(n int, err error) *FaultScript {
+	return s.add(1, func(d *Datagram) bool { return d.Index == n }, func(*Datagram) Fault { return Fault{Err: err} })
+}
+
+// DropWrite drops the datagram of the write attempt of index n
+func (s *FaultScript) DropWrite(n int) *FaultScript {
+	return s.add(1, func(d *Datagram) bool { return d.Index == n }, func(*Datagram) Fault { return Fault{Drop: true} })
+}
+
+// CorruptFragment flips the bits of the last byte of the next datagram carrying a fragment
+// of a request or response. Retransmissions of the fragment are written intact.
+func (s *FaultScript) CorruptFragment(rpcID uint64, seq uint16, fragmentIndex uint8) *FaultScript {
+	return s.add(1, func(d *Datagram) bool {
+		return d.RPCID == rpcID && d.Seq == seq && d.FragmentIndex == fragmentIndex &&
+			(d.PacketTypeID == packet.PacketTypeRequest.TypeID || d.PacketTypeID == packet.PacketTypeResponse.TypeID)
+	}, func(d *Datagram) Fault {
+		d.Data[len(d.Data)-1] ^= 0xFF
+		return Fault{}
+	})
+}
+
+// DelayPackets delays every datagram of a packet type, e.g. the ACKs of the reliable
+// transport handlers
+func (s *FaultScript) DelayPackets(typeID packet.PacketTypeID, delay time.Duration) *FaultScript {
+	return s.add(-1, func(d *Datagram) bool { return d.PacketTypeID == typeID }, func(*Datagram) Fault { return Fault{Delay: delay} })
+}
+
+// Match applies fault to up to times datagrams for which match returns true (all of them
+// if times < 0), for faults the other rules do not cover
+func (s *FaultScript) Match(times int, match func(d *Datagram) bool, fault Fault) *FaultScript {
+	return s.add(times, match, func(*Datagram) Fault { return fault })
+}
+
+// Inject implements FaultInjector
+func (s *FaultScript) Inject(d *Datagram) Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.rules {
+		if r.times == 0 || !r.match(d) {
+			continue
+		}
+		if r.times > 0 {
+			r.times--
+		}
+		return r.fault(d)
+	}
+	return Fault{}
+}
@@ -0,0 +1,127 @@
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+)
+
+// newFaultPair creates a client and a server transport on loopback
+func newFaultPair(t *testing.T) (*UDPTransport, *UDPTransport) {
+	t.Helper()
+	server, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create server transport: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	client, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create client transport: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+// publicPayload returns a public-only Symphony message of size bytes
+func publicPayload(size int) []byte {
+	payload := make([]byte, size)
+	payload[0] = 0x01
+	binary.LittleEndian.PutUint32(payload[1:5], uint32(size))
+	for i := 5; i < size; i++ {
+		payload[i] = byte(i)
+	}
+	return payload
+}
+
+// receiveMessage receives datagrams until a message is complete
+func receiveMessage(t *testing.T, server *UDPTransport) []byte {
+	t.Helper()
+	server.GetConn().SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		data, _, _, _, err := server.Receive(packet.MaxUDPPayloadSize, RoleServer)
+		if err != nil {
+			t.Fatalf("Receive failed: %v", err)
+		}
+		if data != nil {
+			return data
+		}
+	}
+}
+
+func TestFaultScript_FailWrite(t *testing.T) {
+	client, server := newFaultPair(t)
+	addr := server.LocalAddr().String()
+	payload := publicPayload(3000)
+
+	// A transient error is retried by the transport, a permanent one fails the send
+	client.SetFaultInjector(NewFaultScript().FailWrite(0, syscall.ENOBUFS).FailWrite(4, syscall.EPERM))
+	sent, err := client.SendWithFragmentCount(addr, 1, payload, packet.PacketTypeRequest)
+	if err != nil || sent != 3 {
+		t.Fatalf("Expected the retried message to be sent in 3 datagrams, got %d: %v", sent, err)
+	}
+	if retransmits := client.Stats().Retransmits; retransmits != 1 {
+		t.Errorf("Expected 1 retransmit, got %d", retransmits)
+	}
+	receiveMessage(t, server)
+
+	_, err = client.SendWithFragmentCount(addr, 2, payload, packet.PacketTypeRequest)
+	var sendErr *SendError
+	if !errors.As(err, &sendErr) || !errors.Is(err, syscall.EPERM) || sendErr.Seq != 0 {
+		t.Fatalf("Expected a SendError wrapping EPERM for the first packet, got %v", err)
+	}
+	if err := client.Send(addr, 3, payload, packet.PacketTypeRequest); err != nil {
+		t.Fatalf("Expected later sends to succeed, got %v", err)
+	}
+	receiveMessage(t, server)
+}
+
+func TestFaultScript_CorruptAndDrop(t *testing.T) {
+	client, server := newFaultPair(t)
+	addr := server.LocalAddr().String()
+	payload := publicPayload(3000)
+
+	client.SetFaultInjector(NewFaultScript().CorruptFragment(1, 2, 0))
+	if err := client.Send(addr, 1, payload, packet.PacketTypeRequest); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	data := receiveMessage(t, server)
+	if len(data) != len(payload) || data[len(data)-1] != ^payload[len(payload)-1] || data[len(data)-2] != payload[len(payload)-2] {
+		t.Errorf("Expected only the last byte of the message to be corrupted")
+	}
+
+	// Without its second fragment, the message is never complete
+	client.SetFaultInjector(NewFaultScript().DropWrite(1))
+	if err := client.Send(addr, 2, payload, packet.PacketTypeRequest); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	for range 2 {
+		if data, _, _, _, err := server.Receive(packet.MaxUDPPayloadSize, RoleServer); err != nil || data != nil {
+			t.Fatalf("Expected only incomplete fragments, got %d bytes: %v", len(data), err)
+		}
+	}
+	if pending := server.Stats().PendingReassemblies; pending != 1 {
+		t.Errorf("Expected 1 pending reassembly, got %d", pending)
+	}
+}
+
+func TestFaultScript_DelayPackets(t *testing.T) {
+	client, server := newFaultPair(t)
+	const delay = 100 * time.Millisecond
+	client.SetFaultInjector(NewFaultScript().DelayPackets(packet.PacketTypeRequest.TypeID, delay))
+
+	start := time.Now()
+	if err := client.Send(server.LocalAddr().String(), 1, publicPayload(100), packet.PacketTypeRequest); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= delay {
+		t.Errorf("Expected Send to return before the delay, took %v", elapsed)
+	}
+	receiveMessage(t, server)
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("Expected the request after %v, got it after %v", delay, elapsed)
+	}
+}
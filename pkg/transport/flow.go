@@ -0,0 +1,66 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/appnet-org/arpc/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// MaxFlowPorts is the largest number of flow ports SetFlowPorts accepts
+const MaxFlowPorts = 256
+
+// SetFlowPorts makes the transport send the packets of each RPC from one of n additional
+// sockets, picked by RPC ID. L4 load balancers in front of proxy replicas hash the UDP
+// 4-tuple, so all fragments of an RPC reach the same replica while different RPCs spread
+// over the replicas. The sockets are bound to the IP of the transport on ports chosen by the
+// kernel, and only send: packet headers still carry the address of the transport, to which
+// responses are sent. ICMP errors are only reported for packets sent from the transport's own
+// socket. 0 closes the sockets and sends everything from that socket again. It must not be
+// called concurrently with Send.
+func (t *UDPTransport) SetFlowPorts(n int) error {
+	if n < 0 || n > MaxFlowPorts {
+		return fmt.Errorf("flow ports must be between 0 and %d, got %d", MaxFlowPorts, n)
+	}
+	conns := make([]*net.UDPConn, 0, n)
+	for range n {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: t.LocalAddr().IP})
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return fmt.Errorf("failed to open flow port: %w", err)
+		}
+		if err := conn.SetWriteBuffer(socketBufferSize); err != nil {
+			logging.Warn("Failed to set UDP write buffer size", zap.Error(err))
+		}
+		conns = append(conns, conn)
+	}
+	t.closeFlowPorts()
+	t.flowConns = conns
+	return nil
+}
+
+// FlowPort returns the local port the packets of an RPC are sent from
+func (t *UDPTransport) FlowPort(rpcID uint64) int {
+	return t.sendConn(rpcID).LocalAddr().(*net.UDPAddr).Port
+}
+
+// sendConn returns the socket the packets of an RPC are sent from. RPC IDs are often
+// timestamps, so they are mixed (Fibonacci hashing) before picking the socket.
+func (t *UDPTransport) sendConn(rpcID uint64) *net.UDPConn {
+	if len(t.flowConns) == 0 {
+		return t.conn
+	}
+	h := rpcID * 0x9E3779B97F4A7C15
+	return t.flowConns[(h>>32)%uint64(len(t.flowConns))]
+}
+
+// closeFlowPorts closes the sockets opened by SetFlowPorts
+func (t *UDPTransport) closeFlowPorts() {
+	for _, conn := range t.flowConns {
+		conn.Close()
+	}
+	t.flowConns = nil
+}
@@ -31,6 +31,13 @@ type DataReassembler struct {
 	mu         sync.Mutex
 }
 
+// pending returns the number of messages waiting for more fragments
+func (r *DataReassembler) pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.incoming)
+}
+
 // NewDataReassembler creates a new data reassembler
 func NewDataReassembler() *DataReassembler {
 	return &DataReassembler{
@@ -194,8 +201,7 @@ func (r *DataReassembler) FragmentData(data []byte, rpcID uint64, packetType pro
 		return packets, nil
 	}
 	// Calculate chunk size by subtracting header overhead from max UDP payload
-	// New header size: 1+8+2+2+1+1+4+2+4+2+4 = 31 bytes
-	chunkSize := protocol.MaxUDPPayloadSize - 31
+	chunkSize := protocol.MaxUDPPayloadSize - protocol.DataPacketHeaderSize
 	totalPackets := uint16((len(data) + chunkSize - 1) / chunkSize)
 	var packets []any
 
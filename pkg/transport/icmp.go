@@ -0,0 +1,175 @@
+package transport
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/packet"
+	"go.uber.org/zap"
+)
+
+// ICMP types and codes of the errors reported for UDP flows
+const (
+	icmpDestUnreachable     = 3
+	icmpCodeNetUnreachable  = 0
+	icmpCodeHostUnreachable = 1
+	icmpCodePortUnreachable = 3
+	icmpCodeFragNeeded      = 4
+)
+
+// UnavailableErrorPrefix starts the message of the error packets proxies send back for
+// requests whose destination reported an ICMP unreachable error
+const UnavailableErrorPrefix = "unavailable: "
+
+// ipUDPHeaderSize is the size of the IPv4 and UDP headers, without options
+const ipUDPHeaderSize = 28
+
+// ICMPError is an error the kernel reported for a datagram sent from a socket with ICMP
+// error reporting enabled (see EnableICMPErrors): an ICMP destination-unreachable message,
+// or a local error such as a datagram exceeding the path MTU.
+type ICMPError struct {
+	Dst      *net.UDPAddr // destination of the datagram that caused the error
+	Offender net.IP       // host or router that reported the error (nil for local errors)
+	Errno    syscall.Errno
+	Type     uint8 // ICMP type (0 for local errors)
+	Code     uint8 // ICMP code
+	MTU      int   // path MTU for fragmentation-needed errors, 0 otherwise
+	// Quoted is the start of the datagram as quoted by the ICMP message. It usually holds
+	// the packet header, but routers may quote as little as the UDP header, leaving it empty.
+	Quoted []byte
+}
+
+func (e *ICMPError) Error() string {
+	if e.FragmentationNeeded() {
+		return fmt.Sprintf("datagram to %v exceeds path MTU %d", e.Dst, e.MTU)
+	}
+	if e.Offender != nil {
+		return fmt.Sprintf("%v: %v (reported by %v)", e.Dst, e.Errno, e.Offender)
+	}
+	return fmt.Sprintf("%v: %v", e.Dst, e.Errno)
+}
+
+// Unwrap returns the errno, so that errors.Is(err, syscall.ECONNREFUSED) works
+func (e *ICMPError) Unwrap() error {
+	return e.Errno
+}
+
+// Unreachable reports whether the destination is unreachable, i.e. no response will come
+func (e *ICMPError) Unreachable() bool {
+	if e.Type == icmpDestUnreachable {
+		switch e.Code {
+		case icmpCodeNetUnreachable, icmpCodeHostUnreachable, icmpCodePortUnreachable:
+			return true
+		}
+	}
+	switch e.Errno {
+	case syscall.ECONNREFUSED, syscall.EHOSTUNREACH, syscall.ENETUNREACH:
+		return true
+	}
+	return false
+}
+
+// FragmentationNeeded reports whether the datagram was dropped because it exceeds the path MTU
+func (e *ICMPError) FragmentationNeeded() bool {
+	return (e.Type == icmpDestUnreachable && e.Code == icmpCodeFragNeeded) || e.Errno == syscall.EMSGSIZE
+}
+
+// QuotedHeader returns the RPC ID, packet type and header addresses of the quoted datagram.
+// ok is false if the quote is too short to hold a packet header.
+func (e *ICMPError) QuotedHeader() (rpcID uint64, packetTypeID packet.PacketTypeID, dstIP [4]byte, dstPort uint16, srcIP [4]byte, srcPort uint16, ok bool) {
+	q := e.Quoted
+	if len(q) < 1 {
+		return 0, 0, dstIP, 0, srcIP, 0, false
+	}
+	packetTypeID = packet.PacketTypeID(q[0])
+	switch packetTypeID {
+	case packet.PacketTypeRequest.TypeID, packet.PacketTypeResponse.TypeID:
+		// Data packet: [type][rpcID(8)][total(2)][seq(2)][flags][fragIndex][dstIP(4)][dstPort(2)][srcIP(4)][srcPort(2)]
+		if len(q) < 27 {
+			return 0, 0, dstIP, 0, srcIP, 0, false
+		}
+		copy(dstIP[:], q[15:19])
+		copy(srcIP[:], q[21:25])
+		return binary.LittleEndian.Uint64(q[1:9]), packetTypeID, dstIP, binary.LittleEndian.Uint16(q[19:21]), srcIP, binary.LittleEndian.Uint16(q[25:27]), true
+	default:
+		// Other packets start with [type][rpcID(8)]
+		if len(q) < 9 {
+			return 0, 0, dstIP, 0, srcIP, 0, false
+		}
+		return binary.LittleEndian.Uint64(q[1:9]), packetTypeID, dstIP, 0, srcIP, 0, true
+	}
+}
+
+// minPathMTU is the smallest MTU every IPv4 host accepts; learned MTUs are never lower
+const minPathMTU = 576
+
+// EnableICMPErrors makes the transport harvest the ICMP errors of its datagrams: Receive
+// returns port- and host-unreachable errors for the RPC of the datagram instead of leaving
+// the caller to time out, and fragmentation-needed errors lower the fragment size used for
+// the destination. It requires Linux.
+func (t *UDPTransport) EnableICMPErrors() error {
+	if err := EnableICMPErrors(t.conn); err != nil {
+		return err
+	}
+	t.icmpEnabled = true
+	return nil
+}
+
+// PathMTU returns the path MTU learned for a destination, or 0 if none was reported
+func (t *UDPTransport) PathMTU(addr *net.UDPAddr) int {
+	if mtu, ok := t.pathMTUs.Load(addr.String()); ok {
+		return mtu.(int)
+	}
+	return 0
+}
+
+// maxDatagramSize returns the largest UDP payload to send to addr
+func (t *UDPTransport) maxDatagramSize(addr *net.UDPAddr) int {
+	if mtu := t.PathMTU(addr); mtu > 0 && mtu-ipUDPHeaderSize < packet.MaxUDPPayloadSize {
+		return mtu - ipUDPHeaderSize
+	}
+	return packet.MaxUDPPayloadSize
+}
+
+// harvestICMPErrors drains the socket's error queue, records path MTUs, and keeps the
+// errors that can be attributed to an RPC for Receive
+func (t *UDPTransport) harvestICMPErrors() {
+	icmpErrors, err := ReadICMPErrors(t.conn)
+	if err != nil {
+		logging.Debug("Failed to read socket error queue", zap.Error(err))
+	}
+
+	t.icmpMu.Lock()
+	defer t.icmpMu.Unlock()
+	for _, icmpErr := range icmpErrors {
+		if icmpErr.FragmentationNeeded() && icmpErr.MTU > 0 && icmpErr.Dst != nil {
+			t.pathMTUs.Store(icmpErr.Dst.String(), max(icmpErr.MTU, minPathMTU))
+			logging.Debug("Lowered path MTU", zap.String("dst", icmpErr.Dst.String()), zap.Int("mtu", icmpErr.MTU))
+		}
+		if icmpErr.Type == 0 {
+			// Local errors were already returned by the send that caused them
+			continue
+		}
+		if _, _, _, _, _, _, ok := icmpErr.QuotedHeader(); !ok {
+			logging.Debug("Ignoring ICMP error without quoted packet header", zap.Error(icmpErr))
+			continue
+		}
+		t.icmpPending = append(t.icmpPending, icmpErr)
+	}
+}
+
+// nextICMPError returns the next harvested error and the RPC ID of its datagram, if any
+func (t *UDPTransport) nextICMPError() (*ICMPError, uint64) {
+	t.icmpMu.Lock()
+	defer t.icmpMu.Unlock()
+	if len(t.icmpPending) == 0 {
+		return nil, 0
+	}
+	icmpErr := t.icmpPending[0]
+	t.icmpPending = t.icmpPending[1:]
+	rpcID, _, _, _, _, _, _ := icmpErr.QuotedHeader()
+	return icmpErr, rpcID
+}
@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// Origins of extended socket errors (linux/errqueue.h)
+const (
+	soEEOriginLocal = 1
+	soEEOriginICMP  = 2
+)
+
+// EnableICMPErrors makes the kernel queue ICMP errors (and local send errors) of the
+// datagrams sent from conn, to be read with ReadICMPErrors (IP_RECVERR)
+func EnableICMPErrors(conn *net.UDPConn) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	if err := rc.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_IP, syscall.IP_RECVERR, 1)
+	}); err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// ReadICMPErrors drains the error queue of conn without blocking
+func ReadICMPErrors(conn *net.UDPConn) ([]*ICMPError, error) {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var icmpErrors []*ICMPError
+	buf := make([]byte, 576)
+	oob := make([]byte, 512)
+	for {
+		var n, oobn int
+		var from syscall.Sockaddr
+		var recvErr error
+		if err := rc.Read(func(fd uintptr) bool {
+			n, oobn, _, from, recvErr = syscall.Recvmsg(int(fd), buf, oob, syscall.MSG_ERRQUEUE|syscall.MSG_DONTWAIT)
+			return true
+		}); err != nil {
+			return icmpErrors, err
+		}
+		if errors.Is(recvErr, syscall.EAGAIN) {
+			return icmpErrors, nil
+		}
+		if recvErr != nil {
+			return icmpErrors, recvErr
+		}
+		if icmpErr := parseICMPError(buf[:n], oob[:oobn], from); icmpErr != nil {
+			icmpErrors = append(icmpErrors, icmpErr)
+		}
+	}
+}
+
+// parseICMPError decodes an entry of the error queue: the quoted datagram, the IP_RECVERR
+// control message (struct sock_extended_err followed by the offender address), and the
+// original destination
+func parseICMPError(quoted, oob []byte, from syscall.Sockaddr) *ICMPError {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil
+	}
+	for _, m := range msgs {
+		if m.Header.Level != syscall.SOL_IP || m.Header.Type != syscall.IP_RECVERR || len(m.Data) < 16 {
+			continue
+		}
+		icmpErr := &ICMPError{
+			Errno:  syscall.Errno(binary.NativeEndian.Uint32(m.Data[0:4])),
+			Quoted: append([]byte(nil), quoted...),
+		}
+		origin := m.Data[4]
+		if origin == soEEOriginICMP {
+			icmpErr.Type, icmpErr.Code = m.Data[5], m.Data[6]
+			// The offender is a struct sockaddr_in: family(2) port(2) addr(4)
+			if len(m.Data) >= 24 && binary.NativeEndian.Uint16(m.Data[16:18]) == syscall.AF_INET {
+				icmpErr.Offender = net.IPv4(m.Data[20], m.Data[21], m.Data[22], m.Data[23])
+			}
+		}
+		if origin == soEEOriginICMP || origin == soEEOriginLocal {
+			if icmpErr.FragmentationNeeded() {
+				icmpErr.MTU = int(binary.NativeEndian.Uint32(m.Data[8:12]))
+			}
+		}
+		if sa, ok := from.(*syscall.SockaddrInet4); ok {
+			icmpErr.Dst = &net.UDPAddr{IP: net.IPv4(sa.Addr[0], sa.Addr[1], sa.Addr[2], sa.Addr[3]), Port: sa.Port}
+		}
+		return icmpErr
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+)
+
+func TestReceive_ICMPPortUnreachable(t *testing.T) {
+	tr, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("NewUDPTransport failed: %v", err)
+	}
+	defer tr.Close()
+	if err := tr.EnableICMPErrors(); err != nil {
+		t.Fatalf("EnableICMPErrors failed: %v", err)
+	}
+
+	// Find a port nobody listens on
+	closed, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	addr := closed.LocalAddr().String()
+	closed.Close()
+
+	if err := tr.Send(addr, 42, []byte("hello"), packet.PacketTypeRequest); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	tr.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	data, from, rpcID, _, err := tr.Receive(packet.MaxUDPPayloadSize, RoleClient)
+	var icmpErr *ICMPError
+	if !errors.As(err, &icmpErr) {
+		t.Fatalf("Expected *ICMPError, got data=%v err=%v", data, err)
+	}
+	if rpcID != 42 {
+		t.Errorf("Expected RPC ID 42, got %d", rpcID)
+	}
+	if from == nil || from.String() != addr {
+		t.Errorf("Expected destination %s, got %v", addr, from)
+	}
+	if !icmpErr.Unreachable() {
+		t.Errorf("Expected unreachable error, got %v", icmpErr)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("Expected ECONNREFUSED, got %v", icmpErr.Errno)
+	}
+	if _, packetTypeID, _, dstPort, _, _, ok := icmpErr.QuotedHeader(); !ok || packetTypeID != packet.PacketTypeRequest.TypeID || int(dstPort) != from.Port {
+		t.Errorf("Unexpected quoted header: type=%d dstPort=%d ok=%v", packetTypeID, dstPort, ok)
+	}
+}
+
+func TestParseICMPError_FragmentationNeeded(t *testing.T) {
+	// struct sock_extended_err followed by the offender's struct sockaddr_in
+	data := make([]byte, 32)
+	binary.NativeEndian.PutUint32(data[0:4], uint32(syscall.EMSGSIZE))
+	data[4] = soEEOriginICMP
+	data[5], data[6] = icmpDestUnreachable, icmpCodeFragNeeded
+	binary.NativeEndian.PutUint32(data[8:12], 1200)
+	binary.NativeEndian.PutUint16(data[16:18], syscall.AF_INET)
+	copy(data[20:24], []byte{10, 0, 0, 1})
+
+	oob := make([]byte, syscall.CmsgSpace(len(data)))
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	h.Level, h.Type = syscall.SOL_IP, syscall.IP_RECVERR
+	h.SetLen(syscall.CmsgLen(len(data)))
+	copy(oob[syscall.CmsgLen(0):], data)
+
+	dst := &syscall.SockaddrInet4{Port: 9000, Addr: [4]byte{10, 0, 1, 5}}
+	icmpErr := parseICMPError(nil, oob, dst)
+	if icmpErr == nil {
+		t.Fatal("Expected an error to be parsed")
+	}
+	if !icmpErr.FragmentationNeeded() || icmpErr.MTU != 1200 {
+		t.Errorf("Expected fragmentation needed with MTU 1200, got %v (MTU %d)", icmpErr, icmpErr.MTU)
+	}
+	if icmpErr.Unreachable() {
+		t.Error("Fragmentation needed must not be reported as unreachable")
+	}
+	if !icmpErr.Offender.Equal(net.IPv4(10, 0, 0, 1)) || icmpErr.Dst.String() != "10.0.1.5:9000" {
+		t.Errorf("Unexpected addresses: offender=%v dst=%v", icmpErr.Offender, icmpErr.Dst)
+	}
+
+	// The learned MTU lowers the datagram size for the destination only
+	tr := &UDPTransport{}
+	tr.pathMTUs.Store(icmpErr.Dst.String(), icmpErr.MTU)
+	if got := tr.maxDatagramSize(icmpErr.Dst); got != 1200-ipUDPHeaderSize {
+		t.Errorf("Expected max datagram size %d, got %d", 1200-ipUDPHeaderSize, got)
+	}
+	if got := tr.maxDatagramSize(&net.UDPAddr{IP: net.IPv4(10, 0, 1, 6), Port: 9000}); got != packet.MaxUDPPayloadSize {
+		t.Errorf("Expected default max datagram size, got %d", got)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package transport
+
+import (
+	"errors"
+	"net"
+)
+
+// EnableICMPErrors is only supported on Linux
+func EnableICMPErrors(conn *net.UDPConn) error {
+	return errors.New("ICMP error reporting requires Linux")
+}
+
+// ReadICMPErrors returns no errors where EnableICMPErrors is not supported
+func ReadICMPErrors(conn *net.UDPConn) ([]*ICMPError, error) {
+	return nil, nil
+}
@@ -0,0 +1,612 @@
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/packet"
+	"go.uber.org/zap"
+)
+
+// NATPacketTypeID marks the datagrams of NAT traversal: address discovery and registration
+// with a rendezvous server, and hole punching between peers. It is far above the IDs packet
+// registries give out. Receive handles these datagrams itself and returns no data for them;
+// transports that did not enable NAT traversal (see EnableNATTraversal) drop them.
+const NATPacketTypeID packet.PacketTypeID = 0xFE
+
+// NAT traversal messages are [NATPacketTypeID][kind][transaction ID u64][body]
+const natHeaderSize = 10
+
+// Kinds of NAT traversal messages
+const (
+	natBinding   byte = 1 // client -> rendezvous: which address do you see?
+	natRegister  byte = 2 // peer -> rendezvous: [name][local addr]
+	natConnect   byte = 3 // peer -> rendezvous: [name][peer name][local addr]
+	natAddress   byte = 4 // rendezvous -> client: [addr], answers natBinding and natRegister
+	natIntroduce byte = 5 // rendezvous -> both peers: [peer name][public][local][own public]
+	natError     byte = 6 // rendezvous -> client: [message]
+	natPunch     byte = 7 // peer -> peer
+	natPunchAck  byte = 8 // peer -> peer: [addr the punch came from]
+)
+
+const (
+	// natRetransmit is how often requests to the rendezvous server and punches are repeated
+	natRetransmit = 100 * time.Millisecond
+	// natPunchTimeout is how long an introduced peer punches before falling back to the relay
+	natPunchTimeout = 5 * time.Second
+	// RendezvousTTL is how long a registration is kept; peers register again before it ends,
+	// which also keeps the mapping of their NAT open
+	RendezvousTTL = 60 * time.Second
+	// RendezvousMaxPeers is the most registrations a rendezvous server keeps
+	RendezvousMaxPeers = 65536
+)
+
+// ErrNATTraversalDisabled is returned by the NAT traversal methods of transports that did not
+// enable it with the rendezvous server
+var ErrNATTraversalDisabled = errors.New("NAT traversal not enabled")
+
+// ErrHolePunchFailed is returned by ConnectPeer when no candidate address of the peer
+// answered and no relay was given
+var ErrHolePunchFailed = errors.New("hole punching failed")
+
+// natMessage is a decoded NAT traversal message
+type natMessage struct {
+	kind byte
+	txID uint64
+	from *net.UDPAddr
+
+	name, peer string
+	addrs      []*net.UDPAddr // in the order of the layout of the kind; nil for zero addresses
+	text       string
+}
+
+func appendNATName(b []byte, name string) []byte {
+	return append(append(b, byte(len(name))), name...)
+}
+
+// appendNATAddr appends an IPv4 address and port, or zeros for nil
+func appendNATAddr(b []byte, addr *net.UDPAddr) []byte {
+	var raw [6]byte
+	if addr != nil {
+		copy(raw[:4], addr.IP.To4())
+		binary.LittleEndian.PutUint16(raw[4:], uint16(addr.Port))
+	}
+	return append(b, raw[:]...)
+}
+
+func encodeNAT(kind byte, txID uint64, body ...[]byte) []byte {
+	b := make([]byte, natHeaderSize, 64)
+	b[0], b[1] = byte(NATPacketTypeID), kind
+	binary.LittleEndian.PutUint64(b[2:], txID)
+	for _, part := range body {
+		b = append(b, part...)
+	}
+	return b
+}
+
+func decodeNAT(data []byte, from *net.UDPAddr) (*natMessage, error) {
+	if len(data) < natHeaderSize || data[0] != byte(NATPacketTypeID) {
+		return nil, errors.New("invalid NAT traversal message")
+	}
+	m := &natMessage{kind: data[1], txID: binary.LittleEndian.Uint64(data[2:]), from: from}
+	body := data[natHeaderSize:]
+	name := func() (string, error) {
+		if len(body) < 1 || len(body) < 1+int(body[0]) {
+			return "", errors.New("truncated name")
+		}
+		s := string(body[1 : 1+body[0]])
+		body = body[1+body[0]:]
+		return s, nil
+	}
+	addrs := func(n int) error {
+		if len(body) < 6*n {
+			return errors.New("truncated address")
+		}
+		for range n {
+			var addr *net.UDPAddr
+			if ip := net.IP(body[:4]); !ip.Equal(net.IPv4zero.To4()) {
+				addr = &net.UDPAddr{IP: net.IPv4(ip[0], ip[1], ip[2], ip[3]), Port: int(binary.LittleEndian.Uint16(body[4:6]))}
+			}
+			m.addrs = append(m.addrs, addr)
+			body = body[6:]
+		}
+		return nil
+	}
+
+	var err error
+	switch m.kind {
+	case natBinding, natPunch:
+	case natRegister:
+		if m.name, err = name(); err == nil {
+			err = addrs(1)
+		}
+	case natConnect:
+		if m.name, err = name(); err == nil {
+			if m.peer, err = name(); err == nil {
+				err = addrs(1)
+			}
+		}
+	case natAddress, natPunchAck:
+		err = addrs(1)
+	case natIntroduce:
+		if m.peer, err = name(); err == nil {
+			err = addrs(3)
+		}
+	case natError:
+		m.text = string(body)
+	default:
+		err = fmt.Errorf("unknown NAT traversal message kind %d", m.kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// natPath is how datagrams to a peer reached through NAT traversal are sent
+type natPath struct {
+	source *net.UDPAddr // header source, the address the peer sees this transport at
+	relay  *net.UDPAddr // proxy the datagrams are written to instead of the peer, if any
+}
+
+// natState is the NAT traversal state of a transport
+type natState struct {
+	mu      sync.Mutex
+	servers map[string]bool             // rendezvous servers NAT traversal is enabled with
+	relay   *net.UDPAddr                // for peers connecting to this transport, if any
+	pending map[uint64]chan *natMessage // replies awaited, by transaction ID
+	paths   map[string]natPath          // by peer address
+}
+
+func newNATState() *natState {
+	return &natState{
+		servers: make(map[string]bool),
+		pending: make(map[uint64]chan *natMessage),
+		paths:   make(map[string]natPath),
+	}
+}
+
+// enabled reports whether NAT traversal is enabled, with any rendezvous server
+func (n *natState) enabled() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.servers) > 0
+}
+
+// trusted reports whether addr is a rendezvous server NAT traversal is enabled with
+func (n *natState) trusted(addr *net.UDPAddr) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.servers[addr.String()]
+}
+
+// await registers a transaction, whose messages are delivered to the returned channel until
+// done is called
+func (n *natState) await(txID uint64) (<-chan *natMessage, func()) {
+	ch := make(chan *natMessage, 16)
+	n.mu.Lock()
+	n.pending[txID] = ch
+	n.mu.Unlock()
+	return ch, func() {
+		n.mu.Lock()
+		delete(n.pending, txID)
+		n.mu.Unlock()
+	}
+}
+
+// deliver passes a message to its transaction, and reports whether one awaited it
+func (n *natState) deliver(m *natMessage) bool {
+	n.mu.Lock()
+	ch, ok := n.pending[m.txID]
+	n.mu.Unlock()
+	if ok {
+		select {
+		case ch <- m:
+		default: // the transaction has enough to go on
+		}
+	}
+	return ok
+}
+
+func (n *natState) path(addr *net.UDPAddr) (natPath, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	p, ok := n.paths[addr.String()]
+	return p, ok
+}
+
+func (n *natState) setPath(addr *net.UDPAddr, p natPath) {
+	n.mu.Lock()
+	n.paths[addr.String()] = p
+	n.mu.Unlock()
+}
+
+// handleNATMessage handles a NAT traversal datagram read by Receive. Messages of rendezvous
+// servers are only taken from the servers NAT traversal is enabled with, and punches are only
+// answered while punching towards their peer.
+func (t *UDPTransport) handleNATMessage(data []byte, from *net.UDPAddr) {
+	if !t.nat.enabled() {
+		logging.Debug("Dropping NAT traversal message, NAT traversal is not enabled", zap.String("from", from.String()))
+		return
+	}
+	m, err := decodeNAT(data, from)
+	if err != nil {
+		logging.Debug("Dropping NAT traversal message", zap.String("from", from.String()), zap.Error(err))
+		return
+	}
+	switch m.kind {
+	case natPunch:
+		// Tell the peer where its punch came from, which is the header source it must use
+		if t.nat.deliver(m) {
+			t.writeNAT(encodeNAT(natPunchAck, m.txID, appendNATAddr(nil, from)), from)
+		}
+	case natPunchAck:
+		t.nat.deliver(m)
+	default:
+		if !t.nat.trusted(from) {
+			logging.Debug("Dropping NAT traversal message of an unknown rendezvous server", zap.String("from", from.String()))
+			return
+		}
+		if m.kind != natIntroduce {
+			t.nat.deliver(m)
+		} else if !t.nat.deliver(m) {
+			// Another peer connects to this one: punch towards it at the same time. Repeated
+			// introductions go to the same transaction.
+			replies, done := t.nat.await(m.txID)
+			go func() {
+				defer done()
+				t.answerIntroduction(m, replies)
+			}()
+		}
+	}
+}
+
+// writeNAT writes a NAT traversal message from the socket of the transport, whose NAT
+// mapping is the one being discovered or opened
+func (t *UDPTransport) writeNAT(data []byte, to *net.UDPAddr) {
+	if err := t.write(t.conn, data, to, 0); err != nil {
+		logging.Debug("Failed to send NAT traversal message", zap.String("to", to.String()), zap.Error(err))
+		return
+	}
+	t.stats.datagramsSent.Add(1)
+	t.stats.bytesSent.Add(uint64(len(data)))
+}
+
+// EnableNATTraversal lets the transport take part in NAT traversal with the rendezvous
+// server at server, for DiscoverPublicAddr, RegisterPeer and ConnectPeer. Until then, the
+// transport drops all NAT traversal datagrams, and afterwards it only takes addresses and
+// introductions from the rendezvous servers it was enabled with.
+//
+// relay, if not empty, is the proxy RPCs to peers connecting to this transport go through
+// when hole punching towards them fails (see ConnectPeer). It can be enabled with several
+// servers; the relay of the last call is used.
+func (t *UDPTransport) EnableNATTraversal(server, relay string) error {
+	addr, err := t.resolver.ResolveUDPTarget(server)
+	if err != nil {
+		return err
+	}
+	var relayAddr *net.UDPAddr
+	if relay != "" {
+		if relayAddr, err = t.resolver.ResolveUDPTarget(relay); err != nil {
+			return fmt.Errorf("invalid relay: %w", err)
+		}
+	}
+	t.nat.mu.Lock()
+	t.nat.servers[addr.String()] = true
+	t.nat.relay = relayAddr
+	t.nat.mu.Unlock()
+	return nil
+}
+
+// natRequest sends a request to a rendezvous server until a reply of one of the given kinds
+// (or an error) arrives on replies or timeout passes
+func (t *UDPTransport) natRequest(server string, timeout time.Duration, replies <-chan *natMessage, request []byte, kinds ...byte) (*natMessage, error) {
+	addr, err := t.resolver.ResolveUDPTarget(server)
+	if err != nil {
+		return nil, err
+	}
+	if !t.nat.trusted(addr) {
+		return nil, fmt.Errorf("%w with rendezvous server %s", ErrNATTraversalDisabled, server)
+	}
+
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(natRetransmit)
+	defer ticker.Stop()
+	for {
+		t.writeNAT(request, addr)
+		select {
+		case m := <-replies:
+			if m.kind == natError {
+				return nil, fmt.Errorf("rendezvous server: %s", m.text)
+			}
+			for _, kind := range kinds {
+				if m.kind == kind {
+					return m, nil
+				}
+			}
+		case <-ticker.C:
+		case <-deadline:
+			return nil, fmt.Errorf("no answer from rendezvous server %s within %v", server, timeout)
+		}
+	}
+}
+
+// DiscoverPublicAddr asks a rendezvous server which address it sees the transport at, i.e.
+// the address the NAT in front of the transport maps its socket to. Like the rest of NAT
+// traversal, it needs NAT traversal enabled with the server (see EnableNATTraversal) and a
+// goroutine calling Receive, as the receive loops of clients and servers do.
+func (t *UDPTransport) DiscoverPublicAddr(server string, timeout time.Duration) (*net.UDPAddr, error) {
+	txID := rand.Uint64()
+	replies, done := t.nat.await(txID)
+	defer done()
+	m, err := t.natRequest(server, timeout, replies, encodeNAT(natBinding, txID), natAddress)
+	if err != nil {
+		return nil, err
+	}
+	return m.addrs[0], nil
+}
+
+// RegisterPeer registers the transport under name with a rendezvous server, so that other
+// peers can connect to it with ConnectPeer, and returns its public address. Registrations
+// end after RendezvousTTL; call it again before, which also keeps the NAT mapping open.
+func (t *UDPTransport) RegisterPeer(server, name string, timeout time.Duration) (*net.UDPAddr, error) {
+	if len(name) == 0 || len(name) > 255 {
+		return nil, fmt.Errorf("invalid peer name %q", name)
+	}
+	txID := rand.Uint64()
+	replies, done := t.nat.await(txID)
+	defer done()
+	request := encodeNAT(natRegister, txID, appendNATName(nil, name), appendNATAddr(nil, t.LocalAddr()))
+	m, err := t.natRequest(server, timeout, replies, request, natAddress)
+	if err != nil {
+		return nil, err
+	}
+	return m.addrs[0], nil
+}
+
+// PeerPath is how RPCs to a peer reached with ConnectPeer are addressed
+type PeerPath struct {
+	Addr    *net.UDPAddr // address to send the RPCs of the peer to
+	Relayed bool         // whether they are written to the relay, which forwards them
+}
+
+// ConnectPeer opens a direct UDP path to a peer registered as peer with a rendezvous
+// server: the server introduces the two peers to each other with their public and local
+// addresses, and both send punches to the other's addresses at the same time (simultaneous
+// open), which opens the mappings of their NATs. The first address that answers is used.
+//
+// If no address answers within timeout and relay is not empty, RPCs to the peer go through
+// the relay instead, a proxy reachable by both that forwards datagrams to the destination of
+// their header. Otherwise ErrHolePunchFailed is returned. The peer falls back to the relay
+// it enabled NAT traversal with, if any.
+//
+// Afterwards, datagrams to the returned address carry the address the peer sees this
+// transport at as header source, to which the peer answers.
+func (t *UDPTransport) ConnectPeer(server, self, peer, relay string, timeout time.Duration) (*PeerPath, error) {
+	if len(self) == 0 || len(self) > 255 || len(peer) == 0 || len(peer) > 255 {
+		return nil, fmt.Errorf("invalid peer names %q and %q", self, peer)
+	}
+	var relayAddr *net.UDPAddr
+	if relay != "" {
+		var err error
+		if relayAddr, err = t.resolver.ResolveUDPTarget(relay); err != nil {
+			return nil, fmt.Errorf("invalid relay: %w", err)
+		}
+	}
+
+	start := time.Now()
+	txID := rand.Uint64()
+	replies, done := t.nat.await(txID) // for the introduction, then the punches of the peer
+	defer done()
+	request := encodeNAT(natConnect, txID, appendNATName(nil, self), appendNATName(nil, peer),
+		appendNATAddr(nil, t.LocalAddr()))
+	intro, err := t.natRequest(server, timeout, replies, request, natIntroduce)
+	if err != nil {
+		return nil, err
+	}
+	return t.punch(intro, replies, relayAddr, timeout-time.Since(start))
+}
+
+// answerIntroduction punches towards a peer connecting to this one
+func (t *UDPTransport) answerIntroduction(intro *natMessage, replies <-chan *natMessage) {
+	t.nat.mu.Lock()
+	relay := t.nat.relay
+	t.nat.mu.Unlock()
+	path, err := t.punch(intro, replies, relay, natPunchTimeout)
+	if err != nil {
+		logging.Warn("Failed to open a path to peer", zap.String("peer", intro.peer), zap.Error(err))
+		return
+	}
+	logging.Debug("Opened a path to peer", zap.String("peer", intro.peer), zap.Stringer("addr", path.Addr), zap.Bool("relayed", path.Relayed))
+}
+
+// punch sends punches to the public and local addresses of an introduced peer until one
+// acknowledges a punch on replies, and records the path to it, through relay (if not nil)
+// when none does
+func (t *UDPTransport) punch(intro *natMessage, replies <-chan *natMessage, relay *net.UDPAddr, timeout time.Duration) (*PeerPath, error) {
+	public, local, own := intro.addrs[0], intro.addrs[1], intro.addrs[2]
+	if public == nil {
+		return nil, fmt.Errorf("no address of peer %s", intro.peer)
+	}
+	candidates := []*net.UDPAddr{public}
+	if local != nil && !local.IP.Equal(public.IP) {
+		candidates = append(candidates, local)
+	}
+
+	punch := encodeNAT(natPunch, intro.txID)
+	deadline := time.After(max(timeout, 0))
+	ticker := time.NewTicker(natRetransmit)
+	defer ticker.Stop()
+	for {
+		for _, addr := range candidates {
+			t.writeNAT(punch, addr)
+		}
+		select {
+		case m := <-replies:
+			if m.kind != natPunchAck || m.addrs[0] == nil {
+				continue // punches of the peer are answered by handleNATMessage
+			}
+			t.nat.setPath(m.from, natPath{source: m.addrs[0]})
+			return &PeerPath{Addr: m.from}, nil
+		case <-ticker.C:
+		case <-deadline:
+			if relay == nil {
+				return nil, fmt.Errorf("%w: peer %s did not answer at %v", ErrHolePunchFailed, intro.peer, candidates)
+			}
+			// The peer answers to the public address of this transport, via the relay.
+			// Writing to the relay opens the mapping of the NAT for datagrams from it.
+			t.nat.setPath(public, natPath{source: own, relay: relay})
+			t.writeNAT(punch, relay)
+			return &PeerPath{Addr: public, Relayed: true}, nil
+		}
+	}
+}
+
+// natRoute returns the header source and the address to write datagrams to addr to, for
+// peers reached through NAT traversal
+func (t *UDPTransport) natRoute(addr *net.UDPAddr) (source, dst *net.UDPAddr, ok bool) {
+	p, ok := t.nat.path(addr)
+	if !ok {
+		return nil, addr, false
+	}
+	if p.relay != nil {
+		return p.source, p.relay, true
+	}
+	return p.source, addr, true
+}
+
+// registration is a peer registered with a rendezvous server
+type registration struct {
+	public, local *net.UDPAddr
+	expires       time.Time
+}
+
+// RendezvousServer lets peers behind NATs discover their public address and find each other
+// for ConnectPeer. It must be reachable by all peers, e.g. on a public address.
+//
+// A name belongs to the address that registered it until its registration ends: registering
+// the name again from another address fails. The server keeps at most RendezvousMaxPeers
+// registrations, and forgets ended ones every second.
+type RendezvousServer struct {
+	conn *net.UDPConn
+
+	mu        sync.Mutex
+	peers     map[string]registration
+	lastPrune time.Time
+}
+
+// NewRendezvousServer creates a rendezvous server listening on addr
+func NewRendezvousServer(addr string) (*RendezvousServer, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	return &RendezvousServer{conn: conn, peers: make(map[string]registration)}, nil
+}
+
+// Addr returns the address the server listens on
+func (s *RendezvousServer) Addr() *net.UDPAddr {
+	return s.conn.LocalAddr().(*net.UDPAddr)
+}
+
+// Serve answers peers until the server is closed
+func (s *RendezvousServer) Serve() error {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		m, err := decodeNAT(buf[:n], from)
+		if err != nil {
+			logging.Debug("Dropping rendezvous message", zap.String("from", from.String()), zap.Error(err))
+			continue
+		}
+		s.handle(m)
+	}
+}
+
+func (s *RendezvousServer) handle(m *natMessage) {
+	now := time.Now()
+	switch m.kind {
+	case natBinding:
+		s.send(encodeNAT(natAddress, m.txID, appendNATAddr(nil, m.from)), m.from)
+	case natRegister:
+		if err := s.register(m, now); err != nil {
+			s.send(encodeNAT(natError, m.txID, []byte(err.Error())), m.from)
+			return
+		}
+		s.send(encodeNAT(natAddress, m.txID, appendNATAddr(nil, m.from)), m.from)
+	case natConnect:
+		s.mu.Lock()
+		s.prune(now)
+		peer, ok := s.peers[m.peer]
+		ok = ok && !now.After(peer.expires)
+		s.mu.Unlock()
+		if !ok {
+			s.send(encodeNAT(natError, m.txID, []byte(fmt.Sprintf("peer %q is not registered", m.peer))), m.from)
+			return
+		}
+		var toPeer, toClient []byte
+		toPeer = appendNATName(toPeer, m.name)
+		toPeer = appendNATAddr(appendNATAddr(appendNATAddr(toPeer, m.from), m.addrs[0]), peer.public)
+		toClient = appendNATName(toClient, m.peer)
+		toClient = appendNATAddr(appendNATAddr(appendNATAddr(toClient, peer.public), peer.local), m.from)
+		s.send(encodeNAT(natIntroduce, m.txID, toPeer), peer.public)
+		s.send(encodeNAT(natIntroduce, m.txID, toClient), m.from)
+	}
+}
+
+// register records the registration of a name by the sender of m, unless the name belongs to
+// another address or the server is full
+func (s *RendezvousServer) register(m *natMessage, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(now)
+	current, ok := s.peers[m.name]
+	if ok && !now.After(current.expires) && current.public.String() != m.from.String() {
+		return fmt.Errorf("peer %q is registered from another address", m.name)
+	}
+	if !ok && len(s.peers) >= RendezvousMaxPeers {
+		return fmt.Errorf("too many registered peers")
+	}
+	s.peers[m.name] = registration{public: m.from, local: m.addrs[0], expires: now.Add(RendezvousTTL)}
+	return nil
+}
+
+// prune forgets the registrations that ended. It runs at most once per second.
+func (s *RendezvousServer) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < time.Second {
+		return
+	}
+	s.lastPrune = now
+	for name, r := range s.peers {
+		if now.After(r.expires) {
+			delete(s.peers, name)
+		}
+	}
+}
+
+func (s *RendezvousServer) send(data []byte, to *net.UDPAddr) {
+	if _, err := s.conn.WriteToUDP(data, to); err != nil {
+		logging.Debug("Failed to answer peer", zap.String("to", to.String()), zap.Error(err))
+	}
+}
+
+// Close stops the server
+func (s *RendezvousServer) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,265 @@
+package transport
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+)
+
+// received is a message returned by Receive
+type received struct {
+	data []byte
+	addr *net.UDPAddr
+}
+
+// receiveLoop calls Receive until the transport is closed, as clients and servers do, and
+// passes on the messages with data
+func receiveLoop(tr *UDPTransport, role Role) <-chan received {
+	out := make(chan received, 16)
+	go func() {
+		for {
+			data, addr, _, _, err := tr.Receive(packet.MaxUDPPayloadSize, role)
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if data != nil {
+				out <- received{data: data, addr: addr}
+			}
+		}
+	}()
+	return out
+}
+
+func newNATTestSetup(t *testing.T) (*RendezvousServer, *UDPTransport) {
+	t.Helper()
+	server, err := NewRendezvousServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("NewRendezvousServer failed: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	go server.Serve()
+
+	return server, newNATTransport(t, server)
+}
+
+// newNATTransport creates a transport with NAT traversal enabled with server
+func newNATTransport(t *testing.T, server *RendezvousServer) *UDPTransport {
+	t.Helper()
+	tr, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("NewUDPTransport failed: %v", err)
+	}
+	t.Cleanup(func() { tr.Close() })
+	if err := tr.EnableNATTraversal(server.Addr().String(), ""); err != nil {
+		t.Fatalf("EnableNATTraversal failed: %v", err)
+	}
+	return tr
+}
+
+func TestConnectPeer_Direct(t *testing.T) {
+	server, a := newNATTestSetup(t)
+	b := newNATTransport(t, server)
+	receiveLoop(a, RoleClient)
+	requests := receiveLoop(b, RoleServer)
+
+	public, err := a.DiscoverPublicAddr(server.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("DiscoverPublicAddr failed: %v", err)
+	}
+	if public.String() != a.LocalAddr().String() {
+		t.Errorf("Expected the address of the transport without NAT, got %v", public)
+	}
+	if _, err := b.RegisterPeer(server.Addr().String(), "b", time.Second); err != nil {
+		t.Fatalf("RegisterPeer failed: %v", err)
+	}
+
+	if _, err := a.ConnectPeer(server.Addr().String(), "a", "c", "", time.Second); err == nil || !strings.Contains(err.Error(), "not registered") {
+		t.Errorf("Expected error for an unregistered peer, got %v", err)
+	}
+	path, err := a.ConnectPeer(server.Addr().String(), "a", "b", "", 2*time.Second)
+	if err != nil {
+		t.Fatalf("ConnectPeer failed: %v", err)
+	}
+	if path.Relayed || path.Addr.String() != b.LocalAddr().String() {
+		t.Errorf("Expected a direct path to %v, got %+v", b.LocalAddr(), path)
+	}
+
+	// The peer answers to the header source, the address it saw the punches of a at
+	payload := []byte{0x01, 20, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	if err := a.Send(path.Addr.String(), 1, payload, packet.PacketTypeRequest); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	select {
+	case r := <-requests:
+		if r.addr.String() != a.LocalAddr().String() {
+			t.Errorf("Expected the request from %v, got %v", a.LocalAddr(), r.addr)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Request not received")
+	}
+}
+
+func TestConnectPeer_Relay(t *testing.T) {
+	server, a := newNATTestSetup(t)
+	receiveLoop(a, RoleClient)
+
+	// A peer behind a NAT that drops the punches of a: it registers, but never answers
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("ListenUDP failed: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+	peer, relay := listen(), listen()
+	register := encodeNAT(natRegister, 1, appendNATName(nil, "b"), appendNATAddr(nil, nil))
+	if _, err := peer.WriteToUDP(register, server.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1500)
+	if _, _, err := peer.ReadFromUDP(buf); err != nil {
+		t.Fatalf("Registration not answered: %v", err)
+	}
+
+	if _, err := a.ConnectPeer(server.Addr().String(), "a", "b", "", 300*time.Millisecond); !errors.Is(err, ErrHolePunchFailed) {
+		t.Errorf("Expected ErrHolePunchFailed without relay, got %v", err)
+	}
+	path, err := a.ConnectPeer(server.Addr().String(), "a", "b", relay.LocalAddr().String(), 300*time.Millisecond)
+	if err != nil {
+		t.Fatalf("ConnectPeer failed: %v", err)
+	}
+	if !path.Relayed || path.Addr.String() != peer.LocalAddr().String() {
+		t.Fatalf("Expected a relayed path to %v, got %+v", peer.LocalAddr(), path)
+	}
+
+	// RPCs to the peer are written to the relay, with the peer as header destination
+	payload := []byte{0x01, 20, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	if err := a.Send(path.Addr.String(), 7, payload, packet.PacketTypeRequest); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	codec := &packet.DataPacketCodec{}
+	for {
+		n, _, err := relay.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("Request not sent to the relay: %v", err)
+		}
+		if buf[0] == byte(NATPacketTypeID) {
+			continue // opens the NAT mapping towards the relay
+		}
+		decoded, err := codec.Deserialize(buf[:n])
+		if err != nil {
+			t.Fatalf("Deserialize failed: %v", err)
+		}
+		pkt := decoded.(*packet.DataPacket)
+		if pkt.RPCID != 7 || int(pkt.DstPort) != peer.LocalAddr().(*net.UDPAddr).Port || int(pkt.SrcPort) != a.LocalAddr().Port {
+			t.Errorf("Expected a request from %v to %v, got %+v", a.LocalAddr(), peer.LocalAddr(), pkt)
+		}
+		break
+	}
+}
+
+func TestNATTraversal_Untrusted(t *testing.T) {
+	server, _ := newNATTestSetup(t)
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("ListenUDP failed: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	attacker, victim := listen(), listen()
+	victimAddr := victim.LocalAddr().(*net.UDPAddr)
+	intro := encodeNAT(natIntroduce, 3, appendNATName(nil, "victim"), appendNATAddr(nil, victimAddr),
+		appendNATAddr(nil, victimAddr), appendNATAddr(nil, victimAddr))
+	punch := encodeNAT(natPunch, 4)
+
+	plain, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("NewUDPTransport failed: %v", err)
+	}
+	t.Cleanup(func() { plain.Close() })
+	enabled := newNATTransport(t, server)
+	if _, err := plain.DiscoverPublicAddr(server.Addr().String(), time.Second); !errors.Is(err, ErrNATTraversalDisabled) {
+		t.Errorf("Expected ErrNATTraversalDisabled without EnableNATTraversal, got %v", err)
+	}
+
+	// Neither a transport without NAT traversal nor one taking introductions from another
+	// server punches towards the addresses of an unsolicited introduction, or answers punches
+	// it did not ask for
+	for _, tr := range []*UDPTransport{plain, enabled} {
+		receiveLoop(tr, RoleServer)
+		for _, msg := range [][]byte{intro, punch} {
+			if _, err := attacker.WriteToUDP(msg, tr.LocalAddr()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	buf := make([]byte, 1500)
+	for _, conn := range []*net.UDPConn{victim, attacker} {
+		conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		if n, from, err := conn.ReadFromUDP(buf); err == nil {
+			t.Errorf("Expected no NAT traversal datagrams, got %x from %v", buf[:n], from)
+		}
+	}
+	if _, ok := enabled.nat.path(victimAddr); ok {
+		t.Error("Expected no path to the address of an unsolicited introduction")
+	}
+}
+
+func TestRendezvousServer_Register(t *testing.T) {
+	server, a := newNATTestSetup(t)
+	b := newNATTransport(t, server)
+	receiveLoop(a, RoleClient)
+	receiveLoop(b, RoleClient)
+
+	if _, err := a.RegisterPeer(server.Addr().String(), "a", time.Second); err != nil {
+		t.Fatalf("RegisterPeer failed: %v", err)
+	}
+	// The registrant renews its name, other addresses cannot take it over
+	if _, err := a.RegisterPeer(server.Addr().String(), "a", time.Second); err != nil {
+		t.Errorf("Expected the registrant to renew its name, got %v", err)
+	}
+	if _, err := b.RegisterPeer(server.Addr().String(), "a", time.Second); err == nil || !strings.Contains(err.Error(), "another address") {
+		t.Errorf("Expected error for a name registered by another peer, got %v", err)
+	}
+
+	// Names whose registration ended are free again, and forgotten
+	now := time.Now().Add(RendezvousTTL + 2*time.Second)
+	if err := server.register(&natMessage{name: "a", from: b.LocalAddr(), addrs: []*net.UDPAddr{nil}}, now); err != nil {
+		t.Errorf("Expected an ended registration to be replaced, got %v", err)
+	}
+
+	// The server is full once it holds RendezvousMaxPeers registrations
+	server.mu.Lock()
+	for i := len(server.peers); i < RendezvousMaxPeers; i++ {
+		server.peers[strconv.Itoa(i)] = registration{public: b.LocalAddr(), expires: now.Add(time.Hour)}
+	}
+	server.mu.Unlock()
+	if err := server.register(&natMessage{name: "new", from: b.LocalAddr(), addrs: []*net.UDPAddr{nil}}, now); err == nil {
+		t.Error("Expected error for a registration beyond RendezvousMaxPeers")
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.prune(now.Add(2 * time.Hour))
+	if len(server.peers) != 0 {
+		t.Errorf("Expected ended registrations to be forgotten, %d left", len(server.peers))
+	}
+}
+
+func TestDecodeNAT_Truncated(t *testing.T) {
+	intro := encodeNAT(natIntroduce, 9, appendNATName(nil, "peer"), appendNATAddr(nil, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 9000}))
+	if _, err := decodeNAT(intro, nil); err == nil {
+		t.Error("Expected error for an introduction without all its addresses")
+	}
+	if _, err := decodeNAT([]byte{byte(NATPacketTypeID), natPunch}, nil); err == nil {
+		t.Error("Expected error for a message without transaction ID")
+	}
+}
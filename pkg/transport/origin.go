@@ -0,0 +1,36 @@
+package transport
+
+import "github.com/appnet-org/arpc/pkg/packet"
+
+// originExtensionSize is the number of header bytes used by the ExtensionOrigin extension.
+// Like recvLimitExtensionSize, it counts the length prefix of the extension area.
+var originExtensionSize = packet.ExtensionsSize([]packet.Extension{
+	{Type: packet.ExtensionOrigin, Value: make([]byte, packet.OriginSize)},
+})
+
+// SendRequest sends a request like SendWithProfile, with the origin of the call in the
+// ExtensionOrigin extension of every fragment
+func (t *UDPTransport) SendRequest(addr string, rpcID uint64, data []byte, profile EncryptionProfile, origin packet.Origin) (int, error) {
+	encrypt := t.encryptionEnabled
+	if profile == EncryptionRequired && !encrypt {
+		if err := InitDefaultGCMObjects(); err != nil {
+			return 0, err
+		}
+		encrypt = true
+	}
+	return t.send(addr, rpcID, data, packet.PacketTypeRequest, encrypt, &origin)
+}
+
+// TakeOrigin returns and forgets the origin of a received request, which clients of this
+// release send with every request. Servers should call it for every request returned by
+// Receive so that origins do not accumulate.
+func (t *UDPTransport) TakeOrigin(rpcID uint64) (packet.Origin, bool) {
+	t.originsMu.Lock()
+	defer t.originsMu.Unlock()
+
+	origin, ok := t.origins[rpcID]
+	if ok {
+		delete(t.origins, rpcID)
+	}
+	return origin, ok
+}
@@ -0,0 +1,63 @@
+package transport
+
+import "github.com/appnet-org/arpc/pkg/packet"
+
+// EncryptionProfile selects whether the messages of an RPC are encrypted (see SendWithProfile)
+type EncryptionProfile uint8
+
+const (
+	// EncryptionDefault encrypts the messages if encryption is enabled on the transport
+	EncryptionDefault EncryptionProfile = iota
+	// EncryptionRequired encrypts the messages even if encryption is disabled on the
+	// transport, e.g. for the RPCs of a payment service in a mesh that does not encrypt by
+	// default
+	EncryptionRequired
+)
+
+// String returns the name of the profile
+func (p EncryptionProfile) String() string {
+	if p == EncryptionRequired {
+		return "required"
+	}
+	return "default"
+}
+
+// SendWithProfile sends data like SendWithFragmentCount, encrypted as profile says. Messages
+// encrypted while encryption is disabled on the transport use the default keys. Their
+// packets carry the security extensions of the default public key like those of any
+// encrypted message, which tells receivers without encryption enabled, servers and proxies,
+// to decrypt them.
+func (t *UDPTransport) SendWithProfile(addr string, rpcID uint64, data []byte, packetType packet.PacketType, profile EncryptionProfile) (int, error) {
+	if profile != EncryptionRequired || t.encryptionEnabled {
+		return t.SendWithFragmentCount(addr, rpcID, data, packetType)
+	}
+	if err := InitDefaultGCMObjects(); err != nil {
+		return 0, err
+	}
+	return t.send(addr, rpcID, data, packetType, true, nil)
+}
+
+// CallEncrypted tells whether a data packet carries valid security extensions of the default
+// public key, as the packets of messages sent with EncryptionRequired by a transport without
+// encryption enabled do
+func CallEncrypted(exts []packet.Extension, packetTypeID packet.PacketTypeID, rpcID uint64) bool {
+	return VerifySecurityExtensions(exts, packetTypeID, rpcID, DefaultPublicKey) == nil
+}
+
+// callEncrypted tells whether the sender of pkt encrypted its message with EncryptionRequired
+func callEncrypted(pkt *packet.DataPacket) bool {
+	return CallEncrypted(pkt.Extensions, pkt.PacketTypeID, pkt.RPCID)
+}
+
+// TakeCallEncrypted reports and forgets whether a message received while encryption is
+// disabled on the transport was encrypted by its sender (see SendWithProfile), and was
+// decrypted by Receive. Servers should call it for every request returned by Receive, and
+// answer the encrypted ones with EncryptionRequired too; clients for every response.
+func (t *UDPTransport) TakeCallEncrypted(rpcID uint64) bool {
+	t.callEncryptedMu.Lock()
+	defer t.callEncryptedMu.Unlock()
+
+	encrypted := t.callEncrypted[rpcID]
+	delete(t.callEncrypted, rpcID)
+	return encrypted
+}
@@ -0,0 +1,130 @@
+package transport
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+)
+
+// ErrRelayAuth is returned for relay tokens not issued with the secret of the relay, issued
+// for another destination, or expired
+var ErrRelayAuth = errors.New("relay authentication failed")
+
+const (
+	// RelayTokenSize is the size of the session tokens relays authenticate RPCs with
+	RelayTokenSize = 4 + 4 + relayTagSize
+	relayTagSize   = 8
+	// relayExtensionSize is the number of header bytes used by the ExtensionRelay extension
+	relayExtensionSize = 2 + 6 + RelayTokenSize
+)
+
+// NewRelayToken issues the token of a relayed session to dst, valid until expiry: the
+// session ID and the expiry in unix seconds, followed by a truncated HMAC-SHA256 of both and
+// of dst under the secret of the relay. Relays only forward RPCs carrying the token to dst,
+// and charge their bandwidth to the session.
+func NewRelayToken(secret []byte, session uint32, dst *net.UDPAddr, expiry time.Time) []byte {
+	token := binary.LittleEndian.AppendUint32(nil, session)
+	token = binary.LittleEndian.AppendUint32(token, uint32(expiry.Unix()))
+	return append(token, relayTag(secret, token, dst)...)
+}
+
+// VerifyRelayToken checks that a token was issued with secret for dst and has not expired
+// at now, and returns its session ID. The returned error wraps ErrRelayAuth.
+func VerifyRelayToken(secret, token []byte, dst *net.UDPAddr, now time.Time) (uint32, error) {
+	if len(token) != RelayTokenSize {
+		return 0, fmt.Errorf("%w: token of %d bytes, expected %d", ErrRelayAuth, len(token), RelayTokenSize)
+	}
+	session := binary.LittleEndian.Uint32(token[:4])
+	if !hmac.Equal(token[8:], relayTag(secret, token[:8], dst)) {
+		return 0, fmt.Errorf("%w: invalid token for session %d to %v", ErrRelayAuth, session, dst)
+	}
+	if expiry := time.Unix(int64(binary.LittleEndian.Uint32(token[4:8])), 0); now.After(expiry) {
+		return 0, fmt.Errorf("%w: token of session %d expired at %v", ErrRelayAuth, session, expiry)
+	}
+	return session, nil
+}
+
+// relayTag authenticates the session and expiry of a token, and the destination it is for
+func relayTag(secret, sessionExpiry []byte, dst *net.UDPAddr) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(sessionExpiry)
+	mac.Write(EncodeRelayExtension(dst, nil))
+	return mac.Sum(nil)[:relayTagSize]
+}
+
+// EncodeRelayExtension encodes the value of the ExtensionRelay extension:
+// [DstIP(4B)][DstPort(2B)][Token]
+func EncodeRelayExtension(dst *net.UDPAddr, token []byte) []byte {
+	value := make([]byte, 6, 6+len(token))
+	copy(value[:4], dst.IP.To4())
+	binary.LittleEndian.PutUint16(value[4:6], uint16(dst.Port))
+	return append(value, token...)
+}
+
+// DecodeRelayExtension decodes the value of the ExtensionRelay extension into the final
+// destination of the RPC and the session token
+func DecodeRelayExtension(value []byte) (*net.UDPAddr, []byte, error) {
+	if len(value) < 6 {
+		return nil, nil, fmt.Errorf("relay extension of %d bytes is too short", len(value))
+	}
+	ip := make(net.IP, 4)
+	copy(ip, value[:4])
+	dst := &net.UDPAddr{IP: ip, Port: int(binary.LittleEndian.Uint16(value[4:6]))}
+	return dst, value[6:], nil
+}
+
+// relayRoute sends the RPCs to a destination through a relay
+type relayRoute struct {
+	relay *net.UDPAddr
+	token []byte
+}
+
+// SetRelay sends the RPCs to dst, an IPv4 address and port, through the relay proxy at
+// relay, for peers this transport cannot reach directly. Packets are addressed to the relay, and carry dst and the
+// session token (see NewRelayToken), which must be issued for dst, in the ExtensionRelay
+// extension; the relay forwards them and passes the responses back. An empty relay sends to
+// dst directly again.
+//
+// The extension takes 24 bytes of the header extension area, so it does not fit next to
+// the security, receive limit and origin extensions and a user agent of more than 9 bytes.
+func (t *UDPTransport) SetRelay(dst, relay string, token []byte) error {
+	dstAddr, err := net.ResolveUDPAddr("udp4", dst)
+	if err != nil {
+		return err
+	}
+
+	t.relaysMu.Lock()
+	defer t.relaysMu.Unlock()
+	if relay == "" {
+		delete(t.relays, dstAddr.String())
+		return nil
+	}
+	if len(token) != RelayTokenSize {
+		return fmt.Errorf("relay token of %d bytes, expected %d", len(token), RelayTokenSize)
+	}
+	relayAddr, err := net.ResolveUDPAddr("udp4", relay)
+	if err != nil {
+		return err
+	}
+	t.relays[dstAddr.String()] = relayRoute{relay: relayAddr, token: token}
+	return nil
+}
+
+// relayFor returns the relay route of a destination, if RPCs to it are relayed
+func (t *UDPTransport) relayFor(addr *net.UDPAddr) (relayRoute, bool) {
+	t.relaysMu.RLock()
+	defer t.relaysMu.RUnlock()
+	route, ok := t.relays[addr.String()]
+	return route, ok
+}
+
+// extension returns the ExtensionRelay extension of RPCs to dst
+func (r relayRoute) extension(dst *net.UDPAddr) packet.Extension {
+	return packet.Extension{Type: packet.ExtensionRelay, Value: EncodeRelayExtension(dst, r.token)}
+}
@@ -0,0 +1,109 @@
+package transport
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+)
+
+func TestRelayToken(t *testing.T) {
+	secret := []byte("relay-secret")
+	dst := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 10), Port: 9000}
+	now := time.Now()
+	token := NewRelayToken(secret, 42, dst, now.Add(time.Hour))
+	session, err := VerifyRelayToken(secret, token, dst, now)
+	if err != nil || session != 42 {
+		t.Fatalf("Expected session 42, got %d (%v)", session, err)
+	}
+
+	if _, err := VerifyRelayToken([]byte("other"), token, dst, now); !errors.Is(err, ErrRelayAuth) {
+		t.Errorf("Expected ErrRelayAuth for another secret, got %v", err)
+	}
+	forged := append([]byte{}, token...)
+	forged[0] = 43
+	if _, err := VerifyRelayToken(secret, forged, dst, now); !errors.Is(err, ErrRelayAuth) {
+		t.Errorf("Expected ErrRelayAuth for a forged session, got %v", err)
+	}
+	extended := append([]byte{}, token...)
+	extended[7]++
+	if _, err := VerifyRelayToken(secret, extended, dst, now); !errors.Is(err, ErrRelayAuth) {
+		t.Errorf("Expected ErrRelayAuth for a forged expiry, got %v", err)
+	}
+	if _, err := VerifyRelayToken(secret, token[:4], dst, now); !errors.Is(err, ErrRelayAuth) {
+		t.Errorf("Expected ErrRelayAuth for a truncated token, got %v", err)
+	}
+
+	// A token only opens the way to the destination it was issued for
+	for _, other := range []*net.UDPAddr{
+		{IP: net.IPv4(10, 0, 0, 1), Port: 9000},
+		{IP: net.IPv4(192, 0, 2, 10), Port: 9001},
+	} {
+		if _, err := VerifyRelayToken(secret, token, other, now); !errors.Is(err, ErrRelayAuth) {
+			t.Errorf("Expected ErrRelayAuth for a token of %v used for %v, got %v", dst, other, err)
+		}
+	}
+
+	if _, err := VerifyRelayToken(secret, token, dst, now.Add(2*time.Hour)); !errors.Is(err, ErrRelayAuth) {
+		t.Errorf("Expected ErrRelayAuth for an expired token, got %v", err)
+	}
+}
+
+func TestSetRelay(t *testing.T) {
+	tr, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("NewUDPTransport failed: %v", err)
+	}
+	defer tr.Close()
+	relay, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	defer relay.Close()
+	relay.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	dst := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 10), Port: 9000}
+	token := NewRelayToken([]byte("relay-secret"), 7, dst, time.Now().Add(time.Hour))
+	if err := tr.SetRelay(dst.String(), relay.LocalAddr().String(), token[:4]); err == nil {
+		t.Error("Expected error for a truncated token")
+	}
+	if err := tr.SetRelay(dst.String(), relay.LocalAddr().String(), token); err != nil {
+		t.Fatalf("SetRelay failed: %v", err)
+	}
+
+	// The request is addressed to the relay, with the destination in the relay extension
+	payload := []byte{0x01, 20, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	if err := tr.Send(dst.String(), 5, payload, packet.PacketTypeRequest); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	buf := make([]byte, 1500)
+	n, _, err := relay.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("Request not sent to the relay: %v", err)
+	}
+	decoded, err := (&packet.DataPacketCodec{}).Deserialize(buf[:n])
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	pkt := decoded.(*packet.DataPacket)
+	if int(pkt.DstPort) != relay.LocalAddr().(*net.UDPAddr).Port {
+		t.Errorf("Expected the relay as header destination, got %v:%d", pkt.DstIP, pkt.DstPort)
+	}
+	value, ok := pkt.GetExtension(packet.ExtensionRelay)
+	if !ok {
+		t.Fatal("Expected the relay extension")
+	}
+	relayed, relayedToken, err := DecodeRelayExtension(value)
+	if err != nil || relayed.String() != dst.String() || string(relayedToken) != string(token) {
+		t.Errorf("Expected %v and the session token in the extension, got %v %x (%v)", dst, relayed, relayedToken, err)
+	}
+
+	if err := tr.SetRelay(dst.String(), "", nil); err != nil {
+		t.Fatalf("SetRelay failed: %v", err)
+	}
+	if _, ok := tr.relayFor(dst); ok {
+		t.Error("Expected the relay route to be removed")
+	}
+}
@@ -0,0 +1,71 @@
+package transport
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+)
+
+// ErrDowngrade is returned in strict mode for packets that do not prove they were sent
+// with encryption enabled, e.g. by a misconfigured client falling back to plaintext
+var ErrDowngrade = errors.New("protocol downgrade")
+
+const (
+	keyIDSize   = 8
+	authTagSize = 16
+)
+
+// SecurityExtensionsSize is the number of header bytes used by the key ID and auth tag extensions
+var SecurityExtensionsSize = packet.ExtensionsSize([]packet.Extension{
+	{Type: packet.ExtensionKeyID, Value: make([]byte, keyIDSize)},
+	{Type: packet.ExtensionAuthTag, Value: make([]byte, authTagSize)},
+})
+
+// KeyID returns the identifier of a key as carried in the ExtensionKeyID extension.
+// It is a truncated SHA-256 of the key, so it does not reveal the key itself.
+func KeyID(key []byte) []byte {
+	sum := sha256.Sum256(key)
+	return sum[:keyIDSize]
+}
+
+// authTag binds the packet type and RPC ID to the key. Routing fields and the payload are
+// left out since proxies rewrite the former and elements may modify the latter.
+func authTag(key []byte, packetTypeID packet.PacketTypeID, rpcID uint64) []byte {
+	var msg [9]byte
+	msg[0] = byte(packetTypeID)
+	binary.LittleEndian.PutUint64(msg[1:], rpcID)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(msg[:])
+	return mac.Sum(nil)[:authTagSize]
+}
+
+// AddSecurityExtensions attaches the key ID and auth tag extensions to a packet
+func AddSecurityExtensions(pkt *packet.DataPacket, key []byte) {
+	pkt.SetExtension(packet.ExtensionKeyID, KeyID(key))
+	pkt.SetExtension(packet.ExtensionAuthTag, authTag(key, pkt.PacketTypeID, pkt.RPCID))
+}
+
+// VerifySecurityExtensions checks that the extensions of a packet carry the ID of key and a
+// valid auth tag. The returned error wraps ErrDowngrade.
+func VerifySecurityExtensions(exts []packet.Extension, packetTypeID packet.PacketTypeID, rpcID uint64, key []byte) error {
+	keyID, ok := packet.FindExtension(exts, packet.ExtensionKeyID)
+	if !ok {
+		return fmt.Errorf("%w: missing key ID extension", ErrDowngrade)
+	}
+	if !hmac.Equal(keyID, KeyID(key)) {
+		return fmt.Errorf("%w: unexpected key ID %x", ErrDowngrade, keyID)
+	}
+
+	tag, ok := packet.FindExtension(exts, packet.ExtensionAuthTag)
+	if !ok {
+		return fmt.Errorf("%w: missing auth tag extension", ErrDowngrade)
+	}
+	if !hmac.Equal(tag, authTag(key, packetTypeID, rpcID)) {
+		return fmt.Errorf("%w: invalid auth tag", ErrDowngrade)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package transport
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+)
+
+func TestVerifySecurityExtensions(t *testing.T) {
+	pkt := &packet.DataPacket{PacketTypeID: packet.PacketTypeRequest.TypeID, RPCID: 99}
+	AddSecurityExtensions(pkt, DefaultPublicKey)
+
+	if err := VerifySecurityExtensions(pkt.Extensions, pkt.PacketTypeID, pkt.RPCID, DefaultPublicKey); err != nil {
+		t.Fatalf("Expected valid extensions, got %v", err)
+	}
+
+	// The extensions must survive serialization
+	data, err := (&packet.DataPacketCodec{}).Serialize(pkt, nil)
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	if len(data) != packet.DataPacketHeaderSize+SecurityExtensionsSize {
+		t.Errorf("Expected %d bytes, got %d", packet.DataPacketHeaderSize+SecurityExtensionsSize, len(data))
+	}
+
+	tests := []struct {
+		name  string
+		exts  []packet.Extension
+		rpcID uint64
+		key   []byte
+	}{
+		{"NoExtensions", nil, 99, DefaultPublicKey},
+		{"WrongKey", pkt.Extensions, 99, DefaultPrivateKey},
+		{"WrongRPCID", pkt.Extensions, 100, DefaultPublicKey},
+		{"MissingAuthTag", pkt.Extensions[:1], 99, DefaultPublicKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySecurityExtensions(tt.exts, pkt.PacketTypeID, tt.rpcID, tt.key)
+			if !errors.Is(err, ErrDowngrade) {
+				t.Errorf("Expected ErrDowngrade, got %v", err)
+			}
+		})
+	}
+}
+
+func TestUDPTransport_StrictMode(t *testing.T) {
+	server, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create server transport: %v", err)
+	}
+	defer server.Close()
+
+	if err := server.SetStrictMode(true); err == nil {
+		t.Fatal("Expected strict mode to require encryption")
+	}
+	server.EnableEncryption()
+	if err := server.SetStrictMode(true); err != nil {
+		t.Fatalf("SetStrictMode failed: %v", err)
+	}
+
+	// A client without encryption sends plaintext packets without security extensions
+	client, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create client transport: %v", err)
+	}
+	defer client.Close()
+
+	payload := make([]byte, 20)
+	payload[0] = 0x01
+	payload[1] = 20 // offsetToPrivate == len(payload): public-only
+	if err := client.Send(server.LocalAddr().String(), 1, payload, packet.PacketTypeRequest); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	_, _, _, _, err = server.Receive(packet.MaxUDPPayloadSize, RoleServer)
+	if !errors.Is(err, ErrDowngrade) {
+		t.Errorf("Expected ErrDowngrade for plaintext packet, got %v", err)
+	}
+}
+
+func TestUDPTransport_TakeAuthenticated(t *testing.T) {
+	server, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create server transport: %v", err)
+	}
+	defer server.Close()
+	server.EnableEncryption()
+
+	payload := make([]byte, 20)
+	payload[0] = 0x01
+	payload[1] = 20 // offsetToPrivate == len(payload): public-only
+
+	tests := []struct {
+		name     string
+		key      []byte // auth key of the client
+		rpcID    uint64
+		expected bool
+	}{
+		{"ServerKey", DefaultPublicKey, 1, true},
+		{"ForeignKey", DefaultPrivateKey, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewUDPTransport("127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Failed to create client transport: %v", err)
+			}
+			defer client.Close()
+			client.SetEncryptionKeys(tt.key, DefaultPrivateKey)
+
+			if err := client.Send(server.LocalAddr().String(), tt.rpcID, payload, packet.PacketTypeRequest); err != nil {
+				t.Fatalf("Send failed: %v", err)
+			}
+			server.Receive(packet.MaxUDPPayloadSize, RoleServer)
+			if got := server.TakeAuthenticated(tt.rpcID); got != tt.expected {
+				t.Errorf("Expected authenticated %v, got %v", tt.expected, got)
+			}
+			if server.TakeAuthenticated(tt.rpcID) {
+				t.Error("Expected the record to be forgotten once taken")
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/packet"
+	"go.uber.org/zap"
+)
+
+// ErrMessageTooLarge is returned by Send for a message that needs more fragments than the
+// packet header can count
+var ErrMessageTooLarge = errors.New("message too large")
+
+// recvLimitExtensionSize is the number of header bytes used by the receive limit extension.
+// It counts the length prefix of the extension area, which the security extensions share.
+var recvLimitExtensionSize = packet.ExtensionsSize([]packet.Extension{
+	{Type: packet.ExtensionRecvLimit, Value: make([]byte, 4)},
+})
+
+// maxSendAttempts is how often a datagram is written before a transient error is returned
+const maxSendAttempts = 3
+
+// sendRetryBackoff is the wait before the second attempt; it doubles for each further one
+const sendRetryBackoff = 100 * time.Microsecond
+
+// SendError is returned by Send when a packet of the message could not be written to the
+// socket. Packets before Seq were sent; the message is incomplete at the receiver and the
+// caller should retry it or fail the RPC.
+type SendError struct {
+	Dst   *net.UDPAddr
+	RPCID uint64
+	Seq   int // sequence number of the packet that failed
+	Total int // number of packets of the message
+	Err   error
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("failed to send packet %d/%d of RPC %d to %v: %v", e.Seq+1, e.Total, e.RPCID, e.Dst, e.Err)
+}
+
+// Unwrap returns the socket error, so that errors.Is(err, syscall.EMSGSIZE) works
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
+// writeDatagram writes a datagram, retrying errors that do not concern it: a full socket
+// buffer (ENOBUFS), and ICMP errors of earlier datagrams that the kernel reports on the next
+// send. The latter are moved to the error queue harvest so Receive still returns them.
+// Other errors, including EMSGSIZE, are returned right away. The datagram is sent from the
+// socket of the RPC (see SetFlowPorts), or from the socket of the transport to peers reached
+// through NAT traversal, whose NAT mappings only exist for that socket.
+func (t *UDPTransport) writeDatagram(data []byte, addr *net.UDPAddr, rpcID uint64) error {
+	conn := t.sendConn(rpcID)
+	if _, dst, ok := t.natRoute(addr); ok {
+		conn, addr = t.conn, dst
+	}
+	var err error
+	for attempt := 0; attempt < maxSendAttempts; attempt++ {
+		if attempt > 0 {
+			t.stats.retransmits.Add(1)
+		}
+		if err = t.write(conn, data, addr, rpcID); err == nil {
+			t.stats.datagramsSent.Add(1)
+			t.stats.bytesSent.Add(uint64(len(data)))
+			return nil
+		}
+		switch {
+		case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+			if t.icmpEnabled {
+				t.harvestICMPErrors()
+			}
+		case errors.Is(err, syscall.ENOBUFS):
+			time.Sleep(sendRetryBackoff << attempt)
+		default:
+			return err
+		}
+		logging.Debug("Retrying send", zap.String("dst", addr.String()), zap.Int("attempt", attempt+1), zap.Error(err))
+	}
+	return err
+}
+
+// lowerPathMTU lowers the datagram size used for addr after a datagram of size bytes was
+// rejected with EMSGSIZE. It uses the MTU reported in the error queue if there is one, and
+// halves the size otherwise. It returns false if the size cannot be lowered any further.
+func (t *UDPTransport) lowerPathMTU(addr *net.UDPAddr, size int) bool {
+	if t.icmpEnabled {
+		t.harvestICMPErrors()
+		if t.maxDatagramSize(addr) < size {
+			return true
+		}
+	}
+	if size+ipUDPHeaderSize <= minPathMTU {
+		return false
+	}
+	mtu := max((size+ipUDPHeaderSize)/2, minPathMTU)
+	t.pathMTUs.Store(addr.String(), mtu)
+	logging.Debug("Lowered path MTU after EMSGSIZE", zap.String("dst", addr.String()), zap.Int("mtu", mtu))
+	return true
+}
@@ -0,0 +1,275 @@
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+)
+
+func TestLowerPathMTU(t *testing.T) {
+	tr := &UDPTransport{}
+	addr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 9000}
+
+	// Without reported MTU, the datagram size is halved down to the minimum path MTU
+	size := packet.MaxUDPPayloadSize
+	var sizes []int
+	for tr.lowerPathMTU(addr, size) {
+		next := tr.maxDatagramSize(addr)
+		if next >= size {
+			t.Fatalf("Datagram size did not decrease: %d -> %d", size, next)
+		}
+		size = next
+		sizes = append(sizes, size)
+	}
+	if want := []int{686, minPathMTU - ipUDPHeaderSize}; len(sizes) != len(want) || sizes[0] != want[0] || sizes[1] != want[1] {
+		t.Errorf("Expected sizes %v, got %v", want, sizes)
+	}
+	if other := tr.maxDatagramSize(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 9000}); other != packet.MaxUDPPayloadSize {
+		t.Errorf("Other destinations must keep the default size, got %d", other)
+	}
+}
+
+func TestWriteDatagram_EMSGSIZE(t *testing.T) {
+	tr, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("NewUDPTransport failed: %v", err)
+	}
+	defer tr.Close()
+
+	// Larger than any UDP datagram, so the kernel rejects it
+	err = tr.writeDatagram(make([]byte, 70000), tr.LocalAddr(), 0)
+	if !errors.Is(err, syscall.EMSGSIZE) {
+		t.Fatalf("Expected EMSGSIZE, got %v", err)
+	}
+
+	sendErr := &SendError{Dst: tr.LocalAddr(), RPCID: 7, Seq: 1, Total: 3, Err: err}
+	if !errors.Is(sendErr, syscall.EMSGSIZE) {
+		t.Error("SendError must unwrap to the socket error")
+	}
+}
+
+func TestUDPTransport_RecvLimit(t *testing.T) {
+	server, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create server transport: %v", err)
+	}
+	defer server.Close()
+	client, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create client transport: %v", err)
+	}
+	defer client.Close()
+
+	payload := make([]byte, 20)
+	payload[0] = 0x01
+	payload[1] = 20 // offsetToPrivate == len(payload): public-only
+
+	// Requests advertise the client's limit, and servers take it once
+	client.SetRecvLimit(4096)
+	if err := client.Send(server.LocalAddr().String(), 1, payload, packet.PacketTypeRequest); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if _, _, rpcID, _, err := server.Receive(packet.MaxUDPPayloadSize, RoleServer); err != nil || rpcID != 1 {
+		t.Fatalf("Receive failed: rpcID %d, %v", rpcID, err)
+	}
+	if limit, ok := server.TakeRecvLimit(1); !ok || limit != 4096 {
+		t.Errorf("Expected limit 4096, got %d (%v)", limit, ok)
+	}
+	if _, ok := server.TakeRecvLimit(1); ok {
+		t.Error("Expected the limit to be forgotten once taken")
+	}
+
+	// Without a limit, nothing is advertised
+	client.SetRecvLimit(0)
+	if err := client.Send(server.LocalAddr().String(), 2, payload, packet.PacketTypeRequest); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if _, _, _, _, err := server.Receive(packet.MaxUDPPayloadSize, RoleServer); err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+	if _, ok := server.TakeRecvLimit(2); ok {
+		t.Error("Expected no limit for a client without one")
+	}
+}
+
+func TestUDPTransport_UserAgent(t *testing.T) {
+	server, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create server transport: %v", err)
+	}
+	defer server.Close()
+	client, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create client transport: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.SetUserAgent(strings.Repeat("a", packet.MaxUserAgentSize+1)); err == nil {
+		t.Error("Expected an error for a user agent over MaxUserAgentSize")
+	}
+
+	// The longest user agent fits next to the security and receive limit extensions
+	server.EnableEncryption()
+	client.EnableEncryption()
+	client.SetRecvLimit(4096)
+	userAgent := strings.Repeat("a", packet.MaxUserAgentSize)
+	if err := client.SetUserAgent(userAgent); err != nil {
+		t.Fatalf("SetUserAgent failed: %v", err)
+	}
+	payload := make([]byte, 20)
+	payload[0] = 0x01
+	payload[1] = 20 // offsetToPrivate == len(payload): public-only
+	if err := client.Send(server.LocalAddr().String(), 1, payload, packet.PacketTypeRequest); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if _, _, rpcID, _, err := server.Receive(packet.MaxUDPPayloadSize, RoleServer); err != nil || rpcID != 1 {
+		t.Fatalf("Receive failed: rpcID %d, %v", rpcID, err)
+	}
+	if got, ok := server.TakeUserAgent(1); !ok || got != userAgent {
+		t.Errorf("Expected user agent %q, got %q (%v)", userAgent, got, ok)
+	}
+	if _, ok := server.TakeUserAgent(1); ok {
+		t.Error("Expected the user agent to be forgotten once taken")
+	}
+}
+
+func TestUDPTransport_Origin(t *testing.T) {
+	server, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create server transport: %v", err)
+	}
+	defer server.Close()
+	client, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create client transport: %v", err)
+	}
+	defer client.Close()
+
+	// The origin fits next to the longest user agent, the security and receive limit extensions
+	server.EnableEncryption()
+	client.EnableEncryption()
+	client.SetRecvLimit(4096)
+	if err := client.SetUserAgent(strings.Repeat("a", packet.MaxUserAgentSize)); err != nil {
+		t.Fatalf("SetUserAgent failed: %v", err)
+	}
+	payload := make([]byte, 20)
+	payload[0] = 0x01
+	payload[1] = 20 // offsetToPrivate == len(payload): public-only
+	origin := packet.Origin{ID: 7, Hops: 2}
+	if _, err := client.SendRequest(server.LocalAddr().String(), 1, payload, EncryptionDefault, origin); err != nil {
+		t.Fatalf("SendRequest failed: %v", err)
+	}
+	if _, _, rpcID, _, err := server.Receive(packet.MaxUDPPayloadSize, RoleServer); err != nil || rpcID != 1 {
+		t.Fatalf("Receive failed: rpcID %d, %v", rpcID, err)
+	}
+	if got, ok := server.TakeOrigin(1); !ok || got != origin {
+		t.Errorf("Expected origin %+v, got %+v (%v)", origin, got, ok)
+	}
+	if _, ok := server.TakeOrigin(1); ok {
+		t.Error("Expected the origin to be forgotten once taken")
+	}
+}
+
+func TestUDPTransport_FlowPorts(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer server.Close()
+	client, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create client transport: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.SetFlowPorts(MaxFlowPorts + 1); err == nil {
+		t.Error("Expected an error for too many flow ports")
+	}
+	if err := client.SetFlowPorts(4); err != nil {
+		t.Fatalf("SetFlowPorts failed: %v", err)
+	}
+
+	// Each fragment of an RPC comes from the port of the RPC, and carries the address of
+	// the transport for the response
+	payload := make([]byte, 3000)
+	payload[0] = 0x01
+	binary.LittleEndian.PutUint32(payload[1:5], 100)
+	ports := make(map[int]bool)
+	for rpcID := uint64(1); rpcID <= 16; rpcID++ {
+		sent, err := client.SendWithFragmentCount(server.LocalAddr().String(), rpcID, payload, packet.PacketTypeRequest)
+		if err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		for range sent {
+			buf := make([]byte, packet.MaxUDPPayloadSize)
+			server.SetReadDeadline(time.Now().Add(time.Second))
+			n, src, err := server.ReadFromUDP(buf)
+			if err != nil {
+				t.Fatalf("ReadFromUDP failed: %v", err)
+			}
+			pkt, _, err := packet.DeserializePacketAny(buf[:n])
+			if err != nil {
+				t.Fatalf("Failed to deserialize packet: %v", err)
+			}
+			dataPacket := pkt.(*packet.DataPacket)
+			if src.Port != client.FlowPort(dataPacket.RPCID) || src.Port == client.LocalAddr().Port {
+				t.Errorf("RPC %d: fragment from port %d, want flow port %d", dataPacket.RPCID, src.Port, client.FlowPort(dataPacket.RPCID))
+			}
+			if int(dataPacket.SrcPort) != client.LocalAddr().Port {
+				t.Errorf("RPC %d: header source port %d, want %d", dataPacket.RPCID, dataPacket.SrcPort, client.LocalAddr().Port)
+			}
+			ports[src.Port] = true
+		}
+	}
+	if len(ports) < 2 {
+		t.Errorf("Expected RPCs to spread over the flow ports, got %v", ports)
+	}
+
+	if err := client.SetFlowPorts(0); err != nil {
+		t.Fatalf("SetFlowPorts(0) failed: %v", err)
+	}
+	if port := client.FlowPort(1); port != client.LocalAddr().Port {
+		t.Errorf("FlowPort() = %d without flow ports, want %d", port, client.LocalAddr().Port)
+	}
+}
+
+func TestUDPTransport_TakeDropReason(t *testing.T) {
+	client, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create client transport: %v", err)
+	}
+	defer client.Close()
+	proxy, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	defer proxy.Close()
+
+	data, err := (&packet.ErrorPacketCodec{}).Serialize(&packet.ErrorPacket{
+		PacketTypeID: packet.PacketTypeError.TypeID,
+		RPCID:        3,
+		ErrorMsg:     "denied by policy",
+		DropReason:   packet.DropReasonRateLimited,
+	}, nil)
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	if _, err := proxy.WriteToUDP(data, client.LocalAddr()); err != nil {
+		t.Fatalf("WriteToUDP failed: %v", err)
+	}
+	if _, _, rpcID, _, err := client.Receive(packet.MaxUDPPayloadSize, RoleClient); err != nil || rpcID != 3 {
+		t.Fatalf("Receive failed: rpcID %d, %v", rpcID, err)
+	}
+	if reason, ok := client.TakeDropReason(3); !ok || reason != packet.DropReasonRateLimited {
+		t.Errorf("Expected reason rate_limited, got %v (%v)", reason, ok)
+	}
+	if _, ok := client.TakeDropReason(3); ok {
+		t.Error("Expected the reason to be forgotten once taken")
+	}
+}
@@ -0,0 +1,44 @@
+package transport
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// Ioctls returning the bytes queued in the buffers of a socket (SIOCINQ and SIOCOUTQ of
+// linux/sockios.h, which share the values of the tty ioctls)
+const (
+	siocInQ  = syscall.TIOCINQ
+	siocOutQ = syscall.TIOCOUTQ
+)
+
+// socketQueues returns the occupancy and size of the buffers of conn
+func socketQueues(conn *net.UDPConn) (socketQueueStats, error) {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return socketQueueStats{}, err
+	}
+	var q socketQueueStats
+	var sockErr error
+	err = rc.Control(func(fd uintptr) {
+		var recvQueued, sendQueued int32
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, siocInQ, uintptr(unsafe.Pointer(&recvQueued))); errno != 0 {
+			sockErr = errno
+			return
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, siocOutQ, uintptr(unsafe.Pointer(&sendQueued))); errno != 0 {
+			sockErr = errno
+			return
+		}
+		q.recvQueued, q.sendQueued = int(recvQueued), int(sendQueued)
+		if q.recvBuffer, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF); sockErr != nil {
+			return
+		}
+		q.sendBuffer, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+	})
+	if err != nil {
+		return socketQueueStats{}, err
+	}
+	return q, sockErr
+}
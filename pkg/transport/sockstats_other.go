@@ -0,0 +1,13 @@
+//go:build !linux
+
+package transport
+
+import (
+	"errors"
+	"net"
+)
+
+// socketQueues is only supported on Linux
+func socketQueues(conn *net.UDPConn) (socketQueueStats, error) {
+	return socketQueueStats{}, errors.New("socket queue statistics require Linux")
+}
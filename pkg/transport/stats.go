@@ -0,0 +1,148 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Stats is a snapshot of the counters of a transport since it was created, along with the
+// current occupancy of its socket buffers
+type Stats struct {
+	DatagramsSent     uint64
+	DatagramsReceived uint64
+	BytesSent         uint64
+	BytesReceived     uint64
+	// Retransmits counts datagrams written again after a transient socket error, and
+	// messages fragmented again at a smaller size after EMSGSIZE
+	Retransmits uint64
+	// FragmentsReassembled counts the data fragments passed to reassembly, and
+	// MessagesReassembled the messages they completed
+	FragmentsReassembled uint64
+	MessagesReassembled  uint64
+	// ReassemblyFailures counts received data packets rejected before reassembly (malformed,
+	// unauthenticated or refused by a handler) and reassembled messages that failed to decrypt
+	ReassemblyFailures uint64
+	// PendingReassemblies is the number of messages waiting for more fragments
+	PendingReassemblies int
+	EncryptOps          uint64
+	DecryptOps          uint64
+	// Bytes waiting in the receive and send buffers of the socket, and the size of the buffers.
+	// The send buffers of flow ports (see SetFlowPorts) are included. Queue lengths are only
+	// available on Linux; elsewhere they are 0.
+	SocketRecvQueued int
+	SocketSendQueued int
+	SocketRecvBuffer int
+	SocketSendBuffer int
+}
+
+// transportStats are the counters behind Stats
+type transportStats struct {
+	datagramsSent        atomic.Uint64
+	datagramsReceived    atomic.Uint64
+	bytesSent            atomic.Uint64
+	bytesReceived        atomic.Uint64
+	retransmits          atomic.Uint64
+	fragmentsReassembled atomic.Uint64
+	messagesReassembled  atomic.Uint64
+	reassemblyFailures   atomic.Uint64
+	encryptOps           atomic.Uint64
+	decryptOps           atomic.Uint64
+}
+
+// Stats returns a snapshot of the statistics of the transport
+func (t *UDPTransport) Stats() Stats {
+	s := Stats{
+		DatagramsSent:        t.stats.datagramsSent.Load(),
+		DatagramsReceived:    t.stats.datagramsReceived.Load(),
+		BytesSent:            t.stats.bytesSent.Load(),
+		BytesReceived:        t.stats.bytesReceived.Load(),
+		Retransmits:          t.stats.retransmits.Load(),
+		FragmentsReassembled: t.stats.fragmentsReassembled.Load(),
+		MessagesReassembled:  t.stats.messagesReassembled.Load(),
+		ReassemblyFailures:   t.stats.reassemblyFailures.Load(),
+		PendingReassemblies:  t.reassembler.pending(),
+		EncryptOps:           t.stats.encryptOps.Load(),
+		DecryptOps:           t.stats.decryptOps.Load(),
+	}
+	for i, conn := range append([]*net.UDPConn{t.conn}, t.flowConns...) {
+		q, err := socketQueues(conn)
+		if err != nil {
+			continue
+		}
+		s.SocketSendQueued += q.sendQueued
+		s.SocketSendBuffer += q.sendBuffer
+		if i == 0 {
+			s.SocketRecvQueued, s.SocketRecvBuffer = q.recvQueued, q.recvBuffer
+		}
+	}
+	return s
+}
+
+// socketQueueStats is the occupancy of the buffers of a socket
+type socketQueueStats struct {
+	recvQueued, sendQueued int
+	recvBuffer, sendBuffer int
+}
+
+// WriteMetrics writes the statistics of the transport in the Prometheus text exposition format
+// (see WriteMetrics)
+func (t *UDPTransport) WriteMetrics(w io.Writer) (int64, error) {
+	return WriteMetrics(w, t)
+}
+
+// WriteMetrics writes the statistics of transports in the Prometheus text exposition format,
+// as arpc_transport_* series labeled with the local address of each transport. A process with
+// a client and a server writes both with one call, so that each series has a single header.
+func WriteMetrics(w io.Writer, transports ...*UDPTransport) (int64, error) {
+	stats := make([]Stats, len(transports))
+	addrs := make([]string, len(transports))
+	for i, t := range transports {
+		stats[i] = t.Stats()
+		addrs[i] = strconv.Quote(t.LocalAddr().String())
+	}
+
+	var b strings.Builder
+	write := func(name, kind, help string, value func(*Stats) uint64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for i := range stats {
+			fmt.Fprintf(&b, "%s{transport=%s} %d\n", name, addrs[i], value(&stats[i]))
+		}
+	}
+	write("arpc_transport_datagrams_sent_total", "counter", "Total number of datagrams written to the socket.",
+		func(s *Stats) uint64 { return s.DatagramsSent })
+	write("arpc_transport_datagrams_received_total", "counter", "Total number of datagrams read from the socket.",
+		func(s *Stats) uint64 { return s.DatagramsReceived })
+	write("arpc_transport_sent_bytes_total", "counter", "Total number of bytes written to the socket.",
+		func(s *Stats) uint64 { return s.BytesSent })
+	write("arpc_transport_received_bytes_total", "counter", "Total number of bytes read from the socket.",
+		func(s *Stats) uint64 { return s.BytesReceived })
+	write("arpc_transport_retransmits_total", "counter", "Total number of datagrams and messages sent again after a socket error.",
+		func(s *Stats) uint64 { return s.Retransmits })
+	write("arpc_transport_fragments_reassembled_total", "counter", "Total number of fragments of reassembled messages.",
+		func(s *Stats) uint64 { return s.FragmentsReassembled })
+	write("arpc_transport_messages_reassembled_total", "counter", "Total number of messages reassembled.",
+		func(s *Stats) uint64 { return s.MessagesReassembled })
+	write("arpc_transport_reassembly_failures_total", "counter", "Total number of data packets and messages that failed reassembly.",
+		func(s *Stats) uint64 { return s.ReassemblyFailures })
+	write("arpc_transport_pending_reassemblies", "gauge", "Number of messages waiting for more fragments.",
+		func(s *Stats) uint64 { return uint64(s.PendingReassemblies) })
+	write("arpc_transport_encrypt_ops_total", "counter", "Total number of messages encrypted.",
+		func(s *Stats) uint64 { return s.EncryptOps })
+	write("arpc_transport_decrypt_ops_total", "counter", "Total number of messages decrypted.",
+		func(s *Stats) uint64 { return s.DecryptOps })
+	write("arpc_transport_socket_recv_queued_bytes", "gauge", "Number of bytes waiting in the receive buffer of the socket.",
+		func(s *Stats) uint64 { return uint64(s.SocketRecvQueued) })
+	write("arpc_transport_socket_send_queued_bytes", "gauge", "Number of bytes waiting in the send buffers of the sockets.",
+		func(s *Stats) uint64 { return uint64(s.SocketSendQueued) })
+	write("arpc_transport_socket_recv_buffer_bytes", "gauge", "Size of the receive buffer of the socket.",
+		func(s *Stats) uint64 { return uint64(s.SocketRecvBuffer) })
+	write("arpc_transport_socket_send_buffer_bytes", "gauge", "Size of the send buffers of the sockets.",
+		func(s *Stats) uint64 { return uint64(s.SocketSendBuffer) })
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
@@ -0,0 +1,86 @@
+package transport
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/appnet-org/arpc/pkg/packet"
+)
+
+func TestUDPTransport_Stats(t *testing.T) {
+	server, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create server transport: %v", err)
+	}
+	defer server.Close()
+	client, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create client transport: %v", err)
+	}
+	defer client.Close()
+	server.EnableEncryption()
+	client.EnableEncryption()
+
+	// A public-only message of several fragments
+	payload := make([]byte, 5000)
+	payload[0] = 0x01
+	binary.LittleEndian.PutUint32(payload[1:5], uint32(len(payload)))
+	sent, err := client.SendWithFragmentCount(server.LocalAddr().String(), 1, payload, packet.PacketTypeRequest)
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	for {
+		data, _, _, _, err := server.Receive(packet.MaxUDPPayloadSize, RoleServer)
+		if err != nil {
+			t.Fatalf("Receive failed: %v", err)
+		}
+		if data != nil {
+			break
+		}
+	}
+
+	cs, ss := client.Stats(), server.Stats()
+	if cs.DatagramsSent != uint64(sent) || cs.EncryptOps != 1 || cs.BytesSent == 0 {
+		t.Errorf("Client stats %+v, want %d datagrams sent and 1 encryption", cs, sent)
+	}
+	if ss.DatagramsReceived != uint64(sent) || ss.BytesReceived != cs.BytesSent {
+		t.Errorf("Server received %d datagrams of %d bytes, want %d of %d", ss.DatagramsReceived, ss.BytesReceived, sent, cs.BytesSent)
+	}
+	if ss.FragmentsReassembled != uint64(sent) || ss.MessagesReassembled != 1 || ss.DecryptOps != 1 || ss.PendingReassemblies != 0 {
+		t.Errorf("Server stats %+v, want %d fragments of 1 decrypted message", ss, sent)
+	}
+	if ss.SocketRecvBuffer == 0 || ss.SocketSendBuffer == 0 {
+		t.Errorf("Server socket buffers of %d/%d bytes, want their sizes", ss.SocketRecvBuffer, ss.SocketSendBuffer)
+	}
+
+	// A malformed data packet fails before reassembly
+	if _, err := client.GetConn().WriteToUDP([]byte{byte(packet.PacketTypeRequest.TypeID), 1, 2}, server.LocalAddr()); err != nil {
+		t.Fatalf("WriteToUDP failed: %v", err)
+	}
+	if _, _, _, _, err := server.Receive(packet.MaxUDPPayloadSize, RoleServer); err == nil {
+		t.Fatal("Expected an error for a malformed packet")
+	}
+	if failures := server.Stats().ReassemblyFailures; failures != 1 {
+		t.Errorf("Expected 1 reassembly failure, got %d", failures)
+	}
+
+	var b strings.Builder
+	if _, err := WriteMetrics(&b, client, server); err != nil {
+		t.Fatalf("WriteMetrics failed: %v", err)
+	}
+	out := b.String()
+	for _, line := range []string{
+		"# TYPE arpc_transport_datagrams_sent_total counter\n",
+		`arpc_transport_encrypt_ops_total{transport="` + client.LocalAddr().String() + `"} 1` + "\n",
+		`arpc_transport_messages_reassembled_total{transport="` + server.LocalAddr().String() + `"} 1` + "\n",
+		`arpc_transport_reassembly_failures_total{transport="` + server.LocalAddr().String() + `"} 1` + "\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("Missing line %q in output:\n%s", line, out)
+		}
+	}
+	if n := strings.Count(out, "# TYPE arpc_transport_pending_reassemblies gauge\n"); n != 1 {
+		t.Errorf("Expected one header per series, got %d", n)
+	}
+}
@@ -1,13 +1,20 @@
 package transport
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
 	"net"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/appnet-org/arpc/pkg/allocaudit"
 	"github.com/appnet-org/arpc/pkg/common"
 	"github.com/appnet-org/arpc/pkg/logging"
 	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/schema"
 	"github.com/appnet-org/arpc/pkg/transport/balancer"
 	"go.uber.org/zap"
 )
@@ -17,8 +24,14 @@ func GenerateRPCID() uint64 {
 	return uint64(time.Now().UnixNano())
 }
 
+// socketBufferSize is the send and receive buffer size of the sockets of a transport. For
+// large messages that fragment into many packets, we need larger buffers to prevent packet
+// loss when sending/receiving many packets quickly.
+const socketBufferSize = 8 * 1024 * 1024 // 8MB
+
 type UDPTransport struct {
 	conn         *net.UDPConn
+	flowConns    []*net.UDPConn // send-only sockets picked by RPC ID (see SetFlowPorts)
 	reassembler  *DataReassembler
 	resolver     *balancer.Resolver
 	handlers     *HandlerRegistry
@@ -29,6 +42,59 @@ type UDPTransport struct {
 	encryptionEnabled bool
 	publicKey         []byte
 	privateKey        []byte
+	// With chunked encryption (see SetChunkedEncryption), the registry whose schemas private
+	// segments are chunked by. With lazy decryption, sealed holds the sealed messages of received
+	// requests until taken with TakeSealedMessage.
+	chunkRegistry  *schema.Registry
+	lazyDecryption bool
+	sealed         map[uint64]*SealedMessage
+	sealedMu       sync.Mutex
+	// strictMode rejects data packets without valid security extensions
+	strictMode bool
+	// Retry hints of received error packets, kept until taken with TakeRetryHint
+	retryHints   map[uint64]packet.RetryHint
+	retryHintsMu sync.Mutex
+	// Drop reasons of received error packets, kept until taken with TakeDropReason
+	dropReasons   map[uint64]packet.DropReason
+	dropReasonsMu sync.Mutex
+	// recvLimit is advertised in the ExtensionRecvLimit extension of outgoing requests (0: none).
+	// recvLimits holds the limits of received requests until taken with TakeRecvLimit.
+	recvLimit    uint32
+	recvLimits   map[uint64]uint32
+	recvLimitsMu sync.Mutex
+	// userAgent is advertised in the ExtensionUserAgent extension of outgoing requests ("": none).
+	// userAgents holds the user agents of received requests until taken with TakeUserAgent.
+	userAgent    string
+	userAgents   map[uint64]string
+	userAgentsMu sync.Mutex
+	// Origins of received requests, kept until taken with TakeOrigin
+	origins   map[uint64]packet.Origin
+	originsMu sync.Mutex
+	// Relays the RPCs to a destination are sent through (see SetRelay), by destination address
+	relays   map[string]relayRoute
+	relaysMu sync.RWMutex
+	// With encryption enabled, whether every fragment of a received request carried valid
+	// security extensions, kept until taken with TakeAuthenticated
+	authenticated   map[uint64]bool
+	authenticatedMu sync.Mutex
+	// With encryption disabled, the received messages that their sender encrypted (see
+	// SendWithProfile), kept until taken with TakeCallEncrypted
+	callEncrypted   map[uint64]bool
+	callEncryptedMu sync.Mutex
+	// ICMP errors (see EnableICMPErrors): errors harvested but not returned by Receive yet,
+	// and the path MTUs learned from fragmentation-needed errors
+	icmpEnabled bool
+	icmpPending []*ICMPError
+	icmpMu      sync.Mutex
+	pathMTUs    sync.Map // destination address string -> int
+	// NAT traversal (see ConnectPeer): transactions in progress and paths to peers
+	nat *natState
+	// Counters behind Stats
+	stats transportStats
+	// Fault injection for tests (see SetFaultInjector), and the number of writes it decided
+	faults     FaultInjector
+	faultIndex int
+	faultsMu   sync.Mutex
 }
 
 func NewUDPTransport(address string) (*UDPTransport, error) {
@@ -68,9 +134,6 @@ func NewUDPTransportWithBalancer(address string, resolver *balancer.Resolver) (*
 	}
 
 	// Set UDP socket buffer sizes to handle large bursts of packets
-	// For large messages that fragment into many packets, we need larger buffers
-	// to prevent packet loss when sending/receiving many packets quickly
-	const socketBufferSize = 8 * 1024 * 1024 // 8MB for both send and receive
 	if err := conn.SetReadBuffer(socketBufferSize); err != nil {
 		logging.Warn("Failed to set UDP read buffer size", zap.Error(err))
 	}
@@ -79,12 +142,22 @@ func NewUDPTransportWithBalancer(address string, resolver *balancer.Resolver) (*
 	}
 
 	transport := &UDPTransport{
-		conn:         conn,
-		reassembler:  NewDataReassembler(),
-		resolver:     resolver,
-		handlers:     nil, // Will be set after transport is created
-		timerManager: NewTimerManager(),
-		bufferPool:   common.NewBufferPool(65536), // Default to 64KB buffer size
+		conn:          conn,
+		reassembler:   NewDataReassembler(),
+		resolver:      resolver,
+		handlers:      nil, // Will be set after transport is created
+		timerManager:  NewTimerManager(),
+		bufferPool:    common.NewBufferPool(65536), // Default to 64KB buffer size
+		retryHints:    make(map[uint64]packet.RetryHint),
+		dropReasons:   make(map[uint64]packet.DropReason),
+		recvLimits:    make(map[uint64]uint32),
+		userAgents:    make(map[uint64]string),
+		origins:       make(map[uint64]packet.Origin),
+		relays:        make(map[string]relayRoute),
+		authenticated: make(map[uint64]bool),
+		callEncrypted: make(map[uint64]bool),
+		sealed:        make(map[uint64]*SealedMessage),
+		nat:           newNATState(),
 	}
 
 	// Set buffer pool in reassembler so it can return buffers after reassembly
@@ -108,10 +181,37 @@ func ResolveUDPTarget(addr string) (*net.UDPAddr, error) {
 }
 
 func (t *UDPTransport) Send(addr string, rpcID uint64, data []byte, packetType packet.PacketType) error {
+	_, err := t.SendWithFragmentCount(addr, rpcID, data, packetType)
+	return err
+}
+
+// SendWithFragmentCount sends data like Send and also returns the number of packets written to the socket
+func (t *UDPTransport) SendWithFragmentCount(addr string, rpcID uint64, data []byte, packetType packet.PacketType) (int, error) {
+	return t.send(addr, rpcID, data, packetType, t.encryptionEnabled, nil)
+}
+
+// send sends data, encrypting requests and responses if encrypt is set, with origin in the
+// ExtensionOrigin extension of requests if not nil
+func (t *UDPTransport) send(addr string, rpcID uint64, data []byte, packetType packet.PacketType, encrypt bool, origin *packet.Origin) (int, error) {
+	sent := 0
+	publicKey, privateKey := t.publicKey, t.privateKey
+	if !t.encryptionEnabled {
+		publicKey, privateKey = DefaultPublicKey, DefaultPrivateKey
+	}
+
 	// Use the transport's resolver instead of the global function
 	udpAddr, err := t.resolver.ResolveUDPTarget(addr)
 	if err != nil {
-		return err
+		return sent, err
+	}
+
+	// RPCs to peers reached through a relay are addressed to it, with the peer in the
+	// relay extension
+	var relayExt *packet.Extension
+	if route, ok := t.relayFor(udpAddr); ok && (packetType == packet.PacketTypeRequest || packetType == packet.PacketTypeResponse) {
+		ext := route.extension(udpAddr)
+		relayExt = &ext
+		udpAddr = route.relay
 	}
 
 	// Extract destination IP and port
@@ -129,28 +229,64 @@ func (t *UDPTransport) Send(addr string, rpcID uint64, data []byte, packetType p
 		copy(srcIP[:], ip4)
 	}
 	srcPort := uint16(localAddr.Port)
+	// Peers behind NATs answer to the address they see the transport at
+	if source, _, ok := t.natRoute(udpAddr); ok && source != nil {
+		copy(srcIP[:], source.IP.To4())
+		srcPort = uint16(source.Port)
+	}
 
 	// Only DataPackets (Request/Response) use Symphony fragmentation
 	// All other packet types use the old FragmentData approach
 	if packetType == packet.PacketTypeRequest || packetType == packet.PacketTypeResponse {
 		// Encrypt data if encryption is enabled
-		if t.encryptionEnabled {
+		if encrypt {
 			logging.Debug("Encrypting data before send",
 				zap.Uint64("rpcID", rpcID),
 				zap.Int("originalSize", len(data)))
-			data = EncryptSymphonyData(data, t.publicKey, t.privateKey)
+			t.stats.encryptOps.Add(1)
+			if t.chunkRegistry != nil && t.encryptionEnabled {
+				data = EncryptChunkedSymphonyData(data, publicKey, privateKey, t.privateBoundaries(data, packetType))
+			} else {
+				data = EncryptSymphonyData(data, publicKey, privateKey)
+			}
 			logging.Debug("Data encrypted",
 				zap.Uint64("rpcID", rpcID),
 				zap.Int("encryptedSize", len(data)))
 		}
+		// Fragment again at a smaller size if the kernel rejects a datagram as too large
+	refragment:
 		// Calculate effective MTU (subtract DataPacket header overhead)
-		const dataPacketHeaderSize = 31                                 // 1+8+2+2+1+1+4+2+4+2+4 bytes
-		effectiveMTU := packet.MaxUDPPayloadSize - dataPacketHeaderSize // 1400 - 31 = 1369
+		effectiveMTU := t.maxDatagramSize(udpAddr) - packet.DataPacketHeaderSize // 1400 - 31 = 1369
+		if encrypt {
+			effectiveMTU -= SecurityExtensionsSize
+		}
+		advertiseLimit := packetType == packet.PacketTypeRequest && t.recvLimit > 0
+		if advertiseLimit {
+			effectiveMTU -= recvLimitExtensionSize
+		}
+		advertiseUserAgent := packetType == packet.PacketTypeRequest && t.userAgent != ""
+		if advertiseUserAgent {
+			effectiveMTU -= 2 + len(t.userAgent)
+		}
+		if relayExt != nil {
+			effectiveMTU -= relayExtensionSize
+		}
+		var originValue []byte
+		if packetType == packet.PacketTypeRequest && origin != nil {
+			effectiveMTU -= originExtensionSize
+			originValue = origin.Value()
+		}
 
 		// Use FragmentPackets for intelligent head/tail-aligned fragmentation
 		fragments, err := FragmentPackets(data, effectiveMTU)
 		if err != nil {
-			return err
+			return sent, err
+		}
+		// The fragment count does not fit the header beyond this, so the receiver would
+		// wait forever for the rest of the message
+		if len(fragments) > math.MaxUint16 {
+			return sent, fmt.Errorf("%w: %d bytes need %d fragments of %d bytes (at most %d)",
+				ErrMessageTooLarge, len(data), len(fragments), effectiveMTU, math.MaxUint16)
 		}
 
 		totalPackets := uint16(len(fragments))
@@ -171,76 +307,123 @@ func (t *UDPTransport) Send(addr string, rpcID uint64, data []byte, packetType p
 				SrcPort:       srcPort,
 				Payload:       fragment,
 			}
+			if advertiseLimit {
+				pkt.SetExtension(packet.ExtensionRecvLimit, binary.LittleEndian.AppendUint32(nil, t.recvLimit))
+			}
+			if advertiseUserAgent {
+				pkt.SetExtension(packet.ExtensionUserAgent, []byte(t.userAgent))
+			}
+			if relayExt != nil {
+				pkt.SetExtension(relayExt.Type, relayExt.Value)
+			}
+			if originValue != nil {
+				pkt.SetExtension(packet.ExtensionOrigin, originValue)
+			}
+			if encrypt {
+				AddSecurityExtensions(pkt, publicKey)
+			}
 
 			// Get handler chain and process
 			handler, exists := t.handlers.GetHandlerChain(packetType.TypeID, RoleClient)
 			if !exists {
-				return fmt.Errorf("no handler chain found for packet type: %s", packetType.Name)
+				return sent, fmt.Errorf("no handler chain found for packet type: %s", packetType.Name)
 			}
 
 			if err := handler.OnSend(pkt, udpAddr); err != nil {
-				return fmt.Errorf("handler processing failed: %w", err)
+				return sent, fmt.Errorf("handler processing failed: %w", err)
 			}
 
 			// Serialize and send
 			packetData, err := packet.SerializePacket(pkt, packetType, t.bufferPool)
 			logging.Debug("Serialized packet", zap.Uint64("rpcID", rpcID), zap.Int("size", len(packetData)))
 			if err != nil {
-				return err
+				return sent, err
 			}
 
-			_, err = t.conn.WriteToUDP(packetData, udpAddr)
-			logging.Debug("Sent packet", zap.Uint64("rpcID", rpcID), zap.Int("size", len(packetData)))
+			size := len(packetData)
+			err = t.writeDatagram(packetData, udpAddr, rpcID)
+			logging.Debug("Sent packet", zap.Uint64("rpcID", rpcID), zap.Int("size", size))
 
 			// Return buffer to pool after sending (WriteToUDP copies the data, so it's safe)
 			t.bufferPool.Put(packetData)
 
 			if err != nil {
-				return err
+				// Fragments already sent carry the old packet count, so the message can only
+				// be fragmented again if none was. Otherwise the caller's retry uses the new size.
+				if errors.Is(err, syscall.EMSGSIZE) && t.lowerPathMTU(udpAddr, size) && sent == 0 {
+					logging.Debug("Datagram too large, fragmenting again", zap.Uint64("rpcID", rpcID), zap.Int("size", size))
+					t.stats.retransmits.Add(1)
+					goto refragment
+				}
+				return sent, &SendError{Dst: udpAddr, RPCID: rpcID, Seq: seqNum, Total: len(fragments), Err: err}
 			}
+			sent++
 		}
 
-		return nil
+		return sent, nil
 	}
 
 	// For all other packet types, use the old FragmentData approach
 	packets, err := t.reassembler.FragmentData(data, rpcID, packetType, dstIP, dstPort, srcIP, srcPort)
 	if err != nil {
-		return err
+		return sent, err
 	}
 
 	// Iterate through each packet and send it via the UDP connection
-	for _, pkt := range packets {
-		// Get the handler chain for this packet type
-		handler, exists := t.handlers.GetHandlerChain(packetType.TypeID, RoleClient)
-		if !exists {
-			return fmt.Errorf("no handler chain found for packet type: %s", packetType.Name)
+	for seqNum, pkt := range packets {
+		if err := t.sendPacket(pkt, rpcID, packetType, udpAddr); err != nil {
+			return sent, &SendError{Dst: udpAddr, RPCID: rpcID, Seq: seqNum, Total: len(packets), Err: err}
 		}
+		sent++
+	}
 
-		// Process the packet through OnSend handlers before sending
-		if err := handler.OnSend(pkt, udpAddr); err != nil {
-			return fmt.Errorf("handler processing failed: %w", err)
-		}
+	return sent, nil
+}
 
-		// Serialize the packet into a byte slice for transmission using buffer pool
-		packetData, err := packet.SerializePacket(pkt, packetType, t.bufferPool)
-		logging.Debug("Serialized packet", zap.Uint64("rpcID", rpcID), zap.Int("size", len(packetData)))
-		if err != nil {
-			return err
-		}
+// SendErrorWithHint sends an error packet carrying a retry hint, which the client's
+// retry policy uses to back off instead of retrying immediately
+func (t *UDPTransport) SendErrorWithHint(addr string, rpcID uint64, errMsg string, packetType packet.PacketType, hint packet.RetryHint) error {
+	udpAddr, err := t.resolver.ResolveUDPTarget(addr)
+	if err != nil {
+		return err
+	}
 
-		_, err = t.conn.WriteToUDP(packetData, udpAddr)
-		logging.Debug("Sent packet", zap.Uint64("rpcID", rpcID), zap.Int("size", len(packetData)))
+	pkt := &packet.ErrorPacket{
+		PacketTypeID: packetType.TypeID,
+		RPCID:        rpcID,
+		ErrorMsg:     errMsg,
+		RetryHint:    hint,
+	}
+	return t.sendPacket(pkt, rpcID, packetType, udpAddr)
+}
 
-		// Return buffer to pool after sending (WriteToUDP copies the data, so it's safe)
-		t.bufferPool.Put(packetData)
+// sendPacket runs a single non-data packet through the OnSend handlers, serializes it and writes it to the socket
+func (t *UDPTransport) sendPacket(pkt any, rpcID uint64, packetType packet.PacketType, udpAddr *net.UDPAddr) error {
+	// Get the handler chain for this packet type
+	handler, exists := t.handlers.GetHandlerChain(packetType.TypeID, RoleClient)
+	if !exists {
+		return fmt.Errorf("no handler chain found for packet type: %s", packetType.Name)
+	}
 
-		if err != nil {
-			return err
-		}
+	// Process the packet through OnSend handlers before sending
+	if err := handler.OnSend(pkt, udpAddr); err != nil {
+		return fmt.Errorf("handler processing failed: %w", err)
 	}
 
-	return nil
+	// Serialize the packet into a byte slice for transmission using buffer pool
+	packetData, err := packet.SerializePacket(pkt, packetType, t.bufferPool)
+	logging.Debug("Serialized packet", zap.Uint64("rpcID", rpcID), zap.Int("size", len(packetData)))
+	if err != nil {
+		return err
+	}
+
+	err = t.writeDatagram(packetData, udpAddr, rpcID)
+	logging.Debug("Sent packet", zap.Uint64("rpcID", rpcID), zap.Int("size", len(packetData)))
+
+	// Return buffer to pool after sending (WriteToUDP copies the data, so it's safe)
+	t.bufferPool.Put(packetData)
+
+	return err
 }
 
 // Receive takes a buffer size as input, read data from the UDP socket, and return
@@ -250,16 +433,33 @@ func (t *UDPTransport) Send(addr string, rpcID uint64, data []byte, packetType p
 // * RPC id
 // * packet type
 // * error
+//
+// If ICMP errors are enabled, an *ICMPError is returned as error for a datagram of ours that
+// could not be delivered, with the destination and RPC ID of the datagram.
 func (t *UDPTransport) Receive(bufferSize int, role Role) ([]byte, *net.UDPAddr, uint64, packet.PacketType, error) {
+	if icmpErr, rpcID := t.nextICMPError(); icmpErr != nil {
+		return nil, icmpErr.Dst, rpcID, packet.PacketTypeUnknown, icmpErr
+	}
+
 	// Get a buffer from the pool with at least the requested size
 	buffer := t.bufferPool.GetSize(bufferSize)
 
 	n, addr, err := t.conn.ReadFromUDP(buffer)
+	mark := allocaudit.Start()
 	if err != nil {
 		// Return buffer to pool on error
 		t.bufferPool.Put(buffer)
+		// A queued ICMP error interrupts the read; return it instead
+		if t.icmpEnabled {
+			t.harvestICMPErrors()
+			if icmpErr, rpcID := t.nextICMPError(); icmpErr != nil {
+				return nil, icmpErr.Dst, rpcID, packet.PacketTypeUnknown, icmpErr
+			}
+		}
 		return nil, nil, 0, packet.PacketTypeUnknown, err
 	}
+	t.stats.datagramsReceived.Add(1)
+	t.stats.bytesReceived.Add(uint64(n))
 
 	// Deserialize the received data using transport's packet registry
 	// (not DefaultRegistry, which doesn't have custom packets like ACK)
@@ -269,6 +469,11 @@ func (t *UDPTransport) Receive(bufferSize int, role Role) ([]byte, *net.UDPAddr,
 	}
 
 	packetTypeID := packet.PacketTypeID(buffer[0])
+	if packetTypeID == NATPacketTypeID {
+		t.handleNATMessage(buffer[:n], addr)
+		t.bufferPool.Put(buffer)
+		return nil, nil, 0, packet.PacketTypeUnknown, nil
+	}
 	codec, exists := t.packets.GetCodec(packetTypeID)
 	if !exists {
 		t.bufferPool.Put(buffer)
@@ -278,12 +483,28 @@ func (t *UDPTransport) Receive(bufferSize int, role Role) ([]byte, *net.UDPAddr,
 	// Deserialize from the buffer (uses zero-copy slices, so buffer must stay alive)
 	pkt, err := codec.Deserialize(buffer[:n])
 	if err != nil {
+		if packetTypeID == packet.PacketTypeRequest.TypeID || packetTypeID == packet.PacketTypeResponse.TypeID {
+			t.stats.reassemblyFailures.Add(1)
+		}
 		t.bufferPool.Put(buffer)
 		return nil, nil, 0, packet.PacketTypeUnknown, err
 	}
 
 	packetType, _ := t.packets.GetPacketType(packetTypeID)
 
+	// In strict mode, reject data packets that were not sent with encryption enabled
+	if dataPkt, ok := pkt.(*packet.DataPacket); ok && t.strictMode {
+		if err := VerifySecurityExtensions(dataPkt.Extensions, dataPkt.PacketTypeID, dataPkt.RPCID, t.publicKey); err != nil {
+			t.stats.reassemblyFailures.Add(1)
+			t.bufferPool.Put(buffer)
+			logging.Warn("Rejected packet in strict mode",
+				zap.Uint64("rpcID", dataPkt.RPCID),
+				zap.String("from", addr.String()),
+				zap.Error(err))
+			return nil, nil, 0, packetType, err
+		}
+	}
+
 	// Use the handler registry to process the packet
 	handler, exists := t.handlers.GetHandlerChain(packetType.TypeID, role)
 	if !exists {
@@ -299,6 +520,8 @@ func (t *UDPTransport) Receive(bufferSize int, role Role) ([]byte, *net.UDPAddr,
 		// For non-DataPackets, return buffer immediately since we don't need to keep it
 		if _, ok := pkt.(*packet.DataPacket); !ok {
 			t.bufferPool.Put(buffer)
+		} else {
+			t.stats.reassemblyFailures.Add(1)
 		}
 		return nil, nil, 0, packetType, fmt.Errorf("handler processing failed: %w", err)
 	}
@@ -306,11 +529,46 @@ func (t *UDPTransport) Receive(bufferSize int, role Role) ([]byte, *net.UDPAddr,
 	// Handle different packet types based on their nature
 	switch p := pkt.(type) {
 	case *packet.DataPacket:
+		if limit, ok := p.GetExtension(packet.ExtensionRecvLimit); ok && len(limit) == 4 && p.PacketTypeID == packet.PacketTypeRequest.TypeID {
+			t.recvLimitsMu.Lock()
+			t.recvLimits[p.RPCID] = binary.LittleEndian.Uint32(limit)
+			t.recvLimitsMu.Unlock()
+		}
+		if userAgent, ok := p.GetExtension(packet.ExtensionUserAgent); ok && p.PacketTypeID == packet.PacketTypeRequest.TypeID {
+			t.userAgentsMu.Lock()
+			t.userAgents[p.RPCID] = string(userAgent)
+			t.userAgentsMu.Unlock()
+		}
+		if origin, ok := packet.FindOrigin(p.Extensions); ok && p.PacketTypeID == packet.PacketTypeRequest.TypeID {
+			t.originsMu.Lock()
+			t.origins[p.RPCID] = origin
+			t.originsMu.Unlock()
+		}
+		if t.encryptionEnabled && p.PacketTypeID == packet.PacketTypeRequest.TypeID {
+			valid := VerifySecurityExtensions(p.Extensions, p.PacketTypeID, p.RPCID, t.publicKey) == nil
+			t.authenticatedMu.Lock()
+			if prev, ok := t.authenticated[p.RPCID]; ok {
+				valid = valid && prev
+			}
+			t.authenticated[p.RPCID] = valid
+			t.authenticatedMu.Unlock()
+		}
 		// Pass buffer to reassembler - it will return it to pool after reassembly
+		defer mark.Stop(allocaudit.PathReceive, p.RPCID, 1)
 		return t.ReassembleDataPacket(p, addr, packetType, buffer)
 	case *packet.ErrorPacket:
 		// ErrorPacket doesn't need buffer kept alive, return it now
 		t.bufferPool.Put(buffer)
+		if !p.RetryHint.IsZero() {
+			t.retryHintsMu.Lock()
+			t.retryHints[p.RPCID] = p.RetryHint
+			t.retryHintsMu.Unlock()
+		}
+		if p.DropReason != packet.DropReasonNone {
+			t.dropReasonsMu.Lock()
+			t.dropReasons[p.RPCID] = p.DropReason
+			t.dropReasonsMu.Unlock()
+		}
 		return []byte(p.ErrorMsg), addr, p.RPCID, packetType, nil
 	default:
 		// Unknown packet type - return buffer and return early with no data
@@ -320,20 +578,133 @@ func (t *UDPTransport) Receive(bufferSize int, role Role) ([]byte, *net.UDPAddr,
 	}
 }
 
+// TakeRetryHint returns and forgets the retry hint of the last error packet received for
+// an RPC. Receivers of error packets should call it for every error packet returned by
+// Receive so that hints do not accumulate.
+func (t *UDPTransport) TakeRetryHint(rpcID uint64) (packet.RetryHint, bool) {
+	t.retryHintsMu.Lock()
+	defer t.retryHintsMu.Unlock()
+
+	hint, ok := t.retryHints[rpcID]
+	if ok {
+		delete(t.retryHints, rpcID)
+	}
+	return hint, ok
+}
+
+// TakeDropReason returns and forgets the drop reason of the last error packet received for
+// an RPC, like TakeRetryHint
+func (t *UDPTransport) TakeDropReason(rpcID uint64) (packet.DropReason, bool) {
+	t.dropReasonsMu.Lock()
+	defer t.dropReasonsMu.Unlock()
+
+	reason, ok := t.dropReasons[rpcID]
+	if ok {
+		delete(t.dropReasons, rpcID)
+	}
+	return reason, ok
+}
+
+// SetRecvLimit advertises limit, in bytes, as the largest response this transport accepts,
+// in the ExtensionRecvLimit extension of every request it sends. 0 stops advertising.
+func (t *UDPTransport) SetRecvLimit(limit int) {
+	t.recvLimit = uint32(min(max(limit, 0), math.MaxUint32))
+}
+
+// TakeRecvLimit returns and forgets the receive limit advertised by the client of a
+// request. Servers should call it for every request returned by Receive so that limits
+// do not accumulate.
+func (t *UDPTransport) TakeRecvLimit(rpcID uint64) (int, bool) {
+	t.recvLimitsMu.Lock()
+	defer t.recvLimitsMu.Unlock()
+
+	limit, ok := t.recvLimits[rpcID]
+	if ok {
+		delete(t.recvLimits, rpcID)
+	}
+	return int(limit), ok
+}
+
+// SetUserAgent advertises userAgent, of at most packet.MaxUserAgentSize bytes, in the
+// ExtensionUserAgent extension of every request this transport sends. "" stops advertising.
+func (t *UDPTransport) SetUserAgent(userAgent string) error {
+	if len(userAgent) > packet.MaxUserAgentSize {
+		return fmt.Errorf("user agent %q exceeds %d bytes", userAgent, packet.MaxUserAgentSize)
+	}
+	t.userAgent = userAgent
+	return nil
+}
+
+// TakeUserAgent returns and forgets the user agent advertised by the client of a request.
+// Servers should call it for every request returned by Receive so that user agents do not
+// accumulate.
+func (t *UDPTransport) TakeUserAgent(rpcID uint64) (string, bool) {
+	t.userAgentsMu.Lock()
+	defer t.userAgentsMu.Unlock()
+
+	userAgent, ok := t.userAgents[rpcID]
+	if ok {
+		delete(t.userAgents, rpcID)
+	}
+	return userAgent, ok
+}
+
+// TakeAuthenticated reports and forgets whether every fragment of a request carried valid
+// security extensions of the transport's key, which is only checked with encryption enabled.
+// Servers should call it for every request returned by Receive so that records do not
+// accumulate.
+func (t *UDPTransport) TakeAuthenticated(rpcID uint64) bool {
+	t.authenticatedMu.Lock()
+	defer t.authenticatedMu.Unlock()
+
+	valid := t.authenticated[rpcID]
+	delete(t.authenticated, rpcID)
+	return valid
+}
+
 // ReassembleDataPacket processes data packets through the reassembly layer
 // buffer is the original buffer containing the packet data - it will be returned to pool after reassembly
 func (t *UDPTransport) ReassembleDataPacket(pkt *packet.DataPacket, addr *net.UDPAddr, packetType packet.PacketType, buffer []byte) ([]byte, *net.UDPAddr, uint64, packet.PacketType, error) {
 	// Process fragment through reassembly layer
 	// Pass buffer so reassembler can keep it alive until reassembly completes
 	fullMessage, _, reassembledRPCID, isComplete := t.reassembler.ProcessFragment(pkt, addr, buffer)
+	t.stats.fragmentsReassembled.Add(1)
 
 	if isComplete {
-		// Decrypt data if encryption is enabled
+		t.stats.messagesReassembled.Add(1)
+		// Decrypt data if encryption is enabled, or if the sender encrypted this message only
+		// (see SendWithProfile)
+		if !t.encryptionEnabled && callEncrypted(pkt) {
+			if err := InitDefaultGCMObjects(); err != nil {
+				return nil, nil, 0, packetType, err
+			}
+			t.stats.decryptOps.Add(1)
+			fullMessage = DecryptSymphonyData(fullMessage, DefaultPublicKey, DefaultPrivateKey)
+			t.callEncryptedMu.Lock()
+			t.callEncrypted[reassembledRPCID] = true
+			t.callEncryptedMu.Unlock()
+		}
 		if t.encryptionEnabled {
+			t.stats.decryptOps.Add(1)
 			logging.Debug("Decrypting received data",
 				zap.Uint64("rpcID", reassembledRPCID),
 				zap.Int("encryptedSize", len(fullMessage)))
-			fullMessage = DecryptSymphonyData(fullMessage, t.publicKey, t.privateKey)
+			switch {
+			case t.lazyDecryption && packetType == packet.PacketTypeRequest:
+				sealed, err := OpenChunkedSymphonyData(fullMessage, t.publicKey, t.privateKey)
+				if err != nil {
+					t.stats.reassemblyFailures.Add(1)
+					return nil, nil, 0, packetType, err
+				}
+				t.sealedMu.Lock()
+				t.sealed[reassembledRPCID] = sealed
+				t.sealedMu.Unlock()
+				fullMessage = sealed.Data
+			case t.chunkRegistry != nil:
+				fullMessage = DecryptChunkedSymphonyData(fullMessage, t.publicKey, t.privateKey)
+			default:
+				fullMessage = DecryptSymphonyData(fullMessage, t.publicKey, t.privateKey)
+			}
 			logging.Debug("Data decrypted",
 				zap.Uint64("rpcID", reassembledRPCID),
 				zap.Int("decryptedSize", len(fullMessage)))
@@ -355,6 +726,11 @@ func (t *UDPTransport) ReassembleDataPacket(pkt *packet.DataPacket, addr *net.UD
 func (t *UDPTransport) Close() error {
 	// Stop the timer manager before closing the connection
 	t.timerManager.Stop()
+	// Flow ports are closed but kept, since sends may still be in flight: they fail like
+	// those on the closed socket of the transport
+	for _, conn := range t.flowConns {
+		conn.Close()
+	}
 	return t.conn.Close()
 }
 
@@ -442,13 +818,32 @@ func (t *UDPTransport) EnableEncryption() {
 	t.SetEncryptionKeys(nil, nil)
 }
 
-// DisableEncryption disables encryption
+// DisableEncryption disables encryption (and strict mode, which depends on it)
 func (t *UDPTransport) DisableEncryption() {
 	t.encryptionEnabled = false
+	t.strictMode = false
+	t.lazyDecryption = false
 	t.publicKey = nil
 	t.privateKey = nil
 }
 
+// SetStrictMode enables or disables strict mode. In strict mode, data packets without the
+// key ID and auth tag extensions of the local key are rejected with ErrDowngrade instead of
+// being processed, so a peer that silently falls back to plaintext is detected.
+// Encryption must be enabled first.
+func (t *UDPTransport) SetStrictMode(enabled bool) error {
+	if enabled && !t.encryptionEnabled {
+		return errors.New("strict mode requires encryption to be enabled")
+	}
+	t.strictMode = enabled
+	return nil
+}
+
+// IsStrictMode returns whether strict mode is enabled
+func (t *UDPTransport) IsStrictMode() bool {
+	return t.strictMode
+}
+
 // IsEncryptionEnabled returns whether encryption is currently enabled
 func (t *UDPTransport) IsEncryptionEnabled() bool {
 	return t.encryptionEnabled
@@ -0,0 +1,238 @@
+package xds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/appnet-org/arpc/pkg/logging"
+	"github.com/appnet-org/arpc/pkg/transport/balancer"
+	"go.uber.org/zap"
+)
+
+// restPaths are the REST-JSON discovery endpoints of each resource type, fetched in order:
+// endpoints are requested for the EDS clusters of the clusters response
+var restPaths = []struct{ typeURL, path string }{
+	{ClusterType, "v3/discovery:clusters"},
+	{EndpointType, "v3/discovery:endpoints"},
+	{RouteType, "v3/discovery:routes"},
+}
+
+// discoveryRequest is the body of a REST discovery request. It acknowledges the last version
+// accepted, and carries the reason of a rejection (nack), if any.
+type discoveryRequest struct {
+	VersionInfo   string       `json:"versionInfo,omitempty"`
+	Node          node         `json:"node"`
+	ResourceNames []string     `json:"resourceNames,omitempty"`
+	TypeURL       string       `json:"typeUrl"`
+	ResponseNonce string       `json:"responseNonce,omitempty"`
+	ErrorDetail   *errorDetail `json:"errorDetail,omitempty"`
+}
+
+type node struct {
+	ID string `json:"id"`
+}
+
+// errorDetail is a google.rpc.Status
+type errorDetail struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// typeState is what a client knows of the responses of a resource type
+type typeState struct {
+	accepted string       // version of the last response applied
+	nonce    string       // of the last response
+	rejected string       // version of the last response that failed to apply
+	nack     *errorDetail // why it failed, sent with the next request
+}
+
+// Client fetches resources from an xDS management server with the REST-JSON protocol of
+// Envoy (POST <url>/v3/discovery:<type>) and passes complete snapshots to a callback:
+// clusters first, then the endpoints of EDS clusters, then route configurations. Every
+// request acknowledges the last version applied of its type, or reports why the last one
+// received was rejected.
+type Client struct {
+	url    *url.URL
+	node   string
+	routes []string // route configurations to request, all if empty
+	client *http.Client
+
+	mu       sync.Mutex
+	state    map[string]*typeState
+	snapshot *Snapshot // last snapshot applied
+}
+
+// NewClient creates a client of the management server at rawURL for the given node, that
+// requests the named route configurations, or all of them if none are given.
+func NewClient(rawURL, nodeID string, routes ...string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid xDS server URL %q: expected http://host:port[/path]", rawURL)
+	}
+	state := make(map[string]*typeState)
+	for _, p := range restPaths {
+		state[p.typeURL] = &typeState{}
+	}
+	return &Client{
+		url:      u,
+		node:     nodeID,
+		routes:   routes,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		state:    state,
+		snapshot: NewSnapshot(),
+	}, nil
+}
+
+// Snapshot returns the last snapshot applied
+func (c *Client) Snapshot() *Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.snapshot
+}
+
+// Run polls the management server every interval until ctx is done, and calls apply with
+// each new snapshot. A snapshot apply returns an error for is rejected, and the last one
+// applied stays in effect.
+func (c *Client) Run(ctx context.Context, interval time.Duration, apply func(*Snapshot) error) {
+	for {
+		if err := c.Poll(ctx, apply); err != nil && ctx.Err() == nil {
+			logging.Warn("Failed to poll the xDS server", zap.String("url", c.url.String()), zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Poll fetches every resource type once, and calls apply if any of them changed
+func (c *Client) Poll(ctx context.Context, apply func(*Snapshot) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	candidate := c.snapshot.Clone()
+	var changed []string // types whose new version is in candidate
+	responses := make(map[string]*DiscoveryResponse)
+	for _, p := range restPaths {
+		var names []string
+		switch p.typeURL {
+		case EndpointType:
+			if names = candidate.edsServiceNames(); len(names) == 0 {
+				candidate.Endpoints = make(map[string]*ClusterLoadAssignment)
+				continue
+			}
+		case RouteType:
+			names = c.routes
+		}
+
+		state := c.state[p.typeURL]
+		resp, err := c.fetch(ctx, p.path, discoveryRequest{
+			VersionInfo:   state.accepted,
+			Node:          node{ID: c.node},
+			ResourceNames: names,
+			TypeURL:       p.typeURL,
+			ResponseNonce: state.nonce,
+			ErrorDetail:   state.nack,
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.typeURL, err)
+		}
+		state.nonce, state.nack = resp.Nonce, nil
+		if resp.VersionInfo == state.accepted || resp.VersionInfo == state.rejected {
+			continue
+		}
+		if err := candidate.Replace(p.typeURL, resp); err != nil {
+			c.reject(resp, err, p.typeURL)
+			return fmt.Errorf("rejected %s version %s: %w", p.typeURL, resp.VersionInfo, err)
+		}
+		changed = append(changed, p.typeURL)
+		responses[p.typeURL] = resp
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	if err := apply(candidate); err != nil {
+		for _, typeURL := range changed {
+			c.reject(responses[typeURL], err, typeURL)
+		}
+		return fmt.Errorf("rejected snapshot: %w", err)
+	}
+	for _, typeURL := range changed {
+		c.state[typeURL].accepted = responses[typeURL].VersionInfo
+		c.state[typeURL].rejected = ""
+	}
+	c.snapshot = candidate
+	return nil
+}
+
+// reject records that a response could not be applied, to report it with the next request
+func (c *Client) reject(resp *DiscoveryResponse, err error, typeURL string) {
+	state := c.state[typeURL]
+	state.rejected = resp.VersionInfo
+	state.nack = &errorDetail{Code: 3, Message: err.Error()} // INVALID_ARGUMENT
+}
+
+// fetch sends a discovery request and parses the response
+func (c *Client) fetch(ctx context.Context, path string, request discoveryRequest) (*DiscoveryResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url.JoinPath(path).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	return ParseDiscoveryResponse(data)
+}
+
+// LoadFile reads a snapshot from a file holding a discovery response (JSON), whose resources
+// may be of any supported type, as for the file-based subscriptions of Envoy
+func LoadFile(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ParseDiscoveryResponse(data)
+	if err != nil {
+		return nil, err
+	}
+	s := NewSnapshot()
+	if err := decodeResources(resp.Resources, "", s.Clusters, s.Endpoints, s.Routes); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// UpdateResolver returns a callback for Run that replaces the endpoint sets of a client
+// resolver with the clusters of each snapshot, so that dialing <cluster>:<port> balances
+// over the endpoints of the cluster
+func UpdateResolver(r *balancer.Resolver) func(*Snapshot) error {
+	return func(s *Snapshot) error {
+		r.SetEndpoints(s.ClusterEndpoints())
+		return nil
+	}
+}
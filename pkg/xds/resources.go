@@ -0,0 +1,380 @@
+// Package xds consumes a subset of the Envoy xDS v3 API (clusters, endpoints and route
+// configurations in their JSON form), so that control planes written for service meshes can
+// drive aRPC clients and proxies. Only the fields aRPC has a use for are read; others are
+// ignored.
+package xds
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Type URLs of the supported resources
+const (
+	ClusterType  = "type.googleapis.com/envoy.config.cluster.v3.Cluster"
+	EndpointType = "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"
+	RouteType    = "type.googleapis.com/envoy.config.route.v3.RouteConfiguration"
+)
+
+// Cluster is a CDS resource: a named group of upstream endpoints. Endpoints of EDS clusters
+// come from the ClusterLoadAssignment of their service name, the others from LoadAssignment.
+type Cluster struct {
+	Name             string                 `json:"name"`
+	Type             string                 `json:"type,omitempty"`     // STATIC, STRICT_DNS, LOGICAL_DNS or EDS
+	LbPolicy         string                 `json:"lbPolicy,omitempty"` // e.g. ROUND_ROBIN or RING_HASH
+	EdsClusterConfig *EdsClusterConfig      `json:"edsClusterConfig,omitempty"`
+	LoadAssignment   *ClusterLoadAssignment `json:"loadAssignment,omitempty"`
+}
+
+// EdsClusterConfig names the ClusterLoadAssignment of an EDS cluster
+type EdsClusterConfig struct {
+	ServiceName string `json:"serviceName,omitempty"` // defaults to the cluster name
+}
+
+// serviceName returns the name of the ClusterLoadAssignment of the cluster
+func (c *Cluster) serviceName() string {
+	if c.EdsClusterConfig != nil && c.EdsClusterConfig.ServiceName != "" {
+		return c.EdsClusterConfig.ServiceName
+	}
+	return c.Name
+}
+
+// ClusterLoadAssignment is an EDS resource: the endpoints of a cluster, by locality
+type ClusterLoadAssignment struct {
+	ClusterName string              `json:"clusterName"`
+	Endpoints   []LocalityEndpoints `json:"endpoints,omitempty"`
+}
+
+// LocalityEndpoints are the endpoints of a locality. Lower priorities are preferred.
+type LocalityEndpoints struct {
+	Priority    uint32       `json:"priority,omitempty"`
+	LbEndpoints []LbEndpoint `json:"lbEndpoints,omitempty"`
+}
+
+// LbEndpoint is an endpoint with its health status
+type LbEndpoint struct {
+	Endpoint     Endpoint `json:"endpoint"`
+	HealthStatus string   `json:"healthStatus,omitempty"` // UNKNOWN, HEALTHY, UNHEALTHY, DRAINING, TIMEOUT or DEGRADED
+}
+
+// Endpoint is the address of an upstream host
+type Endpoint struct {
+	Address Address `json:"address"`
+}
+
+// Address is a socket address
+type Address struct {
+	SocketAddress SocketAddress `json:"socketAddress"`
+}
+
+// SocketAddress is a host (an IP or a name) and port
+type SocketAddress struct {
+	Address   string `json:"address"`
+	PortValue uint32 `json:"portValue"`
+}
+
+// healthy reports whether an endpoint may receive requests
+func (e *LbEndpoint) healthy() bool {
+	switch e.HealthStatus {
+	case "UNHEALTHY", "DRAINING", "TIMEOUT":
+		return false
+	}
+	return true
+}
+
+// Addresses returns the healthy endpoints (host:port) of the preferred priority, the lowest
+// one that has any
+func (a *ClusterLoadAssignment) Addresses() []string {
+	var addrs []string
+	best := uint32(0)
+	for _, locality := range a.Endpoints {
+		if addrs != nil && locality.Priority > best {
+			continue
+		}
+		for _, e := range locality.LbEndpoints {
+			if !e.healthy() {
+				continue
+			}
+			if addrs == nil || locality.Priority < best {
+				addrs, best = []string{}, locality.Priority
+			}
+			s := e.Endpoint.Address.SocketAddress
+			addrs = append(addrs, net.JoinHostPort(s.Address, strconv.FormatUint(uint64(s.PortValue), 10)))
+		}
+	}
+	return addrs
+}
+
+// RouteConfiguration is an RDS resource
+type RouteConfiguration struct {
+	Name         string        `json:"name"`
+	VirtualHosts []VirtualHost `json:"virtualHosts,omitempty"`
+}
+
+// VirtualHost is a group of routes for a set of domains
+type VirtualHost struct {
+	Name    string   `json:"name"`
+	Domains []string `json:"domains,omitempty"`
+	Routes  []Route  `json:"routes,omitempty"`
+}
+
+// Route sends the requests it matches to a cluster
+type Route struct {
+	Match RouteMatch  `json:"match"`
+	Route RouteAction `json:"route"`
+}
+
+// RouteMatch matches requests by path (exactly) or path prefix
+type RouteMatch struct {
+	Prefix string `json:"prefix,omitempty"`
+	Path   string `json:"path,omitempty"`
+}
+
+// RouteAction names the cluster of a route
+type RouteAction struct {
+	Cluster string `json:"cluster"`
+}
+
+// resource is a resource of a discovery response, an Any with its type URL
+type resource struct {
+	Type string `json:"@type"`
+}
+
+// DiscoveryResponse is the response of a (REST) discovery request, and the format of files
+// read by LoadFile
+type DiscoveryResponse struct {
+	VersionInfo string            `json:"versionInfo,omitempty"`
+	Resources   []json.RawMessage `json:"resources"`
+	TypeURL     string            `json:"typeUrl,omitempty"`
+	Nonce       string            `json:"nonce,omitempty"`
+}
+
+// ParseDiscoveryResponse parses a discovery response. Field names may be in lowerCamelCase
+// (the proto JSON mapping) or snake_case (as in Envoy configuration files).
+func ParseDiscoveryResponse(data []byte) (*DiscoveryResponse, error) {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid discovery response: %w", err)
+	}
+	data, err := json.Marshal(camelCaseKeys(raw))
+	if err != nil {
+		return nil, err
+	}
+	var resp DiscoveryResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("invalid discovery response: %w", err)
+	}
+	return &resp, nil
+}
+
+// camelCaseKeys converts the snake_case keys of a decoded JSON value to lowerCamelCase
+func camelCaseKeys(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			parts := strings.Split(key, "_")
+			for i := 1; i < len(parts); i++ {
+				if parts[i] != "" {
+					parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+				}
+			}
+			out[strings.Join(parts, "")] = camelCaseKeys(value)
+		}
+		return out
+	case []any:
+		for i, value := range v {
+			v[i] = camelCaseKeys(value)
+		}
+	}
+	return v
+}
+
+// Snapshot is the set of resources known to a client, by name
+type Snapshot struct {
+	Clusters  map[string]*Cluster
+	Endpoints map[string]*ClusterLoadAssignment
+	Routes    map[string]*RouteConfiguration
+}
+
+// NewSnapshot creates an empty snapshot
+func NewSnapshot() *Snapshot {
+	return &Snapshot{
+		Clusters:  make(map[string]*Cluster),
+		Endpoints: make(map[string]*ClusterLoadAssignment),
+		Routes:    make(map[string]*RouteConfiguration),
+	}
+}
+
+// Clone returns a copy of the snapshot sharing its resources
+func (s *Snapshot) Clone() *Snapshot {
+	c := NewSnapshot()
+	for name, r := range s.Clusters {
+		c.Clusters[name] = r
+	}
+	for name, r := range s.Endpoints {
+		c.Endpoints[name] = r
+	}
+	for name, r := range s.Routes {
+		c.Routes[name] = r
+	}
+	return c
+}
+
+// Replace replaces the resources of the given type with those of resp, as state-of-the-world
+// responses do. Resources of other types in resp are rejected.
+func (s *Snapshot) Replace(typeURL string, resp *DiscoveryResponse) error {
+	clusters := make(map[string]*Cluster)
+	endpoints := make(map[string]*ClusterLoadAssignment)
+	routes := make(map[string]*RouteConfiguration)
+	if err := decodeResources(resp.Resources, typeURL, clusters, endpoints, routes); err != nil {
+		return err
+	}
+	switch typeURL {
+	case ClusterType:
+		s.Clusters = clusters
+	case EndpointType:
+		s.Endpoints = endpoints
+	case RouteType:
+		s.Routes = routes
+	default:
+		return fmt.Errorf("unsupported resource type %s", typeURL)
+	}
+	return nil
+}
+
+// decodeResources decodes resources into the maps of their types. Resources of a type other
+// than typeURL are rejected, unless typeURL is empty.
+func decodeResources(resources []json.RawMessage, typeURL string, clusters map[string]*Cluster, endpoints map[string]*ClusterLoadAssignment, routes map[string]*RouteConfiguration) error {
+	for i, data := range resources {
+		var r resource
+		if err := json.Unmarshal(data, &r); err != nil {
+			return fmt.Errorf("resource %d: %w", i, err)
+		}
+		if typeURL != "" && r.Type != typeURL {
+			return fmt.Errorf("resource %d: type %q in a response of type %s", i, r.Type, typeURL)
+		}
+		var name string
+		var err error
+		switch r.Type {
+		case ClusterType:
+			var c Cluster
+			if err = json.Unmarshal(data, &c); err == nil {
+				name, clusters[c.Name] = c.Name, &c
+			}
+		case EndpointType:
+			var a ClusterLoadAssignment
+			if err = json.Unmarshal(data, &a); err == nil {
+				name, endpoints[a.ClusterName] = a.ClusterName, &a
+			}
+		case RouteType:
+			var rc RouteConfiguration
+			if err = json.Unmarshal(data, &rc); err == nil {
+				name, routes[rc.Name] = rc.Name, &rc
+			}
+		default:
+			return fmt.Errorf("resource %d: unsupported type %q", i, r.Type)
+		}
+		if err != nil {
+			return fmt.Errorf("resource %d: %w", i, err)
+		}
+		if name == "" {
+			return fmt.Errorf("resource %d: missing name", i)
+		}
+	}
+	return nil
+}
+
+// ClusterAddresses returns the healthy endpoints (host:port) of a cluster, from its
+// ClusterLoadAssignment for EDS clusters and from its inline load assignment otherwise
+func (s *Snapshot) ClusterAddresses(name string) ([]string, error) {
+	c, ok := s.Clusters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown cluster %q", name)
+	}
+	assignment := c.LoadAssignment
+	if c.Type == "EDS" {
+		if assignment, ok = s.Endpoints[c.serviceName()]; !ok {
+			return nil, fmt.Errorf("no endpoints for EDS cluster %q", name)
+		}
+	}
+	if assignment == nil {
+		return nil, nil
+	}
+	return assignment.Addresses(), nil
+}
+
+// ClusterEndpoints returns the healthy endpoints of every cluster whose hosts are IP
+// addresses, keyed by cluster name, in the form taken by balancer.Resolver.SetEndpoints.
+// Clusters whose endpoints are unknown yet, or given by host name, are left out.
+func (s *Snapshot) ClusterEndpoints() map[string][]*net.UDPAddr {
+	endpoints := make(map[string][]*net.UDPAddr)
+clusters:
+	for name := range s.Clusters {
+		addrs, err := s.ClusterAddresses(name)
+		if err != nil || len(addrs) == 0 {
+			continue
+		}
+		udpAddrs := make([]*net.UDPAddr, 0, len(addrs))
+		for _, addr := range addrs {
+			host, port, _ := net.SplitHostPort(addr)
+			ip := net.ParseIP(host)
+			if ip == nil {
+				continue clusters // resolved through DNS instead
+			}
+			p, _ := strconv.Atoi(port)
+			udpAddrs = append(udpAddrs, &net.UDPAddr{IP: ip, Port: p})
+		}
+		endpoints[name] = udpAddrs
+	}
+	return endpoints
+}
+
+// ShardLeaders maps the routes of a route configuration to a shard->leader map, in the form
+// taken by the leader routing element of the proxy. Each route names a shard by its exact
+// path (or prefix) without the leading slash, e.g. {"match": {"path": "/3"}}, and its
+// cluster holds the leader of the shard as the first healthy endpoint.
+func (s *Snapshot) ShardLeaders(routeConfig string) (map[string]string, error) {
+	rc, ok := s.Routes[routeConfig]
+	if !ok {
+		return nil, fmt.Errorf("unknown route configuration %q", routeConfig)
+	}
+	leaders := make(map[string]string)
+	for _, vh := range rc.VirtualHosts {
+		for _, route := range vh.Routes {
+			shard := route.Match.Path
+			if shard == "" {
+				shard = route.Match.Prefix
+			}
+			shard = strings.TrimPrefix(shard, "/")
+			if shard == "" {
+				return nil, fmt.Errorf("route to cluster %q of virtual host %q names no shard", route.Route.Cluster, vh.Name)
+			}
+			addrs, err := s.ClusterAddresses(route.Route.Cluster)
+			if err != nil {
+				return nil, fmt.Errorf("shard %s: %w", shard, err)
+			}
+			if len(addrs) == 0 {
+				continue // no healthy leader; requests of the shard are rejected
+			}
+			leaders[shard] = addrs[0]
+		}
+	}
+	return leaders, nil
+}
+
+// edsServiceNames returns the names of the ClusterLoadAssignments of EDS clusters, sorted
+func (s *Snapshot) edsServiceNames() []string {
+	var names []string
+	for _, c := range s.Clusters {
+		if c.Type == "EDS" {
+			names = append(names, c.serviceName())
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
@@ -0,0 +1,257 @@
+package xds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/appnet-org/arpc/pkg/transport/balancer"
+	"github.com/appnet-org/arpc/pkg/transport/balancer/roundrobin"
+)
+
+// clusters is a CDS response in the snake_case form of Envoy configuration files
+const clusters = `{
+  "version_info": "c1",
+  "resources": [
+    {"@type": "type.googleapis.com/envoy.config.cluster.v3.Cluster", "name": "kv", "type": "EDS",
+     "eds_cluster_config": {"service_name": "kv-endpoints"}, "lb_policy": "ROUND_ROBIN"},
+    {"@type": "type.googleapis.com/envoy.config.cluster.v3.Cluster", "name": "shard-0", "type": "STATIC",
+     "load_assignment": {"cluster_name": "shard-0", "endpoints": [{"lb_endpoints": [
+       {"endpoint": {"address": {"socket_address": {"address": "10.0.1.1", "port_value": 9000}}}}]}]}}
+  ]
+}`
+
+// endpoints is an EDS response in the proto JSON form, with a standby priority and an
+// unhealthy endpoint
+const endpoints = `{
+  "versionInfo": "e1",
+  "resources": [
+    {"@type": "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment", "clusterName": "kv-endpoints",
+     "endpoints": [
+       {"priority": 1, "lbEndpoints": [{"endpoint": {"address": {"socketAddress": {"address": "10.0.9.9", "portValue": 9000}}}}]},
+       {"lbEndpoints": [
+         {"endpoint": {"address": {"socketAddress": {"address": "10.0.0.1", "portValue": 9000}}}, "healthStatus": "HEALTHY"},
+         {"endpoint": {"address": {"socketAddress": {"address": "10.0.0.2", "portValue": 9001}}}},
+         {"endpoint": {"address": {"socketAddress": {"address": "10.0.0.3", "portValue": 9000}}}, "healthStatus": "UNHEALTHY"}]}]}
+  ]
+}`
+
+const routes = `{
+  "versionInfo": "r1",
+  "resources": [
+    {"@type": "type.googleapis.com/envoy.config.route.v3.RouteConfiguration", "name": "leaders",
+     "virtualHosts": [{"name": "kv", "domains": ["*"], "routes": [
+       {"match": {"path": "/0"}, "route": {"cluster": "shard-0"}},
+       {"match": {"prefix": "/1"}, "route": {"cluster": "kv"}}]}]}
+  ]
+}`
+
+func TestSnapshot(t *testing.T) {
+	s := NewSnapshot()
+	for typeURL, body := range map[string]string{ClusterType: clusters, EndpointType: endpoints, RouteType: routes} {
+		resp, err := ParseDiscoveryResponse([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseDiscoveryResponse failed: %v", err)
+		}
+		if err := s.Replace(typeURL, resp); err != nil {
+			t.Fatalf("Replace(%s) failed: %v", typeURL, err)
+		}
+	}
+
+	addrs, err := s.ClusterAddresses("kv")
+	if err != nil {
+		t.Fatalf("ClusterAddresses failed: %v", err)
+	}
+	if fmt.Sprint(addrs) != "[10.0.0.1:9000 10.0.0.2:9001]" {
+		t.Errorf("ClusterAddresses(kv) = %v, want the healthy endpoints of priority 0", addrs)
+	}
+	if c := s.Clusters["kv"]; c.LbPolicy != "ROUND_ROBIN" {
+		t.Errorf("Expected the snake_case lb_policy to be read, got %+v", c)
+	}
+	if _, err := s.ClusterAddresses("missing"); err == nil {
+		t.Error("Expected error for an unknown cluster")
+	}
+
+	endpoints := s.ClusterEndpoints()
+	if len(endpoints) != 2 || len(endpoints["kv"]) != 2 || endpoints["shard-0"][0].String() != "10.0.1.1:9000" {
+		t.Errorf("ClusterEndpoints() = %v", endpoints)
+	}
+
+	leaders, err := s.ShardLeaders("leaders")
+	if err != nil {
+		t.Fatalf("ShardLeaders failed: %v", err)
+	}
+	if len(leaders) != 2 || leaders["0"] != "10.0.1.1:9000" || leaders["1"] != "10.0.0.1:9000" {
+		t.Errorf("ShardLeaders() = %v", leaders)
+	}
+
+	// A response of one type cannot carry resources of another
+	resp, _ := ParseDiscoveryResponse([]byte(routes))
+	if err := s.Replace(ClusterType, resp); err == nil {
+		t.Error("Expected error for route configurations in a clusters response")
+	}
+	if len(s.Clusters) != 2 {
+		t.Errorf("Expected a rejected response to leave the snapshot unchanged, got %d clusters", len(s.Clusters))
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xds.json")
+	c, _ := ParseDiscoveryResponse([]byte(clusters))
+	e, _ := ParseDiscoveryResponse([]byte(endpoints))
+	combined, err := json.Marshal(DiscoveryResponse{Resources: append(c.Resources, e.Resources...)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, combined, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if len(s.Clusters) != 2 || len(s.Endpoints) != 1 {
+		t.Errorf("LoadFile() = %d clusters and %d assignments, want 2 and 1", len(s.Clusters), len(s.Endpoints))
+	}
+}
+
+func TestResolverEndpoints(t *testing.T) {
+	s := NewSnapshot()
+	resp, _ := ParseDiscoveryResponse([]byte(clusters))
+	s.Replace(ClusterType, resp)
+	resp, _ = ParseDiscoveryResponse([]byte(endpoints))
+	s.Replace(EndpointType, resp)
+
+	r := balancer.NewResolver(roundrobin.NewRoundRobinBalancer(), false, 0)
+	if err := UpdateResolver(r)(s); err != nil {
+		t.Fatalf("UpdateResolver failed: %v", err)
+	}
+	seen := make(map[string]bool)
+	for range 4 {
+		addr, err := r.ResolveUDPTarget("kv:1234")
+		if err != nil {
+			t.Fatalf("ResolveUDPTarget failed: %v", err)
+		}
+		seen[addr.String()] = true
+	}
+	if len(seen) != 2 || !seen["10.0.0.1:9000"] || !seen["10.0.0.2:9001"] {
+		t.Errorf("Expected requests balanced over the endpoints of kv with their ports, got %v", seen)
+	}
+
+	r.SetEndpoints(nil)
+	if _, err := r.ResolveUDPTarget("kv.invalid:1234"); err == nil {
+		t.Error("Expected DNS lookup once the endpoint sets are removed")
+	}
+}
+
+// fakeServer is a REST xDS management server recording the requests it receives
+type fakeServer struct {
+	mu        sync.Mutex
+	responses map[string]string // by path
+	requests  []discoveryRequest
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req discoveryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+	body, ok := f.responses[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprint(w, body)
+}
+
+func (f *fakeServer) last(typeURL string) discoveryRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.requests) - 1; i >= 0; i-- {
+		if f.requests[i].TypeURL == typeURL {
+			return f.requests[i]
+		}
+	}
+	return discoveryRequest{}
+}
+
+func TestClient(t *testing.T) {
+	server := &fakeServer{responses: map[string]string{
+		"/xds/v3/discovery:clusters":  clusters,
+		"/xds/v3/discovery:endpoints": endpoints,
+		"/xds/v3/discovery:routes":    routes,
+	}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL+"/xds", "proxy-1", "leaders")
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	applied := 0
+	apply := func(s *Snapshot) error {
+		applied++
+		if _, err := s.ShardLeaders("leaders"); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	ctx := context.Background()
+	if err := c.Poll(ctx, apply); err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+	if applied != 1 || len(c.Snapshot().Endpoints) != 1 {
+		t.Fatalf("Expected one complete snapshot applied, got %d applications and %+v", applied, c.Snapshot())
+	}
+	if req := server.last(EndpointType); req.Node.ID != "proxy-1" || fmt.Sprint(req.ResourceNames) != "[kv-endpoints]" {
+		t.Errorf("Expected endpoints requested for the EDS service names, got %+v", req)
+	}
+
+	// Unchanged versions are acknowledged and not applied again
+	if err := c.Poll(ctx, apply); err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+	if applied != 1 {
+		t.Errorf("Expected unchanged versions not to be applied, got %d applications", applied)
+	}
+	if req := server.last(RouteType); req.VersionInfo != "r1" || req.ErrorDetail != nil {
+		t.Errorf("Expected an ack of r1, got %+v", req)
+	}
+
+	// A route configuration naming an unknown cluster is rejected (nack), and the previous
+	// snapshot stays in effect
+	server.mu.Lock()
+	server.responses["/xds/v3/discovery:routes"] = strings.NewReplacer(`"r1"`, `"r2"`, `"shard-0"`, `"shard-9"`).Replace(routes)
+	server.mu.Unlock()
+	if err := c.Poll(ctx, apply); err == nil {
+		t.Fatal("Expected the snapshot to be rejected")
+	}
+	if err := c.Poll(ctx, apply); err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+	if applied != 2 {
+		t.Errorf("Expected a rejected version not to be applied again, got %d applications", applied)
+	}
+	if req := server.last(RouteType); req.VersionInfo != "r1" || req.ErrorDetail == nil || !strings.Contains(req.ErrorDetail.Message, "shard-9") {
+		t.Errorf("Expected a nack of r2 keeping r1 as the accepted version, got %+v", req)
+	}
+	if leaders, _ := c.Snapshot().ShardLeaders("leaders"); leaders["0"] != "10.0.1.1:9000" {
+		t.Errorf("Expected the previous snapshot to stay in effect, got %v", leaders)
+	}
+
+	if _, err := NewClient("localhost:1", "proxy-1"); err == nil {
+		t.Error("Expected error for a URL without scheme")
+	}
+}
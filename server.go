@@ -0,0 +1,70 @@
+package arpc
+
+import (
+	"context"
+	"net"
+
+	"github.com/appnet-org/arpc/pkg/rpc"
+)
+
+type (
+	// Server serves the services registered with it, created by NewServer
+	Server = rpc.Server
+	// ServiceDesc describes a service and its methods, as generated code registers it
+	ServiceDesc = rpc.ServiceDesc
+	// MethodDesc describes a method of a service
+	MethodDesc = rpc.MethodDesc
+	// MethodHandler is the function generated code registers for a method
+	MethodHandler = rpc.MethodHandler
+	// MethodOptions are the settings the server enforces for the calls of one method
+	MethodOptions = rpc.MethodOptions
+	// Mux registers handlers by service and method name, for services built without
+	// generated code
+	Mux = rpc.Mux
+	// HandlerFunc handles the calls of a method registered on a Mux
+	HandlerFunc = rpc.HandlerFunc
+	// Middleware wraps the handlers of a Mux
+	Middleware = rpc.Middleware
+)
+
+// ServiceRegistrar is the API of a server that generated RegisterXxxServer functions and
+// applications call: the stable subset of Server
+type ServiceRegistrar interface {
+	// RegisterService registers a service and its methods with the server
+	RegisterService(desc *ServiceDesc, impl any)
+	// Start serves incoming requests; it does not return
+	Start()
+}
+
+var _ ServiceRegistrar = (*Server)(nil)
+
+// UserAgentKey is the incoming metadata key under which servers expose the user agent a
+// client set with WithUserAgent
+const UserAgentKey = rpc.UserAgentKey
+
+// NewServer creates a server listening on addr, with the given serializer and RPC elements.
+// The optional enableEncryption enables encryption with the default keys.
+func NewServer(addr string, s Serializer, elements []Element, enableEncryption ...bool) (*Server, error) {
+	return rpc.NewServer(addr, s, elements, enableEncryption...)
+}
+
+// NewMux creates an empty mux
+func NewMux() *Mux {
+	return rpc.NewMux()
+}
+
+// HandleFunc registers fn for the calls of service.method on m, decoding requests into a
+// new Req
+func HandleFunc[Req, Resp any](m *Mux, service, method string, fn func(context.Context, *Req) (*Resp, error), opts ...MethodOptions) {
+	rpc.HandleFunc(m, service, method, fn, opts...)
+}
+
+// MethodFromContext returns the service and method of a call dispatched by a Mux
+func MethodFromContext(ctx context.Context) (service, method string, ok bool) {
+	return rpc.MethodFromContext(ctx)
+}
+
+// PeerFromContext returns the address of the client of the RPC a handler is serving
+func PeerFromContext(ctx context.Context) (*net.UDPAddr, bool) {
+	return rpc.PeerFromContext(ctx)
+}
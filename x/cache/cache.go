@@ -0,0 +1,25 @@
+// Package cache exposes the client-side response cache. It is experimental; see package
+// github.com/appnet-org/arpc/x.
+package cache
+
+import (
+	"time"
+
+	"github.com/appnet-org/arpc"
+	"github.com/appnet-org/arpc/pkg/rpc"
+)
+
+// ResponseCache is an LRU cache of call responses, set on a client with SetResponseCache
+type ResponseCache = rpc.ResponseCache
+
+// New creates a cache of at most maxEntries responses of at most maxBytes in total
+// (0: no limit)
+func New(maxEntries, maxBytes int) *ResponseCache {
+	return rpc.NewResponseCache(maxEntries, maxBytes)
+}
+
+// WithTTL caches the response of a call for ttl, so only idempotent methods whose responses
+// may be stale for ttl should use it
+func WithTTL(ttl time.Duration) arpc.CallOption {
+	return rpc.WithCacheTTL(ttl)
+}
@@ -0,0 +1,9 @@
+// Package x is the root of the experimental APIs of aRPC. The packages under it expose
+// features that are still changing: they may be renamed, changed incompatibly or removed in
+// any release, without a major version bump. Once an API settles, it moves to the stable
+// package github.com/appnet-org/arpc, and its x/ counterpart is deprecated for a release
+// before it is removed.
+//
+// Depending on an x/ package is an explicit choice: its import path says that upgrades may
+// need code changes.
+package x
@@ -0,0 +1,59 @@
+// Package transport exposes the extension points of the aRPC transport: custom packet types,
+// the handlers run on them, and the transport of a client or server. It is experimental; see
+// package github.com/appnet-org/arpc/x.
+package transport
+
+import (
+	"github.com/appnet-org/arpc"
+	"github.com/appnet-org/arpc/pkg/packet"
+	"github.com/appnet-org/arpc/pkg/rpc"
+	"github.com/appnet-org/arpc/pkg/transport"
+)
+
+type (
+	// UDPTransport is the transport of a client or server
+	UDPTransport = transport.UDPTransport
+	// Handler processes the packets of a type as they are sent and received
+	Handler = transport.Handler
+	// HandlerChain is a chain of handlers for a packet type
+	HandlerChain = transport.HandlerChain
+	// Role says whether handlers run on the client or server side
+	Role = transport.Role
+	// PacketCodec serializes and deserializes the packets of a custom type
+	PacketCodec = packet.PacketCodec
+	// PacketType is a registered packet type
+	PacketType = packet.PacketType
+	// PacketTypeID is the ID of a packet type on the wire
+	PacketTypeID = packet.PacketTypeID
+)
+
+const (
+	RoleClient = transport.RoleClient
+	RoleServer = transport.RoleServer
+)
+
+// Extensible is implemented by clients and servers that take custom packet types and handlers
+type Extensible interface {
+	RegisterPacketType(packetType string, codec PacketCodec) (PacketType, error)
+	RegisterPacketTypeWithID(packetType string, id PacketTypeID, codec PacketCodec) (PacketType, error)
+	RegisterHandler(packetTypeID PacketTypeID, handler Handler, role Role)
+	RegisterHandlerChain(packetTypeID PacketTypeID, chain *HandlerChain, role Role)
+	GetRegisteredPackets() []PacketType
+	GetTransport() *UDPTransport
+}
+
+var (
+	_ Extensible = (*arpc.Client)(nil)
+	_ Extensible = (*arpc.Server)(nil)
+)
+
+// NewHandlerChain creates a chain of handlers
+func NewHandlerChain(name string, handlers ...Handler) *HandlerChain {
+	return transport.NewHandlerChain(name, handlers...)
+}
+
+// WithFlowPorts sends the packets of each call from one of n additional local ports, picked
+// by RPC ID, so that L4 load balancers keep the fragments of a call on one proxy replica
+func WithFlowPorts(n int) arpc.DialOption {
+	return rpc.WithFlowPorts(n)
+}